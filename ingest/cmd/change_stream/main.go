@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/greenearth/ingest/internal/change_stream"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func main() {
+	// Parse command line flags
+	port := flag.Int("port", 8090, "Port for the WebSocket stream server")
+	skipTLSVerify := flag.Bool("skip-tls-verify", false, "Skip TLS certificate verification (use for local development only)")
+	debug := flag.Bool("debug", false, "Enable debug logging")
+	flag.Parse()
+
+	// Load configuration
+	config := common.LoadConfig()
+	logger := common.NewLogger(config.LoggingEnabled)
+	logger.SetService("change_stream")
+	logger.SetDebugEnabled(*debug)
+	otelCollector, err := common.NewOTelMetricCollector("change-stream", config.Environment, config.GCPProjectID, config.GCPRegion, config.MetricExportIntervalSec)
+	if err != nil {
+		logger.Error("Failed to create OTel metric collector: %v (continuing without metrics)", err)
+	} else {
+		logger.SetMetricCollector(otelCollector)
+		defer func() {
+			if err := otelCollector.Shutdown(context.Background()); err != nil {
+				logger.Error("Failed to shutdown OTel metric collector: %v", err)
+			}
+		}()
+	}
+
+	logger.Info("Green Earth Ingex - Change Stream Service")
+
+	// Validate configuration
+	if config.ElasticsearchURL == "" {
+		logger.Error("GE_ELASTICSEARCH_URL environment variable is required")
+		os.Exit(1)
+	}
+	if config.ChangeStreamQueriesPath == "" {
+		logger.Error("GE_CHANGE_STREAM_QUERIES environment variable is required")
+		os.Exit(1)
+	}
+
+	// Setup context with cancellation for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Start health check server
+	healthServer, err := common.NewHealthServer(8080, 8089, logger)
+	if err != nil {
+		logger.Error("Failed to create health server: %v", err)
+		os.Exit(1)
+	}
+	go func() {
+		if err := healthServer.Start(ctx); err != nil {
+			logger.Error("Health server failed: %v", err)
+			cancel()
+		}
+	}()
+
+	// Handle shutdown signals
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		logger.Info("Received signal %v, shutting down gracefully...", sig)
+		cancel()
+	}()
+
+	if err := runServer(ctx, config, logger, healthServer, *port, *skipTLSVerify); err != nil {
+		logger.Error("Change stream server failed: %v", err)
+		os.Exit(1)
+	}
+
+	logger.Info("Change stream server stopped")
+}
+
+func runServer(ctx context.Context, config *common.Config, logger *common.IngestLogger, healthServer *common.HealthServer, port int, skipTLSVerify bool) error {
+	queries, err := change_stream.LoadQueries(config.ChangeStreamQueriesPath)
+	if err != nil {
+		return err
+	}
+	logger.Info("Loaded %d stored queries from %s", len(queries), config.ChangeStreamQueriesPath)
+
+	esConfig := common.ElasticsearchConfig{
+		URL:           config.ElasticsearchURL,
+		APIKey:        config.ElasticsearchAPIKey,
+		SkipTLSVerify: skipTLSVerify || config.ElasticsearchTLSSkipVerify,
+	}
+
+	esClient, err := common.NewElasticsearchClient(esConfig, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create Elasticsearch client: %w", err)
+	}
+
+	var allowedOrigins []string
+	for _, origin := range strings.Split(config.ChangeStreamAllowedOrigins, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			allowedOrigins = append(allowedOrigins, origin)
+		}
+	}
+
+	streamServer := change_stream.NewServer(esClient, queries, change_stream.Config{
+		PollInterval:   config.ChangeStreamPollInterval,
+		AllowedOrigins: allowedOrigins,
+	}, logger)
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           streamServer.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		logger.Info("Change stream listening on :%d", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errChan <- err
+		}
+		close(errChan)
+	}()
+
+	healthServer.SetHealthy(true, fmt.Sprintf("Streaming %d stored queries", len(queries)))
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	return server.Shutdown(shutdownCtx)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func main() {
+	// Parse command line flags
+	source := flag.String("source", "", "Dead-letter destination to replay: local directory or gs://bucket/prefix (default: GE_DLQ_DESTINATION)")
+	dryRun := flag.Bool("dry-run", false, "List dead letters without re-submitting or removing them")
+	keep := flag.Bool("keep", false, "Keep dead-letter files after a successful replay")
+	skipTLSVerify := flag.Bool("skip-tls-verify", false, "Skip TLS certificate verification (use for local development only)")
+	debug := flag.Bool("debug", false, "Enable debug logging")
+	flag.Parse()
+
+	// Load configuration
+	config := common.LoadConfig()
+	logger := common.NewLogger(config.LoggingEnabled)
+	logger.SetService("dlq_replay")
+	logger.SetDebugEnabled(*debug)
+	otelCollector, err := common.NewOTelMetricCollector("dlq-replay", config.Environment, config.GCPProjectID, config.GCPRegion, config.MetricExportIntervalSec)
+	if err != nil {
+		logger.Error("Failed to create OTel metric collector: %v (continuing without metrics)", err)
+	} else {
+		logger.SetMetricCollector(otelCollector)
+		defer func() {
+			if err := otelCollector.Shutdown(context.Background()); err != nil {
+				logger.Error("Failed to shutdown OTel metric collector: %v", err)
+			}
+		}()
+	}
+
+	logger.Info("Green Earth Ingex - Dead-Letter Replay Tool")
+	if *dryRun {
+		logger.Info("Running in DRY-RUN mode - no writes to Elasticsearch")
+	}
+
+	destination := *source
+	if destination == "" {
+		destination = config.DLQDestination
+	}
+	if destination == "" {
+		logger.Error("-source or GE_DLQ_DESTINATION is required")
+		os.Exit(1)
+	}
+
+	// Setup context with cancellation for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Handle shutdown signals
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		logger.Info("Received signal %v, shutting down...", sig)
+		cancel()
+	}()
+
+	if config.ElasticsearchURL == "" {
+		logger.Error("GE_ELASTICSEARCH_URL environment variable is required")
+		os.Exit(1)
+	}
+	esConfig := common.ElasticsearchConfig{
+		URL:           config.ElasticsearchURL,
+		APIKey:        config.ElasticsearchAPIKey,
+		SkipTLSVerify: *skipTLSVerify || config.ElasticsearchTLSSkipVerify,
+	}
+	esClient, err := common.NewElasticsearchClient(esConfig, logger)
+	if err != nil {
+		logger.Error("Failed to create Elasticsearch client: %v", err)
+		os.Exit(1)
+	}
+
+	// Documents rejected again are spooled back to the same destination, so
+	// removing the file they came from loses nothing
+	queue, err := common.NewDeadLetterQueue(ctx, destination, "dlq_replay")
+	if err != nil {
+		logger.Error("Failed to open dead-letter queue: %v", err)
+		os.Exit(1)
+	}
+	defer func() { _ = queue.Close() }()
+	logger.SetDeadLetterQueue(queue)
+
+	paths, err := queue.List(ctx)
+	if err != nil {
+		logger.Error("%v", err)
+		os.Exit(1)
+	}
+	logger.Info("Found %d dead-letter files under %s", len(paths), destination)
+
+	failedFiles := 0
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := replayFile(ctx, esClient, queue, path, *dryRun, *keep, logger); err != nil {
+			logger.Error("Failed to replay %s: %v", path, err)
+			logger.Metric("dlq_replay.file_error_count", 1)
+			failedFiles++
+		}
+	}
+
+	if failedFiles > 0 {
+		logger.Error("%d of %d dead-letter files could not be replayed", failedFiles, len(paths))
+		os.Exit(1)
+	}
+	logger.Info("Dead-letter replay complete")
+}
+
+// replayFile re-submits every dead letter in path to the index it was
+// rejected from, then removes the file. Letters Elasticsearch rejects again
+// are dead-lettered anew by the bulk functions; the file is kept only when
+// that fails. Quarantined malformed rows and unpublished change events have
+// no index to replay into, so files holding them are left for an operator
+// to inspect and remove.
+func replayFile(ctx context.Context, client *elasticsearch.Client, queue *common.DeadLetterQueue, path string, dryRun, keep bool, logger *common.IngestLogger) error {
+	letters, err := queue.Read(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	var indices []string
+	byIndex := make(map[string][]common.RawDoc)
+	quarantined := 0
+	for _, letter := range letters {
+		if letter.Index == "" {
+			quarantined++
+			logger.Debug("%s: quarantined %s (%s): %s", path, letter.ID, letter.ErrorType, letter.ErrorReason)
+			continue
+		}
+		if _, ok := byIndex[letter.Index]; !ok {
+			indices = append(indices, letter.Index)
+		}
+		byIndex[letter.Index] = append(byIndex[letter.Index], common.RawDoc{
+			AtURI:     letter.ID,
+			AuthorDID: letter.Routing,
+			Source:    letter.Source,
+		})
+		logger.Debug("%s: %s %s rejected with %s: %s", path, letter.Index, letter.ID, letter.ErrorType, letter.ErrorReason)
+	}
+
+	if quarantined > 0 {
+		logger.Info("%s holds %d quarantined rows or change events; leaving it in place", path, quarantined)
+		logger.Metric("dlq_replay.quarantined_count", float64(quarantined))
+	}
+
+	if dryRun {
+		for _, index := range indices {
+			logger.Info("Dry-run: would replay %d documents from %s into %s", len(byIndex[index]), path, index)
+		}
+		return nil
+	}
+
+	for _, index := range indices {
+		docs := byIndex[index]
+		err := common.BulkIndex(ctx, client, index, docs, false, logger)
+		var itemsErr *common.BulkItemsError
+		switch {
+		case err == nil:
+			logger.Metric("dlq_replay.replayed_count", float64(len(docs)))
+		case errors.As(err, &itemsErr) && itemsErr.DeadLettered == itemsErr.Failed:
+			logger.Metric("dlq_replay.replayed_count", float64(itemsErr.Processed))
+			logger.Metric("dlq_replay.rejected_count", float64(itemsErr.Failed))
+			logger.Info("%d of %d documents from %s were rejected again and re-spooled", itemsErr.Failed, len(docs), path)
+		default:
+			return err
+		}
+	}
+
+	if keep || quarantined > 0 {
+		return nil
+	}
+	return queue.Remove(ctx, path)
+}
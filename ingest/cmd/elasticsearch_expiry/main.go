@@ -9,6 +9,7 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/elastic/go-elasticsearch/v9"
 	"github.com/greenearth/ingest/internal/common"
 	"github.com/greenearth/ingest/internal/elasticsearch_expiry"
 )
@@ -17,14 +18,18 @@ func main() {
 	// Parse command line flags
 	dryRun := flag.Bool("dry-run", false, "Run in dry-run mode (show what would be deleted without actually deleting)")
 	skipTLSVerify := flag.Bool("skip-tls-verify", false, "Skip TLS certificate verification (use for local development only)")
-	retentionHours := flag.Int("retention-hours", 1440, "Number of hours to retain data (default: 1440 hours = 60 days)")
-	hashtagRetentionHours := flag.Int("hashtag-retention-hours", 0, "Number of hours to retain hashtag data (0 = use retention-hours)")
+	retentionHours := flag.Int("retention-hours", 0, "Number of hours to retain data, overriding the retention policy (0 = use the policy)")
+	hashtagRetentionHours := flag.Int("hashtag-retention-hours", 0, "Number of hours to retain hashtag data (0 = use retention-hours, then the policy)")
 	debug := flag.Bool("debug", false, "Enable debug logging")
+	candidatesOut := flag.String("candidates-out", "", "With --dry-run, write the candidates for deletion to this local path or gs://bucket/object for review")
+	sampleSize := flag.Int("sample-size", 100, "Number of candidate at_uris sampled per collection into --candidates-out")
+	confirmFrom := flag.String("confirm-from", "", "Delete only the candidates in this approved file written by --candidates-out")
 	flag.Parse()
 
 	// Load configuration
 	config := common.LoadConfig()
 	logger := common.NewLogger(config.LoggingEnabled)
+	logger.SetService("elasticsearch_expiry")
 	logger.SetDebugEnabled(*debug)
 	otelCollector, err := common.NewOTelMetricCollector("elasticsearch-expiry", config.Environment, config.GCPProjectID, config.GCPRegion, config.MetricExportIntervalSec)
 	if err != nil {
@@ -39,19 +44,55 @@ func main() {
 	}
 
 	logger.Info("Green Earth Ingex - Elasticsearch Expiry Service")
-	logger.Info("Retention period: %d hours (%.1f days)", *retentionHours, float64(*retentionHours)/24.0)
 
-	// Use retention-hours for hashtags if hashtag-retention-hours not specified
+	policy, err := common.RetentionPolicyFromConfig(context.Background(), config)
+	if err != nil {
+		logger.Error("Failed to load retention policy: %v", err)
+		os.Exit(1)
+	}
+
+	// Flags override the policy for one-off runs
+	hashtagRetention := policy.Windows("hashtags").Delete
 	if *hashtagRetentionHours == 0 {
 		*hashtagRetentionHours = *retentionHours
 	}
-	if *hashtagRetentionHours != *retentionHours {
-		logger.Info("Hashtag retention period: %d hours (%.1f days)", *hashtagRetentionHours, float64(*hashtagRetentionHours)/24.0)
+	if *hashtagRetentionHours > 0 {
+		hashtagRetention = time.Duration(*hashtagRetentionHours) * time.Hour
+		logger.Info("Hashtag retention period overridden by flags: %s", hashtagRetention)
+	}
+	if hashtagRetention <= 0 {
+		logger.Error("%s sets no delete window for hashtags and no retention flag was given", policy.Source)
+		os.Exit(1)
 	}
+	logger.Info("Hashtag retention period: %s (%.1f days, from %s)", hashtagRetention, hashtagRetention.Hours()/24.0, policy.Source)
 
 	if *dryRun {
 		logger.Info("Running in DRY-RUN mode - no documents will be deleted")
 	}
+	if *candidatesOut != "" && !*dryRun {
+		logger.Error("--candidates-out requires --dry-run")
+		os.Exit(1)
+	}
+
+	review := reviewOptions{sampleSize: *sampleSize, candidatesOut: *candidatesOut}
+	if *confirmFrom != "" {
+		if *candidatesOut != "" {
+			logger.Error("--confirm-from and --candidates-out cannot be combined")
+			os.Exit(1)
+		}
+		approved, err := elasticsearch_expiry.ReadCandidateFile(context.Background(), *confirmFrom)
+		if err != nil {
+			logger.Error("Failed to read approved candidates: %v", err)
+			os.Exit(1)
+		}
+		if err := approved.Approved(config.Environment); err != nil {
+			logger.Error("Refusing to delete from %s: %v", *confirmFrom, err)
+			os.Exit(1)
+		}
+		logger.Info("Deleting only the candidates in %s (created %s, approved by %s)",
+			*confirmFrom, approved.CreatedAt.Format(time.RFC3339), approved.ApprovedBy)
+		review.approved = approved
+	}
 
 	// Validate configuration
 	if config.ElasticsearchURL == "" {
@@ -91,7 +132,7 @@ func main() {
 	}()
 
 	// Run the expiry process
-	if err := runExpiry(ctx, config, logger, healthServer, *dryRun, *skipTLSVerify, *retentionHours, *hashtagRetentionHours); err != nil {
+	if err := runExpiry(ctx, config, logger, healthServer, *dryRun, *skipTLSVerify, policy, hashtagRetention, review); err != nil {
 		logger.Error("Expiry process failed: %v", err)
 		logger.Metric("expiry.run_error_count", 1)
 		os.Exit(1)
@@ -100,7 +141,15 @@ func main() {
 	logger.Info("Expiry process completed successfully")
 }
 
-func runExpiry(ctx context.Context, config *common.Config, logger *common.IngestLogger, healthServer *common.HealthServer, dryRun, skipTLSVerify bool, retentionHours, hashtagRetentionHours int) error {
+// reviewOptions select two-person review of deletions: a dry run writes the
+// candidates to a file, and a later run deletes only what that file approves
+type reviewOptions struct {
+	sampleSize    int
+	candidatesOut string                              // Dry-run candidate file to write
+	approved      *elasticsearch_expiry.CandidateFile // Approved candidates to delete, or nil
+}
+
+func runExpiry(ctx context.Context, config *common.Config, logger *common.IngestLogger, healthServer *common.HealthServer, dryRun, skipTLSVerify bool, policy *common.RetentionPolicy, hashtagRetention time.Duration, review reviewOptions) error {
 	runStart := time.Now()
 	logger.Metric("expiry.run_attempted_count", 1)
 	// Default graceful timeout for delete operations during shutdown
@@ -116,34 +165,33 @@ func runExpiry(ctx context.Context, config *common.Config, logger *common.Ingest
 	if err != nil {
 		return fmt.Errorf("failed to create Elasticsearch client: %w", err)
 	}
-
-	// Calculate the cutoff date using hours
-	cutoffDate := time.Now().UTC().Add(-time.Duration(retentionHours) * time.Hour)
-	logger.Info("Deleting documents older than: %s", cutoffDate.Format(time.RFC3339))
-
-	// Initialize the expiry service
-	expiryConfig := elasticsearch_expiry.Config{
-		CutoffDate: cutoffDate,
-		DryRun:     dryRun,
-	}
-
-	expiryService := elasticsearch_expiry.NewService(esClient, expiryConfig, logger)
+	logger.SetAuditLog(common.NewAuditLog(esClient, config))
+	common.CheckAPIKeyPrivileges(ctx, esClient, "elasticsearch_expiry", config, logger)
 
 	// Mark service as healthy once we've successfully initialized
-	healthServer.SetHealthy(true, fmt.Sprintf("Expiring documents older than %d hours (%.1f days)", retentionHours, float64(retentionHours)/24.0))
+	healthServer.SetHealthy(true, fmt.Sprintf("Expiring hashtags older than %s (%.1f days)", hashtagRetention, hashtagRetention.Hours()/24.0))
 
 	// posts, likes, post_tombstones, and like_tombstones are now managed by ILM
-	// (delete-only policy). The expiry service only handles hashtags.
+	// (delete-only policy). The expiry service only handles hashtags, and
+	// reports ILM policies that disagree with the retention policy.
+	checkILMRetention(ctx, elasticsearch_expiry.NewService(esClient, elasticsearch_expiry.Config{DryRun: dryRun}, logger), policy, logger)
 	collections := []elasticsearch_expiry.Collection{}
+	candidates := &elasticsearch_expiry.CandidateFile{Environment: config.Environment, CreatedAt: time.Now().UTC()}
 
 	// Add hashtags collection with separate retention
-	hashtagCutoffDate := time.Now().UTC().Add(-time.Duration(hashtagRetentionHours) * time.Hour)
-	logger.Info("Hashtags: deleting records older than: %s (retention: %d hours / %.1f days)",
-		hashtagCutoffDate.Format(time.RFC3339), hashtagRetentionHours, float64(hashtagRetentionHours)/24.0)
+	hashtagCutoffDate := time.Now().UTC().Add(-hashtagRetention)
+	logger.Info("Hashtags: deleting records older than: %s (retention: %s / %.1f days)",
+		hashtagCutoffDate.Format(time.RFC3339), hashtagRetention, hashtagRetention.Hours()/24.0)
 
 	// Process each collection with graceful shutdown handling
 	totalDeleted := 0
 	for _, collection := range collections {
+		retention := policy.Windows(collection.IndexAlias).Delete
+		if retention <= 0 {
+			logger.Error("%s sets no delete window for %s, skipping it", policy.Source, collection.IndexAlias)
+			continue
+		}
+
 		// Check if shutdown was requested before processing each collection
 		select {
 		case <-ctx.Done():
@@ -172,7 +220,8 @@ func runExpiry(ctx context.Context, config *common.Config, logger *common.Ingest
 		logger.Info("Processing collection: %s (date field: %s)", collection.IndexAlias, collection.DateField)
 		logger.Metric("expiry.collection_attempted_count", 1)
 
-		deletedCount, err := expiryService.ExpireCollection(deleteCtx, collection)
+		// Each collection is expired by its own delete window
+		deletedCount, err := expireCollection(deleteCtx, esClient, logger, collection, time.Now().UTC().Add(-retention), dryRun, review, candidates)
 		deleteCancel() // Clean up the context
 
 		if err != nil {
@@ -213,16 +262,11 @@ func runExpiry(ctx context.Context, config *common.Config, logger *common.Ingest
 
 	logger.Info("Processing collection: hashtags (date field: hour)")
 	logger.Metric("expiry.collection_attempted_count", 1)
-	// Create a separate expiry service instance for hashtags with different cutoff
-	hashtagExpiryConfig := elasticsearch_expiry.Config{
-		CutoffDate: hashtagCutoffDate,
-		DryRun:     dryRun,
-	}
-	hashtagExpiryService := elasticsearch_expiry.NewService(esClient, hashtagExpiryConfig, logger)
-	deletedCount, err := hashtagExpiryService.ExpireCollection(deleteCtx, elasticsearch_expiry.Collection{
+	// Hashtags are expired with their own cutoff
+	deletedCount, err := expireCollection(deleteCtx, esClient, logger, elasticsearch_expiry.Collection{
 		IndexAlias: "hashtags",
 		DateField:  "hour",
-	})
+	}, hashtagCutoffDate, dryRun, review, candidates)
 	deleteCancel()
 
 	if err != nil {
@@ -247,7 +291,66 @@ func runExpiry(ctx context.Context, config *common.Config, logger *common.Ingest
 	}
 	logger.Info("Expiry complete: %d total documents %s across all collections", totalDeleted, action)
 
+	if review.candidatesOut != "" {
+		if err := elasticsearch_expiry.WriteCandidateFile(ctx, review.candidatesOut, candidates); err != nil {
+			return err
+		}
+		logger.Info("Wrote candidates for %d collections to %s; set approved_by after review and run with --confirm-from", len(candidates.Collections), review.candidatesOut)
+	}
+
 	logger.Metric("expiry.run_duration_ms", float64(time.Since(runStart).Milliseconds()))
 	logger.Metric("expiry.run_success_count", 1)
 	return nil
 }
+
+// expireCollection expires one collection's documents older than cutoff. With
+// approved candidates it instead deletes only those approved for the
+// collection, and with a candidate file to write it plans the collection into
+// candidates.
+func expireCollection(ctx context.Context, esClient *elasticsearch.Client, logger *common.IngestLogger, collection elasticsearch_expiry.Collection, cutoff time.Time, dryRun bool, review reviewOptions, candidates *elasticsearch_expiry.CandidateFile) (int, error) {
+	service := elasticsearch_expiry.NewService(esClient, elasticsearch_expiry.Config{
+		CutoffDate: cutoff,
+		DryRun:     dryRun,
+		SampleSize: review.sampleSize,
+	}, logger)
+
+	switch {
+	case review.approved != nil:
+		approved := review.approved.Collection(collection.IndexAlias)
+		if approved == nil {
+			logger.Info("Skipping %s: not in the approved candidates", collection.IndexAlias)
+			return 0, nil
+		}
+		return service.ExpireApproved(ctx, *approved)
+	case review.candidatesOut != "":
+		plan, err := service.Plan(ctx, collection)
+		if err != nil {
+			return 0, err
+		}
+		candidates.Collections = append(candidates.Collections, *plan)
+		return plan.Count, nil
+	default:
+		return service.ExpireCollection(ctx, collection)
+	}
+}
+
+// checkILMRetention reports ILM policies whose delete age differs from the
+// delete window the retention policy sets for their alias. ILM keeps
+// deleting by its own age until index/deploy is updated to match.
+func checkILMRetention(ctx context.Context, service *elasticsearch_expiry.Service, policy *common.RetentionPolicy, logger *common.IngestLogger) {
+	for ilmPolicy, alias := range elasticsearch_expiry.ILMPolicies {
+		want := policy.Windows(alias).Delete
+		if want <= 0 {
+			continue
+		}
+		got, err := service.ILMDeleteAge(ctx, ilmPolicy)
+		if err != nil {
+			logger.Error("Failed to check retention of %s: %v", alias, err)
+			continue
+		}
+		if got != want {
+			logger.Error("ILM policy %s deletes %s after %s but %s sets %s", ilmPolicy, alias, got, policy.Source, want)
+			logger.Metric("expiry.retention_mismatch_count", 1)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/embedding_backfill"
+	"github.com/greenearth/ingest/internal/inference"
+)
+
+func main() {
+	// Parse command line flags
+	index := flag.String("index", embedding_backfill.DefaultIndex, "Posts alias to scan and update")
+	model := flag.String("model", embedding_backfill.DefaultModel, "Embeddings field the embedding service's output is stored under")
+	pageSize := flag.Int("page-size", embedding_backfill.DefaultPageSize, "Posts read, embedded, and updated at a time")
+	interval := flag.Duration("interval", 5*time.Minute, "Time between passes over the posts")
+	once := flag.Bool("once", false, "Make a single pass and exit")
+	dryRun := flag.Bool("dry-run", false, "Count posts missing embeddings without embedding or updating them")
+	skipTLSVerify := flag.Bool("skip-tls-verify", false, "Skip TLS certificate verification (use for local development only)")
+	debug := flag.Bool("debug", false, "Enable debug logging")
+	flag.Parse()
+
+	// Load configuration
+	config := common.LoadConfig()
+	logger := common.NewLogger(config.LoggingEnabled)
+	logger.SetService("embedding_backfill")
+	logger.SetDebugEnabled(*debug)
+	otelCollector, err := common.NewOTelMetricCollector("embedding-backfill", config.Environment, config.GCPProjectID, config.GCPRegion, config.MetricExportIntervalSec)
+	if err != nil {
+		logger.Error("Failed to create OTel metric collector: %v (continuing without metrics)", err)
+	} else {
+		logger.SetMetricCollector(otelCollector)
+		defer func() {
+			if err := otelCollector.Shutdown(context.Background()); err != nil {
+				logger.Error("Failed to shutdown OTel metric collector: %v", err)
+			}
+		}()
+	}
+
+	logger.Info("Green Earth Ingex - Embedding Backfill Service")
+	logger.Info("Environment: %s, index: %s, model: %s, dry run: %v", config.Environment, *index, *model, *dryRun)
+
+	// Validate configuration
+	if config.ElasticsearchURL == "" {
+		logger.Error("GE_ELASTICSEARCH_URL environment variable is required")
+		os.Exit(1)
+	}
+	if config.EmbeddingURL == "" && !*dryRun {
+		logger.Error("GE_EMBEDDING_URL environment variable is required (not needed in dry-run mode)")
+		os.Exit(1)
+	}
+
+	// Setup context with cancellation for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Start health check server
+	healthServer, err := common.NewHealthServer(8080, 8089, logger)
+	if err != nil {
+		logger.Error("Failed to create health server: %v", err)
+		os.Exit(1)
+	}
+	go func() {
+		if err := healthServer.Start(ctx); err != nil {
+			logger.Error("Health server failed: %v", err)
+			cancel()
+		}
+	}()
+
+	// Handle shutdown signals
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		logger.Info("Received signal %v, shutting down gracefully...", sig)
+		cancel()
+	}()
+
+	esClient, err := common.NewElasticsearchClient(common.ElasticsearchConfig{
+		URL:           config.ElasticsearchURL,
+		APIKey:        config.ElasticsearchAPIKey,
+		SkipTLSVerify: *skipTLSVerify || config.ElasticsearchTLSSkipVerify,
+	}, logger)
+	if err != nil {
+		logger.Error("Failed to create Elasticsearch client: %v", err)
+		os.Exit(1)
+	}
+	common.CheckAPIKeyPrivileges(ctx, esClient, "embedding_backfill", config, logger)
+
+	embedder := embedding_backfill.NewClient(embedding_backfill.ClientConfig{
+		URL:        config.EmbeddingURL,
+		APIKey:     config.EmbeddingAPIKey,
+		Timeout:    config.EmbeddingTimeout,
+		MaxRetries: config.EmbeddingRetryMax,
+	}, logger)
+
+	// Post-tower embeddings, as megastream_ingest computes them
+	var postTower *inference.BatchEmbedder
+	if config.InferenceBaseURL != "" {
+		inferenceClient := inference.NewClient(inference.ClientConfig{
+			BaseURL:    config.InferenceBaseURL,
+			APIKey:     config.InferenceAPIKey,
+			Timeout:    config.InferenceTimeout,
+			MaxRetries: config.InferenceRetryMax,
+		}, logger)
+		postTower = inference.NewBatchEmbedder(inferenceClient, config.InferenceChunkSize, config.InferenceMaxConcurrency, logger)
+		logger.Info("Post-tower embeddings enabled via %s", config.InferenceBaseURL)
+	}
+
+	service := embedding_backfill.NewService(esClient, embedder, postTower, embedding_backfill.Config{
+		Index:    *index,
+		Model:    *model,
+		PageSize: *pageSize,
+		DryRun:   *dryRun,
+	}, logger)
+
+	healthServer.SetHealthy(true, fmt.Sprintf("Backfilling %s embeddings of fallback posts in %s", *model, *index))
+	if err := run(ctx, esClient, config, service, *index, *interval, *once, *dryRun, logger); err != nil {
+		logger.Error("Embedding backfill failed: %v", err)
+		os.Exit(1)
+	}
+	logger.Info("Embedding backfill stopped")
+}
+
+// run makes the passes, relaxing refresh and replicas on the indices behind
+// index for a single pass as GE_BULK_REFRESH_INTERVAL and GE_BULK_REPLICAS
+// set. A service that keeps running leaves them alone: it would hold the
+// live posts indices tuned between passes.
+func run(ctx context.Context, esClient *elasticsearch.Client, config *common.Config, service *embedding_backfill.Service, index string, interval time.Duration, once, dryRun bool, logger *common.IngestLogger) error {
+	tuningConfig, err := common.BulkTuningConfigFromConfig(config)
+	if err != nil {
+		return err
+	}
+	switch {
+	case !tuningConfig.Enabled() || dryRun:
+	case !once:
+		logger.Info("Bulk tuning applies to single passes (-once) only; leaving the settings of %s alone", index)
+	default:
+		profile, err := common.IndexProfileFromConfig(config)
+		if err != nil {
+			return fmt.Errorf("invalid index configuration: %w", err)
+		}
+		indices, err := common.BulkTuningIndices(ctx, esClient, []string{index}, logger)
+		if err != nil {
+			return err
+		}
+		indexManager := common.NewIndexManager(esClient, profile, []string{index}, logger)
+		tuning, err := indexManager.TuneForBulk(ctx, "embedding_backfill", indices, tuningConfig)
+		defer tuning.Hold(ctx)()
+		if err != nil {
+			return fmt.Errorf("failed to tune indices for backfill: %w", err)
+		}
+	}
+	return runPasses(ctx, service, interval, once, dryRun, logger)
+}
+
+// runPasses makes a pass over the posts every interval until ctx is done,
+// or a single pass with once. A failed pass is retried on the next
+// interval; with once, it is returned.
+func runPasses(ctx context.Context, service *embedding_backfill.Service, interval time.Duration, once, dryRun bool, logger *common.IngestLogger) error {
+	for {
+		result, err := service.Run(ctx)
+		switch {
+		case ctx.Err() != nil:
+			return nil
+		case err != nil && once:
+			return err
+		case err != nil:
+			logger.Error("Embedding backfill pass failed, retrying in %s: %v", interval, err)
+			logger.Metric("embedding_backfill.run_error_count", 1)
+		case dryRun:
+			logger.Info("Dry-run: %d fallback posts are missing embeddings", result.Scanned)
+		default:
+			logger.Info("Embedding backfill pass: %d scanned, %d updated (%d with post-tower embeddings), %d skipped, %d failed",
+				result.Scanned, result.Updated, result.PostTower, result.Skipped, result.Failed)
+		}
+		if once {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
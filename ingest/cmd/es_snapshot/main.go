@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/es_snapshot"
+)
+
+const (
+	ActionRun      = "run"
+	ActionRegister = "register"
+	ActionSnapshot = "snapshot"
+	ActionVerify   = "verify"
+	ActionPrune    = "prune"
+)
+
+func main() {
+	// Parse command line flags
+	action := flag.String("action", ActionRun, "Action: run (snapshot, verify, prune), register, snapshot, verify, or prune")
+	dryRun := flag.Bool("dry-run", false, "Run in dry-run mode (report actions without changing the cluster)")
+	skipTLSVerify := flag.Bool("skip-tls-verify", false, "Skip TLS certificate verification (use for local development only)")
+	retentionDays := flag.Int("retention-days", 14, "Snapshots older than this many days are pruned")
+	minKeep := flag.Int("min-keep", 3, "Number of newest successful snapshots always kept, regardless of age")
+	snapshotName := flag.String("snapshot", "", "Snapshot to verify (default: newest successful snapshot)")
+	debug := flag.Bool("debug", false, "Enable debug logging")
+	flag.Parse()
+
+	// Load configuration
+	config := common.LoadConfig()
+	logger := common.NewLogger(config.LoggingEnabled)
+	logger.SetService("es_snapshot")
+	logger.SetDebugEnabled(*debug)
+	otelCollector, err := common.NewOTelMetricCollector("es-snapshot", config.Environment, config.GCPProjectID, config.GCPRegion, config.MetricExportIntervalSec)
+	if err != nil {
+		logger.Error("Failed to create OTel metric collector: %v (continuing without metrics)", err)
+	} else {
+		logger.SetMetricCollector(otelCollector)
+		defer func() {
+			if err := otelCollector.Shutdown(context.Background()); err != nil {
+				logger.Error("Failed to shutdown OTel metric collector: %v", err)
+			}
+		}()
+	}
+
+	logger.Info("Green Earth Ingex - Elasticsearch Snapshot Tool")
+	logger.Info("Action: %s, repository: %s", *action, config.SnapshotRepository)
+	if *dryRun {
+		logger.Info("Running in DRY-RUN mode - no changes will be made")
+	}
+
+	// Validate configuration
+	if config.ElasticsearchURL == "" {
+		logger.Error("GE_ELASTICSEARCH_URL environment variable is required")
+		os.Exit(1)
+	}
+
+	// Setup context with cancellation for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Handle shutdown signals
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		logger.Info("Received signal %v, shutting down...", sig)
+		cancel()
+	}()
+
+	esConfig := common.ElasticsearchConfig{
+		URL:           config.ElasticsearchURL,
+		APIKey:        config.ElasticsearchAPIKey,
+		SkipTLSVerify: *skipTLSVerify || config.ElasticsearchTLSSkipVerify,
+	}
+	esClient, err := common.NewElasticsearchClient(esConfig, logger)
+	if err != nil {
+		logger.Error("Failed to create Elasticsearch client: %v", err)
+		os.Exit(1)
+	}
+
+	service := es_snapshot.NewService(esClient, es_snapshot.Config{
+		Repository: config.SnapshotRepository,
+		Bucket:     config.SnapshotBucket,
+		RetainFor:  time.Duration(*retentionDays) * 24 * time.Hour,
+		MinKeep:    *minKeep,
+		DryRun:     *dryRun,
+	}, logger)
+
+	if err := runAction(ctx, service, logger, *action, *snapshotName); err != nil {
+		logger.Error("Snapshot %s failed: %v", *action, err)
+		logger.Metric("snapshot."+*action+"_error_count", 1)
+		os.Exit(1)
+	}
+
+	logger.Metric("snapshot."+*action+"_success_count", 1)
+	logger.Info("Snapshot %s completed successfully", *action)
+}
+
+func runAction(ctx context.Context, service *es_snapshot.Service, logger *common.IngestLogger, action, snapshotName string) error {
+	switch action {
+	case ActionRegister:
+		return service.RegisterRepository(ctx)
+	case ActionSnapshot:
+		_, err := service.CreateSnapshot(ctx, newSnapshotName(time.Now()))
+		return err
+	case ActionVerify:
+		return verify(ctx, service, snapshotName)
+	case ActionPrune:
+		return prune(ctx, service, logger)
+	case ActionRun:
+		snapshot, err := service.CreateSnapshot(ctx, newSnapshotName(time.Now()))
+		if err != nil {
+			return err
+		}
+		if snapshot.State == "" {
+			// Dry-run: no snapshot exists to verify, so verify the newest one instead
+			if err := verify(ctx, service, ""); err != nil {
+				return err
+			}
+		} else if err := service.VerifySnapshot(ctx, snapshot); err != nil {
+			return err
+		}
+		return prune(ctx, service, logger)
+	default:
+		return fmt.Errorf("unknown action %q", action)
+	}
+}
+
+func verify(ctx context.Context, service *es_snapshot.Service, snapshotName string) error {
+	snapshots, err := service.ListSnapshots(ctx)
+	if err != nil {
+		return err
+	}
+	snapshot, ok := selectSnapshot(snapshots, snapshotName)
+	if !ok {
+		if snapshotName != "" {
+			return fmt.Errorf("snapshot %s not found", snapshotName)
+		}
+		return fmt.Errorf("no successful snapshots to verify")
+	}
+	return service.VerifySnapshot(ctx, snapshot)
+}
+
+func prune(ctx context.Context, service *es_snapshot.Service, logger *common.IngestLogger) error {
+	pruned, err := service.Prune(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	logger.Metric("snapshot.pruned_count", float64(pruned))
+	logger.Info("Pruned %d snapshots", pruned)
+	return nil
+}
+
+// selectSnapshot returns the named snapshot, or the newest successful one when
+// name is empty. snapshots must be sorted oldest first.
+func selectSnapshot(snapshots []es_snapshot.Snapshot, name string) (es_snapshot.Snapshot, bool) {
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		snapshot := snapshots[i]
+		if name != "" && snapshot.Name == name {
+			return snapshot, true
+		}
+		if name == "" && snapshot.State == "SUCCESS" {
+			return snapshot, true
+		}
+	}
+	return es_snapshot.Snapshot{}, false
+}
+
+// newSnapshotName names on-demand snapshots distinctly from SLM's daily snapshots
+func newSnapshotName(t time.Time) string {
+	return "ops-snap-" + t.UTC().Format("2006.01.02-15.04")
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// noLanguage is the language posts that declare none are counted under
+const noLanguage = "none"
+
+// datasetCard describes what an export run wrote, from statistics gathered
+// as records are fetched. It is written next to the run's files (see
+// writeDatasetCard).
+type datasetCard struct {
+	GeneratedAt    string       `json:"generated_at"`
+	StartTime      string       `json:"start_time,omitempty"` // Requested window; empty when open
+	EndTime        string       `json:"end_time,omitempty"`
+	TimeField      string       `json:"time_field"`
+	Filter         string       `json:"filter,omitempty"`
+	AuthorShards   int          `json:"author_shards,omitempty"`    // --author-shards posts, replies, and likes are split by
+	LikesWithPosts bool         `json:"likes_with_posts,omitempty"` // Whether likes were written joined to their posts (--join-posts)
+	Indices        []*indexCard `json:"indices"`
+}
+
+// indexCard is the part of a dataset card for one exported index
+type indexCard struct {
+	Index   string `json:"index"`
+	Type    string `json:"type"`
+	Records int64  `json:"records"`
+	Authors int    `json:"authors"` // Distinct author DIDs
+	// Share of posts and replies with no text, e.g. image-only posts
+	EmptyContentPercent *float64 `json:"empty_content_percent,omitempty"`
+	// Posts and replies per declared language; a post counts once for
+	// each language it declares, or under "none"
+	Languages map[string]int64 `json:"languages,omitempty"`
+	// Posts and replies the author labeled, in total and per label; a post
+	// counts once for each label it carries
+	SelfLabeled *int64           `json:"self_labeled,omitempty"`
+	SelfLabels  map[string]int64 `json:"self_labels,omitempty"`
+	Earliest    string           `json:"earliest,omitempty"` // Time coverage on the time field
+	Latest      string           `json:"latest,omitempty"`
+	Error       string           `json:"error,omitempty"` // Set when the export failed; the statistics cover what was fetched
+
+	mu           sync.Mutex
+	timeField    string
+	authors      map[string]struct{}
+	emptyContent int64
+	selfLabeled  int64
+	earliest     time.Time
+	latest       time.Time
+}
+
+// newDatasetCard starts the card of a run that began at runStart
+func newDatasetCard(runStart time.Time, startTime, endTime, timeField string, filter common.ExportFilter) *datasetCard {
+	card := &datasetCard{
+		GeneratedAt: runStart.UTC().Format(time.RFC3339),
+		StartTime:   startTime,
+		EndTime:     endTime,
+		TimeField:   timeField,
+		Indices:     []*indexCard{},
+	}
+	if !filter.IsZero() {
+		card.Filter = describeFilter(filter)
+	}
+	return card
+}
+
+// index adds an index to the card and returns its part, which the index's
+// export adds records to. Slices of one export share it.
+func (c *datasetCard) index(indexName string, indexType IndexType) *indexCard {
+	index := &indexCard{
+		Index:     indexName,
+		Type:      string(indexType),
+		timeField: c.TimeField,
+		authors:   make(map[string]struct{}),
+	}
+	if indexType == IndexTypePosts || indexType == IndexTypeReplies {
+		index.Languages = make(map[string]int64)
+		index.SelfLabels = make(map[string]int64)
+	}
+	c.Indices = append(c.Indices, index)
+	return index
+}
+
+// addPosts counts exported posts or replies
+func (c *indexCard) addPosts(posts []common.ExtractPost) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, post := range posts {
+		c.addLocked(post.DID, fileTimestamp(c.timeField, post.RecordCreatedAt, post.InsertedAt))
+		if strings.TrimSpace(post.RecordText) == "" {
+			c.emptyContent++
+		}
+		if len(post.Langs) == 0 {
+			c.Languages[noLanguage]++
+		}
+		for _, lang := range post.Langs {
+			c.Languages[strings.ToLower(lang)]++
+		}
+		if len(post.SelfLabels) > 0 {
+			c.selfLabeled++
+		}
+		for _, label := range post.SelfLabels {
+			c.SelfLabels[label]++
+		}
+	}
+}
+
+// addLikes counts exported likes
+func (c *indexCard) addLikes(likes []common.ExtractLike) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, like := range likes {
+		c.addLocked(like.DID, fileTimestamp(c.timeField, like.RecordCreatedAt, like.InsertedAt))
+	}
+}
+
+func (c *indexCard) addLocked(did, timestamp string) {
+	c.Records++
+	c.authors[did] = struct{}{}
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		return
+	}
+	if c.earliest.IsZero() || t.Before(c.earliest) {
+		c.earliest = t
+	}
+	if t.After(c.latest) {
+		c.latest = t
+	}
+}
+
+// fail records why the index's export failed
+func (c *indexCard) fail(err error) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Error = err.Error()
+}
+
+// finish fills in the card's derived statistics
+func (c *datasetCard) finish() {
+	for _, index := range c.Indices {
+		index.mu.Lock()
+		index.Authors = len(index.authors)
+		if index.Languages != nil && index.Records > 0 {
+			percent := math.Round(float64(index.emptyContent)/float64(index.Records)*10000) / 100
+			index.EmptyContentPercent = &percent
+		}
+		if index.Languages != nil {
+			selfLabeled := index.selfLabeled
+			index.SelfLabeled = &selfLabeled
+		}
+		if !index.earliest.IsZero() {
+			index.Earliest = index.earliest.UTC().Format(time.RFC3339)
+			index.Latest = index.latest.UTC().Format(time.RFC3339)
+		}
+		index.mu.Unlock()
+	}
+}
+
+// datasetCardFilename names a run's card for when the run started, so the
+// cards of runs writing to the same output do not replace each other
+func datasetCardFilename(runStart time.Time) string {
+	return fmt.Sprintf("dataset_card_%s.json", runStart.UTC().Format("20060102_150405"))
+}
+
+// writeDatasetCard writes the card as JSON at the top of the output
+func writeDatasetCard(ctx context.Context, out *output, card *datasetCard, runStart time.Time, logger *common.IngestLogger) error {
+	card.finish()
+	filename := datasetCardFilename(runStart)
+	err := writeObject(ctx, out, filename, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(card); err != nil {
+			return fmt.Errorf("failed to encode dataset card: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	logger.Info("Wrote dataset card to %s", out.location(filename))
+	return nil
+}
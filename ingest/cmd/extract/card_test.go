@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func TestDatasetCard(t *testing.T) {
+	runStart := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	card := newDatasetCard(runStart, "2026-10-16T00:00:00Z", "", common.TimeFieldCreatedAt, common.ExportFilter{HasEmbeddings: true})
+
+	posts := card.index("posts", IndexTypePosts)
+	posts.addPosts([]common.ExtractPost{
+		{DID: "did:plc:a", RecordText: "hello", Langs: []string{"en"}, RecordCreatedAt: "2026-10-16T01:00:00.500Z"},
+		{DID: "did:plc:a", RecordText: " ", Langs: []string{"EN", "ja"}, SelfLabels: []string{"porn", "nudity"}, RecordCreatedAt: "2026-10-16T03:00:00Z"},
+	})
+	posts.addPosts([]common.ExtractPost{
+		{DID: "did:plc:b", RecordText: "hi", RecordCreatedAt: "2026-10-16T00:30:00Z"},
+		{DID: "did:plc:c", RecordCreatedAt: "not a time"},
+	})
+	likes := card.index("likes", IndexTypeLikes)
+	likes.addLikes([]common.ExtractLike{{DID: "did:plc:a", RecordCreatedAt: "2026-10-16T02:00:00Z"}})
+	likes.fail(context.Canceled)
+
+	dir := t.TempDir()
+	if err := writeDatasetCard(context.Background(), &output{path: dir}, card, runStart, common.NewLogger(false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, err := os.ReadFile(filepath.Join(dir, "dataset_card_20261016_120000.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written datasetCard
+	if err := json.Unmarshal(body, &written); err != nil {
+		t.Fatalf("failed to parse card: %v", err)
+	}
+	if written.StartTime != "2026-10-16T00:00:00Z" || written.Filter != "--has-embeddings" || len(written.Indices) != 2 {
+		t.Fatalf("unexpected card %s", body)
+	}
+
+	got := written.Indices[0]
+	if got.Records != 4 || got.Authors != 3 {
+		t.Errorf("expected 4 posts by 3 authors, got %d by %d", got.Records, got.Authors)
+	}
+	if got.EmptyContentPercent == nil || *got.EmptyContentPercent != 50 {
+		t.Errorf("expected half the posts empty, got %v", got.EmptyContentPercent)
+	}
+	if got.Languages["en"] != 2 || got.Languages["ja"] != 1 || got.Languages[noLanguage] != 2 {
+		t.Errorf("unexpected languages %v", got.Languages)
+	}
+	if got.SelfLabeled == nil || *got.SelfLabeled != 1 || got.SelfLabels["porn"] != 1 || got.SelfLabels["nudity"] != 1 {
+		t.Errorf("unexpected self-labels %v of %v", got.SelfLabels, got.SelfLabeled)
+	}
+	if got.Earliest != "2026-10-16T00:30:00Z" || got.Latest != "2026-10-16T03:00:00Z" {
+		t.Errorf("unexpected time coverage %s to %s", got.Earliest, got.Latest)
+	}
+
+	got = written.Indices[1]
+	if got.Records != 1 || got.Languages != nil || got.EmptyContentPercent != nil || got.SelfLabeled != nil || got.Error != context.Canceled.Error() {
+		t.Errorf("unexpected likes card %+v", got)
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/parquet-go/parquet-go"
+)
+
+// defaultCompactTargetMB is the --compact-target-mb default
+const defaultCompactTargetMB = 512
+
+// compactableFilePattern matches the parquet files compaction merges: those
+// generateFilename and likesWithPostsFilename name, in any slice, and those
+// an earlier compaction wrote. The first group is the file's type (e.g.
+// posts or likes_with_posts), which files must share to be merged.
+var compactableFilePattern = regexp.MustCompile(`^bsky_([a-z_]+?)_\d{8}_\d{6}(?:_s\d+)?(?:_c\d{8}_\d{6})?\.parquet$`)
+
+// compactedSuffixPattern matches what compactedFilename adds to a name
+var compactedSuffixPattern = regexp.MustCompile(`_c\d{8}_\d{6}$`)
+
+// Status of a merge in a compaction journal
+const (
+	mergePending   = "pending"   // Recorded before the merged file is written; sources not yet deleted
+	mergeDone      = "done"      // Merged file written and sources deleted
+	mergeAbandoned = "abandoned" // Merged file never completed; sources kept
+)
+
+// compactionJournal records what a compaction run merged, next to the
+// files (see compactionJournalFilename). Each merge is recorded before its
+// merged file is written and updated once its sources are deleted, so a
+// run that stops between the two is finished by the next (see
+// finishCompactions). Readers see a merge's rows twice, in the merged file
+// and its sources, until the sources are deleted, but never lose them.
+type compactionJournal struct {
+	StartedAt string             `json:"started_at"`
+	TargetMB  int                `json:"target_mb"`
+	Merges    []*compactionMerge `json:"merges"`
+
+	filename string
+}
+
+// compactionMerge is one merged file and the files it replaces
+type compactionMerge struct {
+	File    string   `json:"file"`
+	Sources []string `json:"sources"`
+	Rows    int64    `json:"rows"` // Rows of the sources, which the merged file must have
+	Status  string   `json:"status"`
+}
+
+// compactionJournalPattern matches the names compactionJournalFilename gives
+var compactionJournalPattern = regexp.MustCompile(`^extract_compaction_\d{8}_\d{6}\.json$`)
+
+// compactionJournalFilename names the journal of a compaction run that
+// started at runStart
+func compactionJournalFilename(runStart time.Time) string {
+	return fmt.Sprintf("extract_compaction_%s.json", runStart.UTC().Format("20060102_150405"))
+}
+
+// save writes the journal over its previous version
+func (j *compactionJournal) save(ctx context.Context, out *output) error {
+	return writeObject(ctx, out, j.filename, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(j); err != nil {
+			return fmt.Errorf("failed to encode compaction journal: %w", err)
+		}
+		return nil
+	})
+}
+
+// compactedFilename names the file that merges sources, the last of which
+// is last, in a compaction run that started at runStart: last's name, minus
+// the suffix of any earlier compaction, with the run's suffix
+func compactedFilename(last string, runStart time.Time) string {
+	dir, name := path.Split(last)
+	stem := compactedSuffixPattern.ReplaceAllString(strings.TrimSuffix(name, ".parquet"), "")
+	return dir + fmt.Sprintf("%s_c%s.parquet", stem, runStart.UTC().Format("20060102_150405"))
+}
+
+// compactionGroups returns the files of objects that compaction may merge
+// together, in name order: parquet export files smaller than targetBytes,
+// grouped by directory (which holds a partition and author shard) and file
+// type
+func compactionGroups(objects []objectInfo, targetBytes int64) [][]objectInfo {
+	var keys []string
+	groups := map[string][]objectInfo{}
+	for _, object := range objects {
+		if object.size >= targetBytes {
+			continue
+		}
+		dir, name := path.Split(object.name)
+		match := compactableFilePattern.FindStringSubmatch(name)
+		if match == nil {
+			continue
+		}
+		key := dir + "\x00" + match[1]
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], object)
+	}
+
+	result := make([][]objectInfo, 0, len(keys))
+	for _, key := range keys {
+		if len(groups[key]) > 1 {
+			result = append(result, groups[key])
+		}
+	}
+	return result
+}
+
+// compactionSource is a file being merged, read whole
+type compactionSource struct {
+	name string
+	size int64
+	file *parquet.File
+}
+
+// runCompaction merges the small parquet files under outputPath (or
+// GE_PARQUET_DESTINATION) into files of up to targetMB, recording each merge
+// in a compaction journal, after finishing any merge an earlier run left
+// pending
+func runCompaction(ctx context.Context, config *common.Config, logger *common.IngestLogger, outputPath string, targetMB int) error {
+	runStart := time.Now()
+	if targetMB <= 0 {
+		return fmt.Errorf("--compact-target-mb must be positive, got %d", targetMB)
+	}
+	if outputPath == "" {
+		outputPath = config.ParquetDestination
+	}
+	if outputPath == "" {
+		return fmt.Errorf("no output path: set --output-path or GE_PARQUET_DESTINATION")
+	}
+	out, err := newOutput(ctx, outputPath, false, config)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			logger.Error("Failed to close output: %v", err)
+		}
+	}()
+
+	objects, err := listObjects(ctx, out)
+	if err != nil {
+		return err
+	}
+	if err := finishCompactions(ctx, out, objects, logger); err != nil {
+		return err
+	}
+	// Finishing deletes files, so list again
+	if objects, err = listObjects(ctx, out); err != nil {
+		return err
+	}
+
+	journal := &compactionJournal{
+		StartedAt: runStart.UTC().Format(time.RFC3339),
+		TargetMB:  targetMB,
+		Merges:    []*compactionMerge{},
+		filename:  compactionJournalFilename(runStart),
+	}
+	targetBytes := int64(targetMB) << 20
+	merged := 0
+	for _, group := range compactionGroups(objects, targetBytes) {
+		n, err := compactGroup(ctx, out, journal, group, targetBytes, runStart, logger)
+		merged += n
+		if err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Compaction of %s merged %d files into %d", out, merged, len(journal.Merges))
+	logger.Metric("extract.compact.merged_file_count", float64(len(journal.Merges)))
+	logger.Metric("extract.compact.source_file_count", float64(merged))
+	logger.Metric("extract.compact.duration_ms", float64(time.Since(runStart).Milliseconds()))
+	return nil
+}
+
+// compactGroup merges a group of compactionGroups into files of up to
+// targetBytes, reading each file as it goes so no more than targetBytes are
+// held at once. Files whose schema differs from the file before them start
+// a new merged file, as exports add columns over time. Returns how many
+// files were merged.
+func compactGroup(ctx context.Context, out *output, journal *compactionJournal, group []objectInfo, targetBytes int64, runStart time.Time, logger *common.IngestLogger) (int, error) {
+	merged := 0
+	var batch []compactionSource
+	var batchBytes int64
+	flush := func() error {
+		if len(batch) > 1 {
+			if err := mergeFiles(ctx, out, journal, batch, runStart, logger); err != nil {
+				return err
+			}
+			merged += len(batch)
+		}
+		batch, batchBytes = nil, 0
+		return nil
+	}
+
+	for _, object := range group {
+		if err := ctx.Err(); err != nil {
+			return merged, err
+		}
+		source, err := openParquetObject(ctx, out, object)
+		if err != nil {
+			return merged, err
+		}
+		if source == nil {
+			continue
+		}
+		if len(batch) > 0 && (batchBytes+object.size > targetBytes || !parquet.EqualNodes(batch[0].file.Schema(), source.file.Schema())) {
+			if err := flush(); err != nil {
+				return merged, err
+			}
+		}
+		batch = append(batch, *source)
+		batchBytes += object.size
+	}
+	return merged, flush()
+}
+
+// openParquetObject reads a file listObjects found. Returns nil when the
+// file is gone, e.g. deleted by an export's cleanup since the listing.
+func openParquetObject(ctx context.Context, out *output, object objectInfo) (*compactionSource, error) {
+	data, ok, err := readObject(ctx, out, object.name)
+	if err != nil || !ok {
+		return nil, err
+	}
+	file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", out.location(object.name), err)
+	}
+	return &compactionSource{name: object.name, size: int64(len(data)), file: file}, nil
+}
+
+// mergeFiles writes sources, which share a schema, as one file, then
+// deletes them, recording the merge in journal before each step
+func mergeFiles(ctx context.Context, out *output, journal *compactionJournal, sources []compactionSource, runStart time.Time, logger *common.IngestLogger) error {
+	merge := &compactionMerge{
+		File:   compactedFilename(sources[len(sources)-1].name, runStart),
+		Status: mergePending,
+	}
+	for _, source := range sources {
+		merge.Sources = append(merge.Sources, source.name)
+		merge.Rows += source.file.NumRows()
+	}
+	journal.Merges = append(journal.Merges, merge)
+	if err := journal.save(ctx, out); err != nil {
+		return err
+	}
+
+	logger.Debug("Merging %d files (%d rows) into %s", len(sources), merge.Rows, out.location(merge.File))
+	if err := writeObject(ctx, out, merge.File, func(w io.Writer) error {
+		writer := parquet.NewWriter(w, sources[0].file.Schema())
+		for _, source := range sources {
+			for _, rowGroup := range source.file.RowGroups() {
+				rows := rowGroup.Rows()
+				_, err := parquet.CopyRows(writer, rows)
+				_ = rows.Close()
+				if err != nil {
+					return fmt.Errorf("failed to copy rows of %s: %w", out.location(source.name), err)
+				}
+			}
+		}
+		if err := writer.Close(); err != nil {
+			return fmt.Errorf("failed to close parquet writer: %w", err)
+		}
+		return nil
+	}); err != nil {
+		merge.Status = mergeAbandoned
+		if saveErr := journal.save(ctx, out); saveErr != nil {
+			logger.Error("Failed to record abandoned merge into %s: %v", out.location(merge.File), saveErr)
+		}
+		return err
+	}
+
+	return deleteSources(ctx, out, journal, merge)
+}
+
+// deleteSources deletes the sources of a merge whose merged file is complete
+// and records the merge done
+func deleteSources(ctx context.Context, out *output, journal *compactionJournal, merge *compactionMerge) error {
+	for _, source := range merge.Sources {
+		if err := deleteObject(ctx, out, source); err != nil {
+			return err
+		}
+	}
+	merge.Status = mergeDone
+	return journal.save(ctx, out)
+}
+
+// finishCompactions completes the pending merges of earlier compaction runs'
+// journals among objects. A merge whose merged file is complete, with every
+// row of its sources, has its sources deleted; otherwise the merged file
+// never finished, so what there is of it is deleted and the merge abandoned.
+func finishCompactions(ctx context.Context, out *output, objects []objectInfo, logger *common.IngestLogger) error {
+	for _, object := range objects {
+		if !compactionJournalPattern.MatchString(object.name) {
+			continue
+		}
+		data, ok, err := readObject(ctx, out, object.name)
+		if err != nil || !ok {
+			return err
+		}
+		journal := &compactionJournal{filename: object.name}
+		if err := json.Unmarshal(data, journal); err != nil {
+			return fmt.Errorf("failed to parse compaction journal %s: %w", out.location(object.name), err)
+		}
+
+		for _, merge := range journal.Merges {
+			if merge.Status != mergePending {
+				continue
+			}
+			if complete, err := mergedFileComplete(ctx, out, merge); err != nil {
+				return err
+			} else if complete {
+				logger.Info("Finishing merge into %s from %s", out.location(merge.File), out.location(object.name))
+				if err := deleteSources(ctx, out, journal, merge); err != nil {
+					return err
+				}
+				continue
+			}
+
+			logger.Info("Abandoning incomplete merge into %s from %s", out.location(merge.File), out.location(object.name))
+			if err := deleteObject(ctx, out, merge.File); err != nil {
+				return err
+			}
+			merge.Status = mergeAbandoned
+			if err := journal.save(ctx, out); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mergedFileComplete reports whether a merge's merged file exists, opens,
+// and has every row of its sources
+func mergedFileComplete(ctx context.Context, out *output, merge *compactionMerge) (bool, error) {
+	data, ok, err := readObject(ctx, out, merge.File)
+	if err != nil || !ok {
+		return false, err
+	}
+	file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return false, nil
+	}
+	return file.NumRows() == merge.Rows, nil
+}
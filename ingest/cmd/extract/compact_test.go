@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestRunCompaction_MergesSmallFiles(t *testing.T) {
+	ctx := context.Background()
+	logger := common.NewLogger(false)
+	dir := t.TempDir()
+	out := &output{path: dir, format: FormatParquet}
+	writeLikes := func(filename string, dids ...string) {
+		t.Helper()
+		var rows []common.ExtractLike
+		for _, did := range dids {
+			rows = append(rows, common.ExtractLike{DID: did, SubjectURI: "at://did:plc:b/app.bsky.feed.post/1"})
+		}
+		if err := writeFile(ctx, out, filename, rows, logger); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeLikes("dt=2026-06-03/bsky_likes_20260603_100000.parquet", "did:plc:a", "did:plc:b")
+	writeLikes("dt=2026-06-03/bsky_likes_20260603_103000_s01.parquet", "did:plc:c")
+	writeLikes("dt=2026-06-03/bsky_likes_20260603_110000.parquet", "did:plc:d")
+	writeLikes("dt=2026-06-04/bsky_likes_20260604_100000.parquet", "did:plc:e")
+	if err := writeFile(ctx, out, "dt=2026-06-03/bsky_like_tombstones_20260603_100000.parquet", []common.ExtractLikeTombstone{{DID: "did:plc:f"}}, logger); err != nil {
+		t.Fatal(err)
+	}
+	// A file with another schema starts a new merged file
+	if err := writeFile(ctx, out, "dt=2026-06-03/bsky_likes_20260603_120000.parquet", []common.ExtractHashtag{{Hashtag: "go"}}, logger); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runCompaction(ctx, &common.Config{}, logger, dir, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := listObjects(ctx, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, object := range objects {
+		names = append(names, object.name)
+	}
+	if len(names) != 5 || !compactionJournalPattern.MatchString(names[4]) ||
+		names[0] != "dt=2026-06-03/bsky_like_tombstones_20260603_100000.parquet" ||
+		!strings.HasPrefix(names[1], "dt=2026-06-03/bsky_likes_20260603_110000_c") ||
+		names[2] != "dt=2026-06-03/bsky_likes_20260603_120000.parquet" ||
+		names[3] != "dt=2026-06-04/bsky_likes_20260604_100000.parquet" {
+		t.Fatalf("unexpected files after compaction %v", names)
+	}
+
+	likes, err := parquet.ReadFile[common.ExtractLike](filepath.Join(dir, names[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(likes) != 4 || likes[0].DID != "did:plc:a" || likes[3].DID != "did:plc:d" {
+		t.Errorf("unexpected merged likes %+v", likes)
+	}
+
+	var journal compactionJournal
+	data, err := os.ReadFile(filepath.Join(dir, names[4]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &journal); err != nil {
+		t.Fatal(err)
+	}
+	if len(journal.Merges) != 1 || journal.Merges[0].File != names[1] || journal.Merges[0].Status != mergeDone ||
+		journal.Merges[0].Rows != 4 || len(journal.Merges[0].Sources) != 3 {
+		t.Errorf("unexpected journal %+v", journal)
+	}
+}
+
+func TestFinishCompactions(t *testing.T) {
+	ctx := context.Background()
+	logger := common.NewLogger(false)
+	dir := t.TempDir()
+	out := &output{path: dir, format: FormatParquet}
+	for _, filename := range []string{"bsky_likes_20260603_100000.parquet", "bsky_likes_20260603_110000.parquet", "bsky_likes_20260603_110000_c20260603_120000.parquet"} {
+		if err := writeFile(ctx, out, filename, []common.ExtractLike{{DID: "did:plc:a"}}, logger); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeFile(ctx, out, "bsky_posts_20260603_110000_c20260603_120000.parquet", []common.ExtractLike{{DID: "did:plc:a"}}, logger); err != nil {
+		t.Fatal(err)
+	}
+	journal := &compactionJournal{
+		Merges: []*compactionMerge{
+			{File: "bsky_likes_20260603_110000_c20260603_120000.parquet", Sources: []string{"bsky_likes_20260603_100000.parquet", "bsky_likes_20260603_110000.parquet"}, Rows: 1, Status: mergePending},
+			// Has fewer rows than its sources, so never finished
+			{File: "bsky_posts_20260603_110000_c20260603_120000.parquet", Sources: []string{"bsky_posts_20260603_100000.parquet"}, Rows: 2, Status: mergePending},
+		},
+		filename: compactionJournalFilename(time.Date(2026, 6, 3, 12, 0, 0, 0, time.UTC)),
+	}
+	if err := journal.save(ctx, out); err != nil {
+		t.Fatal(err)
+	}
+
+	objects, err := listObjects(ctx, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := finishCompactions(ctx, out, objects, logger); err != nil {
+		t.Fatal(err)
+	}
+	if objects, err = listObjects(ctx, out); err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 2 || objects[0].name != "bsky_likes_20260603_110000_c20260603_120000.parquet" || objects[1].name != "extract_compaction_20260603_120000.json" {
+		t.Errorf("unexpected files after finishing %+v", objects)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "extract_compaction_20260603_120000.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var finished compactionJournal
+	if err := json.Unmarshal(data, &finished); err != nil {
+		t.Fatal(err)
+	}
+	if finished.Merges[0].Status != mergeDone || finished.Merges[1].Status != mergeAbandoned {
+		t.Errorf("unexpected merges %+v %+v", finished.Merges[0], finished.Merges[1])
+	}
+}
+
+func TestCompactedFilename(t *testing.T) {
+	runStart := time.Date(2026, 6, 4, 1, 2, 3, 0, time.UTC)
+	for last, expected := range map[string]string{
+		"dt=2026-06-03/bsky_posts_20260603_100000.parquet":                  "dt=2026-06-03/bsky_posts_20260603_100000_c20260604_010203.parquet",
+		"bsky_likes_with_posts_20260603_100000_s01.parquet":                 "bsky_likes_with_posts_20260603_100000_s01_c20260604_010203.parquet",
+		"dt=2026-06-03/bsky_posts_20260603_100000_c20260603_120000.parquet": "dt=2026-06-03/bsky_posts_20260603_100000_c20260604_010203.parquet",
+	} {
+		if got := compactedFilename(last, runStart); got != expected {
+			t.Errorf("%s: expected %s, got %s", last, expected, got)
+		}
+		if !compactableFilePattern.MatchString(filepath.Base(expected)) {
+			t.Errorf("expected %s compactable again", expected)
+		}
+	}
+}
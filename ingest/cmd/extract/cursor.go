@@ -0,0 +1,42 @@
+package main
+
+import (
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// resumeSettleTime is how far short of now a resumed export stops. Indices
+// refresh every 30s, so records indexed in the last moments may not be
+// searchable yet; stopping short leaves them to the next run instead of
+// skipping them.
+const resumeSettleTime = 2 * time.Minute
+
+// resumeEndTime returns the end of a resumed export's window
+func resumeEndTime(now time.Time) string {
+	return now.Add(-resumeSettleTime).Format(time.RFC3339)
+}
+
+// resumeStartTime returns where an export resumes from cursor: the timeField
+// value of the last record it exported, which the export then pages after, or
+// for indices exported without a record cursor, the end of the last window
+func resumeStartTime(cursor common.ExportCursor, timeField string) string {
+	if start, _ := common.SortCursor(timeField, cursor.CreatedAt, cursor.IndexedAt); start != "" {
+		return start
+	}
+	return cursor.WindowEnd
+}
+
+// nextExportCursor returns the cursor to record after a successful export.
+// A run that exported no records keeps the previous run's last record, and
+// the window end is the run's start when the window was open-ended.
+func nextExportCursor(cursor, previous common.ExportCursor, endTime string, runStart time.Time) common.ExportCursor {
+	if cursor.CreatedAt == "" && cursor.IndexedAt == "" {
+		cursor.CreatedAt, cursor.IndexedAt = previous.CreatedAt, previous.IndexedAt
+	}
+	cursor.WindowEnd = endTime
+	if cursor.WindowEnd == "" {
+		cursor.WindowEnd = runStart.UTC().Format(time.RFC3339)
+	}
+	return cursor
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func TestResumeStartTime(t *testing.T) {
+	cursor := common.ExportCursor{CreatedAt: "2026-06-03T09:58:00Z", IndexedAt: "2026-06-03T10:00:02Z", WindowEnd: "2026-06-03T10:05:00Z"}
+	if got := resumeStartTime(cursor, common.TimeFieldIndexedAt); got != cursor.IndexedAt {
+		t.Errorf("expected indexed_at resume at %s, got %s", cursor.IndexedAt, got)
+	}
+	if got := resumeStartTime(cursor, common.TimeFieldCreatedAt); got != cursor.CreatedAt {
+		t.Errorf("expected created_at resume at %s, got %s", cursor.CreatedAt, got)
+	}
+	if got := resumeStartTime(common.ExportCursor{WindowEnd: cursor.WindowEnd}, common.TimeFieldIndexedAt); got != cursor.WindowEnd {
+		t.Errorf("expected a cursor without records to resume at its window end, got %s", got)
+	}
+}
+
+func TestNextExportCursor(t *testing.T) {
+	previous := common.ExportCursor{CreatedAt: "2026-06-03T09:58:00Z", IndexedAt: "2026-06-03T10:00:02Z", WindowEnd: "2026-06-03T10:05:00Z"}
+	runStart := time.Date(2026, 6, 3, 11, 0, 0, 0, time.UTC)
+
+	got := nextExportCursor(common.ExportCursor{}, previous, "", runStart)
+	if got.CreatedAt != previous.CreatedAt || got.IndexedAt != previous.IndexedAt || got.WindowEnd != "2026-06-03T11:00:00Z" {
+		t.Errorf("expected a run without records to keep the previous record, got %+v", got)
+	}
+
+	exported := common.ExportCursor{CreatedAt: "2026-06-03T10:50:00Z", IndexedAt: "2026-06-03T10:51:00Z"}
+	got = nextExportCursor(exported, previous, "2026-06-03T10:58:00Z", runStart)
+	if got.IndexedAt != exported.IndexedAt || got.WindowEnd != "2026-06-03T10:58:00Z" {
+		t.Errorf("unexpected cursor %+v", got)
+	}
+}
+
+func TestRunExportForLikes_ResumesAfterCursor(t *testing.T) {
+	pages := []string{
+		`{"hits":{"total":{"value":1},"hits":[
+			{"_id":"1","sort":["2026-06-03T10:02:00Z","2026-06-03T10:01:00Z",7],"_source":{"at_uri":"at://did:plc:a/app.bsky.feed.like/1","subject_uri":"at://did:plc:b/app.bsky.feed.post/1","author_did":"did:plc:a","created_at":"2026-06-03T10:01:00Z","indexed_at":"2026-06-03T10:02:00Z"}}]}}`,
+		`{"hits":{"total":{"value":1},"hits":[]}}`,
+	}
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		_, _ = w.Write([]byte(pages[min(len(bodies)-1, len(pages)-1)]))
+	}))
+	defer srv.Close()
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursor := common.ExportCursor{CreatedAt: "2026-06-03T09:58:00Z", IndexedAt: "2026-06-03T10:00:02Z"}
+	err = runExportForLikes(context.Background(), client, common.NewLogger(false), true, &output{path: t.TempDir()},
+		"likes", resumeStartTime(cursor, common.TimeFieldIndexedAt), "", common.TimeFieldIndexedAt, common.ExportFilter{}, false, &cursor, &common.Config{ExtractFetchSize: 1}, nil, nil, nil, nil, common.ExportPIT{ID: "pit-1", KeepAlive: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bodies) != 2 || !strings.Contains(bodies[0], `"search_after":["2026-06-03T10:00:02Z","2026-06-03T09:58:00Z",9223372036854775807]`) {
+		t.Fatalf("expected the first page to start after the cursor's record, got %v", bodies)
+	}
+	if cursor.CreatedAt != "2026-06-03T10:01:00Z" || cursor.IndexedAt != "2026-06-03T10:02:00Z" {
+		t.Errorf("expected the cursor to follow the last exported like, got %+v", cursor)
+	}
+}
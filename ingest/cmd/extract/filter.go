@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// parseAuthorDIDs parses an --author-did value: a comma-separated list of DIDs
+func parseAuthorDIDs(value string) ([]string, error) {
+	var dids []string
+	for _, did := range strings.Split(value, ",") {
+		did = strings.TrimSpace(did)
+		if did == "" {
+			continue
+		}
+		if !strings.HasPrefix(did, "did:") {
+			return nil, fmt.Errorf("%q is not a DID", did)
+		}
+		dids = append(dids, did)
+	}
+	return dids, nil
+}
+
+// validateFilter checks that every index exported can apply filter. Only
+// posts, replies, and likes are filtered, and likes have no content or
+// embeddings to filter on.
+func validateFilter(filter common.ExportFilter, indices []string) error {
+	if filter.IsZero() {
+		return nil
+	}
+	for _, indexName := range indices {
+		indexType, err := ParseIndexType(indexName)
+		if err != nil {
+			return err
+		}
+		switch indexType {
+		case IndexTypePosts, IndexTypeReplies:
+		case IndexTypeLikes:
+			if filter.PostsOnly() {
+				return fmt.Errorf("--has-embeddings and --content-match apply only to posts and replies, not %s", indexName)
+			}
+		default:
+			return fmt.Errorf("filters apply only to posts, replies, and likes, not %s", indexName)
+		}
+	}
+	return nil
+}
+
+// describeFilter returns filter in the terms of the flags that set it
+func describeFilter(filter common.ExportFilter) string {
+	var parts []string
+	if len(filter.AuthorDIDs) > 0 {
+		parts = append(parts, "--author-did="+strings.Join(filter.AuthorDIDs, ","))
+	}
+	if filter.HasEmbeddings {
+		parts = append(parts, "--has-embeddings")
+	}
+	if filter.ContentMatch != "" {
+		parts = append(parts, fmt.Sprintf("--content-match=%q", filter.ContentMatch))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func TestParseAuthorDIDs(t *testing.T) {
+	dids, err := parseAuthorDIDs(" did:plc:a, did:web:example.com ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"did:plc:a", "did:web:example.com"}; !reflect.DeepEqual(dids, want) {
+		t.Errorf("parseAuthorDIDs = %v, want %v", dids, want)
+	}
+	if _, err := parseAuthorDIDs("did:plc:a,alice.bsky.social"); err == nil {
+		t.Error("expected a handle to be rejected")
+	}
+}
+
+func TestValidateFilter(t *testing.T) {
+	byAuthor := common.ExportFilter{AuthorDIDs: []string{"did:plc:a"}}
+	withEmbeddings := common.ExportFilter{HasEmbeddings: true}
+	tests := []struct {
+		filter  common.ExportFilter
+		indices []string
+		wantErr bool
+	}{
+		{common.ExportFilter{}, []string{"posts", "hashtags", "user_features"}, false},
+		{byAuthor, []string{"posts", "replies", "likes"}, false},
+		{withEmbeddings, []string{"posts", "replies"}, false},
+		{withEmbeddings, []string{"posts", "likes"}, true},
+		{common.ExportFilter{ContentMatch: "solar"}, []string{"likes"}, true},
+		{byAuthor, []string{"posts", "post_tombstones"}, true},
+		{byAuthor, []string{"user_features"}, true},
+	}
+	for _, tt := range tests {
+		if err := validateFilter(tt.filter, tt.indices); (err != nil) != tt.wantErr {
+			t.Errorf("validateFilter(%+v, %v) error = %v, wantErr %v", tt.filter, tt.indices, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// Values of --format
+const (
+	FormatParquet = "parquet"
+	FormatNDJSON  = "ndjson"
+	FormatCSV     = "csv"
+)
+
+// validateFormat checks a --format value and whether --gzip may be used
+// with it. Parquet compresses its own pages, so gzip applies only to the
+// text formats.
+func validateFormat(format string, gzipped bool) error {
+	switch format {
+	case FormatParquet:
+		if gzipped {
+			return fmt.Errorf("--gzip applies only to %s and %s; parquet files are already compressed", FormatNDJSON, FormatCSV)
+		}
+		return nil
+	case FormatNDJSON, FormatCSV:
+		return nil
+	default:
+		return fmt.Errorf("unknown format %q (expected %q, %q, or %q)", format, FormatParquet, FormatNDJSON, FormatCSV)
+	}
+}
+
+// filename returns name, which generateFilename gives a .parquet extension,
+// with the extension of the output's format instead. A slice's files are
+// suffixed with the slice, as slices export at the same time.
+func (o *output) filename(name string) string {
+	ext := ".parquet"
+	switch o.format {
+	case FormatNDJSON:
+		ext = ".ndjson"
+	case FormatCSV:
+		ext = ".csv"
+	}
+	if o.gzip {
+		ext += ".gz"
+	}
+	name = strings.TrimSuffix(name, ".parquet")
+	if o.slice != "" {
+		name += "_" + o.slice
+	}
+	return name + ext
+}
+
+// encodeRows writes rows to w in the output's format, gzipped if set. Text
+// formats name fields as the parquet schema does, so every format has the
+// same columns.
+func encodeRows[T any](w io.Writer, o *output, rows []T) error {
+	if o.gzip {
+		zw := gzip.NewWriter(w)
+		if err := encodeRowsAs(zw, o.format, rows); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return fmt.Errorf("failed to finish gzip stream: %w", err)
+		}
+		return nil
+	}
+	return encodeRowsAs(w, o.format, rows)
+}
+
+func encodeRowsAs[T any](w io.Writer, format string, rows []T) error {
+	switch format {
+	case FormatNDJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetEscapeHTML(false)
+		for _, row := range rows {
+			if err := encoder.Encode(row); err != nil {
+				return fmt.Errorf("failed to write ndjson row: %w", err)
+			}
+		}
+		return nil
+	case FormatCSV:
+		return writeCSV(w, rows)
+	default:
+		parquetWriter := parquet.NewGenericWriter[T](w)
+		if _, err := parquetWriter.Write(rows); err != nil {
+			return fmt.Errorf("failed to write parquet data: %w", err)
+		}
+		// Close writes the footer
+		if err := parquetWriter.Close(); err != nil {
+			return fmt.Errorf("failed to close parquet writer: %w", err)
+		}
+		return nil
+	}
+}
+
+// writeCSV writes rows with a header row. Strings and numbers are written as
+// they are; other values, such as the embeddings map, as JSON.
+func writeCSV[T any](w io.Writer, rows []T) error {
+	rowType := reflect.TypeFor[T]()
+	var header []string
+	var fields []int
+	for i := range rowType.NumField() {
+		field := rowType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("parquet"), ",")
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		header = append(header, name)
+		fields = append(fields, i)
+	}
+
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(header); err != nil {
+		return fmt.Errorf("failed to write csv header: %w", err)
+	}
+	record := make([]string, len(fields))
+	for _, row := range rows {
+		value := reflect.ValueOf(row)
+		for i, field := range fields {
+			cell, err := csvCell(value.Field(field))
+			if err != nil {
+				return fmt.Errorf("failed to write csv column %s: %w", header[i], err)
+			}
+			record[i] = cell
+		}
+		if err := csvWriter.Write(record); err != nil {
+			return fmt.Errorf("failed to write csv row: %w", err)
+		}
+	}
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return fmt.Errorf("failed to write csv: %w", err)
+	}
+	return nil
+}
+
+func csvCell(v reflect.Value) (string, error) {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Map, reflect.Slice, reflect.Pointer:
+		if v.IsNil() {
+			return "", nil
+		}
+	}
+	encoded, err := json.Marshal(v.Interface())
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func TestValidateFormat(t *testing.T) {
+	for _, ok := range []struct {
+		format  string
+		gzipped bool
+	}{{FormatParquet, false}, {FormatNDJSON, true}, {FormatCSV, false}} {
+		if err := validateFormat(ok.format, ok.gzipped); err != nil {
+			t.Errorf("validateFormat(%q, %v): %v", ok.format, ok.gzipped, err)
+		}
+	}
+	if err := validateFormat(FormatParquet, true); err == nil {
+		t.Error("expected gzip to be rejected for parquet")
+	}
+	if err := validateFormat("avro", false); err == nil {
+		t.Error("expected an unknown format to be rejected")
+	}
+}
+
+func TestWriteRecordFiles_NDJSONGzip(t *testing.T) {
+	dir := t.TempDir()
+	out := &output{path: dir, format: FormatNDJSON, gzip: true}
+	posts := []common.ExtractPost{
+		{DID: "did:plc:a", AtURI: "at://a", RecordText: "<b>&", RecordCreatedAt: "2026-06-06T12:00:00Z"},
+		{DID: "did:plc:b", AtURI: "at://b", RecordCreatedAt: "2026-06-06T12:05:00Z"},
+	}
+
+	_, err := writeRecordFiles(context.Background(), out, "posts", posts, func(post common.ExtractPost) string { return post.RecordCreatedAt }, nil, common.NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filepath.Join(dir, "bsky_posts_20260606_120500.ndjson.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder := json.NewDecoder(zr)
+	var read []common.ExtractPost
+	for decoder.More() {
+		var post common.ExtractPost
+		if err := decoder.Decode(&post); err != nil {
+			t.Fatal(err)
+		}
+		read = append(read, post)
+	}
+	if len(read) != 2 || read[0].RecordText != "<b>&" || read[1].AtURI != "at://b" {
+		t.Errorf("unexpected rows %+v", read)
+	}
+}
+
+func TestWriteFile_CSV(t *testing.T) {
+	dir := t.TempDir()
+	out := &output{path: dir, format: FormatCSV}
+	posts := []common.ExtractPost{
+		{DID: "did:plc:a", AtURI: "at://a", RecordText: "hello, \"world\"\nbye", Embeddings: map[string]string{"m": "abc"}},
+		{DID: "did:plc:b", AtURI: "at://b"},
+	}
+
+	if err := writeFile(context.Background(), out, "bsky_posts.parquet", posts, common.NewLogger(false)); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filepath.Join(dir, "bsky_posts.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "did,at_uri,embed_quote_uri,inserted_at,record_created_at,record_text,reply_parent_uri,reply_root_uri,embeddings,embeddings_float32,embeddings_float16,like_count,account_status,langs,self_labels"
+	if len(records) != 3 || strings.Join(records[0], ",") != want {
+		t.Fatalf("unexpected csv %v", records)
+	}
+	if records[1][5] != "hello, \"world\"\nbye" || records[1][8] != `{"m":"abc"}` || records[2][8] != "" {
+		t.Errorf("unexpected rows %v", records[1:])
+	}
+}
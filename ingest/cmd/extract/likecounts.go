@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// likesAlias is the alias like counts are counted in
+const likesAlias = "likes"
+
+// enrichLikeCounts sets the LikeCount of each post to its likes in the
+// likes index, counted in batches of fetchSize. Posts without likes get 0.
+func enrichLikeCounts(ctx context.Context, esClient *elasticsearch.Client, logger *common.IngestLogger, posts []common.ExtractPost, fetchSize int) error {
+	if fetchSize <= 0 {
+		fetchSize = 1000
+	}
+	for start := 0; start < len(posts); start += fetchSize {
+		batch := posts[start:min(start+fetchSize, len(posts))]
+		atURIs := make([]string, len(batch))
+		for i, post := range batch {
+			atURIs[i] = post.AtURI
+		}
+
+		counts, err := common.CountLikesBySubject(ctx, esClient, logger, likesAlias, atURIs)
+		if err != nil {
+			return fmt.Errorf("failed to count likes: %w", err)
+		}
+		for i := range batch {
+			count := int64(counts[batch[i].AtURI])
+			batch[i].LikeCount = &count
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func TestEnrichLikeCounts(t *testing.T) {
+	es := estest.New(t)
+	for _, like := range []common.LikeDoc{
+		{AtURI: "at://l1", AuthorDID: "did:plc:x", SubjectURI: "at://a"},
+		{AtURI: "at://l2", AuthorDID: "did:plc:y", SubjectURI: "at://a"},
+		{AtURI: "at://l3", AuthorDID: "did:plc:y", SubjectURI: "at://b"},
+		{AtURI: "at://l4", AuthorDID: "did:plc:y", SubjectURI: "at://other"},
+	} {
+		es.Put(likesAlias, like.AtURI, like)
+	}
+
+	posts := []common.ExtractPost{{AtURI: "at://a"}, {AtURI: "at://b"}, {AtURI: "at://unliked"}}
+	if err := enrichLikeCounts(context.Background(), es.Client, common.NewLogger(false), posts, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int64{2, 1, 0}
+	for i, post := range posts {
+		if post.LikeCount == nil || *post.LikeCount != want[i] {
+			t.Errorf("%s: like_count %v, want %d", post.AtURI, post.LikeCount, want[i])
+		}
+	}
+	if calls := es.Calls(estest.APISearch); len(calls) != 2 {
+		t.Errorf("expected 2 batches, got %d searches", len(calls))
+	}
+}
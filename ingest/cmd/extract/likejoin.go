@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// likedPostsIndex is where --join-posts looks up liked posts; a like's
+// subject may be a post or a reply
+const likedPostsIndex = "posts,replies"
+
+// joinLikedPosts returns likes joined to the posts and replies they like,
+// looked up in batches of fetchSize, with post embeddings in
+// embeddingFormat. Likes of posts that are not found are kept, with empty
+// post columns.
+func joinLikedPosts(ctx context.Context, esClient *elasticsearch.Client, logger *common.IngestLogger, likes []common.ExtractLike, embeddingFormat string, fetchSize int) ([]common.ExtractLikeWithPost, error) {
+	if fetchSize <= 0 {
+		fetchSize = 1000
+	}
+	rows := make([]common.ExtractLikeWithPost, 0, len(likes))
+	missing := 0
+	for start := 0; start < len(likes); start += fetchSize {
+		batch := likes[start:min(start+fetchSize, len(likes))]
+		seen := make(map[string]bool, len(batch))
+		var subjectURIs []string
+		for _, like := range batch {
+			if !seen[like.SubjectURI] {
+				seen[like.SubjectURI] = true
+				subjectURIs = append(subjectURIs, like.SubjectURI)
+			}
+		}
+
+		found, err := common.FetchPosts(ctx, esClient, likedPostsIndex, subjectURIs, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch liked posts: %w", err)
+		}
+		posts := make(map[string]common.ExtractPost, len(found))
+		for atURI, data := range found {
+			posts[atURI] = common.NewExtractPostAs(common.PostFromHit(data), embeddingFormat)
+		}
+
+		for _, like := range batch {
+			post, ok := posts[like.SubjectURI]
+			if !ok {
+				rows = append(rows, common.NewExtractLikeWithPost(like, nil))
+				missing++
+				continue
+			}
+			rows = append(rows, common.NewExtractLikeWithPost(like, &post))
+		}
+	}
+	logger.Metric("extract.liked_post_missing_count", float64(missing))
+	return rows, nil
+}
+
+// likesWithPostsFilename names a file of likes joined to their posts for the
+// timestamp of its last like, like generateFilename does for plain likes
+func likesWithPostsFilename(timestamp string) string {
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		t = time.Now().UTC()
+	}
+	return fmt.Sprintf("bsky_likes_with_posts_%s.parquet", t.Format("20060102_150405"))
+}
+
+// writeLikesWithPostsFile joins likes to their posts and writes them like
+// writeLikesParquetFile, to files named by likesWithPostsFilename
+func writeLikesWithPostsFile(ctx context.Context, esClient *elasticsearch.Client, out *output, timeField string, likes []common.ExtractLike, fetchSize int, logger *common.IngestLogger) ([]string, error) {
+	if len(likes) == 0 {
+		return nil, fmt.Errorf("no likes to write")
+	}
+
+	rows, err := joinLikedPosts(ctx, esClient, logger, likes, out.embeddingFormat, fetchSize)
+	if err != nil {
+		return nil, err
+	}
+	return writeNamedRecordFiles(ctx, out, rows, likesWithPostsFilename, func(row common.ExtractLikeWithPost) string {
+		return fileTimestamp(timeField, row.RecordCreatedAt, row.InsertedAt)
+	}, func(row common.ExtractLikeWithPost) string {
+		return row.DID
+	}, logger)
+}
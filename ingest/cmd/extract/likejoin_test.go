@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func TestWriteLikesWithPostsFile(t *testing.T) {
+	es := estest.New(t)
+	es.Put("posts", "at://did:plc:a/app.bsky.feed.post/1", common.PostData{
+		AtURI: "at://did:plc:a/app.bsky.feed.post/1", AuthorDID: "did:plc:a", Content: "hello", Langs: []string{"en"},
+		CreatedAt: "2026-06-01T00:00:00Z", Embeddings: map[string][]float32{"minilm": {0.5, -1}},
+	})
+	es.Put("replies", "at://did:plc:b/app.bsky.feed.post/2", common.PostData{
+		AtURI: "at://did:plc:b/app.bsky.feed.post/2", AuthorDID: "did:plc:b", Content: "a reply",
+		ThreadParentPost: "at://did:plc:a/app.bsky.feed.post/1", ThreadRootPost: "at://did:plc:a/app.bsky.feed.post/1",
+	})
+
+	likes := []common.ExtractLike{
+		{DID: "did:plc:x", SubjectURI: "at://did:plc:a/app.bsky.feed.post/1", RecordCreatedAt: "2026-06-03T10:00:00Z"},
+		{DID: "did:plc:y", SubjectURI: "at://did:plc:b/app.bsky.feed.post/2", RecordCreatedAt: "2026-06-03T10:01:00Z"},
+		{DID: "did:plc:y", SubjectURI: "at://did:plc:c/app.bsky.feed.post/gone", RecordCreatedAt: "2026-06-03T10:02:00Z"},
+		{DID: "did:plc:z", SubjectURI: "at://did:plc:a/app.bsky.feed.post/1", RecordCreatedAt: "2026-06-03T10:03:00Z"},
+	}
+	dir := t.TempDir()
+	out := &output{path: dir, format: FormatNDJSON, embeddingFormat: common.EmbeddingFormatFloat32}
+	files, err := writeLikesWithPostsFile(context.Background(), es.Client, out, common.TimeFieldCreatedAt, likes, 2, common.NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != "bsky_likes_with_posts_20260603_100300.ndjson" {
+		t.Fatalf("unexpected files %v", files)
+	}
+	if calls := es.Calls(estest.APISearch); len(calls) != 2 {
+		t.Errorf("expected a post lookup per batch of 2 likes, got %d", len(calls))
+	}
+
+	file, err := os.Open(filepath.Join(dir, files[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = file.Close() }()
+	var rows []common.ExtractLikeWithPost
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var row common.ExtractLikeWithPost
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("expected every like written, got %d rows", len(rows))
+	}
+
+	if row := rows[0]; row.DID != "did:plc:x" || row.PostDID != "did:plc:a" || row.PostRecordText != "hello" || len(row.PostLangs) != 1 ||
+		len(row.PostEmbeddingsFloat32["minilm"]) != 2 || row.PostEmbeddings != nil {
+		t.Errorf("unexpected row for a liked post %+v", row)
+	}
+	if row := rows[1]; row.PostRecordText != "a reply" || row.PostReplyParentURI != "at://did:plc:a/app.bsky.feed.post/1" {
+		t.Errorf("unexpected row for a liked reply %+v", row)
+	}
+	if row := rows[2]; row.SubjectURI != "at://did:plc:c/app.bsky.feed.post/gone" || row.PostDID != "" || row.PostRecordText != "" {
+		t.Errorf("expected empty post columns for a post not found, got %+v", row)
+	}
+	if row := rows[3]; row.DID != "did:plc:z" || row.PostRecordText != "hello" {
+		t.Errorf("unexpected row for the second like of a post %+v", row)
+	}
+}
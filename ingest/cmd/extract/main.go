@@ -6,15 +6,13 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"path"
 	"strings"
 	"syscall"
 	"time"
 
-	"cloud.google.com/go/storage"
 	"github.com/elastic/go-elasticsearch/v9"
 	"github.com/greenearth/ingest/internal/common"
-	"github.com/parquet-go/parquet-go"
 )
 
 func main() {
@@ -25,10 +23,29 @@ func main() {
 	startTime := flag.String("start-time", "", "Start time for export window (RFC3339 format, e.g., 2025-01-01T00:00:00Z)")
 	endTime := flag.String("end-time", "", "End time for export window (RFC3339 format, e.g., 2025-12-31T23:59:59Z)")
 	skipInferences := flag.Bool("skip-inferences", false, "Skip exporting inferences for exported posts")
+	timeField := flag.String("time-field", common.TimeFieldCreatedAt, "Field posts and likes are windowed and sorted on: created_at, or indexed_at to export what was ingested in the window")
+	cursorFile := flag.String("cursor-file", "", "Local path or gs://bucket/object recording the last record exported from each index")
+	resume := flag.Bool("resume", false, "Export everything since the last successful run recorded in --cursor-file instead of a fixed window")
+	runID := flag.String("run-id", "", "Record this run's progress next to its files, so rerunning with the same ID after a crash resumes where it stopped instead of writing completed files again")
+	authorShards := flag.Int("author-shards", 0, "Write posts, replies, and likes under author_shard=N directories, N being a hash of the author DID modulo this many shards, consistent across runs; 0 does not shard")
+	partitionBy := flag.String("partition-by", PartitionNone, "Write files under Hive-style partition directories from record timestamps: date (dt=YYYY-MM-DD) or hour (dt=YYYY-MM-DD/hour=HH)")
+	format := flag.String("format", FormatParquet, "File format to write: parquet, ndjson (one JSON object per line), or csv (with a header row)")
+	gzipOutput := flag.Bool("gzip", false, "Gzip ndjson or csv files (adds .gz to their names)")
+	slices := flag.Int("slices", 1, "Export posts, replies, and likes in this many slices of a point in time in parallel, each writing its own files")
+	embeddingFormat := flag.String("embedding-format", common.EmbeddingFormatBase85, "Column and encoding of post embeddings: base85 (zlib-compressed, in embeddings), float32 (lists of floats, in embeddings_float32), or float16 (packed half-precision floats, in embeddings_float16)")
+	enrichLikes := flag.Bool("enrich-like-counts", false, "Write each exported post and reply's like count, counted in the likes index, to like_count")
+	joinPosts := flag.Bool("join-posts", false, "Write exported likes joined to the posts and replies they like, to bsky_likes_with_posts files instead of bsky_likes files")
+	authorDIDs := flag.String("author-did", "", "Only export posts, replies, and likes by these authors (comma-separated DIDs)")
+	hasEmbeddings := flag.Bool("has-embeddings", false, "Only export posts and replies that have embeddings")
+	contentMatch := flag.String("content-match", "", "Only export posts and replies whose content matches this Elasticsearch simple_query_string expression")
+	servePort := flag.Int("serve-port", 0, "Instead of a batch export, serve ad-hoc NDJSON pulls of the GE_EXTRACT_INDICES posts, replies, and likes on /export at this port")
+	compact := flag.Bool("compact", false, "Instead of exporting, merge the small parquet files in each partition directory of --output-path into files of up to --compact-target-mb, deleting the originals")
+	compactTargetMB := flag.Int("compact-target-mb", defaultCompactTargetMB, "Size in MB compaction merges files up to")
 	flag.Parse()
 
 	config := common.LoadConfig()
 	logger := common.NewLogger(config.LoggingEnabled)
+	logger.SetService("extract")
 	otelCollector, err := common.NewOTelMetricCollector("extract", config.Environment, config.GCPProjectID, config.GCPRegion, config.MetricExportIntervalSec)
 	if err != nil {
 		logger.Error("Failed to create OTel metric collector: %v (continuing without metrics)", err)
@@ -60,6 +77,61 @@ func main() {
 		*endTime = calculatedEndTime
 	}
 
+	if err := common.ValidateTimeField(*timeField); err != nil {
+		logger.Error("Invalid --time-field: %v", err)
+		os.Exit(1)
+	}
+
+	if err := validatePartitionBy(*partitionBy); err != nil {
+		logger.Error("Invalid --partition-by: %v", err)
+		os.Exit(1)
+	}
+
+	if err := validateAuthorShards(*authorShards); err != nil {
+		logger.Error("Invalid --author-shards: %v", err)
+		os.Exit(1)
+	}
+
+	if err := validateFormat(*format, *gzipOutput); err != nil {
+		logger.Error("Invalid --format: %v", err)
+		os.Exit(1)
+	}
+
+	if err := common.ValidateEmbeddingFormat(*embeddingFormat); err != nil {
+		logger.Error("Invalid --embedding-format: %v", err)
+		os.Exit(1)
+	}
+
+	if err := validateSlices(*slices); err != nil {
+		logger.Error("Invalid --slices: %v", err)
+		os.Exit(1)
+	}
+
+	if err := validateRunID(*runID, *slices); err != nil {
+		logger.Error("Invalid --run-id: %v", err)
+		os.Exit(1)
+	}
+
+	filter := common.ExportFilter{HasEmbeddings: *hasEmbeddings, ContentMatch: *contentMatch}
+	if filter.AuthorDIDs, err = parseAuthorDIDs(*authorDIDs); err != nil {
+		logger.Error("Invalid --author-did: %v", err)
+		os.Exit(1)
+	}
+
+	if *resume {
+		if *cursorFile == "" {
+			logger.Error("--resume requires --cursor-file")
+			os.Exit(1)
+		}
+		// A resumed export stops short of now, leaving records still waiting
+		// on an index refresh to the next run. Indices without a cursor yet
+		// export from --start-time or --window-size-min.
+		if *endTime == "" || *windowSizeMin > 0 {
+			*endTime = resumeEndTime(time.Now().UTC())
+		}
+		logger.Info("Resuming from %s, exporting up to %s", *cursorFile, *endTime)
+	}
+
 	// Validate time window if provided
 	if *startTime != "" {
 		if _, err := time.Parse(time.RFC3339, *startTime); err != nil {
@@ -75,7 +147,7 @@ func main() {
 	}
 
 	if *startTime != "" || *endTime != "" {
-		logger.Info("Time window filter: %s to %s",
+		logger.Info("Time window filter on %s: %s to %s", *timeField,
 			func() string {
 				if *startTime != "" {
 					return *startTime
@@ -101,14 +173,41 @@ func main() {
 		cancel()
 	}()
 
+	if *compact {
+		if *dryRun {
+			logger.Error("--compact cannot be combined with --dry-run")
+			os.Exit(1)
+		}
+		if err := runCompaction(ctx, config, logger, *outputPath, *compactTargetMB); err != nil {
+			logger.Error("Compaction failed: %v", err)
+			os.Exit(1)
+		}
+		logger.Info("Compaction completed successfully")
+		return
+	}
+
 	indices := parseIndices(config.ExtractIndices)
 	if len(indices) == 0 {
 		logger.Error("No indices specified in GE_EXTRACT_INDICES environment variable")
 		os.Exit(1)
 	}
 
+	if *servePort > 0 {
+		if err := runExportServer(ctx, config, logger, *skipTLSVerify, indices, *servePort); err != nil {
+			logger.Error("Export server failed: %v", err)
+			os.Exit(1)
+		}
+		logger.Info("Export server stopped")
+		return
+	}
+
+	if err := validateFilter(filter, indices); err != nil {
+		logger.Error("Invalid export filter: %v", err)
+		os.Exit(1)
+	}
+
 	logger.Info("Starting export from %d index(es): %s", len(indices), strings.Join(indices, ", "))
-	if err := runExport(ctx, config, logger, *dryRun, *skipTLSVerify, *outputPath, indices, *startTime, *endTime, *skipInferences); err != nil {
+	if err := runExport(ctx, config, logger, *dryRun, *skipTLSVerify, *outputPath, indices, *startTime, *endTime, *timeField, *skipInferences, *cursorFile, *resume, *partitionBy, *authorShards, *format, *gzipOutput, *embeddingFormat, *enrichLikes, *joinPosts, *slices, filter, *runID); err != nil {
 		logger.Error("Export failed: %v", err)
 		logger.Metric("extract.run_error_count", 1)
 		os.Exit(1)
@@ -118,7 +217,7 @@ func main() {
 }
 
 func runExport(ctx context.Context, config *common.Config, logger *common.IngestLogger,
-	dryRun, skipTLSVerify bool, outputPath string, indices []string, startTime, endTime string, skipInferences bool) error {
+	dryRun, skipTLSVerify bool, outputPath string, indices []string, startTime, endTime, timeField string, skipInferences bool, cursorFile string, resume bool, partitionBy string, authorShards int, format string, gzipOutput bool, embeddingFormat string, enrichLikes, joinPosts bool, slices int, filter common.ExportFilter, runID string) error {
 	runStart := time.Now()
 	logger.Metric("extract.run_attempted_count", 1)
 
@@ -134,48 +233,44 @@ func runExport(ctx context.Context, config *common.Config, logger *common.Ingest
 		return fmt.Errorf("output path not specified (use --output-path, GE_PARQUET_DESTINATION)")
 	}
 
-	// Check if GCS destination
-	isGCS := strings.HasPrefix(outputPath, "gs://")
-	var gcsClient *storage.Client
-	var gcsBucket, gcsPrefix string
-
-	if isGCS {
-		// Parse GCS path: gs://bucket/prefix
-		path := strings.TrimPrefix(outputPath, "gs://")
-		parts := strings.SplitN(path, "/", 2)
-		if len(parts) < 1 {
-			return fmt.Errorf("invalid GCS path: %s (expected gs://bucket/path)", outputPath)
-		}
-		gcsBucket = parts[0]
-		if len(parts) == 2 {
-			gcsPrefix = parts[1]
-			if !strings.HasSuffix(gcsPrefix, "/") {
-				gcsPrefix += "/"
-			}
-		}
-
-		if !dryRun {
-			var err error
-			gcsClient, err = storage.NewClient(ctx)
-			if err != nil {
-				return fmt.Errorf("failed to create GCS client: %w", err)
-			}
-			defer func() {
-				if err := gcsClient.Close(); err != nil {
-					logger.Error("Failed to close GSC client: %v", err)
-				}
-			}()
-		}
-
-		logger.Info("Using GCS destination: gs://%s/%s", gcsBucket, gcsPrefix)
-	} else {
-		// For local destinations, create directory
-		if !dryRun {
-			if err := os.MkdirAll(outputPath, 0750); err != nil {
-				return fmt.Errorf("failed to create output directory: %w", err)
-			}
+	out, err := newOutput(ctx, outputPath, dryRun, config)
+	if err != nil {
+		return err
+	}
+	out.partitionBy = partitionBy
+	out.authorShards = authorShards
+	out.format = format
+	out.gzip = gzipOutput
+	out.embeddingFormat = embeddingFormat
+	defer func() {
+		if err := out.Close(); err != nil {
+			logger.Error("Failed to close output client: %v", err)
 		}
-		logger.Info("Using local destination: %s", outputPath)
+	}()
+	logger.Info("Using destination: %s", out)
+	if partitionBy != PartitionNone {
+		logger.Info("Partitioning files by %s", partitionBy)
+	}
+	if authorShards > 0 {
+		logger.Info("Sharding posts, replies, and likes by author into %d shards", authorShards)
+	}
+	if format != FormatParquet || gzipOutput {
+		logger.Info("Writing %s files", strings.TrimPrefix(out.filename(".parquet"), "."))
+	}
+	if embeddingFormat != common.EmbeddingFormatBase85 {
+		logger.Info("Writing post embeddings as %s", embeddingFormat)
+	}
+	if enrichLikes {
+		logger.Info("Enriching posts and replies with like counts from the %s index", likesAlias)
+	}
+	if joinPosts {
+		logger.Info("Joining likes to the liked posts in %s", likedPostsIndex)
+	}
+	if slices > 1 {
+		logger.Info("Exporting posts, replies, and likes in %d parallel slices", slices)
+	}
+	if !filter.IsZero() {
+		logger.Info("Filtering posts, replies, and likes: %s", describeFilter(filter))
 	}
 
 	esConfig := common.ElasticsearchConfig{
@@ -188,31 +283,124 @@ func runExport(ctx context.Context, config *common.Config, logger *common.Ingest
 	if err != nil {
 		return fmt.Errorf("failed to create ES client: %w", err)
 	}
+	common.CheckAPIKeyPrivileges(ctx, esClient, "extract", config, logger)
+
+	denyList, err := common.NewDenyList(ctx, config.DenyListSource, esClient, logger)
+	if err != nil {
+		return fmt.Errorf("failed to load deny list: %w", err)
+	}
+
+	guard, err := common.NewTombstoneGuard(esClient, config.TombstoneGuard, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create tombstone guard: %w", err)
+	}
+
+	accounts, err := common.NewAccountFilter(esClient, config.InactiveAccounts, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create inactive account filter: %w", err)
+	}
+
+	policy, err := common.RetentionPolicyFromConfig(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to load retention policy: %w", err)
+	}
+
+	var cursors *common.StateManager
+	if cursorFile != "" {
+		cursors, err = common.NewStateManager(cursorFile, logger)
+		if err != nil {
+			return fmt.Errorf("failed to load export cursor: %w", err)
+		}
+	}
+
+	// A rerun of a run given a --run-id keeps the run's window, skips the
+	// indices it completed and resumes the one it stopped in
+	var progress *runProgress
+	if runID != "" && dryRun {
+		logger.Info("Dry-run: Would record the progress of run %s to %s", runID, out.location(runProgressFilename(runID)))
+	} else if runID != "" {
+		var resumed bool
+		progress, resumed, err = loadRunProgress(ctx, out, runID, startTime, endTime, logger)
+		if err != nil {
+			return err
+		}
+		if resumed {
+			startTime, endTime = progress.StartTime, progress.EndTime
+			logger.Info("Resuming run %s where it stopped, on its window of %s to %s", runID, startTime, endTime)
+		} else {
+			logger.Info("Recording the progress of run %s to %s", runID, out.location(runProgressFilename(runID)))
+		}
+	}
+
+	card := newDatasetCard(runStart, startTime, endTime, timeField, filter)
+	card.AuthorShards = authorShards
+	card.LikesWithPosts = joinPosts
 
 	for _, indexName := range indices {
+		if progress.completed(indexName) {
+			logger.Info("Run %s already exported index %s, skipping it", runID, indexName)
+			logger.Metric("extract.index_skipped_count", 1)
+			continue
+		}
+
 		logger.Info("Starting export from index: %s", indexName)
 		logger.Metric("extract.index_attempted_count", 1)
 
 		indexType := getIndexType(indexName, logger)
 
+		// cursor starts at the previous run's last record when resuming, and
+		// follows this run's records for the next one
+		var cursor, previous common.ExportCursor
+		var hasPrevious bool
+		windowStart := startTime
+		if cursors != nil {
+			previous, hasPrevious = cursors.GetExportCursor(indexName)
+		}
+		if resume && hasPrevious {
+			cursor = previous
+			windowStart = resumeStartTime(previous, timeField)
+			logger.Info("Resuming export of %s after its last exported record (%s %s)", indexName, timeField, windowStart)
+		} else if resume {
+			logger.Info("No export cursor for %s yet, exporting the window given by --start-time or --window-size-min", indexName)
+		}
+		if completed, files, ok := progress.resumeCursor(indexName); ok {
+			cursor = completed
+			logger.Info("Run %s already wrote %d file(s) of %s, resuming after the last record they hold", runID, files, indexName)
+		}
+
+		indexStartTime := exportStartTime(windowStart, policy.Windows(string(indexType)).Export, time.Now().UTC())
+		if indexStartTime != windowStart {
+			logger.Info("Export of %s starts at %s, the start of its export window in %s", indexName, indexStartTime, policy.Source)
+		}
+
 		var exportErr error
+		var indexCard *indexCard
 		switch indexType {
 		case IndexTypePosts:
 			var atURIs []string
-			atURIs, exportErr = runExportForPosts(ctx, esClient, logger, dryRun, outputPath, isGCS, gcsClient, gcsBucket, gcsPrefix, indexName, startTime, endTime, config)
+			indexCard = card.index(indexName, indexType)
+			atURIs, exportErr = exportPosts(ctx, esClient, logger, dryRun, out, indexName, indexStartTime, endTime, timeField, filter, enrichLikes, &cursor, config, denyList, guard, accounts, indexCard, progress, slices)
 			if exportErr == nil && !skipInferences && len(atURIs) > 0 {
-				if infErr := runExportForPostInferences(ctx, esClient, logger, dryRun, outputPath, isGCS, gcsClient, gcsBucket, gcsPrefix, atURIs, config); infErr != nil {
+				if infErr := runExportForPostInferences(ctx, esClient, logger, dryRun, out, atURIs, config); infErr != nil {
 					logger.Error("Failed to export inferences for posts: %v", infErr)
 					logger.Metric("extract.inference_error_count", 1)
 				}
 			}
 		case IndexTypeReplies:
 			// Replies have the same schema as posts; no inferences export.
-			_, exportErr = runExportForPosts(ctx, esClient, logger, dryRun, outputPath, isGCS, gcsClient, gcsBucket, gcsPrefix, indexName, startTime, endTime, config)
+			indexCard = card.index(indexName, indexType)
+			_, exportErr = exportPosts(ctx, esClient, logger, dryRun, out, indexName, indexStartTime, endTime, timeField, filter, enrichLikes, &cursor, config, denyList, guard, accounts, indexCard, progress, slices)
 		case IndexTypeLikes:
-			exportErr = runExportForLikes(ctx, esClient, logger, dryRun, outputPath, isGCS, gcsClient, gcsBucket, gcsPrefix, indexName, startTime, endTime, config)
+			indexCard = card.index(indexName, indexType)
+			exportErr = exportLikes(ctx, esClient, logger, dryRun, out, indexName, indexStartTime, endTime, timeField, filter, joinPosts, &cursor, config, denyList, guard, indexCard, progress, slices)
 		case IndexTypeHashtags:
-			exportErr = runExportForHashtags(ctx, esClient, logger, dryRun, outputPath, isGCS, gcsClient, gcsBucket, gcsPrefix, indexName, startTime, endTime, config)
+			exportErr = runExportForHashtags(ctx, esClient, logger, dryRun, out, indexName, indexStartTime, endTime, config)
+		case IndexTypePostTombstones:
+			exportErr = runExportForPostTombstones(ctx, esClient, logger, dryRun, out, indexName, indexStartTime, endTime, config, denyList)
+		case IndexTypeLikeTombstones:
+			exportErr = runExportForLikeTombstones(ctx, esClient, logger, dryRun, out, indexName, indexStartTime, endTime, config, denyList)
+		case IndexTypeUserFeatures:
+			exportErr = runExportForUserFeatures(ctx, esClient, logger, dryRun, out, indexName, indexStartTime, endTime, config, denyList)
 		case IndexTypeUnknown:
 			logger.Error("Skipping index %s: unknown index type", indexName)
 			logger.Metric("extract.index_error_count", 1)
@@ -224,29 +412,53 @@ func runExport(ctx context.Context, config *common.Config, logger *common.Ingest
 		}
 
 		if exportErr != nil {
+			indexCard.fail(exportErr)
 			logger.Error("Failed to export index %s: %v", indexName, exportErr)
 			logger.Metric("extract.index_error_count", 1)
 			continue
 		}
 
+		if cursors != nil && !dryRun {
+			if err := cursors.UpdateExportCursor(indexName, nextExportCursor(cursor, previous, endTime, runStart)); err != nil {
+				logger.Error("Failed to record export cursor for %s: %v", indexName, err)
+				logger.Metric("extract.cursor_error_count", 1)
+			}
+		}
+
+		// Recorded after the cursor, so a rerun never skips an index whose
+		// cursor was not recorded
+		if err := progress.complete(ctx, indexName); err != nil {
+			logger.Error("Failed to record run progress for %s: %v", indexName, err)
+			logger.Metric("extract.run_progress_error_count", 1)
+		}
+
 		logger.Metric("extract.index_success_count", 1)
 		logger.Info("Completed export from index: %s", indexName)
 	}
 
+	// The card covers posts, replies, and likes; a failed card does not
+	// fail the export it describes
+	if dryRun {
+		logger.Info("Dry-run: Would write %s", out.location(datasetCardFilename(runStart)))
+	} else if err := writeDatasetCard(ctx, out, card, runStart, logger); err != nil {
+		logger.Error("Failed to write dataset card: %v", err)
+		logger.Metric("extract.dataset_card_error_count", 1)
+	}
+
 	logger.Metric("extract.run_duration_ms", float64(time.Since(runStart).Milliseconds()))
 	logger.Metric("extract.run_success_count", 1)
 	return nil
 }
 
 func runExportForPosts(ctx context.Context, esClient *elasticsearch.Client, logger *common.IngestLogger,
-	dryRun bool, outputPath string, isGCS bool, gcsClient *storage.Client, gcsBucket, gcsPrefix, indexName, startTime, endTime string, config *common.Config) ([]string, error) {
+	dryRun bool, out *output, indexName, startTime, endTime, timeField string, filter common.ExportFilter, enrichLikes bool, cursor *common.ExportCursor, config *common.Config, denyList *common.DenyList, guard *common.TombstoneGuard, accounts *common.AccountFilter, card *indexCard, progress *runProgress, pit common.ExportPIT) ([]string, error) {
 
 	maxRecordsPerFile := config.ParquetMaxRecords
 	fetchSize := config.ExtractFetchSize
 
 	var fileNum = 1
 	var totalRecords int64 = 0
-	var afterCreatedAt, afterIndexedAt string
+	searchAfter := common.PITSearchAfter(common.SortCursor(timeField, cursor.CreatedAt, cursor.IndexedAt))
 	var currentFileBatch []common.ExtractPost
 	var allAtURIs []string
 
@@ -254,15 +466,17 @@ func runExportForPosts(ctx context.Context, esClient *elasticsearch.Client, logg
 		select {
 		case <-ctx.Done():
 			if len(currentFileBatch) > 0 && !dryRun {
-				if err := writePostsParquetFile(ctx, outputPath, isGCS, gcsClient, gcsBucket, gcsPrefix, indexName, currentFileBatch, logger); err != nil {
+				if files, err := writePostsParquetFile(ctx, out, indexName, timeField, currentFileBatch, logger); err != nil {
 					logger.Error("Failed to write final parquet file: %v", err)
+				} else if err := progress.fileWritten(ctx, indexName, *cursor, files); err != nil {
+					logger.Error("Failed to record run progress: %v", err)
 				}
 			}
 			return allAtURIs, ctx.Err()
 		default:
 		}
 
-		response, err := common.FetchPosts(ctx, esClient, logger, indexName, startTime, endTime, afterCreatedAt, afterIndexedAt, fetchSize)
+		response, err := common.FetchPostsPIT(ctx, esClient, logger, pit, startTime, endTime, timeField, filter, searchAfter, fetchSize)
 		if err != nil {
 			return allAtURIs, fmt.Errorf("failed to fetch posts: %w", err)
 		}
@@ -272,7 +486,26 @@ func runExportForPosts(ctx context.Context, esClient *elasticsearch.Client, logg
 			break
 		}
 
-		batchPosts := common.HitsToExtractPosts(response.Hits.Hits)
+		batchPosts := dropDenied(common.HitsToExtractPostsAs(response.Hits.Hits, out.embeddingFormat), denyList, func(post common.ExtractPost) (string, string) {
+			return post.DID, post.AtURI
+		})
+		batchPosts, err = common.FilterTombstoned(ctx, guard, tombstoneAlias(getIndexType(indexName, logger)), batchPosts, func(post common.ExtractPost) string {
+			return post.AtURI
+		})
+		if err != nil {
+			return allAtURIs, err
+		}
+		batchPosts = common.FilterInactiveAccounts(ctx, accounts, batchPosts, func(post common.ExtractPost) string {
+			return post.DID
+		}, func(post *common.ExtractPost, status string) {
+			post.AccountStatus = status
+		})
+		if enrichLikes {
+			if err := enrichLikeCounts(ctx, esClient, logger, batchPosts, fetchSize); err != nil {
+				return allAtURIs, err
+			}
+		}
+		card.addPosts(batchPosts)
 		currentFileBatch = append(currentFileBatch, batchPosts...)
 		totalRecords += int64(len(batchPosts))
 
@@ -282,34 +515,44 @@ func runExportForPosts(ctx context.Context, esClient *elasticsearch.Client, logg
 
 		logger.Debug("Fetched %d records (total: %d)", len(batchPosts), totalRecords)
 
+		// A file written now ends with the page's last record, so the run
+		// progress it records resumes after the page
+		lastHit := response.Hits.Hits[len(response.Hits.Hits)-1]
+		cursor.CreatedAt, cursor.IndexedAt = lastHit.Source.CreatedAt, lastHit.Source.IndexedAt
+		searchAfter = lastHit.Sort
+
 		if maxRecordsPerFile > 0 && int64(len(currentFileBatch)) >= maxRecordsPerFile {
 			if !dryRun {
-				if err := writePostsParquetFile(ctx, outputPath, isGCS, gcsClient, gcsBucket, gcsPrefix, indexName, currentFileBatch, logger); err != nil {
+				files, err := writePostsParquetFile(ctx, out, indexName, timeField, currentFileBatch, logger)
+				if err != nil {
 					return allAtURIs, fmt.Errorf("failed to write parquet file: %w", err)
 				}
+				if err := progress.fileWritten(ctx, indexName, *cursor, files); err != nil {
+					return allAtURIs, fmt.Errorf("failed to record run progress: %w", err)
+				}
 				fileNum++
 			} else {
 				lastPost := currentFileBatch[len(currentFileBatch)-1]
-				filename := generateFilename(indexName, lastPost.RecordCreatedAt, logger)
+				filename := out.filename(generateFilename(indexName, fileTimestamp(timeField, lastPost.RecordCreatedAt, lastPost.InsertedAt), logger))
 				logger.Debug("Dry-run: Would write %s with %d records", filename, len(currentFileBatch))
 				fileNum++
 			}
 			currentFileBatch = currentFileBatch[:0]
 		}
-
-		lastHit := response.Hits.Hits[len(response.Hits.Hits)-1]
-		afterCreatedAt = lastHit.Source.CreatedAt
-		afterIndexedAt = lastHit.Source.IndexedAt
 	}
 
 	if len(currentFileBatch) > 0 {
 		if !dryRun {
-			if err := writePostsParquetFile(ctx, outputPath, isGCS, gcsClient, gcsBucket, gcsPrefix, indexName, currentFileBatch, logger); err != nil {
+			files, err := writePostsParquetFile(ctx, out, indexName, timeField, currentFileBatch, logger)
+			if err != nil {
 				return allAtURIs, fmt.Errorf("failed to write final parquet file: %w", err)
 			}
+			if err := progress.fileWritten(ctx, indexName, *cursor, files); err != nil {
+				return allAtURIs, fmt.Errorf("failed to record run progress: %w", err)
+			}
 		} else {
 			lastPost := currentFileBatch[len(currentFileBatch)-1]
-			filename := generateFilename(indexName, lastPost.RecordCreatedAt, logger)
+			filename := out.filename(generateFilename(indexName, fileTimestamp(timeField, lastPost.RecordCreatedAt, lastPost.InsertedAt), logger))
 			logger.Debug("Dry-run: Would write final %s with %d records", filename, len(currentFileBatch))
 		}
 	}
@@ -321,29 +564,46 @@ func runExportForPosts(ctx context.Context, esClient *elasticsearch.Client, logg
 }
 
 func runExportForLikes(ctx context.Context, esClient *elasticsearch.Client, logger *common.IngestLogger,
-	dryRun bool, outputPath string, isGCS bool, gcsClient *storage.Client, gcsBucket, gcsPrefix, indexName, startTime, endTime string, config *common.Config) error {
+	dryRun bool, out *output, indexName, startTime, endTime, timeField string, filter common.ExportFilter, joinPosts bool, cursor *common.ExportCursor, config *common.Config, denyList *common.DenyList, guard *common.TombstoneGuard, card *indexCard, progress *runProgress, pit common.ExportPIT) error {
 
 	maxRecordsPerFile := config.ParquetMaxRecords
 	fetchSize := config.ExtractFetchSize
 
 	var fileNum = 1
 	var totalRecords int64 = 0
-	var afterCreatedAt, afterIndexedAt string
+	searchAfter := common.PITSearchAfter(common.SortCursor(timeField, cursor.CreatedAt, cursor.IndexedAt))
 	var currentFileBatch []common.ExtractLike
 
+	// With --join-posts, likes are written joined to the posts they like
+	writeLikes := func(likes []common.ExtractLike) ([]string, error) {
+		if joinPosts {
+			return writeLikesWithPostsFile(ctx, esClient, out, timeField, likes, fetchSize, logger)
+		}
+		return writeLikesParquetFile(ctx, out, indexName, timeField, likes, logger)
+	}
+	likesFilename := func(like common.ExtractLike) string {
+		timestamp := fileTimestamp(timeField, like.RecordCreatedAt, like.InsertedAt)
+		if joinPosts {
+			return out.filename(likesWithPostsFilename(timestamp))
+		}
+		return out.filename(generateFilename(indexName, timestamp, logger))
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			if len(currentFileBatch) > 0 && !dryRun {
-				if err := writeLikesParquetFile(ctx, outputPath, isGCS, gcsClient, gcsBucket, gcsPrefix, indexName, currentFileBatch, logger); err != nil {
+				if files, err := writeLikes(currentFileBatch); err != nil {
 					logger.Error("Failed to write final parquet file: %v", err)
+				} else if err := progress.fileWritten(ctx, indexName, *cursor, files); err != nil {
+					logger.Error("Failed to record run progress: %v", err)
 				}
 			}
 			return ctx.Err()
 		default:
 		}
 
-		response, err := common.FetchLikes(ctx, esClient, logger, indexName, startTime, endTime, afterCreatedAt, afterIndexedAt, fetchSize)
+		response, err := common.FetchLikesPIT(ctx, esClient, logger, pit, startTime, endTime, timeField, filter, searchAfter, fetchSize)
 		if err != nil {
 			return fmt.Errorf("failed to fetch likes: %w", err)
 		}
@@ -353,40 +613,65 @@ func runExportForLikes(ctx context.Context, esClient *elasticsearch.Client, logg
 			break
 		}
 
-		batchLikes := common.LikeHitsToExtractLikes(response.Hits.Hits)
+		// Extracted likes carry no at_uri, so the tombstone check runs on the hits
+		hits, err := common.FilterTombstoned(ctx, guard, tombstoneAlias(IndexTypeLikes), response.Hits.Hits, func(hit common.LikeHit) string {
+			return hit.Source.AtURI
+		})
+		if err != nil {
+			return err
+		}
+		batchLikes := dropDenied(common.LikeHitsToExtractLikes(hits), denyList, func(like common.ExtractLike) (string, string) {
+			return like.DID, "like of " + like.SubjectURI
+		})
+		card.addLikes(batchLikes)
 		currentFileBatch = append(currentFileBatch, batchLikes...)
 		totalRecords += int64(len(batchLikes))
 
 		logger.Debug("Fetched %d records (total: %d)", len(batchLikes), totalRecords)
 
+		// A file written now ends with the page's last record, so the run
+		// progress it records resumes after the page
+		lastHit := response.Hits.Hits[len(response.Hits.Hits)-1]
+		cursor.CreatedAt, cursor.IndexedAt = lastHit.Source.CreatedAt, lastHit.Source.IndexedAt
+		searchAfter = lastHit.Sort
+
 		if maxRecordsPerFile > 0 && int64(len(currentFileBatch)) >= maxRecordsPerFile {
 			if !dryRun {
-				if err := writeLikesParquetFile(ctx, outputPath, isGCS, gcsClient, gcsBucket, gcsPrefix, indexName, currentFileBatch, logger); err != nil {
+				files, err := writeLikes(currentFileBatch)
+				if err != nil {
 					return fmt.Errorf("failed to write parquet file: %w", err)
 				}
+				if err := progress.fileWritten(ctx, indexName, *cursor, files); err != nil {
+					return fmt.Errorf("failed to record run progress: %w", err)
+				}
+				// An /export pull of an old window would report its canaries late
+				if out.stream == nil {
+					common.ObserveExportedCanaryLikes(currentFileBatch, time.Now(), config.CanaryExportSLO, logger)
+				}
 				fileNum++
 			} else {
-				lastLike := currentFileBatch[len(currentFileBatch)-1]
-				filename := generateFilename(indexName, lastLike.RecordCreatedAt, logger)
+				filename := likesFilename(currentFileBatch[len(currentFileBatch)-1])
 				logger.Debug("Dry-run: Would write %s with %d records", filename, len(currentFileBatch))
 				fileNum++
 			}
 			currentFileBatch = currentFileBatch[:0]
 		}
-
-		lastHit := response.Hits.Hits[len(response.Hits.Hits)-1]
-		afterCreatedAt = lastHit.Source.CreatedAt
-		afterIndexedAt = lastHit.Source.IndexedAt
 	}
 
 	if len(currentFileBatch) > 0 {
 		if !dryRun {
-			if err := writeLikesParquetFile(ctx, outputPath, isGCS, gcsClient, gcsBucket, gcsPrefix, indexName, currentFileBatch, logger); err != nil {
+			files, err := writeLikes(currentFileBatch)
+			if err != nil {
 				return fmt.Errorf("failed to write final parquet file: %w", err)
 			}
+			if err := progress.fileWritten(ctx, indexName, *cursor, files); err != nil {
+				return fmt.Errorf("failed to record run progress: %w", err)
+			}
+			if out.stream == nil {
+				common.ObserveExportedCanaryLikes(currentFileBatch, time.Now(), config.CanaryExportSLO, logger)
+			}
 		} else {
-			lastLike := currentFileBatch[len(currentFileBatch)-1]
-			filename := generateFilename(indexName, lastLike.RecordCreatedAt, logger)
+			filename := likesFilename(currentFileBatch[len(currentFileBatch)-1])
 			logger.Debug("Dry-run: Would write final %s with %d records", filename, len(currentFileBatch))
 		}
 	}
@@ -398,7 +683,7 @@ func runExportForLikes(ctx context.Context, esClient *elasticsearch.Client, logg
 }
 
 func runExportForHashtags(ctx context.Context, esClient *elasticsearch.Client, logger *common.IngestLogger,
-	dryRun bool, outputPath string, isGCS bool, gcsClient *storage.Client, gcsBucket, gcsPrefix, indexName, startTime, endTime string, config *common.Config) error {
+	dryRun bool, out *output, indexName, startTime, endTime string, config *common.Config) error {
 
 	maxRecordsPerFile := config.ParquetMaxRecords
 	fetchSize := config.ExtractFetchSize
@@ -412,7 +697,7 @@ func runExportForHashtags(ctx context.Context, esClient *elasticsearch.Client, l
 		select {
 		case <-ctx.Done():
 			if len(currentFileBatch) > 0 && !dryRun {
-				if err := writeHashtagsParquetFile(ctx, outputPath, isGCS, gcsClient, gcsBucket, gcsPrefix, indexName, currentFileBatch, logger); err != nil {
+				if err := writeHashtagsParquetFile(ctx, out, indexName, currentFileBatch, logger); err != nil {
 					logger.Error("Failed to write final parquet file: %v", err)
 				}
 			}
@@ -438,13 +723,13 @@ func runExportForHashtags(ctx context.Context, esClient *elasticsearch.Client, l
 
 		if maxRecordsPerFile > 0 && int64(len(currentFileBatch)) >= maxRecordsPerFile {
 			if !dryRun {
-				if err := writeHashtagsParquetFile(ctx, outputPath, isGCS, gcsClient, gcsBucket, gcsPrefix, indexName, currentFileBatch, logger); err != nil {
+				if err := writeHashtagsParquetFile(ctx, out, indexName, currentFileBatch, logger); err != nil {
 					return fmt.Errorf("failed to write parquet file: %w", err)
 				}
 				fileNum++
 			} else {
 				lastHashtag := currentFileBatch[len(currentFileBatch)-1]
-				filename := generateFilename(indexName, lastHashtag.Hour, logger)
+				filename := out.filename(generateFilename(indexName, lastHashtag.Hour, logger))
 				logger.Debug("Dry-run: Would write %s with %d records", filename, len(currentFileBatch))
 				fileNum++
 			}
@@ -457,12 +742,12 @@ func runExportForHashtags(ctx context.Context, esClient *elasticsearch.Client, l
 
 	if len(currentFileBatch) > 0 {
 		if !dryRun {
-			if err := writeHashtagsParquetFile(ctx, outputPath, isGCS, gcsClient, gcsBucket, gcsPrefix, indexName, currentFileBatch, logger); err != nil {
+			if err := writeHashtagsParquetFile(ctx, out, indexName, currentFileBatch, logger); err != nil {
 				return fmt.Errorf("failed to write final parquet file: %w", err)
 			}
 		} else {
 			lastHashtag := currentFileBatch[len(currentFileBatch)-1]
-			filename := generateFilename(indexName, lastHashtag.Hour, logger)
+			filename := out.filename(generateFilename(indexName, lastHashtag.Hour, logger))
 			logger.Debug("Dry-run: Would write final %s with %d records", filename, len(currentFileBatch))
 		}
 	}
@@ -473,6 +758,55 @@ func runExportForHashtags(ctx context.Context, esClient *elasticsearch.Client, l
 	return nil
 }
 
+// dropDenied returns records without those whose author is on the deny
+// list. record returns a record's author DID and how the audit log names it.
+func dropDenied[T any](records []T, denyList *common.DenyList, record func(T) (string, string)) []T {
+	kept := records[:0]
+	for _, r := range records {
+		if did, name := record(r); !denyList.Denied(common.DenyStageExport, did, name) {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// exportStartTime returns startTime, moved forward to the start of the export
+// window when it is empty or earlier. A zero window leaves it unchanged.
+func exportStartTime(startTime string, window time.Duration, now time.Time) string {
+	if window <= 0 {
+		return startTime
+	}
+	earliest := now.Add(-window)
+	if startTime != "" {
+		if t, err := time.Parse(time.RFC3339, startTime); err == nil && !t.Before(earliest) {
+			return startTime
+		}
+	}
+	return earliest.Format(time.RFC3339)
+}
+
+// tombstoneAlias returns the alias holding the tombstones of an index type's
+// records, or "" for types without tombstones
+func tombstoneAlias(indexType IndexType) string {
+	switch indexType {
+	case IndexTypePosts:
+		return "post_tombstones"
+	case IndexTypeReplies:
+		return "reply_tombstones"
+	case IndexTypeLikes:
+		return "like_tombstones"
+	default:
+		return ""
+	}
+}
+
+// fileTimestamp returns the timestamp a file is named by: that of its last
+// record on the field records were sorted by
+func fileTimestamp(timeField, createdAt, indexedAt string) string {
+	timestamp, _ := common.SortCursor(timeField, createdAt, indexedAt)
+	return timestamp
+}
+
 func generateFilename(indexName, lastPostTimestamp string, logger *common.IngestLogger) string {
 	// Parse the timestamp to extract date/time
 	// Expected format: "2025-10-12T09:05:56.961Z" or similar RFC3339
@@ -495,6 +829,12 @@ func generateFilename(indexName, lastPostTimestamp string, logger *common.Ingest
 		typeStr = "hashtags"
 	case IndexTypeReplies:
 		typeStr = "replies"
+	case IndexTypePostTombstones:
+		typeStr = "post_tombstones"
+	case IndexTypeLikeTombstones:
+		typeStr = "like_tombstones"
+	case IndexTypeUserFeatures:
+		typeStr = "user_features"
 	case IndexTypeUnknown:
 		typeStr = "unknown"
 	default:
@@ -513,6 +853,14 @@ const (
 	IndexTypeHashtags IndexType = "hashtags"
 	IndexTypeReplies  IndexType = "replies"
 	IndexTypeUnknown  IndexType = ""
+
+	// Tombstone types export deletions, named for the record that was deleted
+	IndexTypePostTombstones IndexType = "post_tombstones"
+	IndexTypeLikeTombstones IndexType = "like_tombstones"
+
+	// IndexTypeUserFeatures is not an index; it derives per-user feature rows
+	// from the likes, posts and replies aliases
+	IndexTypeUserFeatures IndexType = "user_features"
 )
 
 func parseIndices(indicesStr string) []string {
@@ -537,6 +885,19 @@ func parseIndices(indicesStr string) []string {
 func ParseIndexType(indexName string) (IndexType, error) {
 	lowerName := strings.ToLower(indexName)
 
+	if lowerName == string(IndexTypeUserFeatures) {
+		return IndexTypeUserFeatures, nil
+	}
+
+	// Tombstone index names also contain "post" or "like", so check them first
+	if strings.Contains(lowerName, "post_tombstone") {
+		return IndexTypePostTombstones, nil
+	}
+
+	if strings.Contains(lowerName, "like_tombstone") {
+		return IndexTypeLikeTombstones, nil
+	}
+
 	if strings.Contains(lowerName, "replies") {
 		return IndexTypeReplies, nil
 	}
@@ -553,7 +914,7 @@ func ParseIndexType(indexName string) (IndexType, error) {
 		return IndexTypeHashtags, nil
 	}
 
-	return IndexTypeUnknown, fmt.Errorf("index name '%s' does not contain 'replies', 'posts', 'likes', or 'hashtags'", indexName)
+	return IndexTypeUnknown, fmt.Errorf("index name '%s' does not contain 'post_tombstones', 'like_tombstones', 'replies', 'posts', 'likes', or 'hashtags' and is not 'user_features'", indexName)
 }
 
 func getIndexType(indexName string, logger *common.IngestLogger) IndexType {
@@ -564,127 +925,33 @@ func getIndexType(indexName string, logger *common.IngestLogger) IndexType {
 	return indexType
 }
 
-func writePostsParquetFile(ctx context.Context, basePath string, isGCS bool, gcsClient *storage.Client, gcsBucket, gcsPrefix, indexName string, posts []common.ExtractPost, logger *common.IngestLogger) error {
+func writePostsParquetFile(ctx context.Context, out *output, indexName, timeField string, posts []common.ExtractPost, logger *common.IngestLogger) ([]string, error) {
 	if len(posts) == 0 {
-		return fmt.Errorf("no posts to write")
-	}
-
-	// Use the last post's timestamp for the filename (posts are sorted by created_at)
-	lastPost := posts[len(posts)-1]
-	filename := generateFilename(indexName, lastPost.RecordCreatedAt, logger)
-
-	if isGCS {
-		// Write to GCS using streaming parquet writer
-		fullPath := gcsPrefix + filename
-		logger.Debug("Writing %d records to: gs://%s/%s", len(posts), gcsBucket, fullPath)
-
-		obj := gcsClient.Bucket(gcsBucket).Object(fullPath)
-		gcsWriter := obj.NewWriter(ctx)
-
-		// Use GenericWriter for streaming
-		parquetWriter := parquet.NewGenericWriter[common.ExtractPost](gcsWriter)
-
-		// Write posts in batch
-		if _, err := parquetWriter.Write(posts); err != nil {
-			if err := parquetWriter.Close(); err != nil {
-				logger.Error("Failed to close parquet writer: %v", err)
-			}
-			if err := gcsClient.Close(); err != nil {
-				logger.Error("Failed to close GSC writer: %v", err)
-			}
-			return fmt.Errorf("failed to write parquet data: %w", err)
-		}
-
-		// Close parquet writer (writes footer)
-		if err := parquetWriter.Close(); err != nil {
-			if err := gcsClient.Close(); err != nil {
-				logger.Error("Failed to close GSC writer: %v", err)
-			}
-			return fmt.Errorf("failed to close parquet writer: %w", err)
-		}
-
-		// Close GCS writer (finalizes upload)
-		if err := gcsWriter.Close(); err != nil {
-			return fmt.Errorf("failed to close GCS writer: %w", err)
-		}
-
-		logger.Debug("Successfully wrote %d records to gs://%s/%s", len(posts), gcsBucket, fullPath)
-	} else {
-		// Write to local file (existing logic)
-		fullPath := filepath.Join(basePath, filename)
-		logger.Debug("Writing %d records to: %s", len(posts), fullPath)
-
-		if err := parquet.WriteFile(fullPath, posts); err != nil {
-			return fmt.Errorf("failed to write parquet file: %w", err)
-		}
-
-		logger.Debug("Successfully wrote %d records to %s", len(posts), fullPath)
+		return nil, fmt.Errorf("no posts to write")
 	}
 
-	return nil
+	// Files are named for their last post's timestamp (posts are sorted by timeField)
+	return writeRecordFiles(ctx, out, indexName, posts, func(post common.ExtractPost) string {
+		return fileTimestamp(timeField, post.RecordCreatedAt, post.InsertedAt)
+	}, func(post common.ExtractPost) string {
+		return post.DID
+	}, logger)
 }
 
-func writeLikesParquetFile(ctx context.Context, basePath string, isGCS bool, gcsClient *storage.Client, gcsBucket, gcsPrefix, indexName string, likes []common.ExtractLike, logger *common.IngestLogger) error {
+func writeLikesParquetFile(ctx context.Context, out *output, indexName, timeField string, likes []common.ExtractLike, logger *common.IngestLogger) ([]string, error) {
 	if len(likes) == 0 {
-		return fmt.Errorf("no likes to write")
+		return nil, fmt.Errorf("no likes to write")
 	}
 
-	lastLike := likes[len(likes)-1]
-	filename := generateFilename(indexName, lastLike.RecordCreatedAt, logger)
-
-	if isGCS {
-		// Write to GCS using streaming parquet writer
-		fullPath := gcsPrefix + filename
-		logger.Debug("Writing %d like records to: gs://%s/%s", len(likes), gcsBucket, fullPath)
-
-		obj := gcsClient.Bucket(gcsBucket).Object(fullPath)
-		gcsWriter := obj.NewWriter(ctx)
-
-		// Use GenericWriter for streaming
-		parquetWriter := parquet.NewGenericWriter[common.ExtractLike](gcsWriter)
-
-		// Write likes in batch
-		if _, err := parquetWriter.Write(likes); err != nil {
-			if err := parquetWriter.Close(); err != nil {
-				logger.Error("Failed to close parquet writer: %v", err)
-			}
-			if err := gcsClient.Close(); err != nil {
-				logger.Error("Failed to close GSC writer: %v", err)
-			}
-			return fmt.Errorf("failed to write parquet data: %w", err)
-		}
-
-		// Close parquet writer (writes footer)
-		if err := parquetWriter.Close(); err != nil {
-			if err := gcsClient.Close(); err != nil {
-				logger.Error("Failed to close GSC writer: %v", err)
-			}
-			return fmt.Errorf("failed to close parquet writer: %w", err)
-		}
-
-		// Close GCS writer (finalizes upload)
-		if err := gcsWriter.Close(); err != nil {
-			return fmt.Errorf("failed to close GCS writer: %w", err)
-		}
-
-		logger.Debug("Successfully wrote %d like records to gs://%s/%s", len(likes), gcsBucket, fullPath)
-	} else {
-		// Write to local file (existing logic)
-		fullPath := filepath.Join(basePath, filename)
-		logger.Debug("Writing %d like records to: %s", len(likes), fullPath)
-
-		if err := parquet.WriteFile(fullPath, likes); err != nil {
-			return fmt.Errorf("failed to write parquet file: %w", err)
-		}
-
-		logger.Debug("Successfully wrote %d like records to %s", len(likes), fullPath)
-	}
-
-	return nil
+	return writeRecordFiles(ctx, out, indexName, likes, func(like common.ExtractLike) string {
+		return fileTimestamp(timeField, like.RecordCreatedAt, like.InsertedAt)
+	}, func(like common.ExtractLike) string {
+		return like.DID
+	}, logger)
 }
 
 func runExportForPostInferences(ctx context.Context, esClient *elasticsearch.Client, logger *common.IngestLogger,
-	dryRun bool, outputPath string, isGCS bool, gcsClient *storage.Client, gcsBucket, gcsPrefix string,
+	dryRun bool, out *output,
 	atURIs []string, config *common.Config) error {
 
 	fetchSize := config.ExtractFetchSize
@@ -717,11 +984,11 @@ func runExportForPostInferences(ctx context.Context, esClient *elasticsearch.Cli
 	}
 
 	if !dryRun {
-		if err := writeInferencesParquetFile(ctx, outputPath, isGCS, gcsClient, gcsBucket, gcsPrefix, allInferences, logger); err != nil {
+		if err := writeInferencesParquetFile(ctx, out, allInferences, logger); err != nil {
 			return fmt.Errorf("failed to write inferences parquet file: %w", err)
 		}
 	} else {
-		filename := fmt.Sprintf("bsky_inferences_%s.parquet", time.Now().UTC().Format("20060102_150405"))
+		filename := out.filename(fmt.Sprintf("bsky_inferences_%s.parquet", time.Now().UTC().Format("20060102_150405")))
 		logger.Debug("Dry-run: Would write %s with %d records", filename, len(allInferences))
 	}
 
@@ -730,113 +997,25 @@ func runExportForPostInferences(ctx context.Context, esClient *elasticsearch.Cli
 	return nil
 }
 
-func writeInferencesParquetFile(ctx context.Context, basePath string, isGCS bool, gcsClient *storage.Client, gcsBucket, gcsPrefix string, inferences []common.ExtractInference, logger *common.IngestLogger) error {
+func writeInferencesParquetFile(ctx context.Context, out *output, inferences []common.ExtractInference, logger *common.IngestLogger) error {
 	if len(inferences) == 0 {
 		return fmt.Errorf("no inferences to write")
 	}
 
-	filename := fmt.Sprintf("bsky_inferences_%s.parquet", time.Now().UTC().Format("20060102_150405"))
-
-	if isGCS {
-		fullPath := gcsPrefix + filename
-		logger.Debug("Writing %d inference records to: gs://%s/%s", len(inferences), gcsBucket, fullPath)
-
-		obj := gcsClient.Bucket(gcsBucket).Object(fullPath)
-		gcsWriter := obj.NewWriter(ctx)
-
-		parquetWriter := parquet.NewGenericWriter[common.ExtractInference](gcsWriter)
-
-		if _, err := parquetWriter.Write(inferences); err != nil {
-			if err := parquetWriter.Close(); err != nil {
-				logger.Error("Failed to close parquet writer: %v", err)
-			}
-			if err := gcsClient.Close(); err != nil {
-				logger.Error("Failed to close GSC writer: %v", err)
-			}
-			return fmt.Errorf("failed to write parquet data: %w", err)
-		}
-
-		if err := parquetWriter.Close(); err != nil {
-			if err := gcsClient.Close(); err != nil {
-				logger.Error("Failed to close GSC writer: %v", err)
-			}
-			return fmt.Errorf("failed to close parquet writer: %w", err)
-		}
-
-		if err := gcsWriter.Close(); err != nil {
-			return fmt.Errorf("failed to close GCS writer: %w", err)
-		}
-
-		logger.Debug("Successfully wrote %d inference records to gs://%s/%s", len(inferences), gcsBucket, fullPath)
-	} else {
-		fullPath := filepath.Join(basePath, filename)
-		logger.Debug("Writing %d inference records to: %s", len(inferences), fullPath)
-
-		if err := parquet.WriteFile(fullPath, inferences); err != nil {
-			return fmt.Errorf("failed to write parquet file: %w", err)
-		}
-
-		logger.Debug("Successfully wrote %d inference records to %s", len(inferences), fullPath)
-	}
-
-	return nil
+	// Inferences have no record timestamp of their own, so they are named
+	// and partitioned by export time
+	now := time.Now().UTC()
+	filename := fmt.Sprintf("bsky_inferences_%s.parquet", now.Format("20060102_150405"))
+	return writeFile(ctx, out, path.Join(partitionDir(out.partitionBy, now.Format(time.RFC3339)), filename), inferences, logger)
 }
 
-func writeHashtagsParquetFile(ctx context.Context, basePath string, isGCS bool, gcsClient *storage.Client, gcsBucket, gcsPrefix, indexName string, hashtags []common.ExtractHashtag, logger *common.IngestLogger) error {
+func writeHashtagsParquetFile(ctx context.Context, out *output, indexName string, hashtags []common.ExtractHashtag, logger *common.IngestLogger) error {
 	if len(hashtags) == 0 {
 		return fmt.Errorf("no hashtags to write")
 	}
 
-	lastHashtag := hashtags[len(hashtags)-1]
-	filename := generateFilename(indexName, lastHashtag.Hour, logger)
-
-	if isGCS {
-		// Write to GCS using streaming parquet writer
-		fullPath := gcsPrefix + filename
-		logger.Debug("Writing %d hashtag records to: gs://%s/%s", len(hashtags), gcsBucket, fullPath)
-
-		obj := gcsClient.Bucket(gcsBucket).Object(fullPath)
-		gcsWriter := obj.NewWriter(ctx)
-
-		// Use GenericWriter for streaming
-		parquetWriter := parquet.NewGenericWriter[common.ExtractHashtag](gcsWriter)
-
-		// Write hashtags in batch
-		if _, err := parquetWriter.Write(hashtags); err != nil {
-			if err := parquetWriter.Close(); err != nil {
-				logger.Error("Failed to close parquet writer: %v", err)
-			}
-			if err := gcsClient.Close(); err != nil {
-				logger.Error("Failed to close GSC writer: %v", err)
-			}
-			return fmt.Errorf("failed to write parquet data: %w", err)
-		}
-
-		// Close parquet writer (writes footer)
-		if err := parquetWriter.Close(); err != nil {
-			if err := gcsClient.Close(); err != nil {
-				logger.Error("Failed to close GSC writer: %v", err)
-			}
-			return fmt.Errorf("failed to close parquet writer: %w", err)
-		}
-
-		// Close GCS writer (finalizes upload)
-		if err := gcsWriter.Close(); err != nil {
-			return fmt.Errorf("failed to close GCS writer: %w", err)
-		}
-
-		logger.Debug("Successfully wrote %d hashtag records to gs://%s/%s", len(hashtags), gcsBucket, fullPath)
-	} else {
-		// Write to local file (existing logic)
-		fullPath := filepath.Join(basePath, filename)
-		logger.Debug("Writing %d hashtag records to: %s", len(hashtags), fullPath)
-
-		if err := parquet.WriteFile(fullPath, hashtags); err != nil {
-			return fmt.Errorf("failed to write parquet file: %w", err)
-		}
-
-		logger.Debug("Successfully wrote %d hashtag records to %s", len(hashtags), fullPath)
-	}
-
-	return nil
+	_, err := writeRecordFiles(ctx, out, indexName, hashtags, func(hashtag common.ExtractHashtag) string {
+		return hashtag.Hour
+	}, nil, logger)
+	return err
 }
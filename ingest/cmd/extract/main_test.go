@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -34,3 +37,50 @@ func TestGenerateFilename_replies(t *testing.T) {
 		t.Errorf("expected bsky_replies_ prefix, got %s", filename)
 	}
 }
+
+func TestParseIndexType_userFeatures(t *testing.T) {
+	got, err := ParseIndexType("user_features")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != IndexTypeUserFeatures {
+		t.Errorf("expected IndexTypeUserFeatures, got %q", got)
+	}
+}
+
+func TestGenerateFilename_userFeatures(t *testing.T) {
+	logger := common.NewLogger(false)
+	filename := generateFilename("user_features", "2026-06-06T12:00:00Z", logger)
+	if filename != "bsky_user_features_20260606_120000.parquet" {
+		t.Errorf("unexpected filename %s", filename)
+	}
+}
+
+func TestDropDenied(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.json")
+	if err := os.WriteFile(path, []byte(`{"entries":[{"did":"did:plc:denied","scope":"export"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	denyList, err := common.NewDenyList(context.Background(), path, nil, common.NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posts := []common.ExtractPost{
+		{DID: "did:plc:a", AtURI: "at://did:plc:a/app.bsky.feed.post/1"},
+		{DID: "did:plc:denied", AtURI: "at://did:plc:denied/app.bsky.feed.post/2"},
+		{DID: "did:plc:b", AtURI: "at://did:plc:b/app.bsky.feed.post/3"},
+	}
+	kept := dropDenied(posts, denyList, func(post common.ExtractPost) (string, string) {
+		return post.DID, post.AtURI
+	})
+	if len(kept) != 2 || kept[0].DID != "did:plc:a" || kept[1].DID != "did:plc:b" {
+		t.Errorf("expected the denied author's post to be dropped, got %+v", kept)
+	}
+
+	if kept := dropDenied(posts[:1], nil, func(post common.ExtractPost) (string, string) {
+		return post.DID, post.AtURI
+	}); len(kept) != 1 {
+		t.Errorf("expected a nil deny list to keep everything, got %+v", kept)
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/greenearth/ingest/internal/common"
+	"google.golang.org/api/iterator"
+)
+
+// output is where export files are written: a local directory, or a bucket
+// and key prefix in GCS (gs://) or S3 (s3://). Object stores are written so
+// a file appears only once it is complete; a failed write leaves nothing.
+// partitionBy is the --partition-by value files are laid out by and
+// authorShards the --author-shards they are split by (see
+// writeRecordFiles), and format and gzip the --format and --gzip values
+// they are encoded with (see encodeRows). embeddingFormat is the
+// --embedding-format of post rows. slice is set on each slice's copy
+// of the output in a sliced export (see runPITExport). An output with a
+// stream writes every file's rows to it instead, for an /export response
+// (see exportServer).
+type output struct {
+	path            string
+	scheme          string
+	bucket          string
+	prefix          string
+	partitionBy     string
+	authorShards    int
+	format          string
+	gzip            bool
+	embeddingFormat string
+	slice           string
+	stream          io.Writer
+	gcsClient       *storage.Client
+	s3Client        s3API
+}
+
+// s3API is the part of the S3 client an output uses: uploads, reads of the
+// objects an export keeps its own state in (see readObject), and the
+// listing and deletes of compaction (see listObjects)
+type s3API interface {
+	common.S3UploadAPI
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// newOutput parses path and, unless dryRun, creates the client or local
+// directory it needs. S3 credentials come from GE_AWS_S3_ACCESS_KEY and
+// GE_AWS_S3_SECRET_KEY when set, and the default AWS credential chain
+// otherwise.
+func newOutput(ctx context.Context, path string, dryRun bool, config *common.Config) (*output, error) {
+	out := &output{path: path}
+
+	scheme, rest, isObjectStore := strings.Cut(path, "://")
+	if !isObjectStore {
+		if !dryRun {
+			if err := os.MkdirAll(path, 0750); err != nil {
+				return nil, fmt.Errorf("failed to create output directory: %w", err)
+			}
+		}
+		return out, nil
+	}
+	if scheme != "gs" && scheme != "s3" {
+		return nil, fmt.Errorf("unsupported output path: %s (expected a local path, gs://bucket/path or s3://bucket/path)", path)
+	}
+
+	out.scheme = scheme
+	out.bucket, out.prefix, _ = strings.Cut(rest, "/")
+	if out.bucket == "" {
+		return nil, fmt.Errorf("invalid output path: %s (expected %s://bucket/path)", path, scheme)
+	}
+	if out.prefix != "" && !strings.HasSuffix(out.prefix, "/") {
+		out.prefix += "/"
+	}
+	if dryRun {
+		return out, nil
+	}
+
+	switch scheme {
+	case "gs":
+		client, err := storage.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GCS client: %w", err)
+		}
+		out.gcsClient = client
+	case "s3":
+		optFns := []func(*awsconfig.LoadOptions) error{awsconfig.WithRegion(config.AWSRegion)}
+		if config.AWSS3AccessKey != "" && config.AWSS3SecretKey != "" {
+			optFns = append(optFns, awsconfig.WithCredentialsProvider(aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+				return aws.Credentials{
+					AccessKeyID:     config.AWSS3AccessKey,
+					SecretAccessKey: config.AWSS3SecretKey,
+				}, nil
+			})))
+		}
+		cfg, err := awsconfig.LoadDefaultConfig(ctx, optFns...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		out.s3Client = s3.NewFromConfig(cfg)
+	}
+	return out, nil
+}
+
+// Close releases the output's client, if any
+func (o *output) Close() error {
+	if o.gcsClient != nil {
+		return o.gcsClient.Close()
+	}
+	return nil
+}
+
+// String describes the destination for logs
+func (o *output) String() string {
+	if o.scheme == "" {
+		return o.path
+	}
+	return fmt.Sprintf("%s://%s/%s", o.scheme, o.bucket, o.prefix)
+}
+
+// location returns where filename is written, for logs
+func (o *output) location(filename string) string {
+	if o.scheme == "" {
+		return filepath.Join(o.path, filename)
+	}
+	return fmt.Sprintf("%s://%s/%s%s", o.scheme, o.bucket, o.prefix, filename)
+}
+
+// objectWriter writes one object; Abort discards it instead of completing it
+type objectWriter interface {
+	io.WriteCloser
+	Abort()
+}
+
+// gcsObjectWriter aborts a GCS upload by cancelling its context, so the
+// object is never created
+type gcsObjectWriter struct {
+	*storage.Writer
+	cancel context.CancelFunc
+}
+
+func (w *gcsObjectWriter) Close() error {
+	defer w.cancel()
+	return w.Writer.Close()
+}
+
+func (w *gcsObjectWriter) Abort() {
+	w.cancel()
+	_ = w.Writer.Close()
+}
+
+// newObjectWriter opens a writer for filename in the output's bucket
+func (o *output) newObjectWriter(ctx context.Context, filename string) objectWriter {
+	key := o.prefix + filename
+	if o.scheme == "s3" {
+		return common.NewS3Writer(ctx, o.s3Client, o.bucket, key)
+	}
+	gcsCtx, cancel := context.WithCancel(ctx)
+	return &gcsObjectWriter{Writer: o.gcsClient.Bucket(o.bucket).Object(key).NewWriter(gcsCtx), cancel: cancel}
+}
+
+// writeFile writes rows as filename, in the output's format and with its
+// extension (see output.filename)
+func writeFile[T any](ctx context.Context, out *output, filename string, rows []T, logger *common.IngestLogger) error {
+	filename = out.filename(filename)
+	logger.Debug("Writing %d records to: %s", len(rows), out.location(filename))
+	if err := writeObject(ctx, out, filename, func(w io.Writer) error {
+		return encodeRows(w, out, rows)
+	}); err != nil {
+		return err
+	}
+	logger.Debug("Successfully wrote %d records to %s", len(rows), out.location(filename))
+	return nil
+}
+
+// writeObject writes filename, as is, with the content encode writes.
+// Nothing is left behind when encode fails.
+func writeObject(ctx context.Context, out *output, filename string, encode func(io.Writer) error) error {
+	if out.stream != nil {
+		if err := encode(out.stream); err != nil {
+			return err
+		}
+		if flusher, ok := out.stream.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		return nil
+	}
+
+	location := out.location(filename)
+	if out.scheme == "" {
+		if err := os.MkdirAll(filepath.Dir(location), 0750); err != nil {
+			return fmt.Errorf("failed to create partition directory: %w", err)
+		}
+		file, err := os.Create(location) //nolint:gosec // G304: path under the configured output directory
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", location, err)
+		}
+		if err := encode(file); err != nil {
+			_ = file.Close()
+			_ = os.Remove(location)
+			return err
+		}
+		if err := file.Close(); err != nil {
+			_ = os.Remove(location)
+			return fmt.Errorf("failed to close %s: %w", location, err)
+		}
+		return nil
+	}
+
+	objWriter := out.newObjectWriter(ctx, filename)
+	if err := encode(objWriter); err != nil {
+		objWriter.Abort()
+		return err
+	}
+
+	// Close the object writer (completes the upload)
+	if err := objWriter.Close(); err != nil {
+		return fmt.Errorf("failed to complete upload of %s: %w", location, err)
+	}
+	return nil
+}
+
+// readObject reads filename, as writeObject wrote it. Reports false when
+// there is no such file.
+func readObject(ctx context.Context, out *output, filename string) ([]byte, bool, error) {
+	location := out.location(filename)
+	var body io.ReadCloser
+	switch out.scheme {
+	case "":
+		data, err := os.ReadFile(location) //nolint:gosec // G304: path under the configured output directory
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read %s: %w", location, err)
+		}
+		return data, true, nil
+	case "s3":
+		result, err := out.s3Client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(out.bucket), Key: aws.String(out.prefix + filename)})
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read %s: %w", location, err)
+		}
+		body = result.Body
+	default:
+		reader, err := out.gcsClient.Bucket(out.bucket).Object(out.prefix + filename).NewReader(ctx)
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil, false, nil
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read %s: %w", location, err)
+		}
+		body = reader
+	}
+	defer func() { _ = body.Close() }() // Best-effort close for read operation
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read %s: %w", location, err)
+	}
+	return data, true, nil
+}
+
+// objectInfo is a file listObjects found: its name relative to the output,
+// as writeObject takes it, and its size in bytes
+type objectInfo struct {
+	name string
+	size int64
+}
+
+// listObjects returns every file under the output, ordered by name
+func listObjects(ctx context.Context, out *output) ([]objectInfo, error) {
+	var objects []objectInfo
+	switch out.scheme {
+	case "":
+		err := filepath.WalkDir(out.path, func(path string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			name, err := filepath.Rel(out.path, path)
+			if err != nil {
+				return err
+			}
+			objects = append(objects, objectInfo{name: filepath.ToSlash(name), size: info.Size()})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", out, err)
+		}
+	case "s3":
+		paginator := s3.NewListObjectsV2Paginator(out.s3Client, &s3.ListObjectsV2Input{Bucket: aws.String(out.bucket), Prefix: aws.String(out.prefix)})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list %s: %w", out, err)
+			}
+			for _, object := range page.Contents {
+				objects = append(objects, objectInfo{name: strings.TrimPrefix(aws.ToString(object.Key), out.prefix), size: aws.ToInt64(object.Size)})
+			}
+		}
+	default:
+		it := out.gcsClient.Bucket(out.bucket).Objects(ctx, &storage.Query{Prefix: out.prefix})
+		for {
+			attrs, err := it.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to list %s: %w", out, err)
+			}
+			objects = append(objects, objectInfo{name: strings.TrimPrefix(attrs.Name, out.prefix), size: attrs.Size})
+		}
+	}
+	sort.Slice(objects, func(i, j int) bool { return objects[i].name < objects[j].name })
+	return objects, nil
+}
+
+// deleteObject deletes filename from the output. Deleting a file that is
+// already gone succeeds.
+func deleteObject(ctx context.Context, out *output, filename string) error {
+	location := out.location(filename)
+	var err error
+	switch out.scheme {
+	case "":
+		err = os.Remove(location)
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+	case "s3":
+		// S3 reports success for keys that do not exist
+		_, err = out.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(out.bucket), Key: aws.String(out.prefix + filename)})
+	default:
+		err = out.gcsClient.Bucket(out.bucket).Object(out.prefix + filename).Delete(ctx)
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", location, err)
+	}
+	return nil
+}
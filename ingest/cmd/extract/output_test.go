@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestNewOutput_ParsesDestinations(t *testing.T) {
+	tests := []struct {
+		path     string
+		location string
+	}{
+		{"gs://bucket/exports", "gs://bucket/exports/bsky_posts.parquet"},
+		{"s3://bucket/exports/", "s3://bucket/exports/bsky_posts.parquet"},
+		{"s3://bucket", "s3://bucket/bsky_posts.parquet"},
+		{"/tmp/exports", "/tmp/exports/bsky_posts.parquet"},
+	}
+	for _, tt := range tests {
+		out, err := newOutput(context.Background(), tt.path, true, &common.Config{})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		if got := out.location("bsky_posts.parquet"); got != tt.location {
+			t.Errorf("%s: expected %s, got %s", tt.path, tt.location, got)
+		}
+	}
+
+	for _, path := range []string{"s3://", "azure://container/exports"} {
+		if _, err := newOutput(context.Background(), path, true, &common.Config{}); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+	}
+}
+
+func TestWriteFile_Local(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "exports")
+	out, err := newOutput(context.Background(), dir, false, &common.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []common.ExtractHashtag{{Hashtag: "go", Hour: "2026-06-06T12:00:00Z"}}
+	if err := writeFile(context.Background(), out, "hashtags.parquet", rows, common.NewLogger(false)); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := parquet.ReadFile[common.ExtractHashtag](filepath.Join(dir, "hashtags.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 1 || read[0].Hashtag != "go" {
+		t.Errorf("unexpected rows %+v", read)
+	}
+}
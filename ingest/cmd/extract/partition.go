@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// Values of --partition-by
+const (
+	PartitionNone = ""
+	PartitionDate = "date"
+	PartitionHour = "hour"
+)
+
+// hiveDefaultPartition is the partition Hive, Athena and BigQuery read rows
+// with a missing partition value from
+const hiveDefaultPartition = "__HIVE_DEFAULT_PARTITION__"
+
+// validatePartitionBy checks a --partition-by value
+func validatePartitionBy(partitionBy string) error {
+	switch partitionBy {
+	case PartitionNone, PartitionDate, PartitionHour:
+		return nil
+	default:
+		return fmt.Errorf("unknown partitioning %q (expected %q or %q)", partitionBy, PartitionDate, PartitionHour)
+	}
+}
+
+// partitionDir returns the Hive-style directory, relative to the output, for
+// a record with timestamp: dt=YYYY-MM-DD, with /hour=HH when partitioning by
+// hour. Records whose timestamp does not parse go to the default partition.
+func partitionDir(partitionBy, timestamp string) string {
+	if partitionBy == PartitionNone {
+		return ""
+	}
+	t, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		if partitionBy == PartitionHour {
+			return "dt=" + hiveDefaultPartition + "/hour=" + hiveDefaultPartition
+		}
+		return "dt=" + hiveDefaultPartition
+	}
+	t = t.UTC()
+	if partitionBy == PartitionHour {
+		return fmt.Sprintf("dt=%s/hour=%02d", t.Format("2006-01-02"), t.Hour())
+	}
+	return "dt=" + t.Format("2006-01-02")
+}
+
+// maxAuthorShards is the largest --author-shards value
+const maxAuthorShards = 10000
+
+// validateAuthorShards checks an --author-shards value
+func validateAuthorShards(shards int) error {
+	if shards < 0 || shards > maxAuthorShards {
+		return fmt.Errorf("--author-shards must be between 0 and %d, got %d", maxAuthorShards, shards)
+	}
+	return nil
+}
+
+// authorShard returns the shard of shards an author's records go to: the
+// 64-bit FNV-1a hash of the DID modulo shards, so an author lands in the
+// same shard in every run and every index
+func authorShard(authorDID string, shards int) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(authorDID))
+	return int(h.Sum64() % uint64(shards))
+}
+
+// authorShardDir returns the Hive-style directory, author_shard=N, of an
+// author's records. N is zero-padded to the width of the last shard, so
+// shard directories list in order.
+func authorShardDir(authorDID string, shards int) string {
+	width := len(strconv.Itoa(shards - 1))
+	return fmt.Sprintf("author_shard=%0*d", width, authorShard(authorDID, shards))
+}
+
+// writeRecordFiles writes rows, which timestampOf gives the partition and
+// filename timestamp of. Unpartitioned, rows go to one file named for the
+// last row; partitioned, each partition's rows go to a file in its directory
+// named for that partition's last row. With --author-shards, each partition
+// is further split by the shard of the author authorOf gives; authorOf is
+// nil for rows that are not sharded. Returns the files written, relative to
+// the output.
+func writeRecordFiles[T any](ctx context.Context, out *output, indexName string, rows []T, timestampOf, authorOf func(T) string, logger *common.IngestLogger) ([]string, error) {
+	return writeNamedRecordFiles(ctx, out, rows, func(timestamp string) string {
+		return generateFilename(indexName, timestamp, logger)
+	}, timestampOf, authorOf, logger)
+}
+
+// writeNamedRecordFiles is writeRecordFiles for rows whose files nameOf
+// names from their last row's timestamp, rather than for their index
+func writeNamedRecordFiles[T any](ctx context.Context, out *output, rows []T, nameOf func(timestamp string) string, timestampOf, authorOf func(T) string, logger *common.IngestLogger) ([]string, error) {
+	var dirs []string
+	groups := map[string][]T{}
+	for _, row := range rows {
+		dir := partitionDir(out.partitionBy, timestampOf(row))
+		if authorOf != nil && out.authorShards > 0 {
+			dir = path.Join(dir, authorShardDir(authorOf(row), out.authorShards))
+		}
+		if _, ok := groups[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		groups[dir] = append(groups[dir], row)
+	}
+
+	var files []string
+	for _, dir := range dirs {
+		group := groups[dir]
+		filename := path.Join(dir, nameOf(timestampOf(group[len(group)-1])))
+		if err := writeFile(ctx, out, filename, group, logger); err != nil {
+			return files, err
+		}
+		files = append(files, out.filename(filename))
+	}
+	return files, nil
+}
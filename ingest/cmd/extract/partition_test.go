@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestPartitionDir(t *testing.T) {
+	tests := []struct {
+		partitionBy string
+		timestamp   string
+		want        string
+	}{
+		{PartitionNone, "2026-06-06T12:05:00Z", ""},
+		{PartitionDate, "2026-06-06T12:05:00Z", "dt=2026-06-06"},
+		{PartitionHour, "2026-06-06T09:05:00Z", "dt=2026-06-06/hour=09"},
+		{PartitionHour, "2026-06-06T23:30:00-02:00", "dt=2026-06-07/hour=01"},
+		{PartitionDate, "", "dt=__HIVE_DEFAULT_PARTITION__"},
+		{PartitionHour, "not a time", "dt=__HIVE_DEFAULT_PARTITION__/hour=__HIVE_DEFAULT_PARTITION__"},
+	}
+	for _, tt := range tests {
+		if got := partitionDir(tt.partitionBy, tt.timestamp); got != tt.want {
+			t.Errorf("partitionDir(%q, %q) = %q, want %q", tt.partitionBy, tt.timestamp, got, tt.want)
+		}
+	}
+
+	if err := validatePartitionBy("minute"); err == nil {
+		t.Error("expected an error for unknown partitioning")
+	}
+}
+
+func TestWriteRecordFiles_SplitsByPartition(t *testing.T) {
+	dir := t.TempDir()
+	out := &output{path: dir, partitionBy: PartitionHour}
+	rows := []common.ExtractHashtag{
+		{Hashtag: "a", Hour: "2026-06-06T11:00:00Z"},
+		{Hashtag: "b", Hour: "2026-06-06T12:00:00Z"},
+		{Hashtag: "c", Hour: "2026-06-06T12:00:00Z"},
+	}
+
+	files, err := writeRecordFiles(context.Background(), out, "hashtags", rows, func(h common.ExtractHashtag) string { return h.Hour }, nil, common.NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || files[0] != "dt=2026-06-06/hour=11/bsky_hashtags_20260606_110000.parquet" {
+		t.Errorf("expected the written files returned in order, got %v", files)
+	}
+
+	want := map[string]int{
+		"dt=2026-06-06/hour=11/bsky_hashtags_20260606_110000.parquet": 1,
+		"dt=2026-06-06/hour=12/bsky_hashtags_20260606_120000.parquet": 2,
+	}
+	for name, count := range want {
+		read, err := parquet.ReadFile[common.ExtractHashtag](filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(read) != count {
+			t.Errorf("%s: expected %d rows, got %d", name, count, len(read))
+		}
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != "dt=2026-06-06" {
+		t.Errorf("expected only the dt=2026-06-06 partition at the top level, got %v", entries)
+	}
+}
+
+func TestWriteRecordFiles_ShardsByAuthor(t *testing.T) {
+	dir := t.TempDir()
+	out := &output{path: dir, partitionBy: PartitionDate, authorShards: 16}
+	likes := []common.ExtractLike{
+		{DID: "did:plc:a", RecordCreatedAt: "2026-06-06T11:00:00Z"},
+		{DID: "did:plc:b", RecordCreatedAt: "2026-06-06T11:30:00Z"},
+		{DID: "did:plc:a", RecordCreatedAt: "2026-06-06T12:00:00Z"},
+	}
+
+	files, err := writeRecordFiles(context.Background(), out, "likes", likes, func(like common.ExtractLike) string { return like.RecordCreatedAt },
+		func(like common.ExtractLike) string { return like.DID }, common.NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shardA, shardB := authorShardDir("did:plc:a", 16), authorShardDir("did:plc:b", 16)
+	if shardA == shardB {
+		t.Fatalf("expected the test authors in different shards, both in %s", shardA)
+	}
+	want := []string{
+		"dt=2026-06-06/" + shardA + "/bsky_likes_20260606_120000.parquet",
+		"dt=2026-06-06/" + shardB + "/bsky_likes_20260606_113000.parquet",
+	}
+	if len(files) != 2 || files[0] != want[0] || files[1] != want[1] {
+		t.Fatalf("expected %v, got %v", want, files)
+	}
+	read, err := parquet.ReadFile[common.ExtractLike](filepath.Join(dir, want[0]))
+	if err != nil || len(read) != 2 {
+		t.Errorf("expected both of did:plc:a's likes in its shard, got %d (%v)", len(read), err)
+	}
+}
+
+func TestAuthorShard(t *testing.T) {
+	// The shard is part of the output layout, so it must never change
+	if got := authorShardDir("did:plc:z72i7hdynmk6r22z27h6tvur", 64); got != "author_shard=39" {
+		t.Errorf("expected author_shard=39, got %s", got)
+	}
+	if got := authorShardDir("did:plc:a", 16); got != "author_shard=00" {
+		t.Errorf("expected a zero-padded shard, got %s", got)
+	}
+	if got := authorShardDir("did:plc:a", 1); got != "author_shard=0" {
+		t.Errorf("expected a single shard, got %s", got)
+	}
+	if err := validateAuthorShards(-1); err == nil {
+		t.Error("expected an error for a negative shard count")
+	}
+	if err := validateAuthorShards(0); err != nil {
+		t.Errorf("expected 0 to disable sharding, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// pitKeepAlive is how long an export's point in time is kept open between
+// fetches; writing a file happens between fetches, so it allows for slow
+// uploads
+const pitKeepAlive = 5 * time.Minute
+
+// validateSlices checks a --slices value
+func validateSlices(slices int) error {
+	if slices < 1 {
+		return fmt.Errorf("--slices must be at least 1, got %d", slices)
+	}
+	return nil
+}
+
+// exportPosts runs runExportForPosts on a point in time, in slices if slices
+// is more than 1
+func exportPosts(ctx context.Context, esClient *elasticsearch.Client, logger *common.IngestLogger,
+	dryRun bool, out *output, indexName, startTime, endTime, timeField string, filter common.ExportFilter, enrichLikes bool, cursor *common.ExportCursor, config *common.Config, denyList *common.DenyList, guard *common.TombstoneGuard, accounts *common.AccountFilter, card *indexCard, progress *runProgress, slices int) ([]string, error) {
+	var mu sync.Mutex
+	var atURIs []string
+	err := runPITExport(ctx, esClient, logger, out, indexName, timeField, cursor, slices, func(ctx context.Context, out *output, cursor *common.ExportCursor, pit common.ExportPIT) error {
+		sliceURIs, err := runExportForPosts(ctx, esClient, logger, dryRun, out, indexName, startTime, endTime, timeField, filter, enrichLikes, cursor, config, denyList, guard, accounts, card, progress, pit)
+		mu.Lock()
+		defer mu.Unlock()
+		atURIs = append(atURIs, sliceURIs...)
+		return err
+	})
+	return atURIs, err
+}
+
+// exportLikes runs runExportForLikes on a point in time, in slices if slices
+// is more than 1
+func exportLikes(ctx context.Context, esClient *elasticsearch.Client, logger *common.IngestLogger,
+	dryRun bool, out *output, indexName, startTime, endTime, timeField string, filter common.ExportFilter, joinPosts bool, cursor *common.ExportCursor, config *common.Config, denyList *common.DenyList, guard *common.TombstoneGuard, card *indexCard, progress *runProgress, slices int) error {
+	return runPITExport(ctx, esClient, logger, out, indexName, timeField, cursor, slices, func(ctx context.Context, out *output, cursor *common.ExportCursor, pit common.ExportPIT) error {
+		return runExportForLikes(ctx, esClient, logger, dryRun, out, indexName, startTime, endTime, timeField, filter, joinPosts, cursor, config, denyList, guard, card, progress, pit)
+	})
+}
+
+// runPITExport opens a point in time on indexName and runs export on it, or
+// with slices above 1, on each of its slices in parallel. Each slice writes
+// its own files, named with the slice's number (see output.filename), and
+// follows its own copy of cursor; cursor is then left at the latest record
+// any slice exported. The first slice to fail cancels the rest.
+func runPITExport(ctx context.Context, esClient *elasticsearch.Client, logger *common.IngestLogger, out *output, indexName, timeField string, cursor *common.ExportCursor, slices int,
+	export func(ctx context.Context, out *output, cursor *common.ExportCursor, pit common.ExportPIT) error) error {
+	pit, err := openExportPIT(ctx, esClient, logger, indexName)
+	if err != nil {
+		return err
+	}
+	defer common.CloseExportPIT(esClient, logger, pit.ID)
+	if slices <= 1 {
+		return export(ctx, out, cursor, pit)
+	}
+	logger.Info("Exporting %s in %d slices", indexName, slices)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, slices)
+	cursors := make([]common.ExportCursor, slices)
+	var wg sync.WaitGroup
+	for id := range slices {
+		cursors[id] = *cursor
+		sliceOut := *out
+		sliceOut.slice = fmt.Sprintf("s%02d", id)
+		slice := pit
+		slice.Slice, slice.Slices = id, slices
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := export(ctx, &sliceOut, &cursors[id], slice); err != nil {
+				errs[id] = fmt.Errorf("slice %d: %w", id, err)
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Report the failures, not the slices they cancelled
+	var failures []error
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			failures = append(failures, err)
+		}
+	}
+	if len(failures) > 0 {
+		return errors.Join(failures...)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	for _, sliceCursor := range cursors {
+		if cursorAfter(sliceCursor, *cursor, timeField) {
+			*cursor = sliceCursor
+		}
+	}
+	return nil
+}
+
+// openExportPIT opens a point in time on indexName for an export
+func openExportPIT(ctx context.Context, esClient *elasticsearch.Client, logger *common.IngestLogger, indexName string) (common.ExportPIT, error) {
+	id, err := common.OpenExportPIT(ctx, esClient, logger, indexName, pitKeepAlive)
+	if err != nil {
+		return common.ExportPIT{}, err
+	}
+	return common.ExportPIT{ID: id, KeepAlive: pitKeepAlive}, nil
+}
+
+// cursorAfter reports whether a's record sorts after b's on timeField
+func cursorAfter(a, b common.ExportCursor, timeField string) bool {
+	aTime, aTiebreak := common.SortCursor(timeField, a.CreatedAt, a.IndexedAt)
+	bTime, bTiebreak := common.SortCursor(timeField, b.CreatedAt, b.IndexedAt)
+	if at, bt := parseCursorTime(aTime), parseCursorTime(bTime); !at.Equal(bt) {
+		return at.After(bt)
+	}
+	return parseCursorTime(aTiebreak).After(parseCursorTime(bTiebreak))
+}
+
+// parseCursorTime parses an RFC3339 cursor value, treating an empty or
+// invalid one as the zero time
+func parseCursorTime(value string) time.Time {
+	t, _ := time.Parse(time.RFC3339, value)
+	return t
+}
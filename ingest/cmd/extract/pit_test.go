@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func TestExportLikes_Slices(t *testing.T) {
+	searches, pitClosed, dir, cursor := runTestLikesExport(t, 2)
+
+	for _, name := range []string{"bsky_likes_20260603_100000_s00.ndjson", "bsky_likes_20260603_100100_s01.ndjson"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected each slice to write its own file: %v", err)
+		}
+	}
+	if cursor.CreatedAt != "2026-06-03T10:01:00Z" {
+		t.Errorf("expected the cursor at the latest like of any slice, got %+v", cursor)
+	}
+	if len(searches) != 4 {
+		t.Fatalf("expected two pages per slice, got %d searches", len(searches))
+	}
+	for _, query := range searches {
+		if query["pit"].(map[string]interface{})["id"] != "pit-1" || query["slice"].(map[string]interface{})["max"] != float64(2) {
+			t.Errorf("expected each search on a slice of the point in time, got %v", query)
+		}
+		if after, ok := query["search_after"].([]interface{}); ok && len(after) != 3 {
+			t.Errorf("expected slices to page after the last hit's sort values, got %v", after)
+		}
+	}
+	if !pitClosed {
+		t.Error("expected the point in time to be closed")
+	}
+}
+
+func TestExportLikes_PIT(t *testing.T) {
+	searches, pitClosed, dir, cursor := runTestLikesExport(t, 1)
+
+	if _, err := os.Stat(filepath.Join(dir, "bsky_likes_20260603_100000.ndjson")); err != nil {
+		t.Errorf("expected an unsliced file name: %v", err)
+	}
+	if cursor.CreatedAt != "2026-06-03T10:00:00Z" {
+		t.Errorf("expected the cursor at the exported like, got %+v", cursor)
+	}
+	if len(searches) != 2 {
+		t.Fatalf("expected two pages, got %d searches", len(searches))
+	}
+	for _, query := range searches {
+		if query["pit"].(map[string]interface{})["id"] != "pit-1" {
+			t.Errorf("expected each search on the point in time, got %v", query)
+		}
+		if _, sliced := query["slice"]; sliced {
+			t.Errorf("expected no slice clause, got %v", query)
+		}
+	}
+	if !pitClosed {
+		t.Error("expected the point in time to be closed")
+	}
+}
+
+// runTestLikesExport exports likes in slices from a server with one like per
+// slice, returning the searches made, whether the point in time was closed,
+// the output directory and the final cursor
+func runTestLikesExport(t *testing.T, slices int) ([]map[string]interface{}, bool, string, common.ExportCursor) {
+	t.Helper()
+	var mu sync.Mutex
+	var searches []map[string]interface{}
+	pitClosed := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/likes/_pit":
+			_, _ = w.Write([]byte(`{"id":"pit-1"}`))
+		case r.Method == http.MethodDelete && r.URL.Path == "/_pit":
+			pitClosed = true
+			_, _ = w.Write([]byte(`{"succeeded":true,"num_freed":1}`))
+		case r.URL.Path == "/_search":
+			body, _ := io.ReadAll(r.Body)
+			var query map[string]interface{}
+			if err := json.Unmarshal(body, &query); err != nil {
+				t.Errorf("failed to parse query: %v", err)
+			}
+			searches = append(searches, query)
+			if _, paged := query["search_after"]; paged {
+				_, _ = w.Write([]byte(`{"hits":{"hits":[]}}`))
+				return
+			}
+			// Each slice has one like, slice 1's the later one; an unsliced
+			// export reads as slice 0
+			id := 0
+			if slice, ok := query["slice"].(map[string]interface{}); ok {
+				id = int(slice["id"].(float64))
+			}
+			_, _ = fmt.Fprintf(w, `{"hits":{"hits":[{"_id":"%d","sort":[%d,%d,%d],"_source":{"at_uri":"at://did:plc:a/app.bsky.feed.like/%d","subject_uri":"at://did:plc:b/app.bsky.feed.post/1","author_did":"did:plc:a","created_at":"2026-06-03T10:0%d:00Z","indexed_at":"2026-06-03T10:0%d:30Z"}}]}}`, id, id, id, id, id, id, id)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	var cursor common.ExportCursor
+	err = exportLikes(context.Background(), client, common.NewLogger(false), false, &output{path: dir, format: FormatNDJSON},
+		"likes", "", "", common.TimeFieldCreatedAt, common.ExportFilter{}, false, &cursor, &common.Config{ExtractFetchSize: 10}, nil, nil, nil, nil, slices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return searches, pitClosed, dir, cursor
+}
+
+func TestCursorAfter(t *testing.T) {
+	earlier := common.ExportCursor{CreatedAt: "2026-06-03T10:00:00.500Z", IndexedAt: "2026-06-03T10:00:02Z"}
+	later := common.ExportCursor{CreatedAt: "2026-06-03T10:00:01Z", IndexedAt: "2026-06-03T10:00:01Z"}
+	if !cursorAfter(later, earlier, common.TimeFieldCreatedAt) || cursorAfter(earlier, later, common.TimeFieldCreatedAt) {
+		t.Error("expected cursors compared on created_at first")
+	}
+	if !cursorAfter(earlier, later, common.TimeFieldIndexedAt) {
+		t.Error("expected cursors compared on indexed_at first")
+	}
+	if !cursorAfter(earlier, common.ExportCursor{}, common.TimeFieldCreatedAt) {
+		t.Error("expected any record after an empty cursor")
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// runIDPattern is what a --run-id may contain; it is part of a file name
+var runIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// validateRunID checks a --run-id value
+func validateRunID(runID string, slices int) error {
+	if runID == "" {
+		return nil
+	}
+	if !runIDPattern.MatchString(runID) {
+		return fmt.Errorf("run ID %q may only contain letters, digits, '.', '_' and '-'", runID)
+	}
+	// Slices of a new point in time need not hold the records they held in
+	// the crashed run, so a sliced rerun could write records again
+	if slices > 1 {
+		return fmt.Errorf("--run-id cannot be combined with --slices above 1")
+	}
+	return nil
+}
+
+// runProgress records how far an export run given a --run-id got, so that
+// rerunning it after a crash resumes where it stopped instead of writing the
+// files it completed again. It is kept next to the run's files (see
+// runProgressFilename) and rewritten after every file. A nil runProgress
+// records nothing.
+type runProgress struct {
+	RunID     string                    `json:"run_id"`
+	StartTime string                    `json:"start_time,omitempty"` // The run's window, which a rerun keeps
+	EndTime   string                    `json:"end_time,omitempty"`
+	Indices   map[string]*indexProgress `json:"indices"`
+	UpdatedAt time.Time                 `json:"updated_at"`
+
+	mu     sync.Mutex
+	out    *output
+	logger *common.IngestLogger
+}
+
+// indexProgress is how far a run's export of one index got
+type indexProgress struct {
+	// Cursor is the last record of the last completed file; a rerun pages
+	// after it
+	Cursor    common.ExportCursor `json:"cursor"`
+	Files     []string            `json:"files"` // Completed files, in the order written
+	Completed bool                `json:"completed"`
+}
+
+// runProgressFilename names the progress of the run with runID
+func runProgressFilename(runID string) string {
+	return fmt.Sprintf("extract_run_%s.json", runID)
+}
+
+// loadRunProgress reads the progress of the run with runID from the output,
+// or starts it with the run's window when the run is new. Returns whether
+// the run was started before.
+func loadRunProgress(ctx context.Context, out *output, runID, startTime, endTime string, logger *common.IngestLogger) (*runProgress, bool, error) {
+	progress := &runProgress{
+		RunID:     runID,
+		StartTime: startTime,
+		EndTime:   endTime,
+		Indices:   map[string]*indexProgress{},
+		out:       out,
+		logger:    logger,
+	}
+	filename := runProgressFilename(runID)
+	data, found, err := readObject(ctx, out, filename)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read run progress: %w", err)
+	}
+	if !found {
+		return progress, false, nil
+	}
+	if err := json.Unmarshal(data, progress); err != nil {
+		return nil, false, fmt.Errorf("failed to parse run progress %s: %w", out.location(filename), err)
+	}
+	if progress.RunID != runID {
+		return nil, false, fmt.Errorf("run progress %s is for run %q, not %q", out.location(filename), progress.RunID, runID)
+	}
+	if progress.Indices == nil {
+		progress.Indices = map[string]*indexProgress{}
+	}
+	return progress, true, nil
+}
+
+// completed reports whether the run finished exporting indexName
+func (p *runProgress) completed(indexName string) bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	index, ok := p.Indices[indexName]
+	return ok && index.Completed
+}
+
+// resumeCursor returns the last record of the last file the run completed
+// for indexName, and the number of files it completed
+func (p *runProgress) resumeCursor(indexName string) (common.ExportCursor, int, bool) {
+	if p == nil {
+		return common.ExportCursor{}, 0, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	index, ok := p.Indices[indexName]
+	if !ok || len(index.Files) == 0 {
+		return common.ExportCursor{}, 0, false
+	}
+	return index.Cursor, len(index.Files), true
+}
+
+// fileWritten records files, just written for indexName, and cursor, their
+// last record
+func (p *runProgress) fileWritten(ctx context.Context, indexName string, cursor common.ExportCursor, files []string) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	index := p.indexLocked(indexName)
+	index.Cursor = cursor
+	index.Files = append(index.Files, files...)
+	return p.saveLocked(ctx)
+}
+
+// complete records that the run finished exporting indexName
+func (p *runProgress) complete(ctx context.Context, indexName string) error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.indexLocked(indexName).Completed = true
+	return p.saveLocked(ctx)
+}
+
+func (p *runProgress) indexLocked(indexName string) *indexProgress {
+	index, ok := p.Indices[indexName]
+	if !ok {
+		index = &indexProgress{Files: []string{}}
+		p.Indices[indexName] = index
+	}
+	return index
+}
+
+func (p *runProgress) saveLocked(ctx context.Context) error {
+	p.UpdatedAt = time.Now().UTC()
+	return writeObject(ctx, p.out, runProgressFilename(p.RunID), func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(p); err != nil {
+			return fmt.Errorf("failed to encode run progress: %w", err)
+		}
+		return nil
+	})
+}
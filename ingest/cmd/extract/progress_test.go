@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func TestRunProgress_ResumesAfterCrash(t *testing.T) {
+	// Four likes, one a minute; the first run fails on its third page
+	var mu sync.Mutex
+	var searches []map[string]interface{}
+	failOn := 3
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		var query map[string]interface{}
+		if err := json.Unmarshal(body, &query); err != nil {
+			t.Errorf("failed to parse query: %v", err)
+		}
+		searches = append(searches, query)
+		if len(searches) == failOn {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"crash"}`))
+			return
+		}
+		next := 0
+		if after, ok := query["search_after"].([]interface{}); ok {
+			for next < 4 && fmt.Sprintf("2026-06-03T10:0%d:00Z", next) <= after[0].(string) {
+				next++
+			}
+		}
+		if next == 4 {
+			_, _ = w.Write([]byte(`{"hits":{"hits":[]}}`))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"hits":{"hits":[{"_id":"%d","sort":["2026-06-03T10:0%d:00Z","2026-06-03T10:0%d:30Z",%d],"_source":{"at_uri":"at://did:plc:a/app.bsky.feed.like/%d","subject_uri":"at://did:plc:b/app.bsky.feed.post/1","author_did":"did:plc:a","created_at":"2026-06-03T10:0%d:00Z","indexed_at":"2026-06-03T10:0%d:30Z"}}]}}`, next, next, next, next, next, next, next)
+	}))
+	defer srv.Close()
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := common.NewLogger(false)
+	dir := t.TempDir()
+	out := &output{path: dir, format: FormatNDJSON}
+	config := &common.Config{ExtractFetchSize: 1, ParquetMaxRecords: 1}
+	pit := common.ExportPIT{ID: "pit-1", KeepAlive: time.Minute}
+	export := func() (*runProgress, bool, error) {
+		progress, resumed, err := loadRunProgress(context.Background(), out, "nightly-1", "2026-06-03T00:00:00Z", "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cursor, _, _ := progress.resumeCursor("likes")
+		err = runExportForLikes(context.Background(), client, logger, false, out, "likes", progress.StartTime, progress.EndTime, common.TimeFieldCreatedAt,
+			common.ExportFilter{}, false, &cursor, config, nil, nil, nil, progress, pit)
+		return progress, resumed, err
+	}
+
+	if _, resumed, err := export(); err == nil || resumed {
+		t.Fatalf("expected a new run to crash on its third page, got resumed=%v err=%v", resumed, err)
+	}
+	progress, resumed, err := export()
+	if err != nil || !resumed {
+		t.Fatalf("expected the rerun to resume and finish, got resumed=%v err=%v", resumed, err)
+	}
+	if after := searches[failOn]["search_after"].([]interface{}); after[0] != "2026-06-03T10:01:00Z" {
+		t.Errorf("expected the rerun to page after the last record of the last completed file, got %v", after)
+	}
+
+	want := []string{"bsky_likes_20260603_100000.ndjson", "bsky_likes_20260603_100100.ndjson", "bsky_likes_20260603_100200.ndjson", "bsky_likes_20260603_100300.ndjson"}
+	if files := progress.Indices["likes"].Files; fmt.Sprint(files) != fmt.Sprint(want) {
+		t.Errorf("expected each file recorded once, got %v", files)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != len(want)+1 {
+		t.Errorf("expected the files and the run progress, got %v", entries)
+	}
+
+	if err := progress.complete(context.Background(), "likes"); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, _, err := loadRunProgress(context.Background(), out, "nightly-1", "", "", logger)
+	if err != nil || !reloaded.completed("likes") || reloaded.completed("posts") {
+		t.Errorf("expected only likes completed, got %+v (%v)", reloaded, err)
+	}
+	if reloaded.StartTime != "2026-06-03T00:00:00Z" {
+		t.Errorf("expected the run's window kept, got %s", reloaded.StartTime)
+	}
+
+	var disabled *runProgress
+	if err := disabled.fileWritten(context.Background(), "likes", common.ExportCursor{}, want); err != nil || disabled.completed("likes") {
+		t.Error("expected a nil run progress to record nothing")
+	}
+}
+
+func TestValidateRunID(t *testing.T) {
+	if err := validateRunID("", 4); err != nil {
+		t.Errorf("expected no run ID to be valid, got %v", err)
+	}
+	if err := validateRunID("2026-06-03_nightly.1", 1); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := validateRunID("../nightly", 1); err == nil {
+		t.Error("expected an error for a run ID that is not a plain file name")
+	}
+	if err := validateRunID("nightly", 2); err == nil {
+		t.Error("expected an error for a sliced run")
+	}
+}
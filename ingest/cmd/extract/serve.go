@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+	"golang.org/x/time/rate"
+)
+
+// exportErrorTrailer is the trailer an /export response that failed after
+// its first rows reports the failure in
+const exportErrorTrailer = "X-Export-Error"
+
+// exportServer serves GET /export, which streams a small window of one posts,
+// replies, or likes index as NDJSON, for consumers that need an ad-hoc pull
+// rather than a batch export. Each request runs the batch export's fetch
+// loop on its own point in time, with the same deny list, tombstone and
+// inactive account filtering, writing the rows to the response instead of
+// to files. Requests need one of the server's API keys as a bearer token,
+// and each key is limited to a number of requests a minute.
+type exportServer struct {
+	esClient  *elasticsearch.Client
+	config    *common.Config
+	indices   map[string]IndexType
+	keys      map[string]*rate.Limiter // API key -> its request limiter
+	maxWindow time.Duration
+	denyList  *common.DenyList
+	guard     *common.TombstoneGuard
+	accounts  *common.AccountFilter
+	logger    *common.IngestLogger
+}
+
+// newExportServer creates a server for the posts, replies, and likes among
+// indices, accepting the keys in config.ExportServerAPIKeys
+func newExportServer(esClient *elasticsearch.Client, config *common.Config, indices []string, denyList *common.DenyList, guard *common.TombstoneGuard, accounts *common.AccountFilter, logger *common.IngestLogger) (*exportServer, error) {
+	s := &exportServer{
+		esClient:  esClient,
+		config:    config,
+		indices:   make(map[string]IndexType),
+		keys:      make(map[string]*rate.Limiter),
+		maxWindow: config.ExportServerMaxWindow,
+		denyList:  denyList,
+		guard:     guard,
+		accounts:  accounts,
+		logger:    logger,
+	}
+	for _, indexName := range indices {
+		switch indexType, _ := ParseIndexType(indexName); indexType {
+		case IndexTypePosts, IndexTypeReplies, IndexTypeLikes:
+			s.indices[indexName] = indexType
+		default:
+			logger.Info("Not serving index %s: only posts, replies, and likes are served", indexName)
+		}
+	}
+	if len(s.indices) == 0 {
+		return nil, fmt.Errorf("GE_EXTRACT_INDICES names no posts, replies, or likes index to serve")
+	}
+
+	limit := rate.Inf
+	if config.ExportServerRateLimit > 0 {
+		limit = rate.Limit(float64(config.ExportServerRateLimit) / 60)
+	}
+	for _, key := range strings.Split(config.ExportServerAPIKeys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			s.keys[key] = rate.NewLimiter(limit, max(config.ExportServerRateLimit, 1))
+		}
+	}
+	if len(s.keys) == 0 {
+		return nil, fmt.Errorf("GE_EXPORT_SERVER_API_KEYS is required to serve exports")
+	}
+	return s, nil
+}
+
+// Handler returns the HTTP routes: GET /export?index=<name>&start_time=<RFC3339>&end_time=<RFC3339>
+func (s *exportServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/export", s.handleExport)
+	return mux
+}
+
+// exportRequest is what an /export request asks for
+type exportRequest struct {
+	index           string
+	startTime       string
+	endTime         string
+	timeField       string
+	filter          common.ExportFilter
+	embeddingFormat string
+	enrichLikes     bool
+	joinPosts       bool
+}
+
+func (s *exportServer) handleExport(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	s.logger.Metric("extract.server.request_count", 1)
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	limiter := s.authenticate(r)
+	if limiter == nil {
+		s.logger.Metric("extract.server.unauthorized_count", 1)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if reservation := limiter.Reserve(); reservation.Delay() > 0 {
+		retryAfter := reservation.Delay()
+		reservation.Cancel()
+		s.logger.Metric("extract.server.rate_limited_count", 1)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	req, err := s.parseRequest(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Trailer", exportErrorTrailer)
+	stream := &exportStream{w: w}
+	err = s.export(r.Context(), req, stream)
+	s.logger.Metric("extract.server.request_duration_ms", float64(time.Since(start).Milliseconds()))
+	if err == nil {
+		s.logger.Info("Served %s from %s to %s", req.index, req.startTime, req.endTime)
+		return
+	}
+	if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+		s.logger.Debug("Client went away during an export of %s", req.index)
+		return
+	}
+	s.logger.Error("Failed to serve an export of %s: %v", req.index, err)
+	s.logger.Metric("extract.server.request_error_count", 1)
+	if !stream.started {
+		http.Error(w, "export failed", http.StatusBadGateway)
+		return
+	}
+	// The status is sent with the first rows, so the failure goes in the trailer
+	w.Header().Set(exportErrorTrailer, "export failed")
+}
+
+// authenticate returns the request limiter of the API key r bears, or nil
+// when it bears none of the server's keys
+func (s *exportServer) authenticate(r *http.Request) *rate.Limiter {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return nil
+	}
+	var found *rate.Limiter
+	for key, limiter := range s.keys {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+			found = limiter
+		}
+	}
+	return found
+}
+
+// parseRequest reads an /export query. A window is required, no longer than
+// the server's maximum; filters are those of the batch flags.
+func (s *exportServer) parseRequest(query url.Values, now time.Time) (exportRequest, error) {
+	req := exportRequest{
+		index:           query.Get("index"),
+		startTime:       query.Get("start_time"),
+		endTime:         query.Get("end_time"),
+		timeField:       query.Get("time_field"),
+		embeddingFormat: query.Get("embedding_format"),
+		filter:          common.ExportFilter{ContentMatch: query.Get("content_match")},
+	}
+	indexType, ok := s.indices[req.index]
+	if !ok {
+		return req, fmt.Errorf("index %q is not served", req.index)
+	}
+
+	start, err := time.Parse(time.RFC3339, req.startTime)
+	if err != nil {
+		return req, fmt.Errorf("start_time must be an RFC3339 time: %w", err)
+	}
+	if req.endTime == "" {
+		req.endTime = now.UTC().Format(time.RFC3339)
+	}
+	end, err := time.Parse(time.RFC3339, req.endTime)
+	if err != nil {
+		return req, fmt.Errorf("end_time must be an RFC3339 time: %w", err)
+	}
+	if !end.After(start) {
+		return req, fmt.Errorf("end_time must be after start_time")
+	}
+	if s.maxWindow > 0 && end.Sub(start) > s.maxWindow {
+		return req, fmt.Errorf("window of %s is longer than the %s served", end.Sub(start), s.maxWindow)
+	}
+
+	if req.timeField == "" {
+		req.timeField = common.TimeFieldCreatedAt
+	}
+	if err := common.ValidateTimeField(req.timeField); err != nil {
+		return req, err
+	}
+	if req.embeddingFormat == "" {
+		req.embeddingFormat = common.EmbeddingFormatBase85
+	}
+	if err := common.ValidateEmbeddingFormat(req.embeddingFormat); err != nil {
+		return req, err
+	}
+
+	if req.filter.AuthorDIDs, err = parseAuthorDIDs(query.Get("author_did")); err != nil {
+		return req, fmt.Errorf("invalid author_did: %w", err)
+	}
+	for name, value := range map[string]*bool{"has_embeddings": &req.filter.HasEmbeddings, "enrich_like_counts": &req.enrichLikes, "join_posts": &req.joinPosts} {
+		if raw := query.Get(name); raw != "" {
+			if *value, err = strconv.ParseBool(raw); err != nil {
+				return req, fmt.Errorf("%s must be true or false", name)
+			}
+		}
+	}
+	if err := validateFilter(req.filter, []string{req.index}); err != nil {
+		return req, err
+	}
+	if req.enrichLikes && indexType == IndexTypeLikes {
+		return req, fmt.Errorf("enrich_like_counts applies only to posts and replies")
+	}
+	if req.joinPosts && indexType != IndexTypeLikes {
+		return req, fmt.Errorf("join_posts applies only to likes")
+	}
+	return req, nil
+}
+
+// export runs the batch export's fetch loop for req, writing its rows to w
+// a page at a time
+func (s *exportServer) export(ctx context.Context, req exportRequest, w *exportStream) error {
+	out := &output{format: FormatNDJSON, embeddingFormat: req.embeddingFormat, stream: w}
+	config := *s.config
+	config.ParquetMaxRecords = int64(max(config.ExtractFetchSize, 1))
+	var cursor common.ExportCursor
+	if s.indices[req.index] == IndexTypeLikes {
+		return exportLikes(ctx, s.esClient, s.logger, false, out, req.index, req.startTime, req.endTime, req.timeField, req.filter, req.joinPosts, &cursor, &config, s.denyList, s.guard, nil, nil, 1)
+	}
+	_, err := exportPosts(ctx, s.esClient, s.logger, false, out, req.index, req.startTime, req.endTime, req.timeField, req.filter, req.enrichLikes, &cursor, &config, s.denyList, s.guard, s.accounts, nil, nil, 1)
+	return err
+}
+
+// exportStream is an /export response body, which sends the response's
+// 200 status with its first rows
+type exportStream struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (s *exportStream) Write(p []byte) (int, error) {
+	s.started = true
+	return s.w.Write(p)
+}
+
+// Flush sends the rows written so far
+func (s *exportStream) Flush() {
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// runExportServer serves /export on port until ctx is cancelled
+func runExportServer(ctx context.Context, config *common.Config, logger *common.IngestLogger, skipTLSVerify bool, indices []string, port int) error {
+	if config.ElasticsearchURL == "" {
+		return fmt.Errorf("GE_ELASTICSEARCH_URL environment variable is required")
+	}
+	esClient, err := common.NewElasticsearchClient(common.ElasticsearchConfig{
+		URL:           config.ElasticsearchURL,
+		APIKey:        config.ElasticsearchAPIKey,
+		SkipTLSVerify: skipTLSVerify || config.ElasticsearchTLSSkipVerify,
+	}, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create ES client: %w", err)
+	}
+	common.CheckAPIKeyPrivileges(ctx, esClient, "extract", config, logger)
+
+	denyList, err := common.NewDenyList(ctx, config.DenyListSource, esClient, logger)
+	if err != nil {
+		return fmt.Errorf("failed to load deny list: %w", err)
+	}
+	guard, err := common.NewTombstoneGuard(esClient, config.TombstoneGuard, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create tombstone guard: %w", err)
+	}
+	accounts, err := common.NewAccountFilter(esClient, config.InactiveAccounts, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create inactive account filter: %w", err)
+	}
+
+	exports, err := newExportServer(esClient, config, indices, denyList, guard, accounts, logger)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           exports.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		logger.Info("Serving exports on :%d", port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errChan <- err
+		}
+		close(errChan)
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	return server.Shutdown(shutdownCtx)
+}
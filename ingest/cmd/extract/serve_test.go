@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func TestExportServer_StreamsLikes(t *testing.T) {
+	var mu sync.Mutex
+	var searches []map[string]interface{}
+	es := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/likes/_pit":
+			_, _ = w.Write([]byte(`{"id":"pit-1"}`))
+		case r.Method == http.MethodDelete && r.URL.Path == "/_pit":
+			_, _ = w.Write([]byte(`{"succeeded":true,"num_freed":1}`))
+		case r.URL.Path == "/_search":
+			body, _ := io.ReadAll(r.Body)
+			var query map[string]interface{}
+			if err := json.Unmarshal(body, &query); err != nil {
+				t.Errorf("failed to parse query: %v", err)
+			}
+			searches = append(searches, query)
+			if _, paged := query["search_after"]; paged {
+				_, _ = w.Write([]byte(`{"hits":{"hits":[]}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"hits":{"hits":[
+				{"_id":"1","sort":[1,1,1],"_source":{"at_uri":"at://did:plc:a/app.bsky.feed.like/1","subject_uri":"at://did:plc:b/app.bsky.feed.post/1","author_did":"did:plc:a","created_at":"2026-06-03T10:00:00Z","indexed_at":"2026-06-03T10:00:30Z"}},
+				{"_id":"2","sort":[2,2,2],"_source":{"at_uri":"at://did:plc:c/app.bsky.feed.like/2","subject_uri":"at://did:plc:b/app.bsky.feed.post/1","author_did":"did:plc:c","created_at":"2026-06-03T10:01:00Z","indexed_at":"2026-06-03T10:01:30Z"}}]}}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer es.Close()
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{es.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &common.Config{ExtractFetchSize: 10, ExportServerAPIKeys: "key-1, key-2", ExportServerRateLimit: 1, ExportServerMaxWindow: time.Hour}
+	exports, err := newExportServer(client, config, []string{"likes", "hashtags"}, nil, nil, nil, common.NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(exports.Handler())
+	defer srv.Close()
+	get := func(key string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/export?index=likes&start_time=2026-06-03T10:00:00Z&end_time=2026-06-03T11:00:00Z", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = res.Body.Close() })
+		return res
+	}
+
+	if res := get(""); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected a request without a key refused, got %d", res.StatusCode)
+	}
+	if res := get("key-3"); res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected an unknown key refused, got %d", res.StatusCode)
+	}
+
+	res := get("key-1")
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("expected an NDJSON stream, got %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	var likes []common.ExtractLike
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		var like common.ExtractLike
+		if err := json.Unmarshal(scanner.Bytes(), &like); err != nil {
+			t.Fatal(err)
+		}
+		likes = append(likes, like)
+	}
+	if len(likes) != 2 || likes[0].DID != "did:plc:a" || likes[1].DID != "did:plc:c" {
+		t.Errorf("unexpected likes %+v", likes)
+	}
+	if trailer := res.Trailer.Get(exportErrorTrailer); trailer != "" {
+		t.Errorf("expected no error trailer, got %q", trailer)
+	}
+	if len(searches) != 2 || !strings.Contains(mustMarshal(t, searches[0]), `"lte":"2026-06-03T11:00:00Z"`) {
+		t.Errorf("expected two pages of the requested window, got %v", searches)
+	}
+
+	res = get("key-1")
+	if res.StatusCode != http.StatusTooManyRequests || res.Header.Get("Retry-After") == "" {
+		t.Errorf("expected the key's second request within a minute limited, got %d", res.StatusCode)
+	}
+	if res := get("key-2"); res.StatusCode != http.StatusOK {
+		t.Errorf("expected each key limited separately, got %d", res.StatusCode)
+	}
+}
+
+func TestExportServer_ParseRequest(t *testing.T) {
+	config := &common.Config{ExportServerAPIKeys: "key", ExportServerMaxWindow: time.Hour}
+	exports, err := newExportServer(nil, config, []string{"posts", "likes"}, nil, nil, nil, common.NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 6, 3, 12, 0, 0, 0, time.UTC)
+
+	req, err := exports.parseRequest(url.Values{"index": {"posts"}, "start_time": {"2026-06-03T11:30:00Z"}, "author_did": {"did:plc:a"}, "has_embeddings": {"true"}}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.endTime != "2026-06-03T12:00:00Z" || req.timeField != common.TimeFieldCreatedAt || req.embeddingFormat != common.EmbeddingFormatBase85 ||
+		!req.filter.HasEmbeddings || len(req.filter.AuthorDIDs) != 1 {
+		t.Errorf("unexpected request %+v", req)
+	}
+
+	for name, query := range map[string]url.Values{
+		"unserved index":         {"index": {"hashtags"}, "start_time": {"2026-06-03T11:30:00Z"}},
+		"missing start":          {"index": {"posts"}},
+		"window too long":        {"index": {"posts"}, "start_time": {"2026-06-03T10:00:00Z"}},
+		"reversed window":        {"index": {"posts"}, "start_time": {"2026-06-03T11:30:00Z"}, "end_time": {"2026-06-03T11:00:00Z"}},
+		"content filter on like": {"index": {"likes"}, "start_time": {"2026-06-03T11:30:00Z"}, "content_match": {"solar"}},
+		"join on posts":          {"index": {"posts"}, "start_time": {"2026-06-03T11:30:00Z"}, "join_posts": {"true"}},
+		"bad boolean":            {"index": {"posts"}, "start_time": {"2026-06-03T11:30:00Z"}, "has_embeddings": {"maybe"}},
+	} {
+		if _, err := exports.parseRequest(query, now); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if _, err := newExportServer(nil, &common.Config{}, []string{"posts"}, nil, nil, nil, common.NewLogger(false)); err == nil {
+		t.Error("expected an error without API keys")
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) string {
+	t.Helper()
+	body, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
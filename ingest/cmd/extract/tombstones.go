@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// tombstonePage is one page of a tombstone search: the parquet rows and the
+// deleted_at and indexed_at sort values of its last hit, which the next page
+// starts after
+type tombstonePage[T any] struct {
+	rows           []T
+	lastDeletedAt  string
+	lastIndexedAt  string
+	fetchedRecords int
+}
+
+// runExportForPostTombstones exports post or reply tombstones deleted in the
+// window, so consumers can remove the deleted records from their copies
+func runExportForPostTombstones(ctx context.Context, esClient *elasticsearch.Client, logger *common.IngestLogger,
+	dryRun bool, out *output, indexName, startTime, endTime string, config *common.Config, denyList *common.DenyList) error {
+
+	fetch := func(afterDeletedAt, afterIndexedAt string) (tombstonePage[common.ExtractPostTombstone], error) {
+		response, err := common.FetchPostTombstones(ctx, esClient, logger, indexName, startTime, endTime, afterDeletedAt, afterIndexedAt, config.ExtractFetchSize)
+		if err != nil {
+			return tombstonePage[common.ExtractPostTombstone]{}, fmt.Errorf("failed to fetch post tombstones: %w", err)
+		}
+		hits := response.Hits.Hits
+		page := tombstonePage[common.ExtractPostTombstone]{
+			rows:           common.PostTombstoneHitsToExtractPostTombstones(hits),
+			fetchedRecords: len(hits),
+		}
+		if len(hits) > 0 {
+			page.lastDeletedAt = hits[len(hits)-1].Source.DeletedAt
+			page.lastIndexedAt = hits[len(hits)-1].Source.IndexedAt
+		}
+		return page, nil
+	}
+	return runExportForTombstones(ctx, logger, dryRun, out, indexName, config, denyList, fetch,
+		func(t common.ExtractPostTombstone) (string, string, string) {
+			return t.DID, t.AtURI, t.DeletedAt
+		})
+}
+
+// runExportForLikeTombstones exports like tombstones deleted in the window
+func runExportForLikeTombstones(ctx context.Context, esClient *elasticsearch.Client, logger *common.IngestLogger,
+	dryRun bool, out *output, indexName, startTime, endTime string, config *common.Config, denyList *common.DenyList) error {
+
+	fetch := func(afterDeletedAt, afterIndexedAt string) (tombstonePage[common.ExtractLikeTombstone], error) {
+		response, err := common.FetchLikeTombstones(ctx, esClient, logger, indexName, startTime, endTime, afterDeletedAt, afterIndexedAt, config.ExtractFetchSize)
+		if err != nil {
+			return tombstonePage[common.ExtractLikeTombstone]{}, fmt.Errorf("failed to fetch like tombstones: %w", err)
+		}
+		hits := response.Hits.Hits
+		page := tombstonePage[common.ExtractLikeTombstone]{
+			rows:           common.LikeTombstoneHitsToExtractLikeTombstones(hits),
+			fetchedRecords: len(hits),
+		}
+		if len(hits) > 0 {
+			page.lastDeletedAt = hits[len(hits)-1].Source.DeletedAt
+			page.lastIndexedAt = hits[len(hits)-1].Source.IndexedAt
+		}
+		return page, nil
+	}
+	return runExportForTombstones(ctx, logger, dryRun, out, indexName, config, denyList, fetch,
+		func(t common.ExtractLikeTombstone) (string, string, string) {
+			return t.DID, t.AtURI, t.DeletedAt
+		})
+}
+
+// runExportForTombstones pages through a tombstone index with fetch and
+// writes the rows to parquet files of up to GE_PARQUET_MAX_RECORDS rows.
+// describe returns a row's DID, at_uri, and deleted_at.
+func runExportForTombstones[T any](ctx context.Context, logger *common.IngestLogger,
+	dryRun bool, out *output, indexName string, config *common.Config, denyList *common.DenyList,
+	fetch func(afterDeletedAt, afterIndexedAt string) (tombstonePage[T], error), describe func(T) (string, string, string)) error {
+
+	maxRecordsPerFile := config.ParquetMaxRecords
+
+	var fileNum = 1
+	var totalRecords int64 = 0
+	var afterDeletedAt, afterIndexedAt string
+	var currentFileBatch []T
+
+	flush := func(final bool) error {
+		_, _, lastDeletedAt := describe(currentFileBatch[len(currentFileBatch)-1])
+		filename := out.filename(generateFilename(indexName, lastDeletedAt, logger))
+		if dryRun {
+			if final {
+				logger.Debug("Dry-run: Would write final %s with %d records", filename, len(currentFileBatch))
+			} else {
+				logger.Debug("Dry-run: Would write %s with %d records", filename, len(currentFileBatch))
+			}
+			return nil
+		}
+		_, err := writeRecordFiles(ctx, out, indexName, currentFileBatch, func(row T) string {
+			_, _, deletedAt := describe(row)
+			return deletedAt
+		}, nil, logger)
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			if len(currentFileBatch) > 0 && !dryRun {
+				if err := flush(true); err != nil {
+					logger.Error("Failed to write final parquet file: %v", err)
+				}
+			}
+			return ctx.Err()
+		default:
+		}
+
+		page, err := fetch(afterDeletedAt, afterIndexedAt)
+		if err != nil {
+			return err
+		}
+
+		if page.fetchedRecords == 0 {
+			logger.Debug("No more records to fetch")
+			break
+		}
+
+		batch := dropDenied(page.rows, denyList, func(row T) (string, string) {
+			did, atURI, _ := describe(row)
+			return did, "tombstone of " + atURI
+		})
+		currentFileBatch = append(currentFileBatch, batch...)
+		totalRecords += int64(len(batch))
+
+		logger.Debug("Fetched %d records (total: %d)", len(batch), totalRecords)
+
+		if maxRecordsPerFile > 0 && int64(len(currentFileBatch)) >= maxRecordsPerFile {
+			if err := flush(false); err != nil {
+				return fmt.Errorf("failed to write parquet file: %w", err)
+			}
+			fileNum++
+			currentFileBatch = currentFileBatch[:0]
+		}
+
+		afterDeletedAt = page.lastDeletedAt
+		afterIndexedAt = page.lastIndexedAt
+	}
+
+	if len(currentFileBatch) > 0 {
+		if err := flush(true); err != nil {
+			return fmt.Errorf("failed to write final parquet file: %w", err)
+		}
+	}
+
+	logger.Metric("extract.records_exported_count", float64(totalRecords))
+	logger.Metric("extract.files_written_count", float64(fileNum))
+	logger.Info("Export complete: %d total records in %d files", totalRecords, fileNum)
+	return nil
+}
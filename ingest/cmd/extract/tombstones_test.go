@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestParseIndexType_tombstones(t *testing.T) {
+	tests := map[string]IndexType{
+		"post_tombstones":            IndexTypePostTombstones,
+		"post_tombstones-2026-06-06": IndexTypePostTombstones,
+		"like_tombstones":            IndexTypeLikeTombstones,
+		"posts":                      IndexTypePosts,
+		"likes":                      IndexTypeLikes,
+	}
+	for name, want := range tests {
+		got, err := ParseIndexType(name)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if got != want {
+			t.Errorf("%s: expected %q, got %q", name, want, got)
+		}
+	}
+
+	logger := common.NewLogger(false)
+	if filename := generateFilename("like_tombstones", "2026-06-06T12:00:00Z", logger); filename != "bsky_like_tombstones_20260606_120000.parquet" {
+		t.Errorf("unexpected filename %s", filename)
+	}
+}
+
+func TestRunExportForPostTombstones(t *testing.T) {
+	pages := []string{
+		`{"hits":{"total":{"value":2},"hits":[
+			{"_id":"1","_source":{"at_uri":"at://did:plc:a/app.bsky.feed.post/1","author_did":"did:plc:a","deleted_at":"2026-06-06T12:00:00Z","indexed_at":"2026-06-06T12:00:01Z"}},
+			{"_id":"2","_source":{"at_uri":"at://did:plc:b/app.bsky.feed.post/2","author_did":"did:plc:b","deleted_at":"2026-06-06T12:05:00Z","indexed_at":"2026-06-06T12:05:01Z"}}]}}`,
+		`{"hits":{"total":{"value":2},"hits":[]}}`,
+	}
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		_, _ = w.Write([]byte(pages[min(len(bodies)-1, len(pages)-1)]))
+	}))
+	defer srv.Close()
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outputPath := t.TempDir()
+	config := &common.Config{ExtractFetchSize: 2}
+	err = runExportForPostTombstones(context.Background(), client, common.NewLogger(false), false, &output{path: outputPath},
+		"post_tombstones", "2026-06-06T00:00:00Z", "", config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bodies) != 2 || !strings.Contains(bodies[0], `"deleted_at"`) {
+		t.Fatalf("expected two searches ranged on deleted_at, got %v", bodies)
+	}
+	if !strings.Contains(bodies[1], `"search_after":["2026-06-06T12:05:00Z","2026-06-06T12:05:01Z"]`) {
+		t.Errorf("expected the second page to start after the last tombstone, got %s", bodies[1])
+	}
+
+	path := filepath.Join(outputPath, "bsky_post_tombstones_20260606_120500.parquet")
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected %s to be written: %v", path, err)
+	}
+	rows, err := parquet.ReadFile[common.ExtractPostTombstone](path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].DID != "did:plc:a" || rows[1].AtURI != "at://did:plc:b/app.bsky.feed.post/2" {
+		t.Errorf("unexpected rows %+v", rows)
+	}
+}
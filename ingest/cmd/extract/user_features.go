@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/features"
+)
+
+// runExportForUserFeatures scans likes, follows, posts and replies in the export window
+// and writes one feature row per user, as defined by the features package.
+// A time window is required so rows describe a bounded period.
+func runExportForUserFeatures(ctx context.Context, esClient *elasticsearch.Client, logger *common.IngestLogger,
+	dryRun bool, out *output, indexName, startTime, endTime string, config *common.Config, denyList *common.DenyList) error {
+
+	if startTime == "" || endTime == "" {
+		return fmt.Errorf("user_features export requires a time window (--start-time/--end-time or --window-size-min)")
+	}
+
+	acc := features.NewUserAccumulator()
+
+	if err := accumulateLikeFeatures(ctx, esClient, logger, "likes", startTime, endTime, config.ExtractFetchSize, acc); err != nil {
+		return err
+	}
+	if err := accumulateFollowFeatures(ctx, esClient, logger, "follows", startTime, endTime, config.ExtractFetchSize, acc); err != nil {
+		return err
+	}
+	if err := accumulatePostFeatures(ctx, esClient, logger, "posts", false, startTime, endTime, config.ExtractFetchSize, acc); err != nil {
+		return err
+	}
+	if err := accumulatePostFeatures(ctx, esClient, logger, "replies", true, startTime, endTime, config.ExtractFetchSize, acc); err != nil {
+		return err
+	}
+
+	rows := dropDenied(acc.Rows(startTime, endTime), denyList, func(row features.UserFeatures) (string, string) {
+		return row.UserDID, "user features"
+	})
+	if len(rows) == 0 {
+		logger.Info("No user activity found in window")
+		return nil
+	}
+
+	chunkSize := len(rows)
+	if config.ParquetMaxRecords > 0 && int64(chunkSize) > config.ParquetMaxRecords {
+		chunkSize = int(config.ParquetMaxRecords)
+	}
+
+	baseFilename := generateFilename(indexName, endTime, logger)
+	fileNum := 0
+	for start := 0; start < len(rows); start += chunkSize {
+		end := min(start+chunkSize, len(rows))
+		filename := baseFilename
+		if chunkSize < len(rows) {
+			filename = fmt.Sprintf("%s_part%03d.parquet", strings.TrimSuffix(baseFilename, ".parquet"), fileNum)
+		}
+
+		if dryRun {
+			logger.Debug("Dry-run: Would write %s with %d records", out.filename(filename), end-start)
+		} else if err := writeFile(ctx, out, path.Join(partitionDir(out.partitionBy, endTime), filename), rows[start:end], logger); err != nil {
+			return fmt.Errorf("failed to write parquet file: %w", err)
+		}
+		fileNum++
+	}
+
+	logger.Metric("extract.records_exported_count", float64(len(rows)))
+	logger.Metric("extract.files_written_count", float64(fileNum))
+	logger.Info("User feature export complete: %d users in %d files", len(rows), fileNum)
+	return nil
+}
+
+func accumulateLikeFeatures(ctx context.Context, esClient *elasticsearch.Client, logger *common.IngestLogger,
+	indexName, startTime, endTime string, fetchSize int, acc *features.UserAccumulator) error {
+
+	pit, err := openExportPIT(ctx, esClient, logger, indexName)
+	if err != nil {
+		return err
+	}
+	defer common.CloseExportPIT(esClient, logger, pit.ID)
+
+	var searchAfter []interface{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		response, err := common.FetchLikesPIT(ctx, esClient, logger, pit, startTime, endTime, common.TimeFieldCreatedAt, common.ExportFilter{}, searchAfter, fetchSize)
+		if err != nil {
+			return fmt.Errorf("failed to fetch likes: %w", err)
+		}
+		if len(response.Hits.Hits) == 0 {
+			return nil
+		}
+
+		for _, hit := range response.Hits.Hits {
+			acc.AddLike(hit.Source.AuthorDID, common.ExtractDIDFromATURI(hit.Source.SubjectURI))
+		}
+
+		searchAfter = response.Hits.Hits[len(response.Hits.Hits)-1].Sort
+	}
+}
+
+func accumulateFollowFeatures(ctx context.Context, esClient *elasticsearch.Client, logger *common.IngestLogger,
+	indexName, startTime, endTime string, fetchSize int, acc *features.UserAccumulator) error {
+
+	pit, err := openExportPIT(ctx, esClient, logger, indexName)
+	if err != nil {
+		return err
+	}
+	defer common.CloseExportPIT(esClient, logger, pit.ID)
+
+	var searchAfter []interface{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		response, err := common.FetchFollowsPIT(ctx, esClient, logger, pit, startTime, endTime, common.TimeFieldCreatedAt, common.ExportFilter{}, searchAfter, fetchSize)
+		if err != nil {
+			return fmt.Errorf("failed to fetch follows: %w", err)
+		}
+		if len(response.Hits.Hits) == 0 {
+			return nil
+		}
+
+		for _, hit := range response.Hits.Hits {
+			acc.AddFollow(hit.Source.AuthorDID)
+		}
+
+		searchAfter = response.Hits.Hits[len(response.Hits.Hits)-1].Sort
+	}
+}
+
+func accumulatePostFeatures(ctx context.Context, esClient *elasticsearch.Client, logger *common.IngestLogger,
+	indexName string, isReply bool, startTime, endTime string, fetchSize int, acc *features.UserAccumulator) error {
+
+	pit, err := openExportPIT(ctx, esClient, logger, indexName)
+	if err != nil {
+		return err
+	}
+	defer common.CloseExportPIT(esClient, logger, pit.ID)
+
+	var searchAfter []interface{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		response, err := common.FetchPostsPIT(ctx, esClient, logger, pit, startTime, endTime, common.TimeFieldCreatedAt, common.ExportFilter{}, searchAfter, fetchSize)
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s: %w", indexName, err)
+		}
+		if len(response.Hits.Hits) == 0 {
+			return nil
+		}
+
+		for _, hit := range response.Hits.Hits {
+			acc.AddPost(hit.Source.AuthorDID, isReply, hit.Source.Embeddings[features.InterestEmbeddingModel])
+		}
+
+		searchAfter = response.Hits.Hits[len(response.Hits.Hits)-1].Sort
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/features"
+)
+
+func TestAccumulateFollowFeatures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/follows/_pit":
+			_, _ = w.Write([]byte(`{"id":"pit-1"}`))
+		case r.Method == http.MethodDelete && r.URL.Path == "/_pit":
+			_, _ = w.Write([]byte(`{"succeeded":true,"num_freed":1}`))
+		case r.URL.Path == "/_search":
+			body, _ := io.ReadAll(r.Body)
+			var query map[string]interface{}
+			if err := json.Unmarshal(body, &query); err != nil {
+				t.Errorf("failed to parse query: %v", err)
+			}
+			if _, paged := query["search_after"]; paged {
+				_, _ = w.Write([]byte(`{"hits":{"hits":[]}}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"hits":{"hits":[
+				{"_id":"1","sort":[1,1,1],"_source":{"at_uri":"at://did:plc:a/app.bsky.graph.follow/1","author_did":"did:plc:a","subject_did":"did:plc:b"}},
+				{"_id":"2","sort":[2,2,2],"_source":{"at_uri":"at://did:plc:a/app.bsky.graph.follow/2","author_did":"did:plc:a","subject_did":"did:plc:c"}},
+				{"_id":"3","sort":[3,3,3],"_source":{"at_uri":"at://did:plc:b/app.bsky.graph.follow/3","author_did":"did:plc:b","subject_did":"did:plc:a"}}]}}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acc := features.NewUserAccumulator()
+	if err := accumulateFollowFeatures(context.Background(), client, common.NewLogger(false), "follows", "2026-06-03T00:00:00Z", "2026-06-04T00:00:00Z", 10, acc); err != nil {
+		t.Fatal(err)
+	}
+	rows := acc.Rows("2026-06-03T00:00:00Z", "2026-06-04T00:00:00Z")
+	if len(rows) != 2 || rows[0].FollowCount != 2 || rows[1].FollowCount != 1 {
+		t.Errorf("expected follows counted per follower, got %+v", rows)
+	}
+}
@@ -0,0 +1,549 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/firehose_ingest"
+	"github.com/greenearth/ingest/internal/jetstream_ingest"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// pendingBatch accumulates firehose ops between flushes. Posts and likes are
+// written with the same document builders and bulk helpers as
+// megastream_ingest and jetstream_ingest.
+type pendingBatch struct {
+	posts          []common.MegaStreamMessage
+	postTombstones []common.PostTombstoneDoc
+	postDeletes    []common.DeleteDoc
+	likes          []common.LikeDoc
+	likeDeletes    []common.JetstreamMessage
+	seq            int64 // Highest firehose sequence number covered by the batch
+	timeUs         int64
+}
+
+func (b *pendingBatch) size() int {
+	return len(b.posts) + len(b.postDeletes) + len(b.likes) + len(b.likeDeletes)
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "Run in dry-run mode (no writes to Elasticsearch)")
+	createOnly := flag.Bool("create-only", false, "Index with op_type=create so documents already indexed are skipped, not overwritten (for replays and backfills)")
+	skipTLSVerify := flag.Bool("skip-tls-verify", false, "Skip TLS certificate verification (use for local development only)")
+	noRewind := flag.Bool("no-rewind", false, "Do not resume from the last processed sequence number on startup (drops intervening data)")
+	debug := flag.Bool("debug", false, "Enable debug logging")
+	flag.Parse()
+
+	config := common.LoadConfig()
+	logger := common.NewLogger(config.LoggingEnabled)
+	logger.SetService("firehose_ingest")
+	logger.SetDebugEnabled(*debug)
+	otelCollector, err := common.NewOTelMetricCollector("firehose-ingest", config.Environment, config.GCPProjectID, config.GCPRegion, config.MetricExportIntervalSec)
+	if err != nil {
+		logger.Error("Failed to create OTel metric collector: %v (continuing without metrics)", err)
+	} else {
+		logger.SetMetricCollector(otelCollector)
+		defer func() {
+			if err := otelCollector.Shutdown(context.Background()); err != nil {
+				logger.Error("Failed to shutdown OTel metric collector: %v", err)
+			}
+		}()
+	}
+	tracerProvider, err := common.NewTracerProvider(context.Background(), "firehose-ingest", config)
+	if err != nil {
+		logger.Error("Failed to create tracer provider: %v (continuing without tracing)", err)
+	} else if tracerProvider != nil {
+		defer func() {
+			if err := tracerProvider.Shutdown(context.Background()); err != nil {
+				logger.Error("Failed to shutdown tracer provider: %v", err)
+			}
+		}()
+	}
+
+	logger.Info("Green Earth Ingex - BlueSky Firehose Ingest Service")
+	if *dryRun {
+		logger.Info("Running in DRY-RUN mode - no writes to Elasticsearch")
+	}
+	logger.SetCreateOnly(*createOnly)
+	if *createOnly {
+		logger.Info("Create-only mode - documents already indexed are skipped, not overwritten")
+	}
+	if *noRewind {
+		logger.Info("Rewind disabled - starting from the live firehose")
+	}
+
+	if config.FirehoseURL == "" {
+		logger.Error("GE_FIREHOSE_URL environment variable is required")
+		os.Exit(1)
+	}
+
+	if config.ElasticsearchURL == "" {
+		logger.Error("GE_ELASTICSEARCH_URL environment variable is required")
+		os.Exit(1)
+	}
+
+	if !*dryRun && config.ElasticsearchAPIKey == "" {
+		logger.Error("GE_ELASTICSEARCH_API_KEY environment variable is required")
+		os.Exit(1)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	healthServer, err := common.NewHealthServer(8080, 8089, logger)
+	if err != nil {
+		logger.Error("Failed to create health check server: %v", err)
+		os.Exit(1)
+	}
+	healthServer.SetMaxLag(config.MaxIngestLag)
+	go func() {
+		if err := healthServer.Start(ctx); err != nil {
+			logger.Error("Health server failed: %v", err)
+			cancel()
+		}
+	}()
+
+	// Track ingest SLOs from the metrics above; the report is served at /slo
+	sloTracker, err := common.NewSLOTracker(ctx, "firehose_ingest", common.SLOConfigFromConfig(config), logger)
+	if err != nil {
+		logger.Error("Failed to initialize SLO tracker: %v", err)
+		os.Exit(1)
+	}
+	defer func() { _ = sloTracker.Close() }()
+	sloTracker.Attach(logger)
+	healthServer.Handle("/slo", sloTracker)
+	go sloTracker.Run(ctx, time.Minute)
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		logger.Info("Received shutdown signal, finishing current batch...")
+		cancel()
+	}()
+
+	logger.Info("Starting firehose ingestion")
+	runIngestion(ctx, config, logger, healthServer, *dryRun, *skipTLSVerify, *noRewind)
+}
+
+func runIngestion(ctx context.Context, config *common.Config, logger *common.IngestLogger, healthServer *common.HealthServer, dryRun, skipTLSVerify, noRewind bool) {
+	// The firehose cursor is a relay sequence number rather than a timestamp,
+	// so it is kept in its own state file and stored in the last_time_us field.
+	stateManager, err := common.NewStateManager(config.FirehoseStateFile, logger)
+	if err != nil {
+		logger.Error("Failed to initialize state manager: %v", err)
+		os.Exit(1)
+	}
+
+	myStartTime := time.Now().UnixMicro()
+	if err := stateManager.WriteInstanceInfo(myStartTime); err != nil {
+		logger.Error("Failed to write instance info: %v", err)
+		os.Exit(1)
+	}
+	logger.Info("Wrote instance coordination file with start time: %d", myStartTime)
+
+	esClient, err := common.NewElasticsearchClient(common.ElasticsearchConfig{
+		URL:           config.ElasticsearchURL,
+		APIKey:        config.ElasticsearchAPIKey,
+		SkipTLSVerify: skipTLSVerify || config.ElasticsearchTLSSkipVerify,
+	}, logger)
+	if err != nil {
+		logger.Error("%v", err)
+		os.Exit(1)
+	}
+	common.CheckAPIKeyPrivileges(ctx, esClient, "firehose_ingest", config, logger)
+	common.MonitorClockSkew(ctx, esClient, config, logger)
+	common.CheckRouting(ctx, esClient, []string{"posts", "replies"}, logger)
+
+	deadLetters, err := common.NewDeadLetterQueue(ctx, config.DLQDestination, "firehose_ingest")
+	if err != nil {
+		logger.Error("Failed to initialize dead-letter queue: %v", err)
+		os.Exit(1)
+	}
+	defer func() { _ = deadLetters.Close() }()
+	logger.SetDeadLetterQueue(deadLetters)
+
+	malformed, err := common.NewMalformedRows(common.StrictnessConfigFromConfig(config), "firehose", logger)
+	if err != nil {
+		logger.Error("%v", err)
+		os.Exit(1)
+	}
+	logger.Info("Malformed frames: %s", malformed.Mode())
+
+	denyList, err := common.NewDenyList(ctx, config.DenyListSource, esClient, logger)
+	if err != nil {
+		logger.Error("Failed to load deny list: %v", err)
+		os.Exit(1)
+	}
+	go denyList.Run(ctx, config.DenyListReloadInterval)
+
+	// Ensure the write indices for everything this command writes exist, at
+	// startup and every minute to pick up period changes and rollovers. Likes
+	// instead go to their created_at bucket's index through the likes router.
+	var likesRouter *common.IndexRouter
+	if !dryRun {
+		indexProfile, err := common.IndexProfileFromConfig(config)
+		if err != nil {
+			logger.Error("Invalid index configuration: %v", err)
+			os.Exit(1)
+		}
+		likesRouter, err = common.NewIndexRouter(esClient, indexProfile, "likes", common.IndexRouterConfigFromConfig(config), logger)
+		if err != nil {
+			logger.Error("Invalid likes index configuration: %v", err)
+			os.Exit(1)
+		}
+		indexManager := common.NewIndexManager(esClient, indexProfile, []string{"posts", "post_tombstones", "replies", "reply_tombstones", "like_tombstones"}, logger)
+
+		backoff := time.Second
+		for {
+			indexCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			err := indexManager.EnsureCurrent(indexCtx)
+			cancel()
+			if err == nil {
+				break
+			}
+			logger.Error("ensureIndices failed (retrying in %v): %v", backoff, err)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			if backoff < 60*time.Second {
+				backoff *= 2
+			}
+		}
+
+		go indexManager.Maintain(ctx, time.Minute)
+	}
+
+	// Likes go through the same per-account rate limiter as jetstream_ingest
+	threshold := config.LikeRateLimitPerHour / (60 / config.LikeRateLimitWindowMinutes)
+	rateLimiter := jetstream_ingest.NewRateLimiter(
+		time.Duration(config.LikeRateLimitWindowMinutes)*time.Minute,
+		time.Duration(config.LikeBlockDurationMinutes)*time.Minute,
+		threshold,
+	)
+	rateLimiter.Start(ctx)
+
+	client := firehose_ingest.NewClient(config.FirehoseURL, logger)
+	if !noRewind {
+		if cursor := stateManager.GetCursor(); cursor != nil {
+			client.SetCursor(cursor.LastTimeUs)
+			logger.Info("Resuming from last processed sequence number: %d", cursor.LastTimeUs)
+		}
+	}
+
+	if err := client.Start(ctx); err != nil {
+		logger.Error("Failed to start firehose client: %v", err)
+		os.Exit(1)
+	}
+	defer func() {
+		if err := client.Close(); err != nil {
+			logger.Error("Failed to close firehose client: %v", err)
+		}
+	}()
+
+	healthServer.SetHealthy(true, "Processing firehose messages")
+
+	msgChan := client.GetMessageChannel()
+	const batchSize = 100
+	batch := &pendingBatch{}
+	processedCount := 0
+	skippedCount := 0
+	flushCount := 0
+	var flushedSeq, flushedTimeUs int64
+	var haltErr error
+	cursorWrites := common.NewCursorThrottle(common.CursorWritePolicyFromConfig(config, 10*time.Second), logger)
+	if !dryRun {
+		logger.Info("Writing the cursor %s", cursorWrites.Policy())
+	}
+
+	// Flush partial batches on a timer so quiet periods do not hold the cursor back
+	flushTicker := time.NewTicker(time.Second)
+	defer flushTicker.Stop()
+
+	flush := func(flushCtx context.Context) {
+		if batch.size() == 0 {
+			return
+		}
+		common.RecordFreshness(batch.timeUs, logger)
+		if err := flushBatch(flushCtx, esClient, likesRouter, batch, dryRun, logger); err != nil {
+			logger.Error("Failed to flush batch ending at seq %d: %v", batch.seq, err)
+		} else {
+			processedCount += batch.size()
+			flushCount++
+			flushedSeq, flushedTimeUs = batch.seq, batch.timeUs
+			cursorWrites.AddBatches(1)
+			if now := time.Now(); !dryRun && cursorWrites.Due(now) {
+				// Throttled to avoid a GCS rate limit on state file writes
+				if err := stateManager.UpdateCursor(batch.seq); err != nil {
+					logger.Error("Failed to update cursor: %v", err)
+				} else {
+					client.UpdateCursor(batch.seq)
+					cursorWrites.Written(batch.timeUs, now)
+				}
+			}
+		}
+		seq, timeUs := batch.seq, batch.timeUs
+		batch = &pendingBatch{seq: seq, timeUs: timeUs}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Shutdown signal received, stopping ingestion")
+			goto cleanup
+		case <-flushTicker.C:
+			flush(ctx)
+		case data, ok := <-msgChan:
+			if !ok {
+				logger.Info("Firehose channel closed, finishing remaining batch")
+				goto cleanup
+			}
+
+			logger.Metric("firehose.inbound_count", 1)
+			_, parseSpan := common.StartSpan(ctx, "firehose.parse")
+			frame, err := firehose_ingest.DecodeFrame(data)
+			common.EndSpan(parseSpan, err)
+			if err != nil {
+				logger.Error("Failed to decode firehose frame: %v", err)
+				logger.Metric("firehose.decode_errors_count", 1)
+				if haltErr = malformed.Malformed(ctx, "firehose frame", data, err); haltErr != nil {
+					logger.Error("Halting ingestion: %v", haltErr)
+					healthServer.SetHealthy(false, haltErr.Error())
+					goto cleanup
+				}
+				continue
+			}
+			malformed.Valid()
+			healthServer.RecordEvent("firehose", frame.TimeUs)
+			if frame.Seq > batch.seq {
+				batch.seq = frame.Seq
+			}
+			if frame.TimeUs > batch.timeUs {
+				batch.timeUs = frame.TimeUs
+			}
+
+			if !common.ShouldSampleDID(frame.Repo, config.Environment) {
+				logger.Metric("firehose.sample_dropped_count", 1)
+				continue
+			}
+
+			for _, op := range frame.Ops {
+				if !addOp(batch, frame, op, rateLimiter, denyList, logger) {
+					skippedCount++
+				}
+			}
+
+			if batch.size() >= batchSize {
+				flush(ctx)
+
+				// Check for a newer instance every 10 flushes to avoid excessive GCS reads
+				if flushCount%10 == 0 && stateManager.CheckForNewerInstance(myStartTime) {
+					logger.Info("Newer instance detected, exiting")
+					goto cleanup
+				}
+			}
+		}
+	}
+
+cleanup:
+	cleanupCtx, cleanupCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cleanupCancel()
+	flush(cleanupCtx)
+	if !dryRun && flushedSeq > 0 {
+		if err := stateManager.UpdateCursor(flushedSeq); err != nil {
+			logger.Error("Failed to flush final cursor update: %v", err)
+		} else {
+			cursorWrites.Written(flushedTimeUs, time.Now())
+		}
+	}
+	malformed.Flush(cleanupCtx)
+
+	logger.Info("Firehose ingestion complete. Processed: %d, Skipped: %d", processedCount, skippedCount)
+	if haltErr != nil {
+		os.Exit(1)
+	}
+}
+
+// addOp routes a single firehose op into the pending batch. Returns false if
+// an op for a collection we index was dropped. Creations by DIDs on the deny
+// list are dropped; their deletions still apply.
+func addOp(batch *pendingBatch, frame *firehose_ingest.Frame, op firehose_ingest.Op, rateLimiter *jetstream_ingest.RateLimiter, denyList *common.DenyList, logger *common.IngestLogger) bool {
+	switch op.Collection {
+	case "app.bsky.feed.post":
+		if op.Action == "delete" {
+			msg := frame.MegaStreamMessage(op, logger)
+			batch.postTombstones = append(batch.postTombstones, common.CreatePostTombstoneDoc(msg))
+			batch.postDeletes = append(batch.postDeletes, common.DeleteDoc{DocID: msg.GetAtURI(), AuthorDID: msg.GetAuthorDID(), Version: msg.GetTimeUs()})
+			return true
+		}
+		if op.Record == nil {
+			// tooBig commits omit record blocks
+			logger.Metric("firehose.missing_record_count", 1)
+			return false
+		}
+		msg := frame.MegaStreamMessage(op, logger)
+		if denyList.Denied(common.DenyStageIngest, msg.GetAuthorDID(), msg.GetAtURI()) {
+			return false
+		}
+		batch.posts = append(batch.posts, msg)
+		return true
+
+	case "app.bsky.feed.like":
+		msg := frame.JetstreamMessage(op, logger)
+		if msg.IsLikeDelete() {
+			batch.likeDeletes = append(batch.likeDeletes, msg)
+			return true
+		}
+		if !msg.IsLike() {
+			return true
+		}
+		if denyList.Denied(common.DenyStageIngest, msg.GetAuthorDID(), msg.GetAtURI()) {
+			return false
+		}
+		if blocked, newlyBlocked := rateLimiter.RecordLike(msg.GetAuthorDID()); blocked {
+			if newlyBlocked {
+				logger.Metric("firehose.blocked_accounts_count", 1)
+			}
+			logger.Metric("firehose.dropped_likes_count", 1)
+			return false
+		}
+		if msg.GetSubjectURI() == "" || msg.GetCreatedAt() == "" {
+			logger.Error("Skipping like with empty subject_uri or created_at (at_uri: %s)", msg.GetAtURI())
+			return false
+		}
+		batch.likes = append(batch.likes, common.CreateLikeDoc(msg))
+		return true
+	}
+
+	return true
+}
+
+// flushBatch writes a pending batch to Elasticsearch. Tombstones are always
+// written before the documents they replace are deleted.
+func flushBatch(ctx context.Context, esClient *elasticsearch.Client, likesRouter *common.IndexRouter, batch *pendingBatch, dryRun bool, logger *common.IngestLogger) (err error) {
+	ctx, span := common.StartSpan(ctx, "firehose.flush", attribute.Int("ingex.batch_size", batch.size()))
+	defer func() { common.EndSpan(span, err) }()
+
+	if len(batch.postDeletes) > 0 {
+		if err := common.BulkIndexPostTombstones(ctx, esClient, common.WriteAlias("post_tombstones"), batch.postTombstones, dryRun, logger); err != nil {
+			return fmt.Errorf("failed to index tombstones to post_tombstones: %w", err)
+		}
+		if err := common.BulkIndexPostTombstones(ctx, esClient, common.WriteAlias("reply_tombstones"), batch.postTombstones, dryRun, logger); err != nil {
+			return fmt.Errorf("failed to index tombstones to reply_tombstones: %w", err)
+		}
+		if err := common.BulkDelete(ctx, esClient, common.WriteAlias("posts"), batch.postDeletes, dryRun, logger); err != nil {
+			return fmt.Errorf("failed to delete from posts: %w", err)
+		}
+		if err := common.BulkDelete(ctx, esClient, common.WriteAlias("replies"), batch.postDeletes, dryRun, logger); err != nil {
+			return fmt.Errorf("failed to delete from replies: %w", err)
+		}
+		logger.Metric("firehose.posts_deleted_count", float64(len(batch.postDeletes)))
+	}
+
+	if len(batch.posts) > 0 {
+		var postsBatch []common.PostDoc
+		var repliesBatch []common.ReplyDoc
+		for _, m := range batch.posts {
+			if m.GetThreadParentPost() != "" || m.GetThreadRootPost() != "" {
+				repliesBatch = append(repliesBatch, common.CreateReplyDoc(m, 0))
+			} else {
+				postsBatch = append(postsBatch, common.CreatePostDoc(m, 0))
+			}
+		}
+		if err := common.BulkIndex(ctx, esClient, common.WriteAlias("posts"), postsBatch, dryRun, logger); err != nil {
+			return fmt.Errorf("failed to bulk index posts: %w", err)
+		}
+		if err := common.BulkIndex(ctx, esClient, common.WriteAlias("replies"), repliesBatch, dryRun, logger); err != nil {
+			return fmt.Errorf("failed to bulk index replies: %w", err)
+		}
+		logger.Metric("firehose.posts_indexed_count", float64(len(postsBatch)))
+		logger.Metric("firehose.replies_indexed_count", float64(len(repliesBatch)))
+	}
+
+	if len(batch.likeDeletes) > 0 {
+		if err := flushLikeDeletes(ctx, esClient, likesRouter, batch.likeDeletes, dryRun, logger); err != nil {
+			return err
+		}
+	}
+
+	if len(batch.likes) > 0 {
+		if err := likesRouter.Route(ctx, batch.likes); err != nil {
+			return fmt.Errorf("failed to route likes: %w", err)
+		}
+		if err := common.BulkIndexLikes(ctx, esClient, "likes", batch.likes, dryRun, logger); err != nil {
+			return fmt.Errorf("failed to bulk index likes: %w", err)
+		}
+		logger.Metric("firehose.likes_indexed_count", float64(len(batch.likes)))
+
+		updates := make([]common.LikeCountUpdate, len(batch.likes))
+		for i, like := range batch.likes {
+			updates[i] = common.LikeCountUpdate{SubjectURI: like.SubjectURI, Increment: 1}
+		}
+		updateLikeCounts(ctx, esClient, updates, dryRun, logger, "increment like counts in")
+	}
+
+	return nil
+}
+
+// flushLikeDeletes mirrors jetstream_ingest: the liked post is read back from
+// the likes index so a tombstone can be written and its like count decremented
+func flushLikeDeletes(ctx context.Context, esClient *elasticsearch.Client, likesRouter *common.IndexRouter, deleteMessages []common.JetstreamMessage, dryRun bool, logger *common.IngestLogger) error {
+	likeIDs := make([]common.LikeIdentifier, len(deleteMessages))
+	deleteBatch := make([]common.DeleteDoc, len(deleteMessages))
+	for i, msg := range deleteMessages {
+		likeIDs[i] = common.LikeIdentifier{AtURI: msg.GetAtURI(), AuthorDID: msg.GetAuthorDID()}
+		deleteBatch[i] = common.DeleteDoc{DocID: msg.GetAtURI(), AuthorDID: msg.GetAuthorDID()}
+	}
+
+	likeDocs, err := common.BulkGetLikes(ctx, esClient, "likes", likeIDs, logger)
+	if err != nil {
+		logger.Error("Failed to fetch like documents for deletion: %v", err)
+	}
+
+	var tombstoneBatch []common.LikeTombstoneDoc
+	for i, msg := range deleteMessages {
+		if likeDoc, found := likeDocs[msg.GetAtURI()]; found {
+			tombstoneBatch = append(tombstoneBatch, common.CreateLikeTombstoneDoc(msg, likeDoc.SubjectURI))
+			deleteBatch[i].Index = likeDoc.Index
+		}
+	}
+	likesRouter.RouteDeletes(deleteBatch)
+
+	if err := common.BulkIndexLikeTombstones(ctx, esClient, common.WriteAlias("like_tombstones"), tombstoneBatch, dryRun, logger); err != nil {
+		return fmt.Errorf("failed to bulk index like tombstones: %w", err)
+	}
+	if err := common.BulkDelete(ctx, esClient, "likes", deleteBatch, dryRun, logger); err != nil {
+		return fmt.Errorf("failed to bulk delete likes: %w", err)
+	}
+	logger.Metric("firehose.likes_deleted_count", float64(len(deleteBatch)))
+
+	updates := make([]common.LikeCountUpdate, len(tombstoneBatch))
+	for i, tombstone := range tombstoneBatch {
+		updates[i] = common.LikeCountUpdate{SubjectURI: tombstone.SubjectURI, Increment: -1}
+	}
+	updateLikeCounts(ctx, esClient, updates, dryRun, logger, "decrement like counts in")
+	return nil
+}
+
+// updateLikeCounts applies like count changes to posts and replies. Failures
+// are logged rather than returned, as in jetstream_ingest.
+func updateLikeCounts(ctx context.Context, esClient *elasticsearch.Client, updates []common.LikeCountUpdate, dryRun bool, logger *common.IngestLogger, action string) {
+	if len(updates) == 0 {
+		return
+	}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go common.BulkIndexWorker(&wg, ctx, esClient, common.WriteAlias("posts"), updates, dryRun, logger, common.BulkUpdateLikeCounts, action)
+	go common.BulkIndexWorker(&wg, ctx, esClient, common.WriteAlias("replies"), updates, dryRun, logger, common.BulkUpdateLikeCounts, action)
+	wg.Wait()
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/index_digest"
+)
+
+const (
+	ActionCompute = "compute"
+	ActionVerify  = "verify"
+)
+
+func main() {
+	// Parse command line flags
+	action := flag.String("action", ActionCompute, "Action: compute (write a digest report) or verify (compare against a baseline report)")
+	indices := flag.String("indices", strings.Join(index_digest.DefaultIndices, ","), "Comma-separated aliases to digest")
+	fromFlag := flag.String("from", "", "Start of the range, RFC3339 (default: 24 hours before -to)")
+	toFlag := flag.String("to", "", "End of the range, RFC3339, exclusive (default: start of the current hour)")
+	output := flag.String("output", "", "Where compute writes the report: local path or gs://bucket/object (default: stdout summary only)")
+	label := flag.String("label", "", "Free-form label stored in the report (e.g. pre-restore)")
+	baseline := flag.String("baseline", "", "Baseline report to verify against: local path or gs://bucket/object")
+	candidate := flag.String("candidate", "", "Candidate report to verify (default: compute live from the current cluster over the baseline's range)")
+	skipTLSVerify := flag.Bool("skip-tls-verify", false, "Skip TLS certificate verification (use for local development only)")
+	debug := flag.Bool("debug", false, "Enable debug logging")
+	flag.Parse()
+
+	// Load configuration
+	config := common.LoadConfig()
+	logger := common.NewLogger(config.LoggingEnabled)
+	logger.SetService("index_digest")
+	logger.SetDebugEnabled(*debug)
+	otelCollector, err := common.NewOTelMetricCollector("index-digest", config.Environment, config.GCPProjectID, config.GCPRegion, config.MetricExportIntervalSec)
+	if err != nil {
+		logger.Error("Failed to create OTel metric collector: %v (continuing without metrics)", err)
+	} else {
+		logger.SetMetricCollector(otelCollector)
+		defer func() {
+			if err := otelCollector.Shutdown(context.Background()); err != nil {
+				logger.Error("Failed to shutdown OTel metric collector: %v", err)
+			}
+		}()
+	}
+
+	logger.Info("Green Earth Ingex - Index Digest Tool")
+	logger.Info("Action: %s, environment: %s", *action, config.Environment)
+
+	// Setup context with cancellation for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Handle shutdown signals
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		logger.Info("Received signal %v, shutting down...", sig)
+		cancel()
+	}()
+
+	// Verifying two stored reports needs no cluster access
+	if *action == ActionVerify && *candidate != "" {
+		if err := verifyReports(ctx, logger, *baseline, *candidate); err != nil {
+			logger.Error("Digest verify failed: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if config.ElasticsearchURL == "" {
+		logger.Error("GE_ELASTICSEARCH_URL environment variable is required")
+		os.Exit(1)
+	}
+	esConfig := common.ElasticsearchConfig{
+		URL:           config.ElasticsearchURL,
+		APIKey:        config.ElasticsearchAPIKey,
+		SkipTLSVerify: *skipTLSVerify || config.ElasticsearchTLSSkipVerify,
+	}
+	esClient, err := common.NewElasticsearchClient(esConfig, logger)
+	if err != nil {
+		logger.Error("Failed to create Elasticsearch client: %v", err)
+		os.Exit(1)
+	}
+
+	service := index_digest.NewService(esClient, index_digest.Config{
+		Indices: strings.Split(*indices, ","),
+	}, logger)
+
+	switch *action {
+	case ActionCompute:
+		from, to, err := parseRange(*fromFlag, *toFlag, time.Now())
+		if err != nil {
+			logger.Error("%v", err)
+			os.Exit(1)
+		}
+		report, err := compute(ctx, service, config.Environment, *label, from, to)
+		if err != nil {
+			logger.Error("Digest compute failed: %v", err)
+			logger.Metric("index_digest.compute_error_count", 1)
+			os.Exit(1)
+		}
+		if *output != "" {
+			if err := index_digest.WriteReport(ctx, *output, report); err != nil {
+				logger.Error("%v", err)
+				os.Exit(1)
+			}
+			logger.Info("Wrote %d digests to %s", len(report.Digests), *output)
+		} else {
+			printReport(report)
+		}
+		logger.Metric("index_digest.compute_success_count", 1)
+
+	case ActionVerify:
+		if *baseline == "" {
+			logger.Error("-baseline is required for verify")
+			os.Exit(1)
+		}
+		base, err := index_digest.ReadReport(ctx, *baseline)
+		if err != nil {
+			logger.Error("%v", err)
+			os.Exit(1)
+		}
+		live, err := compute(ctx, service, config.Environment, "live", base.From, base.To)
+		if err != nil {
+			logger.Error("Digest compute failed: %v", err)
+			os.Exit(1)
+		}
+		if !reportMatches(logger, base, live) {
+			os.Exit(1)
+		}
+
+	default:
+		logger.Error("Unknown action %q (expected compute or verify)", *action)
+		os.Exit(1)
+	}
+}
+
+// parseRange resolves -from and -to; the default is the 24 complete hours before now
+func parseRange(fromFlag, toFlag string, now time.Time) (time.Time, time.Time, error) {
+	to := now.UTC().Truncate(time.Hour)
+	if toFlag != "" {
+		t, err := time.Parse(time.RFC3339, toFlag)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid -to %q: %w", toFlag, err)
+		}
+		to = t
+	}
+	from := to.Add(-24 * time.Hour)
+	if fromFlag != "" {
+		t, err := time.Parse(time.RFC3339, fromFlag)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid -from %q: %w", fromFlag, err)
+		}
+		from = t
+	}
+	return from.UTC().Truncate(time.Hour), to.UTC().Truncate(time.Hour), nil
+}
+
+func compute(ctx context.Context, service *index_digest.Service, environment, label string, from, to time.Time) (*index_digest.Report, error) {
+	digests, err := service.Compute(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return &index_digest.Report{
+		Environment: environment,
+		Label:       label,
+		ComputedAt:  time.Now().UTC(),
+		From:        from,
+		To:          to,
+		Digests:     digests,
+	}, nil
+}
+
+func verifyReports(ctx context.Context, logger *common.IngestLogger, baselinePath, candidatePath string) error {
+	if baselinePath == "" {
+		return fmt.Errorf("-baseline is required for verify")
+	}
+	base, err := index_digest.ReadReport(ctx, baselinePath)
+	if err != nil {
+		return err
+	}
+	candidate, err := index_digest.ReadReport(ctx, candidatePath)
+	if err != nil {
+		return err
+	}
+	if !reportMatches(logger, base, candidate) {
+		return fmt.Errorf("%s and %s differ", baselinePath, candidatePath)
+	}
+	return nil
+}
+
+// reportMatches logs every mismatched hour and reports whether there were none
+func reportMatches(logger *common.IngestLogger, baseline, candidate *index_digest.Report) bool {
+	mismatches := index_digest.Compare(baseline, candidate)
+	logger.Metric("index_digest.mismatched_hours_count", float64(len(mismatches)))
+	for _, m := range mismatches {
+		logger.Error("%s %s: %s has %d docs (xor %s), %s has %d docs (xor %s)",
+			m.Index, m.Hour,
+			describe(baseline), m.Baseline.Count, m.Baseline.XOR,
+			describe(candidate), m.Candidate.Count, m.Candidate.XOR)
+	}
+	if len(mismatches) > 0 {
+		logger.Error("%d of %d hours differ", len(mismatches), len(baseline.Digests))
+		return false
+	}
+	logger.Info("All %d digests match between %s and %s", len(baseline.Digests), describe(baseline), describe(candidate))
+	return true
+}
+
+func describe(report *index_digest.Report) string {
+	if report.Label != "" {
+		return report.Environment + "/" + report.Label
+	}
+	return report.Environment
+}
+
+func printReport(report *index_digest.Report) {
+	for _, d := range report.Digests {
+		fmt.Printf("%s\t%s\t%d\t%s\n", d.Index, d.Hour.Format("2006-01-02T15"), d.Count, d.XOR)
+	}
+}
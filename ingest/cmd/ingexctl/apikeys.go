@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func runAPIKeys(args []string) error {
+	fs := flag.NewFlagSet("api-keys", flag.ExitOnError)
+	services := fs.String("service", strings.Join(common.RoleServices(), ","), "Comma-separated services to print API key requests for")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// GE_AUDIT_INDEX and GE_DENY_LIST add indices to the roles
+	return writeAPIKeyRequests(os.Stdout, strings.Split(*services, ","), common.LoadConfig())
+}
+
+// writeAPIKeyRequests writes a create API key request per service, in the
+// form Kibana Dev Tools accepts, granting only what the service needs
+func writeAPIKeyRequests(w io.Writer, services []string, config *common.Config) error {
+	for i, service := range services {
+		service = strings.TrimSpace(service)
+		request, err := common.APIKeyRequest(service, config)
+		if err != nil {
+			return err
+		}
+		body, err := json.MarshalIndent(request, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal API key request for %s: %w", service, err)
+		}
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "# %s\nPOST /_security/api_key\n%s\n", service, body)
+	}
+	return nil
+}
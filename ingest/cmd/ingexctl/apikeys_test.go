@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func TestWriteAPIKeyRequests(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeAPIKeyRequests(&out, []string{"extract", " elasticsearch_expiry"}, &common.Config{AuditIndex: "ops_audit"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	requests := strings.Split(out.String(), "\n\n")
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d:\n%s", len(requests), out.String())
+	}
+	lines := strings.SplitN(requests[1], "\n", 3)
+	if lines[0] != "# elasticsearch_expiry" || lines[1] != "POST /_security/api_key" {
+		t.Errorf("unexpected request header %q", lines[:2])
+	}
+	var body struct {
+		Name            string                           `json:"name"`
+		RoleDescriptors map[string]common.RoleDescriptor `json:"role_descriptors"`
+	}
+	if err := json.Unmarshal([]byte(lines[2]), &body); err != nil {
+		t.Fatalf("failed to parse request body: %v", err)
+	}
+	if body.Name != "elasticsearch_expiry-key" || len(body.RoleDescriptors["elasticsearch_expiry_role"].Indices) != 2 {
+		t.Errorf("unexpected request %+v", body)
+	}
+}
+
+func TestWriteAPIKeyRequests_UnknownService(t *testing.T) {
+	if err := writeAPIKeyRequests(&bytes.Buffer{}, []string{"spooler"}, &common.Config{}); err == nil {
+		t.Error("expected an error for an unknown service")
+	}
+}
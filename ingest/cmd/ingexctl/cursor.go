@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+const cursorUsage = `Usage: ingexctl cursor <subcommand> [flags]
+
+Subcommands:
+  history  Print the recent moves of the ingest cursors
+`
+
+func runCursor(args []string) error {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, cursorUsage)
+		return fmt.Errorf("missing subcommand")
+	}
+	switch args[0] {
+	case "history":
+		return runCursorHistory(args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(cursorUsage)
+		return nil
+	default:
+		return fmt.Errorf("unknown subcommand %q", args[0])
+	}
+}
+
+func runCursorHistory(args []string) error {
+	fs := flag.NewFlagSet("cursor history", flag.ExitOnError)
+	stateFiles := fs.String("state", "", "Comma-separated state files to read (default: GE_MEGASTREAM_STATE_FILE,GE_JETSTREAM_STATE_FILE)")
+	limit := fs.Int("limit", 50, "Print at most this many of the newest entries per state file (0 for all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	config := common.LoadConfig()
+	logger := common.NewLogger(config.LoggingEnabled)
+	logger.SetService("ingexctl")
+
+	paths := []string{config.MegastreamStateFile, config.JetstreamStateFile}
+	if *stateFiles != "" {
+		paths = strings.Split(*stateFiles, ",")
+	}
+	for i, stateFile := range paths {
+		stateManager, err := common.NewStateManager(strings.TrimSpace(stateFile), logger)
+		if err != nil {
+			return fmt.Errorf("failed to open state %s: %w", stateFile, err)
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s\n", stateFile)
+		printCursorHistory(os.Stdout, stateManager.GetCursor(), *limit)
+	}
+	return nil
+}
+
+// printCursorHistory writes the newest limit entries of the cursor's
+// history to w, oldest first, with how far each moved the cursor
+func printCursorHistory(w io.Writer, cursor *common.CursorState, limit int) {
+	if cursor == nil || len(cursor.History) == 0 {
+		fmt.Fprintln(w, "No cursor history recorded")
+		return
+	}
+	history := cursor.History
+	start := 0
+	if limit > 0 && len(history) > limit {
+		start = len(history) - limit
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "AT\tCURSOR\tMOVED\tLAG\tREASON")
+	for i := start; i < len(history); i++ {
+		entry := history[i]
+		cursorTime := time.UnixMicro(entry.LastTimeUs).UTC()
+		moved := "-"
+		if i > 0 {
+			moved = formatCursorMove(time.Duration(entry.LastTimeUs-history[i-1].LastTimeUs) * time.Microsecond)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n",
+			entry.At.UTC().Format(time.RFC3339),
+			cursorTime.Format(time.RFC3339),
+			moved,
+			entry.At.Sub(cursorTime).Round(time.Second),
+			entry.Reason)
+	}
+	_ = tw.Flush()
+	fmt.Fprintf(w, "Current cursor: %s (updated %s)\n",
+		time.UnixMicro(cursor.LastTimeUs).UTC().Format(time.RFC3339), cursor.UpdatedAt.UTC().Format(time.RFC3339))
+}
+
+// formatCursorMove formats how far the cursor moved, signed so moves back
+// stand out
+func formatCursorMove(d time.Duration) string {
+	if d < 0 {
+		return "-" + (-d).Round(time.Second).String()
+	}
+	return "+" + d.Round(time.Second).String()
+}
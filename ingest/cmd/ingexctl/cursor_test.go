@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func TestPrintCursorHistory(t *testing.T) {
+	at := time.Date(2026, 6, 3, 10, 0, 0, 0, time.UTC)
+	cursor := &common.CursorState{
+		LastTimeUs: at.Add(-time.Hour).UnixMicro(),
+		UpdatedAt:  at.Add(2 * time.Minute),
+		History: []common.CursorHistoryEntry{
+			{LastTimeUs: at.Add(-time.Minute).UnixMicro(), At: at},
+			{LastTimeUs: at.UnixMicro(), At: at.Add(time.Minute)},
+			{LastTimeUs: at.Add(-time.Hour).UnixMicro(), At: at.Add(2 * time.Minute), Reason: "ingexctl restore"},
+		},
+	}
+
+	var out bytes.Buffer
+	printCursorHistory(&out, cursor, 2)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected a header, 2 entries, and the current cursor, got:\n%s", out.String())
+	}
+	if !strings.Contains(lines[1], "+1m0s") || strings.Contains(out.String(), "09:59:00Z") {
+		t.Errorf("expected the newest entries with the move from the one before, got %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "-1h0m0s") || !strings.Contains(lines[2], "ingexctl restore") {
+		t.Errorf("expected the rewind with its reason, got %q", lines[2])
+	}
+
+	out.Reset()
+	printCursorHistory(&out, &common.CursorState{}, 0)
+	if !strings.Contains(out.String(), "No cursor history") {
+		t.Errorf("expected no history reported, got %q", out.String())
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+const usage = `Usage: ingexctl <command> [flags]
+
+Commands:
+  restore         Restore indices from a snapshot and rewind ingest cursors to replay the gap
+  cursor history  Print the recent moves of the ingest cursors, including rewinds
+  api-keys        Print minimal Elasticsearch API key requests for each service
+  repair-routing  Reindex documents not routed by author_did so routed deletes find them
+  selftest        Check that SQLite, zip, and parquet compression work on this platform
+  version         Print the build version, commit, and time
+
+Run 'ingexctl <command> --help' for command flags.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "restore":
+		if err := runRestore(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "restore failed: %v\n", err)
+			os.Exit(1)
+		}
+	case "cursor":
+		if err := runCursor(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "cursor failed: %v\n", err)
+			os.Exit(1)
+		}
+	case "api-keys":
+		if err := runAPIKeys(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "api-keys failed: %v\n", err)
+			os.Exit(1)
+		}
+	case "repair-routing":
+		if err := runRepairRouting(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "repair-routing failed: %v\n", err)
+			os.Exit(1)
+		}
+	case "selftest":
+		if err := runSelfTest(os.Args[2:]); err != nil {
+			fmt.Fprintf(os.Stderr, "selftest failed: %v\n", err)
+			os.Exit(1)
+		}
+	case "version":
+		info := common.GetBuildInfo()
+		fmt.Printf("ingexctl %s (commit %s, built %s, %s %s)\n", info.Version, info.Commit, info.BuildTime, info.GoVersion, info.Platform)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
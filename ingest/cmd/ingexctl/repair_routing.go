@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func runRepairRouting(args []string) error {
+	fs := flag.NewFlagSet("repair-routing", flag.ExitOnError)
+	indices := fs.String("index", strings.Join(common.RoutedAliases, ","), "Comma-separated indices or aliases to repair")
+	batchSize := fs.Int("batch-size", 1000, "Documents scanned per page")
+	dryRun := fs.Bool("dry-run", false, "Count misrouted documents without repairing them")
+	skipTLSVerify := fs.Bool("skip-tls-verify", false, "Skip TLS certificate verification (use for local development only)")
+	debug := fs.Bool("debug", false, "Enable debug logging")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	config := common.LoadConfig()
+	logger := common.NewLogger(config.LoggingEnabled)
+	logger.SetService("ingexctl")
+	logger.SetDebugEnabled(*debug)
+
+	if config.ElasticsearchURL == "" {
+		return fmt.Errorf("GE_ELASTICSEARCH_URL environment variable is required")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		logger.Info("Received signal %v, aborting...", sig)
+		cancel()
+	}()
+
+	esClient, err := common.NewElasticsearchClient(common.ElasticsearchConfig{
+		URL:           config.ElasticsearchURL,
+		APIKey:        config.ElasticsearchAPIKey,
+		SkipTLSVerify: *skipTLSVerify || config.ElasticsearchTLSSkipVerify,
+	}, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create Elasticsearch client: %w", err)
+	}
+
+	// Routed copies that fail to index are dead-lettered, since their old
+	// copies are already deleted
+	deadLetters, err := common.NewDeadLetterQueue(ctx, config.DLQDestination, "ingexctl")
+	if err != nil {
+		return fmt.Errorf("failed to initialize dead-letter queue: %w", err)
+	}
+	if deadLetters == nil && !*dryRun {
+		logger.Info("GE_DLQ_DESTINATION is not set; documents that fail to reindex will only be logged")
+	}
+	defer func() { _ = deadLetters.Close() }()
+	logger.SetDeadLetterQueue(deadLetters)
+
+	var found []string
+	for _, index := range strings.Split(*indices, ",") {
+		index = strings.TrimSpace(index)
+		exists, err := indexExists(ctx, esClient, index)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			fmt.Printf("%s: not found, skipped\n", index)
+			continue
+		}
+		found = append(found, index)
+	}
+
+	// Relax refresh and replicas on the repaired indices while reindexing,
+	// restoring them however the repair ends
+	tuningConfig, err := common.BulkTuningConfigFromConfig(config)
+	if err != nil {
+		return err
+	}
+	if tuningConfig.Enabled() && !*dryRun && len(found) > 0 {
+		profile, err := common.IndexProfileFromConfig(config)
+		if err != nil {
+			return fmt.Errorf("invalid index configuration: %w", err)
+		}
+		tuned, err := common.BulkTuningIndices(ctx, esClient, found, logger)
+		if err != nil {
+			return err
+		}
+		indexManager := common.NewIndexManager(esClient, profile, found, logger)
+		tuning, err := indexManager.TuneForBulk(ctx, "repair-routing", tuned, tuningConfig)
+		defer tuning.Hold(ctx)()
+		if err != nil {
+			return fmt.Errorf("failed to tune indices for repair: %w", err)
+		}
+	}
+
+	failed := 0
+	for _, index := range found {
+		stats, err := common.RepairRouting(ctx, esClient, index, common.RoutingRepairConfig{
+			BatchSize: *batchSize,
+			DryRun:    *dryRun,
+		}, logger)
+		fmt.Printf("%s: scanned %d, misrouted %d, repaired %d, changed during repair %d, failed %d, without author_did %d\n",
+			index, stats.Scanned, stats.Misrouted, stats.Repaired, stats.Changed, stats.Failed, stats.Unroutable)
+		if err != nil {
+			return fmt.Errorf("repair of %s: %w", index, err)
+		}
+		failed += stats.Failed
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d documents could not be repaired (see logs)", failed)
+	}
+	return nil
+}
+
+// indexExists reports whether index or alias exists
+func indexExists(ctx context.Context, client *elasticsearch.Client, index string) (bool, error) {
+	res, err := client.Indices.Exists([]string{index}, client.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return false, fmt.Errorf("failed to check whether %s exists: %w", index, err)
+	}
+	_ = res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to check whether %s exists: %s", index, res.Status())
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/es_snapshot"
+)
+
+// replayPlan describes the window that must be re-ingested after a restore
+type replayPlan struct {
+	Snapshot es_snapshot.Snapshot
+	From     time.Time // Ingest cursors rewind to here
+	To       time.Time
+}
+
+// newReplayPlan starts the replay margin before the snapshot began, so
+// documents written while the snapshot was running are replayed too.
+// Re-ingesting a document is idempotent, so overlap is harmless.
+func newReplayPlan(snapshot es_snapshot.Snapshot, now time.Time, margin time.Duration) replayPlan {
+	return replayPlan{
+		Snapshot: snapshot,
+		From:     snapshot.StartTime.Add(-margin),
+		To:       now,
+	}
+}
+
+// Gap is the length of the replay window
+func (p replayPlan) Gap() time.Duration {
+	return p.To.Sub(p.From)
+}
+
+// parseAsOf parses an RFC3339 --as-of value; empty means now
+func parseAsOf(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return now, nil
+	}
+	asOf, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --as-of %q (expected RFC3339, e.g. 2026-03-15T04:00:00Z): %w", value, err)
+	}
+	if asOf.After(now) {
+		return time.Time{}, fmt.Errorf("--as-of %s is in the future", value)
+	}
+	return asOf, nil
+}
+
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	asOfFlag := fs.String("as-of", "", "Restore the newest successful snapshot taken at or before this RFC3339 time (default: now)")
+	snapshotName := fs.String("snapshot", "", "Restore this snapshot instead of selecting one by --as-of")
+	replayMargin := fs.Duration("replay-margin", 15*time.Minute, "Start replay this long before the snapshot began")
+	jetstreamRetention := fs.Duration("jetstream-retention", 24*time.Hour, "How far back Jetstream can replay; longer gaps lose likes")
+	yes := fs.Bool("yes", false, "Skip confirmation prompts")
+	dryRun := fs.Bool("dry-run", false, "Report the plan without deleting indices, restoring, or moving cursors")
+	skipTLSVerify := fs.Bool("skip-tls-verify", false, "Skip TLS certificate verification (use for local development only)")
+	debug := fs.Bool("debug", false, "Enable debug logging")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	config := common.LoadConfig()
+	logger := common.NewLogger(config.LoggingEnabled)
+	logger.SetService("ingexctl")
+	logger.SetDebugEnabled(*debug)
+
+	if config.ElasticsearchURL == "" {
+		return fmt.Errorf("GE_ELASTICSEARCH_URL environment variable is required")
+	}
+
+	now := time.Now().UTC()
+	asOf, err := parseAsOf(*asOfFlag, now)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		logger.Info("Received signal %v, aborting...", sig)
+		cancel()
+	}()
+
+	esClient, err := common.NewElasticsearchClient(common.ElasticsearchConfig{
+		URL:           config.ElasticsearchURL,
+		APIKey:        config.ElasticsearchAPIKey,
+		SkipTLSVerify: *skipTLSVerify || config.ElasticsearchTLSSkipVerify,
+	}, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create Elasticsearch client: %w", err)
+	}
+	logger.SetAuditLog(common.NewAuditLog(esClient, config))
+
+	service := es_snapshot.NewService(esClient, es_snapshot.Config{
+		Repository: config.SnapshotRepository,
+		DryRun:     *dryRun,
+	}, logger)
+
+	snapshots, err := service.ListSnapshots(ctx)
+	if err != nil {
+		return err
+	}
+	snapshot, ok := chooseSnapshot(snapshots, *snapshotName, asOf)
+	if !ok {
+		if *snapshotName != "" {
+			return fmt.Errorf("no successful snapshot named %s", *snapshotName)
+		}
+		return fmt.Errorf("no successful snapshot at or before %s", asOf.Format(time.RFC3339))
+	}
+
+	plan := newReplayPlan(snapshot, now, *replayMargin)
+	logger.Info("Snapshot:      %s (started %s)", snapshot.Name, snapshot.StartTime.Format(time.RFC3339))
+	logger.Info("Replay window: %s to %s (%s)", plan.From.Format(time.RFC3339), plan.To.Format(time.RFC3339), plan.Gap().Round(time.Minute))
+	if plan.Gap() > *jetstreamRetention {
+		logger.Error("Replay window exceeds Jetstream retention (%s): likes before %s cannot be replayed and will be missing",
+			*jetstreamRetention, now.Add(-*jetstreamRetention).Format(time.RFC3339))
+	}
+
+	if !*dryRun && !*yes {
+		live, err := service.LiveIndices(ctx)
+		if err != nil {
+			return err
+		}
+		prompt := fmt.Sprintf("Ingestion must be stopped (scripts/ingestctl.sh stop); a running instance would overwrite the rewound cursors.\n"+
+			"This deletes %d live indices and restores %s. Continue?", len(live), snapshot.Name)
+		if !confirm(os.Stdin, prompt) {
+			return fmt.Errorf("aborted")
+		}
+	}
+
+	if err := service.RestoreSnapshot(ctx, snapshot); err != nil {
+		return err
+	}
+
+	for _, stateFile := range []string{config.MegastreamStateFile, config.JetstreamStateFile} {
+		if err := rewindCursor(ctx, stateFile, plan.From, *dryRun, logger); err != nil {
+			return err
+		}
+	}
+
+	logger.Metric("ingexctl.restore_gap_sec", plan.Gap().Seconds())
+	logger.Info("Restore complete. Start ingestion (scripts/ingestctl.sh start) to replay the window; services deployed with a --max-rewind limit will clamp the replay.")
+	return nil
+}
+
+// chooseSnapshot returns the named successful snapshot, or the newest
+// successful snapshot at or before asOf
+func chooseSnapshot(snapshots []es_snapshot.Snapshot, name string, asOf time.Time) (es_snapshot.Snapshot, bool) {
+	if name == "" {
+		return es_snapshot.SnapshotAsOf(snapshots, asOf)
+	}
+	for _, snapshot := range snapshots {
+		if snapshot.Name == name && snapshot.State == "SUCCESS" {
+			return snapshot, true
+		}
+	}
+	return es_snapshot.Snapshot{}, false
+}
+
+// rewindCursor moves an ingest cursor back to from. A cursor that is already
+// older is left alone, since moving it forward would skip unprocessed data.
+func rewindCursor(ctx context.Context, stateFile string, from time.Time, dryRun bool, logger *common.IngestLogger) error {
+	stateManager, err := common.NewStateManager(stateFile, logger)
+	if err != nil {
+		return fmt.Errorf("failed to open state %s: %w", stateFile, err)
+	}
+
+	fromUs := from.UnixMicro()
+	if cursor := stateManager.GetCursor(); cursor != nil && cursor.LastTimeUs <= fromUs {
+		logger.Info("Cursor in %s is already at %d, before the replay window; leaving it", stateFile, cursor.LastTimeUs)
+		return nil
+	}
+
+	if dryRun {
+		logger.Info("Dry-run: Would rewind cursor in %s to %d (%s)", stateFile, fromUs, from.Format(time.RFC3339))
+		return nil
+	}
+	if err := stateManager.OverrideCursor(ctx, fromUs, "ingexctl restore replay from "+from.Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("failed to rewind cursor in %s: %w", stateFile, err)
+	}
+	logger.Info("Rewound cursor in %s to %s", stateFile, from.Format(time.RFC3339))
+	return nil
+}
+
+// confirm asks a yes/no question on stdout and reads the answer from in
+func confirm(in io.Reader, prompt string) bool {
+	fmt.Printf("%s [y/N] ", prompt)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/es_snapshot"
+)
+
+func TestNewReplayPlan(t *testing.T) {
+	started := time.Date(2026, 3, 15, 4, 0, 0, 0, time.UTC)
+	now := started.Add(36 * time.Hour)
+
+	plan := newReplayPlan(es_snapshot.Snapshot{Name: "daily", StartTime: started}, now, 15*time.Minute)
+
+	if !plan.From.Equal(started.Add(-15 * time.Minute)) {
+		t.Errorf("From = %s, want margin before snapshot start", plan.From)
+	}
+	if plan.Gap() != 36*time.Hour+15*time.Minute {
+		t.Errorf("Gap = %s, want 36h15m", plan.Gap())
+	}
+}
+
+func TestParseAsOf(t *testing.T) {
+	now := time.Date(2026, 3, 16, 0, 0, 0, 0, time.UTC)
+
+	if got, err := parseAsOf("", now); err != nil || !got.Equal(now) {
+		t.Errorf("empty as-of = %s, %v; want now", got, err)
+	}
+	if got, err := parseAsOf("2026-03-15T04:00:00Z", now); err != nil || got.Hour() != 4 {
+		t.Errorf("unexpected result %s, %v", got, err)
+	}
+	if _, err := parseAsOf("2026-03-15", now); err == nil {
+		t.Error("expected error for non-RFC3339 value")
+	}
+	if _, err := parseAsOf("2026-03-17T00:00:00Z", now); err == nil {
+		t.Error("expected error for as-of in the future")
+	}
+}
+
+func TestChooseSnapshot_NamedMustBeSuccessful(t *testing.T) {
+	snapshots := []es_snapshot.Snapshot{
+		{Name: "good", State: "SUCCESS"},
+		{Name: "bad", State: "PARTIAL"},
+	}
+
+	if _, ok := chooseSnapshot(snapshots, "bad", time.Now()); ok {
+		t.Error("expected partial snapshot to be rejected")
+	}
+	if got, ok := chooseSnapshot(snapshots, "good", time.Now()); !ok || got.Name != "good" {
+		t.Errorf("got %s (found=%v), want good", got.Name, ok)
+	}
+}
+
+func TestRewindCursor_NeverMovesForward(t *testing.T) {
+	logger := common.NewLogger(false)
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(stateFile, []byte(`{"last_time_us": 1000}`), 0o600); err != nil {
+		t.Fatalf("failed to write state: %v", err)
+	}
+
+	if err := rewindCursor(context.Background(), stateFile, time.UnixMicro(5000), false, logger); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ := os.ReadFile(stateFile)
+	if !strings.Contains(string(data), `"last_time_us": 1000`) {
+		t.Errorf("expected older cursor to be kept, got %s", data)
+	}
+
+	if err := rewindCursor(context.Background(), stateFile, time.UnixMicro(500), false, logger); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, _ = os.ReadFile(stateFile)
+	if !strings.Contains(string(data), `"last_time_us": 500`) {
+		t.Errorf("expected cursor rewound to 500, got %s", data)
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/megastream_ingest"
+)
+
+// selfTest is one platform check run by ingexctl selftest
+type selfTest struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+func runSelfTest(args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ExitOnError)
+	debug := fs.Bool("debug", false, "Enable debug logging")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// The checks' own logging is only shown with --debug
+	logger := common.NewLogger(*debug)
+	logger.SetService("ingexctl")
+	logger.SetDebugEnabled(*debug)
+	tests := []selfTest{
+		{"sqlite and zip spooling", func(ctx context.Context) error { return megastream_ingest.SelfTest(ctx, logger) }},
+		{"parquet compression", func(context.Context) error { return common.CompressionSelfTest() }},
+	}
+	return writeSelfTestResults(context.Background(), os.Stdout, tests)
+}
+
+// writeSelfTestResults runs tests, writing a PASS or FAIL line for each, and
+// returns an error if any failed
+func writeSelfTestResults(ctx context.Context, w io.Writer, tests []selfTest) error {
+	fmt.Fprintf(w, "Platform: %s/%s (%s), zstd: %s\n", runtime.GOOS, runtime.GOARCH, runtime.Version(), common.ZstdImplementation)
+	failed := 0
+	for _, test := range tests {
+		if err := test.run(ctx); err != nil {
+			fmt.Fprintf(w, "FAIL %s: %v\n", test.name, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(w, "PASS %s\n", test.name)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d self-tests failed", failed, len(tests))
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWriteSelfTestResults(t *testing.T) {
+	tests := []selfTest{
+		{"passes", func(context.Context) error { return nil }},
+		{"fails", func(context.Context) error { return errors.New("codec mismatch") }},
+	}
+
+	var out bytes.Buffer
+	err := writeSelfTestResults(context.Background(), &out, tests)
+	if err == nil || !strings.Contains(err.Error(), "1 of 2") {
+		t.Errorf("expected one of two self-tests to fail, got %v", err)
+	}
+	if !strings.Contains(out.String(), "PASS passes\n") || !strings.Contains(out.String(), "FAIL fails: codec mismatch\n") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+}
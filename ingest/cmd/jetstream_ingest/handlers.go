@@ -0,0 +1,411 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/jetstream_ingest"
+)
+
+// Names of the record handlers runIngestion can register (--handlers)
+const (
+	handlerLikes   = "likes"
+	handlerFollows = "follows"
+	handlerPosts   = "posts"
+)
+
+// postCollection is the collection of the posts handler's records, which
+// is added to the subscribed collections when the handler runs
+const postCollection = "app.bsky.feed.post"
+
+// handlerIndices is the index each record handler writes to
+var handlerIndices = map[string]string{
+	handlerLikes:   "likes",
+	handlerFollows: "follows",
+	handlerPosts:   "posts",
+}
+
+// validateHandlers checks a --handlers list
+func validateHandlers(names []string) error {
+	if len(names) == 0 {
+		return fmt.Errorf("at least one handler is required (%s, %s, or %s)", handlerLikes, handlerFollows, handlerPosts)
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		if _, ok := handlerIndices[name]; !ok {
+			return fmt.Errorf("unknown handler %q (expected %s, %s, or %s)", name, handlerLikes, handlerFollows, handlerPosts)
+		}
+		if seen[name] {
+			return fmt.Errorf("handler %q is listed twice", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// cursorTracker works out the cursor ingestion may persist: the time of the
+// last event read, held back to just before the oldest event a record
+// handler has batched or in flight. Handlers that batch at different rates
+// share one Jetstream connection, so one handler's later batches may be
+// written while another's earlier events still wait; restarting from the
+// tracker's cursor replays those instead of skipping them. An event stays
+// pending until its job is written or spooled; a job that fails and cannot
+// be spooled holds the cursor back for the rest of the run.
+type cursorTracker struct {
+	mu      sync.Mutex
+	read    int64
+	pending map[string]map[int64]int // handler -> event time -> pending events
+}
+
+// newCursorTracker returns a tracker with nothing read
+func newCursorTracker() *cursorTracker {
+	return &cursorTracker{pending: map[string]map[int64]int{}}
+}
+
+// observe records that every event up to timeUs has been read and either
+// skipped or added to its handler
+func (c *cursorTracker) observe(timeUs int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if timeUs > c.read {
+		c.read = timeUs
+	}
+}
+
+// add records an event of handler's at timeUs as pending
+func (c *cursorTracker) add(handler string, timeUs int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	times := c.pending[handler]
+	if times == nil {
+		times = map[int64]int{}
+		c.pending[handler] = times
+	}
+	times[timeUs]++
+}
+
+// done records handler's events at times as written
+func (c *cursorTracker) done(handler string, times []int64) {
+	if handler == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pending := c.pending[handler]
+	for _, timeUs := range times {
+		if pending[timeUs]--; pending[timeUs] <= 0 {
+			delete(pending, timeUs)
+		}
+	}
+}
+
+// cursor returns the time up to which every event read has been written or
+// skipped, and which handler holds it back, if any
+func (c *cursorTracker) cursor() (int64, string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cursor, holder := c.read, ""
+	for handler, times := range c.pending {
+		for timeUs := range times {
+			if timeUs-1 < cursor {
+				cursor, holder = timeUs-1, handler
+			}
+		}
+	}
+	return cursor, holder
+}
+
+// handlerEnv is what the record handlers of one runIngestion share
+type handlerEnv struct {
+	ctx      context.Context
+	lanes    *batchLanes
+	esClient *elasticsearch.Client
+	cursor   *cursorTracker
+	summary  *ingestSummary
+	logger   *common.IngestLogger
+}
+
+// recordHandler ingests one kind of record off the shared Jetstream
+// connection, batching its creates and deletes and sending them to the
+// workers as jobs. The send methods report false when ingestion is shutting
+// down; what was not sent is left for the final flushes.
+type recordHandler interface {
+	// name is the handler's --handlers name
+	name() string
+	// handle batches msg if it is one of the handler's records, and
+	// reports whether it was
+	handle(msg common.JetstreamMessage, size int) (handled, ok bool)
+	// sendDue sends batches that have waited their maximum age
+	sendDue() bool
+	// sendAuthor sends ahead the batched creates by did, for an account
+	// deletion to find once they are written
+	sendAuthor(did string) bool
+	// flushCreates and flushDeletes send what is left at shutdown, each
+	// giving up after timeout
+	flushCreates(timeout time.Duration)
+	flushDeletes(timeout time.Duration)
+	hasDeletes() bool
+}
+
+// collectionHandler is a recordHandler for the records of one collection,
+// whose creates become documents of type T
+type collectionHandler[T any] struct {
+	env      *handlerEnv
+	kind     string // Handler name, e.g. likes
+	record   string // Record name for logs, e.g. like
+	isCreate func(common.JetstreamMessage) bool
+	isDelete func(common.JetstreamMessage) bool
+	// accept converts a create to its document, or reports false to skip
+	// it, having logged why
+	accept    func(common.JetstreamMessage) (T, bool)
+	uriOf     func(T) string
+	authorOf  func(T) string
+	createJob func(docs []T, timeUs int64, skipCount int) batchJob
+	deleteJob func(ctx context.Context, esClient *elasticsearch.Client, msgs []common.JetstreamMessage, timeUs int64, skipCount int, logger *common.IngestLogger) batchJob
+
+	creates     *common.Batcher[T]
+	createTimes []int64 // Event times of creates' documents, in order
+	deletes     *common.Batcher[common.JetstreamMessage]
+}
+
+func (h *collectionHandler[T]) name() string { return h.kind }
+
+func (h *collectionHandler[T]) hasDeletes() bool { return h.deletes.Len() > 0 }
+
+func (h *collectionHandler[T]) handle(msg common.JetstreamMessage, size int) (bool, bool) {
+	switch {
+	case h.isDelete(msg):
+		if msg.GetAtURI() == "" {
+			h.env.logger.Error("Skipping %s deletion with empty at_uri (author_did: %s)", h.record, msg.GetAuthorDID())
+			h.env.summary.skipped++
+			return true, true
+		}
+		// A create still waiting in the batch is sent ahead, so that its
+		// delete can follow once it is written
+		if h.batched(msg.GetAtURI()) && !h.sendCreates() {
+			return true, false
+		}
+		h.env.cursor.add(h.kind, msg.GetTimeUs())
+		return true, !h.deletes.Add(msg, size) || h.sendDeletes()
+	case h.isCreate(msg):
+		doc, ok := h.accept(msg)
+		if !ok {
+			h.env.summary.skipped++
+			return true, true
+		}
+		h.env.cursor.add(h.kind, msg.GetTimeUs())
+		h.createTimes = append(h.createTimes, msg.GetTimeUs())
+		return true, !h.creates.Add(doc, size) || h.sendCreates()
+	}
+	return false, true
+}
+
+// batched reports whether the create of the document at uri is batched
+func (h *collectionHandler[T]) batched(uri string) bool {
+	for _, doc := range h.creates.Docs() {
+		if h.uriOf(doc) == uri {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *collectionHandler[T]) sendAuthor(did string) bool {
+	for _, doc := range h.creates.Docs() {
+		if h.authorOf(doc) == did {
+			return h.sendCreates()
+		}
+	}
+	return true
+}
+
+func (h *collectionHandler[T]) sendDue() bool {
+	if h.creates.Due() && !h.sendCreates() {
+		return false
+	}
+	if h.deletes.Due() && !h.sendDeletes() {
+		return false
+	}
+	return true
+}
+
+// createsJob builds the job of the batched creates
+func (h *collectionHandler[T]) createsJob() batchJob {
+	job := h.createJob(h.creates.Docs(), latest(h.createTimes), h.env.summary.skipped)
+	job.handler, job.eventTimes = h.kind, h.createTimes
+	return job
+}
+
+// took starts a new batch of creates once the last was sent
+func (h *collectionHandler[T]) took() {
+	h.env.summary.processed += len(h.creates.Take())
+	h.createTimes = nil
+}
+
+func (h *collectionHandler[T]) sendCreates() bool {
+	if !h.env.lanes.send(h.env.ctx, h.createsJob()) {
+		return false
+	}
+	h.took()
+	return true
+}
+
+// deletesJob builds the job of ready, batched deletes
+func (h *collectionHandler[T]) deletesJob(ready []common.JetstreamMessage) batchJob {
+	times := make([]int64, len(ready))
+	for i, msg := range ready {
+		times[i] = msg.GetTimeUs()
+	}
+	job := h.deleteJob(h.env.ctx, h.env.esClient, ready, latest(times), h.env.summary.skipped, h.env.logger)
+	job.handler, job.eventTimes = h.kind, times
+	return job
+}
+
+// sendDeletes sends the batched deletes, holding those whose creates are
+// still queued for the next batch
+func (h *collectionHandler[T]) sendDeletes() bool {
+	ready, held := h.env.lanes.hold(h.deletes.Docs())
+	if len(ready) > 0 {
+		if !h.env.lanes.send(h.env.ctx, h.deletesJob(ready)) {
+			return false
+		}
+		h.env.summary.deleted += len(ready)
+	}
+	if len(held) > 0 {
+		h.env.logger.Metric("jetstream.held_deletes_count", float64(len(held)))
+	}
+	h.deletes.Take()
+	for _, msg := range held {
+		h.deletes.Add(msg, 0)
+	}
+	return true
+}
+
+func (h *collectionHandler[T]) flushCreates(timeout time.Duration) {
+	if h.creates.Len() == 0 {
+		return
+	}
+	if h.env.lanes.sendTimeout(h.createsJob(), timeout) {
+		h.took()
+	} else {
+		h.env.logger.Error("Timeout sending final %s batch to workers", h.record)
+	}
+}
+
+func (h *collectionHandler[T]) flushDeletes(timeout time.Duration) {
+	if h.deletes.Len() == 0 {
+		return
+	}
+	if h.env.lanes.sendTimeout(h.deletesJob(h.deletes.Docs()), timeout) {
+		h.env.summary.deleted += h.deletes.Len()
+	} else {
+		h.env.logger.Error("Timeout sending final %s delete batch to workers", h.record)
+	}
+}
+
+// latest returns the latest of times, or 0 if there are none
+func latest(times []int64) int64 {
+	var result int64
+	for _, timeUs := range times {
+		result = max(result, timeUs)
+	}
+	return result
+}
+
+// newLikeHandler returns the handler of likes. Likes replayed after a rewind
+// are skipped while dedup remembers them, and likes by accounts rateLimiter
+// blocks are dropped.
+func newLikeHandler(env *handlerEnv, batchConfig common.BatchConfig, dedup *jetstream_ingest.DedupCache, rateLimiter *jetstream_ingest.RateLimiter) recordHandler {
+	logger := env.logger
+	return &collectionHandler[common.LikeDoc]{
+		env:      env,
+		kind:     handlerLikes,
+		record:   "like",
+		isCreate: common.JetstreamMessage.IsLike,
+		isDelete: common.JetstreamMessage.IsLikeDelete,
+		accept: func(msg common.JetstreamMessage) (common.LikeDoc, bool) {
+			if dedup.Seen(msg.GetAtURI()) {
+				logger.Metric("jetstream.like_dedup.skipped_count", 1)
+				return common.LikeDoc{}, false
+			}
+			if blocked, newlyBlocked := rateLimiter.RecordLike(msg.GetAuthorDID()); blocked {
+				if newlyBlocked {
+					logger.Metric("jetstream.blocked_accounts_count", 1)
+				}
+				logger.Metric("jetstream.dropped_likes_count", 1)
+				return common.LikeDoc{}, false
+			}
+			if msg.GetAtURI() == "" {
+				logger.Error("Skipping like with empty at_uri (author_did: %s)", msg.GetAuthorDID())
+				return common.LikeDoc{}, false
+			}
+			if msg.GetSubjectURI() == "" {
+				logger.Error("Skipping like with empty subject_uri (at_uri: %s, author_did: %s)", msg.GetAtURI(), msg.GetAuthorDID())
+				return common.LikeDoc{}, false
+			}
+			return common.CreateLikeDoc(msg), true
+		},
+		uriOf:     func(like common.LikeDoc) string { return like.AtURI },
+		authorOf:  func(like common.LikeDoc) string { return like.AuthorDID },
+		createJob: newLikeJob,
+		deleteJob: newLikeDeleteJob,
+		creates:   common.NewBatcher[common.LikeDoc](batchConfig),
+		deletes:   common.NewBatcher[common.JetstreamMessage](batchConfig),
+	}
+}
+
+// newFollowHandler returns the handler of follows
+func newFollowHandler(env *handlerEnv, batchConfig common.BatchConfig) recordHandler {
+	return &collectionHandler[common.FollowDoc]{
+		env:      env,
+		kind:     handlerFollows,
+		record:   "follow",
+		isCreate: common.JetstreamMessage.IsFollow,
+		isDelete: common.JetstreamMessage.IsFollowDelete,
+		accept: func(msg common.JetstreamMessage) (common.FollowDoc, bool) {
+			if msg.GetAtURI() == "" || msg.GetSubjectDID() == "" {
+				env.logger.Error("Skipping follow with empty at_uri or subject_did (at_uri: %s, author_did: %s)", msg.GetAtURI(), msg.GetAuthorDID())
+				return common.FollowDoc{}, false
+			}
+			return common.CreateFollowDoc(msg), true
+		},
+		uriOf:     func(follow common.FollowDoc) string { return follow.AtURI },
+		authorOf:  func(follow common.FollowDoc) string { return follow.AuthorDID },
+		createJob: newFollowJob,
+		deleteJob: newFollowDeleteJob,
+		creates:   common.NewBatcher[common.FollowDoc](batchConfig),
+		deletes:   common.NewBatcher[common.JetstreamMessage](batchConfig),
+	}
+}
+
+// newPostHandler returns the handler of original posts, which indexes them
+// without embeddings as a fallback for when megastream lags (see
+// common.PostSourceJetstream). Replies are skipped, as are posts megastream
+// has already indexed, which the workers find stale.
+func newPostHandler(env *handlerEnv, batchConfig common.BatchConfig) recordHandler {
+	return &collectionHandler[common.PostDoc]{
+		env:      env,
+		kind:     handlerPosts,
+		record:   "post",
+		isCreate: common.JetstreamMessage.IsPost,
+		isDelete: common.JetstreamMessage.IsPostDelete,
+		accept: func(msg common.JetstreamMessage) (common.PostDoc, bool) {
+			post := msg.GetPost()
+			if post.GetThreadParentPost() != "" || post.GetThreadRootPost() != "" {
+				env.logger.Metric("jetstream.replies_skipped_count", 1)
+				return common.PostDoc{}, false
+			}
+			return common.CreateJetstreamPostDoc(post), true
+		},
+		uriOf:     func(post common.PostDoc) string { return post.AtURI },
+		authorOf:  func(post common.PostDoc) string { return post.AuthorDID },
+		createJob: newPostJob,
+		deleteJob: newPostDeleteJob,
+		creates:   common.NewBatcher[common.PostDoc](batchConfig),
+		deletes:   common.NewBatcher[common.JetstreamMessage](batchConfig),
+	}
+}
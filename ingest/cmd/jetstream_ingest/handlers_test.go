@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func TestCursorTracker_HeldBackByPendingEvents(t *testing.T) {
+	cursor := newCursorTracker()
+	cursor.add(handlerFollows, 10)
+	cursor.add(handlerLikes, 20)
+	cursor.add(handlerLikes, 30)
+	cursor.observe(40)
+
+	if got, holder := cursor.cursor(); got != 9 || holder != handlerFollows {
+		t.Errorf("expected the cursor before the oldest pending follow, got %d (%s)", got, holder)
+	}
+	cursor.done(handlerFollows, []int64{10})
+	if got, holder := cursor.cursor(); got != 19 || holder != handlerLikes {
+		t.Errorf("expected the cursor before the oldest pending like, got %d (%s)", got, holder)
+	}
+	cursor.done(handlerLikes, []int64{20, 30})
+	cursor.done("", []int64{5}) // Replayed jobs have no handler
+	if got, holder := cursor.cursor(); got != 40 || holder != "" {
+		t.Errorf("expected the cursor at the last event read, got %d (%s)", got, holder)
+	}
+}
+
+// followEvent returns a follow create or delete by did at timeUs
+func followEvent(operation, did, rkey string, timeUs int64) common.JetstreamMessage {
+	raw := fmt.Sprintf(`{"did":%q,"time_us":%d,"kind":"commit","commit":{"operation":%q,"collection":"app.bsky.graph.follow","rkey":%q`, did, timeUs, operation, rkey)
+	if operation == "create" {
+		raw += `,"record":{"$type":"app.bsky.graph.follow","subject":"did:plc:z","createdAt":"2026-06-03T10:00:00Z"}`
+	}
+	return common.NewJetstreamMessage(raw+`}}`, common.NewLogger(false))
+}
+
+func TestCollectionHandler_BatchesAndTracksEvents(t *testing.T) {
+	es := estest.New(t)
+	lanes := newBatchLanes(4)
+	summary := &ingestSummary{}
+	cursor := newCursorTracker()
+	env := &handlerEnv{ctx: context.Background(), lanes: lanes, esClient: es.Client, cursor: cursor, summary: summary, logger: common.NewLogger(false)}
+	follows := newFollowHandler(env, common.BatchConfig{MaxDocs: 2, MaxAge: time.Hour})
+
+	like := common.NewJetstreamMessage(`{"did":"did:plc:a","time_us":1,"kind":"commit","commit":{"operation":"create","collection":"app.bsky.feed.like","rkey":"1","record":{"subject":{"uri":"at://did:plc:b/app.bsky.feed.post/1"}}}}`, common.NewLogger(false))
+	if handled, _ := follows.handle(like, 10); handled {
+		t.Fatal("expected a like not handled by the follow handler")
+	}
+
+	for i, msg := range []common.JetstreamMessage{followEvent("create", "did:plc:a", "1", 100), followEvent("create", "did:plc:a", "2", 200)} {
+		if handled, ok := follows.handle(msg, 10); !handled || !ok {
+			t.Fatalf("follow %d: expected it handled", i)
+		}
+	}
+	job, ok := lanes.next()
+	if !ok || len(job.followBatch) != 2 || job.handler != handlerFollows || len(job.eventTimes) != 2 || job.timeUs != 200 {
+		t.Fatalf("expected a full batch of follows sent, got %+v", job)
+	}
+	cursor.observe(200)
+	if got, _ := cursor.cursor(); got != 99 {
+		t.Errorf("expected the cursor held before the sent follows, got %d", got)
+	}
+
+	// The delete of a batched follow sends the follow ahead
+	if handled, ok := follows.handle(followEvent("create", "did:plc:a", "3", 300), 10); !handled || !ok {
+		t.Fatal("expected the follow handled")
+	}
+	if handled, ok := follows.handle(followEvent("delete", "did:plc:a", "3", 400), 10); !handled || !ok {
+		t.Fatal("expected the unfollow handled")
+	}
+	ahead, _ := lanes.next()
+	if len(ahead.followBatch) != 1 || ahead.followBatch[0].AtURI != "at://did:plc:a/app.bsky.graph.follow/3" {
+		t.Fatalf("expected the unfollowed follow sent ahead, got %+v", ahead)
+	}
+	if !follows.hasDeletes() || summary.processed != 3 {
+		t.Errorf("expected the unfollow batched after 3 follows sent, got %+v", summary)
+	}
+
+	lanes.done(job)
+	lanes.done(ahead)
+	cursor.done(job.handler, job.eventTimes)
+	cursor.done(ahead.handler, ahead.eventTimes)
+	follows.flushDeletes(time.Second)
+	unfollow, _ := lanes.next()
+	if len(unfollow.followDeleteBatch) != 1 || summary.deleted != 1 {
+		t.Fatalf("expected the unfollow sent at shutdown, got %+v", unfollow)
+	}
+	cursor.observe(400)
+	if got, holder := cursor.cursor(); got != 399 || holder != handlerFollows {
+		t.Errorf("expected the cursor held by the unfollow in flight, got %d (%s)", got, holder)
+	}
+}
+
+func TestValidateHandlers(t *testing.T) {
+	if err := validateHandlers([]string{handlerLikes, handlerFollows, handlerPosts}); err != nil {
+		t.Errorf("expected every handler valid, got %v", err)
+	}
+	for _, names := range [][]string{nil, {"reposts"}, {handlerLikes, handlerLikes}} {
+		if err := validateHandlers(names); err == nil {
+			t.Errorf("%v: expected an error", names)
+		}
+	}
+}
+
+// postEvent returns a post create by did at timeUs, replying to parent if set
+func postEvent(did, rkey, parent string, timeUs int64) common.JetstreamMessage {
+	reply := ""
+	if parent != "" {
+		reply = fmt.Sprintf(`,"reply":{"root":{"uri":%q},"parent":{"uri":%q}}`, parent, parent)
+	}
+	raw := fmt.Sprintf(`{"did":%q,"time_us":%d,"kind":"commit","commit":{"operation":"create","collection":"app.bsky.feed.post","rkey":%q,"record":{"text":"hi","createdAt":"2026-06-03T10:00:00Z"%s}}}`, did, timeUs, rkey, reply)
+	return common.NewJetstreamMessage(raw, common.NewLogger(false))
+}
+
+func TestPostHandler_IndexesOriginalPosts(t *testing.T) {
+	lanes := newBatchLanes(4)
+	summary := &ingestSummary{}
+	env := &handlerEnv{ctx: context.Background(), lanes: lanes, cursor: newCursorTracker(), summary: summary, logger: common.NewLogger(false)}
+	posts := newPostHandler(env, common.BatchConfig{MaxDocs: 2, MaxAge: time.Hour})
+
+	if handled, ok := posts.handle(postEvent("did:plc:a", "1", "at://did:plc:b/app.bsky.feed.post/1", 100), 10); !handled || !ok || summary.skipped != 1 {
+		t.Fatalf("expected a reply skipped, got %+v", summary)
+	}
+	for i, msg := range []common.JetstreamMessage{postEvent("did:plc:a", "2", "", 1764183883593200), postEvent("did:plc:a", "3", "", 1764183883593300)} {
+		if handled, ok := posts.handle(msg, 10); !handled || !ok {
+			t.Fatalf("post %d: expected it handled", i)
+		}
+	}
+	job, ok := lanes.next()
+	if !ok || len(job.postBatch) != 2 || job.handler != handlerPosts {
+		t.Fatalf("expected a full batch of posts sent, got %+v", job)
+	}
+	if post := job.postBatch[0]; post.Source != common.PostSourceJetstream || post.Version != 1764183883593200-(1<<32) || post.AtURI != "at://did:plc:a/app.bsky.feed.post/2" {
+		t.Errorf("unexpected fallback post %+v", post)
+	}
+
+	// Spooled posts keep the versions that let megastream replace them
+	spilled := spillJob(job).job()
+	if len(spilled.postBatch) != 2 || spilled.postBatch[1].Version != 1764183883593300-(1<<32) {
+		t.Errorf("expected spooled post versions kept, got %+v", spilled.postBatch)
+	}
+	lanes.done(job)
+
+	deleted := common.NewJetstreamMessage(`{"did":"did:plc:a","time_us":400,"kind":"commit","commit":{"operation":"delete","collection":"app.bsky.feed.post","rkey":"2"}}`, common.NewLogger(false))
+	if handled, ok := posts.handle(deleted, 10); !handled || !ok || !posts.hasDeletes() {
+		t.Fatal("expected the post delete batched")
+	}
+	posts.flushDeletes(time.Second)
+	if job, _ := lanes.next(); len(job.postDeleteBatch) != 1 || job.postDeleteBatch[0].DocID != "at://did:plc:a/app.bsky.feed.post/2" {
+		t.Errorf("expected the post delete sent, got %+v", job)
+	}
+}
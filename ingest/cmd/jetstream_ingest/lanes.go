@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// batchLanes queues batch jobs for the Elasticsearch workers in two lanes.
+// Deletion jobs (like and follow deletes with their tombstones, and post
+// deletes) go in the priority lane, which workers always drain first, so
+// removals are not kept waiting behind a backlog of creates.
+//
+// A delete must still not overtake the create of the same document, or the
+// create would land afterwards and bring the document back. The lanes track
+// the at_uris of creates that are queued or being written; the batcher holds
+// back deletes of those documents until their creates are done (see hold).
+type batchLanes struct {
+	priority chan batchJob
+	normal   chan batchJob
+
+	mu       sync.Mutex
+	creating map[string]int // at_uri -> queued or running create jobs holding it
+}
+
+// newBatchLanes returns lanes that each queue up to size jobs
+func newBatchLanes(size int) *batchLanes {
+	return &batchLanes{
+		priority: make(chan batchJob, size),
+		normal:   make(chan batchJob, size),
+		creating: make(map[string]int),
+	}
+}
+
+// isDeleteJob reports whether job belongs in the priority lane
+func isDeleteJob(job batchJob) bool {
+	return len(job.deleteBatch) > 0 || len(job.followDeleteBatch) > 0 || len(job.postDeleteBatch) > 0
+}
+
+// createURIs returns the at_uris of the documents job creates
+func createURIs(job batchJob) []string {
+	uris := make([]string, 0, len(job.batch)+len(job.followBatch)+len(job.postBatch))
+	for _, like := range job.batch {
+		uris = append(uris, like.AtURI)
+	}
+	for _, follow := range job.followBatch {
+		uris = append(uris, follow.AtURI)
+	}
+	for _, post := range job.postBatch {
+		uris = append(uris, post.AtURI)
+	}
+	return uris
+}
+
+// send queues job in its lane, waiting until there is room, and reports
+// whether it was queued before ctx was done
+func (l *batchLanes) send(ctx context.Context, job batchJob) bool {
+	lane := l.normal
+	if isDeleteJob(job) {
+		lane = l.priority
+	}
+
+	uris := createURIs(job)
+	l.mu.Lock()
+	for _, uri := range uris {
+		l.creating[uri]++
+	}
+	l.mu.Unlock()
+
+	select {
+	case lane <- job:
+		return true
+	case <-ctx.Done():
+		l.done(job)
+		return false
+	}
+}
+
+// sendTimeout is send giving up after timeout, for use once ctx is done
+func (l *batchLanes) sendTimeout(job batchJob, timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return l.send(ctx, job)
+}
+
+// done marks job's creates as written, whether or not they succeeded
+func (l *batchLanes) done(job batchJob) {
+	uris := createURIs(job)
+	if len(uris) == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, uri := range uris {
+		if l.creating[uri]--; l.creating[uri] <= 0 {
+			delete(l.creating, uri)
+		}
+	}
+}
+
+// hold splits deletes into those that can be written now and those whose
+// documents still have a create queued or being written, which are held
+// until a later call finds them ready
+func (l *batchLanes) hold(deletes []common.JetstreamMessage) (ready, held []common.JetstreamMessage) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, msg := range deletes {
+		if l.creating[msg.GetAtURI()] > 0 {
+			held = append(held, msg)
+		} else {
+			ready = append(ready, msg)
+		}
+	}
+	return ready, held
+}
+
+// awaitCreates waits up to timeout for every queued or running create to be
+// written, and reports whether they were
+func (l *batchLanes) awaitCreates(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		l.mu.Lock()
+		idle := len(l.creating) == 0
+		l.mu.Unlock()
+		if idle {
+			return true
+		}
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// awaitDeletes waits up to timeout until no create of a document job deletes
+// is queued or being written, and reports whether none is
+func (l *batchLanes) awaitDeletes(job batchJob, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		l.mu.Lock()
+		pending := false
+		for _, batch := range [][]common.DeleteDoc{job.deleteBatch, job.followDeleteBatch} {
+			for _, doc := range batch {
+				pending = pending || l.creating[doc.DocID] > 0
+			}
+		}
+		l.mu.Unlock()
+		if !pending {
+			return true
+		}
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// awaitAuthor waits up to timeout until no create of a document by did is
+// queued or being written, and reports whether none is
+func (l *batchLanes) awaitAuthor(did string, timeout time.Duration) bool {
+	prefix := "at://" + did + "/"
+	deadline := time.Now().Add(timeout)
+	for {
+		l.mu.Lock()
+		pending := false
+		for uri := range l.creating {
+			if strings.HasPrefix(uri, prefix) {
+				pending = true
+				break
+			}
+		}
+		l.mu.Unlock()
+		if !pending {
+			return true
+		}
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// next returns the next job for a worker, from the priority lane if it has
+// one, or false once both lanes are closed and drained
+func (l *batchLanes) next() (batchJob, bool) {
+	priority, normal := l.priority, l.normal
+	for priority != nil || normal != nil {
+		if priority != nil {
+			select {
+			case job, ok := <-priority:
+				if ok {
+					return job, true
+				}
+				priority = nil
+				continue
+			default:
+			}
+		}
+
+		select {
+		case job, ok := <-priority:
+			if ok {
+				return job, true
+			}
+			priority = nil
+		case job, ok := <-normal:
+			if ok {
+				return job, true
+			}
+			normal = nil
+		}
+	}
+	return batchJob{}, false
+}
+
+// close stops the lanes taking jobs; workers drain what is queued
+func (l *batchLanes) close() {
+	close(l.priority)
+	close(l.normal)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func TestBatchLanes_DeletesFirst(t *testing.T) {
+	lanes := newBatchLanes(4)
+	ctx := context.Background()
+	create := newLikeJob([]common.LikeDoc{{AtURI: "at://did:plc:a/app.bsky.feed.like/1"}}, 1, 0)
+	unlike := batchJob{deleteBatch: []common.DeleteDoc{{DocID: "at://did:plc:a/app.bsky.feed.like/2"}}, timeUs: 2}
+	unfollow := batchJob{followDeleteBatch: []common.DeleteDoc{{DocID: "at://did:plc:a/app.bsky.graph.follow/1"}}, timeUs: 3}
+	for _, job := range []batchJob{create, unlike, unfollow} {
+		if !lanes.send(ctx, job) {
+			t.Fatal("expected the job to be queued")
+		}
+	}
+	lanes.close()
+
+	var order []int64
+	for {
+		job, ok := lanes.next()
+		if !ok {
+			break
+		}
+		order = append(order, job.timeUs)
+	}
+	if len(order) != 3 || order[0] != 2 || order[1] != 3 || order[2] != 1 {
+		t.Errorf("expected deletes ahead of creates, got %v", order)
+	}
+}
+
+func TestBatchLanes_HoldsDeletesBehindCreates(t *testing.T) {
+	lanes := newBatchLanes(4)
+	liked := "at://did:plc:a/app.bsky.feed.like/1"
+	create := newLikeJob([]common.LikeDoc{{AtURI: liked}}, 1, 0)
+	if !lanes.send(context.Background(), create) {
+		t.Fatal("expected the job to be queued")
+	}
+
+	deletes := []common.JetstreamMessage{
+		common.NewJetstreamMessage(`{"did":"did:plc:a","time_us":2,"kind":"commit","commit":{"operation":"delete","collection":"app.bsky.feed.like","rkey":"1"}}`, common.NewLogger(false)),
+		common.NewJetstreamMessage(`{"did":"did:plc:a","time_us":3,"kind":"commit","commit":{"operation":"delete","collection":"app.bsky.feed.like","rkey":"2"}}`, common.NewLogger(false)),
+	}
+	ready, held := lanes.hold(deletes)
+	if len(ready) != 1 || len(held) != 1 || held[0].GetAtURI() != liked {
+		t.Fatalf("expected the delete of the queued like held, got ready %d held %d", len(ready), len(held))
+	}
+
+	job, _ := lanes.next()
+	lanes.done(job)
+	if ready, held := lanes.hold(held); len(ready) != 1 || len(held) != 0 {
+		t.Errorf("expected the delete released once its create was written, got ready %d held %d", len(ready), len(held))
+	}
+	if !lanes.awaitCreates(0) {
+		t.Error("expected no creates outstanding")
+	}
+}
+
+func TestBatchLanes_SendCancelled(t *testing.T) {
+	lanes := newBatchLanes(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if lanes.send(ctx, newLikeJob([]common.LikeDoc{{AtURI: "at://did:plc:a/app.bsky.feed.like/1"}}, 1, 0)) {
+		t.Fatal("expected a cancelled send to fail")
+	}
+	if !lanes.awaitCreates(0) {
+		t.Error("expected a cancelled create not to hold deletes")
+	}
+}
+
+func TestBatchLanes_ReplayedDeletesWaitForCreates(t *testing.T) {
+	lanes := newBatchLanes(4)
+	liked := "at://did:plc:a/app.bsky.feed.like/1"
+	if !lanes.send(context.Background(), newLikeJob([]common.LikeDoc{{AtURI: liked}}, 1, 0)) {
+		t.Fatal("expected the job to be queued")
+	}
+
+	// A delete replayed from the spill round-trips through its spooled form
+	unlike := spilledJob{LikeDeletes: []common.DeleteDoc{{DocID: liked}}, TimeUs: 2}.job()
+	if spillJob(unlike).empty() {
+		t.Fatal("expected the spooled delete kept")
+	}
+	if lanes.awaitDeletes(unlike, 0) {
+		t.Fatal("expected the replayed delete to wait for its queued create")
+	}
+
+	job, _ := lanes.next()
+	lanes.done(job)
+	if !lanes.awaitDeletes(unlike, 0) {
+		t.Error("expected the replayed delete released once its create was written")
+	}
+}
+
+func TestBatchLanes_AwaitAuthor(t *testing.T) {
+	lanes := newBatchLanes(4)
+	if !lanes.send(context.Background(), newLikeJob([]common.LikeDoc{{AtURI: "at://did:plc:a/app.bsky.feed.like/1"}}, 1, 0)) {
+		t.Fatal("expected the job to be queued")
+	}
+
+	if !lanes.awaitAuthor("did:plc:b", 0) {
+		t.Error("expected no creates outstanding for another author")
+	}
+	if lanes.awaitAuthor("did:plc:a", 0) {
+		t.Fatal("expected the author's queued like to be waited for")
+	}
+
+	job, _ := lanes.next()
+	lanes.done(job)
+	if !lanes.awaitAuthor("did:plc:a", 0) {
+		t.Error("expected the author released once the like was written")
+	}
+}
+
+// BenchmarkBatchLanes measures lane throughput with the workers
+// jetstream_ingest runs: each job is a batch of likes sent, taken, and done
+func BenchmarkBatchLanes(b *testing.B) {
+	const workers = 4
+	lanes := newBatchLanes(workers * 2)
+	batches := make([][]common.LikeDoc, 64)
+	for i := range batches {
+		batches[i] = make([]common.LikeDoc, 100)
+		for j := range batches[i] {
+			batches[i][j] = common.LikeDoc{AtURI: fmt.Sprintf("at://did:plc:a/app.bsky.feed.like/%d-%d", i, j)}
+		}
+	}
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				job, ok := lanes.next()
+				if !ok {
+					return
+				}
+				lanes.done(job)
+			}
+		}()
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		lanes.send(ctx, newLikeJob(batches[i%len(batches)], int64(i), 0))
+	}
+	lanes.close()
+	wg.Wait()
+}
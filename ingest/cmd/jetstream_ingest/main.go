@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
 	"sync"
 	"syscall"
@@ -14,6 +15,7 @@ import (
 
 	"cloud.google.com/go/storage"
 	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/account_deletion"
 	"github.com/greenearth/ingest/internal/common"
 	"github.com/greenearth/ingest/internal/jetstream_ingest"
 )
@@ -26,20 +28,47 @@ type batchJob struct {
 	batchCount     int
 	tombstoneCount int
 	skipCount      int
+
+	// Follow graph writes travel in their own jobs alongside likes
+	followBatch          []common.FollowDoc
+	followTombstoneBatch []common.FollowTombstoneDoc
+	followDeleteBatch    []common.DeleteDoc
+
+	// Fallback posts, and deletes of them (see newPostHandler)
+	postBatch       []common.PostDoc
+	postDeleteBatch []common.DeleteDoc
+
+	// done, if set, is called once the job is written or spooled; replayed
+	// jobs use it to release their spool file (see common.Spill.Replay)
+	done func()
+
+	// handler is the record handler that sent the job, and eventTimes the
+	// times of the events in it, which hold back the cursor until the job
+	// is written (see cursorTracker). Replayed jobs have neither.
+	handler    string
+	eventTimes []int64
 }
 
 func main() {
 	// Parse command line flags
 	dryRun := flag.Bool("dry-run", false, "Run in dry-run mode (no writes to Elasticsearch)")
+	createOnly := flag.Bool("create-only", false, "Index with op_type=create so documents already indexed are skipped, not overwritten (for replays and backfills)")
 	skipTLSVerify := flag.Bool("skip-tls-verify", false, "Skip TLS certificate verification (use for local development only)")
 	noRewind := flag.Bool("no-rewind", false, "Do not rewind to last processed timestamp on startup (drops intervening data)")
 	maxRewindMinutes := flag.Int("max-rewind", 0, "Maximum number of minutes to rewind cursor on startup (0 = unlimited)")
 	debug := flag.Bool("debug", false, "Enable debug logging")
+	wantedCollections := flag.String("wanted-collections", "", "Comma-separated collections to subscribe to (overrides GE_JETSTREAM_WANTED_COLLECTIONS)")
+	wantedDIDs := flag.String("wanted-dids", "", "Comma-separated DIDs to subscribe to (overrides GE_JETSTREAM_WANTED_DIDS)")
+	handlers := flag.String("handlers", "", "Comma-separated record handlers to run off the one connection: likes, follows, posts (overrides GE_JETSTREAM_HANDLERS)")
+	soak := flag.Duration("soak", 0, "Ingest a synthetic firehose for this long instead of Jetstream, then check the run and exit (see README)")
+	soakRate := flag.Int("soak-rate", 200, "Events per second the soak firehose emits")
+	soakMaxHeapGrowth := flag.Float64("soak-max-heap-growth", 0.25, "Fraction the live heap may grow over a soak run")
 	flag.Parse()
 
 	// Load configuration
 	config := common.LoadConfig()
 	logger := common.NewLogger(config.LoggingEnabled)
+	logger.SetService("jetstream_ingest")
 	logger.SetDebugEnabled(*debug)
 	otelCollector, err := common.NewOTelMetricCollector("jetstream-ingest", config.Environment, config.GCPProjectID, config.GCPRegion, config.MetricExportIntervalSec)
 	if err != nil {
@@ -52,17 +81,31 @@ func main() {
 			}
 		}()
 	}
+	tracerProvider, err := common.NewTracerProvider(context.Background(), "jetstream-ingest", config)
+	if err != nil {
+		logger.Error("Failed to create tracer provider: %v (continuing without tracing)", err)
+	} else if tracerProvider != nil {
+		defer func() {
+			if err := tracerProvider.Shutdown(context.Background()); err != nil {
+				logger.Error("Failed to shutdown tracer provider: %v", err)
+			}
+		}()
+	}
 
 	logger.Info("Green Earth Ingex - BlueSky Jetstream Ingest Service")
 	if *dryRun {
 		logger.Info("Running in DRY-RUN mode - no writes to Elasticsearch")
 	}
+	logger.SetCreateOnly(*createOnly)
+	if *createOnly {
+		logger.Info("Create-only mode - documents already indexed are skipped, not overwritten")
+	}
 	if *noRewind {
 		logger.Info("Rewind disabled - starting from current time")
 	}
 
 	// Validate configuration
-	if config.JetstreamURL == "" {
+	if config.JetstreamURL == "" && *soak == 0 {
 		logger.Error("GE_JETSTREAM_URL environment variable is required")
 		os.Exit(1)
 	}
@@ -72,7 +115,8 @@ func main() {
 		os.Exit(1)
 	}
 
-	if !*dryRun && config.ElasticsearchAPIKey == "" {
+	// A soak run's Elasticsearch is a local container without security
+	if !*dryRun && *soak == 0 && config.ElasticsearchAPIKey == "" {
 		logger.Error("GE_ELASTICSEARCH_API_KEY environment variable is required")
 		os.Exit(1)
 	}
@@ -87,6 +131,7 @@ func main() {
 		logger.Error("Failed to create health check server: %v", err)
 		os.Exit(1)
 	}
+	healthServer.SetMaxLag(config.MaxIngestLag)
 	go func() {
 		if err := healthServer.Start(ctx); err != nil {
 			logger.Error("Health server failed: %v", err)
@@ -94,6 +139,17 @@ func main() {
 		}
 	}()
 
+	// Track ingest SLOs from the metrics above; the report is served at /slo
+	sloTracker, err := common.NewSLOTracker(ctx, "jetstream_ingest", common.SLOConfigFromConfig(config), logger)
+	if err != nil {
+		logger.Error("Failed to initialize SLO tracker: %v", err)
+		os.Exit(1)
+	}
+	defer func() { _ = sloTracker.Close() }()
+	sloTracker.Attach(logger)
+	healthServer.Handle("/slo", sloTracker)
+	go sloTracker.Run(ctx, time.Minute)
+
 	// Handle signals for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -103,13 +159,85 @@ func main() {
 		cancel()
 	}()
 
-	logger.Info("Starting Jetstream likes ingestion")
-	runIngestion(ctx, config, logger, healthServer, *dryRun, *skipTLSVerify, *noRewind, *maxRewindMinutes)
+	if *handlers != "" {
+		config.JetstreamHandlers = *handlers
+	}
+	if err := validateHandlers(splitList(config.JetstreamHandlers)); err != nil {
+		logger.Error("Invalid --handlers: %v", err)
+		os.Exit(1)
+	}
+
+	shard := shardFromConfig(config)
+	if err := shard.validate(); err != nil {
+		logger.Error("Invalid shard: %v", err)
+		os.Exit(1)
+	}
+
+	if *soak > 0 {
+		if !runSoak(ctx, config, logger, healthServer, *soak, *soakRate, *soakMaxHeapGrowth, *dryRun, *skipTLSVerify) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Jetstream filters the stream server-side, so records that are not
+	// indexed are never sent
+	if *wantedCollections != "" {
+		config.JetstreamWantedCollections = *wantedCollections
+	}
+	if *wantedDIDs != "" {
+		config.JetstreamWantedDIDs = *wantedDIDs
+	}
+	collections, dids := splitList(config.JetstreamWantedCollections), splitList(config.JetstreamWantedDIDs)
+	// The posts handler needs posts, which the default collections leave out
+	if len(collections) > 0 && slices.Contains(splitList(config.JetstreamHandlers), handlerPosts) && !slices.Contains(collections, postCollection) {
+		collections = append(collections, postCollection)
+	}
+	jetstreamURL, err := jetstream_ingest.SubscribeURL(config.JetstreamURL, collections, dids)
+	if err != nil {
+		logger.Error("Invalid Jetstream subscription: %v", err)
+		os.Exit(1)
+	}
+	if len(collections) > 0 {
+		logger.Info("Subscribing to collections: %s", strings.Join(collections, ", "))
+	}
+	if len(dids) > 0 {
+		logger.Info("Subscribing to the records of %d DIDs", len(dids))
+	}
+
+	// Each shard resumes from its own cursor
+	if shard.sharded() {
+		config.JetstreamStateFile = shard.stateFile(config.JetstreamStateFile)
+		logger.Info("Ingesting shard %s of author DIDs, with state in %s", shard, config.JetstreamStateFile)
+	}
+
+	logger.Info("Starting Jetstream ingestion with handlers: %s", strings.Join(splitList(config.JetstreamHandlers), ", "))
+	client := jetstream_ingest.NewClient(jetstreamURL, logger)
+	runIngestion(ctx, config, logger, healthServer, client, *dryRun, *skipTLSVerify, *noRewind, *maxRewindMinutes)
+}
+
+// eventSource is where events are read from: Jetstream, or a soak run's
+// synthetic firehose
+type eventSource interface {
+	SetCursor(timeUs int64)
+	UpdateCursor(timeUs int64)
+	Start(ctx context.Context) error
+	GetMessageChannel() <-chan string
+	Close() error
+}
+
+// ingestSummary counts what runIngestion did with the events it received
+type ingestSummary struct {
+	received  int
+	processed int
+	deleted   int
+	skipped   int
 }
 
-// checkForNewerInstance checks if another instance has started after us
-// Returns true if a newer instance is detected
-func runIngestion(ctx context.Context, config *common.Config, logger *common.IngestLogger, healthServer *common.HealthServer, dryRun, skipTLSVerify, noRewind bool, maxRewindMinutes int) {
+// runIngestion ingests events from client until it closes or ctx is
+// cancelled. The cursor of the last batch written is persisted before it
+// returns.
+func runIngestion(ctx context.Context, config *common.Config, logger *common.IngestLogger, healthServer *common.HealthServer, client eventSource, dryRun, skipTLSVerify, noRewind bool, maxRewindMinutes int) ingestSummary {
 	stateManager, err := common.NewStateManager(config.JetstreamStateFile, logger)
 	if err != nil {
 		logger.Error("Failed to initialize state manager: %v", err)
@@ -137,58 +265,91 @@ func runIngestion(ctx context.Context, config *common.Config, logger *common.Ing
 		logger.Error("%v", err)
 		os.Exit(1)
 	}
+	common.CheckAPIKeyPrivileges(ctx, esClient, "jetstream_ingest", config, logger)
+	common.MonitorClockSkew(ctx, esClient, config, logger)
+	handlerNames := splitList(config.JetstreamHandlers)
+	handledIndices := make([]string, len(handlerNames))
+	for i, name := range handlerNames {
+		handledIndices[i] = handlerIndices[name]
+	}
+	common.CheckRouting(ctx, esClient, handledIndices, logger)
+
+	deadLetters, err := common.NewDeadLetterQueue(ctx, config.DLQDestination, "jetstream_ingest")
+	if err != nil {
+		logger.Error("Failed to initialize dead-letter queue: %v", err)
+		os.Exit(1)
+	}
+	defer func() { _ = deadLetters.Close() }()
+	logger.SetDeadLetterQueue(deadLetters)
 
-	// Ensure period-based indices exist and are the write target for likes,
-	// like_tombstones, and posts. Jetstream updates post like counts through the
-	// posts alias, so posts must always have a write index as well. Runs at
-	// startup and every minute so that period rollovers
-	// are detected promptly without waiting for the next batch flush.
+	malformed, err := common.NewMalformedRows(common.StrictnessConfigFromConfig(config), "jetstream", logger)
+	if err != nil {
+		logger.Error("%v", err)
+		os.Exit(1)
+	}
+	logger.Info("Malformed events: %s", malformed.Mode())
+
+	denyList, err := common.NewDenyList(ctx, config.DenyListSource, esClient, logger)
+	if err != nil {
+		logger.Error("Failed to load deny list: %v", err)
+		os.Exit(1)
+	}
+	go denyList.Run(ctx, config.DenyListReloadInterval)
+
+	// Replicas sharing the stream each ingest their authors' events
+	shard := shardFromConfig(config)
+
+	var changeFeed *common.ChangeFeed
 	if !dryRun {
-		ensureIndices := func() error {
-			indexCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			defer cancel()
-			for _, alias := range []string{"likes", "like_tombstones", "posts", "replies"} {
-				name := common.CurrentIndexName(alias, config.IndexPeriod)
-				if err := common.EnsureIndex(indexCtx, esClient, name, alias, logger); err != nil {
-					return fmt.Errorf("failed to ensure index for %s: %w", alias, err)
-				}
-			}
-			return nil
+		changeFeed, err = common.NewPubSubChangeFeed(ctx, config.GCPProjectID, config.ChangeFeedTopic, config.ChangeFeedEncoding, logger)
+		if err != nil {
+			logger.Error("Failed to initialize change feed: %v", err)
+			os.Exit(1)
 		}
+	}
 
-		{
-			backoff := time.Second
-			for {
-				if err := ensureIndices(); err == nil {
-					break
-				} else {
-					logger.Error("ensureIndices failed (retrying in %v): %v", backoff, err)
-				}
-				select {
-				case <-time.After(backoff):
-				case <-ctx.Done():
-					return
-				}
-				if backoff < 60*time.Second {
-					backoff *= 2
-				}
-			}
+	// Ensure the current indices exist and are the write target for
+	// like_tombstones, follow_tombstones, and posts. Follows themselves live in
+	// a persistent index created at deploy time. Jetstream updates post like
+	// counts through the posts write alias, so posts must always have a write
+	// index as well. Runs at startup and every minute so that period changes
+	// and rollovers are picked up without waiting for the next batch flush.
+	// Likes are not rotated: the likes router writes each one to its
+	// created_at bucket's index.
+	var likesRouter *common.IndexRouter
+	if !dryRun {
+		indexProfile, err := common.IndexProfileFromConfig(config)
+		if err != nil {
+			logger.Error("Invalid index configuration: %v", err)
+			os.Exit(1)
+		}
+		likesRouter, err = common.NewIndexRouter(esClient, indexProfile, "likes", common.IndexRouterConfigFromConfig(config), logger)
+		if err != nil {
+			logger.Error("Invalid likes index configuration: %v", err)
+			os.Exit(1)
 		}
+		indexManager := common.NewIndexManager(esClient, indexProfile, []string{"like_tombstones", "follow_tombstones", "posts", "replies"}, logger)
 
-		go func() {
-			ticker := time.NewTicker(time.Minute)
-			defer ticker.Stop()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case <-ticker.C:
-					if err := ensureIndices(); err != nil {
-						logger.Error("%v", err)
-					}
-				}
+		backoff := time.Second
+		for {
+			indexCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			err := indexManager.EnsureCurrent(indexCtx)
+			cancel()
+			if err == nil {
+				break
 			}
-		}()
+			logger.Error("ensureIndices failed (retrying in %v): %v", backoff, err)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ingestSummary{}
+			}
+			if backoff < 60*time.Second {
+				backoff *= 2
+			}
+		}
+
+		go indexManager.Maintain(ctx, time.Minute)
 	}
 
 	// Initialize and start rate limiter
@@ -198,6 +359,13 @@ func runIngestion(ctx context.Context, config *common.Config, logger *common.Ing
 	rateLimiter := jetstream_ingest.NewRateLimiter(windowDur, blockDur, threshold)
 	rateLimiter.Start(ctx)
 
+	// Likes replayed after a rewind or reconnect are skipped while their
+	// at_uris are remembered
+	likeDedup := jetstream_ingest.NewDedupCache(config.LikeDedupCacheSize)
+	if likeDedup != nil {
+		go reportDedupHitRate(ctx, likeDedup, logger)
+	}
+
 	// Start blocklist persistence goroutine (writes to GCS periodically)
 	if !dryRun && config.BlocklistDestination != "" {
 		gcsClient, err := storage.NewClient(ctx)
@@ -276,17 +444,14 @@ func runIngestion(ctx context.Context, config *common.Config, logger *common.Ing
 		}
 	}
 
-	// Initialize Jetstream client
-	client := jetstream_ingest.NewClient(config.JetstreamURL, logger)
-
 	// Apply cursor if rewind is enabled and we have a saved cursor
 	if !noRewind {
 		if cursor := stateManager.GetCursor(); cursor != nil {
-			cursorTime := cursor.LastTimeUs
+			cursorTime := common.ClampFutureCursor(cursor.LastTimeUs, logger)
 
 			// Apply max-rewind limit if specified
 			if maxRewindMinutes > 0 {
-				currentTime := time.Now().UnixMicro()
+				currentTime := common.CorrectedNow().UnixMicro()
 				maxRewindUs := int64(maxRewindMinutes) * 60 * 1000000 // Convert minutes to microseconds
 				minAllowedTime := currentTime - maxRewindUs
 
@@ -298,6 +463,9 @@ func runIngestion(ctx context.Context, config *common.Config, logger *common.Ing
 
 			client.SetCursor(cursorTime)
 			logger.Info("Rewinding to last processed timestamp: %d", cursorTime)
+			if !dryRun {
+				warmDedupCache(ctx, esClient, likeDedup, cursorTime, config.LikeDedupCacheSize, logger)
+			}
 		}
 	}
 
@@ -314,60 +482,156 @@ func runIngestion(ctx context.Context, config *common.Config, logger *common.Ing
 	// Mark service as healthy once we've successfully connected and started processing
 	healthServer.SetHealthy(true, "Processing Jetstream messages")
 
-	// Process messages from Jetstream with parallel workers
+	// Process messages from Jetstream with parallel workers. Canary likes, if
+	// enabled, are injected here so they take the same path as real events.
 	msgChan := client.GetMessageChannel()
+	if config.CanaryInterval > 0 && !dryRun {
+		canary := common.NewCanary(esClient, common.CanaryConfig{
+			Interval:  config.CanaryInterval,
+			SearchSLO: config.CanarySearchSLO,
+		}, logger)
+		msgChan = canary.Inject(ctx, msgChan)
+		logger.Info("Injecting a canary like every %s (search SLO %s)", config.CanaryInterval, config.CanarySearchSLO)
+	}
+
+	// Create lanes for batches to be processed by workers: deletes in a
+	// priority lane ahead of creates. Each can queue 50 batches.
+	lanes := newBatchLanes(50)
+
+	// Job writes that fail while Elasticsearch is unavailable are spooled to
+	// local disk and replayed into the lanes once it recovers
+	var spill *common.Spill[spilledJob]
+	if !dryRun {
+		spill, err = common.NewSpill[spilledJob](common.SpillConfigFromConfig(config), "jetstream", logger)
+		if err != nil {
+			logger.Error("Failed to initialize spill: %v", err)
+			os.Exit(1)
+		}
+	}
+	replayCtx, stopReplay := context.WithCancel(ctx)
+	replayDone := make(chan struct{})
+	go func() {
+		defer close(replayDone)
+		spill.Run(replayCtx, clusterAvailable(esClient), func(spilled spilledJob, done func()) bool {
+			job := spilled.job()
+			job.done = done
+			// Spooled deletes, unlike live ones, are not held behind their
+			// creates, which may be replaying in the other lane
+			if isDeleteJob(job) && !lanes.awaitDeletes(job, time.Minute) {
+				logger.Error("Timeout waiting for creates before a replayed delete batch")
+			}
+			return lanes.send(replayCtx, job)
+		})
+	}()
 
-	// Create a channel for batches to be processed by workers
-	// Can queue 50k docs (50 batches of 1000)
-	batchChan := make(chan batchJob, 50)
+	// Like count changes are aggregated across batches per post and applied
+	// by one goroutine; the final changes are flushed after the workers stop
+	postCounts := common.NewPostCounter(esClient, common.PostCountConfigFromConfig(config), dryRun, logger)
+	postCountCtx, stopPostCounts := context.WithCancel(ctx)
+	postCountsDone := make(chan struct{})
+	go func() {
+		defer close(postCountsDone)
+		postCounts.Run(postCountCtx)
+	}()
 
-	// Track pending cursor updates to throttle state writes
+	// Account status changes are upserted into the accounts index by one
+	// goroutine; the last ones are flushed at shutdown
+	accountStatuses := common.NewAccountStatusWriter(esClient, common.AccountsIndex, 0, dryRun, logger)
+	accountStatusCtx, stopAccountStatuses := context.WithCancel(ctx)
+	accountStatusesDone := make(chan struct{})
+	go func() {
+		defer close(accountStatusesDone)
+		accountStatuses.Run(accountStatusCtx)
+	}()
+
+	// Blocks are written to the blocks index the same way, for the
+	// recommender to hide blocked accounts from each other
+	blocks := common.NewBlockWriter(esClient, common.BlocksIndex, 0, dryRun, logger)
+	blockCtx, stopBlocks := context.WithCancel(ctx)
+	blocksDone := make(chan struct{})
+	go func() {
+		defer close(blocksDone)
+		blocks.Run(blockCtx)
+	}()
+
+	// Likes of deleted accounts are purged off the main loop. megastream_ingest
+	// purges the same accounts' posts and likes; whichever service gets there
+	// first does the work.
+	accounts := account_deletion.NewService(esClient, account_deletion.Config{
+		StateFile:    account_deletion.StateFileFor(config.JetstreamStateFile),
+		MetricPrefix: "jetstream",
+		PostCounts:   postCounts,
+		ChangeFeed:   changeFeed,
+		DryRun:       dryRun,
+		BeforeDelete: func(did string) {
+			// The account's last likes may still be queued or being written;
+			// a like indexed after the deletion would outlive the account
+			if !lanes.awaitAuthor(did, 30*time.Second) {
+				logger.Error("Timeout waiting for likes by %s before deleting the account", did)
+			}
+		},
+	}, logger)
+	if err := accounts.Start(); err != nil {
+		logger.Error("Failed to resume account deletions: %v", err)
+		os.Exit(1)
+	}
+
+	// The cursor is where every handler's events have been written up to
+	// (see cursorTracker). Batch stats are gathered for throttled logging.
+	cursor := newCursorTracker()
+	cursorWrites := common.NewCursorThrottle(common.CursorWritePolicyFromConfig(config, 10*time.Second), logger)
 	var cursorMu sync.Mutex
-	var pendingCursor int64
-	var hasPendingUpdate bool
+	var persistedCursor int64
 	var pendingBatchCount int
 	var pendingSkipCount int
+	persistCursor := func(force bool) {
+		cursorMu.Lock()
+		defer cursorMu.Unlock()
+		now := time.Now()
+		if !force && !cursorWrites.Due(now) {
+			return
+		}
+		current, holder := cursor.cursor()
+		if current <= persistedCursor {
+			return
+		}
+		if err := stateManager.UpdateCursor(current); err != nil {
+			logger.Error("Failed to update cursor: %v", err)
+			return
+		}
+		persistedCursor = current
+		cursorWrites.Written(current, now)
+		// Keep the client's reconnection cursor in sync so that WebSocket
+		// reconnects resume from the latest written position rather than
+		// replaying from the startup cursor.
+		client.UpdateCursor(current)
+		if holder != "" {
+			logger.Debug("Cursor held back by the %s handler", holder)
+		}
+		// Log summary of batches processed since last log
+		if pendingBatchCount > 0 {
+			freshnessSeconds := common.CalculateFreshness(current)
+			logger.Debug("Indexed %d likes (skipped: %d, freshness: %ds)", pendingBatchCount, pendingSkipCount, freshnessSeconds)
+			pendingBatchCount = 0
+			pendingSkipCount = 0
+		}
+	}
 
-	// Start throttled state writer (writes at most once every 10 seconds)
+	// Start throttled state writer (see common.CursorWritePolicy)
 	if !dryRun {
+		logger.Info("Writing the cursor %s", cursorWrites.Policy())
 		go func() {
-			ticker := time.NewTicker(10 * time.Second)
+			ticker := time.NewTicker(cursorWrites.Policy().TickInterval())
 			defer ticker.Stop()
 
 			for {
 				select {
 				case <-ctx.Done():
 					// Flush any pending update before exiting
-					cursorMu.Lock()
-					if hasPendingUpdate {
-						if err := stateManager.UpdateCursor(pendingCursor); err != nil {
-							logger.Error("Failed to flush final cursor update: %v", err)
-						}
-						client.UpdateCursor(pendingCursor)
-					}
-					cursorMu.Unlock()
+					persistCursor(true)
 					return
 				case <-ticker.C:
-					cursorMu.Lock()
-					if hasPendingUpdate {
-						if err := stateManager.UpdateCursor(pendingCursor); err != nil {
-							logger.Error("Failed to update cursor: %v", err)
-						} else {
-							hasPendingUpdate = false
-							// Keep the client's reconnection cursor in sync so that
-							// WebSocket reconnects resume from the latest processed
-							// position rather than replaying from the startup cursor.
-							client.UpdateCursor(pendingCursor)
-							// Log summary of batches processed since last log
-							if pendingBatchCount > 0 {
-								freshnessSeconds := common.CalculateFreshness(pendingCursor)
-								logger.Debug("Indexed %d likes (skipped: %d, freshness: %ds)", pendingBatchCount, pendingSkipCount, freshnessSeconds)
-								pendingBatchCount = 0
-								pendingSkipCount = 0
-							}
-						}
-					}
-					cursorMu.Unlock()
+					persistCursor(false)
 				}
 			}
 		}()
@@ -380,287 +644,428 @@ func runIngestion(ctx context.Context, config *common.Config, logger *common.Ing
 		var wg sync.WaitGroup
 		for i := 0; i < numWorkers; i++ {
 			wg.Add(1)
-			go esWorker(ctx, i, batchChan, esClient, &cursorMu, &pendingCursor, &hasPendingUpdate, &pendingBatchCount, &pendingSkipCount, dryRun, logger, &wg)
+			go esWorker(ctx, i, lanes, esClient, likesRouter, changeFeed, spill, postCounts, cursor, cursorWrites, &cursorMu, &pendingBatchCount, &pendingSkipCount, dryRun, logger, &wg)
 		}
 		wg.Wait()
 		close(workersDone)
 	}()
 
-	var batch []common.LikeDoc
-	var deleteMessages []common.JetstreamMessage
-	var lastTimeUs int64
-	const batchSize = 100
-	processedCount := 0
-	deletedCount := 0
-	skippedCount := 0
+	// Each record handler batches its own creates and deletes. A batch is
+	// sent when it is full or, on a quiet stream, once its first event has
+	// waited MaxAge.
+	batchConfig := common.BatchConfigFromConfig(config, 100)
+	summary := &ingestSummary{}
+	env := &handlerEnv{ctx: ctx, lanes: lanes, esClient: esClient, cursor: cursor, summary: summary, logger: logger}
+	var handlers []recordHandler
+	for _, name := range handlerNames {
+		switch name {
+		case handlerLikes:
+			handlers = append(handlers, newLikeHandler(env, batchConfig, likeDedup, rateLimiter))
+		case handlerFollows:
+			handlers = append(handlers, newFollowHandler(env, batchConfig))
+		case handlerPosts:
+			handlers = append(handlers, newPostHandler(env, batchConfig))
+		}
+	}
+	// With the posts handler, deleted accounts' posts are purged as well
+	accountDeletion := common.AccountDeletion{Likes: true, Posts: slices.Contains(handlerNames, handlerPosts)}
+	var lastReadUs int64
+	nextInstanceCheck := 1000
+	var haltErr error
+
+	var flushTick <-chan time.Time
+	if tick := batchConfig.TickInterval(); tick > 0 {
+		flushTicker := time.NewTicker(tick)
+		defer flushTicker.Stop()
+		flushTick = flushTicker.C
+	}
 
 	for {
+		// Every event read so far was skipped or handed to its handler
+		cursor.observe(lastReadUs)
+
 		select {
 		case <-ctx.Done():
 			logger.Info("Shutdown signal received, stopping ingestion")
 			goto cleanup
+		case <-flushTick:
+			for _, handler := range handlers {
+				if !handler.sendDue() {
+					goto cleanup
+				}
+			}
 		case rawMsg, ok := <-msgChan:
 			if !ok {
 				logger.Info("Jetstream channel closed, finishing remaining batch")
 				goto cleanup
 			}
 
+			summary.received++
 			logger.Metric("jetstream.inbound_count", 1)
+			_, parseSpan := common.StartSpan(ctx, "jetstream.parse")
 			msg := common.NewJetstreamMessage(rawMsg, logger)
+			common.EndSpan(parseSpan, msg.ParseError())
+
+			if err := msg.ParseError(); err != nil {
+				summary.skipped++
+				if haltErr = malformed.Malformed(ctx, "jetstream event", []byte(rawMsg), err); haltErr != nil {
+					logger.Error("Halting ingestion: %v", haltErr)
+					healthServer.SetHealthy(false, haltErr.Error())
+					goto cleanup
+				}
+				continue
+			}
+			malformed.Valid()
+			healthServer.RecordEvent("jetstream", msg.GetTimeUs())
+			lastReadUs = max(lastReadUs, msg.GetTimeUs())
+
+			// Deletions still apply so documents indexed before a DID was denied are removed
+			if (msg.IsLike() || msg.IsFollow() || msg.IsPost()) && denyList.Denied(common.DenyStageIngest, msg.GetAuthorDID(), msg.GetAtURI()) {
+				summary.skipped++
+				continue
+			}
 
 			if !common.ShouldSampleDID(msg.GetAuthorDID(), config.Environment) {
 				logger.Metric("jetstream.sample_dropped_count", 1)
-				skippedCount++
+				summary.skipped++
 				continue
 			}
 
-			// Handle like deletions
-			if msg.IsLikeDelete() {
-				if msg.GetAtURI() == "" {
-					logger.Error("Skipping like deletion with empty at_uri (author_did: %s)", msg.GetAuthorDID())
-					skippedCount++
-					continue
-				}
-
-				// Store delete message for batch processing
-				deleteMessages = append(deleteMessages, msg)
-
-				// Track the latest timestamp
-				if msg.GetTimeUs() > lastTimeUs {
-					lastTimeUs = msg.GetTimeUs()
-				}
+			// Other shards ingest the events of authors this shard does not own,
+			// account events included
+			if !shard.owns(msg.GetAuthorDID()) {
+				logger.Metric("jetstream.shard_skipped_count", 1)
+				summary.skipped++
+				continue
+			}
 
-				// Process batch when full
-				if len(deleteMessages) >= batchSize {
-					// Fetch existing like documents from Elasticsearch
-					likeIDs := make([]common.LikeIdentifier, len(deleteMessages))
-					for i, delMsg := range deleteMessages {
-						likeIDs[i] = common.LikeIdentifier{
-							AtURI:     delMsg.GetAtURI(),
-							AuthorDID: delMsg.GetAuthorDID(),
-						}
-					}
+			// Every account event, including an account becoming active
+			// again, records the account's status
+			if msg.IsAccountEvent() {
+				accountStatuses.Add(common.AccountEventFromJetstream(msg))
+			}
+			if msg.IsBlock() || msg.IsBlockDelete() {
+				blocks.Add(msg)
+			}
 
-					likeDocs, err := common.BulkGetLikes(ctx, esClient, "likes", likeIDs, logger)
-					if err != nil {
-						logger.Error("Failed to fetch like documents for deletion: %v", err)
-						// Continue processing - we'll skip tombstone creation for missing docs
+			// Handle account deletions
+			if msg.IsAccountDeletion() {
+				// The account's records still waiting in create batches are
+				// sent ahead, so that the deletion finds them once written
+				for _, handler := range handlers {
+					if !handler.sendAuthor(msg.GetAuthorDID()) {
+						goto cleanup
 					}
+				}
 
-					// Build tombstone and delete batches
-					var tombstoneBatch []common.LikeTombstoneDoc
-					var deleteBatch []common.DeleteDoc
+				if !accounts.Enqueue(ctx, msg.GetAuthorDID(), msg.GetTimeUs(), accountDeletion) {
+					goto cleanup
+				}
+				continue
+			}
 
-					for _, delMsg := range deleteMessages {
-						atURI := delMsg.GetAtURI()
-						authorDID := delMsg.GetAuthorDID()
+			handled := false
+			for _, handler := range handlers {
+				var ok bool
+				if handled, ok = handler.handle(msg, len(rawMsg)); !ok {
+					goto cleanup
+				}
+				if handled {
+					break
+				}
+			}
+			// Records of handlers that are not registered
+			if !handled && (msg.IsLike() || msg.IsLikeDelete() || msg.IsFollow() || msg.IsFollowDelete() || msg.IsPost() || msg.IsPostDelete()) {
+				summary.skipped++
+			}
 
-						// Check if we found the like document
-						if likeDoc, found := likeDocs[atURI]; found {
-							// Create tombstone with subject_uri from ES
-							tombstone := common.CreateLikeTombstoneDoc(delMsg, likeDoc.SubjectURI)
-							tombstoneBatch = append(tombstoneBatch, tombstone)
-						} else {
-							// This isn't an error since we won't always have the original like document
-							logger.Debug("Like document not found for deletion, skipping tombstone: at_uri=%s", atURI)
-						}
+			// Check if a newer instance has started (every 1000 records sent,
+			// to avoid excessive GCS reads)
+			if summary.processed >= nextInstanceCheck {
+				nextInstanceCheck = summary.processed + 1000
+				if stateManager.CheckForNewerInstance(myStartTime) {
+					logger.Info("Newer instance detected, exiting")
+					goto cleanup
+				}
+			}
+		}
+	}
 
-						// Always add to delete batch (idempotent operation)
-						deleteBatch = append(deleteBatch, common.DeleteDoc{
-							DocID:     atURI,
-							AuthorDID: authorDID,
-						})
-					}
+cleanup:
+	// Send final create batches to workers, then the delete batches once
+	// the creates they may follow are written
+	for _, handler := range handlers {
+		handler.flushCreates(5 * time.Second)
+	}
+	for _, handler := range handlers {
+		if handler.hasDeletes() {
+			if !lanes.awaitCreates(5 * time.Second) {
+				logger.Error("Timeout waiting for creates before final delete batches")
+			}
+			break
+		}
+	}
+	for _, handler := range handlers {
+		handler.flushDeletes(5 * time.Second)
+	}
 
-					// Send batch to workers
-					job := batchJob{
-						batch:          make([]common.LikeDoc, 0),
-						tombstoneBatch: tombstoneBatch,
-						deleteBatch:    deleteBatch,
-						timeUs:         lastTimeUs,
-						batchCount:     0,
-						tombstoneCount: len(tombstoneBatch),
-						skipCount:      skippedCount,
-					}
+	// Finish account deletions while the workers can still write the likes
+	// they wait for
+	accounts.Close(30 * time.Second)
 
-					select {
-					case batchChan <- job:
-						deletedCount += len(deleteBatch)
-					case <-ctx.Done():
-						goto cleanup
-					}
+	// Stop replaying spooled jobs, then close the lanes to signal workers to
+	// finish
+	stopReplay()
+	<-replayDone
+	lanes.close()
 
-					// Reset delete messages batch
-					deleteMessages = make([]common.JetstreamMessage, 0, batchSize)
-				}
-			} else if msg.IsLike() {
+	// Wait for all workers to complete
+	<-workersDone
 
-				if blocked, newlyBlocked := rateLimiter.RecordLike(msg.GetAuthorDID()); blocked {
-					if newlyBlocked {
-						logger.Metric("jetstream.blocked_accounts_count", 1)
-					}
-					logger.Metric("jetstream.dropped_likes_count", 1)
-					skippedCount++
-					continue
-				}
+	// Apply the like count changes of the final batches
+	stopPostCounts()
+	<-postCountsDone
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 10*time.Second)
+	if err := postCounts.Flush(flushCtx); err != nil {
+		logger.Error("Failed to apply final like count changes: %v", err)
+	}
+	cancelFlush()
+
+	// Record the account statuses of the final batches
+	stopAccountStatuses()
+	<-accountStatusesDone
+	flushCtx, cancelFlush = context.WithTimeout(context.Background(), 10*time.Second)
+	if err := accountStatuses.Flush(flushCtx); err != nil {
+		logger.Error("Failed to record final account statuses: %v", err)
+	}
+	cancelFlush()
+
+	// Write the blocks of the final batches
+	stopBlocks()
+	<-blocksDone
+	flushCtx, cancelFlush = context.WithTimeout(context.Background(), 10*time.Second)
+	if err := blocks.Flush(flushCtx); err != nil {
+		logger.Error("Failed to write final blocks: %v", err)
+	}
+	cancelFlush()
 
-				if msg.GetAtURI() == "" {
-					logger.Error("Skipping like with empty at_uri (author_did: %s)", msg.GetAuthorDID())
-					skippedCount++
-					continue
-				}
+	// Persist the cursor of the final batches; the state writer only
+	// flushes on shutdown, which a closed channel does not signal
+	cursor.observe(lastReadUs)
+	if !dryRun {
+		persistCursor(true)
+	}
 
-				if msg.GetSubjectURI() == "" {
-					logger.Error("Skipping like with empty subject_uri (at_uri: %s, author_did: %s)", msg.GetAtURI(), msg.GetAuthorDID())
-					skippedCount++
-					continue
-				}
+	malformed.Flush(context.Background())
 
-				doc := common.CreateLikeDoc(msg)
-				batch = append(batch, doc)
+	logger.Info("Jetstream ingestion complete. Processed: %d, Deleted: %d, Skipped: %d", summary.processed, summary.deleted, summary.skipped)
+	if haltErr != nil {
+		os.Exit(1)
+	}
+	return *summary
+}
 
-				// Track the latest timestamp
-				if msg.GetTimeUs() > lastTimeUs {
-					lastTimeUs = msg.GetTimeUs()
-				}
+// newLikeJob builds a batch job for new likes
+func newLikeJob(batch []common.LikeDoc, timeUs int64, skipCount int) batchJob {
+	return batchJob{
+		batch:          batch,
+		tombstoneBatch: make([]common.LikeTombstoneDoc, 0),
+		deleteBatch:    make([]common.DeleteDoc, 0),
+		timeUs:         timeUs,
+		batchCount:     len(batch),
+		tombstoneCount: 0,
+		skipCount:      skipCount,
+	}
+}
 
-				if len(batch) >= batchSize {
-					// Send batch to workers for processing
-					job := batchJob{
-						batch:          batch,
-						tombstoneBatch: make([]common.LikeTombstoneDoc, 0),
-						deleteBatch:    make([]common.DeleteDoc, 0),
-						timeUs:         lastTimeUs,
-						batchCount:     len(batch),
-						tombstoneCount: 0,
-						skipCount:      skippedCount,
-					}
+// newFollowJob builds a batch job for new follows
+func newFollowJob(followBatch []common.FollowDoc, timeUs int64, skipCount int) batchJob {
+	return batchJob{
+		followBatch: followBatch,
+		timeUs:      timeUs,
+		skipCount:   skipCount,
+	}
+}
 
-					select {
-					case batchChan <- job:
-						processedCount += len(batch)
-
-						// Check if a newer instance has started (every 10 batches to avoid excessive GCS reads)
-						if processedCount%1000 == 0 {
-							if stateManager.CheckForNewerInstance(myStartTime) {
-								logger.Info("Newer instance detected, exiting")
-								goto cleanup
-							}
-						}
-					case <-ctx.Done():
-						goto cleanup
-					}
+// newPostJob builds a batch job for new fallback posts
+func newPostJob(postBatch []common.PostDoc, timeUs int64, skipCount int) batchJob {
+	return batchJob{
+		postBatch: postBatch,
+		timeUs:    timeUs,
+		skipCount: skipCount,
+	}
+}
 
-					// Create new batch slice
-					batch = make([]common.LikeDoc, 0, batchSize)
-				}
-			}
+// newPostDeleteJob builds a batch job for post deletes. Only fallback posts
+// are deleted; megastream tombstones and deletes the posts it indexed.
+func newPostDeleteJob(_ context.Context, _ *elasticsearch.Client, deleteMessages []common.JetstreamMessage, timeUs int64, skipCount int, _ *common.IngestLogger) batchJob {
+	deleteBatch := make([]common.DeleteDoc, len(deleteMessages))
+	for i, delMsg := range deleteMessages {
+		deleteBatch[i] = common.DeleteDoc{
+			DocID:     delMsg.GetAtURI(),
+			AuthorDID: delMsg.GetAuthorDID(),
 		}
 	}
+	return batchJob{
+		postDeleteBatch: deleteBatch,
+		timeUs:          timeUs,
+		skipCount:       skipCount,
+	}
+}
 
-cleanup:
-	// Send final like batch to workers
-	if len(batch) > 0 {
-		job := batchJob{
-			batch:          batch,
-			tombstoneBatch: make([]common.LikeTombstoneDoc, 0),
-			deleteBatch:    make([]common.DeleteDoc, 0),
-			timeUs:         lastTimeUs,
-			batchCount:     len(batch),
-			tombstoneCount: 0,
-			skipCount:      skippedCount,
-		}
+// postDeleteChangeEvents builds the delete events for a batch of post
+// deletes that removed fallback posts. Delete-by-query does not say which
+// posts it removed, so every post in the batch gets an event; a post
+// megastream indexed gets another when megastream deletes it.
+func postDeleteChangeEvents(deletes []common.DeleteDoc) []common.ChangeEvent {
+	indexedAt := time.Now().UTC().Format(time.RFC3339)
+	events := make([]common.ChangeEvent, 0, len(deletes))
+	for _, doc := range deletes {
+		events = append(events, common.ChangeEvent{AtURI: doc.DocID, Type: common.ChangeTypePost, Operation: common.ChangeOperationDelete, IndexedAt: indexedAt})
+	}
+	return events
+}
 
-		select {
-		case batchChan <- job:
-			processedCount += len(batch)
-		case <-time.After(5 * time.Second):
-			logger.Error("Timeout sending final like batch to workers")
+// newLikeDeleteJob builds a batch job for unlikes. Tombstones need the liked
+// post, which delete events do not carry, so it is read back from the likes
+// index; likes that were never indexed are deleted without a tombstone.
+func newLikeDeleteJob(ctx context.Context, esClient *elasticsearch.Client, deleteMessages []common.JetstreamMessage, timeUs int64, skipCount int, logger *common.IngestLogger) batchJob {
+	likeIDs := make([]common.LikeIdentifier, len(deleteMessages))
+	for i, delMsg := range deleteMessages {
+		likeIDs[i] = common.LikeIdentifier{
+			AtURI:     delMsg.GetAtURI(),
+			AuthorDID: delMsg.GetAuthorDID(),
 		}
 	}
 
-	// Send final delete batch to workers
-	if len(deleteMessages) > 0 {
-		// Fetch existing like documents from Elasticsearch
-		likeIDs := make([]common.LikeIdentifier, len(deleteMessages))
-		for i, delMsg := range deleteMessages {
-			likeIDs[i] = common.LikeIdentifier{
-				AtURI:     delMsg.GetAtURI(),
-				AuthorDID: delMsg.GetAuthorDID(),
-			}
-		}
+	likeDocs, err := common.BulkGetLikes(ctx, esClient, "likes", likeIDs, logger)
+	if err != nil {
+		logger.Error("Failed to fetch like documents for deletion: %v", err)
+		logger.Metric("jetstream.like_delete_lookup_error_count", 1)
+		// Continue processing - we'll skip tombstone creation for missing docs
+	}
 
-		likeDocs, err := common.BulkGetLikes(ctx, esClient, "likes", likeIDs, logger)
-		if err != nil {
-			logger.Error("Failed to fetch like documents for final deletion batch: %v", err)
+	// Build tombstone and delete batches
+	var tombstoneBatch []common.LikeTombstoneDoc
+	var deleteBatch []common.DeleteDoc
+	notFound := 0
+
+	for _, delMsg := range deleteMessages {
+		atURI := delMsg.GetAtURI()
+
+		// Check if we found the like document
+		if likeDoc, found := likeDocs[atURI]; found {
+			// Create tombstone with subject_uri from ES
+			tombstoneBatch = append(tombstoneBatch, common.CreateLikeTombstoneDoc(delMsg, likeDoc.SubjectURI))
+		} else {
+			// This isn't an error since we won't always have the original like document
+			logger.Debug("Like document not found for deletion, skipping tombstone: at_uri=%s", atURI)
+			notFound++
 		}
 
-		// Build tombstone and delete batches
-		var tombstoneBatch []common.LikeTombstoneDoc
-		var deleteBatch []common.DeleteDoc
+		// Always add to delete batch (idempotent operation); the
+		// index is known only if the like was found
+		deleteBatch = append(deleteBatch, common.DeleteDoc{
+			DocID:     atURI,
+			AuthorDID: delMsg.GetAuthorDID(),
+			Index:     likeDocs[atURI].Index,
+		})
+	}
 
-		for _, delMsg := range deleteMessages {
-			atURI := delMsg.GetAtURI()
-			authorDID := delMsg.GetAuthorDID()
+	if notFound > 0 {
+		logger.Metric("jetstream.like_deletes_not_found_count", float64(notFound))
+	}
 
-			if likeDoc, found := likeDocs[atURI]; found {
-				tombstone := common.CreateLikeTombstoneDoc(delMsg, likeDoc.SubjectURI)
-				tombstoneBatch = append(tombstoneBatch, tombstone)
-			} else {
-				logger.Debug("Like document not found for final deletion, skipping tombstone: at_uri=%s", atURI)
-			}
+	return batchJob{
+		batch:          make([]common.LikeDoc, 0),
+		tombstoneBatch: tombstoneBatch,
+		deleteBatch:    deleteBatch,
+		timeUs:         timeUs,
+		batchCount:     0,
+		tombstoneCount: len(tombstoneBatch),
+		skipCount:      skipCount,
+	}
+}
 
-			deleteBatch = append(deleteBatch, common.DeleteDoc{
-				DocID:     atURI,
-				AuthorDID: authorDID,
-			})
+// newFollowDeleteJob builds a batch job for unfollows. Tombstones need the
+// followed DID, which delete events do not carry, so it is read back from the
+// follows index; follows that were never indexed are deleted without a tombstone.
+func newFollowDeleteJob(ctx context.Context, esClient *elasticsearch.Client, deleteMessages []common.JetstreamMessage, timeUs int64, skipCount int, logger *common.IngestLogger) batchJob {
+	deleteBatch := make([]common.DeleteDoc, len(deleteMessages))
+	for i, delMsg := range deleteMessages {
+		deleteBatch[i] = common.DeleteDoc{
+			DocID:     delMsg.GetAtURI(),
+			AuthorDID: delMsg.GetAuthorDID(),
 		}
+	}
 
-		job := batchJob{
-			batch:          make([]common.LikeDoc, 0),
-			tombstoneBatch: tombstoneBatch,
-			deleteBatch:    deleteBatch,
-			timeUs:         lastTimeUs,
-			batchCount:     0,
-			tombstoneCount: len(tombstoneBatch),
-			skipCount:      skippedCount,
-		}
+	followDocs, err := common.BulkGetFollows(ctx, esClient, "follows", deleteBatch, logger)
+	if err != nil {
+		logger.Error("Failed to fetch follow documents for deletion: %v", err)
+	}
 
-		select {
-		case batchChan <- job:
-			deletedCount += len(deleteBatch)
-		case <-time.After(5 * time.Second):
-			logger.Error("Timeout sending final delete batch to workers")
+	var tombstoneBatch []common.FollowTombstoneDoc
+	for _, delMsg := range deleteMessages {
+		if followDoc, found := followDocs[delMsg.GetAtURI()]; found {
+			tombstoneBatch = append(tombstoneBatch, common.CreateFollowTombstoneDoc(delMsg, followDoc.SubjectDID))
 		}
 	}
 
-	// Close batch channel to signal workers to finish
-	close(batchChan)
-
-	// Wait for all workers to complete
-	<-workersDone
+	return batchJob{
+		followTombstoneBatch: tombstoneBatch,
+		followDeleteBatch:    deleteBatch,
+		timeUs:               timeUs,
+		skipCount:            skipCount,
+	}
+}
 
-	logger.Info("Jetstream ingestion complete. Processed: %d, Deleted: %d, Skipped: %d", processedCount, deletedCount, skippedCount)
+// acceptedLikes returns the likes in batch that Elasticsearch accepted despite
+// err. It returns nil when err does not say which likes failed.
+func acceptedLikes(batch []common.LikeDoc, err error) []common.LikeDoc {
+	result, ok := common.AsBulkResult(err)
+	if !ok {
+		return nil
+	}
+	failed := make(map[string]bool, len(result.FailedIDs))
+	for _, atURI := range result.FailedIDs {
+		failed[atURI] = true
+	}
+	var accepted []common.LikeDoc
+	for _, like := range batch {
+		if like.AtURI != "" && !failed[like.AtURI] {
+			accepted = append(accepted, like)
+		}
+	}
+	return accepted
 }
 
 // esWorker processes batches of documents and writes them to Elasticsearch
-func esWorker(ctx context.Context, id int, batchChan <-chan batchJob, esClient *elasticsearch.Client, cursorMu *sync.Mutex, pendingCursor *int64, hasPendingUpdate *bool, pendingBatchCount *int, pendingSkipCount *int, dryRun bool, logger *common.IngestLogger, wg *sync.WaitGroup) {
+func esWorker(ctx context.Context, id int, lanes *batchLanes, esClient *elasticsearch.Client, likesRouter *common.IndexRouter, changeFeed *common.ChangeFeed, spill *common.Spill[spilledJob], postCounts *common.PostCounter, cursor *cursorTracker, cursorWrites *common.CursorThrottle, cursorMu *sync.Mutex, pendingBatchCount *int, pendingSkipCount *int, dryRun bool, logger *common.IngestLogger, wg *sync.WaitGroup) {
 	defer wg.Done()
 
 	batchCounter := 0
-	for job := range batchChan {
+	for {
+		job, ok := lanes.next()
+		if !ok {
+			return
+		}
 		batchCounter++
 		// Calculate freshness once at start
-		freshnessSeconds := common.CalculateFreshness(job.timeUs)
-		logger.Metric("freshness_sec", float64(freshnessSeconds))
+		freshnessSeconds := common.RecordFreshness(job.timeUs, logger)
 		success := true
 
+		// While Elasticsearch is unavailable the whole job is spooled without
+		// trying it; otherwise the parts whose writes fail outright are
+		var unsent spilledJob
+		write := !spill.Engaged()
+
 		// Handle tombstone and deletion batch
-		if len(job.tombstoneBatch) > 0 {
+		if write && len(job.tombstoneBatch) > 0 {
 			// Index tombstones FIRST (critical for data preservation)
-			if err := common.BulkIndexLikeTombstones(ctx, esClient, "like_tombstones", job.tombstoneBatch, dryRun, logger); err != nil {
+			if err := common.BulkIndexLikeTombstones(ctx, esClient, common.WriteAlias("like_tombstones"), job.tombstoneBatch, dryRun, logger); err != nil {
 				logger.Error("Worker %d: Failed to bulk index like tombstones: %v", id, err)
 				success = false
+				unsent.LikeTombstones, unsent.LikeDeletes = job.tombstoneBatch, job.deleteBatch
 			} else {
 				if dryRun {
 					logger.Debug("Worker %d: Dry-run: Would index %d like tombstones", id, job.tombstoneCount)
@@ -670,15 +1075,18 @@ func esWorker(ctx context.Context, id int, batchChan <-chan batchJob, esClient *
 
 				// Only delete if tombstone indexing succeeded
 				if len(job.deleteBatch) > 0 {
+					likesRouter.RouteDeletes(job.deleteBatch)
 					if err := common.BulkDelete(ctx, esClient, "likes", job.deleteBatch, dryRun, logger); err != nil {
 						logger.Error("Worker %d: Failed to bulk delete likes: %v", id, err)
 						success = false
+						unsent.LikeTombstones, unsent.LikeDeletes = job.tombstoneBatch, job.deleteBatch
 					} else {
 						if dryRun {
 							logger.Debug("Worker %d: Dry-run: Would delete %d likes (freshness: %ds)", id, len(job.deleteBatch), freshnessSeconds)
 						} else {
 							logger.Debug("Worker %d: Deleted %d likes (freshness: %ds)", id, len(job.deleteBatch), freshnessSeconds)
 						}
+						changeFeed.Publish(ctx, common.LikeDeleteChangeEvents(job.tombstoneBatch))
 
 						// Decrement like counts on posts
 						updates := make([]common.LikeCountUpdate, len(job.tombstoneBatch))
@@ -688,43 +1096,128 @@ func esWorker(ctx context.Context, id int, batchChan <-chan batchJob, esClient *
 								Increment:  -1,
 							}
 						}
-
-						var wg sync.WaitGroup
-						wg.Add(2)
-						go common.BulkIndexWorker(&wg, ctx, esClient, "posts", updates, dryRun, logger, common.BulkUpdateLikeCounts, "decrement like counts in")
-						go common.BulkIndexWorker(&wg, ctx, esClient, "replies", updates, dryRun, logger, common.BulkUpdateLikeCounts, "decrement like counts in")
-						wg.Wait()
+						postCounts.Add(common.LikeCountField, updates)
 					}
 				}
 			}
 		}
 
 		// Handle like creation batch
-		if len(job.batch) > 0 {
-			if err := common.BulkIndexLikes(ctx, esClient, "likes", job.batch, dryRun, logger); err != nil {
+		if write && len(job.batch) > 0 {
+			indexed := job.batch
+			if err := likesRouter.Route(ctx, job.batch); err != nil {
+				logger.Error("Worker %d: Failed to route likes: %v", id, err)
+				success = false
+				indexed = nil
+				unsent.Likes = job.batch
+			} else if err := common.BulkIndexLikes(ctx, esClient, "likes", job.batch, dryRun, logger); err != nil {
 				logger.Error("Worker %d: Failed to bulk index likes: %v", id, err)
 				success = false
-			} else {
-				if dryRun {
-					logger.Debug("Worker %d: Dry-run: Would index %d likes (skipped: %d, freshness: %ds)", id, job.batchCount, job.skipCount, freshnessSeconds)
-				} else {
-					logger.Debug("Worker %d: Indexed %d likes (skipped: %d, freshness: %ds)", id, job.batchCount, job.skipCount, freshnessSeconds)
+				indexed = acceptedLikes(job.batch, err)
+				if _, ok := common.AsBulkResult(err); !ok {
+					unsent.Likes = job.batch
 				}
+			} else if dryRun {
+				logger.Debug("Worker %d: Dry-run: Would index %d likes (skipped: %d, freshness: %ds)", id, job.batchCount, job.skipCount, freshnessSeconds)
+			} else {
+				logger.Debug("Worker %d: Indexed %d likes (skipped: %d, freshness: %ds)", id, job.batchCount, job.skipCount, freshnessSeconds)
+			}
+
+			// Publish and count only the likes that were indexed
+			if len(indexed) > 0 {
+				changeFeed.Publish(ctx, common.LikeChangeEvents(indexed))
 
 				// Update like counts on posts
-				updates := make([]common.LikeCountUpdate, len(job.batch))
-				for i, like := range job.batch {
+				updates := make([]common.LikeCountUpdate, len(indexed))
+				for i, like := range indexed {
 					updates[i] = common.LikeCountUpdate{
 						SubjectURI: like.SubjectURI,
 						Increment:  1,
 					}
 				}
+				postCounts.Add(common.LikeCountField, updates)
+			}
+		}
+
+		// Handle unfollows: tombstones first, then remove the edge from the graph
+		if write && len(job.followDeleteBatch) > 0 {
+			if err := common.BulkIndex(ctx, esClient, common.WriteAlias("follow_tombstones"), job.followTombstoneBatch, dryRun, logger); err != nil {
+				logger.Error("Worker %d: Failed to bulk index follow tombstones: %v", id, err)
+				success = false
+				unsent.FollowTombstones, unsent.FollowDeletes = job.followTombstoneBatch, job.followDeleteBatch
+			} else if err := common.BulkDelete(ctx, esClient, "follows", job.followDeleteBatch, dryRun, logger); err != nil {
+				logger.Error("Worker %d: Failed to bulk delete follows: %v", id, err)
+				success = false
+				unsent.FollowTombstones, unsent.FollowDeletes = job.followTombstoneBatch, job.followDeleteBatch
+			} else {
+				logger.Metric("jetstream.follows_deleted_count", float64(len(job.followDeleteBatch)))
+				logger.Debug("Worker %d: Deleted %d follows (%d tombstones, freshness: %ds)", id, len(job.followDeleteBatch), len(job.followTombstoneBatch), freshnessSeconds)
+			}
+		}
+
+		// Handle follow creation batch
+		if write && len(job.followBatch) > 0 {
+			if err := common.BulkIndex(ctx, esClient, "follows", job.followBatch, dryRun, logger); err != nil {
+				logger.Error("Worker %d: Failed to bulk index follows: %v", id, err)
+				success = false
+				if _, ok := common.AsBulkResult(err); !ok {
+					unsent.Follows = job.followBatch
+				}
+			} else {
+				logger.Metric("jetstream.follows_indexed_count", float64(len(job.followBatch)))
+				logger.Debug("Worker %d: Indexed %d follows (freshness: %ds)", id, len(job.followBatch), freshnessSeconds)
+			}
+		}
+
+		// Handle fallback post deletes, then creates
+		if write && len(job.postDeleteBatch) > 0 {
+			if deleted, err := common.DeleteJetstreamPosts(ctx, esClient, "posts", job.postDeleteBatch, dryRun, logger); err != nil {
+				logger.Error("Worker %d: Failed to delete fallback posts: %v", id, err)
+				success = false
+				unsent.PostDeletes = job.postDeleteBatch
+			} else {
+				logger.Metric("jetstream.posts_deleted_count", float64(deleted))
+				logger.Debug("Worker %d: Deleted %d of %d posts as fallback posts (freshness: %ds)", id, deleted, len(job.postDeleteBatch), freshnessSeconds)
+				if deleted > 0 {
+					changeFeed.Publish(ctx, postDeleteChangeEvents(job.postDeleteBatch))
+				}
+			}
+		}
+		if write && len(job.postBatch) > 0 {
+			if err := common.BulkIndex(ctx, esClient, common.WriteAlias("posts"), job.postBatch, dryRun, logger); err != nil {
+				logger.Error("Worker %d: Failed to bulk index fallback posts: %v", id, err)
+				success = false
+				if _, ok := common.AsBulkResult(err); !ok {
+					unsent.Posts = spillPosts(job.postBatch)
+				}
+			} else {
+				logger.Metric("jetstream.posts_indexed_count", float64(len(job.postBatch)))
+				logger.Debug("Worker %d: Indexed %d fallback posts (freshness: %ds)", id, len(job.postBatch), freshnessSeconds)
+			}
+		}
 
-				var wg sync.WaitGroup
-				wg.Add(2)
-				go common.BulkIndexWorker(&wg, ctx, esClient, "posts", updates, dryRun, logger, common.BulkUpdateLikeCounts, "increment like counts in")
-				go common.BulkIndexWorker(&wg, ctx, esClient, "replies", updates, dryRun, logger, common.BulkUpdateLikeCounts, "increment like counts in")
-				wg.Wait()
+		// Parts of the job that failed and could not be spooled hold back
+		// the cursor, so a restart replays them
+		dropped := !unsent.empty() && spill == nil
+		if spill != nil {
+			if write {
+				if unsent.empty() {
+					spill.Succeeded()
+				} else {
+					spill.Failed()
+				}
+			} else {
+				unsent = spillJob(job)
+			}
+			if !unsent.empty() {
+				unsent.TimeUs = job.timeUs
+				if err := spill.Write(unsent); err != nil {
+					logger.Error("Worker %d: Failed to spool batch, dropping it: %v", id, err)
+					success = false
+					dropped = true
+				} else {
+					logger.Metric("jetstream.spilled_batches_count", 1)
+				}
 			}
 		}
 
@@ -734,18 +1227,67 @@ func esWorker(ctx context.Context, id int, batchChan <-chan batchJob, esClient *
 			batchCounter = 0
 		}
 
-		// Save cursor after successful batch operations
+		if !dropped {
+			cursor.done(job.handler, job.eventTimes)
+		}
 		if success && !dryRun {
-			// Record cursor and batch stats for throttled logging (logged every 10 seconds by state writer goroutine)
-			// This is necessary to avoid a GSE ratelimit on state file writes
+			// Record batch stats for throttled logging (logged every 10 seconds by state writer goroutine)
 			cursorMu.Lock()
-			if job.timeUs > *pendingCursor {
-				*pendingCursor = job.timeUs
-				*hasPendingUpdate = true
-			}
 			*pendingBatchCount += job.batchCount
 			*pendingSkipCount += job.skipCount
+			cursorWrites.AddBatches(1)
 			cursorMu.Unlock()
 		}
+
+		// Release deletes held behind this job's creates
+		lanes.done(job)
+		if job.done != nil {
+			job.done()
+		}
+	}
+}
+
+// warmDedupCache fills the like dedup cache with the likes indexed since the
+// cursor, which the rewind replays. Without it the cache starts empty after a
+// restart. Failures are logged, leaving the cache as it was.
+func warmDedupCache(ctx context.Context, esClient *elasticsearch.Client, dedup *jetstream_ingest.DedupCache, cursorTime int64, size int, logger *common.IngestLogger) {
+	if dedup == nil {
+		return
+	}
+	since := time.UnixMicro(cursorTime).UTC().Format(time.RFC3339)
+	atURIs, err := common.FetchRecentLikeURIs(ctx, esClient, logger, "likes", since, size)
+	if err != nil {
+		logger.Error("Failed to warm the like dedup cache (continuing with it empty): %v", err)
+		return
+	}
+	dedup.Add(atURIs...)
+	logger.Info("Warmed the like dedup cache with %d likes indexed since %s", len(atURIs), since)
+}
+
+// reportDedupHitRate reports the share of likes skipped as duplicates every
+// minute until ctx is done
+func reportDedupHitRate(ctx context.Context, dedup *jetstream_ingest.DedupCache, logger *common.IngestLogger) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if rate, lookups := dedup.HitRate(); lookups > 0 {
+				logger.Metric("jetstream.like_dedup.hit_rate", rate)
+			}
+			logger.Metric("jetstream.like_dedup.size", float64(dedup.Len()))
+		}
+	}
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// ingestShard is the hash range of author DIDs one replica ingests when
+// GE_SHARD_COUNT replicas share the stream. Every replica reads the whole
+// stream and skips the events of authors other shards own.
+type ingestShard struct {
+	index int
+	count int
+}
+
+// shardFromConfig returns the shard GE_SHARD_INDEX and GE_SHARD_COUNT
+// configure
+func shardFromConfig(config *common.Config) ingestShard {
+	return ingestShard{index: config.JetstreamShardIndex, count: config.JetstreamShardCount}
+}
+
+// validate checks the shard is one of count
+func (s ingestShard) validate() error {
+	if s.count < 1 {
+		return fmt.Errorf("GE_SHARD_COUNT must be at least 1, got %d", s.count)
+	}
+	if s.index < 0 || s.index >= s.count {
+		return fmt.Errorf("GE_SHARD_INDEX must be from 0 to %d, got %d", s.count-1, s.index)
+	}
+	return nil
+}
+
+// sharded reports whether the stream is split between replicas
+func (s ingestShard) sharded() bool {
+	return s.count > 1
+}
+
+// owns reports whether the author's events are this shard's. Canary DIDs
+// belong to every shard, so each replica's canaries are ingested.
+func (s ingestShard) owns(authorDID string) bool {
+	if !s.sharded() || common.IsCanaryDID(authorDID) {
+		return true
+	}
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(authorDID))
+	return int(h.Sum64()%uint64(s.count)) == s.index
+}
+
+// stateFile returns the shard's own state file, so each shard keeps its
+// own cursor, instance file, and account deletion queue. An unsharded
+// replica keeps stateFile.
+func (s ingestShard) stateFile(stateFile string) string {
+	if !s.sharded() {
+		return stateFile
+	}
+	suffix := fmt.Sprintf("_shard%dof%d", s.index, s.count)
+	if strings.HasSuffix(stateFile, "_state.json") {
+		return strings.TrimSuffix(stateFile, "_state.json") + suffix + "_state.json"
+	}
+	return strings.TrimSuffix(stateFile, ".json") + suffix + ".json"
+}
+
+// String describes the shard for logs
+func (s ingestShard) String() string {
+	return fmt.Sprintf("%d of %d", s.index, s.count)
+}
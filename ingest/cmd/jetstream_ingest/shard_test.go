@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/account_deletion"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func TestIngestShard_OwnsEachAuthorOnce(t *testing.T) {
+	shards := []ingestShard{{index: 0, count: 3}, {index: 1, count: 3}, {index: 2, count: 3}}
+	owned := make([]int, len(shards))
+	for i := 0; i < 3000; i++ {
+		did := fmt.Sprintf("did:plc:%d", i)
+		owners := 0
+		for j, shard := range shards {
+			if shard.owns(did) {
+				owners++
+				owned[j]++
+			}
+		}
+		if owners != 1 {
+			t.Fatalf("%s: expected one owning shard, got %d", did, owners)
+		}
+	}
+	for j, n := range owned {
+		if n < 800 || n > 1200 {
+			t.Errorf("shard %d: expected about a third of authors, got %d", j, n)
+		}
+	}
+
+	for _, shard := range shards {
+		if !shard.owns(common.CanaryDID) {
+			t.Errorf("shard %s: expected canaries owned by every shard", shard)
+		}
+	}
+	if !(ingestShard{index: 0, count: 1}).owns("did:plc:a") {
+		t.Error("expected an unsharded replica to own every author")
+	}
+}
+
+func TestIngestShard_StateFile(t *testing.T) {
+	shard := ingestShard{index: 2, count: 4}
+	for stateFile, expected := range map[string]string{
+		".jetstream_state.json":                  ".jetstream_shard2of4_state.json",
+		"gs://bucket/ingex/jetstream_state.json": "gs://bucket/ingex/jetstream_shard2of4_state.json",
+		"/var/lib/ingex/cursor.json":             "/var/lib/ingex/cursor_shard2of4.json",
+	} {
+		if got := shard.stateFile(stateFile); got != expected {
+			t.Errorf("%s: expected %s, got %s", stateFile, expected, got)
+		}
+	}
+	if got := (ingestShard{index: 0, count: 1}).stateFile(".jetstream_state.json"); got != ".jetstream_state.json" {
+		t.Errorf("expected an unsharded replica's state file kept, got %s", got)
+	}
+	// The account deletion queue follows the shard's state file
+	if got := account_deletion.StateFileFor(shard.stateFile(".jetstream_state.json")); got != ".jetstream_shard2of4_state_account_deletions.json" {
+		t.Errorf("unexpected account deletion state file %s", got)
+	}
+}
+
+func TestIngestShard_Validate(t *testing.T) {
+	for _, shard := range []ingestShard{{index: 0, count: 1}, {index: 3, count: 4}} {
+		if err := shard.validate(); err != nil {
+			t.Errorf("shard %s: expected valid, got %v", shard, err)
+		}
+	}
+	for _, shard := range []ingestShard{{index: 0, count: 0}, {index: 4, count: 4}, {index: -1, count: 4}} {
+		if err := shard.validate(); err == nil {
+			t.Errorf("shard %s: expected an error", shard)
+		}
+	}
+}
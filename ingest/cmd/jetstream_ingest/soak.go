@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/jetstream_ingest"
+)
+
+// runSoak ingests a synthetic firehose of rate events per second for
+// duration, then checks that no event was dropped, that the persisted cursor
+// is the last event's, that Elasticsearch holds exactly the likes and follows
+// it should, and that the live heap did not grow by more than maxHeapGrowth.
+// It reports whether every check passed. Run it against an empty cluster,
+// since every like and follow there is counted.
+func runSoak(ctx context.Context, config *common.Config, logger *common.IngestLogger, healthServer *common.HealthServer, duration time.Duration, rate int, maxHeapGrowth float64, dryRun, skipTLSVerify bool) bool {
+	logger.Info("Starting soak run: %d events/s for %s", rate, duration)
+
+	// Canary likes would be counted with the synthetic ones
+	config.CanaryInterval = 0
+
+	loadGen := jetstream_ingest.NewLoadGen(jetstream_ingest.DefaultLoadGenConfig(rate, duration), logger)
+	heap := jetstream_ingest.NewHeapSampler(duration)
+	sampleCtx, stopSampling := context.WithCancel(ctx)
+	go heap.Run(sampleCtx)
+
+	summary := runIngestion(ctx, config, logger, healthServer, loadGen, dryRun, skipTLSVerify, false, 0)
+	stopSampling()
+
+	result := jetstream_ingest.SoakResult{
+		Generated: loadGen.Stats(),
+		Received:  summary.received,
+		Processed: summary.processed,
+		Deleted:   summary.deleted,
+		Skipped:   summary.skipped,
+		Cursor:    -1,
+		Likes:     -1,
+		Follows:   -1,
+	}
+	result.HeapGrowth, result.HeapGrowthErr = heap.HeapGrowth()
+
+	if !dryRun {
+		// Read the cursor back as a restart would
+		stateManager, err := common.NewStateManager(config.JetstreamStateFile, logger)
+		if err != nil {
+			logger.Error("Failed to read cursor: %v", err)
+			return false
+		}
+		result.Cursor = stateManager.GetCursor().LastTimeUs
+
+		esClient, err := common.NewElasticsearchClient(common.ElasticsearchConfig{
+			URL:           config.ElasticsearchURL,
+			APIKey:        config.ElasticsearchAPIKey,
+			SkipTLSVerify: skipTLSVerify || config.ElasticsearchTLSSkipVerify,
+		}, logger)
+		if err != nil {
+			logger.Error("%v", err)
+			return false
+		}
+		countCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if result.Likes, err = countSoakDocs(countCtx, esClient, "likes"); err != nil {
+			logger.Error("Failed to count likes: %v", err)
+			return false
+		}
+		if result.Follows, err = countSoakDocs(countCtx, esClient, "follows"); err != nil {
+			logger.Error("Failed to count follows: %v", err)
+			return false
+		}
+	}
+
+	logger.Info("Soak run result: %+v", result)
+	failures := result.Failures(maxHeapGrowth)
+	for _, failure := range failures {
+		logger.Error("Soak check failed: %s", failure)
+	}
+	if len(failures) > 0 {
+		return false
+	}
+	logger.Info("Soak run passed: %d events in %s, live heap grew %.1f%%", result.Generated.Sent, duration, result.HeapGrowth*100)
+	return true
+}
+
+// countSoakDocs refreshes index and returns how many documents it holds
+func countSoakDocs(ctx context.Context, client *elasticsearch.Client, index string) (int64, error) {
+	res, err := client.Indices.Refresh(
+		client.Indices.Refresh.WithContext(ctx),
+		client.Indices.Refresh.WithIndex(index),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("refresh %s: %w", index, err)
+	}
+	_ = res.Body.Close()
+	if res.IsError() {
+		return 0, fmt.Errorf("refresh %s: %s", index, res.Status())
+	}
+
+	res, err = client.Count(
+		client.Count.WithContext(ctx),
+		client.Count.WithIndex(index),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("count %s: %w", index, err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.IsError() {
+		return 0, fmt.Errorf("count %s: %s", index, res.Status())
+	}
+
+	var response struct {
+		Count int64 `json:"count"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return 0, fmt.Errorf("decode %s count: %w", index, err)
+	}
+	return response.Count, nil
+}
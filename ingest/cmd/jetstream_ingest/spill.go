@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// spilledJob is the part of a batch job that is spooled to local disk while
+// Elasticsearch is unavailable (see common.Spill), and replayed as a job
+// once it recovers
+type spilledJob struct {
+	Likes            []common.LikeDoc            `json:"likes,omitempty"`
+	LikeTombstones   []common.LikeTombstoneDoc   `json:"like_tombstones,omitempty"`
+	LikeDeletes      []common.DeleteDoc          `json:"like_deletes,omitempty"`
+	Follows          []common.FollowDoc          `json:"follows,omitempty"`
+	FollowTombstones []common.FollowTombstoneDoc `json:"follow_tombstones,omitempty"`
+	FollowDeletes    []common.DeleteDoc          `json:"follow_deletes,omitempty"`
+	Posts            []spilledPost               `json:"posts,omitempty"`
+	PostDeletes      []common.DeleteDoc          `json:"post_deletes,omitempty"`
+	TimeUs           int64                       `json:"time_us"`
+}
+
+// spilledPost is a spooled fallback post with its version, which is not
+// part of the document
+type spilledPost struct {
+	Doc     common.PostDoc `json:"doc"`
+	Version int64          `json:"version"`
+}
+
+// spillPosts returns posts to spool
+func spillPosts(posts []common.PostDoc) []spilledPost {
+	if len(posts) == 0 {
+		return nil
+	}
+	spilled := make([]spilledPost, len(posts))
+	for i, post := range posts {
+		spilled[i] = spilledPost{Doc: post, Version: post.Version}
+	}
+	return spilled
+}
+
+// posts returns the spooled posts with their versions
+func (s spilledJob) posts() []common.PostDoc {
+	if len(s.Posts) == 0 {
+		return nil
+	}
+	posts := make([]common.PostDoc, len(s.Posts))
+	for i, spilled := range s.Posts {
+		posts[i] = spilled.Doc
+		posts[i].Version = spilled.Version
+	}
+	return posts
+}
+
+// spillJob returns all of job, to spool it without trying Elasticsearch
+func spillJob(job batchJob) spilledJob {
+	return spilledJob{
+		Likes:            job.batch,
+		LikeTombstones:   job.tombstoneBatch,
+		LikeDeletes:      job.deleteBatch,
+		Follows:          job.followBatch,
+		FollowTombstones: job.followTombstoneBatch,
+		FollowDeletes:    job.followDeleteBatch,
+		Posts:            spillPosts(job.postBatch),
+		PostDeletes:      job.postDeleteBatch,
+		TimeUs:           job.timeUs,
+	}
+}
+
+// empty reports whether there is nothing to spool
+func (s spilledJob) empty() bool {
+	return len(s.Likes) == 0 && len(s.LikeTombstones) == 0 && len(s.LikeDeletes) == 0 &&
+		len(s.Follows) == 0 && len(s.FollowTombstones) == 0 && len(s.FollowDeletes) == 0 &&
+		len(s.Posts) == 0 && len(s.PostDeletes) == 0
+}
+
+// job returns the batch job that replays s. Replayed jobs add nothing to the
+// batch stats, which counted them when they were first sent.
+func (s spilledJob) job() batchJob {
+	return batchJob{
+		batch:                s.Likes,
+		tombstoneBatch:       s.LikeTombstones,
+		deleteBatch:          s.LikeDeletes,
+		tombstoneCount:       len(s.LikeTombstones),
+		followBatch:          s.Follows,
+		followTombstoneBatch: s.FollowTombstones,
+		followDeleteBatch:    s.FollowDeletes,
+		postBatch:            s.posts(),
+		postDeleteBatch:      s.PostDeletes,
+		timeUs:               s.TimeUs,
+	}
+}
+
+// clusterAvailable returns a probe that succeeds once the cluster answers
+// and is not red, so spooled batches are replayed only when writes can land
+func clusterAvailable(client *elasticsearch.Client) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		res, err := client.Cluster.Health(client.Cluster.Health.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = res.Body.Close() }()
+		if res.IsError() {
+			return fmt.Errorf("cluster health returned %s", res.Status())
+		}
+		var health struct {
+			Status string `json:"status"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&health); err != nil {
+			return fmt.Errorf("failed to parse cluster health: %w", err)
+		}
+		if health.Status == "red" {
+			return fmt.Errorf("cluster health is red")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"golang.org/x/time/rate"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/megastream_ingest"
+)
+
+// backfillAliases are written through their backfill aliases (see
+// common.BackfillAlias) rather than the write aliases live ingest uses
+var backfillAliases = []string{"posts", "replies", "post_tombstones", "reply_tombstones"}
+
+func main() {
+	// Parse command line flags
+	from := flag.String("from", "", "Start of the range to backfill, RFC 3339 (required)")
+	to := flag.String("to", "", "End of the range to backfill, RFC 3339 (required)")
+	maxOpsPerSec := flag.Float64("max-ops-per-sec", 500, "Maximum bulk operations (documents written) per second")
+	batchSize := flag.Int("batch-size", 500, "Documents per bulk request")
+	dryRun := flag.Bool("dry-run", false, "Read the archive without writing to Elasticsearch")
+	skipTLSVerify := flag.Bool("skip-tls-verify", false, "Skip TLS certificate verification (use for local development only)")
+	debug := flag.Bool("debug", false, "Enable debug logging")
+	flag.Parse()
+
+	// Load configuration
+	config := common.LoadConfig()
+	logger := common.NewLogger(config.LoggingEnabled)
+	logger.SetService("megastream_backfill")
+	logger.SetDebugEnabled(*debug)
+	otelCollector, err := common.NewOTelMetricCollector("megastream-backfill", config.Environment, config.GCPProjectID, config.GCPRegion, config.MetricExportIntervalSec)
+	if err != nil {
+		logger.Error("Failed to create OTel metric collector: %v (continuing without metrics)", err)
+	} else {
+		logger.SetMetricCollector(otelCollector)
+		defer func() {
+			if err := otelCollector.Shutdown(context.Background()); err != nil {
+				logger.Error("Failed to shutdown OTel metric collector: %v", err)
+			}
+		}()
+	}
+
+	logger.Info("Green Earth Ingex - Megastream Backfill")
+
+	fromTime, err := time.Parse(time.RFC3339, *from)
+	if err != nil {
+		logger.Error("-from must be an RFC 3339 timestamp: %v", err)
+		os.Exit(1)
+	}
+	toTime, err := time.Parse(time.RFC3339, *to)
+	if err != nil {
+		logger.Error("-to must be an RFC 3339 timestamp: %v", err)
+		os.Exit(1)
+	}
+	if *maxOpsPerSec <= 0 || *batchSize <= 0 {
+		logger.Error("-max-ops-per-sec and -batch-size must be positive")
+		os.Exit(1)
+	}
+	if config.S3SQLiteDBBucket == "" {
+		logger.Error("GE_AWS_S3_BUCKET environment variable is required")
+		os.Exit(1)
+	}
+	if config.ElasticsearchURL == "" {
+		logger.Error("GE_ELASTICSEARCH_URL environment variable is required")
+		os.Exit(1)
+	}
+	if *dryRun {
+		logger.Info("Running in DRY-RUN mode - no writes to Elasticsearch")
+	}
+
+	// Setup context with cancellation for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Handle shutdown signals
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		logger.Info("Received signal %v, shutting down...", sig)
+		cancel()
+	}()
+
+	if err := runBackfill(ctx, config, logger, fromTime, toTime, *maxOpsPerSec, *batchSize, *dryRun, *skipTLSVerify); err != nil {
+		logger.Error("Backfill failed: %v", err)
+		logger.Metric("megastream_backfill.run_error_count", 1)
+		os.Exit(1)
+	}
+
+	logger.Metric("megastream_backfill.run_success_count", 1)
+	logger.Info("Backfill completed successfully")
+}
+
+func runBackfill(ctx context.Context, config *common.Config, logger *common.IngestLogger, from, to time.Time, maxOpsPerSec float64, batchSize int, dryRun, skipTLSVerify bool) error {
+	esClient, err := common.NewElasticsearchClient(common.ElasticsearchConfig{
+		URL:           config.ElasticsearchURL,
+		APIKey:        config.ElasticsearchAPIKey,
+		SkipTLSVerify: skipTLSVerify || config.ElasticsearchTLSSkipVerify,
+	}, logger)
+	if err != nil {
+		return err
+	}
+
+	deadLetters, err := common.NewDeadLetterQueue(ctx, config.DLQDestination, "megastream_backfill")
+	if err != nil {
+		return fmt.Errorf("failed to initialize dead-letter queue: %w", err)
+	}
+	defer func() { _ = deadLetters.Close() }()
+	logger.SetDeadLetterQueue(deadLetters)
+
+	tuningConfig, err := common.BulkTuningConfigFromConfig(config)
+	if err != nil {
+		return err
+	}
+
+	if !dryRun {
+		indices := make(map[string]string, len(backfillAliases))
+		for _, alias := range backfillAliases {
+			aliasCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			index, err := common.EnsureBackfillAlias(aliasCtx, esClient, alias, logger)
+			cancel()
+			if err != nil {
+				return err
+			}
+			indices[index] = alias
+			logger.Info("Backfilling %s through %s (index: %s)", alias, common.BackfillAlias(alias), index)
+		}
+
+		// Relax refresh and replicas on the backfilled indices while writing,
+		// restoring them however the backfill ends
+		if tuningConfig.Enabled() {
+			profile, err := common.IndexProfileFromConfig(config)
+			if err != nil {
+				return fmt.Errorf("invalid index configuration: %w", err)
+			}
+			indexManager := common.NewIndexManager(esClient, profile, backfillAliases, logger)
+			tuning, err := indexManager.TuneForBulk(ctx, "megastream_backfill", indices, tuningConfig)
+			defer tuning.Hold(ctx)()
+			if err != nil {
+				return fmt.Errorf("failed to tune indices for backfill: %w", err)
+			}
+		}
+	}
+
+	spooler, err := megastream_ingest.NewS3RangeSpooler(config.S3SQLiteDBBucket, config.S3SQLiteDBPrefix, config.AWSRegion, config.AWSS3AccessKey, config.AWSS3SecretKey, from, to, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create S3 spooler: %w", err)
+	}
+	logger.Info("Backfilling %s to %s at up to %.0f ops/sec", from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339), maxOpsPerSec)
+	if err := spooler.Start(ctx); err != nil {
+		return fmt.Errorf("failed to start spooler: %w", err)
+	}
+
+	b := &backfiller{
+		client:    esClient,
+		limiter:   rate.NewLimiter(rate.Limit(maxOpsPerSec), batchSize),
+		batchSize: batchSize,
+		dryRun:    dryRun,
+		logger:    logger,
+	}
+	for row := range spooler.GetRowChannel() {
+		b.add(ctx, row, config.Environment)
+	}
+
+	// The spooler stops early on cancellation; write what was read
+	flushCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	b.flush(flushCtx)
+
+	logger.Info("Backfill read %d rows: indexed %d, deleted %d, skipped %d, account deletions skipped %d, failed %d",
+		b.rows, b.indexed, b.deleted, b.skipped, b.accountDeletions, b.failed)
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("interrupted: %w", err)
+	}
+	if failedFiles := spooler.FailedFiles(); len(failedFiles) > 0 {
+		return fmt.Errorf("%d archive files could not be read: %v", len(failedFiles), failedFiles)
+	}
+	if b.failed > 0 {
+		return fmt.Errorf("%d documents failed to write", b.failed)
+	}
+	return nil
+}
+
+// backfiller batches archive rows and writes them through the backfill
+// aliases, no faster than its limiter allows
+type backfiller struct {
+	client    *elasticsearch.Client
+	limiter   *rate.Limiter
+	batchSize int
+	dryRun    bool
+	logger    *common.IngestLogger
+
+	posts      []common.PostDoc
+	replies    []common.ReplyDoc
+	inferences []common.InferenceDoc
+	tombstones []common.PostTombstoneDoc
+	deletes    []common.DeleteDoc
+
+	rows, indexed, deleted, skipped, accountDeletions, failed int
+}
+
+// add queues the writes for row, flushing when a batch is full. Rows are
+// handled like live ingest except that account deletions are left to the
+// live path, and hashtag counts and change events are not produced, since
+// replaying them is not idempotent.
+func (b *backfiller) add(ctx context.Context, row megastream_ingest.SQLiteRow, environment string) {
+	b.rows++
+	b.logger.Metric("megastream_backfill.inbound_count", 1)
+	msg := common.NewMegaStreamMessage(row.AtURI, row.DID, row.RawPost, row.Inferences, b.logger)
+
+	switch {
+	case msg.IsAccountDeletion():
+		b.accountDeletions++
+		b.logger.Metric("megastream_backfill.account_deletion_skipped_count", 1)
+		b.logger.Info("Skipping account deletion for %s from %s; run it through live ingest or delete the account's documents separately", row.DID, row.SourceFilename)
+		return
+	case row.AtURI == "" || !common.ShouldSampleDID(row.DID, environment):
+		b.skipped++
+		return
+	case msg.IsDelete():
+		b.tombstones = append(b.tombstones, common.CreatePostTombstoneDoc(msg))
+		b.deletes = append(b.deletes, common.DeleteDoc{DocID: msg.GetAtURI(), AuthorDID: msg.GetAuthorDID(), Version: msg.GetTimeUs()})
+	default:
+		post := common.PostFromMegaStream(msg)
+		// The event time versions the documents, so replaying an older
+		// file does not overwrite newer edits
+		if post.IsReply() {
+			doc := common.NewReplyDoc(post)
+			doc.Version = msg.GetTimeUs()
+			b.replies = append(b.replies, doc)
+		} else {
+			doc := common.NewPostDoc(post)
+			doc.Version = msg.GetTimeUs()
+			b.posts = append(b.posts, doc)
+		}
+		if row.Inferences != "" && row.Inferences != "{}" {
+			b.inferences = append(b.inferences, common.InferenceDoc{
+				AtURI:      row.AtURI,
+				Inferences: json.RawMessage(row.Inferences),
+				IndexedAt:  post.IndexedAt,
+			})
+		}
+	}
+
+	if len(b.posts)+len(b.replies) >= b.batchSize || len(b.deletes) >= b.batchSize {
+		b.flush(ctx)
+	}
+}
+
+// flush writes every queued batch. Creations are written before deletions
+// so a post created and deleted within the range ends up deleted.
+func (b *backfiller) flush(ctx context.Context) {
+	if len(b.posts) > 0 && b.write(ctx, len(b.posts), "posts", func() error {
+		return common.BulkIndex(ctx, b.client, common.BackfillAlias("posts"), b.posts, b.dryRun, b.logger)
+	}) {
+		b.indexed += len(b.posts)
+	}
+	if len(b.replies) > 0 && b.write(ctx, len(b.replies), "replies", func() error {
+		return common.BulkIndex(ctx, b.client, common.BackfillAlias("replies"), b.replies, b.dryRun, b.logger)
+	}) {
+		b.indexed += len(b.replies)
+	}
+	if len(b.inferences) > 0 {
+		b.write(ctx, len(b.inferences), "inferences", func() error {
+			return common.BulkIndexInferences(ctx, b.client, "inferences", b.inferences, b.dryRun, b.logger)
+		})
+	}
+	if len(b.deletes) > 0 {
+		ok := true
+		for _, alias := range []string{"post_tombstones", "reply_tombstones"} {
+			ok = b.write(ctx, len(b.tombstones), alias, func() error {
+				return common.BulkIndexPostTombstones(ctx, b.client, common.BackfillAlias(alias), b.tombstones, b.dryRun, b.logger)
+			}) && ok
+		}
+		for _, alias := range []string{"posts", "replies"} {
+			ok = b.write(ctx, len(b.deletes), alias+" deletes", func() error {
+				return common.BulkDelete(ctx, b.client, common.BackfillAlias(alias), b.deletes, b.dryRun, b.logger)
+			}) && ok
+		}
+		if ok {
+			b.deleted += len(b.deletes)
+		}
+	}
+
+	b.posts, b.replies, b.inferences = b.posts[:0], b.replies[:0], b.inferences[:0]
+	b.tombstones, b.deletes = b.tombstones[:0], b.deletes[:0]
+}
+
+// write waits until ops operations fit the rate limit and then calls fn,
+// reporting whether it succeeded
+func (b *backfiller) write(ctx context.Context, ops int, what string, fn func() error) bool {
+	for remaining := ops; remaining > 0; remaining -= b.batchSize {
+		if err := b.limiter.WaitN(ctx, min(remaining, b.batchSize)); err != nil {
+			b.logger.Error("Stopped before writing %d %s: %v", ops, what, err)
+			b.failed += ops
+			return false
+		}
+	}
+	if err := fn(); err != nil {
+		b.logger.Error("Failed to write %d %s: %v", ops, what, err)
+		b.failed += ops
+		b.logger.Metric("megastream_backfill.write_error_count", 1)
+		return false
+	}
+	b.logger.Metric("megastream_backfill.written_count", float64(ops))
+	return true
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"golang.org/x/time/rate"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/megastream_ingest"
+)
+
+func TestBackfiller_RoutesRows(t *testing.T) {
+	b := &backfiller{
+		limiter:   rate.NewLimiter(rate.Inf, 10),
+		batchSize: 10,
+		dryRun:    true,
+		logger:    common.NewLogger(false),
+	}
+	rows := []megastream_ingest.SQLiteRow{
+		{AtURI: "at://did:plc:a/app.bsky.feed.post/1", DID: "did:plc:a",
+			RawPost: `{"message":{"commit":{"operation":"create","record":{"text":"hello","createdAt":"2026-03-10T00:00:00Z"}}}}`, Inferences: `{"topic":"news"}`},
+		{AtURI: "at://did:plc:a/app.bsky.feed.post/2", DID: "did:plc:a",
+			RawPost: `{"message":{"commit":{"operation":"create","record":{"text":"reply"}}},"hydrated_metadata":{"parent_post":{"uri":"at://did:plc:a/app.bsky.feed.post/1"}}}`, Inferences: "{}"},
+		{AtURI: "at://did:plc:a/app.bsky.feed.post/3", DID: "did:plc:a",
+			RawPost: `{"message":{"commit":{"operation":"delete"}}}`},
+		{DID: "did:plc:b", RawPost: `{"message":{"kind":"account","account":{"active":false,"status":"deleted","did":"did:plc:b"}}}`},
+		{DID: "did:plc:c", RawPost: `{"message":{"commit":{"operation":"create"}}}`},
+	}
+	for _, row := range rows {
+		b.add(context.Background(), row, "prod")
+	}
+
+	if len(b.posts) != 1 || len(b.replies) != 1 || len(b.inferences) != 1 || len(b.deletes) != 1 {
+		t.Fatalf("unexpected batches: %d posts, %d replies, %d inferences, %d deletes", len(b.posts), len(b.replies), len(b.inferences), len(b.deletes))
+	}
+	if b.accountDeletions != 1 || b.skipped != 1 {
+		t.Errorf("expected 1 account deletion and 1 skipped row, got %d and %d", b.accountDeletions, b.skipped)
+	}
+
+	b.flush(context.Background())
+	if b.indexed != 2 || b.deleted != 1 || b.failed != 0 {
+		t.Errorf("unexpected totals: indexed %d, deleted %d, failed %d", b.indexed, b.deleted, b.failed)
+	}
+	if len(b.posts)+len(b.replies)+len(b.deletes) != 0 {
+		t.Error("expected flush to empty the batches")
+	}
+}
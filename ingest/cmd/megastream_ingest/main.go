@@ -17,14 +17,18 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/account_deletion"
 	"github.com/greenearth/ingest/internal/common"
 	"github.com/greenearth/ingest/internal/inference"
 	"github.com/greenearth/ingest/internal/megastream_ingest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func main() {
 	// Parse command line flags
 	dryRun := flag.Bool("dry-run", false, "Run in dry-run mode (no writes to Elasticsearch)")
+	createOnly := flag.Bool("create-only", false, "Index with op_type=create so documents already indexed are skipped, not overwritten (for replays and backfills)")
 	skipTLSVerify := flag.Bool("skip-tls-verify", false, "Skip TLS certificate verification (use for local development only)")
 	source := flag.String("source", "local", "Source of SQLite files: 'local' or 's3'")
 	mode := flag.String("mode", "once", "Ingestion mode: 'once' or 'spool'")
@@ -37,6 +41,7 @@ func main() {
 	// Load configuration
 	config := common.LoadConfig()
 	logger := common.NewLogger(config.LoggingEnabled)
+	logger.SetService("megastream_ingest")
 	logger.SetDebugEnabled(*debug)
 	otelCollector, otelErr := common.NewOTelMetricCollector("megastream-ingest", config.Environment, config.GCPProjectID, config.GCPRegion, config.MetricExportIntervalSec)
 	if otelErr != nil {
@@ -49,11 +54,25 @@ func main() {
 			}
 		}()
 	}
+	tracerProvider, tracerErr := common.NewTracerProvider(context.Background(), "megastream-ingest", config)
+	if tracerErr != nil {
+		logger.Error("Failed to create tracer provider: %v (continuing without tracing)", tracerErr)
+	} else if tracerProvider != nil {
+		defer func() {
+			if err := tracerProvider.Shutdown(context.Background()); err != nil {
+				logger.Error("Failed to shutdown tracer provider: %v", err)
+			}
+		}()
+	}
 
 	logger.Info("Green Earth Ingex - BlueSky Ingest Service")
 	if *dryRun {
 		logger.Info("Running in DRY-RUN mode - no writes to Elasticsearch")
 	}
+	logger.SetCreateOnly(*createOnly)
+	if *createOnly {
+		logger.Info("Create-only mode - documents already indexed are skipped, not overwritten")
+	}
 	if *noRewind {
 		logger.Info("Rewind disabled - starting from current time")
 	}
@@ -71,6 +90,7 @@ func main() {
 		logger.Error("Failed to create health check server: %v", err)
 		os.Exit(1)
 	}
+	healthServer.SetMaxLag(config.MaxIngestLag)
 	go func() {
 		if err := healthServer.Start(ctx); err != nil {
 			logger.Error("Health server failed: %v", err)
@@ -78,6 +98,17 @@ func main() {
 		}
 	}()
 
+	// Track ingest SLOs from the metrics above; the report is served at /slo
+	sloTracker, err := common.NewSLOTracker(ctx, "megastream_ingest", common.SLOConfigFromConfig(config), logger)
+	if err != nil {
+		logger.Error("Failed to initialize SLO tracker: %v", err)
+		os.Exit(1)
+	}
+	defer func() { _ = sloTracker.Close() }()
+	sloTracker.Attach(logger)
+	healthServer.Handle("/slo", sloTracker)
+	go sloTracker.Run(ctx, time.Minute)
+
 	// Handle signals for graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -132,6 +163,22 @@ func runIngestion(ctx context.Context, config *common.Config, logger *common.Ing
 		}
 	}
 
+	// Initialize Elasticsearch client
+	esConfig := common.ElasticsearchConfig{
+		URL:           config.ElasticsearchURL,
+		APIKey:        config.ElasticsearchAPIKey,
+		SkipTLSVerify: skipTLSVerify || config.ElasticsearchTLSSkipVerify,
+	}
+
+	esClient, err := common.NewElasticsearchClient(esConfig, logger)
+	if err != nil {
+		return err
+	}
+	logger.SetAuditLog(common.NewAuditLog(esClient, config))
+	common.CheckAPIKeyPrivileges(ctx, esClient, "megastream_ingest", config, logger)
+	common.MonitorClockSkew(ctx, esClient, config, logger)
+	common.CheckRouting(ctx, esClient, []string{"posts", "replies"}, logger)
+
 	// Initialize state manager
 	stateManager, err := common.NewStateManager(config.MegastreamStateFile, logger)
 	if err != nil {
@@ -149,21 +196,21 @@ func runIngestion(ctx context.Context, config *common.Config, logger *common.Ing
 	// Handle cursor initialization based on flags
 	if noRewind {
 		// If no-rewind is enabled, update cursor to current time (service start time)
-		currentTime := time.Now().UnixMicro()
-		if err := stateManager.UpdateCursor(currentTime); err != nil {
+		currentTime := common.CorrectedNow().UnixMicro()
+		if err := stateManager.OverrideCursor(ctx, currentTime, "no-rewind"); err != nil {
 			return fmt.Errorf("failed to update cursor for no-rewind mode: %w", err)
 		}
 		logger.Info("No-rewind mode: set cursor to service start time: %d", currentTime)
 	} else if maxRewindMinutes > 0 {
 		// Apply max-rewind limit if specified
 		if cursor := stateManager.GetCursor(); cursor != nil {
-			currentTime := time.Now().UnixMicro()
+			currentTime := common.CorrectedNow().UnixMicro()
 			maxRewindUs := int64(maxRewindMinutes) * 60 * 1000000 // Convert minutes to microseconds
 			minAllowedTime := currentTime - maxRewindUs
 
 			if cursor.LastTimeUs < minAllowedTime {
 				logger.Info("Cursor %d is older than max-rewind limit (%d minutes), clamping to %d", cursor.LastTimeUs, maxRewindMinutes, minAllowedTime)
-				if err := stateManager.UpdateCursor(minAllowedTime); err != nil {
+				if err := stateManager.OverrideCursor(ctx, minAllowedTime, fmt.Sprintf("max-rewind of %d minutes", maxRewindMinutes)); err != nil {
 					return fmt.Errorf("failed to update cursor for max-rewind limit: %w", err)
 				}
 			}
@@ -187,7 +234,7 @@ func runIngestion(ctx context.Context, config *common.Config, logger *common.Ing
 		if mostRecentFileTime > 0 {
 			// Set cursor to just before the most recent file so it gets processed
 			cursorTime := mostRecentFileTime - 1
-			if err := stateManager.UpdateCursor(cursorTime); err != nil {
+			if err := stateManager.OverrideCursor(ctx, cursorTime, "startup-with-last-file"); err != nil {
 				return fmt.Errorf("failed to update cursor for startup-with-last-file mode: %w", err)
 			}
 			logger.Info("Startup-with-last-file mode: set cursor to %d to process most recent file", cursorTime)
@@ -201,17 +248,24 @@ func runIngestion(ctx context.Context, config *common.Config, logger *common.Ing
 		}
 	}
 
-	// Initialize Elasticsearch client
-	esConfig := common.ElasticsearchConfig{
-		URL:           config.ElasticsearchURL,
-		APIKey:        config.ElasticsearchAPIKey,
-		SkipTLSVerify: skipTLSVerify || config.ElasticsearchTLSSkipVerify,
+	deadLetters, err := common.NewDeadLetterQueue(ctx, config.DLQDestination, "megastream_ingest")
+	if err != nil {
+		return fmt.Errorf("failed to initialize dead-letter queue: %w", err)
 	}
+	defer func() { _ = deadLetters.Close() }()
+	logger.SetDeadLetterQueue(deadLetters)
 
-	esClient, err := common.NewElasticsearchClient(esConfig, logger)
+	malformed, err := common.NewMalformedRows(common.StrictnessConfigFromConfig(config), "megastream", logger)
 	if err != nil {
 		return err
 	}
+	logger.Info("Malformed rows: %s", malformed.Mode())
+
+	denyList, err := common.NewDenyList(ctx, config.DenyListSource, esClient, logger)
+	if err != nil {
+		return fmt.Errorf("failed to load deny list: %w", err)
+	}
+	go denyList.Run(ctx, config.DenyListReloadInterval)
 
 	if config.InferenceBaseURL == "" && !dryRun {
 		return fmt.Errorf("GE_INFERENCE_BASE_URL is required (use --dry-run to skip inference)")
@@ -233,42 +287,65 @@ func runIngestion(ctx context.Context, config *common.Config, logger *common.Ing
 		logger.Info("Post-tower embeddings disabled (dry-run)")
 	}
 
-	// Ensure period-based indices exist and are the write target for posts and
-	// post_tombstones. Runs at startup and every minute so that period rollovers
-	// are detected promptly without waiting for the next batch flush.
+	var changeFeed *common.ChangeFeed
 	if !dryRun {
-		ensureIndices := func() error {
-			indexCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-			defer cancel()
-			for _, alias := range []string{"posts", "post_tombstones", "replies", "reply_tombstones"} {
-				name := common.CurrentIndexName(alias, config.IndexPeriod)
-				if err := common.EnsureIndex(indexCtx, esClient, name, alias, logger); err != nil {
-					return fmt.Errorf("failed to ensure index for %s: %w", alias, err)
-				}
-			}
-			return nil
+		changeFeed, err = common.NewPubSubChangeFeed(ctx, config.GCPProjectID, config.ChangeFeedTopic, config.ChangeFeedEncoding, logger)
+		if err != nil {
+			return fmt.Errorf("failed to initialize change feed: %w", err)
+		}
+	}
+
+	// Reply and quote count changes of the posts that indexed and deleted
+	// posts reference are aggregated across batches and applied periodically
+	postCounts := common.NewPostCounter(esClient, common.PostCountConfigFromConfig(config), dryRun, logger)
+	postCountCtx, stopPostCounts := context.WithCancel(ctx)
+	defer stopPostCounts()
+	postCountsDone := make(chan struct{})
+	go func() {
+		defer close(postCountsDone)
+		postCounts.Run(postCountCtx)
+	}()
+
+	// Account status changes are upserted into the accounts index
+	// periodically; the last ones are flushed at shutdown
+	accountStatuses := common.NewAccountStatusWriter(esClient, common.AccountsIndex, 0, dryRun, logger)
+	accountStatusCtx, stopAccountStatuses := context.WithCancel(ctx)
+	defer stopAccountStatuses()
+	accountStatusesDone := make(chan struct{})
+	go func() {
+		defer close(accountStatusesDone)
+		accountStatuses.Run(accountStatusCtx)
+	}()
+
+	// Ensure the current indices exist and are the write target for posts and
+	// post_tombstones (through their write aliases). Runs at startup and every
+	// minute so that period changes and rollovers are picked up promptly
+	// without waiting for the next batch flush.
+	if !dryRun {
+		indexProfile, err := common.IndexProfileFromConfig(config)
+		if err != nil {
+			return fmt.Errorf("invalid index configuration: %w", err)
 		}
+		indexManager := common.NewIndexManager(esClient, indexProfile, []string{"posts", "post_tombstones", "replies", "reply_tombstones"}, logger)
 
-		if err := ensureIndices(); err != nil {
+		indexCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err = indexManager.EnsureCurrent(indexCtx)
+		cancel()
+		if err != nil {
 			return err
 		}
 
-		go func() {
-			ticker := time.NewTicker(time.Minute)
-			defer ticker.Stop()
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case <-ticker.C:
-					if err := ensureIndices(); err != nil {
-						logger.Error("%v", err)
-					}
-				}
-			}
-		}()
+		go indexManager.Maintain(ctx, time.Minute)
 	}
 
+	// Pause intake and shrink batches before the heap reaches the container
+	// limit, so backlogs slow ingestion down instead of OOM-killing the pod
+	memoryGuard, err := common.NewMemoryGuard(common.MemoryConfigFromConfig(config), "megastream", logger)
+	if err != nil {
+		return err
+	}
+	go memoryGuard.Run(ctx, time.Second)
+
 	// Initialize spooler
 	var spooler megastream_ingest.Spooler
 	interval := time.Duration(config.SpoolIntervalSec) * time.Second
@@ -282,33 +359,147 @@ func runIngestion(ctx context.Context, config *common.Config, logger *common.Ing
 		}
 	}
 
+	spooler.SetMemoryGuard(memoryGuard)
+	cursorWrites := common.CursorWritePolicyFromConfig(config, 0)
+	spooler.SetCursorWritePolicy(cursorWrites)
+	logger.Info("Writing the cursor %s", cursorWrites)
+	if err := spooler.SetCatchUp(megastream_ingest.CatchUpConfigFromConfig(config)); err != nil {
+		return err
+	}
+
 	// Start spooler
 	if err := spooler.Start(ctx); err != nil {
 		return fmt.Errorf("failed to start spooler: %w", err)
 	}
 
+	// Deleted accounts are purged off the main loop, so scrolling through an
+	// account's documents does not hold up batches. Deletions left unfinished
+	// by a crash or shutdown resume here.
+	accounts := account_deletion.NewService(esClient, account_deletion.Config{
+		StateFile:    account_deletion.StateFileFor(config.MegastreamStateFile),
+		MetricPrefix: "megastream",
+		PostCounts:   postCounts,
+		ChangeFeed:   changeFeed,
+		DryRun:       dryRun,
+	}, logger)
+	if err := accounts.Start(); err != nil {
+		return fmt.Errorf("failed to resume account deletions: %w", err)
+	}
+
 	// Mark service as healthy once we've successfully started the spooler
 	healthServer.SetHealthy(true, fmt.Sprintf("Processing %s data in %s mode", source, mode))
 
 	// Process rows from spooler
 	rowChan := spooler.GetRowChannel()
-	var msgs []common.MegaStreamMessage
+	// Posts and post deletions are batched separately. A batch is flushed
+	// when it is full or, on a quiet stream, once its first row has waited
+	// MaxAge. Batches shrink while memory is throttled.
+	batchConfig := common.BatchConfigFromConfig(config, 512)
+	posts := common.NewBatcher[common.MegaStreamMessage](batchConfig)
+	posts.Limit = memoryGuard.BatchSize
+	tombstones := common.NewBatcher[common.PostTombstoneDoc](batchConfig)
+	tombstones.Limit = memoryGuard.BatchSize
 	var inferencesBatch []common.InferenceDoc
-	var tombstoneBatch []common.PostTombstoneDoc
-	var deleteBatch []common.DeleteDoc
 	var hashtagUpdates []common.HashtagUpdate
-	const batchSize = 512
 	var pendingFlush *pendingPostFlush
 	processedCount := 0
 	deletedCount := 0
 	skippedCount := 0
 	hashtagCount := 0
+	var haltErr error
+
+	var flushTick <-chan time.Time
+	if tick := batchConfig.TickInterval(); tick > 0 {
+		flushTicker := time.NewTicker(tick)
+		defer flushTicker.Stop()
+		flushTick = flushTicker.C
+	}
+
+	// flushPosts dispatches the post batch, with its inferences and hashtags,
+	// and reports false if a newer instance has started
+	flushPosts := func() bool {
+		// Drain the previous async post flush and process its result before
+		// dispatching the next batch. By the time a new batch has filled,
+		// the previous inference + ES write has had the entire fill window
+		// to complete concurrently.
+		if pendingFlush != nil {
+			flushCount, flushLastMsg := drainPendingFlush(pendingFlush)
+			pendingFlush = nil
+			processedCount += flushCount
+			if flushLastMsg != nil && flushLastMsg.GetTimeUs() > 0 {
+				common.RecordFreshness(flushLastMsg.GetTimeUs(), logger)
+			}
+			if processedCount%1000 == 0 {
+				if stateManager.CheckForNewerInstance(myStartTime) {
+					logger.Info("Newer instance detected, exiting")
+					return false
+				}
+			}
+			if dryRun {
+				logger.Debug("Dry-run: Would index batch: %d documents (total: %d, deleted: %d, skipped: %d)", flushCount, processedCount, deletedCount, skippedCount)
+			} else {
+				logger.Debug("Indexed batch: %d documents (total: %d, deleted: %d, skipped: %d)", flushCount, processedCount, deletedCount, skippedCount)
+			}
+			if flushCount > 0 && (processedCount/flushCount%100) == 0 {
+				logger.Info("Progress: %d documents processed (deleted: %d, skipped: %d)", processedCount, deletedCount, skippedCount)
+			}
+		}
+
+		// Take hands the batch's slice to the goroutine; later appends go to
+		// a fresh backing array so they don't race with it.
+		pendingFlush = dispatchIndexPosts(posts.Take(), esClient, embedder, changeFeed, postCounts, dryRun, logger)
+
+		// Flush inferences and hashtags synchronously — they are fast
+		// (no inference service call) and should stay ordered with posts.
+		batchCtx, cancelBatchCtx := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancelBatchCtx()
+
+		if len(inferencesBatch) > 0 {
+			if err := common.BulkIndexInferences(batchCtx, esClient, "inferences", inferencesBatch, dryRun, logger); err != nil {
+				logger.Error("Failed to bulk index inferences: %v", err)
+			} else if dryRun {
+				logger.Debug("Dry-run: Would index %d inference docs", len(inferencesBatch))
+			} else {
+				logger.Debug("Indexed %d inference docs", len(inferencesBatch))
+			}
+			inferencesBatch = inferencesBatch[:0]
+		}
+
+		if len(hashtagUpdates) > 0 {
+			if err := common.BulkUpdateHashtagCounts(batchCtx, esClient, "hashtags", hashtagUpdates, dryRun, logger); err != nil {
+				logger.Error("Failed to bulk update hashtag counts: %v", err)
+			} else {
+				hashtagCount += len(hashtagUpdates)
+				if dryRun {
+					logger.Debug("Dry-run: Would update %d hashtag counts (total: %d)", len(hashtagUpdates), hashtagCount)
+				} else {
+					logger.Debug("Updated %d hashtag counts (total: %d)", len(hashtagUpdates), hashtagCount)
+				}
+			}
+			hashtagUpdates = hashtagUpdates[:0]
+		}
+		return true
+	}
+
+	// flushTombstones writes the post deletion batch
+	flushTombstones := func() {
+		batchCtx, cancelBatchCtx := context.WithTimeout(context.Background(), 30*time.Second)
+		deletedCount += deletePosts(batchCtx, esClient, tombstones.Take(), changeFeed, postCounts, dryRun, logger)
+		cancelBatchCtx()
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			logger.Info("Shutdown signal received, stopping ingestion")
 			goto cleanup
+		case <-flushTick:
+			if posts.Due() && !flushPosts() {
+				goto cleanup
+			}
+			if tombstones.Due() {
+				flushTombstones()
+			}
 		case row, ok := <-rowChan:
 			if !ok {
 				logger.Info("Spooler channel closed, finishing remaining batch")
@@ -316,10 +507,31 @@ func runIngestion(ctx context.Context, config *common.Config, logger *common.Ing
 			}
 
 			logger.Metric("megastream.inbound_count", 1)
+			// Parse spans are children of the span of the file the row came from
+			_, parseSpan := common.StartSpan(trace.ContextWithSpanContext(ctx, row.SpanContext), "megastream.parse")
 			msg := common.NewMegaStreamMessage(row.AtURI, row.DID, row.RawPost, row.Inferences, logger)
+			common.EndSpan(parseSpan, msg.ParseError())
 
-			// Skip rows with empty at_uri unless it's an account deletion event
-			if row.AtURI == "" && !msg.IsAccountDeletion() {
+			if err := msg.ParseError(); err != nil {
+				skippedCount++
+				if haltErr = malformed.Malformed(ctx, row.AtURI, []byte(row.RawPost), fmt.Errorf("%s: %w", row.SourceFilename, err)); haltErr != nil {
+					logger.Error("Halting ingestion: %v", haltErr)
+					healthServer.SetHealthy(false, haltErr.Error())
+					goto cleanup
+				}
+				continue
+			}
+			malformed.Valid()
+			healthServer.RecordEvent("megastream", msg.GetTimeUs())
+
+			// Deletions still apply so documents indexed before a DID was denied are removed
+			if !msg.IsDelete() && !msg.IsAccountDeletion() && denyList.Denied(common.DenyStageIngest, row.DID, row.AtURI) {
+				skippedCount++
+				continue
+			}
+
+			// Skip rows with empty at_uri unless it's an account event
+			if row.AtURI == "" && !msg.IsAccountEvent() {
 				logger.Debug("Skipping row with empty at_uri from file %s (did: %s)", row.SourceFilename, row.DID)
 				skippedCount++
 				continue
@@ -331,6 +543,11 @@ func runIngestion(ctx context.Context, config *common.Config, logger *common.Ing
 				continue
 			}
 
+			// Every account event records the account's status
+			if msg.IsAccountEvent() {
+				accountStatuses.Add(common.AccountEventFromMegaStream(msg))
+			}
+
 			// Handle different event types with if-else chain
 			if msg.IsAccountDeletion() {
 				// Flush all pending batches before account deletion
@@ -345,9 +562,9 @@ func runIngestion(ctx context.Context, config *common.Config, logger *common.Ing
 				}
 
 				// Flush post creation batch
-				if len(msgs) > 0 {
+				if posts.Len() > 0 {
 					batchCtx, cancelBatchCtx := context.WithTimeout(context.Background(), 30*time.Second)
-					count := indexDocuments(batchCtx, msgs, esClient, embedder, dryRun, logger, "account deletion flush")
+					count := indexDocuments(batchCtx, posts.Take(), esClient, embedder, changeFeed, postCounts, dryRun, logger, "account deletion flush")
 					processedCount += count
 					// Check if a newer instance has started (every 1000 docs to avoid excessive GCS reads)
 					if processedCount%1000 == 0 {
@@ -362,7 +579,6 @@ func runIngestion(ctx context.Context, config *common.Config, logger *common.Ing
 					} else {
 						logger.Info("Indexed batch before account deletion: %d documents", count)
 					}
-					msgs = msgs[:0]
 
 					if len(inferencesBatch) > 0 {
 						if err := common.BulkIndexInferences(batchCtx, esClient, "inferences", inferencesBatch, dryRun, logger); err != nil {
@@ -379,56 +595,26 @@ func runIngestion(ctx context.Context, config *common.Config, logger *common.Ing
 				}
 
 				// Flush post deletion batch (tombstones + deletes)
-				if len(tombstoneBatch) > 0 {
-					batchCtx, cancelBatchCtx := context.WithTimeout(context.Background(), 30*time.Second)
-					var wg sync.WaitGroup
-					wg.Add(2)
-					go common.BulkIndexWorker(&wg, batchCtx, esClient, "post_tombstones", tombstoneBatch, dryRun, logger, common.BulkIndexPostTombstones, "index tombstones to")
-					go common.BulkIndexWorker(&wg, batchCtx, esClient, "reply_tombstones", tombstoneBatch, dryRun, logger, common.BulkIndexPostTombstones, "index tombstones to")
-					wg.Wait()
-					wg.Add(2)
-					go common.BulkIndexWorker(&wg, batchCtx, esClient, "posts", deleteBatch, dryRun, logger, common.BulkDelete, "delete from")
-					go common.BulkIndexWorker(&wg, batchCtx, esClient, "replies", deleteBatch, dryRun, logger, common.BulkDelete, "delete from")
-					wg.Wait()
-					deletedCount += len(deleteBatch)
-					tombstoneBatch = tombstoneBatch[:0]
-					deleteBatch = deleteBatch[:0]
-					cancelBatchCtx()
+				if tombstones.Len() > 0 {
+					flushTombstones()
 				}
 
-				// Now process account deletion
-				if err := handleAccountDeletion(ctx, msg, esClient, dryRun, logger, &deletedCount); err != nil {
-					logger.Error("Failed to handle account deletion for DID %s: %v", msg.GetAuthorDID(), err)
+				// Now queue the account deletion, which finds the flushed
+				// documents when it runs
+				if !accounts.Enqueue(ctx, msg.GetAuthorDID(), msg.GetTimeUs(), common.AccountDeletion{Posts: true, Likes: true}) {
+					goto cleanup
 				}
+			} else if msg.IsAccountEvent() {
+				// Other account status changes only update the accounts index
+				continue
 			} else if msg.IsDelete() {
 				// Post deletion - add to batch
-				tombstone := common.CreatePostTombstoneDoc(msg)
-				tombstoneBatch = append(tombstoneBatch, tombstone)
-				deleteBatch = append(deleteBatch, common.DeleteDoc{
-					DocID:     msg.GetAtURI(),
-					AuthorDID: msg.GetAuthorDID(),
-				})
-
-				if len(tombstoneBatch) >= batchSize {
-					batchCtx, cancelBatchCtx := context.WithTimeout(context.Background(), 30*time.Second)
-					var wg sync.WaitGroup
-					wg.Add(2)
-					go common.BulkIndexWorker(&wg, batchCtx, esClient, "post_tombstones", tombstoneBatch, dryRun, logger, common.BulkIndexPostTombstones, "index tombstones to")
-					go common.BulkIndexWorker(&wg, batchCtx, esClient, "reply_tombstones", tombstoneBatch, dryRun, logger, common.BulkIndexPostTombstones, "index tombstones to")
-					wg.Wait()
-					wg.Add(2)
-					go common.BulkIndexWorker(&wg, batchCtx, esClient, "posts", deleteBatch, dryRun, logger, common.BulkDelete, "delete from")
-					go common.BulkIndexWorker(&wg, batchCtx, esClient, "replies", deleteBatch, dryRun, logger, common.BulkDelete, "delete from")
-					wg.Wait()
-					deletedCount += len(deleteBatch)
-
-					tombstoneBatch = tombstoneBatch[:0]
-					deleteBatch = deleteBatch[:0]
-					cancelBatchCtx()
+				if tombstones.Add(common.CreatePostTombstoneDoc(msg), len(row.RawPost)) {
+					flushTombstones()
 				}
 			} else {
 				// Post creation - accumulate messages first
-				msgs = append(msgs, msg)
+				full := posts.Add(msg, len(row.RawPost)+len(row.Inferences))
 
 				// Accumulate inference doc if inferences data is present
 				if row.Inferences != "" && row.Inferences != "{}" {
@@ -443,70 +629,8 @@ func runIngestion(ctx context.Context, config *common.Config, logger *common.Ing
 				hashtags := common.ExtractHashtags(msg.GetContent(), msg.GetCreatedAt())
 				hashtagUpdates = append(hashtagUpdates, hashtags...)
 
-				if len(msgs) >= batchSize {
-					// Drain the previous async post flush and process its result before
-					// dispatching the next batch. By the time a new batch has filled
-					// (batchSize rows), the previous inference + ES write has had the
-					// entire fill window to complete concurrently.
-					if pendingFlush != nil {
-						flushCount, flushLastMsg := drainPendingFlush(pendingFlush)
-						pendingFlush = nil
-						processedCount += flushCount
-						if flushLastMsg != nil && flushLastMsg.GetTimeUs() > 0 {
-							logger.Metric("freshness_sec", float64(common.CalculateFreshness(flushLastMsg.GetTimeUs())))
-						}
-						if processedCount%1000 == 0 {
-							if stateManager.CheckForNewerInstance(myStartTime) {
-								logger.Info("Newer instance detected, exiting")
-								goto cleanup
-							}
-						}
-						if dryRun {
-							logger.Debug("Dry-run: Would index batch: %d documents (total: %d, deleted: %d, skipped: %d)", flushCount, processedCount, deletedCount, skippedCount)
-						} else {
-							logger.Debug("Indexed batch: %d documents (total: %d, deleted: %d, skipped: %d)", flushCount, processedCount, deletedCount, skippedCount)
-						}
-						if flushCount > 0 && (processedCount/flushCount%100) == 0 {
-							logger.Info("Progress: %d documents processed (deleted: %d, skipped: %d)", processedCount, deletedCount, skippedCount)
-						}
-					}
-
-					// Transfer slice ownership to the goroutine; give the main loop a
-					// fresh backing array so appends don't race with the goroutine.
-					batchMsgs := msgs
-					msgs = make([]common.MegaStreamMessage, 0, batchSize)
-					pendingFlush = dispatchIndexPosts(batchMsgs, esClient, embedder, dryRun, logger)
-
-					// Flush inferences and hashtags synchronously — they are fast
-					// (no inference service call) and should stay ordered with posts.
-					batchCtx, cancelBatchCtx := context.WithTimeout(context.Background(), 30*time.Second)
-
-					if len(inferencesBatch) > 0 {
-						if err := common.BulkIndexInferences(batchCtx, esClient, "inferences", inferencesBatch, dryRun, logger); err != nil {
-							logger.Error("Failed to bulk index inferences: %v", err)
-						} else if dryRun {
-							logger.Debug("Dry-run: Would index %d inference docs", len(inferencesBatch))
-						} else {
-							logger.Debug("Indexed %d inference docs", len(inferencesBatch))
-						}
-						inferencesBatch = inferencesBatch[:0]
-					}
-
-					if len(hashtagUpdates) > 0 {
-						if err := common.BulkUpdateHashtagCounts(batchCtx, esClient, "hashtags", hashtagUpdates, dryRun, logger); err != nil {
-							logger.Error("Failed to bulk update hashtag counts: %v", err)
-						} else {
-							hashtagCount += len(hashtagUpdates)
-							if dryRun {
-								logger.Debug("Dry-run: Would update %d hashtag counts (total: %d)", len(hashtagUpdates), hashtagCount)
-							} else {
-								logger.Debug("Updated %d hashtag counts (total: %d)", len(hashtagUpdates), hashtagCount)
-							}
-						}
-						hashtagUpdates = hashtagUpdates[:0]
-					}
-
-					cancelBatchCtx()
+				if full && !flushPosts() {
+					goto cleanup
 				}
 			}
 		}
@@ -524,8 +648,8 @@ cleanup:
 	}
 
 	// Index remaining documents in batch
-	if len(msgs) > 0 {
-		count := indexDocuments(cleanupCtx, msgs, esClient, embedder, dryRun, logger, "cleanup")
+	if posts.Len() > 0 {
+		count := indexDocuments(cleanupCtx, posts.Docs(), esClient, embedder, changeFeed, postCounts, dryRun, logger, "cleanup")
 		processedCount += count
 		if dryRun {
 			logger.Debug("Dry-run: Would index final batch: %d documents", count)
@@ -560,21 +684,100 @@ cleanup:
 	}
 
 	// Index remaining tombstones and delete posts
-	if len(tombstoneBatch) > 0 {
-		var wg sync.WaitGroup
-		wg.Add(2)
-		go common.BulkIndexWorker(&wg, cleanupCtx, esClient, "post_tombstones", tombstoneBatch, dryRun, logger, common.BulkIndexPostTombstones, "index tombstones to")
-		go common.BulkIndexWorker(&wg, cleanupCtx, esClient, "reply_tombstones", tombstoneBatch, dryRun, logger, common.BulkIndexPostTombstones, "index tombstones to")
-		wg.Wait()
-		wg.Add(2)
-		go common.BulkIndexWorker(&wg, cleanupCtx, esClient, "posts", deleteBatch, dryRun, logger, common.BulkDelete, "delete from")
-		go common.BulkIndexWorker(&wg, cleanupCtx, esClient, "replies", deleteBatch, dryRun, logger, common.BulkDelete, "delete from")
-		wg.Wait()
-		deletedCount += len(deleteBatch)
+	if tombstones.Len() > 0 {
+		deletedCount += deletePosts(cleanupCtx, esClient, tombstones.Docs(), postCounts, dryRun, logger)
 	}
 
+	// Finish queued account deletions while their like count changes can
+	// still be applied; unfinished ones resume on the next start
+	accounts.Close(30 * time.Second)
+
+	// Apply the reply and quote count changes of the final batches
+	stopPostCounts()
+	<-postCountsDone
+	if err := postCounts.Flush(cleanupCtx); err != nil {
+		logger.Error("Failed to apply final post count changes: %v", err)
+	}
+
+	// Record the account statuses of the final batches
+	stopAccountStatuses()
+	<-accountStatusesDone
+	if err := accountStatuses.Flush(cleanupCtx); err != nil {
+		logger.Error("Failed to record final account statuses: %v", err)
+	}
+
+	malformed.Flush(cleanupCtx)
+
 	logger.Info("Spooler ingestion complete. Processed: %d, Deleted: %d, Skipped: %d, Hashtag updates: %d", processedCount, deletedCount, skippedCount, hashtagCount)
-	return nil
+	return haltErr
+}
+
+// deletePosts indexes tombstones for deleted posts and deletes the posts
+// from the posts and replies indices, taking them off the reply and quote
+// counts of the posts they referenced. Once both deletes succeed, a delete
+// event for each is published to changeFeed. It returns the number of
+// deletions.
+func deletePosts(ctx context.Context, esClient *elasticsearch.Client, tombstones []common.PostTombstoneDoc, changeFeed *common.ChangeFeed, postCounts *common.PostCounter, dryRun bool, logger *common.IngestLogger) int {
+	deleteBatch := make([]common.DeleteDoc, len(tombstones))
+	for i, tombstone := range tombstones {
+		deleteBatch[i] = common.DeleteDoc{DocID: tombstone.AtURI, AuthorDID: tombstone.AuthorDID, Version: tombstone.Version}
+	}
+
+	// The references are only known from the documents, so they are read
+	// before the documents are deleted
+	var references map[string]common.PostData
+	if !dryRun {
+		var err error
+		references, err = common.FetchPostReferences(ctx, esClient, "posts,replies", deleteBatch, logger)
+		if err != nil {
+			logger.Error("Failed to fetch references of deleted posts: %v", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go common.BulkIndexWorker(&wg, ctx, esClient, common.WriteAlias("post_tombstones"), tombstones, dryRun, logger, common.BulkIndexPostTombstones, "index tombstones to")
+	go common.BulkIndexWorker(&wg, ctx, esClient, common.WriteAlias("reply_tombstones"), tombstones, dryRun, logger, common.BulkIndexPostTombstones, "index tombstones to")
+	wg.Wait()
+	var postsErr, repliesErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if postsErr = common.BulkDelete(ctx, esClient, common.WriteAlias("posts"), deleteBatch, dryRun, logger); postsErr != nil {
+			logger.Error("Failed to delete from %s: %v", common.WriteAlias("posts"), postsErr)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if repliesErr = common.BulkDelete(ctx, esClient, common.WriteAlias("replies"), deleteBatch, dryRun, logger); repliesErr != nil {
+			logger.Error("Failed to delete from %s: %v", common.WriteAlias("replies"), repliesErr)
+		}
+	}()
+	wg.Wait()
+	if postsErr == nil && repliesErr == nil {
+		changeFeed.Publish(ctx, postDeleteChangeEvents(tombstones, references))
+	}
+
+	for _, post := range references {
+		postCounts.AddReferences(post.ThreadParentPost, post.ThreadRootPost, post.QuotePost, -1)
+	}
+	return len(deleteBatch)
+}
+
+// postDeleteChangeEvents builds the delete events for tombstones, typed as
+// replies where references shows the deleted document was one. A post whose
+// document was never indexed, or whose references could not be read, is
+// reported as a post.
+func postDeleteChangeEvents(tombstones []common.PostTombstoneDoc, references map[string]common.PostData) []common.ChangeEvent {
+	var posts, replies []common.PostTombstoneDoc
+	for _, tombstone := range tombstones {
+		if ref, ok := references[tombstone.AtURI]; ok && (ref.ThreadParentPost != "" || ref.ThreadRootPost != "") {
+			replies = append(replies, tombstone)
+		} else {
+			posts = append(posts, tombstone)
+		}
+	}
+	return append(common.PostDeleteChangeEvents(posts, common.ChangeTypePost), common.PostDeleteChangeEvents(replies, common.ChangeTypeReply)...)
 }
 
 type postFlushResult struct {
@@ -593,7 +796,7 @@ func drainPendingFlush(pending *pendingPostFlush) (int, common.MegaStreamMessage
 	return r.count, r.lastMsg
 }
 
-func dispatchIndexPosts(msgs []common.MegaStreamMessage, esClient *elasticsearch.Client, embedder *inference.BatchEmbedder, dryRun bool, logger *common.IngestLogger) *pendingPostFlush {
+func dispatchIndexPosts(msgs []common.MegaStreamMessage, esClient *elasticsearch.Client, embedder *inference.BatchEmbedder, changeFeed *common.ChangeFeed, postCounts *common.PostCounter, dryRun bool, logger *common.IngestLogger) *pendingPostFlush {
 	batchCtx, cancelBatchCtx := context.WithTimeout(context.Background(), 30*time.Second)
 	ch := make(chan postFlushResult, 1)
 	var lastMsg common.MegaStreamMessage
@@ -601,7 +804,7 @@ func dispatchIndexPosts(msgs []common.MegaStreamMessage, esClient *elasticsearch
 		lastMsg = msgs[len(msgs)-1]
 	}
 	go func() {
-		count := indexDocuments(batchCtx, msgs, esClient, embedder, dryRun, logger, "async batch")
+		count := indexDocuments(batchCtx, msgs, esClient, embedder, changeFeed, postCounts, dryRun, logger, "async batch")
 		ch <- postFlushResult{count: count, lastMsg: lastMsg}
 	}()
 	return &pendingPostFlush{ch: ch, cancelCtx: cancelBatchCtx}
@@ -611,12 +814,20 @@ func dispatchIndexPosts(msgs []common.MegaStreamMessage, esClient *elasticsearch
 // concurrently — posts and replies are routed to their respective indices in parallel goroutines.
 // Post-tower embeddings are attached to posts before indexing.
 // Like counts start at 0 and are incremented by jetstream when likes arrive.
+// Successfully indexed documents are published to the change feed, if configured,
+// and counted toward the reply and quote counts of the posts they reference.
 // Returns the number of documents successfully indexed.
-func indexDocuments(ctx context.Context, msgs []common.MegaStreamMessage, esClient *elasticsearch.Client, embedder *inference.BatchEmbedder, dryRun bool, logger *common.IngestLogger, batchContext string) int {
+func indexDocuments(ctx context.Context, msgs []common.MegaStreamMessage, esClient *elasticsearch.Client, embedder *inference.BatchEmbedder, changeFeed *common.ChangeFeed, postCounts *common.PostCounter, dryRun bool, logger *common.IngestLogger, batchContext string) int {
 	if len(msgs) == 0 {
 		return 0
 	}
 
+	ctx, span := common.StartSpan(ctx, "megastream.index_batch",
+		attribute.String("ingex.batch_context", batchContext),
+		attribute.Int("ingex.batch_size", len(msgs)),
+	)
+	defer span.End()
+
 	postsBatch := make([]common.PostDoc, 0, len(msgs))
 	repliesBatch := make([]common.ReplyDoc, 0)
 
@@ -640,10 +851,14 @@ func indexDocuments(ctx context.Context, msgs []common.MegaStreamMessage, esClie
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err := common.BulkIndex(ctx, esClient, "posts", postsBatch, dryRun, logger); err != nil {
+			if err := common.BulkIndex(ctx, esClient, common.WriteAlias("posts"), postsBatch, dryRun, logger); err != nil {
 				logger.Error("[%s] Failed to bulk index posts: %v", batchContext, err)
 			} else {
 				postsIndexed = len(postsBatch)
+				changeFeed.Publish(ctx, common.PostChangeEvents(postsBatch))
+				for _, doc := range postsBatch {
+					postCounts.AddReferences("", "", doc.QuotePost, 1)
+				}
 			}
 		}()
 	}
@@ -652,10 +867,14 @@ func indexDocuments(ctx context.Context, msgs []common.MegaStreamMessage, esClie
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err := common.BulkIndex(ctx, esClient, "replies", repliesBatch, dryRun, logger); err != nil {
+			if err := common.BulkIndex(ctx, esClient, common.WriteAlias("replies"), repliesBatch, dryRun, logger); err != nil {
 				logger.Error("[%s] Failed to bulk index replies: %v", batchContext, err)
 			} else {
 				repliesIndexed = len(repliesBatch)
+				changeFeed.Publish(ctx, common.ReplyChangeEvents(repliesBatch))
+				for _, doc := range repliesBatch {
+					postCounts.AddReferences(doc.ThreadParentPost, doc.ThreadRootPost, doc.QuotePost, 1)
+				}
 			}
 		}()
 	}
@@ -664,248 +883,6 @@ func indexDocuments(ctx context.Context, msgs []common.MegaStreamMessage, esClie
 	return postsIndexed + repliesIndexed
 }
 
-// handleAccountDeletion handles account deletion events by querying and deleting all posts and likes
-func handleAccountDeletion(
-	ctx context.Context,
-	msg common.MegaStreamMessage,
-	esClient *elasticsearch.Client,
-	dryRun bool,
-	logger *common.IngestLogger,
-	deletedCount *int,
-) error {
-	authorDID := msg.GetAuthorDID()
-	logger.Debug("Processing account deletion for DID: %s", authorDID)
-
-	// Create 1-minute timeout context for queries
-	queryCtx, queryCancel := context.WithTimeout(ctx, time.Minute)
-	defer queryCancel()
-
-	// Query all posts
-	posts, err := common.QueryPostsByAuthorDID(queryCtx, esClient, "posts", authorDID, logger)
-	if err != nil {
-		return fmt.Errorf("failed to query posts for account deletion (DID: %s): %w", authorDID, err)
-	}
-	logger.Debug("Found %d posts for account deletion (DID: %s)", len(posts), authorDID)
-
-	// Process post deletions
-	if err := processAccountDocDeletions(ctx, posts, esClient, authorDID, msg.GetTimeUs(), dryRun, logger); err != nil {
-		return fmt.Errorf("failed to process post deletions for account (DID: %s): %w", authorDID, err)
-	}
-	*deletedCount += len(posts)
-
-	// Query replies
-	replies, err := common.QueryPostsByAuthorDID(queryCtx, esClient, "replies", authorDID, logger)
-	if err != nil {
-		return fmt.Errorf("failed to query replies for account deletion (DID: %s): %w", authorDID, err)
-	}
-	logger.Debug("Found %d replies for account deletion (DID: %s)", len(replies), authorDID)
-
-	if err := processAccountDocDeletions(ctx, replies, esClient, authorDID, msg.GetTimeUs(), dryRun, logger); err != nil {
-		return fmt.Errorf("failed to process reply deletions for account (DID: %s): %w", authorDID, err)
-	}
-	*deletedCount += len(replies)
-
-	// Query all likes
-	likes, err := common.QueryLikesByAuthorDID(queryCtx, esClient, "likes", authorDID, logger)
-	if err != nil {
-		return fmt.Errorf("failed to query likes for account deletion (DID: %s): %w", authorDID, err)
-	}
-	logger.Debug("Found %d likes for account deletion (DID: %s)", len(likes), authorDID)
-
-	// Process like deletions
-	if err := processAccountLikeDeletions(ctx, likes, esClient, authorDID, msg.GetTimeUs(), dryRun, logger); err != nil {
-		return fmt.Errorf("failed to process like deletions for account (DID: %s): %w", authorDID, err)
-	}
-	*deletedCount += len(likes)
-
-	logger.Debug("Completed account deletion for DID: %s (posts: %d, replies: %d, likes: %d)", authorDID, len(posts), len(replies), len(likes))
-	return nil
-}
-
-// processAccountDocDeletions processes post/reply deletions in batches for account deletion
-func processAccountDocDeletions(
-	ctx context.Context,
-	postAtURIs []string,
-	esClient *elasticsearch.Client,
-	authorDID string,
-	timeUs int64,
-	dryRun bool,
-	logger *common.IngestLogger,
-) error {
-	const batchSize = 100
-
-	now := time.Now().UTC()
-	deletedAt := now
-	if timeUs > 0 {
-		deletedAt = time.Unix(0, timeUs*1000)
-	}
-
-	var tombstoneBatch []common.PostTombstoneDoc
-	var deleteBatch []common.DeleteDoc
-
-	for _, atURI := range postAtURIs {
-		tombstoneBatch = append(tombstoneBatch, common.PostTombstoneDoc{
-			AtURI:     atURI,
-			AuthorDID: authorDID,
-			DeletedAt: deletedAt.Format(time.RFC3339),
-			IndexedAt: now.Format(time.RFC3339),
-		})
-
-		deleteBatch = append(deleteBatch, common.DeleteDoc{
-			DocID:     atURI,
-			AuthorDID: authorDID,
-		})
-
-		// Flush batch when full
-		if len(tombstoneBatch) >= batchSize {
-			if err := flushPostDeletionBatch(ctx, esClient, tombstoneBatch, deleteBatch, dryRun, logger); err != nil {
-				return err
-			}
-			tombstoneBatch = tombstoneBatch[:0]
-			deleteBatch = deleteBatch[:0]
-		}
-	}
-
-	// Flush remaining
-	if len(tombstoneBatch) > 0 {
-		return flushPostDeletionBatch(ctx, esClient, tombstoneBatch, deleteBatch, dryRun, logger)
-	}
-
-	return nil
-}
-
-// processAccountLikeDeletions processes like deletions in batches for account deletion
-func processAccountLikeDeletions(
-	ctx context.Context,
-	likes map[string]string,
-	esClient *elasticsearch.Client,
-	authorDID string,
-	timeUs int64,
-	dryRun bool,
-	logger *common.IngestLogger,
-) error {
-	const batchSize = 100
-
-	now := time.Now().UTC()
-	deletedAt := now
-	if timeUs > 0 {
-		deletedAt = time.Unix(0, timeUs*1000)
-	}
-
-	var tombstoneBatch []common.LikeTombstoneDoc
-	var deleteBatch []common.DeleteDoc
-
-	for atURI, subjectURI := range likes {
-		tombstoneBatch = append(tombstoneBatch, common.LikeTombstoneDoc{
-			AtURI:      atURI,
-			AuthorDID:  authorDID,
-			SubjectURI: subjectURI,
-			DeletedAt:  deletedAt.Format(time.RFC3339),
-			IndexedAt:  now.Format(time.RFC3339),
-		})
-
-		deleteBatch = append(deleteBatch, common.DeleteDoc{
-			DocID:     atURI,
-			AuthorDID: authorDID,
-		})
-
-		// Flush batch when full
-		if len(tombstoneBatch) >= batchSize {
-			if err := flushLikeDeletionBatch(ctx, esClient, tombstoneBatch, deleteBatch, dryRun, logger); err != nil {
-				return err
-			}
-			tombstoneBatch = tombstoneBatch[:0]
-			deleteBatch = deleteBatch[:0]
-		}
-	}
-
-	// Flush remaining
-	if len(tombstoneBatch) > 0 {
-		return flushLikeDeletionBatch(ctx, esClient, tombstoneBatch, deleteBatch, dryRun, logger)
-	}
-
-	return nil
-}
-
-// flushPostDeletionBatch indexes post tombstones and deletes posts
-func flushPostDeletionBatch(
-	ctx context.Context,
-	esClient *elasticsearch.Client,
-	tombstoneBatch []common.PostTombstoneDoc,
-	deleteBatch []common.DeleteDoc,
-	dryRun bool,
-	logger *common.IngestLogger,
-) error {
-	batchCtx, cancelBatchCtx := context.WithTimeout(ctx, 30*time.Second)
-	defer cancelBatchCtx()
-
-	// Index tombstones to both post_tombstones and reply_tombstones
-	var postTombstoneErr, replyTombstoneErr error
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go func() {
-		defer wg.Done()
-		postTombstoneErr = common.BulkIndexPostTombstones(batchCtx, esClient, "post_tombstones", tombstoneBatch, dryRun, logger)
-	}()
-	go func() {
-		defer wg.Done()
-		replyTombstoneErr = common.BulkIndexPostTombstones(batchCtx, esClient, "reply_tombstones", tombstoneBatch, dryRun, logger)
-	}()
-	wg.Wait()
-	if postTombstoneErr != nil {
-		return fmt.Errorf("failed to index tombstones to post_tombstones: %w", postTombstoneErr)
-	}
-	if replyTombstoneErr != nil {
-		return fmt.Errorf("failed to index tombstones to reply_tombstones: %w", replyTombstoneErr)
-	}
-
-	// Then delete from both posts and replies
-	var postsDeleteErr, repliesDeleteErr error
-	wg.Add(2)
-	go func() {
-		defer wg.Done()
-		postsDeleteErr = common.BulkDelete(batchCtx, esClient, "posts", deleteBatch, dryRun, logger)
-	}()
-	go func() {
-		defer wg.Done()
-		repliesDeleteErr = common.BulkDelete(batchCtx, esClient, "replies", deleteBatch, dryRun, logger)
-	}()
-	wg.Wait()
-	if postsDeleteErr != nil {
-		return fmt.Errorf("failed to delete from posts: %w", postsDeleteErr)
-	}
-	if repliesDeleteErr != nil {
-		return fmt.Errorf("failed to delete from replies: %w", repliesDeleteErr)
-	}
-
-	return nil
-}
-
-// flushLikeDeletionBatch indexes like tombstones and deletes likes
-func flushLikeDeletionBatch(
-	ctx context.Context,
-	esClient *elasticsearch.Client,
-	tombstoneBatch []common.LikeTombstoneDoc,
-	deleteBatch []common.DeleteDoc,
-	dryRun bool,
-	logger *common.IngestLogger,
-) error {
-	batchCtx, cancelBatchCtx := context.WithTimeout(ctx, 30*time.Second)
-	defer cancelBatchCtx()
-
-	// Index tombstones first
-	if err := common.BulkIndexLikeTombstones(batchCtx, esClient, "like_tombstones", tombstoneBatch, dryRun, logger); err != nil {
-		return fmt.Errorf("failed to bulk index like tombstones: %w", err)
-	}
-
-	// Then delete likes
-	if err := common.BulkDelete(batchCtx, esClient, "likes", deleteBatch, dryRun, logger); err != nil {
-		return fmt.Errorf("failed to bulk delete likes: %w", err)
-	}
-
-	return nil
-}
-
 // findMostRecentLocalFile finds the most recent file in the local directory
 func findMostRecentLocalFile(directory string, logger *common.IngestLogger) (int64, error) {
 	entries, err := os.ReadDir(directory)
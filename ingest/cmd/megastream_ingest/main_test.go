@@ -84,3 +84,36 @@ func TestIndexDocuments_errorHandlingContract(t *testing.T) {
 	// prevent the other from being attempted, and does not block the caller.
 	t.Log("contract documented; see indexDocuments implementation")
 }
+
+func TestPostDeleteChangeEvents_typesRepliesByReferences(t *testing.T) {
+	tombstones := []common.PostTombstoneDoc{
+		{AtURI: "at://did:plc:abc/app.bsky.feed.post/orig"},
+		{AtURI: "at://did:plc:abc/app.bsky.feed.post/reply1"},
+		{AtURI: "at://did:plc:abc/app.bsky.feed.post/unindexed"},
+	}
+	references := map[string]common.PostData{
+		"at://did:plc:abc/app.bsky.feed.post/orig":   {},
+		"at://did:plc:abc/app.bsky.feed.post/reply1": {ThreadRootPost: "at://did:plc:abc/app.bsky.feed.post/orig"},
+	}
+
+	types := make(map[string]string)
+	for _, event := range postDeleteChangeEvents(tombstones, references) {
+		if event.Operation != common.ChangeOperationDelete {
+			t.Errorf("expected a delete event, got %+v", event)
+		}
+		types[event.AtURI] = event.Type
+	}
+	want := map[string]string{
+		"at://did:plc:abc/app.bsky.feed.post/orig":      common.ChangeTypePost,
+		"at://did:plc:abc/app.bsky.feed.post/reply1":    common.ChangeTypeReply,
+		"at://did:plc:abc/app.bsky.feed.post/unindexed": common.ChangeTypePost,
+	}
+	if len(types) != len(want) {
+		t.Fatalf("expected %d events, got %v", len(want), types)
+	}
+	for uri, changeType := range want {
+		if types[uri] != changeType {
+			t.Errorf("%s: got type %q, want %q", uri, types[uri], changeType)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/rec_metrics"
+)
+
+func main() {
+	// Parse command line flags
+	fromFlag := flag.String("from", "", "Start of the served_at range, RFC3339 (default: 24 hours before -to)")
+	toFlag := flag.String("to", "", "End of the served_at range, RFC3339, exclusive (default: start of the current hour less the window)")
+	window := flag.Duration("window", time.Hour, "How long after an impression a like or reply counts")
+	index := flag.String("index", rec_metrics.DefaultMetricsIndex, "Alias the metrics are written to")
+	output := flag.String("output", "", "Where to also write a parquet report: local path or gs://bucket/object")
+	dryRun := flag.Bool("dry-run", false, "Compute and print the metrics without writing them to Elasticsearch")
+	skipTLSVerify := flag.Bool("skip-tls-verify", false, "Skip TLS certificate verification (use for local development only)")
+	debug := flag.Bool("debug", false, "Enable debug logging")
+	flag.Parse()
+
+	// Load configuration
+	config := common.LoadConfig()
+	logger := common.NewLogger(config.LoggingEnabled)
+	logger.SetService("rec_metrics")
+	logger.SetDebugEnabled(*debug)
+	otelCollector, err := common.NewOTelMetricCollector("rec-metrics", config.Environment, config.GCPProjectID, config.GCPRegion, config.MetricExportIntervalSec)
+	if err != nil {
+		logger.Error("Failed to create OTel metric collector: %v (continuing without metrics)", err)
+	} else {
+		logger.SetMetricCollector(otelCollector)
+		defer func() {
+			if err := otelCollector.Shutdown(context.Background()); err != nil {
+				logger.Error("Failed to shutdown OTel metric collector: %v", err)
+			}
+		}()
+	}
+
+	logger.Info("Green Earth Ingex - Recommendation Metrics Job")
+	logger.Info("Environment: %s, window: %s, dry run: %v", config.Environment, *window, *dryRun)
+
+	from, to, err := parseRange(*fromFlag, *toFlag, *window, time.Now())
+	if err != nil {
+		logger.Error("%v", err)
+		os.Exit(1)
+	}
+
+	// Setup context with cancellation for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Handle shutdown signals
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		logger.Info("Received signal %v, shutting down...", sig)
+		cancel()
+	}()
+
+	if config.ElasticsearchURL == "" {
+		logger.Error("GE_ELASTICSEARCH_URL environment variable is required")
+		os.Exit(1)
+	}
+	esConfig := common.ElasticsearchConfig{
+		URL:           config.ElasticsearchURL,
+		APIKey:        config.ElasticsearchAPIKey,
+		SkipTLSVerify: *skipTLSVerify || config.ElasticsearchTLSSkipVerify,
+	}
+	esClient, err := common.NewElasticsearchClient(esConfig, logger)
+	if err != nil {
+		logger.Error("Failed to create Elasticsearch client: %v", err)
+		os.Exit(1)
+	}
+	common.CheckAPIKeyPrivileges(ctx, esClient, "rec_metrics", config, logger)
+
+	service := rec_metrics.NewService(esClient, rec_metrics.Config{Window: *window}, logger)
+
+	logger.Info("Evaluating impressions served from %s to %s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	rows, err := service.Evaluate(ctx, config.Environment, from, to)
+	if err != nil {
+		logger.Error("Metrics evaluation failed: %v", err)
+		logger.Metric("rec_metrics.compute_error_count", 1)
+		os.Exit(1)
+	}
+
+	if err := rec_metrics.WriteIndex(ctx, esClient, *index, rows, *dryRun, logger); err != nil {
+		logger.Error("Failed to index metrics: %v", err)
+		logger.Metric("rec_metrics.compute_error_count", 1)
+		os.Exit(1)
+	}
+	if *output != "" {
+		if err := rec_metrics.WriteParquet(ctx, *output, rows); err != nil {
+			logger.Error("%v", err)
+			logger.Metric("rec_metrics.compute_error_count", 1)
+			os.Exit(1)
+		}
+		logger.Info("Wrote %d rows to %s", len(rows), *output)
+	}
+
+	printRows(rows)
+	logger.Metric("rec_metrics.compute_success_count", 1)
+}
+
+// parseRange resolves -from and -to. The default is the 24 complete hours
+// ending a window before now, so every impression has had its full window
+// for engagement.
+func parseRange(fromFlag, toFlag string, window time.Duration, now time.Time) (time.Time, time.Time, error) {
+	to := now.UTC().Add(-window).Truncate(time.Hour)
+	if toFlag != "" {
+		t, err := time.Parse(time.RFC3339, toFlag)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid -to %q: %w", toFlag, err)
+		}
+		to = t
+	}
+	from := to.Add(-24 * time.Hour)
+	if fromFlag != "" {
+		t, err := time.Parse(time.RFC3339, fromFlag)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid -from %q: %w", fromFlag, err)
+		}
+		from = t
+	}
+	return from.UTC().Truncate(time.Hour), to.UTC().Truncate(time.Hour), nil
+}
+
+func printRows(rows []rec_metrics.ArmMetrics) {
+	for _, r := range rows {
+		fmt.Printf("%s\t%s\t%d\t%d\t%.4f\t%.4f\t%.4f\n", r.ExperimentArm, r.PromptVersion, r.Impressions, r.Users, r.LikeRate, r.ReplyRate, r.CTR)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/recommender"
+)
+
+func main() {
+	// Parse command line flags
+	port := flag.Int("port", 8091, "Port for the recommender API")
+	postsIndex := flag.String("posts-index", "posts", "Alias posts are read from")
+	repliesIndex := flag.String("replies-index", "replies", "Alias users' replies are read from")
+	likesIndex := flag.String("likes-index", "likes", "Alias users' likes are read from")
+	followsIndex := flag.String("follows-index", "follows", "Alias users' follows are read from")
+	historySize := flag.Int("history-size", 200, "A user's most recent likes, and posts and replies, their profile is built from")
+	skipTLSVerify := flag.Bool("skip-tls-verify", false, "Skip TLS certificate verification (use for local development only)")
+	debug := flag.Bool("debug", false, "Enable debug logging")
+	flag.Parse()
+
+	// Load configuration
+	config := common.LoadConfig()
+	logger := common.NewLogger(config.LoggingEnabled)
+	logger.SetService("recommender_api")
+	logger.SetDebugEnabled(*debug)
+	otelCollector, err := common.NewOTelMetricCollector("recommender-api", config.Environment, config.GCPProjectID, config.GCPRegion, config.MetricExportIntervalSec)
+	if err != nil {
+		logger.Error("Failed to create OTel metric collector: %v (continuing without metrics)", err)
+	} else {
+		logger.SetMetricCollector(otelCollector)
+		defer func() {
+			if err := otelCollector.Shutdown(context.Background()); err != nil {
+				logger.Error("Failed to shutdown OTel metric collector: %v", err)
+			}
+		}()
+	}
+
+	logger.Info("Green Earth Ingex - Recommender API")
+
+	// Validate configuration
+	if config.ElasticsearchURL == "" {
+		logger.Error("GE_ELASTICSEARCH_URL environment variable is required")
+		os.Exit(1)
+	}
+	if config.RecommenderAPIKeys == "" {
+		logger.Error("GE_RECOMMENDER_API_KEYS environment variable is required")
+		os.Exit(1)
+	}
+
+	// Setup context with cancellation for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Start health check server
+	healthServer, err := common.NewHealthServer(8080, 8089, logger)
+	if err != nil {
+		logger.Error("Failed to create health server: %v", err)
+		os.Exit(1)
+	}
+	go func() {
+		if err := healthServer.Start(ctx); err != nil {
+			logger.Error("Health server failed: %v", err)
+			cancel()
+		}
+	}()
+
+	// Handle shutdown signals
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		logger.Info("Received signal %v, shutting down gracefully...", sig)
+		cancel()
+	}()
+
+	modelConfig := recommender.EngagementConfig{
+		PostsIndex:   *postsIndex,
+		RepliesIndex: *repliesIndex,
+		LikesIndex:   *likesIndex,
+		FollowsIndex: *followsIndex,
+		HalfLife:     config.EngagementHalfLife,
+		HistorySize:  *historySize,
+	}
+	if err := runServer(ctx, config, logger, healthServer, modelConfig, *port, *skipTLSVerify); err != nil {
+		logger.Error("Recommender API failed: %v", err)
+		os.Exit(1)
+	}
+
+	logger.Info("Recommender API stopped")
+}
+
+func runServer(ctx context.Context, config *common.Config, logger *common.IngestLogger, healthServer *common.HealthServer, modelConfig recommender.EngagementConfig, port int, skipTLSVerify bool) error {
+	var policy *common.RetentionPolicy
+	if config.RecommenderTrendingWindow <= 0 {
+		var err error
+		if policy, err = common.RetentionPolicyFromConfig(ctx, config); err != nil {
+			return fmt.Errorf("failed to load retention policy: %w", err)
+		}
+	}
+	window, err := recommender.CandidateWindow(config, policy, modelConfig.PostsIndex)
+	if err != nil {
+		return err
+	}
+	modelConfig.Window = window
+
+	esClient, err := common.NewElasticsearchClient(common.ElasticsearchConfig{
+		URL:           config.ElasticsearchURL,
+		APIKey:        config.ElasticsearchAPIKey,
+		SkipTLSVerify: skipTLSVerify || config.ElasticsearchTLSSkipVerify,
+	}, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create Elasticsearch client: %w", err)
+	}
+	common.CheckAPIKeyPrivileges(ctx, esClient, "recommender_api", config, logger)
+
+	sources := []recommender.WeightedSource{{Source: recommender.NewTrendingSource(esClient, modelConfig.PostsIndex, window, logger), Weight: 1}}
+	if config.RecommenderSeedListPath != "" {
+		seeds, err := recommender.LoadSeedList(ctx, config.RecommenderSeedListPath)
+		if err != nil {
+			return fmt.Errorf("failed to load seed list: %w", err)
+		}
+		sources = append(sources,
+			recommender.WeightedSource{Source: recommender.NewSeedListSource(seeds.Posts), Weight: 1},
+			recommender.WeightedSource{Source: recommender.NewExplorationSource(esClient, modelConfig.PostsIndex, seeds.TopicAnchors, window, logger), Weight: 1})
+	}
+	modelConfig.ColdStart = recommender.NewColdStartBlender(sources, logger)
+
+	model := recommender.NewEngagementModel(esClient, modelConfig, logger)
+	var scorer *recommender.LLMScorer
+	if config.LLMURL != "" {
+		llm := recommender.NewLLMClient(recommender.LLMClientConfig{
+			URL:        config.LLMURL,
+			APIKey:     config.LLMAPIKey,
+			Model:      config.LLMModel,
+			Timeout:    config.LLMTimeout,
+			MaxRetries: config.LLMRetryMax,
+		}, logger)
+		scorer = recommender.NewLLMScorer(llm, esClient, recommender.LLMScorerConfig{
+			PostsIndex: modelConfig.PostsIndex,
+			BatchSize:  config.LLMBatchSize,
+			RateLimit:  config.LLMRateLimit,
+		}, logger)
+	} else {
+		logger.Info("GE_LLM_URL is not set; LLM scoring endpoints are disabled")
+	}
+	var cursors *recommender.CursorSigner
+	if config.RecommenderCursorSecret != "" {
+		if cursors, err = recommender.NewCursorSigner([]byte(config.RecommenderCursorSecret)); err != nil {
+			return err
+		}
+	} else {
+		logger.Info("GE_RECOMMENDER_CURSOR_SECRET is not set; slates are served in one page")
+	}
+	guard, err := common.NewTombstoneGuard(esClient, config.TombstoneGuard, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create tombstone guard: %w", err)
+	}
+	accounts, err := common.NewAccountFilter(esClient, config.InactiveAccounts, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create inactive account filter: %w", err)
+	}
+	filter, err := recommender.PostFilterFromConfig(ctx, esClient, config, logger)
+	if err != nil {
+		return fmt.Errorf("failed to load post filters: %w", err)
+	}
+	guardrails, err := recommender.GuardrailsFromConfig(ctx, esClient, config, logger)
+	if err != nil {
+		return fmt.Errorf("failed to load guardrails: %w", err)
+	}
+	feed := feedConfig{
+		retrievalBudget: config.RecommenderRetrievalBudget,
+		guard:           guard,
+		accounts:        accounts,
+		impressions:     esClient,
+		filter:          filter,
+		guardrails:      guardrails,
+		blocks:          recommender.NewBlockCache(esClient, common.BlocksIndex, config.RecommenderBlockCacheTTL, logger),
+	}
+	go func() {
+		if err := recommender.RunBlockStream(ctx, feed.blocks, config.JetstreamURL, logger); err != nil {
+			logger.Error("Block stream failed, blocks apply once read from the index: %v", err)
+			ticker := time.NewTicker(time.Minute)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					feed.blocks.Sweep()
+				}
+			}
+		}
+	}()
+	if config.RecommenderShadowWeights != "" {
+		var weights recommender.EngagementWeights
+		decoder := json.NewDecoder(strings.NewReader(config.RecommenderShadowWeights))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&weights); err != nil {
+			return fmt.Errorf("failed to parse GE_RECOMMENDER_SHADOW_WEIGHTS: %w", err)
+		}
+		if err := weights.Validate(); err != nil {
+			return fmt.Errorf("invalid GE_RECOMMENDER_SHADOW_WEIGHTS: %w", err)
+		}
+		feed.shadow = recommender.NewShadowScorer(recommender.ShadowConfig{
+			Name:       "engagement_weights",
+			Score:      model.ScoreFunc(&weights),
+			SampleRate: config.RecommenderShadowSample,
+			Timeout:    config.RecommenderScoringBudget,
+			Filter:     filter,
+		}, logger)
+	}
+	if config.RecommenderCacheTTL > 0 {
+		if config.RecommenderCachePoll <= 0 {
+			return fmt.Errorf("GE_RECOMMENDER_CACHE_POLL_INTERVAL must be positive, got %s", config.RecommenderCachePoll)
+		}
+		feed.cache = recommender.NewSlateCache(config.RecommenderCacheTTL)
+		go recommender.RunLikeInvalidation(ctx, feed.cache, esClient, modelConfig.LikesIndex, config.RecommenderCachePoll, logger)
+	} else {
+		logger.Info("GE_RECOMMENDER_CACHE_TTL is 0; feed slates are not cached")
+	}
+	api, err := newAPIServer(model, scorer, cursors, config.RecommenderScoringBudget, feed, config.RecommenderAPIKeys, logger)
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           api.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		logger.Info("Recommender API listening on :%d (candidate window %s)", port, window)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errChan <- err
+		}
+		close(errChan)
+	}()
+
+	healthServer.SetHealthy(true, fmt.Sprintf("Serving on :%d", port))
+
+	select {
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	err = server.Shutdown(shutdownCtx)
+	api.Wait()
+	return err
+}
@@ -0,0 +1,667 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/recommender"
+)
+
+const (
+	// maxRequestBytes bounds a request body
+	maxRequestBytes = 1 << 20
+	// defaultSlateSize is the slate size of requests that set none
+	defaultSlateSize = 30
+	// maxExperimentArmBytes bounds the experiment arm of a feed request
+	maxExperimentArmBytes = 64
+	// impressionIndexTimeout bounds indexing the impressions of one page
+	impressionIndexTimeout = 30 * time.Second
+)
+
+// apiServer serves the engagement model and LLM scorer over HTTP. Requests
+// need one of the server's API keys as a bearer token.
+type apiServer struct {
+	model         *recommender.EngagementModel
+	llm           *recommender.LLMScorer    // nil when no LLM endpoint is configured
+	cursors       *recommender.CursorSigner // nil when no cursor secret is configured
+	scoringBudget time.Duration             // Scoring budget of a slate before it is served unscored
+	feed          feedConfig
+	keys          [][]byte
+	logger        *common.IngestLogger
+
+	background sync.WaitGroup // Impressions being indexed
+}
+
+// feedConfig is what /v1/feed builds slates with beyond the model and
+// scorer. A nil filter checks nothing, and a nil cache rebuilds every slate.
+type feedConfig struct {
+	retrievalBudget time.Duration             // Retrieval budget of a slate before its candidate pool is shrunk
+	guard           *common.TombstoneGuard    // Drops deleted candidates
+	accounts        *common.AccountFilter     // Drops candidates by inactive accounts
+	impressions     *elasticsearch.Client     // Indexes served impressions into rec_impressions; nil only logs them
+	cache           *recommender.SlateCache   // Serves repeated requests the slate built for the first
+	shadow          *recommender.ShadowScorer // Rescores sampled engagement slates with other weights; nil shadows nothing
+	filter          *recommender.PostFilter   // Drops scored candidates that break the post-filter rules
+	guardrails      *recommender.Guardrails   // Drops retrieved candidates by accounts too new or inactive for the request's arm
+	blocks          *recommender.BlockCache   // Drops candidates by accounts the user blocked or muted, or that blocked the user
+}
+
+// newAPIServer creates a server accepting the comma-separated bearer tokens
+// in apiKeys. The LLM endpoints, and feed requests with a prompt, respond
+// 503 when llm is nil, and paged slate requests when cursors is nil.
+func newAPIServer(model *recommender.EngagementModel, llm *recommender.LLMScorer, cursors *recommender.CursorSigner, scoringBudget time.Duration, feed feedConfig, apiKeys string, logger *common.IngestLogger) (*apiServer, error) {
+	s := &apiServer{model: model, llm: llm, cursors: cursors, scoringBudget: scoringBudget, feed: feed, logger: logger}
+	for _, key := range strings.Split(apiKeys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			s.keys = append(s.keys, []byte(key))
+		}
+	}
+	if len(s.keys) == 0 {
+		return nil, fmt.Errorf("GE_RECOMMENDER_API_KEYS is required to serve the recommender API")
+	}
+	return s, nil
+}
+
+// Handler returns the HTTP routes: POST /v1/predict_engagement, POST
+// /v1/recommend_most_engaging_posts, POST /v1/llm_score, POST
+// /v1/recommend_highest_scoring_llm_posts and POST /v1/feed, each taking and
+// returning JSON
+func (s *apiServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/predict_engagement", s.handlePredictEngagement)
+	mux.HandleFunc("/v1/recommend_most_engaging_posts", s.handleRecommend)
+	mux.HandleFunc("/v1/llm_score", s.handleLLMScore)
+	mux.HandleFunc("/v1/recommend_highest_scoring_llm_posts", s.handleRecommendLLM)
+	mux.HandleFunc("/v1/feed", s.handleFeed)
+	return mux
+}
+
+// predictRequest is the body of a /v1/predict_engagement request
+type predictRequest struct {
+	UserDID string   `json:"user_did"`
+	AtURIs  []string `json:"at_uris"`
+}
+
+// predictResponse is the body of a /v1/predict_engagement response
+type predictResponse struct {
+	Predictions []recommender.EngagementPrediction `json:"predictions"`
+}
+
+// pageRequest are the paging fields of a slate request. A slate is served in
+// pages of PageSize (default: the whole slate); Cursor, the NextCursor of
+// the previous page, asks for the next one.
+type pageRequest struct {
+	PageSize int    `json:"page_size"`
+	Cursor   string `json:"cursor"`
+}
+
+// recommendRequest is the body of a /v1/recommend_most_engaging_posts
+// request. Source defaults to trending, SlateSize to defaultSlateSize, and
+// Weights to the model's.
+type recommendRequest struct {
+	UserDID   string                         `json:"user_did"`
+	Source    string                         `json:"source"`
+	SlateSize int                            `json:"slate_size"`
+	Weights   *recommender.EngagementWeights `json:"weights"`
+	pageRequest
+}
+
+// recommendResponse is the body of a /v1/recommend_most_engaging_posts
+// response. NextCursor is empty on the last page.
+type recommendResponse struct {
+	Source     string                             `json:"source"`
+	Slate      []recommender.EngagementPrediction `json:"slate"`
+	NextCursor string                             `json:"next_cursor,omitempty"`
+}
+
+// llmScoreRequest is the body of a /v1/llm_score request
+type llmScoreRequest struct {
+	Prompt string   `json:"prompt"`
+	AtURIs []string `json:"at_uris"`
+}
+
+// llmScoreResponse is the body of a /v1/llm_score response
+type llmScoreResponse struct {
+	PromptHash string                 `json:"prompt_hash"`
+	Scores     []recommender.LLMScore `json:"scores"`
+}
+
+// recommendLLMRequest is the body of a
+// /v1/recommend_highest_scoring_llm_posts request. Source defaults to
+// trending and SlateSize to defaultSlateSize.
+type recommendLLMRequest struct {
+	UserDID   string `json:"user_did"`
+	Source    string `json:"source"`
+	SlateSize int    `json:"slate_size"`
+	Prompt    string `json:"prompt"`
+	pageRequest
+}
+
+// recommendLLMResponse is the body of a
+// /v1/recommend_highest_scoring_llm_posts response. DegradationLevel is
+// no_llm when scoring missed its budget and the slate is unscored;
+// NextCursor is empty on the last page.
+type recommendLLMResponse struct {
+	Source           string                 `json:"source"`
+	PromptHash       string                 `json:"prompt_hash"`
+	DegradationLevel string                 `json:"degradation_level"`
+	Slate            []recommender.LLMScore `json:"slate"`
+	NextCursor       string                 `json:"next_cursor,omitempty"`
+}
+
+// feedRequest is the body of a /v1/feed request. Source defaults to
+// trending and SlateSize to defaultSlateSize. The slate is ranked by
+// engagement under Weights (default: the model's), or, with a Prompt, by
+// relevance to it. ExperimentArm picks the guardrails the candidates pass
+// and tags the slate's impressions. MutedDIDs, when set, replaces the
+// accounts the user muted.
+type feedRequest struct {
+	UserDID       string                         `json:"user_did"`
+	Source        string                         `json:"source"`
+	SlateSize     int                            `json:"slate_size"`
+	Weights       *recommender.EngagementWeights `json:"weights"`
+	Prompt        string                         `json:"prompt"`
+	ExperimentArm string                         `json:"experiment_arm"`
+	MutedDIDs     []string                       `json:"muted_dids"`
+	pageRequest
+}
+
+// feedPost is a post of a /v1/feed slate
+type feedPost struct {
+	AtURI       string                   `json:"at_uri"`
+	AuthorDID   string                   `json:"author_did,omitempty"`
+	Score       float64                  `json:"score"`
+	Strategy    string                   `json:"strategy,omitempty"`
+	Explanation *recommender.Explanation `json:"explanation,omitempty"` // Set for explain=true requests
+}
+
+// feedResponse is the body of a /v1/feed response. DegradationLevel names
+// the work skipped to serve the slate within its budgets, or is full;
+// NextCursor is empty on the last page.
+type feedResponse struct {
+	DegradationLevel string     `json:"degradation_level"`
+	Slate            []feedPost `json:"slate"`
+	NextCursor       string     `json:"next_cursor,omitempty"`
+}
+
+func (s *apiServer) handlePredictEngagement(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req predictRequest
+	if !s.decode(w, r, "predict_engagement", &req) {
+		return
+	}
+	if len(req.AtURIs) == 0 {
+		s.fail(w, "predict_engagement", "at_uris is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.AtURIs) > recommender.MaxEngagementPosts {
+		s.fail(w, "predict_engagement", fmt.Sprintf("at most %d at_uris per request", recommender.MaxEngagementPosts), http.StatusBadRequest)
+		return
+	}
+
+	predictions, err := s.model.PredictEngagement(r.Context(), req.UserDID, req.AtURIs)
+	if err != nil {
+		s.logger.Error("PredictEngagement failed for %s: %v", req.UserDID, err)
+		s.fail(w, "predict_engagement", "prediction failed", http.StatusInternalServerError)
+		return
+	}
+	s.respond(w, "predict_engagement", start, predictResponse{Predictions: predictions})
+}
+
+func (s *apiServer) handleRecommend(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req recommendRequest
+	if !s.decode(w, r, "recommend", &req) {
+		return
+	}
+	if req.Source == "" {
+		req.Source = recommender.EngagementSourceTrending
+	}
+	if req.SlateSize == 0 {
+		req.SlateSize = defaultSlateSize
+	}
+	if req.Source != recommender.EngagementSourceTrending && req.Source != recommender.EngagementSourceSimilar {
+		s.fail(w, "recommend", fmt.Sprintf("source must be %s or %s", recommender.EngagementSourceTrending, recommender.EngagementSourceSimilar), http.StatusBadRequest)
+		return
+	}
+	if req.SlateSize < 0 || req.SlateSize > recommender.MaxEngagementPosts {
+		s.fail(w, "recommend", fmt.Sprintf("slate_size must be from 1 to %d", recommender.MaxEngagementPosts), http.StatusBadRequest)
+		return
+	}
+	if req.Weights != nil {
+		if err := req.Weights.Validate(); err != nil {
+			s.fail(w, "recommend", err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	ctx, cursor, ok := s.startPage(w, r, "recommend", req.SlateSize, req.pageRequest)
+	if !ok {
+		return
+	}
+
+	slate, err := s.model.RecommendMostEngagingPosts(ctx, req.UserDID, req.Source, cursor.Size, req.Weights)
+	if err != nil {
+		s.logger.Error("RecommendMostEngagingPosts failed for %s: %v", req.UserDID, err)
+		s.fail(w, "recommend", "recommendation failed", http.StatusInternalServerError)
+		return
+	}
+	page, next, ok := pageSlate(s, w, "recommend", slate, cursor, req.PageSize, func(p recommender.EngagementPrediction) string { return p.AtURI })
+	if !ok {
+		return
+	}
+	s.respond(w, "recommend", start, recommendResponse{Source: req.Source, Slate: page, NextCursor: next})
+}
+
+func (s *apiServer) handleLLMScore(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req llmScoreRequest
+	if !s.decode(w, r, "llm_score", &req) {
+		return
+	}
+	if s.llm == nil {
+		s.fail(w, "llm_score", "LLM scoring is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	if len(req.AtURIs) == 0 {
+		s.fail(w, "llm_score", "at_uris is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.AtURIs) > recommender.MaxLLMPosts {
+		s.fail(w, "llm_score", fmt.Sprintf("at most %d at_uris per request", recommender.MaxLLMPosts), http.StatusBadRequest)
+		return
+	}
+	if req.Prompt == "" || len(req.Prompt) > recommender.MaxLLMPromptBytes {
+		s.fail(w, "llm_score", fmt.Sprintf("prompt must be from 1 to %d bytes", recommender.MaxLLMPromptBytes), http.StatusBadRequest)
+		return
+	}
+
+	scores, err := s.llm.LLMScore(r.Context(), req.Prompt, req.AtURIs)
+	if err != nil {
+		s.logger.Error("LLMScore failed: %v", err)
+		s.fail(w, "llm_score", "scoring failed", http.StatusBadGateway)
+		return
+	}
+	s.respond(w, "llm_score", start, llmScoreResponse{PromptHash: s.llm.PromptHash(req.Prompt), Scores: scores})
+}
+
+func (s *apiServer) handleRecommendLLM(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req recommendLLMRequest
+	if !s.decode(w, r, "recommend_llm", &req) {
+		return
+	}
+	if s.llm == nil {
+		s.fail(w, "recommend_llm", "LLM scoring is not configured", http.StatusServiceUnavailable)
+		return
+	}
+	if req.Source == "" {
+		req.Source = recommender.EngagementSourceTrending
+	}
+	if req.SlateSize == 0 {
+		req.SlateSize = defaultSlateSize
+	}
+	if req.Source != recommender.EngagementSourceTrending && req.Source != recommender.EngagementSourceSimilar {
+		s.fail(w, "recommend_llm", fmt.Sprintf("source must be %s or %s", recommender.EngagementSourceTrending, recommender.EngagementSourceSimilar), http.StatusBadRequest)
+		return
+	}
+	if req.SlateSize < 0 || req.SlateSize > recommender.MaxLLMPosts {
+		s.fail(w, "recommend_llm", fmt.Sprintf("slate_size must be from 1 to %d", recommender.MaxLLMPosts), http.StatusBadRequest)
+		return
+	}
+	if req.Prompt == "" || len(req.Prompt) > recommender.MaxLLMPromptBytes {
+		s.fail(w, "recommend_llm", fmt.Sprintf("prompt must be from 1 to %d bytes", recommender.MaxLLMPromptBytes), http.StatusBadRequest)
+		return
+	}
+	ctx, cursor, ok := s.startPage(w, r, "recommend_llm", req.SlateSize, req.pageRequest)
+	if !ok {
+		return
+	}
+
+	slate, level, err := recommender.RecommendHighestScoringLLMPosts(ctx, s.model, s.llm, req.UserDID, req.Source, req.Prompt, cursor.Size, s.scoringBudget)
+	if err != nil {
+		s.logger.Error("RecommendHighestScoringLLMPosts failed for %s: %v", req.UserDID, err)
+		s.fail(w, "recommend_llm", "recommendation failed", http.StatusInternalServerError)
+		return
+	}
+	page, next, ok := pageSlate(s, w, "recommend_llm", slate, cursor, req.PageSize, func(score recommender.LLMScore) string { return score.AtURI })
+	if !ok {
+		return
+	}
+	s.respond(w, "recommend_llm", start, recommendLLMResponse{Source: req.Source, PromptHash: s.llm.PromptHash(req.Prompt), DegradationLevel: level.String(), Slate: page, NextCursor: next})
+}
+
+func (s *apiServer) handleFeed(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	var req feedRequest
+	if !s.decode(w, r, "feed", &req) {
+		return
+	}
+	if req.Source == "" {
+		req.Source = recommender.EngagementSourceTrending
+	}
+	if req.SlateSize == 0 {
+		req.SlateSize = defaultSlateSize
+	}
+	if req.Source != recommender.EngagementSourceTrending && req.Source != recommender.EngagementSourceSimilar {
+		s.fail(w, "feed", fmt.Sprintf("source must be %s or %s", recommender.EngagementSourceTrending, recommender.EngagementSourceSimilar), http.StatusBadRequest)
+		return
+	}
+	maxSlateSize := recommender.MaxEngagementPosts
+	if req.Prompt != "" {
+		if s.llm == nil {
+			s.fail(w, "feed", "LLM scoring is not configured", http.StatusServiceUnavailable)
+			return
+		}
+		if len(req.Prompt) > recommender.MaxLLMPromptBytes {
+			s.fail(w, "feed", fmt.Sprintf("prompt must be at most %d bytes", recommender.MaxLLMPromptBytes), http.StatusBadRequest)
+			return
+		}
+		if req.Weights != nil {
+			s.fail(w, "feed", "weights do not apply to slates ranked by prompt", http.StatusBadRequest)
+			return
+		}
+		maxSlateSize = recommender.MaxLLMPosts
+	}
+	if req.SlateSize < 0 || req.SlateSize > maxSlateSize {
+		s.fail(w, "feed", fmt.Sprintf("slate_size must be from 1 to %d", maxSlateSize), http.StatusBadRequest)
+		return
+	}
+	if req.Weights != nil {
+		if err := req.Weights.Validate(); err != nil {
+			s.fail(w, "feed", err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if !validExperimentArm(req.ExperimentArm) {
+		s.fail(w, "feed", fmt.Sprintf("experiment_arm must be at most %d letters, digits, '_', or '-'", maxExperimentArmBytes), http.StatusBadRequest)
+		return
+	}
+	ctx, cursor, ok := s.startPage(w, r, "feed", req.SlateSize, req.pageRequest)
+	if !ok {
+		return
+	}
+	if req.ExperimentArm != "" {
+		ctx = recommender.WithExperimentArm(ctx, req.ExperimentArm)
+	}
+	if req.MutedDIDs != nil && req.UserDID != "" {
+		s.feed.blocks.SetMutes(req.UserDID, req.MutedDIDs)
+	}
+
+	// Explained slates are built for the request, bypassing the cache
+	cache := s.feed.cache
+	if recommender.ParseExplain(r.URL.Query()) {
+		ctx = recommender.WithExplain(ctx)
+		cache = nil
+	}
+
+	// A cached slate serves first pages, which take up its snapshot, and the
+	// later pages of that snapshot
+	var key recommender.CacheKey
+	slate, level, cached := []recommender.Candidate(nil), recommender.LevelFull, false
+	if cache != nil {
+		key = s.feedCacheKey(req, cursor.Size)
+		if hit, snapshot, ok := cache.Get(key); ok && (req.Cursor == "" || snapshot.UnixMicro() == cursor.SnapshotUs) {
+			// Blocks and mutes since the slate was cached apply at once
+			slate, cached = s.feed.blocks.Filter(ctx, req.UserDID, hit), true
+			cursor.SnapshotUs = snapshot.UnixMicro()
+			s.logger.Metric("recommender.cache.hit_count", 1)
+		} else {
+			s.logger.Metric("recommender.cache.miss_count", 1)
+		}
+	}
+	if !cached {
+		var err error
+		if slate, level, err = s.buildFeed(ctx, req, cursor.Size); err != nil {
+			s.logger.Error("Feed failed for %s: %v", req.UserDID, err)
+			s.fail(w, "feed", "recommendation failed", http.StatusInternalServerError)
+			return
+		}
+		if cache != nil && req.Cursor == "" && level == recommender.LevelFull {
+			cache.Put(key, slate, time.UnixMicro(cursor.SnapshotUs))
+		}
+	}
+	page, next, ok := pageSlate(s, w, "feed", slate, cursor, req.PageSize, func(c recommender.Candidate) string { return c.AtURI })
+	if !ok {
+		return
+	}
+	tags := recommender.ImpressionTags{ExperimentArm: req.ExperimentArm}
+	if req.Prompt != "" {
+		tags.PromptVersion = s.llm.PromptHash(req.Prompt)
+	}
+	s.recordImpressions(req.UserDID, page, cursor.Offset, tags)
+
+	posts := make([]feedPost, len(page))
+	for i, c := range page {
+		posts[i] = feedPost{AtURI: c.AtURI, AuthorDID: c.AuthorDID, Score: c.Score, Strategy: c.Strategy, Explanation: c.Explanation}
+	}
+	s.respond(w, "feed", start, feedResponse{DegradationLevel: level.String(), Slate: posts, NextCursor: next})
+}
+
+// buildFeed runs the slate pipeline for a feed request, building a slate of
+// slateSize at the snapshot bound to ctx. Engagement slates served at full
+// are passed to the shadow scorer with the pool they were scored from, which
+// the guard, blocks and guardrails have already filtered.
+func (s *apiServer) buildFeed(ctx context.Context, req feedRequest, slateSize int) ([]recommender.Candidate, recommender.DegradationLevel, error) {
+	// Pipelines are per request, so the pool is only written by its Score
+	var pool []recommender.Candidate
+	score := s.model.ScoreFunc(req.Weights)
+	stages := recommender.Stages{
+		Retrieve: func(ctx context.Context, userDID string, poolSize int) ([]recommender.Candidate, error) {
+			return s.model.Retrieve(ctx, userDID, req.Source, poolSize)
+		},
+		Score: func(ctx context.Context, userDID string, candidates []recommender.Candidate) ([]recommender.Candidate, error) {
+			pool = candidates
+			return score(ctx, userDID, candidates)
+		},
+		Guard:      s.feed.guard,
+		Accounts:   s.feed.accounts,
+		Blocks:     s.feed.blocks,
+		Guardrails: s.feed.guardrails,
+		Filter:     s.feed.filter,
+	}
+	if req.Prompt != "" {
+		stages.Score = s.llm.ScoreFunc(req.Prompt)
+	}
+	if s.feed.cache != nil {
+		stages.Cached = s.feed.cache.Last
+	}
+	pipeline := recommender.NewDegradingPipeline(stages, recommender.StageBudgets{
+		Retrieval: s.feed.retrievalBudget,
+		Scoring:   s.scoringBudget,
+	}, recommender.FeedPoolSize(slateSize, req.Prompt != ""), 0, s.logger)
+	slate, level, err := pipeline.Serve(ctx, req.UserDID, slateSize)
+	if err == nil && level == recommender.LevelFull && pool != nil {
+		s.feed.shadow.Observe(ctx, req.UserDID, pool, slate)
+	}
+	return slate, level, err
+}
+
+// feedCacheKey returns the cache key of a feed request's slate of slateSize.
+// Requests that leave weights unset share the key of the model's weights.
+// Arms filter candidates differently, so each has its own slate.
+func (s *apiServer) feedCacheKey(req feedRequest, slateSize int) recommender.CacheKey {
+	var weights map[string]float64
+	if w := req.Weights; w != nil {
+		weights = map[string]float64{"bias": w.Bias, "popularity": w.Popularity, "recency": w.Recency, "similarity": w.Similarity, "affinity": w.Affinity}
+	}
+	promptSet := req.Source + "|" + strconv.Itoa(slateSize) + "|" + req.ExperimentArm
+	if req.Prompt != "" {
+		promptSet += "|" + s.llm.PromptHash(req.Prompt)
+	}
+	return recommender.NewCacheKey(req.UserDID, weights, promptSet)
+}
+
+// validExperimentArm reports whether arm is empty or a name safe to put in
+// metric names: guardrail drops are counted per arm
+func validExperimentArm(arm string) bool {
+	if len(arm) > maxExperimentArmBytes {
+		return false
+	}
+	for _, r := range arm {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// recordImpressions logs the impressions of a served page, offset the slate
+// position of its first post, and indexes them in the background
+func (s *apiServer) recordImpressions(userDID string, page []recommender.Candidate, offset int, tags recommender.ImpressionTags) {
+	impressions := recommender.LogImpressions(s.logger, userDID, page, offset, time.Now(), tags)
+	if s.feed.impressions == nil || len(impressions) == 0 {
+		return
+	}
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), impressionIndexTimeout)
+		defer cancel()
+		if err := recommender.IndexImpressions(ctx, s.feed.impressions, recommender.ImpressionsIndex, impressions, false, s.logger); err != nil {
+			s.logger.Error("Failed to index %d impressions of %s: %v", len(impressions), userDID, err)
+		}
+	}()
+}
+
+// Wait blocks until impressions being indexed are written and shadow runs
+// finish
+func (s *apiServer) Wait() {
+	s.background.Wait()
+	if s.feed.shadow != nil {
+		s.feed.shadow.Wait()
+	}
+}
+
+// startPage resolves the paging fields of a slate request: the cursor of the
+// page to serve, whose Size is the slate to build and SnapshotUs the time to
+// build it at, and a context bounding retrieval to that snapshot. A first
+// page is built at now, slateSize long; later pages rebuild the slate their
+// cursor describes, whatever slate_size says. It responds with an error and
+// returns false if the fields are invalid.
+func (s *apiServer) startPage(w http.ResponseWriter, r *http.Request, endpoint string, slateSize int, req pageRequest) (context.Context, recommender.FeedCursor, bool) {
+	cursor := recommender.FeedCursor{SnapshotUs: time.Now().UnixMicro(), Size: slateSize}
+	if req.PageSize < 0 {
+		s.fail(w, endpoint, "page_size must not be negative", http.StatusBadRequest)
+		return nil, cursor, false
+	}
+	if req.Cursor != "" || (req.PageSize > 0 && req.PageSize < slateSize) {
+		if s.cursors == nil {
+			s.fail(w, endpoint, "paging is not configured", http.StatusServiceUnavailable)
+			return nil, cursor, false
+		}
+	}
+	if req.Cursor != "" {
+		decoded, err := s.cursors.Decode(req.Cursor)
+		if err != nil || decoded.Size <= 0 || decoded.SnapshotUs <= 0 {
+			s.fail(w, endpoint, "invalid cursor", http.StatusBadRequest)
+			return nil, cursor, false
+		}
+		cursor = decoded
+	}
+	return recommender.WithSnapshot(r.Context(), time.UnixMicro(cursor.SnapshotUs)), cursor, true
+}
+
+// pageSlate returns the page of slate cursor points to, pageSize long
+// (default: the rest of the slate), and the encoded cursor of the next page,
+// or "" on the last one. A cursor whose earlier pages no longer match the
+// rebuilt slate is answered 409: the client restarts from the first page.
+func pageSlate[T any](s *apiServer, w http.ResponseWriter, endpoint string, slate []T, cursor recommender.FeedCursor, pageSize int, atURI func(T) string) ([]T, string, bool) {
+	if pageSize == 0 {
+		pageSize = cursor.Size
+	}
+	page, next, err := recommender.PageSlate(slate, cursor, cursor.SnapshotUs, pageSize, atURI)
+	if errors.Is(err, recommender.ErrStaleCursor) {
+		s.logger.Metric("recommender_api.stale_cursor_count", 1)
+		s.fail(w, endpoint, "stale cursor; restart from the first page", http.StatusConflict)
+		return nil, "", false
+	}
+	if err != nil {
+		s.fail(w, endpoint, err.Error(), http.StatusBadRequest)
+		return nil, "", false
+	}
+	if next == nil {
+		return page, "", true
+	}
+	token, err := s.cursors.Encode(*next)
+	if err != nil {
+		s.logger.Error("Failed to encode %s cursor: %v", endpoint, err)
+		s.fail(w, endpoint, "failed to encode cursor", http.StatusInternalServerError)
+		return nil, "", false
+	}
+	return page, token, true
+}
+
+// decode authenticates r and decodes its JSON body into v, responding with
+// an error and returning false if either fails
+func (s *apiServer) decode(w http.ResponseWriter, r *http.Request, endpoint string, v interface{}) bool {
+	s.logger.Metric("recommender_api."+endpoint+".request_count", 1)
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	if !s.authenticate(r) {
+		s.logger.Metric("recommender_api.unauthorized_count", 1)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.fail(w, endpoint, "request body too large", http.StatusRequestEntityTooLarge)
+			return false
+		}
+		if errors.Is(err, io.EOF) {
+			err = errors.New("empty request body")
+		}
+		s.fail(w, endpoint, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// authenticate reports whether r bears one of the server's keys
+func (s *apiServer) authenticate(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	found := false
+	for _, key := range s.keys {
+		if subtle.ConstantTimeCompare([]byte(token), key) == 1 {
+			found = true
+		}
+	}
+	return found
+}
+
+// fail responds with message and status, counting the error
+func (s *apiServer) fail(w http.ResponseWriter, endpoint, message string, status int) {
+	s.logger.Metric("recommender_api."+endpoint+".error_count", 1)
+	http.Error(w, message, status)
+}
+
+// respond writes body as JSON and records the request's duration
+func (s *apiServer) respond(w http.ResponseWriter, endpoint string, start time.Time, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		s.logger.Error("Failed to encode %s response: %v", endpoint, err)
+	}
+	s.logger.Metric("recommender_api."+endpoint+".duration_ms", float64(time.Since(start).Milliseconds()))
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+	"github.com/greenearth/ingest/internal/recommender"
+)
+
+// newTestLLM serves scores of 0.9 for posts mentioning "solar" and 0.1 for
+// the rest
+func newTestLLM(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Posts []recommender.LLMPost `json:"posts"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode LLM request: %v", err)
+		}
+		scores := make([]float64, len(req.Posts))
+		for i, p := range req.Posts {
+			scores[i] = 0.1
+			if strings.Contains(p.Text, "solar") {
+				scores[i] = 0.9
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"scores": scores})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newTestAPIServer(t *testing.T) (*estest.Server, *apiServer) {
+	t.Helper()
+	es := estest.New(t)
+	contents := map[string]string{
+		"at://did:plc:a/app.bsky.feed.post/1": "New solar farm opens",
+		"at://did:plc:b/app.bsky.feed.post/2": "Match highlights",
+	}
+	now := time.Now().UTC()
+	for uri, likes := range map[string]int{
+		"at://did:plc:a/app.bsky.feed.post/1": 3,
+		"at://did:plc:b/app.bsky.feed.post/2": 40,
+	} {
+		es.Put("posts", uri, map[string]interface{}{
+			"at_uri":     uri,
+			"author_did": common.ExtractDIDFromATURI(uri),
+			"created_at": now.Add(-time.Hour).Format(time.RFC3339),
+			"indexed_at": now.Add(-time.Hour).Format(time.RFC3339),
+			"like_count": likes,
+			"content":    contents[uri],
+		})
+	}
+	model := recommender.NewEngagementModel(es.Client, recommender.EngagementConfig{Window: 24 * time.Hour}, common.NewLogger(false))
+	llm := recommender.NewLLMClient(recommender.LLMClientConfig{URL: newTestLLM(t).URL, Model: "test"}, common.NewLogger(false))
+	scorer := recommender.NewLLMScorer(llm, es.Client, recommender.LLMScorerConfig{}, common.NewLogger(false))
+	cursors, err := recommender.NewCursorSigner([]byte("cursor-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	guard, err := common.NewTombstoneGuard(es.Client, common.TombstoneGuardFilter, common.NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	api, err := newAPIServer(model, scorer, cursors, time.Second, feedConfig{guard: guard, impressions: es.Client}, "key-1, key-2", common.NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return es, api
+}
+
+func post(handler http.Handler, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPIServer_PredictEngagement(t *testing.T) {
+	_, api := newTestAPIServer(t)
+	handler := api.Handler()
+
+	rec := post(handler, "/v1/predict_engagement", "key-2", `{"user_did":"did:plc:u","at_uris":["at://did:plc:a/app.bsky.feed.post/1","at://did:plc:b/app.bsky.feed.post/2"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var response predictResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Predictions) != 2 || response.Predictions[0].AtURI != "at://did:plc:a/app.bsky.feed.post/1" || response.Predictions[1].Features.LikeCount != 40 {
+		t.Fatalf("expected a prediction per post in request order, got %+v", response.Predictions)
+	}
+	for _, p := range response.Predictions {
+		if p.Probability <= 0 || p.Probability >= 1 {
+			t.Errorf("expected a probability, got %+v", p)
+		}
+	}
+}
+
+func TestAPIServer_RecommendMostEngagingPosts(t *testing.T) {
+	_, api := newTestAPIServer(t)
+	handler := api.Handler()
+
+	rec := post(handler, "/v1/recommend_most_engaging_posts", "key-1", `{"user_did":"did:plc:u","slate_size":1,"weights":{"popularity":1}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var response recommendResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Source != recommender.EngagementSourceTrending || len(response.Slate) != 1 || response.Slate[0].AtURI != "at://did:plc:b/app.bsky.feed.post/2" {
+		t.Errorf("expected the most-liked post from trending, got %+v", response)
+	}
+}
+
+func TestAPIServer_PagesSlate(t *testing.T) {
+	es, api := newTestAPIServer(t)
+	handler := api.Handler()
+	page := func(body string) recommendResponse {
+		t.Helper()
+		rec := post(handler, "/v1/recommend_most_engaging_posts", "key-1", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var response recommendResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	first := page(`{"user_did":"did:plc:u","slate_size":2,"page_size":1,"weights":{"popularity":1}}`)
+	if len(first.Slate) != 1 || first.Slate[0].AtURI != "at://did:plc:b/app.bsky.feed.post/2" || first.NextCursor == "" {
+		t.Fatalf("expected the first page and a cursor, got %+v", first)
+	}
+
+	// A post indexed after the first page is left out of later ones
+	now := time.Now().UTC()
+	es.Put("posts", "at://did:plc:c/app.bsky.feed.post/3", map[string]interface{}{
+		"at_uri":     "at://did:plc:c/app.bsky.feed.post/3",
+		"author_did": "did:plc:c",
+		"created_at": now.Add(-2 * time.Hour).Format(time.RFC3339),
+		"indexed_at": now.Add(time.Minute).Format(time.RFC3339),
+		"like_count": 100,
+	})
+	second := page(`{"user_did":"did:plc:u","page_size":1,"weights":{"popularity":1},"cursor":"` + first.NextCursor + `"}`)
+	if len(second.Slate) != 1 || second.Slate[0].AtURI != "at://did:plc:a/app.bsky.feed.post/1" || second.NextCursor != "" {
+		t.Errorf("expected the second and last page of the first page's snapshot, got %+v", second)
+	}
+
+	tampered := first.NextCursor[:len(first.NextCursor)-2] + "xx"
+	if rec := post(handler, "/v1/recommend_most_engaging_posts", "key-1", `{"cursor":"`+tampered+`"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected a tampered cursor rejected, got %d", rec.Code)
+	}
+
+	// Like counts are live within a snapshot: once they reorder posts already
+	// served, the client is told to restart
+	first = page(`{"user_did":"did:plc:u","slate_size":2,"page_size":1,"weights":{"popularity":1}}`)
+	es.Put("posts", "at://did:plc:a/app.bsky.feed.post/1", map[string]interface{}{
+		"at_uri":     "at://did:plc:a/app.bsky.feed.post/1",
+		"author_did": "did:plc:a",
+		"created_at": now.Add(-time.Hour).Format(time.RFC3339),
+		"indexed_at": now.Add(-time.Hour).Format(time.RFC3339),
+		"like_count": 400,
+	})
+	rec := post(handler, "/v1/recommend_most_engaging_posts", "key-1", `{"user_did":"did:plc:u","page_size":1,"weights":{"popularity":1},"cursor":"`+first.NextCursor+`"}`)
+	if rec.Code != http.StatusConflict {
+		t.Errorf("expected 409 once like counts reorder served posts, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if restarted := page(`{"user_did":"did:plc:u","slate_size":2,"page_size":1,"weights":{"popularity":1}}`); restarted.Slate[0].AtURI != "at://did:plc:a/app.bsky.feed.post/1" {
+		t.Errorf("expected the restarted first page at the new counts, got %+v", restarted)
+	}
+}
+
+func TestAPIServer_PagingDisabled(t *testing.T) {
+	api, err := newAPIServer(nil, nil, nil, 0, feedConfig{}, "key-1", common.NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := post(api.Handler(), "/v1/recommend_most_engaging_posts", "key-1", `{"slate_size":10,"page_size":5}`); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without a cursor secret, got %d", rec.Code)
+	}
+}
+
+func TestAPIServer_LLMScore(t *testing.T) {
+	_, api := newTestAPIServer(t)
+	handler := api.Handler()
+
+	rec := post(handler, "/v1/llm_score", "key-1", `{"prompt":"climate news","at_uris":["at://did:plc:b/app.bsky.feed.post/2","at://did:plc:a/app.bsky.feed.post/1","at://did:plc:c/app.bsky.feed.post/3"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var response llmScoreResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.PromptHash) != 64 || len(response.Scores) != 3 {
+		t.Fatalf("expected a score per post and the prompt hash, got %+v", response)
+	}
+	if response.Scores[0].Score != 0.1 || response.Scores[1].Score != 0.9 || !response.Scores[2].Missing {
+		t.Errorf("unexpected scores %+v", response.Scores)
+	}
+}
+
+func TestAPIServer_RecommendHighestScoringLLMPosts(t *testing.T) {
+	_, api := newTestAPIServer(t)
+	handler := api.Handler()
+
+	rec := post(handler, "/v1/recommend_highest_scoring_llm_posts", "key-1", `{"user_did":"did:plc:u","slate_size":1,"prompt":"climate news"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var response recommendLLMResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Source != recommender.EngagementSourceTrending || response.DegradationLevel != "full" || len(response.Slate) != 1 || response.Slate[0].AtURI != "at://did:plc:a/app.bsky.feed.post/1" {
+		t.Errorf("expected the most relevant post, not the most liked, got %+v", response)
+	}
+}
+
+func TestAPIServer_Feed(t *testing.T) {
+	es, api := newTestAPIServer(t)
+	handler := api.Handler()
+	feed := func(body string) feedResponse {
+		t.Helper()
+		rec := post(handler, "/v1/feed", "key-1", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var response feedResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	response := feed(`{"user_did":"did:plc:u","weights":{"popularity":1}}`)
+	if response.DegradationLevel != "full" || len(response.Slate) != 2 || response.Slate[0].AtURI != "at://did:plc:b/app.bsky.feed.post/2" {
+		t.Fatalf("expected the most-liked post first, got %+v", response)
+	}
+	if top := response.Slate[0]; top.Strategy != recommender.StrategyEngagementTrending || top.Score <= response.Slate[1].Score || top.AuthorDID != "did:plc:b" {
+		t.Errorf("unexpected slate entry %+v", top)
+	}
+
+	// Served posts are indexed as impressions, positioned in the slate
+	api.Wait()
+	if es.Len(recommender.ImpressionsIndex) != 2 {
+		t.Fatalf("expected an impression per served post, got %d", es.Len(recommender.ImpressionsIndex))
+	}
+	page := feed(`{"user_did":"did:plc:u","weights":{"popularity":1},"page_size":1}`)
+	feed(`{"user_did":"did:plc:u","weights":{"popularity":1},"page_size":1,"cursor":"` + page.NextCursor + `"}`)
+	api.Wait()
+	if es.Len(recommender.ImpressionsIndex) != 4 {
+		t.Errorf("expected an impression per post on each page, got %d", es.Len(recommender.ImpressionsIndex))
+	}
+
+	// explain=true explains each post
+	rec := post(handler, "/v1/feed?explain=true", "key-1", `{"user_did":"did:plc:u","weights":{"popularity":1}}`)
+	var explained feedResponse
+	if err := json.NewDecoder(rec.Body).Decode(&explained); err != nil {
+		t.Fatal(err)
+	}
+	if e := explained.Slate[0].Explanation; e == nil || e.Source != recommender.StrategyEngagementTrending || e.RetrievalRank == 0 || e.Level != "full" || e.Features["like_count"] != 40 {
+		t.Errorf("unexpected explanation %+v", e)
+	}
+	if response.Slate[0].Explanation != nil {
+		t.Error("expected no explanation unless asked for")
+	}
+
+	// A prompt ranks by relevance instead
+	response = feed(`{"user_did":"did:plc:u","prompt":"climate news","slate_size":1}`)
+	if len(response.Slate) != 1 || response.Slate[0].AtURI != "at://did:plc:a/app.bsky.feed.post/1" || response.Slate[0].Score != 0.9 {
+		t.Errorf("expected the most relevant post, got %+v", response)
+	}
+
+	// Posts breaking the post filters are left out
+	api.feed.filter = recommender.NewPostFilter(es.Client, recommender.PostFilterRules{MinContentLength: 18}, common.NewLogger(false))
+	response = feed(`{"user_did":"did:plc:u","weights":{"popularity":1}}`)
+	if len(response.Slate) != 1 || response.Slate[0].AtURI != "at://did:plc:a/app.bsky.feed.post/1" {
+		t.Errorf("expected the short post filtered out, got %+v", response)
+	}
+	api.feed.filter = nil
+
+	// Guardrails apply the request's arm
+	es.Put("follows", "at://did:plc:fan/app.bsky.graph.follow/1", map[string]interface{}{"author_did": "did:plc:fan", "subject_did": "did:plc:a"})
+	api.feed.guardrails = recommender.NewGuardrails(es.Client, recommender.GuardrailConfig{
+		Default: recommender.GuardrailRules{MinFollowers: 1},
+		Arms:    map[string]recommender.GuardrailRules{"control": {}},
+	}, nil, common.NewLogger(false))
+	response = feed(`{"user_did":"did:plc:u","weights":{"popularity":1}}`)
+	if len(response.Slate) != 1 || response.Slate[0].AtURI != "at://did:plc:a/app.bsky.feed.post/1" {
+		t.Errorf("expected the unfollowed author left out, got %+v", response)
+	}
+	if response = feed(`{"user_did":"did:plc:u","weights":{"popularity":1},"experiment_arm":"control"}`); len(response.Slate) != 2 {
+		t.Errorf("expected the control arm unguarded, got %+v", response)
+	}
+	api.Wait()
+	bulks := es.Calls(estest.APIBulk)
+	if items := bulks[len(bulks)-1].BulkItems(); len(items) != 2 || !strings.Contains(string(items[0].Source), `"experiment_arm":"control"`) {
+		t.Errorf("expected the arm tagged on impressions, got %+v", items)
+	}
+	api.feed.guardrails = nil
+
+	// Deleted posts are left out though still indexed
+	es.Put("post_tombstones", "at://did:plc:b/app.bsky.feed.post/2", map[string]interface{}{"at_uri": "at://did:plc:b/app.bsky.feed.post/2"})
+	response = feed(`{"user_did":"did:plc:u","weights":{"popularity":1}}`)
+	if len(response.Slate) != 1 || response.Slate[0].AtURI != "at://did:plc:a/app.bsky.feed.post/1" {
+		t.Errorf("expected the tombstoned post left out, got %+v", response)
+	}
+}
+
+func TestAPIServer_FeedCache(t *testing.T) {
+	es, api := newTestAPIServer(t)
+	api.feed.cache = recommender.NewSlateCache(time.Minute)
+	handler := api.Handler()
+	feed := func(body string) feedResponse {
+		t.Helper()
+		rec := post(handler, "/v1/feed", "key-1", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var response feedResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	first := feed(`{"user_did":"did:plc:u","weights":{"popularity":1},"page_size":1}`)
+	searches := len(es.Calls(estest.APISearch))
+
+	// Posts indexed since don't reach the cached slate or its later pages
+	es.Put("posts", "at://did:plc:c/app.bsky.feed.post/3", map[string]interface{}{
+		"at_uri":     "at://did:plc:c/app.bsky.feed.post/3",
+		"author_did": "did:plc:c",
+		"created_at": time.Now().UTC().Format(time.RFC3339),
+		"indexed_at": time.Now().UTC().Format(time.RFC3339),
+		"like_count": 500,
+	})
+	again := feed(`{"user_did":"did:plc:u","weights":{"popularity":1},"page_size":1}`)
+	if len(again.Slate) != 1 || again.Slate[0].AtURI != first.Slate[0].AtURI || again.NextCursor != first.NextCursor {
+		t.Errorf("expected the cached first page, got %+v", again)
+	}
+	second := feed(`{"user_did":"did:plc:u","weights":{"popularity":1},"page_size":1,"cursor":"` + again.NextCursor + `"}`)
+	if len(second.Slate) != 1 || second.Slate[0].AtURI == first.Slate[0].AtURI || second.NextCursor != "" {
+		t.Errorf("expected the cached second page, got %+v", second)
+	}
+	if got := len(es.Calls(estest.APISearch)); got != searches {
+		t.Errorf("expected cached pages served without searching, got %d more searches", got-searches)
+	}
+
+	// Other weights, and an invalidated user, rebuild the slate
+	if response := feed(`{"user_did":"did:plc:u","weights":{"popularity":1,"recency":1},"page_size":1}`); response.Slate[0].AtURI != "at://did:plc:c/app.bsky.feed.post/3" {
+		t.Errorf("expected other weights to rebuild the slate, got %+v", response)
+	}
+	api.feed.cache.InvalidateUser("did:plc:u")
+	if response := feed(`{"user_did":"did:plc:u","weights":{"popularity":1},"page_size":1}`); response.Slate[0].AtURI != "at://did:plc:c/app.bsky.feed.post/3" {
+		t.Errorf("expected an invalidated slate rebuilt, got %+v", response)
+	}
+}
+
+func TestAPIServer_FeedShadow(t *testing.T) {
+	_, api := newTestAPIServer(t)
+	var mu sync.Mutex
+	var shadowed []string
+	api.feed.shadow = recommender.NewShadowScorer(recommender.ShadowConfig{
+		Name: "test",
+		Score: func(_ context.Context, userDID string, candidates []recommender.Candidate) ([]recommender.Candidate, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			shadowed = append(shadowed, userDID)
+			if len(candidates) != 2 {
+				t.Errorf("expected the scored pool shadowed, got %+v", candidates)
+			}
+			return candidates, nil
+		},
+		SampleRate: 1,
+	}, common.NewLogger(false))
+	handler := api.Handler()
+
+	for _, body := range []string{
+		`{"user_did":"did:plc:u","weights":{"popularity":1}}`,
+		`{"user_did":"did:plc:u","prompt":"climate news"}`,
+	} {
+		if rec := post(handler, "/v1/feed", "key-1", body); rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+	api.Wait()
+	if len(shadowed) != 1 || shadowed[0] != "did:plc:u" {
+		t.Errorf("expected only the engagement slate shadowed, got %v", shadowed)
+	}
+}
+
+func TestAPIServer_FeedBlocksAndMutes(t *testing.T) {
+	es, api := newTestAPIServer(t)
+	api.feed.blocks = recommender.NewBlockCache(es.Client, common.BlocksIndex, time.Minute, common.NewLogger(false))
+	api.feed.cache = recommender.NewSlateCache(time.Minute)
+	handler := api.Handler()
+	feed := func(body string) []feedPost {
+		t.Helper()
+		rec := post(handler, "/v1/feed", "key-1", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var response feedResponse
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		return response.Slate
+	}
+
+	es.Put(common.BlocksIndex, "at://did:plc:b/app.bsky.graph.block/1", map[string]interface{}{
+		"at_uri":      "at://did:plc:b/app.bsky.graph.block/1",
+		"author_did":  "did:plc:b",
+		"subject_did": "did:plc:u",
+	})
+	if slate := feed(`{"user_did":"did:plc:u"}`); len(slate) != 1 || slate[0].AtURI != "at://did:plc:a/app.bsky.feed.post/1" {
+		t.Fatalf("expected the account that blocked the user left out, got %+v", slate)
+	}
+
+	// Mutes apply to the cached slate, and an empty list clears them
+	if slate := feed(`{"user_did":"did:plc:u","muted_dids":["did:plc:a"]}`); len(slate) != 0 {
+		t.Errorf("expected the muted account left out, got %+v", slate)
+	}
+	if slate := feed(`{"user_did":"did:plc:u","muted_dids":[]}`); len(slate) != 1 {
+		t.Errorf("expected mutes cleared, got %+v", slate)
+	}
+}
+
+func TestAPIServer_LLMDisabled(t *testing.T) {
+	api, err := newAPIServer(nil, nil, nil, 0, feedConfig{}, "key-1", common.NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/v1/llm_score", "/v1/recommend_highest_scoring_llm_posts", "/v1/feed"} {
+		if rec := post(api.Handler(), path, "key-1", `{"prompt":"climate news"}`); rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s: expected 503 without an LLM endpoint, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestAPIServer_RejectsInvalidRequests(t *testing.T) {
+	es, api := newTestAPIServer(t)
+	handler := api.Handler()
+
+	tests := []struct {
+		name, path, token, body string
+		want                    int
+	}{
+		{"no token", "/v1/predict_engagement", "", `{"at_uris":["at://did:plc:a/app.bsky.feed.post/1"]}`, http.StatusUnauthorized},
+		{"unknown token", "/v1/predict_engagement", "key-3", `{"at_uris":["at://did:plc:a/app.bsky.feed.post/1"]}`, http.StatusUnauthorized},
+		{"no posts", "/v1/predict_engagement", "key-1", `{"user_did":"did:plc:u"}`, http.StatusBadRequest},
+		{"unknown field", "/v1/predict_engagement", "key-1", `{"ids":["at://did:plc:a/app.bsky.feed.post/1"]}`, http.StatusBadRequest},
+		{"empty body", "/v1/recommend_most_engaging_posts", "key-1", ``, http.StatusBadRequest},
+		{"unknown source", "/v1/recommend_most_engaging_posts", "key-1", `{"source":"following"}`, http.StatusBadRequest},
+		{"slate too large", "/v1/recommend_most_engaging_posts", "key-1", `{"slate_size":501}`, http.StatusBadRequest},
+		{"no prompt", "/v1/llm_score", "key-1", `{"at_uris":["at://did:plc:a/app.bsky.feed.post/1"]}`, http.StatusBadRequest},
+		{"no posts to score", "/v1/llm_score", "key-1", `{"prompt":"climate news"}`, http.StatusBadRequest},
+		{"LLM slate too large", "/v1/recommend_highest_scoring_llm_posts", "key-1", `{"prompt":"climate news","slate_size":201}`, http.StatusBadRequest},
+		{"unknown feed source", "/v1/feed", "key-1", `{"source":"following"}`, http.StatusBadRequest},
+		{"feed too large", "/v1/feed", "key-1", `{"slate_size":501}`, http.StatusBadRequest},
+		{"prompted feed too large", "/v1/feed", "key-1", `{"prompt":"climate news","slate_size":201}`, http.StatusBadRequest},
+		{"invalid experiment arm", "/v1/feed", "key-1", `{"experiment_arm":"arm.1"}`, http.StatusBadRequest},
+		{"weights with a prompt", "/v1/feed", "key-1", `{"prompt":"climate news","weights":{"popularity":1}}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		if rec := post(handler, tt.path, tt.token, tt.body); rec.Code != tt.want {
+			t.Errorf("%s: expected %d, got %d: %s", tt.name, tt.want, rec.Code, rec.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/predict_engagement", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected GET rejected, got %d", rec.Code)
+	}
+	if calls := es.Calls(estest.APISearch); len(calls) != 0 {
+		t.Errorf("expected invalid requests not to search, got %d searches", len(calls))
+	}
+}
+
+func TestNewAPIServer_RequiresKeys(t *testing.T) {
+	if _, err := newAPIServer(nil, nil, nil, 0, feedConfig{}, " , ", common.NewLogger(false)); err == nil {
+		t.Error("expected an error without API keys")
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/stage_mirror"
+)
+
+func main() {
+	// Parse command line flags
+	indices := flag.String("indices", strings.Join(stage_mirror.DefaultIndices, ","), "Comma-separated aliases to mirror")
+	samplePercent := flag.Float64("sample-percent", 10, "Percentage of author DIDs to mirror (0-100)")
+	allowDIDs := flag.String("allow-dids", "", "Comma-separated DIDs always mirrored (default: GE_MIRROR_ALLOW_DIDS)")
+	lookback := flag.Duration("lookback", 24*time.Hour, "How far back to start an index that has no saved progress")
+	pageSize := flag.Int("page-size", 1000, "Documents per source search and target bulk request")
+	dryRun := flag.Bool("dry-run", false, "Read and sample from the source without writing to the target or saving progress")
+	skipTLSVerify := flag.Bool("skip-tls-verify", false, "Skip TLS certificate verification (use for local development only)")
+	debug := flag.Bool("debug", false, "Enable debug logging")
+	flag.Parse()
+
+	// Load configuration
+	config := common.LoadConfig()
+	logger := common.NewLogger(config.LoggingEnabled)
+	logger.SetService("stage_mirror")
+	logger.SetDebugEnabled(*debug)
+	otelCollector, err := common.NewOTelMetricCollector("stage-mirror", config.Environment, config.GCPProjectID, config.GCPRegion, config.MetricExportIntervalSec)
+	if err != nil {
+		logger.Error("Failed to create OTel metric collector: %v (continuing without metrics)", err)
+	} else {
+		logger.SetMetricCollector(otelCollector)
+		defer func() {
+			if err := otelCollector.Shutdown(context.Background()); err != nil {
+				logger.Error("Failed to shutdown OTel metric collector: %v", err)
+			}
+		}()
+	}
+
+	logger.Info("Green Earth Ingex - Stage Mirror")
+
+	// The target is this environment's cluster; never write a sample into prod
+	if config.Environment == "prod" {
+		logger.Error("stage_mirror writes to GE_ELASTICSEARCH_URL and refuses to run with GE_ENVIRONMENT=prod")
+		os.Exit(1)
+	}
+	if config.MirrorSourceURL == "" {
+		logger.Error("GE_MIRROR_SOURCE_URL environment variable is required")
+		os.Exit(1)
+	}
+	if config.ElasticsearchURL == "" {
+		logger.Error("GE_ELASTICSEARCH_URL environment variable is required")
+		os.Exit(1)
+	}
+	if *samplePercent < 0 || *samplePercent > 100 {
+		logger.Error("-sample-percent must be between 0 and 100, got %v", *samplePercent)
+		os.Exit(1)
+	}
+	if *allowDIDs == "" {
+		*allowDIDs = config.MirrorAllowDIDs
+	}
+
+	if *dryRun {
+		logger.Info("Running in DRY-RUN mode - nothing will be written to %s", config.ElasticsearchURL)
+	}
+
+	// Setup context with cancellation for graceful shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Handle shutdown signals
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigChan
+		logger.Info("Received signal %v, shutting down...", sig)
+		cancel()
+	}()
+
+	mirrorConfig := stage_mirror.Config{
+		Indices:       strings.Split(*indices, ","),
+		SamplePercent: *samplePercent,
+		AllowDIDs:     splitList(*allowDIDs),
+		PageSize:      *pageSize,
+		Lookback:      *lookback,
+		DryRun:        *dryRun,
+	}
+	if err := runMirror(ctx, config, logger, mirrorConfig, *skipTLSVerify); err != nil {
+		logger.Error("Mirror failed: %v", err)
+		logger.Metric("stage_mirror.run_error_count", 1)
+		os.Exit(1)
+	}
+
+	logger.Metric("stage_mirror.run_success_count", 1)
+	logger.Info("Mirror completed successfully")
+}
+
+func runMirror(ctx context.Context, config *common.Config, logger *common.IngestLogger, mirrorConfig stage_mirror.Config, skipTLSVerify bool) error {
+	source, err := common.NewElasticsearchClient(common.ElasticsearchConfig{
+		URL:           config.MirrorSourceURL,
+		APIKey:        config.MirrorSourceAPIKey,
+		SkipTLSVerify: skipTLSVerify || config.ElasticsearchTLSSkipVerify,
+	}, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create source Elasticsearch client: %w", err)
+	}
+	target, err := common.NewElasticsearchClient(common.ElasticsearchConfig{
+		URL:           config.ElasticsearchURL,
+		APIKey:        config.ElasticsearchAPIKey,
+		SkipTLSVerify: skipTLSVerify || config.ElasticsearchTLSSkipVerify,
+	}, logger)
+	if err != nil {
+		return fmt.Errorf("failed to create target Elasticsearch client: %w", err)
+	}
+
+	progress, err := stage_mirror.ReadProgress(ctx, config.MirrorStateFile)
+	if err != nil {
+		return err
+	}
+	logger.Info("Mirroring %s at %.1f%% of authors plus %d allowed DIDs (progress: %s)",
+		strings.Join(mirrorConfig.Indices, ","), mirrorConfig.SamplePercent, len(mirrorConfig.AllowDIDs), config.MirrorStateFile)
+
+	service := stage_mirror.NewService(source, target, mirrorConfig, logger)
+	return service.Mirror(ctx, progress, time.Now(), func(p *stage_mirror.Progress) error {
+		return stage_mirror.WriteProgress(ctx, config.MirrorStateFile, p)
+	})
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,308 @@
+// Package account_deletion purges the documents of deleted accounts off the
+// ingest loop. Deletions are queued and worked through in the background,
+// and the queue is persisted with how far each deletion has got, so a
+// deletion interrupted by a crash or shutdown resumes where it stopped when
+// the service next starts instead of leaving the account half purged.
+package account_deletion
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// Config holds configuration for the deletion queue
+type Config struct {
+	StateFile    string              // Queue state, local path or gs://bucket/object; empty keeps the queue in memory only
+	QueueSize    int                 // Deletions queued before Enqueue waits (default 100)
+	Workers      int                 // Deletions run at once (default 1)
+	MaxAttempts  int                 // Failed attempts before a deletion is given up (default 5)
+	RetryDelay   time.Duration       // Wait between attempts (default 30s)
+	MetricPrefix string              // Prefix of the queue's metrics, e.g. jetstream
+	PostCounts   *common.PostCounter // Takes the like_count changes of deleted likes; may be nil
+	ChangeFeed   *common.ChangeFeed  // Takes a delete event for each deleted document; may be nil
+	DryRun       bool                // Log deletions without making them; the queue is not persisted
+
+	// BeforeDelete, when set, runs before each deletion, e.g. to wait for
+	// the account's documents still being written
+	BeforeDelete func(did string)
+}
+
+// Service runs account deletions in the background
+type Service struct {
+	client *elasticsearch.Client
+	config Config
+	logger *common.IngestLogger
+
+	mu      sync.Mutex // Guards pending, and orders state writes
+	pending map[string]*Deletion
+
+	sendMu sync.RWMutex // Held to send on queue; Close takes it to close queue
+	closed bool
+	queue  chan string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewService creates a deletion queue. Call Start before Enqueue.
+func NewService(client *elasticsearch.Client, config Config, logger *common.IngestLogger) *Service {
+	if config.QueueSize <= 0 {
+		config.QueueSize = 100
+	}
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 5
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = 30 * time.Second
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Service{
+		client:  client,
+		config:  config,
+		logger:  logger,
+		pending: make(map[string]*Deletion),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Start queues the deletions left unfinished in the state file, oldest
+// first, and starts the workers
+func (s *Service) Start() error {
+	if s.persisted() {
+		state, err := ReadState(s.ctx, s.config.StateFile)
+		if err != nil {
+			return err
+		}
+		for did, d := range state.Pending {
+			d.DID = did
+			s.pending[did] = d
+		}
+	}
+
+	resumed := make([]*Deletion, 0, len(s.pending))
+	for _, d := range s.pending {
+		resumed = append(resumed, d)
+	}
+	sort.Slice(resumed, func(i, j int) bool { return resumed[i].QueuedAt.Before(resumed[j].QueuedAt) })
+
+	s.queue = make(chan string, max(s.config.QueueSize, len(resumed)))
+	for _, d := range resumed {
+		s.queue <- d.DID
+	}
+	if len(resumed) > 0 {
+		s.logger.Info("Resuming %d unfinished account deletions from %s", len(resumed), s.config.StateFile)
+		s.logger.Metric(s.metric("account_deletions_resumed_count"), float64(len(resumed)))
+	}
+
+	for range s.config.Workers {
+		s.wg.Add(1)
+		go s.run()
+	}
+	return nil
+}
+
+// Enqueue queues the deletion of the documents of did that kinds selects.
+// timeUs is when the account was deleted. The deletion is persisted before
+// it is queued, and Enqueue waits until there is room in the queue. It
+// reports whether the deletion was queued before ctx was done or the
+// service closed. Enqueueing an account already queued adds kinds to its
+// deletion.
+func (s *Service) Enqueue(ctx context.Context, did string, timeUs int64, kinds common.AccountDeletion) bool {
+	s.sendMu.RLock()
+	defer s.sendMu.RUnlock()
+	if s.closed || s.queue == nil {
+		return false
+	}
+
+	s.mu.Lock()
+	if d, ok := s.pending[did]; ok {
+		d.Posts = d.Posts || kinds.Posts
+		d.Likes = d.Likes || kinds.Likes
+		s.persistLocked()
+		s.mu.Unlock()
+		return true
+	}
+	s.pending[did] = &Deletion{
+		DID:      did,
+		TimeUs:   timeUs,
+		Posts:    kinds.Posts,
+		Likes:    kinds.Likes,
+		QueuedAt: time.Now().UTC(),
+	}
+	s.persistLocked()
+	s.mu.Unlock()
+
+	// A deletion persisted but not queued is resumed on the next start
+	select {
+	case s.queue <- did:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Pending returns the number of deletions queued or in progress
+func (s *Service) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
+
+// Close stops the service taking deletions and waits up to timeout for the
+// queued ones. Deletions not finished by then are cancelled and stay in the
+// state file, to resume when the service next starts.
+func (s *Service) Close(timeout time.Duration) {
+	s.sendMu.Lock()
+	if !s.closed && s.queue != nil {
+		close(s.queue)
+	}
+	s.closed = true
+	s.sendMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		s.logger.Error("Timeout finishing account deletions, cancelling the rest")
+		s.cancel()
+		<-done
+	}
+	s.cancel()
+
+	if n := s.Pending(); n > 0 {
+		if s.persisted() {
+			s.logger.Info("%d account deletions unfinished, resuming them on the next start", n)
+		} else {
+			s.logger.Error("%d account deletions unfinished and not persisted", n)
+		}
+	}
+}
+
+func (s *Service) run() {
+	defer s.wg.Done()
+	for did := range s.queue {
+		if s.ctx.Err() != nil {
+			continue
+		}
+		if s.config.BeforeDelete != nil {
+			s.config.BeforeDelete(did)
+		}
+		s.process(did)
+	}
+}
+
+// process removes the kinds of did's deletion not yet removed, one kind at
+// a time, persisting progress after each
+func (s *Service) process(did string) {
+	for s.ctx.Err() == nil {
+		s.mu.Lock()
+		d, ok := s.pending[did]
+		if !ok {
+			s.mu.Unlock()
+			return
+		}
+		var kinds common.AccountDeletion
+		switch {
+		case d.Posts && !d.PostsDone:
+			kinds.Posts = true
+		case d.Likes && !d.LikesDone:
+			kinds.Likes = true
+		default:
+			s.finishLocked(did)
+			s.mu.Unlock()
+			return
+		}
+		timeUs := d.TimeUs
+		s.mu.Unlock()
+
+		result, err := common.DeleteAccount(s.ctx, s.client, did, timeUs, kinds, s.config.PostCounts, s.config.ChangeFeed, s.config.DryRun, s.logger)
+		s.logger.Metric(s.metric("account_posts_deleted_count"), float64(result.Posts))
+		s.logger.Metric(s.metric("account_replies_deleted_count"), float64(result.Replies))
+		s.logger.Metric(s.metric("account_likes_deleted_count"), float64(result.Likes))
+		if err != nil && s.ctx.Err() != nil {
+			// Cancelled by Close; resumed on the next start
+			return
+		}
+
+		s.mu.Lock()
+		if err == nil {
+			d.PostsDone = d.PostsDone || kinds.Posts
+			d.LikesDone = d.LikesDone || kinds.Likes
+			s.persistLocked()
+			s.mu.Unlock()
+			continue
+		}
+
+		d.Attempts++
+		attempts := d.Attempts
+		abandon := attempts >= s.config.MaxAttempts
+		if abandon {
+			delete(s.pending, did)
+		}
+		s.persistLocked()
+		s.mu.Unlock()
+
+		s.logger.Metric(s.metric("account_deletion_error_count"), 1)
+		if abandon {
+			s.logger.Metric(s.metric("account_deletion_abandoned_count"), 1)
+			s.logger.Error("Giving up account deletion for DID %s after %d attempts: %v", did, attempts, err)
+			return
+		}
+		s.logger.Error("Failed to handle account deletion for DID %s (attempt %d of %d), retrying in %s: %v",
+			did, attempts, s.config.MaxAttempts, s.config.RetryDelay, err)
+		select {
+		case <-time.After(s.config.RetryDelay):
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// finishLocked removes did's completed deletion from the queue
+func (s *Service) finishLocked(did string) {
+	delete(s.pending, did)
+	s.persistLocked()
+	s.logger.Metric(s.metric("account_deletions_count"), 1)
+}
+
+// persistLocked writes the queue to the state file. A failed write is
+// logged; the deletions it missed are lost only if the process also dies
+// before a later write succeeds.
+func (s *Service) persistLocked() {
+	if !s.persisted() {
+		return
+	}
+	state := &State{Pending: s.pending}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := WriteState(ctx, s.config.StateFile, state); err != nil {
+		s.logger.Error("Failed to persist account deletion queue: %v", err)
+		s.logger.Metric(s.metric("account_deletion_state_error_count"), 1)
+	}
+}
+
+// persisted reports whether the queue is kept in the state file
+func (s *Service) persisted() bool {
+	return s.config.StateFile != "" && !s.config.DryRun
+}
+
+func (s *Service) metric(name string) string {
+	if s.config.MetricPrefix == "" {
+		return name
+	}
+	return s.config.MetricPrefix + "." + name
+}
@@ -0,0 +1,112 @@
+package account_deletion
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+const did = "did:plc:deleted"
+
+func putAccount(es *estest.Server) {
+	post := "at://" + did + "/app.bsky.feed.post/1"
+	es.Put("posts", post, map[string]interface{}{"at_uri": post, "author_did": did})
+	for _, uri := range []string{"at://" + did + "/app.bsky.feed.like/a", "at://" + did + "/app.bsky.feed.like/b"} {
+		es.Put("likes", uri, map[string]interface{}{"at_uri": uri, "author_did": did, "subject_uri": "at://did:plc:author/app.bsky.feed.post/1"})
+	}
+}
+
+func TestService_DeletesInBackground(t *testing.T) {
+	es := estest.New(t)
+	putAccount(es)
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	var waited []string
+	service := NewService(es.Client, Config{
+		StateFile:    stateFile,
+		BeforeDelete: func(did string) { waited = append(waited, did) },
+	}, common.NewLogger(false))
+	if err := service.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !service.Enqueue(context.Background(), did, 1760000000000000, common.AccountDeletion{Posts: true, Likes: true}) {
+		t.Fatal("expected the deletion to be queued")
+	}
+	service.Close(5 * time.Second)
+
+	if n := es.Len("likes"); n != 0 {
+		t.Errorf("expected the account's likes deleted, %d left", n)
+	}
+	if n := es.Len(common.WriteAlias("post_tombstones")); n != 1 {
+		t.Errorf("expected the account's post tombstoned, got %d tombstones", n)
+	}
+	if len(waited) != 1 || waited[0] != did {
+		t.Errorf("expected BeforeDelete for %s, got %v", did, waited)
+	}
+	state, err := ReadState(context.Background(), stateFile)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(state.Pending) != 0 || service.Pending() != 0 {
+		t.Errorf("expected a finished deletion removed from the queue, got %+v", state.Pending)
+	}
+	if service.Enqueue(context.Background(), did, 0, common.AccountDeletion{Likes: true}) {
+		t.Error("expected a closed service to refuse deletions")
+	}
+}
+
+func TestService_ResumesUnfinishedDeletion(t *testing.T) {
+	es := estest.New(t)
+	putAccount(es)
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	// A crash after the posts were removed, before the likes were
+	err := WriteState(context.Background(), stateFile, &State{Pending: map[string]*Deletion{
+		did: {TimeUs: 1760000000000000, Posts: true, Likes: true, PostsDone: true, QueuedAt: time.Now()},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	service := NewService(es.Client, Config{StateFile: stateFile}, common.NewLogger(false))
+	if err := service.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	service.Close(5 * time.Second)
+
+	if n := es.Len("likes"); n != 0 {
+		t.Errorf("expected the resumed deletion to remove the likes, %d left", n)
+	}
+	if n := es.Len(common.WriteAlias("post_tombstones")); n != 0 {
+		t.Errorf("expected the finished posts step not to run again, got %d post tombstones", n)
+	}
+	if state, _ := ReadState(context.Background(), stateFile); len(state.Pending) != 0 {
+		t.Errorf("expected the resumed deletion finished, got %+v", state.Pending)
+	}
+}
+
+func TestService_RetriesThenGivesUp(t *testing.T) {
+	es := estest.New(t)
+	es.Handle(estest.APISearch, func(estest.Call) *estest.Response {
+		return &estest.Response{Status: http.StatusInternalServerError, Body: `{"error":"boom"}`}
+	})
+
+	service := NewService(es.Client, Config{MaxAttempts: 2, RetryDelay: time.Millisecond}, common.NewLogger(false))
+	if err := service.Start(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	service.Enqueue(context.Background(), did, 0, common.AccountDeletion{Likes: true})
+	service.Close(5 * time.Second)
+
+	if n := len(es.Calls(estest.APISearch)); n != 2 {
+		t.Errorf("expected 2 attempts, got %d", n)
+	}
+	if n := service.Pending(); n != 0 {
+		t.Errorf("expected the deletion given up, %d pending", n)
+	}
+}
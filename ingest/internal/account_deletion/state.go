@@ -0,0 +1,132 @@
+package account_deletion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// Deletion is one queued account deletion and how far it has got
+type Deletion struct {
+	DID       string    `json:"did"`
+	TimeUs    int64     `json:"time_us"` // When the account was deleted
+	Posts     bool      `json:"posts"`   // Posts and replies are to be removed
+	Likes     bool      `json:"likes"`   // Likes are to be removed
+	PostsDone bool      `json:"posts_done"`
+	LikesDone bool      `json:"likes_done"`
+	Attempts  int       `json:"attempts"` // Failed attempts so far
+	QueuedAt  time.Time `json:"queued_at"`
+}
+
+// done reports whether every selected kind has been removed
+func (d *Deletion) done() bool {
+	return (!d.Posts || d.PostsDone) && (!d.Likes || d.LikesDone)
+}
+
+// State is the persisted queue: every deletion not yet finished, keyed by DID
+type State struct {
+	Pending map[string]*Deletion `json:"pending"`
+}
+
+// StateFileFor returns where a service whose cursor state is at stateFile
+// keeps its account deletion queue, next to it
+func StateFileFor(stateFile string) string {
+	return strings.TrimSuffix(stateFile, ".json") + "_account_deletions.json"
+}
+
+// ReadState reads state from a local path or GCS (gs://bucket/object). A
+// missing file is an empty queue.
+func ReadState(ctx context.Context, path string) (*State, error) {
+	var data []byte
+	if strings.HasPrefix(path, "gs://") {
+		bucket, object, err := parseGCSPath(path)
+		if err != nil {
+			return nil, err
+		}
+		client, err := storage.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GCS client: %w", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		reader, err := client.Bucket(bucket).Object(object).NewReader(ctx)
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return &State{}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open account deletion state in GCS: %w", err)
+		}
+		defer func() { _ = reader.Close() }() // Best-effort close for read operation
+
+		data, err = io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read account deletion state from GCS: %w", err)
+		}
+	} else {
+		var err error
+		data, err = os.ReadFile(path) //nolint:gosec // G304: path comes from service configuration
+		if errors.Is(err, os.ErrNotExist) {
+			return &State{}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read account deletion state: %w", err)
+		}
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse account deletion state %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// WriteState writes state as JSON to a local path or GCS (gs://bucket/object)
+func WriteState(ctx context.Context, path string, state *State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal account deletion state: %w", err)
+	}
+
+	if !strings.HasPrefix(path, "gs://") {
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return fmt.Errorf("failed to write account deletion state: %w", err)
+		}
+		return nil
+	}
+
+	bucket, object, err := parseGCSPath(path)
+	if err != nil {
+		return err
+	}
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	writer := client.Bucket(bucket).Object(object).NewWriter(ctx)
+	writer.ContentType = "application/json"
+	if _, err := writer.Write(data); err != nil {
+		_ = writer.Close()
+		return fmt.Errorf("failed to write account deletion state to GCS: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to finalize account deletion state in GCS: %w", err)
+	}
+	return nil
+}
+
+func parseGCSPath(path string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "gs://"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid GCS path format: %s (expected gs://bucket/object)", path)
+	}
+	return parts[0], parts[1], nil
+}
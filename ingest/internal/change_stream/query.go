@@ -0,0 +1,163 @@
+package change_stream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// StoredQuery is a named Elasticsearch query that stream clients subscribe to
+type StoredQuery struct {
+	Name  string                 `json:"name"`
+	Index string                 `json:"index"` // defaults to "posts"
+	Query map[string]interface{} `json:"query"` // Elasticsearch query DSL; empty matches all
+}
+
+// LoadQueries reads a JSON array of stored queries from path
+func LoadQueries(path string) (map[string]StoredQuery, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // G304: path comes from operator configuration
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stored queries: %w", err)
+	}
+
+	var list []StoredQuery
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse stored queries: %w", err)
+	}
+
+	queries := make(map[string]StoredQuery, len(list))
+	for _, q := range list {
+		if q.Name == "" {
+			return nil, fmt.Errorf("stored query missing name")
+		}
+		if _, dup := queries[q.Name]; dup {
+			return nil, fmt.Errorf("duplicate stored query %q", q.Name)
+		}
+		if q.Index == "" {
+			q.Index = "posts"
+		}
+		queries[q.Name] = q
+	}
+	return queries, nil
+}
+
+// pollBatchSize bounds documents fetched per poll; a full batch is re-polled
+// immediately rather than waiting for the next interval
+const pollBatchSize = 500
+
+type streamHit struct {
+	Source json.RawMessage `json:"_source"`
+}
+
+type streamSearchResponse struct {
+	Hits struct {
+		Hits []streamHit `json:"hits"`
+	} `json:"hits"`
+}
+
+type indexedDoc struct {
+	AtURI     string `json:"at_uri"`
+	IndexedAt string `json:"indexed_at"`
+}
+
+// poller tails an index for newly indexed documents matching a stored query.
+// It tracks the last indexed_at seen plus the at_uris at that timestamp, so
+// documents sharing a timestamp across polls are neither dropped nor repeated.
+type poller struct {
+	client    *elasticsearch.Client
+	query     StoredQuery
+	since     string
+	seenAtTop map[string]bool
+	logger    *common.IngestLogger
+}
+
+func newPoller(client *elasticsearch.Client, query StoredQuery, start time.Time, logger *common.IngestLogger) *poller {
+	return &poller{
+		client:    client,
+		query:     query,
+		since:     start.UTC().Format(time.RFC3339Nano),
+		seenAtTop: make(map[string]bool),
+		logger:    logger,
+	}
+}
+
+// poll returns the _source of each new matching document in indexed_at
+// order, and whether more documents may be immediately available
+func (p *poller) poll(ctx context.Context) ([]json.RawMessage, bool, error) {
+	filters := []interface{}{
+		map[string]interface{}{
+			"range": map[string]interface{}{
+				"indexed_at": map[string]interface{}{"gte": p.since},
+			},
+		},
+	}
+	if len(p.query.Query) > 0 {
+		filters = append(filters, p.query.Query)
+	}
+
+	body := map[string]interface{}{
+		"size":  pollBatchSize,
+		"query": map[string]interface{}{"bool": map[string]interface{}{"filter": filters}},
+		"sort": []interface{}{
+			map[string]interface{}{"indexed_at": "asc"},
+		},
+	}
+
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	start := time.Now()
+	res, err := p.client.Search(
+		p.client.Search.WithContext(ctx),
+		p.client.Search.WithIndex(p.query.Index),
+		p.client.Search.WithBody(bytes.NewReader(bodyJSON)),
+	)
+	p.logger.Metric("es.change_stream_poll.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return nil, false, fmt.Errorf("search request failed: %w", err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			p.logger.Error("Failed to close search response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		return nil, false, fmt.Errorf("search request returned error: %s", res.String())
+	}
+
+	var response streamSearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, false, fmt.Errorf("failed to parse search response: %w", err)
+	}
+
+	docs := make([]json.RawMessage, 0, len(response.Hits.Hits))
+	for _, hit := range response.Hits.Hits {
+		var doc indexedDoc
+		if err := json.Unmarshal(hit.Source, &doc); err != nil || doc.IndexedAt == "" {
+			continue
+		}
+		if doc.IndexedAt == p.since {
+			if p.seenAtTop[doc.AtURI] {
+				continue
+			}
+		} else {
+			p.since = doc.IndexedAt
+			p.seenAtTop = make(map[string]bool)
+		}
+		p.seenAtTop[doc.AtURI] = true
+		docs = append(docs, hit.Source)
+	}
+
+	// A full batch with nothing new means one timestamp holds more than a batch
+	// of documents; wait for the next interval instead of spinning
+	return docs, len(response.Hits.Hits) == pollBatchSize && len(docs) > 0, nil
+}
@@ -0,0 +1,235 @@
+// Package change_stream serves WebSocket streams of newly indexed documents
+// matching stored queries, for internal tools that watch content live.
+package change_stream
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/gorilla/websocket"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// subscriberBuffer is the number of undelivered documents a client may lag
+// behind before it is disconnected
+const subscriberBuffer = 256
+
+const writeTimeout = 10 * time.Second
+
+// Config holds change stream server settings
+type Config struct {
+	PollInterval   time.Duration
+	AllowedOrigins []string // browser origins allowed to connect; empty allows same-origin only
+}
+
+// Server streams documents for stored queries over WebSocket. Each query is
+// polled once no matter how many clients watch it, and only while watched.
+type Server struct {
+	client   *elasticsearch.Client
+	queries  map[string]StoredQuery
+	config   Config
+	upgrader websocket.Upgrader
+	logger   *common.IngestLogger
+
+	mu     sync.Mutex
+	topics map[string]*topic
+}
+
+type topic struct {
+	subscribers map[chan json.RawMessage]bool
+	cancel      context.CancelFunc
+}
+
+// NewServer creates a change stream server
+func NewServer(client *elasticsearch.Client, queries map[string]StoredQuery, config Config, logger *common.IngestLogger) *Server {
+	s := &Server{
+		client:  client,
+		queries: queries,
+		config:  config,
+		logger:  logger,
+		topics:  make(map[string]*topic),
+	}
+	if len(config.AllowedOrigins) > 0 {
+		allowed := make(map[string]bool, len(config.AllowedOrigins))
+		for _, origin := range config.AllowedOrigins {
+			allowed[origin] = true
+		}
+		s.upgrader.CheckOrigin = func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || allowed[origin]
+		}
+	}
+	return s
+}
+
+// Handler returns the HTTP routes: GET /queries lists stored query names and
+// GET /stream?query=<name> upgrades to a WebSocket carrying one JSON document
+// per message
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/queries", s.handleQueries)
+	mux.HandleFunc("/stream", s.handleStream)
+	return mux
+}
+
+func (s *Server) handleQueries(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(s.queries))
+	for name := range s.queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(names); err != nil {
+		s.logger.Error("Failed to encode query list: %v", err)
+	}
+}
+
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("query")
+	query, ok := s.queries[name]
+	if !ok {
+		http.Error(w, "unknown query", http.StatusNotFound)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.logger.Error("WebSocket upgrade failed: %v", err)
+		return
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			s.logger.Debug("Failed to close WebSocket: %v", err)
+		}
+	}()
+
+	docs := s.subscribe(query)
+	defer s.unsubscribe(name, docs)
+	s.logger.Metric("change_stream.connections_count", 1)
+
+	// Clients don't send data; reading detects disconnects and handles control frames
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case doc, ok := <-docs:
+			if !ok {
+				s.logger.Info("Disconnecting slow client on query %s", name)
+				s.logger.Metric("change_stream.slow_client_count", 1)
+				return
+			}
+			if err := conn.SetWriteDeadline(time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+			if err := conn.WriteMessage(websocket.TextMessage, doc); err != nil {
+				s.logger.Debug("WebSocket write failed on query %s: %v", name, err)
+				return
+			}
+		}
+	}
+}
+
+// subscribe registers a subscriber, starting the query's poller if it is the first
+func (s *Server) subscribe(query StoredQuery) chan json.RawMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan json.RawMessage, subscriberBuffer)
+	t, ok := s.topics[query.Name]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		t = &topic{subscribers: make(map[chan json.RawMessage]bool), cancel: cancel}
+		s.topics[query.Name] = t
+		go s.run(ctx, query)
+		s.logger.Info("Started polling for query %s", query.Name)
+	}
+	t.subscribers[ch] = true
+	return ch
+}
+
+// unsubscribe removes a subscriber, stopping the poller when none remain
+func (s *Server) unsubscribe(name string, ch chan json.RawMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.topics[name]
+	if !ok {
+		return
+	}
+	delete(t.subscribers, ch)
+	if len(t.subscribers) == 0 {
+		t.cancel()
+		delete(s.topics, name)
+		s.logger.Info("Stopped polling for query %s", name)
+	}
+}
+
+// broadcast delivers docs to every subscriber of a query. A subscriber whose
+// buffer is full is dropped and its channel closed rather than stalling the rest.
+func (s *Server) broadcast(name string, docs []json.RawMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.topics[name]
+	if !ok {
+		return
+	}
+	for ch := range t.subscribers {
+		for _, doc := range docs {
+			select {
+			case ch <- doc:
+				continue
+			default:
+			}
+			delete(t.subscribers, ch)
+			close(ch)
+			break
+		}
+	}
+	s.logger.Metric("change_stream.documents_count", float64(len(docs)))
+}
+
+func (s *Server) run(ctx context.Context, query StoredQuery) {
+	p := newPoller(s.client, query, time.Now(), s.logger)
+	ticker := time.NewTicker(s.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for more := true; more && ctx.Err() == nil; {
+			docs, hasMore, err := p.poll(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					s.logger.Error("Change stream poll failed for query %s: %v", query.Name, err)
+					s.logger.Metric("change_stream.poll_errors", 1)
+				}
+				break
+			}
+			if len(docs) > 0 {
+				s.broadcast(query.Name, docs)
+			}
+			more = hasMore
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package change_stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func hitsResponse(docs ...string) string {
+	hits := make([]string, len(docs))
+	for i, doc := range docs {
+		hits[i] = fmt.Sprintf(`{"_source":%s}`, doc)
+	}
+	return fmt.Sprintf(`{"hits":{"hits":[%s]}}`, strings.Join(hits, ","))
+}
+
+func TestLoadQueries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.json")
+	content := `[{"name":"video","index":"replies","query":{"term":{"contains_video":true}}},{"name":"all"}]`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write queries: %v", err)
+	}
+
+	queries, err := LoadQueries(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(queries) != 2 {
+		t.Fatalf("expected 2 queries, got %d", len(queries))
+	}
+	if queries["video"].Index != "replies" {
+		t.Errorf("expected video index replies, got %s", queries["video"].Index)
+	}
+	if queries["all"].Index != "posts" {
+		t.Errorf("expected default index posts, got %s", queries["all"].Index)
+	}
+}
+
+func TestLoadQueries_RejectsDuplicates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queries.json")
+	if err := os.WriteFile(path, []byte(`[{"name":"a"},{"name":"a"}]`), 0o600); err != nil {
+		t.Fatalf("failed to write queries: %v", err)
+	}
+
+	if _, err := LoadQueries(path); err == nil {
+		t.Error("expected error for duplicate query names")
+	}
+}
+
+func TestPoller_SkipsDocsAlreadySeenAtBoundary(t *testing.T) {
+	var mu sync.Mutex
+	responses := []string{
+		hitsResponse(
+			`{"at_uri":"at://a/1","indexed_at":"2025-01-01T00:00:01Z"}`,
+			`{"at_uri":"at://a/2","indexed_at":"2025-01-01T00:00:02Z"}`,
+		),
+		// Second poll uses gte on the last timestamp, so a/2 comes back alongside new docs
+		hitsResponse(
+			`{"at_uri":"at://a/2","indexed_at":"2025-01-01T00:00:02Z"}`,
+			`{"at_uri":"at://a/3","indexed_at":"2025-01-01T00:00:02Z"}`,
+			`{"at_uri":"at://a/4","indexed_at":"2025-01-01T00:00:03Z"}`,
+		),
+	}
+	var bodies []string
+	client := estest.NewClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		resp := responses[0]
+		responses = responses[1:]
+		mu.Unlock()
+		_, _ = w.Write([]byte(resp))
+	})
+
+	query := StoredQuery{Name: "q", Index: "posts", Query: map[string]interface{}{"match": map[string]interface{}{"content": "hello"}}}
+	p := newPoller(client, query, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), common.NewLogger(false))
+
+	first, _, err := p.poll(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, _, err := p.poll(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(first) != 2 {
+		t.Errorf("expected 2 docs in first poll, got %d", len(first))
+	}
+	if len(second) != 2 {
+		t.Fatalf("expected 2 new docs in second poll, got %d", len(second))
+	}
+	if !strings.Contains(string(second[0]), "at://a/3") || !strings.Contains(string(second[1]), "at://a/4") {
+		t.Errorf("unexpected second poll docs: %s, %s", second[0], second[1])
+	}
+	if !strings.Contains(bodies[0], `"match"`) {
+		t.Errorf("expected stored query in search body, got %s", bodies[0])
+	}
+	if !strings.Contains(bodies[1], "2025-01-01T00:00:02Z") {
+		t.Errorf("expected second poll to start at last indexed_at, got %s", bodies[1])
+	}
+}
+
+func TestServer_StreamsMatchingDocuments(t *testing.T) {
+	var mu sync.Mutex
+	served := false
+	client := estest.NewClient(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if served {
+			_, _ = w.Write([]byte(hitsResponse()))
+			return
+		}
+		served = true
+		_, _ = w.Write([]byte(hitsResponse(`{"at_uri":"at://a/1","indexed_at":"2099-01-01T00:00:00Z","content":"hello"}`)))
+	})
+
+	queries := map[string]StoredQuery{"hello": {Name: "hello", Index: "posts"}}
+	server := NewServer(client, queries, Config{PollInterval: 10 * time.Millisecond}, common.NewLogger(false))
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(httpServer.URL, "http") + "/stream?query=hello"
+	conn, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("failed to dial stream: %v", err)
+	}
+	_ = resp.Body.Close()
+	defer func() { _ = conn.Close() }()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, message, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(message, &doc); err != nil {
+		t.Fatalf("message is not JSON: %v", err)
+	}
+	if doc["at_uri"] != "at://a/1" {
+		t.Errorf("expected at://a/1, got %v", doc["at_uri"])
+	}
+}
+
+func TestServer_UnknownQuery(t *testing.T) {
+	server := NewServer(nil, map[string]StoredQuery{}, Config{PollInterval: time.Second}, common.NewLogger(false))
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	resp, err := http.Get(httpServer.URL + "/stream?query=missing")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", resp.StatusCode)
+	}
+}
+
+func TestServer_DropsSlowSubscriber(t *testing.T) {
+	server := NewServer(nil, nil, Config{PollInterval: time.Hour}, common.NewLogger(false))
+	ch := server.subscribe(StoredQuery{Name: "q"})
+	defer server.unsubscribe("q", ch)
+
+	docs := make([]json.RawMessage, subscriberBuffer+1)
+	for i := range docs {
+		docs[i] = json.RawMessage(`{}`)
+	}
+	server.broadcast("q", docs)
+
+	received := 0
+	for range ch {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("expected %d buffered docs before close, got %d", subscriberBuffer, received)
+	}
+}
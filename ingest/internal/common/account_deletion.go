@@ -0,0 +1,301 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// accountDeletionBatchSize is how many documents of a deleted account are
+// tombstoned and deleted per bulk request
+const accountDeletionBatchSize = 100
+
+// AccountDeletion selects which documents of a deleted account
+// DeleteAccount removes. Each ingest service removes the kinds it indexes,
+// so an account deleted while one service is behind is still purged by the
+// other.
+type AccountDeletion struct {
+	Posts bool // Posts and replies, tombstoned in post_tombstones and reply_tombstones
+	Likes bool // Likes, tombstoned in like_tombstones
+}
+
+// AccountDeletionResult counts the documents DeleteAccount removed
+type AccountDeletionResult struct {
+	Posts   int
+	Replies int
+	Likes   int
+}
+
+// Total returns the number of documents removed
+func (r AccountDeletionResult) Total() int {
+	return r.Posts + r.Replies + r.Likes
+}
+
+// DeleteAccount tombstones and deletes the documents of authorDID that
+// kinds selects. timeUs is when the account was deleted; 0 uses the current
+// time. Each deleted like subtracts 1 from the like_count of the post it
+// liked through postCounts, which may be nil. A delete event for each
+// removed document is published to changeFeed, which may be nil. Deleting
+// is idempotent: a second service processing the same deletion finds
+// nothing left to remove.
+func DeleteAccount(ctx context.Context, client *elasticsearch.Client, authorDID string, timeUs int64,
+	kinds AccountDeletion, postCounts *PostCounter, changeFeed *ChangeFeed, dryRun bool, logger *IngestLogger) (AccountDeletionResult, error) {
+
+	var result AccountDeletionResult
+	logger.Debug("Processing account deletion for DID: %s", authorDID)
+
+	// Create 1-minute timeout context for queries
+	queryCtx, queryCancel := context.WithTimeout(ctx, time.Minute)
+	defer queryCancel()
+
+	if kinds.Posts {
+		posts, err := QueryPostsByAuthorDID(queryCtx, client, "posts", authorDID, logger)
+		if err != nil {
+			return result, fmt.Errorf("failed to query posts for account deletion (DID: %s): %w", authorDID, err)
+		}
+		logger.Debug("Found %d posts for account deletion (DID: %s)", len(posts), authorDID)
+
+		if err := deleteAccountPosts(ctx, client, posts, authorDID, timeUs, ChangeTypePost, changeFeed, dryRun, logger); err != nil {
+			return result, fmt.Errorf("failed to process post deletions for account (DID: %s): %w", authorDID, err)
+		}
+		result.Posts = len(posts)
+
+		replies, err := QueryPostsByAuthorDID(queryCtx, client, "replies", authorDID, logger)
+		if err != nil {
+			return result, fmt.Errorf("failed to query replies for account deletion (DID: %s): %w", authorDID, err)
+		}
+		logger.Debug("Found %d replies for account deletion (DID: %s)", len(replies), authorDID)
+
+		if err := deleteAccountPosts(ctx, client, replies, authorDID, timeUs, ChangeTypeReply, changeFeed, dryRun, logger); err != nil {
+			return result, fmt.Errorf("failed to process reply deletions for account (DID: %s): %w", authorDID, err)
+		}
+		result.Replies = len(replies)
+	}
+
+	if kinds.Likes {
+		likes, err := QueryLikesByAuthorDID(queryCtx, client, "likes", authorDID, logger)
+		if err != nil {
+			return result, fmt.Errorf("failed to query likes for account deletion (DID: %s): %w", authorDID, err)
+		}
+		logger.Debug("Found %d likes for account deletion (DID: %s)", len(likes), authorDID)
+
+		deleted, err := deleteAccountLikes(ctx, client, likes, authorDID, timeUs, postCounts, changeFeed, dryRun, logger)
+		result.Likes = deleted
+		if err != nil {
+			return result, fmt.Errorf("failed to process like deletions for account (DID: %s): %w", authorDID, err)
+		}
+	}
+
+	logger.Debug("Completed account deletion for DID: %s (posts: %d, replies: %d, likes: %d)", authorDID, result.Posts, result.Replies, result.Likes)
+	logger.Audit(ctx, AuditEntry{
+		Operation: AuditAccountDeletion,
+		Target:    authorDID,
+		Detail:    accountDeletionDetail(kinds, result),
+		Count:     int64(result.Total()),
+		DryRun:    dryRun,
+	})
+	return result, nil
+}
+
+// accountDeletionDetail describes what an account deletion removed, naming
+// only the kinds it selected
+func accountDeletionDetail(kinds AccountDeletion, result AccountDeletionResult) string {
+	var parts []string
+	if kinds.Posts {
+		parts = append(parts, fmt.Sprintf("posts: %d", result.Posts), fmt.Sprintf("replies: %d", result.Replies))
+	}
+	if kinds.Likes {
+		parts = append(parts, fmt.Sprintf("likes: %d", result.Likes))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// accountDeletedAt returns when an account deleted at timeUs was deleted, and
+// the current time for the tombstones' indexed_at
+func accountDeletedAt(timeUs int64) (deletedAt, now time.Time) {
+	now = time.Now().UTC()
+	deletedAt = now
+	if timeUs > 0 {
+		deletedAt = time.Unix(0, timeUs*1000)
+	}
+	return deletedAt, now
+}
+
+// deleteAccountPosts processes post/reply deletions in batches for account
+// deletion, publishing a delete event of changeType for each batch deleted
+func deleteAccountPosts(ctx context.Context, client *elasticsearch.Client, postAtURIs []string, authorDID string,
+	timeUs int64, changeType string, changeFeed *ChangeFeed, dryRun bool, logger *IngestLogger) error {
+
+	deletedAt, now := accountDeletedAt(timeUs)
+
+	var tombstoneBatch []PostTombstoneDoc
+	var deleteBatch []DeleteDoc
+
+	for _, atURI := range postAtURIs {
+		tombstoneBatch = append(tombstoneBatch, PostTombstoneDoc{
+			AtURI:     atURI,
+			AuthorDID: authorDID,
+			DeletedAt: deletedAt.Format(time.RFC3339),
+			IndexedAt: now.Format(time.RFC3339),
+		})
+
+		deleteBatch = append(deleteBatch, DeleteDoc{
+			DocID:     atURI,
+			AuthorDID: authorDID,
+		})
+
+		// Flush batch when full
+		if len(tombstoneBatch) >= accountDeletionBatchSize {
+			if err := flushAccountPostDeletions(ctx, client, tombstoneBatch, deleteBatch, dryRun, logger); err != nil {
+				return err
+			}
+			changeFeed.Publish(ctx, PostDeleteChangeEvents(tombstoneBatch, changeType))
+			tombstoneBatch = tombstoneBatch[:0]
+			deleteBatch = deleteBatch[:0]
+		}
+	}
+
+	// Flush remaining
+	if len(tombstoneBatch) > 0 {
+		if err := flushAccountPostDeletions(ctx, client, tombstoneBatch, deleteBatch, dryRun, logger); err != nil {
+			return err
+		}
+		changeFeed.Publish(ctx, PostDeleteChangeEvents(tombstoneBatch, changeType))
+	}
+
+	return nil
+}
+
+// deleteAccountLikes processes like deletions in batches for account
+// deletion, publishing a delete event for each, and returns how many likes
+// were deleted
+func deleteAccountLikes(ctx context.Context, client *elasticsearch.Client, likes map[string]LikeDoc, authorDID string,
+	timeUs int64, postCounts *PostCounter, changeFeed *ChangeFeed, dryRun bool, logger *IngestLogger) (int, error) {
+
+	deletedAt, now := accountDeletedAt(timeUs)
+	deleted := 0
+
+	var tombstoneBatch []LikeTombstoneDoc
+	var deleteBatch []DeleteDoc
+
+	flush := func() error {
+		if err := flushAccountLikeDeletions(ctx, client, tombstoneBatch, deleteBatch, dryRun, logger); err != nil {
+			return err
+		}
+		updates := make([]CountUpdate, len(tombstoneBatch))
+		for i, tombstone := range tombstoneBatch {
+			updates[i] = CountUpdate{SubjectURI: tombstone.SubjectURI, Increment: -1}
+		}
+		postCounts.Add(LikeCountField, updates)
+		changeFeed.Publish(ctx, LikeDeleteChangeEvents(tombstoneBatch))
+		deleted += len(deleteBatch)
+		tombstoneBatch = tombstoneBatch[:0]
+		deleteBatch = deleteBatch[:0]
+		return nil
+	}
+
+	for atURI, like := range likes {
+		tombstoneBatch = append(tombstoneBatch, LikeTombstoneDoc{
+			AtURI:      atURI,
+			AuthorDID:  authorDID,
+			SubjectURI: like.SubjectURI,
+			DeletedAt:  deletedAt.Format(time.RFC3339),
+			IndexedAt:  now.Format(time.RFC3339),
+		})
+
+		deleteBatch = append(deleteBatch, DeleteDoc{
+			DocID:     atURI,
+			AuthorDID: authorDID,
+			Index:     like.Index,
+		})
+
+		// Flush batch when full
+		if len(tombstoneBatch) >= accountDeletionBatchSize {
+			if err := flush(); err != nil {
+				return deleted, err
+			}
+		}
+	}
+
+	// Flush remaining
+	if len(tombstoneBatch) > 0 {
+		if err := flush(); err != nil {
+			return deleted, err
+		}
+	}
+
+	return deleted, nil
+}
+
+// flushAccountPostDeletions indexes post tombstones and deletes posts
+func flushAccountPostDeletions(ctx context.Context, client *elasticsearch.Client, tombstoneBatch []PostTombstoneDoc,
+	deleteBatch []DeleteDoc, dryRun bool, logger *IngestLogger) error {
+
+	batchCtx, cancelBatchCtx := context.WithTimeout(ctx, 30*time.Second)
+	defer cancelBatchCtx()
+
+	// Index tombstones to both post_tombstones and reply_tombstones
+	var postTombstoneErr, replyTombstoneErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		postTombstoneErr = BulkIndexPostTombstones(batchCtx, client, WriteAlias("post_tombstones"), tombstoneBatch, dryRun, logger)
+	}()
+	go func() {
+		defer wg.Done()
+		replyTombstoneErr = BulkIndexPostTombstones(batchCtx, client, WriteAlias("reply_tombstones"), tombstoneBatch, dryRun, logger)
+	}()
+	wg.Wait()
+	if postTombstoneErr != nil {
+		return fmt.Errorf("failed to index tombstones to post_tombstones: %w", postTombstoneErr)
+	}
+	if replyTombstoneErr != nil {
+		return fmt.Errorf("failed to index tombstones to reply_tombstones: %w", replyTombstoneErr)
+	}
+
+	// Then delete from both posts and replies
+	var postsDeleteErr, repliesDeleteErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		postsDeleteErr = BulkDelete(batchCtx, client, WriteAlias("posts"), deleteBatch, dryRun, logger)
+	}()
+	go func() {
+		defer wg.Done()
+		repliesDeleteErr = BulkDelete(batchCtx, client, WriteAlias("replies"), deleteBatch, dryRun, logger)
+	}()
+	wg.Wait()
+	if postsDeleteErr != nil {
+		return fmt.Errorf("failed to delete from posts: %w", postsDeleteErr)
+	}
+	if repliesDeleteErr != nil {
+		return fmt.Errorf("failed to delete from replies: %w", repliesDeleteErr)
+	}
+
+	return nil
+}
+
+// flushAccountLikeDeletions indexes like tombstones and deletes likes
+func flushAccountLikeDeletions(ctx context.Context, client *elasticsearch.Client, tombstoneBatch []LikeTombstoneDoc,
+	deleteBatch []DeleteDoc, dryRun bool, logger *IngestLogger) error {
+
+	batchCtx, cancelBatchCtx := context.WithTimeout(ctx, 30*time.Second)
+	defer cancelBatchCtx()
+
+	// Index tombstones first
+	if err := BulkIndexLikeTombstones(batchCtx, client, WriteAlias("like_tombstones"), tombstoneBatch, dryRun, logger); err != nil {
+		return fmt.Errorf("failed to bulk index like tombstones: %w", err)
+	}
+
+	// Then delete likes from the backing indices they were found in
+	if err := BulkDelete(batchCtx, client, "likes", deleteBatch, dryRun, logger); err != nil {
+		return fmt.Errorf("failed to bulk delete likes: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func TestDeleteAccount_LikesOnly(t *testing.T) {
+	es := estest.New(t)
+	did := "did:plc:deleted"
+	post := "at://did:plc:author/app.bsky.feed.post/1"
+	other := "at://did:plc:author/app.bsky.feed.post/2"
+	for i, subject := range []string{post, post, other} {
+		uri := "at://" + did + "/app.bsky.feed.like/" + string(rune('a'+i))
+		es.Put("likes", uri, map[string]interface{}{"at_uri": uri, "author_did": did, "subject_uri": subject})
+	}
+	es.Put("likes", "at://did:plc:kept/app.bsky.feed.like/a", map[string]interface{}{"author_did": "did:plc:kept", "subject_uri": post})
+	es.Put("posts", "at://"+did+"/app.bsky.feed.post/1", map[string]interface{}{"author_did": did})
+
+	counter := NewPostCounter(es.Client, PostCountConfig{}, true, NewLogger(false))
+	publisher := &fakeChangePublisher{}
+	result, err := DeleteAccount(context.Background(), es.Client, did, 1760000000000000,
+		AccountDeletion{Likes: true}, counter, NewChangeFeed(publisher, NewLogger(false)), false, NewLogger(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if result != (AccountDeletionResult{Likes: 3}) {
+		t.Errorf("expected 3 likes deleted, got %+v", result)
+	}
+	if n := es.Len("likes"); n != 1 {
+		t.Errorf("expected only the other account's like left, got %d", n)
+	}
+	if n := es.Len(WriteAlias("like_tombstones")); n != 3 {
+		t.Errorf("expected 3 like tombstones, got %d", n)
+	}
+	if n := es.Len("posts"); n != 1 {
+		t.Errorf("expected posts to be left to megastream, got %d", n)
+	}
+	if n := counter.Pending(); n != 2 {
+		t.Errorf("expected like_count decrements for 2 posts, got %d", n)
+	}
+	if len(publisher.published) != 1 || len(publisher.published[0]) != 3 || publisher.published[0][0].Type != ChangeTypeLike || publisher.published[0][0].Operation != ChangeOperationDelete {
+		t.Errorf("expected a delete event for each like, got %+v", publisher.published)
+	}
+}
+
+func TestDeleteAccount_PublishesPostAndReplyDeletes(t *testing.T) {
+	es := estest.New(t)
+	did := "did:plc:deleted"
+	post, reply := "at://"+did+"/app.bsky.feed.post/1", "at://"+did+"/app.bsky.feed.post/2"
+	es.Put("posts", post, map[string]interface{}{"at_uri": post, "author_did": did})
+	es.Put("replies", reply, map[string]interface{}{"at_uri": reply, "author_did": did})
+
+	publisher := &fakeChangePublisher{}
+	result, err := DeleteAccount(context.Background(), es.Client, did, 0,
+		AccountDeletion{Posts: true}, nil, NewChangeFeed(publisher, NewLogger(false)), false, NewLogger(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result != (AccountDeletionResult{Posts: 1, Replies: 1}) {
+		t.Fatalf("expected a post and a reply deleted, got %+v", result)
+	}
+	want := [][]ChangeEvent{
+		{{AtURI: post, Type: ChangeTypePost, Operation: ChangeOperationDelete}},
+		{{AtURI: reply, Type: ChangeTypeReply, Operation: ChangeOperationDelete}},
+	}
+	if len(publisher.published) != len(want) {
+		t.Fatalf("expected %d publishes, got %+v", len(want), publisher.published)
+	}
+	for i, events := range publisher.published {
+		got := events[0]
+		got.IndexedAt = ""
+		if len(events) != 1 || got != want[i][0] {
+			t.Errorf("publish %d: got %+v, want %+v", i, events, want[i])
+		}
+	}
+}
+
+func TestDeleteAccount_NothingIndexed(t *testing.T) {
+	es := estest.New(t)
+
+	result, err := DeleteAccount(context.Background(), es.Client, "did:plc:unknown", 0,
+		AccountDeletion{Posts: true, Likes: true}, nil, nil, false, NewLogger(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Total() != 0 {
+		t.Errorf("expected nothing deleted, got %+v", result)
+	}
+	if calls := es.Calls(estest.APIBulk); len(calls) != 0 {
+		t.Errorf("expected no bulk requests, got %d", len(calls))
+	}
+}
@@ -0,0 +1,120 @@
+package common
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// Inactive account handling modes for readers (GE_INACTIVE_ACCOUNTS).
+// "flag" marks the records of inactive accounts with the account's status
+// where the reader has somewhere to put it; "drop" leaves them out.
+const (
+	InactiveAccountsOff  = "off"
+	InactiveAccountsFlag = "flag"
+	InactiveAccountsDrop = "drop"
+)
+
+// accountLookupBatch caps the DIDs sent in one account lookup
+const accountLookupBatch = 1000
+
+// AccountFilter checks the authors of records against the accounts index,
+// so readers can flag or drop content of deactivated, taken down, or
+// suspended accounts. Statuses are those recorded from account events (see
+// AccountStatusWriter); an account with no recorded status is active. A
+// failed lookup is logged and treated as every author active. A nil
+// AccountFilter checks nothing.
+type AccountFilter struct {
+	client *elasticsearch.Client
+	mode   string
+	logger *IngestLogger
+}
+
+// NewAccountFilter creates a filter in the given mode. Returns nil for
+// InactiveAccountsOff so callers can use the result unconditionally.
+func NewAccountFilter(client *elasticsearch.Client, mode string, logger *IngestLogger) (*AccountFilter, error) {
+	switch mode {
+	case InactiveAccountsOff, "":
+		return nil, nil
+	case InactiveAccountsFlag, InactiveAccountsDrop:
+	default:
+		return nil, fmt.Errorf("unknown inactive accounts mode %q (expected %s, %s, or %s)", mode, InactiveAccountsOff, InactiveAccountsFlag, InactiveAccountsDrop)
+	}
+	if client == nil {
+		return nil, fmt.Errorf("inactive account filter needs an Elasticsearch client")
+	}
+	return &AccountFilter{client: client, mode: mode, logger: logger}, nil
+}
+
+// Inactive returns the status of each of dids whose account is inactive
+func (f *AccountFilter) Inactive(ctx context.Context, dids []string) map[string]string {
+	inactive := make(map[string]string)
+	if f == nil {
+		return inactive
+	}
+	seen := make(map[string]bool, len(dids))
+	unique := make([]string, 0, len(dids))
+	for _, did := range dids {
+		if did != "" && !seen[did] {
+			seen[did] = true
+			unique = append(unique, did)
+		}
+	}
+	for start := 0; start < len(unique); start += accountLookupBatch {
+		batch := unique[start:min(start+accountLookupBatch, len(unique))]
+		accounts, err := FetchAccounts(ctx, f.client, f.logger, AccountsIndex, batch)
+		if err != nil {
+			f.logger.Metric("account_filter.lookup_error_count", 1)
+			f.logger.Error("Account status check failed, treating %d accounts as active: %v", len(batch), err)
+			continue
+		}
+		for did, account := range accounts {
+			if !account.Active {
+				inactive[did] = account.Status
+			}
+		}
+	}
+	return inactive
+}
+
+// FilterInactiveAccounts checks the authors of records, preserving order.
+// In drop mode the records of inactive accounts are left out; in flag mode
+// they are kept and passed to flag with the account's status; readers with
+// nowhere to record it pass nil, and flag mode then checks nothing.
+func FilterInactiveAccounts[T any](ctx context.Context, f *AccountFilter, records []T, did func(T) string, flag func(*T, string)) []T {
+	if f == nil || len(records) == 0 || (f.mode == InactiveAccountsFlag && flag == nil) {
+		return records
+	}
+	dids := make([]string, 0, len(records))
+	for _, record := range records {
+		dids = append(dids, did(record))
+	}
+	inactive := f.Inactive(ctx, dids)
+	if len(inactive) == 0 {
+		return records
+	}
+
+	if f.mode == InactiveAccountsFlag {
+		flagged := 0
+		for i := range records {
+			if status, ok := inactive[did(records[i])]; ok {
+				flag(&records[i], status)
+				flagged++
+			}
+		}
+		f.logger.Metric("account_filter.flagged_count", float64(flagged))
+		return records
+	}
+
+	kept := make([]T, 0, len(records))
+	for _, record := range records {
+		if status, ok := inactive[did(record)]; ok {
+			f.logger.Debug("Account filter: dropped record of %s account %s", status, did(record))
+			continue
+		}
+		kept = append(kept, record)
+	}
+	f.logger.Metric("account_filter.dropped_count", float64(len(records)-len(kept)))
+	return kept
+}
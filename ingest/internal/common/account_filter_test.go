@@ -0,0 +1,62 @@
+package common
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/estest"
+	"github.com/greenearth/ingest/internal/model"
+)
+
+type accountFilterRecord struct {
+	DID    string
+	Status string
+}
+
+func TestNewAccountFilter_Modes(t *testing.T) {
+	es := estest.New(t)
+	for _, mode := range []string{"", InactiveAccountsOff} {
+		if filter, err := NewAccountFilter(es.Client, mode, NewLogger(false)); err != nil || filter != nil {
+			t.Errorf("expected no filter for mode %q, got %v, %v", mode, filter, err)
+		}
+	}
+	if _, err := NewAccountFilter(es.Client, "hide", NewLogger(false)); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+	if _, err := NewAccountFilter(nil, InactiveAccountsDrop, NewLogger(false)); err == nil {
+		t.Error("expected an error without a client")
+	}
+}
+
+func TestFilterInactiveAccounts(t *testing.T) {
+	es := estest.New(t)
+	es.Put(AccountsIndex, "did:plc:gone", NewAccountDoc(model.AccountEvent{DID: "did:plc:gone", Status: model.AccountDeactivated, TimeUs: 1}))
+	es.Put(AccountsIndex, "did:plc:back", NewAccountDoc(model.AccountEvent{DID: "did:plc:back", TimeUs: 1}))
+	records := func() []accountFilterRecord {
+		return []accountFilterRecord{{DID: "did:plc:gone"}, {DID: "did:plc:back"}, {DID: "did:plc:new"}, {DID: "did:plc:gone"}}
+	}
+	did := func(r accountFilterRecord) string { return r.DID }
+	flag := func(r *accountFilterRecord, status string) { r.Status = status }
+
+	drop, _ := NewAccountFilter(es.Client, InactiveAccountsDrop, NewLogger(false))
+	kept := FilterInactiveAccounts(context.Background(), drop, records(), did, nil)
+	if !slices.Equal(kept, []accountFilterRecord{{DID: "did:plc:back"}, {DID: "did:plc:new"}}) {
+		t.Errorf("expected the deactivated account's records dropped, got %+v", kept)
+	}
+	if calls := es.Calls(estest.APIMget); len(calls) != 1 {
+		t.Errorf("expected one account lookup, got %d", len(calls))
+	}
+
+	flagger, _ := NewAccountFilter(es.Client, InactiveAccountsFlag, NewLogger(false))
+	flagged := FilterInactiveAccounts(context.Background(), flagger, records(), did, flag)
+	if len(flagged) != 4 || flagged[0].Status != model.AccountDeactivated || flagged[3].Status != model.AccountDeactivated || flagged[1].Status != "" {
+		t.Errorf("expected the deactivated account's records flagged, got %+v", flagged)
+	}
+
+	// With nowhere to record the status, flag mode checks nothing
+	FilterInactiveAccounts(context.Background(), flagger, records(), did, nil)
+	if calls := es.Calls(estest.APIMget); len(calls) != 2 {
+		t.Errorf("expected no lookup without a flag function, got %d lookups", len(calls))
+	}
+}
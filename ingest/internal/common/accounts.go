@@ -0,0 +1,297 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/model"
+)
+
+// AccountsIndex is the alias account statuses are kept in
+const AccountsIndex = "accounts"
+
+// AccountDoc is an account's current status in the accounts index, whose
+// _id is the DID
+type AccountDoc struct {
+	DID       string `json:"did"`
+	Status    string `json:"status"` // model.AccountActive, or why the account is inactive, e.g. model.AccountDeactivated
+	Active    bool   `json:"active"`
+	ChangedAt string `json:"changed_at"` // When the account event that set the status happened
+	TimeUs    int64  `json:"time_us"`    // Time of that event; only a newer event replaces the status
+	IndexedAt string `json:"indexed_at"`
+}
+
+// NewAccountDoc returns the status event sets
+func NewAccountDoc(event model.AccountEvent) AccountDoc {
+	now := time.Now().UTC()
+	changedAt := now
+	if event.TimeUs > 0 {
+		changedAt = time.UnixMicro(event.TimeUs).UTC()
+	}
+	status := event.Status
+	if status == "" {
+		status = model.AccountActive
+	}
+	return AccountDoc{
+		DID:       event.DID,
+		Status:    status,
+		Active:    status == model.AccountActive,
+		ChangedAt: changedAt.Format(time.RFC3339),
+		TimeUs:    event.TimeUs,
+		IndexedAt: now.Format(time.RFC3339),
+	}
+}
+
+// accountStatusScript replaces a stored status only with one from an event
+// at least as new, so replayed events, and the two services that both
+// record statuses, cannot undo a later change
+const accountStatusScript = "if (ctx._source.time_us == null || params.doc.time_us >= ctx._source.time_us) { ctx._source.putAll(params.doc); } else { ctx.op = 'noop'; }"
+
+// AccountStatusWriter collects account status changes across batches and
+// upserts the latest per DID into the accounts index (see
+// BulkUpsertAccounts). Account events are rare next to the records around
+// them, so they are written periodically rather than batched with them.
+// Changes are lost if the process dies between flushes; the next event for
+// the account corrects its status. A nil AccountStatusWriter discards
+// changes.
+type AccountStatusWriter struct {
+	client   *elasticsearch.Client
+	index    string
+	interval time.Duration
+	dryRun   bool
+	logger   *IngestLogger
+
+	mu      sync.Mutex
+	pending map[string]AccountDoc
+}
+
+// NewAccountStatusWriter returns an AccountStatusWriter that writes to
+// index every interval; call Run to start it
+func NewAccountStatusWriter(client *elasticsearch.Client, index string, interval time.Duration, dryRun bool, logger *IngestLogger) *AccountStatusWriter {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	return &AccountStatusWriter{
+		client:   client,
+		index:    index,
+		interval: interval,
+		dryRun:   dryRun,
+		logger:   logger,
+		pending:  make(map[string]AccountDoc),
+	}
+}
+
+// Add records the status event sets, replacing a pending older status of
+// the same account
+func (w *AccountStatusWriter) Add(event model.AccountEvent) {
+	if w == nil || event.DID == "" {
+		return
+	}
+	doc := NewAccountDoc(event)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if pending, ok := w.pending[doc.DID]; !ok || doc.TimeUs >= pending.TimeUs {
+		w.pending[doc.DID] = doc
+	}
+}
+
+// Pending returns the number of accounts with a status not yet written
+func (w *AccountStatusWriter) Pending() int {
+	if w == nil {
+		return 0
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pending)
+}
+
+// Run writes pending statuses every interval until ctx is done. Statuses
+// added after that are written by a final Flush.
+func (w *AccountStatusWriter) Run(ctx context.Context) {
+	if w == nil {
+		return
+	}
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := w.Flush(ctx); err != nil {
+			w.logger.Error("Failed to update account statuses: %v", err)
+		}
+	}
+}
+
+// Flush writes the pending statuses. Writing a status is idempotent, so the
+// statuses of a failed write are kept for the next flush unless a newer one
+// has arrived.
+func (w *AccountStatusWriter) Flush(ctx context.Context) error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	pending := w.pending
+	w.pending = make(map[string]AccountDoc, len(pending))
+	w.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	docs := make([]AccountDoc, 0, len(pending))
+	for _, doc := range pending {
+		docs = append(docs, doc)
+	}
+	err := BulkUpsertAccounts(ctx, w.client, w.index, docs, w.dryRun, w.logger)
+	if err != nil {
+		w.mu.Lock()
+		for _, doc := range docs {
+			if newer, ok := w.pending[doc.DID]; !ok || doc.TimeUs > newer.TimeUs {
+				w.pending[doc.DID] = doc
+			}
+		}
+		w.mu.Unlock()
+		return err
+	}
+	w.logger.Metric("accounts.status_updated_count", float64(len(docs)))
+	return nil
+}
+
+// BulkUpsertAccounts writes account statuses to index, each replacing the
+// stored status of its DID unless that came from a newer event
+func BulkUpsertAccounts(ctx context.Context, client *elasticsearch.Client, index string, docs []AccountDoc, dryRun bool, logger *IngestLogger) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	if dryRun {
+		logger.Debug("Dry-run: Skipping bulk upsert of %d account statuses to index '%s'", len(docs), index)
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, doc := range docs {
+		meta := map[string]interface{}{
+			"update": map[string]interface{}{
+				"_index": index,
+				"_id":    doc.DID,
+			},
+		}
+		update := map[string]interface{}{
+			"script": map[string]interface{}{
+				"source": accountStatusScript,
+				"params": map[string]interface{}{"doc": doc},
+				"lang":   "painless",
+			},
+			"upsert":          map[string]interface{}{},
+			"scripted_upsert": true,
+		}
+		for _, line := range []interface{}{meta, update} {
+			lineJSON, err := json.Marshal(line)
+			if err != nil {
+				return fmt.Errorf("failed to marshal account status update: %w", err)
+			}
+			buf.Write(lineJSON)
+			buf.WriteByte('\n')
+		}
+	}
+
+	start := time.Now()
+	res, err := client.Bulk(
+		bytes.NewReader(buf.Bytes()),
+		client.Bulk.WithContext(ctx),
+	)
+	logger.Metric("es.upsert_accounts.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return fmt.Errorf("bulk request failed: %w", err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			logger.Error("Failed to close response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		return fmt.Errorf("bulk request returned error: %s", res.String())
+	}
+
+	var bulkResponse struct {
+		Errors bool                        `json:"errors"`
+		Items  []map[string]bulkItemResult `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&bulkResponse); err != nil {
+		return fmt.Errorf("failed to parse bulk response: %w", err)
+	}
+	if bulkResponse.Errors {
+		failed := 0
+		for _, item := range bulkResponse.Items {
+			for _, result := range item {
+				if result.Error != nil {
+					failed++
+					logger.Debug("Account status update failed: %s: %s", result.Error.Type, result.Error.Reason)
+				}
+			}
+		}
+		return fmt.Errorf("bulk account status update failed: %d of %d updates had errors", failed, len(docs))
+	}
+
+	logger.Debug("Upserted %d account statuses", len(docs))
+	return nil
+}
+
+// FetchAccounts returns the stored statuses of dids, keyed by DID. Accounts
+// with no stored status are left out.
+func FetchAccounts(ctx context.Context, client *elasticsearch.Client, logger *IngestLogger, index string, dids []string) (map[string]AccountDoc, error) {
+	accounts := make(map[string]AccountDoc)
+	if len(dids) == 0 {
+		return accounts, nil
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"ids": dids})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal account lookup: %w", err)
+	}
+
+	start := time.Now()
+	res, err := client.Mget(
+		bytes.NewReader(body),
+		client.Mget.WithContext(ctx),
+		client.Mget.WithIndex(index),
+	)
+	logger.Metric("es.fetch_accounts.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("account lookup failed: %w", err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			logger.Error("Failed to close account lookup response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("account lookup returned error: %s", res.String())
+	}
+
+	var response struct {
+		Docs []struct {
+			Found  bool       `json:"found"`
+			Source AccountDoc `json:"_source"`
+		} `json:"docs"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse account lookup response: %w", err)
+	}
+	for _, doc := range response.Docs {
+		if doc.Found {
+			accounts[doc.Source.DID] = doc.Source
+		}
+	}
+	return accounts, nil
+}
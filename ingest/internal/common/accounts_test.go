@@ -0,0 +1,79 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/estest"
+	"github.com/greenearth/ingest/internal/model"
+)
+
+// newAccountsTestServer returns a server that runs the account status
+// script like Elasticsearch: only an event at least as new replaces a status
+func newAccountsTestServer(t *testing.T) *estest.Server {
+	t.Helper()
+	es := estest.New(t)
+	es.Script(accountStatusScript, func(source, params map[string]interface{}) {
+		doc := params["doc"].(map[string]interface{})
+		if stored, ok := source["time_us"].(float64); ok && doc["time_us"].(float64) < stored {
+			return
+		}
+		for k, v := range doc {
+			source[k] = v
+		}
+	})
+	return es
+}
+
+func TestAccountStatusWriter_KeepsNewestStatus(t *testing.T) {
+	es := newAccountsTestServer(t)
+	writer := NewAccountStatusWriter(es.Client, AccountsIndex, 0, false, NewLogger(false))
+
+	writer.Add(model.AccountEvent{DID: "did:plc:a", Status: model.AccountDeactivated, TimeUs: 2000000})
+	writer.Add(model.AccountEvent{DID: "did:plc:a", TimeUs: 1000000}) // Older, arrived late
+	writer.Add(model.AccountEvent{DID: "did:plc:b", Status: model.AccountTakendown, TimeUs: 1000000})
+	writer.Add(model.AccountEvent{Status: model.AccountDeactivated})
+	if n := writer.Pending(); n != 2 {
+		t.Fatalf("expected 2 accounts pending, got %d", n)
+	}
+	if err := writer.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A replayed older event leaves the stored status alone; a newer one
+	// reactivates the account
+	writer.Add(model.AccountEvent{DID: "did:plc:a", TimeUs: 1500000})
+	writer.Add(model.AccountEvent{DID: "did:plc:b", TimeUs: 3000000})
+	if err := writer.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	accounts, err := FetchAccounts(context.Background(), es.Client, NewLogger(false), AccountsIndex, []string{"did:plc:a", "did:plc:b", "did:plc:unknown"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(accounts) != 2 {
+		t.Fatalf("expected 2 stored accounts, got %+v", accounts)
+	}
+	if a := accounts["did:plc:a"]; a.Status != model.AccountDeactivated || a.Active || a.ChangedAt != "1970-01-01T00:00:02Z" {
+		t.Errorf("expected did:plc:a to stay deactivated, got %+v", a)
+	}
+	if b := accounts["did:plc:b"]; b.Status != model.AccountActive || !b.Active {
+		t.Errorf("expected did:plc:b to be active again, got %+v", b)
+	}
+}
+
+func TestAccountStatusWriter_DryRun(t *testing.T) {
+	es := newAccountsTestServer(t)
+	writer := NewAccountStatusWriter(es.Client, AccountsIndex, 0, true, NewLogger(false))
+	writer.Add(model.AccountEvent{DID: "did:plc:a", Status: model.AccountSuspended, TimeUs: 1})
+	if err := writer.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls := es.Calls(estest.APIBulk); len(calls) != 0 {
+		t.Errorf("expected a dry run to write nothing, got %d bulk calls", len(calls))
+	}
+	if writer.Pending() != 0 {
+		t.Error("expected a dry run to clear the pending statuses")
+	}
+}
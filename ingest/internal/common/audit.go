@@ -0,0 +1,129 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// Audited operations
+const (
+	AuditDeleteByQuery   = "delete_by_query"
+	AuditDropIndex       = "drop_index"
+	AuditRestoreSnapshot = "restore_snapshot"
+	AuditCursorOverride  = "cursor_override"
+	AuditAccountDeletion = "account_deletion"
+)
+
+// AuditEntry records one destructive operation: who ran it, what it touched,
+// when, and how many documents it affected
+type AuditEntry struct {
+	PerformedAt time.Time `json:"performed_at"`
+	Actor       string    `json:"actor"`
+	Service     string    `json:"service"`
+	Environment string    `json:"environment"`
+	Operation   string    `json:"operation"`
+	Target      string    `json:"target"`           // Index, alias, state file, or DID the operation acted on
+	Detail      string    `json:"detail,omitempty"` // Query, cutoff, or cursor change, in human-readable form
+	Count       int64     `json:"count"`            // Documents affected; -1 when unknown
+	DryRun      bool      `json:"dry_run"`
+}
+
+// AuditLog appends audit entries to an Elasticsearch index
+type AuditLog struct {
+	client      *elasticsearch.Client
+	index       string
+	actor       string
+	environment string
+}
+
+// NewAuditLog creates an audit log writing to GE_AUDIT_INDEX. The actor is
+// GE_AUDIT_ACTOR, falling back to $USER; entries from services with neither
+// are attributed to the service. Returns nil when client is nil or
+// GE_AUDIT_INDEX is empty; a nil audit log only writes the AUDIT log line.
+func NewAuditLog(client *elasticsearch.Client, config *Config) *AuditLog {
+	if client == nil || config.AuditIndex == "" {
+		return nil
+	}
+	actor := config.AuditActor
+	if actor == "" {
+		actor = os.Getenv("USER")
+	}
+	return &AuditLog{
+		client:      client,
+		index:       config.AuditIndex,
+		actor:       actor,
+		environment: config.Environment,
+	}
+}
+
+// Write indexes entry into the audit index
+func (a *AuditLog) Write(ctx context.Context, entry AuditEntry) error {
+	body, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+	res, err := a.client.Index(
+		a.index,
+		bytes.NewReader(body),
+		a.client.Index.WithContext(ctx),
+	)
+	if err != nil {
+		return fmt.Errorf("audit index request failed: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.IsError() {
+		return fmt.Errorf("audit index returned error: %s", res.String())
+	}
+	return nil
+}
+
+// SetAuditLog configures where Audit records destructive operations.
+// Without an audit log they are only logged.
+func (l *IngestLogger) SetAuditLog(a *AuditLog) {
+	l.auditLog = a
+}
+
+// Audit records a destructive operation. The entry is always logged as an
+// AUDIT line and, with an audit log configured, appended to the audit index.
+// Failing to write the entry is logged but never fails the operation.
+func (l *IngestLogger) Audit(ctx context.Context, entry AuditEntry) {
+	if entry.PerformedAt.IsZero() {
+		entry.PerformedAt = time.Now().UTC()
+	}
+	if entry.Service == "" {
+		entry.Service = l.service
+	}
+	if l.auditLog != nil {
+		if entry.Actor == "" {
+			entry.Actor = l.auditLog.actor
+		}
+		if entry.Environment == "" {
+			entry.Environment = l.auditLog.environment
+		}
+	}
+	if entry.Actor == "" {
+		entry.Actor = entry.Service
+	}
+
+	l.WithFields(map[string]interface{}{
+		"audit_operation": entry.Operation,
+		"audit_target":    entry.Target,
+		"audit_actor":     entry.Actor,
+		"audit_count":     entry.Count,
+		"audit_dry_run":   entry.DryRun,
+	}).Info("AUDIT %s on %s by %s: %d documents (%s)", entry.Operation, entry.Target, entry.Actor, entry.Count, entry.Detail)
+
+	if l.auditLog == nil {
+		return
+	}
+	if err := l.auditLog.Write(ctx, entry); err != nil {
+		l.Error("Failed to write audit entry for %s on %s: %v", entry.Operation, entry.Target, err)
+		l.Metric("audit.write_error_count", 1)
+	}
+}
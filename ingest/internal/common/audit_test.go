@@ -0,0 +1,73 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestAudit_WritesEntry(t *testing.T) {
+	var entries []AuditEntry
+	client, srv := newMockESClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		if r.URL.Path != "/ops_audit/_doc" {
+			t.Errorf("unexpected request path %s", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		var entry AuditEntry
+		if err := json.Unmarshal(body, &entry); err != nil {
+			t.Errorf("failed to parse audit entry: %v", err)
+		}
+		entries = append(entries, entry)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"result":"created"}`))
+	}))
+	defer srv.Close()
+
+	logger := NewLogger(false)
+	logger.SetService("elasticsearch-expiry")
+	logger.SetAuditLog(NewAuditLog(client, &Config{AuditIndex: "ops_audit", AuditActor: "oncall@greenearth.social", Environment: "prod"}))
+	logger.Audit(context.Background(), AuditEntry{Operation: AuditDeleteByQuery, Target: "hashtags", Count: 12})
+
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 audit entry, got %d", len(entries))
+	}
+	got := entries[0]
+	if got.Actor != "oncall@greenearth.social" || got.Service != "elasticsearch-expiry" || got.Environment != "prod" {
+		t.Errorf("unexpected attribution %+v", got)
+	}
+	if got.Operation != AuditDeleteByQuery || got.Target != "hashtags" || got.Count != 12 || got.PerformedAt.IsZero() {
+		t.Errorf("unexpected entry %+v", got)
+	}
+}
+
+func TestAudit_WriteFailureDoesNotFail(t *testing.T) {
+	client, srv := newMockESClient(t, &mockESHandler{statusCode: 503, body: `{"error":"unavailable"}`})
+	defer srv.Close()
+
+	metrics := newMockMetricCollector()
+	logger := NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(metrics)
+	logger.SetAuditLog(NewAuditLog(client, &Config{AuditIndex: "ops_audit"}))
+	logger.Audit(context.Background(), AuditEntry{Operation: AuditDropIndex, Target: "hashtags-2026-06"})
+
+	if got := metrics.getRecords("audit.write_error_count"); len(got) != 1 {
+		t.Errorf("expected one audit write error, got %v", got)
+	}
+}
+
+func TestNewAuditLog_Disabled(t *testing.T) {
+	client, srv := newMockESClient(t, &mockESHandler{statusCode: 200, body: `{}`})
+	defer srv.Close()
+
+	if a := NewAuditLog(client, &Config{}); a != nil {
+		t.Error("expected no audit log without an audit index")
+	}
+	if a := NewAuditLog(nil, &Config{AuditIndex: "ops_audit"}); a != nil {
+		t.Error("expected no audit log without a client")
+	}
+}
@@ -0,0 +1,113 @@
+package common
+
+import "time"
+
+// BatchConfig controls when a Batcher's batch is ready to flush
+type BatchConfig struct {
+	MaxDocs  int           // Documents per batch
+	MaxBytes int           // Estimated payload bytes per batch; 0 disables the size trigger
+	MaxAge   time.Duration // How long a batch's first document may wait; 0 disables the age trigger
+}
+
+// BatchConfigFromConfig returns the batching configuration in config, with
+// maxDocs documents per batch unless GE_BULK_MAX_DOCS overrides it
+func BatchConfigFromConfig(config *Config, maxDocs int) BatchConfig {
+	if config.BulkMaxDocs > 0 {
+		maxDocs = config.BulkMaxDocs
+	}
+	return BatchConfig{
+		MaxDocs:  maxDocs,
+		MaxBytes: config.BulkMaxBytes,
+		MaxAge:   config.BulkMaxAge,
+	}
+}
+
+// TickInterval is how often a caller should check Due so that no batch
+// waits much longer than MaxAge, or 0 if batches never age out
+func (c BatchConfig) TickInterval() time.Duration {
+	if c.MaxAge <= 0 {
+		return 0
+	}
+	return max(c.MaxAge/4, 10*time.Millisecond)
+}
+
+// Batcher accumulates documents until a batch holds MaxDocs of them, holds
+// MaxBytes of estimated payload, or its first document is MaxAge old. Full
+// reports the first two as documents are added; the caller checks Due
+// periodically (see TickInterval) for the last. A Batcher is not safe for
+// concurrent use.
+type Batcher[T any] struct {
+	config BatchConfig
+
+	// Limit, if set, adjusts MaxDocs each time Full is checked, e.g.
+	// MemoryGuard.BatchSize to shrink batches under memory pressure
+	Limit func(maxDocs int) int
+
+	docs    []T
+	bytes   int
+	started time.Time
+	now     func() time.Time
+}
+
+// NewBatcher returns an empty Batcher
+func NewBatcher[T any](config BatchConfig) *Batcher[T] {
+	return &Batcher[T]{
+		config: config,
+		docs:   make([]T, 0, max(config.MaxDocs, 0)),
+		now:    time.Now,
+	}
+}
+
+// Add appends doc, whose estimated payload is size bytes (e.g. the length of
+// the raw event it came from), and reports whether the batch is now full
+func (b *Batcher[T]) Add(doc T, size int) bool {
+	if len(b.docs) == 0 {
+		b.started = b.now()
+	}
+	b.docs = append(b.docs, doc)
+	b.bytes += size
+	return b.Full()
+}
+
+// Full reports whether the batch has reached MaxDocs or MaxBytes
+func (b *Batcher[T]) Full() bool {
+	if len(b.docs) == 0 {
+		return false
+	}
+	maxDocs := b.config.MaxDocs
+	if b.Limit != nil {
+		maxDocs = b.Limit(maxDocs)
+	}
+	if len(b.docs) >= maxDocs {
+		return true
+	}
+	return b.config.MaxBytes > 0 && b.bytes >= b.config.MaxBytes
+}
+
+// Due reports whether the batch is non-empty and its first document has
+// waited MaxAge
+func (b *Batcher[T]) Due() bool {
+	return len(b.docs) > 0 && b.config.MaxAge > 0 && b.now().Sub(b.started) >= b.config.MaxAge
+}
+
+// Len returns the number of documents in the batch
+func (b *Batcher[T]) Len() int {
+	return len(b.docs)
+}
+
+// Docs returns the documents in the batch. The slice is only valid until the
+// next Add or Take.
+func (b *Batcher[T]) Docs() []T {
+	return b.docs
+}
+
+// Take returns the batch and starts a new one. The returned slice is the
+// caller's: later Adds write to a fresh backing array, so it may be handed
+// to another goroutine.
+func (b *Batcher[T]) Take() []T {
+	docs := b.docs
+	b.docs = make([]T, 0, max(b.config.MaxDocs, 0))
+	b.bytes = 0
+	b.started = time.Time{}
+	return docs
+}
@@ -0,0 +1,137 @@
+package common
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestBatcher returns a Batcher whose clock is advanced by the returned
+// function
+func newTestBatcher(config BatchConfig) (*Batcher[string], func(time.Duration)) {
+	now := time.Unix(1700000000, 0)
+	b := NewBatcher[string](config)
+	b.now = func() time.Time { return now }
+	return b, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestBatcher_MaxDocs(t *testing.T) {
+	b, _ := newTestBatcher(BatchConfig{MaxDocs: 3})
+	for i, doc := range []string{"a", "b"} {
+		if b.Add(doc, 10) {
+			t.Fatalf("batch full after %d documents", i+1)
+		}
+	}
+	if !b.Add("c", 10) {
+		t.Fatal("expected the batch to be full at MaxDocs")
+	}
+
+	docs := b.Take()
+	if len(docs) != 3 || docs[0] != "a" || docs[2] != "c" {
+		t.Errorf("unexpected batch %v", docs)
+	}
+	if b.Len() != 0 || b.Full() {
+		t.Error("expected Take to start an empty batch")
+	}
+
+	// The taken slice is not shared with the next batch
+	b.Add("d", 10)
+	if docs[0] != "a" {
+		t.Errorf("Add after Take wrote to the taken batch: %v", docs)
+	}
+}
+
+func TestBatcher_MaxBytes(t *testing.T) {
+	b, _ := newTestBatcher(BatchConfig{MaxDocs: 100, MaxBytes: 1000})
+	if b.Add("a", 600) {
+		t.Fatal("batch full below MaxBytes")
+	}
+	if !b.Add("b", 400) {
+		t.Fatal("expected the batch to be full at MaxBytes")
+	}
+
+	b.Take()
+	if b.Add("c", 600) {
+		t.Error("expected Take to reset the byte count")
+	}
+
+	b, _ = newTestBatcher(BatchConfig{MaxDocs: 100})
+	if b.Add("a", 1<<30) {
+		t.Error("expected no size trigger without MaxBytes")
+	}
+}
+
+func TestBatcher_MaxAge(t *testing.T) {
+	b, advance := newTestBatcher(BatchConfig{MaxDocs: 100, MaxAge: 5 * time.Second})
+	advance(time.Minute)
+	if b.Due() {
+		t.Fatal("an empty batch is never due")
+	}
+
+	b.Add("a", 1)
+	advance(3 * time.Second)
+	b.Add("b", 1)
+	if b.Due() {
+		t.Fatal("batch due before MaxAge")
+	}
+
+	// Age is measured from the first document, not the latest
+	advance(2 * time.Second)
+	if !b.Due() {
+		t.Fatal("expected the batch to be due MaxAge after its first document")
+	}
+
+	b.Take()
+	b.Add("c", 1)
+	if b.Due() {
+		t.Error("expected Take to restart the age")
+	}
+
+	b, advance = newTestBatcher(BatchConfig{MaxDocs: 100})
+	b.Add("a", 1)
+	advance(time.Hour)
+	if b.Due() {
+		t.Error("expected no age trigger without MaxAge")
+	}
+}
+
+func TestBatcher_Limit(t *testing.T) {
+	b, _ := newTestBatcher(BatchConfig{MaxDocs: 8})
+	throttled := false
+	b.Limit = func(maxDocs int) int {
+		if throttled {
+			return maxDocs / 4
+		}
+		return maxDocs
+	}
+
+	b.Add("a", 1)
+	if b.Add("b", 1) {
+		t.Fatal("batch full below MaxDocs")
+	}
+	throttled = true
+	if !b.Full() {
+		t.Error("expected Limit to shrink the batch")
+	}
+}
+
+func TestBatchConfig_TickInterval(t *testing.T) {
+	if got := (BatchConfig{MaxAge: 4 * time.Second}).TickInterval(); got != time.Second {
+		t.Errorf("got %v, want 1s", got)
+	}
+	if got := (BatchConfig{}).TickInterval(); got != 0 {
+		t.Errorf("got %v without MaxAge, want 0", got)
+	}
+}
+
+func TestBatchConfigFromConfig(t *testing.T) {
+	config := &Config{BulkMaxBytes: 5 << 20, BulkMaxAge: 5 * time.Second}
+	got := BatchConfigFromConfig(config, 100)
+	if got != (BatchConfig{MaxDocs: 100, MaxBytes: 5 << 20, MaxAge: 5 * time.Second}) {
+		t.Errorf("unexpected config %+v", got)
+	}
+
+	config.BulkMaxDocs = 250
+	if got := BatchConfigFromConfig(config, 100); got.MaxDocs != 250 {
+		t.Errorf("expected GE_BULK_MAX_DOCS to override the default, got %d", got.MaxDocs)
+	}
+}
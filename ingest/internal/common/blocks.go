@@ -0,0 +1,258 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// BlocksIndex is the alias blocks are kept in
+const BlocksIndex = "blocks"
+
+// BlockDoc is a block record in the blocks index, whose _id is the block's
+// at_uri. Blocks are routed by author_did like follows.
+type BlockDoc struct {
+	AtURI      string `json:"at_uri"`
+	AuthorDID  string `json:"author_did"`
+	SubjectDID string `json:"subject_did"`
+	CreatedAt  string `json:"created_at"`
+	IndexedAt  string `json:"indexed_at"`
+}
+
+func (d BlockDoc) esAtURI() string     { return d.AtURI }
+func (d BlockDoc) esAuthorDID() string { return d.AuthorDID }
+
+// CreateBlockDoc creates a BlockDoc from a JetstreamMessage
+func CreateBlockDoc(msg JetstreamMessage) BlockDoc {
+	return BlockDoc{
+		AtURI:      msg.GetAtURI(),
+		AuthorDID:  msg.GetAuthorDID(),
+		SubjectDID: msg.GetSubjectDID(),
+		CreatedAt:  msg.GetCreatedAt(),
+		IndexedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// pendingBlock is a block write not yet sent: the block to index, or its
+// removal when deleted is set
+type pendingBlock struct {
+	doc     BlockDoc
+	deleted bool
+	timeUs  int64
+}
+
+// BlockWriter collects blocks and unblocks across batches and writes them to
+// the blocks index periodically, the way AccountStatusWriter writes account
+// statuses. Only the latest write per block is kept. Writes are lost if the
+// process dies between flushes. A nil BlockWriter discards writes.
+type BlockWriter struct {
+	client   *elasticsearch.Client
+	index    string
+	interval time.Duration
+	dryRun   bool
+	logger   *IngestLogger
+
+	mu      sync.Mutex
+	pending map[string]pendingBlock
+}
+
+// NewBlockWriter returns a BlockWriter that writes to index every interval;
+// call Run to start it
+func NewBlockWriter(client *elasticsearch.Client, index string, interval time.Duration, dryRun bool, logger *IngestLogger) *BlockWriter {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	return &BlockWriter{
+		client:   client,
+		index:    index,
+		interval: interval,
+		dryRun:   dryRun,
+		logger:   logger,
+		pending:  make(map[string]pendingBlock),
+	}
+}
+
+// Add records a block create or delete message; other messages are ignored
+func (w *BlockWriter) Add(msg JetstreamMessage) {
+	if w == nil || msg.GetAtURI() == "" {
+		return
+	}
+	var op pendingBlock
+	switch {
+	case msg.IsBlock():
+		if msg.GetSubjectDID() == "" {
+			w.logger.Error("Skipping block with empty subject_did (at_uri: %s)", msg.GetAtURI())
+			return
+		}
+		op = pendingBlock{doc: CreateBlockDoc(msg), timeUs: msg.GetTimeUs()}
+	case msg.IsBlockDelete():
+		op = pendingBlock{doc: BlockDoc{AtURI: msg.GetAtURI(), AuthorDID: msg.GetAuthorDID()}, deleted: true, timeUs: msg.GetTimeUs()}
+	default:
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if pending, ok := w.pending[op.doc.AtURI]; !ok || op.timeUs >= pending.timeUs {
+		w.pending[op.doc.AtURI] = op
+	}
+}
+
+// Pending returns the number of blocks with a write not yet sent
+func (w *BlockWriter) Pending() int {
+	if w == nil {
+		return 0
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pending)
+}
+
+// Run writes pending blocks every interval until ctx is done. Blocks added
+// after that are written by a final Flush.
+func (w *BlockWriter) Run(ctx context.Context) {
+	if w == nil {
+		return
+	}
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := w.Flush(ctx); err != nil {
+			w.logger.Error("Failed to write blocks: %v", err)
+		}
+	}
+}
+
+// Flush writes the pending blocks. Indexing and deleting a block are
+// idempotent, so the writes of a failed request are kept for the next flush
+// unless a newer write of the block has arrived.
+func (w *BlockWriter) Flush(ctx context.Context) error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	pending := w.pending
+	w.pending = make(map[string]pendingBlock, len(pending))
+	w.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	var created, deleted []pendingBlock
+	for _, op := range pending {
+		if op.deleted {
+			deleted = append(deleted, op)
+		} else {
+			created = append(created, op)
+		}
+	}
+
+	var errs []error
+	if len(created) > 0 {
+		docs := make([]BlockDoc, len(created))
+		for i, op := range created {
+			docs[i] = op.doc
+		}
+		if err := BulkIndex(ctx, w.client, w.index, docs, w.dryRun, w.logger); err != nil {
+			errs = append(errs, fmt.Errorf("failed to index %d blocks: %w", len(docs), err))
+			w.requeue(created)
+		} else {
+			w.logger.Metric("blocks.indexed_count", float64(len(docs)))
+		}
+	}
+	if len(deleted) > 0 {
+		docs := make([]DeleteDoc, len(deleted))
+		for i, op := range deleted {
+			docs[i] = DeleteDoc{DocID: op.doc.AtURI, AuthorDID: op.doc.AuthorDID}
+		}
+		if err := BulkDelete(ctx, w.client, w.index, docs, w.dryRun, w.logger); err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete %d blocks: %w", len(docs), err))
+			w.requeue(deleted)
+		} else {
+			w.logger.Metric("blocks.deleted_count", float64(len(docs)))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// requeue keeps the writes of a failed request unless a newer write of the
+// same block has arrived
+func (w *BlockWriter) requeue(ops []pendingBlock) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, op := range ops {
+		if newer, ok := w.pending[op.doc.AtURI]; !ok || op.timeUs > newer.timeUs {
+			w.pending[op.doc.AtURI] = op
+		}
+	}
+}
+
+// FetchBlocks returns up to limit blocks made by or against did, newest
+// first
+func FetchBlocks(ctx context.Context, client *elasticsearch.Client, logger *IngestLogger, index, did string, limit int) ([]BlockDoc, error) {
+	query := map[string]interface{}{
+		"size": limit,
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"should": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"author_did": did}},
+					map[string]interface{}{"term": map[string]interface{}{"subject_did": did}},
+				},
+				"minimum_should_match": 1,
+			},
+		},
+		"sort": []interface{}{
+			map[string]interface{}{"created_at": "desc"},
+		},
+	}
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal block query: %w", err)
+	}
+
+	start := time.Now()
+	res, err := client.Search(
+		client.Search.WithContext(ctx),
+		client.Search.WithIndex(index),
+		client.Search.WithBody(bytes.NewReader(queryJSON)),
+	)
+	logger.Metric("es.fetch_blocks.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("block lookup failed: %w", err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			logger.Error("Failed to close block lookup response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("block lookup returned error: %s", res.String())
+	}
+
+	var response struct {
+		Hits struct {
+			Hits []struct {
+				Source BlockDoc `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse block lookup response: %w", err)
+	}
+	blocks := make([]BlockDoc, 0, len(response.Hits.Hits))
+	for _, hit := range response.Hits.Hits {
+		blocks = append(blocks, hit.Source)
+	}
+	return blocks, nil
+}
@@ -0,0 +1,70 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+const (
+	testBlockCreate = `{"did":"did:plc:a","time_us":1000000,"kind":"commit","commit":{"operation":"create","collection":"app.bsky.graph.block","rkey":"3kblock1","record":{"$type":"app.bsky.graph.block","subject":"did:plc:b","createdAt":"2026-10-16T12:00:00.000Z"}}}`
+	testBlockDelete = `{"did":"did:plc:a","time_us":2000000,"kind":"commit","commit":{"operation":"delete","collection":"app.bsky.graph.block","rkey":"3kblock1"}}`
+)
+
+func TestJetstreamMessage_Block(t *testing.T) {
+	logger := NewLogger(false)
+
+	msg := NewJetstreamMessage(testBlockCreate, logger)
+	if !msg.IsBlock() || msg.IsBlockDelete() || msg.IsFollow() {
+		t.Fatalf("expected a block create, got block=%v blockDelete=%v follow=%v", msg.IsBlock(), msg.IsBlockDelete(), msg.IsFollow())
+	}
+	if msg.GetAtURI() != "at://did:plc:a/app.bsky.graph.block/3kblock1" || msg.GetSubjectDID() != "did:plc:b" {
+		t.Errorf("unexpected block fields: at_uri=%s subject_did=%s", msg.GetAtURI(), msg.GetSubjectDID())
+	}
+	if msg.GetCreatedAt() != "2026-10-16T12:00:00Z" {
+		t.Errorf("expected a normalized created_at, got %s", msg.GetCreatedAt())
+	}
+
+	msg = NewJetstreamMessage(testBlockDelete, logger)
+	if !msg.IsBlockDelete() || msg.IsBlock() || msg.IsFollowDelete() {
+		t.Fatalf("expected a block delete, got block=%v blockDelete=%v followDelete=%v", msg.IsBlock(), msg.IsBlockDelete(), msg.IsFollowDelete())
+	}
+}
+
+func TestBlockWriter(t *testing.T) {
+	es := estest.New(t)
+	logger := NewLogger(false)
+	writer := NewBlockWriter(es.Client, BlocksIndex, 0, false, logger)
+
+	writer.Add(NewJetstreamMessage(testBlockCreate, logger))
+	writer.Add(NewJetstreamMessage(`{"did":"did:plc:c","time_us":1000000,"kind":"commit","commit":{"operation":"create","collection":"app.bsky.graph.block","rkey":"3kblock2","record":{"subject":"did:plc:a","createdAt":"2026-10-16T13:00:00.000Z"}}}`, logger))
+	writer.Add(NewJetstreamMessage(`{"did":"did:plc:c","time_us":1000000,"kind":"commit","commit":{"operation":"create","collection":"app.bsky.graph.follow","rkey":"3kfollow","record":{"subject":"did:plc:a","createdAt":"2026-10-16T13:00:00.000Z"}}}`, logger))
+	if n := writer.Pending(); n != 2 {
+		t.Fatalf("expected 2 blocks pending, got %d", n)
+	}
+	if err := writer.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	blocks, err := FetchBlocks(context.Background(), es.Client, logger, BlocksIndex, "did:plc:a", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(blocks) != 2 || blocks[0].AuthorDID != "did:plc:c" || blocks[1].SubjectDID != "did:plc:b" {
+		t.Errorf("expected blocks by and against did:plc:a, newest first, got %+v", blocks)
+	}
+
+	// The unblock replaces the block in the same flush window
+	writer.Add(NewJetstreamMessage(testBlockCreate, logger))
+	writer.Add(NewJetstreamMessage(testBlockDelete, logger))
+	if err := writer.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, found := es.Get(BlocksIndex, "at://did:plc:a/app.bsky.graph.block/3kblock1"); found {
+		t.Error("expected the unblock to delete the block")
+	}
+	if es.Len(BlocksIndex) != 1 {
+		t.Errorf("expected the other block kept, got %d blocks", es.Len(BlocksIndex))
+	}
+}
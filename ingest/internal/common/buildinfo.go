@@ -0,0 +1,61 @@
+package common
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Build information set at link time by the Makefile, e.g.
+// -X github.com/greenearth/ingest/internal/common.version=v1.4.0. Builds
+// without them (go run, buildpacks) fall back to what the Go toolchain
+// embeds.
+var (
+	version   string
+	commit    string
+	buildTime string
+)
+
+// BuildInfo identifies the build a binary came from
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"` // Commit time, so rebuilding a commit reproduces it
+	Modified  bool   `json:"modified,omitempty"`   // Built from a tree with uncommitted changes
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+// GetBuildInfo returns the binary's build information, served at /version
+// by the health server
+func GetBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildTime: buildTime,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if embedded, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && embedded.Main.Version != "" {
+			info.Version = embedded.Main.Version
+		}
+		for _, setting := range embedded.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = setting.Value
+				}
+			case "vcs.modified":
+				info.Modified = setting.Value == "true"
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "(devel)"
+	}
+	return info
+}
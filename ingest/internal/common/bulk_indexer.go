@@ -0,0 +1,134 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// Routable is the constraint for document types that can be bulk-indexed:
+// the at_uri is the document's _id and the author_did its routing.
+type Routable interface {
+	esAtURI() string
+	esAuthorDID() string
+}
+
+// Versioned is implemented by documents that carry the time of the event
+// they were built from. BulkIndexer indexes them with it as an external
+// version, so an event re-ingested after a newer one (e.g. from an older
+// file) cannot overwrite the newer state. A version of 0 indexes the
+// document unversioned.
+type Versioned interface {
+	esVersion() int64
+}
+
+// BulkIndexer indexes batches of one document type through submitBulkIndex,
+// which retries throttled items and dead-letters the rest. A new document
+// type needs only a Routable implementation and an indexer.
+type BulkIndexer[T Routable] struct {
+	// Kind names the documents in logs and errors, e.g. "like tombstone";
+	// empty for generic documents
+	Kind string
+	// Metric names the bulk request's metrics, e.g. "es.bulk_index_likes"
+	Metric string
+	// Target returns the index doc goes to, given the batch's index. If nil,
+	// every document goes to the batch's index.
+	Target func(doc T, index string) string
+	// Skip returns why doc cannot be indexed, or "" to index it. Documents
+	// without an at_uri are always skipped.
+	Skip func(doc T) string
+}
+
+// Index indexes docs to index, skipping any without an at_uri or that Skip
+// rejects. It is an error if every document is skipped.
+func (b BulkIndexer[T]) Index(ctx context.Context, client *elasticsearch.Client, index string, docs []T, dryRun bool, logger *IngestLogger) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	noun := b.Kind
+	if noun == "" {
+		noun = "document"
+	}
+
+	if dryRun {
+		logger.Debug("Dry-run: Skipping bulk index of %d %ss to index '%s'", len(docs), noun, index)
+		return nil
+	}
+
+	var sent []DeadLetter
+	for _, doc := range docs {
+		if doc.esAtURI() == "" {
+			logger.Error("Skipping %s with empty at_uri (author_did: %s)", noun, doc.esAuthorDID())
+			continue
+		}
+		if b.Skip != nil {
+			if reason := b.Skip(doc); reason != "" {
+				logger.Error("Skipping %s with %s (at_uri: %s)", noun, reason, doc.esAtURI())
+				continue
+			}
+		}
+
+		docJSON, err := json.Marshal(doc)
+		if err != nil {
+			if b.Kind == "" {
+				return fmt.Errorf("failed to marshal document: %w", err)
+			}
+			return fmt.Errorf("failed to marshal %s document: %w", b.Kind, err)
+		}
+
+		target := index
+		if b.Target != nil {
+			target = b.Target(doc, index)
+		}
+		letter := DeadLetter{Index: target, ID: doc.esAtURI(), Routing: doc.esAuthorDID(), Source: docJSON}
+		if versioned, ok := any(doc).(Versioned); ok {
+			letter.Version = versioned.esVersion()
+		}
+		sent = append(sent, letter)
+	}
+
+	if len(sent) == 0 {
+		logger.Error("No valid %ss to index (all %d were skipped)", noun, len(docs))
+		return fmt.Errorf("no valid %ss in batch", noun)
+	}
+
+	return submitBulkIndex(ctx, client, sent, b.Metric, b.Kind, logger)
+}
+
+// BulkIndexWithIDs indexes docs to index without routing, each under the
+// _id id returns, for documents that are not keyed by an at_uri (e.g.
+// recommender impressions and metrics). Documents with an empty _id are
+// skipped. kind names the documents in logs and errors and metric the bulk
+// request's metrics, as for BulkIndexer.
+func BulkIndexWithIDs[T any](ctx context.Context, client *elasticsearch.Client, index string, docs []T, id func(T) string,
+	kind, metric string, dryRun bool, logger *IngestLogger) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	if dryRun {
+		logger.Debug("Dry-run: Skipping bulk index of %d %ss to index '%s'", len(docs), kind, index)
+		return nil
+	}
+
+	sent := make([]DeadLetter, 0, len(docs))
+	for _, doc := range docs {
+		docID := id(doc)
+		if docID == "" {
+			logger.Error("Skipping %s with empty _id", kind)
+			continue
+		}
+		docJSON, err := json.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("failed to marshal %s document: %w", kind, err)
+		}
+		sent = append(sent, DeadLetter{Index: index, ID: docID, Source: docJSON})
+	}
+	if len(sent) == 0 {
+		return fmt.Errorf("no valid %ss in batch", kind)
+	}
+
+	return submitBulkIndex(ctx, client, sent, metric, kind, logger)
+}
@@ -0,0 +1,107 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+// bookDoc is a document type that exists only to exercise BulkIndexer
+type bookDoc struct {
+	AtURI     string `json:"at_uri"`
+	AuthorDID string `json:"author_did"`
+	Title     string `json:"title"`
+	Shelf     string `json:"-"`
+}
+
+func (d bookDoc) esAtURI() string     { return d.AtURI }
+func (d bookDoc) esAuthorDID() string { return d.AuthorDID }
+
+var bookIndexer = BulkIndexer[bookDoc]{
+	Kind:   "book",
+	Metric: "es.bulk_index_books",
+	Target: func(doc bookDoc, index string) string {
+		if doc.Shelf != "" {
+			return index + "-" + doc.Shelf
+		}
+		return index
+	},
+	Skip: func(doc bookDoc) string {
+		if doc.Title == "" {
+			return "empty title"
+		}
+		return ""
+	},
+}
+
+func TestBulkIndexer_RoutesTargetsAndSkips(t *testing.T) {
+	es := estest.New(t)
+	docs := []bookDoc{
+		{AtURI: "at://a", AuthorDID: "did:plc:a", Title: "a"},
+		{AtURI: "at://b", AuthorDID: "did:plc:b", Title: "b", Shelf: "top"},
+		{AtURI: "at://untitled", AuthorDID: "did:plc:c"},
+		{AuthorDID: "did:plc:d", Title: "no uri"},
+	}
+	if err := bookIndexer.Index(context.Background(), es.Client, "books", docs, false, NewLogger(false)); err != nil {
+		t.Fatal(err)
+	}
+
+	if doc, ok := es.Get("books", "at://a"); !ok || doc["title"] != "a" {
+		t.Errorf("expected at://a in books, got %v", doc)
+	}
+	if _, ok := es.Get("books-top", "at://b"); !ok {
+		t.Error("expected at://b in its target index")
+	}
+	if es.Len("books")+es.Len("books-top") != 2 {
+		t.Error("expected the skipped documents not to be indexed")
+	}
+
+	calls := es.Calls(estest.APIBulk)
+	if len(calls) != 1 {
+		t.Fatalf("expected one bulk request, got %d", len(calls))
+	}
+	for _, item := range calls[0].BulkItems() {
+		if want := "did:plc:" + item.ID[len("at://"):]; item.Routing != want {
+			t.Errorf("%s: routing %q, want %q", item.ID, item.Routing, want)
+		}
+	}
+}
+
+func TestBulkIndexer_AllSkipped(t *testing.T) {
+	es := estest.New(t)
+	docs := []bookDoc{{AtURI: "at://untitled"}, {Title: "no uri"}}
+
+	err := bookIndexer.Index(context.Background(), es.Client, "books", docs, false, NewLogger(false))
+	if err == nil || err.Error() != "no valid books in batch" {
+		t.Errorf("expected no valid documents, got %v", err)
+	}
+	if len(es.Calls(estest.APIBulk)) != 0 {
+		t.Error("expected no bulk request")
+	}
+
+	if err := bookIndexer.Index(context.Background(), es.Client, "books", docs, true, NewLogger(false)); err != nil {
+		t.Errorf("expected a dry run to skip validation, got %v", err)
+	}
+}
+
+func TestBulkIndexWithIDs(t *testing.T) {
+	es := estest.New(t)
+	docs := []bookDoc{{Title: "a", Shelf: "1"}, {Title: "b", Shelf: "2"}, {Title: "no id"}}
+	shelfID := func(doc bookDoc) string { return doc.Shelf }
+
+	if err := BulkIndexWithIDs(context.Background(), es.Client, "books", docs, shelfID, "book", "es.bulk_index_books", false, NewLogger(false)); err != nil {
+		t.Fatal(err)
+	}
+	if doc, ok := es.Get("books", "2"); !ok || doc["title"] != "b" {
+		t.Errorf("expected b under _id 2, got %v", doc)
+	}
+	if es.Len("books") != 2 {
+		t.Errorf("expected the document without an _id skipped, got %d documents", es.Len("books"))
+	}
+	for _, item := range es.Calls(estest.APIBulk)[0].BulkItems() {
+		if item.Routing != "" {
+			t.Errorf("%s: expected no routing, got %q", item.ID, item.Routing)
+		}
+	}
+}
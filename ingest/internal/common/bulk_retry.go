@@ -0,0 +1,335 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Per-item retry bounds for bulk index requests. Variables so tests can
+// shorten them.
+var (
+	bulkRetryMax       = 4                      // retries beyond the first attempt
+	bulkRetryBaseDelay = 250 * time.Millisecond // base delay for exponential backoff
+)
+
+// BulkResult accounts for the documents of one bulk index call
+type BulkResult struct {
+	Submitted int      // Documents sent, excluding any skipped as invalid
+	Processed int      // Documents Elasticsearch accepted, including on retry
+	Failed    int      // Documents rejected, or still throttled after the last retry
+	Retried   int      // Document resubmissions across all retries
+	Skipped   int      // Documents already indexed, left as they are in create-only mode
+	Stale     int      // Documents older than the indexed version, left as they are (see Versioned)
+	FailedIDs []string // _id of every failed document
+}
+
+// AsBulkResult returns the accounting carried by an error from a bulk index
+// function. ok is false when no document's outcome is known, e.g. when the
+// request itself failed.
+func AsBulkResult(err error) (BulkResult, bool) {
+	var itemsErr *BulkItemsError
+	if errors.As(err, &itemsErr) {
+		return itemsErr.BulkResult, true
+	}
+	return BulkResult{}, false
+}
+
+// isRetryableBulkItem reports whether an item failed because the cluster was
+// overloaded rather than because of the document
+func isRetryableBulkItem(item bulkItemResult) bool {
+	if item.Status == http.StatusTooManyRequests {
+		return true
+	}
+	return item.Error != nil && item.Error.Type == "es_rejected_execution_exception"
+}
+
+// bulkIndexMeta is the metadata of a bulk index or create item
+type bulkIndexMeta struct {
+	Index       string `json:"_index"`
+	ID          string `json:"_id"`
+	Routing     string `json:"routing,omitempty"`
+	Version     int64  `json:"version,omitempty"`
+	VersionType string `json:"version_type,omitempty"`
+}
+
+// externalVersionType is the version type of versioned bulk items. A write
+// with the same version as the indexed document succeeds, so retries and
+// replays of one event are idempotent; only older events are rejected.
+const externalVersionType = "external_gte"
+
+// SetCreateOnly makes bulk index functions index with op_type=create, so
+// replays and backfills never overwrite a document that is already indexed,
+// along with whatever was added to it since (e.g. like_count). Items that
+// conflict with an existing document are counted as skipped rather than
+// failed.
+func (l *IngestLogger) SetCreateOnly(createOnly bool) {
+	l.createOnly = createOnly
+}
+
+// bulkIndexOp returns the bulk action bulk index functions send
+func (l *IngestLogger) bulkIndexOp() string {
+	if l.createOnly {
+		return "create"
+	}
+	return "index"
+}
+
+// isVersionConflict reports whether an item failed because its document
+// already exists (for creates) or has a newer version (for versioned items)
+func isVersionConflict(item bulkItemResult) bool {
+	return item.Status == http.StatusConflict && item.Error != nil && item.Error.Type == "version_conflict_engine_exception"
+}
+
+// submitBulkIndex indexes docs with the bulk API. Items rejected for
+// overload are resubmitted alone with jittered exponential backoff; all
+// other failures, and items still rejected after bulkRetryMax retries, are
+// dead-lettered and reported as a *BulkItemsError. In create-only mode (see
+// SetCreateOnly) documents that already exist are skipped; otherwise
+// versioned documents older than the indexed version are counted as stale
+// and left as they are. A request rejected as a
+// whole for its content is bisected so only the documents that cause the
+// rejection fail. metric prefixes the duration and took metrics; kind (e.g.
+// "like") names the documents in errors and logs.
+func submitBulkIndex(ctx context.Context, client *elasticsearch.Client, docs []DeadLetter, metric, kind string, logger *IngestLogger) (err error) {
+	ctx, span := StartSpan(ctx, "es.bulk_index",
+		attribute.String("ingex.bulk.metric", metric),
+		attribute.Int("ingex.bulk.docs", len(docs)),
+	)
+	defer func() { EndSpan(span, err) }()
+
+	label := "bulk"
+	if kind != "" {
+		label += " " + kind
+	}
+	op := logger.bulkIndexOp()
+
+	result := BulkResult{Submitted: len(docs)}
+	var rejected []DeadLetter
+	pending := docs
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			delay := bulkRetryBaseDelay * (1 << (attempt - 1))
+			jitter := time.Duration(rand.Int63n(int64(delay) + 1)) //nolint:gosec // G404: jitter does not need crypto randomness
+			select {
+			case <-ctx.Done():
+				rejected = append(rejected, withBulkError(pending, ctx.Err())...)
+				pending = nil
+				continue
+			case <-time.After(delay + jitter):
+			}
+			result.Retried += len(pending)
+			logger.Metric("es.bulk_retried_count", float64(len(pending)))
+			logger.Debug("Retrying %d throttled %s items (attempt %d)", len(pending), label, attempt+1)
+		}
+
+		items, err := sendBulkIndex(ctx, client, pending, op, metric, label, logger)
+		if reqErr := isolatableRequestError(err); reqErr != nil {
+			items, err = bisectBulkIndex(ctx, client, pending, op, metric, label, logger, reqErr), nil
+		}
+		if err != nil {
+			if result.Processed > 0 || len(rejected) > 0 {
+				// Earlier attempts settled some documents; do not report them as unknown
+				rejected = append(rejected, withBulkError(pending, err)...)
+				break
+			}
+			return err
+		}
+
+		var retry []DeadLetter
+		for i, doc := range pending {
+			var outcome bulkItemResult
+			if i < len(items) {
+				for _, r := range items[i] {
+					outcome = r
+				}
+			}
+			if outcome.Error == nil {
+				result.Processed++
+				continue
+			}
+			if op == "create" && isVersionConflict(outcome) {
+				result.Skipped++
+				continue
+			}
+			if doc.Version > 0 && isVersionConflict(outcome) {
+				result.Stale++
+				continue
+			}
+			doc.Status = outcome.Status
+			doc.ErrorType = outcome.Error.Type
+			doc.ErrorReason = outcome.Error.Reason
+			if isRetryableBulkItem(outcome) && attempt < bulkRetryMax {
+				retry = append(retry, doc)
+			} else {
+				rejected = append(rejected, doc)
+			}
+		}
+		pending = retry
+	}
+	logger.Metric("es.bulk_items_count", float64(len(docs)))
+	if result.Skipped > 0 {
+		logger.Metric("es.bulk_create_conflict_count", float64(result.Skipped))
+		logger.Debug("Skipped %d %s documents that were already indexed", result.Skipped, label)
+	}
+	if result.Stale > 0 {
+		logger.Metric("es.bulk_stale_count", float64(result.Stale))
+		logger.Debug("Skipped %d %s documents older than the indexed version", result.Stale, label)
+	}
+	span.SetAttributes(
+		attribute.Int("ingex.bulk.retried", result.Retried),
+		attribute.Int("ingex.bulk.rejected", len(rejected)),
+	)
+
+	if len(rejected) == 0 {
+		return nil
+	}
+
+	failedAt := time.Now().UTC().Format(time.RFC3339)
+	summaries := make([]string, 0, len(rejected))
+	for i := range rejected {
+		rejected[i].FailedAt = failedAt
+		result.FailedIDs = append(result.FailedIDs, rejected[i].ID)
+		summaries = append(summaries, fmt.Sprintf("%s (%d %s: %s)", rejected[i].ID, rejected[i].Status, rejected[i].ErrorType, rejected[i].ErrorReason))
+	}
+	result.Failed = len(rejected)
+	logger.Error("%s%s indexing failed for %d of %d documents: %s", strings.ToUpper(label[:1]), label[1:], len(rejected), len(docs), strings.Join(summaries, "; "))
+
+	itemsErr := logger.deadLetter(ctx, rejected)
+	itemsErr.BulkResult = result
+	return fmt.Errorf("%s indexing failed: %w", label, itemsErr)
+}
+
+// withBulkError records err as the failure of docs that never got an item result
+func withBulkError(docs []DeadLetter, err error) []DeadLetter {
+	failed := make([]DeadLetter, len(docs))
+	for i, doc := range docs {
+		doc.ErrorType = "request_failed"
+		doc.ErrorReason = err.Error()
+		failed[i] = doc
+	}
+	return failed
+}
+
+// bulkRequestError is an error response to a whole bulk request
+type bulkRequestError struct {
+	status int
+	msg    string
+}
+
+func (e *bulkRequestError) Error() string {
+	return e.msg
+}
+
+// isolatableRequestError returns err if it rejected a bulk request for its
+// content, e.g. a document that breaks parsing of the request body, so that
+// a subset of the documents may succeed; otherwise nil. Overload and server
+// errors are not isolatable.
+func isolatableRequestError(err error) *bulkRequestError {
+	var reqErr *bulkRequestError
+	if errors.As(err, &reqErr) && reqErr.status >= 400 && reqErr.status < 500 && reqErr.status != http.StatusTooManyRequests {
+		return reqErr
+	}
+	return nil
+}
+
+// bisectBulkIndex resubmits docs, rejected as a whole by reqErr, in halves
+// until the documents responsible are isolated. It returns item results in
+// the order of docs: those of the requests that succeeded, and a failure for
+// each isolated document and each document whose request failed outright.
+func bisectBulkIndex(ctx context.Context, client *elasticsearch.Client, docs []DeadLetter, op, metric, label string, logger *IngestLogger, reqErr *bulkRequestError) []map[string]bulkItemResult {
+	if len(docs) == 1 {
+		logger.Metric("es.bulk_isolated_count", 1)
+		logger.Error("Isolated %s document %s that fails its request: %v", label, docs[0].ID, reqErr)
+		return []map[string]bulkItemResult{{op: {Status: reqErr.status, Error: &bulkItemError{Type: "request_rejected", Reason: reqErr.msg}}}}
+	}
+
+	logger.Debug("Bisecting %d %s documents after request error: %v", len(docs), label, reqErr)
+	items := make([]map[string]bulkItemResult, 0, len(docs))
+	mid := len(docs) / 2
+	for _, half := range [][]DeadLetter{docs[:mid], docs[mid:]} {
+		halfItems, err := sendBulkIndex(ctx, client, half, op, metric, label, logger)
+		if halfErr := isolatableRequestError(err); halfErr != nil {
+			halfItems = bisectBulkIndex(ctx, client, half, op, metric, label, logger, halfErr)
+		} else if err != nil {
+			halfItems = make([]map[string]bulkItemResult, len(half))
+			for i := range halfItems {
+				halfItems[i] = map[string]bulkItemResult{op: {Error: &bulkItemError{Type: "request_failed", Reason: err.Error()}}}
+			}
+		}
+		items = append(items, halfItems...)
+	}
+	return items
+}
+
+// bulkIndexBody returns the bulk request body indexing docs with op,
+// "index" or "create". Versioned documents are indexed with their external
+// version; creates only support internal versioning, so they send none.
+func bulkIndexBody(docs []DeadLetter, op string) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, doc := range docs {
+		meta := bulkIndexMeta{Index: doc.Index, ID: doc.ID, Routing: doc.Routing}
+		if op == "index" && doc.Version > 0 {
+			meta.Version, meta.VersionType = doc.Version, externalVersionType
+		}
+		action := map[string]bulkIndexMeta{op: meta}
+		actionJSON, err := json.Marshal(action)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal metadata: %w", err)
+		}
+		buf.Write(actionJSON)
+		buf.WriteByte('\n')
+		buf.Write(doc.Source)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// sendBulkIndex sends one bulk request for docs and returns its items, in
+// request order
+func sendBulkIndex(ctx context.Context, client *elasticsearch.Client, docs []DeadLetter, op, metric, label string, logger *IngestLogger) ([]map[string]bulkItemResult, error) {
+	body, err := bulkIndexBody(docs, op)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	res, err := client.Bulk(
+		bytes.NewReader(body),
+		client.Bulk.WithContext(ctx),
+	)
+	logger.Metric(metric+".duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("%s request failed: %w", label, err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			logger.Error("Failed to close response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		return nil, &bulkRequestError{status: res.StatusCode, msg: fmt.Sprintf("%s request returned error: %s", label, res.String())}
+	}
+
+	var bulkResponse struct {
+		Took   int                         `json:"took"`
+		Errors bool                        `json:"errors"`
+		Items  []map[string]bulkItemResult `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&bulkResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse %s response: %w", label, err)
+	}
+	logger.Metric(metric+".took_ms", float64(bulkResponse.Took))
+
+	return bulkResponse.Items, nil
+}
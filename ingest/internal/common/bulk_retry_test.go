@@ -0,0 +1,313 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func shortenBulkRetry(t *testing.T, retries int) {
+	t.Helper()
+	maxRetries, baseDelay := bulkRetryMax, bulkRetryBaseDelay
+	bulkRetryMax, bulkRetryBaseDelay = retries, time.Millisecond
+	t.Cleanup(func() { bulkRetryMax, bulkRetryBaseDelay = maxRetries, baseDelay })
+}
+
+func TestBulkIndexLikes_RetriesOnlyThrottledItems(t *testing.T) {
+	shortenBulkRetry(t, 3)
+
+	es := estest.New(t)
+	es.FailItems(func(item estest.BulkItem) *estest.ItemFailure {
+		switch {
+		case item.ID == "at://b" && item.Attempt == 1:
+			return &estest.ItemFailure{Status: http.StatusTooManyRequests, Type: "es_rejected_execution_exception", Reason: "rejected execution"}
+		case item.ID == "at://c":
+			return &estest.ItemFailure{Status: http.StatusBadRequest, Type: "mapper_parsing_exception", Reason: "bad field"}
+		}
+		return nil
+	})
+
+	docs := []LikeDoc{
+		{AtURI: "at://a", AuthorDID: "did:plc:a"},
+		{AtURI: "at://b", AuthorDID: "did:plc:b"},
+		{AtURI: "at://c", AuthorDID: "did:plc:c"},
+	}
+	err := BulkIndexLikes(context.Background(), es.Client, "likes-write", docs, false, NewLogger(false))
+
+	requests := es.Calls(estest.APIBulk)
+	if len(requests) != 2 || strings.Join(requests[1].BulkIDs(), ",") != "at://b" {
+		t.Fatalf("expected only at://b to be retried, got requests %v", requests)
+	}
+	result, ok := AsBulkResult(err)
+	if !ok {
+		t.Fatalf("expected a bulk result, got %v", err)
+	}
+	if result.Submitted != 3 || result.Processed != 2 || result.Failed != 1 || result.Retried != 1 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if len(result.FailedIDs) != 1 || result.FailedIDs[0] != "at://c" {
+		t.Errorf("expected at://c to fail, got %v", result.FailedIDs)
+	}
+	if es.Len("likes-write") != 2 {
+		t.Errorf("expected at://a and at://b indexed, got %d likes", es.Len("likes-write"))
+	}
+}
+
+func TestBulkIndex_GivesUpAfterMaxRetries(t *testing.T) {
+	shortenBulkRetry(t, 2)
+
+	es := estest.New(t)
+	es.FailItems(func(estest.BulkItem) *estest.ItemFailure {
+		return &estest.ItemFailure{Status: http.StatusTooManyRequests, Type: "circuit_breaking_exception", Reason: "too many requests"}
+	})
+
+	err := BulkIndex(context.Background(), es.Client, "posts-write", []RawDoc{{AtURI: "at://a", Source: []byte(`{}`)}}, false, NewLogger(false))
+	if attempts := len(es.Calls(estest.APIBulk)); attempts != 3 {
+		t.Errorf("expected 1 attempt and 2 retries, got %d requests", attempts)
+	}
+	result, ok := AsBulkResult(err)
+	if !ok || result.Failed != 1 || result.Processed != 0 || result.Retried != 2 {
+		t.Errorf("unexpected result %+v (%v)", result, err)
+	}
+}
+
+func TestBulkIndex_CreateOnlySkipsExistingDocuments(t *testing.T) {
+	es := estest.New(t)
+	es.Put("posts-write", "at://a", map[string]interface{}{"content": "a", "like_count": 7})
+	es.FailItems(func(item estest.BulkItem) *estest.ItemFailure {
+		if item.ID == "at://c" {
+			return &estest.ItemFailure{Status: http.StatusBadRequest, Type: "mapper_parsing_exception", Reason: "bad field"}
+		}
+		return nil
+	})
+
+	mc := newMockMetricCollector()
+	logger := NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(mc)
+	logger.SetCreateOnly(true)
+	docs := []RawDoc{
+		{AtURI: "at://a", Source: []byte(`{"content":"a"}`)},
+		{AtURI: "at://b", Source: []byte(`{"content":"b"}`)},
+		{AtURI: "at://c", Source: []byte(`{"content":"c"}`)},
+	}
+	err := BulkIndex(context.Background(), es.Client, "posts-write", docs, false, logger)
+
+	result, ok := AsBulkResult(err)
+	if !ok || result.Processed != 1 || result.Skipped != 1 || result.Failed != 1 {
+		t.Errorf("expected the conflict skipped and only the bad document failed, got %+v (%v)", result, err)
+	}
+	if doc, _ := es.Get("posts-write", "at://a"); doc["like_count"] != 7.0 {
+		t.Errorf("expected the existing document left as it was, got %v", doc)
+	}
+	if _, ok := es.Get("posts-write", "at://b"); !ok {
+		t.Error("expected the new document created")
+	}
+	for _, item := range es.Calls(estest.APIBulk)[0].BulkItems() {
+		if item.Action != "create" {
+			t.Errorf("expected create actions, got %s", item.Action)
+		}
+	}
+	if got := mc.getRecords("es.bulk_create_conflict_count"); len(got) != 1 || got[0] != 1 {
+		t.Errorf("expected one conflict counted, got %v", got)
+	}
+}
+
+func TestAsBulkResult_RequestErrorsCarryNoResult(t *testing.T) {
+	es := estest.New(t)
+	es.Handle(estest.APIBulk, func(estest.Call) *estest.Response {
+		return &estest.Response{Status: http.StatusServiceUnavailable, Body: `{"error":"unavailable"}`}
+	})
+
+	err := BulkIndexLikes(context.Background(), es.Client, "likes-write", []LikeDoc{{AtURI: "at://a"}}, false, NewLogger(false))
+	if err == nil || !strings.Contains(err.Error(), "bulk like request returned error") {
+		t.Fatalf("expected the request error, got %v", err)
+	}
+	if _, ok := AsBulkResult(err); ok {
+		t.Error("a failed request must not report per-document outcomes")
+	}
+}
+
+func TestBulkIndex_BisectsToIsolatePoisonDocument(t *testing.T) {
+	es := estest.New(t)
+	es.Handle(estest.APIBulk, func(call estest.Call) *estest.Response {
+		if bytes.Contains(call.Body, []byte(`"at://poison"`)) {
+			return &estest.Response{Status: http.StatusBadRequest, Body: `{"error":{"type":"x_content_parse_exception","reason":"bad document"}}`}
+		}
+		return nil
+	})
+
+	docs := []RawDoc{
+		{AtURI: "at://a", Source: []byte(`{}`)},
+		{AtURI: "at://b", Source: []byte(`{}`)},
+		{AtURI: "at://poison", Source: []byte(`{}`)},
+		{AtURI: "at://c", Source: []byte(`{}`)},
+	}
+	err := BulkIndex(context.Background(), es.Client, "posts-write", docs, false, NewLogger(false))
+
+	result, ok := AsBulkResult(err)
+	if !ok {
+		t.Fatalf("expected a bulk result, got %v", err)
+	}
+	if result.Submitted != 4 || result.Processed != 3 || result.Failed != 1 || result.Retried != 0 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if len(result.FailedIDs) != 1 || result.FailedIDs[0] != "at://poison" {
+		t.Errorf("expected only the poison document to fail, got %v", result.FailedIDs)
+	}
+	// The whole batch, both halves, then both quarters of the failing half
+	if requests := len(es.Calls(estest.APIBulk)); requests != 5 {
+		t.Errorf("expected 5 requests, got %d", requests)
+	}
+	if es.Len("posts-write") != 3 {
+		t.Errorf("expected the other documents indexed, got %d", es.Len("posts-write"))
+	}
+}
+
+// benchmarkPostDoc returns a post document carrying an embedding from each
+// model, at that model's dimension
+func benchmarkPostDoc(i int) PostDoc {
+	rng := rand.New(rand.NewSource(int64(i)))
+	embedding := func(dims int) Float32Array {
+		v := make(Float32Array, dims)
+		for j := range v {
+			v[j] = rng.Float32()*2 - 1
+		}
+		return v
+	}
+	return PostDoc{
+		AtURI:     fmt.Sprintf("at://did:plc:abcdefghijklmnopqrstuvwx/app.bsky.feed.post/%d", i),
+		AuthorDID: "did:plc:abcdefghijklmnopqrstuvwx",
+		Content:   "Watching the sunrise over the bay this morning, with coffee and no notifications",
+		CreatedAt: "2025-11-26T19:04:43Z",
+		IndexedAt: "2025-11-26T19:04:44Z",
+		Embeddings: map[string]Float32Array{
+			"all_MiniLM_L12_v2":          embedding(384),
+			"all_MiniLM_L6_v2":           embedding(384),
+			"google_embeddinggemma_300m": embedding(768),
+		},
+	}
+}
+
+// Marshaling embeddings is most of the cost of indexing a post
+func BenchmarkMarshalPostDoc(b *testing.B) {
+	doc := benchmarkPostDoc(0)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(doc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBulkIndexBody(b *testing.B) {
+	docs := make([]DeadLetter, 500)
+	size := 0
+	for i := range docs {
+		doc := benchmarkPostDoc(i)
+		source, err := json.Marshal(doc)
+		if err != nil {
+			b.Fatal(err)
+		}
+		docs[i] = DeadLetter{Index: "posts-write", ID: doc.AtURI, Routing: doc.AuthorDID, Source: source}
+		size += len(source)
+	}
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := bulkIndexBody(docs, "index"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestBulkIndex_ExternalVersionsRejectOlderEvents(t *testing.T) {
+	es := estest.New(t)
+	mc := newMockMetricCollector()
+	logger := NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(mc)
+
+	edited := []PostDoc{{AtURI: "at://a", AuthorDID: "did:plc:a", Content: "edited", Version: 2000}}
+	if err := BulkIndex(context.Background(), es.Client, "posts-write", edited, false, logger); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The original post, re-ingested from an older file, and a post never
+	// indexed before
+	replayed := []PostDoc{
+		{AtURI: "at://a", AuthorDID: "did:plc:a", Content: "original", Version: 1000},
+		{AtURI: "at://b", AuthorDID: "did:plc:b", Content: "new", Version: 1000},
+	}
+	if err := BulkIndex(context.Background(), es.Client, "posts-write", replayed, false, logger); err != nil {
+		t.Fatalf("expected the stale document skipped, not failed: %v", err)
+	}
+	if doc, _ := es.Get("posts-write", "at://a"); doc["content"] != "edited" {
+		t.Errorf("expected the newer edit kept, got %v", doc)
+	}
+	if _, ok := es.Get("posts-write", "at://b"); !ok {
+		t.Error("expected the new document indexed")
+	}
+	if got := mc.getRecords("es.bulk_stale_count"); len(got) != 1 || got[0] != 1 {
+		t.Errorf("expected 1 stale document counted, got %v", got)
+	}
+
+	// Replaying the same event again is idempotent
+	if err := BulkIndex(context.Background(), es.Client, "posts-write", edited, false, logger); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, item := range es.Calls(estest.APIBulk)[2].BulkItems() {
+		if item.Version != 2000 || item.VersionType != "external_gte" {
+			t.Errorf("expected the event time as an external version, got %d %q", item.Version, item.VersionType)
+		}
+	}
+	if got := mc.getRecords("es.bulk_stale_count"); len(got) != 1 {
+		t.Errorf("expected the replay of the same event accepted, got stale counts %v", got)
+	}
+
+	// Create-only mode sends no version
+	logger.SetCreateOnly(true)
+	if err := BulkIndex(context.Background(), es.Client, "posts-write", replayed[1:], false, logger); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if item := es.Calls(estest.APIBulk)[3].BulkItems()[0]; item.Version != 0 || item.VersionType != "" {
+		t.Errorf("expected an unversioned create, got %d %q", item.Version, item.VersionType)
+	}
+}
+
+func TestBulkDelete_ExternalVersionsRejectOlderDeletes(t *testing.T) {
+	es := estest.New(t)
+	logger := NewLogger(false)
+	docs := []PostDoc{
+		{AtURI: "at://a", AuthorDID: "did:plc:a", Version: 2000},
+		{AtURI: "at://b", AuthorDID: "did:plc:b", Version: 2000},
+	}
+	if err := BulkIndex(context.Background(), es.Client, "posts-write", docs, false, logger); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deletes := []DeleteDoc{
+		{DocID: "at://a", AuthorDID: "did:plc:a", Version: 1000}, // Older than the indexed post
+		{DocID: "at://b", AuthorDID: "did:plc:b", Version: 3000},
+		{DocID: "at://missing", AuthorDID: "did:plc:c", Version: 3000},
+	}
+	if err := BulkDelete(context.Background(), es.Client, "posts-write", deletes, false, logger); err != nil {
+		t.Fatalf("expected the stale delete skipped, not failed: %v", err)
+	}
+	if _, ok := es.Get("posts-write", "at://a"); !ok {
+		t.Error("expected the post newer than its delete kept")
+	}
+	if _, ok := es.Get("posts-write", "at://b"); ok {
+		t.Error("expected the post deleted")
+	}
+}
@@ -0,0 +1,483 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// bulkTuningMetaKey is the key in an index's mapping _meta under which a
+// tuned index records the settings to restore
+const bulkTuningMetaKey = "ingest_bulk_tuning"
+
+// BulkTuningConfig is the index settings bulk-heavy jobs (backfills,
+// reindexes, recounts) apply to the indices they write while they run.
+// Settings are per alias, so e.g. posts can stop refreshing while replies
+// only refresh less often.
+type BulkTuningConfig struct {
+	RefreshInterval map[string]string // Alias -> index.refresh_interval, e.g. "30s" or "-1"; "*" applies to every alias
+	Replicas        map[string]int    // Alias -> index.number_of_replicas; "*" applies to every alias
+	Lease           time.Duration     // How long tuned settings outlive a job that stops renewing them
+}
+
+// BulkTuningConfigFromConfig parses GE_BULK_REFRESH_INTERVAL and
+// GE_BULK_REPLICAS. Each is a single value for every alias, or
+// comma-separated alias=value pairs.
+func BulkTuningConfigFromConfig(config *Config) (BulkTuningConfig, error) {
+	tuning := BulkTuningConfig{
+		RefreshInterval: map[string]string{},
+		Replicas:        map[string]int{},
+		Lease:           config.BulkTuningLease,
+	}
+	refresh, err := parsePerAlias("GE_BULK_REFRESH_INTERVAL", config.BulkRefreshInterval)
+	if err != nil {
+		return BulkTuningConfig{}, err
+	}
+	for alias, value := range refresh {
+		if value != "-1" {
+			if _, err := time.ParseDuration(value); err != nil {
+				return BulkTuningConfig{}, fmt.Errorf("invalid GE_BULK_REFRESH_INTERVAL %q for %s (expected a duration such as 30s, or -1)", value, alias)
+			}
+		}
+		tuning.RefreshInterval[alias] = value
+	}
+	replicas, err := parsePerAlias("GE_BULK_REPLICAS", config.BulkReplicas)
+	if err != nil {
+		return BulkTuningConfig{}, err
+	}
+	for alias, value := range replicas {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return BulkTuningConfig{}, fmt.Errorf("invalid GE_BULK_REPLICAS %q for %s (expected a non-negative count)", value, alias)
+		}
+		tuning.Replicas[alias] = n
+	}
+	if tuning.Enabled() && tuning.Lease <= 0 {
+		return BulkTuningConfig{}, fmt.Errorf("invalid GE_BULK_TUNING_LEASE %s (must be positive)", tuning.Lease)
+	}
+	return tuning, nil
+}
+
+// parsePerAlias parses "value" as {"*": value}, or "a=x,b=y" as {"a": x, "b": y}
+func parsePerAlias(name, spec string) (map[string]string, error) {
+	values := map[string]string{}
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return values, nil
+	}
+	if !strings.Contains(spec, "=") {
+		values["*"] = spec
+		return values, nil
+	}
+	for _, pair := range strings.Split(spec, ",") {
+		alias, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || alias == "" || value == "" {
+			return nil, fmt.Errorf("invalid %s entry %q (expected alias=value)", name, pair)
+		}
+		values[alias] = value
+	}
+	return values, nil
+}
+
+// Enabled reports whether config changes any setting
+func (c BulkTuningConfig) Enabled() bool {
+	return len(c.RefreshInterval) > 0 || len(c.Replicas) > 0
+}
+
+// settings returns the settings config applies to alias's indices
+func (c BulkTuningConfig) settings(alias string) map[string]interface{} {
+	settings := map[string]interface{}{}
+	if value, ok := c.RefreshInterval[alias]; ok {
+		settings["index.refresh_interval"] = value
+	} else if value, ok := c.RefreshInterval["*"]; ok {
+		settings["index.refresh_interval"] = value
+	}
+	if n, ok := c.Replicas[alias]; ok {
+		settings["index.number_of_replicas"] = n
+	} else if n, ok := c.Replicas["*"]; ok {
+		settings["index.number_of_replicas"] = n
+	}
+	return settings
+}
+
+// bulkTuningRecord is what a tuned index records in its mapping _meta: the
+// job that tuned it, when the tuning lapses unless renewed, and the original
+// settings. A nil setting was unset and is restored to the default.
+type bulkTuningRecord struct {
+	Job              string    `json:"job"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshInterval  *string   `json:"refresh_interval"`
+	NumberOfReplicas *string   `json:"number_of_replicas"`
+}
+
+// BulkTuning is the set of indices a job has tuned, to restore when it ends
+type BulkTuning struct {
+	manager *IndexManager
+	job     string
+	lease   time.Duration
+	indices []string
+}
+
+// BulkTuningIndices returns the indices behind names, for TuneForBulk, each
+// mapped to the alias it is behind. A name that is an index rather than an
+// alias maps to itself.
+func BulkTuningIndices(ctx context.Context, client *elasticsearch.Client, names []string, logger *IngestLogger) (map[string]string, error) {
+	indices := make(map[string]string, len(names))
+	for _, name := range names {
+		behind, err := AliasIndices(ctx, client, name, logger)
+		if err != nil {
+			return nil, err
+		}
+		if len(behind) == 0 {
+			indices[name] = name
+			continue
+		}
+		for index := range behind {
+			indices[index] = name
+		}
+	}
+	return indices, nil
+}
+
+// TuneForBulk applies config's settings to indices (index -> the alias whose
+// settings apply) for job. Each index first records its original settings in
+// its mapping _meta, so that if the job dies without calling Restore,
+// Maintain restores them once the lease lapses. An index already tuned by a
+// job that died keeps the settings it recorded then. Call Renew, or Hold, to
+// keep the lease while the job runs.
+func (m *IndexManager) TuneForBulk(ctx context.Context, job string, indices map[string]string, config BulkTuningConfig) (*BulkTuning, error) {
+	tuning := &BulkTuning{manager: m, job: job, lease: config.Lease}
+	for index, alias := range indices {
+		settings := config.settings(alias)
+		if len(settings) == 0 {
+			continue
+		}
+
+		meta, err := m.mappingMeta(ctx, index)
+		if err != nil {
+			return tuning, err
+		}
+		record, tuned := meta.get()
+		if !tuned {
+			original, err := m.indexSettings(ctx, index)
+			if err != nil {
+				return tuning, err
+			}
+			record = bulkTuningRecord{
+				RefreshInterval:  original["index.refresh_interval"],
+				NumberOfReplicas: original["index.number_of_replicas"],
+			}
+		}
+		record.Job = job
+		record.ExpiresAt = time.Now().Add(config.Lease).UTC()
+		if err := m.putMappingMeta(ctx, index, meta, &record); err != nil {
+			return tuning, err
+		}
+		tuning.indices = append(tuning.indices, index)
+
+		if err := m.putSettings(ctx, index, settings); err != nil {
+			return tuning, err
+		}
+		m.logger.Info("Tuned %s for %s: %v", index, job, settings)
+	}
+	return tuning, nil
+}
+
+// Renew extends the lease on every tuned index every third of the lease
+// until ctx is cancelled
+func (t *BulkTuning) Renew(ctx context.Context) {
+	if t == nil || len(t.indices) == 0 {
+		return
+	}
+	ticker := time.NewTicker(t.lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, index := range t.indices {
+				if err := t.manager.renewTuning(ctx, index, t.lease); err != nil {
+					t.manager.logger.Error("Failed to renew bulk tuning of %s: %v", index, err)
+				}
+			}
+		}
+	}
+}
+
+// Hold renews the lease in the background until the returned stop is
+// called, which restores the original settings. Defer stop as soon as
+// TuneForBulk returns, even with an error, so indices tuned before the error
+// are restored however the job ends.
+func (t *BulkTuning) Hold(ctx context.Context) (stop func()) {
+	renewCtx, stopRenewing := context.WithCancel(ctx)
+	go t.Renew(renewCtx)
+	return func() {
+		stopRenewing()
+		restoreCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		t.Restore(restoreCtx)
+	}
+}
+
+// Restore puts back the original settings of every tuned index. Failures are
+// logged; Maintain retries them once the lease lapses.
+func (t *BulkTuning) Restore(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	for _, index := range t.indices {
+		if err := t.manager.restoreTuning(ctx, index); err != nil {
+			t.manager.logger.Error("Failed to restore settings of %s: %v", index, err)
+			continue
+		}
+		t.manager.logger.Info("Restored settings of %s after %s", index, t.job)
+	}
+}
+
+// RestoreExpiredTuning restores the original settings of indices behind the
+// managed aliases whose bulk tuning lease has lapsed, left by jobs that died
+// before restoring them
+func (m *IndexManager) RestoreExpiredTuning(ctx context.Context) error {
+	for _, alias := range m.aliases {
+		records, err := m.tuningRecords(ctx, alias)
+		if err != nil {
+			return err
+		}
+		for index, record := range records {
+			if time.Now().Before(record.ExpiresAt) {
+				continue
+			}
+			if err := m.restoreTuning(ctx, index); err != nil {
+				return err
+			}
+			m.logger.Info("Restored settings of %s left tuned by %s", index, record.Job)
+			m.logger.Metric("es.index_manager.tuning_expired_count", 1)
+		}
+	}
+	return nil
+}
+
+func (m *IndexManager) renewTuning(ctx context.Context, index string, lease time.Duration) error {
+	meta, err := m.mappingMeta(ctx, index)
+	if err != nil {
+		return err
+	}
+	record, ok := meta.get()
+	if !ok {
+		return fmt.Errorf("%s is no longer tuned", index)
+	}
+	record.ExpiresAt = time.Now().Add(lease).UTC()
+	return m.putMappingMeta(ctx, index, meta, &record)
+}
+
+// restoreTuning puts back index's recorded settings, then drops the record
+func (m *IndexManager) restoreTuning(ctx context.Context, index string) error {
+	meta, err := m.mappingMeta(ctx, index)
+	if err != nil {
+		return err
+	}
+	record, ok := meta.get()
+	if !ok {
+		return nil
+	}
+	if err := m.putSettings(ctx, index, map[string]interface{}{
+		"index.refresh_interval":   record.RefreshInterval,
+		"index.number_of_replicas": record.NumberOfReplicas,
+	}); err != nil {
+		return err
+	}
+	return m.putMappingMeta(ctx, index, meta, nil)
+}
+
+// tuningRecords returns the bulk tuning records of the indices behind alias
+func (m *IndexManager) tuningRecords(ctx context.Context, alias string) (map[string]bulkTuningRecord, error) {
+	res, err := m.client.Indices.GetMapping(
+		m.client.Indices.GetMapping.WithContext(ctx),
+		m.client.Indices.GetMapping.WithIndex(alias),
+		m.client.Indices.GetMapping.WithFilterPath("*.mappings._meta."+bulkTuningMetaKey),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get mappings %s: %w", alias, err)
+	}
+	defer func() {
+		if cerr := res.Body.Close(); cerr != nil {
+			m.logger.Error("Failed to close get-mapping response body: %v", cerr)
+		}
+	}()
+	if res.StatusCode == 404 {
+		return nil, nil
+	}
+	if res.IsError() {
+		bodyBytes, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("get mappings %s: [%d] %s", alias, res.StatusCode, string(bodyBytes))
+	}
+
+	var mappings map[string]struct {
+		Mappings struct {
+			Meta tuningMeta `json:"_meta"`
+		} `json:"mappings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&mappings); err != nil {
+		return nil, fmt.Errorf("decode mappings %s: %w", alias, err)
+	}
+	records := map[string]bulkTuningRecord{}
+	for index, mapping := range mappings {
+		if record, ok := mapping.Mappings.Meta.get(); ok {
+			records[index] = record
+		}
+	}
+	return records, nil
+}
+
+// tuningMeta is an index's mapping _meta
+type tuningMeta map[string]json.RawMessage
+
+// get returns the bulk tuning record in meta, if any
+func (meta tuningMeta) get() (bulkTuningRecord, bool) {
+	raw, ok := meta[bulkTuningMetaKey]
+	if !ok {
+		return bulkTuningRecord{}, false
+	}
+	var record bulkTuningRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		return bulkTuningRecord{}, false
+	}
+	return record, true
+}
+
+// mappingMeta returns index's mapping _meta, with any bulk tuning record
+// decoded under bulkTuningMetaKey and every other entry kept as is
+func (m *IndexManager) mappingMeta(ctx context.Context, index string) (tuningMeta, error) {
+	res, err := m.client.Indices.GetMapping(
+		m.client.Indices.GetMapping.WithContext(ctx),
+		m.client.Indices.GetMapping.WithIndex(index),
+		m.client.Indices.GetMapping.WithFilterPath("*.mappings._meta"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get mapping %s: %w", index, err)
+	}
+	defer func() {
+		if cerr := res.Body.Close(); cerr != nil {
+			m.logger.Error("Failed to close get-mapping response body: %v", cerr)
+		}
+	}()
+	if res.IsError() {
+		bodyBytes, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("get mapping %s: [%d] %s", index, res.StatusCode, string(bodyBytes))
+	}
+
+	var mappings map[string]struct {
+		Mappings struct {
+			Meta tuningMeta `json:"_meta"`
+		} `json:"mappings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&mappings); err != nil {
+		return nil, fmt.Errorf("decode mapping %s: %w", index, err)
+	}
+	meta := tuningMeta{}
+	for _, mapping := range mappings {
+		for key, value := range mapping.Mappings.Meta {
+			meta[key] = value
+		}
+	}
+	return meta, nil
+}
+
+// putMappingMeta writes meta back to index with record as its bulk tuning
+// record, or without one if record is nil. _meta is replaced as a whole, so
+// the other entries read with it are kept.
+func (m *IndexManager) putMappingMeta(ctx context.Context, index string, meta tuningMeta, record *bulkTuningRecord) error {
+	updated := make(map[string]interface{}, len(meta)+1)
+	for key, value := range meta {
+		if key != bulkTuningMetaKey {
+			updated[key] = value
+		}
+	}
+	if record != nil {
+		updated[bulkTuningMetaKey] = record
+	}
+	body, err := json.Marshal(map[string]interface{}{"_meta": updated})
+	if err != nil {
+		return fmt.Errorf("marshal mapping meta: %w", err)
+	}
+
+	res, err := m.client.Indices.PutMapping([]string{index}, bytes.NewReader(body), m.client.Indices.PutMapping.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("put mapping %s: %w", index, err)
+	}
+	defer func() {
+		if cerr := res.Body.Close(); cerr != nil {
+			m.logger.Error("Failed to close put-mapping response body: %v", cerr)
+		}
+	}()
+	if res.IsError() {
+		bodyBytes, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("put mapping %s: [%d] %s", index, res.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
+
+// indexSettings returns index's explicitly set settings, flattened
+func (m *IndexManager) indexSettings(ctx context.Context, index string) (map[string]*string, error) {
+	res, err := m.client.Indices.GetSettings(
+		m.client.Indices.GetSettings.WithContext(ctx),
+		m.client.Indices.GetSettings.WithIndex(index),
+		m.client.Indices.GetSettings.WithFlatSettings(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get settings %s: %w", index, err)
+	}
+	defer func() {
+		if cerr := res.Body.Close(); cerr != nil {
+			m.logger.Error("Failed to close get-settings response body: %v", cerr)
+		}
+	}()
+	if res.IsError() {
+		bodyBytes, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("get settings %s: [%d] %s", index, res.StatusCode, string(bodyBytes))
+	}
+
+	var indices map[string]struct {
+		Settings map[string]*string `json:"settings"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&indices); err != nil {
+		return nil, fmt.Errorf("decode settings %s: %w", index, err)
+	}
+	for _, info := range indices {
+		return info.Settings, nil
+	}
+	return nil, fmt.Errorf("get settings %s: index not found", index)
+}
+
+func (m *IndexManager) putSettings(ctx context.Context, index string, settings map[string]interface{}) error {
+	body, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("marshal settings: %w", err)
+	}
+	res, err := m.client.Indices.PutSettings(
+		bytes.NewReader(body),
+		m.client.Indices.PutSettings.WithContext(ctx),
+		m.client.Indices.PutSettings.WithIndex(index),
+	)
+	if err != nil {
+		return fmt.Errorf("put settings %s: %w", index, err)
+	}
+	defer func() {
+		if cerr := res.Body.Close(); cerr != nil {
+			m.logger.Error("Failed to close put-settings response body: %v", cerr)
+		}
+	}()
+	if res.IsError() {
+		bodyBytes, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("put settings %s: [%d] %s", index, res.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
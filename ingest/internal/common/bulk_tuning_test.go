@@ -0,0 +1,182 @@
+package common
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBulkTuningConfigFromConfig(t *testing.T) {
+	tuning, err := BulkTuningConfigFromConfig(&Config{BulkRefreshInterval: "posts=-1, replies=30s", BulkReplicas: "0", BulkTuningLease: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	posts := tuning.settings("posts")
+	if posts["index.refresh_interval"] != "-1" || posts["index.number_of_replicas"] != 0 {
+		t.Errorf("unexpected posts settings %v", posts)
+	}
+	if tombstones := tuning.settings("post_tombstones"); len(tombstones) != 1 || tombstones["index.number_of_replicas"] != 0 {
+		t.Errorf("expected only the every-alias replicas for post_tombstones, got %v", tombstones)
+	}
+
+	if tuning, err := BulkTuningConfigFromConfig(&Config{}); err != nil || tuning.Enabled() {
+		t.Errorf("expected tuning to be opt-in, got %+v, %v", tuning, err)
+	}
+	for _, config := range []Config{
+		{BulkRefreshInterval: "often", BulkTuningLease: time.Minute},
+		{BulkReplicas: "posts=-1", BulkTuningLease: time.Minute},
+		{BulkReplicas: "posts=0,replies", BulkTuningLease: time.Minute},
+		{BulkReplicas: "0"},
+	} {
+		if _, err := BulkTuningConfigFromConfig(&config); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
+
+// tuningCluster simulates one index, posts-000001 behind posts, recording its
+// mapping _meta and settings
+type tuningCluster struct {
+	mu       sync.Mutex
+	meta     map[string]json.RawMessage
+	settings map[string]interface{}
+}
+
+func (c *tuningCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodGet && (r.URL.Path == "/posts-000001/_mapping" || r.URL.Path == "/posts/_mapping"):
+		if len(c.meta) == 0 {
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"posts-000001": map[string]interface{}{"mappings": map[string]interface{}{"_meta": c.meta}}})
+	case r.Method == http.MethodPut && r.URL.Path == "/posts-000001/_mapping":
+		var mapping struct {
+			Meta map[string]json.RawMessage `json:"_meta"`
+		}
+		_ = json.Unmarshal(body, &mapping)
+		c.meta = mapping.Meta
+		_, _ = w.Write([]byte(`{"acknowledged":true}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/_alias/posts":
+		_, _ = w.Write([]byte(`{"posts-000001":{"aliases":{"posts":{}}}}`))
+	case r.Method == http.MethodGet && r.URL.Path == "/posts-000001/_settings":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"posts-000001": map[string]interface{}{"settings": c.settings}})
+	case r.Method == http.MethodPut && r.URL.Path == "/posts-000001/_settings":
+		var update map[string]interface{}
+		_ = json.Unmarshal(body, &update)
+		for key, value := range update {
+			if value == nil {
+				delete(c.settings, key)
+			} else {
+				c.settings[key] = value
+			}
+		}
+		_, _ = w.Write([]byte(`{"acknowledged":true}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error":"unexpected request","status":404}`))
+	}
+}
+
+func TestIndexManager_TuneForBulk(t *testing.T) {
+	cluster := &tuningCluster{
+		meta:     map[string]json.RawMessage{"owner": json.RawMessage(`"search"`)},
+		settings: map[string]interface{}{"index.number_of_replicas": "1"},
+	}
+	client, srv := newMockESClient(t, cluster)
+	defer srv.Close()
+	manager := NewIndexManager(client, IndexProfile{Environment: "local", Period: IndexPeriod10Min}, []string{"posts"}, NewLogger(false))
+	config := BulkTuningConfig{RefreshInterval: map[string]string{"*": "-1"}, Replicas: map[string]int{"posts": 0}, Lease: time.Minute}
+
+	tuning, err := manager.TuneForBulk(t.Context(), "backfill", map[string]string{"posts-000001": "posts"}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cluster.settings["index.refresh_interval"] != "-1" || cluster.settings["index.number_of_replicas"] != float64(0) {
+		t.Errorf("expected tuned settings, got %v", cluster.settings)
+	}
+	if _, ok := cluster.meta[bulkTuningMetaKey]; !ok || string(cluster.meta["owner"]) != `"search"` {
+		t.Errorf("expected the tuning recorded beside the existing _meta, got %v", cluster.meta)
+	}
+
+	// A second job keeps the settings recorded by the first
+	if _, err := manager.TuneForBulk(t.Context(), "recount", map[string]string{"posts-000001": "posts"}, config); err != nil {
+		t.Fatal(err)
+	}
+
+	tuning.Restore(t.Context())
+	if _, set := cluster.settings["index.refresh_interval"]; set || cluster.settings["index.number_of_replicas"] != "1" {
+		t.Errorf("expected the original settings restored, got %v", cluster.settings)
+	}
+	if _, ok := cluster.meta[bulkTuningMetaKey]; ok || string(cluster.meta["owner"]) != `"search"` {
+		t.Errorf("expected only the tuning record removed, got %v", cluster.meta)
+	}
+}
+
+func TestBulkTuning_Hold(t *testing.T) {
+	cluster := &tuningCluster{settings: map[string]interface{}{"index.refresh_interval": "5s"}}
+	client, srv := newMockESClient(t, cluster)
+	defer srv.Close()
+	logger := NewLogger(false)
+
+	indices, err := BulkTuningIndices(t.Context(), client, []string{"posts", "posts-000002"}, logger)
+	if err != nil || len(indices) != 2 || indices["posts-000001"] != "posts" || indices["posts-000002"] != "posts-000002" {
+		t.Fatalf("expected the alias resolved and the index kept, got %v, %v", indices, err)
+	}
+
+	manager := NewIndexManager(client, IndexProfile{Environment: "local", Period: IndexPeriod10Min}, []string{"posts"}, logger)
+	config := BulkTuningConfig{RefreshInterval: map[string]string{"posts": "-1"}, Lease: time.Minute}
+	tuning, err := manager.TuneForBulk(t.Context(), "repair", map[string]string{"posts-000001": "posts"}, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := tuning.Hold(t.Context())
+	if cluster.settings["index.refresh_interval"] != "-1" {
+		t.Fatalf("expected the refresh interval tuned, got %v", cluster.settings)
+	}
+	stop()
+	if cluster.settings["index.refresh_interval"] != "5s" {
+		t.Errorf("expected stop to restore the refresh interval, got %v", cluster.settings)
+	}
+}
+
+func TestIndexManager_RestoreExpiredTuning(t *testing.T) {
+	cluster := &tuningCluster{settings: map[string]interface{}{"index.refresh_interval": "5s"}}
+	client, srv := newMockESClient(t, cluster)
+	defer srv.Close()
+	manager := NewIndexManager(client, IndexProfile{Environment: "local", Period: IndexPeriod10Min}, []string{"posts"}, NewLogger(false))
+
+	// The job dies without restoring, or renewing its lease
+	config := BulkTuningConfig{RefreshInterval: map[string]string{"posts": "-1"}, Lease: time.Hour}
+	if _, err := manager.TuneForBulk(t.Context(), "backfill", map[string]string{"posts-000001": "posts"}, config); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.RestoreExpiredTuning(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if cluster.settings["index.refresh_interval"] != "-1" {
+		t.Fatalf("expected a live lease to be left alone, got %v", cluster.settings)
+	}
+
+	config.Lease = -time.Second
+	if _, err := manager.TuneForBulk(t.Context(), "backfill", map[string]string{"posts-000001": "posts"}, config); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.RestoreExpiredTuning(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if cluster.settings["index.refresh_interval"] != "5s" {
+		t.Errorf("expected the original refresh interval restored, got %v", cluster.settings)
+	}
+	if _, ok := cluster.meta[bulkTuningMetaKey]; ok {
+		t.Errorf("expected the tuning record removed, got %v", cluster.meta)
+	}
+}
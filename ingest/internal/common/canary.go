@@ -0,0 +1,212 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// CanaryDID authors every synthetic canary record. The .invalid TLD can never
+// resolve, so no real account collides with it.
+const CanaryDID = "did:web:canary.greenearth.invalid"
+
+// canarySubjectURI is the post every canary like points at. It never exists,
+// so canary likes do not change any real post's like_count.
+const canarySubjectURI = "at://" + CanaryDID + "/app.bsky.feed.post/canary"
+
+// IsCanaryDID reports whether did authors synthetic canary records
+func IsCanaryDID(did string) bool {
+	return did == CanaryDID
+}
+
+// NewCanaryLikeEvent returns a Jetstream like-create event from CanaryDID,
+// created at now, and the at_uri it will be indexed under. time_us is zero so
+// processing a canary never advances the Jetstream cursor.
+func NewCanaryLikeEvent(now time.Time) (string, string) {
+	rkey := "canary" + strconv.FormatInt(now.UnixNano(), 36)
+	event := map[string]interface{}{
+		"did":     CanaryDID,
+		"time_us": 0,
+		"kind":    "commit",
+		"commit": map[string]interface{}{
+			"operation":  "create",
+			"collection": "app.bsky.feed.like",
+			"rkey":       rkey,
+			"record": map[string]interface{}{
+				"$type":     "app.bsky.feed.like",
+				"subject":   map[string]interface{}{"uri": canarySubjectURI},
+				"createdAt": now.UTC().Format(time.RFC3339Nano),
+			},
+		},
+	}
+	raw, _ := json.Marshal(event) // Only strings and numbers; cannot fail
+	return string(raw), "at://" + CanaryDID + "/app.bsky.feed.like/" + rkey
+}
+
+// CanaryConfig controls canary injection and the search latency SLO
+type CanaryConfig struct {
+	Interval  time.Duration // How often a canary is injected; 0 disables canaries
+	SearchSLO time.Duration // Injection-to-searchable latency above which a breach is reported
+	Index     string        // Alias the canary becomes searchable in (default "likes")
+}
+
+// Canary injects synthetic like events into an ingest service's message
+// stream and measures how long each takes to become searchable. Latency and
+// SLO breaches are reported as metrics for alerting.
+type Canary struct {
+	client *elasticsearch.Client
+	config CanaryConfig
+	logger *IngestLogger
+	now    func() time.Time
+	poll   time.Duration
+}
+
+// NewCanary creates a canary prober that searches client
+func NewCanary(client *elasticsearch.Client, config CanaryConfig, logger *IngestLogger) *Canary {
+	if config.Index == "" {
+		config.Index = "likes"
+	}
+	if config.SearchSLO <= 0 {
+		config.SearchSLO = time.Minute
+	}
+	return &Canary{client: client, config: config, logger: logger, now: time.Now, poll: time.Second}
+}
+
+// Inject returns a channel carrying every message from in plus a canary
+// event every Interval. It closes when in closes. With canaries disabled, in
+// is returned unchanged.
+func (c *Canary) Inject(ctx context.Context, in <-chan string) <-chan string {
+	if c == nil || c.config.Interval <= 0 {
+		return in
+	}
+	out := make(chan string, cap(in))
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(c.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-in:
+				if !ok {
+					return
+				}
+				select {
+				case out <- msg:
+				case <-ctx.Done():
+					return
+				}
+			case <-ticker.C:
+				injectedAt := c.now()
+				raw, atURI := NewCanaryLikeEvent(injectedAt)
+				select {
+				case out <- raw:
+				case <-ctx.Done():
+					return
+				}
+				c.logger.Metric("canary.injected_count", 1)
+				go c.probe(ctx, atURI, injectedAt)
+			}
+		}
+	}()
+	return out
+}
+
+// probe polls until the canary at atURI is searchable, or until twice the SLO
+// has passed, and reports the latency
+func (c *Canary) probe(ctx context.Context, atURI string, injectedAt time.Time) {
+	deadline := injectedAt.Add(2 * c.config.SearchSLO)
+	ticker := time.NewTicker(c.poll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		found, err := c.searchable(ctx, atURI)
+		if err != nil {
+			c.logger.Debug("Canary search failed for %s: %v", atURI, err)
+		}
+		now := c.now()
+		if found {
+			latency := now.Sub(injectedAt)
+			c.logger.Metric("canary.search_latency_ms", float64(latency.Milliseconds()))
+			if latency > c.config.SearchSLO {
+				c.logger.Error("Canary %s took %s to become searchable (SLO %s)", atURI, latency.Round(time.Millisecond), c.config.SearchSLO)
+				c.logger.Metric("canary.search_slo_breach_count", 1)
+			}
+			return
+		}
+		if now.After(deadline) {
+			c.logger.Error("Canary %s not searchable after %s (SLO %s)", atURI, now.Sub(injectedAt).Round(time.Second), c.config.SearchSLO)
+			c.logger.Metric("canary.search_slo_breach_count", 1)
+			c.logger.Metric("canary.lost_count", 1)
+			return
+		}
+	}
+}
+
+// searchable reports whether a search (not a realtime get) finds atURI
+func (c *Canary) searchable(ctx context.Context, atURI string) (bool, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"size":  0,
+		"query": map[string]interface{}{"term": map[string]interface{}{"at_uri": atURI}},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal canary query: %w", err)
+	}
+	res, err := c.client.Count(
+		c.client.Count.WithContext(ctx),
+		c.client.Count.WithIndex(c.config.Index),
+		c.client.Count.WithBody(bytes.NewReader(body)),
+		c.client.Count.WithRouting(CanaryDID),
+	)
+	if err != nil {
+		return false, fmt.Errorf("canary count request failed: %w", err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			c.logger.Error("Failed to close canary count response body: %v", err)
+		}
+	}()
+	if res.IsError() {
+		return false, fmt.Errorf("canary count returned error: %s", res.String())
+	}
+
+	var response struct {
+		Count int64 `json:"count"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return false, fmt.Errorf("failed to parse canary count response: %w", err)
+	}
+	return response.Count > 0, nil
+}
+
+// ObserveExportedCanaryLikes reports the injection-to-export latency of every
+// canary like in likes, flagging those older than slo. Exporters call it on
+// each batch they write.
+func ObserveExportedCanaryLikes(likes []ExtractLike, now time.Time, slo time.Duration, logger *IngestLogger) {
+	for _, like := range likes {
+		if !IsCanaryDID(like.DID) {
+			continue
+		}
+		createdAt, err := time.Parse(time.RFC3339Nano, like.RecordCreatedAt)
+		if err != nil {
+			continue
+		}
+		latency := now.Sub(createdAt)
+		logger.Metric("canary.export_latency_sec", latency.Seconds())
+		if slo > 0 && latency > slo {
+			logger.Error("Canary like from %s exported %s after injection (SLO %s)", like.RecordCreatedAt, latency.Round(time.Second), slo)
+			logger.Metric("canary.export_slo_breach_count", 1)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewCanaryLikeEvent_ParsesAsLike(t *testing.T) {
+	now := time.Date(2026, 3, 14, 10, 0, 0, 0, time.UTC)
+	raw, atURI := NewCanaryLikeEvent(now)
+
+	msg := NewJetstreamMessage(raw, NewLogger(false))
+	if !msg.IsLike() || msg.GetAtURI() != atURI || !IsCanaryDID(msg.GetAuthorDID()) {
+		t.Fatalf("expected a canary like at %s, got %+v", atURI, msg)
+	}
+	if msg.GetTimeUs() != 0 {
+		t.Errorf("canaries must not move the cursor, got time_us %d", msg.GetTimeUs())
+	}
+	if msg.GetSubjectURI() != canarySubjectURI {
+		t.Errorf("unexpected subject %s", msg.GetSubjectURI())
+	}
+	if _, second := NewCanaryLikeEvent(now.Add(time.Nanosecond)); second == atURI {
+		t.Errorf("canaries injected at different times must have different at_uris")
+	}
+	if !ShouldSampleDID(CanaryDID, "stage") {
+		t.Errorf("canaries must survive stage sampling")
+	}
+}
+
+func TestCanary_InjectAndProbe(t *testing.T) {
+	var counts atomic.Int32
+	client, srv := newMockESClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		if !strings.HasSuffix(r.URL.Path, "/likes/_count") || r.URL.Query().Get("routing") != CanaryDID {
+			t.Errorf("unexpected request %s?%s", r.URL.Path, r.URL.RawQuery)
+		}
+		// Searchable on the second poll
+		if counts.Add(1) < 2 {
+			_, _ = w.Write([]byte(`{"count":0}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"count":1}`))
+	}))
+	defer srv.Close()
+
+	logger := NewLogger(true)
+	mc := newMockMetricCollector()
+	logger.SetMetricCollector(mc)
+
+	canary := NewCanary(client, CanaryConfig{Interval: 20 * time.Millisecond, SearchSLO: time.Hour}, logger)
+	canary.poll = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan string)
+	out := canary.Inject(ctx, in)
+
+	in <- `{"did":"did:plc:real"}`
+	if msg := <-out; msg != `{"did":"did:plc:real"}` {
+		t.Fatalf("expected the real message first, got %s", msg)
+	}
+	select {
+	case msg := <-out:
+		if !strings.Contains(msg, CanaryDID) {
+			t.Fatalf("expected a canary, got %s", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no canary injected")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(mc.getRecords("canary.search_latency_ms")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(mc.getRecords("canary.search_latency_ms")) == 0 {
+		t.Fatal("expected a search latency once the canary was searchable")
+	}
+	if breaches := mc.getRecords("canary.search_slo_breach_count"); len(breaches) != 0 {
+		t.Errorf("unexpected SLO breach %v", breaches)
+	}
+
+	close(in)
+	for range out {
+	}
+}
+
+func TestCanary_InjectDisabledReturnsInput(t *testing.T) {
+	in := make(chan string)
+	canary := NewCanary(nil, CanaryConfig{}, NewLogger(false))
+	if out := canary.Inject(context.Background(), in); out != (<-chan string)(in) {
+		t.Error("disabled canary must not wrap the message channel")
+	}
+}
+
+func TestObserveExportedCanaryLikes(t *testing.T) {
+	logger := NewLogger(true)
+	mc := newMockMetricCollector()
+	logger.SetMetricCollector(mc)
+
+	now := time.Date(2026, 3, 14, 12, 0, 0, 0, time.UTC)
+	ObserveExportedCanaryLikes([]ExtractLike{
+		{DID: "did:plc:real", RecordCreatedAt: "2026-03-14T11:59:00Z"},
+		{DID: CanaryDID, RecordCreatedAt: "2026-03-14T11:30:00Z"},
+		{DID: CanaryDID, RecordCreatedAt: "2026-03-14T09:00:00Z"},
+	}, now, time.Hour, logger)
+
+	latencies := mc.getRecords("canary.export_latency_sec")
+	if len(latencies) != 2 || latencies[0] != 1800 || latencies[1] != 10800 {
+		t.Errorf("unexpected export latencies %v", latencies)
+	}
+	if breaches := mc.getRecords("canary.export_slo_breach_count"); len(breaches) != 1 {
+		t.Errorf("expected one breach, got %v", breaches)
+	}
+}
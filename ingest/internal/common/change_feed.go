@@ -0,0 +1,302 @@
+package common
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	pubsub "google.golang.org/api/pubsub/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Change feed document types and operations
+const (
+	ChangeTypePost  = "post"
+	ChangeTypeReply = "reply"
+	ChangeTypeLike  = "like"
+
+	ChangeOperationIndex  = "index"
+	ChangeOperationDelete = "delete"
+)
+
+// Change feed message encodings, sent as the "encoding" attribute
+const (
+	ChangeEncodingJSON     = "json"
+	ChangeEncodingProtobuf = "protobuf"
+)
+
+// pubSubMaxMessages is the Pub/Sub limit on messages per publish request
+const pubSubMaxMessages = 1000
+
+// ChangeEventErrorType is the error_type of change events saved to the
+// dead-letter queue because they could not be published. Like quarantined
+// rows they have no index, so dlq_replay leaves them in place.
+const ChangeEventErrorType = "change_event_unpublished"
+
+// A failed publish is retried up to changeFeedRetryMax times with
+// exponential backoff from changeFeedRetryDelay. Variables so tests can
+// shorten them.
+var (
+	changeFeedRetryMax   = 3
+	changeFeedRetryDelay = 500 * time.Millisecond
+)
+
+// ChangeEvent is a compact record of a document written to Elasticsearch
+type ChangeEvent struct {
+	AtURI     string `json:"at_uri"`
+	Type      string `json:"type"`
+	Operation string `json:"operation"`
+	IndexedAt string `json:"indexed_at"`
+}
+
+// ChangePublisher delivers change events to a downstream transport
+type ChangePublisher interface {
+	Publish(ctx context.Context, events []ChangeEvent) error
+}
+
+// ChangeFeed publishes change events after successful bulk writes. Publish
+// failures are retried, then the events are saved to the logger's
+// dead-letter queue; they never fail ingestion. A nil ChangeFeed is valid
+// and publishes nothing.
+type ChangeFeed struct {
+	publisher ChangePublisher
+	logger    *IngestLogger
+}
+
+// NewChangeFeed creates a change feed backed by publisher
+func NewChangeFeed(publisher ChangePublisher, logger *IngestLogger) *ChangeFeed {
+	return &ChangeFeed{publisher: publisher, logger: logger}
+}
+
+// NewPubSubChangeFeed creates a change feed publishing to a Pub/Sub topic.
+// Returns nil when topic is empty so callers can pass the result unconditionally.
+func NewPubSubChangeFeed(ctx context.Context, projectID, topic, encoding string, logger *IngestLogger) (*ChangeFeed, error) {
+	if topic == "" {
+		return nil, nil
+	}
+	publisher, err := NewPubSubPublisher(ctx, projectID, topic, encoding)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Change feed enabled (topic: %s, encoding: %s)", publisher.topic, publisher.encoding)
+	return NewChangeFeed(publisher, logger), nil
+}
+
+// Publish sends events to the feed, retrying a failed publish with backoff
+// until ctx is done. Events that still cannot be published are saved to the
+// logger's dead-letter queue, and counted in changefeed.lost_count only when
+// there is no queue or the write to it fails.
+func (f *ChangeFeed) Publish(ctx context.Context, events []ChangeEvent) {
+	if f == nil || len(events) == 0 {
+		return
+	}
+	err := f.publisher.Publish(ctx, events)
+	for attempt := 0; err != nil && attempt < changeFeedRetryMax && ctx.Err() == nil; attempt++ {
+		delay := changeFeedRetryDelay << attempt
+		f.logger.Error("Failed to publish %d change events, retrying in %s (attempt %d of %d): %v", len(events), delay, attempt+2, changeFeedRetryMax+1, err)
+		f.logger.Metric("changefeed.retry_count", 1)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+			err = f.publisher.Publish(ctx, events)
+		}
+	}
+	if err != nil {
+		f.logger.Error("Failed to publish %d change events: %v", len(events), err)
+		f.logger.Metric("changefeed.publish_errors", 1)
+		f.deadLetter(ctx, events, err)
+		return
+	}
+	f.logger.Metric("changefeed.published_count", float64(len(events)))
+}
+
+// deadLetter saves events that could not be published to the logger's
+// dead-letter queue, counting those it cannot save as lost. The write gets
+// its own timeout, since ctx may be done already.
+func (f *ChangeFeed) deadLetter(ctx context.Context, events []ChangeEvent, publishErr error) {
+	queue := f.logger.deadLetters
+	if queue == nil {
+		f.logger.Metric("changefeed.lost_count", float64(len(events)))
+		return
+	}
+	failedAt := time.Now().UTC().Format(time.RFC3339)
+	letters := make([]DeadLetter, len(events))
+	for i, event := range events {
+		source, _ := json.Marshal(event) // A ChangeEvent always marshals
+		letters[i] = DeadLetter{
+			ID:          event.AtURI,
+			ErrorType:   ChangeEventErrorType,
+			ErrorReason: publishErr.Error(),
+			FailedAt:    failedAt,
+			Source:      source,
+		}
+	}
+
+	writeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+	defer cancel()
+	path, err := queue.Write(writeCtx, letters)
+	if err != nil {
+		f.logger.Error("Failed to dead-letter %d change events, losing them: %v", len(events), err)
+		f.logger.Metric("dlq.write_error_count", 1)
+		f.logger.Metric("changefeed.lost_count", float64(len(events)))
+		return
+	}
+	f.logger.Metric("changefeed.dead_lettered_count", float64(len(events)))
+	f.logger.Info("Dead-lettered %d unpublished change events to %s", len(events), path)
+}
+
+// PubSubPublisher publishes change events to a Pub/Sub topic, one JSON- or
+// protobuf-encoded event per message with type and operation as attributes
+// for subscription filters
+type PubSubPublisher struct {
+	topics   *pubsub.ProjectsTopicsService
+	topic    string
+	encoding string
+}
+
+// NewPubSubPublisher creates a publisher using application default credentials
+func NewPubSubPublisher(ctx context.Context, projectID, topic, encoding string) (*PubSubPublisher, error) {
+	if projectID == "" {
+		return nil, fmt.Errorf("GE_GCP_PROJECT_ID is required for the change feed")
+	}
+	if encoding != ChangeEncodingJSON && encoding != ChangeEncodingProtobuf {
+		return nil, fmt.Errorf("unknown change feed encoding %q (want %s or %s)", encoding, ChangeEncodingJSON, ChangeEncodingProtobuf)
+	}
+	service, err := pubsub.NewService(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Pub/Sub client: %w", err)
+	}
+	return &PubSubPublisher{
+		topics:   service.Projects.Topics,
+		topic:    fmt.Sprintf("projects/%s/topics/%s", projectID, topic),
+		encoding: encoding,
+	}, nil
+}
+
+// Publish sends events in chunks of at most 1000 messages
+func (p *PubSubPublisher) Publish(ctx context.Context, events []ChangeEvent) error {
+	for start := 0; start < len(events); start += pubSubMaxMessages {
+		end := min(start+pubSubMaxMessages, len(events))
+		messages, err := pubSubMessages(events[start:end], p.encoding)
+		if err != nil {
+			return err
+		}
+		if _, err := p.topics.Publish(p.topic, &pubsub.PublishRequest{Messages: messages}).Context(ctx).Do(); err != nil {
+			return fmt.Errorf("failed to publish to %s: %w", p.topic, err)
+		}
+	}
+	return nil
+}
+
+func pubSubMessages(events []ChangeEvent, encoding string) ([]*pubsub.PubsubMessage, error) {
+	messages := make([]*pubsub.PubsubMessage, len(events))
+	for i, event := range events {
+		var data []byte
+		if encoding == ChangeEncodingProtobuf {
+			data = event.MarshalProto()
+		} else {
+			var err error
+			if data, err = json.Marshal(event); err != nil {
+				return nil, fmt.Errorf("failed to marshal change event: %w", err)
+			}
+		}
+		messages[i] = &pubsub.PubsubMessage{
+			Data: base64.StdEncoding.EncodeToString(data),
+			Attributes: map[string]string{
+				"type":      event.Type,
+				"operation": event.Operation,
+				"encoding":  encoding,
+			},
+		}
+	}
+	return messages, nil
+}
+
+// MarshalProto encodes the event as a ChangeEvent message (proto/model.proto)
+func (e ChangeEvent) MarshalProto() []byte {
+	var b []byte
+	for _, field := range []struct {
+		num   protowire.Number
+		value string
+	}{{1, e.AtURI}, {2, e.Type}, {3, e.Operation}, {4, e.IndexedAt}} {
+		if field.value != "" {
+			b = protowire.AppendTag(b, field.num, protowire.BytesType)
+			b = protowire.AppendString(b, field.value)
+		}
+	}
+	return b
+}
+
+// UnmarshalChangeEventProto decodes a ChangeEvent message. Unknown fields are
+// skipped.
+func UnmarshalChangeEventProto(b []byte) (ChangeEvent, error) {
+	var e ChangeEvent
+	fields := map[protowire.Number]*string{1: &e.AtURI, 2: &e.Type, 3: &e.Operation, 4: &e.IndexedAt}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return ChangeEvent{}, fmt.Errorf("invalid change event: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+		if dst, ok := fields[num]; ok && typ == protowire.BytesType {
+			var v string
+			v, n = protowire.ConsumeString(b)
+			*dst = v
+		} else {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return ChangeEvent{}, fmt.Errorf("invalid change event: %w", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return e, nil
+}
+
+// PostChangeEvents builds index events for indexed posts
+func PostChangeEvents(docs []PostDoc) []ChangeEvent {
+	events := make([]ChangeEvent, 0, len(docs))
+	for _, doc := range docs {
+		events = append(events, ChangeEvent{AtURI: doc.AtURI, Type: ChangeTypePost, Operation: ChangeOperationIndex, IndexedAt: doc.IndexedAt})
+	}
+	return events
+}
+
+// ReplyChangeEvents builds index events for indexed replies
+func ReplyChangeEvents(docs []ReplyDoc) []ChangeEvent {
+	events := make([]ChangeEvent, 0, len(docs))
+	for _, doc := range docs {
+		events = append(events, ChangeEvent{AtURI: doc.AtURI, Type: ChangeTypeReply, Operation: ChangeOperationIndex, IndexedAt: doc.IndexedAt})
+	}
+	return events
+}
+
+// LikeChangeEvents builds index events for indexed likes
+func LikeChangeEvents(docs []LikeDoc) []ChangeEvent {
+	events := make([]ChangeEvent, 0, len(docs))
+	for _, doc := range docs {
+		events = append(events, ChangeEvent{AtURI: doc.AtURI, Type: ChangeTypeLike, Operation: ChangeOperationIndex, IndexedAt: doc.IndexedAt})
+	}
+	return events
+}
+
+// PostDeleteChangeEvents builds delete events of changeType, ChangeTypePost
+// or ChangeTypeReply, from the tombstones written for deleted posts or replies
+func PostDeleteChangeEvents(tombstones []PostTombstoneDoc, changeType string) []ChangeEvent {
+	events := make([]ChangeEvent, 0, len(tombstones))
+	for _, tombstone := range tombstones {
+		events = append(events, ChangeEvent{AtURI: tombstone.AtURI, Type: changeType, Operation: ChangeOperationDelete, IndexedAt: tombstone.IndexedAt})
+	}
+	return events
+}
+
+// LikeDeleteChangeEvents builds delete events from the tombstones written for deleted likes
+func LikeDeleteChangeEvents(tombstones []LikeTombstoneDoc) []ChangeEvent {
+	events := make([]ChangeEvent, 0, len(tombstones))
+	for _, tombstone := range tombstones {
+		events = append(events, ChangeEvent{AtURI: tombstone.AtURI, Type: ChangeTypeLike, Operation: ChangeOperationDelete, IndexedAt: tombstone.IndexedAt})
+	}
+	return events
+}
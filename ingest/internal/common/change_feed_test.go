@@ -0,0 +1,273 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type fakeChangePublisher struct {
+	published [][]ChangeEvent
+	err       error
+}
+
+func (p *fakeChangePublisher) Publish(ctx context.Context, events []ChangeEvent) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.published = append(p.published, events)
+	return nil
+}
+
+// flakyChangePublisher fails its first failures publishes
+type flakyChangePublisher struct {
+	fakeChangePublisher
+	failures int
+}
+
+func (p *flakyChangePublisher) Publish(ctx context.Context, events []ChangeEvent) error {
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("service unavailable")
+	}
+	return p.fakeChangePublisher.Publish(ctx, events)
+}
+
+func shortenChangeFeedRetries(t *testing.T) {
+	t.Helper()
+	delay := changeFeedRetryDelay
+	changeFeedRetryDelay = time.Millisecond
+	t.Cleanup(func() { changeFeedRetryDelay = delay })
+}
+
+func TestChangeFeed_NilIsNoOp(t *testing.T) {
+	var feed *ChangeFeed
+	feed.Publish(context.Background(), []ChangeEvent{{AtURI: "at://did:plc:a/app.bsky.feed.post/1"}})
+}
+
+func TestChangeFeed_PublishesEvents(t *testing.T) {
+	publisher := &fakeChangePublisher{}
+	feed := NewChangeFeed(publisher, NewLogger(false))
+
+	docs := []PostDoc{
+		{AtURI: "at://did:plc:a/app.bsky.feed.post/1", IndexedAt: "2025-01-01T00:00:00Z"},
+		{AtURI: "at://did:plc:b/app.bsky.feed.post/2", IndexedAt: "2025-01-01T00:00:01Z"},
+	}
+	feed.Publish(context.Background(), PostChangeEvents(docs))
+
+	if len(publisher.published) != 1 {
+		t.Fatalf("expected 1 publish call, got %d", len(publisher.published))
+	}
+	events := publisher.published[0]
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	want := ChangeEvent{AtURI: docs[1].AtURI, Type: ChangeTypePost, Operation: ChangeOperationIndex, IndexedAt: docs[1].IndexedAt}
+	if events[1] != want {
+		t.Errorf("got %+v, want %+v", events[1], want)
+	}
+}
+
+func TestChangeFeed_SkipsEmptyBatch(t *testing.T) {
+	publisher := &fakeChangePublisher{}
+	feed := NewChangeFeed(publisher, NewLogger(false))
+
+	feed.Publish(context.Background(), nil)
+
+	if len(publisher.published) != 0 {
+		t.Errorf("expected no publish calls, got %d", len(publisher.published))
+	}
+}
+
+func TestChangeFeed_PublishErrorIsLogged(t *testing.T) {
+	shortenChangeFeedRetries(t)
+	publisher := &fakeChangePublisher{err: errors.New("topic not found")}
+	logger := NewLogger(true)
+	var buf bytes.Buffer
+	logger.SetOutput(&buf)
+	feed := NewChangeFeed(publisher, logger)
+
+	feed.Publish(context.Background(), LikeChangeEvents([]LikeDoc{{AtURI: "at://did:plc:a/app.bsky.feed.like/1"}}))
+
+	if !strings.Contains(buf.String(), "topic not found") {
+		t.Errorf("expected publish error to be logged, got %q", buf.String())
+	}
+}
+
+func TestChangeFeed_RetriesFailedPublish(t *testing.T) {
+	shortenChangeFeedRetries(t)
+	mc := newMockMetricCollector()
+	logger := NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(mc)
+	publisher := &flakyChangePublisher{failures: 2}
+	feed := NewChangeFeed(publisher, logger)
+
+	feed.Publish(context.Background(), PostChangeEvents([]PostDoc{{AtURI: "at://did:plc:a/app.bsky.feed.post/1"}}))
+
+	if len(publisher.published) != 1 {
+		t.Fatalf("expected the events published on the third attempt, got %d publishes", len(publisher.published))
+	}
+	if got := mc.getRecords("changefeed.retry_count"); len(got) != 2 {
+		t.Errorf("expected 2 retries counted, got %v", got)
+	}
+	if got := mc.getRecords("changefeed.publish_errors"); len(got) != 0 {
+		t.Errorf("expected no publish error counted, got %v", got)
+	}
+}
+
+func TestChangeFeed_DeadLettersUnpublishedEvents(t *testing.T) {
+	shortenChangeFeedRetries(t)
+	mc := newMockMetricCollector()
+	logger := NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(mc)
+	feed := NewChangeFeed(&fakeChangePublisher{err: errors.New("topic not found")}, logger)
+	event := ChangeEvent{AtURI: "at://did:plc:a/app.bsky.feed.post/1", Type: ChangeTypePost, Operation: ChangeOperationDelete, IndexedAt: "2025-01-01T00:00:00Z"}
+
+	// Without a dead-letter queue the events are lost
+	feed.Publish(context.Background(), []ChangeEvent{event})
+	if got := mc.getRecords("changefeed.lost_count"); len(got) != 1 || got[0] != 1 {
+		t.Errorf("expected the event counted lost, got %v", got)
+	}
+
+	queue, err := NewDeadLetterQueue(context.Background(), t.TempDir(), "jetstream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.SetDeadLetterQueue(queue)
+	feed.Publish(context.Background(), []ChangeEvent{event})
+
+	paths, err := queue.List(context.Background())
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected one dead-letter file, got %v (%v)", paths, err)
+	}
+	letters, err := queue.Read(context.Background(), paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || letters[0].Index != "" || letters[0].ID != event.AtURI || letters[0].ErrorType != ChangeEventErrorType {
+		t.Fatalf("unexpected dead letters %+v", letters)
+	}
+	var saved ChangeEvent
+	if err := json.Unmarshal(letters[0].Source, &saved); err != nil || saved != event {
+		t.Errorf("expected the event saved as the source, got %s (%v)", letters[0].Source, err)
+	}
+	if got := mc.getRecords("changefeed.dead_lettered_count"); len(got) != 1 {
+		t.Errorf("expected the dead-lettered event counted, got %v", got)
+	}
+	if got := mc.getRecords("changefeed.lost_count"); len(got) != 1 {
+		t.Errorf("expected no more events counted lost, got %v", got)
+	}
+}
+
+func TestPostDeleteChangeEvents(t *testing.T) {
+	events := PostDeleteChangeEvents([]PostTombstoneDoc{
+		{AtURI: "at://did:plc:a/app.bsky.feed.post/1", IndexedAt: "2025-01-01T00:00:00Z"},
+	}, ChangeTypeReply)
+
+	want := ChangeEvent{AtURI: "at://did:plc:a/app.bsky.feed.post/1", Type: ChangeTypeReply, Operation: ChangeOperationDelete, IndexedAt: "2025-01-01T00:00:00Z"}
+	if len(events) != 1 || events[0] != want {
+		t.Errorf("got %+v, want %+v", events, want)
+	}
+}
+
+func TestLikeDeleteChangeEvents(t *testing.T) {
+	events := LikeDeleteChangeEvents([]LikeTombstoneDoc{
+		{AtURI: "at://did:plc:a/app.bsky.feed.like/1", IndexedAt: "2025-01-01T00:00:00Z"},
+	})
+
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	if events[0].Type != ChangeTypeLike || events[0].Operation != ChangeOperationDelete {
+		t.Errorf("got type=%s operation=%s, want like/delete", events[0].Type, events[0].Operation)
+	}
+}
+
+func TestPubSubMessages(t *testing.T) {
+	event := ChangeEvent{
+		AtURI:     "at://did:plc:a/app.bsky.feed.post/1",
+		Type:      ChangeTypeReply,
+		Operation: ChangeOperationIndex,
+		IndexedAt: "2025-01-01T00:00:00Z",
+	}
+
+	messages, err := pubSubMessages([]ChangeEvent{event}, ChangeEncodingJSON)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+
+	if messages[0].Attributes["type"] != ChangeTypeReply || messages[0].Attributes["operation"] != ChangeOperationIndex {
+		t.Errorf("unexpected attributes: %v", messages[0].Attributes)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(messages[0].Data)
+	if err != nil {
+		t.Fatalf("message data is not base64: %v", err)
+	}
+	var decoded ChangeEvent
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("message data is not a JSON event: %v", err)
+	}
+	if decoded != event {
+		t.Errorf("got %+v, want %+v", decoded, event)
+	}
+}
+
+func TestPubSubMessages_Protobuf(t *testing.T) {
+	event := ChangeEvent{
+		AtURI:     "at://did:plc:a/app.bsky.feed.like/1",
+		Type:      ChangeTypeLike,
+		Operation: ChangeOperationDelete,
+		IndexedAt: "2025-01-01T00:00:00Z",
+	}
+
+	messages, err := pubSubMessages([]ChangeEvent{event}, ChangeEncodingProtobuf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if messages[0].Attributes["encoding"] != ChangeEncodingProtobuf {
+		t.Errorf("unexpected attributes: %v", messages[0].Attributes)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(messages[0].Data)
+	if err != nil {
+		t.Fatalf("message data is not base64: %v", err)
+	}
+	decoded, err := UnmarshalChangeEventProto(data)
+	if err != nil {
+		t.Fatalf("message data is not a protobuf event: %v", err)
+	}
+	if decoded != event {
+		t.Errorf("got %+v, want %+v", decoded, event)
+	}
+}
+
+func TestUnmarshalChangeEventProto_SkipsUnknownFields(t *testing.T) {
+	data := ChangeEvent{AtURI: "at://x", Type: ChangeTypePost}.MarshalProto()
+	data = protowire.AppendTag(data, 9, protowire.VarintType)
+	data = protowire.AppendVarint(data, 42)
+
+	decoded, err := UnmarshalChangeEventProto(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if decoded.AtURI != "at://x" || decoded.Type != ChangeTypePost {
+		t.Errorf("unexpected event %+v", decoded)
+	}
+	if _, err := UnmarshalChangeEventProto(data[:len(data)-1]); err == nil {
+		t.Error("expected truncated data to fail")
+	}
+}
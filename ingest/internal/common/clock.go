@@ -0,0 +1,165 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// Freshness, new cursors, and rewind limits compare event times with the
+// local clock. A VM whose clock drifts makes freshness negative, or puts a
+// cursor in the future, where it skips every file older than it. The
+// process measures its skew against the Elasticsearch cluster's clock (see
+// MonitorClockSkew) and corrects CorrectedNow by it once it exceeds the
+// threshold; event times and cursors ahead of the corrected clock are
+// clamped to it, with a warning.
+var (
+	clockOffsetUs        atomic.Int64 // Cluster clock minus local clock, while beyond the threshold; 0 otherwise
+	clockSkewThresholdUs atomic.Int64 // Skew tolerated before correcting, warning, or clamping
+	clockWarnedUs        atomic.Int64 // When a future event time was last warned about
+)
+
+// clockWarnInterval limits warnings about future event times, which arrive
+// with every batch while the clock is behind
+const clockWarnInterval = time.Minute
+
+func init() {
+	clockSkewThresholdUs.Store((5 * time.Second).Microseconds())
+}
+
+// CorrectedNow returns the local time, corrected by the skew last measured
+// against the Elasticsearch cluster if it exceeded the threshold
+func CorrectedNow() time.Time {
+	return time.Now().Add(time.Duration(clockOffsetUs.Load()) * time.Microsecond)
+}
+
+// clockSkewThreshold returns the skew tolerated before correcting the clock
+func clockSkewThreshold() time.Duration {
+	return time.Duration(clockSkewThresholdUs.Load()) * time.Microsecond
+}
+
+// RecordFreshness records freshness_sec, the lag in seconds between the
+// microsecond event time timeUs and now, and returns it. An event more than
+// the skew threshold in the future means the local clock is behind: it is
+// warned about, counted in clock.future_event_count, and its freshness
+// clamped to 0.
+func RecordFreshness(timeUs int64, logger *IngestLogger) int64 {
+	freshness := CalculateFreshness(timeUs)
+	if ahead := time.Duration(timeUs-CorrectedNow().UnixMicro()) * time.Microsecond; timeUs != 0 && ahead > clockSkewThreshold() {
+		logger.Metric("clock.future_event_count", 1)
+		nowUs := time.Now().UnixMicro()
+		if last := clockWarnedUs.Load(); nowUs-last >= clockWarnInterval.Microseconds() && clockWarnedUs.CompareAndSwap(last, nowUs) {
+			logger.Error("Event time %s is %s ahead of the local clock; the clock may be skewed", time.UnixMicro(timeUs).UTC().Format(time.RFC3339), ahead.Round(time.Millisecond))
+		}
+	}
+	logger.Metric("freshness_sec", float64(freshness))
+	return freshness
+}
+
+// ClampFutureCursor returns cursorUs, or now if the cursor is more than the
+// skew threshold in the future. A cursor written by a clock that ran ahead
+// would otherwise skip every file or event older than it.
+func ClampFutureCursor(cursorUs int64, logger *IngestLogger) int64 {
+	now := CorrectedNow()
+	if ahead := time.Duration(cursorUs-now.UnixMicro()) * time.Microsecond; ahead > clockSkewThreshold() {
+		logger.Error("Cursor %s is %s ahead of the clock, reading from %s instead", time.UnixMicro(cursorUs).UTC().Format(time.RFC3339), ahead.Round(time.Second), now.UTC().Format(time.RFC3339))
+		logger.Metric("clock.future_cursor_count", 1)
+		return now.UnixMicro()
+	}
+	return cursorUs
+}
+
+// MonitorClockSkew measures the local clock's skew against the cluster's
+// clock, then again every GE_CLOCK_SKEW_CHECK_INTERVAL until ctx is done.
+// The first measurement is made before it returns, so that cursors set at
+// startup use the corrected clock. Skew beyond GE_CLOCK_SKEW_THRESHOLD is
+// logged and corrects CorrectedNow; each measurement is recorded in
+// clock.skew_sec, positive when the local clock is behind.
+func MonitorClockSkew(ctx context.Context, client *elasticsearch.Client, config *Config, logger *IngestLogger) {
+	if config.ClockSkewThreshold > 0 {
+		clockSkewThresholdUs.Store(config.ClockSkewThreshold.Microseconds())
+	}
+	checkClockSkew(ctx, client, logger)
+	if config.ClockSkewCheckInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(config.ClockSkewCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				checkClockSkew(ctx, client, logger)
+			}
+		}
+	}()
+}
+
+// checkClockSkew measures the clock skew and corrects CorrectedNow by it if
+// it is beyond the threshold and the measurement's uncertainty
+func checkClockSkew(ctx context.Context, client *elasticsearch.Client, logger *IngestLogger) {
+	skew, uncertainty, err := measureClockSkew(ctx, client)
+	if err != nil {
+		logger.Error("Failed to measure clock skew against Elasticsearch: %v", err)
+		return
+	}
+	logger.Metric("clock.skew_sec", skew.Seconds())
+
+	if skew.Abs() <= clockSkewThreshold()+uncertainty {
+		if clockOffsetUs.Swap(0) != 0 {
+			logger.Info("Local clock is within %s of Elasticsearch's again, no longer correcting it", clockSkewThreshold())
+		}
+		return
+	}
+	direction := "behind"
+	if skew < 0 {
+		direction = "ahead of"
+	}
+	logger.Error("Local clock is %s %s Elasticsearch's; correcting freshness and cursor times by it", skew.Abs().Round(time.Millisecond), direction)
+	clockOffsetUs.Store(skew.Microseconds())
+}
+
+// measureClockSkew returns the cluster's clock minus the local clock, read
+// from _cat/health, and how far off the estimate may be: half the round
+// trip, plus half a second for the cluster's whole-second epoch
+func measureClockSkew(ctx context.Context, client *elasticsearch.Client) (skew, uncertainty time.Duration, err error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	res, err := client.Cat.Health(
+		client.Cat.Health.WithContext(ctx),
+		client.Cat.Health.WithFormat("json"),
+	)
+	rtt := time.Since(start)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.IsError() {
+		return 0, 0, fmt.Errorf("cat health returned %s", res.Status())
+	}
+	var health []struct {
+		Epoch string `json:"epoch"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&health); err != nil {
+		return 0, 0, fmt.Errorf("failed to parse cat health: %w", err)
+	}
+	if len(health) == 0 {
+		return 0, 0, fmt.Errorf("cat health returned no rows")
+	}
+	epoch, err := strconv.ParseInt(health[0].Epoch, 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid cat health epoch %q: %w", health[0].Epoch, err)
+	}
+
+	clusterTime := time.Unix(epoch, 0).Add(500 * time.Millisecond)
+	localTime := start.Add(rtt / 2)
+	return clusterTime.Sub(localTime), rtt/2 + 500*time.Millisecond, nil
+}
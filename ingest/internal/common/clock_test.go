@@ -0,0 +1,107 @@
+package common
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// resetClock restores the process's clock state when the test ends
+func resetClock(t *testing.T) {
+	t.Helper()
+	offset, threshold := clockOffsetUs.Load(), clockSkewThresholdUs.Load()
+	t.Cleanup(func() {
+		clockOffsetUs.Store(offset)
+		clockSkewThresholdUs.Store(threshold)
+		clockWarnedUs.Store(0)
+	})
+}
+
+func TestMonitorClockSkew_CorrectsSkewBeyondThreshold(t *testing.T) {
+	resetClock(t)
+	var clusterOffset time.Duration
+	client, srv := newMockESClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_cat/health" {
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		_, _ = fmt.Fprintf(w, `[{"epoch":"%d","timestamp":"00:00:00","status":"green"}]`, time.Now().Add(clusterOffset).Unix())
+	}))
+	defer srv.Close()
+
+	mc := newMockMetricCollector()
+	logger := NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(mc)
+	config := &Config{ClockSkewThreshold: 5 * time.Second}
+
+	// The local clock is a minute behind the cluster's
+	clusterOffset = time.Minute
+	MonitorClockSkew(t.Context(), client, config, logger)
+	if offset := time.Duration(clockOffsetUs.Load()) * time.Microsecond; offset < 58*time.Second || offset > 62*time.Second {
+		t.Errorf("expected the clock corrected by about a minute, got %s", offset)
+	}
+	if drift := CorrectedNow().Sub(time.Now().Add(time.Minute)); drift.Abs() > 2*time.Second {
+		t.Errorf("expected CorrectedNow a minute ahead of the local clock, off by %s", drift)
+	}
+	if got := mc.getRecords("clock.skew_sec"); len(got) != 1 || got[0] < 58 {
+		t.Errorf("expected clock.skew_sec of about 60, got %v", got)
+	}
+
+	// Skew within the threshold is left alone
+	clusterOffset = 2 * time.Second
+	checkClockSkew(t.Context(), client, logger)
+	if offset := clockOffsetUs.Load(); offset != 0 {
+		t.Errorf("expected no correction within the threshold, got %dus", offset)
+	}
+}
+
+func TestRecordFreshness_ClampsFutureEvents(t *testing.T) {
+	resetClock(t)
+	mc := newMockMetricCollector()
+	logger := NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(mc)
+
+	if got := RecordFreshness(time.Now().Add(-30*time.Second).UnixMicro(), logger); got < 29 || got > 31 {
+		t.Errorf("expected freshness of about 30s, got %d", got)
+	}
+	if got := RecordFreshness(time.Now().Add(time.Minute).UnixMicro(), logger); got != 0 {
+		t.Errorf("expected a future event clamped to 0, got %d", got)
+	}
+	if got := mc.getRecords("clock.future_event_count"); len(got) != 1 {
+		t.Errorf("expected one future event counted, got %v", got)
+	}
+	if got := mc.getRecords("freshness_sec"); len(got) != 2 || got[1] != 0 {
+		t.Errorf("expected freshness_sec recorded for both events, got %v", got)
+	}
+
+	// Once the skew is measured, the same event is no longer in the future
+	clockOffsetUs.Store(time.Minute.Microseconds())
+	RecordFreshness(time.Now().Add(time.Minute).UnixMicro(), logger)
+	if got := mc.getRecords("clock.future_event_count"); len(got) != 1 {
+		t.Errorf("expected the corrected clock to account for the skew, got %v", got)
+	}
+}
+
+func TestClampFutureCursor(t *testing.T) {
+	resetClock(t)
+	logger := NewLogger(false)
+
+	past := time.Now().Add(-time.Hour).UnixMicro()
+	if got := ClampFutureCursor(past, logger); got != past {
+		t.Errorf("expected a past cursor kept, got %d", got)
+	}
+	near := time.Now().Add(2 * time.Second).UnixMicro()
+	if got := ClampFutureCursor(near, logger); got != near {
+		t.Errorf("expected a cursor within the threshold kept, got %d", got)
+	}
+	future := time.Now().Add(time.Hour)
+	got := time.UnixMicro(ClampFutureCursor(future.UnixMicro(), logger))
+	if got.After(time.Now()) || time.Since(got) > time.Second {
+		t.Errorf("expected a future cursor clamped to now, got %s", got)
+	}
+}
@@ -17,7 +17,13 @@ const (
 // Config holds all configuration values for the ingest service
 type Config struct {
 	// WebSocket configuration
-	JetstreamURL string
+	JetstreamURL               string
+	JetstreamWantedCollections string // GE_JETSTREAM_WANTED_COLLECTIONS, comma-separated collections jetstream_ingest subscribes to
+	JetstreamWantedDIDs        string // GE_JETSTREAM_WANTED_DIDS, comma-separated DIDs jetstream_ingest subscribes to; empty subscribes to all
+	JetstreamHandlers          string // GE_JETSTREAM_HANDLERS, comma-separated record handlers jetstream_ingest runs off its one connection
+	JetstreamShardIndex        int    // GE_SHARD_INDEX, which hash range of author DIDs this jetstream_ingest replica ingests
+	JetstreamShardCount        int    // GE_SHARD_COUNT, how many jetstream_ingest replicas split the stream by author DID; 1 is unsharded
+	FirehoseURL                string
 
 	// Elasticsearch configuration
 	ElasticsearchURL           string
@@ -34,8 +40,13 @@ type Config struct {
 	S3SQLiteDBBucket    string
 	S3SQLiteDBPrefix    string
 	SpoolIntervalSec    int
+	SpoolStrategy       string        // GE_SPOOL_STRATEGY, oldest-first, or newest-first to catch up on the freshest files first
+	SpoolCatchUpLag     time.Duration // GE_SPOOL_CATCH_UP_LAG, how far the newest file may be past the cursor before newest-first catch-up starts
 	JetstreamStateFile  string
 	MegastreamStateFile string
+	FirehoseStateFile   string
+	CursorWriteInterval time.Duration // GE_CURSOR_WRITE_INTERVAL, least time between cursor writes to the state file; 0 uses each command's default
+	CursorSyncBatches   int           // GE_CURSOR_SYNC_BATCHES, write the cursor after this many batches even within the interval; 0 disables
 	AWSRegion           string
 	AWSS3AccessKey      string
 	AWSS3SecretKey      string
@@ -46,25 +57,67 @@ type Config struct {
 	// Metric configuration
 	MetricExportIntervalSec int
 
+	// Tracing configuration (see NewTracerProvider)
+	OTLPEndpoint     string  // GE_OTLP_ENDPOINT, OTLP/gRPC collector URL (e.g. http://localhost:4317); empty disables tracing
+	TraceSampleRatio float64 // GE_TRACE_SAMPLE_RATIO, fraction of traces kept
+
 	// GCP configuration
 	GCPProjectID string
 	GCPRegion    string
 	Environment  string
 
 	// Extract/Export configuration
-	ParquetDestination string // Supports local paths (./output) or GCS paths (gs://bucket/path)
+	ParquetDestination string // Supports local paths (./output), GCS paths (gs://bucket/path), or S3 paths (s3://bucket/path)
 	ParquetMaxRecords  int64
 	ExtractFetchSize   int
 	ExtractIndices     string
 
+	// Export server configuration (extract --serve-port)
+	ExportServerAPIKeys   string        // GE_EXPORT_SERVER_API_KEYS, comma-separated bearer tokens /export accepts
+	ExportServerRateLimit int           // GE_EXPORT_SERVER_RATE_LIMIT, /export requests per minute per key
+	ExportServerMaxWindow time.Duration // GE_EXPORT_SERVER_MAX_WINDOW, longest window one /export request may pull
+
 	// Rate limiting / blocklist configuration
 	BlocklistDestination       string // GE_BLOCKLIST_DESTINATION, e.g. gs://bucket/environment
 	LikeRateLimitPerHour       int    // GE_LIKE_RATE_LIMIT_PER_HOUR, default 2000
 	LikeRateLimitWindowMinutes int    // GE_LIKE_RATE_LIMIT_WINDOW_MIN, default 5
 	LikeBlockDurationMinutes   int    // GE_LIKE_BLOCK_DURATION_MIN, default 60
 
-	// Index period configuration
-	IndexPeriod string // GE_INDEX_PERIOD: "week", "hour", or "10min"
+	// Duplicate like suppression (see jetstream_ingest.DedupCache)
+	LikeDedupCacheSize int // GE_LIKE_DEDUP_CACHE_SIZE, recent like at_uris remembered; 0 disables
+
+	// Index period configuration (see IndexProfileFromConfig)
+	IndexPeriod      string // GE_INDEX_PERIOD: "week", "hour", or "10min"; empty uses the environment profile
+	IndexShardBudget int    // GE_INDEX_SHARD_BUDGET; 0 uses the environment profile's budget
+
+	// Index rollover configuration (see RolloverConditions)
+	IndexRollover             bool          // GE_INDEX_ROLLOVER; roll over numbered indices instead of creating dated ones
+	IndexRolloverMaxAge       time.Duration // GE_INDEX_ROLLOVER_MAX_AGE; 0 uses the environment default
+	IndexRolloverMaxShardSize string        // GE_INDEX_ROLLOVER_MAX_SHARD_SIZE, e.g. "50gb"
+	IndexRolloverMaxDocs      int           // GE_INDEX_ROLLOVER_MAX_DOCS; 0 uses the environment default
+
+	// Bulk job index tuning (see BulkTuningConfig)
+	BulkRefreshInterval string        // GE_BULK_REFRESH_INTERVAL, refresh_interval while a bulk job writes, e.g. "30s", "-1", or "posts=-1,replies=30s"; empty leaves it
+	BulkReplicas        string        // GE_BULK_REPLICAS, number_of_replicas while a bulk job writes, e.g. "0" or "posts=0"; empty leaves it
+	BulkTuningLease     time.Duration // GE_BULK_TUNING_LEASE, how long tuned settings outlive a job that dies before restoring them
+
+	// Clock skew (see MonitorClockSkew)
+	ClockSkewThreshold     time.Duration // GE_CLOCK_SKEW_THRESHOLD, skew from the Elasticsearch cluster's clock tolerated before correcting for it
+	ClockSkewCheckInterval time.Duration // GE_CLOCK_SKEW_CHECK_INTERVAL, how often the skew is measured after startup; 0 measures it only at startup
+
+	// Ingest batching (see BatchConfig)
+	BulkMaxDocs  int           // GE_BULK_MAX_DOCS, documents per bulk batch; 0 uses each command's default
+	BulkMaxBytes int           // GE_BULK_MAX_BYTES, estimated payload bytes per bulk batch; 0 disables the size trigger
+	BulkMaxAge   time.Duration // GE_BULK_MAX_AGE, how long a partial batch waits before it is flushed; 0 disables the age trigger
+
+	// Likes routing configuration (see IndexRouter)
+	LikesIndexBucket string        // GE_LIKES_INDEX_BUCKET: "week", "hour", or "10min"; likes are split into one index per bucket of created_at
+	LikesIndexMaxAge time.Duration // GE_LIKES_INDEX_MAX_AGE; likes created longer ago than this are bucketed by when they were indexed
+
+	// Post counter aggregation (see PostCounter)
+	PostCountFlushInterval time.Duration // GE_POST_COUNT_FLUSH_INTERVAL, how long like, reply, and quote count changes are aggregated before they are applied
+	PostCountMaxPosts      int           // GE_POST_COUNT_MAX_POSTS, pending post counter changes that trigger an early flush
+	PostRoutingCacheSize   int           // GE_POST_ROUTING_CACHE_SIZE, posts whose index counter updates remember, so they go to it alone; 0 disables
 
 	// Inference service configuration
 	InferenceBaseURL        string        // GE_INFERENCE_BASE_URL; empty disables post-tower embeddings
@@ -73,12 +126,123 @@ type Config struct {
 	InferenceChunkSize      int           // GE_INFERENCE_CHUNK_SIZE, must be <= server GE_INFERENCE_MAX_BATCH
 	InferenceMaxConcurrency int           // GE_INFERENCE_MAX_CONCURRENCY, concurrent inference requests
 	InferenceRetryMax       int           // GE_INFERENCE_RETRY_MAX, retries beyond the first attempt
+
+	// Sentence embedding service configuration (embedding_backfill)
+	EmbeddingURL      string        // GE_EMBEDDING_URL, endpoint embedding post content, e.g. the MiniLM service's /embed
+	EmbeddingAPIKey   string        // GE_EMBEDDING_API_KEY, sent as X-API-Key when set
+	EmbeddingTimeout  time.Duration // GE_EMBEDDING_TIMEOUT, per-request HTTP timeout
+	EmbeddingRetryMax int           // GE_EMBEDDING_RETRY_MAX, retries beyond the first attempt
+
+	// Recommender configuration
+	RecommenderSeedListPath    string        // GE_RECOMMENDER_SEED_LIST, local path or gs://bucket/object
+	RecommenderTrendingWindow  time.Duration // GE_RECOMMENDER_TRENDING_WINDOW, lookback for trending and exploration candidates; 0 uses the retention policy's hot window
+	RecommenderCursorSecret    string        // GE_RECOMMENDER_CURSOR_SECRET, HMAC key for feed pagination cursors
+	RecommenderRetrievalBudget time.Duration // GE_RECOMMENDER_RETRIEVAL_TIMEOUT, candidate retrieval budget before shrinking the pool
+	RecommenderScoringBudget   time.Duration // GE_RECOMMENDER_SCORING_TIMEOUT, LLM scoring budget before serving retrieval order
+	RecommenderCacheTTL        time.Duration // GE_RECOMMENDER_CACHE_TTL, lifetime of cached slate responses
+	RecommenderCachePoll       time.Duration // GE_RECOMMENDER_CACHE_POLL_INTERVAL, how often new likes invalidate cached slates
+	RecommenderBlockCacheTTL   time.Duration // GE_RECOMMENDER_BLOCK_CACHE_TTL, how long a user's blocks read from the blocks index are kept
+	RecommenderPostFilterPath  string        // GE_RECOMMENDER_POST_FILTERS, slate post-filter rules at a local path or gs://bucket/object; unset serves every scored candidate
+	RecommenderGuardrailsPath  string        // GE_RECOMMENDER_GUARDRAILS, per-experiment-arm account age and activity guardrails at a local path or gs://bucket/object; unset serves every author
+	PLCDirectoryURL            string        // GE_PLC_DIRECTORY_URL, PLC directory account creation times are read from
+	RecommenderShadowWeights   string        // GE_RECOMMENDER_SHADOW_WEIGHTS, JSON engagement weights feed slates are shadow-scored with; empty disables shadow scoring
+	RecommenderShadowSample    float64       // GE_RECOMMENDER_SHADOW_SAMPLE_RATE, fraction of users whose feed slates are shadow-scored
+
+	// Recommender API configuration (recommender_api)
+	RecommenderAPIKeys string        // GE_RECOMMENDER_API_KEYS, comma-separated bearer tokens the API accepts
+	EngagementHalfLife time.Duration // GE_RECOMMENDER_ENGAGEMENT_HALF_LIFE, post age at which the engagement model's recency feature halves
+
+	// LLM scoring configuration (recommender_api)
+	LLMURL       string        // GE_LLM_URL, LLM scoring endpoint; empty disables LLM scoring
+	LLMAPIKey    string        // GE_LLM_API_KEY, sent as X-API-Key when set
+	LLMModel     string        // GE_LLM_MODEL, model name sent with each request; part of the score cache key
+	LLMTimeout   time.Duration // GE_LLM_TIMEOUT, per-request HTTP timeout
+	LLMRetryMax  int           // GE_LLM_RETRY_MAX, retries beyond the first attempt
+	LLMBatchSize int           // GE_LLM_BATCH_SIZE, posts per LLM request
+	LLMRateLimit int           // GE_LLM_RATE_LIMIT, LLM requests per minute; 0 is unlimited
+
+	// Change feed configuration
+	ChangeFeedTopic    string // GE_CHANGE_FEED_TOPIC, Pub/Sub topic ID in GE_GCP_PROJECT_ID; empty disables the change feed
+	ChangeFeedEncoding string // GE_CHANGE_FEED_ENCODING, "json" or "protobuf" (ChangeEvent in proto/model.proto)
+
+	// Change stream configuration
+	ChangeStreamQueriesPath    string        // GE_CHANGE_STREAM_QUERIES, JSON file of stored queries
+	ChangeStreamPollInterval   time.Duration // GE_CHANGE_STREAM_POLL_INTERVAL, how often watched queries are polled
+	ChangeStreamAllowedOrigins string        // GE_CHANGE_STREAM_ALLOWED_ORIGINS, comma-separated browser origins
+
+	// Snapshot configuration
+	SnapshotRepository string // GE_SNAPSHOT_REPOSITORY, Elasticsearch snapshot repository name
+	SnapshotBucket     string // GE_SNAPSHOT_BUCKET, GCS bucket backing the snapshot repository
+
+	// Stage mirror configuration
+	MirrorSourceURL    string // GE_MIRROR_SOURCE_URL, cluster the stage mirror copies from
+	MirrorSourceAPIKey string // GE_MIRROR_SOURCE_API_KEY, read-only key for the source cluster
+	MirrorStateFile    string // GE_MIRROR_STATE_FILE, mirror progress, local path or gs://bucket/object
+	MirrorAllowDIDs    string // GE_MIRROR_ALLOW_DIDS, comma-separated DIDs always mirrored
+
+	// Canary configuration (see Canary)
+	CanaryInterval  time.Duration // GE_CANARY_INTERVAL, how often jetstream_ingest injects a canary like; 0 disables
+	CanarySearchSLO time.Duration // GE_CANARY_SEARCH_SLO, injection-to-searchable latency objective
+	CanaryExportSLO time.Duration // GE_CANARY_EXPORT_SLO, injection-to-export latency objective
+
+	// Dead-letter queue configuration (see DeadLetterQueue)
+	DLQDestination string // GE_DLQ_DESTINATION, local directory or gs://bucket/prefix; empty disables dead-lettering
+
+	// Spill configuration (see Spill)
+	SpillDir            string        // GE_SPILL_DIR, local directory batches are spooled to while Elasticsearch is unavailable; empty disables spilling
+	SpillAfterFailures  int           // GE_SPILL_AFTER_FAILURES, consecutive failed batches before batches go straight to the spool
+	SpillReplayInterval time.Duration // GE_SPILL_REPLAY_INTERVAL, how often Elasticsearch is probed while batches are spooled
+	SpillMaxBytes       int           // GE_SPILL_MAX_BYTES, spool size beyond which batches are dropped; 0 is unlimited
+
+	// Audit configuration (see AuditLog)
+	AuditIndex string // GE_AUDIT_INDEX, index destructive operations are recorded in; empty only logs them
+	AuditActor string // GE_AUDIT_ACTOR, who audit entries are attributed to; defaults to $USER
+
+	// Malformed row handling (see MalformedRows)
+	IngestStrictness  string  // GE_INGEST_STRICTNESS, "skip", "quarantine", or "halt"
+	MalformedHaltRate float64 // GE_MALFORMED_HALT_RATE, fraction of a window's rows that may be malformed in halt mode
+	MalformedWindow   int     // GE_MALFORMED_WINDOW, rows the malformed rate is measured over
+
+	// SLO configuration (see SLOTracker)
+	SLOWindow                time.Duration // GE_SLO_WINDOW, rolling window compliance and error budgets cover
+	SLOFreshnessTarget       time.Duration // GE_SLO_FRESHNESS_TARGET, freshness a minute must stay within to count as good
+	SLOFreshnessObjective    float64       // GE_SLO_FRESHNESS_OBJECTIVE, fraction of minutes within the freshness target
+	SLOCompletenessObjective float64       // GE_SLO_COMPLETENESS_OBJECTIVE, fraction of submitted documents accepted
+	SLOAvailabilityObjective float64       // GE_SLO_AVAILABILITY_OBJECTIVE, fraction of minutes in which a batch was written
+	SLOStateFile             string        // GE_SLO_STATE_FILE, local path or gs://bucket/object; empty keeps SLO history in memory
+
+	// Deny list configuration (see DenyList)
+	DenyListSource         string        // GE_DENY_LIST, local path, gs://bucket/object, or es://index/id; empty disables
+	DenyListReloadInterval time.Duration // GE_DENY_LIST_RELOAD_INTERVAL, how often the deny list is re-read
+
+	// Retention configuration (see RetentionPolicy)
+	RetentionPolicySource string // GE_RETENTION_POLICY, local path or gs://bucket/object; empty uses the built-in policy
+
+	// Tombstone read guard (see TombstoneGuard)
+	TombstoneGuard string // GE_TOMBSTONE_GUARD, "off", "filter", or "strict"
+
+	// Inactive account handling for readers (see AccountFilter)
+	InactiveAccounts string // GE_INACTIVE_ACCOUNTS, "off", "flag", or "drop"
+
+	// Health configuration (see HealthServer)
+	MaxIngestLag time.Duration // GE_MAX_INGEST_LAG, stream lag beyond which /health reports unhealthy; 0 only reports lag
+
+	// Memory pressure throttling (see MemoryGuard)
+	MemoryLimitBytes       int     // GE_MEMORY_LIMIT_BYTES, limit the heap is measured against; 0 detects the container limit or GOMEMLIMIT
+	MemoryThrottleFraction float64 // GE_MEMORY_THROTTLE_FRACTION, fraction of the limit at which intake pauses and batches shrink
+	MemoryResumeFraction   float64 // GE_MEMORY_RESUME_FRACTION, fraction of the limit the heap must fall below to resume
 }
 
 // LoadConfig loads configuration from environment variables with defaults
 func LoadConfig() *Config {
 	return &Config{
 		JetstreamURL:               getEnv("GE_JETSTREAM_URL", "wss://jetstream2.us-east.bsky.network/subscribe"),
+		JetstreamWantedCollections: getEnv("GE_JETSTREAM_WANTED_COLLECTIONS", "app.bsky.feed.like,app.bsky.graph.follow,app.bsky.graph.block"),
+		JetstreamWantedDIDs:        getEnv("GE_JETSTREAM_WANTED_DIDS", ""),
+		JetstreamHandlers:          getEnv("GE_JETSTREAM_HANDLERS", "likes,follows"),
+		JetstreamShardIndex:        getEnvInt("GE_SHARD_INDEX", 0),
+		JetstreamShardCount:        getEnvInt("GE_SHARD_COUNT", 1),
+		FirehoseURL:                getEnv("GE_FIREHOSE_URL", "wss://bsky.network/xrpc/com.atproto.sync.subscribeRepos"),
 		WebSocketWorkers:           getEnvInt("GE_WEBSOCKET_WORKERS", 3),
 		ElasticsearchURL:           getEnv("GE_ELASTICSEARCH_URL", ""),
 		ElasticsearchAPIKey:        getEnv("GE_ELASTICSEARCH_API_KEY", ""),
@@ -89,13 +253,22 @@ func LoadConfig() *Config {
 		S3SQLiteDBBucket:           getEnv("GE_AWS_S3_BUCKET", ""),
 		S3SQLiteDBPrefix:           getEnv("GE_AWS_S3_PREFIX", ""),
 		SpoolIntervalSec:           getEnvInt("GE_SPOOL_INTERVAL_SEC", 60),
+		SpoolStrategy:              getEnv("GE_SPOOL_STRATEGY", "oldest-first"),
+		SpoolCatchUpLag:            getEnvDuration("GE_SPOOL_CATCH_UP_LAG", time.Hour),
 		JetstreamStateFile:         getEnv("GE_JETSTREAM_STATE_FILE", ".jetstream_state.json"),
 		MegastreamStateFile:        getEnv("GE_MEGASTREAM_STATE_FILE", ".megastream_state.json"),
+		FirehoseStateFile:          getEnv("GE_FIREHOSE_STATE_FILE", ".firehose_state.json"),
+		CursorWriteInterval:        getEnvDuration("GE_CURSOR_WRITE_INTERVAL", 0),
+		CursorSyncBatches:          getEnvInt("GE_CURSOR_SYNC_BATCHES", 0),
+		ClockSkewThreshold:         getEnvDuration("GE_CLOCK_SKEW_THRESHOLD", 5*time.Second),
+		ClockSkewCheckInterval:     getEnvDuration("GE_CLOCK_SKEW_CHECK_INTERVAL", 10*time.Minute),
 		AWSRegion:                  getEnv("GE_AWS_REGION", "us-east-1"),
 		AWSS3AccessKey:             getEnv("GE_AWS_S3_ACCESS_KEY", ""),
 		AWSS3SecretKey:             getEnv("GE_AWS_S3_SECRET_KEY", ""),
 		LoggingEnabled:             getEnvBool("GE_LOGGING_ENABLED", true),
 		MetricExportIntervalSec:    getEnvInt("GE_METRIC_EXPORT_INTERVAL_SEC", 60),
+		OTLPEndpoint:               getEnv("GE_OTLP_ENDPOINT", ""),
+		TraceSampleRatio:           getEnvFloat("GE_TRACE_SAMPLE_RATIO", 0.01),
 		GCPProjectID:               getEnv("GE_GCP_PROJECT_ID", ""),
 		GCPRegion:                  getEnv("GE_GCP_REGION", "us-east1"),
 		Environment:                getEnv("GE_ENVIRONMENT", "local"),
@@ -103,17 +276,102 @@ func LoadConfig() *Config {
 		ParquetMaxRecords:          int64(getEnvInt("GE_PARQUET_MAX_RECORDS", 100000)),
 		ExtractFetchSize:           getEnvInt("GE_EXTRACT_FETCH_SIZE", 1000),
 		ExtractIndices:             getEnv("GE_EXTRACT_INDICES", "posts"),
+		ExportServerAPIKeys:        getEnv("GE_EXPORT_SERVER_API_KEYS", ""),
+		ExportServerRateLimit:      getEnvInt("GE_EXPORT_SERVER_RATE_LIMIT", 10),
+		ExportServerMaxWindow:      getEnvDuration("GE_EXPORT_SERVER_MAX_WINDOW", 24*time.Hour),
 		BlocklistDestination:       getEnv("GE_BLOCKLIST_DESTINATION", ""),
 		LikeRateLimitPerHour:       getEnvInt("GE_LIKE_RATE_LIMIT_PER_HOUR", 2000),
 		LikeRateLimitWindowMinutes: getEnvInt("GE_LIKE_RATE_LIMIT_WINDOW_MIN", 5),
 		LikeBlockDurationMinutes:   getEnvInt("GE_LIKE_BLOCK_DURATION_MIN", 60),
-		IndexPeriod:                getEnv("GE_INDEX_PERIOD", IndexPeriod10Min),
+		LikeDedupCacheSize:         getEnvInt("GE_LIKE_DEDUP_CACHE_SIZE", 100000),
+		IndexPeriod:                getEnv("GE_INDEX_PERIOD", ""),
+		IndexShardBudget:           getEnvInt("GE_INDEX_SHARD_BUDGET", 0),
+		IndexRollover:              getEnvBool("GE_INDEX_ROLLOVER", false),
+		IndexRolloverMaxAge:        getEnvDuration("GE_INDEX_ROLLOVER_MAX_AGE", 0),
+		IndexRolloverMaxShardSize:  getEnv("GE_INDEX_ROLLOVER_MAX_SHARD_SIZE", ""),
+		IndexRolloverMaxDocs:       getEnvInt("GE_INDEX_ROLLOVER_MAX_DOCS", 0),
+		BulkRefreshInterval:        getEnv("GE_BULK_REFRESH_INTERVAL", ""),
+		BulkReplicas:               getEnv("GE_BULK_REPLICAS", ""),
+		BulkTuningLease:            getEnvDuration("GE_BULK_TUNING_LEASE", 10*time.Minute),
+		BulkMaxDocs:                getEnvInt("GE_BULK_MAX_DOCS", 0),
+		BulkMaxBytes:               getEnvInt("GE_BULK_MAX_BYTES", 5<<20),
+		BulkMaxAge:                 getEnvDuration("GE_BULK_MAX_AGE", 5*time.Second),
+		LikesIndexBucket:           getEnv("GE_LIKES_INDEX_BUCKET", IndexPeriodWeek),
+		LikesIndexMaxAge:           getEnvDuration("GE_LIKES_INDEX_MAX_AGE", 30*24*time.Hour),
+		PostCountFlushInterval:     getEnvDuration("GE_POST_COUNT_FLUSH_INTERVAL", 5*time.Second),
+		PostCountMaxPosts:          getEnvInt("GE_POST_COUNT_MAX_POSTS", 1000),
+		PostRoutingCacheSize:       getEnvInt("GE_POST_ROUTING_CACHE_SIZE", 100000),
 		InferenceBaseURL:           getEnv("GE_INFERENCE_BASE_URL", ""),
 		InferenceAPIKey:            getEnv("GE_INFERENCE_API_KEY", ""),
 		InferenceTimeout:           getEnvDuration("GE_INFERENCE_TIMEOUT", 10*time.Second),
 		InferenceChunkSize:         getEnvInt("GE_INFERENCE_CHUNK_SIZE", 64),
 		InferenceMaxConcurrency:    getEnvInt("GE_INFERENCE_MAX_CONCURRENCY", 8),
 		InferenceRetryMax:          getEnvInt("GE_INFERENCE_RETRY_MAX", 3),
+		EmbeddingURL:               getEnv("GE_EMBEDDING_URL", ""),
+		EmbeddingAPIKey:            getEnv("GE_EMBEDDING_API_KEY", ""),
+		EmbeddingTimeout:           getEnvDuration("GE_EMBEDDING_TIMEOUT", 30*time.Second),
+		EmbeddingRetryMax:          getEnvInt("GE_EMBEDDING_RETRY_MAX", 3),
+		RecommenderSeedListPath:    getEnv("GE_RECOMMENDER_SEED_LIST", ""),
+		RecommenderTrendingWindow:  getEnvDuration("GE_RECOMMENDER_TRENDING_WINDOW", 0),
+		RecommenderCursorSecret:    getEnv("GE_RECOMMENDER_CURSOR_SECRET", ""),
+		RecommenderRetrievalBudget: getEnvDuration("GE_RECOMMENDER_RETRIEVAL_TIMEOUT", 300*time.Millisecond),
+		RecommenderScoringBudget:   getEnvDuration("GE_RECOMMENDER_SCORING_TIMEOUT", 800*time.Millisecond),
+		RecommenderCacheTTL:        getEnvDuration("GE_RECOMMENDER_CACHE_TTL", 30*time.Second),
+		RecommenderCachePoll:       getEnvDuration("GE_RECOMMENDER_CACHE_POLL_INTERVAL", 10*time.Second),
+		RecommenderBlockCacheTTL:   getEnvDuration("GE_RECOMMENDER_BLOCK_CACHE_TTL", 5*time.Minute),
+		RecommenderPostFilterPath:  getEnv("GE_RECOMMENDER_POST_FILTERS", ""),
+		RecommenderGuardrailsPath:  getEnv("GE_RECOMMENDER_GUARDRAILS", ""),
+		PLCDirectoryURL:            getEnv("GE_PLC_DIRECTORY_URL", "https://plc.directory"),
+		RecommenderShadowWeights:   getEnv("GE_RECOMMENDER_SHADOW_WEIGHTS", ""),
+		RecommenderShadowSample:    getEnvFloat("GE_RECOMMENDER_SHADOW_SAMPLE_RATE", 0.05),
+		RecommenderAPIKeys:         getEnv("GE_RECOMMENDER_API_KEYS", ""),
+		EngagementHalfLife:         getEnvDuration("GE_RECOMMENDER_ENGAGEMENT_HALF_LIFE", 6*time.Hour),
+		LLMURL:                     getEnv("GE_LLM_URL", ""),
+		LLMAPIKey:                  getEnv("GE_LLM_API_KEY", ""),
+		LLMModel:                   getEnv("GE_LLM_MODEL", ""),
+		LLMTimeout:                 getEnvDuration("GE_LLM_TIMEOUT", 60*time.Second),
+		LLMRetryMax:                getEnvInt("GE_LLM_RETRY_MAX", 3),
+		LLMBatchSize:               getEnvInt("GE_LLM_BATCH_SIZE", 20),
+		LLMRateLimit:               getEnvInt("GE_LLM_RATE_LIMIT", 60),
+		ChangeFeedTopic:            getEnv("GE_CHANGE_FEED_TOPIC", ""),
+		ChangeFeedEncoding:         getEnv("GE_CHANGE_FEED_ENCODING", ChangeEncodingJSON),
+		ChangeStreamQueriesPath:    getEnv("GE_CHANGE_STREAM_QUERIES", ""),
+		ChangeStreamPollInterval:   getEnvDuration("GE_CHANGE_STREAM_POLL_INTERVAL", 2*time.Second),
+		ChangeStreamAllowedOrigins: getEnv("GE_CHANGE_STREAM_ALLOWED_ORIGINS", ""),
+		SnapshotRepository:         getEnv("GE_SNAPSHOT_REPOSITORY", "gcs_backup"),
+		SnapshotBucket:             getEnv("GE_SNAPSHOT_BUCKET", ""),
+		MirrorSourceURL:            getEnv("GE_MIRROR_SOURCE_URL", ""),
+		MirrorSourceAPIKey:         getEnv("GE_MIRROR_SOURCE_API_KEY", ""),
+		MirrorStateFile:            getEnv("GE_MIRROR_STATE_FILE", ".stage_mirror_state.json"),
+		MirrorAllowDIDs:            getEnv("GE_MIRROR_ALLOW_DIDS", ""),
+		CanaryInterval:             getEnvDuration("GE_CANARY_INTERVAL", 0),
+		CanarySearchSLO:            getEnvDuration("GE_CANARY_SEARCH_SLO", time.Minute),
+		CanaryExportSLO:            getEnvDuration("GE_CANARY_EXPORT_SLO", time.Hour),
+		DLQDestination:             getEnv("GE_DLQ_DESTINATION", ""),
+		SpillDir:                   getEnv("GE_SPILL_DIR", ""),
+		SpillAfterFailures:         getEnvInt("GE_SPILL_AFTER_FAILURES", 3),
+		SpillReplayInterval:        getEnvDuration("GE_SPILL_REPLAY_INTERVAL", 30*time.Second),
+		SpillMaxBytes:              getEnvInt("GE_SPILL_MAX_BYTES", 1<<30),
+		AuditIndex:                 getEnv("GE_AUDIT_INDEX", "ops_audit"),
+		AuditActor:                 getEnv("GE_AUDIT_ACTOR", ""),
+		IngestStrictness:           getEnv("GE_INGEST_STRICTNESS", StrictnessSkip),
+		MalformedHaltRate:          getEnvFloat("GE_MALFORMED_HALT_RATE", 0.01),
+		MalformedWindow:            getEnvInt("GE_MALFORMED_WINDOW", 1000),
+		SLOWindow:                  getEnvDuration("GE_SLO_WINDOW", 7*24*time.Hour),
+		SLOFreshnessTarget:         getEnvDuration("GE_SLO_FRESHNESS_TARGET", 2*time.Minute),
+		SLOFreshnessObjective:      getEnvFloat("GE_SLO_FRESHNESS_OBJECTIVE", 0.99),
+		SLOCompletenessObjective:   getEnvFloat("GE_SLO_COMPLETENESS_OBJECTIVE", 0.999),
+		SLOAvailabilityObjective:   getEnvFloat("GE_SLO_AVAILABILITY_OBJECTIVE", 0.995),
+		SLOStateFile:               getEnv("GE_SLO_STATE_FILE", ""),
+		MaxIngestLag:               getEnvDuration("GE_MAX_INGEST_LAG", 0),
+		DenyListSource:             getEnv("GE_DENY_LIST", ""),
+		DenyListReloadInterval:     getEnvDuration("GE_DENY_LIST_RELOAD_INTERVAL", time.Minute),
+		RetentionPolicySource:      getEnv("GE_RETENTION_POLICY", ""),
+		TombstoneGuard:             getEnv("GE_TOMBSTONE_GUARD", TombstoneGuardFilter),
+		InactiveAccounts:           getEnv("GE_INACTIVE_ACCOUNTS", InactiveAccountsOff),
+		MemoryLimitBytes:           getEnvInt("GE_MEMORY_LIMIT_BYTES", 0),
+		MemoryThrottleFraction:     getEnvFloat("GE_MEMORY_THROTTLE_FRACTION", 0.8),
+		MemoryResumeFraction:       getEnvFloat("GE_MEMORY_RESUME_FRACTION", 0.7),
 	}
 }
 
@@ -145,6 +403,16 @@ func getEnvBool(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+// getEnvFloat returns the float value of an environment variable or a default value
+func getEnvFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
 // getEnvDuration returns the duration value of an environment variable or a default value
 func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
 	if value := os.Getenv(key); value != "" {
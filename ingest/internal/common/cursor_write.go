@@ -0,0 +1,99 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// CursorWritePolicy controls how often an ingest command writes its cursor
+// to its state file. Each write to a GCS state file is an object write, which
+// GCS rate limits to about one a second; everything indexed since the last
+// write is replayed after a crash.
+type CursorWritePolicy struct {
+	Interval    time.Duration // Least time between writes; 0 writes whenever the cursor moves
+	SyncBatches int           // Write once this many batches are indexed since the last write, even within Interval; 0 disables
+}
+
+// CursorWritePolicyFromConfig returns the cursor write policy in config,
+// writing at most every interval unless GE_CURSOR_WRITE_INTERVAL overrides it
+func CursorWritePolicyFromConfig(config *Config, interval time.Duration) CursorWritePolicy {
+	if config.CursorWriteInterval > 0 {
+		interval = config.CursorWriteInterval
+	}
+	return CursorWritePolicy{
+		Interval:    interval,
+		SyncBatches: config.CursorSyncBatches,
+	}
+}
+
+// TickInterval is how often a caller should check Due so that writes are not
+// held much past Interval, or past SyncBatches batches
+func (p CursorWritePolicy) TickInterval() time.Duration {
+	tick := max(p.Interval/4, 10*time.Millisecond)
+	if p.SyncBatches > 0 {
+		tick = min(tick, 100*time.Millisecond)
+	}
+	return tick
+}
+
+func (p CursorWritePolicy) String() string {
+	switch {
+	case p.Interval <= 0:
+		return "every batch"
+	case p.SyncBatches > 0:
+		return fmt.Sprintf("every %s or %d batches", p.Interval, p.SyncBatches)
+	default:
+		return fmt.Sprintf("every %s", p.Interval)
+	}
+}
+
+// CursorThrottle decides when a cursor is due to be written under a policy,
+// and reports each write's replay window: how far, in event time, the write
+// moved the cursor, which is what a crash just before it would have
+// replayed. A CursorThrottle is not safe for concurrent use.
+type CursorThrottle struct {
+	policy    CursorWritePolicy
+	logger    *IngestLogger
+	lastWrite time.Time
+	writtenUs int64
+	batches   int
+}
+
+// NewCursorThrottle creates a CursorThrottle whose first write is due an
+// interval from now
+func NewCursorThrottle(policy CursorWritePolicy, logger *IngestLogger) *CursorThrottle {
+	return &CursorThrottle{
+		policy:    policy,
+		logger:    logger,
+		lastWrite: time.Now(),
+	}
+}
+
+// Policy returns the throttle's write policy
+func (t *CursorThrottle) Policy() CursorWritePolicy {
+	return t.policy
+}
+
+// AddBatches records n more batches indexed since the last write
+func (t *CursorThrottle) AddBatches(n int) {
+	t.batches += n
+}
+
+// Due reports whether the cursor should be written at now
+func (t *CursorThrottle) Due(now time.Time) bool {
+	if t.policy.SyncBatches > 0 && t.batches >= t.policy.SyncBatches {
+		return true
+	}
+	return now.Sub(t.lastWrite) >= t.policy.Interval
+}
+
+// Written records that the cursor was written at now with the event time
+// timeUs, emitting cursor.replay_window_sec for all but the first write
+func (t *CursorThrottle) Written(timeUs int64, now time.Time) {
+	if t.writtenUs > 0 && timeUs > t.writtenUs {
+		t.logger.Metric("cursor.replay_window_sec", float64(timeUs-t.writtenUs)/1e6)
+	}
+	t.lastWrite = now
+	t.writtenUs = timeUs
+	t.batches = 0
+}
@@ -0,0 +1,84 @@
+package common
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestCursorWritePolicyFromConfig(t *testing.T) {
+	config := &Config{}
+	got := CursorWritePolicyFromConfig(config, 10*time.Second)
+	if got != (CursorWritePolicy{Interval: 10 * time.Second}) {
+		t.Errorf("unexpected policy %+v", got)
+	}
+
+	config.CursorWriteInterval = time.Minute
+	config.CursorSyncBatches = 50
+	got = CursorWritePolicyFromConfig(config, 10*time.Second)
+	if got != (CursorWritePolicy{Interval: time.Minute, SyncBatches: 50}) {
+		t.Errorf("expected GE_CURSOR_WRITE_INTERVAL and GE_CURSOR_SYNC_BATCHES to apply, got %+v", got)
+	}
+}
+
+func TestCursorWritePolicy_TickInterval(t *testing.T) {
+	tests := []struct {
+		policy CursorWritePolicy
+		want   time.Duration
+	}{
+		{CursorWritePolicy{Interval: 10 * time.Second}, 2500 * time.Millisecond},
+		{CursorWritePolicy{Interval: 10 * time.Second, SyncBatches: 20}, 100 * time.Millisecond},
+		{CursorWritePolicy{}, 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.TickInterval(); got != tt.want {
+			t.Errorf("%+v: got %v, want %v", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestCursorThrottle(t *testing.T) {
+	mc := newMockMetricCollector()
+	logger := NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(mc)
+
+	throttle := NewCursorThrottle(CursorWritePolicy{Interval: 10 * time.Second, SyncBatches: 3}, logger)
+	start := time.Now()
+	if throttle.Due(start) {
+		t.Error("expected no write due before the interval or batches")
+	}
+	throttle.AddBatches(2)
+	if throttle.Due(start.Add(time.Second)) {
+		t.Error("expected no write due after 2 of 3 batches")
+	}
+	throttle.AddBatches(1)
+	if !throttle.Due(start.Add(time.Second)) {
+		t.Error("expected a write due after 3 batches")
+	}
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC).UnixMicro()
+	throttle.Written(base, start.Add(time.Second))
+	if throttle.Due(start.Add(5 * time.Second)) {
+		t.Error("expected the write to reset the interval and batch count")
+	}
+	if !throttle.Due(start.Add(11 * time.Second)) {
+		t.Error("expected a write due after the interval")
+	}
+	throttle.Written(base+30_000_000, start.Add(11*time.Second))
+
+	// The first write has no earlier cursor to measure from
+	if got := mc.getRecords("cursor.replay_window_sec"); len(got) != 1 || got[0] != 30 {
+		t.Errorf("expected one 30s replay window, got %v", got)
+	}
+}
+
+func TestCursorThrottle_EveryBatch(t *testing.T) {
+	logger := NewLogger(false)
+	throttle := NewCursorThrottle(CursorWritePolicy{}, logger)
+	now := time.Now()
+	throttle.Written(1, now)
+	if !throttle.Due(now) {
+		t.Error("expected every write due with no interval")
+	}
+}
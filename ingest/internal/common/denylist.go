@@ -0,0 +1,199 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// Deny list scopes. An "all" entry drops a DID's records at ingest and at
+// export; an "export" entry keeps ingesting them but drops them from exports.
+const (
+	DenyScopeAll    = "all"
+	DenyScopeExport = "export"
+)
+
+// Stages a deny list is applied at
+const (
+	DenyStageIngest = "ingest"
+	DenyStageExport = "export"
+)
+
+// DenyEntry is one denied DID
+type DenyEntry struct {
+	DID    string `json:"did"`
+	Scope  string `json:"scope,omitempty"`  // DenyScopeAll (default) or DenyScopeExport
+	Reason string `json:"reason,omitempty"` // Why the DID is denied, e.g. a court order or abuse report reference
+}
+
+// denyListDocument is the deny list's stored form
+type denyListDocument struct {
+	Entries []DenyEntry `json:"entries"`
+}
+
+// DenyList is a reloadable set of DIDs whose records must not be ingested or
+// exported, for legal holds and abuse. It is read from a local path, a GCS
+// object (gs://bucket/object), or an Elasticsearch document
+// (es://index/id), and every record dropped because of it is audit-logged.
+// A nil DenyList denies nothing.
+type DenyList struct {
+	source string
+	client *elasticsearch.Client
+	logger *IngestLogger
+
+	mu      sync.RWMutex
+	entries map[string]DenyEntry
+}
+
+// NewDenyList loads the deny list at source. client is needed only for es://
+// sources. Returns nil when source is empty so callers can use the result
+// unconditionally. A list that cannot be loaded is an error rather than an
+// empty list, so a service never starts without the holds it must enforce.
+func NewDenyList(ctx context.Context, source string, client *elasticsearch.Client, logger *IngestLogger) (*DenyList, error) {
+	if source == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(source, "es://") && client == nil {
+		return nil, fmt.Errorf("deny list %s needs an Elasticsearch client", source)
+	}
+	d := &DenyList{source: source, client: client, logger: logger}
+	if err := d.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Reload replaces the list with the current contents of its source. On
+// error the previous list stays in effect.
+func (d *DenyList) Reload(ctx context.Context) error {
+	data, err := d.read(ctx)
+	if err != nil {
+		return err
+	}
+	var doc denyListDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse deny list %s: %w", d.source, err)
+	}
+	entries := make(map[string]DenyEntry, len(doc.Entries))
+	for _, entry := range doc.Entries {
+		if entry.Scope == "" {
+			entry.Scope = DenyScopeAll
+		}
+		if entry.Scope != DenyScopeAll && entry.Scope != DenyScopeExport {
+			return fmt.Errorf("deny list %s: unknown scope %q for %s", d.source, entry.Scope, entry.DID)
+		}
+		entries[entry.DID] = entry
+	}
+
+	d.mu.Lock()
+	previous := len(d.entries)
+	d.entries = entries
+	d.mu.Unlock()
+	if previous != len(entries) {
+		d.logger.Info("Loaded deny list %s: %d DIDs", d.source, len(entries))
+	}
+	return nil
+}
+
+// Run reloads the list every interval until ctx is cancelled
+func (d *DenyList) Run(ctx context.Context, interval time.Duration) {
+	if d == nil || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := d.Reload(ctx); err != nil {
+			d.logger.Error("Failed to reload deny list (keeping the previous list): %v", err)
+			d.logger.Metric("denylist.reload_error_count", 1)
+		}
+	}
+}
+
+// Denied reports whether the record atURI by did must be dropped at stage,
+// writing an audit log line for each record it drops
+func (d *DenyList) Denied(stage, did, atURI string) bool {
+	if d == nil {
+		return false
+	}
+	d.mu.RLock()
+	entry, ok := d.entries[did]
+	d.mu.RUnlock()
+	if !ok || (stage == DenyStageIngest && entry.Scope != DenyScopeAll) {
+		return false
+	}
+	d.logger.WithFields(map[string]interface{}{
+		"did":    did,
+		"scope":  entry.Scope,
+		"reason": entry.Reason,
+	}).Info("AUDIT deny list: dropped %s at %s", atURI, stage)
+	d.logger.Metric("denylist."+stage+"_dropped_count", 1)
+	return true
+}
+
+// read returns the raw deny list document from its source
+func (d *DenyList) read(ctx context.Context) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(d.source, "gs://"):
+		parts := strings.SplitN(strings.TrimPrefix(d.source, "gs://"), "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid GCS path format: %s (expected gs://bucket/object)", d.source)
+		}
+		client, err := storage.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GCS client: %w", err)
+		}
+		defer func() { _ = client.Close() }()
+		reader, err := client.Bucket(parts[0]).Object(parts[1]).NewReader(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open deny list in GCS: %w", err)
+		}
+		defer func() { _ = reader.Close() }() // Best-effort close for read operation
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read deny list from GCS: %w", err)
+		}
+		return data, nil
+
+	case strings.HasPrefix(d.source, "es://"):
+		parts := strings.SplitN(strings.TrimPrefix(d.source, "es://"), "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid Elasticsearch document format: %s (expected es://index/id)", d.source)
+		}
+		res, err := d.client.Get(parts[0], parts[1], d.client.Get.WithContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get deny list document: %w", err)
+		}
+		defer func() { _ = res.Body.Close() }()
+		if res.IsError() {
+			return nil, fmt.Errorf("failed to get deny list document %s: %s", d.source, res.String())
+		}
+		var doc struct {
+			Source json.RawMessage `json:"_source"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to parse deny list document response: %w", err)
+		}
+		return doc.Source, nil
+
+	default:
+		data, err := os.ReadFile(d.source) //nolint:gosec // G304: path comes from service configuration
+		if err != nil {
+			return nil, fmt.Errorf("failed to read deny list: %w", err)
+		}
+		return data, nil
+	}
+}
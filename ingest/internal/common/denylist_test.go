@@ -0,0 +1,124 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewDenyList_EmptySourceDisables(t *testing.T) {
+	denyList, err := NewDenyList(context.Background(), "", nil, NewLogger(false))
+	if err != nil || denyList != nil {
+		t.Fatalf("expected a nil deny list, got %v, %v", denyList, err)
+	}
+	if denyList.Denied(DenyStageIngest, "did:plc:a", "at://a") {
+		t.Error("a nil deny list should deny nothing")
+	}
+}
+
+func TestDenyList_Scopes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.json")
+	if err := os.WriteFile(path, []byte(`{"entries":[
+		{"did":"did:plc:held","reason":"court order 2026-114"},
+		{"did":"did:plc:export","scope":"export","reason":"abuse report"}
+	]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	logger := NewLogger(true)
+	mc := newMockMetricCollector()
+	logger.SetMetricCollector(mc)
+
+	denyList, err := NewDenyList(context.Background(), path, nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		stage, did string
+		want       bool
+	}{
+		{DenyStageIngest, "did:plc:held", true},
+		{DenyStageExport, "did:plc:held", true},
+		{DenyStageIngest, "did:plc:export", false},
+		{DenyStageExport, "did:plc:export", true},
+		{DenyStageIngest, "did:plc:other", false},
+		{DenyStageExport, "did:plc:other", false},
+	}
+	for _, tt := range tests {
+		if got := denyList.Denied(tt.stage, tt.did, "at://x"); got != tt.want {
+			t.Errorf("Denied(%s, %s) = %v, want %v", tt.stage, tt.did, got, tt.want)
+		}
+	}
+	if got := len(mc.getRecords("denylist.ingest_dropped_count")); got != 1 {
+		t.Errorf("expected 1 ingest drop recorded, got %d", got)
+	}
+	if got := len(mc.getRecords("denylist.export_dropped_count")); got != 2 {
+		t.Errorf("expected 2 export drops recorded, got %d", got)
+	}
+}
+
+func TestDenyList_ReloadKeepsPreviousListOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.json")
+	if err := os.WriteFile(path, []byte(`{"entries":[{"did":"did:plc:a"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	denyList, err := NewDenyList(ctx, path, nil, NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"entries":[{"did":"did:plc:b"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := denyList.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if denyList.Denied(DenyStageIngest, "did:plc:a", "at://a") || !denyList.Denied(DenyStageIngest, "did:plc:b", "at://b") {
+		t.Error("expected the reloaded list to replace the original")
+	}
+
+	for _, bad := range []string{`{"entries":`, `{"entries":[{"did":"did:plc:c","scope":"ingest"}]}`} {
+		if err := os.WriteFile(path, []byte(bad), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := denyList.Reload(ctx); err == nil {
+			t.Errorf("expected an error reloading %s", bad)
+		}
+		if !denyList.Denied(DenyStageIngest, "did:plc:b", "at://b") {
+			t.Errorf("expected the previous list to stay in effect after reloading %s", bad)
+		}
+	}
+}
+
+func TestDenyList_ElasticsearchDocument(t *testing.T) {
+	var requested string
+	client, srv := newMockESClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		requested = r.URL.Path
+		_, _ = w.Write([]byte(`{"_index":"ingest_config","_id":"deny_list","found":true,"_source":{"entries":[{"did":"did:plc:a"}]}}`))
+	}))
+	defer srv.Close()
+
+	denyList, err := NewDenyList(context.Background(), "es://ingest_config/deny_list", client, NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requested != "/ingest_config/_doc/deny_list" {
+		t.Errorf("unexpected request path %s", requested)
+	}
+	if !denyList.Denied(DenyStageIngest, "did:plc:a", "at://a") {
+		t.Error("expected did:plc:a to be denied")
+	}
+}
+
+func TestNewDenyList_MissingSourceFails(t *testing.T) {
+	if _, err := NewDenyList(context.Background(), filepath.Join(t.TempDir(), "missing.json"), nil, NewLogger(false)); err == nil {
+		t.Error("expected an error for a missing deny list")
+	}
+	if _, err := NewDenyList(context.Background(), "es://ingest_config/deny_list", nil, NewLogger(false)); err == nil {
+		t.Error("expected an error for an es:// deny list without a client")
+	}
+}
@@ -0,0 +1,272 @@
+package common
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/iterator"
+)
+
+// DeadLetter is a document Elasticsearch rejected in a bulk request, with
+// everything needed to re-submit it
+type DeadLetter struct {
+	Index       string          `json:"index"`
+	ID          string          `json:"id"`
+	Routing     string          `json:"routing,omitempty"`
+	Version     int64           `json:"version,omitempty"` // External version (see Versioned); 0 for none
+	Status      int             `json:"status"`
+	ErrorType   string          `json:"error_type"`
+	ErrorReason string          `json:"error_reason"`
+	FailedAt    string          `json:"failed_at"`
+	Source      json.RawMessage `json:"source"`
+}
+
+// bulkItemResult is the outcome of one item in a bulk response
+type bulkItemResult struct {
+	Status int            `json:"status"`
+	Error  *bulkItemError `json:"error,omitempty"`
+}
+
+type bulkItemError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// BulkItemsError reports a bulk request in which some items failed.
+// DeadLettered counts the failed items saved to the dead-letter queue.
+type BulkItemsError struct {
+	BulkResult
+	DeadLettered int
+}
+
+func (e *BulkItemsError) Error() string {
+	return "some documents had errors (see logs for details)"
+}
+
+// DeadLetterQueue spools dead letters as NDJSON files under a local
+// directory or GCS prefix (gs://bucket/prefix). Each write is a new file,
+// <destination>/<service>/<timestamp>-<seq>.ndjson, so concurrent writers
+// never share a file.
+type DeadLetterQueue struct {
+	destination string
+	service     string
+	gcs         *storage.Client
+	bucket      string
+	prefix      string
+	mu          sync.Mutex
+	seq         int
+}
+
+// NewDeadLetterQueue creates a queue writing under destination. Returns nil
+// when destination is empty so callers can pass the result unconditionally;
+// a nil queue drops dead letters.
+func NewDeadLetterQueue(ctx context.Context, destination, service string) (*DeadLetterQueue, error) {
+	if destination == "" {
+		return nil, nil
+	}
+	q := &DeadLetterQueue{destination: destination, service: service}
+	if strings.HasPrefix(destination, "gs://") {
+		bucket, prefix, err := parseDeadLetterGCSPath(destination)
+		if err != nil {
+			return nil, err
+		}
+		client, err := storage.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GCS client: %w", err)
+		}
+		q.gcs, q.bucket, q.prefix = client, bucket, prefix
+	}
+	return q, nil
+}
+
+// Close releases the queue's GCS client
+func (q *DeadLetterQueue) Close() error {
+	if q == nil || q.gcs == nil {
+		return nil
+	}
+	return q.gcs.Close()
+}
+
+// Write saves letters as one NDJSON file and returns its path
+func (q *DeadLetterQueue) Write(ctx context.Context, letters []DeadLetter) (string, error) {
+	var buf bytes.Buffer
+	for _, letter := range letters {
+		line, err := json.Marshal(letter)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal dead letter %s: %w", letter.ID, err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	q.mu.Lock()
+	q.seq++
+	name := fmt.Sprintf("%s/%s-%04d.ndjson", q.service, time.Now().UTC().Format("20060102T150405.000000000Z"), q.seq)
+	q.mu.Unlock()
+
+	if q.gcs == nil {
+		path := filepath.Join(q.destination, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			return "", fmt.Errorf("failed to create dead-letter directory: %w", err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0600); err != nil {
+			return "", fmt.Errorf("failed to write dead letters: %w", err)
+		}
+		return path, nil
+	}
+
+	object := q.prefix + name
+	writer := q.gcs.Bucket(q.bucket).Object(object).NewWriter(ctx)
+	writer.ContentType = "application/x-ndjson"
+	if _, err := writer.Write(buf.Bytes()); err != nil {
+		_ = writer.Close()
+		return "", fmt.Errorf("failed to write dead letters to GCS: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return "", fmt.Errorf("failed to finalize dead letters in GCS: %w", err)
+	}
+	return "gs://" + q.bucket + "/" + object, nil
+}
+
+// List returns every dead-letter file under the queue's destination, oldest first
+func (q *DeadLetterQueue) List(ctx context.Context) ([]string, error) {
+	var paths []string
+	if q.gcs == nil {
+		err := filepath.WalkDir(q.destination, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(path, ".ndjson") {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to list dead letters: %w", err)
+		}
+	} else {
+		it := q.gcs.Bucket(q.bucket).Objects(ctx, &storage.Query{Prefix: q.prefix})
+		for {
+			attrs, err := it.Next()
+			if errors.Is(err, iterator.Done) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to list dead letters in GCS: %w", err)
+			}
+			if strings.HasSuffix(attrs.Name, ".ndjson") {
+				paths = append(paths, "gs://"+q.bucket+"/"+attrs.Name)
+			}
+		}
+	}
+	// File names start with their write time, so this orders by time within a service
+	sort.Slice(paths, func(i, j int) bool { return filepath.Base(paths[i]) < filepath.Base(paths[j]) })
+	return paths, nil
+}
+
+// Read returns the dead letters in a file returned by Write or List
+func (q *DeadLetterQueue) Read(ctx context.Context, path string) ([]DeadLetter, error) {
+	var reader io.Reader
+	if q.gcs == nil {
+		file, err := os.Open(path) //nolint:gosec // G304: path comes from List
+		if err != nil {
+			return nil, fmt.Errorf("failed to open dead letters: %w", err)
+		}
+		defer func() { _ = file.Close() }() // Best-effort close for read operation
+		reader = file
+	} else {
+		objectReader, err := q.gcs.Bucket(q.bucket).Object(q.objectName(path)).NewReader(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open dead letters in GCS: %w", err)
+		}
+		defer func() { _ = objectReader.Close() }() // Best-effort close for read operation
+		reader = objectReader
+	}
+
+	var letters []DeadLetter
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var letter DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			return nil, fmt.Errorf("failed to parse dead letter in %s: %w", path, err)
+		}
+		letters = append(letters, letter)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dead letters from %s: %w", path, err)
+	}
+	return letters, nil
+}
+
+// Remove deletes a dead-letter file
+func (q *DeadLetterQueue) Remove(ctx context.Context, path string) error {
+	if q.gcs == nil {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove dead letters: %w", err)
+		}
+		return nil
+	}
+	if err := q.gcs.Bucket(q.bucket).Object(q.objectName(path)).Delete(ctx); err != nil {
+		return fmt.Errorf("failed to remove dead letters from GCS: %w", err)
+	}
+	return nil
+}
+
+// SetDeadLetterQueue configures where bulk index functions save documents
+// Elasticsearch rejects. Without a queue they are only logged.
+func (l *IngestLogger) SetDeadLetterQueue(q *DeadLetterQueue) {
+	l.deadLetters = q
+}
+
+// deadLetter saves documents Elasticsearch rejected to the configured queue
+// and returns the error describing them
+func (l *IngestLogger) deadLetter(ctx context.Context, failed []DeadLetter) *BulkItemsError {
+	result := &BulkItemsError{BulkResult: BulkResult{Failed: len(failed)}}
+	l.Metric("dlq.failed_items_count", float64(len(failed)))
+	if l.deadLetters == nil || len(failed) == 0 {
+		return result
+	}
+	path, err := l.deadLetters.Write(ctx, failed)
+	if err != nil {
+		l.Error("Failed to dead-letter %d documents: %v", len(failed), err)
+		l.Metric("dlq.write_error_count", 1)
+		return result
+	}
+	result.DeadLettered = len(failed)
+	l.Metric("dlq.dead_lettered_count", float64(len(failed)))
+	l.Info("Dead-lettered %d rejected documents to %s", len(failed), path)
+	return result
+}
+
+// objectName returns the object of a gs:// path in the queue's bucket
+func (q *DeadLetterQueue) objectName(path string) string {
+	return strings.TrimPrefix(path, "gs://"+q.bucket+"/")
+}
+
+func parseDeadLetterGCSPath(path string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "gs://"), "/", 2)
+	if len(parts) == 0 || parts[0] == "" {
+		return "", "", fmt.Errorf("invalid GCS path format: %s (expected gs://bucket/prefix)", path)
+	}
+	prefix := ""
+	if len(parts) == 2 && parts[1] != "" {
+		prefix = strings.TrimSuffix(parts[1], "/") + "/"
+	}
+	return parts[0], prefix, nil
+}
@@ -0,0 +1,112 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestDeadLetterQueue_LocalRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	queue, err := NewDeadLetterQueue(ctx, t.TempDir(), "jetstream_ingest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := queue.Write(ctx, []DeadLetter{{Index: "likes-write", ID: "at://a", Routing: "did:plc:a", Source: json.RawMessage(`{"at_uri":"at://a"}`)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := queue.Write(ctx, []DeadLetter{{Index: "posts-write", ID: "at://b"}, {Index: "posts-write", ID: "at://c"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := queue.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || paths[0] != first || paths[1] != second {
+		t.Fatalf("expected [%s %s] in write order, got %v", first, second, paths)
+	}
+
+	letters, err := queue.Read(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || letters[0].Routing != "did:plc:a" || string(letters[0].Source) != `{"at_uri":"at://a"}` {
+		t.Errorf("unexpected letters %+v", letters)
+	}
+
+	if err := queue.Remove(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if paths, _ := queue.List(ctx); len(paths) != 1 {
+		t.Errorf("expected one file after remove, got %v", paths)
+	}
+}
+
+func TestNewDeadLetterQueue_EmptyDestinationDisables(t *testing.T) {
+	queue, err := NewDeadLetterQueue(context.Background(), "", "jetstream_ingest")
+	if err != nil || queue != nil {
+		t.Fatalf("expected a nil queue, got %v, %v", queue, err)
+	}
+	if err := queue.Close(); err != nil {
+		t.Errorf("closing a nil queue should succeed, got %v", err)
+	}
+}
+
+func TestBulkIndex_DeadLettersRejectedItems(t *testing.T) {
+	client, srv := newMockESClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		_, _ = w.Write([]byte(`{"took":3,"errors":true,"items":[
+			{"index":{"_id":"at://a","status":201}},
+			{"index":{"_id":"at://b","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [created_at]"}}}
+		]}`))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	queue, err := NewDeadLetterQueue(ctx, t.TempDir(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := NewLogger(true)
+	mc := newMockMetricCollector()
+	logger.SetMetricCollector(mc)
+	logger.SetDeadLetterQueue(queue)
+
+	docs := []RawDoc{
+		{AtURI: "at://a", AuthorDID: "did:plc:a", Source: json.RawMessage(`{"n":1}`)},
+		{AtURI: "at://b", AuthorDID: "did:plc:b", Source: json.RawMessage(`{"n":2}`)},
+	}
+	err = BulkIndex(ctx, client, "posts-write", docs, false, logger)
+	var itemsErr *BulkItemsError
+	if !errors.As(err, &itemsErr) || itemsErr.Failed != 1 || itemsErr.DeadLettered != 1 {
+		t.Fatalf("expected one dead-lettered item, got %v", err)
+	}
+	if err.Error() != "bulk indexing failed: some documents had errors (see logs for details)" {
+		t.Errorf("unexpected error message %q", err.Error())
+	}
+
+	paths, err := queue.List(ctx)
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected one dead-letter file, got %v, %v", paths, err)
+	}
+	letters, err := queue.Read(ctx, paths[0])
+	if err != nil || len(letters) != 1 {
+		t.Fatalf("expected one dead letter, got %+v, %v", letters, err)
+	}
+	want := DeadLetter{Index: "posts-write", ID: "at://b", Routing: "did:plc:b", Status: 400, ErrorType: "mapper_parsing_exception", ErrorReason: "failed to parse field [created_at]"}
+	got := letters[0]
+	if got.Index != want.Index || got.ID != want.ID || got.Routing != want.Routing ||
+		got.Status != want.Status || got.ErrorType != want.ErrorType || got.ErrorReason != want.ErrorReason ||
+		string(got.Source) != `{"n":2}` || got.FailedAt == "" {
+		t.Errorf("expected %+v, got %+v", want, letters)
+	}
+	if records := mc.getRecords("dlq.dead_lettered_count"); len(records) != 1 || records[0] != 1 {
+		t.Errorf("unexpected dlq.dead_lettered_count %v", records)
+	}
+}
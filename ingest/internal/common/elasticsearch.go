@@ -54,24 +54,23 @@ type ExternalEmbed struct {
 	Description string `json:"description,omitempty"`
 }
 
-// ESDoc is the constraint for document types that can be bulk-indexed.
-type ESDoc interface {
-	esAtURI() string
-	esAuthorDID() string
-}
-
 // PostDoc is the document structure for indexing original posts.
 // Reply-specific fields (ThreadParentPost, ThreadRootPost) are intentionally absent.
 type PostDoc struct {
 	AtURI                   string                  `json:"at_uri"`
 	AuthorDID               string                  `json:"author_did"`
 	Content                 string                  `json:"content"`
+	Langs                   []string                `json:"langs,omitempty"`       // Languages the author declared, as BCP 47 tags
+	SelfLabels              []string                `json:"self_labels,omitempty"` // Labels the author applied, e.g. "porn"
 	CreatedAt               string                  `json:"created_at"`
 	QuotePost               string                  `json:"quote_post"`
 	Embeddings              map[string]Float32Array `json:"embeddings,omitempty"`
 	PostEmbeddingModelUUID  string                  `json:"ge_post_embedding_model_uuid"`
 	IndexedAt               string                  `json:"indexed_at"`
 	LikeCount               int                     `json:"like_count"`
+	ReplyCount              int                     `json:"reply_count"`
+	ThreadReplyCount        int                     `json:"thread_reply_count"`
+	QuoteCount              int                     `json:"quote_count"`
 	Media                   []MediaItem             `json:"media"`
 	ContainsImages          bool                    `json:"contains_images"`
 	ContainsVideo           bool                    `json:"contains_video"`
@@ -79,12 +78,21 @@ type PostDoc struct {
 	VideoCount              int                     `json:"video_count"`
 	MediaCount              int                     `json:"media_count"`
 	ExternalEmbed           *ExternalEmbed          `json:"external_embed"`
+	ExternalDomain          string                  `json:"external_domain,omitempty"` // Link card host (see model.Post.ExternalDomain)
 	VideoTranscript         string                  `json:"video_transcript"`
 	VideoTranscriptLanguage string                  `json:"video_transcript_language"`
+	VideoDurationSec        float64                 `json:"video_duration_sec,omitempty"`
+	Source                  string                  `json:"source,omitempty"` // PostSourceJetstream for fallback posts; empty for megastream's
+
+	// Version is the time_us of the event the document was built from, its
+	// external version (see Versioned); 0 when unknown. It is not part of
+	// the document.
+	Version int64 `json:"-"`
 }
 
 func (d PostDoc) esAtURI() string     { return d.AtURI }
 func (d PostDoc) esAuthorDID() string { return d.AuthorDID }
+func (d PostDoc) esVersion() int64    { return d.Version }
 
 // ReplyDoc is the document structure for indexing replies.
 // Includes thread join fields; omits PostEmbeddingModelUUID (replies don't receive post-tower embeddings).
@@ -92,6 +100,8 @@ type ReplyDoc struct {
 	AtURI                   string                  `json:"at_uri"`
 	AuthorDID               string                  `json:"author_did"`
 	Content                 string                  `json:"content"`
+	Langs                   []string                `json:"langs,omitempty"`       // Languages the author declared, as BCP 47 tags
+	SelfLabels              []string                `json:"self_labels,omitempty"` // Labels the author applied, e.g. "porn"
 	CreatedAt               string                  `json:"created_at"`
 	ThreadRootPost          string                  `json:"thread_root_post"`
 	ThreadParentPost        string                  `json:"thread_parent_post"`
@@ -99,6 +109,9 @@ type ReplyDoc struct {
 	Embeddings              map[string]Float32Array `json:"embeddings,omitempty"`
 	IndexedAt               string                  `json:"indexed_at"`
 	LikeCount               int                     `json:"like_count"`
+	ReplyCount              int                     `json:"reply_count"`
+	ThreadReplyCount        int                     `json:"thread_reply_count"`
+	QuoteCount              int                     `json:"quote_count"`
 	Media                   []MediaItem             `json:"media"`
 	ContainsImages          bool                    `json:"contains_images"`
 	ContainsVideo           bool                    `json:"contains_video"`
@@ -106,12 +119,18 @@ type ReplyDoc struct {
 	VideoCount              int                     `json:"video_count"`
 	MediaCount              int                     `json:"media_count"`
 	ExternalEmbed           *ExternalEmbed          `json:"external_embed"`
+	ExternalDomain          string                  `json:"external_domain,omitempty"` // Link card host (see model.Post.ExternalDomain)
 	VideoTranscript         string                  `json:"video_transcript"`
 	VideoTranscriptLanguage string                  `json:"video_transcript_language"`
+	VideoDurationSec        float64                 `json:"video_duration_sec,omitempty"`
+
+	// Version is as for PostDoc
+	Version int64 `json:"-"`
 }
 
 func (d ReplyDoc) esAtURI() string     { return d.AtURI }
 func (d ReplyDoc) esAuthorDID() string { return d.AuthorDID }
+func (d ReplyDoc) esVersion() int64    { return d.Version }
 
 // PostTombstoneDoc represents the document structure for post deletion tombstones
 type PostTombstoneDoc struct {
@@ -119,8 +138,16 @@ type PostTombstoneDoc struct {
 	AuthorDID string `json:"author_did"`
 	DeletedAt string `json:"deleted_at"`
 	IndexedAt string `json:"indexed_at"`
+
+	// Version is the time_us of the delete event, which deletes the post
+	// with it as an external version (see DeleteDoc); 0 when unknown. It is
+	// not part of the document.
+	Version int64 `json:"-"`
 }
 
+func (d PostTombstoneDoc) esAtURI() string     { return d.AtURI }
+func (d PostTombstoneDoc) esAuthorDID() string { return d.AuthorDID }
+
 // LikeDoc represents the document structure for indexing likes
 type LikeDoc struct {
 	AtURI      string `json:"at_uri"`
@@ -128,8 +155,15 @@ type LikeDoc struct {
 	AuthorDID  string `json:"author_did"`
 	CreatedAt  string `json:"created_at"`
 	IndexedAt  string `json:"indexed_at"`
+
+	// Index is the backing index the like is stored in (see IndexRouter),
+	// when known. It is not part of the document.
+	Index string `json:"-"`
 }
 
+func (d LikeDoc) esAtURI() string     { return d.AtURI }
+func (d LikeDoc) esAuthorDID() string { return d.AuthorDID }
+
 // LikeIdentifier holds the at_uri and author_did pair for looking up likes
 type LikeIdentifier struct {
 	AtURI     string
@@ -145,6 +179,50 @@ type LikeTombstoneDoc struct {
 	IndexedAt  string `json:"indexed_at"`
 }
 
+func (d LikeTombstoneDoc) esAtURI() string     { return d.AtURI }
+func (d LikeTombstoneDoc) esAuthorDID() string { return d.AuthorDID }
+
+// FollowDoc represents the document structure for indexing follows. Follows
+// are routed by author_did, so one account's outgoing follows share a shard.
+type FollowDoc struct {
+	AtURI      string `json:"at_uri"`
+	AuthorDID  string `json:"author_did"`
+	SubjectDID string `json:"subject_did"`
+	CreatedAt  string `json:"created_at"`
+	IndexedAt  string `json:"indexed_at"`
+}
+
+func (d FollowDoc) esAtURI() string     { return d.AtURI }
+func (d FollowDoc) esAuthorDID() string { return d.AuthorDID }
+
+// FollowTombstoneDoc represents the document structure for unfollow tombstones
+type FollowTombstoneDoc struct {
+	AtURI      string `json:"at_uri"`
+	AuthorDID  string `json:"author_did"`
+	SubjectDID string `json:"subject_did"`
+	DeletedAt  string `json:"deleted_at"`
+	IndexedAt  string `json:"indexed_at"`
+}
+
+func (d FollowTombstoneDoc) esAtURI() string     { return d.AtURI }
+func (d FollowTombstoneDoc) esAuthorDID() string { return d.AuthorDID }
+
+// RawDoc is a document copied verbatim from another index or cluster. Source
+// is indexed as-is; AtURI and AuthorDID only supply the _id and routing.
+type RawDoc struct {
+	AtURI     string
+	AuthorDID string
+	Source    json.RawMessage
+}
+
+func (d RawDoc) esAtURI() string     { return d.AtURI }
+func (d RawDoc) esAuthorDID() string { return d.AuthorDID }
+
+// MarshalJSON returns the document source unchanged
+func (d RawDoc) MarshalJSON() ([]byte, error) {
+	return d.Source, nil
+}
+
 // HashtagUpdate represents a hashtag count update for a specific hour
 type HashtagUpdate struct {
 	Hashtag string
@@ -156,6 +234,11 @@ type HashtagUpdate struct {
 type DeleteDoc struct {
 	DocID     string
 	AuthorDID string
+	Index     string // Overrides the index passed to BulkDelete when set
+	// Version is the delete's external version, so a delete older than the
+	// indexed document leaves it in place (see Versioned); 0 deletes
+	// unconditionally
+	Version int64
 }
 
 // ElasticsearchConfig holds configuration for Elasticsearch connection
@@ -170,6 +253,9 @@ func NewElasticsearchClient(config ElasticsearchConfig, logger *IngestLogger) (*
 	esConfig := elasticsearch.Config{
 		Addresses: []string{config.URL},
 		APIKey:    config.APIKey,
+		// Spans each request as a child of the span in its context. Uses the
+		// global tracer provider, a no-op unless NewTracerProvider set one.
+		Instrumentation: elasticsearch.NewOpenTelemetryInstrumentation(nil, false),
 	}
 
 	if config.SkipTLSVerify {
@@ -198,198 +284,18 @@ func NewElasticsearchClient(config ElasticsearchConfig, logger *IngestLogger) (*
 	return client, nil
 }
 
-// BulkIndex indexes a batch of PostDoc or ReplyDoc documents to Elasticsearch.
-func BulkIndex[T ESDoc](ctx context.Context, client *elasticsearch.Client, index string, docs []T, dryRun bool, logger *IngestLogger) error {
-	if len(docs) == 0 {
-		return nil
-	}
-
-	if dryRun {
-		logger.Debug("Dry-run: Skipping bulk index of %d documents to index '%s'", len(docs), index)
-		return nil
-	}
-
-	var buf bytes.Buffer
-	validDocCount := 0
-
-	for _, doc := range docs {
-		if doc.esAtURI() == "" {
-			logger.Error("Skipping document with empty at_uri (author_did: %s)", doc.esAuthorDID())
-			continue
-		}
-
-		meta := map[string]interface{}{
-			"index": map[string]interface{}{
-				"_index":  index,
-				"_id":     doc.esAtURI(),
-				"routing": doc.esAuthorDID(),
-			},
-		}
-
-		validDocCount++
-
-		metaJSON, err := json.Marshal(meta)
-		if err != nil {
-			return fmt.Errorf("failed to marshal metadata: %w", err)
-		}
-
-		buf.Write(metaJSON)
-		buf.WriteByte('\n')
-
-		docJSON, err := json.Marshal(doc)
-		if err != nil {
-			return fmt.Errorf("failed to marshal document: %w", err)
-		}
-
-		buf.Write(docJSON)
-		buf.WriteByte('\n')
-	}
-
-	if validDocCount == 0 {
-		logger.Error("No valid documents to index (all had empty at_uri)")
-		return fmt.Errorf("no valid documents in batch")
-	}
-
-	start := time.Now()
-	res, err := client.Bulk(
-		bytes.NewReader(buf.Bytes()),
-		client.Bulk.WithContext(ctx),
-	)
-	logger.Metric("es.bulk_index_posts.duration_ms", float64(time.Since(start).Milliseconds()))
-	if err != nil {
-		return fmt.Errorf("bulk request failed: %w", err)
-	}
-	defer func() {
-		if err := res.Body.Close(); err != nil {
-			logger.Error("Failed to close response body: %v", err)
-		}
-	}()
-
-	if res.IsError() {
-		return fmt.Errorf("bulk request returned error: %s", res.String())
-	}
-
-	var bulkResponse struct {
-		Took   int  `json:"took"`
-		Errors bool `json:"errors"`
-		Items  []map[string]struct {
-			Error *struct {
-				Type   string `json:"type"`
-				Reason string `json:"reason"`
-			} `json:"error"`
-		} `json:"items"`
-	}
-
-	if err := json.NewDecoder(res.Body).Decode(&bulkResponse); err != nil {
-		return fmt.Errorf("failed to parse bulk response: %w", err)
-	}
-
-	logger.Metric("es.bulk_index_posts.took_ms", float64(bulkResponse.Took))
-
-	if bulkResponse.Errors {
-		itemsJSON, _ := json.Marshal(bulkResponse.Items)
-		logger.Error("Bulk indexing failed with errors. Response items: %s", string(itemsJSON))
-		return fmt.Errorf("bulk indexing failed: some documents had errors (see logs for details)")
-	}
-
-	return nil
+// BulkIndex indexes a batch of documents (posts, replies, follows, follow
+// tombstones) to Elasticsearch, routed by author_did.
+func BulkIndex[T Routable](ctx context.Context, client *elasticsearch.Client, index string, docs []T, dryRun bool, logger *IngestLogger) error {
+	return BulkIndexer[T]{Metric: "es.bulk_index_posts"}.Index(ctx, client, index, docs, dryRun, logger)
 }
 
+// postTombstoneIndexer indexes post tombstones
+var postTombstoneIndexer = BulkIndexer[PostTombstoneDoc]{Kind: "tombstone", Metric: "es.bulk_index_tombstones"}
+
 // BulkIndexPostTombstones indexes a batch of post tombstone documents to Elasticsearch
 func BulkIndexPostTombstones(ctx context.Context, client *elasticsearch.Client, index string, docs []PostTombstoneDoc, dryRun bool, logger *IngestLogger) error {
-	if len(docs) == 0 {
-		return nil
-	}
-
-	if dryRun {
-		logger.Debug("Dry-run: Skipping bulk index of %d tombstones to index '%s'", len(docs), index)
-		return nil
-	}
-
-	var buf bytes.Buffer
-	validDocCount := 0
-
-	for _, doc := range docs {
-		if doc.AtURI == "" {
-			logger.Error("Skipping tombstone with empty at_uri (author_did: %s)", doc.AuthorDID)
-			continue
-		}
-
-		meta := map[string]interface{}{
-			"index": map[string]interface{}{
-				"_index":  index,
-				"_id":     doc.AtURI,
-				"routing": doc.AuthorDID,
-			},
-		}
-
-		validDocCount++
-
-		metaJSON, err := json.Marshal(meta)
-		if err != nil {
-			return fmt.Errorf("failed to marshal metadata: %w", err)
-		}
-
-		buf.Write(metaJSON)
-		buf.WriteByte('\n')
-
-		docJSON, err := json.Marshal(doc)
-		if err != nil {
-			return fmt.Errorf("failed to marshal tombstone document: %w", err)
-		}
-
-		buf.Write(docJSON)
-		buf.WriteByte('\n')
-	}
-
-	if validDocCount == 0 {
-		logger.Error("No valid tombstones to index (all had empty at_uri)")
-		return fmt.Errorf("no valid tombstones in batch")
-	}
-
-	start := time.Now()
-	res, err := client.Bulk(
-		bytes.NewReader(buf.Bytes()),
-		client.Bulk.WithContext(ctx),
-	)
-	logger.Metric("es.bulk_index_tombstones.duration_ms", float64(time.Since(start).Milliseconds()))
-	if err != nil {
-		return fmt.Errorf("bulk tombstone request failed: %w", err)
-	}
-	defer func() {
-		if err := res.Body.Close(); err != nil {
-			logger.Error("Failed to close response body: %v", err)
-		}
-	}()
-
-	if res.IsError() {
-		return fmt.Errorf("bulk tombstone request returned error: %s", res.String())
-	}
-
-	var bulkResponse struct {
-		Took   int  `json:"took"`
-		Errors bool `json:"errors"`
-		Items  []map[string]struct {
-			Error *struct {
-				Type   string `json:"type"`
-				Reason string `json:"reason"`
-			} `json:"error"`
-		} `json:"items"`
-	}
-
-	if err := json.NewDecoder(res.Body).Decode(&bulkResponse); err != nil {
-		return fmt.Errorf("failed to parse bulk tombstone response: %w", err)
-	}
-
-	logger.Metric("es.bulk_index_tombstones.took_ms", float64(bulkResponse.Took))
-
-	if bulkResponse.Errors {
-		itemsJSON, _ := json.Marshal(bulkResponse.Items)
-		logger.Error("Bulk tombstone indexing failed with errors. Response items: %s", string(itemsJSON))
-		return fmt.Errorf("bulk tombstone indexing failed: some documents had errors (see logs for details)")
-	}
-
-	return nil
+	return postTombstoneIndexer.Index(ctx, client, index, docs, dryRun, logger)
 }
 
 // BulkDelete deletes a batch of documents from Elasticsearch by their IDs with routing
@@ -412,14 +318,22 @@ func BulkDelete(ctx context.Context, client *elasticsearch.Client, index string,
 			continue
 		}
 
-		meta := map[string]interface{}{
-			"delete": map[string]interface{}{
-				"_index":  index,
-				"_id":     doc.DocID,
-				"routing": doc.AuthorDID,
-			},
+		target := index
+		if doc.Index != "" {
+			target = doc.Index
 		}
 
+		action := map[string]interface{}{
+			"_index":  target,
+			"_id":     doc.DocID,
+			"routing": doc.AuthorDID,
+		}
+		if doc.Version > 0 {
+			action["version"] = doc.Version
+			action["version_type"] = externalVersionType
+		}
+		meta := map[string]interface{}{"delete": action}
+
 		validDocCount++
 
 		metaJSON, err := json.Marshal(meta)
@@ -475,14 +389,24 @@ func BulkDelete(ctx context.Context, client *elasticsearch.Client, index string,
 
 	if bulkResponse.Errors {
 		hasRealErrors := false
+		stale := 0
 		for _, item := range bulkResponse.Items {
 			for _, details := range item {
-				if details.Error != nil && details.Status != 404 {
-					hasRealErrors = true
-					break
+				if details.Error == nil || details.Status == 404 {
+					continue
+				}
+				// A versioned delete older than the document leaves it in place
+				if details.Status == http.StatusConflict && details.Error.Type == "version_conflict_engine_exception" {
+					stale++
+					continue
 				}
+				hasRealErrors = true
 			}
 		}
+		if stale > 0 {
+			logger.Metric("es.bulk_delete_stale_count", float64(stale))
+			logger.Debug("Skipped %d deletes older than the indexed version", stale)
+		}
 
 		if hasRealErrors {
 			itemsJSON, _ := json.Marshal(bulkResponse.Items)
@@ -494,248 +418,300 @@ func BulkDelete(ctx context.Context, client *elasticsearch.Client, index string,
 	return nil
 }
 
-func msgEmbeddings(msg MegaStreamMessage) map[string]Float32Array {
-	raw := msg.GetEmbeddings()
-	if raw == nil {
-		return nil
-	}
-	out := make(map[string]Float32Array, len(raw))
-	for k, v := range raw {
-		out[k] = Float32Array(v)
-	}
-	return out
-}
-
-func msgMediaCounts(msg MegaStreamMessage) (media []MediaItem, imageCount, videoCount, mediaCount int, containsImages, containsVideo bool) {
-	media = msg.GetMedia()
-	for _, item := range media {
-		switch item.MediaType {
-		case "image":
-			imageCount++
-		case "video":
-			videoCount++
-		}
-	}
-	mediaCount = len(media)
-	containsImages = imageCount > 0
-	containsVideo = videoCount > 0
-	return
-}
-
 // CreatePostDoc creates a PostDoc from a MegaStreamMessage for indexing into posts-*.
 func CreatePostDoc(msg MegaStreamMessage, likeCount int) PostDoc {
-	media, imageCount, videoCount, mediaCount, containsImages, containsVideo := msgMediaCounts(msg)
-	return PostDoc{
-		AtURI:                   msg.GetAtURI(),
-		AuthorDID:               msg.GetAuthorDID(),
-		Content:                 msg.GetContent(),
-		CreatedAt:               msg.GetCreatedAt(),
-		QuotePost:               msg.GetQuotePost(),
-		Embeddings:              msgEmbeddings(msg),
-		IndexedAt:               time.Now().UTC().Format(time.RFC3339),
-		LikeCount:               likeCount,
-		Media:                   media,
-		ContainsImages:          containsImages,
-		ContainsVideo:           containsVideo,
-		ImageCount:              imageCount,
-		VideoCount:              videoCount,
-		MediaCount:              mediaCount,
-		ExternalEmbed:           msg.GetExternalEmbed(),
-		VideoTranscript:         msg.GetVideoTranscript(),
-		VideoTranscriptLanguage: msg.GetVideoTranscriptLanguage(),
-	}
+	post := PostFromMegaStream(msg)
+	post.LikeCount = likeCount
+	doc := NewPostDoc(post)
+	doc.Version = msg.GetTimeUs()
+	return doc
 }
 
 // CreateReplyDoc creates a ReplyDoc from a MegaStreamMessage for indexing into replies-*.
 func CreateReplyDoc(msg MegaStreamMessage, likeCount int) ReplyDoc {
-	media, imageCount, videoCount, mediaCount, containsImages, containsVideo := msgMediaCounts(msg)
-	return ReplyDoc{
-		AtURI:                   msg.GetAtURI(),
-		AuthorDID:               msg.GetAuthorDID(),
-		Content:                 msg.GetContent(),
-		CreatedAt:               msg.GetCreatedAt(),
-		ThreadRootPost:          msg.GetThreadRootPost(),
-		ThreadParentPost:        msg.GetThreadParentPost(),
-		QuotePost:               msg.GetQuotePost(),
-		Embeddings:              msgEmbeddings(msg),
-		IndexedAt:               time.Now().UTC().Format(time.RFC3339),
-		LikeCount:               likeCount,
-		Media:                   media,
-		ContainsImages:          containsImages,
-		ContainsVideo:           containsVideo,
-		ImageCount:              imageCount,
-		VideoCount:              videoCount,
-		MediaCount:              mediaCount,
-		ExternalEmbed:           msg.GetExternalEmbed(),
-		VideoTranscript:         msg.GetVideoTranscript(),
-		VideoTranscriptLanguage: msg.GetVideoTranscriptLanguage(),
-	}
+	post := PostFromMegaStream(msg)
+	post.LikeCount = likeCount
+	doc := NewReplyDoc(post)
+	doc.Version = msg.GetTimeUs()
+	return doc
 }
 
 // CreatePostTombstoneDoc creates a PostTombstoneDoc from a MegaStreamMessage
 func CreatePostTombstoneDoc(msg MegaStreamMessage) PostTombstoneDoc {
-	now := time.Now().UTC()
-	deletedAt := now
-
-	if timeUs := msg.GetTimeUs(); timeUs > 0 {
-		deletedAt = time.Unix(0, timeUs*1000)
-	}
-
-	return PostTombstoneDoc{
-		AtURI:     msg.GetAtURI(),
-		AuthorDID: msg.GetAuthorDID(),
-		DeletedAt: deletedAt.Format(time.RFC3339),
-		IndexedAt: now.Format(time.RFC3339),
-	}
+	doc := NewPostTombstoneDoc(PostTombstoneFromMegaStream(msg))
+	doc.Version = msg.GetTimeUs()
+	return doc
 }
 
 // CreateLikeDoc creates a LikeDoc from a JetstreamMessage
 func CreateLikeDoc(msg JetstreamMessage) LikeDoc {
-	return LikeDoc{
-		AtURI:      msg.GetAtURI(),
-		SubjectURI: msg.GetSubjectURI(),
-		AuthorDID:  msg.GetAuthorDID(),
-		CreatedAt:  msg.GetCreatedAt(),
-		IndexedAt:  time.Now().UTC().Format(time.RFC3339),
-	}
+	return NewLikeDoc(LikeFromJetstream(msg))
 }
 
 // CreateLikeTombstoneDoc creates a LikeTombstoneDoc from a JetstreamMessage and subject URI
 func CreateLikeTombstoneDoc(msg JetstreamMessage, subjectURI string) LikeTombstoneDoc {
-	now := time.Now().UTC()
-	deletedAt := now
-
-	if timeUs := msg.GetTimeUs(); timeUs > 0 {
-		deletedAt = time.Unix(0, timeUs*1000)
-	}
+	return NewLikeTombstoneDoc(LikeTombstoneFromJetstream(msg, subjectURI))
+}
 
-	return LikeTombstoneDoc{
+// CreateFollowDoc creates a FollowDoc from a JetstreamMessage
+func CreateFollowDoc(msg JetstreamMessage) FollowDoc {
+	return FollowDoc{
 		AtURI:      msg.GetAtURI(),
 		AuthorDID:  msg.GetAuthorDID(),
-		SubjectURI: subjectURI,
-		DeletedAt:  deletedAt.Format(time.RFC3339),
-		IndexedAt:  now.Format(time.RFC3339),
+		SubjectDID: msg.GetSubjectDID(),
+		CreatedAt:  msg.GetCreatedAt(),
+		IndexedAt:  time.Now().UTC().Format(time.RFC3339),
 	}
 }
 
-// BulkIndexLikes indexes a batch of like documents to Elasticsearch
+// CreateFollowTombstoneDoc creates a FollowTombstoneDoc from a JetstreamMessage and subject DID
+func CreateFollowTombstoneDoc(msg JetstreamMessage, subjectDID string) FollowTombstoneDoc {
+	return NewFollowTombstoneDoc(FollowTombstoneFromJetstream(msg, subjectDID))
+}
+
+// likeIndexer indexes likes, each to its own Index when set
+var likeIndexer = BulkIndexer[LikeDoc]{
+	Kind:   "like",
+	Metric: "es.bulk_index_likes",
+	Target: func(doc LikeDoc, index string) string {
+		if doc.Index != "" {
+			return doc.Index
+		}
+		return index
+	},
+}
+
+// BulkIndexLikes indexes a batch of like documents to Elasticsearch. Likes
+// with Index set (see IndexRouter.Route) go to that index instead of index.
 func BulkIndexLikes(ctx context.Context, client *elasticsearch.Client, index string, docs []LikeDoc, dryRun bool, logger *IngestLogger) error {
-	if len(docs) == 0 {
-		return nil
-	}
+	return likeIndexer.Index(ctx, client, index, docs, dryRun, logger)
+}
 
-	if dryRun {
-		logger.Debug("Dry-run: Skipping bulk index of %d likes to index '%s'", len(docs), index)
-		return nil
+// BulkGetLikes fetches multiple like documents from Elasticsearch by at_uri
+// with routing, setting each like's Index to the backing index it was found
+// in. index is normally the likes read alias, which spans several indices
+// (see IndexRouter), so it searches by ID rather than using mget, which
+// needs a single concrete index.
+func BulkGetLikes(ctx context.Context, client *elasticsearch.Client, index string, likeIDs []LikeIdentifier, logger *IngestLogger) (map[string]LikeDoc, error) {
+	ids := make([]string, 0, len(likeIDs))
+	routing := make(map[string]bool)
+	missingAuthor := false
+	for _, id := range likeIDs {
+		if id.AtURI == "" {
+			continue
+		}
+		ids = append(ids, id.AtURI)
+		if id.AuthorDID == "" {
+			missingAuthor = true
+		} else {
+			routing[id.AuthorDID] = true
+		}
+	}
+	if len(ids) == 0 {
+		return make(map[string]LikeDoc), nil
 	}
 
-	var buf bytes.Buffer
-	validDocCount := 0
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"ids": map[string]interface{}{"values": ids},
+		},
+		"size": len(ids),
+	}
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal like lookup: %w", err)
+	}
 
-	for _, doc := range docs {
-		if doc.AtURI == "" {
-			logger.Error("Skipping like with empty at_uri (author_did: %s)", doc.AuthorDID)
-			continue
+	// Only the authors' shards need searching, unless a like has no author
+	var authors []string
+	if !missingAuthor {
+		for did := range routing {
+			authors = append(authors, did)
 		}
+	}
 
-		meta := map[string]interface{}{
-			"index": map[string]interface{}{
-				"_index":  index,
-				"_id":     doc.AtURI,
-				"routing": doc.AuthorDID,
-			},
+	start := time.Now()
+	res, err := client.Search(
+		client.Search.WithContext(ctx),
+		client.Search.WithIndex(index),
+		client.Search.WithBody(bytes.NewReader(queryJSON)),
+		client.Search.WithRouting(authors...),
+	)
+	logger.Metric("es.bulk_get_likes.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("like lookup request failed: %w", err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			logger.Error("Failed to close like lookup response body: %v", err)
 		}
+	}()
 
-		validDocCount++
+	if res.IsError() {
+		return nil, fmt.Errorf("like lookup returned error: %s", res.String())
+	}
 
-		metaJSON, err := json.Marshal(meta)
-		if err != nil {
-			return fmt.Errorf("failed to marshal metadata: %w", err)
+	var searchResponse struct {
+		Hits struct {
+			Hits []struct {
+				Index  string  `json:"_index"`
+				ID     string  `json:"_id"`
+				Source LikeDoc `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&searchResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse like lookup response: %w", err)
+	}
+
+	result := make(map[string]LikeDoc, len(searchResponse.Hits.Hits))
+	for _, hit := range searchResponse.Hits.Hits {
+		like := hit.Source
+		like.Index = hit.Index
+		result[hit.ID] = like
+	}
+	for _, id := range ids {
+		if _, found := result[id]; !found {
+			logger.Debug("Like document not found for deletion: at_uri=%s", id)
 		}
+	}
 
-		buf.Write(metaJSON)
-		buf.WriteByte('\n')
+	return result, nil
+}
 
-		docJSON, err := json.Marshal(doc)
-		if err != nil {
-			return fmt.Errorf("failed to marshal like document: %w", err)
+// BulkGetFollows fetches multiple follow documents from Elasticsearch by at_uri with routing
+func BulkGetFollows(ctx context.Context, client *elasticsearch.Client, index string, refs []DeleteDoc, logger *IngestLogger) (map[string]FollowDoc, error) {
+	return bulkGet[FollowDoc](ctx, client, index, refs, "es.bulk_get_follows.duration_ms", "Follow", logger)
+}
+
+// FetchPostReferences returns the thread and quote references of the
+// posts and replies refs name, keyed by at_uri, so that deleting them can
+// undo their reply and quote counts (see PostCounter.AddReferences). index
+// is normally "posts,replies", whose read aliases span several indices, so
+// it searches by ID rather than using mget. Documents that are not found are
+// omitted.
+func FetchPostReferences(ctx context.Context, client *elasticsearch.Client, index string, refs []DeleteDoc, logger *IngestLogger) (map[string]PostData, error) {
+	return searchPostsByID(ctx, client, index, refs, []string{"thread_root_post", "thread_parent_post", "quote_post"}, "es.fetch_post_references.duration_ms", "post reference lookup", logger)
+}
+
+// FetchPosts returns the posts and replies at atURIs, keyed by at_uri, with
+// their content, languages, self-labels, references, and embeddings. Like
+// FetchPostReferences, it searches index by ID, routed to each post's author
+// (the DID in its AT-URI). Posts that are not found are omitted.
+func FetchPosts(ctx context.Context, client *elasticsearch.Client, index string, atURIs []string, logger *IngestLogger) (map[string]PostData, error) {
+	refs := make([]DeleteDoc, len(atURIs))
+	for i, atURI := range atURIs {
+		refs[i] = DeleteDoc{DocID: atURI, AuthorDID: ExtractDIDFromATURI(atURI)}
+	}
+	source := []string{"at_uri", "author_did", "content", "langs", "self_labels", "created_at", "indexed_at", "thread_root_post", "thread_parent_post", "quote_post", "embeddings"}
+	return searchPostsByID(ctx, client, index, refs, source, "es.fetch_posts.duration_ms", "post lookup", logger)
+}
+
+// searchPostsByID searches index for the posts refs name, returning the
+// source fields of each found post, keyed by at_uri. The search is routed
+// to the refs' authors unless a ref has none.
+func searchPostsByID(ctx context.Context, client *elasticsearch.Client, index string, refs []DeleteDoc, source []string, metricName, kind string, logger *IngestLogger) (map[string]PostData, error) {
+	ids := make([]string, 0, len(refs))
+	routing := make(map[string]bool)
+	missingAuthor := false
+	for _, ref := range refs {
+		if ref.DocID == "" {
+			continue
+		}
+		ids = append(ids, ref.DocID)
+		if ref.AuthorDID == "" {
+			missingAuthor = true
+		} else {
+			routing[ref.AuthorDID] = true
 		}
+	}
+	if len(ids) == 0 {
+		return make(map[string]PostData), nil
+	}
 
-		buf.Write(docJSON)
-		buf.WriteByte('\n')
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"ids": map[string]interface{}{"values": ids},
+		},
+		"_source": source,
+		"size":    len(ids),
+	}
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %w", kind, err)
 	}
 
-	if validDocCount == 0 {
-		logger.Error("No valid likes to index (all had empty at_uri)")
-		return fmt.Errorf("no valid likes in batch")
+	// Only the authors' shards need searching, unless a post has no author
+	var authors []string
+	if !missingAuthor {
+		for did := range routing {
+			authors = append(authors, did)
+		}
 	}
 
 	start := time.Now()
-	res, err := client.Bulk(
-		bytes.NewReader(buf.Bytes()),
-		client.Bulk.WithContext(ctx),
+	res, err := client.Search(
+		client.Search.WithContext(ctx),
+		client.Search.WithIndex(index),
+		client.Search.WithBody(bytes.NewReader(queryJSON)),
+		client.Search.WithRouting(authors...),
+		client.Search.WithIgnoreUnavailable(true),
 	)
-	logger.Metric("es.bulk_index_likes.duration_ms", float64(time.Since(start).Milliseconds()))
+	logger.Metric(metricName, float64(time.Since(start).Milliseconds()))
 	if err != nil {
-		return fmt.Errorf("bulk like request failed: %w", err)
+		return nil, fmt.Errorf("%s request failed: %w", kind, err)
 	}
 	defer func() {
 		if err := res.Body.Close(); err != nil {
-			logger.Error("Failed to close response body: %v", err)
+			logger.Error("Failed to close %s response body: %v", kind, err)
 		}
 	}()
 
 	if res.IsError() {
-		return fmt.Errorf("bulk like request returned error: %s", res.String())
+		return nil, fmt.Errorf("%s returned error: %s", kind, res.String())
 	}
 
-	var bulkResponse struct {
-		Took   int  `json:"took"`
-		Errors bool `json:"errors"`
-		Items  []map[string]struct {
-			Error *struct {
-				Type   string `json:"type"`
-				Reason string `json:"reason"`
-			} `json:"error"`
-		} `json:"items"`
+	var searchResponse struct {
+		Hits struct {
+			Hits []struct {
+				ID     string   `json:"_id"`
+				Source PostData `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
 	}
-
-	if err := json.NewDecoder(res.Body).Decode(&bulkResponse); err != nil {
-		return fmt.Errorf("failed to parse bulk like response: %w", err)
+	if err := json.NewDecoder(res.Body).Decode(&searchResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse %s response: %w", kind, err)
 	}
 
-	logger.Metric("es.bulk_index_likes.took_ms", float64(bulkResponse.Took))
-
-	if bulkResponse.Errors {
-		itemsJSON, _ := json.Marshal(bulkResponse.Items)
-		logger.Error("Bulk like indexing failed with errors. Response items: %s", string(itemsJSON))
-		return fmt.Errorf("bulk like indexing failed: some documents had errors (see logs for details)")
+	result := make(map[string]PostData, len(searchResponse.Hits.Hits))
+	for _, hit := range searchResponse.Hits.Hits {
+		result[hit.ID] = hit.Source
 	}
-
-	return nil
+	return result, nil
 }
 
-// BulkGetLikes fetches multiple like documents from Elasticsearch by at_uri with routing
-func BulkGetLikes(ctx context.Context, client *elasticsearch.Client, index string, likeIDs []LikeIdentifier, logger *IngestLogger) (map[string]LikeDoc, error) {
-	if len(likeIDs) == 0 {
-		return make(map[string]LikeDoc), nil
+// bulkGet fetches documents by ID with an mget request, keyed by ID. Documents
+// that are not found are omitted from the result.
+func bulkGet[T any](ctx context.Context, client *elasticsearch.Client, index string, refs []DeleteDoc, metricName, kind string, logger *IngestLogger) (map[string]T, error) {
+	if len(refs) == 0 {
+		return make(map[string]T), nil
 	}
 
 	// Build mget request with proper docs array structure
-	docs := make([]map[string]interface{}, 0, len(likeIDs))
-	for _, id := range likeIDs {
-		if id.AtURI == "" {
+	docs := make([]map[string]interface{}, 0, len(refs))
+	for _, ref := range refs {
+		if ref.DocID == "" {
 			continue
 		}
 
 		doc := map[string]interface{}{
 			"_index": index,
-			"_id":    id.AtURI,
+			"_id":    ref.DocID,
 		}
 
 		// Add routing if author_did is provided
-		if id.AuthorDID != "" {
-			doc["routing"] = id.AuthorDID
+		if ref.AuthorDID != "" {
+			doc["routing"] = ref.AuthorDID
 		}
 
 		docs = append(docs, doc)
@@ -757,7 +733,7 @@ func BulkGetLikes(ctx context.Context, client *elasticsearch.Client, index strin
 		bytes.NewReader(bodyJSON),
 		client.Mget.WithContext(ctx),
 	)
-	logger.Metric("es.bulk_get_likes.duration_ms", float64(time.Since(start).Milliseconds()))
+	logger.Metric(metricName, float64(time.Since(start).Milliseconds()))
 	if err != nil {
 		return nil, fmt.Errorf("mget request failed: %w", err)
 	}
@@ -774,129 +750,45 @@ func BulkGetLikes(ctx context.Context, client *elasticsearch.Client, index strin
 	// Parse response
 	var mgetResponse struct {
 		Docs []struct {
-			ID     string  `json:"_id"`
-			Found  bool    `json:"found"`
-			Source LikeDoc `json:"_source"`
+			ID     string `json:"_id"`
+			Found  bool   `json:"found"`
+			Source T      `json:"_source"`
 		} `json:"docs"`
 	}
 
-	if err := json.NewDecoder(res.Body).Decode(&mgetResponse); err != nil {
-		return nil, fmt.Errorf("failed to parse mget response: %w", err)
-	}
-
-	// Build result map
-	result := make(map[string]LikeDoc)
-	for _, doc := range mgetResponse.Docs {
-		if doc.Found {
-			result[doc.ID] = doc.Source
-		} else {
-			logger.Debug("Like document not found for deletion: at_uri=%s", doc.ID)
-		}
-	}
-
-	return result, nil
-}
-
-// BulkIndexLikeTombstones indexes a batch of like tombstone documents to Elasticsearch
-func BulkIndexLikeTombstones(ctx context.Context, client *elasticsearch.Client, index string, docs []LikeTombstoneDoc, dryRun bool, logger *IngestLogger) error {
-	if len(docs) == 0 {
-		return nil
-	}
-
-	if dryRun {
-		logger.Debug("Dry-run: Skipping bulk index of %d like tombstones to index '%s'", len(docs), index)
-		return nil
-	}
-
-	var buf bytes.Buffer
-	validDocCount := 0
-
-	for _, doc := range docs {
-		if doc.AtURI == "" {
-			logger.Error("Skipping like tombstone with empty at_uri (author_did: %s)", doc.AuthorDID)
-			continue
-		}
-
-		if doc.SubjectURI == "" {
-			logger.Error("Skipping like tombstone with empty subject_uri (at_uri: %s)", doc.AtURI)
-			continue
-		}
-
-		meta := map[string]interface{}{
-			"index": map[string]interface{}{
-				"_index":  index,
-				"_id":     doc.AtURI,
-				"routing": doc.AuthorDID,
-			},
-		}
-
-		validDocCount++
-
-		metaJSON, err := json.Marshal(meta)
-		if err != nil {
-			return fmt.Errorf("failed to marshal metadata: %w", err)
-		}
-
-		buf.Write(metaJSON)
-		buf.WriteByte('\n')
-
-		docJSON, err := json.Marshal(doc)
-		if err != nil {
-			return fmt.Errorf("failed to marshal like tombstone document: %w", err)
-		}
-
-		buf.Write(docJSON)
-		buf.WriteByte('\n')
-	}
-
-	if validDocCount == 0 {
-		logger.Error("No valid like tombstones to index (all had empty at_uri or subject_uri)")
-		return fmt.Errorf("no valid like tombstones in batch")
-	}
-
-	start := time.Now()
-	res, err := client.Bulk(
-		bytes.NewReader(buf.Bytes()),
-		client.Bulk.WithContext(ctx),
-	)
-	logger.Metric("es.bulk_index_like_tombstones.duration_ms", float64(time.Since(start).Milliseconds()))
-	if err != nil {
-		return fmt.Errorf("bulk like tombstone request failed: %w", err)
-	}
-	defer func() {
-		if err := res.Body.Close(); err != nil {
-			logger.Error("Failed to close response body: %v", err)
-		}
-	}()
-
-	if res.IsError() {
-		return fmt.Errorf("bulk like tombstone request returned error: %s", res.String())
-	}
-
-	var bulkResponse struct {
-		Took   int  `json:"took"`
-		Errors bool `json:"errors"`
-		Items  []map[string]struct {
-			Error *struct {
-				Type   string `json:"type"`
-				Reason string `json:"reason"`
-			} `json:"error"`
-		} `json:"items"`
+	if err := json.NewDecoder(res.Body).Decode(&mgetResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse mget response: %w", err)
 	}
 
-	if err := json.NewDecoder(res.Body).Decode(&bulkResponse); err != nil {
-		return fmt.Errorf("failed to parse bulk like tombstone response: %w", err)
+	// Build result map
+	result := make(map[string]T)
+	for _, doc := range mgetResponse.Docs {
+		if doc.Found {
+			result[doc.ID] = doc.Source
+		} else {
+			logger.Debug("%s document not found for deletion: at_uri=%s", kind, doc.ID)
+		}
 	}
 
-	logger.Metric("es.bulk_index_like_tombstones.took_ms", float64(bulkResponse.Took))
+	return result, nil
+}
 
-	if bulkResponse.Errors {
-		itemsJSON, _ := json.Marshal(bulkResponse.Items)
-		logger.Error("Bulk like tombstone indexing failed with errors. Response items: %s", string(itemsJSON))
-		return fmt.Errorf("bulk like tombstone indexing failed: some documents had errors (see logs for details)")
-	}
+// likeTombstoneIndexer indexes like tombstones, skipping any without the
+// liked post's URI
+var likeTombstoneIndexer = BulkIndexer[LikeTombstoneDoc]{
+	Kind:   "like tombstone",
+	Metric: "es.bulk_index_like_tombstones",
+	Skip: func(doc LikeTombstoneDoc) string {
+		if doc.SubjectURI == "" {
+			return "empty subject_uri"
+		}
+		return ""
+	},
+}
 
-	return nil
+// BulkIndexLikeTombstones indexes a batch of like tombstone documents to Elasticsearch
+func BulkIndexLikeTombstones(ctx context.Context, client *elasticsearch.Client, index string, docs []LikeTombstoneDoc, dryRun bool, logger *IngestLogger) error {
+	return likeTombstoneIndexer.Index(ctx, client, index, docs, dryRun, logger)
 }
 
 // SearchResponse represents the response from an Elasticsearch search query
@@ -942,6 +834,8 @@ type PostData struct {
 	AtURI            string               `json:"at_uri"`
 	AuthorDID        string               `json:"author_did"`
 	Content          string               `json:"content"`
+	Langs            []string             `json:"langs,omitempty"`
+	SelfLabels       []string             `json:"self_labels,omitempty"`
 	CreatedAt        string               `json:"created_at"`
 	ThreadRootPost   string               `json:"thread_root_post,omitempty"`
 	ThreadParentPost string               `json:"thread_parent_post,omitempty"`
@@ -989,6 +883,28 @@ type LikeSearchResponse struct {
 	Hits     LikeHits   `json:"hits"`
 }
 
+// FollowHit represents a follow search hit from Elasticsearch
+type FollowHit struct {
+	Index  string        `json:"_index"`
+	ID     string        `json:"_id"`
+	Sort   []interface{} `json:"sort,omitempty"`
+	Source FollowDoc     `json:"_source"`
+}
+
+// FollowHits contains the follow search results
+type FollowHits struct {
+	Total TotalHits   `json:"total"`
+	Hits  []FollowHit `json:"hits"`
+}
+
+// FollowSearchResponse represents the response from an Elasticsearch follow search query
+type FollowSearchResponse struct {
+	Took     int        `json:"took"`
+	TimedOut bool       `json:"timed_out"`
+	Shards   ShardsInfo `json:"_shards"`
+	Hits     FollowHits `json:"hits"`
+}
+
 // HashtagHit represents a hashtag search hit from Elasticsearch
 type HashtagHit struct {
 	ID     string        `json:"_id"`
@@ -1018,23 +934,45 @@ type HashtagSearchResponse struct {
 	Hits     HashtagHits `json:"hits"`
 }
 
-// FetchPosts queries Elasticsearch with pagination using search_after
-// Parameters:
-//   - client: Elasticsearch client
-//   - logger: Logger for debug/error messages
-//   - index: Index name to query
-//   - startTime, endTime: optional time range filter on created_at field (RFC3339 format)
-//   - afterCreatedAt, afterIndexedAt: pagination cursors (both required if either provided)
-//   - size: number of results to fetch (defaults to 1000 if 0)
-func FetchPosts(ctx context.Context, client *elasticsearch.Client, logger *IngestLogger, index string, startTime string, endTime string, afterCreatedAt string, afterIndexedAt string, size int) (SearchResponse, error) {
-	var response SearchResponse
+// Time fields an export can be windowed and sorted on
+const (
+	TimeFieldCreatedAt = "created_at" // When the record was created; late-indexed records land in past windows
+	TimeFieldIndexedAt = "indexed_at" // When the record was indexed; every record lands in the window it was ingested in
+)
 
-	if size <= 0 {
-		size = 1000
+// ValidateTimeField returns an error unless timeField is TimeFieldCreatedAt or TimeFieldIndexedAt
+func ValidateTimeField(timeField string) error {
+	if timeField != TimeFieldCreatedAt && timeField != TimeFieldIndexedAt {
+		return fmt.Errorf("invalid time field %q (expected %s or %s)", timeField, TimeFieldCreatedAt, TimeFieldIndexedAt)
+	}
+	return nil
+}
+
+// SortCursor returns the search_after values of a record with createdAt and
+// indexedAt for a fetch sorted on timeField: timeField first, then the other
+// timestamp as a tiebreak
+func SortCursor(timeField, createdAt, indexedAt string) (string, string) {
+	if timeField == TimeFieldIndexedAt {
+		return indexedAt, createdAt
 	}
+	return createdAt, indexedAt
+}
+
+// timeFieldSort returns the sort clause matching SortCursor
+func timeFieldSort(timeField string) []interface{} {
+	first, tiebreak := SortCursor(timeField, TimeFieldCreatedAt, TimeFieldIndexedAt)
+	return []interface{}{
+		map[string]interface{}{first: "asc"},
+		map[string]interface{}{tiebreak: "asc"},
+	}
+}
 
-	// Build query based on whether time range is specified
-	var queryClause map[string]interface{}
+// exportQuery returns the query of an export fetch: records within the
+// optional window on timeField that match filter, sorted to match SortCursor
+func exportQuery(startTime, endTime, timeField string, filter ExportFilter, size int) map[string]interface{} {
+	queryClause := map[string]interface{}{
+		"match_all": map[string]interface{}{},
+	}
 	if startTime != "" || endTime != "" {
 		rangeQuery := map[string]interface{}{}
 		if startTime != "" {
@@ -1045,76 +983,107 @@ func FetchPosts(ctx context.Context, client *elasticsearch.Client, logger *Inges
 		}
 		queryClause = map[string]interface{}{
 			"range": map[string]interface{}{
-				"created_at": rangeQuery,
+				timeField: rangeQuery,
 			},
 		}
-	} else {
-		queryClause = map[string]interface{}{
-			"match_all": map[string]interface{}{},
+	}
+
+	if !filter.IsZero() {
+		filters, must := filter.clauses()
+		if _, all := queryClause["match_all"]; !all {
+			filters = append([]interface{}{queryClause}, filters...)
+		}
+		boolQuery := map[string]interface{}{}
+		if len(filters) > 0 {
+			boolQuery["filter"] = filters
 		}
+		if len(must) > 0 {
+			boolQuery["must"] = must
+		}
+		queryClause = map[string]interface{}{"bool": boolQuery}
 	}
 
-	query := map[string]interface{}{
+	return map[string]interface{}{
 		"query": queryClause,
-		"sort": []interface{}{
-			map[string]interface{}{"created_at": "asc"},
-			map[string]interface{}{"indexed_at": "asc"},
-		},
-		"size": size,
+		"sort":  timeFieldSort(timeField),
+		"size":  size,
 	}
+}
 
-	if afterCreatedAt != "" && afterIndexedAt != "" {
-		query["search_after"] = []interface{}{afterCreatedAt, afterIndexedAt}
-	}
+// PostTombstoneHit represents a single post tombstone search hit
+type PostTombstoneHit struct {
+	Index  string           `json:"_index"`
+	ID     string           `json:"_id"`
+	Sort   []interface{}    `json:"sort,omitempty"`
+	Source PostTombstoneDoc `json:"_source"`
+}
 
-	queryJSON, err := json.Marshal(query)
-	if err != nil {
-		return response, fmt.Errorf("failed to marshal query: %w", err)
-	}
+// PostTombstoneSearchResponse represents the response from an Elasticsearch post tombstone search query
+type PostTombstoneSearchResponse struct {
+	Took     int        `json:"took"`
+	TimedOut bool       `json:"timed_out"`
+	Shards   ShardsInfo `json:"_shards"`
+	Hits     struct {
+		Total TotalHits          `json:"total"`
+		Hits  []PostTombstoneHit `json:"hits"`
+	} `json:"hits"`
+}
 
-	logger.Debug("Executing search query on index '%s': %s", index, string(queryJSON))
+// LikeTombstoneHit represents a single like tombstone search hit
+type LikeTombstoneHit struct {
+	Index  string           `json:"_index"`
+	ID     string           `json:"_id"`
+	Sort   []interface{}    `json:"sort,omitempty"`
+	Source LikeTombstoneDoc `json:"_source"`
+}
 
-	start := time.Now()
-	res, err := client.Search(
-		client.Search.WithContext(ctx),
-		client.Search.WithIndex(index),
-		client.Search.WithBody(bytes.NewReader(queryJSON)),
-	)
-	logger.Metric("es.fetch_posts.duration_ms", float64(time.Since(start).Milliseconds()))
-	if err != nil {
-		return response, fmt.Errorf("search request failed: %w", err)
-	}
-	defer func() {
-		if err := res.Body.Close(); err != nil {
-			logger.Error("Failed to close search response body: %v", err)
-		}
-	}()
+// LikeTombstoneSearchResponse represents the response from an Elasticsearch like tombstone search query
+type LikeTombstoneSearchResponse struct {
+	Took     int        `json:"took"`
+	TimedOut bool       `json:"timed_out"`
+	Shards   ShardsInfo `json:"_shards"`
+	Hits     struct {
+		Total TotalHits          `json:"total"`
+		Hits  []LikeTombstoneHit `json:"hits"`
+	} `json:"hits"`
+}
 
-	if res.IsError() {
-		return response, fmt.Errorf("search request returned error: %s", res.String())
-	}
+// FetchPostTombstones queries Elasticsearch for post or reply tombstones with
+// pagination using search_after. The optional time range (RFC3339) and the
+// cursor are on deleted_at, with indexed_at as the cursor's tiebreak.
+func FetchPostTombstones(ctx context.Context, client *elasticsearch.Client, logger *IngestLogger, index string, startTime string, endTime string, afterDeletedAt string, afterIndexedAt string, size int) (PostTombstoneSearchResponse, error) {
+	var response PostTombstoneSearchResponse
+	err := fetchTombstones(ctx, client, logger, "fetch_post_tombstones", index, startTime, endTime, afterDeletedAt, afterIndexedAt, size, &response)
+	if err == nil {
+		logger.Metric("es.fetch_post_tombstones.took_ms", float64(response.Took))
+		logger.Debug("Post tombstone search returned %d hits (total: %d)", len(response.Hits.Hits), response.Hits.Total.Value)
+	}
+	return response, err
+}
 
-	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
-		return response, fmt.Errorf("failed to parse search response: %w", err)
+// FetchLikeTombstones queries Elasticsearch for like tombstones with
+// pagination using search_after. Parameters mirror FetchPostTombstones.
+func FetchLikeTombstones(ctx context.Context, client *elasticsearch.Client, logger *IngestLogger, index string, startTime string, endTime string, afterDeletedAt string, afterIndexedAt string, size int) (LikeTombstoneSearchResponse, error) {
+	var response LikeTombstoneSearchResponse
+	err := fetchTombstones(ctx, client, logger, "fetch_like_tombstones", index, startTime, endTime, afterDeletedAt, afterIndexedAt, size, &response)
+	if err == nil {
+		logger.Metric("es.fetch_like_tombstones.took_ms", float64(response.Took))
+		logger.Debug("Like tombstone search returned %d hits (total: %d)", len(response.Hits.Hits), response.Hits.Total.Value)
 	}
-
-	logger.Metric("es.fetch_posts.took_ms", float64(response.Took))
-	logger.Debug("Search returned %d hits (total: %d)", len(response.Hits.Hits), response.Hits.Total.Value)
-
-	return response, nil
+	return response, err
 }
 
-// FetchLikes queries Elasticsearch for likes with pagination using search_after
-// Parameters mirror FetchPosts but return LikeSearchResponse
-func FetchLikes(ctx context.Context, client *elasticsearch.Client, logger *IngestLogger, index string, startTime string, endTime string, afterCreatedAt string, afterIndexedAt string, size int) (LikeSearchResponse, error) {
-	var response LikeSearchResponse
-
+// fetchTombstones runs one page of a tombstone search sorted by deleted_at
+// and indexed_at, decoding the response into response. metric names the
+// duration metric.
+func fetchTombstones(ctx context.Context, client *elasticsearch.Client, logger *IngestLogger, metric, index, startTime, endTime, afterDeletedAt, afterIndexedAt string, size int, response interface{}) error {
 	if size <= 0 {
 		size = 1000
 	}
 
-	// Build query based on whether time range is specified
-	var queryClause map[string]interface{}
+	queryClause := map[string]interface{}{
+		"match_all": map[string]interface{}{},
+	}
 	if startTime != "" || endTime != "" {
 		rangeQuery := map[string]interface{}{}
 		if startTime != "" {
@@ -1125,34 +1094,30 @@ func FetchLikes(ctx context.Context, client *elasticsearch.Client, logger *Inges
 		}
 		queryClause = map[string]interface{}{
 			"range": map[string]interface{}{
-				"created_at": rangeQuery,
+				"deleted_at": rangeQuery,
 			},
 		}
-	} else {
-		queryClause = map[string]interface{}{
-			"match_all": map[string]interface{}{},
-		}
 	}
 
 	query := map[string]interface{}{
 		"query": queryClause,
 		"sort": []interface{}{
-			map[string]interface{}{"created_at": "asc"},
+			map[string]interface{}{"deleted_at": "asc"},
 			map[string]interface{}{"indexed_at": "asc"},
 		},
 		"size": size,
 	}
 
-	if afterCreatedAt != "" && afterIndexedAt != "" {
-		query["search_after"] = []interface{}{afterCreatedAt, afterIndexedAt}
+	if afterDeletedAt != "" && afterIndexedAt != "" {
+		query["search_after"] = []interface{}{afterDeletedAt, afterIndexedAt}
 	}
 
 	queryJSON, err := json.Marshal(query)
 	if err != nil {
-		return response, fmt.Errorf("failed to marshal query: %w", err)
+		return fmt.Errorf("failed to marshal query: %w", err)
 	}
 
-	logger.Debug("Executing like search query on index '%s': %s", index, string(queryJSON))
+	logger.Debug("Executing tombstone search query on index '%s': %s", index, string(queryJSON))
 
 	start := time.Now()
 	res, err := client.Search(
@@ -1160,28 +1125,24 @@ func FetchLikes(ctx context.Context, client *elasticsearch.Client, logger *Inges
 		client.Search.WithIndex(index),
 		client.Search.WithBody(bytes.NewReader(queryJSON)),
 	)
-	logger.Metric("es.fetch_likes.duration_ms", float64(time.Since(start).Milliseconds()))
+	logger.Metric("es."+metric+".duration_ms", float64(time.Since(start).Milliseconds()))
 	if err != nil {
-		return response, fmt.Errorf("like search request failed: %w", err)
+		return fmt.Errorf("tombstone search request failed: %w", err)
 	}
 	defer func() {
 		if err := res.Body.Close(); err != nil {
-			logger.Error("Failed to close like search response body: %v", err)
+			logger.Error("Failed to close tombstone search response body: %v", err)
 		}
 	}()
 
 	if res.IsError() {
-		return response, fmt.Errorf("like search request returned error: %s", res.String())
+		return fmt.Errorf("tombstone search request returned error: %s", res.String())
 	}
 
-	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
-		return response, fmt.Errorf("failed to parse like search response: %w", err)
+	if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to parse tombstone search response: %w", err)
 	}
-
-	logger.Metric("es.fetch_likes.took_ms", float64(response.Took))
-	logger.Debug("Like search returned %d hits (total: %d)", len(response.Hits.Hits), response.Hits.Total.Value)
-
-	return response, nil
+	return nil
 }
 
 
@@ -1320,8 +1281,9 @@ func QueryPostsByAuthorDID(ctx context.Context, client *elasticsearch.Client, in
 }
 
 // QueryLikesByAuthorDID retrieves all likes for a given author_did using scroll API
-// Returns map of at_uri -> subject_uri (subject_uri needed for tombstone creation)
-func QueryLikesByAuthorDID(ctx context.Context, client *elasticsearch.Client, index string, authorDID string, logger *IngestLogger) (map[string]string, error) {
+// Returns map of at_uri -> like, with only SubjectURI (needed for tombstone
+// creation) and Index (the backing index to delete it from) set
+func QueryLikesByAuthorDID(ctx context.Context, client *elasticsearch.Client, index string, authorDID string, logger *IngestLogger) (map[string]LikeDoc, error) {
 	// Build search query
 	query := map[string]interface{}{
 		"query": map[string]interface{}{
@@ -1363,6 +1325,7 @@ func QueryLikesByAuthorDID(ctx context.Context, client *elasticsearch.Client, in
 		ScrollID string `json:"_scroll_id"`
 		Hits     struct {
 			Hits []struct {
+				Index  string `json:"_index"`
 				Source struct {
 					AtURI      string `json:"at_uri"`
 					SubjectURI string `json:"subject_uri"`
@@ -1376,10 +1339,10 @@ func QueryLikesByAuthorDID(ctx context.Context, client *elasticsearch.Client, in
 	}
 
 	// Collect all likes
-	likes := make(map[string]string)
+	likes := make(map[string]LikeDoc)
 	for _, hit := range searchResponse.Hits.Hits {
 		if hit.Source.AtURI != "" && hit.Source.SubjectURI != "" {
-			likes[hit.Source.AtURI] = hit.Source.SubjectURI
+			likes[hit.Source.AtURI] = LikeDoc{SubjectURI: hit.Source.SubjectURI, Index: hit.Index}
 		}
 	}
 
@@ -1414,6 +1377,7 @@ func QueryLikesByAuthorDID(ctx context.Context, client *elasticsearch.Client, in
 			ScrollID string `json:"_scroll_id"`
 			Hits     struct {
 				Hits []struct {
+					Index  string `json:"_index"`
 					Source struct {
 						AtURI      string `json:"at_uri"`
 						SubjectURI string `json:"subject_uri"`
@@ -1436,7 +1400,7 @@ func QueryLikesByAuthorDID(ctx context.Context, client *elasticsearch.Client, in
 		// Collect likes from this batch
 		for _, hit := range scrollResponse.Hits.Hits {
 			if hit.Source.AtURI != "" && hit.Source.SubjectURI != "" {
-				likes[hit.Source.AtURI] = hit.Source.SubjectURI
+				likes[hit.Source.AtURI] = LikeDoc{SubjectURI: hit.Source.SubjectURI, Index: hit.Index}
 			}
 		}
 
@@ -1456,6 +1420,79 @@ func QueryLikesByAuthorDID(ctx context.Context, client *elasticsearch.Client, in
 	return likes, nil
 }
 
+// recentLikePage is the page size of FetchRecentLikeURIs
+const recentLikePage = 10000
+
+// FetchRecentLikeURIs returns the at_uris of up to limit likes indexed at or
+// after since (RFC3339), oldest first
+func FetchRecentLikeURIs(ctx context.Context, client *elasticsearch.Client, logger *IngestLogger, index, since string, limit int) ([]string, error) {
+	var (
+		atURIs      []string
+		searchAfter []interface{}
+	)
+	start := time.Now()
+	defer func() {
+		logger.Metric("es.fetch_recent_likes.duration_ms", float64(time.Since(start).Milliseconds()))
+	}()
+	for len(atURIs) < limit {
+		query := map[string]interface{}{
+			"size":    min(recentLikePage, limit-len(atURIs)),
+			"_source": []string{"at_uri"},
+			"query": map[string]interface{}{
+				"range": map[string]interface{}{TimeFieldIndexedAt: map[string]interface{}{"gte": since}},
+			},
+			"sort": append(timeFieldSort(TimeFieldIndexedAt), map[string]interface{}{"at_uri": "asc"}),
+		}
+		if searchAfter != nil {
+			query["search_after"] = searchAfter
+		}
+		queryJSON, err := json.Marshal(query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal recent likes query: %w", err)
+		}
+
+		res, err := client.Search(
+			client.Search.WithContext(ctx),
+			client.Search.WithIndex(index),
+			client.Search.WithBody(bytes.NewReader(queryJSON)),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("recent likes lookup failed: %w", err)
+		}
+		var response struct {
+			Hits struct {
+				Hits []struct {
+					Sort   []interface{} `json:"sort"`
+					Source struct {
+						AtURI string `json:"at_uri"`
+					} `json:"_source"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		if res.IsError() {
+			err = fmt.Errorf("recent likes lookup returned error: %s", res.String())
+		} else if decodeErr := json.NewDecoder(res.Body).Decode(&response); decodeErr != nil {
+			err = fmt.Errorf("failed to parse recent likes response: %w", decodeErr)
+		}
+		if closeErr := res.Body.Close(); closeErr != nil {
+			logger.Error("Failed to close recent likes response body: %v", closeErr)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		hits := response.Hits.Hits
+		for _, hit := range hits {
+			atURIs = append(atURIs, hit.Source.AtURI)
+		}
+		if len(hits) < recentLikePage {
+			break
+		}
+		searchAfter = hits[len(hits)-1].Sort
+	}
+	return atURIs, nil
+}
+
 // ExtractDIDFromATURI extracts the DID from an AT-URI (at://DID/collection/rkey).
 // Returns empty string if the URI is malformed.
 func ExtractDIDFromATURI(atURI string) string {
@@ -1469,12 +1506,23 @@ func ExtractDIDFromATURI(atURI string) string {
 	return parts[0]
 }
 
-// LikeCountUpdate represents a like count change for a post
-type LikeCountUpdate struct {
+// Post counters maintained with scripted updates (see PostCounter)
+const (
+	LikeCountField        = "like_count"
+	ReplyCountField       = "reply_count"        // Direct replies
+	ThreadReplyCountField = "thread_reply_count" // Replies anywhere in the thread a post roots
+	QuoteCountField       = "quote_count"
+)
+
+// CountUpdate represents a change to one of a post's counters
+type CountUpdate struct {
 	SubjectURI string
-	Increment  int // Positive for like creation, negative for deletion
+	Increment  int // Positive for creation, negative for deletion
 }
 
+// LikeCountUpdate represents a like count change for a post
+type LikeCountUpdate = CountUpdate
+
 // aggregateLikeCountUpdates aggregates multiple updates to the same post
 // Returns a map of subject_uri -> total increment
 func aggregateLikeCountUpdates(updates []LikeCountUpdate) map[string]int {
@@ -1490,20 +1538,33 @@ func aggregateLikeCountUpdates(updates []LikeCountUpdate) map[string]int {
 // BulkUpdateLikeCounts updates like_count fields on documents using the ES update API.
 // Routes each update to the correct shard by extracting the author DID from the AT-URI.
 func BulkUpdateLikeCounts(ctx context.Context, client *elasticsearch.Client, index string, updates []LikeCountUpdate, dryRun bool, logger *IngestLogger) error {
+	return BulkUpdatePostCounts(ctx, client, index, LikeCountField, updates, dryRun, logger)
+}
+
+// BulkUpdatePostCounts adds each update's increment to the counter field of
+// its post, as BulkUpdateLikeCounts does for like_count
+func BulkUpdatePostCounts(ctx context.Context, client *elasticsearch.Client, index, field string, updates []CountUpdate, dryRun bool, logger *IngestLogger) error {
+	_, err := bulkUpdatePostCounts(ctx, client, index, field, updates, dryRun, logger)
+	return err
+}
+
+// bulkUpdatePostCounts is BulkUpdatePostCounts, also returning the AT-URIs
+// of the posts index held and updated
+func bulkUpdatePostCounts(ctx context.Context, client *elasticsearch.Client, index, field string, updates []CountUpdate, dryRun bool, logger *IngestLogger) ([]string, error) {
 	if len(updates) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	if dryRun {
-		logger.Debug("Dry-run: Skipping bulk update of %d post like counts", len(updates))
-		return nil
+		logger.Debug("Dry-run: Skipping bulk update of %d post %s values", len(updates), field)
+		return nil, nil
 	}
 
 	// Aggregate updates by subject_uri (in case same post appears multiple times)
 	aggregated := aggregateLikeCountUpdates(updates)
 
 	if len(aggregated) == 0 {
-		return fmt.Errorf("no valid updates in batch")
+		return nil, fmt.Errorf("no valid updates in batch")
 	}
 
 	var buf bytes.Buffer
@@ -1529,7 +1590,7 @@ func BulkUpdateLikeCounts(ctx context.Context, client *elasticsearch.Client, ind
 
 		metaJSON, err := json.Marshal(meta)
 		if err != nil {
-			return fmt.Errorf("failed to marshal update metadata: %w", err)
+			return nil, fmt.Errorf("failed to marshal update metadata: %w", err)
 		}
 
 		buf.Write(metaJSON)
@@ -1538,7 +1599,7 @@ func BulkUpdateLikeCounts(ctx context.Context, client *elasticsearch.Client, ind
 		// Update body with painless script
 		updateBody := map[string]interface{}{
 			"script": map[string]interface{}{
-				"source": "if (ctx._source.like_count == null) { ctx._source.like_count = 0; } ctx._source.like_count = ctx._source.like_count + params.increment;",
+				"source": countScript(field),
 				"params": map[string]interface{}{
 					"increment": increment,
 				},
@@ -1549,7 +1610,7 @@ func BulkUpdateLikeCounts(ctx context.Context, client *elasticsearch.Client, ind
 
 		updateJSON, err := json.Marshal(updateBody)
 		if err != nil {
-			return fmt.Errorf("failed to marshal update body: %w", err)
+			return nil, fmt.Errorf("failed to marshal update body: %w", err)
 		}
 
 		buf.Write(updateJSON)
@@ -1557,12 +1618,12 @@ func BulkUpdateLikeCounts(ctx context.Context, client *elasticsearch.Client, ind
 	}
 
 	if validUpdateCount == 0 {
-		logger.Debug("No like-count updates to perform (no corresponding posts found)")
-		return nil
+		logger.Debug("No %s updates to perform (no corresponding posts found)", field)
+		return nil, nil
 	}
 	// Log if we skipped some updates due to missing posts
 	if skippedNoRouting > 0 {
-		logger.Debug("Skipped %d post like-count updates while looking for routing info due to missing posts", skippedNoRouting)
+		logger.Debug("Skipped %d post %s updates while looking for routing info due to missing posts", skippedNoRouting, field)
 	}
 
 	start := time.Now()
@@ -1570,9 +1631,9 @@ func BulkUpdateLikeCounts(ctx context.Context, client *elasticsearch.Client, ind
 		bytes.NewReader(buf.Bytes()),
 		client.Bulk.WithContext(ctx),
 	)
-	logger.Metric("es.update_like_counts.duration_ms", float64(time.Since(start).Milliseconds()))
+	logger.Metric("es.update_"+field+"s.duration_ms", float64(time.Since(start).Milliseconds()))
 	if err != nil {
-		return fmt.Errorf("bulk update request failed: %w", err)
+		return nil, fmt.Errorf("bulk update request failed: %w", err)
 	}
 	defer func() {
 		if err := res.Body.Close(); err != nil {
@@ -1581,14 +1642,15 @@ func BulkUpdateLikeCounts(ctx context.Context, client *elasticsearch.Client, ind
 	}()
 
 	if res.IsError() {
-		return fmt.Errorf("bulk update request returned error: %s", res.String())
+		return nil, fmt.Errorf("bulk update request returned error: %s", res.String())
 	}
 
 	var bulkResponse struct {
 		Took   int  `json:"took"`
 		Errors bool `json:"errors"`
 		Items  []map[string]struct {
-			Status int `json:"status"`
+			ID     string `json:"_id"`
+			Status int    `json:"status"`
 			Error  *struct {
 				Type   string `json:"type"`
 				Reason string `json:"reason"`
@@ -1597,10 +1659,19 @@ func BulkUpdateLikeCounts(ctx context.Context, client *elasticsearch.Client, ind
 	}
 
 	if err := json.NewDecoder(res.Body).Decode(&bulkResponse); err != nil {
-		return fmt.Errorf("failed to parse bulk update response: %w", err)
+		return nil, fmt.Errorf("failed to parse bulk update response: %w", err)
 	}
 
-	logger.Metric("es.update_like_counts.took_ms", float64(bulkResponse.Took))
+	logger.Metric("es.update_"+field+"s.took_ms", float64(bulkResponse.Took))
+
+	var updated []string
+	for _, item := range bulkResponse.Items {
+		for _, details := range item {
+			if details.Error == nil {
+				updated = append(updated, details.ID)
+			}
+		}
+	}
 
 	if bulkResponse.Errors {
 		hasRealErrors := false
@@ -1610,7 +1681,7 @@ func BulkUpdateLikeCounts(ctx context.Context, client *elasticsearch.Client, ind
 			for _, details := range item {
 				if details.Error != nil {
 					// It's possible (though unlikely) a post is deleted
-					// before we increment likes. Ignore those race situations.
+					// before we update its counts. Ignore those race situations.
 					if details.Status == 404 {
 						notFoundCount++
 					} else {
@@ -1623,19 +1694,25 @@ func BulkUpdateLikeCounts(ctx context.Context, client *elasticsearch.Client, ind
 		}
 
 		if notFoundCount > 0 {
-			logger.Debug("Skipped %d like-count updates due to missing posts", notFoundCount)
+			logger.Debug("Skipped %d %s updates due to missing posts", notFoundCount, field)
 		}
 
 		if hasRealErrors {
 			itemsJSON, _ := json.Marshal(bulkResponse.Items)
-			logger.Error("Bulk like-count update failed with errors")
+			logger.Error("Bulk %s update failed with errors", field)
 			logger.Debug("Response items with errors: %s", string(itemsJSON))
-			return fmt.Errorf("bulk update failed: some updates had errors")
+			return nil, fmt.Errorf("bulk update failed: some updates had errors")
 		}
 	}
 
-	logger.Debug("Successfully updated like counts for %d posts", validUpdateCount)
-	return nil
+	logger.Debug("Successfully updated %s for %d posts", field, validUpdateCount)
+	return updated, nil
+}
+
+// countScript returns the painless script that adds params.increment to
+// field, which is null until a post's first update
+func countScript(field string) string {
+	return fmt.Sprintf("if (ctx._source.%[1]s == null) { ctx._source.%[1]s = 0; } ctx._source.%[1]s = ctx._source.%[1]s + params.increment;", field)
 }
 
 // ExtractHashtags extracts hashtags from post content and returns them with hour bucket and count
@@ -1851,8 +1928,8 @@ func BulkIndexInferences(ctx context.Context, client *elasticsearch.Client, inde
 		return nil
 	}
 
-	var buf bytes.Buffer
 	validDocCount := 0
+	var sent []DeadLetter
 
 	for _, doc := range docs {
 		if doc.AtURI == "" {
@@ -1860,30 +1937,14 @@ func BulkIndexInferences(ctx context.Context, client *elasticsearch.Client, inde
 			continue
 		}
 
-		meta := map[string]interface{}{
-			"index": map[string]interface{}{
-				"_index": index,
-				"_id":    doc.AtURI,
-			},
-		}
-
 		validDocCount++
 
-		metaJSON, err := json.Marshal(meta)
-		if err != nil {
-			return fmt.Errorf("failed to marshal metadata: %w", err)
-		}
-
-		buf.Write(metaJSON)
-		buf.WriteByte('\n')
-
 		docJSON, err := json.Marshal(doc)
 		if err != nil {
 			return fmt.Errorf("failed to marshal inference document: %w", err)
 		}
 
-		buf.Write(docJSON)
-		buf.WriteByte('\n')
+		sent = append(sent, DeadLetter{Index: index, ID: doc.AtURI, Source: docJSON})
 	}
 
 	if validDocCount == 0 {
@@ -1891,49 +1952,7 @@ func BulkIndexInferences(ctx context.Context, client *elasticsearch.Client, inde
 		return fmt.Errorf("no valid inference docs in batch")
 	}
 
-	start := time.Now()
-	res, err := client.Bulk(
-		bytes.NewReader(buf.Bytes()),
-		client.Bulk.WithContext(ctx),
-	)
-	logger.Metric("es.bulk_index_inferences.duration_ms", float64(time.Since(start).Milliseconds()))
-	if err != nil {
-		return fmt.Errorf("bulk inference request failed: %w", err)
-	}
-	defer func() {
-		if err := res.Body.Close(); err != nil {
-			logger.Error("Failed to close response body: %v", err)
-		}
-	}()
-
-	if res.IsError() {
-		return fmt.Errorf("bulk inference request returned error: %s", res.String())
-	}
-
-	var bulkResponse struct {
-		Took   int  `json:"took"`
-		Errors bool `json:"errors"`
-		Items  []map[string]struct {
-			Error *struct {
-				Type   string `json:"type"`
-				Reason string `json:"reason"`
-			} `json:"error"`
-		} `json:"items"`
-	}
-
-	if err := json.NewDecoder(res.Body).Decode(&bulkResponse); err != nil {
-		return fmt.Errorf("failed to parse bulk inference response: %w", err)
-	}
-
-	logger.Metric("es.bulk_index_inferences.took_ms", float64(bulkResponse.Took))
-
-	if bulkResponse.Errors {
-		itemsJSON, _ := json.Marshal(bulkResponse.Items)
-		logger.Error("Bulk inference indexing failed with errors. Response items: %s", string(itemsJSON))
-		return fmt.Errorf("bulk inference indexing failed: some documents had errors (see logs for details)")
-	}
-
-	return nil
+	return submitBulkIndex(ctx, client, sent, "es.bulk_index_inferences", "inference", logger)
 }
 
 // InferenceSource represents the _source field of an inference document in Elasticsearch
@@ -2018,6 +2037,84 @@ func FetchInferencesByAtURIs(ctx context.Context, client *elasticsearch.Client,
 	return response, nil
 }
 
+// CountLikesBySubject counts the likes of each of subjectURIs in the likes
+// index, with a terms aggregation on subject_uri. Likes are routed by their
+// author, so a post's likes are spread over shards; as the query matches
+// only subjectURIs, each shard returns every bucket and the counts are
+// exact. Subjects without likes are absent from the result.
+func CountLikesBySubject(ctx context.Context, client *elasticsearch.Client, logger *IngestLogger,
+	index string, subjectURIs []string) (map[string]int, error) {
+
+	counts := make(map[string]int, len(subjectURIs))
+	if len(subjectURIs) == 0 {
+		return counts, nil
+	}
+
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"terms": map[string]interface{}{
+				"subject_uri": subjectURIs,
+			},
+		},
+		"aggs": map[string]interface{}{
+			"by_subject": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field": "subject_uri",
+					"size":  len(subjectURIs),
+				},
+			},
+		},
+		"size":             0,
+		"track_total_hits": false,
+	}
+
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	start := time.Now()
+	res, err := client.Search(
+		client.Search.WithContext(ctx),
+		client.Search.WithIndex(index),
+		client.Search.WithBody(bytes.NewReader(queryJSON)),
+	)
+	logger.Metric("es.count_likes_by_subject.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("like count request failed: %w", err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			logger.Error("Failed to close like count response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("like count request returned error: %s", res.String())
+	}
+
+	var response struct {
+		Took         int `json:"took"`
+		Aggregations struct {
+			BySubject struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount int    `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"by_subject"`
+		} `json:"aggregations"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse like count response: %w", err)
+	}
+
+	logger.Metric("es.count_likes_by_subject.took_ms", float64(response.Took))
+	for _, bucket := range response.Aggregations.BySubject.Buckets {
+		counts[bucket.Key] = bucket.DocCount
+	}
+	return counts, nil
+}
+
 // FetchHashtags fetches hashtags from Elasticsearch within a time window
 // Uses the 'hour' field for filtering since hashtags are bucketed by hour
 func FetchHashtags(ctx context.Context, client *elasticsearch.Client, logger *IngestLogger,
@@ -2117,19 +2214,25 @@ func FetchHashtags(ctx context.Context, client *elasticsearch.Client, logger *In
 //	CurrentIndexName("likes", "hour")              → "likes-2026-04-12-14"
 //	CurrentIndexName("post_tombstones", "10min")   → "post-tombstones-2026-04-12-14-30"
 func CurrentIndexName(base, period string) string {
+	return IndexNameAt(base, period, time.Now())
+}
+
+// IndexNameAt returns the period-based index name that t falls in, named as
+// CurrentIndexName names the current one
+func IndexNameAt(base, period string, t time.Time) string {
 	kebabBase := strings.ReplaceAll(base, "_", "-")
-	now := time.Now().UTC()
+	t = t.UTC()
 	switch period {
 	case IndexPeriodWeek:
-		year, week := now.ISOWeek()
+		year, week := t.ISOWeek()
 		return fmt.Sprintf("%s-%d-w%02d", kebabBase, year, week)
 	case IndexPeriodHour:
-		return fmt.Sprintf("%s-%s", kebabBase, now.Format("2006-01-02-15"))
+		return fmt.Sprintf("%s-%s", kebabBase, t.Format("2006-01-02-15"))
 	case IndexPeriod10Min:
-		truncated := now.Truncate(10 * time.Minute)
+		truncated := t.Truncate(10 * time.Minute)
 		return fmt.Sprintf("%s-%s", kebabBase, truncated.Format("2006-01-02-15-04"))
 	default:
-		year, week := now.ISOWeek()
+		year, week := t.ISOWeek()
 		return fmt.Sprintf("%s-%d-w%02d", kebabBase, year, week)
 	}
 }
@@ -0,0 +1,58 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+// likeCountScript is the painless script BulkUpdateLikeCounts sends
+const likeCountScript = "if (ctx._source.like_count == null) { ctx._source.like_count = 0; } ctx._source.like_count = ctx._source.like_count + params.increment;"
+
+func TestBulkDelete_IgnoresMissingDocuments(t *testing.T) {
+	es := estest.New(t)
+	es.Put("likes-write", "at://a", LikeDoc{AtURI: "at://a"})
+
+	docs := []DeleteDoc{{DocID: "at://a", AuthorDID: "did:plc:a"}, {DocID: "at://gone", AuthorDID: "did:plc:a"}}
+	if err := BulkDelete(context.Background(), es.Client, "likes-write", docs, false, NewLogger(false)); err != nil {
+		t.Fatalf("expected a missing document to be ignored, got %v", err)
+	}
+	if es.Len("likes-write") != 0 {
+		t.Error("expected at://a deleted")
+	}
+
+	es.FailItems(func(estest.BulkItem) *estest.ItemFailure {
+		return &estest.ItemFailure{Status: http.StatusInternalServerError, Type: "shard_failure"}
+	})
+	if err := BulkDelete(context.Background(), es.Client, "likes-write", docs, false, NewLogger(false)); err == nil || !strings.Contains(err.Error(), "some documents had errors") {
+		t.Errorf("expected item errors to fail the delete, got %v", err)
+	}
+}
+
+func TestBulkUpdateLikeCounts_IncrementsExistingPosts(t *testing.T) {
+	es := estest.New(t)
+	es.Script(likeCountScript, func(source, params map[string]interface{}) {
+		count, _ := source["like_count"].(float64)
+		source["like_count"] = count + params["increment"].(float64)
+	})
+	post := "at://did:plc:author/app.bsky.feed.post/1"
+	es.Put("posts", post, map[string]interface{}{"at_uri": post, "like_count": 2})
+
+	updates := []LikeCountUpdate{
+		{SubjectURI: post, Increment: 1},
+		{SubjectURI: post, Increment: 1},
+		{SubjectURI: "at://did:plc:author/app.bsky.feed.post/deleted", Increment: 1},
+	}
+	if err := BulkUpdateLikeCounts(context.Background(), es.Client, "posts", updates, false, NewLogger(false)); err != nil {
+		t.Fatalf("expected a missing post to be ignored, got %v", err)
+	}
+	if doc, _ := es.Get("posts", post); doc["like_count"] != 4.0 {
+		t.Errorf("expected like_count 4, got %v", doc["like_count"])
+	}
+	if calls := es.Calls(estest.APIBulk); len(calls) != 1 || len(calls[0].BulkIDs()) != 2 {
+		t.Errorf("expected one update per post, got %v", calls)
+	}
+}
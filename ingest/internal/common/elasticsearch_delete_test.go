@@ -292,6 +292,10 @@ func TestTombstoneDoc_TimeUs(t *testing.T) {
 		if time.Since(indexedAt) > time.Second {
 			t.Errorf("Expected IndexedAt to be recent, got %v", indexedAt)
 		}
+
+		if tombstone.Version != timeUs {
+			t.Errorf("Expected the delete versioned by time_us %d, got %d", timeUs, tombstone.Version)
+		}
 	})
 
 	t.Run("without time_us fallback to current time", func(t *testing.T) {
@@ -0,0 +1,143 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func TestFetchPostsPIT_TimeField(t *testing.T) {
+	var query map[string]interface{}
+	client, srv := newMockESClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &query); err != nil {
+			t.Errorf("failed to parse query: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"hits":{"total":{"value":0},"hits":[]}}`))
+	}))
+	defer srv.Close()
+
+	afterTime, afterTiebreak := SortCursor(TimeFieldIndexedAt, "2026-06-01T00:00:00Z", "2026-06-04T00:00:00Z")
+	pit := ExportPIT{ID: "pit-1", KeepAlive: time.Minute}
+	_, err := FetchPostsPIT(context.Background(), client, NewLogger(false), pit, "2026-06-03T00:00:00Z", "2026-06-05T00:00:00Z", TimeFieldIndexedAt, ExportFilter{}, PITSearchAfter(afterTime, afterTiebreak), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rangeClause := query["query"].(map[string]interface{})["range"].(map[string]interface{})
+	if _, ok := rangeClause["indexed_at"]; !ok || len(rangeClause) != 1 {
+		t.Errorf("expected the window on indexed_at, got %v", rangeClause)
+	}
+	sort := query["sort"].([]interface{})
+	if _, ok := sort[0].(map[string]interface{})["indexed_at"]; !ok {
+		t.Errorf("expected results sorted on indexed_at first, got %v", sort)
+	}
+	searchAfter := query["search_after"].([]interface{})
+	if searchAfter[0] != "2026-06-04T00:00:00Z" || searchAfter[1] != "2026-06-01T00:00:00Z" {
+		t.Errorf("expected search_after to lead with indexed_at, got %v", searchAfter)
+	}
+}
+
+func TestValidateTimeField(t *testing.T) {
+	for _, field := range []string{TimeFieldCreatedAt, TimeFieldIndexedAt} {
+		if err := ValidateTimeField(field); err != nil {
+			t.Errorf("%s: unexpected error %v", field, err)
+		}
+	}
+	if err := ValidateTimeField("deleted_at"); err == nil {
+		t.Error("expected an error for an unsupported time field")
+	}
+}
+
+func TestFetchPostsPIT(t *testing.T) {
+	var path string
+	var query map[string]interface{}
+	client, srv := newMockESClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		path = r.URL.Path
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &query); err != nil {
+			t.Errorf("failed to parse query: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"hits":{"hits":[]}}`))
+	}))
+	defer srv.Close()
+
+	fetch := func(pit ExportPIT) {
+		searchAfter := PITSearchAfter("2026-06-04T00:00:00Z", "2026-06-01T00:00:00Z")
+		if _, err := FetchPostsPIT(context.Background(), client, NewLogger(false), pit, "2026-06-03T00:00:00Z", "", TimeFieldCreatedAt, ExportFilter{}, searchAfter, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fetch(ExportPIT{ID: "pit-1", KeepAlive: 5 * time.Minute})
+	if path != "/_search" {
+		t.Errorf("expected a point in time search to name no index, got %s", path)
+	}
+	if pit := query["pit"].(map[string]interface{}); pit["id"] != "pit-1" || pit["keep_alive"] != "300s" {
+		t.Errorf("unexpected pit %v", pit)
+	}
+	if _, sliced := query["slice"]; sliced {
+		t.Errorf("expected an unsliced search of the whole point in time, got %v", query["slice"])
+	}
+	if after := query["search_after"].([]interface{}); len(after) != 3 || after[0] != "2026-06-04T00:00:00Z" {
+		t.Errorf("expected search_after to skip past the cursor's ties on every shard, got %v", after)
+	}
+
+	fetch(ExportPIT{ID: "pit-1", KeepAlive: 5 * time.Minute, Slice: 2, Slices: 4})
+	if s := query["slice"].(map[string]interface{}); s["id"] != float64(2) || s["max"] != float64(4) {
+		t.Errorf("unexpected slice %v", s)
+	}
+	if PITSearchAfter("", "") != nil {
+		t.Error("expected no search_after without a cursor")
+	}
+}
+
+func TestExportQuery_Filter(t *testing.T) {
+	filter := ExportFilter{AuthorDIDs: []string{"did:plc:a", "did:plc:b"}, HasEmbeddings: true, ContentMatch: "solar -oil"}
+	body, err := json.Marshal(exportQuery("2026-06-03T00:00:00Z", "", TimeFieldCreatedAt, filter, 10)["query"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"bool":{"filter":[{"range":{"created_at":{"gte":"2026-06-03T00:00:00Z"}}},{"terms":{"author_did":["did:plc:a","did:plc:b"]}},{"exists":{"field":"embeddings"}}],` +
+		`"must":[{"simple_query_string":{"default_operator":"and","fields":["content"],"query":"solar -oil"}}]}}`
+	if string(body) != want {
+		t.Errorf("unexpected query\n got %s\nwant %s", body, want)
+	}
+
+	body, _ = json.Marshal(exportQuery("", "", TimeFieldCreatedAt, ExportFilter{AuthorDIDs: []string{"did:plc:a"}}, 10)["query"])
+	if string(body) != `{"bool":{"filter":[{"terms":{"author_did":["did:plc:a"]}}]}}` {
+		t.Errorf("expected an unwindowed filter without match_all, got %s", body)
+	}
+	if filter.PostsOnly() != true || (ExportFilter{AuthorDIDs: []string{"did:plc:a"}}).PostsOnly() {
+		t.Error("expected only embeddings and content filters to be posts-only")
+	}
+}
+
+func TestFetchRecentLikeURIs(t *testing.T) {
+	es := estest.New(t)
+	es.Put("likes-1", "at://old", map[string]interface{}{"at_uri": "at://old", "created_at": "2026-10-16T09:00:00Z", "indexed_at": "2026-10-16T09:00:00Z"})
+	es.Put("likes-1", "at://b", map[string]interface{}{"at_uri": "at://b", "created_at": "2026-10-16T10:00:00Z", "indexed_at": "2026-10-16T10:00:02Z"})
+	es.Put("likes-2", "at://a", map[string]interface{}{"at_uri": "at://a", "created_at": "2026-10-16T10:00:00Z", "indexed_at": "2026-10-16T10:00:01Z"})
+	logger := NewLogger(false)
+
+	atURIs, err := FetchRecentLikeURIs(context.Background(), es.Client, logger, "likes-*", "2026-10-16T10:00:00Z", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(atURIs) != 2 || atURIs[0] != "at://a" || atURIs[1] != "at://b" {
+		t.Errorf("expected the likes indexed since the cursor, oldest first, got %v", atURIs)
+	}
+
+	if atURIs, _ := FetchRecentLikeURIs(context.Background(), es.Client, logger, "likes-*", "2026-10-16T10:00:00Z", 1); len(atURIs) != 1 {
+		t.Errorf("expected the limit applied, got %v", atURIs)
+	}
+}
@@ -0,0 +1,114 @@
+package common
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJetstreamMessage_Follow(t *testing.T) {
+	logger := NewLogger(false)
+
+	rawJSON := `{
+		"did": "did:plc:follower",
+		"time_us": 1764183883593160,
+		"kind": "commit",
+		"commit": {
+			"operation": "create",
+			"collection": "app.bsky.graph.follow",
+			"rkey": "followkey1",
+			"record": {
+				"$type": "app.bsky.graph.follow",
+				"subject": "did:plc:followed",
+				"createdAt": "2025-01-27T12:34:56.789Z"
+			}
+		}
+	}`
+
+	msg := NewJetstreamMessage(rawJSON, logger)
+	if !msg.IsFollow() || msg.IsFollowDelete() || msg.IsLike() {
+		t.Fatalf("expected follow create, got IsFollow=%v IsFollowDelete=%v IsLike=%v", msg.IsFollow(), msg.IsFollowDelete(), msg.IsLike())
+	}
+
+	doc := CreateFollowDoc(msg)
+	if doc.AtURI != "at://did:plc:follower/app.bsky.graph.follow/followkey1" {
+		t.Errorf("AtURI = %s", doc.AtURI)
+	}
+	if doc.AuthorDID != "did:plc:follower" {
+		t.Errorf("AuthorDID = %s, want did:plc:follower", doc.AuthorDID)
+	}
+	if doc.SubjectDID != "did:plc:followed" {
+		t.Errorf("SubjectDID = %s, want did:plc:followed", doc.SubjectDID)
+	}
+	if doc.CreatedAt == "" || doc.IndexedAt == "" {
+		t.Errorf("expected timestamps to be set, got created_at=%q indexed_at=%q", doc.CreatedAt, doc.IndexedAt)
+	}
+}
+
+func TestCreateFollowTombstoneDoc(t *testing.T) {
+	logger := NewLogger(false)
+
+	rawJSON := `{
+		"did": "did:plc:follower",
+		"time_us": 1764183883593160,
+		"kind": "commit",
+		"commit": {
+			"operation": "delete",
+			"collection": "app.bsky.graph.follow",
+			"rkey": "followkey1"
+		}
+	}`
+
+	msg := NewJetstreamMessage(rawJSON, logger)
+	if !msg.IsFollowDelete() || msg.IsLikeDelete() {
+		t.Fatal("expected message to be a follow delete")
+	}
+
+	tombstone := CreateFollowTombstoneDoc(msg, "did:plc:followed")
+	if tombstone.AtURI != "at://did:plc:follower/app.bsky.graph.follow/followkey1" {
+		t.Errorf("AtURI = %s", tombstone.AtURI)
+	}
+	if tombstone.SubjectDID != "did:plc:followed" {
+		t.Errorf("SubjectDID = %s, want did:plc:followed", tombstone.SubjectDID)
+	}
+	deletedAt, err := time.Parse(time.RFC3339, tombstone.DeletedAt)
+	if err != nil || deletedAt.Unix() != 1764183883 {
+		t.Errorf("DeletedAt = %s, want time_us of the delete event", tombstone.DeletedAt)
+	}
+}
+
+func TestBulkGetFollows(t *testing.T) {
+	var body string
+	client, srv := newMockESClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		_, _ = w.Write([]byte(`{"docs":[
+			{"_id":"at://a/app.bsky.graph.follow/1","found":true,"_source":{"at_uri":"at://a/app.bsky.graph.follow/1","author_did":"did:plc:a","subject_did":"did:plc:b"}},
+			{"_id":"at://a/app.bsky.graph.follow/2","found":false}
+		]}`))
+	}))
+	defer srv.Close()
+
+	refs := []DeleteDoc{
+		{DocID: "at://a/app.bsky.graph.follow/1", AuthorDID: "did:plc:a"},
+		{DocID: "at://a/app.bsky.graph.follow/2", AuthorDID: "did:plc:a"},
+	}
+	follows, err := BulkGetFollows(t.Context(), client, "follows", refs, NewLogger(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(follows) != 1 {
+		t.Fatalf("expected 1 follow found, got %d", len(follows))
+	}
+	if follows["at://a/app.bsky.graph.follow/1"].SubjectDID != "did:plc:b" {
+		t.Errorf("unexpected follow: %+v", follows["at://a/app.bsky.graph.follow/1"])
+	}
+	if !strings.Contains(body, `"routing":"did:plc:a"`) {
+		t.Errorf("expected mget to route by author_did, got %s", body)
+	}
+}
@@ -0,0 +1,46 @@
+package common
+
+// ExportFilter narrows an export of posts, replies, or likes to the
+// documents matching every filter set. The zero value matches everything.
+type ExportFilter struct {
+	AuthorDIDs    []string // Only documents by these authors
+	HasEmbeddings bool     // Only posts with at least one embedding
+	ContentMatch  string   // Only posts whose content matches this simple_query_string expression
+}
+
+// IsZero reports whether f matches everything
+func (f ExportFilter) IsZero() bool {
+	return len(f.AuthorDIDs) == 0 && !f.HasEmbeddings && f.ContentMatch == ""
+}
+
+// PostsOnly reports whether f filters on fields only posts and replies have
+func (f ExportFilter) PostsOnly() bool {
+	return f.HasEmbeddings || f.ContentMatch != ""
+}
+
+// clauses returns the bool query clauses for f: filter clauses, which only
+// include or exclude documents, and must clauses, which also score them
+func (f ExportFilter) clauses() (filter, must []interface{}) {
+	if len(f.AuthorDIDs) > 0 {
+		filter = append(filter, map[string]interface{}{
+			"terms": map[string]interface{}{"author_did": f.AuthorDIDs},
+		})
+	}
+	if f.HasEmbeddings {
+		filter = append(filter, map[string]interface{}{
+			"exists": map[string]interface{}{"field": "embeddings"},
+		})
+	}
+	if f.ContentMatch != "" {
+		// simple_query_string never fails on malformed input, so a stray
+		// quote or operator narrows the match instead of failing the export
+		must = append(must, map[string]interface{}{
+			"simple_query_string": map[string]interface{}{
+				"query":            f.ContentMatch,
+				"fields":           []string{"content"},
+				"default_operator": "and",
+			},
+		})
+	}
+	return filter, must
+}
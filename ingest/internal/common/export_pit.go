@@ -0,0 +1,176 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// ExportPIT is a point in time on an index that an export pages through, so
+// it reads one consistent snapshot however long it runs: documents indexed,
+// deleted, or rolled over to a new backing index mid-export neither appear
+// twice nor go missing. Pages are fetched with search_after from the sort
+// values of the last hit, which end with the point in time's implicit
+// _shard_doc tiebreak.
+//
+// With Slices above 1, the export reads slice Slice of Slices disjoint
+// slices of the point in time, and the other slices are read in parallel.
+type ExportPIT struct {
+	ID        string
+	KeepAlive time.Duration // Extended by each fetch
+	Slice     int
+	Slices    int
+}
+
+// OpenExportPIT opens a point in time on index for an export
+func OpenExportPIT(ctx context.Context, client *elasticsearch.Client, logger *IngestLogger, index string, keepAlive time.Duration) (string, error) {
+	res, err := client.OpenPointInTime(
+		[]string{index},
+		keepAlive,
+		client.OpenPointInTime.WithContext(ctx),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to open point in time on %s: %w", index, err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			logger.Error("Failed to close open-PIT response body: %v", err)
+		}
+	}()
+	if res.IsError() {
+		return "", fmt.Errorf("open point in time on %s returned error: %s", index, res.String())
+	}
+
+	var pit struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&pit); err != nil {
+		return "", fmt.Errorf("failed to parse point in time response: %w", err)
+	}
+	return pit.ID, nil
+}
+
+// CloseExportPIT releases a point in time; failures only delay cleanup until
+// its keep-alive lapses
+func CloseExportPIT(client *elasticsearch.Client, logger *IngestLogger, pit string) {
+	body, _ := json.Marshal(map[string]string{"id": pit})
+	res, err := client.ClosePointInTime(bytes.NewReader(body))
+	if err != nil {
+		logger.Error("Failed to close point in time: %v", err)
+		return
+	}
+	_ = res.Body.Close()
+}
+
+// PITSearchAfter returns the search_after of an export's first page that
+// resumes after the record with SortCursor values afterTime and
+// afterTiebreak, or nil to start at the beginning. It skips every record
+// tied with that one, whichever shard it is on.
+func PITSearchAfter(afterTime, afterTiebreak string) []interface{} {
+	if afterTime == "" || afterTiebreak == "" {
+		return nil
+	}
+	return []interface{}{afterTime, afterTiebreak, int64(math.MaxInt64)}
+}
+
+// FetchPostsPIT fetches a page of posts from a point in time
+// Parameters:
+//   - pit: the point in time, or slice of one, to read
+//   - startTime, endTime: optional time range filter on timeField (RFC3339 format)
+//   - timeField: TimeFieldCreatedAt or TimeFieldIndexedAt; results are sorted on it
+//   - filter: which posts to export; the zero value exports all of them
+//   - searchAfter: the Sort of the last hit, or from PITSearchAfter for the first page
+//   - size: number of results to fetch (defaults to 1000 if 0)
+func FetchPostsPIT(ctx context.Context, client *elasticsearch.Client, logger *IngestLogger, pit ExportPIT, startTime, endTime, timeField string, filter ExportFilter, searchAfter []interface{}, size int) (SearchResponse, error) {
+	var response SearchResponse
+	if err := searchPIT(ctx, client, logger, "es.fetch_posts", pit, startTime, endTime, timeField, filter, searchAfter, size, &response); err != nil {
+		return response, err
+	}
+	logger.Metric("es.fetch_posts.took_ms", float64(response.Took))
+	logger.Debug("Search returned %d hits", len(response.Hits.Hits))
+	return response, nil
+}
+
+// FetchLikesPIT fetches a page of likes from a point in time. Parameters
+// mirror FetchPostsPIT; filter must not be PostsOnly.
+func FetchLikesPIT(ctx context.Context, client *elasticsearch.Client, logger *IngestLogger, pit ExportPIT, startTime, endTime, timeField string, filter ExportFilter, searchAfter []interface{}, size int) (LikeSearchResponse, error) {
+	var response LikeSearchResponse
+	if err := searchPIT(ctx, client, logger, "es.fetch_likes", pit, startTime, endTime, timeField, filter, searchAfter, size, &response); err != nil {
+		return response, err
+	}
+	logger.Metric("es.fetch_likes.took_ms", float64(response.Took))
+	logger.Debug("Like search returned %d hits", len(response.Hits.Hits))
+	return response, nil
+}
+
+// FetchFollowsPIT fetches a page of follows from a point in time. Parameters
+// mirror FetchPostsPIT; filter must be the zero value.
+func FetchFollowsPIT(ctx context.Context, client *elasticsearch.Client, logger *IngestLogger, pit ExportPIT, startTime, endTime, timeField string, filter ExportFilter, searchAfter []interface{}, size int) (FollowSearchResponse, error) {
+	var response FollowSearchResponse
+	if err := searchPIT(ctx, client, logger, "es.fetch_follows", pit, startTime, endTime, timeField, filter, searchAfter, size, &response); err != nil {
+		return response, err
+	}
+	logger.Metric("es.fetch_follows.took_ms", float64(response.Took))
+	logger.Debug("Follow search returned %d hits", len(response.Hits.Hits))
+	return response, nil
+}
+
+// searchPIT runs an export query over pit and decodes the results into
+// response. A point in time search names no index.
+func searchPIT(ctx context.Context, client *elasticsearch.Client, logger *IngestLogger, metric string, pit ExportPIT, startTime, endTime, timeField string, filter ExportFilter, searchAfter []interface{}, size int, response interface{}) error {
+	if size <= 0 {
+		size = 1000
+	}
+
+	query := exportQuery(startTime, endTime, timeField, filter, size)
+	query["pit"] = map[string]interface{}{
+		"id":         pit.ID,
+		"keep_alive": fmt.Sprintf("%ds", int(pit.KeepAlive.Seconds())),
+	}
+	if pit.Slices > 1 {
+		query["slice"] = map[string]interface{}{
+			"id":  pit.Slice,
+			"max": pit.Slices,
+		}
+	}
+	query["track_total_hits"] = false
+	if searchAfter != nil {
+		query["search_after"] = searchAfter
+	}
+
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	logger.Debug("Executing point in time search query: %s", string(queryJSON))
+
+	start := time.Now()
+	res, err := client.Search(
+		client.Search.WithContext(ctx),
+		client.Search.WithBody(bytes.NewReader(queryJSON)),
+	)
+	logger.Metric(metric+".duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return fmt.Errorf("search request failed: %w", err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			logger.Error("Failed to close search response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		return fmt.Errorf("search request returned error: %s", res.String())
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to parse search response: %w", err)
+	}
+	return nil
+}
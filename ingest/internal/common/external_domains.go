@@ -0,0 +1,117 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// DomainStats is the engagement of the posts whose link cards point to one
+// external domain (see model.Post.ExternalDomain)
+type DomainStats struct {
+	Domain string
+	Posts  int // Posts with a link card to Domain
+	Likes  int // Sum of their like_count
+}
+
+// LikesPerPost returns the mean like_count of the domain's posts
+func (s DomainStats) LikesPerPost() float64 {
+	if s.Posts == 0 {
+		return 0
+	}
+	return float64(s.Likes) / float64(s.Posts)
+}
+
+// ExternalDomainStats returns the size external domains linked from the most
+// posts in index (e.g. "posts" or "posts,replies") created at or after
+// since, most linked first. A zero since counts every post. Counts are
+// approximate for large indices, as terms aggregations are.
+func ExternalDomainStats(ctx context.Context, client *elasticsearch.Client, logger *IngestLogger,
+	index string, since time.Time, size int) ([]DomainStats, error) {
+
+	if size <= 0 {
+		size = 100
+	}
+	filter := []interface{}{
+		map[string]interface{}{"exists": map[string]interface{}{"field": "external_domain"}},
+	}
+	if !since.IsZero() {
+		filter = append(filter, map[string]interface{}{
+			"range": map[string]interface{}{
+				"created_at": map[string]interface{}{"gte": since.UTC().Format(time.RFC3339)},
+			},
+		})
+	}
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{"filter": filter},
+		},
+		"aggs": map[string]interface{}{
+			"by_domain": map[string]interface{}{
+				"terms": map[string]interface{}{
+					"field": "external_domain",
+					"size":  size,
+				},
+				"aggs": map[string]interface{}{
+					"likes": map[string]interface{}{
+						"sum": map[string]interface{}{"field": "like_count"},
+					},
+				},
+			},
+		},
+		"size":             0,
+		"track_total_hits": false,
+	}
+
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	start := time.Now()
+	res, err := client.Search(
+		client.Search.WithContext(ctx),
+		client.Search.WithIndex(index),
+		client.Search.WithBody(bytes.NewReader(queryJSON)),
+	)
+	logger.Metric("es.external_domain_stats.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("external domain stats request failed: %w", err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			logger.Error("Failed to close external domain stats response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("external domain stats request returned error: %s", res.String())
+	}
+
+	var response struct {
+		Aggregations struct {
+			ByDomain struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount int    `json:"doc_count"`
+					Likes    struct {
+						Value float64 `json:"value"`
+					} `json:"likes"`
+				} `json:"buckets"`
+			} `json:"by_domain"`
+		} `json:"aggregations"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse external domain stats response: %w", err)
+	}
+
+	stats := make([]DomainStats, len(response.Aggregations.ByDomain.Buckets))
+	for i, bucket := range response.Aggregations.ByDomain.Buckets {
+		stats[i] = DomainStats{Domain: bucket.Key, Posts: bucket.DocCount, Likes: int(bucket.Likes.Value)}
+	}
+	return stats, nil
+}
@@ -0,0 +1,34 @@
+package common
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func TestExternalDomainStats(t *testing.T) {
+	es := estest.New(t)
+	es.Put("posts", "at://p1", map[string]interface{}{"external_domain": "example.com", "like_count": 4, "created_at": "2026-10-02T00:00:00Z"})
+	es.Put("posts", "at://p2", map[string]interface{}{"external_domain": "example.com", "like_count": 1, "created_at": "2026-10-03T00:00:00Z"})
+	es.Put("posts", "at://p3", map[string]interface{}{"external_domain": "news.example.org", "like_count": 0, "created_at": "2026-10-03T00:00:00Z"})
+	es.Put("posts", "at://p4", map[string]interface{}{"external_domain": "news.example.org", "like_count": 9, "created_at": "2026-09-01T00:00:00Z"})
+	es.Put("posts", "at://p5", map[string]interface{}{"like_count": 7, "created_at": "2026-10-03T00:00:00Z"})
+
+	since := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	stats, err := ExternalDomainStats(context.Background(), es.Client, NewLogger(false), "posts", since, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []DomainStats{
+		{Domain: "example.com", Posts: 2, Likes: 5},
+		{Domain: "news.example.org", Posts: 1, Likes: 0},
+	}
+	if len(stats) != len(want) || stats[0] != want[0] || stats[1] != want[1] {
+		t.Fatalf("got %+v, want %+v", stats, want)
+	}
+	if got := stats[0].LikesPerPost(); got != 2.5 {
+		t.Errorf("expected 2.5 likes per post, got %v", got)
+	}
+}
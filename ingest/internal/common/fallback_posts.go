@@ -0,0 +1,98 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// PostSourceJetstream is the source of posts jetstream_ingest indexes
+// straight from Jetstream, as a fallback while megastream lags. Such posts
+// have no embeddings; megastream replaces them once it indexes the same
+// posts.
+const PostSourceJetstream = "jetstream"
+
+// jetstreamPostVersionOffset is how far below its event time a fallback
+// post's external version starts. Every count update and embedding a post
+// takes raises its version by one, so the offset leaves room for far more
+// updates than a post takes while megastream lags.
+const jetstreamPostVersionOffset = 1 << 32
+
+// CreateJetstreamPostDoc creates a fallback PostDoc from a post Jetstream
+// delivered (see PostSourceJetstream). Its version is
+// jetstreamPostVersionOffset less than its event time, so megastream's
+// document for the same event replaces it however many updates it has
+// taken, while it cannot replace megastream's.
+func CreateJetstreamPostDoc(msg MegaStreamMessage) PostDoc {
+	doc := CreatePostDoc(msg, 0)
+	doc.Source = PostSourceJetstream
+	if doc.Version > 0 {
+		doc.Version = max(doc.Version-jetstreamPostVersionOffset, 1)
+	}
+	return doc
+}
+
+// DeleteJetstreamPosts deletes the fallback posts in docs from index, by
+// query, and returns how many were deleted. Posts megastream indexed are
+// left for megastream to delete, along with its tombstones and reference
+// counts.
+func DeleteJetstreamPosts(ctx context.Context, client *elasticsearch.Client, index string, docs []DeleteDoc, dryRun bool, logger *IngestLogger) (int, error) {
+	atURIs := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		if doc.DocID != "" {
+			atURIs = append(atURIs, doc.DocID)
+		}
+	}
+	if len(atURIs) == 0 {
+		return 0, nil
+	}
+	if dryRun {
+		logger.Debug("Dry-run: Skipping delete of %d fallback posts from index '%s'", len(atURIs), index)
+		return 0, nil
+	}
+
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"terms": map[string]interface{}{"at_uri": atURIs}},
+					map[string]interface{}{"term": map[string]interface{}{"source": PostSourceJetstream}},
+				},
+			},
+		},
+	}
+	body, err := json.Marshal(query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal fallback post delete query: %w", err)
+	}
+
+	start := time.Now()
+	res, err := client.DeleteByQuery(
+		[]string{index},
+		bytes.NewReader(body),
+		client.DeleteByQuery.WithContext(ctx),
+		client.DeleteByQuery.WithConflicts("proceed"),
+	)
+	logger.Metric("es.delete_fallback_posts.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return 0, fmt.Errorf("fallback post delete request failed: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.IsError() {
+		errBody, _ := io.ReadAll(res.Body)
+		return 0, fmt.Errorf("fallback post delete returned error: %s - %s", res.Status(), string(errBody))
+	}
+
+	var result struct {
+		Deleted int `json:"deleted"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to parse fallback post delete response: %w", err)
+	}
+	return result.Deleted, nil
+}
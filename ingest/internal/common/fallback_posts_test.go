@@ -0,0 +1,122 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func TestJetstreamMessage_Post(t *testing.T) {
+	logger := NewLogger(false)
+	msg := NewJetstreamMessage(`{"did":"did:plc:a","time_us":1764183883593160,"kind":"commit","commit":{"operation":"create","collection":"app.bsky.feed.post","rkey":"1","record":{
+		"$type":"app.bsky.feed.post","text":"Solar panels","langs":["en"],"createdAt":"2025-01-27T12:34:56.789Z",
+		"embed":{"$type":"app.bsky.embed.recordWithMedia",
+			"record":{"record":{"uri":"at://did:plc:b/app.bsky.feed.post/2","cid":"c"}},
+			"media":{"$type":"app.bsky.embed.images","images":[{"alt":"roof","image":{"ref":{"$link":"bafy"},"mimeType":"image/jpeg","size":10}}]}}}}}`, logger)
+	if !msg.IsPost() || msg.IsPostDelete() || msg.GetAtURI() != "at://did:plc:a/app.bsky.feed.post/1" {
+		t.Fatalf("expected a post create, got %+v", msg)
+	}
+	post := msg.GetPost()
+	if post.GetContent() != "Solar panels" || post.GetQuotePost() != "at://did:plc:b/app.bsky.feed.post/2" || len(post.GetMedia()) != 1 ||
+		post.GetThreadRootPost() != "" || post.GetTimeUs() != 1764183883593160 || post.GetCreatedAt() != "2025-01-27T12:34:56Z" {
+		t.Errorf("unexpected post %+v", post)
+	}
+
+	reply := NewJetstreamMessage(`{"did":"did:plc:a","time_us":1,"kind":"commit","commit":{"operation":"create","collection":"app.bsky.feed.post","rkey":"3","record":{
+		"text":"Agreed","createdAt":"2025-01-27T12:34:56Z",
+		"reply":{"root":{"uri":"at://did:plc:b/app.bsky.feed.post/2"},"parent":{"uri":"at://did:plc:c/app.bsky.feed.post/4"}},
+		"embed":{"$type":"app.bsky.embed.record","record":{"uri":"at://did:plc:d/app.bsky.graph.list/5"}}}}}`, logger)
+	if post := reply.GetPost(); post.GetThreadRootPost() != "at://did:plc:b/app.bsky.feed.post/2" ||
+		post.GetThreadParentPost() != "at://did:plc:c/app.bsky.feed.post/4" || post.GetQuotePost() != "" {
+		t.Errorf("expected a reply quoting no post, got %+v", post)
+	}
+
+	deleted := NewJetstreamMessage(`{"did":"did:plc:a","time_us":2,"kind":"commit","commit":{"operation":"delete","collection":"app.bsky.feed.post","rkey":"1"}}`, logger)
+	if !deleted.IsPostDelete() || deleted.IsPost() || !deleted.GetPost().IsDelete() || deleted.GetAtURI() != "at://did:plc:a/app.bsky.feed.post/1" {
+		t.Errorf("expected a post delete, got %+v", deleted)
+	}
+
+	if like := NewJetstreamMessage(`{"did":"did:plc:a","time_us":2,"kind":"commit","commit":{"operation":"delete","collection":"app.bsky.feed.like","rkey":"1"}}`, logger); like.GetPost() != nil {
+		t.Error("expected no post on a like")
+	}
+}
+
+func TestJetstreamPostDocs_YieldToMegastream(t *testing.T) {
+	ctx := context.Background()
+	logger := NewLogger(false)
+	es := estest.New(t)
+	event := `{"did":"did:plc:a","time_us":100,"kind":"commit","commit":{"operation":"create","collection":"app.bsky.feed.post","rkey":"%s","record":{"text":"hi","createdAt":"2025-01-27T12:00:00Z"}}}`
+	fallback := func(rkey string) PostDoc {
+		return CreateJetstreamPostDoc(NewJetstreamMessage(fmt.Sprintf(event, rkey), logger).GetPost())
+	}
+	megastream := func(rkey string) PostDoc {
+		doc := fallback(rkey)
+		doc.Source, doc.Version, doc.PostEmbeddingModelUUID = "", 100, "model"
+		return doc
+	}
+
+	// Megastream replaces the fallback post of the same event
+	if err := BulkIndex(ctx, es.Client, "posts", []PostDoc{fallback("1")}, false, logger); err != nil {
+		t.Fatal(err)
+	}
+	if err := BulkIndex(ctx, es.Client, "posts", []PostDoc{megastream("1")}, false, logger); err != nil {
+		t.Fatal(err)
+	}
+	// A fallback post arriving after megastream's is stale
+	if err := BulkIndex(ctx, es.Client, "posts", []PostDoc{megastream("2")}, false, logger); err != nil {
+		t.Fatal(err)
+	}
+	if err := BulkIndex(ctx, es.Client, "posts", []PostDoc{fallback("2"), fallback("3")}, false, logger); err != nil {
+		t.Fatal(err)
+	}
+	for _, rkey := range []string{"1", "2"} {
+		if doc, _ := es.Get("posts", "at://did:plc:a/app.bsky.feed.post/"+rkey); doc["source"] != nil || doc["ge_post_embedding_model_uuid"] != "model" {
+			t.Errorf("%s: expected megastream's post kept, got %v", rkey, doc)
+		}
+	}
+
+	docs := []DeleteDoc{{DocID: "at://did:plc:a/app.bsky.feed.post/2"}, {DocID: "at://did:plc:a/app.bsky.feed.post/3"}}
+	deleted, err := DeleteJetstreamPosts(ctx, es.Client, "posts", docs, false, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := es.Get("posts", "at://did:plc:a/app.bsky.feed.post/2"); deleted != 1 || es.Len("posts") != 2 || !found {
+		t.Errorf("expected only the fallback post deleted, got %d deleted", deleted)
+	}
+}
+
+func TestJetstreamPostDocs_YieldToMegastreamAfterUpdates(t *testing.T) {
+	ctx := context.Background()
+	logger := NewLogger(false)
+	es := estest.New(t)
+	es.Script(likeCountScript, func(source, params map[string]interface{}) {
+		count, _ := source["like_count"].(float64)
+		source["like_count"] = count + params["increment"].(float64)
+	})
+	post := "at://did:plc:a/app.bsky.feed.post/1"
+	fallback := CreateJetstreamPostDoc(NewJetstreamMessage(`{"did":"did:plc:a","time_us":1764183883593160,"kind":"commit","commit":{"operation":"create","collection":"app.bsky.feed.post","rkey":"1","record":{"text":"hi","createdAt":"2025-01-27T12:00:00Z"}}}`, logger).GetPost())
+	if err := BulkIndex(ctx, es.Client, "posts", []PostDoc{fallback}, false, logger); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each flush of the counter raises the fallback post's version
+	for i := 0; i < 3; i++ {
+		if err := BulkUpdateLikeCounts(ctx, es.Client, "posts", []LikeCountUpdate{{SubjectURI: post, Increment: 1}}, false, logger); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if doc, _ := es.Get("posts", post); doc["like_count"] != 3.0 {
+		t.Fatalf("expected the likes counted on the fallback post, got %v", doc["like_count"])
+	}
+
+	megastream := fallback
+	megastream.Source, megastream.Version, megastream.PostEmbeddingModelUUID = "", 1764183883593160, "model"
+	if err := BulkIndex(ctx, es.Client, "posts", []PostDoc{megastream}, false, logger); err != nil {
+		t.Fatal(err)
+	}
+	if doc, _ := es.Get("posts", post); doc["source"] != nil || doc["ge_post_embedding_model_uuid"] != "model" {
+		t.Errorf("expected megastream's post to replace the updated fallback post, got %v", doc)
+	}
+}
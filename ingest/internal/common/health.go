@@ -4,40 +4,57 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"net"
 	"net/http"
+	"slices"
 	"sync"
 	"time"
 )
 
 // HealthStatus represents the current health state of the service
 type HealthStatus struct {
-	Healthy   bool      `json:"healthy"`
-	Status    string    `json:"status"`
-	StartedAt time.Time `json:"started_at"`
-	Message   string    `json:"message,omitempty"`
+	Healthy   bool                 `json:"healthy"`
+	Status    string               `json:"status"`
+	StartedAt time.Time            `json:"started_at"`
+	Message   string               `json:"message,omitempty"`
+	Lag       map[string]StreamLag `json:"lag,omitempty"`
+}
+
+// StreamLag is how far an ingest stream is behind: the time since the newest
+// event it has processed was created upstream
+type StreamLag struct {
+	LastEventAt time.Time `json:"last_event_at"`
+	LagSeconds  float64   `json:"lag_seconds"`
+	MaxSeconds  float64   `json:"max_seconds,omitempty"`
 }
 
 // HealthServer manages the HTTP health check endpoint
 type HealthServer struct {
-	port      int
-	server    *http.Server
-	mu        sync.RWMutex
-	healthy   bool
-	startedAt time.Time
-	message   string
-	logger    *IngestLogger
+	port        int
+	server      *http.Server
+	mux         *http.ServeMux
+	mu          sync.RWMutex
+	healthy     bool
+	startedAt   time.Time
+	message     string
+	lastEventUs map[string]int64 // Newest event time_us processed, per stream
+	maxLag      time.Duration    // Lag beyond which the service reports unhealthy; 0 disables
+	now         func() time.Time
+	logger      *IngestLogger
 }
 
 // NewHealthServer creates a new health check server
 // It will try the specified port, and if that fails, will try ports up to maxPort
 func NewHealthServer(port int, maxPort int, logger *IngestLogger) (*HealthServer, error) {
 	hs := &HealthServer{
-		port:      port,
-		startedAt: time.Now(),
-		healthy:   false,
-		message:   "Initializing...",
-		logger:    logger,
+		port:        port,
+		startedAt:   time.Now(),
+		healthy:     false,
+		message:     "Initializing...",
+		lastEventUs: make(map[string]int64),
+		now:         time.Now,
+		logger:      logger,
 	}
 
 	// Try to find an available port
@@ -66,7 +83,9 @@ func NewHealthServer(port int, maxPort int, logger *IngestLogger) (*HealthServer
 	mux.HandleFunc("/health", hs.handleHealth)
 	mux.HandleFunc("/healthz", hs.handleHealth)
 	mux.HandleFunc("/ready", hs.handleReady)
+	mux.HandleFunc("/version", hs.handleVersion)
 	mux.HandleFunc("/", hs.handleRoot)
+	hs.mux = mux
 
 	hs.server = &http.Server{
 		Addr:              fmt.Sprintf(":%d", hs.port),
@@ -97,6 +116,11 @@ func (hs *HealthServer) Start(ctx context.Context) error {
 	return hs.server.Shutdown(shutdownCtx)
 }
 
+// Handle registers an additional endpoint on the health server, e.g. /slo
+func (hs *HealthServer) Handle(pattern string, handler http.Handler) {
+	hs.mux.Handle(pattern, handler)
+}
+
 // SetHealthy marks the service as healthy and ready to serve traffic
 func (hs *HealthServer) SetHealthy(healthy bool, message string) {
 	hs.mu.Lock()
@@ -110,20 +134,71 @@ func (hs *HealthServer) SetHealthy(healthy bool, message string) {
 	}
 }
 
-// handleHealth handles /health and /healthz endpoints
-func (hs *HealthServer) handleHealth(w http.ResponseWriter, r *http.Request) {
-	hs.mu.RLock()
-	defer hs.mu.RUnlock()
+// SetMaxLag sets the lag beyond which any stream marks the service unhealthy.
+// Zero, the default, only reports lag.
+func (hs *HealthServer) SetMaxLag(maxLag time.Duration) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.maxLag = maxLag
+}
 
+// RecordEvent notes that stream processed an event created upstream at
+// timeUs. Lag is measured from the newest event recorded, so a stream that
+// stops receiving events falls further behind until it resumes.
+func (hs *HealthServer) RecordEvent(stream string, timeUs int64) {
+	if timeUs <= 0 {
+		return
+	}
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if timeUs > hs.lastEventUs[stream] {
+		hs.lastEventUs[stream] = timeUs
+	}
+}
+
+// status returns the current health, which is unhealthy when any stream lags
+// beyond the maximum even if the service has marked itself healthy. The
+// caller must hold hs.mu.
+func (hs *HealthServer) status() HealthStatus {
 	status := HealthStatus{
 		Healthy:   hs.healthy,
-		Status:    hs.getStatusString(),
 		StartedAt: hs.startedAt,
 		Message:   hs.message,
 	}
+	if len(hs.lastEventUs) > 0 {
+		status.Lag = make(map[string]StreamLag, len(hs.lastEventUs))
+	}
+	now := hs.now()
+	// Sorted so the message names the same stream on every request
+	for _, stream := range slices.Sorted(maps.Keys(hs.lastEventUs)) {
+		lastEventAt := time.UnixMicro(hs.lastEventUs[stream]).UTC()
+		lag := max(now.Sub(lastEventAt), 0)
+		status.Lag[stream] = StreamLag{
+			LastEventAt: lastEventAt,
+			LagSeconds:  lag.Seconds(),
+			MaxSeconds:  hs.maxLag.Seconds(),
+		}
+		if hs.maxLag > 0 && lag > hs.maxLag && status.Healthy {
+			status.Healthy = false
+			status.Message = fmt.Sprintf("%s is %s behind (max %s)", stream, lag.Round(time.Second), hs.maxLag)
+		}
+	}
+	status.Status = "unhealthy"
+	if status.Healthy {
+		status.Status = "healthy"
+	}
+	return status
+}
+
+// handleHealth handles /health and /healthz endpoints
+func (hs *HealthServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+
+	status := hs.status()
 
 	w.Header().Set("Content-Type", "application/json")
-	if !hs.healthy {
+	if !status.Healthy {
 		w.WriteHeader(http.StatusServiceUnavailable)
 	} else {
 		w.WriteHeader(http.StatusOK)
@@ -139,7 +214,7 @@ func (hs *HealthServer) handleReady(w http.ResponseWriter, r *http.Request) {
 	hs.mu.RLock()
 	defer hs.mu.RUnlock()
 
-	if !hs.healthy {
+	if !hs.status().Healthy {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		_, _ = w.Write([]byte("Not ready"))
 		return
@@ -149,17 +224,21 @@ func (hs *HealthServer) handleReady(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte("Ready"))
 }
 
+// handleVersion handles the /version endpoint (see GetBuildInfo)
+func (hs *HealthServer) handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(GetBuildInfo()); err != nil {
+		hs.logger.Error("Failed to encode build info: %v", err)
+	}
+}
+
 // handleRoot handles the root endpoint
 func (hs *HealthServer) handleRoot(w http.ResponseWriter, r *http.Request) {
 	hs.mu.RLock()
 	defer hs.mu.RUnlock()
 
-	status := HealthStatus{
-		Healthy:   hs.healthy,
-		Status:    hs.getStatusString(),
-		StartedAt: hs.startedAt,
-		Message:   hs.message,
-	}
+	status := hs.status()
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -168,14 +247,6 @@ func (hs *HealthServer) handleRoot(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// getStatusString returns a human-readable status string
-func (hs *HealthServer) getStatusString() string {
-	if hs.healthy {
-		return "healthy"
-	}
-	return "unhealthy"
-}
-
 // GetPort returns the actual port the health server is using
 func (hs *HealthServer) GetPort() int {
 	return hs.port
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 )
@@ -271,3 +272,87 @@ func getHealthStatus(t *testing.T, port int) HealthStatus {
 
 	return status
 }
+
+func TestHealthServer_Lag(t *testing.T) {
+	logger := NewLogger(false)
+	hs, err := NewHealthServer(9090, 9099, logger)
+	if err != nil {
+		t.Fatalf("Failed to create health server: %v", err)
+	}
+	now := time.Date(2026, 3, 14, 10, 0, 0, 0, time.UTC)
+	hs.now = func() time.Time { return now }
+	hs.SetHealthy(true, "Processing")
+	hs.SetMaxLag(5 * time.Minute)
+
+	get := func() (int, HealthStatus) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		hs.handleHealth(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+		var status HealthStatus
+		if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return rec.Code, status
+	}
+
+	// No events yet: nothing to report and no reason to be unhealthy
+	if code, status := get(); code != http.StatusOK || status.Lag != nil {
+		t.Fatalf("expected 200 without lag before any events, got %d %+v", code, status)
+	}
+
+	hs.RecordEvent("likes", now.Add(-time.Minute).UnixMicro())
+	hs.RecordEvent("likes", now.Add(-3*time.Minute).UnixMicro()) // Older events do not move lag back
+	hs.RecordEvent("likes", 0)                                   // Nor do events without a time
+	hs.RecordEvent("posts", now.Add(-2*time.Minute).UnixMicro())
+	code, status := get()
+	if code != http.StatusOK || !status.Healthy {
+		t.Fatalf("expected healthy within max lag, got %d %+v", code, status)
+	}
+	if lag := status.Lag["likes"]; lag.LagSeconds != 60 || lag.MaxSeconds != 300 || !lag.LastEventAt.Equal(now.Add(-time.Minute)) {
+		t.Errorf("unexpected likes lag %+v", lag)
+	}
+	if lag := status.Lag["posts"]; lag.LagSeconds != 120 {
+		t.Errorf("unexpected posts lag %+v", lag)
+	}
+
+	// A stream that stops receiving events falls behind
+	now = now.Add(4 * time.Minute)
+	code, status = get()
+	if code != http.StatusServiceUnavailable || status.Healthy || status.Status != "unhealthy" {
+		t.Fatalf("expected 503 once posts lag exceeds the max, got %d %+v", code, status)
+	}
+	if status.Message != "posts is 6m0s behind (max 5m0s)" {
+		t.Errorf("unexpected message %q", status.Message)
+	}
+
+	// Catching up restores health
+	hs.RecordEvent("posts", now.UnixMicro())
+	hs.RecordEvent("likes", now.UnixMicro())
+	if code, status := get(); code != http.StatusOK || status.Message != "Processing" {
+		t.Errorf("expected 200 after catching up, got %d %+v", code, status)
+	}
+}
+
+func TestHealthServer_Version(t *testing.T) {
+	hs, err := NewHealthServer(9100, 9109, NewLogger(false))
+	if err != nil {
+		t.Fatalf("Failed to create health server: %v", err)
+	}
+
+	previous := version
+	version = "v1.4.0"
+	defer func() { version = previous }()
+
+	rec := httptest.NewRecorder()
+	hs.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var info BuildInfo
+	if err := json.NewDecoder(rec.Body).Decode(&info); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if info.Version != "v1.4.0" || info.GoVersion == "" || info.Platform == "" {
+		t.Errorf("unexpected build info %+v", info)
+	}
+}
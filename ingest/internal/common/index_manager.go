@@ -0,0 +1,348 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// IndexProfile is the index layout for one environment. Each environment
+// creates exactly one pattern family (weekly, hourly, or 10-minute names), or
+// rolls over numbered indices when Rollover is set, and may cap the total
+// number of shards in the cluster.
+type IndexProfile struct {
+	Environment string
+	Period      string              // IndexPeriodWeek, IndexPeriodHour, or IndexPeriod10Min
+	ShardBudget int                 // Maximum shards (primaries and replicas) in the cluster; 0 disables the check
+	Rollover    *RolloverConditions // Non-nil switches from dated indices to condition-based rollover
+}
+
+// indexProfiles are the built-in environment profiles. Budgets leave headroom
+// below Elasticsearch's default limit of 1000 shards per data node (prod runs
+// four data nodes, stage two).
+var indexProfiles = map[string]IndexProfile{
+	"prod":  {Environment: "prod", Period: IndexPeriodWeek, ShardBudget: 3000},
+	"stage": {Environment: "stage", Period: IndexPeriodHour, ShardBudget: 1500},
+	"local": {Environment: "local", Period: IndexPeriod10Min},
+}
+
+// IndexProfileFromConfig resolves the index profile for config.Environment.
+// GE_INDEX_PERIOD may only override the period for local development; in
+// prod and stage a conflicting value is an error rather than a second family
+// of indices. GE_INDEX_SHARD_BUDGET overrides the profile's budget, and
+// GE_INDEX_ROLLOVER switches to rollover with the environment's conditions.
+func IndexProfileFromConfig(config *Config) (IndexProfile, error) {
+	profile, ok := indexProfiles[config.Environment]
+	if !ok {
+		return IndexProfile{}, fmt.Errorf("no index profile for environment %q (expected prod, stage, or local)", config.Environment)
+	}
+
+	if config.IndexPeriod != "" && config.IndexPeriod != profile.Period {
+		if _, known := indexFamilyPatterns[config.IndexPeriod]; !known {
+			return IndexProfile{}, fmt.Errorf("invalid GE_INDEX_PERIOD %q (expected week, hour, or 10min)", config.IndexPeriod)
+		}
+		if profile.Environment != "local" {
+			return IndexProfile{}, fmt.Errorf("GE_INDEX_PERIOD=%s conflicts with the %s profile, which uses %s indices", config.IndexPeriod, profile.Environment, profile.Period)
+		}
+		profile.Period = config.IndexPeriod
+	}
+
+	if config.IndexShardBudget > 0 {
+		profile.ShardBudget = config.IndexShardBudget
+	}
+
+	if config.IndexRollover {
+		conditions, err := rolloverConditionsFromConfig(profile.Environment, config)
+		if err != nil {
+			return IndexProfile{}, err
+		}
+		profile.Rollover = &conditions
+	}
+
+	return profile, nil
+}
+
+// indexFamilyPatterns match the date suffix CurrentIndexName produces for each period
+var indexFamilyPatterns = map[string]*regexp.Regexp{
+	IndexPeriodWeek:  regexp.MustCompile(`^\d{4}-w\d{2}$`),
+	IndexPeriodHour:  regexp.MustCompile(`^\d{4}-\d{2}-\d{2}-\d{2}$`),
+	IndexPeriod10Min: regexp.MustCompile(`^\d{4}-\d{2}-\d{2}-\d{2}-\d{2}$`),
+}
+
+// indexFamily returns the period whose naming pattern index follows, or "" if
+// it is not a period-based index of alias
+func indexFamily(alias, index string) string {
+	suffix, ok := strings.CutPrefix(index, strings.ReplaceAll(alias, "_", "-")+"-")
+	if !ok {
+		return ""
+	}
+	for period, pattern := range indexFamilyPatterns {
+		if pattern.MatchString(suffix) {
+			return period
+		}
+	}
+	return ""
+}
+
+// IndexManager creates the write indices for a set of aliases according to an
+// IndexProfile and keeps each alias's write alias (see WriteAlias) pointed at
+// the current one. Ingest commands use it instead of calling EnsureIndex
+// directly, so every new index is checked against the profile's pattern
+// family and shard budget before it is created.
+type IndexManager struct {
+	client  *elasticsearch.Client
+	profile IndexProfile
+	aliases []string
+	logger  *IngestLogger
+}
+
+// NewIndexManager creates an IndexManager for aliases (e.g. "posts", "likes")
+func NewIndexManager(client *elasticsearch.Client, profile IndexProfile, aliases []string, logger *IngestLogger) *IndexManager {
+	return &IndexManager{
+		client:  client,
+		profile: profile,
+		aliases: aliases,
+		logger:  logger,
+	}
+}
+
+// Profile returns the profile the manager creates indices for
+func (m *IndexManager) Profile() IndexProfile {
+	return m.profile
+}
+
+// EnsureCurrent makes the current index the write target for every managed
+// alias: the current period's index, or in rollover mode the newest rollover
+// index, rolling over first if a condition is met
+func (m *IndexManager) EnsureCurrent(ctx context.Context) error {
+	for _, alias := range m.aliases {
+		if m.profile.Rollover != nil {
+			if err := m.ensureRollover(ctx, alias); err != nil {
+				return fmt.Errorf("failed to roll over %s: %w", alias, err)
+			}
+			continue
+		}
+
+		name := CurrentIndexName(alias, m.profile.Period)
+
+		exists, err := m.indexExists(ctx, name)
+		if err != nil {
+			return fmt.Errorf("failed to ensure index for %s: %w", alias, err)
+		}
+		if !exists {
+			if err := m.checkCreate(ctx, alias, name); err != nil {
+				m.logger.Metric("es.index_manager.create_refused_count", 1)
+				return fmt.Errorf("failed to ensure index for %s: %w", alias, err)
+			}
+		}
+
+		if err := EnsureIndex(ctx, m.client, name, alias, m.logger); err != nil {
+			return fmt.Errorf("failed to ensure index for %s: %w", alias, err)
+		}
+		if err := m.pointWriteAlias(ctx, alias, name); err != nil {
+			return fmt.Errorf("failed to ensure index for %s: %w", alias, err)
+		}
+	}
+	return nil
+}
+
+// Maintain calls EnsureCurrent every interval until ctx is cancelled, so that
+// period changes and rollover conditions are picked up without waiting for
+// the next write. It also restores indices left tuned by bulk jobs that died
+// (see RestoreExpiredTuning).
+func (m *IndexManager) Maintain(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			indexCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			if err := m.EnsureCurrent(indexCtx); err != nil {
+				m.logger.Error("%v", err)
+			}
+			if err := m.RestoreExpiredTuning(indexCtx); err != nil {
+				m.logger.Error("Failed to restore expired bulk tuning: %v", err)
+			}
+			cancel()
+		}
+	}
+}
+
+// checkCreate refuses to create name if alias already has indices from a
+// different pattern family, or if the new index would push the cluster over
+// the shard budget
+func (m *IndexManager) checkCreate(ctx context.Context, alias, name string) error {
+	existing, err := m.catIndices(ctx, strings.ReplaceAll(alias, "_", "-")+"-*")
+	if err != nil {
+		return err
+	}
+	for _, index := range existing {
+		if family := indexFamily(alias, index); family != "" && family != m.profile.Period {
+			return fmt.Errorf("refusing to create %s: %s already has %s-period index %s, and the %s profile allows only %s indices",
+				name, alias, family, index, m.profile.Environment, m.profile.Period)
+		}
+	}
+
+	return m.checkShardBudget(ctx, name)
+}
+
+// checkShardBudget refuses to create name if its shards would push the
+// cluster over the profile's shard budget
+func (m *IndexManager) checkShardBudget(ctx context.Context, name string) error {
+	if m.profile.ShardBudget <= 0 {
+		return nil
+	}
+
+	newShards, err := m.templateShards(ctx, name)
+	if err != nil {
+		return err
+	}
+	used, err := m.clusterShards(ctx)
+	if err != nil {
+		return err
+	}
+	m.logger.Metric("es.index_manager.cluster_shards", float64(used))
+	if used+newShards > m.profile.ShardBudget {
+		return fmt.Errorf("refusing to create %s: it needs %d shards and the cluster already has %d of its %d shard budget",
+			name, newShards, used, m.profile.ShardBudget)
+	}
+	return nil
+}
+
+func (m *IndexManager) indexExists(ctx context.Context, name string) (bool, error) {
+	res, err := m.client.Indices.Exists([]string{name}, m.client.Indices.Exists.WithContext(ctx))
+	if err != nil {
+		return false, fmt.Errorf("check index %s: %w", name, err)
+	}
+	defer func() {
+		if cerr := res.Body.Close(); cerr != nil {
+			m.logger.Error("Failed to close index-exists response body: %v", cerr)
+		}
+	}()
+
+	switch res.StatusCode {
+	case 200:
+		return true, nil
+	case 404:
+		return false, nil
+	default:
+		return false, fmt.Errorf("check index %s: unexpected status %d", name, res.StatusCode)
+	}
+}
+
+// catIndices lists the names of indices matching pattern
+func (m *IndexManager) catIndices(ctx context.Context, pattern string) ([]string, error) {
+	res, err := m.client.Cat.Indices(
+		m.client.Cat.Indices.WithContext(ctx),
+		m.client.Cat.Indices.WithIndex(pattern),
+		m.client.Cat.Indices.WithFormat("json"),
+		m.client.Cat.Indices.WithH("index"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list indices %s: %w", pattern, err)
+	}
+	defer func() {
+		if cerr := res.Body.Close(); cerr != nil {
+			m.logger.Error("Failed to close cat-indices response body: %v", cerr)
+		}
+	}()
+	if res.IsError() {
+		bodyBytes, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("list indices %s: [%d] %s", pattern, res.StatusCode, string(bodyBytes))
+	}
+
+	var rows []struct {
+		Index string `json:"index"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("decode indices %s: %w", pattern, err)
+	}
+	names := make([]string, len(rows))
+	for i, row := range rows {
+		names[i] = row.Index
+	}
+	return names, nil
+}
+
+// templateShards returns the shards (primaries and replicas) the matching
+// index template would give name
+func (m *IndexManager) templateShards(ctx context.Context, name string) (int, error) {
+	res, err := m.client.Indices.SimulateIndexTemplate(name, m.client.Indices.SimulateIndexTemplate.WithContext(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("simulate index %s: %w", name, err)
+	}
+	defer func() {
+		if cerr := res.Body.Close(); cerr != nil {
+			m.logger.Error("Failed to close simulate-index response body: %v", cerr)
+		}
+	}()
+	if res.IsError() {
+		bodyBytes, _ := io.ReadAll(res.Body)
+		return 0, fmt.Errorf("simulate index %s: [%d] %s", name, res.StatusCode, string(bodyBytes))
+	}
+
+	var simulated struct {
+		Template struct {
+			Settings struct {
+				Index struct {
+					NumberOfShards   string `json:"number_of_shards"`
+					NumberOfReplicas string `json:"number_of_replicas"`
+				} `json:"index"`
+			} `json:"settings"`
+		} `json:"template"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&simulated); err != nil {
+		return 0, fmt.Errorf("decode simulated index %s: %w", name, err)
+	}
+
+	// Elasticsearch defaults when the template does not set them
+	primaries, replicas := 1, 1
+	settings := simulated.Template.Settings.Index
+	if settings.NumberOfShards != "" {
+		if primaries, err = strconv.Atoi(settings.NumberOfShards); err != nil {
+			return 0, fmt.Errorf("invalid number_of_shards %q for %s", settings.NumberOfShards, name)
+		}
+	}
+	if settings.NumberOfReplicas != "" {
+		if replicas, err = strconv.Atoi(settings.NumberOfReplicas); err != nil {
+			return 0, fmt.Errorf("invalid number_of_replicas %q for %s", settings.NumberOfReplicas, name)
+		}
+	}
+	return primaries * (1 + replicas), nil
+}
+
+// clusterShards returns the shards the cluster holds, including ones not yet assigned
+func (m *IndexManager) clusterShards(ctx context.Context) (int, error) {
+	res, err := m.client.Cluster.Health(m.client.Cluster.Health.WithContext(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("cluster health: %w", err)
+	}
+	defer func() {
+		if cerr := res.Body.Close(); cerr != nil {
+			m.logger.Error("Failed to close cluster-health response body: %v", cerr)
+		}
+	}()
+	if res.IsError() {
+		bodyBytes, _ := io.ReadAll(res.Body)
+		return 0, fmt.Errorf("cluster health: [%d] %s", res.StatusCode, string(bodyBytes))
+	}
+
+	var health struct {
+		ActiveShards       int `json:"active_shards"`
+		InitializingShards int `json:"initializing_shards"`
+		UnassignedShards   int `json:"unassigned_shards"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&health); err != nil {
+		return 0, fmt.Errorf("decode cluster health: %w", err)
+	}
+	return health.ActiveShards + health.InitializingShards + health.UnassignedShards, nil
+}
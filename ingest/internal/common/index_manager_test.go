@@ -0,0 +1,130 @@
+package common
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestIndexProfileFromConfig(t *testing.T) {
+	profile, err := IndexProfileFromConfig(&Config{Environment: "prod"})
+	if err != nil || profile.Period != IndexPeriodWeek || profile.ShardBudget != 3000 {
+		t.Errorf("prod profile = %+v, %v", profile, err)
+	}
+
+	profile, err = IndexProfileFromConfig(&Config{Environment: "stage", IndexPeriod: IndexPeriodHour, IndexShardBudget: 200})
+	if err != nil || profile.Period != IndexPeriodHour || profile.ShardBudget != 200 {
+		t.Errorf("stage profile = %+v, %v", profile, err)
+	}
+
+	if _, err := IndexProfileFromConfig(&Config{Environment: "prod", IndexPeriod: IndexPeriodHour}); err == nil {
+		t.Error("expected hourly period to be rejected in prod")
+	}
+
+	profile, err = IndexProfileFromConfig(&Config{Environment: "local", IndexPeriod: IndexPeriodHour})
+	if err != nil || profile.Period != IndexPeriodHour {
+		t.Errorf("local override = %+v, %v", profile, err)
+	}
+
+	if _, err := IndexProfileFromConfig(&Config{Environment: "local", IndexPeriod: "daily"}); err == nil {
+		t.Error("expected unknown period to be rejected")
+	}
+	if _, err := IndexProfileFromConfig(&Config{Environment: "qa"}); err == nil {
+		t.Error("expected unknown environment to be rejected")
+	}
+}
+
+func TestIndexFamily(t *testing.T) {
+	cases := map[string]string{
+		"likes-2026-w17":                IndexPeriodWeek,
+		"likes-2026-04-27-00":           IndexPeriodHour,
+		"likes-2026-04-27-00-10":        IndexPeriod10Min,
+		"likes-restored":                "",
+		"like-tombstones-2026-04-27-00": "",
+		"post-tombstones-2026-04-27-00": "",
+		"posts-2026-w17-reindexed":      "",
+	}
+	for index, want := range cases {
+		if got := indexFamily("likes", index); got != want {
+			t.Errorf("indexFamily(likes, %s) = %q, want %q", index, got, want)
+		}
+	}
+	if got := indexFamily("post_tombstones", "post-tombstones-2026-w17"); got != IndexPeriodWeek {
+		t.Errorf("expected kebab-case index to match underscore alias, got %q", got)
+	}
+}
+
+// indexManagerHandler simulates a cluster where the current index does not
+// exist yet; created records whether the index was created
+func indexManagerHandler(t *testing.T, existing, simulate, health string, created *bool) http.Handler {
+	t.Helper()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(404)
+		case strings.HasPrefix(r.URL.Path, "/_cat/indices"):
+			_, _ = w.Write([]byte(existing))
+		case strings.HasPrefix(r.URL.Path, "/_index_template/_simulate_index/"):
+			_, _ = w.Write([]byte(simulate))
+		case r.URL.Path == "/_cluster/health":
+			_, _ = w.Write([]byte(health))
+		case strings.HasPrefix(r.URL.Path, "/_alias/"):
+			_, _ = w.Write([]byte(`{}`))
+		case r.Method == http.MethodPut:
+			*created = true
+			_, _ = w.Write([]byte(`{"acknowledged":true}`))
+		default:
+			_, _ = w.Write([]byte(`{"acknowledged":true}`))
+		}
+	})
+}
+
+func TestIndexManager_RefusesSecondPatternFamily(t *testing.T) {
+	created := false
+	client, srv := newMockESClient(t, indexManagerHandler(t, `[{"index":"likes-2026-04-27-00"}]`, `{}`, `{}`, &created))
+	defer srv.Close()
+
+	manager := NewIndexManager(client, IndexProfile{Environment: "prod", Period: IndexPeriodWeek}, []string{"likes"}, NewLogger(false))
+	err := manager.EnsureCurrent(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "hour-period index likes-2026-04-27-00") {
+		t.Errorf("expected refusal naming the hourly index, got %v", err)
+	}
+	if created {
+		t.Error("index must not be created when another pattern family exists")
+	}
+}
+
+func TestIndexManager_RefusesOverShardBudget(t *testing.T) {
+	created := false
+	simulate := `{"template":{"settings":{"index":{"number_of_shards":"10","number_of_replicas":"1"}}}}`
+	health := `{"active_shards":2990,"initializing_shards":0,"unassigned_shards":0}`
+	client, srv := newMockESClient(t, indexManagerHandler(t, `[{"index":"likes-2026-w16"}]`, simulate, health, &created))
+	defer srv.Close()
+
+	manager := NewIndexManager(client, IndexProfile{Environment: "prod", Period: IndexPeriodWeek, ShardBudget: 3000}, []string{"likes"}, NewLogger(false))
+	err := manager.EnsureCurrent(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "needs 20 shards") {
+		t.Errorf("expected shard budget refusal, got %v", err)
+	}
+	if created {
+		t.Error("index must not be created over the shard budget")
+	}
+}
+
+func TestIndexManager_CreatesWithinBudget(t *testing.T) {
+	created := false
+	simulate := `{"template":{"settings":{"index":{"number_of_shards":"10","number_of_replicas":"1"}}}}`
+	health := `{"active_shards":100,"initializing_shards":0,"unassigned_shards":0}`
+	client, srv := newMockESClient(t, indexManagerHandler(t, `[]`, simulate, health, &created))
+	defer srv.Close()
+
+	manager := NewIndexManager(client, IndexProfile{Environment: "prod", Period: IndexPeriodWeek, ShardBudget: 3000}, []string{"likes"}, NewLogger(false))
+	if err := manager.EnsureCurrent(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !created {
+		t.Error("expected the current index to be created")
+	}
+}
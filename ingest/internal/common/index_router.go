@@ -0,0 +1,185 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// likeCreatedAtSkew is how far past indexed_at a like's created_at may be
+// before it is treated as untrustworthy
+const likeCreatedAtSkew = 10 * time.Minute
+
+// IndexRouterConfig controls how IndexRouter buckets likes
+type IndexRouterConfig struct {
+	Bucket string        // IndexPeriodWeek, IndexPeriodHour, or IndexPeriod10Min
+	MaxAge time.Duration // Likes created longer than this before they were indexed are bucketed by indexed_at
+}
+
+// IndexRouterConfigFromConfig returns the likes routing configuration in config
+func IndexRouterConfigFromConfig(config *Config) IndexRouterConfig {
+	return IndexRouterConfig{
+		Bucket: config.LikesIndexBucket,
+		MaxAge: config.LikesIndexMaxAge,
+	}
+}
+
+// IndexRouter spreads likes across time-bucketed indices by created_at, so
+// that no single index (and its shards) holds every like. Each bucket's index
+// joins the likes read alias when it is created; there is no write alias,
+// since writes are addressed to the bucket's index directly. This replaces
+// IndexManager's rotation for likes, which bucketed by when a like arrived.
+//
+// A like's bucket depends only on its created_at and indexed_at, so a like is
+// always routed to the same index. created_at is client-supplied, so likes
+// dated in the future or more than MaxAge before indexed_at are bucketed by
+// indexed_at instead, rather than creating an index per bogus date.
+type IndexRouter struct {
+	client  *elasticsearch.Client
+	alias   string
+	config  IndexRouterConfig
+	budget  *IndexManager // Checks new indices against the profile's shard budget
+	logger  *IngestLogger
+	mu      sync.Mutex
+	ensured map[string]bool
+}
+
+// NewIndexRouter creates the router for alias (e.g. "likes"). New indices are
+// checked against profile's shard budget.
+func NewIndexRouter(client *elasticsearch.Client, profile IndexProfile, alias string, config IndexRouterConfig, logger *IngestLogger) (*IndexRouter, error) {
+	if _, known := indexFamilyPatterns[config.Bucket]; !known {
+		return nil, fmt.Errorf("invalid GE_LIKES_INDEX_BUCKET %q (expected week, hour, or 10min)", config.Bucket)
+	}
+	if config.MaxAge <= 0 {
+		return nil, fmt.Errorf("invalid GE_LIKES_INDEX_MAX_AGE %s (must be positive)", config.MaxAge)
+	}
+	return &IndexRouter{
+		client:  client,
+		alias:   alias,
+		config:  config,
+		budget:  NewIndexManager(client, profile, nil, logger),
+		logger:  logger,
+		ensured: make(map[string]bool),
+	}, nil
+}
+
+// IndexFor returns the index like belongs in
+func (r *IndexRouter) IndexFor(like LikeDoc) string {
+	return IndexNameAt(r.alias, r.config.Bucket, r.bucketTime(like))
+}
+
+// bucketTime returns the time like is bucketed by: created_at if it is
+// plausible, otherwise indexed_at, otherwise now
+func (r *IndexRouter) bucketTime(like LikeDoc) time.Time {
+	indexedAt, err := time.Parse(time.RFC3339, like.IndexedAt)
+	if err != nil {
+		indexedAt = time.Now()
+	}
+	createdAt, err := time.Parse(time.RFC3339, like.CreatedAt)
+	if err != nil || createdAt.After(indexedAt.Add(likeCreatedAtSkew)) || createdAt.Before(indexedAt.Add(-r.config.MaxAge)) {
+		r.logger.Metric("es.index_router.untrusted_created_at_count", 1)
+		return indexedAt
+	}
+	return createdAt
+}
+
+// Route sets the Index of each like to its bucket's index, creating any
+// bucket index that does not exist yet. A nil router (as in dry runs) leaves
+// likes unrouted.
+func (r *IndexRouter) Route(ctx context.Context, likes []LikeDoc) error {
+	if r == nil {
+		return nil
+	}
+	for i := range likes {
+		likes[i].Index = r.IndexFor(likes[i])
+		if err := r.ensure(ctx, likes[i].Index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RouteDeletes sends deletes whose index is unknown, because the like was
+// not found, to the current bucket's index. A like too new to be searchable
+// yet is almost certainly there; elsewhere the delete is a harmless miss. A
+// nil router leaves deletes unrouted.
+func (r *IndexRouter) RouteDeletes(deletes []DeleteDoc) {
+	if r == nil {
+		return
+	}
+	current := CurrentIndexName(r.alias, r.config.Bucket)
+	for i := range deletes {
+		if deletes[i].Index == "" {
+			deletes[i].Index = current
+		}
+	}
+}
+
+// ensure creates name in the read alias unless it has already been ensured
+func (r *IndexRouter) ensure(ctx context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.ensured[name] {
+		return nil
+	}
+
+	exists, err := r.budget.indexExists(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to ensure index %s: %w", name, err)
+	}
+	if !exists {
+		if err := r.budget.checkShardBudget(ctx, name); err != nil {
+			r.logger.Metric("es.index_router.create_refused_count", 1)
+			return fmt.Errorf("failed to ensure index %s: %w", name, err)
+		}
+		if err := r.create(ctx, name); err != nil {
+			return fmt.Errorf("failed to ensure index %s: %w", name, err)
+		}
+	}
+
+	r.ensured[name] = true
+	return nil
+}
+
+// create creates name as a member of the read alias. The matching index
+// template applies settings and mappings; an index created concurrently by
+// another ingester is treated as success.
+func (r *IndexRouter) create(ctx context.Context, name string) error {
+	body := fmt.Sprintf(`{"aliases":{%q:{}}}`, r.alias)
+	res, err := r.client.Indices.Create(
+		name,
+		r.client.Indices.Create.WithContext(ctx),
+		r.client.Indices.Create.WithBody(strings.NewReader(body)),
+	)
+	if err != nil {
+		return fmt.Errorf("create index %s: %w", name, err)
+	}
+	defer func() {
+		if cerr := res.Body.Close(); cerr != nil {
+			r.logger.Error("Failed to close create-index response body: %v", cerr)
+		}
+	}()
+
+	if res.IsError() {
+		bodyBytes, _ := io.ReadAll(res.Body)
+		var errBody struct {
+			Error struct {
+				Type string `json:"type"`
+			} `json:"error"`
+		}
+		if jerr := json.Unmarshal(bodyBytes, &errBody); jerr != nil || errBody.Error.Type != "resource_already_exists_exception" {
+			return fmt.Errorf("create index %s: [%d] %s", name, res.StatusCode, string(bodyBytes))
+		}
+		return nil
+	}
+
+	r.logger.Info("Created index %s in alias %s", name, r.alias)
+	r.logger.Metric("es.index_router.created_count", 1)
+	return nil
+}
@@ -0,0 +1,140 @@
+package common
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIndexRouter_IndexFor(t *testing.T) {
+	router, err := NewIndexRouter(nil, IndexProfile{}, "likes", IndexRouterConfig{Bucket: IndexPeriodWeek, MaxAge: 30 * 24 * time.Hour}, NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	indexedAt := "2026-04-15T12:00:00Z" // 2026-w16
+	cases := map[string]string{
+		"2026-04-14T08:00:00Z":      "likes-2026-w16",
+		"2026-04-05T23:59:59Z":      "likes-2026-w14", // Sunday closes the ISO week
+		"2026-04-15T12:05:00Z":      "likes-2026-w16", // within the clock skew allowance
+		"2026-04-15T14:00:00+02:00": "likes-2026-w16",
+		"2027-01-01T00:00:00Z":      "likes-2026-w16", // future: bucketed by indexed_at
+		"1970-01-01T00:00:00Z":      "likes-2026-w16", // older than MaxAge
+		"not a time":                "likes-2026-w16",
+	}
+	for createdAt, want := range cases {
+		if got := router.IndexFor(LikeDoc{CreatedAt: createdAt, IndexedAt: indexedAt}); got != want {
+			t.Errorf("IndexFor(created_at %s) = %s, want %s", createdAt, got, want)
+		}
+	}
+}
+
+func TestNewIndexRouter_RejectsInvalidConfig(t *testing.T) {
+	for _, config := range []IndexRouterConfig{
+		{Bucket: "daily", MaxAge: time.Hour},
+		{Bucket: IndexPeriodWeek},
+	} {
+		if _, err := NewIndexRouter(nil, IndexProfile{}, "likes", config, NewLogger(false)); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
+
+func TestIndexRouter_RouteCreatesBucketIndicesOnce(t *testing.T) {
+	var mu sync.Mutex
+	created := map[string]string{}
+	client, srv := newMockESClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		switch r.Method {
+		case http.MethodHead:
+			w.WriteHeader(404)
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			created[strings.TrimPrefix(r.URL.Path, "/")] = string(body)
+			mu.Unlock()
+			_, _ = w.Write([]byte(`{"acknowledged":true}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	router, err := NewIndexRouter(client, IndexProfile{}, "likes", IndexRouterConfig{Bucket: IndexPeriodWeek, MaxAge: 30 * 24 * time.Hour}, NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	likes := []LikeDoc{
+		{AtURI: "at://a", CreatedAt: "2026-04-14T08:00:00Z", IndexedAt: "2026-04-15T12:00:00Z"},
+		{AtURI: "at://b", CreatedAt: "2026-04-05T08:00:00Z", IndexedAt: "2026-04-15T12:00:00Z"},
+		{AtURI: "at://c", CreatedAt: "2026-04-15T11:00:00Z", IndexedAt: "2026-04-15T12:00:00Z"},
+	}
+	if err := router.Route(t.Context(), likes); err != nil {
+		t.Fatal(err)
+	}
+	if err := router.Route(t.Context(), likes[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	if likes[0].Index != "likes-2026-w16" || likes[1].Index != "likes-2026-w14" || likes[2].Index != "likes-2026-w16" {
+		t.Errorf("unexpected routing %q %q %q", likes[0].Index, likes[1].Index, likes[2].Index)
+	}
+	if len(created) != 2 {
+		t.Fatalf("expected each bucket index created once, got %v", created)
+	}
+	if body := created["likes-2026-w14"]; body != `{"aliases":{"likes":{}}}` {
+		t.Errorf("expected the index created in the likes read alias, got %s", body)
+	}
+}
+
+func TestIndexRouter_RouteDeletes(t *testing.T) {
+	router, err := NewIndexRouter(nil, IndexProfile{}, "likes", IndexRouterConfig{Bucket: IndexPeriodHour, MaxAge: time.Hour}, NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deletes := []DeleteDoc{{DocID: "at://found", Index: "likes-2026-04-01-00"}, {DocID: "at://missing"}}
+	router.RouteDeletes(deletes)
+
+	if deletes[0].Index != "likes-2026-04-01-00" {
+		t.Errorf("expected a found like's index to be kept, got %s", deletes[0].Index)
+	}
+	if deletes[1].Index == "" || !strings.HasPrefix(deletes[1].Index, "likes-") {
+		t.Errorf("expected a missing like to be deleted from the current bucket, got %q", deletes[1].Index)
+	}
+
+	var nilRouter *IndexRouter
+	unrouted := []LikeDoc{{AtURI: "at://a"}}
+	if err := nilRouter.Route(t.Context(), unrouted); err != nil || unrouted[0].Index != "" {
+		t.Error("expected a nil router to leave likes unrouted")
+	}
+}
+
+func TestBulkGetLikes_RecordsBackingIndex(t *testing.T) {
+	client, srv := newMockESClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		if r.URL.Path != "/likes/_search" {
+			t.Errorf("expected a search of the read alias, got %s", r.URL.Path)
+		}
+		if routing := r.URL.Query().Get("routing"); routing != "did:plc:a" {
+			t.Errorf("expected routing by author, got %q", routing)
+		}
+		_, _ = w.Write([]byte(`{"hits":{"hits":[{"_index":"likes-2026-w14","_id":"at://a","_source":{"at_uri":"at://a","subject_uri":"at://post"}}]}}`))
+	}))
+	defer srv.Close()
+
+	likes, err := BulkGetLikes(t.Context(), client, "likes", []LikeIdentifier{
+		{AtURI: "at://a", AuthorDID: "did:plc:a"},
+		{AtURI: "at://b", AuthorDID: "did:plc:a"},
+	}, NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(likes) != 1 || likes["at://a"].Index != "likes-2026-w14" || likes["at://a"].SubjectURI != "at://post" {
+		t.Errorf("unexpected likes %+v", likes)
+	}
+}
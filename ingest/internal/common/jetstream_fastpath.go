@@ -0,0 +1,364 @@
+package common
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// likeCollection is the collection scanLikeEvent reads
+const likeCollection = "app.bsky.feed.like"
+
+// scanLikeEvent reads the fields of a like commit straight from the raw
+// event, skipping everything else without decoding it. Decoding full events
+// into JetstreamEventData, whose record is a map[string]interface{}, is most
+// of the CPU jetstream_ingest spends on likes.
+//
+// It returns false for anything but a like commit, and for events it cannot
+// read exactly as encoding/json would: malformed JSON, fields of unexpected
+// types, or keys in other than their canonical case. Those go to the full
+// parser, so the result never differs from it.
+func scanLikeEvent(raw string) (likeEvent, bool) {
+	var event likeEvent
+	var kind, key string
+	s := jsonScanner{data: raw}
+
+	if !s.beginObject() {
+		return likeEvent{}, false
+	}
+	for first := true; s.nextKey(&first, &key); {
+		var ok bool
+		switch key {
+		case "did":
+			ok = s.str(&event.did)
+		case "time_us":
+			ok = s.int(&event.timeUs)
+		case "kind":
+			ok = s.str(&kind)
+		case "commit":
+			ok = s.likeCommit(&event)
+		default:
+			ok = s.skipField(key)
+		}
+		if !ok {
+			return likeEvent{}, false
+		}
+	}
+	if s.bad || !s.end() || kind != "commit" || event.collection != likeCollection {
+		return likeEvent{}, false
+	}
+	return event, true
+}
+
+// likeCommit reads a commit's operation, collection, rkey, and record
+func (s *jsonScanner) likeCommit(event *likeEvent) bool {
+	var key string
+	if !s.beginObject() {
+		return false
+	}
+	for first := true; s.nextKey(&first, &key); {
+		var ok bool
+		switch key {
+		case "operation":
+			ok = s.str(&event.operation)
+		case "collection":
+			ok = s.str(&event.collection)
+		case "rkey":
+			ok = s.str(&event.rkey)
+		case "record":
+			ok = s.likeRecord(event)
+		default:
+			ok = s.skipField(key)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return !s.bad
+}
+
+// likeRecord reads a like record's subject URI and createdAt. As with the
+// full parser, values of other types are ignored rather than rejected.
+func (s *jsonScanner) likeRecord(event *likeEvent) bool {
+	var key string
+	if !s.beginObject() {
+		return false
+	}
+	for first := true; s.nextKey(&first, &key); {
+		var ok bool
+		switch {
+		case key == "subject" && s.peek() == '{':
+			ok = s.likeSubject(event)
+		case key == "createdAt" && s.peek() == '"':
+			event.hasCreatedAt = true
+			ok = s.str(&event.createdAt)
+		default:
+			ok = s.skipField(key)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return !s.bad
+}
+
+// likeSubject reads the URI of a like's subject
+func (s *jsonScanner) likeSubject(event *likeEvent) bool {
+	var key string
+	if !s.beginObject() {
+		return false
+	}
+	for first := true; s.nextKey(&first, &key); {
+		var ok bool
+		if key == "uri" && s.peek() == '"' {
+			ok = s.str(&event.subjectURI)
+		} else {
+			ok = s.skipField(key)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return !s.bad
+}
+
+// jsonScanner walks a JSON document in place. Each value method consumes one
+// value and reports whether it was well formed. Objects are read with
+// beginObject and a nextKey loop, after which bad reports malformed input.
+type jsonScanner struct {
+	data string
+	pos  int
+	bad  bool
+}
+
+func (s *jsonScanner) skipSpace() {
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case ' ', '\t', '\n', '\r':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+// peek returns the next non-space byte without consuming it, or 0 at the end
+func (s *jsonScanner) peek() byte {
+	s.skipSpace()
+	if s.pos >= len(s.data) {
+		return 0
+	}
+	return s.data[s.pos]
+}
+
+// end reports whether only whitespace remains
+func (s *jsonScanner) end() bool {
+	return s.peek() == 0 && s.pos == len(s.data)
+}
+
+// beginObject consumes the opening brace of an object
+func (s *jsonScanner) beginObject() bool {
+	if s.peek() != '{' {
+		return false
+	}
+	s.pos++
+	return true
+}
+
+// nextKey reads the next key of an object into key, leaving the scanner at
+// its value; first is true before the first key. It returns false once it
+// consumes the closing brace, or on malformed input, which sets bad.
+func (s *jsonScanner) nextKey(first *bool, key *string) bool {
+	switch c := s.peek(); {
+	case c == '}':
+		s.pos++
+		return false
+	case *first:
+		*first = false
+	case c == ',':
+		s.pos++
+	default:
+		s.bad = true
+		return false
+	}
+	if s.peek() != '"' || !s.str(key) || s.peek() != ':' {
+		s.bad = true
+		return false
+	}
+	s.pos++
+	return true
+}
+
+// skipField skips the value of a key the caller does not read. A key that
+// matches a read key only case-insensitively would be read by encoding/json,
+// so it fails the scan instead.
+func (s *jsonScanner) skipField(key string) bool {
+	for _, known := range [...]string{"did", "time_us", "kind", "commit", "operation", "collection", "rkey", "record", "subject", "uri", "createdAt"} {
+		if key != known && strings.EqualFold(key, known) {
+			return false
+		}
+	}
+	return s.skipValue()
+}
+
+// str reads a string into dst. Strings with escapes or invalid UTF-8, which
+// encoding/json rewrites, are decoded by it; others are sliced as they are.
+func (s *jsonScanner) str(dst *string) bool {
+	if s.peek() != '"' {
+		return false
+	}
+	start := s.pos
+	escaped := false
+	for i := start + 1; i < len(s.data); i++ {
+		switch c := s.data[i]; {
+		case c == '\\':
+			escaped = true
+			i++
+		case c == '"':
+			s.pos = i + 1
+			if raw := s.data[start+1 : i]; !escaped && utf8.ValidString(raw) {
+				*dst = raw
+				return true
+			}
+			// Decoded into a local so dst does not escape on the common path
+			var decoded string
+			if err := json.Unmarshal([]byte(s.data[start:s.pos]), &decoded); err != nil {
+				return false
+			}
+			*dst = decoded
+			return true
+		case c < 0x20:
+			return false
+		}
+	}
+	return false
+}
+
+// int reads an integer into dst
+func (s *jsonScanner) int(dst *int64) bool {
+	text, ok := s.numberText()
+	if !ok {
+		return false
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return false
+	}
+	*dst = n
+	return true
+}
+
+// skipValue skips one value of any type
+func (s *jsonScanner) skipValue() bool {
+	switch c := s.peek(); {
+	case c == '"':
+		return s.skipString()
+	case c == '{':
+		var key string
+		s.pos++
+		for first := true; s.nextKey(&first, &key); {
+			if !s.skipValue() {
+				return false
+			}
+		}
+		return !s.bad
+	case c == '[':
+		s.pos++
+		if s.peek() == ']' {
+			s.pos++
+			return true
+		}
+		for {
+			if !s.skipValue() {
+				return false
+			}
+			switch s.peek() {
+			case ',':
+				s.pos++
+			case ']':
+				s.pos++
+				return true
+			default:
+				return false
+			}
+		}
+	case c == 't':
+		return s.literal("true")
+	case c == 'f':
+		return s.literal("false")
+	case c == 'n':
+		return s.literal("null")
+	case c == '-' || (c >= '0' && c <= '9'):
+		return s.number()
+	}
+	return false
+}
+
+// skipString skips a string without unescaping it
+func (s *jsonScanner) skipString() bool {
+	for i := s.pos + 1; i < len(s.data); i++ {
+		switch c := s.data[i]; {
+		case c == '\\':
+			if i+1 >= len(s.data) {
+				return false
+			}
+			i++
+			switch s.data[i] {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+			case 'u':
+				if i+4 >= len(s.data) {
+					return false
+				}
+				if _, err := strconv.ParseUint(s.data[i+1:i+5], 16, 16); err != nil {
+					return false
+				}
+				i += 4
+			default:
+				return false
+			}
+		case c == '"':
+			s.pos = i + 1
+			return true
+		case c < 0x20:
+			return false
+		}
+	}
+	return false
+}
+
+func (s *jsonScanner) literal(word string) bool {
+	if !strings.HasPrefix(s.data[s.pos:], word) {
+		return false
+	}
+	s.pos += len(word)
+	return true
+}
+
+// number skips a number
+func (s *jsonScanner) number() bool {
+	_, ok := s.numberText()
+	return ok
+}
+
+// numberText consumes a number, returning its text if it follows the JSON
+// grammar: no leading +, leading zeros, or bare decimal point
+func (s *jsonScanner) numberText() (string, bool) {
+	s.skipSpace()
+	start := s.pos
+	for s.pos < len(s.data) && strings.IndexByte("+-.0123456789eE", s.data[s.pos]) >= 0 {
+		s.pos++
+	}
+	text := s.data[start:s.pos]
+	digits := strings.TrimPrefix(text, "-")
+	if digits == "" || digits[0] < '0' || digits[0] > '9' {
+		return "", false
+	}
+	if len(digits) > 1 && digits[0] == '0' && digits[1] >= '0' && digits[1] <= '9' {
+		return "", false
+	}
+	if _, err := strconv.ParseFloat(text, 64); err != nil || strings.Contains(text, ".e") || strings.Contains(text, ".E") || strings.HasSuffix(text, ".") {
+		return "", false
+	}
+	return text, true
+}
@@ -0,0 +1,92 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// benchmarkLikeEvent is a like as Jetstream sends it, including the fields
+// like documents do not use
+const benchmarkLikeEvent = `{"did":"did:plc:abcdefghijklmnopqrstuvwx","time_us":1764183883593160,"kind":"commit","commit":{"rev":"3m4zb3vk4ai2x","operation":"create","collection":"app.bsky.feed.like","rkey":"3m4zb3vk46q26","record":{"$type":"app.bsky.feed.like","createdAt":"2025-11-26T19:04:43.297Z","subject":{"cid":"bafyreigh7yh4pmhm3vdvkz3ayztqy6hcxnkkfbgsaemwlyvn3oifs5jvhy","uri":"at://did:plc:xyz/app.bsky.feed.post/3m4yz7w6tbk2c"},"via":{"cid":"bafyreif3pr3yatxvuwmwxppcmfzyawgdn7hnhvypvoxtrbs3u4twq3kq3a","uri":"at://did:plc:xyz/app.bsky.feed.repost/3m4yzabc"}},"cid":"bafyreib2rxk3rybk3aobmv2cjuatpj7kbjmhzrtqdjdhvqyj7cxvoc3mxy"}}`
+
+func TestScanLikeEvent_MatchesFullParser(t *testing.T) {
+	tests := map[string]string{
+		"create":             benchmarkLikeEvent,
+		"delete":             `{"did":"did:plc:a","time_us":1,"kind":"commit","commit":{"operation":"delete","collection":"app.bsky.feed.like","rkey":"r"}}`,
+		"escaped strings":    `{"did":"did:plc:ab","time_us":2,"kind":"commit","commit":{"operation":"create","collection":"app.bsky.feed.like","rkey":"r","record":{"createdAt":"2025-01-27T12:34:56Z","subject":{"uri":"at:\/\/did:plc:x\/app.bsky.feed.post\/1"}}}}`,
+		"non-string fields":  `{"did":"did:plc:a","time_us":3,"kind":"commit","commit":{"operation":"create","collection":"app.bsky.feed.like","rkey":"r","record":{"createdAt":17,"subject":"at://did:plc:x/app.bsky.feed.post/1"}}}`,
+		"uri not a string":   `{"did":"did:plc:a","time_us":4,"kind":"commit","commit":{"operation":"create","collection":"app.bsky.feed.like","rkey":"r","record":{"createdAt":"2025-01-27T12:34:56Z","subject":{"uri":null}}}}`,
+		"nested extra value": `{"did":"did:plc:a","extra":[{"a":[true,false,null,-1.5e3,"}"]}],"time_us":5,"kind":"commit","commit":{"operation":"create","collection":"app.bsky.feed.like","rkey":"r","record":{}}}`,
+		"whitespace":         " {\n\t\"did\" : \"did:plc:a\" , \"time_us\" : 6 , \"kind\" : \"commit\" , \"commit\" : { \"collection\" : \"app.bsky.feed.like\" } }\n",
+	}
+	for name, raw := range tests {
+		fast, ok := scanLikeEvent(raw)
+		if !ok {
+			t.Errorf("%s: expected the fast path to read the event", name)
+			continue
+		}
+		var event JetstreamEventData
+		if err := json.Unmarshal([]byte(raw), &event); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if full := likeEventFromData(event); fast != full {
+			t.Errorf("%s: fast path read %+v, full parser %+v", name, fast, full)
+		}
+	}
+}
+
+func TestScanLikeEvent_FallsBack(t *testing.T) {
+	tests := map[string]string{
+		"post":             `{"did":"did:plc:a","time_us":1,"kind":"commit","commit":{"operation":"create","collection":"app.bsky.feed.post","rkey":"r"}}`,
+		"identity":         `{"did":"did:plc:a","time_us":1,"kind":"identity","identity":{}}`,
+		"malformed":        `{"did":"did:plc:a","kind":"commit","commit":{"collection":"app.bsky.feed.like"`,
+		"trailing comma":   `{"did":"did:plc:a","kind":"commit","commit":{"collection":"app.bsky.feed.like"},}`,
+		"trailing data":    `{"did":"did:plc:a","kind":"commit","commit":{"collection":"app.bsky.feed.like"}} {}`,
+		"invalid escape":   `{"did":"did:plc:a","kind":"commit","commit":{"collection":"app.bsky.feed.like","x":"\q"}}`,
+		"leading zero":     `{"did":"did:plc:a","time_us":01,"kind":"commit","commit":{"collection":"app.bsky.feed.like"}}`,
+		"did not a string": `{"did":null,"kind":"commit","commit":{"collection":"app.bsky.feed.like"}}`,
+		"key case":         `{"DID":"did:plc:a","kind":"commit","commit":{"collection":"app.bsky.feed.like"}}`,
+	}
+	for name, raw := range tests {
+		if event, ok := scanLikeEvent(raw); ok {
+			t.Errorf("%s: expected a fallback to the full parser, read %+v", name, event)
+		}
+	}
+}
+
+func TestNewJetstreamMessage_FastPathLike(t *testing.T) {
+	msg := NewJetstreamMessage(benchmarkLikeEvent, NewLogger(false))
+
+	if !msg.IsLike() || msg.ParseError() != nil {
+		t.Fatalf("expected a like, got parse error %v", msg.ParseError())
+	}
+	if got := msg.GetAtURI(); got != "at://did:plc:abcdefghijklmnopqrstuvwx/app.bsky.feed.like/3m4zb3vk46q26" {
+		t.Errorf("unexpected at_uri %s", got)
+	}
+	if got := msg.GetSubjectURI(); got != "at://did:plc:xyz/app.bsky.feed.post/3m4yz7w6tbk2c" {
+		t.Errorf("unexpected subject_uri %s", got)
+	}
+	if msg.GetCreatedAt() != "2025-11-26T19:04:43Z" || msg.GetTimeUs() != 1764183883593160 || msg.GetAuthorDID() != "did:plc:abcdefghijklmnopqrstuvwx" {
+		t.Errorf("unexpected fields %+v", msg)
+	}
+}
+
+// The fast path should read likes at least twice as fast as the full parser:
+//
+//	go test ./internal/common -run '^$' -bench JetstreamLike -benchmem
+func BenchmarkJetstreamLike_FullParser(b *testing.B) {
+	logger := NewLogger(false)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msg := &jetstreamMessage{}
+		msg.parseRawEvent(benchmarkLikeEvent, logger)
+	}
+}
+
+func BenchmarkJetstreamLike_FastPath(b *testing.B) {
+	logger := NewLogger(false)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		NewJetstreamMessage(benchmarkLikeEvent, logger)
+	}
+}
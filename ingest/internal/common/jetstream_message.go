@@ -9,23 +9,45 @@ import (
 type JetstreamMessage interface {
 	GetAtURI() string
 	GetSubjectURI() string
+	GetSubjectDID() string
 	GetAuthorDID() string
 	GetCreatedAt() string
 	GetTimeUs() int64
 	IsLike() bool
 	IsLikeDelete() bool
+	IsFollow() bool
+	IsFollowDelete() bool
+	IsBlock() bool
+	IsBlockDelete() bool
+	IsPost() bool
+	IsPostDelete() bool
+	GetPost() MegaStreamMessage
+	IsAccountEvent() bool
+	IsAccountDeletion() bool
+	GetAccountStatus() string
+	ParseError() error
 }
 
 // jetstreamMessage is the implementation of JetstreamMessage
 type jetstreamMessage struct {
-	uri          string
-	subjectURI   string
-	authorDID    string
-	createdAt    string
-	timeUs       int64
-	isLike       bool
-	isLikeDelete bool
-	parseError   error
+	uri            string
+	subjectURI     string
+	authorDID      string
+	createdAt      string
+	timeUs         int64
+	isLike         bool
+	isLikeDelete   bool
+	subjectDID     string
+	isFollow       bool
+	isFollowDelete bool
+	isBlock        bool
+	isBlockDelete  bool
+	isPost         bool
+	isPostDelete   bool
+	post           MegaStreamMessage
+	isAccountEvent bool
+	accountStatus  string
+	parseError     error
 }
 
 // JetstreamEventData represents the raw Jetstream event structure
@@ -40,11 +62,39 @@ type JetstreamEventData struct {
 		Record     map[string]interface{} `json:"record"`
 		CID        string                 `json:"cid"`
 	} `json:"commit"`
+	// Account is set on account events, which report hosting status changes
+	Account struct {
+		Active bool   `json:"active"`
+		Status string `json:"status"`
+	} `json:"account"`
+}
+
+// likeEvent holds the fields of a like commit that like documents are built
+// from. It is filled by scanLikeEvent on the fast path, or from a fully
+// parsed JetstreamEventData otherwise.
+type likeEvent struct {
+	did          string
+	timeUs       int64
+	collection   string
+	operation    string
+	rkey         string
+	subjectURI   string
+	createdAt    string
+	hasCreatedAt bool
 }
 
-// NewJetstreamMessage creates a new JetstreamMessage from raw Jetstream JSON data
+// NewJetstreamMessage creates a new JetstreamMessage from raw Jetstream JSON
+// data. Like commits, the bulk of the stream, are read by scanLikeEvent
+// without decoding the rest of the event; everything else, and any like the
+// scanner cannot read, goes through the full parser.
 func NewJetstreamMessage(rawJSON string, logger *IngestLogger) JetstreamMessage {
 	msg := &jetstreamMessage{}
+	if event, ok := scanLikeEvent(rawJSON); ok {
+		msg.authorDID = event.did
+		msg.timeUs = event.timeUs
+		msg.parseLike(event, logger)
+		return msg
+	}
 	msg.parseRawEvent(rawJSON, logger)
 	return msg
 }
@@ -61,39 +111,131 @@ func (m *jetstreamMessage) parseRawEvent(rawJSON string, logger *IngestLogger) {
 	m.authorDID = event.Did
 	m.timeUs = event.TimeUs
 
-	// Check if this is a like-related event
-	if event.Kind == "commit" && event.Commit.Collection == "app.bsky.feed.like" {
-		// Construct the URI for this like (works for both create and delete)
-		m.uri = fmt.Sprintf("at://%s/%s/%s", event.Did, event.Commit.Collection, event.Commit.RKey)
+	// An inactive account's status says why (deleted, deactivated,
+	// takendown, ...); an active one has none
+	if event.Kind == "account" {
+		m.isAccountEvent = true
+		if !event.Account.Active {
+			m.accountStatus = event.Account.Status
+		}
+		return
+	}
 
-		switch event.Commit.Operation {
-		case "create":
-			m.isLike = true
+	if event.Kind != "commit" {
+		return
+	}
 
-			// Extract the subject URI (the post being liked)
-			if subject, ok := event.Commit.Record["subject"].(map[string]interface{}); ok {
-				if subjectURI, ok := subject["uri"].(string); ok {
-					m.subjectURI = subjectURI
-				}
+	switch event.Commit.Collection {
+	case "app.bsky.feed.like":
+		m.parseLike(likeEventFromData(event), logger)
+	case "app.bsky.graph.follow", "app.bsky.graph.block":
+		m.parseGraphRecord(event, logger)
+	case "app.bsky.feed.post":
+		m.parsePost(event, logger)
+	}
+}
+
+// likeEventFromData returns the like fields of a fully parsed event
+func likeEventFromData(event JetstreamEventData) likeEvent {
+	like := likeEvent{
+		did:        event.Did,
+		timeUs:     event.TimeUs,
+		collection: event.Commit.Collection,
+		operation:  event.Commit.Operation,
+		rkey:       event.Commit.RKey,
+	}
+	if subject, ok := event.Commit.Record["subject"].(map[string]interface{}); ok {
+		if subjectURI, ok := subject["uri"].(string); ok {
+			like.subjectURI = subjectURI
+		}
+	}
+	like.createdAt, like.hasCreatedAt = event.Commit.Record["createdAt"].(string)
+	return like
+}
+
+// parseLike extracts like fields from a like create or delete commit
+func (m *jetstreamMessage) parseLike(event likeEvent, logger *IngestLogger) {
+	// Construct the URI for this like (works for both create and delete)
+	m.uri = "at://" + event.did + "/" + event.collection + "/" + event.rkey
+
+	switch event.operation {
+	case "create":
+		m.isLike = true
+
+		// The subject URI is the post being liked
+		m.subjectURI = event.subjectURI
+
+		// Extract and normalize created_at timestamp to UTC
+		if event.hasCreatedAt {
+			m.createdAt = NormalizeTimestampToUTC(event.createdAt, logger)
+			if m.createdAt == "" {
+				logger.Error("Failed to normalize createdAt timestamp for at_uri: %s (raw value: %s)", m.uri, event.createdAt)
+				return
 			}
+		} else {
+			logger.Error("Failed to extract createdAt from Jetstream JSON (at_uri: %s)", m.uri)
+			return
+		}
+	case "delete":
+		m.isLikeDelete = true
+		// For delete events, we only have did, collection, and rkey
+		// URI is already constructed above
+		// subject_uri will be fetched from Elasticsearch
+	}
+}
+
+// parseGraphRecord extracts follow or block fields from a create or delete
+// commit. Both records name the other account by DID.
+func (m *jetstreamMessage) parseGraphRecord(event JetstreamEventData, logger *IngestLogger) {
+	m.uri = fmt.Sprintf("at://%s/%s/%s", event.Did, event.Commit.Collection, event.Commit.RKey)
+	isBlock := event.Commit.Collection == "app.bsky.graph.block"
+
+	switch event.Commit.Operation {
+	case "create":
+		m.isFollow = !isBlock
+		m.isBlock = isBlock
 
-			// Extract and normalize created_at timestamp to UTC
-			if rawCreatedAt, ok := event.Commit.Record["createdAt"].(string); ok {
-				m.createdAt = NormalizeTimestampToUTC(rawCreatedAt, logger)
-				if m.createdAt == "" {
-					logger.Error("Failed to normalize createdAt timestamp for at_uri: %s (raw value: %s)", m.uri, rawCreatedAt)
-					return
-				}
-			} else {
-				logger.Error("Failed to extract createdAt from Jetstream JSON (at_uri: %s)", m.uri)
+		// The subject is the followed or blocked account's DID, not a record reference
+		if subjectDID, ok := event.Commit.Record["subject"].(string); ok {
+			m.subjectDID = subjectDID
+		}
+
+		if rawCreatedAt, ok := event.Commit.Record["createdAt"].(string); ok {
+			m.createdAt = NormalizeTimestampToUTC(rawCreatedAt, logger)
+			if m.createdAt == "" {
+				logger.Error("Failed to normalize createdAt timestamp for at_uri: %s (raw value: %s)", m.uri, rawCreatedAt)
 				return
 			}
-		case "delete":
-			m.isLikeDelete = true
-			// For delete events, we only have did, collection, and rkey
-			// URI is already constructed above
-			// subject_uri will be fetched from Elasticsearch
+		} else {
+			logger.Error("Failed to extract createdAt from Jetstream JSON (at_uri: %s)", m.uri)
+			return
+		}
+	case "delete":
+		// subject_did will be fetched from Elasticsearch for unfollows;
+		// blocks are deleted by at_uri alone
+		m.isFollowDelete = !isBlock
+		m.isBlockDelete = isBlock
+	}
+}
+
+// parsePost reads a post create or delete commit into the post megastream
+// would deliver for it
+func (m *jetstreamMessage) parsePost(event JetstreamEventData, logger *IngestLogger) {
+	m.uri = fmt.Sprintf("at://%s/%s/%s", event.Did, event.Commit.Collection, event.Commit.RKey)
+
+	switch event.Commit.Operation {
+	case "create":
+		post := newMegaStreamMessageFromJetstream(m.uri, event, logger)
+		if post.createdAt == "" {
+			logger.Error("Failed to extract createdAt from Jetstream JSON (at_uri: %s)", m.uri)
+			return
 		}
+		m.isPost = true
+		m.createdAt = post.createdAt
+		m.post = post
+	case "delete":
+		m.isPostDelete = true
+		m.post = newMegaStreamMessageFromJetstream(m.uri, event, logger)
 	}
 }
 
@@ -107,6 +249,10 @@ func (m *jetstreamMessage) GetSubjectURI() string {
 	return m.subjectURI
 }
 
+func (m *jetstreamMessage) GetSubjectDID() string {
+	return m.subjectDID
+}
+
 func (m *jetstreamMessage) GetAuthorDID() string {
 	return m.authorDID
 }
@@ -126,3 +272,55 @@ func (m *jetstreamMessage) IsLike() bool {
 func (m *jetstreamMessage) IsLikeDelete() bool {
 	return m.isLikeDelete
 }
+
+func (m *jetstreamMessage) IsFollow() bool {
+	return m.isFollow
+}
+
+func (m *jetstreamMessage) IsFollowDelete() bool {
+	return m.isFollowDelete
+}
+
+func (m *jetstreamMessage) IsBlock() bool {
+	return m.isBlock
+}
+
+func (m *jetstreamMessage) IsBlockDelete() bool {
+	return m.isBlockDelete
+}
+
+func (m *jetstreamMessage) IsPost() bool {
+	return m.isPost
+}
+
+func (m *jetstreamMessage) IsPostDelete() bool {
+	return m.isPostDelete
+}
+
+// GetPost returns the post a post create or delete commit carries, or nil
+func (m *jetstreamMessage) GetPost() MegaStreamMessage {
+	return m.post
+}
+
+// IsAccountEvent reports whether the event is an account status change,
+// including an account becoming active again
+func (m *jetstreamMessage) IsAccountEvent() bool {
+	return m.isAccountEvent
+}
+
+// IsAccountDeletion reports whether the event is an account event for a
+// deleted account
+func (m *jetstreamMessage) IsAccountDeletion() bool {
+	return m.accountStatus == "deleted"
+}
+
+// GetAccountStatus returns the status of an inactive account from an
+// account event, or ""
+func (m *jetstreamMessage) GetAccountStatus() string {
+	return m.accountStatus
+}
+
+// ParseError returns why the event could not be parsed, or nil
+func (m *jetstreamMessage) ParseError() error {
+	return m.parseError
+}
@@ -318,3 +318,68 @@ func TestJetstreamMessage_CreatedAtNormalization(t *testing.T) {
 		})
 	}
 }
+
+func TestJetstreamMessage_ParseError(t *testing.T) {
+	logger := NewLogger(false)
+
+	if err := NewJetstreamMessage(`{"did":`, logger).ParseError(); err == nil {
+		t.Error("expected a parse error for truncated JSON")
+	}
+	if err := NewJetstreamMessage(`{"did":"did:plc:test","kind":"identity"}`, logger).ParseError(); err != nil {
+		t.Errorf("expected no parse error, got %v", err)
+	}
+}
+
+func TestJetstreamMessage_AccountEvents(t *testing.T) {
+	logger := NewLogger(false)
+
+	tests := []struct {
+		name           string
+		rawJSON        string
+		wantDeletion   bool
+		wantStatus     string
+		wantLikeDelete bool
+	}{
+		{
+			name:         "deleted account",
+			rawJSON:      `{"did":"did:plc:gone","time_us":1764183883593160,"kind":"account","account":{"active":false,"did":"did:plc:gone","seq":1,"status":"deleted","time":"2025-11-26T19:04:43.593Z"}}`,
+			wantDeletion: true,
+			wantStatus:   "deleted",
+		},
+		{
+			name:       "deactivated account",
+			rawJSON:    `{"did":"did:plc:away","time_us":1764183883593160,"kind":"account","account":{"active":false,"did":"did:plc:away","seq":2,"status":"deactivated"}}`,
+			wantStatus: "deactivated",
+		},
+		{
+			name:    "reactivated account",
+			rawJSON: `{"did":"did:plc:back","time_us":1764183883593160,"kind":"account","account":{"active":true,"did":"did:plc:back","seq":3}}`,
+		},
+		{
+			name:           "like delete is not an account deletion",
+			rawJSON:        `{"did":"did:plc:test","time_us":1764183883593160,"kind":"commit","commit":{"operation":"delete","collection":"app.bsky.feed.like","rkey":"3m4zb3vk46q26"}}`,
+			wantLikeDelete: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := NewJetstreamMessage(tt.rawJSON, logger)
+			if got := msg.IsAccountDeletion(); got != tt.wantDeletion {
+				t.Errorf("IsAccountDeletion() = %v, want %v", got, tt.wantDeletion)
+			}
+			if got := msg.GetAccountStatus(); got != tt.wantStatus {
+				t.Errorf("GetAccountStatus() = %q, want %q", got, tt.wantStatus)
+			}
+			if msg.IsLikeDelete() != tt.wantLikeDelete {
+				t.Errorf("IsLikeDelete() = %v, want %v", msg.IsLikeDelete(), tt.wantLikeDelete)
+			}
+			if msg.IsAccountEvent() == tt.wantLikeDelete {
+				t.Errorf("IsAccountEvent() = %v, want %v", msg.IsAccountEvent(), !tt.wantLikeDelete)
+			}
+			if msg.IsLike() || msg.IsFollow() || msg.IsFollowDelete() {
+				t.Error("expected neither a like nor a follow")
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// JSONClientConfig configures a JSONClient
+type JSONClientConfig struct {
+	URL            string        // Endpoint requests are posted to
+	APIKey         string        //nolint:gosec // G117: struct field name, not a secret value; sent as the X-API-Key header when set
+	Timeout        time.Duration // Per-request HTTP timeout
+	MaxRetries     int           // Retries beyond the first attempt
+	RetryBaseDelay time.Duration // Base delay for exponential backoff; defaults to 200ms
+}
+
+// JSONClient posts JSON requests to one HTTP endpoint, such as a model
+// service, and decodes its JSON responses. Services wrap it with their own
+// request and response types. Construct one per endpoint and share it; the
+// underlying http.Client pools connections.
+type JSONClient struct {
+	httpClient *http.Client
+	config     JSONClientConfig
+	name       string
+	logger     *IngestLogger
+}
+
+// NewJSONClient creates a client for the endpoint in config. name (e.g.
+// "inference service") names the endpoint in errors and logs.
+func NewJSONClient(name string, config JSONClientConfig, logger *IngestLogger) *JSONClient {
+	if config.RetryBaseDelay <= 0 {
+		config.RetryBaseDelay = 200 * time.Millisecond
+	}
+	return &JSONClient{
+		httpClient: &http.Client{Timeout: config.Timeout},
+		config:     config,
+		name:       name,
+		logger:     logger,
+	}
+}
+
+// Post sends request as JSON and decodes the 200 response into response.
+// Retries transport errors, 429s and 5xx responses with exponential backoff
+// and jitter; other 4xx responses and responses that fail to decode fail
+// immediately.
+func (c *JSONClient) Post(ctx context.Context, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.config.MaxRetries; attempt++ {
+		if attempt > 0 {
+			delay := c.config.RetryBaseDelay * (1 << (attempt - 1))
+			jitter := time.Duration(rand.Int63n(int64(delay) + 1)) //nolint:gosec // G404: jitter does not need crypto randomness
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay + jitter):
+			}
+		}
+
+		retryable, err := c.postOnce(ctx, body, response)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retryable {
+			return err
+		}
+		c.logger.Debug("%s request attempt %d failed (retryable): %v", c.name, attempt+1, err)
+	}
+	return fmt.Errorf("%s request failed after %d attempts: %w", c.name, c.config.MaxRetries+1, lastErr)
+}
+
+// postOnce performs a single HTTP request. The first return value indicates
+// whether the failure is retryable.
+func (c *JSONClient) postOnce(ctx context.Context, body []byte, response interface{}) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.config.APIKey != "" {
+		req.Header.Set("X-API-Key", c.config.APIKey)
+	}
+
+	resp, err := c.httpClient.Do(req) //nolint:gosec // G704: URL comes from service configuration, not user input
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("%s request failed: %w", c.name, err)
+	}
+	defer func() {
+		_ = resp.Body.Close() // Ignore error in cleanup
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retryable, fmt.Errorf("%s returned status %d: %s", c.name, resp.StatusCode, string(respBody))
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return false, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return false, nil
+}
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJSONClient_RetriesRetryableStatuses(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request["q"] != "hi" || r.Header.Get("X-API-Key") != "key" {
+			t.Errorf("unexpected request %v (%v), X-API-Key %q", request, err, r.Header.Get("X-API-Key"))
+		}
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			_, _ = w.Write([]byte(`{"answer":"hello"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewJSONClient("test service", JSONClientConfig{URL: server.URL, APIKey: "key", MaxRetries: 2, RetryBaseDelay: time.Millisecond}, NewLogger(false))
+	var response struct {
+		Answer string `json:"answer"`
+	}
+	if err := client.Post(context.Background(), map[string]string{"q": "hi"}, &response); err != nil || response.Answer != "hello" {
+		t.Fatalf("expected the third attempt decoded, got %+v, %v", response, err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestJSONClient_FailsFast(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("X-API-Key") != "" {
+			t.Error("expected no X-API-Key without an API key")
+		}
+		if r.URL.Path == "/bad" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("no such model"))
+			return
+		}
+		_, _ = w.Write([]byte("not json"))
+	}))
+	defer server.Close()
+
+	logger := NewLogger(false)
+	var response map[string]interface{}
+	bad := NewJSONClient("test service", JSONClientConfig{URL: server.URL + "/bad", MaxRetries: 2, RetryBaseDelay: time.Millisecond}, logger)
+	if err := bad.Post(context.Background(), struct{}{}, &response); err == nil || !strings.Contains(err.Error(), "test service returned status 400: no such model") {
+		t.Errorf("expected the 400 returned, got %v", err)
+	}
+	garbled := NewJSONClient("test service", JSONClientConfig{URL: server.URL, MaxRetries: 2, RetryBaseDelay: time.Millisecond}, logger)
+	if err := garbled.Post(context.Background(), struct{}{}, &response); err == nil || !strings.Contains(err.Error(), "failed to decode response") {
+		t.Errorf("expected a decode error, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected no retries, got %d requests", calls.Load())
+	}
+}
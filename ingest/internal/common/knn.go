@@ -0,0 +1,119 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// Dense vector fields of the posts index that are indexed for kNN search
+// (HNSW graphs, cosine similarity; see the posts index template)
+const (
+	EmbeddingFieldMiniLML12 = "embeddings.all_MiniLM_L12_v2"
+	EmbeddingFieldMiniLML6  = "embeddings.all_MiniLM_L6_v2"
+)
+
+// knnMaxCandidates is Elasticsearch's limit on num_candidates
+const knnMaxCandidates = 10000
+
+// KNNQuery is an approximate k-nearest-neighbour search over an indexed
+// dense_vector field
+type KNNQuery struct {
+	Field         string                 // Indexed dense_vector field, e.g. EmbeddingFieldMiniLML6
+	Vector        []float32              // Query vector, with the field's dims
+	K             int                    // Nearest hits to return
+	NumCandidates int                    // Candidates each shard considers; 0 uses 10 per hit, up to 10000
+	Filter        map[string]interface{} // Query hits must match, applied during the search rather than after; nil for none
+	Source        []string               // _source fields returned; nil returns at_uri and author_did
+	Metric        string                 // Prefix of the duration_ms and took_ms metrics; empty uses es.knn_search
+}
+
+// KNNHit is a post found by KNNSearch
+type KNNHit struct {
+	Score float64  // Similarity to the query vector; for cosine fields, (1 + cosine) / 2
+	Post  PostData // Source fields the query asked for
+}
+
+// KNNSearch returns the posts in index nearest to query.Vector in
+// query.Field, most similar first. More candidates per shard make the
+// search slower and its results closer to an exact search.
+func KNNSearch(ctx context.Context, client *elasticsearch.Client, index string, query KNNQuery, logger *IngestLogger) ([]KNNHit, error) {
+	if query.Field == "" || len(query.Vector) == 0 {
+		return nil, fmt.Errorf("kNN search needs a field and a query vector")
+	}
+	if query.K <= 0 {
+		return nil, fmt.Errorf("invalid kNN k %d (must be positive)", query.K)
+	}
+	candidates := query.NumCandidates
+	if candidates <= 0 {
+		candidates = min(query.K*10, knnMaxCandidates)
+	}
+	if candidates < query.K || candidates > knnMaxCandidates {
+		return nil, fmt.Errorf("invalid kNN num_candidates %d (must be from k=%d to %d)", candidates, query.K, knnMaxCandidates)
+	}
+	source := query.Source
+	if source == nil {
+		source = []string{"at_uri", "author_did"}
+	}
+	metric := query.Metric
+	if metric == "" {
+		metric = "es.knn_search"
+	}
+
+	knn := map[string]interface{}{
+		"field":          query.Field,
+		"query_vector":   query.Vector,
+		"k":              query.K,
+		"num_candidates": candidates,
+	}
+	if query.Filter != nil {
+		knn["filter"] = query.Filter
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"knn":     knn,
+		"_source": source,
+		"size":    query.K,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal kNN query: %w", err)
+	}
+
+	start := time.Now()
+	res, err := client.Search(
+		client.Search.WithContext(ctx),
+		client.Search.WithIndex(index),
+		client.Search.WithBody(bytes.NewReader(body)),
+	)
+	logger.Metric(metric+".duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("kNN search failed: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.IsError() {
+		return nil, fmt.Errorf("kNN search returned error: %s", res.String())
+	}
+
+	var response struct {
+		Took int `json:"took"`
+		Hits struct {
+			Hits []struct {
+				Score  float64  `json:"_score"`
+				Source PostData `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse kNN search response: %w", err)
+	}
+	logger.Metric(metric+".took_ms", float64(response.Took))
+
+	hits := make([]KNNHit, len(response.Hits.Hits))
+	for i, h := range response.Hits.Hits {
+		hits[i] = KNNHit{Score: h.Score, Post: h.Source}
+	}
+	return hits, nil
+}
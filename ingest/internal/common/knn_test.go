@@ -0,0 +1,69 @@
+package common
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func TestKNNSearch(t *testing.T) {
+	ctx := context.Background()
+	es := estest.New(t)
+	post := func(rkey, createdAt string, vector []float64) {
+		es.Put("posts", "at://did:plc:a/app.bsky.feed.post/"+rkey, map[string]interface{}{
+			"at_uri":     "at://did:plc:a/app.bsky.feed.post/" + rkey,
+			"author_did": "did:plc:a",
+			"created_at": createdAt,
+			"embeddings": map[string]interface{}{"all_MiniLM_L6_v2": vector},
+		})
+	}
+	post("same", "2026-01-02T00:00:00Z", []float64{1, 0})
+	post("close", "2026-01-02T00:00:00Z", []float64{1, 1})
+	post("far", "2026-01-02T00:00:00Z", []float64{0, 1})
+	post("old", "2025-01-01T00:00:00Z", []float64{1, 0})
+	es.Put("posts", "at://did:plc:a/app.bsky.feed.post/none", map[string]interface{}{"created_at": "2026-01-02T00:00:00Z"})
+
+	mc := newMockMetricCollector()
+	logger := NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(mc)
+	hits, err := KNNSearch(ctx, es.Client, "posts", KNNQuery{
+		Field:  EmbeddingFieldMiniLML6,
+		Vector: []float32{1, 0},
+		K:      2,
+		Filter: map[string]interface{}{"range": map[string]interface{}{"created_at": map[string]interface{}{"gte": "2026-01-01T00:00:00Z"}}},
+	}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 2 || hits[0].Post.AtURI != "at://did:plc:a/app.bsky.feed.post/same" || hits[1].Post.AtURI != "at://did:plc:a/app.bsky.feed.post/close" {
+		t.Fatalf("expected the two nearest recent posts, got %+v", hits)
+	}
+	if hits[0].Score != 1 || hits[1].Score >= hits[0].Score || hits[0].Post.AuthorDID != "did:plc:a" {
+		t.Errorf("unexpected hits %+v", hits)
+	}
+	if len(mc.getRecords("es.knn_search.duration_ms")) != 1 || len(mc.getRecords("es.knn_search.took_ms")) != 1 {
+		t.Errorf("expected es.knn_search metrics, got %v", mc.records)
+	}
+}
+
+func TestKNNSearch_RejectsInvalidQueries(t *testing.T) {
+	es := estest.New(t)
+	logger := NewLogger(false)
+	for name, query := range map[string]KNNQuery{
+		"no field":            {Vector: []float32{1}, K: 1},
+		"no vector":           {Field: EmbeddingFieldMiniLML6, K: 1},
+		"no k":                {Field: EmbeddingFieldMiniLML6, Vector: []float32{1}},
+		"too few candidates":  {Field: EmbeddingFieldMiniLML6, Vector: []float32{1}, K: 5, NumCandidates: 4},
+		"too many candidates": {Field: EmbeddingFieldMiniLML6, Vector: []float32{1}, K: 5, NumCandidates: 10001},
+	} {
+		if _, err := KNNSearch(context.Background(), es.Client, "posts", query, logger); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if calls := es.Calls(estest.APISearch); len(calls) != 0 {
+		t.Errorf("expected invalid queries not to be sent, got %d searches", len(calls))
+	}
+}
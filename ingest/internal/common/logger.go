@@ -1,9 +1,22 @@
 package common
 
 import (
+	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Log formats, selected with GE_LOG_FORMAT
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
 )
 
 // IngestLogger implements the Logger interface with configurable output
@@ -12,27 +25,84 @@ type IngestLogger struct {
 	errorLogger     *log.Logger
 	debugLogger     *log.Logger
 	metricCollector MetricCollector
+	deadLetters     *DeadLetterQueue
+	auditLog        *AuditLog
+	createOnly      bool
 	enabled         bool
 	debugEnabled    bool
 	gitSHA          string
+	jsonFormat      bool
+	service         string
+	fields          map[string]interface{}
+}
+
+// logRecord is one line of JSON output. severity, message, and time are the
+// fields Cloud Logging reads into its own LogEntry fields; the rest end up in
+// jsonPayload.
+type logRecord struct {
+	Severity string                 `json:"severity"`
+	Message  string                 `json:"message"`
+	Time     string                 `json:"time"`
+	Service  string                 `json:"service,omitempty"`
+	GitSHA   string                 `json:"git_sha,omitempty"`
+	Fields   map[string]interface{} `json:"fields,omitempty"`
 }
 
-// NewLogger creates a new logger with configurable output destinations
+// NewLogger creates a new logger with configurable output destinations.
+// GE_LOG_FORMAT=json switches output to one JSON record per line.
 func NewLogger(enabled bool) *IngestLogger {
 	gitSHA := os.Getenv("GE_GIT_SHA")
+	format := os.Getenv("GE_LOG_FORMAT")
+	jsonFormat := format == LogFormatJSON
 	var prefix string
-	if gitSHA != "" {
+	if gitSHA != "" && !jsonFormat {
 		prefix = "[" + gitSHA + "] "
 	}
+	levelPrefix := func(level string) string {
+		if jsonFormat {
+			return ""
+		}
+		return prefix + "[" + level + "] "
+	}
 
-	return &IngestLogger{
-		infoLogger:  log.New(os.Stdout, prefix+"[INFO] ", 0),
-		errorLogger: log.New(os.Stderr, prefix+"[ERROR] ", 0),
-		debugLogger: log.New(os.Stdout, prefix+"[DEBUG] ", 0),
-		enabled:     enabled,
+	l := &IngestLogger{
+		infoLogger:   log.New(os.Stdout, levelPrefix("INFO"), 0),
+		errorLogger:  log.New(os.Stderr, levelPrefix("ERROR"), 0),
+		debugLogger:  log.New(os.Stdout, levelPrefix("DEBUG"), 0),
+		enabled:      enabled,
 		debugEnabled: false,
-		gitSHA:      gitSHA,
+		gitSHA:       gitSHA,
+		jsonFormat:   jsonFormat,
+		service:      filepath.Base(os.Args[0]),
+	}
+	if format != "" && format != LogFormatText && !jsonFormat {
+		l.Error("Unknown GE_LOG_FORMAT %q (expected %s or %s), using %s", format, LogFormatText, LogFormatJSON, LogFormatText)
+	}
+	return l
+}
+
+// SetService sets the service name recorded in JSON output. It defaults to
+// the executable name, which does not identify the command in built images.
+func (l *IngestLogger) SetService(service string) {
+	l.service = service
+}
+
+// WithFields returns a logger that attaches fields to every line it writes,
+// in addition to any fields l already attaches. In JSON format they are the
+// record's fields map; in text format they are appended as key=value pairs.
+// The returned logger shares l's outputs, metrics, dead-letter queue, audit
+// log, and create-only mode.
+func (l *IngestLogger) WithFields(fields map[string]interface{}) *IngestLogger {
+	merged := make(map[string]interface{}, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
 	}
+	child := *l
+	child.fields = merged
+	return &child
 }
 
 // Info logs an informational message
@@ -40,7 +110,7 @@ func (l *IngestLogger) Info(msg string, args ...interface{}) {
 	if !l.enabled {
 		return
 	}
-	l.infoLogger.Printf(msg, args...)
+	l.output(l.infoLogger, "INFO", msg, args)
 }
 
 // Error logs an error message
@@ -48,7 +118,7 @@ func (l *IngestLogger) Error(msg string, args ...interface{}) {
 	if !l.enabled {
 		return
 	}
-	l.errorLogger.Printf(msg, args...)
+	l.output(l.errorLogger, "ERROR", msg, args)
 }
 
 // Debug logs a debug message
@@ -56,7 +126,64 @@ func (l *IngestLogger) Debug(msg string, args ...interface{}) {
 	if !l.enabled || !l.debugEnabled {
 		return
 	}
-	l.debugLogger.Printf(msg, args...)
+	l.output(l.debugLogger, "DEBUG", msg, args)
+}
+
+// output writes one line to logger in the configured format
+func (l *IngestLogger) output(logger *log.Logger, severity, msg string, args []interface{}) {
+	message := fmt.Sprintf(msg, args...)
+	if !l.jsonFormat {
+		if len(l.fields) == 0 {
+			logger.Print(message)
+			return
+		}
+		var b strings.Builder
+		b.WriteString(message)
+		for _, k := range sortedFieldKeys(l.fields) {
+			fmt.Fprintf(&b, " %s=%s", k, textFieldValue(l.fields[k]))
+		}
+		logger.Print(b.String())
+		return
+	}
+
+	line, err := json.Marshal(logRecord{
+		Severity: severity,
+		Message:  message,
+		Time:     time.Now().UTC().Format(time.RFC3339Nano),
+		Service:  l.service,
+		GitSHA:   l.gitSHA,
+		Fields:   l.fields,
+	})
+	if err != nil {
+		// A field value that cannot be marshalled must not lose the message
+		line, _ = json.Marshal(logRecord{
+			Severity: severity,
+			Message:  message + " (fields dropped: " + err.Error() + ")",
+			Time:     time.Now().UTC().Format(time.RFC3339Nano),
+			Service:  l.service,
+			GitSHA:   l.gitSHA,
+		})
+	}
+	logger.Print(string(line))
+}
+
+// textFieldValue formats a field value for text output, quoting strings that
+// would otherwise be ambiguous in a key=value list
+func textFieldValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if _, isString := v.(string); isString && (s == "" || strings.ContainsAny(s, " =\"\t\n")) {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func sortedFieldKeys(fields map[string]interface{}) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // SetDebugEnabled enables or disables debug logging
@@ -2,6 +2,7 @@ package common
 
 import (
 	"bytes"
+	"encoding/json"
 	"strings"
 	"sync"
 	"testing"
@@ -123,6 +124,59 @@ func TestLoggerFormatting(t *testing.T) {
 	}
 }
 
+func TestLoggerWithFieldsText(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(true)
+	logger.SetOutput(&buf)
+
+	child := logger.WithFields(map[string]interface{}{"stream": "jetstream"}).WithFields(map[string]interface{}{"cursor": 42, "reason": "court order"})
+	child.Info("caught up")
+	logger.Info("parent")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+	if lines[0] != `[INFO] caught up cursor=42 reason="court order" stream=jetstream` {
+		t.Errorf("unexpected child line %q", lines[0])
+	}
+	if lines[1] != "[INFO] parent" {
+		t.Errorf("expected the parent logger to have no fields, got %q", lines[1])
+	}
+}
+
+func TestLoggerJSONFormat(t *testing.T) {
+	t.Setenv("GE_LOG_FORMAT", LogFormatJSON)
+	t.Setenv("GE_GIT_SHA", "abc123")
+	var buf bytes.Buffer
+	logger := NewLogger(true)
+	logger.SetService("jetstream_ingest")
+	logger.SetOutput(&buf)
+
+	logger.WithFields(map[string]interface{}{"did": "did:plc:a"}).Error("failed %d times", 3)
+
+	var record struct {
+		Severity string                 `json:"severity"`
+		Message  string                 `json:"message"`
+		Time     string                 `json:"time"`
+		Service  string                 `json:"service"`
+		GitSHA   string                 `json:"git_sha"`
+		Fields   map[string]interface{} `json:"fields"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("expected one JSON record, got %q: %v", buf.String(), err)
+	}
+	if record.Severity != "ERROR" || record.Message != "failed 3 times" || record.Service != "jetstream_ingest" || record.GitSHA != "abc123" {
+		t.Errorf("unexpected record %+v", record)
+	}
+	if record.Time == "" {
+		t.Error("expected a timestamp")
+	}
+	if record.Fields["did"] != "did:plc:a" {
+		t.Errorf("expected the did field, got %v", record.Fields)
+	}
+}
+
 func TestMetricDisabledLogger(t *testing.T) {
 	logger := NewLogger(false)
 	mc := newMockMetricCollector()
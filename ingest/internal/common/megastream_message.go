@@ -3,6 +3,8 @@ package common
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"strings"
 
 	"github.com/greenearth/ingest/internal/embeddings"
 )
@@ -12,6 +14,8 @@ type MegaStreamMessage interface {
 	GetAtURI() string
 	GetAuthorDID() string
 	GetContent() string
+	GetLangs() []string
+	GetSelfLabels() []string
 	GetCreatedAt() string
 	GetThreadRootPost() string
 	GetThreadParentPost() string
@@ -21,10 +25,13 @@ type MegaStreamMessage interface {
 	GetExternalEmbed() *ExternalEmbed
 	GetVideoTranscript() string
 	GetVideoTranscriptLanguage() string
+	GetVideoDurationSec() float64
 	GetTimeUs() int64
 	IsDelete() bool
+	IsAccountEvent() bool
 	IsAccountDeletion() bool
 	GetAccountStatus() string
+	ParseError() error
 }
 
 // megaStreamMessage is the implementation of MegaStreamMessage
@@ -32,6 +39,8 @@ type megaStreamMessage struct {
 	atURI                   string
 	did                     string
 	content                 string
+	langs                   []string
+	selfLabels              []string
 	createdAt               string
 	threadRootPost          string
 	threadParentPost        string
@@ -41,8 +50,10 @@ type megaStreamMessage struct {
 	externalEmbed           *ExternalEmbed
 	videoTranscript         string
 	videoTranscriptLanguage string
+	videoDurationSec        float64
 	timeUs                  int64
 	isDelete                bool
+	isAccountEvent          bool
 	accountStatus           string
 	parseError              error
 }
@@ -83,13 +94,14 @@ func (m *megaStreamMessage) parseRawPost(rawPostJSON string, logger *IngestLogge
 	// Check for account deletion event FIRST (before checking commit field)
 	if kind, ok := message["kind"].(string); ok && kind == "account" {
 		if account, ok := message["account"].(map[string]interface{}); ok {
+			m.isAccountEvent = true
 			if active, ok := account["active"].(bool); ok && !active {
 				if status, ok := account["status"].(string); ok {
 					m.accountStatus = status
 					logger.Debug("Account event detected for DID %s: status=%s", m.did, status)
-					return
 				}
 			}
+			return
 		}
 	}
 
@@ -115,12 +127,7 @@ func (m *megaStreamMessage) parseRawPost(rawPostJSON string, logger *IngestLogge
 		logger.Debug("No record field in commit for %s", m.atURI)
 		return
 	}
-
-	m.content, _ = record["text"].(string) // This is blank on image posts
-
-	if rawCreatedAt, ok := record["createdAt"].(string); ok {
-		m.createdAt = NormalizeTimestampToUTC(rawCreatedAt, logger)
-	}
+	m.parseRecord(record, logger)
 
 	hydratedMetadata, _ := rawPost["hydrated_metadata"].(map[string]interface{})
 	if hydratedMetadata != nil {
@@ -136,12 +143,80 @@ func (m *megaStreamMessage) parseRawPost(rawPostJSON string, logger *IngestLogge
 			m.quotePost, _ = qPost["uri"].(string)
 		}
 	}
+}
+
+// parseRecord extracts the fields of a post record, other than the posts it
+// references
+func (m *megaStreamMessage) parseRecord(record map[string]interface{}, logger *IngestLogger) {
+	m.content, _ = record["text"].(string) // This is blank on image posts
+
+	if langs, ok := record["langs"].([]interface{}); ok {
+		for _, lang := range langs {
+			if tag, ok := lang.(string); ok && tag != "" {
+				m.langs = append(m.langs, tag)
+			}
+		}
+	}
+
+	m.selfLabels = parseSelfLabels(record)
+
+	if rawCreatedAt, ok := record["createdAt"].(string); ok {
+		m.createdAt = NormalizeTimestampToUTC(rawCreatedAt, logger)
+	}
 
 	if embed, ok := record["embed"].(map[string]interface{}); ok {
 		m.parseEmbed(embed)
 	}
 }
 
+// newMegaStreamMessageFromJetstream returns the post created or deleted by
+// a Jetstream post commit, as megastream would deliver it but without
+// inferences. Jetstream does not hydrate the posts a record references, so
+// the reply and quote are read from the record's own strong references.
+func newMegaStreamMessageFromJetstream(atURI string, event JetstreamEventData, logger *IngestLogger) *megaStreamMessage {
+	m := &megaStreamMessage{
+		atURI:      atURI,
+		did:        event.Did,
+		timeUs:     event.TimeUs,
+		embeddings: make(map[string][]float32),
+	}
+	if event.Commit.Operation == "delete" {
+		m.isDelete = true
+		return m
+	}
+	record := event.Commit.Record
+	m.parseRecord(record, logger)
+
+	if reply, ok := record["reply"].(map[string]interface{}); ok {
+		m.threadRootPost = strongRefURI(reply["root"])
+		m.threadParentPost = strongRefURI(reply["parent"])
+	}
+	if embed, ok := record["embed"].(map[string]interface{}); ok {
+		quoted := embed["record"]
+		// A quote with media nests the quoted record's reference once more
+		if embedType, _ := embed["$type"].(string); embedType == "app.bsky.embed.recordWithMedia" {
+			if withMedia, ok := quoted.(map[string]interface{}); ok {
+				quoted = withMedia["record"]
+			}
+		}
+		// Quotes of lists, feeds, and the like are not quote posts
+		if uri := strongRefURI(quoted); strings.Contains(uri, "/app.bsky.feed.post/") {
+			m.quotePost = uri
+		}
+	}
+	return m
+}
+
+// strongRefURI returns the uri of a com.atproto.repo.strongRef, or ""
+func strongRefURI(ref interface{}) string {
+	refMap, ok := ref.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	uri, _ := refMap["uri"].(string)
+	return uri
+}
+
 // parseEmbed extracts media items from the embed field
 func (m *megaStreamMessage) parseEmbed(embed map[string]interface{}) {
 	embedType, _ := embed["$type"].(string)
@@ -274,14 +349,14 @@ func (m *megaStreamMessage) parseInferences(inferencesJSON string, logger *Inges
 
 	if textEmbeddings, ok := inferences["text_embeddings"].(map[string]interface{}); ok {
 		if embL12, ok := textEmbeddings["all-MiniLM-L12-v2"].(string); ok {
-			if decoded, err := embeddings.Decode(embL12); err == nil {
+			if decoded, err := decodeEmbedding(embL12); err == nil {
 				m.embeddings["all_MiniLM_L12_v2"] = decoded
 			} else {
 				logger.Debug("Failed to decode L12 embedding for %s: %v", m.atURI, err)
 			}
 		}
 		if embL6, ok := textEmbeddings["all-MiniLM-L6-v2"].(string); ok {
-			if decoded, err := embeddings.Decode(embL6); err == nil {
+			if decoded, err := decodeEmbedding(embL6); err == nil {
 				m.embeddings["all_MiniLM_L6_v2"] = decoded
 			} else {
 				logger.Debug("Failed to decode L6 embedding for %s: %v", m.atURI, err)
@@ -302,9 +377,15 @@ func (m *megaStreamMessage) parseInferences(inferencesJSON string, logger *Inges
 	m.videoTranscript, _ = audioTranscription["text"].(string)
 	m.videoTranscriptLanguage, _ = audioTranscription["language"].(string)
 
+	// The transcription covers the whole soundtrack, so its duration is the
+	// video's; records do not carry it
+	if duration, ok := audioTranscription["duration"].(float64); ok && duration > 0 {
+		m.videoDurationSec = duration
+	}
+
 	if embeddingsMap, ok := audioTranscription["embeddings"].(map[string]interface{}); ok {
 		if embGemma, ok := embeddingsMap["google/embeddinggemma-300m"].(string); ok {
-			if decoded, err := embeddings.Decode(embGemma); err == nil {
+			if decoded, err := decodeEmbedding(embGemma); err == nil {
 				m.embeddings["google_embeddinggemma_300m"] = decoded
 			} else {
 				logger.Debug("Failed to decode embeddinggemma-300m for %s: %v", m.atURI, err)
@@ -313,6 +394,21 @@ func (m *megaStreamMessage) parseInferences(inferencesJSON string, logger *Inges
 	}
 }
 
+// decodeEmbedding decodes an inference embedding, rejecting non-finite
+// values, which neither JSON nor a dense_vector field can hold
+func decodeEmbedding(encoded string) ([]float32, error) {
+	decoded, err := embeddings.Decode(encoded)
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range decoded {
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return nil, fmt.Errorf("embedding has non-finite value %v at index %d", v, i)
+		}
+	}
+	return decoded, nil
+}
+
 // Interface method implementations
 
 func (m *megaStreamMessage) GetAtURI() string {
@@ -360,6 +456,12 @@ func (m *megaStreamMessage) IsDelete() bool {
 	return m.isDelete
 }
 
+// IsAccountEvent reports whether the row is an account status change,
+// including an account becoming active again
+func (m *megaStreamMessage) IsAccountEvent() bool {
+	return m.isAccountEvent
+}
+
 func (m *megaStreamMessage) IsAccountDeletion() bool {
 	return m.accountStatus == "deleted"
 }
@@ -368,10 +470,23 @@ func (m *megaStreamMessage) GetAccountStatus() string {
 	return m.accountStatus
 }
 
+// ParseError returns why raw_post could not be parsed, or nil
+func (m *megaStreamMessage) ParseError() error {
+	return m.parseError
+}
+
 func (m *megaStreamMessage) GetExternalEmbed() *ExternalEmbed {
 	return m.externalEmbed
 }
 
+func (m *megaStreamMessage) GetLangs() []string {
+	return m.langs
+}
+
+func (m *megaStreamMessage) GetSelfLabels() []string {
+	return m.selfLabels
+}
+
 func (m *megaStreamMessage) GetVideoTranscript() string {
 	return m.videoTranscript
 }
@@ -380,9 +495,31 @@ func (m *megaStreamMessage) GetVideoTranscriptLanguage() string {
 	return m.videoTranscriptLanguage
 }
 
+func (m *megaStreamMessage) GetVideoDurationSec() float64 {
+	return m.videoDurationSec
+}
+
 func (m *megaStreamMessage) GetMedia() []MediaItem {
 	if len(m.media) == 0 {
 		return nil
 	}
 	return m.media
 }
+
+// parseSelfLabels returns the values of the labels the author applied to the
+// record (com.atproto.label.defs#selfLabels), e.g. "porn" or "graphic-media"
+func parseSelfLabels(record map[string]interface{}) []string {
+	labels, ok := record["labels"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	values, _ := labels["values"].([]interface{})
+	var vals []string
+	for _, value := range values {
+		label, _ := value.(map[string]interface{})
+		if val, ok := label["val"].(string); ok && val != "" {
+			vals = append(vals, val)
+		}
+	}
+	return vals
+}
@@ -1,7 +1,11 @@
 package common
 
 import (
+	"encoding/json"
+	"math/rand"
 	"testing"
+
+	"github.com/greenearth/ingest/internal/embeddings"
 )
 
 func TestIsAccountDeletion(t *testing.T) {
@@ -12,6 +16,7 @@ func TestIsAccountDeletion(t *testing.T) {
 		rawPostJSON             string
 		expectedIsAccountDeletion bool
 		expectedAccountStatus   string
+		expectedIsAccountEvent  bool
 	}{
 		{
 			name: "account deletion event",
@@ -28,6 +33,7 @@ func TestIsAccountDeletion(t *testing.T) {
 			}`,
 			expectedIsAccountDeletion: true,
 			expectedAccountStatus:   "deleted",
+			expectedIsAccountEvent:  true,
 		},
 		{
 			name: "account deactivation event",
@@ -44,6 +50,7 @@ func TestIsAccountDeletion(t *testing.T) {
 			}`,
 			expectedIsAccountDeletion: false,
 			expectedAccountStatus:   "deactivated",
+			expectedIsAccountEvent:  true,
 		},
 		{
 			name: "active account event",
@@ -60,6 +67,7 @@ func TestIsAccountDeletion(t *testing.T) {
 			}`,
 			expectedIsAccountDeletion: false,
 			expectedAccountStatus:   "",
+			expectedIsAccountEvent:  true,
 		},
 		{
 			name: "regular post creation event",
@@ -104,6 +112,10 @@ func TestIsAccountDeletion(t *testing.T) {
 			if got := msg.GetAccountStatus(); got != tt.expectedAccountStatus {
 				t.Errorf("GetAccountStatus() = %q, expected %q", got, tt.expectedAccountStatus)
 			}
+
+			if got := msg.IsAccountEvent(); got != tt.expectedIsAccountEvent {
+				t.Errorf("IsAccountEvent() = %v, expected %v", got, tt.expectedIsAccountEvent)
+			}
 		})
 	}
 }
@@ -952,4 +964,132 @@ func TestMegaStreamMessage_CreatedAtNormalization(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+func TestMegaStreamMessage_ParseError(t *testing.T) {
+	logger := NewLogger(false)
+
+	if err := NewMegaStreamMessage("at://test", "did:plc:test", `{"message":`, "{}", logger).ParseError(); err == nil {
+		t.Error("expected a parse error for truncated raw_post")
+	}
+	if err := NewMegaStreamMessage("at://test", "did:plc:test", `{"message":{}}`, "{}", logger).ParseError(); err != nil {
+		t.Errorf("expected no parse error, got %v", err)
+	}
+}
+
+func TestMegaStreamMessage_NonFiniteEmbedding(t *testing.T) {
+	logger := NewLogger(false)
+
+	// [1.0, NaN] and [1.0, 2.0, 3.0], encoded by the Python inference service
+	inferencesJSON := `{
+		"text_embeddings": {
+			"all-MiniLM-L12-v2": "c${NkXs~BsI8YA&20{V<",
+			"all-MiniLM-L6-v2": "c${NkXs~BsU~m8;2LK5}0e}"
+		}
+	}`
+	msg := NewMegaStreamMessage("at://test", "did:plc:test", `{"message":{}}`, inferencesJSON, logger)
+
+	decoded := msg.GetEmbeddings()
+	if _, ok := decoded["all_MiniLM_L12_v2"]; ok {
+		t.Error("expected the embedding with NaN to be dropped")
+	}
+	if got := decoded["all_MiniLM_L6_v2"]; len(got) != 3 {
+		t.Errorf("expected the finite embedding kept, got %v", got)
+	}
+}
+
+func BenchmarkParseRawPost(b *testing.B) {
+	var rawPosts []string
+	for _, line := range readSeedLines(b, "megastream_rows.jsonl") {
+		var row struct {
+			RawPost string `json:"raw_post"`
+		}
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			b.Fatal(err)
+		}
+		rawPosts = append(rawPosts, row.RawPost)
+	}
+	logger := NewLogger(false)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msg := &megaStreamMessage{atURI: "at://test", did: "did:plc:test"}
+		msg.parseRawPost(rawPosts[i%len(rawPosts)], logger)
+	}
+}
+
+func BenchmarkDecodeEmbedding(b *testing.B) {
+	rng := rand.New(rand.NewSource(384))
+	floats := make([]float32, 384)
+	for i := range floats {
+		floats[i] = rng.Float32()*2 - 1
+	}
+	encoded, err := embeddings.Encode(floats)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := decodeEmbedding(encoded); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMegaStreamMessage_LangsParsing(t *testing.T) {
+	logger := NewLogger(false)
+
+	rawPostJSON := `{
+		"message": {
+			"commit": {
+				"operation": "create",
+				"record": {
+					"text": "Bonjour, hello",
+					"langs": ["fr", "", "en"],
+					"createdAt": "2025-01-27T12:00:00Z"
+				}
+			}
+		}
+	}`
+
+	msg := NewMegaStreamMessage("at://test", "did:plc:test123", rawPostJSON, "{}", logger)
+	if langs := msg.GetLangs(); len(langs) != 2 || langs[0] != "fr" || langs[1] != "en" {
+		t.Errorf("Expected declared languages [fr en], got %v", langs)
+	}
+	if doc := NewPostDoc(PostFromMegaStream(msg)); len(doc.Langs) != 2 {
+		t.Errorf("Expected languages on the post document, got %v", doc.Langs)
+	}
+
+	msg = NewMegaStreamMessage("at://test", "did:plc:test123", `{"message":{"commit":{"operation":"create","record":{"text":"no langs"}}}}`, "{}", logger)
+	if langs := msg.GetLangs(); langs != nil {
+		t.Errorf("Expected no languages, got %v", langs)
+	}
+}
+
+func TestMegaStreamMessage_SelfLabelsParsing(t *testing.T) {
+	logger := NewLogger(false)
+
+	rawPostJSON := `{
+		"message": {
+			"commit": {
+				"operation": "create",
+				"record": {
+					"text": "",
+					"labels": {
+						"$type": "com.atproto.label.defs#selfLabels",
+						"values": [{"val": "graphic-media"}, {"val": ""}, {"val": "nudity"}]
+					},
+					"createdAt": "2025-01-27T12:00:00Z"
+				}
+			}
+		}
+	}`
+
+	msg := NewMegaStreamMessage("at://test", "did:plc:test123", rawPostJSON, "{}", logger)
+	if labels := msg.GetSelfLabels(); len(labels) != 2 || labels[0] != "graphic-media" || labels[1] != "nudity" {
+		t.Errorf("Expected self-labels [graphic-media nudity], got %v", labels)
+	}
+	if post := NewExtractPostAs(PostFromMegaStream(msg), EmbeddingFormatBase85); len(post.SelfLabels) != 2 {
+		t.Errorf("Expected self-labels on the exported post, got %v", post.SelfLabels)
+	}
+}
@@ -0,0 +1,224 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// heapMetric is the runtime/metrics sample MemoryGuard compares against the
+// limit: memory occupied by heap objects, live or not yet swept
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// throttledBatchDivisor is how much BatchSize shrinks batches while throttled
+const throttledBatchDivisor = 4
+
+// Files the container memory limit is read from, cgroup v2 then v1
+var cgroupMemoryLimitFiles = []string{
+	"/sys/fs/cgroup/memory.max",
+	"/sys/fs/cgroup/memory/memory.limit_in_bytes",
+}
+
+// MemoryConfig controls when a service throttles itself under memory pressure
+type MemoryConfig struct {
+	Limit            int64   // Bytes the heap is measured against; 0 detects the container limit or GOMEMLIMIT
+	ThrottleFraction float64 // Fraction of Limit at which intake pauses and batches shrink
+	ResumeFraction   float64 // Fraction of Limit the heap must fall below to end throttling
+}
+
+// MemoryConfigFromConfig returns the memory configuration in config
+func MemoryConfigFromConfig(config *Config) MemoryConfig {
+	return MemoryConfig{
+		Limit:            int64(config.MemoryLimitBytes),
+		ThrottleFraction: config.MemoryThrottleFraction,
+		ResumeFraction:   config.MemoryResumeFraction,
+	}
+}
+
+// MemoryGuard samples the heap and throttles a service before it is
+// OOM-killed. Once the heap exceeds ThrottleFraction of the limit, intake
+// waits in Wait and BatchSize shrinks batches, until the heap falls below
+// ResumeFraction. Without a known limit it never throttles.
+type MemoryGuard struct {
+	config  MemoryConfig
+	service string
+	logger  *IngestLogger
+	sample  func() uint64
+
+	mu             sync.Mutex
+	throttledSince time.Time
+	released       chan struct{} // Closed when the current throttle ends
+}
+
+// NewMemoryGuard creates the guard for service, whose name prefixes its
+// metrics
+func NewMemoryGuard(config MemoryConfig, service string, logger *IngestLogger) (*MemoryGuard, error) {
+	if config.ThrottleFraction <= 0 || config.ThrottleFraction > 1 || config.ResumeFraction <= 0 || config.ResumeFraction > config.ThrottleFraction {
+		return nil, fmt.Errorf("memory throttling needs 0 < resume fraction <= throttle fraction <= 1, got %v and %v", config.ResumeFraction, config.ThrottleFraction)
+	}
+	if config.Limit < 0 {
+		return nil, fmt.Errorf("invalid memory limit %d", config.Limit)
+	}
+	if config.Limit == 0 {
+		config.Limit = detectMemoryLimit()
+	}
+	return &MemoryGuard{config: config, service: service, logger: logger, sample: sampleHeapBytes}, nil
+}
+
+// Limit returns the limit the heap is measured against, or 0 if none is known
+func (g *MemoryGuard) Limit() int64 {
+	return g.config.Limit
+}
+
+// Run samples the heap every interval until ctx is done
+func (g *MemoryGuard) Run(ctx context.Context, interval time.Duration) {
+	if g.config.Limit == 0 {
+		g.logger.Info("No container memory limit or GOMEMLIMIT found; memory throttling disabled")
+		return
+	}
+	g.logger.Info("Memory throttling above %.0f%% of %d MiB, resuming below %.0f%%",
+		g.config.ThrottleFraction*100, g.config.Limit>>20, g.config.ResumeFraction*100)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			g.release()
+			return
+		case <-ticker.C:
+			g.Check()
+		}
+	}
+}
+
+// Check samples the heap once, starting or ending throttling as needed
+func (g *MemoryGuard) Check() {
+	if g.config.Limit == 0 {
+		return
+	}
+	heap := g.sample()
+	g.logger.Metric(g.service+".memory_heap_bytes", float64(heap))
+	fraction := float64(heap) / float64(g.config.Limit)
+
+	switch {
+	case fraction >= g.config.ThrottleFraction && !g.Throttled():
+		g.mu.Lock()
+		g.throttledSince = time.Now()
+		g.released = make(chan struct{})
+		g.mu.Unlock()
+		g.logger.Error("Heap at %.0f%% of memory limit (%d of %d MiB), pausing intake and shrinking batches",
+			fraction*100, heap>>20, g.config.Limit>>20)
+		g.logger.Metric(g.service+".memory_throttle_count", 1)
+		// Garbage counts towards the heap until swept; collect it now so it
+		// does not hold the throttle on
+		runtime.GC()
+	case fraction < g.config.ResumeFraction && g.Throttled():
+		duration := g.release()
+		g.logger.Info("Heap down to %.0f%% of memory limit, resuming intake after %s", fraction*100, duration.Round(time.Second))
+	}
+}
+
+// release ends throttling, returning how long it lasted
+func (g *MemoryGuard) release() time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.released == nil {
+		return 0
+	}
+	duration := time.Since(g.throttledSince)
+	close(g.released)
+	g.released = nil
+	g.logger.Metric(g.service+".memory_throttle_duration_ms", float64(duration.Milliseconds()))
+	return duration
+}
+
+// Throttled reports whether the service is throttled
+func (g *MemoryGuard) Throttled() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.released != nil
+}
+
+// Wait blocks while the service is throttled, returning ctx's error if it is
+// done first. Intake calls it before taking on more work.
+func (g *MemoryGuard) Wait(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	released := g.released
+	g.mu.Unlock()
+	if released == nil {
+		return nil
+	}
+	select {
+	case <-released:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// BatchSize returns size, shrunk while the service is throttled
+func (g *MemoryGuard) BatchSize(size int) int {
+	if !g.Throttled() {
+		return size
+	}
+	return max(size/throttledBatchDivisor, 1)
+}
+
+func sampleHeapBytes() uint64 {
+	samples := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return samples[0].Value.Uint64()
+}
+
+// detectMemoryLimit returns the smaller of the container's cgroup memory
+// limit and GOMEMLIMIT, or 0 if neither is set
+func detectMemoryLimit() int64 {
+	var limit int64
+	for _, path := range cgroupMemoryLimitFiles {
+		if cgroupLimit := readCgroupMemoryLimit(path); cgroupLimit > 0 {
+			limit = cgroupLimit
+			break
+		}
+	}
+	if goLimit := debug.SetMemoryLimit(-1); goLimit != math.MaxInt64 && (limit == 0 || goLimit < limit) {
+		limit = goLimit
+	}
+	return limit
+}
+
+// readCgroupMemoryLimit reads a cgroup memory limit file, returning 0 if it
+// is missing or unlimited
+func readCgroupMemoryLimit(path string) int64 {
+	data, err := os.ReadFile(path) // nolint:gosec // G304: fixed cgroup paths
+	if err != nil {
+		return 0
+	}
+	value := strings.TrimSpace(string(data))
+	if value == "max" {
+		return 0
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	// cgroup v1 reports no limit as a page-aligned value near MaxInt64
+	if err != nil || limit <= 0 || limit >= math.MaxInt64/2 {
+		return 0
+	}
+	return limit
+}
@@ -0,0 +1,130 @@
+package common
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryGuard_ThrottlesAndResumes(t *testing.T) {
+	metrics := newMockMetricCollector()
+	logger := NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(metrics)
+
+	guard, err := NewMemoryGuard(MemoryConfig{Limit: 1000, ThrottleFraction: 0.8, ResumeFraction: 0.7}, "megastream", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var heap uint64
+	guard.sample = func() uint64 { return heap }
+
+	heap = 790
+	guard.Check()
+	if guard.Throttled() || guard.BatchSize(512) != 512 {
+		t.Fatal("expected no throttling below the threshold")
+	}
+
+	heap = 850
+	guard.Check()
+	if !guard.Throttled() {
+		t.Fatal("expected throttling above the threshold")
+	}
+	if got := guard.BatchSize(512); got != 128 {
+		t.Errorf("expected batches shrunk to 128, got %d", got)
+	}
+
+	waited := make(chan error, 1)
+	go func() { waited <- guard.Wait(context.Background()) }()
+
+	// Between the resume and throttle fractions the throttle holds
+	heap = 750
+	guard.Check()
+	select {
+	case <-waited:
+		t.Fatal("Wait returned while still throttled")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	heap = 600
+	guard.Check()
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Errorf("unexpected error from Wait: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return once the throttle ended")
+	}
+	if guard.Throttled() || guard.BatchSize(512) != 512 {
+		t.Error("expected throttling to end below the resume fraction")
+	}
+
+	if got := metrics.getRecords("megastream.memory_throttle_count"); len(got) != 1 {
+		t.Errorf("expected one throttle event, got %v", got)
+	}
+	if got := metrics.getRecords("megastream.memory_throttle_duration_ms"); len(got) != 1 {
+		t.Errorf("expected one throttle duration, got %v", got)
+	}
+	if got := metrics.getRecords("megastream.memory_heap_bytes"); len(got) != 4 {
+		t.Errorf("expected a heap sample per check, got %v", got)
+	}
+}
+
+func TestMemoryGuard_WaitCancelled(t *testing.T) {
+	guard, err := NewMemoryGuard(MemoryConfig{Limit: 1000, ThrottleFraction: 0.8, ResumeFraction: 0.7}, "megastream", NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	guard.sample = func() uint64 { return 900 }
+	guard.Check()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := guard.Wait(ctx); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	var nilGuard *MemoryGuard
+	if nilGuard.Throttled() || nilGuard.Wait(ctx) != nil || nilGuard.BatchSize(10) != 10 {
+		t.Error("expected a nil guard never to throttle")
+	}
+}
+
+func TestNewMemoryGuard_RejectsInvalidFractions(t *testing.T) {
+	for _, config := range []MemoryConfig{
+		{ThrottleFraction: 0.7, ResumeFraction: 0.8},
+		{ThrottleFraction: 1.5, ResumeFraction: 0.7},
+		{ThrottleFraction: 0.8, ResumeFraction: 0},
+		{Limit: -1, ThrottleFraction: 0.8, ResumeFraction: 0.7},
+	} {
+		if _, err := NewMemoryGuard(config, "megastream", NewLogger(false)); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
+
+func TestReadCgroupMemoryLimit(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]int64{
+		"2147483648\n":          2147483648,
+		"max\n":                 0,
+		"9223372036854771712\n": 0,
+		"garbage":               0,
+	}
+	for content, want := range tests {
+		path := filepath.Join(dir, "memory.max")
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if got := readCgroupMemoryLimit(path); got != want {
+			t.Errorf("readCgroupMemoryLimit(%q) = %d, want %d", content, got, want)
+		}
+	}
+	if got := readCgroupMemoryLimit(filepath.Join(dir, "missing")); got != 0 {
+		t.Errorf("expected 0 for a missing file, got %d", got)
+	}
+}
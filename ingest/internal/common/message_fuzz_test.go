@@ -0,0 +1,120 @@
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"math"
+	"os"
+	"testing"
+)
+
+// The fuzz targets below run their seed corpora as part of go test. To fuzz:
+//
+//	go test ./internal/common -run '^$' -fuzz '^FuzzNewJetstreamMessage$' -fuzztime 5m
+//
+// Seeds are events as the upstream streams send them, one per line of a
+// file in testdata.
+
+// maxFuzzEmbeddingDims bounds a decoded embedding; the largest model's has
+// 768 dimensions
+const maxFuzzEmbeddingDims = 1 << 18
+
+// readSeedLines returns the lines of a seed corpus in testdata
+func readSeedLines(tb testing.TB, name string) []string {
+	tb.Helper()
+	file, err := os.Open("testdata/" + name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		tb.Fatal(err)
+	}
+	return lines
+}
+
+func FuzzNewJetstreamMessage(f *testing.F) {
+	for _, line := range readSeedLines(f, "jetstream_events.jsonl") {
+		f.Add(line)
+	}
+	logger := NewLogger(false)
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		msg := NewJetstreamMessage(raw, logger)
+
+		kinds := 0
+		for _, is := range []bool{msg.IsLike(), msg.IsLikeDelete(), msg.IsFollow(), msg.IsFollowDelete()} {
+			if is {
+				kinds++
+			}
+		}
+		if kinds > 1 {
+			t.Fatalf("message is %d kinds at once: %+v", kinds, msg)
+		}
+		if msg.ParseError() != nil && kinds != 0 {
+			t.Fatalf("message with parse error %v is also a like or follow", msg.ParseError())
+		}
+
+		// The fast path must read exactly what the full parser would
+		fast, ok := scanLikeEvent(raw)
+		if !ok {
+			return
+		}
+		var event JetstreamEventData
+		if err := json.Unmarshal([]byte(raw), &event); err != nil {
+			t.Fatalf("fast path read %+v from JSON the full parser rejects: %v", fast, err)
+		}
+		if full := likeEventFromData(event); fast != full {
+			t.Fatalf("fast path read %+v, full parser %+v", fast, full)
+		}
+	})
+}
+
+func FuzzNewMegaStreamMessage(f *testing.F) {
+	for _, line := range readSeedLines(f, "megastream_rows.jsonl") {
+		var row struct {
+			AtURI      string `json:"at_uri"`
+			DID        string `json:"did"`
+			RawPost    string `json:"raw_post"`
+			Inferences string `json:"inferences"`
+		}
+		if err := json.Unmarshal([]byte(line), &row); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(row.AtURI, row.DID, row.RawPost, row.Inferences)
+	}
+	logger := NewLogger(false)
+
+	f.Fuzz(func(t *testing.T, atURI, did, rawPost, inferences string) {
+		msg := NewMegaStreamMessage(atURI, did, rawPost, inferences, logger)
+
+		if msg.ParseError() != nil && (msg.IsDelete() || msg.GetAccountStatus() != "" || msg.GetContent() != "") {
+			t.Fatalf("message with parse error %v has fields set", msg.ParseError())
+		}
+		for _, item := range msg.GetMedia() {
+			if item.ID == "" {
+				t.Fatalf("media item without an ID: %+v", item)
+			}
+			if math.IsNaN(item.AspectRatio) || math.IsInf(item.AspectRatio, 0) || item.AspectRatio < 0 {
+				t.Fatalf("media item with aspect ratio %v", item.AspectRatio)
+			}
+		}
+		for model, vector := range msg.GetEmbeddings() {
+			if len(vector) == 0 || len(vector) > maxFuzzEmbeddingDims {
+				t.Fatalf("embedding %s has %d dimensions", model, len(vector))
+			}
+		}
+
+		// A document that does not marshal fails its whole bulk batch
+		if _, err := json.Marshal(CreatePostDoc(msg, 0)); err != nil {
+			t.Fatalf("post document does not marshal: %v", err)
+		}
+	})
+}
@@ -1,20 +1,17 @@
 package common
 
-import (
-	"time"
-)
-
 // MetricCollector records metric values
 type MetricCollector interface {
 	Record(name string, value float64)
 }
 
-// CalculateFreshness returns the lag in seconds between the given microsecond timestamp and now
+// CalculateFreshness returns the lag in seconds between the given
+// microsecond timestamp and now (see CorrectedNow). A timestamp in the
+// future, which only a skewed clock produces, has a freshness of 0.
 func CalculateFreshness(timeUs int64) int64 {
 	if timeUs == 0 {
 		return 0
 	}
-	nowUs := time.Now().UnixMicro()
-	lagUs := nowUs - timeUs
-	return lagUs / 1_000_000
+	lagUs := CorrectedNow().UnixMicro() - timeUs
+	return max(lagUs, 0) / 1_000_000
 }
@@ -0,0 +1,378 @@
+package common
+
+import (
+	"time"
+
+	"github.com/greenearth/ingest/internal/embeddings"
+	"github.com/greenearth/ingest/internal/model"
+)
+
+// Sources: decode messages and search hits into model records
+
+// PostFromMegaStream returns the post or reply in msg
+func PostFromMegaStream(msg MegaStreamMessage) model.Post {
+	post := model.Post{
+		AtURI:                   msg.GetAtURI(),
+		AuthorDID:               msg.GetAuthorDID(),
+		Content:                 msg.GetContent(),
+		Langs:                   msg.GetLangs(),
+		SelfLabels:              msg.GetSelfLabels(),
+		CreatedAt:               msg.GetCreatedAt(),
+		IndexedAt:               time.Now().UTC().Format(time.RFC3339),
+		ThreadRootURI:           msg.GetThreadRootPost(),
+		ThreadParentURI:         msg.GetThreadParentPost(),
+		QuoteURI:                msg.GetQuotePost(),
+		Embeddings:              msg.GetEmbeddings(),
+		VideoTranscript:         msg.GetVideoTranscript(),
+		VideoTranscriptLanguage: msg.GetVideoTranscriptLanguage(),
+		VideoDurationSec:        msg.GetVideoDurationSec(),
+		Media:                   modelMedia(msg.GetMedia()),
+	}
+	if external := msg.GetExternalEmbed(); external != nil {
+		post.External = &model.External{URI: external.URI, Title: external.Title, Description: external.Description}
+	}
+	return post
+}
+
+// PostTombstoneFromMegaStream returns the deletion of the post in msg
+func PostTombstoneFromMegaStream(msg MegaStreamMessage) model.Tombstone {
+	deletedAt, indexedAt := tombstoneTimes(msg.GetTimeUs())
+	return model.Tombstone{
+		Kind:      model.TombstonePost,
+		AtURI:     msg.GetAtURI(),
+		AuthorDID: msg.GetAuthorDID(),
+		DeletedAt: deletedAt,
+		IndexedAt: indexedAt,
+	}
+}
+
+// AccountEventFromMegaStream returns the account status change in msg
+func AccountEventFromMegaStream(msg MegaStreamMessage) model.AccountEvent {
+	return model.AccountEvent{
+		DID:    msg.GetAuthorDID(),
+		Status: msg.GetAccountStatus(),
+		TimeUs: msg.GetTimeUs(),
+	}
+}
+
+// AccountEventFromJetstream returns the account status change in msg
+func AccountEventFromJetstream(msg JetstreamMessage) model.AccountEvent {
+	return model.AccountEvent{
+		DID:    msg.GetAuthorDID(),
+		Status: msg.GetAccountStatus(),
+		TimeUs: msg.GetTimeUs(),
+	}
+}
+
+// LikeFromJetstream returns the like created in msg
+func LikeFromJetstream(msg JetstreamMessage) model.Like {
+	return model.Like{
+		AtURI:      msg.GetAtURI(),
+		AuthorDID:  msg.GetAuthorDID(),
+		SubjectURI: msg.GetSubjectURI(),
+		CreatedAt:  msg.GetCreatedAt(),
+		IndexedAt:  time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+// LikeTombstoneFromJetstream returns the deletion in msg of a like of
+// subjectURI. Jetstream deletes do not carry the subject, so callers look it
+// up from the indexed like.
+func LikeTombstoneFromJetstream(msg JetstreamMessage, subjectURI string) model.Tombstone {
+	deletedAt, indexedAt := tombstoneTimes(msg.GetTimeUs())
+	return model.Tombstone{
+		Kind:       model.TombstoneLike,
+		AtURI:      msg.GetAtURI(),
+		AuthorDID:  msg.GetAuthorDID(),
+		SubjectURI: subjectURI,
+		DeletedAt:  deletedAt,
+		IndexedAt:  indexedAt,
+	}
+}
+
+// FollowTombstoneFromJetstream returns the deletion in msg of a follow of
+// subjectDID
+func FollowTombstoneFromJetstream(msg JetstreamMessage, subjectDID string) model.Tombstone {
+	deletedAt, indexedAt := tombstoneTimes(msg.GetTimeUs())
+	return model.Tombstone{
+		Kind:       model.TombstoneFollow,
+		AtURI:      msg.GetAtURI(),
+		AuthorDID:  msg.GetAuthorDID(),
+		SubjectDID: subjectDID,
+		DeletedAt:  deletedAt,
+		IndexedAt:  indexedAt,
+	}
+}
+
+// tombstoneTimes returns when a deletion happened, from its event time when
+// known, and the current time as the indexing time
+func tombstoneTimes(timeUs int64) (string, string) {
+	now := time.Now().UTC()
+	deletedAt := now
+	if timeUs > 0 {
+		deletedAt = time.Unix(0, timeUs*1000)
+	}
+	return deletedAt.Format(time.RFC3339), now.Format(time.RFC3339)
+}
+
+// PostFromHit returns the post or reply in a posts or replies search hit
+func PostFromHit(source PostData) model.Post {
+	return model.Post{
+		AtURI:           source.AtURI,
+		AuthorDID:       source.AuthorDID,
+		Content:         source.Content,
+		Langs:           source.Langs,
+		SelfLabels:      source.SelfLabels,
+		CreatedAt:       source.CreatedAt,
+		IndexedAt:       source.IndexedAt,
+		ThreadRootURI:   source.ThreadRootPost,
+		ThreadParentURI: source.ThreadParentPost,
+		QuoteURI:        source.QuotePost,
+		Embeddings:      source.Embeddings,
+		Media:           modelMedia(source.Media),
+	}
+}
+
+// LikeFromHit returns the like in a likes search hit
+func LikeFromHit(source LikeData) model.Like {
+	return model.Like{
+		AtURI:      source.AtURI,
+		AuthorDID:  source.AuthorDID,
+		SubjectURI: source.SubjectURI,
+		CreatedAt:  source.CreatedAt,
+		IndexedAt:  source.IndexedAt,
+	}
+}
+
+// PostTombstoneFromHit returns the deletion in a post_tombstones or
+// reply_tombstones search hit
+func PostTombstoneFromHit(source PostTombstoneDoc) model.Tombstone {
+	return model.Tombstone{
+		Kind:      model.TombstonePost,
+		AtURI:     source.AtURI,
+		AuthorDID: source.AuthorDID,
+		DeletedAt: source.DeletedAt,
+		IndexedAt: source.IndexedAt,
+	}
+}
+
+// LikeTombstoneFromHit returns the deletion in a like_tombstones search hit
+func LikeTombstoneFromHit(source LikeTombstoneDoc) model.Tombstone {
+	return model.Tombstone{
+		Kind:       model.TombstoneLike,
+		AtURI:      source.AtURI,
+		AuthorDID:  source.AuthorDID,
+		SubjectURI: source.SubjectURI,
+		DeletedAt:  source.DeletedAt,
+		IndexedAt:  source.IndexedAt,
+	}
+}
+
+func modelMedia(items []MediaItem) []model.Media {
+	if items == nil {
+		return nil
+	}
+	media := make([]model.Media, len(items))
+	for i, m := range items {
+		media[i] = model.Media{ID: m.ID, Type: m.MediaType, MimeType: m.MimeType, Size: m.Size, AspectRatio: m.AspectRatio, Width: m.Width, Height: m.Height, AltText: m.AltText}
+	}
+	return media
+}
+
+// Elasticsearch sink
+
+// NewPostDoc returns the posts index document for an original post
+func NewPostDoc(p model.Post) PostDoc {
+	images, videos := p.MediaCounts()
+	return PostDoc{
+		AtURI:                   p.AtURI,
+		AuthorDID:               p.AuthorDID,
+		Content:                 p.Content,
+		Langs:                   p.Langs,
+		SelfLabels:              p.SelfLabels,
+		CreatedAt:               p.CreatedAt,
+		QuotePost:               p.QuoteURI,
+		Embeddings:              float32Arrays(p.Embeddings),
+		IndexedAt:               p.IndexedAt,
+		LikeCount:               p.LikeCount,
+		ReplyCount:              p.ReplyCount,
+		ThreadReplyCount:        p.ThreadReplyCount,
+		QuoteCount:              p.QuoteCount,
+		Media:                   mediaItems(p.Media),
+		ContainsImages:          images > 0,
+		ContainsVideo:           videos > 0,
+		ImageCount:              images,
+		VideoCount:              videos,
+		MediaCount:              len(p.Media),
+		ExternalEmbed:           externalEmbed(p.External),
+		ExternalDomain:          p.ExternalDomain(),
+		VideoTranscript:         p.VideoTranscript,
+		VideoTranscriptLanguage: p.VideoTranscriptLanguage,
+		VideoDurationSec:        p.VideoDurationSec,
+	}
+}
+
+// NewReplyDoc returns the replies index document for a reply
+func NewReplyDoc(p model.Post) ReplyDoc {
+	images, videos := p.MediaCounts()
+	return ReplyDoc{
+		AtURI:                   p.AtURI,
+		AuthorDID:               p.AuthorDID,
+		Content:                 p.Content,
+		Langs:                   p.Langs,
+		SelfLabels:              p.SelfLabels,
+		CreatedAt:               p.CreatedAt,
+		ThreadRootPost:          p.ThreadRootURI,
+		ThreadParentPost:        p.ThreadParentURI,
+		QuotePost:               p.QuoteURI,
+		Embeddings:              float32Arrays(p.Embeddings),
+		IndexedAt:               p.IndexedAt,
+		LikeCount:               p.LikeCount,
+		ReplyCount:              p.ReplyCount,
+		ThreadReplyCount:        p.ThreadReplyCount,
+		QuoteCount:              p.QuoteCount,
+		Media:                   mediaItems(p.Media),
+		ContainsImages:          images > 0,
+		ContainsVideo:           videos > 0,
+		ImageCount:              images,
+		VideoCount:              videos,
+		MediaCount:              len(p.Media),
+		ExternalEmbed:           externalEmbed(p.External),
+		ExternalDomain:          p.ExternalDomain(),
+		VideoTranscript:         p.VideoTranscript,
+		VideoTranscriptLanguage: p.VideoTranscriptLanguage,
+		VideoDurationSec:        p.VideoDurationSec,
+	}
+}
+
+// NewLikeDoc returns the likes index document for a like
+func NewLikeDoc(l model.Like) LikeDoc {
+	return LikeDoc{
+		AtURI:      l.AtURI,
+		SubjectURI: l.SubjectURI,
+		AuthorDID:  l.AuthorDID,
+		CreatedAt:  l.CreatedAt,
+		IndexedAt:  l.IndexedAt,
+	}
+}
+
+// NewPostTombstoneDoc returns the post_tombstones index document for t
+func NewPostTombstoneDoc(t model.Tombstone) PostTombstoneDoc {
+	return PostTombstoneDoc{AtURI: t.AtURI, AuthorDID: t.AuthorDID, DeletedAt: t.DeletedAt, IndexedAt: t.IndexedAt}
+}
+
+// NewLikeTombstoneDoc returns the like_tombstones index document for t
+func NewLikeTombstoneDoc(t model.Tombstone) LikeTombstoneDoc {
+	return LikeTombstoneDoc{AtURI: t.AtURI, AuthorDID: t.AuthorDID, SubjectURI: t.SubjectURI, DeletedAt: t.DeletedAt, IndexedAt: t.IndexedAt}
+}
+
+// NewFollowTombstoneDoc returns the follow_tombstones index document for t
+func NewFollowTombstoneDoc(t model.Tombstone) FollowTombstoneDoc {
+	return FollowTombstoneDoc{AtURI: t.AtURI, AuthorDID: t.AuthorDID, SubjectDID: t.SubjectDID, DeletedAt: t.DeletedAt, IndexedAt: t.IndexedAt}
+}
+
+func float32Arrays(in map[string][]float32) map[string]Float32Array {
+	if in == nil {
+		return nil
+	}
+	out := make(map[string]Float32Array, len(in))
+	for k, v := range in {
+		out[k] = Float32Array(v)
+	}
+	return out
+}
+
+func mediaItems(media []model.Media) []MediaItem {
+	if media == nil {
+		return nil
+	}
+	items := make([]MediaItem, len(media))
+	for i, m := range media {
+		items[i] = MediaItem{ID: m.ID, MediaType: m.Type, MimeType: m.MimeType, Size: m.Size, AspectRatio: m.AspectRatio, Width: m.Width, Height: m.Height, AltText: m.AltText}
+	}
+	return items
+}
+
+func externalEmbed(external *model.External) *ExternalEmbed {
+	if external == nil {
+		return nil
+	}
+	return &ExternalEmbed{URI: external.URI, Title: external.Title, Description: external.Description}
+}
+
+// Parquet sink
+
+// NewExtractPost returns the parquet row for a post or reply, with
+// base85-encoded embeddings
+func NewExtractPost(p model.Post) ExtractPost {
+	return NewExtractPostAs(p, EmbeddingFormatBase85)
+}
+
+// NewExtractPostAs returns the parquet row for a post or reply, with
+// embeddings in embeddingFormat. Embeddings that fail to encode are left out.
+func NewExtractPostAs(p model.Post, embeddingFormat string) ExtractPost {
+	extractPost := ExtractPost{
+		DID:             p.AuthorDID,
+		AtURI:           p.AtURI,
+		EmbedQuoteURI:   p.QuoteURI,
+		InsertedAt:      p.IndexedAt,
+		RecordCreatedAt: p.CreatedAt,
+		RecordText:      p.Content,
+		Langs:           p.Langs,
+		SelfLabels:      p.SelfLabels,
+		ReplyParentURI:  p.ThreadParentURI,
+		ReplyRootURI:    p.ThreadRootURI,
+	}
+	if len(p.Embeddings) == 0 {
+		return extractPost
+	}
+	switch embeddingFormat {
+	case EmbeddingFormatFloat32:
+		extractPost.EmbeddingsFloat32 = p.Embeddings
+	case EmbeddingFormatFloat16:
+		extractPost.EmbeddingsFloat16 = make(map[string][]byte, len(p.Embeddings))
+		for modelName, floatArray := range p.Embeddings {
+			extractPost.EmbeddingsFloat16[modelName] = embeddings.EncodeFloat16(floatArray)
+		}
+	default:
+		extractPost.Embeddings = make(map[string]string, len(p.Embeddings))
+		for modelName, floatArray := range p.Embeddings {
+			if encoded, err := embeddings.Encode(floatArray); err == nil {
+				extractPost.Embeddings[modelName] = encoded
+			}
+		}
+	}
+	return extractPost
+}
+
+// NewExtractLike returns the parquet row for a like
+func NewExtractLike(l model.Like) ExtractLike {
+	return ExtractLike{
+		DID:             l.AuthorDID,
+		SubjectURI:      l.SubjectURI,
+		InsertedAt:      l.IndexedAt,
+		RecordCreatedAt: l.CreatedAt,
+	}
+}
+
+// NewExtractPostTombstone returns the parquet row for the deletion of a post
+// or reply
+func NewExtractPostTombstone(t model.Tombstone) ExtractPostTombstone {
+	return ExtractPostTombstone{
+		DID:        t.AuthorDID,
+		AtURI:      t.AtURI,
+		DeletedAt:  t.DeletedAt,
+		InsertedAt: t.IndexedAt,
+	}
+}
+
+// NewExtractLikeTombstone returns the parquet row for the deletion of a like
+func NewExtractLikeTombstone(t model.Tombstone) ExtractLikeTombstone {
+	return ExtractLikeTombstone{
+		DID:        t.AuthorDID,
+		AtURI:      t.AtURI,
+		SubjectURI: t.SubjectURI,
+		DeletedAt:  t.DeletedAt,
+		InsertedAt: t.IndexedAt,
+	}
+}
@@ -0,0 +1,127 @@
+package common
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/model"
+)
+
+func TestPostFromMegaStream_MapsToBothSinks(t *testing.T) {
+	rawPostJSON := `{
+		"message": {
+			"commit": {
+				"operation": "create",
+				"record": {
+					"text": "two images",
+					"createdAt": "2025-01-27T12:00:00Z",
+					"embed": {
+						"$type": "app.bsky.embed.images",
+						"images": [
+							{"alt": "one", "image": {"ref": {"$link": "img1"}, "mimeType": "image/jpeg", "size": 10}},
+							{"alt": "two", "image": {"ref": {"$link": "img2"}, "mimeType": "image/png", "size": 20}}
+						]
+					}
+				}
+			}
+		},
+		"hydrated_metadata": {
+			"reply_post": {"uri": "at://root"},
+			"parent_post": {"uri": "at://parent"}
+		}
+	}`
+	msg := NewMegaStreamMessage("at://reply", "did:plc:author", rawPostJSON, "{}", NewLogger(false))
+
+	post := PostFromMegaStream(msg)
+	if !post.IsReply() {
+		t.Fatalf("expected a reply, got %+v", post)
+	}
+
+	doc := NewReplyDoc(post)
+	if doc.ThreadRootPost != "at://root" || doc.ThreadParentPost != "at://parent" {
+		t.Errorf("unexpected thread fields %q, %q", doc.ThreadRootPost, doc.ThreadParentPost)
+	}
+	if doc.ImageCount != 2 || doc.MediaCount != 2 || !doc.ContainsImages || doc.ContainsVideo {
+		t.Errorf("unexpected media counts %+v", doc)
+	}
+	if len(doc.Media) != 2 || doc.Media[1].ID != "img2" || doc.Media[1].AltText != "two" {
+		t.Errorf("unexpected media %+v", doc.Media)
+	}
+
+	row := NewExtractPost(post)
+	if row.ReplyRootURI != "at://root" || row.ReplyParentURI != "at://parent" || row.RecordText != "two images" {
+		t.Errorf("unexpected extract row %+v", row)
+	}
+}
+
+func TestPostFromMegaStream_EngagementSignals(t *testing.T) {
+	video := `{"message":{"commit":{"operation":"create","record":{"text":"clip","embed":{"$type":"app.bsky.embed.video","video":{"ref":{"$link":"vid1"},"mimeType":"video/mp4"}}}}}}`
+	inferences := `{"video":{"audio_transcription":{"text":"hi","language":"en","duration":12.5}}}`
+	doc := NewPostDoc(PostFromMegaStream(NewMegaStreamMessage("at://video", "did:plc:author", video, inferences, NewLogger(false))))
+	if !doc.ContainsVideo || doc.VideoDurationSec != 12.5 || doc.ExternalDomain != "" {
+		t.Errorf("unexpected video signals %+v", doc)
+	}
+
+	link := `{"message":{"commit":{"operation":"create","record":{"text":"read","embed":{"$type":"app.bsky.embed.external","external":{"uri":"https://www.Example.com/story","title":"Story"}}}}}}`
+	doc = NewPostDoc(PostFromMegaStream(NewMegaStreamMessage("at://link", "did:plc:author", link, "{}", NewLogger(false))))
+	if doc.ExternalDomain != "example.com" || doc.ContainsVideo || doc.VideoDurationSec != 0 {
+		t.Errorf("unexpected link signals %+v", doc)
+	}
+}
+
+// A post read back from the index must export the same row it was indexed from
+func TestPostFromHit_RoundTripsIndexedDoc(t *testing.T) {
+	msg := NewMegaStreamMessage("at://post", "did:plc:author",
+		`{"message":{"commit":{"operation":"create","record":{"text":"hi","createdAt":"2025-01-27T12:00:00Z"}}}}`, "{}", NewLogger(false))
+	post := PostFromMegaStream(msg)
+	post.Embeddings = map[string][]float32{"minilm": {0.25, -0.5}}
+
+	source, err := json.Marshal(NewPostDoc(post))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hit Hit
+	if err := json.Unmarshal(source, &hit.Source); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := HitToExtractPost(hit), NewExtractPost(post); !reflect.DeepEqual(got, want) {
+		t.Errorf("HitToExtractPost() = %+v, want %+v", got, want)
+	}
+}
+
+func TestNewExtractPostAs_EmbeddingFormats(t *testing.T) {
+	post := model.Post{AtURI: "at://post", Embeddings: map[string][]float32{"minilm": {0.25, -0.5}}}
+
+	row := NewExtractPostAs(post, EmbeddingFormatFloat32)
+	if row.Embeddings != nil || row.EmbeddingsFloat16 != nil || !reflect.DeepEqual(row.EmbeddingsFloat32, post.Embeddings) {
+		t.Errorf("unexpected float32 row %+v", row)
+	}
+
+	row = NewExtractPostAs(post, EmbeddingFormatFloat16)
+	if want := []byte{0x00, 0x34, 0x00, 0xb8}; row.Embeddings != nil || !reflect.DeepEqual(row.EmbeddingsFloat16["minilm"], want) {
+		t.Errorf("unexpected float16 row %+v", row)
+	}
+
+	row = NewExtractPostAs(post, EmbeddingFormatBase85)
+	if len(row.Embeddings) != 1 || row.EmbeddingsFloat32 != nil || row.EmbeddingsFloat16 != nil {
+		t.Errorf("unexpected base85 row %+v", row)
+	}
+}
+
+func TestTombstoneTimes(t *testing.T) {
+	deletedAt, indexedAt := tombstoneTimes(1737979200000000)
+	if deletedAt != time.Unix(1737979200, 0).Format(time.RFC3339) {
+		t.Errorf("expected the event time, got %s", deletedAt)
+	}
+	if _, err := time.Parse(time.RFC3339, indexedAt); err != nil {
+		t.Errorf("indexedAt %q is not RFC 3339: %v", indexedAt, err)
+	}
+
+	deletedAt, indexedAt = tombstoneTimes(0)
+	if deletedAt != indexedAt {
+		t.Errorf("expected an unknown event time to fall back to now, got %s and %s", deletedAt, indexedAt)
+	}
+}
@@ -1,6 +1,25 @@
 package common
 
-import "github.com/greenearth/ingest/internal/embeddings"
+import "fmt"
+
+// Values of the embedding format of ExtractPost rows, which sets the column
+// embeddings are written to. Every row has all three columns, so files
+// written in different formats share a schema.
+const (
+	EmbeddingFormatBase85  = "base85"  // embeddings: zlib-compressed float32s, base85-encoded
+	EmbeddingFormatFloat32 = "float32" // embeddings_float32: lists of float32
+	EmbeddingFormatFloat16 = "float16" // embeddings_float16: little-endian IEEE 754 half-precision floats
+)
+
+// ValidateEmbeddingFormat checks an embedding format
+func ValidateEmbeddingFormat(format string) error {
+	switch format {
+	case EmbeddingFormatBase85, EmbeddingFormatFloat32, EmbeddingFormatFloat16:
+		return nil
+	default:
+		return fmt.Errorf("unknown embedding format %q (expected %q, %q, or %q)", format, EmbeddingFormatBase85, EmbeddingFormatFloat32, EmbeddingFormatFloat16)
+	}
+}
 
 // ExtractPost represents the Post document structure for Parquet serialization
 // Field names match the expected parquet output format
@@ -14,40 +33,39 @@ type ExtractPost struct {
 	ReplyParentURI  string            `json:"reply_parent_uri,omitempty" parquet:"reply_parent_uri,optional"`
 	ReplyRootURI    string            `json:"reply_root_uri,omitempty" parquet:"reply_root_uri,optional"`
 	Embeddings      map[string]string `json:"embeddings,omitempty" parquet:"embeddings,optional"` // model name -> base85-encoded embedding string
+	// Model name -> embedding, in the other embedding formats
+	EmbeddingsFloat32 map[string][]float32 `json:"embeddings_float32,omitempty" parquet:"embeddings_float32,optional"`
+	EmbeddingsFloat16 map[string][]byte    `json:"embeddings_float16,omitempty" parquet:"embeddings_float16,optional"`
+	// Likes counted in the likes index at export time; null unless the
+	// export enriches like counts
+	LikeCount *int64 `json:"like_count,omitempty" parquet:"like_count,optional"`
+	// Status of the author's account when it is inactive (e.g.
+	// deactivated); empty unless the export flags inactive accounts
+	AccountStatus string `json:"account_status,omitempty" parquet:"account_status,optional"`
+	// Languages the author declared for the post, as BCP 47 tags
+	Langs []string `json:"langs,omitempty" parquet:"langs,list"`
+	// Values of the labels the author applied to the post, e.g. "porn" or
+	// "graphic-media"; downstream training uses them to honor the author's
+	// content warnings
+	SelfLabels []string `json:"self_labels,omitempty" parquet:"self_labels,list"`
 }
 
 // HitToExtractPost converts an Elasticsearch Hit to an ExtractPost
 func HitToExtractPost(hit Hit) ExtractPost {
-	extractPost := ExtractPost{
-		DID:             hit.Source.AuthorDID,
-		AtURI:           hit.Source.AtURI,
-		EmbedQuoteURI:   hit.Source.QuotePost,
-		InsertedAt:      hit.Source.IndexedAt,
-		RecordCreatedAt: hit.Source.CreatedAt,
-		RecordText:      hit.Source.Content,
-		ReplyParentURI:  hit.Source.ThreadParentPost,
-		ReplyRootURI:    hit.Source.ThreadRootPost,
-	}
-
-	// Encode embeddings if present
-	if len(hit.Source.Embeddings) > 0 {
-		extractPost.Embeddings = make(map[string]string, len(hit.Source.Embeddings))
-		for modelName, floatArray := range hit.Source.Embeddings {
-			if encoded, err := embeddings.Encode(floatArray); err == nil {
-				extractPost.Embeddings[modelName] = encoded
-			}
-			// Silently skip embeddings that fail to encode
-		}
-	}
-
-	return extractPost
+	return NewExtractPost(PostFromHit(hit.Source))
 }
 
 // HitsToExtractPosts converts multiple Elasticsearch Hits to ExtractPosts
 func HitsToExtractPosts(hits []Hit) []ExtractPost {
+	return HitsToExtractPostsAs(hits, EmbeddingFormatBase85)
+}
+
+// HitsToExtractPostsAs converts multiple Elasticsearch Hits to ExtractPosts
+// with embeddings in embeddingFormat
+func HitsToExtractPostsAs(hits []Hit, embeddingFormat string) []ExtractPost {
 	posts := make([]ExtractPost, len(hits))
 	for i, hit := range hits {
-		posts[i] = HitToExtractPost(hit)
+		posts[i] = NewExtractPostAs(PostFromHit(hit.Source), embeddingFormat)
 	}
 	return posts
 }
@@ -62,12 +80,7 @@ type ExtractLike struct {
 
 // LikeHitToExtractLike converts an Elasticsearch LikeHit to an ExtractLike
 func LikeHitToExtractLike(hit LikeHit) ExtractLike {
-	return ExtractLike{
-		DID:             hit.Source.AuthorDID,
-		SubjectURI:      hit.Source.SubjectURI,
-		InsertedAt:      hit.Source.IndexedAt,
-		RecordCreatedAt: hit.Source.CreatedAt,
-	}
+	return NewExtractLike(LikeFromHit(hit.Source))
 }
 
 // LikeHitsToExtractLikes converts multiple Elasticsearch LikeHits to ExtractLikes
@@ -79,6 +92,94 @@ func LikeHitsToExtractLikes(hits []LikeHit) []ExtractLike {
 	return likes
 }
 
+// ExtractLikeWithPost is a like joined at export time to the post or reply
+// it likes, for training tables that would otherwise join likes to posts
+// downstream. The post_ columns are those of ExtractPost, and are empty when
+// the liked post is not in the posts or replies index; post_did is then
+// empty too.
+type ExtractLikeWithPost struct {
+	DID                 string `json:"did" parquet:"did"`
+	SubjectURI          string `json:"subject_uri" parquet:"subject_uri"`
+	InsertedAt          string `json:"inserted_at" parquet:"inserted_at"`
+	RecordCreatedAt     string `json:"record_created_at" parquet:"record_created_at"`
+	PostDID             string `json:"post_did,omitempty" parquet:"post_did,optional"`
+	PostRecordCreatedAt string `json:"post_record_created_at,omitempty" parquet:"post_record_created_at,optional"`
+	PostRecordText      string `json:"post_record_text,omitempty" parquet:"post_record_text,optional"`
+	PostReplyParentURI  string `json:"post_reply_parent_uri,omitempty" parquet:"post_reply_parent_uri,optional"`
+	PostReplyRootURI    string `json:"post_reply_root_uri,omitempty" parquet:"post_reply_root_uri,optional"`
+	PostEmbedQuoteURI   string `json:"post_embed_quote_uri,omitempty" parquet:"post_embed_quote_uri,optional"`
+	// Model name -> embedding, in the export's embedding format
+	PostEmbeddings        map[string]string    `json:"post_embeddings,omitempty" parquet:"post_embeddings,optional"`
+	PostEmbeddingsFloat32 map[string][]float32 `json:"post_embeddings_float32,omitempty" parquet:"post_embeddings_float32,optional"`
+	PostEmbeddingsFloat16 map[string][]byte    `json:"post_embeddings_float16,omitempty" parquet:"post_embeddings_float16,optional"`
+	PostLangs             []string             `json:"post_langs,omitempty" parquet:"post_langs,list"`
+	PostSelfLabels        []string             `json:"post_self_labels,omitempty" parquet:"post_self_labels,list"`
+}
+
+// NewExtractLikeWithPost joins like to post, the post it likes, or to no
+// post when post is nil
+func NewExtractLikeWithPost(like ExtractLike, post *ExtractPost) ExtractLikeWithPost {
+	row := ExtractLikeWithPost{
+		DID:             like.DID,
+		SubjectURI:      like.SubjectURI,
+		InsertedAt:      like.InsertedAt,
+		RecordCreatedAt: like.RecordCreatedAt,
+	}
+	if post == nil {
+		return row
+	}
+	row.PostDID = post.DID
+	row.PostRecordCreatedAt = post.RecordCreatedAt
+	row.PostRecordText = post.RecordText
+	row.PostReplyParentURI = post.ReplyParentURI
+	row.PostReplyRootURI = post.ReplyRootURI
+	row.PostEmbedQuoteURI = post.EmbedQuoteURI
+	row.PostEmbeddings = post.Embeddings
+	row.PostEmbeddingsFloat32 = post.EmbeddingsFloat32
+	row.PostEmbeddingsFloat16 = post.EmbeddingsFloat16
+	row.PostLangs = post.Langs
+	row.PostSelfLabels = post.SelfLabels
+	return row
+}
+
+// ExtractPostTombstone represents the deletion of a post or reply for Parquet
+// serialization. Consumers apply it by removing the row with the same at_uri.
+type ExtractPostTombstone struct {
+	DID        string `json:"did" parquet:"did"`
+	AtURI      string `json:"at_uri" parquet:"at_uri"`
+	DeletedAt  string `json:"deleted_at" parquet:"deleted_at"`
+	InsertedAt string `json:"inserted_at" parquet:"inserted_at"`
+}
+
+// PostTombstoneHitsToExtractPostTombstones converts Elasticsearch PostTombstoneHits to ExtractPostTombstones
+func PostTombstoneHitsToExtractPostTombstones(hits []PostTombstoneHit) []ExtractPostTombstone {
+	tombstones := make([]ExtractPostTombstone, len(hits))
+	for i, hit := range hits {
+		tombstones[i] = NewExtractPostTombstone(PostTombstoneFromHit(hit.Source))
+	}
+	return tombstones
+}
+
+// ExtractLikeTombstone represents the deletion of a like for Parquet
+// serialization. Exported likes carry no at_uri, so consumers apply it by
+// removing the like of subject_uri by did.
+type ExtractLikeTombstone struct {
+	DID        string `json:"did" parquet:"did"`
+	AtURI      string `json:"at_uri" parquet:"at_uri"`
+	SubjectURI string `json:"subject_uri" parquet:"subject_uri"`
+	DeletedAt  string `json:"deleted_at" parquet:"deleted_at"`
+	InsertedAt string `json:"inserted_at" parquet:"inserted_at"`
+}
+
+// LikeTombstoneHitsToExtractLikeTombstones converts Elasticsearch LikeTombstoneHits to ExtractLikeTombstones
+func LikeTombstoneHitsToExtractLikeTombstones(hits []LikeTombstoneHit) []ExtractLikeTombstone {
+	tombstones := make([]ExtractLikeTombstone, len(hits))
+	for i, hit := range hits {
+		tombstones[i] = NewExtractLikeTombstone(LikeTombstoneFromHit(hit.Source))
+	}
+	return tombstones
+}
+
 // ExtractHashtag represents the Hashtag document structure for Parquet serialization
 type ExtractHashtag struct {
 	Hashtag string `json:"hashtag" parquet:"hashtag"`
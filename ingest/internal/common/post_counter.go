@@ -0,0 +1,249 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// PostCountConfig controls a PostCounter
+type PostCountConfig struct {
+	FlushInterval time.Duration // How long counter changes are aggregated before they are applied
+	MaxPosts      int           // Pending post counter changes that trigger an early flush
+	// RoutingCacheSize is how many posts the counter remembers the index of
+	// (see PostRoutingCache); 0 sends every update to both indices
+	RoutingCacheSize int
+}
+
+// PostCountConfigFromConfig returns the post counter configuration in config
+func PostCountConfigFromConfig(config *Config) PostCountConfig {
+	return PostCountConfig{
+		FlushInterval:    config.PostCountFlushInterval,
+		MaxPosts:         config.PostCountMaxPosts,
+		RoutingCacheSize: config.PostRoutingCacheSize,
+	}
+}
+
+// postCount names one counter of one post
+type postCount struct {
+	field      string // e.g. LikeCountField
+	subjectURI string
+}
+
+// PostCounter aggregates changes to the counters of posts and replies (like
+// LikeCountField) per post and counter, across many batches, and applies
+// each net change with one scripted update (see BulkUpdatePostCounts) to the
+// posts and replies write aliases. A like and its unlike within the same
+// window cancel out without a write, and a popular post takes one update
+// per window rather than one per batch. Updates are routed by the author
+// DID in the post's AT-URI, which is how posts and replies are routed, so
+// no lookup is needed. A post's first update goes to both aliases; the one
+// that holds it is then remembered in a PostRoutingCache, so later updates
+// go to it alone. Changes are lost if the process dies between flushes. A
+// nil PostCounter discards changes.
+type PostCounter struct {
+	client  *elasticsearch.Client
+	config  PostCountConfig
+	indices []string
+	dryRun  bool
+	logger  *IngestLogger
+	routes  *PostRoutingCache
+
+	mu      sync.Mutex
+	pending map[postCount]int // net increment
+	full    chan struct{}
+}
+
+// NewPostCounter returns a PostCounter; call Run to apply its changes
+func NewPostCounter(client *elasticsearch.Client, config PostCountConfig, dryRun bool, logger *IngestLogger) *PostCounter {
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 5 * time.Second
+	}
+	if config.MaxPosts <= 0 {
+		config.MaxPosts = 1000
+	}
+	return &PostCounter{
+		client:  client,
+		config:  config,
+		indices: []string{WriteAlias("posts"), WriteAlias("replies")},
+		dryRun:  dryRun,
+		logger:  logger,
+		routes:  NewPostRoutingCache(config.RoutingCacheSize),
+		pending: make(map[postCount]int),
+		full:    make(chan struct{}, 1),
+	}
+}
+
+// Add aggregates updates to field into the pending changes
+func (c *PostCounter) Add(field string, updates []CountUpdate) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, update := range updates {
+		if update.SubjectURI == "" || update.Increment == 0 {
+			continue
+		}
+		key := postCount{field: field, subjectURI: update.SubjectURI}
+		if net := c.pending[key] + update.Increment; net != 0 {
+			c.pending[key] = net
+		} else {
+			delete(c.pending, key)
+		}
+	}
+	if len(c.pending) >= c.config.MaxPosts {
+		select {
+		case c.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// AddReferences records that a post replying to parent, in the thread of
+// root, and quoting quote was indexed (increment 1) or deleted (-1). Empty
+// references are skipped.
+func (c *PostCounter) AddReferences(parent, root, quote string, increment int) {
+	c.Add(ReplyCountField, []CountUpdate{{SubjectURI: parent, Increment: increment}})
+	c.Add(ThreadReplyCountField, []CountUpdate{{SubjectURI: root, Increment: increment}})
+	c.Add(QuoteCountField, []CountUpdate{{SubjectURI: quote, Increment: increment}})
+}
+
+// Pending returns the number of post counters with changes not yet applied
+func (c *PostCounter) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
+
+// Run applies pending changes every FlushInterval, or sooner once MaxPosts
+// counters have changes, until ctx is done. Changes added after that are
+// applied by a final Flush.
+func (c *PostCounter) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-c.full:
+		}
+		if err := c.Flush(ctx); err != nil {
+			c.logger.Error("Failed to update post counts: %v", err)
+		}
+	}
+}
+
+// Flush applies the pending changes. Changes whose update fails are dropped
+// rather than retried, since a failed bulk request may have applied some of
+// them and a retry would count those twice.
+func (c *PostCounter) Flush(ctx context.Context) error {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[postCount]int, len(pending))
+	c.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	byField := make(map[string][]CountUpdate)
+	for key, increment := range pending {
+		byField[key.field] = append(byField[key.field], CountUpdate{SubjectURI: key.subjectURI, Increment: increment})
+	}
+	c.logger.Metric("post_counts.flushed_count", float64(len(pending)))
+	if c.dryRun {
+		c.logger.Debug("Dry-run: Would update %d post counts", len(pending))
+		return nil
+	}
+
+	routes := c.lookupRoutes(pending)
+
+	// A post is in exactly one of the indices; its update to the other is
+	// a 404 that BulkUpdatePostCounts ignores. Posts whose index is known
+	// are only updated there.
+	var (
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+	)
+	for field, updates := range byField {
+		for _, index := range c.indices {
+			var routed []CountUpdate
+			for _, update := range updates {
+				if alias, known := routes[update.SubjectURI]; !known || alias == index {
+					routed = append(routed, update)
+				}
+			}
+			if len(routed) == 0 {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				updated, err := bulkUpdatePostCounts(ctx, c.client, index, field, routed, false, c.logger)
+				if err != nil {
+					c.logger.Metric("post_counts.failed_count", float64(len(routed)))
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+					return
+				}
+				c.learnRoutes(index, routed, updated, routes)
+			}()
+		}
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	c.logger.Debug("Updated %d post counts", len(pending))
+	return nil
+}
+
+// lookupRoutes returns the known index of each post with pending changes
+func (c *PostCounter) lookupRoutes(pending map[postCount]int) map[string]string {
+	if c.routes == nil {
+		return nil
+	}
+	routes := make(map[string]string)
+	looked := make(map[string]bool)
+	var hits, misses int
+	for key := range pending {
+		if looked[key.subjectURI] {
+			continue
+		}
+		looked[key.subjectURI] = true
+		if alias, ok := c.routes.Get(key.subjectURI); ok {
+			routes[key.subjectURI] = alias
+			hits++
+		} else {
+			misses++
+		}
+	}
+	c.logger.Metric("post_counts.routing_cache_hit_count", float64(hits))
+	c.logger.Metric("post_counts.routing_cache_miss_count", float64(misses))
+	c.logger.Metric("post_counts.routing_cache_size", float64(c.routes.Len()))
+	return routes
+}
+
+// learnRoutes remembers that index holds the posts it updated, and forgets
+// the posts it was known to hold but no longer does, e.g. once deleted
+func (c *PostCounter) learnRoutes(index string, sent []CountUpdate, updated []string, routes map[string]string) {
+	if c.routes == nil {
+		return
+	}
+	found := make(map[string]bool, len(updated))
+	for _, uri := range updated {
+		found[uri] = true
+		c.routes.Put(uri, index)
+	}
+	for _, update := range sent {
+		if routes[update.SubjectURI] == index && !found[update.SubjectURI] {
+			c.routes.Forget(update.SubjectURI)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func newPostCounterTestServer(t *testing.T) *estest.Server {
+	t.Helper()
+	es := estest.New(t)
+	for _, field := range []string{LikeCountField, ReplyCountField, ThreadReplyCountField, QuoteCountField} {
+		es.Script(countScript(field), func(source, params map[string]interface{}) {
+			count, _ := source[field].(float64)
+			source[field] = count + params["increment"].(float64)
+		})
+	}
+	return es
+}
+
+func TestPostCounter_AppliesNetChangePerPost(t *testing.T) {
+	es := newPostCounterTestServer(t)
+	post := "at://did:plc:author/app.bsky.feed.post/1"
+	reply := "at://did:plc:author/app.bsky.feed.post/2"
+	unliked := "at://did:plc:author/app.bsky.feed.post/3"
+	es.Put("posts-write", post, map[string]interface{}{"at_uri": post, "like_count": 2})
+	es.Put("replies-write", reply, map[string]interface{}{"at_uri": reply})
+
+	counter := NewPostCounter(es.Client, PostCountConfig{}, false, NewLogger(false))
+	counter.Add(LikeCountField, []CountUpdate{{SubjectURI: post, Increment: 1}, {SubjectURI: reply, Increment: 1}, {SubjectURI: unliked, Increment: 1}})
+	counter.Add(LikeCountField, []CountUpdate{{SubjectURI: post, Increment: 1}, {SubjectURI: unliked, Increment: -1}, {Increment: 1}})
+	if n := counter.Pending(); n != 2 {
+		t.Fatalf("expected a like and its unlike to cancel out, got %d posts pending", n)
+	}
+
+	if err := counter.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if doc, _ := es.Get("posts-write", post); doc["like_count"] != 4.0 {
+		t.Errorf("expected post like_count 4, got %v", doc["like_count"])
+	}
+	if doc, _ := es.Get("replies-write", reply); doc["like_count"] != 1.0 {
+		t.Errorf("expected reply like_count 1, got %v", doc["like_count"])
+	}
+
+	// One update per post to each index, routed by the post's author
+	for _, call := range es.Calls(estest.APIBulk) {
+		items := call.BulkItems()
+		if len(items) != 2 {
+			t.Errorf("expected 2 updates in %s, got %d", call.Index, len(items))
+		}
+		for _, item := range items {
+			if item.Action != "update" || item.Routing != "did:plc:author" {
+				t.Errorf("expected a routed update, got %s routed %q", item.Action, item.Routing)
+			}
+		}
+	}
+	if counter.Pending() != 0 {
+		t.Error("expected nothing pending after a flush")
+	}
+}
+
+func TestPostCounter_RoutesKnownPostsToTheirIndex(t *testing.T) {
+	es := newPostCounterTestServer(t)
+	post := "at://did:plc:author/app.bsky.feed.post/1"
+	reply := "at://did:plc:author/app.bsky.feed.post/2"
+	es.Put("posts-write", post, map[string]interface{}{"at_uri": post})
+	es.Put("replies-write", reply, map[string]interface{}{"at_uri": reply})
+	deleted := false
+	es.FailItems(func(item estest.BulkItem) *estest.ItemFailure {
+		if deleted && item.ID == post {
+			return &estest.ItemFailure{Status: http.StatusNotFound, Type: "document_missing_exception", Reason: "document missing"}
+		}
+		return nil
+	})
+	counter := NewPostCounter(es.Client, PostCountConfig{RoutingCacheSize: 10}, false, NewLogger(false))
+
+	// flush likes both posts and returns how many updates each index got
+	flush := func() map[string]int {
+		t.Helper()
+		before := len(es.Calls(estest.APIBulk))
+		counter.Add(LikeCountField, []CountUpdate{{SubjectURI: post, Increment: 1}, {SubjectURI: reply, Increment: 1}})
+		if err := counter.Flush(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		sent := map[string]int{}
+		for _, call := range es.Calls(estest.APIBulk)[before:] {
+			for _, item := range call.BulkItems() {
+				sent[item.Index]++
+			}
+		}
+		return sent
+	}
+
+	if sent := flush(); sent["posts-write"] != 2 || sent["replies-write"] != 2 {
+		t.Errorf("expected unknown posts updated in both indices, got %v", sent)
+	}
+	if sent := flush(); sent["posts-write"] != 1 || sent["replies-write"] != 1 {
+		t.Errorf("expected each post updated only in its index, got %v", sent)
+	}
+	if doc, _ := es.Get("replies-write", reply); doc["like_count"] != 2.0 {
+		t.Errorf("expected reply like_count 2, got %v", doc["like_count"])
+	}
+
+	// A post its index no longer holds is forgotten
+	deleted = true
+	flush()
+	if _, known := counter.routes.Get(post); known {
+		t.Error("expected a missing post forgotten")
+	}
+	if sent := flush(); sent["posts-write"] != 1 || sent["replies-write"] != 2 {
+		t.Errorf("expected the forgotten post updated in both indices again, got %v", sent)
+	}
+}
+
+func TestPostCounter_DryRun(t *testing.T) {
+	es := newPostCounterTestServer(t)
+	counter := NewPostCounter(es.Client, PostCountConfig{}, true, NewLogger(false))
+	counter.Add(LikeCountField, []CountUpdate{{SubjectURI: "at://did:plc:author/app.bsky.feed.post/1", Increment: 1}})
+	if err := counter.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls := es.Calls(estest.APIBulk); len(calls) != 0 {
+		t.Errorf("expected a dry run to write nothing, got %d bulk calls", len(calls))
+	}
+	if counter.Pending() != 0 {
+		t.Error("expected a dry run to clear the pending changes")
+	}
+}
+
+func TestPostCounter_FlushesEarlyAtMaxPosts(t *testing.T) {
+	es := newPostCounterTestServer(t)
+	counter := NewPostCounter(es.Client, PostCountConfig{FlushInterval: time.Hour, MaxPosts: 2}, false, NewLogger(false))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		counter.Run(ctx)
+	}()
+
+	counter.Add(LikeCountField, []CountUpdate{
+		{SubjectURI: "at://did:plc:a/app.bsky.feed.post/1", Increment: 1},
+		{SubjectURI: "at://did:plc:b/app.bsky.feed.post/1", Increment: 1},
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(es.Calls(estest.APIBulk)) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-done
+	if calls := es.Calls(estest.APIBulk); len(calls) != 2 {
+		t.Errorf("expected a flush to posts and replies once MaxPosts posts changed, got %d bulk calls", len(calls))
+	}
+}
+
+func TestPostCounter_AddReferences(t *testing.T) {
+	es := newPostCounterTestServer(t)
+	root := "at://did:plc:root/app.bsky.feed.post/1"
+	parent := "at://did:plc:parent/app.bsky.feed.post/2"
+	quoted := "at://did:plc:quoted/app.bsky.feed.post/3"
+	es.Put("posts-write", root, map[string]interface{}{"at_uri": root})
+	es.Put("replies-write", parent, map[string]interface{}{"at_uri": parent})
+	es.Put("posts-write", quoted, map[string]interface{}{"at_uri": quoted, "quote_count": 1})
+
+	counter := NewPostCounter(es.Client, PostCountConfig{}, false, NewLogger(false))
+	counter.AddReferences(root, root, "", 1)       // Reply to the root
+	counter.AddReferences(parent, root, quoted, 1) // Reply to a reply, quoting
+	counter.AddReferences(root, root, "", 1)       // Another reply to the root...
+	counter.AddReferences(root, root, "", -1)      // ...deleted
+	counter.AddReferences("", "", quoted, 1)       // Quote post
+	if err := counter.Flush(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rootDoc, _ := es.Get("posts-write", root)
+	if rootDoc[ReplyCountField] != 1.0 || rootDoc[ThreadReplyCountField] != 2.0 {
+		t.Errorf("expected root reply_count 1 and thread_reply_count 2, got %v", rootDoc)
+	}
+	if doc, _ := es.Get("replies-write", parent); doc[ReplyCountField] != 1.0 {
+		t.Errorf("expected parent reply_count 1, got %v", doc)
+	}
+	if doc, _ := es.Get("posts-write", quoted); doc[QuoteCountField] != 3.0 {
+		t.Errorf("expected quote_count 3, got %v", doc)
+	}
+}
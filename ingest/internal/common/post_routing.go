@@ -0,0 +1,96 @@
+package common
+
+import (
+	"container/list"
+	"sync"
+)
+
+// PostRoutingCache remembers, for up to a fixed number of recently updated
+// posts, which write alias holds each one (see PostCounter), so that a
+// post's counter updates go to its index alone instead of to both the posts
+// and replies write aliases. A post's shard routing needs no cache: it is
+// the author DID in the post's AT-URI. The least recently used post is
+// forgotten first. A nil PostRoutingCache remembers nothing.
+type PostRoutingCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // Front is the most recently used
+	entries map[string]*list.Element
+}
+
+// postRoute is a PostRoutingCache entry
+type postRoute struct {
+	atURI string
+	alias string
+}
+
+// NewPostRoutingCache creates a cache remembering up to size posts. Returns
+// nil when size is not positive, which disables the cache.
+func NewPostRoutingCache(size int) *PostRoutingCache {
+	if size <= 0 {
+		return nil
+	}
+	return &PostRoutingCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+	}
+}
+
+// Get returns the write alias that holds the post at atURI, if known
+func (c *PostRoutingCache) Get(atURI string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[atURI]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*postRoute).alias, true
+}
+
+// Put records that alias holds the post at atURI
+func (c *PostRoutingCache) Put(atURI, alias string) {
+	if c == nil || atURI == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[atURI]; ok {
+		elem.Value.(*postRoute).alias = alias
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[atURI] = c.order.PushFront(&postRoute{atURI: atURI, alias: alias})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*postRoute).atURI)
+	}
+}
+
+// Forget drops the post at atURI, e.g. once an update finds it missing
+func (c *PostRoutingCache) Forget(atURI string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[atURI]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, atURI)
+	}
+}
+
+// Len returns the number of posts remembered
+func (c *PostRoutingCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,32 @@
+package common
+
+import "testing"
+
+func TestPostRoutingCache(t *testing.T) {
+	cache := NewPostRoutingCache(2)
+	cache.Put("at://a", "posts-write")
+	cache.Put("at://b", "replies-write")
+	if alias, ok := cache.Get("at://a"); !ok || alias != "posts-write" {
+		t.Fatalf("expected at://a in posts-write, got %q (%v)", alias, ok)
+	}
+
+	// at://b is now the least recently used
+	cache.Put("at://c", "posts-write")
+	if _, ok := cache.Get("at://b"); ok {
+		t.Error("expected the least recently used post evicted")
+	}
+	if cache.Len() != 2 {
+		t.Errorf("expected 2 posts remembered, got %d", cache.Len())
+	}
+
+	cache.Forget("at://a")
+	if _, ok := cache.Get("at://a"); ok {
+		t.Error("expected a forgotten post to be unknown")
+	}
+
+	disabled := NewPostRoutingCache(0)
+	disabled.Put("at://a", "posts-write")
+	if _, ok := disabled.Get("at://a"); ok || disabled.Len() != 0 {
+		t.Error("expected a disabled cache to remember nothing")
+	}
+}
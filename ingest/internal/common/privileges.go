@@ -0,0 +1,274 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// RoleDescriptor is an Elasticsearch role descriptor, in the form the create
+// API key API takes in role_descriptors
+type RoleDescriptor struct {
+	Cluster []string          `json:"cluster"`
+	Indices []IndexPrivileges `json:"indices"`
+}
+
+// IndexPrivileges grants privileges on a set of index names and patterns
+type IndexPrivileges struct {
+	Names      []string `json:"names"`
+	Privileges []string `json:"privileges"`
+}
+
+// Index privileges granted to each kind of access
+var (
+	ingestPrivileges = []string{"create_index", "manage", "write", "read", "view_index_metadata"}
+	readPrivileges   = []string{"read", "view_index_metadata"}
+	expiryPrivileges = []string{"read", "view_index_metadata", "delete", "delete_index"}
+	auditPrivileges  = []string{"create_doc"}
+	reportPrivileges = []string{"index", "view_index_metadata"}
+	updatePrivileges = []string{"read", "index", "view_index_metadata"}
+)
+
+// Service role definitions: the aliases each service reads or writes
+var (
+	megastreamAliases = []string{"posts", "replies", "post_tombstones", "reply_tombstones", "likes", "like_tombstones", "hashtags", "inferences", "accounts"}
+	jetstreamAliases  = []string{"likes", "like_tombstones", "follows", "follow_tombstones", "posts", "replies", "post_tombstones", "reply_tombstones", "accounts", "blocks"}
+	firehoseAliases   = []string{"posts", "replies", "post_tombstones", "reply_tombstones", "likes", "like_tombstones"}
+	extractAliases    = []string{"posts", "replies", "likes", "hashtags", "inferences", "follows", "post_tombstones", "reply_tombstones", "like_tombstones", "accounts"}
+	expiryAliases     = []string{"hashtags"}
+	recMetricsReads   = []string{"rec_impressions", "likes", "replies"}
+	recMetricsWrites  = []string{"rec_metrics"}
+	backfillAliases   = []string{"posts"}
+	recAPIReads       = []string{"posts", "replies", "likes", "follows", "blocks", "post_tombstones", "accounts"}
+	recAPIWrites      = []string{"llm_scores", "rec_impressions"}
+)
+
+// RoleServices lists the services ServiceRole has a role for
+func RoleServices() []string {
+	return []string{"megastream_ingest", "jetstream_ingest", "firehose_ingest", "extract", "elasticsearch_expiry", "rec_metrics", "embedding_backfill", "recommender_api"}
+}
+
+// ServiceRole returns the minimal role service's API key needs. Ingest
+// services write to, and create and roll over indices behind, their aliases;
+// extract only reads; expiry deletes documents and drops indices behind the
+// aliases it expires; rec_metrics reads impressions and engagement and
+// writes its results; embedding_backfill reads and updates posts in place,
+// and manages them when bulk tuning is configured;
+// recommender_api reads posts, replies, likes, and follows, the blocks, post
+// tombstones, and account statuses it filters slates by, reads and writes its
+// LLM score cache, and writes the impressions it serves.
+// Services that audit (see AuditLog) may also append to
+// GE_AUDIT_INDEX, and services that read an es:// deny list may read its
+// index. config may be nil, leaving both out.
+func ServiceRole(service string, config *Config) (RoleDescriptor, bool) {
+	var role RoleDescriptor
+	audits := false
+	switch service {
+	case "megastream_ingest":
+		role = RoleDescriptor{Cluster: []string{"monitor"}, Indices: []IndexPrivileges{{Names: aliasIndexNames(megastreamAliases), Privileges: ingestPrivileges}}}
+		audits = true
+	case "jetstream_ingest":
+		role = RoleDescriptor{Cluster: []string{"monitor"}, Indices: []IndexPrivileges{{Names: aliasIndexNames(jetstreamAliases), Privileges: ingestPrivileges}}}
+	case "firehose_ingest":
+		role = RoleDescriptor{Cluster: []string{"monitor"}, Indices: []IndexPrivileges{{Names: aliasIndexNames(firehoseAliases), Privileges: ingestPrivileges}}}
+	case "extract":
+		role = RoleDescriptor{Cluster: []string{}, Indices: []IndexPrivileges{{Names: aliasIndexNames(extractAliases), Privileges: readPrivileges}}}
+	case "elasticsearch_expiry":
+		role = RoleDescriptor{Cluster: []string{"monitor", "read_ilm"}, Indices: []IndexPrivileges{{Names: aliasIndexNames(expiryAliases), Privileges: expiryPrivileges}}}
+		audits = true
+	case "rec_metrics":
+		role = RoleDescriptor{Cluster: []string{}, Indices: []IndexPrivileges{
+			{Names: aliasIndexNames(recMetricsReads), Privileges: readPrivileges},
+			{Names: aliasIndexNames(recMetricsWrites), Privileges: reportPrivileges},
+		}}
+	case "embedding_backfill":
+		role = RoleDescriptor{Cluster: []string{}, Indices: []IndexPrivileges{{Names: aliasIndexNames(backfillAliases), Privileges: updatePrivileges}}}
+	case "recommender_api":
+		role = RoleDescriptor{Cluster: []string{}, Indices: []IndexPrivileges{
+			{Names: aliasIndexNames(recAPIReads), Privileges: readPrivileges},
+			{Names: aliasIndexNames(recAPIWrites), Privileges: updatePrivileges},
+		}}
+	default:
+		return RoleDescriptor{}, false
+	}
+
+	if config == nil {
+		return role, true
+	}
+	// Tuning posts for a single pass changes their settings and mapping _meta
+	if service == "embedding_backfill" && (config.BulkRefreshInterval != "" || config.BulkReplicas != "") {
+		role.Indices[0].Privileges = append(append([]string(nil), updatePrivileges...), "manage")
+	}
+	if audits && config.AuditIndex != "" {
+		role.Indices = append(role.Indices, IndexPrivileges{Names: []string{config.AuditIndex}, Privileges: auditPrivileges})
+	}
+	if index, ok := strings.CutPrefix(config.DenyListSource, "es://"); ok && service != "elasticsearch_expiry" && service != "rec_metrics" && service != "embedding_backfill" && service != "recommender_api" {
+		if name, _, found := strings.Cut(index, "/"); found {
+			role.Indices = append(role.Indices, IndexPrivileges{Names: []string{name}, Privileges: []string{"read"}})
+		}
+	}
+	return role, true
+}
+
+// aliasIndexNames returns the names a role needs for aliases: each alias, its
+// write alias, its dated or numbered backing indices (hyphenated, e.g.
+// post-tombstones-2026-06-03), and its versioned indices (e.g. hashtags_v1).
+// ES checks privileges against whichever name a request uses.
+func aliasIndexNames(aliases []string) []string {
+	names := make([]string, 0, 4*len(aliases))
+	for _, alias := range aliases {
+		names = append(names, alias, WriteAlias(alias), strings.ReplaceAll(alias, "_", "-")+"-*", alias+"_v*")
+	}
+	return names
+}
+
+// APIKeyRequest returns the body of a create API key request for service's
+// role
+func APIKeyRequest(service string, config *Config) (map[string]interface{}, error) {
+	role, ok := ServiceRole(service, config)
+	if !ok {
+		return nil, fmt.Errorf("no role defined for service %q (expected one of %s)", service, strings.Join(RoleServices(), ", "))
+	}
+	return map[string]interface{}{
+		"name": service + "-key",
+		"role_descriptors": map[string]interface{}{
+			service + "_role": role,
+		},
+	}, nil
+}
+
+// Privileges CheckAPIKeyPrivileges reports when a key holds them beyond its
+// service's role
+var (
+	adminClusterPrivileges = []string{"all", "manage", "manage_security", "manage_api_key", "manage_ilm", "manage_index_templates", "create_snapshot"}
+	broadIndexPrivileges   = []string{"all", "manage", "write", "delete", "delete_index"}
+)
+
+// impliedIndexPrivileges lists the broad index privileges each privilege
+// grants along with itself
+var impliedIndexPrivileges = map[string][]string{
+	"all":    broadIndexPrivileges,
+	"manage": {"delete_index"},
+	"write":  {"delete"},
+}
+
+// hasPrivilegesRequest is the body of a has_privileges request
+type hasPrivilegesRequest struct {
+	Cluster []string          `json:"cluster"`
+	Index   []IndexPrivileges `json:"index"`
+}
+
+// hasPrivilegesResponse is the part of a has_privileges response the check reads
+type hasPrivilegesResponse struct {
+	Username string                     `json:"username"`
+	Cluster  map[string]bool            `json:"cluster"`
+	Index    map[string]map[string]bool `json:"index"`
+}
+
+// CheckAPIKeyPrivileges warns when the configured API key holds far broader
+// privileges than service's role (see ServiceRole): cluster administration,
+// access to every index, or broad privileges on the service's own indices
+// that its role does not grant. It returns the excess privileges found. The
+// check never fails startup; it is skipped without GE_ELASTICSEARCH_API_KEY
+// and logged and skipped when Elasticsearch cannot answer it.
+func CheckAPIKeyPrivileges(ctx context.Context, client *elasticsearch.Client, service string, config *Config, logger *IngestLogger) []string {
+	if client == nil || config.ElasticsearchAPIKey == "" {
+		return nil
+	}
+	role, ok := ServiceRole(service, config)
+	if !ok {
+		logger.Debug("No API key role defined for %s, skipping privilege check", service)
+		return nil
+	}
+
+	request := excessPrivilegesRequest(role)
+	body, err := json.Marshal(request)
+	if err != nil {
+		logger.Error("Failed to marshal privilege check: %v", err)
+		return nil
+	}
+	res, err := client.Security.HasPrivileges(
+		bytes.NewReader(body),
+		client.Security.HasPrivileges.WithContext(ctx),
+	)
+	if err != nil {
+		logger.Error("Failed to check API key privileges: %v", err)
+		return nil
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.IsError() {
+		logger.Error("Failed to check API key privileges: %s", res.String())
+		return nil
+	}
+
+	var response hasPrivilegesResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		logger.Error("Failed to parse API key privilege check: %v", err)
+		return nil
+	}
+
+	var excess []string
+	for _, privilege := range request.Cluster {
+		if response.Cluster[privilege] {
+			excess = append(excess, "cluster:"+privilege)
+		}
+	}
+	for name, privileges := range response.Index {
+		for privilege, granted := range privileges {
+			if granted {
+				excess = append(excess, name+":"+privilege)
+			}
+		}
+	}
+	if len(excess) == 0 {
+		logger.Debug("API key privileges for %s are within its role", service)
+		return nil
+	}
+	sort.Strings(excess)
+
+	logger.Error("API key for %s (user %s) has %d privileges beyond its role: %s. Create a scoped key with 'ingexctl api-keys --service %s'",
+		service, response.Username, len(excess), strings.Join(excess, ", "), service)
+	logger.Metric("es.api_key_excess_privileges_count", float64(len(excess)))
+	return excess
+}
+
+// excessPrivilegesRequest builds the has_privileges request for privileges
+// beyond role: administrative cluster privileges, any access to every index,
+// and broad privileges on role's indices that role does not grant
+func excessPrivilegesRequest(role RoleDescriptor) hasPrivilegesRequest {
+	var request hasPrivilegesRequest
+
+	for _, privilege := range adminClusterPrivileges {
+		if !slices.Contains(role.Cluster, privilege) {
+			request.Cluster = append(request.Cluster, privilege)
+		}
+	}
+	request.Index = append(request.Index, IndexPrivileges{Names: []string{"*"}, Privileges: []string{"read", "write", "delete_index", "manage", "all"}})
+
+	for _, entry := range role.Indices {
+		granted := map[string]bool{}
+		for _, privilege := range entry.Privileges {
+			granted[privilege] = true
+			for _, implied := range impliedIndexPrivileges[privilege] {
+				granted[implied] = true
+			}
+		}
+		var broader []string
+		for _, privilege := range broadIndexPrivileges {
+			if !granted[privilege] {
+				broader = append(broader, privilege)
+			}
+		}
+		if len(broader) == 0 {
+			continue
+		}
+		request.Index = append(request.Index, IndexPrivileges{Names: entry.Names, Privileges: broader})
+	}
+	return request
+}
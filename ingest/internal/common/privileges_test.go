@@ -0,0 +1,135 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestServiceRole_ScopesAccess(t *testing.T) {
+	config := &Config{AuditIndex: "ops_audit", DenyListSource: "es://deny_list/current"}
+
+	extract, ok := ServiceRole("extract", config)
+	if !ok {
+		t.Fatal("expected a role for extract")
+	}
+	for _, entry := range extract.Indices {
+		for _, privilege := range entry.Privileges {
+			if privilege != "read" && privilege != "view_index_metadata" {
+				t.Errorf("extract role grants %s on %v", privilege, entry.Names)
+			}
+		}
+	}
+	if !slices.Contains(extract.Indices[0].Names, "post-tombstones-*") || !slices.Contains(extract.Indices[len(extract.Indices)-1].Names, "deny_list") {
+		t.Errorf("unexpected extract indices %+v", extract.Indices)
+	}
+
+	expiry, _ := ServiceRole("elasticsearch_expiry", config)
+	if !slices.Contains(expiry.Indices[0].Names, "hashtags_v*") || slices.Contains(expiry.Indices[0].Names, "posts") {
+		t.Errorf("unexpected expiry indices %+v", expiry.Indices[0].Names)
+	}
+	if last := expiry.Indices[len(expiry.Indices)-1]; last.Names[0] != "ops_audit" || !slices.Equal(last.Privileges, []string{"create_doc"}) {
+		t.Errorf("expected create_doc on the audit index, got %+v", last)
+	}
+
+	metrics, _ := ServiceRole("rec_metrics", config)
+	if len(metrics.Indices) != 2 || !slices.Contains(metrics.Indices[0].Names, "rec_impressions") || !slices.Equal(metrics.Indices[0].Privileges, readPrivileges) {
+		t.Errorf("unexpected rec_metrics read indices %+v", metrics.Indices)
+	}
+	if write := metrics.Indices[len(metrics.Indices)-1]; !slices.Contains(write.Names, "rec_metrics_v*") || slices.Contains(write.Names, "likes") {
+		t.Errorf("unexpected rec_metrics write indices %+v", write)
+	}
+
+	backfill, _ := ServiceRole("embedding_backfill", config)
+	if len(backfill.Indices) != 1 || !slices.Contains(backfill.Indices[0].Names, "posts-*") || slices.Contains(backfill.Indices[0].Privileges, "delete") {
+		t.Errorf("unexpected embedding_backfill indices %+v", backfill.Indices)
+	}
+	tuned := *config
+	tuned.BulkReplicas = "0"
+	if backfill, _ := ServiceRole("embedding_backfill", &tuned); !slices.Contains(backfill.Indices[0].Privileges, "manage") || slices.Contains(updatePrivileges, "manage") {
+		t.Errorf("expected manage on posts with bulk tuning, got %+v", backfill.Indices)
+	}
+
+	recAPI, _ := ServiceRole("recommender_api", config)
+	if len(recAPI.Indices) != 2 || !slices.Contains(recAPI.Indices[0].Names, "likes-*") || !slices.Equal(recAPI.Indices[0].Privileges, readPrivileges) {
+		t.Errorf("unexpected recommender_api indices %+v", recAPI.Indices)
+	}
+	if writes := recAPI.Indices[len(recAPI.Indices)-1]; !slices.Contains(writes.Names, "llm_scores_v*") || !slices.Contains(writes.Names, "rec_impressions_v*") || !slices.Contains(writes.Privileges, "index") {
+		t.Errorf("unexpected recommender_api write privileges %+v", writes)
+	}
+
+	if _, ok := ServiceRole("unknown", config); ok {
+		t.Error("expected no role for an unknown service")
+	}
+	if _, err := APIKeyRequest("unknown", config); err == nil {
+		t.Error("expected an error for an unknown service")
+	}
+}
+
+func TestCheckAPIKeyPrivileges_ReportsExcess(t *testing.T) {
+	var request hasPrivilegesRequest
+	client, srv := newMockESClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		if r.URL.Path != "/_security/user/_has_privileges" {
+			t.Errorf("unexpected request path %s", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &request); err != nil {
+			t.Errorf("failed to parse privilege check: %v", err)
+		}
+		_, _ = w.Write([]byte(`{
+			"username": "extract-key",
+			"has_all_requested": false,
+			"cluster": {"all": false, "manage": false, "manage_security": true},
+			"index": {
+				"*": {"read": true, "write": false, "delete_index": false, "manage": false, "all": false},
+				"posts": {"all": false, "manage": false, "write": false, "delete": false, "delete_index": false}
+			}
+		}`))
+	}))
+	defer srv.Close()
+
+	metrics := newMockMetricCollector()
+	logger := NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(metrics)
+
+	excess := CheckAPIKeyPrivileges(context.Background(), client, "extract", &Config{ElasticsearchAPIKey: "key"}, logger)
+
+	if !slices.Equal(excess, []string{"*:read", "cluster:manage_security"}) {
+		t.Errorf("unexpected excess privileges %v", excess)
+	}
+	if got := metrics.getRecords("es.api_key_excess_privileges_count"); len(got) != 1 {
+		t.Errorf("expected one excess privileges metric, got %v", got)
+	}
+	if len(request.Index) != 2 || !slices.Equal(request.Index[1].Privileges, broadIndexPrivileges) {
+		t.Errorf("expected every broad privilege checked on extract's indices, got %+v", request.Index)
+	}
+}
+
+func TestCheckAPIKeyPrivileges_SkipsGrantedPrivileges(t *testing.T) {
+	role, _ := ServiceRole("megastream_ingest", nil)
+	request := excessPrivilegesRequest(role)
+
+	if slices.Contains(request.Cluster, "monitor") {
+		t.Error("expected the role's own cluster privileges to be skipped")
+	}
+	if !slices.Equal(request.Index[1].Privileges, []string{"all"}) {
+		t.Errorf("expected only all checked on ingest indices, got %v", request.Index[1].Privileges)
+	}
+}
+
+func TestCheckAPIKeyPrivileges_WithoutAPIKey(t *testing.T) {
+	client, srv := newMockESClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s", r.URL.Path)
+	}))
+	defer srv.Close()
+
+	if excess := CheckAPIKeyPrivileges(context.Background(), client, "extract", &Config{}, NewLogger(false)); excess != nil {
+		t.Errorf("expected no check without an API key, got %v", excess)
+	}
+}
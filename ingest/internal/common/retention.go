@@ -0,0 +1,148 @@
+package common
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// defaultRetentionPolicy is the retention policy of every environment. It is
+// the one place retention is decided: elasticsearch_expiry deletes by it,
+// extract bounds its export windows by it, and the recommender takes its
+// candidate window from it. ILM delete ages (index/deploy) must match the
+// delete windows; elasticsearch_expiry reports any that do not.
+//
+//go:embed retention_policy.json
+var defaultRetentionPolicy []byte
+
+// RetentionWindows are the retention windows of one index, by age of its
+// documents. A zero window is unbounded.
+type RetentionWindows struct {
+	Hot    time.Duration // Newest content the recommender serves from the index
+	Export time.Duration // Oldest content extract may export
+	Delete time.Duration // Age at which documents are deleted
+}
+
+// retentionWindowsDocument is the stored form of RetentionWindows, with Go
+// duration strings
+type retentionWindowsDocument struct {
+	Hot    string `json:"hot,omitempty"`
+	Export string `json:"export,omitempty"`
+	Delete string `json:"delete,omitempty"`
+}
+
+// RetentionPolicy holds the retention windows of each index of one
+// environment, keyed by read alias (posts, likes, hashtags, ...)
+type RetentionPolicy struct {
+	Source  string
+	Indices map[string]RetentionWindows
+}
+
+// LoadRetentionPolicy returns environment's retention policy from source, a
+// local path or gs://bucket/object holding a document in the format of
+// retention_policy.json. An empty source uses the built-in policy.
+func LoadRetentionPolicy(ctx context.Context, environment, source string) (*RetentionPolicy, error) {
+	data := defaultRetentionPolicy
+	name := "built-in retention policy"
+	if source != "" {
+		var err error
+		if data, err = readRetentionPolicy(ctx, source); err != nil {
+			return nil, err
+		}
+		name = source
+	}
+	return parseRetentionPolicy(data, environment, name)
+}
+
+// RetentionPolicyFromConfig loads the retention policy for GE_ENVIRONMENT
+// from GE_RETENTION_POLICY
+func RetentionPolicyFromConfig(ctx context.Context, config *Config) (*RetentionPolicy, error) {
+	return LoadRetentionPolicy(ctx, config.Environment, config.RetentionPolicySource)
+}
+
+// Windows returns the retention windows of alias. Aliases the policy does not
+// name have no windows.
+func (p *RetentionPolicy) Windows(alias string) RetentionWindows {
+	if p == nil {
+		return RetentionWindows{}
+	}
+	return p.Indices[alias]
+}
+
+func parseRetentionPolicy(data []byte, environment, name string) (*RetentionPolicy, error) {
+	var doc map[string]map[string]retentionWindowsDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	indices, ok := doc[environment]
+	if !ok {
+		return nil, fmt.Errorf("%s has no policy for environment %q", name, environment)
+	}
+
+	policy := &RetentionPolicy{Source: name, Indices: make(map[string]RetentionWindows, len(indices))}
+	for alias, stored := range indices {
+		var windows RetentionWindows
+		for _, field := range []struct {
+			key   string
+			value string
+			dest  *time.Duration
+		}{
+			{"hot", stored.Hot, &windows.Hot},
+			{"export", stored.Export, &windows.Export},
+			{"delete", stored.Delete, &windows.Delete},
+		} {
+			if field.value == "" {
+				continue
+			}
+			d, err := time.ParseDuration(field.value)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("%s: invalid %s window %q for %s/%s", name, field.key, field.value, environment, alias)
+			}
+			*field.dest = d
+		}
+		if windows.Delete > 0 && (windows.Export > windows.Delete || windows.Hot > windows.Delete) {
+			return nil, fmt.Errorf("%s: %s/%s keeps hot or export content longer than its delete window", name, environment, alias)
+		}
+		policy.Indices[alias] = windows
+	}
+	return policy, nil
+}
+
+// readRetentionPolicy returns the raw policy document at a local path or
+// gs://bucket/object
+func readRetentionPolicy(ctx context.Context, source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "gs://") {
+		data, err := os.ReadFile(source) //nolint:gosec // G304: path comes from service configuration
+		if err != nil {
+			return nil, fmt.Errorf("failed to read retention policy: %w", err)
+		}
+		return data, nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(source, "gs://"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid GCS path format: %s (expected gs://bucket/object)", source)
+	}
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	defer func() { _ = client.Close() }()
+	reader, err := client.Bucket(parts[0]).Object(parts[1]).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open retention policy in GCS: %w", err)
+	}
+	defer func() { _ = reader.Close() }() // Best-effort close for read operation
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read retention policy from GCS: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadRetentionPolicy_BuiltIn(t *testing.T) {
+	for _, environment := range []string{"prod", "stage", "local"} {
+		policy, err := LoadRetentionPolicy(context.Background(), environment, "")
+		if err != nil {
+			t.Fatalf("%s: %v", environment, err)
+		}
+		for _, alias := range []string{"posts", "likes", "hashtags"} {
+			if policy.Windows(alias).Delete <= 0 {
+				t.Errorf("%s: expected a delete window for %s", environment, alias)
+			}
+		}
+	}
+
+	policy, _ := LoadRetentionPolicy(context.Background(), "prod", "")
+	want := RetentionWindows{Hot: 6 * time.Hour, Export: 720 * time.Hour, Delete: 1440 * time.Hour}
+	if got := policy.Windows("posts"); got != want {
+		t.Errorf("expected prod posts windows %+v, got %+v", want, got)
+	}
+	if got := policy.Windows("unknown"); got != (RetentionWindows{}) {
+		t.Errorf("expected no windows for an unknown alias, got %+v", got)
+	}
+}
+
+func TestLoadRetentionPolicy_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "retention.json")
+	if err := os.WriteFile(path, []byte(`{"prod":{"posts":{"hot":"1h","delete":"48h"}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := LoadRetentionPolicy(context.Background(), "prod", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Source != path {
+		t.Errorf("expected source %s, got %s", path, policy.Source)
+	}
+	if got := policy.Windows("posts"); got.Hot != time.Hour || got.Export != 0 || got.Delete != 48*time.Hour {
+		t.Errorf("unexpected posts windows %+v", got)
+	}
+
+	if _, err := LoadRetentionPolicy(context.Background(), "stage", path); err == nil {
+		t.Error("expected an error for an environment without a policy")
+	}
+}
+
+func TestLoadRetentionPolicy_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"bad duration":          `{"prod":{"posts":{"delete":"60 days"}}}`,
+		"negative":              `{"prod":{"posts":{"delete":"-1h"}}}`,
+		"export past deletion":  `{"prod":{"posts":{"export":"72h","delete":"48h"}}}`,
+		"hot past deletion":     `{"prod":{"posts":{"hot":"72h","delete":"48h"}}}`,
+		"not a policy document": `[]`,
+	}
+	for name, doc := range tests {
+		path := filepath.Join(t.TempDir(), "retention.json")
+		if err := os.WriteFile(path, []byte(doc), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadRetentionPolicy(context.Background(), "prod", path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// WriteAlias returns the alias ingest services write through for alias (e.g.
+// "posts" → "posts-write"). It always points at exactly one backing index, the
+// current write target; the read alias spans every backing index.
+func WriteAlias(alias string) string {
+	return alias + "-write"
+}
+
+// BackfillAlias returns the alias backfills write through for alias (e.g.
+// "posts" → "posts-backfill"), so repairs never move or roll over the live
+// write alias
+func BackfillAlias(alias string) string {
+	return alias + "-backfill"
+}
+
+// EnsureBackfillAlias returns the index alias's backfill alias writes to. If
+// the backfill alias does not exist yet, it is created on the current write
+// index of alias and stays there when the write alias rolls over. Point it
+// at another index of the read alias beforehand to backfill elsewhere.
+func EnsureBackfillAlias(ctx context.Context, client *elasticsearch.Client, alias string, logger *IngestLogger) (string, error) {
+	backfillAlias := BackfillAlias(alias)
+	existing, err := AliasIndices(ctx, client, backfillAlias, logger)
+	if err != nil {
+		return "", err
+	}
+	if index := writeIndex(existing); index != "" {
+		return index, nil
+	}
+	if len(existing) > 0 {
+		return "", fmt.Errorf("%s points at %d indices and none is its write index", backfillAlias, len(existing))
+	}
+
+	current, err := AliasIndices(ctx, client, WriteAlias(alias), logger)
+	if err != nil {
+		return "", err
+	}
+	index := writeIndex(current)
+	if index == "" {
+		return "", fmt.Errorf("%s has no write index to backfill into", WriteAlias(alias))
+	}
+	if err := updateAliases(ctx, client, []map[string]interface{}{
+		{"add": map[string]interface{}{"index": index, "alias": backfillAlias, "is_write_index": true}},
+	}, logger); err != nil {
+		return "", err
+	}
+	logger.Info("Created %s on %s", backfillAlias, index)
+	return index, nil
+}
+
+func writeIndex(indices map[string]bool) string {
+	for index, isWrite := range indices {
+		if isWrite {
+			return index
+		}
+	}
+	return ""
+}
+
+// RolloverConditions are the thresholds at which the write index of an alias
+// is rolled over to a new backing index. Any one condition met triggers a
+// rollover; zero values are ignored.
+type RolloverConditions struct {
+	MaxAge              time.Duration // Age of the write index
+	MaxPrimaryShardSize string        // Size of its largest primary shard, e.g. "50gb"
+	MaxDocs             int64         // Documents in the write index
+}
+
+// rolloverConditions are the default conditions for each environment profile
+// when GE_INDEX_ROLLOVER is enabled. Ages match the period each environment
+// uses for dated indices, so retention behaves the same in either mode.
+var rolloverConditions = map[string]RolloverConditions{
+	"prod":  {MaxAge: 7 * 24 * time.Hour, MaxPrimaryShardSize: "50gb"},
+	"stage": {MaxAge: time.Hour, MaxPrimaryShardSize: "10gb"},
+	"local": {MaxAge: 10 * time.Minute},
+}
+
+// rolloverConditionsFromConfig returns the environment's default conditions
+// with any GE_INDEX_ROLLOVER_* overrides applied
+func rolloverConditionsFromConfig(environment string, config *Config) (RolloverConditions, error) {
+	conditions := rolloverConditions[environment]
+	if config.IndexRolloverMaxAge > 0 {
+		conditions.MaxAge = config.IndexRolloverMaxAge
+	}
+	if config.IndexRolloverMaxShardSize != "" {
+		conditions.MaxPrimaryShardSize = config.IndexRolloverMaxShardSize
+	}
+	if config.IndexRolloverMaxDocs > 0 {
+		conditions.MaxDocs = int64(config.IndexRolloverMaxDocs)
+	}
+	if conditions.MaxAge <= 0 && conditions.MaxPrimaryShardSize == "" && conditions.MaxDocs <= 0 {
+		return RolloverConditions{}, fmt.Errorf("GE_INDEX_ROLLOVER is enabled but no rollover condition is set")
+	}
+	return conditions, nil
+}
+
+func (c RolloverConditions) body() map[string]interface{} {
+	conditions := map[string]interface{}{}
+	if c.MaxAge > 0 {
+		conditions["max_age"] = fmt.Sprintf("%ds", int64(c.MaxAge.Seconds()))
+	}
+	if c.MaxPrimaryShardSize != "" {
+		conditions["max_primary_shard_size"] = c.MaxPrimaryShardSize
+	}
+	if c.MaxDocs > 0 {
+		conditions["max_docs"] = c.MaxDocs
+	}
+	return conditions
+}
+
+// FirstRolloverIndex returns the name of the first backing index of a rolled
+// over alias. Elasticsearch increments the numeric suffix on each rollover.
+func FirstRolloverIndex(alias string) string {
+	return strings.ReplaceAll(alias, "_", "-") + "-000001"
+}
+
+// AliasIndices returns the indices alias points to, mapped to whether each is
+// the alias's write index. A missing alias has no indices.
+func AliasIndices(ctx context.Context, client *elasticsearch.Client, alias string, logger *IngestLogger) (map[string]bool, error) {
+	res, err := client.Indices.GetAlias(
+		client.Indices.GetAlias.WithContext(ctx),
+		client.Indices.GetAlias.WithName(alias),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get alias %s: %w", alias, err)
+	}
+	defer func() {
+		if cerr := res.Body.Close(); cerr != nil {
+			logger.Error("Failed to close get-alias response body: %v", cerr)
+		}
+	}()
+	if res.StatusCode == 404 {
+		return map[string]bool{}, nil
+	}
+	if res.IsError() {
+		bodyBytes, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("get alias %s: [%d] %s", alias, res.StatusCode, string(bodyBytes))
+	}
+
+	var state map[string]struct {
+		Aliases map[string]indexAliasInfo `json:"aliases"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&state); err != nil {
+		return nil, fmt.Errorf("parse alias response for %s: %w", alias, err)
+	}
+	indices := make(map[string]bool, len(state))
+	for index, info := range state {
+		aliasInfo, ok := info.Aliases[alias]
+		if !ok {
+			continue
+		}
+		// An alias with a single index and no explicit flag still writes to it
+		indices[index] = aliasInfo.IsWriteIndex || len(state) == 1
+	}
+	return indices, nil
+}
+
+// ensureRollover bootstraps the write alias for alias if it does not exist
+// yet, and otherwise rolls it over when the profile's conditions are met
+func (m *IndexManager) ensureRollover(ctx context.Context, alias string) error {
+	writeAlias := WriteAlias(alias)
+	current, err := AliasIndices(ctx, m.client, writeAlias, m.logger)
+	if err != nil {
+		return err
+	}
+	if len(current) == 0 {
+		return m.bootstrapRollover(ctx, alias)
+	}
+
+	// A dry run reports whether any condition is met and the name of the
+	// index a rollover would create, so the budget can be checked first
+	result, err := m.rollover(ctx, writeAlias, nil, true)
+	if err != nil {
+		return err
+	}
+	met := false
+	for _, ok := range result.Conditions {
+		met = met || ok
+	}
+	if !met {
+		return nil
+	}
+
+	if err := m.checkShardBudget(ctx, result.NewIndex); err != nil {
+		m.logger.Metric("es.index_manager.create_refused_count", 1)
+		return err
+	}
+	result, err = m.rollover(ctx, writeAlias, map[string]interface{}{alias: map[string]interface{}{}}, false)
+	if err != nil {
+		return err
+	}
+	if result.RolledOver {
+		m.logger.Info("Rolled over %s from %s to %s", writeAlias, result.OldIndex, result.NewIndex)
+		m.logger.Metric("es.index_manager.rollover_count", 1)
+	}
+	return nil
+}
+
+// bootstrapRollover creates the first rollover index for alias and, in one
+// atomic alias update, makes it the target of the write alias, adds it to
+// the read alias, and clears the write flag of any dated index still marked
+// as the read alias's write index
+func (m *IndexManager) bootstrapRollover(ctx context.Context, alias string) error {
+	name := FirstRolloverIndex(alias)
+	exists, err := m.indexExists(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := m.checkShardBudget(ctx, name); err != nil {
+			m.logger.Metric("es.index_manager.create_refused_count", 1)
+			return err
+		}
+		if err := createIndex(ctx, m.client, name, m.logger); err != nil {
+			return err
+		}
+	}
+
+	members, err := AliasIndices(ctx, m.client, alias, m.logger)
+	if err != nil {
+		return err
+	}
+	var actions []map[string]interface{}
+	for index, isWrite := range members {
+		if isWrite && index != name {
+			actions = append(actions, map[string]interface{}{
+				"add": map[string]interface{}{"index": index, "alias": alias, "is_write_index": false},
+			})
+		}
+	}
+	actions = append(actions,
+		map[string]interface{}{"add": map[string]interface{}{"index": name, "alias": alias}},
+		map[string]interface{}{"add": map[string]interface{}{"index": name, "alias": WriteAlias(alias), "is_write_index": true}},
+	)
+	if err := updateAliases(ctx, m.client, actions, m.logger); err != nil {
+		return err
+	}
+	m.logger.Info("Bootstrapped %s on %s", WriteAlias(alias), name)
+	return nil
+}
+
+type rolloverResult struct {
+	OldIndex   string          `json:"old_index"`
+	NewIndex   string          `json:"new_index"`
+	RolledOver bool            `json:"rolled_over"`
+	Conditions map[string]bool `json:"conditions"`
+}
+
+func (m *IndexManager) rollover(ctx context.Context, writeAlias string, newAliases map[string]interface{}, dryRun bool) (*rolloverResult, error) {
+	body := map[string]interface{}{"conditions": m.profile.Rollover.body()}
+	if newAliases != nil {
+		body["aliases"] = newAliases
+	}
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshal rollover for %s: %w", writeAlias, err)
+	}
+
+	res, err := m.client.Indices.Rollover(
+		writeAlias,
+		m.client.Indices.Rollover.WithContext(ctx),
+		m.client.Indices.Rollover.WithBody(bytes.NewReader(bodyJSON)),
+		m.client.Indices.Rollover.WithDryRun(dryRun),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("rollover %s: %w", writeAlias, err)
+	}
+	defer func() {
+		if cerr := res.Body.Close(); cerr != nil {
+			m.logger.Error("Failed to close rollover response body: %v", cerr)
+		}
+	}()
+	if res.IsError() {
+		bodyBytes, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("rollover %s: [%d] %s", writeAlias, res.StatusCode, string(bodyBytes))
+	}
+
+	var result rolloverResult
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode rollover %s: %w", writeAlias, err)
+	}
+	return &result, nil
+}
+
+// pointWriteAlias makes index the only member of alias's write alias
+func (m *IndexManager) pointWriteAlias(ctx context.Context, alias, index string) error {
+	writeAlias := WriteAlias(alias)
+	members, err := AliasIndices(ctx, m.client, writeAlias, m.logger)
+	if err != nil {
+		return err
+	}
+	if isWrite, ok := members[index]; ok && isWrite && len(members) == 1 {
+		return nil
+	}
+
+	var actions []map[string]interface{}
+	for member := range members {
+		if member != index {
+			actions = append(actions, map[string]interface{}{
+				"remove": map[string]interface{}{"index": member, "alias": writeAlias},
+			})
+		}
+	}
+	actions = append(actions, map[string]interface{}{
+		"add": map[string]interface{}{"index": index, "alias": writeAlias, "is_write_index": true},
+	})
+	if err := updateAliases(ctx, m.client, actions, m.logger); err != nil {
+		return err
+	}
+	m.logger.Info("Pointed %s at %s", writeAlias, index)
+	return nil
+}
+
+// createIndex creates name from its matching index template; an index that
+// already exists is not an error
+func createIndex(ctx context.Context, client *elasticsearch.Client, name string, logger *IngestLogger) error {
+	res, err := client.Indices.Create(name, client.Indices.Create.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("create index %s: %w", name, err)
+	}
+	defer func() {
+		if cerr := res.Body.Close(); cerr != nil {
+			logger.Error("Failed to close create-index response body: %v", cerr)
+		}
+	}()
+	if res.IsError() {
+		bodyBytes, _ := io.ReadAll(res.Body)
+		if strings.Contains(string(bodyBytes), "resource_already_exists_exception") {
+			return nil
+		}
+		return fmt.Errorf("create index %s: [%d] %s", name, res.StatusCode, string(bodyBytes))
+	}
+	logger.Info("Created index %s", name)
+	return nil
+}
+
+func updateAliases(ctx context.Context, client *elasticsearch.Client, actions []map[string]interface{}, logger *IngestLogger) error {
+	body, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return fmt.Errorf("marshal alias update: %w", err)
+	}
+	res, err := client.Indices.UpdateAliases(bytes.NewReader(body), client.Indices.UpdateAliases.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("update aliases: %w", err)
+	}
+	defer func() {
+		if cerr := res.Body.Close(); cerr != nil {
+			logger.Error("Failed to close update-aliases response body: %v", cerr)
+		}
+	}()
+	if res.IsError() {
+		bodyBytes, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("update aliases: [%d] %s", res.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
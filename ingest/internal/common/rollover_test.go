@@ -0,0 +1,207 @@
+package common
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIndexProfileFromConfig_Rollover(t *testing.T) {
+	profile, err := IndexProfileFromConfig(&Config{Environment: "prod"})
+	if err != nil || profile.Rollover != nil {
+		t.Errorf("rollover must be opt-in, got %+v, %v", profile.Rollover, err)
+	}
+
+	profile, err = IndexProfileFromConfig(&Config{Environment: "prod", IndexRollover: true, IndexRolloverMaxDocs: 1000})
+	if err != nil || profile.Rollover == nil {
+		t.Fatalf("expected rollover conditions, got %+v, %v", profile, err)
+	}
+	if profile.Rollover.MaxAge != 7*24*time.Hour || profile.Rollover.MaxPrimaryShardSize != "50gb" || profile.Rollover.MaxDocs != 1000 {
+		t.Errorf("unexpected conditions %+v", *profile.Rollover)
+	}
+
+	body := profile.Rollover.body()
+	if body["max_age"] != "604800s" || body["max_docs"] != int64(1000) {
+		t.Errorf("unexpected rollover body %v", body)
+	}
+}
+
+// rolloverHandler simulates a cluster for rollover mode. writeAlias is the
+// GET _alias response for the write alias; conditionMet controls the dry-run
+// result. Every request that changes the cluster is recorded.
+func rolloverHandler(t *testing.T, writeAlias string, conditionMet bool, health string, requests *[]string) http.Handler {
+	t.Helper()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !strings.Contains(r.URL.Path, "_simulate_index") {
+			body, _ := io.ReadAll(r.Body)
+			*requests = append(*requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery+" "+string(body))
+		}
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(404)
+		case r.URL.Path == "/_alias/likes-write":
+			if writeAlias == "" {
+				w.WriteHeader(404)
+				_, _ = w.Write([]byte(`{"error":"alias [likes-write] missing","status":404}`))
+				return
+			}
+			_, _ = w.Write([]byte(writeAlias))
+		case r.URL.Path == "/_alias/likes":
+			_, _ = w.Write([]byte(`{"likes-2026-w16":{"aliases":{"likes":{"is_write_index":true}}},"likes-2026-w15":{"aliases":{"likes":{}}}}`))
+		case strings.HasSuffix(r.URL.Path, "/_rollover"):
+			if r.URL.Query().Get("dry_run") != "true" {
+				_, _ = w.Write([]byte(`{"old_index":"likes-000001","new_index":"likes-000002","rolled_over":true,"conditions":{"[max_docs: 10]":true}}`))
+				return
+			}
+			if conditionMet {
+				_, _ = w.Write([]byte(`{"old_index":"likes-000001","new_index":"likes-000002","rolled_over":false,"dry_run":true,"conditions":{"[max_docs: 10]":true}}`))
+			} else {
+				_, _ = w.Write([]byte(`{"old_index":"likes-000001","new_index":"likes-000002","rolled_over":false,"dry_run":true,"conditions":{"[max_docs: 10]":false}}`))
+			}
+		case strings.HasPrefix(r.URL.Path, "/_index_template/_simulate_index/"):
+			_, _ = w.Write([]byte(`{"template":{"settings":{"index":{"number_of_shards":"10","number_of_replicas":"1"}}}}`))
+		case r.URL.Path == "/_cluster/health":
+			_, _ = w.Write([]byte(health))
+		default:
+			_, _ = w.Write([]byte(`{"acknowledged":true}`))
+		}
+	})
+}
+
+func TestIndexManager_BootstrapsWriteAlias(t *testing.T) {
+	var requests []string
+	client, srv := newMockESClient(t, rolloverHandler(t, "", false, `{"active_shards":100}`, &requests))
+	defer srv.Close()
+
+	profile := IndexProfile{Environment: "prod", ShardBudget: 3000, Rollover: &RolloverConditions{MaxDocs: 10}}
+	manager := NewIndexManager(client, profile, []string{"likes"}, NewLogger(false))
+	if err := manager.EnsureCurrent(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(requests) != 2 || !strings.HasPrefix(requests[0], "PUT /likes-000001") {
+		t.Fatalf("expected index creation then one alias update, got %v", requests)
+	}
+	update := requests[1]
+	for _, want := range []string{
+		`"alias":"likes","index":"likes-2026-w16","is_write_index":false`,
+		`"alias":"likes","index":"likes-000001"`,
+		`"alias":"likes-write","index":"likes-000001","is_write_index":true`,
+	} {
+		if !strings.Contains(update, want) {
+			t.Errorf("alias update missing %s: %s", want, update)
+		}
+	}
+}
+
+func TestIndexManager_RollsOverWhenConditionMet(t *testing.T) {
+	var requests []string
+	client, srv := newMockESClient(t, rolloverHandler(t, `{"likes-000001":{"aliases":{"likes-write":{"is_write_index":true}}}}`, true, `{"active_shards":100}`, &requests))
+	defer srv.Close()
+
+	profile := IndexProfile{Environment: "prod", ShardBudget: 3000, Rollover: &RolloverConditions{MaxDocs: 10}}
+	manager := NewIndexManager(client, profile, []string{"likes"}, NewLogger(false))
+	if err := manager.EnsureCurrent(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected a dry run and a rollover, got %v", requests)
+	}
+	if !strings.Contains(requests[1], `"aliases":{"likes":{}}`) || !strings.Contains(requests[1], `"max_docs":10`) {
+		t.Errorf("rollover must add the new index to the read alias: %s", requests[1])
+	}
+}
+
+func TestIndexManager_NoRolloverWhenConditionsUnmet(t *testing.T) {
+	var requests []string
+	client, srv := newMockESClient(t, rolloverHandler(t, `{"likes-000001":{"aliases":{"likes-write":{"is_write_index":true}}}}`, false, `{"active_shards":100}`, &requests))
+	defer srv.Close()
+
+	manager := NewIndexManager(client, IndexProfile{Environment: "prod", Rollover: &RolloverConditions{MaxDocs: 10}}, []string{"likes"}, NewLogger(false))
+	if err := manager.EnsureCurrent(t.Context()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(requests) != 1 || !strings.Contains(requests[0], "dry_run=true") {
+		t.Errorf("expected only the dry run, got %v", requests)
+	}
+}
+
+func TestIndexManager_RolloverRespectsShardBudget(t *testing.T) {
+	var requests []string
+	client, srv := newMockESClient(t, rolloverHandler(t, `{"likes-000001":{"aliases":{"likes-write":{"is_write_index":true}}}}`, true, `{"active_shards":2990}`, &requests))
+	defer srv.Close()
+
+	profile := IndexProfile{Environment: "prod", ShardBudget: 3000, Rollover: &RolloverConditions{MaxDocs: 10}}
+	manager := NewIndexManager(client, profile, []string{"likes"}, NewLogger(false))
+	err := manager.EnsureCurrent(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "refusing to create likes-000002") {
+		t.Errorf("expected shard budget refusal, got %v", err)
+	}
+	if len(requests) != 1 {
+		t.Errorf("only the dry run may be sent over budget, got %v", requests)
+	}
+}
+
+func TestEnsureBackfillAlias(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		aliases   map[string]string // GET /_alias/<name> response by alias
+		wantIndex string
+		wantAdd   bool
+	}{
+		{
+			name: "creates on the live write index",
+			aliases: map[string]string{
+				"posts-write": `{"posts-2026-w10":{"aliases":{"posts-write":{"is_write_index":true}}}}`,
+			},
+			wantIndex: "posts-2026-w10",
+			wantAdd:   true,
+		},
+		{
+			name: "keeps an existing backfill alias",
+			aliases: map[string]string{
+				"posts-backfill": `{"posts-2026-w08":{"aliases":{"posts-backfill":{}}}}`,
+				"posts-write":    `{"posts-2026-w10":{"aliases":{"posts-write":{"is_write_index":true}}}}`,
+			},
+			wantIndex: "posts-2026-w08",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var updates []string
+			client, srv := newMockESClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Elastic-Product", "Elasticsearch")
+				if name, ok := strings.CutPrefix(r.URL.Path, "/_alias/"); ok {
+					if body, ok := tc.aliases[name]; ok {
+						_, _ = w.Write([]byte(body))
+						return
+					}
+					w.WriteHeader(http.StatusNotFound)
+					_, _ = w.Write([]byte(`{}`))
+					return
+				}
+				body, _ := io.ReadAll(r.Body)
+				updates = append(updates, string(body))
+				_, _ = w.Write([]byte(`{"acknowledged":true}`))
+			}))
+			defer srv.Close()
+
+			index, err := EnsureBackfillAlias(t.Context(), client, "posts", NewLogger(false))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if index != tc.wantIndex {
+				t.Errorf("got index %s, want %s", index, tc.wantIndex)
+			}
+			if tc.wantAdd != (len(updates) == 1) {
+				t.Fatalf("unexpected alias updates %v", updates)
+			}
+			if tc.wantAdd && !strings.Contains(updates[0], `"alias":"posts-backfill","index":"posts-2026-w10","is_write_index":true`) {
+				t.Errorf("unexpected alias update %s", updates[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/elastic/go-elasticsearch/v9/esapi"
+)
+
+// RoutedAliases are the aliases whose documents are routed by author_did
+var RoutedAliases = []string{"posts", "replies", "post_tombstones", "reply_tombstones", "likes", "like_tombstones", "follows", "follow_tombstones"}
+
+// routingSampleSize is how many of an alias's oldest documents CheckRouting
+// samples
+const routingSampleSize = 200
+
+// routingHit is a search hit with what a routing check needs
+type routingHit struct {
+	Index   string        `json:"_index"`
+	ID      string        `json:"_id"`
+	Routing string        `json:"_routing"`
+	Sort    []interface{} `json:"sort"`
+	Source  struct {
+		AuthorDID string `json:"author_did"`
+	} `json:"_source"`
+}
+
+// misrouted reports whether the document is not routed by its author_did.
+// Documents without an author_did cannot be routed and are left alone.
+func (h routingHit) misrouted() bool {
+	return h.Source.AuthorDID != "" && h.Routing != h.Source.AuthorDID
+}
+
+type routingSearchResponse struct {
+	PITID string `json:"pit_id"`
+	Hits  struct {
+		Hits []routingHit `json:"hits"`
+	} `json:"hits"`
+}
+
+// CheckRouting warns when any of aliases holds documents not routed by
+// author_did, such as those older releases indexed without routing. Routed
+// deletes, updates, and lookups miss them. Each alias's oldest documents are
+// sampled, since that is where legacy documents sort. It returns the aliases
+// with misrouted documents. The check never fails startup; aliases that are
+// missing or cannot be searched are logged and skipped.
+func CheckRouting(ctx context.Context, client *elasticsearch.Client, aliases []string, logger *IngestLogger) []string {
+	if client == nil {
+		return nil
+	}
+
+	var mixed []string
+	for _, alias := range aliases {
+		query := map[string]interface{}{
+			"size":             routingSampleSize,
+			"_source":          []string{"author_did"},
+			"sort":             []interface{}{map[string]interface{}{"indexed_at": map[string]interface{}{"order": "asc", "unmapped_type": "date"}}},
+			"track_total_hits": false,
+		}
+		response, status, err := searchRouting(ctx, client, alias, query, logger)
+		if status == http.StatusNotFound {
+			logger.Debug("Index %s not found, skipping routing check", alias)
+			continue
+		}
+		if err != nil {
+			logger.Error("Failed to check routing of %s: %v", alias, err)
+			continue
+		}
+
+		misrouted := 0
+		for _, hit := range response.Hits.Hits {
+			if hit.misrouted() {
+				misrouted++
+			}
+		}
+		if misrouted == 0 {
+			logger.Debug("Sampled %d documents of %s, all routed by author_did", len(response.Hits.Hits), alias)
+			continue
+		}
+		mixed = append(mixed, alias)
+		logger.Error("Index %s has documents not routed by author_did (%d of the %d oldest sampled), which routed deletes and updates miss. Repair them with 'ingexctl repair-routing --index %s'",
+			alias, misrouted, len(response.Hits.Hits), alias)
+		logger.Metric("es.misrouted_sampled_count", float64(misrouted))
+	}
+	return mixed
+}
+
+// RoutingRepairConfig controls a RepairRouting run
+type RoutingRepairConfig struct {
+	BatchSize int           // Documents scanned per page (default 1000)
+	KeepAlive time.Duration // How long the point in time is kept between pages (default 5m)
+	DryRun    bool          // Count misrouted documents without repairing them
+}
+
+// RoutingRepairStats counts what a RepairRouting run found and did
+type RoutingRepairStats struct {
+	Scanned    int // Documents scanned
+	Unroutable int // Documents without an author_did, left alone
+	Misrouted  int // Documents whose _routing is not their author_did
+	Repaired   int // Misrouted documents reindexed with author_did routing
+	Changed    int // Misrouted documents deleted or updated since the scan, left for a later run
+	Failed     int // Misrouted documents not repaired; reindex failures are dead-lettered
+}
+
+// RepairRouting scans index for documents whose _routing is not their
+// author_did and reindexes each with author_did routing. The scan reads a
+// point in time, so repaired copies are not scanned again. Each misrouted
+// document is fetched, deleted with its old routing only if it has not
+// changed since it was fetched, and then indexed with the new routing to the
+// same backing index; deleting first keeps a copy that lands on the same
+// shard from being deleted after it is written. A copy that fails to index
+// is dead-lettered and can be replayed with dlq_replay.
+func RepairRouting(ctx context.Context, client *elasticsearch.Client, index string, config RoutingRepairConfig, logger *IngestLogger) (RoutingRepairStats, error) {
+	var stats RoutingRepairStats
+	if config.BatchSize <= 0 {
+		config.BatchSize = 1000
+	}
+	if config.KeepAlive <= 0 {
+		config.KeepAlive = 5 * time.Minute
+	}
+
+	pitID, err := OpenExportPIT(ctx, client, logger, index, config.KeepAlive)
+	if err != nil {
+		return stats, err
+	}
+	defer func() { CloseExportPIT(client, logger, pitID) }()
+
+	var searchAfter []interface{}
+	for {
+		query := map[string]interface{}{
+			"size":    config.BatchSize,
+			"_source": []string{"author_did"},
+			"sort":    []string{"_shard_doc"},
+			"pit": map[string]interface{}{
+				"id":         pitID,
+				"keep_alive": fmt.Sprintf("%ds", int(config.KeepAlive.Seconds())),
+			},
+			"track_total_hits": false,
+		}
+		if searchAfter != nil {
+			query["search_after"] = searchAfter
+		}
+		response, _, err := searchRouting(ctx, client, "", query, logger)
+		if err != nil {
+			return stats, err
+		}
+		if response.PITID != "" {
+			pitID = response.PITID
+		}
+		hits := response.Hits.Hits
+		if len(hits) == 0 {
+			break
+		}
+
+		var misrouted []routingHit
+		for _, hit := range hits {
+			switch {
+			case hit.Source.AuthorDID == "":
+				stats.Unroutable++
+			case hit.misrouted():
+				misrouted = append(misrouted, hit)
+			}
+		}
+		stats.Scanned += len(hits)
+		stats.Misrouted += len(misrouted)
+
+		if len(misrouted) > 0 && !config.DryRun {
+			if err := repairRoutingBatch(ctx, client, misrouted, &stats, logger); err != nil {
+				return stats, err
+			}
+		}
+		logger.Info("Scanned %d documents of %s: %d misrouted, %d repaired", stats.Scanned, index, stats.Misrouted, stats.Repaired)
+		searchAfter = hits[len(hits)-1].Sort
+	}
+	return stats, nil
+}
+
+// searchRouting runs a routing check query on index, or on the query's point
+// in time if index is empty, and returns the response status
+func searchRouting(ctx context.Context, client *elasticsearch.Client, index string, query map[string]interface{}, logger *IngestLogger) (routingSearchResponse, int, error) {
+	var response routingSearchResponse
+	body, err := json.Marshal(query)
+	if err != nil {
+		return response, 0, fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	opts := []func(*esapi.SearchRequest){
+		client.Search.WithContext(ctx),
+		client.Search.WithBody(bytes.NewReader(body)),
+	}
+	if index != "" {
+		opts = append(opts, client.Search.WithIndex(index))
+	}
+	start := time.Now()
+	res, err := client.Search(opts...)
+	logger.Metric("es.routing_search.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return response, 0, fmt.Errorf("routing search failed: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.IsError() {
+		return response, res.StatusCode, fmt.Errorf("routing search returned error: %s", res.String())
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return response, res.StatusCode, fmt.Errorf("failed to parse routing search response: %w", err)
+	}
+	return response, res.StatusCode, nil
+}
+
+// misroutedDoc is a fetched misrouted document, with the routing it was
+// scanned with and the routing it should have
+type misroutedDoc struct {
+	Index       string          `json:"_index"`
+	ID          string          `json:"_id"`
+	Found       bool            `json:"found"`
+	SeqNo       *int64          `json:"_seq_no"`
+	PrimaryTerm *int64          `json:"_primary_term"`
+	Source      json.RawMessage `json:"_source"`
+	Routing     string          `json:"-"`
+	AuthorDID   string          `json:"-"`
+}
+
+// repairRoutingBatch repairs a page of misrouted documents (see
+// RepairRouting), adding the outcomes to stats. It returns an error only if
+// a request fails outright.
+func repairRoutingBatch(ctx context.Context, client *elasticsearch.Client, hits []routingHit, stats *RoutingRepairStats, logger *IngestLogger) error {
+	docs, err := fetchMisrouted(ctx, client, hits, logger)
+	if err != nil {
+		return err
+	}
+
+	var found []misroutedDoc
+	for _, doc := range docs {
+		if !doc.Found {
+			stats.Changed++
+			continue
+		}
+		found = append(found, doc)
+	}
+	if len(found) == 0 {
+		return nil
+	}
+
+	deleted, err := deleteMisrouted(ctx, client, found, stats, logger)
+	if err != nil {
+		return err
+	}
+	if len(deleted) == 0 {
+		return nil
+	}
+
+	letters := make([]DeadLetter, 0, len(deleted))
+	for _, doc := range deleted {
+		letters = append(letters, DeadLetter{Index: doc.Index, ID: doc.ID, Routing: doc.AuthorDID, Source: doc.Source})
+	}
+	err = submitBulkIndex(ctx, client, letters, "es.bulk_index_routing_repair", "routing repair", logger)
+	if err == nil {
+		stats.Repaired += len(letters)
+		return nil
+	}
+	if result, ok := AsBulkResult(err); ok {
+		stats.Repaired += result.Processed
+		stats.Failed += result.Failed
+		return nil
+	}
+	// The old copies are gone; keep the documents for dlq_replay
+	logger.deadLetter(ctx, withBulkError(letters, err))
+	stats.Failed += len(letters)
+	return err
+}
+
+// fetchMisrouted fetches the source, _seq_no, and _primary_term of each
+// misrouted document with its current routing
+func fetchMisrouted(ctx context.Context, client *elasticsearch.Client, hits []routingHit, logger *IngestLogger) ([]misroutedDoc, error) {
+	refs := make([]map[string]interface{}, 0, len(hits))
+	for _, hit := range hits {
+		ref := map[string]interface{}{"_index": hit.Index, "_id": hit.ID}
+		if hit.Routing != "" {
+			ref["routing"] = hit.Routing
+		}
+		refs = append(refs, ref)
+	}
+	body, err := json.Marshal(map[string]interface{}{"docs": refs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal mget request: %w", err)
+	}
+
+	start := time.Now()
+	res, err := client.Mget(
+		bytes.NewReader(body),
+		client.Mget.WithContext(ctx),
+	)
+	logger.Metric("es.routing_repair_get.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("mget request failed: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.IsError() {
+		return nil, fmt.Errorf("mget request returned error: %s", res.String())
+	}
+
+	var response struct {
+		Docs []misroutedDoc `json:"docs"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse mget response: %w", err)
+	}
+	if len(response.Docs) != len(hits) {
+		return nil, fmt.Errorf("mget returned %d documents for %d requested", len(response.Docs), len(hits))
+	}
+	for i, hit := range hits {
+		response.Docs[i].Routing = hit.Routing
+		response.Docs[i].AuthorDID = hit.Source.AuthorDID
+	}
+	return response.Docs, nil
+}
+
+// deleteMisrouted deletes each document with its old routing, if it is
+// unchanged since it was fetched, and returns those deleted
+func deleteMisrouted(ctx context.Context, client *elasticsearch.Client, docs []misroutedDoc, stats *RoutingRepairStats, logger *IngestLogger) ([]misroutedDoc, error) {
+	var buf bytes.Buffer
+	for _, doc := range docs {
+		meta := map[string]interface{}{"_index": doc.Index, "_id": doc.ID}
+		if doc.Routing != "" {
+			meta["routing"] = doc.Routing
+		}
+		if doc.SeqNo != nil && doc.PrimaryTerm != nil {
+			meta["if_seq_no"] = *doc.SeqNo
+			meta["if_primary_term"] = *doc.PrimaryTerm
+		}
+		line, err := json.Marshal(map[string]interface{}{"delete": meta})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal delete metadata: %w", err)
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+
+	start := time.Now()
+	res, err := client.Bulk(
+		bytes.NewReader(buf.Bytes()),
+		client.Bulk.WithContext(ctx),
+	)
+	logger.Metric("es.routing_repair_delete.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("bulk delete request failed: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.IsError() {
+		return nil, fmt.Errorf("bulk delete request returned error: %s", res.String())
+	}
+
+	var response struct {
+		Items []map[string]bulkItemResult `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse bulk delete response: %w", err)
+	}
+
+	var deleted []misroutedDoc
+	var failures []string
+	for i, doc := range docs {
+		var outcome bulkItemResult
+		if i < len(response.Items) {
+			for _, r := range response.Items[i] {
+				outcome = r
+			}
+		}
+		switch {
+		case outcome.Error == nil && outcome.Status < 300:
+			deleted = append(deleted, doc)
+		case outcome.Status == http.StatusNotFound || outcome.Status == http.StatusConflict:
+			stats.Changed++
+		default:
+			stats.Failed++
+			reason := "no item in response"
+			if outcome.Error != nil {
+				reason = outcome.Error.Type + ": " + outcome.Error.Reason
+			}
+			failures = append(failures, fmt.Sprintf("%s (%d %s)", doc.ID, outcome.Status, reason))
+		}
+	}
+	if len(failures) > 0 {
+		logger.Error("Failed to delete %d misrouted documents, left in place: %s", len(failures), strings.Join(failures, "; "))
+	}
+	return deleted, nil
+}
@@ -0,0 +1,155 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+// routingTestHits are the documents of a routing scan: one routed correctly,
+// two misrouted, one without an author_did, and one misrouted but deleted
+// before it is fetched
+var routingTestHits = []string{
+	`{"_index":"posts-000001","_id":"at://a","_routing":"did:plc:a","_source":{"author_did":"did:plc:a"}}`,
+	`{"_index":"posts-000001","_id":"at://b","_source":{"author_did":"did:plc:b"}}`,
+	`{"_index":"posts-000001","_id":"at://c","_routing":"did:plc:x","_source":{"author_did":"did:plc:c"}}`,
+	`{"_index":"posts-000001","_id":"at://d","_source":{}}`,
+	`{"_index":"posts-000001","_id":"at://e","_source":{"author_did":"did:plc:e"}}`,
+}
+
+// newRoutingTestServer serves routingTestHits through a point in time, two
+// per page, and the documents they name that still exist
+func newRoutingTestServer(t *testing.T) (*estest.Server, *bool) {
+	t.Helper()
+	es := estest.New(t)
+	for _, id := range []string{"at://a", "at://b", "at://c", "at://d"} {
+		es.Put("posts-000001", id, map[string]interface{}{"at_uri": id, "author_did": "did:plc:" + id[len(id)-1:]})
+	}
+
+	pitClosed := false
+	es.Handle("pit", func(call estest.Call) *estest.Response {
+		if call.Method == http.MethodDelete {
+			pitClosed = true
+			return &estest.Response{Status: http.StatusOK, Body: `{"succeeded":true}`}
+		}
+		return &estest.Response{Status: http.StatusOK, Body: `{"id":"pit-1"}`}
+	})
+	es.Handle(estest.APISearch, func(call estest.Call) *estest.Response {
+		var query struct {
+			SearchAfter []int `json:"search_after"`
+		}
+		if err := json.Unmarshal(call.Body, &query); err != nil {
+			t.Errorf("bad search body: %v", err)
+		}
+		start := 0
+		if len(query.SearchAfter) == 1 {
+			start = query.SearchAfter[0] + 1
+		}
+		var hits []string
+		for i := start; i < len(routingTestHits) && i < start+2; i++ {
+			hits = append(hits, strings.TrimSuffix(routingTestHits[i], "}")+fmt.Sprintf(`,"sort":[%d]}`, i))
+		}
+		return &estest.Response{Status: http.StatusOK, Body: `{"pit_id":"pit-1","hits":{"hits":[` + strings.Join(hits, ",") + `]}}`}
+	})
+	return es, &pitClosed
+}
+
+func TestRepairRouting(t *testing.T) {
+	es, pitClosed := newRoutingTestServer(t)
+
+	stats, err := RepairRouting(context.Background(), es.Client, "posts", RoutingRepairConfig{BatchSize: 2}, NewLogger(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := RoutingRepairStats{Scanned: 5, Unroutable: 1, Misrouted: 3, Repaired: 2, Changed: 1}
+	if stats != want {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+	if !*pitClosed {
+		t.Error("expected the point in time to be closed")
+	}
+
+	// Each old copy is deleted with its old routing before its routed copy is indexed
+	var items []string
+	for _, call := range es.Calls(estest.APIBulk) {
+		for _, item := range call.BulkItems() {
+			items = append(items, fmt.Sprintf("%s %s %q", item.Action, item.ID, item.Routing))
+		}
+	}
+	wantItems := []string{
+		`delete at://b ""`, `index at://b "did:plc:b"`,
+		`delete at://c "did:plc:x"`, `index at://c "did:plc:c"`,
+	}
+	if strings.Join(items, "; ") != strings.Join(wantItems, "; ") {
+		t.Errorf("got bulk items %v, want %v", items, wantItems)
+	}
+	if doc, ok := es.Get("posts-000001", "at://c"); !ok || doc["author_did"] != "did:plc:c" {
+		t.Errorf("expected at://c reindexed with its source, got %v", doc)
+	}
+}
+
+func TestRepairRouting_DryRun(t *testing.T) {
+	es, _ := newRoutingTestServer(t)
+
+	stats, err := RepairRouting(context.Background(), es.Client, "posts", RoutingRepairConfig{BatchSize: 2, DryRun: true}, NewLogger(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Scanned != 5 || stats.Misrouted != 3 || stats.Repaired != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if len(es.Calls(estest.APIMget)) != 0 || len(es.Calls(estest.APIBulk)) != 0 {
+		t.Error("expected a dry run to fetch and write nothing")
+	}
+}
+
+func TestRepairRouting_DeleteFailureSkipsReindex(t *testing.T) {
+	es, _ := newRoutingTestServer(t)
+	es.FailItems(func(item estest.BulkItem) *estest.ItemFailure {
+		if item.Action == "delete" && item.ID == "at://b" {
+			return &estest.ItemFailure{Status: http.StatusConflict, Type: "version_conflict_engine_exception", Reason: "changed"}
+		}
+		if item.Action == "delete" && item.ID == "at://c" {
+			return &estest.ItemFailure{Status: http.StatusInternalServerError, Type: "exception", Reason: "boom"}
+		}
+		return nil
+	})
+
+	stats, err := RepairRouting(context.Background(), es.Client, "posts", RoutingRepairConfig{BatchSize: 2}, NewLogger(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Repaired != 0 || stats.Changed != 2 || stats.Failed != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	for _, call := range es.Calls(estest.APIBulk) {
+		for _, item := range call.BulkItems() {
+			if item.Action == "index" {
+				t.Errorf("expected no reindex of a document whose old copy was not deleted, got %s", item.ID)
+			}
+		}
+	}
+}
+
+func TestCheckRouting(t *testing.T) {
+	es := estest.New(t)
+	es.Handle(estest.APISearch, func(call estest.Call) *estest.Response {
+		switch call.Index {
+		case "posts":
+			return &estest.Response{Status: http.StatusOK, Body: `{"hits":{"hits":[` + routingTestHits[0] + `,` + routingTestHits[1] + `]}}`}
+		case "likes":
+			return &estest.Response{Status: http.StatusOK, Body: `{"hits":{"hits":[` + routingTestHits[0] + `]}}`}
+		}
+		return &estest.Response{Status: http.StatusNotFound, Body: `{"error":{"type":"index_not_found_exception"},"status":404}`}
+	})
+
+	mixed := CheckRouting(context.Background(), es.Client, []string{"posts", "likes", "follows"}, NewLogger(false))
+	if len(mixed) != 1 || mixed[0] != "posts" {
+		t.Errorf("expected only posts reported mixed, got %v", mixed)
+	}
+}
@@ -0,0 +1,155 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3PartSize is the size of each part of an S3Writer multipart upload. S3
+// requires parts other than the last to be at least 5 MiB.
+const S3PartSize = 16 << 20
+
+// S3UploadAPI is the part of the S3 client S3Writer uses
+type S3UploadAPI interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// S3Writer streams an object to S3. Writes are buffered into parts; an
+// object that outgrows one part is sent as a multipart upload, and a smaller
+// one with a single PutObject on Close. Either way the object only appears
+// once Close succeeds, as with a GCS object writer, and a failed or aborted
+// write leaves neither an object nor orphaned parts behind.
+type S3Writer struct {
+	ctx      context.Context
+	client   S3UploadAPI
+	bucket   string
+	key      string
+	partSize int
+	buf      bytes.Buffer
+	uploadID *string
+	parts    []types.CompletedPart
+	err      error
+}
+
+// NewS3Writer creates a writer for s3://bucket/key
+func NewS3Writer(ctx context.Context, client S3UploadAPI, bucket, key string) *S3Writer {
+	return &S3Writer{
+		ctx:      ctx,
+		client:   client,
+		bucket:   bucket,
+		key:      key,
+		partSize: S3PartSize,
+	}
+}
+
+// Write buffers p, uploading full parts as they fill. After an error, every
+// call returns it and the upload is aborted.
+func (w *S3Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, _ := w.buf.Write(p)
+	for w.buf.Len() >= w.partSize {
+		if err := w.uploadPart(w.buf.Next(w.partSize)); err != nil {
+			w.fail(err)
+			return n, w.err
+		}
+	}
+	return n, nil
+}
+
+// Close uploads what is buffered and completes the object
+func (w *S3Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.uploadID == nil {
+		_, err := w.client.PutObject(w.ctx, &s3.PutObjectInput{
+			Bucket: aws.String(w.bucket),
+			Key:    aws.String(w.key),
+			Body:   bytes.NewReader(w.buf.Bytes()),
+		})
+		if err != nil {
+			w.err = fmt.Errorf("failed to put s3://%s/%s: %w", w.bucket, w.key, err)
+		}
+		return w.err
+	}
+
+	if w.buf.Len() > 0 {
+		if err := w.uploadPart(w.buf.Bytes()); err != nil {
+			w.fail(err)
+			return w.err
+		}
+	}
+	_, err := w.client.CompleteMultipartUpload(w.ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(w.bucket),
+		Key:             aws.String(w.key),
+		UploadId:        w.uploadID,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: w.parts},
+	})
+	if err != nil {
+		w.fail(fmt.Errorf("failed to complete upload of s3://%s/%s: %w", w.bucket, w.key, err))
+	}
+	return w.err
+}
+
+// Abort discards the object. It is safe to call after an error or Close.
+func (w *S3Writer) Abort() {
+	if w.err == nil {
+		w.fail(fmt.Errorf("upload of s3://%s/%s aborted", w.bucket, w.key))
+	}
+}
+
+// uploadPart uploads data as the next part, starting the multipart upload
+// on the first
+func (w *S3Writer) uploadPart(data []byte) error {
+	if w.uploadID == nil {
+		created, err := w.client.CreateMultipartUpload(w.ctx, &s3.CreateMultipartUploadInput{
+			Bucket: aws.String(w.bucket),
+			Key:    aws.String(w.key),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to start upload of s3://%s/%s: %w", w.bucket, w.key, err)
+		}
+		w.uploadID = created.UploadId
+	}
+
+	partNumber := aws.Int32(int32(len(w.parts) + 1)) // nolint:gosec // G115: S3 allows at most 10,000 parts
+	uploaded, err := w.client.UploadPart(w.ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(w.bucket),
+		Key:        aws.String(w.key),
+		UploadId:   w.uploadID,
+		PartNumber: partNumber,
+		Body:       bytes.NewReader(data),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload part %d of s3://%s/%s: %w", *partNumber, w.bucket, w.key, err)
+	}
+	w.parts = append(w.parts, types.CompletedPart{ETag: uploaded.ETag, PartNumber: partNumber})
+	return nil
+}
+
+// fail records err and aborts the multipart upload, if one was started, so
+// its parts are not left behind
+func (w *S3Writer) fail(err error) {
+	w.err = err
+	if w.uploadID == nil {
+		return
+	}
+	// The upload's context may be what failed, so abort outside it
+	_, _ = w.client.AbortMultipartUpload(context.WithoutCancel(w.ctx), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(w.bucket),
+		Key:      aws.String(w.key),
+		UploadId: w.uploadID,
+	})
+	w.uploadID = nil
+}
@@ -0,0 +1,156 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// fakeS3 records uploads in memory; an object appears in objects only once
+// its upload completes
+type fakeS3 struct {
+	mu         sync.Mutex
+	objects    map[string][]byte
+	uploads    map[string][][]byte
+	aborted    int
+	failPartAt int32
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string][]byte{}, uploads: map[string][][]byte{}}
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, _ := io.ReadAll(params.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.objects[*params.Key] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := *params.Key + "-upload"
+	f.uploads[id] = nil
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String(id)}, nil
+}
+
+func (f *fakeS3) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	if *params.PartNumber == f.failPartAt {
+		return nil, errors.New("connection reset")
+	}
+	data, _ := io.ReadAll(params.Body)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.uploads[*params.UploadId] = append(f.uploads[*params.UploadId], data)
+	return &s3.UploadPartOutput{ETag: aws.String("etag")}, nil
+}
+
+func (f *fakeS3) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	parts := f.uploads[*params.UploadId]
+	if len(parts) != len(params.MultipartUpload.Parts) {
+		return nil, errors.New("part count mismatch")
+	}
+	f.objects[*params.Key] = bytes.Join(parts, nil)
+	delete(f.uploads, *params.UploadId)
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (f *fakeS3) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.uploads, *params.UploadId)
+	f.aborted++
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func TestS3Writer_SmallObjectUsesPutObject(t *testing.T) {
+	fake := newFakeS3()
+	w := NewS3Writer(context.Background(), fake, "bucket", "exports/small.parquet")
+
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.objects["exports/small.parquet"]; ok {
+		t.Fatal("object visible before Close")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(fake.objects["exports/small.parquet"]); got != "hello" {
+		t.Errorf("expected hello, got %q", got)
+	}
+	if len(fake.uploads) != 0 {
+		t.Errorf("expected no multipart upload, got %d", len(fake.uploads))
+	}
+}
+
+func TestS3Writer_LargeObjectUsesMultipartUpload(t *testing.T) {
+	fake := newFakeS3()
+	w := NewS3Writer(context.Background(), fake, "bucket", "large.parquet")
+	w.partSize = 4
+
+	for _, chunk := range []string{"abc", "defgh", "ij"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := fake.objects["large.parquet"]; ok {
+		t.Fatal("object visible before Close")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(fake.objects["large.parquet"]); got != "abcdefghij" {
+		t.Errorf("expected abcdefghij, got %q", got)
+	}
+	if len(w.parts) != 3 {
+		t.Errorf("expected 3 parts, got %d", len(w.parts))
+	}
+}
+
+func TestS3Writer_FailedPartAbortsUpload(t *testing.T) {
+	fake := newFakeS3()
+	fake.failPartAt = 2
+	w := NewS3Writer(context.Background(), fake, "bucket", "failed.parquet")
+	w.partSize = 4
+
+	if _, err := w.Write([]byte("abcdefgh")); err == nil {
+		t.Fatal("expected the second part to fail")
+	}
+	if err := w.Close(); err == nil {
+		t.Fatal("expected Close to return the part error")
+	}
+	if _, ok := fake.objects["failed.parquet"]; ok {
+		t.Error("failed upload left an object")
+	}
+	if fake.aborted != 1 || len(fake.uploads) != 0 {
+		t.Errorf("expected the upload aborted, got %d aborts and %d open uploads", fake.aborted, len(fake.uploads))
+	}
+}
+
+func TestS3Writer_Abort(t *testing.T) {
+	fake := newFakeS3()
+	w := NewS3Writer(context.Background(), fake, "bucket", "aborted.parquet")
+	w.partSize = 4
+
+	if _, err := w.Write([]byte("abcdef")); err != nil {
+		t.Fatal(err)
+	}
+	w.Abort()
+	if err := w.Close(); err == nil {
+		t.Error("expected Close after Abort to fail")
+	}
+	if _, ok := fake.objects["aborted.parquet"]; ok || fake.aborted != 1 {
+		t.Errorf("expected the upload discarded, got %d aborts", fake.aborted)
+	}
+}
@@ -6,12 +6,25 @@ var ingestSampleDenominator uint32 = 10
 
 // ShouldSampleDID returns true if the DID should be ingested. In the stage
 // environment, only ~10% of DIDs (by FNV-32a bucket) are retained to reduce
-// cluster costs. In all other environments every DID is kept.
+// cluster costs. In all other environments, and for CanaryDID, every DID is
+// kept.
 func ShouldSampleDID(did, environment string) bool {
-	if environment != "stage" {
+	if environment != "stage" || IsCanaryDID(did) {
 		return true
 	}
 	h := fnv.New32a()
 	_, _ = h.Write([]byte(did))
 	return h.Sum32()%ingestSampleDenominator == 0
 }
+
+// SampleDIDPercent returns true if the DID falls in a deterministic sample of
+// percent% of all DIDs (by FNV-32a bucket out of 10000). The sample does not
+// line up with ShouldSampleDID's; at 10% the two select different DIDs.
+func SampleDIDPercent(did string, percent float64) bool {
+	if percent >= 100 {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(did))
+	return float64(h.Sum32()%10000) < percent*100
+}
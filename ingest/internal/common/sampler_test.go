@@ -46,3 +46,27 @@ func TestShouldSampleDID_NonStagePassthrough(t *testing.T) {
 		}
 	}
 }
+
+func TestSampleDIDPercent(t *testing.T) {
+	total := 10000
+	sampled := 0
+	for i := 0; i < total; i++ {
+		did := fmt.Sprintf("did:plc:user%d", i)
+		if SampleDIDPercent(did, 5) {
+			sampled++
+		}
+		if SampleDIDPercent(did, 5) && !SampleDIDPercent(did, 20) {
+			t.Fatalf("%s is in the 5%% sample but not the 20%% sample", did)
+		}
+	}
+	pct := float64(sampled) / float64(total) * 100
+	if pct < 3 || pct > 7 {
+		t.Fatalf("expected ~5%% sample rate, got %.1f%%", pct)
+	}
+	if SampleDIDPercent("did:plc:abc123xyz", 0) {
+		t.Fatalf("expected no DIDs at 0%%")
+	}
+	if !SampleDIDPercent("did:plc:abc123xyz", 100) {
+		t.Fatalf("expected every DID at 100%%")
+	}
+}
@@ -0,0 +1,70 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+)
+
+// selfTestRecord is the row CompressionSelfTest round-trips
+type selfTestRecord struct {
+	AtURI     string  `parquet:"at_uri"`
+	Content   string  `parquet:"content"`
+	LikeCount int64   `parquet:"like_count"`
+	Score     float64 `parquet:"score"`
+}
+
+// selfTestCodecs are the parquet codecs CompressionSelfTest checks
+var selfTestCodecs = []struct {
+	name  string
+	codec compress.Codec
+}{
+	{"uncompressed", &parquet.Uncompressed},
+	{"snappy", &parquet.Snappy},
+	{"gzip", &parquet.Gzip},
+	{"zstd", &parquet.Zstd},
+}
+
+// CompressionSelfTest writes and reads back a parquet file with each codec
+// consumers may see, so a platform whose compression paths (such as the zstd
+// assembly, see ZstdImplementation) misbehave is caught before it writes
+// exports. Rows are repetitive enough to compress and include multi-byte text.
+func CompressionSelfTest() error {
+	rows := make([]selfTestRecord, 1000)
+	for i := range rows {
+		rows[i] = selfTestRecord{
+			AtURI:     fmt.Sprintf("at://did:plc:selftest/app.bsky.feed.post/%d", i),
+			Content:   strings.Repeat("green earth 🌍 ", i%50),
+			LikeCount: int64(i * 7),
+			Score:     float64(i) / 3,
+		}
+	}
+
+	for _, c := range selfTestCodecs {
+		var buf bytes.Buffer
+		writer := parquet.NewGenericWriter[selfTestRecord](&buf, parquet.Compression(c.codec))
+		if _, err := writer.Write(rows); err != nil {
+			return fmt.Errorf("%s: failed to write parquet data: %w", c.name, err)
+		}
+		if err := writer.Close(); err != nil {
+			return fmt.Errorf("%s: failed to close parquet writer: %w", c.name, err)
+		}
+
+		read, err := parquet.Read[selfTestRecord](bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			return fmt.Errorf("%s: failed to read parquet data: %w", c.name, err)
+		}
+		if len(read) != len(rows) {
+			return fmt.Errorf("%s: read %d rows, wrote %d", c.name, len(read), len(rows))
+		}
+		for i := range rows {
+			if read[i] != rows[i] {
+				return fmt.Errorf("%s: row %d read back differs from what was written", c.name, i)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+package common
+
+import "testing"
+
+func TestCompressionSelfTest(t *testing.T) {
+	if err := CompressionSelfTest(); err != nil {
+		t.Fatalf("compression self-test failed with %s zstd: %v", ZstdImplementation, err)
+	}
+}
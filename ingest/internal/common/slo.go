@@ -0,0 +1,414 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// SLO names reported by SLOTracker
+const (
+	SLOFreshness    = "freshness"
+	SLOCompleteness = "completeness"
+	SLOAvailability = "availability"
+)
+
+// SLOConfig defines the ingest service level objectives. Objectives are
+// fractions, e.g. 0.99.
+type SLOConfig struct {
+	Window                time.Duration // Rolling window for compliance and error budgets
+	FreshnessTarget       time.Duration // A minute is fresh when its worst freshness_sec is within this
+	FreshnessObjective    float64       // Fraction of measured minutes that must be fresh
+	CompletenessObjective float64       // Fraction of submitted documents Elasticsearch must accept
+	AvailabilityObjective float64       // Fraction of minutes in which at least one batch is written
+	StateFile             string        // Local path or gs://bucket/object; empty keeps history in memory
+}
+
+// SLOConfigFromConfig returns the SLO configuration in config
+func SLOConfigFromConfig(config *Config) SLOConfig {
+	return SLOConfig{
+		Window:                config.SLOWindow,
+		FreshnessTarget:       config.SLOFreshnessTarget,
+		FreshnessObjective:    config.SLOFreshnessObjective,
+		CompletenessObjective: config.SLOCompletenessObjective,
+		AvailabilityObjective: config.SLOAvailabilityObjective,
+		StateFile:             config.SLOStateFile,
+	}
+}
+
+// SLOStatus is one objective's compliance over a report's range
+type SLOStatus struct {
+	Name                 string  `json:"name"`
+	Objective            float64 `json:"objective"`
+	Good                 float64 `json:"good"`
+	Total                float64 `json:"total"`
+	Compliance           float64 `json:"compliance"`
+	ErrorBudgetRemaining float64 `json:"error_budget_remaining"` // 1 is untouched, 0 exhausted, negative overspent
+	Met                  bool    `json:"met"`
+}
+
+// SLOReport is the compliance of every objective between From and To
+type SLOReport struct {
+	Service string      `json:"service"`
+	From    time.Time   `json:"from"`
+	To      time.Time   `json:"to"`
+	SLOs    []SLOStatus `json:"slos"`
+}
+
+// sloMinute aggregates the metrics an SLO is computed from over one minute
+type sloMinute struct {
+	Minute       int64   `json:"minute"` // Unix time / 60
+	Batches      int     `json:"batches"`
+	MaxFreshness float64 `json:"max_freshness_sec"`
+	Items        float64 `json:"items"`
+	FailedItems  float64 `json:"failed_items"`
+}
+
+// sloState is what SLOTracker persists so compliance survives restarts
+type sloState struct {
+	Since       int64       `json:"since"`        // First minute tracked
+	LastSummary time.Time   `json:"last_summary"` // Start of the last week summarized
+	Minutes     []sloMinute `json:"minutes"`
+}
+
+// SLOTracker computes SLO compliance from the metrics a service already
+// emits: freshness_sec for freshness and availability, es.bulk_items_count
+// and dlq.failed_items_count for completeness. It sits between the logger
+// and its metric collector, forwarding every metric unchanged.
+type SLOTracker struct {
+	service string
+	config  SLOConfig
+	logger  *IngestLogger
+	next    MetricCollector
+	now     func() time.Time
+
+	mu    sync.Mutex
+	state sloState
+	byMin map[int64]*sloMinute
+
+	gcs       *storage.Client
+	gcsBucket string
+	gcsObject string
+}
+
+// NewSLOTracker creates a tracker for service, loading history from the
+// configured state file
+func NewSLOTracker(ctx context.Context, service string, config SLOConfig, logger *IngestLogger) (*SLOTracker, error) {
+	t := &SLOTracker{
+		service: service,
+		config:  config,
+		logger:  logger,
+		now:     time.Now,
+		byMin:   make(map[int64]*sloMinute),
+	}
+	if strings.HasPrefix(config.StateFile, "gs://") {
+		parts := strings.SplitN(strings.TrimPrefix(config.StateFile, "gs://"), "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid GCS path format: %s (expected gs://bucket/object)", config.StateFile)
+		}
+		client, err := storage.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GCS client: %w", err)
+		}
+		t.gcs, t.gcsBucket, t.gcsObject = client, parts[0], parts[1]
+	}
+	if err := t.load(ctx); err != nil {
+		return nil, err
+	}
+	if t.state.Since == 0 {
+		t.state.Since = t.now().Unix() / 60
+	}
+	return t, nil
+}
+
+// Attach makes the tracker logger's metric collector, forwarding to the
+// collector logger already had
+func (t *SLOTracker) Attach(logger *IngestLogger) {
+	t.next = logger.metricCollector
+	logger.SetMetricCollector(t)
+}
+
+// Record observes the metrics SLOs are computed from and forwards every
+// metric to the next collector
+func (t *SLOTracker) Record(name string, value float64) {
+	if t.next != nil {
+		t.next.Record(name, value)
+	}
+	if name != "freshness_sec" && name != "es.bulk_items_count" && name != "dlq.failed_items_count" {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	minute := t.minute(t.now().Unix() / 60)
+	switch name {
+	case "freshness_sec":
+		minute.Batches++
+		if value > minute.MaxFreshness {
+			minute.MaxFreshness = value
+		}
+	case "es.bulk_items_count":
+		minute.Items += value
+	case "dlq.failed_items_count":
+		minute.FailedItems += value
+	}
+}
+
+// minute returns the aggregate for minute m, creating it. Callers hold mu.
+func (t *SLOTracker) minute(m int64) *sloMinute {
+	if existing, ok := t.byMin[m]; ok {
+		return existing
+	}
+	created := &sloMinute{Minute: m}
+	t.byMin[m] = created
+	return created
+}
+
+// Report computes compliance over the complete minutes between from and to
+func (t *SLOTracker) Report(from, to time.Time) SLOReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	first, last := from.Unix()/60, to.Unix()/60 // [first, last)
+	if first < t.state.Since {
+		first = t.state.Since
+	}
+
+	var freshGood, freshTotal, items, failed, activeMinutes float64
+	for m, minute := range t.byMin {
+		if m < first || m >= last {
+			continue
+		}
+		if minute.Batches > 0 {
+			activeMinutes++
+			freshTotal++
+			if minute.MaxFreshness <= t.config.FreshnessTarget.Seconds() {
+				freshGood++
+			}
+		}
+		items += minute.Items
+		failed += minute.FailedItems
+	}
+	trackedMinutes := float64(0)
+	if last > first {
+		trackedMinutes = float64(last - first)
+	}
+
+	return SLOReport{
+		Service: t.service,
+		From:    from.UTC(),
+		To:      to.UTC(),
+		SLOs: []SLOStatus{
+			newSLOStatus(SLOFreshness, t.config.FreshnessObjective, freshGood, freshTotal),
+			newSLOStatus(SLOCompleteness, t.config.CompletenessObjective, items-failed, items),
+			newSLOStatus(SLOAvailability, t.config.AvailabilityObjective, activeMinutes, trackedMinutes),
+		},
+	}
+}
+
+func newSLOStatus(name string, objective, good, total float64) SLOStatus {
+	status := SLOStatus{Name: name, Objective: objective, Good: good, Total: total, Compliance: 1, ErrorBudgetRemaining: 1}
+	if total > 0 {
+		status.Compliance = good / total
+	}
+	allowed := (1 - objective) * total
+	spent := total - good
+	switch {
+	case allowed > 0:
+		status.ErrorBudgetRemaining = 1 - spent/allowed
+	case spent > 0:
+		status.ErrorBudgetRemaining = 0
+	}
+	status.Met = status.Compliance >= objective
+	return status
+}
+
+// ServeHTTP serves the current window's report as JSON, or the last complete
+// week's with ?period=week
+func (t *SLOTracker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	now := t.now()
+	report := t.Report(now.Add(-t.config.Window), now)
+	if r.URL.Query().Get("period") == "week" {
+		weekStart := startOfWeek(now)
+		report = t.Report(weekStart.AddDate(0, 0, -7), weekStart)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		t.logger.Error("Failed to encode SLO report: %v", err)
+	}
+}
+
+// Run emits compliance and error budget gauges every interval, saves state,
+// and logs a summary of each week once it completes. It returns when ctx is
+// done; at most one interval of history is lost on shutdown.
+func (t *SLOTracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		t.tick(ctx)
+	}
+}
+
+// tick is one iteration of Run
+func (t *SLOTracker) tick(ctx context.Context) {
+	now := t.now()
+	report := t.Report(now.Add(-t.config.Window), now)
+	if t.next != nil {
+		for _, slo := range report.SLOs {
+			t.next.Record("slo."+slo.Name+".compliance_rate", slo.Compliance)
+			t.next.Record("slo."+slo.Name+".error_budget_remaining_rate", slo.ErrorBudgetRemaining)
+		}
+	}
+
+	weekStart := startOfWeek(now)
+	t.mu.Lock()
+	summarize := t.state.LastSummary.Before(weekStart) && t.state.Since < weekStart.Unix()/60
+	if summarize {
+		t.state.LastSummary = weekStart
+	}
+	t.prune(now)
+	t.mu.Unlock()
+
+	if summarize {
+		t.logWeeklySummary(t.Report(weekStart.AddDate(0, 0, -7), weekStart))
+	}
+	if err := t.save(ctx); err != nil {
+		t.logger.Error("Failed to save SLO state: %v", err)
+	}
+}
+
+// logWeeklySummary logs one line per objective, as errors when missed
+func (t *SLOTracker) logWeeklySummary(report SLOReport) {
+	t.logger.Info("SLO summary for %s, week of %s", report.Service, report.From.Format("2006-01-02"))
+	for _, slo := range report.SLOs {
+		line := fmt.Sprintf("SLO %s: %.4f%% (objective %.4f%%, %.0f/%.0f good), %.1f%% of error budget remaining",
+			slo.Name, slo.Compliance*100, slo.Objective*100, slo.Good, slo.Total, slo.ErrorBudgetRemaining*100)
+		if slo.Met {
+			t.logger.Info("%s", line)
+		} else {
+			t.logger.Error("%s", line)
+		}
+	}
+}
+
+// prune drops minutes no longer needed by the window or the weekly summary.
+// Callers hold mu.
+func (t *SLOTracker) prune(now time.Time) {
+	retain := t.config.Window
+	if retain < 8*24*time.Hour {
+		retain = 8 * 24 * time.Hour
+	}
+	oldest := now.Add(-retain).Unix() / 60
+	for m := range t.byMin {
+		if m < oldest {
+			delete(t.byMin, m)
+		}
+	}
+	if t.state.Since < oldest {
+		t.state.Since = oldest
+	}
+}
+
+// startOfWeek returns the Monday 00:00 UTC on or before now
+func startOfWeek(now time.Time) time.Time {
+	day := now.UTC().Truncate(24 * time.Hour)
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+// load reads saved history, if any
+func (t *SLOTracker) load(ctx context.Context) error {
+	if t.config.StateFile == "" {
+		return nil
+	}
+	var data []byte
+	var err error
+	if t.gcs != nil {
+		var reader *storage.Reader
+		reader, err = t.gcs.Bucket(t.gcsBucket).Object(t.gcsObject).NewReader(ctx)
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return nil
+		}
+		if err == nil {
+			defer func() { _ = reader.Close() }() // Best-effort close for read operation
+			data, err = io.ReadAll(reader)
+		}
+	} else {
+		data, err = os.ReadFile(t.config.StateFile)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read SLO state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &t.state); err != nil {
+		return fmt.Errorf("failed to parse SLO state: %w", err)
+	}
+	for i := range t.state.Minutes {
+		minute := t.state.Minutes[i]
+		t.byMin[minute.Minute] = &minute
+	}
+	t.state.Minutes = nil
+	return nil
+}
+
+// save writes history to the state file, if configured
+func (t *SLOTracker) save(ctx context.Context) error {
+	if t.config.StateFile == "" {
+		return nil
+	}
+	t.mu.Lock()
+	state := t.state
+	state.Minutes = make([]sloMinute, 0, len(t.byMin))
+	for _, minute := range t.byMin {
+		state.Minutes = append(state.Minutes, *minute)
+	}
+	t.mu.Unlock()
+	sort.Slice(state.Minutes, func(i, j int) bool { return state.Minutes[i].Minute < state.Minutes[j].Minute })
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal SLO state: %w", err)
+	}
+	if t.gcs == nil {
+		if err := os.WriteFile(t.config.StateFile, data, 0600); err != nil {
+			return fmt.Errorf("failed to write SLO state: %w", err)
+		}
+		return nil
+	}
+	writer := t.gcs.Bucket(t.gcsBucket).Object(t.gcsObject).NewWriter(ctx)
+	writer.ContentType = "application/json"
+	if _, err := writer.Write(data); err != nil {
+		_ = writer.Close()
+		return fmt.Errorf("failed to write SLO state to GCS: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to finalize SLO state in GCS: %w", err)
+	}
+	return nil
+}
+
+// Close releases the tracker's GCS client
+func (t *SLOTracker) Close() error {
+	if t.gcs == nil {
+		return nil
+	}
+	return t.gcs.Close()
+}
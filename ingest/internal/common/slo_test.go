@@ -0,0 +1,151 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestSLOTracker(t *testing.T, config SLOConfig, now *time.Time) *SLOTracker {
+	t.Helper()
+	tracker, err := NewSLOTracker(context.Background(), "test", config, NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker.now = func() time.Time { return *now }
+	tracker.state.Since = now.Unix() / 60
+	return tracker
+}
+
+func findSLO(t *testing.T, report SLOReport, name string) SLOStatus {
+	t.Helper()
+	for _, slo := range report.SLOs {
+		if slo.Name == name {
+			return slo
+		}
+	}
+	t.Fatalf("no %s SLO in %+v", name, report)
+	return SLOStatus{}
+}
+
+func TestSLOTracker_Report(t *testing.T) {
+	start := time.Date(2026, 3, 11, 10, 0, 0, 0, time.UTC)
+	now := start
+	tracker := newTestSLOTracker(t, SLOConfig{
+		Window:                time.Hour,
+		FreshnessTarget:       2 * time.Minute,
+		FreshnessObjective:    0.9,
+		CompletenessObjective: 0.99,
+		AvailabilityObjective: 0.5,
+	}, &now)
+
+	// Minute 0: fresh, 1000 documents with 5 rejected
+	tracker.Record("freshness_sec", 30)
+	tracker.Record("freshness_sec", 90)
+	tracker.Record("es.bulk_items_count", 1000)
+	tracker.Record("dlq.failed_items_count", 5)
+	// Minute 1: stale
+	now = start.Add(time.Minute)
+	tracker.Record("freshness_sec", 30)
+	tracker.Record("freshness_sec", 600)
+	// Minutes 2 and 3: nothing written. Minute 4 is in progress and excluded.
+	now = start.Add(4*time.Minute + 30*time.Second)
+	tracker.Record("freshness_sec", 1)
+
+	report := tracker.Report(now.Add(-time.Hour), now)
+
+	freshness := findSLO(t, report, SLOFreshness)
+	if freshness.Good != 1 || freshness.Total != 2 || freshness.Met {
+		t.Errorf("unexpected freshness %+v", freshness)
+	}
+	// 1 bad minute against an allowance of 0.2
+	if math.Abs(freshness.ErrorBudgetRemaining-(-4)) > 1e-9 {
+		t.Errorf("expected freshness budget -4, got %v", freshness.ErrorBudgetRemaining)
+	}
+
+	completeness := findSLO(t, report, SLOCompleteness)
+	if completeness.Good != 995 || completeness.Total != 1000 || !completeness.Met {
+		t.Errorf("unexpected completeness %+v", completeness)
+	}
+	if math.Abs(completeness.ErrorBudgetRemaining-0.5) > 1e-9 {
+		t.Errorf("expected half the completeness budget left, got %v", completeness.ErrorBudgetRemaining)
+	}
+
+	availability := findSLO(t, report, SLOAvailability)
+	if availability.Good != 2 || availability.Total != 4 || !availability.Met {
+		t.Errorf("unexpected availability %+v", availability)
+	}
+}
+
+func TestSLOTracker_AttachForwardsMetrics(t *testing.T) {
+	now := time.Date(2026, 3, 11, 10, 0, 0, 0, time.UTC)
+	tracker := newTestSLOTracker(t, SLOConfig{Window: time.Hour}, &now)
+
+	logger := NewLogger(true)
+	mc := newMockMetricCollector()
+	logger.SetMetricCollector(mc)
+	tracker.Attach(logger)
+
+	logger.Metric("freshness_sec", 12)
+	logger.Metric("jetstream.inbound_count", 1)
+	if len(mc.getRecords("freshness_sec")) != 1 || len(mc.getRecords("jetstream.inbound_count")) != 1 {
+		t.Error("expected every metric to reach the original collector")
+	}
+
+	now = now.Add(2 * time.Minute)
+	tracker.tick(context.Background())
+	if rates := mc.getRecords("slo.availability.compliance_rate"); len(rates) != 1 || rates[0] != 0.5 {
+		t.Errorf("unexpected availability compliance gauge %v", rates)
+	}
+}
+
+func TestSLOTracker_StateSurvivesRestart(t *testing.T) {
+	config := SLOConfig{Window: time.Hour, StateFile: filepath.Join(t.TempDir(), "slo.json")}
+	now := time.Date(2026, 3, 11, 10, 0, 0, 0, time.UTC)
+	tracker := newTestSLOTracker(t, config, &now)
+	tracker.Record("es.bulk_items_count", 10)
+	tracker.Record("dlq.failed_items_count", 1)
+	if err := tracker.save(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, err := NewSLOTracker(context.Background(), "test", config, NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restarted.state.Since != tracker.state.Since {
+		t.Errorf("expected tracking to resume from minute %d, got %d", tracker.state.Since, restarted.state.Since)
+	}
+	completeness := findSLO(t, restarted.Report(now, now.Add(time.Minute)), SLOCompleteness)
+	if completeness.Good != 9 || completeness.Total != 10 {
+		t.Errorf("unexpected completeness after restart %+v", completeness)
+	}
+}
+
+func TestSLOTracker_ServeHTTP(t *testing.T) {
+	now := time.Date(2026, 3, 11, 10, 0, 0, 0, time.UTC) // Wednesday
+	tracker := newTestSLOTracker(t, SLOConfig{Window: 24 * time.Hour}, &now)
+
+	for _, tc := range []struct {
+		query string
+		from  time.Time
+	}{
+		{"", now.Add(-24 * time.Hour)},
+		{"?period=week", time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)},
+	} {
+		rec := httptest.NewRecorder()
+		tracker.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/slo"+tc.query, nil))
+		var report SLOReport
+		if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+			t.Fatal(err)
+		}
+		if !report.From.Equal(tc.from) || len(report.SLOs) != 3 {
+			t.Errorf("%q: expected a report from %s, got %+v", tc.query, tc.from, report)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package common
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSpillFull is returned by Spill.Write once the spool holds MaxBytes
+var ErrSpillFull = errors.New("spill spool is full")
+
+// SpillConfig controls a Spill
+type SpillConfig struct {
+	Dir            string        // Local directory for spool files; empty disables spilling
+	AfterFailures  int           // Consecutive failed batches before writes go straight to the spool
+	ReplayInterval time.Duration // How often Elasticsearch is probed while batches are spooled
+	MaxBytes       int           // Spool size beyond which batches are refused; 0 is unlimited
+}
+
+// SpillConfigFromConfig returns the spill configuration in config
+func SpillConfigFromConfig(config *Config) SpillConfig {
+	return SpillConfig{
+		Dir:            config.SpillDir,
+		AfterFailures:  config.SpillAfterFailures,
+		ReplayInterval: config.SpillReplayInterval,
+		MaxBytes:       config.SpillMaxBytes,
+	}
+}
+
+// Spill is a write-ahead spool of batches that could not be written to
+// Elasticsearch. Writers report each batch's outcome with Succeeded or
+// Failed; a batch whose outcome is unknown (the bulk request itself failed)
+// is written to the spool instead of being dropped. After AfterFailures
+// consecutive failures the spill engages: Engaged tells writers to spool
+// batches without trying Elasticsearch, until Run finds it reachable again
+// and replays the spool. Each batch is one NDJSON line, synced to disk
+// before Write returns, so spooled batches survive a restart and are
+// replayed by the next Run.
+type Spill[T any] struct {
+	config SpillConfig
+	name   string
+	logger *IngestLogger
+
+	mu       sync.Mutex
+	failures int
+	engaged  bool
+	file     *os.File // Spool file being written, if any
+	bytes    int      // Bytes across every spool file
+	seq      int
+}
+
+// NewSpill returns the spill for name's batches in config.Dir, or nil if
+// spilling is disabled. Spool files left by an earlier run are kept for Run
+// to replay.
+func NewSpill[T any](config SpillConfig, name string, logger *IngestLogger) (*Spill[T], error) {
+	if config.Dir == "" {
+		return nil, nil
+	}
+	if config.AfterFailures <= 0 {
+		config.AfterFailures = 1
+	}
+	if config.ReplayInterval <= 0 {
+		config.ReplayInterval = 30 * time.Second
+	}
+	if err := os.MkdirAll(config.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+
+	s := &Spill[T]{config: config, name: name, logger: logger}
+	files, err := s.spoolFiles()
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range files {
+		if info, err := os.Stat(path); err == nil {
+			s.bytes += int(info.Size())
+		}
+	}
+	if len(files) > 0 {
+		logger.Info("Found %d spool files (%d bytes) from an earlier run in %s", len(files), s.bytes, config.Dir)
+	}
+	return s, nil
+}
+
+// Engaged reports whether writers should spool batches without trying
+// Elasticsearch. A nil Spill is never engaged.
+func (s *Spill[T]) Engaged() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.engaged
+}
+
+// Succeeded records a batch written to Elasticsearch
+func (s *Spill[T]) Succeeded() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = 0
+}
+
+// Failed records a batch that Elasticsearch did not take, engaging the spill
+// after AfterFailures in a row
+func (s *Spill[T]) Failed() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures++
+	if !s.engaged && s.failures >= s.config.AfterFailures {
+		s.engaged = true
+		s.logger.Error("%d %s batches failed in a row; spooling batches to %s until Elasticsearch recovers", s.failures, s.name, s.config.Dir)
+		s.logger.Metric("spill.engaged_count", 1)
+	}
+}
+
+// Write appends batch to the spool and syncs it to disk
+func (s *Spill[T]) Write(batch T) error {
+	if s == nil {
+		return fmt.Errorf("spilling is disabled")
+	}
+	line, err := json.Marshal(batch)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spilled batch: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.config.MaxBytes > 0 && s.bytes+len(line) > s.config.MaxBytes {
+		s.logger.Metric("spill.refused_count", 1)
+		return ErrSpillFull
+	}
+	if s.file == nil {
+		s.seq++
+		path := filepath.Join(s.config.Dir, fmt.Sprintf("%s-%020d-%06d.ndjson", s.name, time.Now().UnixNano(), s.seq))
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640) //nolint:gosec // G304: path is built from the configured spill directory
+		if err != nil {
+			return fmt.Errorf("failed to create spool file: %w", err)
+		}
+		s.file = file
+	}
+	if _, err := s.file.Write(line); err != nil {
+		return fmt.Errorf("failed to write spool file: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync spool file: %w", err)
+	}
+	s.bytes += len(line)
+	s.logger.Metric("spill.batches_written_count", 1)
+	s.logger.Metric("spill.bytes", float64(s.bytes))
+	return nil
+}
+
+// Run probes Elasticsearch with probe at once and then every
+// ReplayInterval while batches are spooled or the spill is engaged. Once a
+// probe succeeds, the spill disengages and the spool is replayed (see
+// Replay). Run returns when ctx is done.
+func (s *Spill[T]) Run(ctx context.Context, probe func(ctx context.Context) error, replay func(batch T, done func()) bool) {
+	if s == nil {
+		return
+	}
+	ticker := time.NewTicker(s.config.ReplayInterval)
+	defer ticker.Stop()
+	for {
+		if s.pending() {
+			if err := probe(ctx); err != nil {
+				s.logger.Debug("Elasticsearch still unavailable, keeping %s batches spooled: %v", s.name, err)
+			} else {
+				s.mu.Lock()
+				if s.engaged {
+					s.logger.Info("Elasticsearch is reachable again; replaying spooled %s batches", s.name)
+				}
+				s.engaged, s.failures = false, 0
+				s.mu.Unlock()
+				if _, err := s.Replay(ctx, replay); err != nil {
+					s.logger.Error("Failed to replay spooled %s batches: %v", s.name, err)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pending reports whether there is anything to replay or the spill is engaged
+func (s *Spill[T]) pending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.engaged || s.bytes > 0
+}
+
+// Replay hands every spooled batch to replay, oldest first, and returns how
+// many it handed off. replay must call done once the batch is written or
+// spooled again; a spool file is removed only when every batch read from it
+// is done, so batches are never lost to a crash mid-replay. Replay stops if
+// replay returns false or ctx is done, and the batches not handed off stay
+// spooled. Batches spooled while it runs go to a new file, replayed by a
+// later call.
+func (s *Spill[T]) Replay(ctx context.Context, replay func(batch T, done func()) bool) (int, error) {
+	if s == nil {
+		return 0, nil
+	}
+
+	// Close the file being written, so that every file listed is complete
+	// and later writes start a file that is not listed
+	s.mu.Lock()
+	if s.file != nil {
+		if err := s.file.Close(); err != nil {
+			s.logger.Error("Failed to close spool file: %v", err)
+		}
+		s.file = nil
+	}
+	files, err := s.spoolFiles()
+	s.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for _, path := range files {
+		n, stopped, err := s.replayFile(ctx, path, replay)
+		replayed += n
+		if n > 0 {
+			s.logger.Info("Replayed %d spooled %s batches from %s", n, s.name, filepath.Base(path))
+			s.logger.Metric("spill.batches_replayed_count", float64(n))
+		}
+		if err != nil || stopped {
+			return replayed, err
+		}
+	}
+	return replayed, nil
+}
+
+// replayFile hands the batches in the spool file at path to replay, waits
+// until each is done, and removes the file. If replay stops early, the file
+// is rewritten with the batches not handed off. It returns the batches
+// handed off and whether replay stopped.
+func (s *Spill[T]) replayFile(ctx context.Context, path string, replay func(batch T, done func()) bool) (int, bool, error) {
+	file, err := os.Open(path) //nolint:gosec // G304: path is listed from the configured spill directory
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to open spool file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	n, size := 0, 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 256<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var batch T
+		if err := json.Unmarshal(line, &batch); err != nil {
+			// A line torn by a crash mid-write cannot be replayed
+			s.logger.Error("Skipping unreadable batch in spool file %s: %v", filepath.Base(path), err)
+			size += len(line) + 1
+			continue
+		}
+		wg.Add(1)
+		if ctx.Err() != nil || !replay(batch, wg.Done) {
+			wg.Done()
+			return n, true, s.keepRemainder(path, line, scanner, size)
+		}
+		n++
+		size += len(line) + 1
+	}
+	if err := scanner.Err(); err != nil {
+		return n, false, fmt.Errorf("failed to read spool file: %w", err)
+	}
+
+	wg.Wait()
+	if err := os.Remove(path); err != nil {
+		return n, false, fmt.Errorf("failed to remove replayed spool file: %w", err)
+	}
+	s.release(size)
+	return n, false, nil
+}
+
+// keepRemainder replaces the spool file at path with line and the lines
+// scanner has yet to read, dropping the replayed bytes before them
+func (s *Spill[T]) keepRemainder(path string, line []byte, scanner *bufio.Scanner, replayed int) error {
+	tmp := path + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640) //nolint:gosec // G304: path is listed from the configured spill directory
+	if err != nil {
+		return fmt.Errorf("failed to rewrite spool file: %w", err)
+	}
+	w := bufio.NewWriter(out)
+	_, _ = w.Write(line)
+	_ = w.WriteByte('\n')
+	for scanner.Scan() {
+		_, _ = w.Write(scanner.Bytes())
+		_ = w.WriteByte('\n')
+	}
+	err = errors.Join(scanner.Err(), w.Flush(), out.Sync(), out.Close())
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to rewrite spool file: %w", err)
+	}
+	s.release(replayed)
+	return nil
+}
+
+// release subtracts bytes removed from the spool
+func (s *Spill[T]) release(bytes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bytes = max(s.bytes-bytes, 0)
+	s.logger.Metric("spill.bytes", float64(s.bytes))
+}
+
+// spoolFiles lists the spool files, oldest first
+func (s *Spill[T]) spoolFiles() ([]string, error) {
+	entries, err := os.ReadDir(s.config.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list spill directory: %w", err)
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), s.name+"-") && strings.HasSuffix(entry.Name(), ".ndjson") {
+			files = append(files, filepath.Join(s.config.Dir, entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,202 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type spillTestBatch struct {
+	N int `json:"n"`
+}
+
+func newTestSpill(t *testing.T, config SpillConfig) *Spill[spillTestBatch] {
+	t.Helper()
+	if config.Dir == "" {
+		config.Dir = t.TempDir()
+	}
+	spill, err := NewSpill[spillTestBatch](config, "test", NewLogger(false))
+	if err != nil {
+		t.Fatalf("failed to create spill: %v", err)
+	}
+	return spill
+}
+
+// replayAll replays spill, finishing each batch at once, and returns the
+// batches in the order they were handed off
+func replayAll(t *testing.T, spill *Spill[spillTestBatch]) []int {
+	t.Helper()
+	var got []int
+	if _, err := spill.Replay(context.Background(), func(batch spillTestBatch, done func()) bool {
+		got = append(got, batch.N)
+		done()
+		return true
+	}); err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+	return got
+}
+
+func TestNewSpill_DisabledWithoutDir(t *testing.T) {
+	spill, err := NewSpill[spillTestBatch](SpillConfig{}, "test", NewLogger(false))
+	if err != nil || spill != nil {
+		t.Fatalf("expected no spill without a directory, got %v, %v", spill, err)
+	}
+	if spill.Engaged() {
+		t.Error("a nil spill is never engaged")
+	}
+	spill.Failed()
+	spill.Succeeded()
+}
+
+func TestSpill_EngagesAfterConsecutiveFailures(t *testing.T) {
+	spill := newTestSpill(t, SpillConfig{AfterFailures: 3})
+	spill.Failed()
+	spill.Failed()
+	spill.Succeeded()
+	spill.Failed()
+	spill.Failed()
+	if spill.Engaged() {
+		t.Fatal("a success should reset the failure count")
+	}
+	spill.Failed()
+	if !spill.Engaged() {
+		t.Fatal("expected the spill to engage after 3 failures in a row")
+	}
+}
+
+func TestSpill_ReplaysInOrderAndRemovesFiles(t *testing.T) {
+	dir := t.TempDir()
+	spill := newTestSpill(t, SpillConfig{Dir: dir})
+	for n := 1; n <= 3; n++ {
+		if err := spill.Write(spillTestBatch{N: n}); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	got := replayAll(t, spill)
+	if len(got) != 3 || got[0] != 1 || got[2] != 3 {
+		t.Errorf("expected batches 1-3 in order, got %v", got)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected replayed spool files removed, found %d", len(entries))
+	}
+	if spill.pending() {
+		t.Error("expected nothing pending after a replay")
+	}
+
+	// Writes after a replay start a new file
+	if err := spill.Write(spillTestBatch{N: 4}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if got := replayAll(t, spill); len(got) != 1 || got[0] != 4 {
+		t.Errorf("expected batch 4 replayed, got %v", got)
+	}
+}
+
+func TestSpill_ReplaysFilesFromEarlierRun(t *testing.T) {
+	dir := t.TempDir()
+	first := newTestSpill(t, SpillConfig{Dir: dir})
+	if err := first.Write(spillTestBatch{N: 1}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	// A torn final line, as a crash mid-write leaves, is skipped
+	files, _ := filepath.Glob(filepath.Join(dir, "test-*.ndjson"))
+	f, err := os.OpenFile(files[0], os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"n":`)
+	_ = f.Close()
+
+	second := newTestSpill(t, SpillConfig{Dir: dir})
+	if !second.pending() {
+		t.Fatal("expected spool files from an earlier run pending")
+	}
+	if got := replayAll(t, second); len(got) != 1 || got[0] != 1 {
+		t.Errorf("expected batch 1 replayed, got %v", got)
+	}
+}
+
+func TestSpill_MaxBytes(t *testing.T) {
+	spill := newTestSpill(t, SpillConfig{MaxBytes: 20})
+	if err := spill.Write(spillTestBatch{N: 1}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := spill.Write(spillTestBatch{N: 2}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if err := spill.Write(spillTestBatch{N: 3}); !errors.Is(err, ErrSpillFull) {
+		t.Fatalf("expected ErrSpillFull past MaxBytes, got %v", err)
+	}
+
+	replayAll(t, spill)
+	if err := spill.Write(spillTestBatch{N: 3}); err != nil {
+		t.Errorf("expected room once the spool was replayed, got %v", err)
+	}
+}
+
+func TestSpill_ReplayStoppedKeepsRemainder(t *testing.T) {
+	spill := newTestSpill(t, SpillConfig{})
+	for n := 1; n <= 4; n++ {
+		if err := spill.Write(spillTestBatch{N: n}); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	handed := 0
+	n, err := spill.Replay(context.Background(), func(batch spillTestBatch, done func()) bool {
+		if handed == 2 {
+			return false
+		}
+		handed++
+		done()
+		return true
+	})
+	if err != nil || n != 2 {
+		t.Fatalf("expected 2 batches handed off before the stop, got %d (%v)", n, err)
+	}
+
+	if got := replayAll(t, spill); len(got) != 2 || got[0] != 3 || got[1] != 4 {
+		t.Errorf("expected only batches 3 and 4 left, got %v", got)
+	}
+}
+
+func TestSpill_RunReplaysOnceProbeSucceeds(t *testing.T) {
+	spill := newTestSpill(t, SpillConfig{AfterFailures: 1, ReplayInterval: 5 * time.Millisecond})
+	spill.Failed()
+	if err := spill.Write(spillTestBatch{N: 1}); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	probes := 0
+	replayed := make(chan int, 1)
+	go spill.Run(ctx, func(context.Context) error {
+		if probes++; probes < 3 {
+			return errors.New("unavailable")
+		}
+		return nil
+	}, func(batch spillTestBatch, done func()) bool {
+		done()
+		replayed <- batch.N
+		return true
+	})
+
+	select {
+	case n := <-replayed:
+		if n != 1 {
+			t.Errorf("expected batch 1 replayed, got %d", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the replay")
+	}
+	if spill.Engaged() {
+		t.Error("expected the spill to disengage once the probe succeeded")
+	}
+}
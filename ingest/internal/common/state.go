@@ -1,33 +1,198 @@
 package common
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"strings"
 	"sync"
 	"time"
 
 	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
 )
 
 // CursorState represents the current processing position and metadata for file ingestion
 type CursorState struct {
+	LastTimeUs int64                   `json:"last_time_us"`
+	UpdatedAt  time.Time               `json:"updated_at"`
+	Exports    map[string]ExportCursor `json:"exports,omitempty"`  // Per-index export watermarks (see ExportCursor)
+	Backfill   *BackfillCursor         `json:"backfill,omitempty"` // Files a newest-first catch-up has yet to process
+	History    []CursorHistoryEntry    `json:"history,omitempty"`  // Recent cursor moves, oldest first (see appendCursorHistory)
+}
+
+// CursorHistoryEntry is one recorded position of the cursor
+type CursorHistoryEntry struct {
 	LastTimeUs int64     `json:"last_time_us"`
-	UpdatedAt  time.Time `json:"updated_at"`
+	At         time.Time `json:"at"`               // When the cursor was moved there
+	Reason     string    `json:"reason,omitempty"` // Why the cursor moved other than by progress, e.g. a rewind
+}
+
+// The cursor history keeps the last cursorHistorySize entries. Progress is
+// recorded at most every cursorHistoryInterval; moves back and overrides
+// are always recorded.
+const (
+	cursorHistorySize     = 500
+	cursorHistoryInterval = time.Minute
+)
+
+// cursorMovedBack is the reason recorded for a cursor that moved back
+// without one given
+const cursorMovedBack = "moved back"
+
+// appendCursorHistory returns history with entry appended, unless it is
+// progress within cursorHistoryInterval of the last entry, trimmed to the
+// last cursorHistorySize entries
+func appendCursorHistory(history []CursorHistoryEntry, entry CursorHistoryEntry) []CursorHistoryEntry {
+	if n := len(history); n > 0 && entry.Reason == "" {
+		last := history[n-1]
+		if entry.LastTimeUs < last.LastTimeUs {
+			entry.Reason = cursorMovedBack
+		} else if entry.At.Sub(last.At) < cursorHistoryInterval {
+			return history
+		}
+	}
+	history = append(history[:len(history):len(history)], entry)
+	if len(history) > cursorHistorySize {
+		history = history[len(history)-cursorHistorySize:]
+	}
+	return history
+}
+
+// BackfillCursor is the range of files a newest-first catch-up has yet to
+// process: those after FromUs and at or before ToUs. Files are processed
+// newest first, so ToUs moves down towards FromUs as they are.
+type BackfillCursor struct {
+	FromUs    int64     `json:"from_us"`
+	ToUs      int64     `json:"to_us"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ExportCursor records how far an export of one index got: the created_at
+// and indexed_at of the last record it exported, and the end of its window
+type ExportCursor struct {
+	CreatedAt string    `json:"created_at,omitempty"`
+	IndexedAt string    `json:"indexed_at,omitempty"`
+	WindowEnd string    `json:"window_end"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
-// StateManager manages file processing state and cursor position
+// StateManager manages file processing state and cursor position. A state
+// object in GCS is written only if it is still the generation this manager
+// last read or wrote, so two replicas sharing it cannot silently overwrite
+// each other's cursor, and a manager that finds another writer has written
+// it yields to that writer (see writeGCSState).
 type StateManager struct {
 	stateFilePath string
-	mu            sync.RWMutex
+	writeMu       sync.Mutex   // Serializes loads and writes of the state file, across GCS requests and their retries
+	mu            sync.RWMutex // Guards cursor; never held across a GCS request, so readers don't wait on GCS
 	cursor        *CursorState
 	logger        *IngestLogger
 	gcsClient     *storage.Client
 	gcsBucket     string
 	gcsObject     string
 	useGCS        bool
+	state         stateObject
+	generation    int64  // Generation of the GCS state object last read or written; 0 if there was none. Guarded by writeMu
+	unconfirmed   []byte // A write to the GCS state object that failed but may have landed; nil if none. Guarded by writeMu
+	superseded    bool   // Another writer has written the GCS state object; no more writes are made. Guarded by mu
+}
+
+// Each GCS state request gets stateGCSTimeout, and is retried up to
+// stateGCSRetryMax times with exponential backoff on transient errors.
+// Variables so tests can shorten them.
+var (
+	stateGCSTimeout    = 30 * time.Second
+	stateGCSRetryMax   = 3
+	stateGCSRetryDelay = 500 * time.Millisecond
+)
+
+// isTransientGCSError reports whether a GCS request failed in a way a retry
+// may not: a timeout, a dropped connection, throttling, or a server error
+func isTransientGCSError(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || storage.ShouldRetry(err)
+}
+
+// withGCSRetry runs the GCS request op with a timeout, retrying it while it
+// fails transiently. Retries are logged and counted in
+// state.gcs_retry_count. It sleeps between retries, so callers must not
+// hold sm.mu.
+func (sm *StateManager) withGCSRetry(request string, op func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), stateGCSTimeout)
+		err := op(ctx)
+		cancel()
+		if err == nil || attempt == stateGCSRetryMax || !isTransientGCSError(err) {
+			return err
+		}
+		delay := stateGCSRetryDelay << attempt
+		sm.logger.Metric("state.gcs_retry_count", 1)
+		sm.logger.Error("Transient error on %s of %s, retrying in %s (attempt %d of %d): %v", request, sm.stateFilePath, delay, attempt+1, stateGCSRetryMax+1, err)
+		time.Sleep(delay)
+	}
+}
+
+// errStateConflict is returned by stateObject.write when the object is not
+// at the expected generation
+var errStateConflict = errors.New("state object was changed by another writer")
+
+// ErrStateSuperseded is returned by state writes once another writer, a
+// second replica or an operator overriding the cursor, has written the GCS
+// state object. The manager has yielded to it and writes nothing more.
+var ErrStateSuperseded = errors.New("state was superseded by another writer")
+
+// stateObject is the GCS object a StateManager keeps its state in
+type stateObject interface {
+	// read returns the object's content and generation, or
+	// storage.ErrObjectNotExist
+	read(ctx context.Context) ([]byte, int64, error)
+	// write replaces the object if it is at generation, or does not exist
+	// when generation is 0, and returns its new generation; otherwise it
+	// returns errStateConflict
+	write(ctx context.Context, data []byte, generation int64) (int64, error)
+}
+
+// gcsStateObject is a stateObject in a GCS bucket
+type gcsStateObject struct {
+	object *storage.ObjectHandle
+}
+
+func (o gcsStateObject) read(ctx context.Context) ([]byte, int64, error) {
+	reader, err := o.object.NewReader(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = reader.Close() }() // Best-effort close for read operation
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, reader.Attrs.Generation, nil
+}
+
+func (o gcsStateObject) write(ctx context.Context, data []byte, generation int64) (int64, error) {
+	conditions := storage.Conditions{GenerationMatch: generation}
+	if generation == 0 {
+		conditions = storage.Conditions{DoesNotExist: true}
+	}
+	writer := o.object.If(conditions).NewWriter(ctx)
+	if _, err := writer.Write(data); err != nil {
+		_ = writer.Close() // Best-effort close on error
+		return 0, err
+	}
+	if err := writer.Close(); err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+			return 0, errStateConflict
+		}
+		return 0, err
+	}
+	return writer.Attrs().Generation, nil
 }
 
 // NewStateManager creates a new state manager with the given state file path
@@ -57,6 +222,7 @@ func NewStateManager(stateFilePath string, logger *IngestLogger) (*StateManager,
 			return nil, fmt.Errorf("failed to create GCS client: %w", err)
 		}
 		sm.gcsClient = client
+		sm.state = gcsStateObject{object: client.Bucket(sm.gcsBucket).Object(sm.gcsObject)}
 		logger.Info("Using GCS for state storage: gs://%s/%s", sm.gcsBucket, sm.gcsObject)
 	} else {
 		logger.Info("Using local filesystem for state storage: %s", stateFilePath)
@@ -69,7 +235,7 @@ func NewStateManager(stateFilePath string, logger *IngestLogger) (*StateManager,
 	// Initialize cursor to current time if no state was loaded
 	if sm.cursor == nil {
 		sm.cursor = &CursorState{
-			LastTimeUs: time.Now().UnixMicro(),
+			LastTimeUs: CorrectedNow().UnixMicro(),
 			UpdatedAt:  time.Now().UTC(),
 		}
 		sm.logger.Info("No existing state found, initialized cursor to current time: %d", sm.cursor.LastTimeUs)
@@ -80,30 +246,27 @@ func NewStateManager(stateFilePath string, logger *IngestLogger) (*StateManager,
 
 // LoadState loads the processing state from the state file
 func (sm *StateManager) LoadState() error {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
+	sm.writeMu.Lock()
+	defer sm.writeMu.Unlock()
 
 	var data []byte
 	var err error
 
-	if sm.useGCS {
-		// Load from GCS
-		ctx := context.Background()
-		reader, err := sm.gcsClient.Bucket(sm.gcsBucket).Object(sm.gcsObject).NewReader(ctx)
+	if sm.state != nil {
+		// Load from GCS, remembering the generation the next write expects
+		sm.unconfirmed = nil
+		err = sm.withGCSRetry("state read", func(ctx context.Context) error {
+			var readErr error
+			data, sm.generation, readErr = sm.state.read(ctx)
+			return readErr
+		})
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			sm.logger.Info("State file does not exist in GCS, starting with empty state")
+			return nil
+		}
 		if err != nil {
-			if err == storage.ErrObjectNotExist {
-				sm.logger.Info("State file does not exist in GCS, starting with empty state")
-				return nil
-			}
 			return fmt.Errorf("failed to read state from GCS: %w", err)
 		}
-		defer func() { _ = reader.Close() }() // Best-effort close for read operation
-
-		data = make([]byte, reader.Attrs.Size)
-		_, err = reader.Read(data)
-		if err != nil && err.Error() != "EOF" {
-			return fmt.Errorf("failed to read GCS object: %w", err)
-		}
 	} else {
 		// Load from local filesystem
 		if _, err := os.Stat(sm.stateFilePath); os.IsNotExist(err) {
@@ -122,12 +285,16 @@ func (sm *StateManager) LoadState() error {
 		return nil
 	}
 
-	if err := json.Unmarshal(data, &sm.cursor); err != nil {
+	var cursor *CursorState
+	if err := json.Unmarshal(data, &cursor); err != nil {
 		return fmt.Errorf("failed to parse state file: %w", err)
 	}
+	sm.mu.Lock()
+	sm.cursor = cursor
+	sm.mu.Unlock()
 
-	if sm.cursor != nil {
-		sm.logger.Info("Loaded state with cursor (last_time_us: %d)", sm.cursor.LastTimeUs)
+	if cursor != nil {
+		sm.logger.Info("Loaded state with cursor (last_time_us: %d)", cursor.LastTimeUs)
 	} else {
 		sm.logger.Info("Loaded empty state")
 	}
@@ -143,37 +310,239 @@ func (sm *StateManager) GetCursor() *CursorState {
 
 // UpdateCursor updates the cursor state with a new timestamp
 func (sm *StateManager) UpdateCursor(timeUs int64) error {
+	return sm.moveCursor(timeUs, "")
+}
+
+// moveCursor moves the cursor to timeUs, recording the move in its history
+// with reason, and writes the state file
+func (sm *StateManager) moveCursor(timeUs int64, reason string) error {
+	sm.writeMu.Lock()
+	defer sm.writeMu.Unlock()
 	sm.mu.Lock()
-	defer sm.mu.Unlock()
 
-	sm.cursor = &CursorState{
+	cursor := &CursorState{
 		LastTimeUs: timeUs,
 		UpdatedAt:  time.Now().UTC(),
 	}
+	if sm.cursor != nil {
+		cursor.Exports = sm.cursor.Exports
+		cursor.Backfill = sm.cursor.Backfill
+		cursor.History = sm.cursor.History
+	}
+	cursor.History = appendCursorHistory(cursor.History, CursorHistoryEntry{LastTimeUs: timeUs, At: cursor.UpdatedAt, Reason: reason})
+	sm.cursor = cursor
+	sm.mu.Unlock()
+
+	return sm.writeState()
+}
+
+// GetBackfillCursor returns the backfill in progress, if any
+func (sm *StateManager) GetBackfillCursor() (BackfillCursor, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	if sm.cursor == nil || sm.cursor.Backfill == nil {
+		return BackfillCursor{}, false
+	}
+	return *sm.cursor.Backfill, true
+}
 
+// StartBackfill hands the files after fromUs and at or before toUs to a
+// backfill and moves the cursor to toUs, in a single write so that a crash
+// cannot leave files covered by neither
+func (sm *StateManager) StartBackfill(fromUs, toUs int64) error {
+	sm.writeMu.Lock()
+	defer sm.writeMu.Unlock()
+	sm.mu.Lock()
+
+	now := time.Now().UTC()
+	cursor := &CursorState{
+		LastTimeUs: toUs,
+		UpdatedAt:  now,
+		Backfill:   &BackfillCursor{FromUs: fromUs, ToUs: toUs, UpdatedAt: now},
+	}
+	if sm.cursor != nil {
+		cursor.Exports = sm.cursor.Exports
+		cursor.History = sm.cursor.History
+	}
+	cursor.History = appendCursorHistory(cursor.History, CursorHistoryEntry{LastTimeUs: toUs, At: now, Reason: "backfill started"})
+	sm.cursor = cursor
+	sm.mu.Unlock()
+
+	return sm.writeState()
+}
+
+// UpdateBackfillCursor records the backfill's progress and writes the state
+// file. A cursor whose range is empty ends the backfill.
+func (sm *StateManager) UpdateBackfillCursor(backfill BackfillCursor) error {
+	sm.writeMu.Lock()
+	defer sm.writeMu.Unlock()
+	sm.mu.Lock()
+
+	if sm.cursor == nil {
+		sm.cursor = &CursorState{LastTimeUs: CorrectedNow().UnixMicro()}
+	}
+	cursor := *sm.cursor
+	cursor.UpdatedAt = time.Now().UTC()
+	cursor.Backfill = nil
+	if backfill.ToUs > backfill.FromUs {
+		backfill.UpdatedAt = cursor.UpdatedAt
+		cursor.Backfill = &backfill
+	}
+	sm.cursor = &cursor
+	sm.mu.Unlock()
+
+	return sm.writeState()
+}
+
+// GetExportCursor returns the export cursor recorded for index, if any
+func (sm *StateManager) GetExportCursor(index string) (ExportCursor, bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	if sm.cursor == nil {
+		return ExportCursor{}, false
+	}
+	cursor, ok := sm.cursor.Exports[index]
+	return cursor, ok
+}
+
+// UpdateExportCursor records cursor for index and writes the state file
+func (sm *StateManager) UpdateExportCursor(index string, cursor ExportCursor) error {
+	sm.writeMu.Lock()
+	defer sm.writeMu.Unlock()
+	sm.mu.Lock()
+
+	if sm.cursor == nil {
+		sm.cursor = &CursorState{LastTimeUs: CorrectedNow().UnixMicro()}
+	}
+	exports := make(map[string]ExportCursor, len(sm.cursor.Exports)+1)
+	for name, existing := range sm.cursor.Exports {
+		exports[name] = existing
+	}
+	cursor.UpdatedAt = time.Now().UTC()
+	exports[index] = cursor
+	sm.cursor = &CursorState{
+		LastTimeUs: sm.cursor.LastTimeUs,
+		UpdatedAt:  cursor.UpdatedAt,
+		Exports:    exports,
+		Backfill:   sm.cursor.Backfill,
+		History:    sm.cursor.History,
+	}
+	sm.mu.Unlock()
+
+	return sm.writeState()
+}
+
+// writeState writes the cursor state to the state file. Callers hold
+// sm.writeMu, not sm.mu.
+func (sm *StateManager) writeState() error {
+	sm.mu.RLock()
+	superseded := sm.superseded
 	data, err := json.MarshalIndent(sm.cursor, "", "  ")
+	sm.mu.RUnlock()
+	if superseded {
+		return ErrStateSuperseded
+	}
 	if err != nil {
 		return fmt.Errorf("failed to marshal state: %w", err)
 	}
 
-	if sm.useGCS {
-		// Write to GCS
-		ctx := context.Background()
-		writer := sm.gcsClient.Bucket(sm.gcsBucket).Object(sm.gcsObject).NewWriter(ctx)
-		if _, err := writer.Write(data); err != nil {
-			_ = writer.Close() // Best-effort close on error
+	if sm.state != nil {
+		return sm.writeGCSState(data)
+	}
+
+	// Write to local filesystem
+	if err := os.WriteFile(sm.stateFilePath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	return nil
+}
+
+// writeGCSState writes data to the GCS state object if it is still at the
+// generation this manager last read or wrote. Otherwise another writer has
+// written it since: a second replica that should not be running, or an
+// operator overriding the cursor. Its state is newer than this manager's,
+// so rather than overwrite it the manager yields: the conflict is logged and
+// counted in state.write_conflict_count, the other writer's state is
+// adopted, and every later write fails with ErrStateSuperseded, while
+// CheckForNewerInstance reports a newer instance so the service exits.
+//
+// A write that timed out may still have landed, moving the object to a
+// generation this manager never saw. So before a precondition failure is
+// taken for a conflict, the object is read back: if it holds the write whose
+// outcome was unknown, the generation is this manager's own. Callers hold
+// sm.writeMu, not sm.mu.
+func (sm *StateManager) writeGCSState(data []byte) error {
+	for {
+		var generation int64
+		err := sm.withGCSRetry("state write", func(ctx context.Context) error {
+			var writeErr error
+			generation, writeErr = sm.state.write(ctx, data, sm.generation)
+			if isTransientGCSError(writeErr) {
+				sm.unconfirmed = data
+			}
+			return writeErr
+		})
+		if err == nil {
+			sm.generation, sm.unconfirmed = generation, nil
+			return nil
+		}
+		if !errors.Is(err, errStateConflict) {
 			return fmt.Errorf("failed to write state to GCS: %w", err)
 		}
-		if err := writer.Close(); err != nil {
-			return fmt.Errorf("failed to close GCS writer: %w", err)
+
+		var remote []byte
+		err = sm.withGCSRetry("state read", func(ctx context.Context) error {
+			var readErr error
+			remote, generation, readErr = sm.state.read(ctx)
+			return readErr
+		})
+		if err != nil && !errors.Is(err, storage.ErrObjectNotExist) {
+			return fmt.Errorf("failed to read state from GCS after a conflicting write: %w", err)
 		}
-	} else {
-		// Write to local filesystem
-		if err := os.WriteFile(sm.stateFilePath, data, 0600); err != nil {
-			return fmt.Errorf("failed to write state file: %w", err)
+		if sm.unconfirmed != nil && bytes.Equal(remote, sm.unconfirmed) {
+			// Not a conflict: a write of ours that timed out landed
+			sm.logger.Info("State %s write that failed landed at generation %d", sm.stateFilePath, generation)
+			sm.generation, sm.unconfirmed = generation, nil
+			if bytes.Equal(remote, data) {
+				return nil
+			}
+			continue
+		}
+
+		sm.logger.Metric("state.write_conflict_count", 1)
+		sm.logger.Error("State %s was written by another writer since generation %d; yielding to it at generation %d (is more than one replica running, or was the cursor overridden?)", sm.stateFilePath, sm.generation, generation)
+		sm.generation, sm.unconfirmed = generation, nil
+		var other *CursorState
+		if json.Unmarshal(remote, &other) != nil {
+			other = nil
+		}
+		sm.mu.Lock()
+		if other != nil {
+			sm.cursor = other
 		}
+		sm.superseded = true
+		sm.mu.Unlock()
+		return fmt.Errorf("failed to write state to GCS: %w", ErrStateSuperseded)
 	}
+}
 
+// OverrideCursor moves the cursor to timeUs outside normal progress, such as
+// a rewind or a skip ahead, and audits the change with reason. The move is
+// recorded in the cursor history with reason.
+func (sm *StateManager) OverrideCursor(ctx context.Context, timeUs int64, reason string) error {
+	var previousUs int64
+	if cursor := sm.GetCursor(); cursor != nil {
+		previousUs = cursor.LastTimeUs
+	}
+	if err := sm.moveCursor(timeUs, reason); err != nil {
+		return err
+	}
+	sm.logger.Audit(ctx, AuditEntry{
+		Operation: AuditCursorOverride,
+		Target:    sm.stateFilePath,
+		Detail:    fmt.Sprintf("%s: cursor moved from %d to %d", reason, previousUs, timeUs),
+		Count:     -1,
+	})
 	return nil
 }
 
@@ -197,15 +566,18 @@ func (sm *StateManager) WriteInstanceInfo(startedAt int64) error {
 	instancePath := sm.getInstancePath()
 
 	if sm.useGCS {
-		ctx := context.Background()
-		writer := sm.gcsClient.Bucket(sm.gcsBucket).Object(instancePath).NewWriter(ctx)
-		if _, err := writer.Write(data); err != nil {
-			_ = writer.Close()
+		object := sm.gcsClient.Bucket(sm.gcsBucket).Object(instancePath)
+		err := sm.withGCSRetry("instance info write", func(ctx context.Context) error {
+			writer := object.NewWriter(ctx)
+			if _, err := writer.Write(data); err != nil {
+				_ = writer.Close()
+				return err
+			}
+			return writer.Close()
+		})
+		if err != nil {
 			return fmt.Errorf("failed to write instance info to GCS: %w", err)
 		}
-		if err := writer.Close(); err != nil {
-			return fmt.Errorf("failed to close GCS writer: %w", err)
-		}
 	} else {
 		filePath := strings.Replace(sm.stateFilePath, "_state.json", "_instance.json", 1)
 		if err := os.WriteFile(filePath, data, 0600); err != nil {
@@ -224,24 +596,15 @@ func (sm *StateManager) ReadInstanceInfo() (*InstanceInfo, error) {
 	var err error
 
 	if sm.useGCS {
-		ctx := context.Background()
-		reader, err := sm.gcsClient.Bucket(sm.gcsBucket).Object(instancePath).NewReader(ctx)
+		object := gcsStateObject{object: sm.gcsClient.Bucket(sm.gcsBucket).Object(instancePath)}
+		err = sm.withGCSRetry("instance info read", func(ctx context.Context) error {
+			var readErr error
+			data, _, readErr = object.read(ctx)
+			return readErr
+		})
 		if err != nil {
 			return nil, fmt.Errorf("failed to read instance info from GCS: %w", err)
 		}
-		defer func() {
-			if closeErr := reader.Close(); closeErr != nil {
-				sm.logger.Error("Failed to close GCS reader: %v", closeErr)
-			}
-		}()
-
-		// Read all data from GCS reader
-		buf := make([]byte, 1024) // Small buffer for instance info
-		n, err := reader.Read(buf)
-		if err != nil && err.Error() != "EOF" {
-			return nil, fmt.Errorf("failed to read instance info data: %w", err)
-		}
-		data = buf[:n]
 	} else {
 		filePath := strings.Replace(sm.stateFilePath, "_state.json", "_instance.json", 1)
 		data, err = os.ReadFile(filePath) // #nosec G304 - filePath is a controlled configuration value
@@ -258,9 +621,18 @@ func (sm *StateManager) ReadInstanceInfo() (*InstanceInfo, error) {
 	return &info, nil
 }
 
-// CheckForNewerInstance checks if a newer instance has started by comparing start times.
+// CheckForNewerInstance checks if a newer instance has started by comparing start times,
+// or has already written the state this instance yielded to (see writeGCSState).
 // Returns true if a newer instance is detected, false otherwise.
 func (sm *StateManager) CheckForNewerInstance(myStartTime int64) bool {
+	sm.mu.RLock()
+	superseded := sm.superseded
+	sm.mu.RUnlock()
+	if superseded {
+		sm.logger.Info("State %s was written by another writer, shutting down", sm.stateFilePath)
+		return true
+	}
+
 	instanceInfo, err := sm.ReadInstanceInfo()
 	if err != nil {
 		// If we can't read the file, assume it's not there yet or temporary error
@@ -1,9 +1,19 @@
 package common
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
 )
 
 func TestStateManager_LoadState(t *testing.T) {
@@ -221,3 +231,397 @@ func TestStateManager_InstanceFileLocation(t *testing.T) {
 		t.Errorf("Expected instance file to be created at %s", expectedPath)
 	}
 }
+
+func TestStateManager_OverrideCursor(t *testing.T) {
+	sm, err := NewStateManager(filepath.Join(t.TempDir(), "state.json"), NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.OverrideCursor(context.Background(), 1234, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if got := sm.GetCursor().LastTimeUs; got != 1234 {
+		t.Errorf("expected cursor 1234, got %d", got)
+	}
+}
+
+func TestStateManager_CursorHistory(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	sm, err := NewStateManager(stateFile, NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, timeUs := range []int64{100, 200, 300} {
+		if err := sm.UpdateCursor(timeUs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sm.OverrideCursor(context.Background(), 50, "replay"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Progress within a minute of the last entry is not recorded; the
+	// override is, and survives a reload
+	reloaded, err := NewStateManager(stateFile, NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	history := reloaded.GetCursor().History
+	if len(history) != 2 || history[0].LastTimeUs != 100 || history[1].LastTimeUs != 50 || history[1].Reason != "replay" {
+		t.Errorf("expected the first cursor and the override, got %+v", history)
+	}
+
+	at := time.Date(2026, 6, 3, 10, 0, 0, 0, time.UTC)
+	history = appendCursorHistory(nil, CursorHistoryEntry{LastTimeUs: 10, At: at})
+	history = appendCursorHistory(history, CursorHistoryEntry{LastTimeUs: 20, At: at.Add(cursorHistoryInterval)})
+	history = appendCursorHistory(history, CursorHistoryEntry{LastTimeUs: 15, At: at.Add(cursorHistoryInterval + time.Second)})
+	if len(history) != 3 || history[1].LastTimeUs != 20 || history[2].Reason != cursorMovedBack {
+		t.Errorf("expected progress after the interval and the move back recorded, got %+v", history)
+	}
+	for i := 0; i < cursorHistorySize; i++ {
+		history = appendCursorHistory(history, CursorHistoryEntry{LastTimeUs: int64(100 + i), At: at.Add(time.Duration(i+3) * cursorHistoryInterval)})
+	}
+	if len(history) != cursorHistorySize || history[0].LastTimeUs != 100 {
+		t.Errorf("expected the oldest entries dropped, got %d entries from %d", len(history), history[0].LastTimeUs)
+	}
+
+}
+
+func TestStateManager_ExportCursor(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "extract_state.json")
+	logger := NewLogger(false)
+
+	sm1, err := NewStateManager(stateFile, logger)
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	if _, ok := sm1.GetExportCursor("posts"); ok {
+		t.Error("Expected no export cursor before the first export")
+	}
+
+	cursor := ExportCursor{CreatedAt: "2026-06-03T10:00:00.000Z", IndexedAt: "2026-06-03T10:00:02.000Z", WindowEnd: "2026-06-03T10:05:00Z"}
+	if err := sm1.UpdateExportCursor("posts", cursor); err != nil {
+		t.Fatalf("Failed to update export cursor: %v", err)
+	}
+	if err := sm1.UpdateCursor(1234); err != nil {
+		t.Fatalf("Failed to update cursor: %v", err)
+	}
+
+	sm2, err := NewStateManager(stateFile, logger)
+	if err != nil {
+		t.Fatalf("Failed to load state manager: %v", err)
+	}
+	got, ok := sm2.GetExportCursor("posts")
+	if !ok {
+		t.Fatal("Expected export cursor to survive a cursor update and reload")
+	}
+	if got.CreatedAt != cursor.CreatedAt || got.IndexedAt != cursor.IndexedAt || got.WindowEnd != cursor.WindowEnd || got.UpdatedAt.IsZero() {
+		t.Errorf("Unexpected export cursor %+v", got)
+	}
+	if _, ok := sm2.GetExportCursor("likes"); ok {
+		t.Error("Expected no export cursor for an index that was never exported")
+	}
+}
+
+func TestStateManager_Backfill(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	logger := NewLogger(false)
+
+	sm1, err := NewStateManager(stateFile, logger)
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	if _, ok := sm1.GetBackfillCursor(); ok {
+		t.Error("Expected no backfill before one is started")
+	}
+
+	if err := sm1.StartBackfill(100, 500); err != nil {
+		t.Fatalf("Failed to start backfill: %v", err)
+	}
+	if got := sm1.GetCursor().LastTimeUs; got != 500 {
+		t.Errorf("Expected the cursor moved to the end of the backfill, got %d", got)
+	}
+	if err := sm1.UpdateBackfillCursor(BackfillCursor{FromUs: 100, ToUs: 299}); err != nil {
+		t.Fatalf("Failed to update backfill cursor: %v", err)
+	}
+	if err := sm1.UpdateCursor(600); err != nil {
+		t.Fatalf("Failed to update cursor: %v", err)
+	}
+
+	sm2, err := NewStateManager(stateFile, logger)
+	if err != nil {
+		t.Fatalf("Failed to load state manager: %v", err)
+	}
+	got, ok := sm2.GetBackfillCursor()
+	if !ok || got.FromUs != 100 || got.ToUs != 299 {
+		t.Fatalf("Expected the backfill to survive a cursor update and reload, got %+v", got)
+	}
+
+	if err := sm2.UpdateBackfillCursor(BackfillCursor{FromUs: 100, ToUs: 100}); err != nil {
+		t.Fatalf("Failed to update backfill cursor: %v", err)
+	}
+	if _, ok := sm2.GetBackfillCursor(); ok {
+		t.Error("Expected an empty range to end the backfill")
+	}
+	if got := sm2.GetCursor().LastTimeUs; got != 600 {
+		t.Errorf("Expected ending the backfill to leave the cursor, got %d", got)
+	}
+}
+
+// fakeStateObject is a stateObject in memory, with GCS's generation
+// preconditions
+type fakeStateObject struct {
+	mu         sync.Mutex
+	data       []byte
+	generation int64
+	writes     int
+}
+
+func (o *fakeStateObject) read(ctx context.Context) ([]byte, int64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.generation == 0 {
+		return nil, 0, storage.ErrObjectNotExist
+	}
+	return o.data, o.generation, nil
+}
+
+func (o *fakeStateObject) write(ctx context.Context, data []byte, generation int64) (int64, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if generation != o.generation {
+		return 0, errStateConflict
+	}
+	o.data, o.generation = data, o.generation+1
+	o.writes++
+	return o.generation, nil
+}
+
+func TestStateManager_GCSWriteConflicts(t *testing.T) {
+	object := &fakeStateObject{}
+	mc := newMockMetricCollector()
+	logger := NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(mc)
+	replica := func() *StateManager {
+		sm := &StateManager{stateFilePath: "gs://bucket/state.json", logger: logger, useGCS: true, state: object}
+		if err := sm.LoadState(); err != nil {
+			t.Fatal(err)
+		}
+		sm.cursor = &CursorState{LastTimeUs: 100}
+		return sm
+	}
+
+	// Two replicas load the state before either writes it
+	first, second := replica(), replica()
+	if err := first.UpdateExportCursor("posts", ExportCursor{WindowEnd: "2026-06-03T10:00:00Z"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(mc.getRecords("state.write_conflict_count")) != 0 {
+		t.Fatal("expected the first write of the object not to conflict")
+	}
+
+	// The second replica yields to the first rather than overwrite it
+	if err := second.UpdateCursor(200); !errors.Is(err, ErrStateSuperseded) {
+		t.Fatalf("expected the second replica superseded, got %v", err)
+	}
+	if got := mc.getRecords("state.write_conflict_count"); len(got) != 1 {
+		t.Errorf("expected the second replica's write counted as a conflict, got %v", got)
+	}
+	if object.writes != 1 || object.generation != 1 {
+		t.Errorf("expected the first replica's state kept, got %d writes at generation %d", object.writes, object.generation)
+	}
+	if cursor := second.GetCursor(); cursor.LastTimeUs != 100 || cursor.Exports["posts"].WindowEnd != "2026-06-03T10:00:00Z" {
+		t.Errorf("expected the second replica to adopt the first's state, got %+v", cursor)
+	}
+	if !second.CheckForNewerInstance(time.Now().UnixMicro()) {
+		t.Error("expected a superseded replica to report a newer instance")
+	}
+	if err := second.UpdateCursor(300); !errors.Is(err, ErrStateSuperseded) || object.writes != 1 {
+		t.Errorf("expected no more writes from a superseded replica, got %v and %d writes", err, object.writes)
+	}
+	if got := mc.getRecords("state.write_conflict_count"); len(got) != 1 {
+		t.Errorf("expected a refused write not counted as another conflict, got %v", got)
+	}
+
+	// An operator's cursor override survives the service's next write
+	if err := first.UpdateCursor(400); err != nil {
+		t.Fatal(err)
+	}
+	operator := replica()
+	if err := operator.OverrideCursor(context.Background(), 50, "replay"); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.UpdateCursor(500); !errors.Is(err, ErrStateSuperseded) {
+		t.Fatalf("expected the service superseded by the override, got %v", err)
+	}
+	var state CursorState
+	if err := json.Unmarshal(object.data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if state.LastTimeUs != 50 || first.GetCursor().LastTimeUs != 50 {
+		t.Errorf("expected the overridden cursor kept and adopted, got %d and %d", state.LastTimeUs, first.GetCursor().LastTimeUs)
+	}
+}
+
+// flakyStateObject is a stateObject whose requests fail with failure until
+// failures is used up
+type flakyStateObject struct {
+	fakeStateObject
+	failure  error
+	failures int
+	requests int
+}
+
+func (o *flakyStateObject) fail() error {
+	o.requests++
+	if o.failures > 0 {
+		o.failures--
+		return o.failure
+	}
+	return nil
+}
+
+func (o *flakyStateObject) read(ctx context.Context) ([]byte, int64, error) {
+	if err := o.fail(); err != nil {
+		return nil, 0, err
+	}
+	return o.fakeStateObject.read(ctx)
+}
+
+func (o *flakyStateObject) write(ctx context.Context, data []byte, generation int64) (int64, error) {
+	if err := o.fail(); err != nil {
+		return 0, err
+	}
+	return o.fakeStateObject.write(ctx, data, generation)
+}
+
+func TestStateManager_GCSRetriesTransientErrors(t *testing.T) {
+	retryMax, retryDelay := stateGCSRetryMax, stateGCSRetryDelay
+	stateGCSRetryMax, stateGCSRetryDelay = 2, time.Millisecond
+	t.Cleanup(func() { stateGCSRetryMax, stateGCSRetryDelay = retryMax, retryDelay })
+	mc := newMockMetricCollector()
+	logger := NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(mc)
+
+	object := &flakyStateObject{failure: &googleapi.Error{Code: http.StatusServiceUnavailable}, failures: 2}
+	object.data, object.generation = []byte(`{"last_time_us":100}`), 1
+	sm := &StateManager{stateFilePath: "gs://bucket/state.json", logger: logger, useGCS: true, state: object}
+	if err := sm.LoadState(); err != nil || sm.GetCursor().LastTimeUs != 100 {
+		t.Fatalf("expected the state read on the third request, got %v", err)
+	}
+	object.failures = 1
+	if err := sm.UpdateCursor(200); err != nil || object.writes != 1 {
+		t.Fatalf("expected the write retried, got %v", err)
+	}
+	if got := mc.getRecords("state.gcs_retry_count"); len(got) != 3 {
+		t.Errorf("expected 3 retries counted, got %v", got)
+	}
+
+	object.failures, object.requests = 3, 0
+	if err := sm.UpdateCursor(300); err == nil || object.requests != 3 {
+		t.Errorf("expected the write to give up after 3 requests, got %v after %d", err, object.requests)
+	}
+	object.failure, object.failures, object.requests = &googleapi.Error{Code: http.StatusForbidden}, 1, 0
+	if err := sm.UpdateCursor(300); err == nil || object.requests != 1 {
+		t.Errorf("expected a permanent error not retried, got %v after %d requests", err, object.requests)
+	}
+}
+
+// landingStateObject is a stateObject whose writes land but report a
+// timeout until timeouts is used up
+type landingStateObject struct {
+	fakeStateObject
+	timeouts int
+}
+
+func (o *landingStateObject) write(ctx context.Context, data []byte, generation int64) (int64, error) {
+	written, err := o.fakeStateObject.write(ctx, data, generation)
+	if err == nil && o.timeouts > 0 {
+		o.timeouts--
+		return 0, context.DeadlineExceeded
+	}
+	return written, err
+}
+
+func TestStateManager_GCSWriteThatTimedOutAndLanded(t *testing.T) {
+	retryMax, retryDelay := stateGCSRetryMax, stateGCSRetryDelay
+	stateGCSRetryMax, stateGCSRetryDelay = 2, time.Millisecond
+	t.Cleanup(func() { stateGCSRetryMax, stateGCSRetryDelay = retryMax, retryDelay })
+	mc := newMockMetricCollector()
+	logger := NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(mc)
+
+	object := &landingStateObject{timeouts: 1}
+	object.data, object.generation = []byte(`{"last_time_us":100}`), 1
+	sm := &StateManager{stateFilePath: "gs://bucket/state.json", logger: logger, useGCS: true, state: object}
+	if err := sm.LoadState(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The retry after the timeout fails its precondition on the write that landed
+	if err := sm.UpdateCursor(200); err != nil {
+		t.Fatal(err)
+	}
+	if got := mc.getRecords("state.write_conflict_count"); len(got) != 0 {
+		t.Errorf("expected a write that landed not counted as a conflict, got %v", got)
+	}
+	if object.writes != 1 || sm.generation != 2 {
+		t.Errorf("expected the landed write adopted at generation 2, got %d writes at generation %d", object.writes, sm.generation)
+	}
+
+	// A timeout on the last attempt leaves the outcome unknown until the next write
+	stateGCSRetryMax, object.timeouts = 0, 1
+	if err := sm.UpdateCursor(300); err == nil {
+		t.Fatal("expected the write to fail when its only attempt timed out")
+	}
+	if err := sm.UpdateCursor(400); err != nil {
+		t.Fatal(err)
+	}
+	var state CursorState
+	if err := json.Unmarshal(object.data, &state); err != nil {
+		t.Fatal(err)
+	}
+	if got := mc.getRecords("state.write_conflict_count"); len(got) != 0 || state.LastTimeUs != 400 {
+		t.Errorf("expected the next write on top of the one that landed, got %d conflicts and cursor %d", len(got), state.LastTimeUs)
+	}
+}
+
+// blockingStateObject is a stateObject whose writes wait for release
+type blockingStateObject struct {
+	fakeStateObject
+	started chan struct{}
+	release chan struct{}
+}
+
+func (o *blockingStateObject) write(ctx context.Context, data []byte, generation int64) (int64, error) {
+	o.started <- struct{}{}
+	<-o.release
+	return o.fakeStateObject.write(ctx, data, generation)
+}
+
+func TestStateManager_ReadsDoNotWaitOnGCS(t *testing.T) {
+	object := &blockingStateObject{started: make(chan struct{}), release: make(chan struct{})}
+	sm := &StateManager{stateFilePath: "gs://bucket/state.json", logger: NewLogger(false), useGCS: true, state: object, cursor: &CursorState{LastTimeUs: 100}}
+
+	done := make(chan error, 1)
+	go func() { done <- sm.UpdateCursor(200) }()
+	<-object.started
+
+	read := make(chan int64, 1)
+	go func() { read <- sm.GetCursor().LastTimeUs }()
+	select {
+	case got := <-read:
+		if got != 200 {
+			t.Errorf("expected the cursor being written, got %d", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the cursor readable while its write waits on GCS")
+	}
+	close(object.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,174 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Strictness modes for rows an ingest service cannot parse
+const (
+	StrictnessSkip       = "skip"       // Log and count malformed rows, then drop them
+	StrictnessQuarantine = "quarantine" // Also save each raw row to the dead-letter queue
+	StrictnessHalt       = "halt"       // Drop them, but stop once the malformed rate exceeds a threshold
+)
+
+// MalformedErrorType is the error_type of quarantined rows in the dead-letter
+// queue. Quarantined rows have no index, so dlq_replay leaves them in place.
+const MalformedErrorType = "malformed_row"
+
+// quarantineBatchSize is how many quarantined rows are buffered before they
+// are written as one dead-letter file
+const quarantineBatchSize = 100
+
+// ErrMalformedRateExceeded is returned in halt mode once too large a fraction
+// of a window's rows were malformed
+var ErrMalformedRateExceeded = errors.New("malformed row rate exceeded threshold")
+
+// StrictnessConfig controls how a service treats malformed rows
+type StrictnessConfig struct {
+	Mode     string  // StrictnessSkip, StrictnessQuarantine, or StrictnessHalt
+	HaltRate float64 // Fraction of a window's rows that may be malformed before halt mode stops
+	Window   int     // Rows the malformed rate is measured over
+}
+
+// StrictnessConfigFromConfig returns the strictness configuration in config
+func StrictnessConfigFromConfig(config *Config) StrictnessConfig {
+	return StrictnessConfig{
+		Mode:     config.IngestStrictness,
+		HaltRate: config.MalformedHaltRate,
+		Window:   config.MalformedWindow,
+	}
+}
+
+// MalformedRows applies a service's strictness mode to the rows it reads.
+// Services report every row as Valid or Malformed; the malformed rate is
+// measured over consecutive windows of Window rows.
+type MalformedRows struct {
+	config  StrictnessConfig
+	service string
+	logger  *IngestLogger
+
+	mu          sync.Mutex
+	rows        int // Rows seen in the current window
+	malformed   int // Malformed rows seen in the current window
+	quarantined []DeadLetter
+	halted      error
+}
+
+// NewMalformedRows creates the guard for service, whose name prefixes its
+// metrics. Quarantine mode writes to the logger's dead-letter queue, so the
+// queue must be set on logger first.
+func NewMalformedRows(config StrictnessConfig, service string, logger *IngestLogger) (*MalformedRows, error) {
+	switch config.Mode {
+	case StrictnessSkip, StrictnessHalt:
+	case StrictnessQuarantine:
+		if logger.deadLetters == nil {
+			return nil, fmt.Errorf("strictness %q requires GE_DLQ_DESTINATION", config.Mode)
+		}
+	default:
+		return nil, fmt.Errorf("unknown strictness %q (want %s, %s, or %s)", config.Mode, StrictnessSkip, StrictnessQuarantine, StrictnessHalt)
+	}
+	if config.Mode == StrictnessHalt && (config.HaltRate < 0 || config.HaltRate >= 1 || config.Window <= 0) {
+		return nil, fmt.Errorf("halt strictness needs a halt rate in [0, 1) and a positive window, got %v over %d rows", config.HaltRate, config.Window)
+	}
+	return &MalformedRows{config: config, service: service, logger: logger}, nil
+}
+
+// Mode returns the configured strictness mode
+func (m *MalformedRows) Mode() string {
+	return m.config.Mode
+}
+
+// Valid counts a well-formed row
+func (m *MalformedRows) Valid() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.count(false)
+}
+
+// Malformed records a row that could not be parsed; the parser has already
+// logged why. id identifies the row (an at_uri or a stream position) and raw
+// is the row as read. In halt mode it returns ErrMalformedRateExceeded, and
+// keeps returning it, once the window's malformed rate is certain to exceed
+// the threshold; the caller must then stop without advancing its cursor.
+func (m *MalformedRows) Malformed(ctx context.Context, id string, raw []byte, err error) error {
+	m.logger.Metric(m.service+".malformed_count", 1)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.count(true)
+
+	switch m.config.Mode {
+	case StrictnessQuarantine:
+		m.quarantined = append(m.quarantined, DeadLetter{
+			ID:          id,
+			ErrorType:   MalformedErrorType,
+			ErrorReason: err.Error(),
+			FailedAt:    time.Now().UTC().Format(time.RFC3339),
+			Source:      rawSource(raw),
+		})
+		if len(m.quarantined) >= quarantineBatchSize {
+			m.flushLocked(ctx)
+		}
+	case StrictnessHalt:
+		if m.halted == nil && float64(m.malformed) > m.config.HaltRate*float64(m.config.Window) {
+			m.halted = fmt.Errorf("%w: %d of the last %d rows were malformed (halt rate %v over %d rows)",
+				ErrMalformedRateExceeded, m.malformed, m.rows, m.config.HaltRate, m.config.Window)
+			m.logger.Metric(m.service+".malformed_halt_count", 1)
+		}
+	}
+	return m.halted
+}
+
+// Flush writes any quarantined rows still buffered
+func (m *MalformedRows) Flush(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.flushLocked(ctx)
+}
+
+// count adds a row to the current window, starting a new window when it is full
+func (m *MalformedRows) count(malformed bool) {
+	if m.config.Window > 0 && m.rows >= m.config.Window {
+		m.rows, m.malformed = 0, 0
+	}
+	m.rows++
+	if malformed {
+		m.malformed++
+	}
+}
+
+func (m *MalformedRows) flushLocked(ctx context.Context) {
+	if len(m.quarantined) == 0 {
+		return
+	}
+	path, err := m.logger.deadLetters.Write(ctx, m.quarantined)
+	if err != nil {
+		m.logger.Error("Failed to quarantine %d malformed rows: %v", len(m.quarantined), err)
+		m.logger.Metric("dlq.write_error_count", 1)
+	} else {
+		m.logger.Metric(m.service+".quarantined_count", float64(len(m.quarantined)))
+		m.logger.Info("Quarantined %d malformed rows to %s", len(m.quarantined), path)
+	}
+	m.quarantined = m.quarantined[:0]
+}
+
+// rawSource embeds a raw row in a dead letter: valid JSON as-is, other text
+// as a JSON string, and binary data as a base64 JSON string
+func rawSource(raw []byte) json.RawMessage {
+	if json.Valid(raw) {
+		return json.RawMessage(raw)
+	}
+	var encoded []byte
+	if utf8.Valid(raw) {
+		encoded, _ = json.Marshal(string(raw)) // Strings always marshal
+	} else {
+		encoded, _ = json.Marshal(raw) // Byte slices always marshal
+	}
+	return encoded
+}
@@ -0,0 +1,133 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNewMalformedRows_ValidatesConfig(t *testing.T) {
+	logger := NewLogger(false)
+	tests := []struct {
+		name   string
+		config StrictnessConfig
+	}{
+		{"unknown mode", StrictnessConfig{Mode: "strict"}},
+		{"quarantine without a queue", StrictnessConfig{Mode: StrictnessQuarantine}},
+		{"halt rate of 1", StrictnessConfig{Mode: StrictnessHalt, HaltRate: 1, Window: 100}},
+		{"halt without a window", StrictnessConfig{Mode: StrictnessHalt, HaltRate: 0.1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewMalformedRows(tt.config, "test", logger); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestMalformedRows_SkipNeverHalts(t *testing.T) {
+	logger := NewLogger(true)
+	mc := newMockMetricCollector()
+	logger.SetMetricCollector(mc)
+	m, err := NewMalformedRows(StrictnessConfig{Mode: StrictnessSkip, HaltRate: 0.01, Window: 10}, "test", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 20 {
+		if err := m.Malformed(context.Background(), "at://a", []byte("{"), errors.New("bad json")); err != nil {
+			t.Fatalf("skip mode should never halt, got %v", err)
+		}
+	}
+	if got := len(mc.getRecords("test.malformed_count")); got != 20 {
+		t.Errorf("expected 20 malformed_count records, got %d", got)
+	}
+}
+
+func TestMalformedRows_HaltsWhenRateExceeded(t *testing.T) {
+	logger := NewLogger(false)
+	m, err := NewMalformedRows(StrictnessConfig{Mode: StrictnessHalt, HaltRate: 0.2, Window: 10}, "test", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	bad := errors.New("bad json")
+
+	// Two malformed rows per window of ten is exactly the threshold
+	for range 3 {
+		for i := range 10 {
+			if i < 2 {
+				if err := m.Malformed(ctx, "at://a", nil, bad); err != nil {
+					t.Fatalf("expected no halt at the threshold, got %v", err)
+				}
+			} else {
+				m.Valid()
+			}
+		}
+	}
+
+	// The third malformed row in a window exceeds it, before the window fills
+	for range 2 {
+		if err := m.Malformed(ctx, "at://a", nil, bad); err != nil {
+			t.Fatalf("expected no halt yet, got %v", err)
+		}
+	}
+	if err := m.Malformed(ctx, "at://a", nil, bad); !errors.Is(err, ErrMalformedRateExceeded) {
+		t.Fatalf("expected ErrMalformedRateExceeded, got %v", err)
+	}
+
+	// Once halted it stays halted
+	for range 10 {
+		m.Valid()
+	}
+	if err := m.Malformed(ctx, "at://a", nil, bad); !errors.Is(err, ErrMalformedRateExceeded) {
+		t.Errorf("expected the halt to persist, got %v", err)
+	}
+}
+
+func TestMalformedRows_QuarantinesRawRows(t *testing.T) {
+	ctx := context.Background()
+	queue, err := NewDeadLetterQueue(ctx, t.TempDir(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := NewLogger(false)
+	logger.SetDeadLetterQueue(queue)
+	m, err := NewMalformedRows(StrictnessConfig{Mode: StrictnessQuarantine}, "test", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := [][]byte{[]byte(`{"message":`), []byte(`{"valid":true}`), {0xa2, 0xff, 0x00}}
+	for _, row := range rows {
+		if err := m.Malformed(ctx, "at://a", row, errors.New("bad row")); err != nil {
+			t.Fatalf("quarantine should never halt, got %v", err)
+		}
+	}
+	if paths, _ := queue.List(ctx); len(paths) != 0 {
+		t.Fatalf("expected rows to be buffered until flushed, got %v", paths)
+	}
+	m.Flush(ctx)
+
+	paths, err := queue.List(ctx)
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("expected one quarantine file, got %v, %v", paths, err)
+	}
+	letters, err := queue.Read(ctx, paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{`"{\"message\":"`, `{"valid":true}`, `"ov8A"`}
+	if len(letters) != len(want) {
+		t.Fatalf("expected %d letters, got %+v", len(want), letters)
+	}
+	for i, letter := range letters {
+		if letter.Index != "" || letter.ErrorType != MalformedErrorType || letter.ErrorReason != "bad row" {
+			t.Errorf("letter %d: unexpected %+v", i, letter)
+		}
+		if string(letter.Source) != want[i] {
+			t.Errorf("letter %d: expected source %s, got %s", i, want[i], letter.Source)
+		}
+	}
+}
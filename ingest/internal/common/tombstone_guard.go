@@ -0,0 +1,165 @@
+package common
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// Tombstone guard modes. "filter" drops records that have a tombstone but
+// serves unchecked records when the tombstone lookup fails; "strict" treats a
+// failed lookup as an error so nothing unchecked is returned.
+const (
+	TombstoneGuardOff    = "off"
+	TombstoneGuardFilter = "filter"
+	TombstoneGuardStrict = "strict"
+)
+
+// tombstoneLookupBatch caps the at_uris sent in one tombstone terms query
+const tombstoneLookupBatch = 1000
+
+// TombstoneGuard refuses to return records that have a matching tombstone.
+// Deletes normally remove the record itself, but they can lag behind the
+// tombstone (or fail), so readers check the tombstone aliases as well before
+// serving or exporting content. A nil TombstoneGuard checks nothing.
+type TombstoneGuard struct {
+	client *elasticsearch.Client
+	mode   string
+	logger *IngestLogger
+}
+
+// NewTombstoneGuard creates a guard in the given mode. Returns nil for
+// TombstoneGuardOff so callers can use the result unconditionally.
+func NewTombstoneGuard(client *elasticsearch.Client, mode string, logger *IngestLogger) (*TombstoneGuard, error) {
+	switch mode {
+	case TombstoneGuardOff:
+		return nil, nil
+	case TombstoneGuardFilter, TombstoneGuardStrict:
+	default:
+		return nil, fmt.Errorf("unknown tombstone guard mode %q (expected %s, %s, or %s)", mode, TombstoneGuardOff, TombstoneGuardFilter, TombstoneGuardStrict)
+	}
+	if client == nil {
+		return nil, fmt.Errorf("tombstone guard needs an Elasticsearch client")
+	}
+	return &TombstoneGuard{client: client, mode: mode, logger: logger}, nil
+}
+
+// Deleted returns the subset of atURIs that have a tombstone in
+// tombstoneIndex. In filter mode a failed lookup is logged and treated as no
+// tombstones; in strict mode it is returned as an error.
+func (g *TombstoneGuard) Deleted(ctx context.Context, tombstoneIndex string, atURIs []string) (map[string]bool, error) {
+	deleted := make(map[string]bool)
+	if g == nil {
+		return deleted, nil
+	}
+	for start := 0; start < len(atURIs); start += tombstoneLookupBatch {
+		batch := atURIs[start:min(start+tombstoneLookupBatch, len(atURIs))]
+		found, err := FetchTombstonedAtURIs(ctx, g.client, g.logger, tombstoneIndex, batch)
+		if err != nil {
+			g.logger.Metric("tombstone_guard.lookup_error_count", 1)
+			if g.mode == TombstoneGuardStrict {
+				return nil, fmt.Errorf("tombstone check against %s failed: %w", tombstoneIndex, err)
+			}
+			g.logger.Error("Tombstone check against %s failed, returning %d unchecked records: %v", tombstoneIndex, len(batch), err)
+			continue
+		}
+		for _, atURI := range found {
+			deleted[atURI] = true
+		}
+	}
+	return deleted, nil
+}
+
+// FilterTombstoned drops records whose at_uri has a tombstone in
+// tombstoneIndex, preserving order
+func FilterTombstoned[T any](ctx context.Context, g *TombstoneGuard, tombstoneIndex string, records []T, atURI func(T) string) ([]T, error) {
+	if g == nil || len(records) == 0 {
+		return records, nil
+	}
+	atURIs := make([]string, 0, len(records))
+	for _, record := range records {
+		atURIs = append(atURIs, atURI(record))
+	}
+	deleted, err := g.Deleted(ctx, tombstoneIndex, atURIs)
+	if err != nil {
+		return nil, err
+	}
+	if len(deleted) == 0 {
+		return records, nil
+	}
+	kept := make([]T, 0, len(records)-len(deleted))
+	for _, record := range records {
+		if deleted[atURI(record)] {
+			g.logger.Debug("Tombstone guard: dropped deleted record %s", atURI(record))
+			continue
+		}
+		kept = append(kept, record)
+	}
+	g.logger.Metric("tombstone_guard.dropped_count", float64(len(records)-len(kept)))
+	return kept, nil
+}
+
+// FetchTombstonedAtURIs returns the at_uris among atURIs that have a tombstone
+// in index. Callers should keep atURIs to a few thousand per call.
+func FetchTombstonedAtURIs(ctx context.Context, client *elasticsearch.Client, logger *IngestLogger, index string, atURIs []string) ([]string, error) {
+	if len(atURIs) == 0 {
+		return nil, nil
+	}
+
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"terms": map[string]interface{}{
+				"at_uri": atURIs,
+			},
+		},
+		"_source": []string{"at_uri"},
+		"size":    len(atURIs),
+	}
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	start := time.Now()
+	res, err := client.Search(
+		client.Search.WithContext(ctx),
+		client.Search.WithIndex(index),
+		client.Search.WithBody(bytes.NewReader(queryJSON)),
+	)
+	logger.Metric("es.fetch_tombstoned_at_uris.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("tombstone search request failed: %w", err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			logger.Error("Failed to close tombstone search response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("tombstone search request returned error: %s", res.String())
+	}
+
+	var response struct {
+		Hits struct {
+			Hits []struct {
+				Source struct {
+					AtURI string `json:"at_uri"`
+				} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse tombstone search response: %w", err)
+	}
+
+	found := make([]string, 0, len(response.Hits.Hits))
+	for _, hit := range response.Hits.Hits {
+		found = append(found, hit.Source.AtURI)
+	}
+	return found, nil
+}
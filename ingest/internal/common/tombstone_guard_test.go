@@ -0,0 +1,101 @@
+package common
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func tombstoneHandler(deleted ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		hits := make([]string, 0, len(deleted))
+		for _, atURI := range deleted {
+			hits = append(hits, `{"_source":{"at_uri":"`+atURI+`"}}`)
+		}
+		_, _ = w.Write([]byte(`{"hits":{"hits":[` + strings.Join(hits, ",") + `]}}`))
+	}
+}
+
+func failingTombstoneHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_, _ = w.Write([]byte(`{"error":"unavailable"}`))
+}
+
+func tombstoneTestAtURI(s string) string { return s }
+
+func TestNewTombstoneGuard_Modes(t *testing.T) {
+	client, srv := newMockESClient(t, tombstoneHandler())
+	defer srv.Close()
+
+	guard, err := NewTombstoneGuard(client, TombstoneGuardOff, NewLogger(false))
+	if err != nil || guard != nil {
+		t.Fatalf("expected a nil guard for off, got %v, %v", guard, err)
+	}
+	records := []string{"at://a"}
+	if kept, err := FilterTombstoned(context.Background(), guard, "post_tombstones", records, tombstoneTestAtURI); err != nil || len(kept) != 1 {
+		t.Errorf("a nil guard should keep everything, got %v, %v", kept, err)
+	}
+	if _, err := NewTombstoneGuard(client, "lenient", NewLogger(false)); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+	if _, err := NewTombstoneGuard(nil, TombstoneGuardStrict, NewLogger(false)); err == nil {
+		t.Error("expected an error without a client")
+	}
+}
+
+func TestFilterTombstoned_DropsDeleted(t *testing.T) {
+	var requested string
+	client, srv := newMockESClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		tombstoneHandler("at://b")(w, r)
+	}))
+	defer srv.Close()
+	logger := NewLogger(true)
+	mc := newMockMetricCollector()
+	logger.SetMetricCollector(mc)
+
+	guard, err := NewTombstoneGuard(client, TombstoneGuardStrict, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := FilterTombstoned(context.Background(), guard, "post_tombstones", []string{"at://a", "at://b", "at://c"}, tombstoneTestAtURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kept) != 2 || kept[0] != "at://a" || kept[1] != "at://c" {
+		t.Errorf("expected at://b to be dropped, got %v", kept)
+	}
+	if requested != "/post_tombstones/_search" {
+		t.Errorf("unexpected request path %s", requested)
+	}
+	records := mc.getRecords("tombstone_guard.dropped_count")
+	if len(records) != 1 || records[0] != 1 {
+		t.Errorf("expected one dropped record counted, got %+v", records)
+	}
+}
+
+func TestFilterTombstoned_LookupFailure(t *testing.T) {
+	client, srv := newMockESClient(t, http.HandlerFunc(failingTombstoneHandler))
+	defer srv.Close()
+	records := []string{"at://a", "at://b"}
+
+	filter, err := NewTombstoneGuard(client, TombstoneGuardFilter, NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := FilterTombstoned(context.Background(), filter, "post_tombstones", records, tombstoneTestAtURI)
+	if err != nil || len(kept) != 2 {
+		t.Errorf("filter mode should return unchecked records on lookup failure, got %v, %v", kept, err)
+	}
+
+	strict, err := NewTombstoneGuard(client, TombstoneGuardStrict, NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kept, err := FilterTombstoned(context.Background(), strict, "post_tombstones", records, tombstoneTestAtURI); err == nil {
+		t.Errorf("strict mode should fail on lookup failure, got %v", kept)
+	}
+}
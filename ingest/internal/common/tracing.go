@@ -0,0 +1,72 @@
+package common
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName names the tracer of every ingex span
+const tracerName = "greenearth/ingex"
+
+// NewTracerProvider exports spans over OTLP/gRPC to GE_OTLP_ENDPOINT and
+// installs itself, with W3C trace context propagation, as the global tracer
+// provider. Traces are sampled at GE_TRACE_SAMPLE_RATIO; spans whose parent
+// was sampled are always kept. It returns nil when GE_OTLP_ENDPOINT is unset,
+// leaving tracing disabled.
+func NewTracerProvider(ctx context.Context, serviceName string, config *Config) (*sdktrace.TracerProvider, error) {
+	if config.OTLPEndpoint == "" {
+		return nil, nil
+	}
+
+	exporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpointURL(config.OTLPEndpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+
+	res, err := resource.New(
+		ctx,
+		resource.WithAttributes(
+			semconv.ServiceName(serviceName),
+			semconv.ServiceNamespace(config.Environment),
+			semconv.CloudRegion(config.GCPRegion),
+			semconv.ServiceInstanceID(generateInstanceID()),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.TraceSampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider, nil
+}
+
+// StartSpan starts a span as a child of the span in ctx, if any. Without a
+// tracer provider the span is a no-op.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan records err, if any, on span and ends it
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,47 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestNewTracerProvider_DisabledWithoutEndpoint(t *testing.T) {
+	provider, err := NewTracerProvider(context.Background(), "test", &Config{})
+	if err != nil || provider != nil {
+		t.Fatalf("expected no provider without GE_OTLP_ENDPOINT, got %v, %v", provider, err)
+	}
+}
+
+func TestStartSpan_NestsAndRecordsErrors(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	ctx, parent := StartSpan(context.Background(), "megastream.process_file")
+	_, child := StartSpan(ctx, "es.bulk_index")
+	EndSpan(child, errors.New("bulk indexing failed"))
+	EndSpan(parent, nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 ended spans, got %d", len(spans))
+	}
+	bulk, file := spans[0], spans[1]
+	if bulk.Parent().SpanID() != file.SpanContext().SpanID() {
+		t.Error("expected the bulk span to be a child of the file span")
+	}
+	if bulk.Status().Code != codes.Error || len(bulk.Events()) != 1 {
+		t.Errorf("expected the bulk span to record its error, got status %v with %d events", bulk.Status(), len(bulk.Events()))
+	}
+	if file.Status().Code == codes.Error {
+		t.Error("expected the file span to end without an error")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build amd64 && !appengine && !noasm && gc
+
+package common
+
+// ZstdImplementation names the zstd decoder compiled into this binary.
+// klauspost/compress decodes with assembly on amd64 unless built with
+// -tags noasm; the conditions match its own build tags.
+const ZstdImplementation = "amd64 assembly"
@@ -0,0 +1,7 @@
+//go:build !amd64 || appengine || noasm || !gc
+
+package common
+
+// ZstdImplementation names the zstd decoder compiled into this binary (see
+// zstd_asm.go)
+const ZstdImplementation = "pure Go"
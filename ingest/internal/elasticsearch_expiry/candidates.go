@@ -0,0 +1,141 @@
+package elasticsearch_expiry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// CollectionCandidates describes what expiry would delete from one
+// collection: every document whose date field is older than CutoffDate
+type CollectionCandidates struct {
+	IndexAlias string    `json:"index_alias"`
+	DateField  string    `json:"date_field"`
+	CutoffDate time.Time `json:"cutoff_date"`
+	Count      int       `json:"count"`             // Documents older than the cutoff, including those in dropped indices
+	Indices    []string  `json:"indices,omitempty"` // Backing indices that would be dropped whole
+	Sample     []string  `json:"sample"`            // Randomly sampled at_uris (document IDs for collections without one)
+}
+
+// CandidateFile is the output of a dry run, reviewed before a confirmed run
+// executes it. A reviewer approves it by setting ApprovedBy; a confirmed run
+// deletes nothing outside the recorded cutoffs and indices, and nothing at all
+// from a collection holding more expired documents than were reviewed.
+type CandidateFile struct {
+	Environment string                 `json:"environment"`
+	CreatedAt   time.Time              `json:"created_at"`
+	ApprovedBy  string                 `json:"approved_by"`
+	Collections []CollectionCandidates `json:"collections"`
+}
+
+// Collection returns the candidates recorded for alias, or nil when the file
+// has none
+func (f *CandidateFile) Collection(alias string) *CollectionCandidates {
+	for i := range f.Collections {
+		if f.Collections[i].IndexAlias == alias {
+			return &f.Collections[i]
+		}
+	}
+	return nil
+}
+
+// Approved returns an error unless the file has been approved for environment
+func (f *CandidateFile) Approved(environment string) error {
+	if f.Environment != environment {
+		return fmt.Errorf("candidate file was created in %q, not %q", f.Environment, environment)
+	}
+	if strings.TrimSpace(f.ApprovedBy) == "" {
+		return fmt.Errorf("candidate file has not been approved (approved_by is empty)")
+	}
+	return nil
+}
+
+// WriteCandidateFile writes file as JSON to a local path or GCS
+// (gs://bucket/object)
+func WriteCandidateFile(ctx context.Context, path string, file *CandidateFile) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal candidate file: %w", err)
+	}
+
+	if !strings.HasPrefix(path, "gs://") {
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return fmt.Errorf("failed to write candidate file: %w", err)
+		}
+		return nil
+	}
+
+	bucket, object, err := parseGCSPath(path)
+	if err != nil {
+		return err
+	}
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	writer := client.Bucket(bucket).Object(object).NewWriter(ctx)
+	writer.ContentType = "application/json"
+	if _, err := writer.Write(data); err != nil {
+		_ = writer.Close()
+		return fmt.Errorf("failed to write candidate file to GCS: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to finalize candidate file in GCS: %w", err)
+	}
+	return nil
+}
+
+// ReadCandidateFile reads a file written by WriteCandidateFile
+func ReadCandidateFile(ctx context.Context, path string) (*CandidateFile, error) {
+	var data []byte
+	if strings.HasPrefix(path, "gs://") {
+		bucket, object, err := parseGCSPath(path)
+		if err != nil {
+			return nil, err
+		}
+		client, err := storage.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GCS client: %w", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		reader, err := client.Bucket(bucket).Object(object).NewReader(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open candidate file in GCS: %w", err)
+		}
+		defer func() { _ = reader.Close() }() // Best-effort close for read operation
+
+		data, err = io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read candidate file from GCS: %w", err)
+		}
+	} else {
+		var err error
+		data, err = os.ReadFile(path) //nolint:gosec // G304: path comes from a command line flag
+		if err != nil {
+			return nil, fmt.Errorf("failed to read candidate file: %w", err)
+		}
+	}
+
+	var file CandidateFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse candidate file %s: %w", path, err)
+	}
+	return &file, nil
+}
+
+func parseGCSPath(path string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "gs://"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid GCS path format: %s (expected gs://bucket/object)", path)
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,85 @@
+package elasticsearch_expiry
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func TestCandidateFile_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "candidates.json")
+	cutoff := time.Date(2026, 8, 1, 0, 0, 0, 0, time.UTC)
+	file := &CandidateFile{
+		Environment: "prod",
+		CreatedAt:   cutoff.Add(time.Hour),
+		Collections: []CollectionCandidates{{
+			IndexAlias: "hashtags",
+			DateField:  "hour",
+			CutoffDate: cutoff,
+			Count:      42,
+			Indices:    []string{"hashtags-2026-06"},
+			Sample:     []string{"bluesky-2026-06-01T00"},
+		}},
+	}
+	if err := WriteCandidateFile(context.Background(), path, file); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadCandidateFile(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := read.Collection("hashtags")
+	if got == nil || got.Count != 42 || !got.CutoffDate.Equal(cutoff) || len(got.Indices) != 1 || len(got.Sample) != 1 {
+		t.Fatalf("unexpected candidates after round trip: %+v", got)
+	}
+	if read.Collection("posts") != nil {
+		t.Error("expected no candidates for a collection not in the file")
+	}
+
+	if err := read.Approved("prod"); err == nil {
+		t.Error("expected an unapproved file to be refused")
+	}
+	read.ApprovedBy = "reviewer@greenearth.social"
+	if err := read.Approved("stage"); err == nil {
+		t.Error("expected a file from another environment to be refused")
+	}
+	if err := read.Approved("prod"); err != nil {
+		t.Errorf("expected an approved file to be accepted, got %v", err)
+	}
+}
+
+func TestExpireApproved_RefusesUnreviewedDocuments(t *testing.T) {
+	deletes := 0
+	client := estest.NewClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_count"):
+			_, _ = w.Write([]byte(`{"count":50}`))
+		case strings.HasSuffix(r.URL.Path, "/_delete_by_query") || r.Method == http.MethodDelete:
+			deletes++
+			_, _ = w.Write([]byte(`{"deleted":50}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	})
+
+	service := NewService(client, Config{}, common.NewLogger(false))
+	_, err := service.ExpireApproved(context.Background(), CollectionCandidates{
+		IndexAlias: "hashtags",
+		DateField:  "hour",
+		CutoffDate: time.Now().UTC().Add(-72 * time.Hour),
+		Count:      40,
+	})
+	if err == nil {
+		t.Fatal("expected an error when more documents are expired than were approved")
+	}
+	if deletes != 0 {
+		t.Errorf("expected no deletions, got %d", deletes)
+	}
+}
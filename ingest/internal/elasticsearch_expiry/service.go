@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -22,6 +24,7 @@ type Collection struct {
 type Config struct {
 	CutoffDate time.Time // Documents older than this date will be deleted
 	DryRun     bool      // If true, only count documents without deleting
+	SampleSize int       // Candidates sampled by Plan (default 100)
 }
 
 // Service handles expiration of documents from Elasticsearch
@@ -33,6 +36,9 @@ type Service struct {
 
 // NewService creates a new expiry service
 func NewService(client *elasticsearch.Client, config Config, logger *common.IngestLogger) *Service {
+	if config.SampleSize <= 0 {
+		config.SampleSize = 100
+	}
 	return &Service{
 		client: client,
 		config: config,
@@ -40,33 +46,296 @@ func NewService(client *elasticsearch.Client, config Config, logger *common.Inge
 	}
 }
 
-// ExpireCollection removes expired documents from a specific collection
+// ExpireCollection removes expired documents from a specific collection.
+// Backing indices whose newest document is older than the cutoff are dropped
+// whole; delete-by-query only handles what remains.
 func (s *Service) ExpireCollection(ctx context.Context, collection Collection) (int, error) {
 	s.logger.Info("Starting expiry for collection: %s", collection.IndexAlias)
 
+	droppedDocs, err := s.dropExpiredIndices(ctx, collection)
+	if err != nil {
+		return 0, err
+	}
+
 	if s.config.DryRun {
-		// In dry-run mode, count documents that would be deleted
+		// In dry-run mode, count documents that would be deleted (including
+		// those in indices that would be dropped)
 		return s.countExpiredDocuments(ctx, collection)
 	}
 
 	// Use Delete By Query API for efficient deletion
-	return s.deleteExpiredDocuments(ctx, collection)
+	deleted, err := s.deleteExpiredDocuments(ctx, collection)
+	return droppedDocs + deleted, err
+}
+
+// Plan returns what ExpireCollection would delete from collection, with a
+// random sample of the candidate documents. Nothing is deleted.
+func (s *Service) Plan(ctx context.Context, collection Collection) (*CollectionCandidates, error) {
+	expired, err := s.expiredIndices(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	count, err := s.countExpired(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	sample, err := s.sampleExpired(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &CollectionCandidates{
+		IndexAlias: collection.IndexAlias,
+		DateField:  collection.DateField,
+		CutoffDate: s.config.CutoffDate,
+		Count:      count,
+		Indices:    make([]string, 0, len(expired)),
+		Sample:     sample,
+	}
+	for _, index := range expired {
+		plan.Indices = append(plan.Indices, index.name)
+	}
+	s.logger.Info("Dry-run: Would delete %d documents from %s (%d whole indices, %d sampled)",
+		count, collection.IndexAlias, len(plan.Indices), len(sample))
+	return plan, nil
+}
+
+// ExpireApproved deletes the documents of an approved plan: those older than
+// its cutoff, dropping only the backing indices it lists. It refuses to
+// delete anything when the collection now holds more documents older than the
+// cutoff than the plan counted, since those were never reviewed. The plan's
+// cutoff replaces the service's.
+func (s *Service) ExpireApproved(ctx context.Context, approved CollectionCandidates) (int, error) {
+	collection := Collection{IndexAlias: approved.IndexAlias, DateField: approved.DateField}
+	s.config.CutoffDate = approved.CutoffDate
+	s.logger.Info("Starting approved expiry for collection: %s (cutoff %s, %d approved documents)",
+		collection.IndexAlias, approved.CutoffDate.Format(time.RFC3339), approved.Count)
+
+	count, err := s.countExpired(ctx, collection)
+	if err != nil {
+		return 0, err
+	}
+	if count > approved.Count {
+		return 0, fmt.Errorf("%s holds %d documents older than %s but only %d were approved; run a new dry run",
+			collection.IndexAlias, count, approved.CutoffDate.Format(time.RFC3339), approved.Count)
+	}
+	if s.config.DryRun {
+		s.logger.Info("Dry-run: Would delete %d approved documents from %s", count, collection.IndexAlias)
+		return count, nil
+	}
+
+	allowed := make(map[string]bool, len(approved.Indices))
+	for _, index := range approved.Indices {
+		allowed[index] = true
+	}
+	expired, err := s.expiredIndices(ctx, collection)
+	if err != nil {
+		return 0, err
+	}
+	dropped := 0
+	for _, index := range expired {
+		if !allowed[index.name] {
+			s.logger.Info("Not dropping index %s: not in the approved candidates", index.name)
+			continue
+		}
+		docs, err := s.dropIndex(ctx, index)
+		if err != nil {
+			return dropped, err
+		}
+		dropped += docs
+	}
+
+	deleted, err := s.deleteExpiredDocuments(ctx, collection)
+	return dropped + deleted, err
+}
+
+// expiredIndex is a backing index whose documents are all older than the
+// cutoff
+type expiredIndex struct {
+	name   string
+	docs   int
+	newest time.Time
+}
+
+// dropExpiredIndices deletes every backing index of the collection's alias
+// whose documents are all older than the cutoff, and returns how many
+// documents they held
+func (s *Service) dropExpiredIndices(ctx context.Context, collection Collection) (int, error) {
+	expired, err := s.expiredIndices(ctx, collection)
+	if err != nil {
+		return 0, err
+	}
+
+	dropped := 0
+	for _, index := range expired {
+		if s.config.DryRun {
+			s.logger.Info("Dry-run: Would drop index %s (%d documents, newest %s)", index.name, index.docs, index.newest.Format(time.RFC3339))
+			continue
+		}
+		docs, err := s.dropIndex(ctx, index)
+		if err != nil {
+			return dropped, err
+		}
+		dropped += docs
+	}
+	return dropped, nil
+}
+
+// expiredIndices returns the backing indices of the collection's alias whose
+// documents are all older than the cutoff. The write index of the alias and
+// of its write alias is never returned, even when empty.
+func (s *Service) expiredIndices(ctx context.Context, collection Collection) ([]expiredIndex, error) {
+	members, err := common.AliasIndices(ctx, s.client, collection.IndexAlias, s.logger)
+	if err != nil {
+		return nil, err
+	}
+	writeMembers, err := common.AliasIndices(ctx, s.client, common.WriteAlias(collection.IndexAlias), s.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	indices := make([]string, 0, len(members))
+	for index, isWrite := range members {
+		if _, writing := writeMembers[index]; !isWrite && !writing {
+			indices = append(indices, index)
+		}
+	}
+	sort.Strings(indices)
+
+	var expired []expiredIndex
+	for _, index := range indices {
+		docs, newest, err := s.indexExtent(ctx, index, collection.DateField)
+		if err != nil {
+			return nil, err
+		}
+		if docs > 0 && !newest.Before(s.config.CutoffDate) {
+			continue
+		}
+		expired = append(expired, expiredIndex{name: index, docs: docs, newest: newest})
+	}
+	return expired, nil
+}
+
+// dropIndex deletes an expired index and returns how many documents it held
+func (s *Service) dropIndex(ctx context.Context, index expiredIndex) (int, error) {
+	if err := s.deleteIndex(ctx, index.name); err != nil {
+		return 0, err
+	}
+	s.logger.Info("Dropped expired index %s (%d documents, newest %s)", index.name, index.docs, index.newest.Format(time.RFC3339))
+	s.logger.Metric("expiry.dropped_indices_count", 1)
+	s.logger.Audit(ctx, common.AuditEntry{
+		Operation: common.AuditDropIndex,
+		Target:    index.name,
+		Detail:    fmt.Sprintf("newest %s before cutoff %s", index.newest.Format(time.RFC3339), s.config.CutoffDate.Format(time.RFC3339)),
+		Count:     int64(index.docs),
+	})
+	return index.docs, nil
+}
+
+// indexExtent returns the number of documents in index and the newest value
+// of dateField among them
+func (s *Service) indexExtent(ctx context.Context, index, dateField string) (int, time.Time, error) {
+	query := map[string]interface{}{
+		"size":             0,
+		"track_total_hits": true,
+		"aggs": map[string]interface{}{
+			"newest": map[string]interface{}{
+				"max": map[string]interface{}{"field": dateField},
+			},
+		},
+	}
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to marshal extent query: %w", err)
+	}
+
+	res, err := s.client.Search(
+		s.client.Search.WithContext(ctx),
+		s.client.Search.WithIndex(index),
+		s.client.Search.WithBody(strings.NewReader(string(queryJSON))),
+	)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to query extent of %s: %w", index, err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			s.logger.Error("Failed to close extent response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		body, _ := io.ReadAll(res.Body)
+		return 0, time.Time{}, fmt.Errorf("extent query for %s failed: %s - %s", index, res.Status(), string(body))
+	}
+
+	var response struct {
+		Hits struct {
+			Total struct {
+				Value int `json:"value"`
+			} `json:"total"`
+		} `json:"hits"`
+		Aggregations struct {
+			Newest struct {
+				Value *float64 `json:"value"` // Epoch milliseconds; null for an empty index
+			} `json:"newest"`
+		} `json:"aggregations"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to parse extent response: %w", err)
+	}
+
+	var newest time.Time
+	if response.Aggregations.Newest.Value != nil {
+		newest = time.UnixMilli(int64(*response.Aggregations.Newest.Value)).UTC()
+	}
+	return response.Hits.Total.Value, newest, nil
+}
+
+func (s *Service) deleteIndex(ctx context.Context, index string) error {
+	res, err := s.client.Indices.Delete([]string{index}, s.client.Indices.Delete.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to delete index %s: %w", index, err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			s.logger.Error("Failed to close delete index response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		body, _ := io.ReadAll(res.Body)
+		return fmt.Errorf("delete index %s failed: %s - %s", index, res.Status(), string(body))
+	}
+	return nil
 }
 
 // countExpiredDocuments counts how many documents would be deleted (for dry-run mode)
 func (s *Service) countExpiredDocuments(ctx context.Context, collection Collection) (int, error) {
-	cutoffDateStr := s.config.CutoffDate.Format(time.RFC3339)
+	count, err := s.countExpired(ctx, collection)
+	if err != nil {
+		return 0, err
+	}
+	s.logger.Info("Dry-run: Would delete %d documents from %s", count, collection.IndexAlias)
+	return count, nil
+}
 
-	// Build the count query
-	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"range": map[string]interface{}{
-				collection.DateField: map[string]interface{}{
-					"lt": cutoffDateStr,
-				},
+// expiredQuery matches the collection's documents older than the cutoff
+func (s *Service) expiredQuery(collection Collection) map[string]interface{} {
+	return map[string]interface{}{
+		"range": map[string]interface{}{
+			collection.DateField: map[string]interface{}{
+				"lt": s.config.CutoffDate.Format(time.RFC3339),
 			},
 		},
 	}
+}
+
+// countExpired counts the collection's documents older than the cutoff
+func (s *Service) countExpired(ctx context.Context, collection Collection) (int, error) {
+	// Build the count query
+	query := map[string]interface{}{
+		"query": s.expiredQuery(collection),
+	}
 
 	queryJSON, err := json.Marshal(query)
 	if err != nil {
@@ -103,24 +372,77 @@ func (s *Service) countExpiredDocuments(ctx context.Context, collection Collecti
 	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
 		return 0, fmt.Errorf("failed to parse count response: %w", err)
 	}
-
-	s.logger.Info("Dry-run: Would delete %d documents from %s", response.Count, collection.IndexAlias)
 	return response.Count, nil
 }
 
-// deleteExpiredDocuments uses the Delete By Query API to efficiently delete expired documents
-func (s *Service) deleteExpiredDocuments(ctx context.Context, collection Collection) (int, error) {
-	cutoffDateStr := s.config.CutoffDate.Format(time.RFC3339)
-
-	// Build the delete by query request
+// sampleExpired returns the at_uris of up to SampleSize randomly chosen
+// documents older than the cutoff. Documents without an at_uri, such as
+// hashtag buckets, are identified by their document ID.
+func (s *Service) sampleExpired(ctx context.Context, collection Collection) ([]string, error) {
 	query := map[string]interface{}{
+		"size": s.config.SampleSize,
 		"query": map[string]interface{}{
-			"range": map[string]interface{}{
-				collection.DateField: map[string]interface{}{
-					"lt": cutoffDateStr,
-				},
+			"function_score": map[string]interface{}{
+				"query":        s.expiredQuery(collection),
+				"random_score": map[string]interface{}{},
 			},
 		},
+		"_source": []string{"at_uri"},
+	}
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal sample query: %w", err)
+	}
+
+	res, err := s.client.Search(
+		s.client.Search.WithContext(ctx),
+		s.client.Search.WithIndex(collection.IndexAlias),
+		s.client.Search.WithBody(strings.NewReader(string(queryJSON))),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample %s: %w", collection.IndexAlias, err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			s.logger.Error("Failed to close sample response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		body, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("sample query for %s failed: %s - %s", collection.IndexAlias, res.Status(), string(body))
+	}
+
+	var response struct {
+		Hits struct {
+			Hits []struct {
+				ID     string `json:"_id"`
+				Source struct {
+					AtURI string `json:"at_uri"`
+				} `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse sample response: %w", err)
+	}
+
+	sample := make([]string, 0, len(response.Hits.Hits))
+	for _, hit := range response.Hits.Hits {
+		if hit.Source.AtURI != "" {
+			sample = append(sample, hit.Source.AtURI)
+		} else {
+			sample = append(sample, hit.ID)
+		}
+	}
+	return sample, nil
+}
+
+// deleteExpiredDocuments uses the Delete By Query API to efficiently delete expired documents
+func (s *Service) deleteExpiredDocuments(ctx context.Context, collection Collection) (int, error) {
+	// Build the delete by query request
+	query := map[string]interface{}{
+		"query": s.expiredQuery(collection),
 		// Add conflicts handling - proceed even if there are version conflicts
 		"conflicts": "proceed",
 	}
@@ -171,6 +493,12 @@ func (s *Service) deleteExpiredDocuments(ctx context.Context, collection Collect
 	// Log operation details
 	s.logger.Info("Delete by query completed for %s: deleted=%d, took=%dms, conflicts=%d",
 		collection.IndexAlias, response.Deleted, response.Took, response.VersionConflicts)
+	s.logger.Audit(ctx, common.AuditEntry{
+		Operation: common.AuditDeleteByQuery,
+		Target:    collection.IndexAlias,
+		Detail:    string(queryJSON),
+		Count:     int64(response.Deleted),
+	})
 
 	if response.TimedOut {
 		s.logger.Error("Delete by query timed out for %s", collection.IndexAlias)
@@ -187,3 +515,69 @@ func (s *Service) deleteExpiredDocuments(ctx context.Context, collection Collect
 
 	return response.Deleted, nil
 }
+
+// ILMPolicies maps the ILM policies bootstrapped by index/deploy to the alias
+// whose retention they enforce. Expiry leaves these aliases to ILM.
+var ILMPolicies = map[string]string{
+	"posts_ilm_policy":      "posts",
+	"replies_ilm_policy":    "replies",
+	"likes_ilm_policy":      "likes",
+	"tombstones_ilm_policy": "post_tombstones",
+}
+
+// ILMDeleteAge returns the min_age of the delete phase of an ILM policy, or
+// zero when the policy has no delete phase
+func (s *Service) ILMDeleteAge(ctx context.Context, policy string) (time.Duration, error) {
+	res, err := s.client.ILM.GetLifecycle(
+		s.client.ILM.GetLifecycle.WithContext(ctx),
+		s.client.ILM.GetLifecycle.WithPolicy(policy),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get ILM policy %s: %w", policy, err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			s.logger.Error("Failed to close ILM policy response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		body, _ := io.ReadAll(res.Body)
+		return 0, fmt.Errorf("get ILM policy %s failed: %s - %s", policy, res.Status(), string(body))
+	}
+
+	var response map[string]struct {
+		Policy struct {
+			Phases struct {
+				Delete *struct {
+					MinAge string `json:"min_age"`
+				} `json:"delete"`
+			} `json:"phases"`
+		} `json:"policy"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return 0, fmt.Errorf("failed to parse ILM policy %s: %w", policy, err)
+	}
+	phases := response[policy].Policy.Phases
+	if phases.Delete == nil {
+		return 0, nil
+	}
+	return parseESDuration(phases.Delete.MinAge)
+}
+
+// parseESDuration parses an Elasticsearch time value such as "60d", "4h", or
+// "0ms"
+func parseESDuration(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time value %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time value %q", value)
+	}
+	return d, nil
+}
@@ -0,0 +1,72 @@
+package elasticsearch_expiry
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+// cutoff is 2025-06-10; likes-000001 is entirely older, likes-000002 straddles
+// the cutoff, and likes-000003 is the write index
+func expiryHandler(deleted *[]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/_alias/likes":
+			_, _ = w.Write([]byte(`{"likes-000001":{"aliases":{"likes":{}}},"likes-000002":{"aliases":{"likes":{}}},"likes-000003":{"aliases":{"likes":{}}}}`))
+		case r.URL.Path == "/_alias/likes-write":
+			_, _ = w.Write([]byte(`{"likes-000003":{"aliases":{"likes-write":{"is_write_index":true}}}}`))
+		case r.URL.Path == "/likes-000001/_search":
+			_, _ = w.Write([]byte(`{"hits":{"total":{"value":40}},"aggregations":{"newest":{"value":1749081600000}}}`)) // 2025-06-05
+		case r.URL.Path == "/likes-000002/_search":
+			_, _ = w.Write([]byte(`{"hits":{"total":{"value":25}},"aggregations":{"newest":{"value":1749859200000}}}`)) // 2025-06-14
+		case r.Method == http.MethodDelete:
+			*deleted = append(*deleted, r.URL.Path)
+			_, _ = w.Write([]byte(`{"acknowledged":true}`))
+		case strings.HasSuffix(r.URL.Path, "/_delete_by_query"):
+			_, _ = w.Write([]byte(`{"deleted":7,"took":5}`))
+		case strings.HasSuffix(r.URL.Path, "/_count"):
+			_, _ = w.Write([]byte(`{"count":47}`))
+		default:
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}
+}
+
+func TestExpireCollection_DropsWholeExpiredIndices(t *testing.T) {
+	var deleted []string
+	client := estest.NewClient(t, expiryHandler(&deleted))
+
+	service := NewService(client, Config{CutoffDate: time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)}, common.NewLogger(false))
+	count, err := service.ExpireCollection(context.Background(), Collection{IndexAlias: "likes", DateField: "created_at"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0] != "/likes-000001" {
+		t.Errorf("expected only likes-000001 to be dropped, got %v", deleted)
+	}
+	if count != 47 {
+		t.Errorf("expected 40 dropped + 7 deleted by query, got %d", count)
+	}
+}
+
+func TestExpireCollection_DryRunDropsNothing(t *testing.T) {
+	var deleted []string
+	client := estest.NewClient(t, expiryHandler(&deleted))
+
+	service := NewService(client, Config{CutoffDate: time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC), DryRun: true}, common.NewLogger(false))
+	count, err := service.ExpireCollection(context.Background(), Collection{IndexAlias: "likes", DateField: "created_at"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(deleted) != 0 {
+		t.Errorf("dry run must not delete indices, got %v", deleted)
+	}
+	if count != 47 {
+		t.Errorf("expected the count query result, got %d", count)
+	}
+}
@@ -0,0 +1,71 @@
+package embedding_backfill
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// ClientConfig configures the embedding service client
+type ClientConfig struct {
+	URL            string        // Embedding endpoint, e.g. http://minilm:8000/embed
+	APIKey         string        //nolint:gosec // G117: struct field name, not a secret value; sent as the X-API-Key header when set
+	Timeout        time.Duration // Per-request HTTP timeout
+	MaxRetries     int           // Retries beyond the first attempt
+	RetryBaseDelay time.Duration // Base delay for exponential backoff
+}
+
+// Client is an HTTP client for a sentence embedding service. The service
+// takes {"texts": [...]} and returns {"embeddings": [[...], ...]}, one
+// embedding per text, in order.
+type Client struct {
+	endpoint *common.JSONClient
+	logger   *common.IngestLogger
+}
+
+// NewClient creates a new embedding service client
+func NewClient(config ClientConfig, logger *common.IngestLogger) *Client {
+	return &Client{
+		endpoint: common.NewJSONClient("embedding service", common.JSONClientConfig{
+			URL:            config.URL,
+			APIKey:         config.APIKey,
+			Timeout:        config.Timeout,
+			MaxRetries:     config.MaxRetries,
+			RetryBaseDelay: config.RetryBaseDelay,
+		}, logger),
+		logger: logger,
+	}
+}
+
+type embedRequest struct {
+	Texts []string `json:"texts"`
+}
+
+type embedResponse struct {
+	Embeddings [][]float32 `json:"embeddings"`
+}
+
+// Embed returns the embedding of each text, in input order. Retries
+// transport errors, 429s and 5xx responses with exponential backoff; other
+// 4xx responses fail immediately.
+func (c *Client) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return [][]float32{}, nil
+	}
+	start := time.Now()
+	var response embedResponse
+	err := c.endpoint.Post(ctx, embedRequest{Texts: texts}, &response)
+	c.logger.Metric("embedding_backfill.embed.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		c.logger.Metric("embedding_backfill.embed_error_count", 1)
+		return nil, err
+	}
+	embeddings := response.Embeddings
+	if len(embeddings) != len(texts) {
+		c.logger.Metric("embedding_backfill.embed_error_count", 1)
+		return nil, fmt.Errorf("embedding count mismatch: got %d embeddings for %d texts", len(embeddings), len(texts))
+	}
+	return embeddings, nil
+}
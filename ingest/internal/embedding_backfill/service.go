@@ -0,0 +1,312 @@
+// Package embedding_backfill gives embeddings to the fallback posts
+// jetstream_ingest indexes straight from Jetstream (see
+// common.PostSourceJetstream). Those posts arrive without the content
+// embeddings megastream carries, so vector search and the recommender miss
+// them. The service scans the posts index for fallback posts missing an
+// embedding, embeds their content with a sentence embedding service, and
+// updates the posts in place, along with their post-tower embedding when
+// an inference service is configured.
+package embedding_backfill
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/inference"
+)
+
+// Defaults for Config
+const (
+	DefaultIndex    = "posts"
+	DefaultModel    = "all_MiniLM_L12_v2"
+	DefaultPageSize = 64
+)
+
+// embeddingScript adds the embeddings in params to a post that is still a
+// fallback post. Megastream may have replaced the post since it was read,
+// with embeddings of its own, which are left alone.
+const embeddingScript = "if (ctx._source.source != params.source) { ctx.op = 'noop'; return; } " +
+	"if (ctx._source.embeddings == null) { ctx._source.embeddings = [:]; } " +
+	"ctx._source.embeddings.putAll(params.embeddings); " +
+	"if (params.model_uuid != '') { ctx._source.ge_post_embedding_model_uuid = params.model_uuid; }"
+
+// Config holds configuration for the backfill service
+type Config struct {
+	Index    string // Posts alias to scan and update (default posts)
+	Model    string // Embeddings field the embedding service's output is stored under (default all_MiniLM_L12_v2)
+	PageSize int    // Posts read, embedded, and updated at a time (default 64)
+	DryRun   bool   // Count the posts missing embeddings without embedding or updating them
+}
+
+// Embedder embeds texts, returning one embedding per text in order. *Client
+// is the production Embedder.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// Result accounts for one pass over the fallback posts
+type Result struct {
+	Scanned   int // Fallback posts found missing an embedding
+	Updated   int // Posts given an embedding
+	PostTower int // Posts also given a post-tower embedding
+	Skipped   int // Posts megastream replaced, or that were deleted, before the update
+	Failed    int // Posts whose embedding or update failed; the next pass retries them
+}
+
+// Service backfills embeddings of fallback posts
+type Service struct {
+	client    *elasticsearch.Client
+	embedder  Embedder
+	postTower *inference.BatchEmbedder
+	config    Config
+	logger    *common.IngestLogger
+}
+
+// NewService creates a new backfill service. postTower may be nil, leaving
+// posts without post-tower embeddings.
+func NewService(client *elasticsearch.Client, embedder Embedder, postTower *inference.BatchEmbedder, config Config, logger *common.IngestLogger) *Service {
+	if config.Index == "" {
+		config.Index = DefaultIndex
+	}
+	if config.Model == "" {
+		config.Model = DefaultModel
+	}
+	if config.PageSize <= 0 {
+		config.PageSize = DefaultPageSize
+	}
+	return &Service{
+		client:    client,
+		embedder:  embedder,
+		postTower: postTower,
+		config:    config,
+		logger:    logger,
+	}
+}
+
+// postHit is a fallback post read by the scan
+type postHit struct {
+	Index  string `json:"_index"`
+	ID     string `json:"_id"`
+	Source struct {
+		AtURI     string `json:"at_uri"`
+		AuthorDID string `json:"author_did"`
+		Content   string `json:"content"`
+	} `json:"_source"`
+	Sort []interface{} `json:"sort"`
+}
+
+// Run makes one pass over the fallback posts missing an embedding, oldest
+// indexed first. A page whose embedding fails is counted as failed and left
+// for the next pass; an Elasticsearch failure ends the pass.
+func (s *Service) Run(ctx context.Context) (Result, error) {
+	start := time.Now()
+	var result Result
+	var after []interface{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		page, err := s.fetchPage(ctx, after)
+		if err != nil {
+			return result, err
+		}
+		if len(page) == 0 {
+			break
+		}
+		after = page[len(page)-1].Sort
+		result.Scanned += len(page)
+		if !s.config.DryRun {
+			if err := s.backfillPage(ctx, page, &result); err != nil {
+				return result, err
+			}
+		}
+		if len(page) < s.config.PageSize {
+			break
+		}
+	}
+
+	s.logger.Metric("embedding_backfill.run.duration_ms", float64(time.Since(start).Milliseconds()))
+	s.logger.Metric("embedding_backfill.scanned_count", float64(result.Scanned))
+	s.logger.Metric("embedding_backfill.updated_count", float64(result.Updated))
+	s.logger.Metric("embedding_backfill.skipped_count", float64(result.Skipped))
+	s.logger.Metric("embedding_backfill.failed_count", float64(result.Failed))
+	return result, nil
+}
+
+// fetchPage returns the next page of fallback posts missing an embedding
+// after the sort values after, or the first page if after is nil
+func (s *Service) fetchPage(ctx context.Context, after []interface{}) ([]postHit, error) {
+	query := map[string]interface{}{
+		"size":    s.config.PageSize,
+		"_source": []string{"at_uri", "author_did", "content"},
+		"query": map[string]interface{}{
+			"bool": map[string]interface{}{
+				"filter": []interface{}{
+					map[string]interface{}{"term": map[string]interface{}{"source": common.PostSourceJetstream}},
+				},
+				"must_not": []interface{}{
+					map[string]interface{}{"exists": map[string]interface{}{"field": "embeddings." + s.config.Model}},
+				},
+			},
+		},
+		"sort": []interface{}{
+			map[string]interface{}{"indexed_at": "asc"},
+			map[string]interface{}{"at_uri": "asc"},
+		},
+	}
+	if after != nil {
+		query["search_after"] = after
+	}
+	body, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal fallback post query: %w", err)
+	}
+
+	start := time.Now()
+	res, err := s.client.Search(
+		s.client.Search.WithContext(ctx),
+		s.client.Search.WithIndex(s.config.Index),
+		s.client.Search.WithBody(bytes.NewReader(body)),
+	)
+	s.logger.Metric("es.search_fallback_posts.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("fallback post search failed: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.IsError() {
+		errBody, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("fallback post search returned error: %s - %s", res.Status(), string(errBody))
+	}
+
+	var response struct {
+		Hits struct {
+			Hits []postHit `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse fallback post search response: %w", err)
+	}
+	return response.Hits.Hits, nil
+}
+
+// backfillPage embeds the content of page's posts and updates them
+func (s *Service) backfillPage(ctx context.Context, page []postHit, result *Result) error {
+	texts := make([]string, len(page))
+	for i, hit := range page {
+		texts[i] = hit.Source.Content
+	}
+	embeddings, err := s.embedder.Embed(ctx, texts)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.logger.Error("Failed to embed %d fallback posts, leaving them for the next pass: %v", len(page), err)
+		result.Failed += len(page)
+		return nil
+	}
+
+	docs := make([]common.PostDoc, len(page))
+	for i, hit := range page {
+		docs[i] = common.PostDoc{
+			AtURI:      hit.Source.AtURI,
+			AuthorDID:  hit.Source.AuthorDID,
+			Embeddings: map[string]common.Float32Array{s.config.Model: embeddings[i]},
+		}
+	}
+	postTower, _, _ := inference.AttachPostTowerEmbeddings(ctx, s.postTower, docs)
+	result.PostTower += postTower
+
+	updated, skipped, failed, err := s.update(ctx, page, docs)
+	result.Updated += updated
+	result.Skipped += skipped
+	result.Failed += failed
+	return err
+}
+
+// update writes the embeddings of docs to the posts of page, and returns
+// how many were updated, skipped, and failed
+func (s *Service) update(ctx context.Context, page []postHit, docs []common.PostDoc) (updated, skipped, failed int, err error) {
+	var buf bytes.Buffer
+	for i, hit := range page {
+		meta := map[string]interface{}{
+			"update": map[string]interface{}{
+				"_index":  hit.Index,
+				"_id":     hit.ID,
+				"routing": hit.Source.AuthorDID,
+			},
+		}
+		update := map[string]interface{}{
+			"script": map[string]interface{}{
+				"source": embeddingScript,
+				"params": map[string]interface{}{
+					"source":     common.PostSourceJetstream,
+					"embeddings": docs[i].Embeddings,
+					"model_uuid": docs[i].PostEmbeddingModelUUID,
+				},
+				"lang": "painless",
+			},
+		}
+		for _, line := range []interface{}{meta, update} {
+			lineJSON, err := json.Marshal(line)
+			if err != nil {
+				return 0, 0, 0, fmt.Errorf("failed to marshal embedding update: %w", err)
+			}
+			buf.Write(lineJSON)
+			buf.WriteByte('\n')
+		}
+	}
+
+	start := time.Now()
+	res, err := s.client.Bulk(
+		bytes.NewReader(buf.Bytes()),
+		s.client.Bulk.WithContext(ctx),
+	)
+	s.logger.Metric("es.update_embeddings.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("bulk request failed: %w", err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	if res.IsError() {
+		return 0, 0, 0, fmt.Errorf("bulk request returned error: %s", res.String())
+	}
+
+	var bulkResponse struct {
+		Items []map[string]struct {
+			Status int    `json:"status"`
+			Result string `json:"result"`
+			Error  *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&bulkResponse); err != nil {
+		return 0, 0, 0, fmt.Errorf("failed to parse bulk response: %w", err)
+	}
+	for _, item := range bulkResponse.Items {
+		for _, result := range item {
+			switch {
+			case result.Status == http.StatusNotFound:
+				skipped++
+			case result.Error != nil:
+				failed++
+				s.logger.Debug("Embedding update failed: %s: %s", result.Error.Type, result.Error.Reason)
+			case result.Result == "noop":
+				skipped++
+			default:
+				updated++
+			}
+		}
+	}
+	if failed > 0 {
+		s.logger.Error("Failed to update embeddings of %d of %d fallback posts, leaving them for the next pass", failed, len(page))
+	}
+	return updated, skipped, failed, nil
+}
@@ -0,0 +1,171 @@
+package embedding_backfill
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+// embedFunc is an Embedder calling a function
+type embedFunc func(texts []string) ([][]float32, error)
+
+func (f embedFunc) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return f(texts)
+}
+
+// newBackfillTestServer returns a server that runs the embedding script
+// like Elasticsearch: only fallback posts are given embeddings
+func newBackfillTestServer(t *testing.T) *estest.Server {
+	t.Helper()
+	es := estest.New(t)
+	es.Script(embeddingScript, func(source, params map[string]interface{}) {
+		if source["source"] != params["source"] {
+			return
+		}
+		embeddings, _ := source["embeddings"].(map[string]interface{})
+		if embeddings == nil {
+			embeddings = map[string]interface{}{}
+			source["embeddings"] = embeddings
+		}
+		for k, v := range params["embeddings"].(map[string]interface{}) {
+			embeddings[k] = v
+		}
+	})
+	return es
+}
+
+func putPost(es *estest.Server, rkey, source string, embedded bool) {
+	doc := map[string]interface{}{
+		"at_uri": "at://did:plc:a/app.bsky.feed.post/" + rkey, "author_did": "did:plc:a", "content": "post " + rkey,
+		"indexed_at": "2026-10-16T10:00:0" + rkey + "Z",
+	}
+	if source != "" {
+		doc["source"] = source
+	}
+	if embedded {
+		doc["embeddings"] = map[string]interface{}{DefaultModel: []float32{9}}
+	}
+	es.Put("posts", "at://did:plc:a/app.bsky.feed.post/"+rkey, doc)
+}
+
+func TestRun_EmbedsFallbackPosts(t *testing.T) {
+	es := newBackfillTestServer(t)
+	putPost(es, "1", common.PostSourceJetstream, false)
+	putPost(es, "2", common.PostSourceJetstream, false)
+	putPost(es, "3", common.PostSourceJetstream, false)
+	putPost(es, "4", common.PostSourceJetstream, true) // Already embedded
+	putPost(es, "5", "", false)                        // Megastream's
+
+	var embedded []string
+	embedder := embedFunc(func(texts []string) ([][]float32, error) {
+		embedded = append(embedded, texts...)
+		if texts[0] == "post 3" {
+			// Megastream replaces the post while its embedding is computed
+			putPost(es, "3", "", false)
+		}
+		out := make([][]float32, len(texts))
+		for i := range texts {
+			out[i] = []float32{float32(len(embedded) - len(texts) + i + 1)}
+		}
+		return out, nil
+	})
+	service := NewService(es.Client, embedder, nil, Config{PageSize: 2}, common.NewLogger(false))
+
+	result, err := service.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Scanned != 3 || len(embedded) != 3 || embedded[0] != "post 1" {
+		t.Errorf("expected the 3 fallback posts missing embeddings embedded in order, got %+v (%v)", result, embedded)
+	}
+	for rkey, want := range map[string]interface{}{"1": 1.0, "2": 2.0, "3": nil, "4": 9.0, "5": nil} {
+		doc, _ := es.Get("posts", "at://did:plc:a/app.bsky.feed.post/"+rkey)
+		var got interface{}
+		if embeddings, ok := doc["embeddings"].(map[string]interface{}); ok {
+			got = embeddings[DefaultModel].([]interface{})[0]
+		}
+		if got != want {
+			t.Errorf("post %s: expected embedding %v, got %v", rkey, want, got)
+		}
+	}
+	for _, item := range es.Calls(estest.APIBulk)[0].BulkItems() {
+		if item.Action != "update" || item.Routing != "did:plc:a" {
+			t.Errorf("expected routed updates, got %+v", item)
+		}
+	}
+
+	// A second pass finds nothing left to embed
+	if result, err := service.Run(context.Background()); err != nil || result.Scanned != 0 {
+		t.Errorf("expected nothing left, got %+v, %v", result, err)
+	}
+}
+
+func TestRun_DryRunAndEmbeddingFailures(t *testing.T) {
+	es := newBackfillTestServer(t)
+	putPost(es, "1", common.PostSourceJetstream, false)
+	putPost(es, "2", common.PostSourceJetstream, false)
+	putPost(es, "3", common.PostSourceJetstream, false)
+
+	calls := 0
+	embedder := embedFunc(func(texts []string) ([][]float32, error) {
+		calls++
+		return nil, errors.New("embedding service unavailable")
+	})
+	dryRun := NewService(es.Client, embedder, nil, Config{PageSize: 2, DryRun: true}, common.NewLogger(false))
+	if result, err := dryRun.Run(context.Background()); err != nil || result.Scanned != 3 || calls != 0 {
+		t.Errorf("expected 3 posts counted without embedding, got %+v, %v after %d calls", result, err, calls)
+	}
+
+	service := NewService(es.Client, embedder, nil, Config{PageSize: 2}, common.NewLogger(false))
+	result, err := service.Run(context.Background())
+	if err != nil || result.Failed != 3 || result.Updated != 0 || calls != 2 {
+		t.Errorf("expected every page failed and left, got %+v, %v after %d calls", result, err, calls)
+	}
+	if len(es.Calls(estest.APIBulk)) != 0 {
+		t.Error("expected no updates")
+	}
+}
+
+func TestClient_Embed(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var req embedRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || r.Header.Get("X-API-Key") != "key" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		resp := embedResponse{}
+		for i := range req.Texts {
+			resp.Embeddings = append(resp.Embeddings, []float32{float32(i)})
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewClient(ClientConfig{URL: server.URL, APIKey: "key", Timeout: time.Second, MaxRetries: 1, RetryBaseDelay: time.Millisecond}, common.NewLogger(false))
+	embeddings, err := client.Embed(context.Background(), []string{"a", "b"})
+	if err != nil || len(embeddings) != 2 || embeddings[1][0] != 1 || requests != 2 {
+		t.Errorf("expected 2 embeddings after a retry, got %v, %v after %d requests", embeddings, err, requests)
+	}
+
+	unauthorized := NewClient(ClientConfig{URL: server.URL, Timeout: time.Second, MaxRetries: 3}, common.NewLogger(false))
+	requests = 1
+	if _, err := unauthorized.Embed(context.Background(), []string{"a"}); err == nil || requests != 2 {
+		t.Errorf("expected a 400 not retried, got %v after %d requests", err, requests-1)
+	}
+	if embeddings, err := client.Embed(context.Background(), nil); err != nil || len(embeddings) != 0 {
+		t.Errorf("expected no request for no texts, got %v", err)
+	}
+}
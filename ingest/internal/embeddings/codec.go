@@ -24,6 +24,11 @@ import (
 	"strings"
 )
 
+// maxDecodedSize bounds the decompressed size of an embedding, far above
+// the largest model's (768 float32s), so a corrupt payload cannot inflate
+// into gigabytes
+const maxDecodedSize = 1 << 20
+
 const base85Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz!#$%&()*+-;<=>?@^_`{|}~"
 
 // decodeBase85RFC1924 decodes RFC 1924 base85 encoded data (used by Python's base64.b85decode)
@@ -128,8 +133,14 @@ func encodeBase85RFC1924(data []byte) (string, error) {
 	return output, nil
 }
 
-// Decode decodes a base85-encoded, zlib-compressed embedding string to a float32 array
+// Decode decodes a base85-encoded, zlib-compressed embedding string to a float32 array.
+// An empty string is an error, not an empty embedding, so that a missing
+// inference is not stored as one.
 func Decode(encoded string) ([]float32, error) {
+	if encoded == "" {
+		return nil, fmt.Errorf("empty embedding")
+	}
+
 	decoded, err := decodeBase85RFC1924(encoded)
 	if err != nil {
 		return nil, fmt.Errorf("base85 decode failed: %w", err)
@@ -143,10 +154,17 @@ func Decode(encoded string) ([]float32, error) {
 		_ = reader.Close() // Ignore error in cleanup
 	}()
 
-	decompressed, err := io.ReadAll(reader)
+	decompressed, err := io.ReadAll(io.LimitReader(reader, maxDecodedSize+1))
 	if err != nil {
 		return nil, fmt.Errorf("failed to read decompressed data: %w", err)
 	}
+	if len(decompressed) > maxDecodedSize {
+		return nil, fmt.Errorf("decompressed embedding exceeds %d bytes", maxDecodedSize)
+	}
+
+	if len(decompressed)%4 != 0 {
+		return nil, fmt.Errorf("decompressed embedding is %d bytes, not a whole number of float32s", len(decompressed))
+	}
 
 	floatCount := len(decompressed) / 4
 	floats := make([]float32, floatCount)
@@ -192,3 +210,87 @@ func Encode(floats []float32) (string, error) {
 
 	return encoded, nil
 }
+
+// EncodeFloat16 packs a float32 array as little-endian IEEE 754
+// half-precision floats, rounding to nearest even. Values beyond the
+// float16 range become infinities. NumPy reads the result with
+// np.frombuffer(data, dtype="<f2").
+func EncodeFloat16(floats []float32) []byte {
+	data := make([]byte, len(floats)*2)
+	for i, f := range floats {
+		binary.LittleEndian.PutUint16(data[i*2:], float16Bits(f))
+	}
+	return data
+}
+
+// DecodeFloat16 unpacks little-endian IEEE 754 half-precision floats to a
+// float32 array. This is the reverse of EncodeFloat16.
+func DecodeFloat16(data []byte) ([]float32, error) {
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("float16 data has odd length %d", len(data))
+	}
+	floats := make([]float32, len(data)/2)
+	for i := range floats {
+		floats[i] = float16ToFloat32(binary.LittleEndian.Uint16(data[i*2:]))
+	}
+	return floats, nil
+}
+
+// float16Bits returns the half-precision float nearest to f
+func float16Bits(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int32(bits>>23&0xff) - 127 + 15
+	mant := bits & 0x7fffff
+
+	switch {
+	case bits>>23&0xff == 0xff:
+		if mant != 0 {
+			return sign | 0x7e00 // NaN
+		}
+		return sign | 0x7c00
+	case exp >= 0x1f:
+		return sign | 0x7c00 // Overflows to infinity
+	case exp <= 0:
+		// Subnormal in float16, or too small and rounds to zero
+		if exp < -10 {
+			return sign
+		}
+		return sign | uint16(roundShift(mant|0x800000, uint32(14-exp)))
+	default:
+		// A carry out of the mantissa rounds up into the exponent
+		return sign | uint16(uint32(exp)<<10+roundShift(mant, 13))
+	}
+}
+
+// roundShift returns v shifted right by shift bits, rounded to nearest even
+func roundShift(v, shift uint32) uint32 {
+	half := uint32(1) << (shift - 1)
+	rem := v & (1<<shift - 1)
+	v >>= shift
+	if rem > half || (rem == half && v&1 == 1) {
+		v++
+	}
+	return v
+}
+
+// float16ToFloat32 returns the float32 equal to the half-precision float h
+func float16ToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+
+	switch exp {
+	case 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	case 0:
+		// Zero or subnormal: mant * 2^-24
+		f := float32(mant) / (1 << 24)
+		if sign != 0 {
+			f = -f
+		}
+		return f
+	default:
+		return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+	}
+}
@@ -0,0 +1,246 @@
+package embeddings
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+// TestBase85RFC1924MatchesPython tests decoding and encoding against output
+// recorded from Python's base64.b85encode, at every tail length
+func TestBase85RFC1924MatchesPython(t *testing.T) {
+	tests := []struct {
+		hex     string
+		encoded string
+	}{
+		{"90", "kN"},
+		{"a820", "s2~"},
+		{"c5640b", "#bgT"},
+		{"513fe1ee", "Q9t4C"},
+		{"d137a243cd", "(Kn()%>"},
+		{"d6a8ed346f49", ")~M|?Z%F"},
+		{"db1092afba8d20", "+Ypkkx{V+"},
+		{"dfc01423b0ef17acf8", "-@p_ju<sYF_y"},
+		{"124d38b1bc9168c04c8a5008f1", "5=}U<ypd?YOo~tl@c"},
+		{"ff060e3d", "{{{{{"},
+		{"ffffffff", "|NsC0"},
+	}
+	for _, tt := range tests {
+		data, _ := hex.DecodeString(tt.hex)
+		decoded, err := decodeBase85RFC1924(tt.encoded)
+		if err != nil {
+			t.Errorf("decodeBase85RFC1924(%q) error = %v", tt.encoded, err)
+		} else if !bytes.Equal(decoded, data) {
+			t.Errorf("decodeBase85RFC1924(%q) = %x, want %s", tt.encoded, decoded, tt.hex)
+		}
+		if encoded, _ := encodeBase85RFC1924(data); encoded != tt.encoded {
+			t.Errorf("encodeBase85RFC1924(%s) = %q, want %q", tt.hex, encoded, tt.encoded)
+		}
+	}
+
+	// Python rejects these as well
+	for _, encoded := range []string{"~~~~~", "abc\x00", "ab\"cd"} {
+		if _, err := decodeBase85RFC1924(encoded); err == nil {
+			t.Errorf("decodeBase85RFC1924(%q) expected an error", encoded)
+		}
+	}
+}
+
+// TestDecodeMatchesPython tests decoding embeddings recorded from the Python
+// encoder (struct.pack, zlib.compress, base64.b85encode), including extreme
+// and subnormal values
+func TestDecodeMatchesPython(t *testing.T) {
+	eighths := make([]float32, 17)
+	for i := range eighths {
+		eighths[i] = float32(i-8) / 8
+	}
+	tests := []struct {
+		encoded  string
+		expected []float32
+	}{
+		{"c${NkV6bOkXxInDE&vKW0zv", []float32{0.5, -0.25, 1024}},
+		{"c$|CpIEUf?|N8%o3=9kaFc$^8", []float32{1e-38, -math.MaxFloat32, math.SmallestNonzeroFloat32}},
+		{"c$^i=Q4Ihf48+h%K?$1_q)Zu18r>!D<B~!>I7%&{zEEP!wqGs6PN}1c5BGfx>i", eighths},
+	}
+	for _, tt := range tests {
+		decoded, err := Decode(tt.encoded)
+		if err != nil {
+			t.Fatalf("Decode(%q) error = %v", tt.encoded, err)
+		}
+		if !reflect.DeepEqual(decoded, tt.expected) {
+			t.Errorf("Decode(%q) = %v, want %v", tt.encoded, decoded, tt.expected)
+		}
+	}
+}
+
+// TestDecodeMalformed tests that malformed payloads fail with an error
+// naming the step that rejected them
+func TestDecodeMalformed(t *testing.T) {
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	_, _ = w.Write(make([]byte, maxDecodedSize+4))
+	_ = w.Close()
+	bomb, _ := encodeBase85RFC1924(compressed.Bytes())
+
+	tests := []struct {
+		name    string
+		encoded string
+		want    string
+	}{
+		{"empty", "", "empty embedding"},
+		{"not base85", "c${Nk\"", "base85 decode failed"},
+		{"not zlib", "NM&qnZ!92J", "zlib decompression failed"},
+		{"truncated", "c${NkXs~BsU~m8", "failed to read decompressed data"},
+		{"partial float", "c${NkXs~Al00IO6!2", "not a whole number of float32s"},
+		{"too large", bomb, "exceeds"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(tt.encoded)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Decode(%q) error = %v, want %q", tt.encoded, err, tt.want)
+			}
+		})
+	}
+}
+
+// TestBase85RFC1924RoundTripProperty tests round-tripping random bytes of
+// random lengths
+func TestBase85RFC1924RoundTripProperty(t *testing.T) {
+	roundTrips := func(data []byte) bool {
+		encoded, err := encodeBase85RFC1924(data)
+		if err != nil || len(encoded) != len(data)+(len(data)+3)/4 {
+			return false
+		}
+		decoded, err := decodeBase85RFC1924(encoded)
+		return err == nil && bytes.Equal(decoded, data)
+	}
+	config := &quick.Config{MaxCount: 2000, Rand: rand.New(rand.NewSource(85))}
+	if err := quick.Check(roundTrips, config); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestRoundTripProperty tests that random embeddings, including NaNs,
+// infinities, and subnormals, survive encoding bit for bit
+func TestRoundTripProperty(t *testing.T) {
+	roundTrips := func(bits []uint32) bool {
+		if len(bits) == 0 {
+			return true // Encode gives "", which Decode rejects
+		}
+		floats := make([]float32, len(bits))
+		for i, b := range bits {
+			floats[i] = math.Float32frombits(b)
+		}
+		encoded, err := Encode(floats)
+		if err != nil {
+			return false
+		}
+		decoded, err := Decode(encoded)
+		if err != nil || len(decoded) != len(floats) {
+			return false
+		}
+		for i := range decoded {
+			if math.Float32bits(decoded[i]) != bits[i] {
+				return false
+			}
+		}
+		return true
+	}
+	config := &quick.Config{MaxCount: 500, Rand: rand.New(rand.NewSource(1924))}
+	if err := quick.Check(roundTrips, config); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestFloat16RoundTripProperty tests that every value representable in
+// float16 survives EncodeFloat16 exactly
+func TestFloat16RoundTripProperty(t *testing.T) {
+	roundTrips := func(data []byte) bool {
+		if len(data)%2 != 0 {
+			data = data[:len(data)-1]
+		}
+		floats, err := DecodeFloat16(data)
+		if err != nil {
+			return false
+		}
+		again := EncodeFloat16(floats)
+		for i := 0; i < len(data); i += 2 {
+			h := uint16(data[i]) | uint16(data[i+1])<<8
+			got := uint16(again[i]) | uint16(again[i+1])<<8
+			if h&0x7c00 == 0x7c00 && h&0x3ff != 0 {
+				// NaN payloads are not preserved, only the sign and NaN-ness
+				if got&0x7c00 != 0x7c00 || got&0x3ff == 0 || got&0x8000 != h&0x8000 {
+					return false
+				}
+				continue
+			}
+			if got != h {
+				return false
+			}
+		}
+		return true
+	}
+	config := &quick.Config{MaxCount: 2000, Rand: rand.New(rand.NewSource(16))}
+	if err := quick.Check(roundTrips, config); err != nil {
+		t.Error(err)
+	}
+}
+
+// FuzzDecodeBase85RFC1924 checks that arbitrary input never panics, and that
+// whatever decodes re-encodes to input that decodes the same
+func FuzzDecodeBase85RFC1924(f *testing.F) {
+	for _, seed := range []string{"", "0", "kN", "s2~", "|NsC0", "{{{{{", "~~~~~", "abc\x00", "NM&qnZ!92JZ*pv8As|R^cOYSMWgvNPbs%(aWMO$f"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, encoded string) {
+		decoded, err := decodeBase85RFC1924(encoded)
+		if err != nil {
+			return
+		}
+		if want := len(encoded) * 4 / 5; len(decoded) != want {
+			t.Fatalf("decoded %d bytes from %d characters, want %d", len(decoded), len(encoded), want)
+		}
+		reencoded, err := encodeBase85RFC1924(decoded)
+		if err != nil {
+			t.Fatalf("encodeBase85RFC1924(%x) error = %v", decoded, err)
+		}
+		again, err := decodeBase85RFC1924(reencoded)
+		if err != nil || !bytes.Equal(again, decoded) {
+			t.Fatalf("re-decoding %q = %x, %v; want %x", reencoded, again, err, decoded)
+		}
+	})
+}
+
+// FuzzDecode checks that arbitrary input, such as a truncated or corrupted
+// inference payload, never panics, and that whatever decodes round-trips
+func FuzzDecode(f *testing.F) {
+	for _, seed := range []string{"", "c${NkXs~BsU~m8;2LK5}0e}", "c${Nk&~O3(0G0r2", "c${NkXs~BsU~m8", "c${NkXs~BsU~m8;2LK5}0e~", "not base85 \x00"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, encoded string) {
+		floats, err := Decode(encoded)
+		if err != nil || len(floats) == 0 {
+			return
+		}
+		reencoded, err := Encode(floats)
+		if err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+		again, err := Decode(reencoded)
+		if err != nil || len(again) != len(floats) {
+			t.Fatalf("re-decoding got %d floats, %v; want %d", len(again), err, len(floats))
+		}
+		for i := range again {
+			if math.Float32bits(again[i]) != math.Float32bits(floats[i]) {
+				t.Fatalf("index %d: got %v, want %v", i, again[i], floats[i])
+			}
+		}
+	})
+}
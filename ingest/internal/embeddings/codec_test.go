@@ -348,3 +348,60 @@ func floatsAlmostEqual(a, b float32) bool {
 	}
 	return diff < epsilon
 }
+
+// TestEncodeFloat16 tests half-precision packing against known bit patterns
+func TestEncodeFloat16(t *testing.T) {
+	tests := []struct {
+		f    float32
+		bits uint16
+	}{
+		{0, 0x0000},
+		{float32(math.Copysign(0, -1)), 0x8000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{0.1, 0x2e66},
+		{65504, 0x7bff},                         // Largest float16
+		{65520, 0x7c00},                         // Rounds up to infinity
+		{float32(math.Pow(2, -14)), 0x0400},     // Smallest normal
+		{float32(math.Pow(2, -24)), 0x0001},     // Smallest subnormal
+		{float32(math.Pow(2, -26)), 0x0000},     // Rounds to zero
+		{1 + float32(math.Pow(2, -11)), 0x3c00}, // Tie rounds to even
+		{float32(math.Inf(-1)), 0xfc00},
+	}
+	for _, tt := range tests {
+		data := EncodeFloat16([]float32{tt.f})
+		if got := uint16(data[0]) | uint16(data[1])<<8; got != tt.bits {
+			t.Errorf("EncodeFloat16(%v) = %#04x, want %#04x", tt.f, got, tt.bits)
+		}
+	}
+}
+
+// TestFloat16RoundTrip tests that embeddings survive float16 within its precision
+func TestFloat16RoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	floats := make([]float32, 384)
+	for i := range floats {
+		floats[i] = rng.Float32()*2 - 1
+	}
+	floats[0] = float32(math.NaN())
+
+	decoded, err := DecodeFloat16(EncodeFloat16(floats))
+	if err != nil {
+		t.Fatalf("DecodeFloat16() error = %v", err)
+	}
+	if len(decoded) != len(floats) {
+		t.Fatalf("length mismatch: got %d, want %d", len(decoded), len(floats))
+	}
+	if !math.IsNaN(float64(decoded[0])) {
+		t.Errorf("expected NaN at index 0, got %v", decoded[0])
+	}
+	for i := 1; i < len(floats); i++ {
+		if diff := math.Abs(float64(decoded[i] - floats[i])); diff > 1e-3 {
+			t.Errorf("index %d: got %v, want %v", i, decoded[i], floats[i])
+		}
+	}
+
+	if _, err := DecodeFloat16([]byte{1, 2, 3}); err == nil {
+		t.Error("expected an error for odd-length data")
+	}
+}
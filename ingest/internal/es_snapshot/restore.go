@@ -0,0 +1,128 @@
+package es_snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// deleteChunkSize bounds how many index names go into one delete request so
+// the URL stays well under proxy limits
+const deleteChunkSize = 50
+
+// SnapshotAsOf returns the newest successful snapshot started at or before
+// asOf. snapshots must be sorted oldest first.
+func SnapshotAsOf(snapshots []Snapshot, asOf time.Time) (Snapshot, bool) {
+	for i := len(snapshots) - 1; i >= 0; i-- {
+		snapshot := snapshots[i]
+		if snapshot.State == "SUCCESS" && !snapshot.StartTime.After(asOf) {
+			return snapshot, true
+		}
+	}
+	return Snapshot{}, false
+}
+
+// RestoreSnapshot replaces the live indices with the contents of snapshot.
+// Every live index matching the configured patterns is deleted first,
+// including indices created after the snapshot was taken, so the cluster ends
+// up exactly as of the snapshot. Aliases are restored with their indices.
+func (s *Service) RestoreSnapshot(ctx context.Context, snapshot Snapshot) error {
+	live, err := s.LiveIndices(ctx)
+	if err != nil {
+		return err
+	}
+
+	if s.config.DryRun {
+		s.logger.Info("Dry-run: Would delete %d live indices and restore %s from snapshot %s", len(live), strings.Join(s.config.Indices, ","), snapshot.Name)
+		return nil
+	}
+
+	for start := 0; start < len(live); start += deleteChunkSize {
+		end := min(start+deleteChunkSize, len(live))
+		res, err := s.client.Indices.Delete(
+			live[start:end],
+			s.client.Indices.Delete.WithContext(ctx),
+			s.client.Indices.Delete.WithIgnoreUnavailable(true),
+		)
+		if err := s.checkResponse(res, err, "delete live indices"); err != nil {
+			return err
+		}
+		s.closeBody(res)
+	}
+	s.logger.Info("Deleted %d live indices", len(live))
+	s.logger.Audit(ctx, common.AuditEntry{
+		Operation: common.AuditRestoreSnapshot,
+		Target:    strings.Join(s.config.Indices, ","),
+		Detail:    fmt.Sprintf("deleted %d live indices to restore snapshot %s: %s", len(live), snapshot.Name, strings.Join(live, ",")),
+		Count:     -1,
+	})
+
+	body := map[string]interface{}{
+		"indices":              strings.Join(s.config.Indices, ","),
+		"ignore_unavailable":   true,
+		"include_global_state": false,
+		"include_aliases":      true,
+		"feature_states":       []string{},
+	}
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal restore request: %w", err)
+	}
+
+	start := time.Now()
+	res, err := s.client.Snapshot.Restore(
+		s.config.Repository,
+		snapshot.Name,
+		s.client.Snapshot.Restore.WithContext(ctx),
+		s.client.Snapshot.Restore.WithBody(bytes.NewReader(bodyJSON)),
+		s.client.Snapshot.Restore.WithWaitForCompletion(true),
+	)
+	if err := s.checkResponse(res, err, "restore snapshot"); err != nil {
+		return err
+	}
+	defer s.closeBody(res)
+	s.logger.Metric("snapshot.restore.duration_ms", float64(time.Since(start).Milliseconds()))
+
+	shards, err := decodeRestoreShards(res)
+	if err != nil {
+		return err
+	}
+	if shards.Total == 0 || shards.Failed > 0 {
+		return fmt.Errorf("restore of %s failed on %d of %d shards", snapshot.Name, shards.Failed, shards.Total)
+	}
+
+	s.logger.Info("Restored snapshot %s (%d shards)", snapshot.Name, shards.Total)
+	return nil
+}
+
+// LiveIndices returns the names of live indices matching the configured patterns
+func (s *Service) LiveIndices(ctx context.Context) ([]string, error) {
+	res, err := s.client.Cat.Indices(
+		s.client.Cat.Indices.WithContext(ctx),
+		s.client.Cat.Indices.WithIndex(s.config.Indices...),
+		s.client.Cat.Indices.WithH("index"),
+		s.client.Cat.Indices.WithFormat("json"),
+	)
+	if err := s.checkResponse(res, err, "list live indices"); err != nil {
+		return nil, err
+	}
+	defer s.closeBody(res)
+
+	var rows []struct {
+		Index string `json:"index"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&rows); err != nil {
+		return nil, fmt.Errorf("failed to parse index list: %w", err)
+	}
+
+	indices := make([]string, 0, len(rows))
+	for _, row := range rows {
+		indices = append(indices, row.Index)
+	}
+	return indices, nil
+}
@@ -0,0 +1,83 @@
+package es_snapshot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func TestSnapshotAsOf(t *testing.T) {
+	base := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	snapshots := []Snapshot{
+		{Name: "day-1", State: "SUCCESS", StartTime: base},
+		{Name: "day-2", State: "SUCCESS", StartTime: base.Add(24 * time.Hour)},
+		{Name: "day-3-partial", State: "PARTIAL", StartTime: base.Add(48 * time.Hour)},
+		{Name: "day-4", State: "SUCCESS", StartTime: base.Add(72 * time.Hour)},
+	}
+
+	got, ok := SnapshotAsOf(snapshots, base.Add(60*time.Hour))
+	if !ok || got.Name != "day-2" {
+		t.Errorf("got %s (found=%v), want day-2 (partial snapshots are skipped)", got.Name, ok)
+	}
+
+	got, ok = SnapshotAsOf(snapshots, base.Add(72*time.Hour))
+	if !ok || got.Name != "day-4" {
+		t.Errorf("got %s (found=%v), want day-4 for a snapshot starting exactly at as-of", got.Name, ok)
+	}
+
+	if _, ok := SnapshotAsOf(snapshots, base.Add(-time.Hour)); ok {
+		t.Error("expected no snapshot before the first one")
+	}
+}
+
+func TestRestoreSnapshot_DeletesLiveIndicesThenRestores(t *testing.T) {
+	var requests []string
+	var restoreBody string
+	client := estest.NewClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/_cat/indices"):
+			_, _ = w.Write([]byte(`[{"index":"posts-2025-w23"},{"index":"likes-2025-06-08-10-00"}]`))
+		case strings.Contains(r.URL.Path, "/_restore"):
+			body, _ := io.ReadAll(r.Body)
+			restoreBody = string(body)
+			_, _ = w.Write([]byte(`{"snapshot":{"shards":{"total":4,"failed":0,"successful":4}}}`))
+		default:
+			_, _ = w.Write([]byte(`{"acknowledged":true}`))
+		}
+	})
+
+	service := NewService(client, Config{Repository: "gcs_backup"}, common.NewLogger(false))
+	if err := service.RestoreSnapshot(context.Background(), Snapshot{Name: "snap-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(requests) != 3 || requests[1] != "DELETE /posts-2025-w23,likes-2025-06-08-10-00" {
+		t.Errorf("expected live indices to be deleted before restoring, got %v", requests)
+	}
+	if !strings.Contains(restoreBody, `"include_aliases":true`) {
+		t.Errorf("expected aliases to be restored, got %s", restoreBody)
+	}
+}
+
+func TestRestoreSnapshot_FailedShardsIsError(t *testing.T) {
+	client := estest.NewClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/_cat/indices"):
+			_, _ = w.Write([]byte(`[]`))
+		default:
+			_, _ = w.Write([]byte(`{"snapshot":{"shards":{"total":4,"failed":1,"successful":3}}}`))
+		}
+	})
+
+	service := NewService(client, Config{Repository: "gcs_backup"}, common.NewLogger(false))
+	if err := service.RestoreSnapshot(context.Background(), Snapshot{Name: "snap-1"}); err == nil {
+		t.Error("expected error when shards fail to restore")
+	}
+}
@@ -0,0 +1,389 @@
+package es_snapshot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/elastic/go-elasticsearch/v9/esapi"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// DefaultIndices are the index patterns snapshotted by default, matching the
+// SLM policy installed by the index deployment
+var DefaultIndices = []string{
+	"posts*", "post_tombstones*", "post-tombstones*", "replies*", "reply_tombstones*", "reply-tombstones*",
+	"hashtags*", "likes*", "like_tombstones*", "like-tombstones*",
+	"follows*", "follow_tombstones*", "follow-tombstones*", "inferences*",
+}
+
+// verifyIndexPrefix is prepended to indices restored during verification so
+// they never collide with live indices or aliases
+const verifyIndexPrefix = "snapshot-verify-"
+
+// Config holds configuration for the snapshot service
+type Config struct {
+	Repository string        // Snapshot repository name (e.g., "gcs_backup")
+	Bucket     string        // GCS bucket backing the repository
+	Indices    []string      // Index patterns to snapshot
+	RetainFor  time.Duration // Snapshots older than this are pruned
+	MinKeep    int           // Newest successful snapshots always kept, regardless of age
+	VerifyBase string        // Index name prefix restored during verification (e.g., "hashtags")
+	DryRun     bool          // If true, report what would change without changing it
+}
+
+// Snapshot describes one snapshot in the repository
+type Snapshot struct {
+	Name      string    `json:"snapshot"`
+	State     string    `json:"state"`
+	Indices   []string  `json:"indices"`
+	StartTime time.Time `json:"start_time"`
+}
+
+// Service manages the snapshot lifecycle: repository registration, snapshot
+// creation, restore verification, and retention pruning
+type Service struct {
+	client *elasticsearch.Client
+	config Config
+	logger *common.IngestLogger
+}
+
+// NewService creates a new snapshot service
+func NewService(client *elasticsearch.Client, config Config, logger *common.IngestLogger) *Service {
+	if len(config.Indices) == 0 {
+		config.Indices = DefaultIndices
+	}
+	if config.VerifyBase == "" {
+		config.VerifyBase = "hashtags"
+	}
+	return &Service{
+		client: client,
+		config: config,
+		logger: logger,
+	}
+}
+
+// RegisterRepository creates or updates the GCS snapshot repository and has
+// every node verify it can access the bucket
+func (s *Service) RegisterRepository(ctx context.Context) error {
+	if s.config.Bucket == "" {
+		return fmt.Errorf("snapshot bucket is required to register the repository")
+	}
+
+	body := map[string]interface{}{
+		"type": "gcs",
+		"settings": map[string]interface{}{
+			"bucket":           s.config.Bucket,
+			"application_name": "elasticsearch",
+		},
+	}
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal repository settings: %w", err)
+	}
+
+	if s.config.DryRun {
+		s.logger.Info("Dry-run: Would register repository %s on bucket %s", s.config.Repository, s.config.Bucket)
+		return nil
+	}
+
+	res, err := s.client.Snapshot.CreateRepository(
+		s.config.Repository,
+		bytes.NewReader(bodyJSON),
+		s.client.Snapshot.CreateRepository.WithContext(ctx),
+		s.client.Snapshot.CreateRepository.WithVerify(true),
+	)
+	if err := s.checkResponse(res, err, "register repository"); err != nil {
+		return err
+	}
+
+	s.logger.Info("Registered snapshot repository %s on bucket %s", s.config.Repository, s.config.Bucket)
+	return nil
+}
+
+// CreateSnapshot takes a snapshot and waits for it to finish. Partial or
+// failed snapshots are returned as errors.
+func (s *Service) CreateSnapshot(ctx context.Context, name string) (Snapshot, error) {
+	body := map[string]interface{}{
+		"indices":              strings.Join(s.config.Indices, ","),
+		"include_global_state": false,
+		"feature_states":       []string{},
+	}
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		return Snapshot{}, fmt.Errorf("failed to marshal snapshot request: %w", err)
+	}
+
+	if s.config.DryRun {
+		s.logger.Info("Dry-run: Would create snapshot %s of %s", name, strings.Join(s.config.Indices, ","))
+		return Snapshot{Name: name}, nil
+	}
+
+	start := time.Now()
+	res, err := s.client.Snapshot.Create(
+		s.config.Repository,
+		name,
+		s.client.Snapshot.Create.WithContext(ctx),
+		s.client.Snapshot.Create.WithBody(bytes.NewReader(bodyJSON)),
+		s.client.Snapshot.Create.WithWaitForCompletion(true),
+	)
+	if err := s.checkResponse(res, err, "create snapshot"); err != nil {
+		return Snapshot{}, err
+	}
+	defer s.closeBody(res)
+	s.logger.Metric("snapshot.create.duration_ms", float64(time.Since(start).Milliseconds()))
+
+	var response struct {
+		Snapshot Snapshot `json:"snapshot"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return Snapshot{}, fmt.Errorf("failed to parse snapshot response: %w", err)
+	}
+	if response.Snapshot.State != "SUCCESS" {
+		return response.Snapshot, fmt.Errorf("snapshot %s finished in state %s", name, response.Snapshot.State)
+	}
+
+	s.logger.Info("Created snapshot %s (%d indices)", name, len(response.Snapshot.Indices))
+	return response.Snapshot, nil
+}
+
+// ListSnapshots returns all snapshots in the repository, oldest first
+func (s *Service) ListSnapshots(ctx context.Context) ([]Snapshot, error) {
+	res, err := s.client.Snapshot.Get(
+		s.config.Repository,
+		[]string{"_all"},
+		s.client.Snapshot.Get.WithContext(ctx),
+	)
+	if err := s.checkResponse(res, err, "list snapshots"); err != nil {
+		return nil, err
+	}
+	defer s.closeBody(res)
+
+	var response struct {
+		Snapshots []Snapshot `json:"snapshots"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot list: %w", err)
+	}
+
+	sort.Slice(response.Snapshots, func(i, j int) bool {
+		return response.Snapshots[i].StartTime.Before(response.Snapshots[j].StartTime)
+	})
+	return response.Snapshots, nil
+}
+
+// VerifySnapshot proves a snapshot is restorable: it restores one of the
+// snapshot's indices under a scratch name, checks the restored index is
+// searchable and non-empty, then deletes it
+func (s *Service) VerifySnapshot(ctx context.Context, snapshot Snapshot) error {
+	index := verificationIndex(snapshot.Indices, s.config.VerifyBase)
+	if index == "" {
+		return fmt.Errorf("snapshot %s contains no indices to verify", snapshot.Name)
+	}
+	restored := verifyIndexPrefix + index
+
+	if s.config.DryRun {
+		s.logger.Info("Dry-run: Would verify snapshot %s by restoring %s as %s", snapshot.Name, index, restored)
+		return nil
+	}
+
+	// Clear leftovers from an interrupted verification
+	if err := s.deleteIndex(ctx, restored); err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{
+		"indices":              index,
+		"include_global_state": false,
+		"include_aliases":      false,
+		"rename_pattern":       "(.+)",
+		"rename_replacement":   verifyIndexPrefix + "$1",
+		"index_settings": map[string]interface{}{
+			"index.number_of_replicas": 0,
+		},
+	}
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to marshal restore request: %w", err)
+	}
+
+	start := time.Now()
+	res, err := s.client.Snapshot.Restore(
+		s.config.Repository,
+		snapshot.Name,
+		s.client.Snapshot.Restore.WithContext(ctx),
+		s.client.Snapshot.Restore.WithBody(bytes.NewReader(bodyJSON)),
+		s.client.Snapshot.Restore.WithWaitForCompletion(true),
+	)
+	if err := s.checkResponse(res, err, "restore snapshot"); err != nil {
+		return err
+	}
+	defer s.closeBody(res)
+
+	shards, err := decodeRestoreShards(res)
+	if err != nil {
+		return err
+	}
+
+	count, countErr := s.countDocs(ctx, restored)
+	if err := s.deleteIndex(ctx, restored); err != nil {
+		s.logger.Error("Failed to delete verification index %s: %v", restored, err)
+	}
+	s.logger.Metric("snapshot.verify.duration_ms", float64(time.Since(start).Milliseconds()))
+
+	if shards.Total == 0 || shards.Failed > 0 {
+		return fmt.Errorf("restore of %s from %s failed on %d of %d shards", index, snapshot.Name, shards.Failed, shards.Total)
+	}
+	if countErr != nil {
+		return fmt.Errorf("restored index %s is not searchable: %w", restored, countErr)
+	}
+	if count == 0 {
+		return fmt.Errorf("restored index %s from %s is empty", index, snapshot.Name)
+	}
+
+	s.logger.Info("Verified snapshot %s: restored %s with %d documents", snapshot.Name, index, count)
+	return nil
+}
+
+// restoreShards is the shard summary of a completed restore
+type restoreShards struct {
+	Total  int `json:"total"`
+	Failed int `json:"failed"`
+}
+
+func decodeRestoreShards(res *esapi.Response) (restoreShards, error) {
+	var response struct {
+		Snapshot struct {
+			Shards restoreShards `json:"shards"`
+		} `json:"snapshot"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return restoreShards{}, fmt.Errorf("failed to parse restore response: %w", err)
+	}
+	return response.Snapshot.Shards, nil
+}
+
+// verificationIndex picks the newest index whose name starts with base, so
+// verification restores a small, recently written index. Falls back to the
+// newest index of any name.
+func verificationIndex(indices []string, base string) string {
+	if len(indices) == 0 {
+		return ""
+	}
+	sorted := append([]string(nil), indices...)
+	sort.Sort(sort.Reverse(sort.StringSlice(sorted)))
+	for _, index := range sorted {
+		if strings.HasPrefix(index, base) {
+			return index
+		}
+	}
+	return sorted[0]
+}
+
+// PruneCandidates returns snapshots that fall outside the retention policy.
+// The newest minKeep successful snapshots are always kept, so a stalled
+// snapshot schedule never prunes the last good restore point.
+func PruneCandidates(snapshots []Snapshot, now time.Time, retainFor time.Duration, minKeep int) []Snapshot {
+	sorted := append([]Snapshot(nil), snapshots...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].StartTime.After(sorted[j].StartTime)
+	})
+
+	cutoff := now.Add(-retainFor)
+	kept := 0
+	var prune []Snapshot
+	for _, snapshot := range sorted {
+		if snapshot.State == "SUCCESS" && kept < minKeep {
+			kept++
+			continue
+		}
+		if snapshot.State == "IN_PROGRESS" || snapshot.StartTime.After(cutoff) {
+			continue
+		}
+		prune = append(prune, snapshot)
+	}
+	return prune
+}
+
+// Prune deletes snapshots outside the retention policy and returns how many were removed
+func (s *Service) Prune(ctx context.Context, now time.Time) (int, error) {
+	snapshots, err := s.ListSnapshots(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	candidates := PruneCandidates(snapshots, now, s.config.RetainFor, s.config.MinKeep)
+	for _, snapshot := range candidates {
+		if s.config.DryRun {
+			s.logger.Info("Dry-run: Would delete snapshot %s (started %s, state %s)", snapshot.Name, snapshot.StartTime.Format(time.RFC3339), snapshot.State)
+			continue
+		}
+		res, err := s.client.Snapshot.Delete(
+			s.config.Repository,
+			[]string{snapshot.Name},
+			s.client.Snapshot.Delete.WithContext(ctx),
+		)
+		if err := s.checkResponse(res, err, "delete snapshot "+snapshot.Name); err != nil {
+			return 0, err
+		}
+		s.closeBody(res)
+		s.logger.Info("Deleted snapshot %s (started %s)", snapshot.Name, snapshot.StartTime.Format(time.RFC3339))
+	}
+	return len(candidates), nil
+}
+
+func (s *Service) countDocs(ctx context.Context, index string) (int, error) {
+	res, err := s.client.Count(
+		s.client.Count.WithContext(ctx),
+		s.client.Count.WithIndex(index),
+	)
+	if err := s.checkResponse(res, err, "count "+index); err != nil {
+		return 0, err
+	}
+	defer s.closeBody(res)
+
+	var response struct {
+		Count int `json:"count"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return 0, fmt.Errorf("failed to parse count response: %w", err)
+	}
+	return response.Count, nil
+}
+
+func (s *Service) deleteIndex(ctx context.Context, index string) error {
+	res, err := s.client.Indices.Delete(
+		[]string{index},
+		s.client.Indices.Delete.WithContext(ctx),
+		s.client.Indices.Delete.WithIgnoreUnavailable(true),
+	)
+	if err := s.checkResponse(res, err, "delete index "+index); err != nil {
+		return err
+	}
+	s.closeBody(res)
+	return nil
+}
+
+// checkResponse folds transport and HTTP errors into one error, closing the
+// body on failure
+func (s *Service) checkResponse(res *esapi.Response, err error, action string) error {
+	if err != nil {
+		return fmt.Errorf("failed to %s: %w", action, err)
+	}
+	if res.IsError() {
+		defer s.closeBody(res)
+		return fmt.Errorf("failed to %s: %s", action, res.String())
+	}
+	return nil
+}
+
+func (s *Service) closeBody(res *esapi.Response) {
+	if err := res.Body.Close(); err != nil {
+		s.logger.Error("Failed to close response body: %v", err)
+	}
+}
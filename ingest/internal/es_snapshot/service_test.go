@@ -0,0 +1,125 @@
+package es_snapshot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func TestPruneCandidates(t *testing.T) {
+	now := time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	snapshots := []Snapshot{
+		{Name: "old-1", State: "SUCCESS", StartTime: now.Add(-30 * day)},
+		{Name: "old-2", State: "SUCCESS", StartTime: now.Add(-20 * day)},
+		{Name: "old-failed", State: "FAILED", StartTime: now.Add(-19 * day)},
+		{Name: "recent", State: "SUCCESS", StartTime: now.Add(-1 * day)},
+	}
+
+	got := PruneCandidates(snapshots, now, 14*day, 2)
+
+	names := make([]string, len(got))
+	for i, s := range got {
+		names[i] = s.Name
+	}
+	// recent and old-2 are the two newest successes and are kept despite old-2's age
+	want := "old-failed,old-1"
+	if strings.Join(names, ",") != want {
+		t.Errorf("got %v, want %s", names, want)
+	}
+}
+
+func TestPruneCandidates_KeepsInProgress(t *testing.T) {
+	now := time.Now()
+	snapshots := []Snapshot{
+		{Name: "running", State: "IN_PROGRESS", StartTime: now.Add(-48 * time.Hour)},
+	}
+
+	if got := PruneCandidates(snapshots, now, time.Hour, 0); len(got) != 0 {
+		t.Errorf("expected in-progress snapshot to be kept, got %v", got)
+	}
+}
+
+func TestVerificationIndex(t *testing.T) {
+	indices := []string{"posts-2025.06.01", "hashtags-2025.06.01", "hashtags-2025.06.08", "likes-2025.06.08"}
+
+	if got := verificationIndex(indices, "hashtags"); got != "hashtags-2025.06.08" {
+		t.Errorf("got %s, want newest hashtags index", got)
+	}
+	if got := verificationIndex(indices, "inferences"); got != "posts-2025.06.01" {
+		t.Errorf("got %s, want fallback to newest index by name", got)
+	}
+	if got := verificationIndex(nil, "hashtags"); got != "" {
+		t.Errorf("got %s, want empty for no indices", got)
+	}
+}
+
+func TestVerifySnapshot_RestoresCountsAndCleansUp(t *testing.T) {
+	var requests []string
+	var restoreBody string
+	client := estest.NewClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch {
+		case strings.Contains(r.URL.Path, "/_restore"):
+			body, _ := io.ReadAll(r.Body)
+			restoreBody = string(body)
+			_, _ = w.Write([]byte(`{"snapshot":{"shards":{"total":1,"failed":0,"successful":1}}}`))
+		case strings.HasSuffix(r.URL.Path, "/_count"):
+			_, _ = w.Write([]byte(`{"count":42}`))
+		case r.Method == http.MethodDelete:
+			_, _ = w.Write([]byte(`{"acknowledged":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	service := NewService(client, Config{Repository: "gcs_backup"}, common.NewLogger(false))
+	err := service.VerifySnapshot(context.Background(), Snapshot{Name: "snap-1", Indices: []string{"hashtags-2025.06.08"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(restoreBody, `"rename_replacement":"snapshot-verify-$1"`) {
+		t.Errorf("expected restore to rename indices, got %s", restoreBody)
+	}
+	last := requests[len(requests)-1]
+	if last != "DELETE /snapshot-verify-hashtags-2025.06.08" {
+		t.Errorf("expected verification index to be deleted last, got %s", last)
+	}
+}
+
+func TestVerifySnapshot_FailsOnEmptyRestore(t *testing.T) {
+	client := estest.NewClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "/_restore"):
+			_, _ = w.Write([]byte(`{"snapshot":{"shards":{"total":1,"failed":0,"successful":1}}}`))
+		case strings.HasSuffix(r.URL.Path, "/_count"):
+			_, _ = w.Write([]byte(`{"count":0}`))
+		default:
+			_, _ = w.Write([]byte(`{"acknowledged":true}`))
+		}
+	})
+
+	service := NewService(client, Config{Repository: "gcs_backup"}, common.NewLogger(false))
+	err := service.VerifySnapshot(context.Background(), Snapshot{Name: "snap-1", Indices: []string{"hashtags-2025.06.08"}})
+	if err == nil || !strings.Contains(err.Error(), "empty") {
+		t.Errorf("expected empty-restore error, got %v", err)
+	}
+}
+
+func TestCreateSnapshot_PartialIsError(t *testing.T) {
+	client := estest.NewClient(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"snapshot":{"snapshot":"snap-1","state":"PARTIAL","indices":["posts-1"]}}`))
+	})
+
+	service := NewService(client, Config{Repository: "gcs_backup"}, common.NewLogger(false))
+	if _, err := service.CreateSnapshot(context.Background(), "snap-1"); err == nil {
+		t.Error("expected error for partial snapshot")
+	}
+}
@@ -0,0 +1,954 @@
+// Package estest is an in-process fake of the subset of the Elasticsearch
+// API the ingest services use: bulk, search and scroll, mget,
+// delete_by_query, and count. It keeps documents in memory and evaluates the query clauses and
+// terms and sum aggregations the services send, so code that takes an
+// *elasticsearch.Client can be tested without a live cluster. Tests script
+// failures with Handle, for whole requests, and FailItems, for single bulk
+// items. Tests of APIs the fake does not model answer requests themselves
+// through NewClient.
+//
+// The fake is not a search engine: queries match exactly (no analysis or
+// scoring, except exact cosine kNN over dense vectors), routing is ignored, and index names match literally or by
+// wildcard, with no aliases. Painless scripts in updates run only if the
+// test registers a Go equivalent with Script.
+package estest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v9"
+)
+
+// APIs the fake serves, as named in Call.API and Handle
+const (
+	APIBulk          = "bulk"
+	APISearch        = "search"
+	APIMget          = "mget"
+	APIDeleteByQuery = "delete_by_query"
+	APICount         = "count"
+	APIScroll        = "scroll" // Scroll pages and clear scroll, after a search with ?scroll
+)
+
+// Call is a request the fake received
+type Call struct {
+	API    string
+	Method string
+	Path   string
+	Index  string // Index or pattern from the path; empty if it names none
+	Query  url.Values
+	Body   []byte
+}
+
+// BulkItems returns the actions of a bulk call
+func (c Call) BulkItems() []BulkItem {
+	items, _ := parseBulk(c.Body, c.Index)
+	return items
+}
+
+// BulkIDs returns the _id of each action of a bulk call
+func (c Call) BulkIDs() []string {
+	var ids []string
+	for _, item := range c.BulkItems() {
+		ids = append(ids, item.ID)
+	}
+	return ids
+}
+
+// Response is a scripted response to a call
+type Response struct {
+	Status int
+	Body   string
+}
+
+// BulkItem is one action of a bulk request
+type BulkItem struct {
+	Action  string // index, create, update, or delete
+	Index   string
+	ID      string
+	Routing string
+	Source  json.RawMessage // The document or update body; nil for deletes
+	Attempt int             // 1 the first time a bulk request carries this action on this document, 2 the next, ...
+	// Version and VersionType are the item's external version, if any
+	Version     int64
+	VersionType string
+}
+
+// ItemFailure is a scripted failure of a bulk item
+type ItemFailure struct {
+	Status int
+	Type   string
+	Reason string
+}
+
+// Server is a fake Elasticsearch cluster. Its zero value is not usable; use New.
+type Server struct {
+	Client *elasticsearch.Client // Client of the fake
+
+	srv *httptest.Server
+
+	mu         sync.Mutex
+	docs       map[string]map[string]map[string]interface{} // index -> _id -> _source
+	calls      []Call
+	handlers   map[string]func(Call) *Response
+	failItem   func(BulkItem) *ItemFailure
+	scripts    map[string]func(source, params map[string]interface{})
+	attempts   map[string]int   // Bulk attempts by action, index, and _id
+	versions   map[string]int64 // External versions by index and _id, kept after deletes
+	nextAutoID int
+	scrolls    map[string]*scrollContext // Open scrolls by _scroll_id
+	nextScroll int
+}
+
+// New starts a fake cluster, closed when the test ends
+func New(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{
+		docs:     make(map[string]map[string]map[string]interface{}),
+		handlers: make(map[string]func(Call) *Response),
+		scripts:  make(map[string]func(source, params map[string]interface{})),
+		attempts: make(map[string]int),
+		versions: make(map[string]int64),
+		scrolls:  make(map[string]*scrollContext),
+	}
+	s.srv = httptest.NewServer(s)
+	t.Cleanup(s.srv.Close)
+
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{s.srv.URL}})
+	if err != nil {
+		t.Fatalf("failed to create fake ES client: %v", err)
+	}
+	s.Client = client
+	return s
+}
+
+// NewClient returns a client of a test server that answers every request
+// with handler, for APIs the fake does not model (snapshots, aliases, point
+// in time searches) or requests a test inspects directly. Responses carry
+// the headers the client requires of Elasticsearch. The server is closed
+// when the test ends.
+func NewClient(t testing.TB, handler http.HandlerFunc) *elasticsearch.Client {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{srv.URL}})
+	if err != nil {
+		t.Fatalf("failed to create ES client: %v", err)
+	}
+	return client
+}
+
+// URL returns the fake's address
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// Put stores source, any value that marshals to a JSON object, as document
+// id of index
+func (s *Server) Put(index, id string, source interface{}) {
+	doc, err := toObject(source)
+	if err != nil {
+		panic(fmt.Sprintf("estest: document %s/%s: %v", index, id, err))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(index, id, doc)
+}
+
+// Get returns the source of document id of index
+func (s *Server) Get(index, id string) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc, ok := s.docs[index][id]
+	return doc, ok
+}
+
+// Len returns the number of documents in index
+func (s *Server) Len(index string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.docs[index])
+}
+
+// Calls returns the calls made to api, oldest first, or every call if api
+// is empty
+func (s *Server) Calls(api string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []Call
+	for _, call := range s.calls {
+		if api == "" || call.API == api {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Handle scripts the response to calls to api. fn returns nil to let the
+// fake serve the call as usual.
+func (s *Server) Handle(api string, fn func(Call) *Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[api] = fn
+}
+
+// FailItems scripts failures of bulk items. fn returns nil to let the item
+// succeed; a failed item leaves the documents unchanged.
+func (s *Server) FailItems(fn func(BulkItem) *ItemFailure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failItem = fn
+}
+
+// Script registers fn as the implementation of the painless script source
+// in update actions. fn updates the document source in place.
+func (s *Server) Script(source string, fn func(source, params map[string]interface{})) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[source] = fn
+}
+
+// ServeHTTP serves a call to the fake
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.Header().Set("X-Elastic-Product", "Elasticsearch")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "parse_exception", err.Error())
+		return
+	}
+	call := Call{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query(), Body: body}
+	call.Index, call.API = route(r.URL.Path)
+
+	s.mu.Lock()
+	s.calls = append(s.calls, call)
+	handler := s.handlers[call.API]
+	s.mu.Unlock()
+
+	if handler != nil {
+		if res := handler(call); res != nil {
+			w.WriteHeader(res.Status)
+			_, _ = io.WriteString(w, res.Body)
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var status int
+	var response interface{}
+	switch call.API {
+	case APIBulk:
+		status, response = s.bulk(call)
+	case APISearch:
+		status, response = s.search(call)
+	case APIMget:
+		status, response = s.mget(call)
+	case APIDeleteByQuery:
+		status, response = s.deleteByQuery(call)
+	case APICount:
+		status, response = s.count(call)
+	case APIScroll:
+		status, response = s.scroll(call)
+	default:
+		writeError(w, http.StatusNotFound, "unsupported_operation_exception", fmt.Sprintf("estest does not implement %s %s", r.Method, r.URL.Path))
+		return
+	}
+	if status >= 400 {
+		reason, _ := response.(string)
+		writeError(w, status, errorType(status), reason)
+		return
+	}
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// route returns the index and API of a request path, e.g. "posts" and
+// APISearch for /posts/_search, or APIScroll for /_search/scroll
+func route(urlPath string) (index, api string) {
+	parts := strings.Split(strings.Trim(urlPath, "/"), "/")
+	for i, part := range parts {
+		if part == "_search" && i+1 < len(parts) && parts[i+1] == "scroll" {
+			return "", APIScroll
+		}
+		if strings.HasPrefix(part, "_") {
+			if i > 0 {
+				index = parts[0]
+			}
+			return index, strings.TrimPrefix(part, "_")
+		}
+	}
+	return "", ""
+}
+
+func errorType(status int) string {
+	switch status {
+	case http.StatusNotFound:
+		return "index_not_found_exception"
+	default:
+		return "parsing_exception"
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, errType, reason string) {
+	w.WriteHeader(status)
+	cause := map[string]interface{}{"type": errType, "reason": reason}
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":  map[string]interface{}{"root_cause": []interface{}{cause}, "type": errType, "reason": reason},
+		"status": status,
+	})
+}
+
+func (s *Server) put(index, id string, doc map[string]interface{}) {
+	if s.docs[index] == nil {
+		s.docs[index] = make(map[string]map[string]interface{})
+	}
+	s.docs[index][id] = doc
+}
+
+// indices returns the indices holding documents that pattern, a
+// comma-separated list of names or wildcards, names. An empty pattern or
+// _all names every index.
+func (s *Server) indices(pattern string) []string {
+	var names []string
+	for name := range s.docs {
+		if pattern == "" || pattern == "_all" {
+			names = append(names, name)
+			continue
+		}
+		for _, p := range strings.Split(pattern, ",") {
+			if ok, _ := path.Match(p, name); ok {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// bulk
+
+// bulkAction is the action line of a bulk item
+type bulkAction struct {
+	Index       string `json:"_index"`
+	ID          string `json:"_id"`
+	Routing     string `json:"routing"`
+	Version     int64  `json:"version"`
+	VersionType string `json:"version_type"`
+}
+
+// parseBulk parses an NDJSON bulk body; defaultIndex is the index in the path
+func parseBulk(body []byte, defaultIndex string) ([]BulkItem, error) {
+	var items []BulkItem
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var actionLine map[string]bulkAction
+		if err := json.Unmarshal(line, &actionLine); err != nil || len(actionLine) != 1 {
+			return items, fmt.Errorf("malformed action/metadata line [%s]", line)
+		}
+		for action, meta := range actionLine {
+			item := BulkItem{Action: action, Index: meta.Index, ID: meta.ID, Routing: meta.Routing, Version: meta.Version, VersionType: meta.VersionType}
+			if item.Index == "" {
+				item.Index = defaultIndex
+			}
+			switch action {
+			case "index", "create", "update":
+				if !scanner.Scan() {
+					return items, fmt.Errorf("%s action for [%s] has no source", action, item.ID)
+				}
+				item.Source = append(json.RawMessage(nil), bytes.TrimSpace(scanner.Bytes())...)
+			case "delete":
+			default:
+				return items, fmt.Errorf("unknown bulk action [%s]", action)
+			}
+			items = append(items, item)
+		}
+	}
+	return items, scanner.Err()
+}
+
+func (s *Server) bulk(call Call) (int, interface{}) {
+	items, err := parseBulk(call.Body, call.Index)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+
+	results := make([]interface{}, 0, len(items))
+	anyErrors := false
+	for _, item := range items {
+		key := item.Action + "\x00" + item.Index + "\x00" + item.ID
+		s.attempts[key]++
+		item.Attempt = s.attempts[key]
+
+		var failure *ItemFailure
+		if s.failItem != nil {
+			failure = s.failItem(item)
+		}
+		var result map[string]interface{}
+		if failure == nil {
+			result, failure = s.applyBulkItem(&item)
+		}
+		if failure != nil {
+			result = map[string]interface{}{
+				"status": failure.Status,
+				"error":  map[string]interface{}{"type": failure.Type, "reason": failure.Reason},
+			}
+			anyErrors = true
+		}
+		result["_index"] = item.Index
+		result["_id"] = item.ID
+		results = append(results, map[string]interface{}{item.Action: result})
+	}
+	return http.StatusOK, map[string]interface{}{"took": 1, "errors": anyErrors, "items": results}
+}
+
+// applyBulkItem applies item to the documents, filling in an automatic _id
+func (s *Server) applyBulkItem(item *BulkItem) (map[string]interface{}, *ItemFailure) {
+	if item.Index == "" {
+		return nil, &ItemFailure{Status: http.StatusBadRequest, Type: "action_request_validation_exception", Reason: "index is missing"}
+	}
+	existing, exists := s.docs[item.Index][item.ID]
+	if item.ID == "" && item.Action != "delete" {
+		s.nextAutoID++
+		item.ID = fmt.Sprintf("estest-%d", s.nextAutoID)
+		exists = false
+	}
+
+	if failure := s.checkVersion(item); failure != nil {
+		return nil, failure
+	}
+
+	switch item.Action {
+	case "index", "create":
+		if item.Action == "create" && exists {
+			return nil, &ItemFailure{Status: http.StatusConflict, Type: "version_conflict_engine_exception", Reason: fmt.Sprintf("[%s]: version conflict, document already exists", item.ID)}
+		}
+		doc, err := toObject(item.Source)
+		if err != nil {
+			return nil, &ItemFailure{Status: http.StatusBadRequest, Type: "document_parsing_exception", Reason: err.Error()}
+		}
+		s.put(item.Index, item.ID, doc)
+		return written(exists), nil
+
+	case "update":
+		return s.update(item, existing, exists)
+
+	default: // delete
+		if !exists {
+			return map[string]interface{}{"status": http.StatusNotFound, "result": "not_found"}, nil
+		}
+		delete(s.docs[item.Index], item.ID)
+		return map[string]interface{}{"status": http.StatusOK, "result": "deleted"}, nil
+	}
+}
+
+// checkVersion applies item's external version, failing the item if the
+// document has a newer one. Unlike Elasticsearch, which forgets the version
+// of a deleted document after index.gc_deletes, the fake keeps it. Internal
+// writes to a document with an external version increment it.
+func (s *Server) checkVersion(item *BulkItem) *ItemFailure {
+	key := item.Index + "\x00" + item.ID
+	current, versioned := s.versions[key]
+	switch item.VersionType {
+	case "", "internal":
+		if versioned && item.Action != "create" {
+			s.versions[key] = current + 1
+		}
+		return nil
+	case "external", "external_gte":
+	default:
+		return &ItemFailure{Status: http.StatusBadRequest, Type: "illegal_argument_exception", Reason: fmt.Sprintf("No version type match [%s]", item.VersionType)}
+	}
+	if item.Action == "create" || item.Action == "update" {
+		return &ItemFailure{Status: http.StatusBadRequest, Type: "action_request_validation_exception", Reason: fmt.Sprintf("Validation Failed: 1: %s operations only support internal versioning. use index instead;", item.Action)}
+	}
+	if versioned && (item.Version < current || item.Version == current && item.VersionType == "external") {
+		return &ItemFailure{Status: http.StatusConflict, Type: "version_conflict_engine_exception",
+			Reason: fmt.Sprintf("[%s]: version conflict, current version [%d] is higher or equal to the one provided [%d]", item.ID, current, item.Version)}
+	}
+	s.versions[key] = item.Version
+	return nil
+}
+
+func written(existed bool) map[string]interface{} {
+	if existed {
+		return map[string]interface{}{"status": http.StatusOK, "result": "updated"}
+	}
+	return map[string]interface{}{"status": http.StatusCreated, "result": "created"}
+}
+
+// updateBody is the body of a bulk update
+type updateBody struct {
+	Doc            map[string]interface{} `json:"doc"`
+	DocAsUpsert    bool                   `json:"doc_as_upsert"`
+	Upsert         map[string]interface{} `json:"upsert"`
+	ScriptedUpsert bool                   `json:"scripted_upsert"`
+	Script         *struct {
+		Source string                 `json:"source"`
+		Params map[string]interface{} `json:"params"`
+	} `json:"script"`
+}
+
+func (s *Server) update(item *BulkItem, existing map[string]interface{}, exists bool) (map[string]interface{}, *ItemFailure) {
+	var body updateBody
+	if err := json.Unmarshal(item.Source, &body); err != nil {
+		return nil, &ItemFailure{Status: http.StatusBadRequest, Type: "x_content_parse_exception", Reason: err.Error()}
+	}
+
+	runScript := func(doc map[string]interface{}) *ItemFailure {
+		fn := s.scripts[body.Script.Source]
+		if fn == nil {
+			return &ItemFailure{Status: http.StatusBadRequest, Type: "script_exception", Reason: fmt.Sprintf("estest has no Script registered for [%s]", body.Script.Source)}
+		}
+		fn(doc, body.Script.Params)
+		return nil
+	}
+
+	if !exists {
+		var doc map[string]interface{}
+		switch {
+		case body.Upsert != nil:
+			doc = body.Upsert
+			if body.Script != nil && body.ScriptedUpsert {
+				if failure := runScript(doc); failure != nil {
+					return nil, failure
+				}
+			}
+		case body.DocAsUpsert && body.Doc != nil:
+			doc = body.Doc
+		default:
+			return nil, &ItemFailure{Status: http.StatusNotFound, Type: "document_missing_exception", Reason: fmt.Sprintf("[%s]: document missing", item.ID)}
+		}
+		s.put(item.Index, item.ID, doc)
+		return written(false), nil
+	}
+
+	// Update a copy, so a failing script leaves the document unchanged
+	doc := make(map[string]interface{}, len(existing))
+	for k, v := range existing {
+		doc[k] = v
+	}
+	switch {
+	case body.Script != nil:
+		if failure := runScript(doc); failure != nil {
+			return nil, failure
+		}
+	case body.Doc != nil:
+		for k, v := range body.Doc {
+			doc[k] = v
+		}
+	default:
+		return nil, &ItemFailure{Status: http.StatusBadRequest, Type: "action_request_validation_exception", Reason: "script or doc is missing"}
+	}
+	s.put(item.Index, item.ID, doc)
+	return written(true), nil
+}
+
+// search, count, and delete_by_query
+
+// aggregate runs the aggregations of a search over its matching documents.
+// Terms and sum aggregations are supported, and terms buckets may hold
+// their own aggregations; buckets are ordered by count, then key.
+func aggregate(aggs map[string]interface{}, hits []hit) (map[string]interface{}, error) {
+	if len(aggs) == 0 {
+		return nil, nil
+	}
+	results := make(map[string]interface{}, len(aggs))
+	for name, agg := range aggs {
+		if sum, ok := object(agg)["sum"].(map[string]interface{}); ok && len(object(agg)) == 1 {
+			field, _ := sum["field"].(string)
+			total := 0.0
+			for _, h := range hits {
+				anyValue(h.source, field, func(v interface{}) bool {
+					n, _ := number(v)
+					total += n
+					return false
+				})
+			}
+			results[name] = map[string]interface{}{"value": total}
+			continue
+		}
+
+		terms, ok := object(agg)["terms"].(map[string]interface{})
+		subAggs, _ := object(agg)["aggs"].(map[string]interface{})
+		keys := 1
+		if subAggs != nil {
+			keys++
+		}
+		if !ok || len(object(agg)) != keys {
+			return nil, fmt.Errorf("estest supports only terms and sum aggregations, got [%s]", name)
+		}
+		field, _ := terms["field"].(string)
+		size := 10
+		if n, ok := number(terms["size"]); ok {
+			size = int(n)
+		}
+
+		members := make(map[string][]hit)
+		for _, h := range hits {
+			anyValue(h.source, field, func(v interface{}) bool {
+				key := fmt.Sprint(v)
+				members[key] = append(members[key], h)
+				return false
+			})
+		}
+		values := make([]string, 0, len(members))
+		for value := range members {
+			values = append(values, value)
+		}
+		sort.Slice(values, func(i, j int) bool {
+			if len(members[values[i]]) != len(members[values[j]]) {
+				return len(members[values[i]]) > len(members[values[j]])
+			}
+			return values[i] < values[j]
+		})
+
+		buckets := make([]interface{}, 0, min(size, len(values)))
+		others := 0
+		for i, key := range values {
+			if i >= size {
+				others += len(members[key])
+				continue
+			}
+			bucket := map[string]interface{}{"key": key, "doc_count": len(members[key])}
+			sub, err := aggregate(subAggs, members[key])
+			if err != nil {
+				return nil, err
+			}
+			for subName, result := range sub {
+				bucket[subName] = result
+			}
+			buckets = append(buckets, bucket)
+		}
+		results[name] = map[string]interface{}{
+			"doc_count_error_upper_bound": 0,
+			"sum_other_doc_count":         others,
+			"buckets":                     buckets,
+		}
+	}
+	return results, nil
+}
+
+// searchRequest is the subset of a search body the fake reads
+type searchRequest struct {
+	Query       map[string]interface{} `json:"query"`
+	Size        *int                   `json:"size"`
+	From        int                    `json:"from"`
+	Sort        []interface{}          `json:"sort"`
+	SearchAfter []interface{}          `json:"search_after"`
+	PIT         interface{}            `json:"pit"`
+	Aggs        map[string]interface{} `json:"aggs"`
+	KNN         map[string]interface{} `json:"knn"`
+}
+
+// hit is a matching document
+type hit struct {
+	index, id string
+	source    map[string]interface{}
+	sort      []interface{}
+	score     float64
+}
+
+// match returns the documents of the indices pattern names that match query
+func (s *Server) match(pattern string, query map[string]interface{}) ([]hit, error) {
+	var hits []hit
+	for _, index := range s.indices(pattern) {
+		ids := make([]string, 0, len(s.docs[index]))
+		for id := range s.docs[index] {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			source := s.docs[index][id]
+			ok, err := matches(query, id, source)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				hits = append(hits, hit{index: index, id: id, source: source, score: 1})
+			}
+		}
+	}
+	return hits, nil
+}
+
+func (s *Server) search(call Call) (int, interface{}) {
+	var req searchRequest
+	if len(call.Body) > 0 {
+		if err := json.Unmarshal(call.Body, &req); err != nil {
+			return http.StatusBadRequest, err.Error()
+		}
+	}
+	if req.PIT != nil {
+		return http.StatusBadRequest, "estest does not support point in time searches; script them with Handle"
+	}
+
+	if req.KNN != nil && req.Query != nil {
+		return http.StatusBadRequest, "estest does not support combining knn with a query"
+	}
+	hits, err := s.match(call.Index, req.Query)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if req.KNN != nil {
+		if hits, err = nearest(req.KNN, hits); err != nil {
+			return http.StatusBadRequest, err.Error()
+		}
+	}
+	sorts, err := parseSort(req.Sort)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if req.KNN != nil && len(req.Sort) == 0 {
+		// Nearest first, as Elasticsearch sorts by score
+		sorts = append([]sortField{{field: "_score", desc: true}}, sorts...)
+	}
+	for i := range hits {
+		hits[i].sort = sortValues(sorts, hits[i])
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return compareSort(sorts, hits[i].sort, hits[j].sort) < 0
+	})
+	total := len(hits)
+	aggregations, err := aggregate(req.Aggs, hits)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+
+	if req.SearchAfter != nil {
+		if len(req.SearchAfter) != len(sorts) {
+			return http.StatusBadRequest, fmt.Sprintf("search_after has %d values but sort has %d", len(req.SearchAfter), len(sorts))
+		}
+		after := hits[:0]
+		for _, h := range hits {
+			if compareSort(sorts, h.sort, req.SearchAfter) > 0 {
+				after = append(after, h)
+			}
+		}
+		hits = after
+	}
+
+	size := 10
+	if req.Size != nil {
+		size = *req.Size
+	}
+	hits = hits[min(req.From, len(hits)):]
+
+	results := make([]interface{}, 0, len(hits))
+	for _, h := range hits {
+		result := map[string]interface{}{"_index": h.index, "_id": h.id, "_score": h.score, "_source": h.source}
+		if len(req.Sort) > 0 {
+			result["_score"] = nil
+			result["sort"] = h.sort
+		}
+		results = append(results, result)
+	}
+	page := results[:min(size, len(results))]
+	response := searchResponse(total, page)
+	if aggregations != nil {
+		response["aggregations"] = aggregations
+	}
+
+	// A scrolling search keeps the rest of the results for scroll calls
+	if call.Query.Get("scroll") != "" {
+		s.nextScroll++
+		id := fmt.Sprintf("estest-scroll-%d", s.nextScroll)
+		s.scrolls[id] = &scrollContext{rest: results[len(page):], size: size, total: total}
+		response["_scroll_id"] = id
+	}
+	return http.StatusOK, response
+}
+
+// scrollContext is the state of an open scroll
+type scrollContext struct {
+	rest  []interface{} // Results not yet returned
+	size  int
+	total int
+}
+
+// searchResponse returns a search response body holding the page of results
+// out of total matches
+func searchResponse(total int, page []interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"took":      1,
+		"timed_out": false,
+		"hits": map[string]interface{}{
+			"total": map[string]interface{}{"value": total, "relation": "eq"},
+			"hits":  page,
+		},
+	}
+}
+
+// scroll returns the next page of an open scroll, or clears scrolls for a
+// DELETE. The scroll ID may be in the path, the scroll_id parameter, or the
+// body.
+func (s *Server) scroll(call Call) (int, interface{}) {
+	var ids []string
+	if parts := strings.Split(strings.Trim(call.Path, "/"), "/"); len(parts) > 2 {
+		ids = strings.Split(parts[len(parts)-1], ",")
+	} else if id := call.Query.Get("scroll_id"); id != "" {
+		ids = strings.Split(id, ",")
+	} else if len(call.Body) > 0 {
+		var req struct {
+			ScrollID interface{} `json:"scroll_id"`
+		}
+		if err := json.Unmarshal(call.Body, &req); err != nil {
+			return http.StatusBadRequest, err.Error()
+		}
+		switch v := req.ScrollID.(type) {
+		case string:
+			ids = []string{v}
+		case []interface{}:
+			for _, id := range v {
+				ids = append(ids, fmt.Sprint(id))
+			}
+		}
+	}
+
+	if call.Method == http.MethodDelete {
+		freed := 0
+		for _, id := range ids {
+			if id == "_all" {
+				freed += len(s.scrolls)
+				s.scrolls = make(map[string]*scrollContext)
+			} else if _, ok := s.scrolls[id]; ok {
+				delete(s.scrolls, id)
+				freed++
+			}
+		}
+		return http.StatusOK, map[string]interface{}{"succeeded": true, "num_freed": freed}
+	}
+
+	if len(ids) != 1 {
+		return http.StatusBadRequest, "scroll requires a single scroll_id"
+	}
+	ctx, ok := s.scrolls[ids[0]]
+	if !ok {
+		return http.StatusNotFound, fmt.Sprintf("no search context found for id [%s]", ids[0])
+	}
+	page := ctx.rest[:min(ctx.size, len(ctx.rest))]
+	ctx.rest = ctx.rest[len(page):]
+	response := searchResponse(ctx.total, page)
+	response["_scroll_id"] = ids[0]
+	return http.StatusOK, response
+}
+
+func (s *Server) count(call Call) (int, interface{}) {
+	var req searchRequest
+	if len(call.Body) > 0 {
+		if err := json.Unmarshal(call.Body, &req); err != nil {
+			return http.StatusBadRequest, err.Error()
+		}
+	}
+	hits, err := s.match(call.Index, req.Query)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	return http.StatusOK, map[string]interface{}{"count": len(hits)}
+}
+
+func (s *Server) deleteByQuery(call Call) (int, interface{}) {
+	var req searchRequest
+	if err := json.Unmarshal(call.Body, &req); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if req.Query == nil {
+		return http.StatusBadRequest, "query is missing"
+	}
+	hits, err := s.match(call.Index, req.Query)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	for _, h := range hits {
+		delete(s.docs[h.index], h.id)
+	}
+	return http.StatusOK, map[string]interface{}{
+		"took":      1,
+		"timed_out": false,
+		"total":     len(hits),
+		"deleted":   len(hits),
+		"failures":  []interface{}{},
+	}
+}
+
+// mget
+
+func (s *Server) mget(call Call) (int, interface{}) {
+	var req struct {
+		Docs []struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		} `json:"docs"`
+		IDs []string `json:"ids"`
+	}
+	if err := json.Unmarshal(call.Body, &req); err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	for _, id := range req.IDs {
+		req.Docs = append(req.Docs, struct {
+			Index string `json:"_index"`
+			ID    string `json:"_id"`
+		}{ID: id})
+	}
+
+	docs := make([]interface{}, 0, len(req.Docs))
+	for _, ref := range req.Docs {
+		index := ref.Index
+		if index == "" {
+			index = call.Index
+		}
+		if index == "" {
+			return http.StatusBadRequest, fmt.Sprintf("index is missing for doc [%s]", ref.ID)
+		}
+		doc := map[string]interface{}{"_index": index, "_id": ref.ID, "found": false}
+		if source, ok := s.docs[index][ref.ID]; ok {
+			doc["found"] = true
+			doc["_source"] = source
+		}
+		docs = append(docs, doc)
+	}
+	return http.StatusOK, map[string]interface{}{"docs": docs}
+}
+
+// toObject returns v, a JSON object or any value that marshals to one, as
+// a generic map
+func toObject(v interface{}) (map[string]interface{}, error) {
+	raw, ok := v.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(v); err != nil {
+			return nil, err
+		}
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("document is not a JSON object")
+	}
+	return doc, nil
+}
@@ -0,0 +1,350 @@
+package estest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9/esapi"
+)
+
+func TestBulk_AppliesActions(t *testing.T) {
+	es := New(t)
+	es.Put("posts", "at://gone", map[string]interface{}{"like_count": 1})
+	es.Put("posts", "at://liked", map[string]interface{}{"like_count": 1})
+	es.Script("ctx._source.like_count += params.increment", func(source, params map[string]interface{}) {
+		source["like_count"] = source["like_count"].(float64) + params["increment"].(float64)
+	})
+
+	body := `{"index":{"_index":"posts","_id":"at://a"}}
+{"text":"hello"}
+{"create":{"_index":"posts","_id":"at://a"}}
+{"text":"again"}
+{"delete":{"_index":"posts","_id":"at://gone"}}
+{"delete":{"_index":"posts","_id":"at://missing"}}
+{"update":{"_index":"posts","_id":"at://liked"}}
+{"script":{"source":"ctx._source.like_count += params.increment","params":{"increment":2}}}
+{"update":{"_index":"posts","_id":"at://unknown"}}
+{"doc":{"text":"x"}}
+`
+	res, err := es.Client.Bulk(strings.NewReader(body), es.Client.Bulk.WithContext(context.Background()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var response struct {
+		Errors bool                        `json:"errors"`
+		Items  []map[string]map[string]any `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+
+	var statuses []float64
+	for _, item := range response.Items {
+		for _, result := range item {
+			statuses = append(statuses, result["status"].(float64))
+		}
+	}
+	want := []float64{201, 409, 200, 404, 200, 404}
+	if !response.Errors || len(statuses) != len(want) {
+		t.Fatalf("unexpected response %+v", response)
+	}
+	for i := range want {
+		if statuses[i] != want[i] {
+			t.Errorf("item %d: status %v, want %v", i, statuses[i], want[i])
+		}
+	}
+
+	if doc, ok := es.Get("posts", "at://a"); !ok || doc["text"] != "hello" {
+		t.Errorf("expected the create conflict to keep the indexed document, got %v", doc)
+	}
+	if _, ok := es.Get("posts", "at://gone"); ok {
+		t.Error("expected at://gone deleted")
+	}
+	if doc, _ := es.Get("posts", "at://liked"); doc["like_count"] != 3.0 {
+		t.Errorf("expected the script to run, got %v", doc)
+	}
+	if got := es.Calls(APIBulk); len(got) != 1 || len(got[0].BulkIDs()) != 6 {
+		t.Errorf("unexpected calls %+v", got)
+	}
+}
+
+func TestFailItems_CountsAttempts(t *testing.T) {
+	es := New(t)
+	es.FailItems(func(item BulkItem) *ItemFailure {
+		if item.Attempt == 1 {
+			return &ItemFailure{Status: http.StatusTooManyRequests, Type: "es_rejected_execution_exception"}
+		}
+		return nil
+	})
+
+	body := "{\"index\":{\"_index\":\"likes\",\"_id\":\"at://a\"}}\n{}\n"
+	for range 2 {
+		res, err := es.Client.Bulk(strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if es.Len("likes") == 0 && len(es.Calls(APIBulk)) == 2 {
+			t.Error("expected the second attempt to succeed")
+		}
+	}
+	if es.Len("likes") != 1 {
+		t.Errorf("expected the retried document indexed, got %d documents", es.Len("likes"))
+	}
+}
+
+func TestSearch_QueriesSortsAndPages(t *testing.T) {
+	es := New(t)
+	es.Put("posts-1", "at://a", map[string]interface{}{"author_did": "did:plc:a", "created_at": "2026-01-01T00:00:00Z"})
+	es.Put("posts-1", "at://b", map[string]interface{}{"author_did": "did:plc:b", "created_at": "2026-01-02T00:00:00Z", "embeddings": map[string]interface{}{"m": "x"}})
+	es.Put("posts-2", "at://c", map[string]interface{}{"author_did": "did:plc:a", "created_at": "2026-01-03T00:00:00Z"})
+	es.Put("likes", "at://l", map[string]interface{}{"author_did": "did:plc:a"})
+
+	search := func(query string) []string {
+		t.Helper()
+		res, err := es.Client.Search(es.Client.Search.WithIndex("posts-*"), es.Client.Search.WithBody(strings.NewReader(query)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		if res.IsError() {
+			t.Fatalf("search failed: %s", res)
+		}
+		var response struct {
+			Hits struct {
+				Hits []struct {
+					ID string `json:"_id"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, h := range response.Hits.Hits {
+			ids = append(ids, h.ID)
+		}
+		return ids
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`{"query":{"match_all":{}},"sort":[{"created_at":{"order":"desc"}}]}`, "at://c,at://b,at://a"},
+		{`{"query":{"term":{"author_did":"did:plc:a"}},"sort":["created_at"]}`, "at://a,at://c"},
+		{`{"query":{"bool":{"filter":[{"range":{"created_at":{"gt":"2026-01-01T00:00:00Z"}}}],"must_not":{"exists":{"field":"embeddings"}}}}}`, "at://c"},
+		{`{"query":{"ids":{"values":["at://b","at://l"]}}}`, "at://b"},
+		{`{"sort":["created_at"],"search_after":["2026-01-01T00:00:00Z"],"size":1}`, "at://b"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(search(tt.query), ","); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.query, got, tt.want)
+		}
+	}
+
+	res, err := es.Client.Search(es.Client.Search.WithBody(strings.NewReader(`{"query":{"match":{"text":"x"}}}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected an unsupported query to fail, got %s", res.Status())
+	}
+}
+
+func TestSearch_TermsAggregation(t *testing.T) {
+	es := New(t)
+	for id, subject := range map[string]string{"at://l1": "at://a", "at://l2": "at://a", "at://l3": "at://b", "at://l4": "at://c"} {
+		es.Put("likes", id, map[string]interface{}{"subject_uri": subject})
+	}
+
+	query := `{"size":0,"query":{"terms":{"subject_uri":["at://a","at://b"]}},"aggs":{"by_subject":{"terms":{"field":"subject_uri","size":2}}}}`
+	res, err := es.Client.Search(es.Client.Search.WithIndex("likes"), es.Client.Search.WithBody(strings.NewReader(query)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var response struct {
+		Aggregations struct {
+			BySubject struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount int    `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"by_subject"`
+		} `json:"aggregations"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	buckets := response.Aggregations.BySubject.Buckets
+	if len(buckets) != 2 || buckets[0].Key != "at://a" || buckets[0].DocCount != 2 || buckets[1].Key != "at://b" || buckets[1].DocCount != 1 {
+		t.Errorf("unexpected buckets %+v", buckets)
+	}
+}
+
+func TestSearch_SumSubAggregation(t *testing.T) {
+	es := New(t)
+	es.Put("posts", "at://p1", map[string]interface{}{"external_domain": "a.com", "like_count": 2})
+	es.Put("posts", "at://p2", map[string]interface{}{"external_domain": "a.com", "like_count": 3})
+	es.Put("posts", "at://p3", map[string]interface{}{"external_domain": "b.com"})
+
+	query := `{"size":0,"aggs":{"by_domain":{"terms":{"field":"external_domain"},"aggs":{"likes":{"sum":{"field":"like_count"}}}}}}`
+	res, err := es.Client.Search(es.Client.Search.WithIndex("posts"), es.Client.Search.WithBody(strings.NewReader(query)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var response struct {
+		Aggregations struct {
+			ByDomain struct {
+				Buckets []struct {
+					Key   string `json:"key"`
+					Likes struct {
+						Value float64 `json:"value"`
+					} `json:"likes"`
+				} `json:"buckets"`
+			} `json:"by_domain"`
+		} `json:"aggregations"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	buckets := response.Aggregations.ByDomain.Buckets
+	if len(buckets) != 2 || buckets[0].Key != "a.com" || buckets[0].Likes.Value != 5 || buckets[1].Likes.Value != 0 {
+		t.Errorf("unexpected buckets %+v", buckets)
+	}
+}
+
+func TestMgetCountAndDeleteByQuery(t *testing.T) {
+	es := New(t)
+	es.Put("follows", "at://a", map[string]interface{}{"subject_did": "did:plc:x"})
+	es.Put("follows", "at://b", map[string]interface{}{"subject_did": "did:plc:y"})
+
+	res, err := es.Client.Mget(strings.NewReader(`{"docs":[{"_index":"follows","_id":"at://a"},{"_index":"follows","_id":"at://z"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mget struct {
+		Docs []struct {
+			Found bool `json:"found"`
+		} `json:"docs"`
+	}
+	_ = json.NewDecoder(res.Body).Decode(&mget)
+	res.Body.Close()
+	if len(mget.Docs) != 2 || !mget.Docs[0].Found || mget.Docs[1].Found {
+		t.Errorf("unexpected mget %+v", mget)
+	}
+
+	query := `{"query":{"term":{"subject_did":"did:plc:x"}}}`
+	res, err = es.Client.DeleteByQuery([]string{"follows"}, strings.NewReader(query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	res, err = es.Client.Count(es.Client.Count.WithIndex("follows"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count struct {
+		Count int `json:"count"`
+	}
+	_ = json.NewDecoder(res.Body).Decode(&count)
+	res.Body.Close()
+	if count.Count != 1 {
+		t.Errorf("expected 1 follow left, got %d", count.Count)
+	}
+}
+
+func TestSearch_Scroll(t *testing.T) {
+	es := New(t)
+	for _, id := range []string{"at://a", "at://b", "at://c"} {
+		es.Put("likes", id, map[string]interface{}{"author_did": "did:plc:x"})
+	}
+
+	page := func(res *esapi.Response, err error) (string, []string) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		var body struct {
+			ScrollID string `json:"_scroll_id"`
+			Hits     struct {
+				Hits []struct {
+					ID string `json:"_id"`
+				} `json:"hits"`
+			} `json:"hits"`
+		}
+		_ = json.NewDecoder(res.Body).Decode(&body)
+		var ids []string
+		for _, h := range body.Hits.Hits {
+			ids = append(ids, h.ID)
+		}
+		return body.ScrollID, ids
+	}
+
+	query := `{"query":{"term":{"author_did":"did:plc:x"}},"size":2,"sort":[{"_id":"asc"}]}`
+	scrollID, ids := page(es.Client.Search(
+		es.Client.Search.WithIndex("likes"),
+		es.Client.Search.WithBody(strings.NewReader(query)),
+		es.Client.Search.WithScroll(time.Minute),
+	))
+	if scrollID == "" || len(ids) != 2 || ids[0] != "at://a" {
+		t.Fatalf("unexpected first page %q %v", scrollID, ids)
+	}
+
+	next := func() []string {
+		_, ids := page(es.Client.Scroll(es.Client.Scroll.WithScrollID(scrollID), es.Client.Scroll.WithScroll(time.Minute)))
+		return ids
+	}
+	if ids := next(); len(ids) != 1 || ids[0] != "at://c" {
+		t.Errorf("expected the last like on the second page, got %v", ids)
+	}
+	if ids := next(); len(ids) != 0 {
+		t.Errorf("expected an empty page once the scroll is exhausted, got %v", ids)
+	}
+
+	res, err := es.Client.ClearScroll(es.Client.ClearScroll.WithScrollID(scrollID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	res, err = es.Client.Scroll(es.Client.Scroll.WithScrollID(scrollID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 404 {
+		t.Errorf("expected a cleared scroll to be gone, got status %d", res.StatusCode)
+	}
+}
+
+func TestHandle_ScriptsResponses(t *testing.T) {
+	es := New(t)
+	es.Handle(APIBulk, func(call Call) *Response {
+		if bytes.Contains(call.Body, []byte("at://poison")) {
+			return &Response{Status: http.StatusBadRequest, Body: `{"error":{"type":"x_content_parse_exception"}}`}
+		}
+		return nil
+	})
+
+	for _, id := range []string{"at://poison", "at://ok"} {
+		res, err := es.Client.Bulk(strings.NewReader(`{"index":{"_index":"posts","_id":"` + id + `"}}` + "\n{}\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}
+	if _, ok := es.Get("posts", "at://poison"); ok || es.Len("posts") != 1 {
+		t.Error("expected only the unscripted request to be applied")
+	}
+}
@@ -0,0 +1,427 @@
+package estest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// matches reports whether the document id with source matches query. It
+// supports the clauses the services send: match_all, ids, term, terms,
+// range, exists, prefix, and bool. Text is matched exactly, without
+// analysis.
+func matches(query map[string]interface{}, id string, source map[string]interface{}) (bool, error) {
+	if len(query) == 0 {
+		return true, nil
+	}
+	if len(query) != 1 {
+		return false, fmt.Errorf("query has %d clauses, expected 1", len(query))
+	}
+	for kind, body := range query {
+		switch kind {
+		case "match_all":
+			return true, nil
+		case "match_none":
+			return false, nil
+		case "ids":
+			values, _ := object(body)["values"].([]interface{})
+			for _, v := range values {
+				if v == id {
+					return true, nil
+				}
+			}
+			return false, nil
+		case "term", "prefix":
+			field, want, err := fieldClause(kind, body)
+			if err != nil {
+				return false, err
+			}
+			return anyValue(source, field, func(v interface{}) bool {
+				if kind == "prefix" {
+					s, ok := v.(string)
+					prefix, _ := want.(string)
+					return ok && strings.HasPrefix(s, prefix)
+				}
+				c, ok := compare(v, want)
+				return ok && c == 0
+			}), nil
+		case "terms":
+			for field, want := range object(body) {
+				if field == "boost" {
+					continue
+				}
+				values, ok := want.([]interface{})
+				if !ok {
+					return false, fmt.Errorf("[terms] query on [%s] needs a list of values", field)
+				}
+				return anyValue(source, field, func(v interface{}) bool {
+					for _, w := range values {
+						if c, ok := compare(v, w); ok && c == 0 {
+							return true
+						}
+					}
+					return false
+				}), nil
+			}
+			return false, fmt.Errorf("[terms] query names no field")
+		case "range":
+			for field, bounds := range object(body) {
+				return anyValue(source, field, func(v interface{}) bool {
+					return inRange(v, object(bounds))
+				}), nil
+			}
+			return false, fmt.Errorf("[range] query names no field")
+		case "exists":
+			field, _ := object(body)["field"].(string)
+			return anyValue(source, field, func(interface{}) bool { return true }), nil
+		case "bool":
+			return matchBool(object(body), id, source)
+		default:
+			return false, fmt.Errorf("estest does not support [%s] queries", kind)
+		}
+	}
+	return false, nil
+}
+
+// matchBool evaluates a bool query
+func matchBool(body map[string]interface{}, id string, source map[string]interface{}) (bool, error) {
+	for _, occur := range []string{"must", "filter"} {
+		for _, clause := range clauses(body[occur]) {
+			ok, err := matches(clause, id, source)
+			if err != nil || !ok {
+				return false, err
+			}
+		}
+	}
+	for _, clause := range clauses(body["must_not"]) {
+		ok, err := matches(clause, id, source)
+		if err != nil || ok {
+			return false, err
+		}
+	}
+
+	should := clauses(body["should"])
+	minimum := 0
+	if len(should) > 0 && body["must"] == nil && body["filter"] == nil {
+		minimum = 1
+	}
+	if m, ok := body["minimum_should_match"]; ok {
+		n, err := strconv.Atoi(fmt.Sprint(m))
+		if err != nil {
+			return false, fmt.Errorf("estest supports only a number as minimum_should_match, got %v", m)
+		}
+		minimum = n
+	}
+	matched := 0
+	for _, clause := range should {
+		ok, err := matches(clause, id, source)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			matched++
+		}
+	}
+	return matched >= minimum, nil
+}
+
+// clauses returns the clauses of a bool occurrence, which may be a single
+// clause or a list
+func clauses(v interface{}) []map[string]interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{v}
+	case []interface{}:
+		list := make([]map[string]interface{}, 0, len(v))
+		for _, c := range v {
+			list = append(list, object(c))
+		}
+		return list
+	default:
+		return nil
+	}
+}
+
+// fieldClause returns the field and value of a term or prefix query, given
+// as {field: value} or {field: {"value": value}}
+func fieldClause(kind string, body interface{}) (string, interface{}, error) {
+	for field, v := range object(body) {
+		if inner, ok := v.(map[string]interface{}); ok {
+			return field, inner["value"], nil
+		}
+		return field, v, nil
+	}
+	return "", nil, fmt.Errorf("[%s] query names no field", kind)
+}
+
+// inRange reports whether v is within the gt, gte, lt, and lte bounds
+func inRange(v interface{}, bounds map[string]interface{}) bool {
+	for op, bound := range bounds {
+		c, ok := compare(v, bound)
+		switch op {
+		case "gt":
+			if !ok || c <= 0 {
+				return false
+			}
+		case "gte":
+			if !ok || c < 0 {
+				return false
+			}
+		case "lt":
+			if !ok || c >= 0 {
+				return false
+			}
+		case "lte":
+			if !ok || c > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// anyValue reports whether fn holds for the value of field in source, or
+// for any element if it is a list
+func anyValue(source map[string]interface{}, field string, fn func(interface{}) bool) bool {
+	v, ok := lookup(source, field)
+	if !ok || v == nil {
+		return false
+	}
+	if list, ok := v.([]interface{}); ok {
+		for _, e := range list {
+			if fn(e) {
+				return true
+			}
+		}
+		return false
+	}
+	return fn(v)
+}
+
+// lookup returns the value of a dotted field path in source
+func lookup(source map[string]interface{}, field string) (interface{}, bool) {
+	if v, ok := source[field]; ok {
+		return v, true
+	}
+	head, rest, found := strings.Cut(field, ".")
+	if !found {
+		return nil, false
+	}
+	inner, ok := source[head].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	return lookup(inner, rest)
+}
+
+// compare orders two JSON scalars: numbers numerically (including strings
+// that parse as numbers), other strings lexically, which orders RFC 3339
+// timestamps in the same format. ok is false if they cannot be compared.
+func compare(a, b interface{}) (int, bool) {
+	if an, ok := number(a); ok {
+		if bn, ok := number(b); ok {
+			switch {
+			case an < bn:
+				return -1, true
+			case an > bn:
+				return 1, true
+			default:
+				return 0, true
+			}
+		}
+	}
+	if as, ok := a.(string); ok {
+		if bs, ok := b.(string); ok {
+			return strings.Compare(as, bs), true
+		}
+	}
+	if ab, ok := a.(bool); ok {
+		if bb, ok := b.(bool); ok {
+			switch {
+			case ab == bb:
+				return 0, true
+			case !ab:
+				return -1, true
+			default:
+				return 1, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func object(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+// kNN
+
+// nearest returns the k hits whose vectors in the knn clause's field are
+// most similar to its query_vector, scored as Elasticsearch scores cosine
+// similarity, (1 + cosine) / 2, best first. It searches exhaustively, so
+// num_candidates only has to be valid. Hits matching none of the clause's
+// filters, or without a vector, are left out.
+func nearest(knn map[string]interface{}, hits []hit) ([]hit, error) {
+	field, _ := knn["field"].(string)
+	query, ok := vector(knn["query_vector"])
+	if field == "" || !ok || len(query) == 0 {
+		return nil, fmt.Errorf("[knn] needs a field and a query_vector")
+	}
+	k, _ := number(knn["k"])
+	candidates, _ := number(knn["num_candidates"])
+	if k < 1 || candidates < k {
+		return nil, fmt.Errorf("[knn] needs k of at least 1 and num_candidates of at least k, got %v and %v", knn["k"], knn["num_candidates"])
+	}
+
+	var found []hit
+	for _, h := range hits {
+		ok := true
+		for _, clause := range clauses(knn["filter"]) {
+			matched, err := matches(clause, h.id, h.source)
+			if err != nil {
+				return nil, err
+			}
+			ok = ok && matched
+		}
+		raw, _ := lookup(h.source, field)
+		v, isVector := vector(raw)
+		if !ok || !isVector {
+			continue
+		}
+		if len(v) != len(query) {
+			return nil, fmt.Errorf("[knn] query_vector has %d dims but %s of %s has %d", len(query), field, h.id, len(v))
+		}
+		h.score = (1 + cosine(query, v)) / 2
+		found = append(found, h)
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].score > found[j].score })
+	return found[:min(int(k), len(found))], nil
+}
+
+// vector reads a JSON array of numbers
+func vector(v interface{}) ([]float64, bool) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	values := make([]float64, len(list))
+	for i, e := range list {
+		if values[i], ok = number(e); !ok {
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+// cosine returns the cosine similarity of a and b, or 0 if either is zero
+func cosine(a, b []float64) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// sorting
+
+// sortField is one key of a search's sort
+type sortField struct {
+	field string
+	desc  bool
+}
+
+// parseSort parses a search sort: a list of field names or {field: order}
+// or {field: {"order": order}} objects. _doc and _shard_doc sort by index
+// and _id, the fake's stable document order.
+func parseSort(sort []interface{}) ([]sortField, error) {
+	var fields []sortField
+	for _, s := range sort {
+		switch s := s.(type) {
+		case string:
+			fields = append(fields, sortField{field: s})
+		case map[string]interface{}:
+			for field, order := range s {
+				if inner, ok := order.(map[string]interface{}); ok {
+					order = inner["order"]
+				}
+				fields = append(fields, sortField{field: field, desc: order == "desc"})
+			}
+		default:
+			return nil, fmt.Errorf("estest does not support sort [%v]", s)
+		}
+	}
+	if len(fields) == 0 {
+		fields = []sortField{{field: "_doc"}}
+	}
+	return fields, nil
+}
+
+// sortValues returns the sort values of h, as Elasticsearch returns them in
+// hits. A missing field sorts last.
+func sortValues(fields []sortField, h hit) []interface{} {
+	values := make([]interface{}, len(fields))
+	for i, f := range fields {
+		switch f.field {
+		case "_doc", "_shard_doc", "_id":
+			values[i] = h.index + "/" + h.id
+		case "_score":
+			values[i] = h.score
+		default:
+			if v, ok := lookup(h.source, f.field); ok {
+				values[i] = v
+			}
+		}
+	}
+	return values
+}
+
+// compareSort orders two lists of sort values
+func compareSort(fields []sortField, a, b []interface{}) int {
+	for i, f := range fields {
+		var c int
+		switch {
+		case a[i] == nil && b[i] == nil:
+			c = 0
+		case a[i] == nil:
+			return 1
+		case b[i] == nil:
+			return -1
+		default:
+			c, _ = compare(a[i], b[i])
+		}
+		if f.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return 0
+}
@@ -0,0 +1,163 @@
+// Package features defines per-user engagement features. The user_features
+// training export computes every feature through UserAccumulator, and the
+// recommender computes a user's interest vector through it too, so the
+// vector it serves cannot drift from the one models are trained on.
+package features
+
+import (
+	"sort"
+
+	"github.com/greenearth/ingest/internal/embeddings"
+)
+
+// InterestEmbeddingModel is the post embedding averaged into a user's interest vector
+const InterestEmbeddingModel = "all_MiniLM_L12_v2"
+
+// UserFeatures is one user's feature row for a time window
+type UserFeatures struct {
+	UserDID              string `json:"user_did" parquet:"user_did"`
+	WindowStart          string `json:"window_start" parquet:"window_start"`
+	WindowEnd            string `json:"window_end" parquet:"window_end"`
+	LikesGiven           int64  `json:"likes_given" parquet:"likes_given"`
+	DistinctAuthorsLiked int64  `json:"distinct_authors_liked" parquet:"distinct_authors_liked"`
+	PostsAuthored        int64  `json:"posts_authored" parquet:"posts_authored"`
+	RepliesAuthored      int64  `json:"replies_authored" parquet:"replies_authored"`
+	FollowCount          int64  `json:"follow_count" parquet:"follow_count"`
+	InterestVector       string `json:"interest_vector,omitempty" parquet:"interest_vector,optional"` // base85-encoded mean embedding
+	InterestVectorPosts  int64  `json:"interest_vector_posts" parquet:"interest_vector_posts"`
+}
+
+type userState struct {
+	likesGiven   int64
+	likedAuthors map[string]struct{}
+	posts        int64
+	replies      int64
+	follows      int64
+	vectorSum    []float64
+	vectorCount  int64
+}
+
+// UserAccumulator aggregates engagement events into per-user features
+type UserAccumulator struct {
+	users map[string]*userState
+}
+
+// NewUserAccumulator creates an empty accumulator
+func NewUserAccumulator() *UserAccumulator {
+	return &UserAccumulator{users: make(map[string]*userState)}
+}
+
+func (a *UserAccumulator) user(did string) *userState {
+	state, ok := a.users[did]
+	if !ok {
+		state = &userState{likedAuthors: make(map[string]struct{})}
+		a.users[did] = state
+	}
+	return state
+}
+
+// AddLike records a like by userDID of a post written by subjectAuthorDID
+func (a *UserAccumulator) AddLike(userDID, subjectAuthorDID string) {
+	if userDID == "" {
+		return
+	}
+	state := a.user(userDID)
+	state.likesGiven++
+	if subjectAuthorDID != "" {
+		state.likedAuthors[subjectAuthorDID] = struct{}{}
+	}
+}
+
+// AddPost records a post or reply authored by userDID. The post's content
+// embedding, when present, contributes to the user's interest vector.
+func (a *UserAccumulator) AddPost(userDID string, isReply bool, embedding []float32) {
+	if userDID == "" {
+		return
+	}
+	state := a.user(userDID)
+	if isReply {
+		state.replies++
+	} else {
+		state.posts++
+	}
+
+	if len(embedding) == 0 {
+		return
+	}
+	if state.vectorSum == nil {
+		state.vectorSum = make([]float64, len(embedding))
+	}
+	if len(embedding) != len(state.vectorSum) {
+		return // dimension mismatch; skip rather than corrupt the mean
+	}
+	for i, v := range embedding {
+		state.vectorSum[i] += float64(v)
+	}
+	state.vectorCount++
+}
+
+// AddFollow records a follow made by userDID
+func (a *UserAccumulator) AddFollow(userDID string) {
+	if userDID == "" {
+		return
+	}
+	a.user(userDID).follows++
+}
+
+// Len returns the number of users seen
+func (a *UserAccumulator) Len() int {
+	return len(a.users)
+}
+
+// Rows returns one feature row per user, sorted by DID
+func (a *UserAccumulator) Rows(windowStart, windowEnd string) []UserFeatures {
+	dids := make([]string, 0, len(a.users))
+	for did := range a.users {
+		dids = append(dids, did)
+	}
+	sort.Strings(dids)
+
+	rows := make([]UserFeatures, 0, len(dids))
+	for _, did := range dids {
+		state := a.users[did]
+		row := UserFeatures{
+			UserDID:              did,
+			WindowStart:          windowStart,
+			WindowEnd:            windowEnd,
+			LikesGiven:           state.likesGiven,
+			DistinctAuthorsLiked: int64(len(state.likedAuthors)),
+			PostsAuthored:        state.posts,
+			RepliesAuthored:      state.replies,
+			FollowCount:          state.follows,
+			InterestVectorPosts:  state.vectorCount,
+		}
+		if mean := state.meanVector(); mean != nil {
+			if encoded, err := embeddings.Encode(mean); err == nil {
+				row.InterestVector = encoded
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// InterestVector returns the user's mean content embedding, or nil if none
+// of their posts carried one
+func (a *UserAccumulator) InterestVector(did string) []float32 {
+	state, ok := a.users[did]
+	if !ok {
+		return nil
+	}
+	return state.meanVector()
+}
+
+func (s *userState) meanVector() []float32 {
+	if s.vectorCount == 0 {
+		return nil
+	}
+	mean := make([]float32, len(s.vectorSum))
+	for i, sum := range s.vectorSum {
+		mean[i] = float32(sum / float64(s.vectorCount))
+	}
+	return mean
+}
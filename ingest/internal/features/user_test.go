@@ -0,0 +1,71 @@
+package features
+
+import (
+	"testing"
+
+	"github.com/greenearth/ingest/internal/embeddings"
+)
+
+func TestUserAccumulator_Counts(t *testing.T) {
+	acc := NewUserAccumulator()
+	acc.AddLike("did:plc:a", "did:plc:x")
+	acc.AddLike("did:plc:a", "did:plc:x")
+	acc.AddLike("did:plc:a", "did:plc:y")
+	acc.AddPost("did:plc:a", false, nil)
+	acc.AddPost("did:plc:a", true, nil)
+	acc.AddPost("did:plc:b", false, nil)
+	acc.AddFollow("did:plc:b")
+	acc.AddLike("", "did:plc:x")
+
+	rows := acc.Rows("2025-01-01T00:00:00Z", "2025-01-08T00:00:00Z")
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+
+	a := rows[0]
+	if a.UserDID != "did:plc:a" || a.LikesGiven != 3 || a.DistinctAuthorsLiked != 2 {
+		t.Errorf("unexpected like features: %+v", a)
+	}
+	if a.PostsAuthored != 1 || a.RepliesAuthored != 1 {
+		t.Errorf("unexpected post features: %+v", a)
+	}
+	if a.WindowStart != "2025-01-01T00:00:00Z" || a.WindowEnd != "2025-01-08T00:00:00Z" {
+		t.Errorf("unexpected window: %+v", a)
+	}
+
+	b := rows[1]
+	if b.FollowCount != 1 || b.LikesGiven != 0 {
+		t.Errorf("unexpected features for b: %+v", b)
+	}
+}
+
+func TestUserAccumulator_InterestVector(t *testing.T) {
+	acc := NewUserAccumulator()
+	acc.AddPost("did:plc:a", false, []float32{1, 0})
+	acc.AddPost("did:plc:a", true, []float32{0, 1})
+	acc.AddPost("did:plc:a", false, []float32{1, 1, 1}) // wrong dimension, ignored
+	acc.AddPost("did:plc:b", false, nil)
+
+	mean := acc.InterestVector("did:plc:a")
+	if len(mean) != 2 || mean[0] != 0.5 || mean[1] != 0.5 {
+		t.Fatalf("expected mean [0.5 0.5], got %v", mean)
+	}
+	if acc.InterestVector("did:plc:b") != nil {
+		t.Error("expected no interest vector without embeddings")
+	}
+
+	rows := acc.Rows("", "")
+	if rows[0].InterestVectorPosts != 2 {
+		t.Errorf("expected 2 posts averaged, got %d", rows[0].InterestVectorPosts)
+	}
+	decoded, err := embeddings.Decode(rows[0].InterestVector)
+	if err != nil {
+		t.Fatalf("failed to decode interest vector: %v", err)
+	}
+	if len(decoded) != 2 || decoded[0] != 0.5 {
+		t.Errorf("unexpected decoded vector %v", decoded)
+	}
+	if rows[1].InterestVector != "" {
+		t.Error("expected empty interest vector for user without embeddings")
+	}
+}
@@ -0,0 +1,79 @@
+package firehose_ingest
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// readCARBlocks parses a CARv1 archive and returns its blocks keyed by the
+// binary CID (as a string, so it can be used as a map key).
+//
+// Layout: varint header length, DAG-CBOR header, then repeated sections of
+// varint section length followed by the block CID and the block data.
+func readCARBlocks(data []byte) (map[string][]byte, error) {
+	headerLen, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, fmt.Errorf("invalid CAR header length")
+	}
+	pos := n
+	if headerLen > uint64(len(data)-pos) {
+		return nil, fmt.Errorf("CAR header of %d bytes overruns data", headerLen)
+	}
+	header, _, err := decodeCBOR(data[pos : pos+int(headerLen)])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode CAR header: %w", err)
+	}
+	if h, ok := header.(map[string]interface{}); !ok || h["version"] != int64(1) {
+		return nil, fmt.Errorf("unsupported CAR header %v", header)
+	}
+	pos += int(headerLen)
+
+	blocks := make(map[string][]byte)
+	for pos < len(data) {
+		sectionLen, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return nil, fmt.Errorf("invalid CAR section length at offset %d", pos)
+		}
+		pos += n
+		if sectionLen > uint64(len(data)-pos) {
+			return nil, fmt.Errorf("CAR section of %d bytes overruns data at offset %d", sectionLen, pos)
+		}
+		section := data[pos : pos+int(sectionLen)]
+		pos += int(sectionLen)
+
+		cidLen, err := cidLength(section)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block CID at offset %d: %w", pos, err)
+		}
+		blocks[string(section[:cidLen])] = section[cidLen:]
+	}
+
+	return blocks, nil
+}
+
+// cidLength returns the byte length of the binary CID at the front of data
+func cidLength(data []byte) (int, error) {
+	// CIDv0 is a bare sha2-256 multihash
+	if len(data) >= 34 && data[0] == 0x12 && data[1] == 0x20 {
+		return 34, nil
+	}
+
+	pos := 0
+	// version, codec, multihash function code
+	for i := 0; i < 3; i++ {
+		_, n := binary.Uvarint(data[pos:])
+		if n <= 0 {
+			return 0, fmt.Errorf("truncated CID prefix")
+		}
+		pos += n
+	}
+	digestLen, n := binary.Uvarint(data[pos:])
+	if n <= 0 {
+		return 0, fmt.Errorf("truncated multihash length")
+	}
+	pos += n
+	if digestLen > uint64(len(data)-pos) {
+		return 0, fmt.Errorf("multihash digest overruns block")
+	}
+	return pos + int(digestLen), nil
+}
@@ -0,0 +1,243 @@
+package firehose_ingest
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// cidTag is the CBOR tag DAG-CBOR uses for CID links
+const cidTag = 42
+
+// maxCBORDepth bounds nesting so a malicious frame cannot exhaust the stack
+const maxCBORDepth = 64
+
+// CID is a binary content identifier as it appears in DAG-CBOR links and CAR
+// block headers
+type CID []byte
+
+// String renders the CID in the base32 multibase form used by the AT Protocol
+// JSON encoding ("bafyrei...")
+func (c CID) String() string {
+	return "b" + strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(c))
+}
+
+// cborDecoder decodes the DAG-CBOR subset used by the firehose: definite
+// lengths only, string map keys, and tag 42 for CID links.
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// decodeCBOR decodes a single DAG-CBOR value from the front of data and
+// returns it along with the number of bytes consumed.
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	d := &cborDecoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, 0, err
+	}
+	return v, d.pos, nil
+}
+
+func (d *cborDecoder) readByte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, fmt.Errorf("unexpected end of CBOR data at offset %d", d.pos)
+	}
+	b := d.data[d.pos]
+	d.pos++
+	return b, nil
+}
+
+func (d *cborDecoder) readN(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, fmt.Errorf("CBOR item of %d bytes overruns data at offset %d", n, d.pos)
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// argument reads the length/value argument that follows an initial byte
+func (d *cborDecoder) argument(info byte) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info == 24:
+		b, err := d.readN(1)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(b[0]), nil
+	case info == 25:
+		b, err := d.readN(2)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint16(b)), nil
+	case info == 26:
+		b, err := d.readN(4)
+		if err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint32(b)), nil
+	case info == 27:
+		b, err := d.readN(8)
+		if err != nil {
+			return 0, err
+		}
+		return binary.BigEndian.Uint64(b), nil
+	default:
+		return 0, fmt.Errorf("unsupported CBOR additional info %d (indefinite lengths are not valid DAG-CBOR)", info)
+	}
+}
+
+func (d *cborDecoder) value(depth int) (interface{}, error) {
+	if depth > maxCBORDepth {
+		return nil, fmt.Errorf("CBOR nesting exceeds %d levels", maxCBORDepth)
+	}
+
+	initial, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	major, info := initial>>5, initial&0x1f
+
+	if major == 7 {
+		return d.simple(info)
+	}
+
+	arg, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("CBOR integer %d overflows int64", arg)
+		}
+		return int64(arg), nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, fmt.Errorf("CBOR negative integer overflows int64")
+		}
+		return -1 - int64(arg), nil
+	case 2:
+		b, err := d.readN(arg)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	case 3:
+		b, err := d.readN(arg)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case 4:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, fmt.Errorf("CBOR array of %d items overruns data", arg)
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case 5:
+		if arg > uint64(len(d.data)-d.pos) {
+			return nil, fmt.Errorf("CBOR map of %d entries overruns data", arg)
+		}
+		m := make(map[string]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("CBOR map key is %T, DAG-CBOR requires strings", key)
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = v
+		}
+		return m, nil
+	case 6:
+		if arg != cidTag {
+			return nil, fmt.Errorf("unsupported CBOR tag %d", arg)
+		}
+		inner, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := inner.([]byte)
+		if !ok || len(b) == 0 || b[0] != 0x00 {
+			return nil, fmt.Errorf("malformed CID link")
+		}
+		// Drop the identity multibase prefix DAG-CBOR puts in front of links
+		return CID(b[1:]), nil
+	}
+	return nil, fmt.Errorf("unknown CBOR major type %d", major)
+}
+
+// simple decodes major type 7: booleans, null, and floats
+func (d *cborDecoder) simple(info byte) (interface{}, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22:
+		return nil, nil
+	case 26:
+		b, err := d.readN(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), nil
+	case 27:
+		b, err := d.readN(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	default:
+		return nil, fmt.Errorf("unsupported CBOR simple value %d", info)
+	}
+}
+
+// jsonValue converts a decoded DAG-CBOR value to the AT Protocol JSON data
+// model, so records match what Jetstream and MegaStream deliver: links become
+// {"$link": cid} and byte strings become {"$bytes": base64}.
+func jsonValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case CID:
+		return map[string]interface{}{"$link": val.String()}
+	case []byte:
+		return map[string]interface{}{"$bytes": base64.RawStdEncoding.EncodeToString(val)}
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = jsonValue(item)
+		}
+		return out
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = jsonValue(item)
+		}
+		return out
+	default:
+		return val
+	}
+}
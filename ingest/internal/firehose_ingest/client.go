@@ -0,0 +1,195 @@
+package firehose_ingest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// Client is a WebSocket client for the AT Protocol firehose
+// (com.atproto.sync.subscribeRepos). It delivers raw binary frames; decode
+// them with DecodeFrame.
+type Client struct {
+	url       string
+	cursor    *int64 // Optional firehose sequence number to resume from
+	conn      *websocket.Conn
+	msgChan   chan []byte
+	logger    *common.IngestLogger
+	reconnect bool
+	mu        sync.RWMutex // Protects conn, cursor and reconnect fields
+}
+
+// NewClient creates a new firehose WebSocket client
+func NewClient(url string, logger *common.IngestLogger) *Client {
+	return &Client{
+		url:       url,
+		msgChan:   make(chan []byte, 10000),
+		logger:    logger,
+		reconnect: true,
+	}
+}
+
+// SetCursor sets the sequence number to resume from on the next connection
+func (c *Client) SetCursor(seq int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cursor = &seq
+}
+
+// UpdateCursor records the latest processed sequence number so reconnects
+// resume from it rather than from the startup cursor
+func (c *Client) UpdateCursor(seq int64) {
+	c.SetCursor(seq)
+}
+
+// Connect establishes a WebSocket connection to the firehose
+func (c *Client) Connect(ctx context.Context) error {
+	url := c.url
+
+	c.mu.RLock()
+	cursor := c.cursor
+	c.mu.RUnlock()
+
+	if cursor != nil {
+		url = fmt.Sprintf("%s?cursor=%d", c.url, *cursor)
+		c.logger.Info("Connecting to firehose at %s with cursor (resuming from seq %d)", c.url, *cursor)
+	} else {
+		c.logger.Info("Connecting to firehose at %s", c.url)
+	}
+
+	dialer := websocket.DefaultDialer
+	dialer.HandshakeTimeout = 30 * time.Second
+
+	conn, resp, err := dialer.DialContext(ctx, url, nil)
+	if resp != nil && resp.Body != nil {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			c.logger.Error("Failed to close HTTP response body: %v", closeErr)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to firehose: %w", err)
+	}
+
+	// Commits with many blocks can be large; the relay caps frames well below this
+	conn.SetReadLimit(16 << 20)
+
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+	c.logger.Info("Successfully connected to firehose")
+
+	return nil
+}
+
+// Start connects and begins reading frames in the background
+func (c *Client) Start(ctx context.Context) error {
+	if err := c.Connect(ctx); err != nil {
+		return err
+	}
+
+	go c.readLoop(ctx)
+
+	return nil
+}
+
+// readLoop reads frames until ctx is cancelled, reconnecting on failure
+func (c *Client) readLoop(ctx context.Context) {
+	defer close(c.msgChan)
+
+	go func() {
+		<-ctx.Done()
+		c.mu.Lock()
+		c.reconnect = false
+		if c.conn != nil {
+			if err := c.conn.Close(); err != nil {
+				c.logger.Error("Failed to close WebSocket connection on shutdown: %v", err)
+			}
+		}
+		c.mu.Unlock()
+	}()
+
+	for {
+		c.mu.RLock()
+		conn := c.conn
+		shouldReconnect := c.reconnect
+		c.mu.RUnlock()
+
+		if conn == nil {
+			if !shouldReconnect {
+				return
+			}
+			c.logger.Info("Attempting to reconnect...")
+			if err := c.Connect(ctx); err != nil {
+				c.logger.Error("Reconnection failed: %v, retrying in 5 seconds", err)
+				select {
+				case <-time.After(5 * time.Second):
+				case <-ctx.Done():
+					return
+				}
+				continue
+			}
+			c.mu.RLock()
+			conn = c.conn
+			c.mu.RUnlock()
+		}
+
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				c.logger.Info("WebSocket connection closed normally")
+			} else {
+				c.logger.Error("Error reading from WebSocket: %v", err)
+			}
+			c.mu.Lock()
+			c.conn = nil
+			shouldReconnect = c.reconnect
+			c.mu.Unlock()
+			if shouldReconnect {
+				c.logger.Info("Reconnecting in 5 seconds...")
+				select {
+				case <-time.After(5 * time.Second):
+				case <-ctx.Done():
+					return
+				}
+			}
+			continue
+		}
+
+		if messageType != websocket.BinaryMessage {
+			c.logger.Debug("Ignoring non-binary firehose message")
+			continue
+		}
+
+		select {
+		case c.msgChan <- message:
+		case <-time.After(5 * time.Second):
+			c.logger.Error("Message channel full for 5 seconds, dropping frame")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// GetMessageChannel returns the channel that receives raw binary frames
+func (c *Client) GetMessageChannel() <-chan []byte {
+	return c.msgChan
+}
+
+// Close closes the WebSocket connection
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.reconnect = false
+	if c.conn != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package firehose_ingest
+
+import (
+	"encoding/json"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// Firehose ops are re-encoded in the JSON shapes Jetstream and MegaStream
+// deliver so the common message parsers, and therefore the post and like
+// document builders, are shared with the other ingest commands.
+
+// JetstreamMessage converts an op (a like, for example) into a
+// common.JetstreamMessage as if it had arrived from Jetstream
+func (f *Frame) JetstreamMessage(op Op, logger *common.IngestLogger) common.JetstreamMessage {
+	var event common.JetstreamEventData
+	event.Did = f.Repo
+	event.TimeUs = f.TimeUs
+	event.Kind = "commit"
+	event.Commit.Operation = op.Action
+	event.Commit.Collection = op.Collection
+	event.Commit.RKey = op.RKey
+	event.Commit.Record = op.Record
+	event.Commit.CID = op.CID
+
+	raw, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("Failed to encode firehose op %s as Jetstream JSON: %v", f.AtURI(op), err)
+	}
+	return common.NewJetstreamMessage(string(raw), logger)
+}
+
+// MegaStreamMessage converts a post op into a common.MegaStreamMessage. The
+// firehose is not hydrated, so the thread and quote references MegaStream
+// supplies in hydrated_metadata are taken from the record itself.
+func (f *Frame) MegaStreamMessage(op Op, logger *common.IngestLogger) common.MegaStreamMessage {
+	message := map[string]interface{}{
+		"did":     f.Repo,
+		"time_us": f.TimeUs,
+		"kind":    "commit",
+		"commit": map[string]interface{}{
+			"operation":  op.Action,
+			"collection": op.Collection,
+			"rkey":       op.RKey,
+			"cid":        op.CID,
+			"record":     op.Record,
+		},
+	}
+
+	hydrated := map[string]interface{}{}
+	if reply, ok := op.Record["reply"].(map[string]interface{}); ok {
+		if root := refURI(reply["root"]); root != "" {
+			hydrated["reply_post"] = map[string]interface{}{"uri": root}
+		}
+		if parent := refURI(reply["parent"]); parent != "" {
+			hydrated["parent_post"] = map[string]interface{}{"uri": parent}
+		}
+	}
+	if quote := quotedURI(op.Record); quote != "" {
+		hydrated["quote_post"] = map[string]interface{}{"uri": quote}
+	}
+
+	raw, err := json.Marshal(map[string]interface{}{
+		"message":           message,
+		"hydrated_metadata": hydrated,
+	})
+	if err != nil {
+		logger.Error("Failed to encode firehose op %s as MegaStream JSON: %v", f.AtURI(op), err)
+	}
+	return common.NewMegaStreamMessage(f.AtURI(op), f.Repo, string(raw), "{}", logger)
+}
+
+// quotedURI returns the URI of the post a record quotes, if any
+func quotedURI(record map[string]interface{}) string {
+	embed, ok := record["embed"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	switch embed["$type"] {
+	case "app.bsky.embed.record":
+		return refURI(embed["record"])
+	case "app.bsky.embed.recordWithMedia":
+		if inner, ok := embed["record"].(map[string]interface{}); ok {
+			return refURI(inner["record"])
+		}
+	}
+	return ""
+}
+
+// refURI extracts the uri from a com.atproto.repo.strongRef
+func refURI(ref interface{}) string {
+	m, ok := ref.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	uri, _ := m["uri"].(string)
+	return uri
+}
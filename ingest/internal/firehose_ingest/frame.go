@@ -0,0 +1,125 @@
+package firehose_ingest
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Frame is a decoded com.atproto.sync.subscribeRepos event. Only #commit
+// frames carry Ops; other types (#identity, #account, #sync) are surfaced so
+// the caller can still advance its cursor past them.
+type Frame struct {
+	Type   string
+	Seq    int64
+	Repo   string
+	TimeUs int64
+	Ops    []Op
+}
+
+// Op is a single record operation within a commit, with its record resolved
+// from the commit's CAR blocks
+type Op struct {
+	Action     string // create, update, or delete
+	Collection string
+	RKey       string
+	CID        string
+	Record     map[string]interface{} // nil for deletes and for records missing from the CAR
+}
+
+// AtURI returns the at:// URI of the record the op touches
+func (f *Frame) AtURI(op Op) string {
+	return fmt.Sprintf("at://%s/%s/%s", f.Repo, op.Collection, op.RKey)
+}
+
+// DecodeFrame decodes a binary firehose WebSocket message. Each message is two
+// concatenated DAG-CBOR objects: a header {op, t} and a body whose shape
+// depends on t. Error frames (op = -1) are returned as errors.
+func DecodeFrame(data []byte) (*Frame, error) {
+	rawHeader, n, err := decodeCBOR(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode frame header: %w", err)
+	}
+	header, ok := rawHeader.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("frame header is %T, expected map", rawHeader)
+	}
+
+	rawBody, _, err := decodeCBOR(data[n:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode frame body: %w", err)
+	}
+	body, ok := rawBody.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("frame body is %T, expected map", rawBody)
+	}
+
+	if op, _ := header["op"].(int64); op == -1 {
+		errName, _ := body["error"].(string)
+		message, _ := body["message"].(string)
+		return nil, fmt.Errorf("firehose error frame: %s: %s", errName, message)
+	}
+
+	frame := &Frame{}
+	frame.Type, _ = header["t"].(string)
+	frame.Seq, _ = body["seq"].(int64)
+	if frame.Repo, ok = body["repo"].(string); !ok {
+		frame.Repo, _ = body["did"].(string)
+	}
+	if rawTime, ok := body["time"].(string); ok {
+		if t, err := time.Parse(time.RFC3339Nano, rawTime); err == nil {
+			frame.TimeUs = t.UnixMicro()
+		}
+	}
+
+	if frame.Type != "#commit" {
+		return frame, nil
+	}
+
+	var blocks map[string][]byte
+	if car, ok := body["blocks"].([]byte); ok && len(car) > 0 {
+		if blocks, err = readCARBlocks(car); err != nil {
+			return nil, fmt.Errorf("failed to read commit blocks (seq %d): %w", frame.Seq, err)
+		}
+	}
+
+	rawOps, _ := body["ops"].([]interface{})
+	for _, rawOp := range rawOps {
+		opMap, ok := rawOp.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		action, _ := opMap["action"].(string)
+		path, _ := opMap["path"].(string)
+		collection, rkey, found := strings.Cut(path, "/")
+		if !found {
+			continue
+		}
+
+		op := Op{Action: action, Collection: collection, RKey: rkey}
+		if cid, ok := opMap["cid"].(CID); ok {
+			op.CID = cid.String()
+			if action != "delete" {
+				op.Record = resolveRecord(blocks, cid)
+			}
+		}
+		frame.Ops = append(frame.Ops, op)
+	}
+
+	return frame, nil
+}
+
+// resolveRecord decodes the record block for cid, or returns nil when the
+// block is absent (tooBig commits omit blocks) or undecodable
+func resolveRecord(blocks map[string][]byte, cid CID) map[string]interface{} {
+	block, ok := blocks[string(cid)]
+	if !ok {
+		return nil
+	}
+	decoded, _, err := decodeCBOR(block)
+	if err != nil {
+		return nil
+	}
+	record, _ := jsonValue(decoded).(map[string]interface{})
+	return record
+}
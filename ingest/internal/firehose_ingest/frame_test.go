@@ -0,0 +1,237 @@
+package firehose_ingest
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// encodeCBOR is a minimal DAG-CBOR encoder used to build test frames
+func encodeCBOR(v interface{}) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n < 1<<8:
+			return []byte{major<<5 | 24, byte(n)}
+		case n < 1<<16:
+			b := []byte{major<<5 | 25, 0, 0}
+			binary.BigEndian.PutUint16(b[1:], uint16(n))
+			return b
+		default:
+			b := []byte{major<<5 | 26, 0, 0, 0, 0}
+			binary.BigEndian.PutUint32(b[1:], uint32(n))
+			return b
+		}
+	}
+
+	switch val := v.(type) {
+	case nil:
+		return []byte{0xf6}
+	case bool:
+		if val {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case int:
+		if val < 0 {
+			return head(1, uint64(-1-val))
+		}
+		return head(0, uint64(val))
+	case string:
+		return append(head(3, uint64(len(val))), val...)
+	case []byte:
+		return append(head(2, uint64(len(val))), val...)
+	case CID:
+		link := append([]byte{0x00}, val...)
+		return append([]byte{0xd8, cidTag}, encodeCBOR(link)...)
+	case []interface{}:
+		out := head(4, uint64(len(val)))
+		for _, item := range val {
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := head(5, uint64(len(val)))
+		for _, k := range keys {
+			out = append(out, encodeCBOR(k)...)
+			out = append(out, encodeCBOR(val[k])...)
+		}
+		return out
+	}
+	panic("unsupported test value")
+}
+
+// testCID builds a CIDv1 (dag-cbor, sha2-256) for block data
+func testCID(data []byte) CID {
+	digest := sha256.Sum256(data)
+	return append(CID{0x01, 0x71, 0x12, 0x20}, digest[:]...)
+}
+
+// buildCAR packs blocks into a CARv1 archive
+func buildCAR(blocks ...[]byte) []byte {
+	header := encodeCBOR(map[string]interface{}{"version": 1, "roots": []interface{}{}})
+	out := binary.AppendUvarint(nil, uint64(len(header)))
+	out = append(out, header...)
+	for _, block := range blocks {
+		cid := testCID(block)
+		out = binary.AppendUvarint(out, uint64(len(cid)+len(block)))
+		out = append(out, cid...)
+		out = append(out, block...)
+	}
+	return out
+}
+
+func commitFrame(ops []interface{}, blocks ...[]byte) []byte {
+	header := encodeCBOR(map[string]interface{}{"op": 1, "t": "#commit"})
+	body := encodeCBOR(map[string]interface{}{
+		"seq":    12345,
+		"repo":   "did:plc:author",
+		"time":   "2025-10-30T12:34:56.789Z",
+		"ops":    ops,
+		"blocks": buildCAR(blocks...),
+	})
+	return append(header, body...)
+}
+
+func TestDecodeCBOR_Scalars(t *testing.T) {
+	cases := []struct {
+		in   interface{}
+		want interface{}
+	}{
+		{0, int64(0)},
+		{23, int64(23)},
+		{500, int64(500)},
+		{-1, int64(-1)},
+		{-1000, int64(-1000)},
+		{"hello", "hello"},
+		{true, true},
+		{nil, nil},
+	}
+	for _, tc := range cases {
+		got, n, err := decodeCBOR(encodeCBOR(tc.in))
+		if err != nil {
+			t.Errorf("decode %v: %v", tc.in, err)
+			continue
+		}
+		if got != tc.want || n != len(encodeCBOR(tc.in)) {
+			t.Errorf("decode %v = %v (%d bytes), want %v", tc.in, got, n, tc.want)
+		}
+	}
+}
+
+func TestDecodeCBOR_RejectsMalformed(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"truncated string": {0x65, 'a', 'b'},
+		"indefinite map":   {0xbf},
+		"non-string key":   {0xa1, 0x01, 0x01},
+		"oversized array":  {0x9a, 0xff, 0xff, 0xff, 0xff},
+		"unsupported tag":  {0xc1, 0x00},
+	} {
+		if _, _, err := decodeCBOR(data); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestDecodeFrame_ResolvesRecordsFromCAR(t *testing.T) {
+	like := encodeCBOR(map[string]interface{}{
+		"$type":     "app.bsky.feed.like",
+		"createdAt": "2025-10-30T12:34:56.000Z",
+		"subject":   map[string]interface{}{"uri": "at://did:plc:other/app.bsky.feed.post/abc", "cid": "bafy"},
+	})
+	data := commitFrame([]interface{}{
+		map[string]interface{}{"action": "create", "path": "app.bsky.feed.like/3kabc", "cid": testCID(like)},
+		map[string]interface{}{"action": "delete", "path": "app.bsky.feed.post/3kdel", "cid": nil},
+	}, like)
+
+	frame, err := DecodeFrame(data)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if frame.Type != "#commit" || frame.Seq != 12345 || frame.Repo != "did:plc:author" {
+		t.Fatalf("unexpected frame %+v", frame)
+	}
+	if frame.TimeUs != 1761827696789000 {
+		t.Errorf("TimeUs = %d", frame.TimeUs)
+	}
+	if len(frame.Ops) != 2 {
+		t.Fatalf("expected 2 ops, got %d", len(frame.Ops))
+	}
+	if frame.Ops[0].Record["$type"] != "app.bsky.feed.like" {
+		t.Errorf("expected like record to be resolved, got %v", frame.Ops[0].Record)
+	}
+	if frame.Ops[1].Action != "delete" || frame.Ops[1].Record != nil {
+		t.Errorf("unexpected delete op %+v", frame.Ops[1])
+	}
+
+	msg := frame.JetstreamMessage(frame.Ops[0], common.NewLogger(false))
+	if !msg.IsLike() || msg.GetAtURI() != "at://did:plc:author/app.bsky.feed.like/3kabc" || msg.GetSubjectURI() != "at://did:plc:other/app.bsky.feed.post/abc" {
+		t.Errorf("like not converted: uri=%s subject=%s", msg.GetAtURI(), msg.GetSubjectURI())
+	}
+}
+
+func TestDecodeFrame_ErrorFrame(t *testing.T) {
+	data := append(encodeCBOR(map[string]interface{}{"op": -1}),
+		encodeCBOR(map[string]interface{}{"error": "FutureCursor", "message": "cursor in the future"})...)
+	if _, err := DecodeFrame(data); err == nil {
+		t.Error("expected error frame to be returned as an error")
+	}
+}
+
+func TestMegaStreamMessage_ReplyAndQuote(t *testing.T) {
+	post := encodeCBOR(map[string]interface{}{
+		"$type":     "app.bsky.feed.post",
+		"text":      "replying with a quote",
+		"createdAt": "2025-10-30T12:34:56.000Z",
+		"reply": map[string]interface{}{
+			"root":   map[string]interface{}{"uri": "at://did:plc:a/app.bsky.feed.post/root"},
+			"parent": map[string]interface{}{"uri": "at://did:plc:b/app.bsky.feed.post/parent"},
+		},
+		"embed": map[string]interface{}{
+			"$type":  "app.bsky.embed.record",
+			"record": map[string]interface{}{"uri": "at://did:plc:c/app.bsky.feed.post/quoted"},
+		},
+	})
+	frame, err := DecodeFrame(commitFrame([]interface{}{
+		map[string]interface{}{"action": "create", "path": "app.bsky.feed.post/3kpost", "cid": testCID(post)},
+	}, post))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	msg := frame.MegaStreamMessage(frame.Ops[0], common.NewLogger(false))
+	if msg.GetContent() != "replying with a quote" || msg.GetAtURI() != "at://did:plc:author/app.bsky.feed.post/3kpost" {
+		t.Errorf("unexpected content %q / uri %s", msg.GetContent(), msg.GetAtURI())
+	}
+	if msg.GetThreadRootPost() != "at://did:plc:a/app.bsky.feed.post/root" || msg.GetThreadParentPost() != "at://did:plc:b/app.bsky.feed.post/parent" {
+		t.Errorf("thread not taken from record: root=%s parent=%s", msg.GetThreadRootPost(), msg.GetThreadParentPost())
+	}
+	if msg.GetQuotePost() != "at://did:plc:c/app.bsky.feed.post/quoted" {
+		t.Errorf("quote = %s", msg.GetQuotePost())
+	}
+	if msg.GetTimeUs() != frame.TimeUs {
+		t.Errorf("time_us = %d, want %d", msg.GetTimeUs(), frame.TimeUs)
+	}
+}
+
+func TestJSONValue_LinksAndBytes(t *testing.T) {
+	cid := testCID([]byte("blob"))
+	got := jsonValue(map[string]interface{}{"ref": cid, "raw": []byte{0xde, 0xad}}).(map[string]interface{})
+
+	link := got["ref"].(map[string]interface{})["$link"].(string)
+	if link != cid.String() || link[:7] != "bafyrei" {
+		t.Errorf("link = %s", link)
+	}
+	if got["raw"].(map[string]interface{})["$bytes"] != "3q0" {
+		t.Errorf("bytes = %v", got["raw"])
+	}
+}
@@ -0,0 +1,134 @@
+package index_digest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/storage"
+)
+
+// Mismatch is an hour whose digest differs between two reports
+type Mismatch struct {
+	Index     string
+	Hour      string
+	Baseline  Digest
+	Candidate Digest
+}
+
+// Compare returns the hours whose count or XOR differ between baseline and
+// candidate. Only hours present in both reports are compared, so a report
+// covering a wider range can be verified against a narrower one.
+func Compare(baseline, candidate *Report) []Mismatch {
+	type key struct {
+		index string
+		hour  int64
+	}
+	candidates := make(map[key]Digest, len(candidate.Digests))
+	for _, d := range candidate.Digests {
+		candidates[key{d.Index, d.Hour.Unix()}] = d
+	}
+
+	var mismatches []Mismatch
+	for _, b := range baseline.Digests {
+		c, ok := candidates[key{b.Index, b.Hour.Unix()}]
+		if !ok {
+			continue
+		}
+		if b.Count != c.Count || b.XOR != c.XOR {
+			mismatches = append(mismatches, Mismatch{
+				Index:     b.Index,
+				Hour:      b.Hour.UTC().Format("2006-01-02T15"),
+				Baseline:  b,
+				Candidate: c,
+			})
+		}
+	}
+	return mismatches
+}
+
+// WriteReport writes report as JSON to a local path or GCS (gs://bucket/object)
+func WriteReport(ctx context.Context, path string, report *Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal digest report: %w", err)
+	}
+
+	if !strings.HasPrefix(path, "gs://") {
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return fmt.Errorf("failed to write digest report: %w", err)
+		}
+		return nil
+	}
+
+	bucket, object, err := parseGCSPath(path)
+	if err != nil {
+		return err
+	}
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	writer := client.Bucket(bucket).Object(object).NewWriter(ctx)
+	writer.ContentType = "application/json"
+	if _, err := writer.Write(data); err != nil {
+		_ = writer.Close()
+		return fmt.Errorf("failed to write digest report to GCS: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to finalize digest report in GCS: %w", err)
+	}
+	return nil
+}
+
+// ReadReport reads a report written by WriteReport
+func ReadReport(ctx context.Context, path string) (*Report, error) {
+	var data []byte
+	if strings.HasPrefix(path, "gs://") {
+		bucket, object, err := parseGCSPath(path)
+		if err != nil {
+			return nil, err
+		}
+		client, err := storage.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GCS client: %w", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		reader, err := client.Bucket(bucket).Object(object).NewReader(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open digest report in GCS: %w", err)
+		}
+		defer func() { _ = reader.Close() }() // Best-effort close for read operation
+
+		data, err = io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read digest report from GCS: %w", err)
+		}
+	} else {
+		var err error
+		data, err = os.ReadFile(path) //nolint:gosec // G304: path comes from a command line flag
+		if err != nil {
+			return nil, fmt.Errorf("failed to read digest report: %w", err)
+		}
+	}
+
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse digest report %s: %w", path, err)
+	}
+	return &report, nil
+}
+
+func parseGCSPath(path string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "gs://"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid GCS path format: %s (expected gs://bucket/object)", path)
+	}
+	return parts[0], parts[1], nil
+}
@@ -0,0 +1,263 @@
+package index_digest
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// DefaultIndices are the aliases digested by default
+var DefaultIndices = []string{"posts", "likes"}
+
+// Config holds configuration for the digest service
+type Config struct {
+	Indices   []string      // Aliases to digest (e.g., "posts", "likes")
+	PageSize  int           // Documents fetched per search page
+	KeepAlive time.Duration // Point-in-time keep-alive between pages
+}
+
+// Digest summarizes the documents of one index whose created_at falls in one
+// UTC hour. XOR is order-independent, so two copies of the same data produce
+// the same digest however they were written.
+type Digest struct {
+	Index string    `json:"index"`
+	Hour  time.Time `json:"hour"`
+	Count int64     `json:"count"`
+	XOR   string    `json:"xor"` // Hex XOR of the 64-bit hashes of every at_uri
+}
+
+// Report is a stored set of digests
+type Report struct {
+	Environment string    `json:"environment"`
+	Label       string    `json:"label,omitempty"` // e.g. "pre-restore"
+	ComputedAt  time.Time `json:"computed_at"`
+	From        time.Time `json:"from"`
+	To          time.Time `json:"to"`
+	Digests     []Digest  `json:"digests"`
+}
+
+// Service computes per-hour index digests
+type Service struct {
+	client *elasticsearch.Client
+	config Config
+	logger *common.IngestLogger
+}
+
+// NewService creates a new digest service
+func NewService(client *elasticsearch.Client, config Config, logger *common.IngestLogger) *Service {
+	if len(config.Indices) == 0 {
+		config.Indices = DefaultIndices
+	}
+	if config.PageSize <= 0 {
+		config.PageSize = 5000
+	}
+	if config.KeepAlive <= 0 {
+		config.KeepAlive = 5 * time.Minute
+	}
+	return &Service{
+		client: client,
+		config: config,
+		logger: logger,
+	}
+}
+
+// HashURI returns the 64-bit hash of an at_uri that is folded into a digest
+func HashURI(atURI string) uint64 {
+	sum := sha256.Sum256([]byte(atURI))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// Compute digests every configured index for each hour in [from, to). from
+// and to are truncated to the hour; hours with no documents get a zero digest
+// so that a missing hour and an empty hour compare equal.
+func (s *Service) Compute(ctx context.Context, from, to time.Time) ([]Digest, error) {
+	from, to = from.UTC().Truncate(time.Hour), to.UTC().Truncate(time.Hour)
+	if !to.After(from) {
+		return nil, fmt.Errorf("digest range %s to %s is empty", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+
+	var digests []Digest
+	for _, index := range s.config.Indices {
+		start := time.Now()
+		indexDigests, err := s.computeIndex(ctx, index, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("failed to digest %s: %w", index, err)
+		}
+		s.logger.Metric("index_digest.compute.duration_ms", float64(time.Since(start).Milliseconds()))
+		digests = append(digests, indexDigests...)
+	}
+	return digests, nil
+}
+
+type hourAccumulator struct {
+	count int64
+	xor   uint64
+}
+
+func (s *Service) computeIndex(ctx context.Context, index string, from, to time.Time) ([]Digest, error) {
+	hours := make(map[time.Time]*hourAccumulator)
+	for h := from; h.Before(to); h = h.Add(time.Hour) {
+		hours[h] = &hourAccumulator{}
+	}
+
+	pitID, err := s.openPIT(ctx, index)
+	if err != nil {
+		return nil, err
+	}
+	defer s.closePIT(pitID)
+
+	var searchAfter []interface{}
+	var docs int64
+	for {
+		page, err := s.searchPage(ctx, pitID, from, to, searchAfter)
+		if err != nil {
+			return nil, err
+		}
+		if page.PitID != "" {
+			pitID = page.PitID
+		}
+		for _, hit := range page.Hits.Hits {
+			createdAt, err := time.Parse(time.RFC3339Nano, hit.Source.CreatedAt)
+			if err != nil {
+				s.logger.Error("Skipping %s with unparseable created_at %q", hit.Source.AtURI, hit.Source.CreatedAt)
+				continue
+			}
+			acc, ok := hours[createdAt.UTC().Truncate(time.Hour)]
+			if !ok {
+				continue
+			}
+			acc.count++
+			acc.xor ^= HashURI(hit.Source.AtURI)
+			docs++
+		}
+		if len(page.Hits.Hits) < s.config.PageSize {
+			break
+		}
+		searchAfter = page.Hits.Hits[len(page.Hits.Hits)-1].Sort
+	}
+	s.logger.Info("Digested %d %s documents between %s and %s", docs, index, from.Format(time.RFC3339), to.Format(time.RFC3339))
+
+	digests := make([]Digest, 0, len(hours))
+	for hour, acc := range hours {
+		digests = append(digests, Digest{
+			Index: index,
+			Hour:  hour,
+			Count: acc.count,
+			XOR:   strconv.FormatUint(acc.xor, 16),
+		})
+	}
+	sort.Slice(digests, func(i, j int) bool { return digests[i].Hour.Before(digests[j].Hour) })
+	return digests, nil
+}
+
+type searchPage struct {
+	PitID string `json:"pit_id"`
+	Hits  struct {
+		Hits []struct {
+			Source struct {
+				AtURI     string `json:"at_uri"`
+				CreatedAt string `json:"created_at"`
+			} `json:"_source"`
+			Sort []interface{} `json:"sort"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+func (s *Service) searchPage(ctx context.Context, pitID string, from, to time.Time, searchAfter []interface{}) (*searchPage, error) {
+	body := map[string]interface{}{
+		"size":    s.config.PageSize,
+		"_source": []string{"at_uri", "created_at"},
+		"query": map[string]interface{}{
+			"range": map[string]interface{}{
+				"created_at": map[string]interface{}{
+					"gte": from.Format(time.RFC3339),
+					"lt":  to.Format(time.RFC3339),
+				},
+			},
+		},
+		"pit": map[string]interface{}{
+			"id":         pitID,
+			"keep_alive": fmt.Sprintf("%ds", int(s.config.KeepAlive.Seconds())),
+		},
+		// _shard_doc is the cheapest stable order for walking a point in time
+		"sort":             []interface{}{map[string]interface{}{"_shard_doc": "asc"}},
+		"track_total_hits": false,
+	}
+	if searchAfter != nil {
+		body["search_after"] = searchAfter
+	}
+
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal search: %w", err)
+	}
+
+	res, err := s.client.Search(
+		s.client.Search.WithContext(ctx),
+		s.client.Search.WithBody(bytes.NewReader(bodyJSON)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %w", err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			s.logger.Error("Failed to close search response body: %v", err)
+		}
+	}()
+	if res.IsError() {
+		return nil, fmt.Errorf("search returned error: %s", res.String())
+	}
+
+	var page searchPage
+	if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("failed to parse search response: %w", err)
+	}
+	return &page, nil
+}
+
+func (s *Service) openPIT(ctx context.Context, index string) (string, error) {
+	res, err := s.client.OpenPointInTime(
+		[]string{index},
+		s.config.KeepAlive,
+		s.client.OpenPointInTime.WithContext(ctx),
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to open point in time on %s: %w", index, err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			s.logger.Error("Failed to close open-PIT response body: %v", err)
+		}
+	}()
+	if res.IsError() {
+		return "", fmt.Errorf("open point in time on %s returned error: %s", index, res.String())
+	}
+
+	var pit struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&pit); err != nil {
+		return "", fmt.Errorf("failed to parse point in time response: %w", err)
+	}
+	return pit.ID, nil
+}
+
+// closePIT releases a point in time; failures only delay cleanup until the keep-alive lapses
+func (s *Service) closePIT(pitID string) {
+	body, _ := json.Marshal(map[string]string{"id": pitID})
+	res, err := s.client.ClosePointInTime(bytes.NewReader(body))
+	if err != nil {
+		s.logger.Error("Failed to close point in time: %v", err)
+		return
+	}
+	_ = res.Body.Close()
+}
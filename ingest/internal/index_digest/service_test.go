@@ -0,0 +1,160 @@
+package index_digest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+type testDoc struct {
+	AtURI     string `json:"at_uri"`
+	CreatedAt string `json:"created_at"`
+}
+
+// pagedSearchHandler serves docs through a point in time, pageSize at a time,
+// using the hit position as the sort value
+func pagedSearchHandler(t *testing.T, docs []testDoc, searches *int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_pit") && r.Method == http.MethodPost:
+			_, _ = w.Write([]byte(`{"id":"pit-1"}`))
+		case r.URL.Path == "/_pit":
+			_, _ = w.Write([]byte(`{"succeeded":true}`))
+		case r.URL.Path == "/_search":
+			*searches++
+			var body struct {
+				Size        int           `json:"size"`
+				SearchAfter []interface{} `json:"search_after"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Errorf("bad search body: %v", err)
+			}
+			start := 0
+			if len(body.SearchAfter) == 1 {
+				start = int(body.SearchAfter[0].(float64)) + 1
+			}
+			var hits []string
+			for i := start; i < len(docs) && i < start+body.Size; i++ {
+				source, _ := json.Marshal(docs[i])
+				hits = append(hits, fmt.Sprintf(`{"_source":%s,"sort":[%d]}`, source, i))
+			}
+			_, _ = w.Write([]byte(`{"pit_id":"pit-1","hits":{"hits":[` + strings.Join(hits, ",") + `]}}`))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}
+}
+
+func TestCompute_BucketsByHour(t *testing.T) {
+	docs := []testDoc{
+		{"at://did:plc:a/app.bsky.feed.post/1", "2025-06-01T10:05:00Z"},
+		{"at://did:plc:a/app.bsky.feed.post/2", "2025-06-01T10:59:59.999Z"},
+		{"at://did:plc:b/app.bsky.feed.post/3", "2025-06-01T12:00:00Z"},
+	}
+	searches := 0
+	client := estest.NewClient(t, pagedSearchHandler(t, docs, &searches))
+
+	service := NewService(client, Config{Indices: []string{"posts"}, PageSize: 2}, common.NewLogger(false))
+	from := time.Date(2025, 6, 1, 10, 30, 0, 0, time.UTC)
+	digests, err := service.Compute(context.Background(), from, from.Add(3*time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if searches != 2 {
+		t.Errorf("expected 2 pages, got %d", searches)
+	}
+	if len(digests) != 3 {
+		t.Fatalf("expected digests for 10:00, 11:00 and 12:00, got %d", len(digests))
+	}
+
+	wantXOR := strconv.FormatUint(HashURI(docs[0].AtURI)^HashURI(docs[1].AtURI), 16)
+	if digests[0].Count != 2 || digests[0].XOR != wantXOR {
+		t.Errorf("10:00 digest = %+v, want count 2 xor %s", digests[0], wantXOR)
+	}
+	if digests[1].Count != 0 || digests[1].XOR != "0" {
+		t.Errorf("expected empty 11:00 digest, got %+v", digests[1])
+	}
+	if digests[2].Count != 1 || digests[2].Hour.Hour() != 12 {
+		t.Errorf("12:00 digest = %+v", digests[2])
+	}
+}
+
+func TestCompute_OrderIndependent(t *testing.T) {
+	docs := []testDoc{
+		{"at://did:plc:a/app.bsky.feed.like/1", "2025-06-01T10:01:00Z"},
+		{"at://did:plc:a/app.bsky.feed.like/2", "2025-06-01T10:02:00Z"},
+		{"at://did:plc:a/app.bsky.feed.like/3", "2025-06-01T10:03:00Z"},
+	}
+	reversed := []testDoc{docs[2], docs[1], docs[0]}
+	from := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+
+	var results [][]Digest
+	for _, d := range [][]testDoc{docs, reversed} {
+		searches := 0
+		service := NewService(estest.NewClient(t, pagedSearchHandler(t, d, &searches)), Config{Indices: []string{"likes"}}, common.NewLogger(false))
+		digests, err := service.Compute(context.Background(), from, from.Add(time.Hour))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		results = append(results, digests)
+	}
+	if results[0][0] != results[1][0] {
+		t.Errorf("digest depends on order: %+v vs %+v", results[0][0], results[1][0])
+	}
+}
+
+func TestCompute_RejectsEmptyRange(t *testing.T) {
+	service := NewService(nil, Config{}, common.NewLogger(false))
+	from := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	if _, err := service.Compute(context.Background(), from, from.Add(30*time.Minute)); err == nil {
+		t.Error("expected error for a range shorter than an hour")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	hour := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	baseline := &Report{Digests: []Digest{
+		{Index: "posts", Hour: hour, Count: 2, XOR: "abc"},
+		{Index: "posts", Hour: hour.Add(time.Hour), Count: 1, XOR: "def"},
+		{Index: "likes", Hour: hour, Count: 5, XOR: "123"},
+	}}
+	candidate := &Report{Digests: []Digest{
+		{Index: "posts", Hour: hour, Count: 2, XOR: "abc"},
+		{Index: "posts", Hour: hour.Add(time.Hour), Count: 1, XOR: "dee"},
+	}}
+
+	mismatches := Compare(baseline, candidate)
+	if len(mismatches) != 1 {
+		t.Fatalf("expected 1 mismatch (hours missing from the candidate are skipped), got %+v", mismatches)
+	}
+	if mismatches[0].Index != "posts" || mismatches[0].Hour != "2025-06-01T11" {
+		t.Errorf("unexpected mismatch %+v", mismatches[0])
+	}
+}
+
+func TestReportRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "digest.json")
+	hour := time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	report := &Report{Environment: "stage", Label: "pre-restore", From: hour, To: hour.Add(time.Hour),
+		Digests: []Digest{{Index: "posts", Hour: hour, Count: 3, XOR: "ff"}}}
+
+	if err := WriteReport(context.Background(), path, report); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	got, err := ReadReport(context.Background(), path)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if got.Label != "pre-restore" || len(got.Digests) != 1 || len(Compare(report, got)) != 0 {
+		t.Errorf("round trip changed the report: %+v", got)
+	}
+}
@@ -5,13 +5,8 @@
 package inference
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"math/rand"
-	"net/http"
 	"time"
 
 	"github.com/greenearth/ingest/internal/common"
@@ -32,20 +27,21 @@ type ClientConfig struct {
 // process with NewClient and share it; the underlying http.Client pools
 // connections.
 type Client struct {
-	httpClient *http.Client
-	config     ClientConfig
-	logger     *common.IngestLogger
+	endpoint *common.JSONClient
+	logger   *common.IngestLogger
 }
 
 // NewClient creates a new inference service client
 func NewClient(config ClientConfig, logger *common.IngestLogger) *Client {
-	if config.RetryBaseDelay <= 0 {
-		config.RetryBaseDelay = 200 * time.Millisecond
-	}
 	return &Client{
-		httpClient: &http.Client{Timeout: config.Timeout},
-		config:     config,
-		logger:     logger,
+		endpoint: common.NewJSONClient("inference service", common.JSONClientConfig{
+			URL:            config.BaseURL + postTowerPredictPath,
+			APIKey:         config.APIKey,
+			Timeout:        config.Timeout,
+			MaxRetries:     config.MaxRetries,
+			RetryBaseDelay: config.RetryBaseDelay,
+		}, logger),
+		logger: logger,
 	}
 }
 
@@ -74,88 +70,24 @@ func (c *Client) PostTowerPredict(ctx context.Context, postEmbeddings [][]float3
 		return [][]float32{}, "", nil
 	}
 
-	body, err := json.Marshal(postTowerRequest{
-		PostEmbeddings:   postEmbeddings,
-		TargetAuthorDIDs: authorDIDs,
-	})
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to marshal request: %w", err)
-	}
-
 	start := time.Now()
 	c.logger.Metric("inference.request.count", 1)
 
-	outputs, modelUUID, err := c.doWithRetries(ctx, body)
+	var response postTowerResponse
+	err := c.endpoint.Post(ctx, postTowerRequest{
+		PostEmbeddings:   postEmbeddings,
+		TargetAuthorDIDs: authorDIDs,
+	}, &response)
 	c.logger.Metric("inference.request.duration_ms", float64(time.Since(start).Milliseconds()))
 	if err != nil {
 		c.logger.Metric("inference.request.errors", 1)
 		return nil, "", err
 	}
 
-	if len(outputs) != len(postEmbeddings) {
+	if len(response.Outputs) != len(postEmbeddings) {
 		c.logger.Metric("inference.request.errors", 1)
-		return nil, "", fmt.Errorf("output count mismatch: got %d outputs for %d inputs", len(outputs), len(postEmbeddings))
-	}
-
-	return outputs, modelUUID, nil
-}
-
-// doWithRetries performs the HTTP request, retrying retryable failures with
-// exponential backoff and jitter
-func (c *Client) doWithRetries(ctx context.Context, body []byte) ([][]float32, string, error) {
-	var lastErr error
-	for attempt := 0; attempt <= c.config.MaxRetries; attempt++ {
-		if attempt > 0 {
-			delay := c.config.RetryBaseDelay * (1 << (attempt - 1))
-			jitter := time.Duration(rand.Int63n(int64(delay) + 1)) //nolint:gosec // G404: jitter does not need crypto randomness
-			select {
-			case <-ctx.Done():
-				return nil, "", ctx.Err()
-			case <-time.After(delay + jitter):
-			}
-		}
-
-		outputs, modelUUID, retryable, err := c.doOnce(ctx, body)
-		if err == nil {
-			return outputs, modelUUID, nil
-		}
-		lastErr = err
-		if !retryable {
-			return nil, "", err
-		}
-		c.logger.Debug("Inference request attempt %d failed (retryable): %v", attempt+1, err)
-	}
-	return nil, "", fmt.Errorf("inference request failed after %d attempts: %w", c.config.MaxRetries+1, lastErr)
-}
-
-// doOnce performs a single HTTP request. The third return value indicates
-// whether the failure is retryable.
-func (c *Client) doOnce(ctx context.Context, body []byte) ([][]float32, string, bool, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.BaseURL+postTowerPredictPath, bytes.NewReader(body))
-	if err != nil {
-		return nil, "", false, fmt.Errorf("failed to create request: %w", err)
-	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-API-Key", c.config.APIKey)
-
-	resp, err := c.httpClient.Do(req) //nolint:gosec // G704: BaseURL comes from service configuration, not user input
-	if err != nil {
-		return nil, "", ctx.Err() == nil, fmt.Errorf("inference request failed: %w", err)
-	}
-	defer func() {
-		_ = resp.Body.Close() // Ignore error in cleanup
-	}()
-
-	if resp.StatusCode != http.StatusOK {
-		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
-		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
-		return nil, "", retryable, fmt.Errorf("inference service returned status %d: %s", resp.StatusCode, string(respBody))
-	}
-
-	var parsed postTowerResponse
-	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
-		return nil, "", false, fmt.Errorf("failed to decode response: %w", err)
+		return nil, "", fmt.Errorf("output count mismatch: got %d outputs for %d inputs", len(response.Outputs), len(postEmbeddings))
 	}
 
-	return parsed.Outputs, parsed.ModelUUID, false, nil
+	return response.Outputs, response.ModelUUID, nil
 }
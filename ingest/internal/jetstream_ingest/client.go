@@ -3,6 +3,8 @@ package jetstream_ingest
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"strings"
 	"sync"
 	"time"
 
@@ -10,24 +12,69 @@ import (
 	"github.com/greenearth/ingest/internal/common"
 )
 
-// Client represents a Jetstream WebSocket client
+// Reconnection backoff: the first reconnect waits reconnectMinBackoff, and
+// each failed attempt doubles the wait up to reconnectMaxBackoff
+const (
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = time.Minute
+)
+
+// Jetstream's limits on the subscription filters of one connection
+const (
+	maxWantedCollections = 100
+	maxWantedDIDs        = 10000
+)
+
+// SubscribeURL adds Jetstream's wantedCollections and wantedDids parameters
+// to a subscribe URL, so that the server sends only commits to collections
+// (NSIDs, or prefixes such as "app.bsky.graph.*") by dids. Parameters the URL
+// already has are replaced; an empty list leaves its parameter as it is.
+// Account and identity events are sent regardless of collections.
+func SubscribeURL(jetstreamURL string, collections, dids []string) (string, error) {
+	u, err := url.Parse(jetstreamURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid Jetstream URL %q: %w", jetstreamURL, err)
+	}
+	if len(collections) > maxWantedCollections {
+		return "", fmt.Errorf("%d wanted collections is more than the %d Jetstream accepts", len(collections), maxWantedCollections)
+	}
+	if len(dids) > maxWantedDIDs {
+		return "", fmt.Errorf("%d wanted DIDs is more than the %d Jetstream accepts", len(dids), maxWantedDIDs)
+	}
+	query := u.Query()
+	for param, values := range map[string][]string{"wantedCollections": collections, "wantedDids": dids} {
+		if len(values) > 0 {
+			query[param] = values
+		}
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// Client represents a Jetstream WebSocket client. A lost connection is
+// re-established with exponential backoff, resuming from the cursor last
+// given to UpdateCursor, until the client is closed or its context is done.
 type Client struct {
-	url       string
-	cursor    *int64 // Optional cursor for rewinding to specific timestamp
-	conn      *websocket.Conn
-	msgChan   chan string
-	logger    *common.IngestLogger
-	reconnect bool
-	mu        sync.RWMutex // Protects conn and reconnect fields
+	url        string
+	cursor     *int64 // Optional cursor for rewinding to specific timestamp
+	conn       *websocket.Conn
+	msgChan    chan string
+	logger     *common.IngestLogger
+	reconnect  bool
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	mu         sync.RWMutex // Protects conn and reconnect fields
 }
 
 // NewClient creates a new Jetstream WebSocket client
-func NewClient(url string, logger *common.IngestLogger) *Client {
+func NewClient(jetstreamURL string, logger *common.IngestLogger) *Client {
 	return &Client{
-		url:       url,
-		msgChan:   make(chan string, 10000), // Buffer for 10000 messages
-		logger:    logger,
-		reconnect: true,
+		url:        jetstreamURL,
+		msgChan:    make(chan string, 10000), // Buffer for 10000 messages
+		logger:     logger,
+		reconnect:  true,
+		minBackoff: reconnectMinBackoff,
+		maxBackoff: reconnectMaxBackoff,
 	}
 }
 
@@ -40,25 +87,33 @@ func (c *Client) SetCursor(timeUs int64) {
 
 // Connect establishes a WebSocket connection to Jetstream
 func (c *Client) Connect(ctx context.Context) error {
-	url := c.url
+	dialURL := c.url
 
 	// Read cursor under lock since it may be updated by UpdateCursor
 	c.mu.RLock()
 	cursor := c.cursor
 	c.mu.RUnlock()
 
+	// The subscription filters (see SubscribeURL) can be long, so only the
+	// endpoint is logged
+	endpoint, _, _ := strings.Cut(c.url, "?")
+
 	// Add cursor parameter if set
 	if cursor != nil {
-		url = fmt.Sprintf("%s?cursor=%d", c.url, *cursor)
-		c.logger.Info("Connecting to Jetstream at %s with cursor (rewinding to timestamp %d)", c.url, *cursor)
+		separator := "?"
+		if strings.Contains(c.url, "?") {
+			separator = "&"
+		}
+		dialURL = fmt.Sprintf("%s%scursor=%d", c.url, separator, *cursor)
+		c.logger.Info("Connecting to Jetstream at %s with cursor (rewinding to timestamp %d)", endpoint, *cursor)
 	} else {
-		c.logger.Info("Connecting to Jetstream at %s", c.url)
+		c.logger.Info("Connecting to Jetstream at %s", endpoint)
 	}
 
 	dialer := websocket.DefaultDialer
 	dialer.HandshakeTimeout = 30 * time.Second
 
-	conn, resp, err := dialer.DialContext(ctx, url, nil)
+	conn, resp, err := dialer.DialContext(ctx, dialURL, nil)
 	if resp != nil && resp.Body != nil {
 		// Close the body on the HTTP upgrade response
 		if closeErr := resp.Body.Close(); closeErr != nil {
@@ -88,7 +143,9 @@ func (c *Client) Start(ctx context.Context) error {
 	return nil
 }
 
-// readLoop continuously reads messages from the WebSocket connection
+// readLoop continuously reads messages from the WebSocket connection,
+// reconnecting when it is lost. The backoff resets once a connection
+// delivers a message.
 func (c *Client) readLoop(ctx context.Context) {
 	defer close(c.msgChan)
 
@@ -105,6 +162,7 @@ func (c *Client) readLoop(ctx context.Context) {
 		c.mu.Unlock()
 	}()
 
+	backoff := c.minBackoff
 	for {
 		c.mu.RLock()
 		conn := c.conn
@@ -115,16 +173,21 @@ func (c *Client) readLoop(ctx context.Context) {
 			if !shouldReconnect {
 				return
 			}
-			c.logger.Info("Attempting to reconnect...")
+			c.logger.Info("Reconnecting in %v...", backoff)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			backoff = min(backoff*2, c.maxBackoff)
+
+			c.logger.Metric("jetstream.reconnect_attempt_count", 1)
 			if err := c.Connect(ctx); err != nil {
-				c.logger.Error("Reconnection failed: %v, retrying in 5 seconds", err)
-				select {
-				case <-time.After(5 * time.Second):
-				case <-ctx.Done():
-					return
-				}
+				c.logger.Error("Reconnection failed: %v", err)
+				c.logger.Metric("jetstream.reconnect_failed_count", 1)
 				continue
 			}
+			c.logger.Metric("jetstream.reconnect_count", 1)
 			c.mu.RLock()
 			conn = c.conn
 			c.mu.RUnlock()
@@ -140,20 +203,14 @@ func (c *Client) readLoop(ctx context.Context) {
 			} else {
 				c.logger.Error("Error reading from WebSocket: %v", err)
 			}
+			c.logger.Metric("jetstream.disconnect_count", 1)
+			_ = conn.Close() // Best-effort close of the lost connection
 			c.mu.Lock()
 			c.conn = nil
-			shouldReconnect = c.reconnect
 			c.mu.Unlock()
-			if shouldReconnect {
-				c.logger.Info("Reconnecting in 5 seconds...")
-				select {
-				case <-time.After(5 * time.Second):
-				case <-ctx.Done():
-					return
-				}
-			}
 			continue
 		}
+		backoff = c.minBackoff
 
 		select {
 		case c.msgChan <- string(message):
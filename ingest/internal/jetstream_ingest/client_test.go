@@ -2,9 +2,11 @@ package jetstream_ingest
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -323,3 +325,84 @@ func TestGetMessageChannel(t *testing.T) {
 		t.Error("GetMessageChannel returned different channels")
 	}
 }
+
+func TestClientReconnectsFromCursor(t *testing.T) {
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	cursorSet := make(chan struct{})
+	queries := make(chan string, 10)
+	var connections atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("Failed to upgrade connection: %v", err)
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		n := connections.Add(1)
+		queries <- r.URL.RawQuery
+		msg := fmt.Sprintf(`{"did":"did:plc:test","time_us":%d}`, n)
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			return
+		}
+		if n == 1 {
+			// Drop the first connection once the cursor has moved
+			<-cursorSet
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	client := NewClient("ws"+strings.TrimPrefix(server.URL, "http")+"/subscribe?wantedCollections=app.bsky.feed.like", common.NewLogger(false))
+	client.minBackoff, client.maxBackoff = 10*time.Millisecond, 20*time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Start(ctx); err != nil {
+		t.Fatalf("Failed to start client: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	msgChan := client.GetMessageChannel()
+	if msg := <-msgChan; !strings.Contains(msg, `"time_us":1`) {
+		t.Fatalf("unexpected first message %s", msg)
+	}
+	client.UpdateCursor(1)
+	close(cursorSet)
+
+	select {
+	case msg := <-msgChan:
+		if !strings.Contains(msg, `"time_us":2`) {
+			t.Errorf("expected a message from the new connection, got %s", msg)
+		}
+	case <-ctx.Done():
+		t.Fatal("client did not reconnect")
+	}
+	if first := <-queries; first != "wantedCollections=app.bsky.feed.like" {
+		t.Errorf("expected no cursor on the first connection, got %q", first)
+	}
+	if second := <-queries; second != "wantedCollections=app.bsky.feed.like&cursor=1" {
+		t.Errorf("expected the reconnect to resume from the cursor, got %q", second)
+	}
+}
+
+func TestSubscribeURL(t *testing.T) {
+	got, err := SubscribeURL("wss://jetstream2.us-east.bsky.network/subscribe?compress=false&wantedCollections=app.bsky.feed.post",
+		[]string{"app.bsky.feed.like", "app.bsky.graph.*"}, []string{"did:plc:a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "wss://jetstream2.us-east.bsky.network/subscribe?compress=false&wantedCollections=app.bsky.feed.like&wantedCollections=app.bsky.graph.%2A&wantedDids=did%3Aplc%3Aa"
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	if got, err := SubscribeURL("wss://jetstream.example/subscribe", nil, nil); err != nil || got != "wss://jetstream.example/subscribe" {
+		t.Errorf("expected no filters to leave the URL unfiltered, got %q (%v)", got, err)
+	}
+	if _, err := SubscribeURL("wss://jetstream.example/subscribe", make([]string, maxWantedCollections+1), nil); err == nil {
+		t.Error("expected an error for more collections than Jetstream accepts")
+	}
+	if _, err := SubscribeURL("://bad", nil, nil); err == nil {
+		t.Error("expected an error for an invalid URL")
+	}
+}
@@ -0,0 +1,103 @@
+package jetstream_ingest
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DedupCache remembers the at_uris of the most recently seen records, up to
+// a fixed number, so that events replayed after a cursor rewind or a
+// reconnect can be skipped instead of indexed again. The least recently seen
+// at_uri is forgotten first. A nil DedupCache remembers nothing.
+type DedupCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // Front is the most recently seen
+	entries map[string]*list.Element
+	hits    int64 // Since the last HitRate
+	misses  int64
+}
+
+// NewDedupCache creates a cache remembering up to size at_uris. Returns nil
+// when size is not positive, which disables deduplication.
+func NewDedupCache(size int) *DedupCache {
+	if size <= 0 {
+		return nil
+	}
+	return &DedupCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+	}
+}
+
+// Seen reports whether atURI was seen before, and records it as seen
+func (c *DedupCache) Seen(atURI string) bool {
+	if c == nil || atURI == "" {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[atURI]; ok {
+		c.order.MoveToFront(elem)
+		c.hits++
+		return true
+	}
+	c.misses++
+	c.addLocked(atURI)
+	return false
+}
+
+// Add records atURIs as seen without counting them as lookups, e.g. to warm
+// the cache with records already indexed
+func (c *DedupCache) Add(atURIs ...string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, atURI := range atURIs {
+		if elem, ok := c.entries[atURI]; ok {
+			c.order.MoveToFront(elem)
+		} else if atURI != "" {
+			c.addLocked(atURI)
+		}
+	}
+}
+
+func (c *DedupCache) addLocked(atURI string) {
+	c.entries[atURI] = c.order.PushFront(atURI)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(string))
+	}
+}
+
+// Len returns the number of at_uris remembered
+func (c *DedupCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// HitRate returns the share of lookups since the last call that found a
+// duplicate, and the number of lookups, and resets both
+func (c *DedupCache) HitRate() (float64, int64) {
+	if c == nil {
+		return 0, 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lookups := c.hits + c.misses
+	rate := 0.0
+	if lookups > 0 {
+		rate = float64(c.hits) / float64(lookups)
+	}
+	c.hits, c.misses = 0, 0
+	return rate, lookups
+}
@@ -0,0 +1,53 @@
+package jetstream_ingest
+
+import "testing"
+
+func TestDedupCache_SkipsRecentDuplicates(t *testing.T) {
+	cache := NewDedupCache(2)
+
+	if cache.Seen("at://a") || cache.Seen("at://b") {
+		t.Fatal("expected first sightings to be new")
+	}
+	if !cache.Seen("at://a") {
+		t.Error("expected at://a to be a duplicate")
+	}
+
+	// at://b is now the least recently seen and is forgotten first
+	cache.Seen("at://c")
+	if cache.Len() != 2 {
+		t.Errorf("expected the cache bounded at 2, got %d", cache.Len())
+	}
+	if !cache.Seen("at://a") {
+		t.Error("expected at://a, seen recently, to be kept")
+	}
+	if cache.Seen("at://b") {
+		t.Error("expected at://b to have been evicted")
+	}
+
+	rate, lookups := cache.HitRate()
+	if lookups != 6 || rate != 2.0/6 {
+		t.Errorf("expected 2 hits in 6 lookups, got rate %v of %d", rate, lookups)
+	}
+	if _, lookups := cache.HitRate(); lookups != 0 {
+		t.Errorf("expected the hit rate reset, got %d lookups", lookups)
+	}
+}
+
+func TestDedupCache_AddWarmsWithoutCounting(t *testing.T) {
+	cache := NewDedupCache(10)
+	cache.Add("at://a", "", "at://b")
+	if cache.Len() != 2 {
+		t.Errorf("expected 2 at_uris, got %d", cache.Len())
+	}
+	if !cache.Seen("at://b") || cache.Seen("") {
+		t.Error("expected warmed at_uris to be duplicates and empty ones never")
+	}
+	if rate, lookups := cache.HitRate(); lookups != 1 || rate != 1 {
+		t.Errorf("expected only the lookup counted, got rate %v of %d", rate, lookups)
+	}
+
+	disabled := NewDedupCache(0)
+	if disabled != nil || disabled.Seen("at://a") || disabled.Seen("at://a") {
+		t.Error("expected a disabled cache to skip nothing")
+	}
+}
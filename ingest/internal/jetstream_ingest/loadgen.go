@@ -0,0 +1,279 @@
+package jetstream_ingest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// loadGenRecentCreates is how many recent creates of each kind a LoadGen
+// remembers as candidates for deletes, which bounds its memory
+const loadGenRecentCreates = 4096
+
+// LoadGenConfig shapes the synthetic firehose a LoadGen emits
+type LoadGenConfig struct {
+	Rate           int           // Events per second
+	Duration       time.Duration // How long to emit events before the firehose ends
+	Accounts       int           // Distinct DIDs events are spread across, round robin
+	Subjects       int           // Distinct posts likes are spread across
+	FollowFraction float64       // Fraction of events that are follows or unfollows rather than likes or unlikes
+	DeleteFraction float64       // Fraction of events that delete an earlier like or follow
+	Seed           int64         // Seeds the choice of each event's kind
+}
+
+// DefaultLoadGenConfig returns a firehose of rate events per second for
+// duration, shaped like Jetstream's like and follow traffic. Accounts are
+// spread widely enough that none nears the like rate limiter's threshold.
+func DefaultLoadGenConfig(rate int, duration time.Duration) LoadGenConfig {
+	return LoadGenConfig{
+		Rate:           rate,
+		Duration:       duration,
+		Accounts:       max(rate*10, 1000),
+		Subjects:       1000,
+		FollowFraction: 0.2,
+		DeleteFraction: 0.1,
+		Seed:           1,
+	}
+}
+
+// LoadGenStats counts the events a LoadGen has emitted
+type LoadGenStats struct {
+	Sent          int   // Events delivered to the message channel
+	Dropped       int   // Events dropped because the channel stayed full
+	Likes         int   // Like creates delivered
+	LikeDeletes   int   // Like deletes delivered
+	Follows       int   // Follow creates delivered
+	FollowDeletes int   // Follow deletes delivered
+	LastTimeUs    int64 // time_us of the last event delivered
+}
+
+// LoadGen is a bounded synthetic Jetstream firehose. It emits like and
+// follow creates and deletes as Jetstream JSON on the same kind of channel
+// Client does, with strictly increasing time_us, so that jetstream_ingest
+// can consume it in place of the network. Every delete targets a create
+// emitted earlier, so after the firehose ends the likes and follows that
+// should be indexed are the creates less the deletes.
+type LoadGen struct {
+	config  LoadGenConfig
+	msgChan chan string
+	logger  *common.IngestLogger
+
+	mu     sync.Mutex
+	cursor int64
+	stats  LoadGenStats
+}
+
+// NewLoadGen creates a LoadGen
+func NewLoadGen(config LoadGenConfig, logger *common.IngestLogger) *LoadGen {
+	return &LoadGen{
+		config:  config,
+		msgChan: make(chan string, 10000), // Buffered like Client's
+		logger:  logger,
+	}
+}
+
+// SetCursor starts the firehose after timeUs, as Jetstream would when
+// rewinding
+func (g *LoadGen) SetCursor(timeUs int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.cursor = timeUs
+}
+
+// UpdateCursor is a no-op: a LoadGen never reconnects
+func (g *LoadGen) UpdateCursor(timeUs int64) {}
+
+// Start begins emitting events. The message channel is closed once
+// Duration has passed or ctx is cancelled.
+func (g *LoadGen) Start(ctx context.Context) error {
+	if g.config.Rate <= 0 || g.config.Duration <= 0 {
+		return fmt.Errorf("load generator needs a positive rate and duration, got %d/s for %s", g.config.Rate, g.config.Duration)
+	}
+	g.logger.Info("Generating %d events/s for %s across %d accounts", g.config.Rate, g.config.Duration, g.config.Accounts)
+	go g.run(ctx)
+	return nil
+}
+
+// GetMessageChannel returns the channel that receives raw JSON messages
+func (g *LoadGen) GetMessageChannel() <-chan string {
+	return g.msgChan
+}
+
+// Close is a no-op; cancel the context passed to Start to stop early
+func (g *LoadGen) Close() error {
+	return nil
+}
+
+// Stats returns the events emitted so far
+func (g *LoadGen) Stats() LoadGenStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.stats
+}
+
+// loadGenCreate is a create a later delete may target
+type loadGenCreate struct {
+	did  string
+	rkey string
+}
+
+// run emits events in ticks of a few milliseconds, each carrying the
+// events due since the start, so the rate holds however the ticks drift
+func (g *LoadGen) run(ctx context.Context) {
+	defer close(g.msgChan)
+
+	rng := rand.New(rand.NewSource(g.config.Seed))
+	var likes, follows []loadGenCreate
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	start := time.Now()
+	deadline := start.Add(g.config.Duration)
+	emitted := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if now.After(deadline) {
+				now = deadline
+			}
+			due := int(now.Sub(start).Seconds() * float64(g.config.Rate))
+			for ; emitted < due; emitted++ {
+				raw, kind := g.next(rng, emitted, &likes, &follows)
+				if !g.deliver(ctx, raw, kind) {
+					return
+				}
+			}
+			if !now.Before(deadline) {
+				g.logger.Info("Load generator finished: %+v", g.Stats())
+				return
+			}
+		}
+	}
+}
+
+// Kinds of event a LoadGen emits
+const (
+	loadGenLike = iota
+	loadGenLikeDelete
+	loadGenFollow
+	loadGenFollowDelete
+)
+
+// next builds the n-th event. Deletes pop a remembered create of their
+// kind, so no create is deleted twice; with none remembered, a create is
+// emitted instead.
+func (g *LoadGen) next(rng *rand.Rand, n int, likes, follows *[]loadGenCreate) (string, int) {
+	follow := rng.Float64() < g.config.FollowFraction
+	remove := rng.Float64() < g.config.DeleteFraction
+
+	timeUs := g.nextTimeUs()
+	if remove {
+		recent := likes
+		if follow {
+			recent = follows
+		}
+		if len(*recent) > 0 {
+			i := rng.Intn(len(*recent))
+			target := (*recent)[i]
+			(*recent)[i] = (*recent)[len(*recent)-1]
+			*recent = (*recent)[:len(*recent)-1]
+
+			collection, kind := "app.bsky.feed.like", loadGenLikeDelete
+			if follow {
+				collection, kind = "app.bsky.graph.follow", loadGenFollowDelete
+			}
+			return fmt.Sprintf(`{"did":%q,"time_us":%d,"kind":"commit","commit":{"rev":%q,"operation":"delete","collection":%q,"rkey":%q}}`,
+				target.did, timeUs, loadGenRkey(n), collection, target.rkey), kind
+		}
+	}
+
+	did := loadGenDID(n % g.config.Accounts)
+	create := loadGenCreate{did: did, rkey: loadGenRkey(n)}
+	createdAt := time.UnixMicro(timeUs).UTC().Format("2006-01-02T15:04:05.000Z")
+
+	var raw string
+	kind := loadGenLike
+	if follow {
+		kind = loadGenFollow
+		subject := loadGenDID((n + 1 + rng.Intn(g.config.Accounts)) % g.config.Accounts)
+		raw = fmt.Sprintf(`{"did":%q,"time_us":%d,"kind":"commit","commit":{"rev":%q,"operation":"create","collection":"app.bsky.graph.follow","rkey":%q,"record":{"$type":"app.bsky.graph.follow","createdAt":%q,"subject":%q},"cid":"bafyreiloadgen"}}`,
+			did, timeUs, create.rkey, create.rkey, createdAt, subject)
+		*follows = remember(*follows, create, n)
+	} else {
+		subject := rng.Intn(g.config.Subjects)
+		raw = fmt.Sprintf(`{"did":%q,"time_us":%d,"kind":"commit","commit":{"rev":%q,"operation":"create","collection":"app.bsky.feed.like","rkey":%q,"record":{"$type":"app.bsky.feed.like","createdAt":%q,"subject":{"cid":"bafyreiloadgen","uri":"at://%s/app.bsky.feed.post/loadgen%d"}},"cid":"bafyreiloadgen"}}`,
+			did, timeUs, create.rkey, create.rkey, createdAt, loadGenDID(subject%g.config.Accounts), subject)
+		*likes = remember(*likes, create, n)
+	}
+	return raw, kind
+}
+
+// remember adds the n-th event's create to recent. Once recent holds
+// loadGenRecentCreates, the create replaces an earlier one, which is then
+// never deleted.
+func remember(recent []loadGenCreate, create loadGenCreate, n int) []loadGenCreate {
+	if len(recent) >= loadGenRecentCreates {
+		recent[n%len(recent)] = create
+		return recent
+	}
+	return append(recent, create)
+}
+
+// nextTimeUs returns a time_us later than every one before it and than the
+// cursor, and no earlier than now
+func (g *LoadGen) nextTimeUs() int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	timeUs := max(time.Now().UnixMicro(), g.cursor+1)
+	g.cursor = timeUs
+	return timeUs
+}
+
+// deliver sends raw to the message channel, dropping it if the channel
+// stays full for 5 seconds as Client does. It returns false once ctx is
+// cancelled.
+func (g *LoadGen) deliver(ctx context.Context, raw string, kind int) bool {
+	select {
+	case g.msgChan <- raw:
+	case <-time.After(5 * time.Second):
+		g.logger.Error("Message channel full for 5 seconds, dropping message")
+		g.mu.Lock()
+		g.stats.Dropped++
+		g.mu.Unlock()
+		return true
+	case <-ctx.Done():
+		return false
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.stats.Sent++
+	g.stats.LastTimeUs = g.cursor
+	switch kind {
+	case loadGenLike:
+		g.stats.Likes++
+	case loadGenLikeDelete:
+		g.stats.LikeDeletes++
+	case loadGenFollow:
+		g.stats.Follows++
+	case loadGenFollowDelete:
+		g.stats.FollowDeletes++
+	}
+	return true
+}
+
+// loadGenDID returns the DID of synthetic account i
+func loadGenDID(i int) string {
+	return fmt.Sprintf("did:plc:loadgen%017d", i)
+}
+
+// loadGenRkey returns the record key of the n-th event
+func loadGenRkey(n int) string {
+	return fmt.Sprintf("lg%011d", n)
+}
@@ -0,0 +1,86 @@
+package jetstream_ingest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func TestLoadGenEmitsConsistentFirehose(t *testing.T) {
+	logger := common.NewLogger(false)
+	config := DefaultLoadGenConfig(2000, 300*time.Millisecond)
+	config.DeleteFraction = 0.3
+	gen := NewLoadGen(config, logger)
+	cursor := time.Now().Add(time.Hour).UnixMicro()
+	gen.SetCursor(cursor)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := gen.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	live := map[string]bool{}
+	lastTimeUs := cursor
+	var likes, likeDeletes, follows, followDeletes, total int
+	for raw := range gen.GetMessageChannel() {
+		total++
+		msg := common.NewJetstreamMessage(raw, logger)
+		if err := msg.ParseError(); err != nil {
+			t.Fatalf("unparseable event %s: %v", raw, err)
+		}
+		if msg.GetTimeUs() <= lastTimeUs {
+			t.Fatalf("time_us %d does not follow %d", msg.GetTimeUs(), lastTimeUs)
+		}
+		lastTimeUs = msg.GetTimeUs()
+
+		switch {
+		case msg.IsLike(), msg.IsFollow():
+			if live[msg.GetAtURI()] {
+				t.Fatalf("%s created twice", msg.GetAtURI())
+			}
+			live[msg.GetAtURI()] = true
+			if msg.IsLike() {
+				likes++
+			} else {
+				follows++
+			}
+		case msg.IsLikeDelete(), msg.IsFollowDelete():
+			if !live[msg.GetAtURI()] {
+				t.Fatalf("%s deleted without a live create", msg.GetAtURI())
+			}
+			delete(live, msg.GetAtURI())
+			if msg.IsLikeDelete() {
+				likeDeletes++
+			} else {
+				followDeletes++
+			}
+		default:
+			t.Fatalf("event is not a like or follow: %s", raw)
+		}
+	}
+	if ctx.Err() != nil {
+		t.Fatal("the firehose did not end after its duration")
+	}
+
+	stats := gen.Stats()
+	if total < 400 || total > 700 {
+		t.Errorf("got %d events, expected about 600", total)
+	}
+	want := LoadGenStats{Sent: total, Likes: likes, LikeDeletes: likeDeletes, Follows: follows, FollowDeletes: followDeletes, LastTimeUs: lastTimeUs}
+	if stats != want {
+		t.Errorf("stats %+v, counted %+v", stats, want)
+	}
+	if likeDeletes == 0 || followDeletes == 0 {
+		t.Errorf("expected deletes of both kinds, got %+v", stats)
+	}
+}
+
+func TestLoadGenRejectsEmptyFirehose(t *testing.T) {
+	gen := NewLoadGen(LoadGenConfig{Rate: 0, Duration: time.Minute}, common.NewLogger(false))
+	if err := gen.Start(context.Background()); err == nil {
+		t.Error("expected an error for a zero rate")
+	}
+}
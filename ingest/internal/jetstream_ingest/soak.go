@@ -0,0 +1,152 @@
+package jetstream_ingest
+
+import (
+	"context"
+	"fmt"
+	"runtime/metrics"
+	"slices"
+	"sync"
+	"time"
+)
+
+// liveHeapMetric is the heap still reachable at the end of the last GC, which
+// unlike the heap in use does not swing with allocation between GCs
+const liveHeapMetric = "/gc/heap/live:bytes"
+
+// minHeapSamples is how many samples HeapGrowth needs to judge a trend
+const minHeapSamples = 8
+
+// HeapSampler records the live heap at an interval over a soak run
+type HeapSampler struct {
+	interval time.Duration
+	sample   func() uint64
+
+	mu      sync.Mutex
+	samples []uint64
+}
+
+// NewHeapSampler returns a HeapSampler that takes about 60 samples over a
+// run of duration, at most one a second
+func NewHeapSampler(duration time.Duration) *HeapSampler {
+	return &HeapSampler{
+		interval: max(duration/60, time.Second),
+		sample:   sampleLiveHeap,
+	}
+}
+
+// Run samples until ctx is cancelled
+func (s *HeapSampler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			bytes := s.sample()
+			s.mu.Lock()
+			s.samples = append(s.samples, bytes)
+			s.mu.Unlock()
+		}
+	}
+}
+
+// HeapGrowth returns how much the live heap grew over the run, as a fraction:
+// the median of the last quarter of samples against the median of the first,
+// after the first tenth of the run is discarded as warm-up
+func (s *HeapSampler) HeapGrowth() (float64, error) {
+	s.mu.Lock()
+	samples := slices.Clone(s.samples)
+	s.mu.Unlock()
+
+	samples = samples[len(samples)/10:]
+	if len(samples) < minHeapSamples {
+		return 0, fmt.Errorf("only %d heap samples after warm-up, need %d", len(samples), minHeapSamples)
+	}
+	quarter := len(samples) / 4
+	first := median(samples[:quarter])
+	last := median(samples[len(samples)-quarter:])
+	if first == 0 {
+		return 0, fmt.Errorf("no live heap measured")
+	}
+	return float64(last)/float64(first) - 1, nil
+}
+
+func median(values []uint64) uint64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	return sorted[len(sorted)/2]
+}
+
+func sampleLiveHeap() uint64 {
+	samples := []metrics.Sample{{Name: liveHeapMetric}}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return samples[0].Value.Uint64()
+}
+
+// SoakResult is what a soak run observed once its firehose was ingested
+type SoakResult struct {
+	Generated LoadGenStats
+
+	// Events the ingest loop received, and what became of them
+	Received  int
+	Processed int
+	Deleted   int
+	Skipped   int
+
+	// Cursor is the persisted cursor after shutdown, or -1 if it was not
+	// checked (dry runs write no cursor)
+	Cursor int64
+
+	// Likes and Follows are the documents in Elasticsearch after the run, or
+	// -1 if they were not counted
+	Likes   int64
+	Follows int64
+
+	HeapGrowth    float64
+	HeapGrowthErr error
+}
+
+// Failures returns each way the run went wrong: events dropped or skipped,
+// documents missing or left behind, a cursor short of (or past) the last
+// event, or a live heap that grew by more than maxHeapGrowth
+func (r SoakResult) Failures(maxHeapGrowth float64) []string {
+	var failures []string
+	gen := r.Generated
+	if gen.Sent == 0 {
+		failures = append(failures, "the load generator sent no events")
+	}
+	if gen.Dropped > 0 {
+		failures = append(failures, fmt.Sprintf("%d events dropped on a full message channel", gen.Dropped))
+	}
+	if r.Received != gen.Sent {
+		failures = append(failures, fmt.Sprintf("received %d of %d events sent", r.Received, gen.Sent))
+	}
+	if r.Skipped > 0 {
+		failures = append(failures, fmt.Sprintf("%d events skipped", r.Skipped))
+	}
+	if handled := r.Processed + r.Deleted + r.Skipped; handled != r.Received {
+		failures = append(failures, fmt.Sprintf("handled %d of %d events received (processed %d, deleted %d, skipped %d)", handled, r.Received, r.Processed, r.Deleted, r.Skipped))
+	}
+
+	if r.Cursor >= 0 && r.Cursor != gen.LastTimeUs {
+		failures = append(failures, fmt.Sprintf("cursor %d after shutdown, last event %d (off by %s)", r.Cursor, gen.LastTimeUs, time.Duration(gen.LastTimeUs-r.Cursor)*time.Microsecond))
+	}
+
+	if want := int64(gen.Likes - gen.LikeDeletes); r.Likes >= 0 && r.Likes != want {
+		failures = append(failures, fmt.Sprintf("%d likes indexed, want %d", r.Likes, want))
+	}
+	if want := int64(gen.Follows - gen.FollowDeletes); r.Follows >= 0 && r.Follows != want {
+		failures = append(failures, fmt.Sprintf("%d follows indexed, want %d", r.Follows, want))
+	}
+
+	if r.HeapGrowthErr != nil {
+		failures = append(failures, fmt.Sprintf("heap growth unknown: %v", r.HeapGrowthErr))
+	} else if r.HeapGrowth > maxHeapGrowth {
+		failures = append(failures, fmt.Sprintf("live heap grew %.0f%%, more than %.0f%%", r.HeapGrowth*100, maxHeapGrowth*100))
+	}
+	return failures
+}
@@ -0,0 +1,79 @@
+package jetstream_ingest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHeapGrowth(t *testing.T) {
+	sampler := &HeapSampler{}
+	// After warm-up the heap holds steady, with noise
+	sampler.samples = []uint64{10, 100, 104, 98, 101, 99, 103, 100, 97, 102, 100, 101, 99, 100, 98, 102}
+	growth, err := sampler.HeapGrowth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if growth < -0.05 || growth > 0.05 {
+		t.Errorf("expected a steady heap, got %.2f growth", growth)
+	}
+
+	sampler.samples = nil
+	for i := range 40 {
+		sampler.samples = append(sampler.samples, uint64(100+5*i))
+	}
+	if growth, _ := sampler.HeapGrowth(); growth < 0.5 {
+		t.Errorf("expected a leak to show as growth, got %.2f", growth)
+	}
+
+	sampler.samples = []uint64{100, 100, 100}
+	if _, err := sampler.HeapGrowth(); err == nil {
+		t.Error("expected an error with too few samples")
+	}
+}
+
+func TestSoakResultFailures(t *testing.T) {
+	passing := SoakResult{
+		Generated: LoadGenStats{Sent: 100, Likes: 60, LikeDeletes: 10, Follows: 25, FollowDeletes: 5, LastTimeUs: 1700000000000000},
+		Received:  100,
+		Processed: 85,
+		Deleted:   15,
+		Cursor:    1700000000000000,
+		Likes:     50,
+		Follows:   20,
+	}
+	if failures := passing.Failures(0.25); len(failures) != 0 {
+		t.Fatalf("expected no failures, got %v", failures)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func(*SoakResult)
+		want   string
+	}{
+		{"dropped", func(r *SoakResult) { r.Generated.Dropped = 3 }, "3 events dropped"},
+		{"not received", func(r *SoakResult) { r.Received = 99; r.Processed = 84 }, "received 99 of 100"},
+		{"skipped", func(r *SoakResult) { r.Processed = 84; r.Skipped = 1 }, "1 events skipped"},
+		{"unaccounted", func(r *SoakResult) { r.Processed = 80 }, "handled 95 of 100"},
+		{"cursor behind", func(r *SoakResult) { r.Cursor -= 2000000 }, "off by 2s"},
+		{"likes missing", func(r *SoakResult) { r.Likes = 49 }, "49 likes indexed, want 50"},
+		{"follows left behind", func(r *SoakResult) { r.Follows = 21 }, "21 follows indexed, want 20"},
+		{"heap growth", func(r *SoakResult) { r.HeapGrowth = 0.4 }, "live heap grew 40%"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := passing
+			tt.mutate(&result)
+			failures := result.Failures(0.25)
+			if len(failures) != 1 || !strings.Contains(failures[0], tt.want) {
+				t.Errorf("expected one failure containing %q, got %v", tt.want, failures)
+			}
+		})
+	}
+
+	// Checks that were not run do not fail
+	unchecked := passing
+	unchecked.Cursor, unchecked.Likes, unchecked.Follows = -1, -1, -1
+	if failures := unchecked.Failures(0.25); len(failures) != 0 {
+		t.Errorf("expected unchecked counts to pass, got %v", failures)
+	}
+}
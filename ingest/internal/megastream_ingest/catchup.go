@@ -0,0 +1,153 @@
+package megastream_ingest
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// Values of CatchUpConfig.Strategy
+const (
+	StrategyOldestFirst = "oldest-first"
+	StrategyNewestFirst = "newest-first"
+)
+
+// CatchUpConfig controls how a spooler that has fallen behind catches up
+type CatchUpConfig struct {
+	Strategy string        // StrategyOldestFirst or StrategyNewestFirst
+	Lag      time.Duration // How far the newest file may be past the cursor before newest-first catch-up starts
+}
+
+// CatchUpConfigFromConfig returns the catch-up configuration in config
+func CatchUpConfigFromConfig(config *common.Config) CatchUpConfig {
+	return CatchUpConfig{
+		Strategy: config.SpoolStrategy,
+		Lag:      config.SpoolCatchUpLag,
+	}
+}
+
+// SetCatchUp sets how the spooler catches up when it falls behind.
+//
+// Oldest-first, the default, processes files in order. Newest-first, once
+// the newest file is more than config.Lag past the cursor, moves the cursor
+// to that file and hands everything up to it to a backfill (see
+// common.BackfillCursor). The backfill works through those files newest
+// first, between rounds of newer files, so the freshest posts are indexed
+// first and the cursor keeps up with new files while the backlog drains.
+func (bs *baseSpooler) SetCatchUp(config CatchUpConfig) error {
+	switch config.Strategy {
+	case StrategyOldestFirst:
+	case StrategyNewestFirst:
+		if bs.stateManager == nil {
+			return fmt.Errorf("%s catch-up requires a cursor", StrategyNewestFirst)
+		}
+		if config.Lag <= 0 {
+			return fmt.Errorf("invalid GE_SPOOL_CATCH_UP_LAG %s (must be positive)", config.Lag)
+		}
+	default:
+		return fmt.Errorf("invalid GE_SPOOL_STRATEGY %q (expected %s or %s)", config.Strategy, StrategyOldestFirst, StrategyNewestFirst)
+	}
+	bs.catchUp = config
+	return nil
+}
+
+// startCatchUp takes the files after the cursor, sorted oldest first, and
+// returns those to process in order. Under newest-first, if the newest file
+// is more than the lag past the cursor, it starts a backfill of all of them
+// and returns none. While a backfill is in progress newer files are
+// processed in order, since they are never far behind.
+func (bs *baseSpooler) startCatchUp(files []string) []string {
+	if bs.catchUp.Strategy != StrategyNewestFirst || len(files) == 0 {
+		return files
+	}
+	if _, active := bs.stateManager.GetBackfillCursor(); active {
+		return files
+	}
+
+	cursorUs := bs.stateManager.GetCursor().LastTimeUs
+	newestUs, err := common.ParseMegastreamFilenameTimestamp(filepath.Base(files[len(files)-1]))
+	if err != nil {
+		return files
+	}
+	behind := time.Duration(newestUs-cursorUs) * time.Microsecond
+	if behind <= bs.catchUp.Lag {
+		return files
+	}
+
+	if err := bs.stateManager.StartBackfill(cursorUs, newestUs); err != nil {
+		bs.logger.Error("Failed to start backfill, processing files in order: %v", err)
+		return files
+	}
+	bs.logger.Info("Cursor is %s behind the newest file, catching up newest first (%d files to backfill)", behind.Round(time.Second), len(files))
+	bs.logger.Metric("megastream.backfill_started_count", 1)
+	return nil
+}
+
+// backfill processes the files in the backfill range newest first, moving
+// the top of the range below each one. list returns the files in a range,
+// sorted oldest first. Outside once mode it pauses after an interval, so
+// that newer files are not kept waiting behind the backlog, and reports
+// whether it did.
+//
+// A file that fails is passed over, as processFiles passes over one by
+// moving the cursor past it on the next success.
+func (bs *baseSpooler) backfill(ctx context.Context, list func(afterUs, toUs int64) ([]string, error), process func(ctx context.Context, file string) error) (paused bool) {
+	if bs.stateManager == nil {
+		return false
+	}
+	cursor, active := bs.stateManager.GetBackfillCursor()
+	if !active {
+		return false
+	}
+
+	files, err := list(cursor.FromUs, cursor.ToUs)
+	if err != nil {
+		bs.logger.Error("Failed to discover backfill files: %v", err)
+		return false
+	}
+	bs.logger.Info("Backfilling %d files newest first", len(files))
+
+	deadline := time.Now().Add(bs.interval)
+	for i := len(files) - 1; i >= 0; i-- {
+		if bs.mode != "once" && i < len(files)-1 && !time.Now().Before(deadline) {
+			bs.logger.Info("Pausing backfill to check for newer files (%d files left)", i+1)
+			return true
+		}
+		if ctx.Err() != nil || !bs.waitForMemory(ctx) {
+			bs.logger.Info("Context cancelled during backfill")
+			return false
+		}
+
+		file := files[i]
+		fileTimeUs, err := common.ParseMegastreamFilenameTimestamp(filepath.Base(file))
+		if err != nil {
+			bs.logger.Error("Failed to parse filename timestamp for backfill: %s (%v)", file, err)
+			continue
+		}
+
+		bs.logger.Info("Backfilling file: %s", file)
+		if err := process(ctx, file); err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+			bs.logger.Error("Failed to backfill file %s: %v", file, err)
+		}
+		cursor.ToUs = fileTimeUs - 1
+		if err := bs.stateManager.UpdateBackfillCursor(cursor); err != nil {
+			bs.logger.Error("Failed to update backfill cursor for file %s: %v", file, err)
+		}
+	}
+
+	// Every file in the range has been processed or passed over
+	cursor.ToUs = cursor.FromUs
+	if err := bs.stateManager.UpdateBackfillCursor(cursor); err != nil {
+		bs.logger.Error("Failed to end backfill: %v", err)
+		return false
+	}
+	bs.logger.Info("Backfill complete")
+	bs.logger.Metric("megastream.backfill_completed_count", 1)
+	return false
+}
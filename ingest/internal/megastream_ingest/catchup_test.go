@@ -0,0 +1,121 @@
+package megastream_ingest
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func TestCatchUp_NewestFirst(t *testing.T) {
+	at := func(hour int) int64 {
+		return time.Date(2026, 3, 10, hour, 0, 0, 0, time.UTC).UnixMicro()
+	}
+	name := func(hour int) string {
+		return common.TimestampToMegastreamFilename(at(hour))
+	}
+	logger := common.NewLogger(false)
+	stateManager, err := common.NewStateManager(filepath.Join(t.TempDir(), "state.json"), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stateManager.UpdateCursor(at(8)); err != nil {
+		t.Fatal(err)
+	}
+
+	spooler := NewLocalSpooler(t.TempDir(), "once", 0, stateManager, logger)
+	if err := spooler.SetCatchUp(CatchUpConfig{Strategy: StrategyNewestFirst, Lag: 2 * time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := spooler.startCatchUp([]string{name(9), name(10)}); len(got) != 2 {
+		t.Errorf("expected files within the lag processed in order, got %v", got)
+	}
+	if got := spooler.startCatchUp([]string{name(9), name(10), name(11), name(12)}); len(got) != 0 {
+		t.Errorf("expected files past the lag handed to a backfill, got %v", got)
+	}
+	if got := stateManager.GetCursor().LastTimeUs; got != at(12) {
+		t.Errorf("expected the cursor moved to the newest file, got %d", got)
+	}
+	if got := spooler.startCatchUp([]string{name(13), name(20)}); len(got) != 2 {
+		t.Errorf("expected newer files processed in order during a backfill, got %v", got)
+	}
+
+	all := []string{name(7), name(8), name(9), name(10), name(11), name(12), name(13)}
+	list := func(afterUs, toUs int64) ([]string, error) {
+		return selectFiles(all, afterUs, toUs, logger), nil
+	}
+	var processed []string
+	process := func(ctx context.Context, file string) error {
+		processed = append(processed, file)
+		return nil
+	}
+	if paused := spooler.backfill(t.Context(), list, process); paused {
+		t.Error("expected a once-mode backfill to run to completion")
+	}
+	if want := []string{name(12), name(11), name(10), name(9)}; !reflect.DeepEqual(processed, want) {
+		t.Errorf("backfilled %v, want %v", processed, want)
+	}
+	if _, active := stateManager.GetBackfillCursor(); active {
+		t.Error("expected the backfill to be complete")
+	}
+}
+
+func TestCatchUp_BackfillPausesForNewerFiles(t *testing.T) {
+	// Filenames are second-granular, so the files are an hour apart
+	at := func(hour int) int64 {
+		return time.Date(2026, 3, 10, hour, 0, 0, 0, time.UTC).UnixMicro()
+	}
+	logger := common.NewLogger(false)
+	stateManager, err := common.NewStateManager(filepath.Join(t.TempDir(), "state.json"), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stateManager.StartBackfill(at(0), at(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A zero interval pauses after the first file
+	spooler := NewLocalSpooler(t.TempDir(), "spool", 0, stateManager, logger)
+	files := []string{common.TimestampToMegastreamFilename(at(1)), common.TimestampToMegastreamFilename(at(2))}
+	list := func(afterUs, toUs int64) ([]string, error) {
+		return selectFiles(files, afterUs, toUs, logger), nil
+	}
+	process := func(ctx context.Context, file string) error { return nil }
+
+	if paused := spooler.backfill(t.Context(), list, process); !paused {
+		t.Fatal("expected the backfill to pause")
+	}
+	cursor, active := stateManager.GetBackfillCursor()
+	if !active || cursor.ToUs != at(2)-1 {
+		t.Errorf("expected the backfill to resume below the processed file, got %+v", cursor)
+	}
+	if paused := spooler.backfill(t.Context(), list, process); paused {
+		t.Error("expected the resumed backfill to finish")
+	}
+}
+
+func TestSetCatchUp_RejectsInvalidConfig(t *testing.T) {
+	logger := common.NewLogger(false)
+	stateManager, err := common.NewStateManager(filepath.Join(t.TempDir(), "state.json"), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spooler := NewLocalSpooler(t.TempDir(), "once", 0, stateManager, logger)
+	for _, config := range []CatchUpConfig{
+		{Strategy: "random"},
+		{Strategy: StrategyNewestFirst},
+	} {
+		if err := spooler.SetCatchUp(config); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+
+	rangeSpooler := &S3Spooler{baseSpooler: &baseSpooler{logger: logger}}
+	if err := rangeSpooler.SetCatchUp(CatchUpConfig{Strategy: StrategyNewestFirst, Lag: time.Hour}); err == nil {
+		t.Error("expected newest-first to be rejected without a cursor")
+	}
+}
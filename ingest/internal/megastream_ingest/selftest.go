@@ -0,0 +1,141 @@
+package megastream_ingest
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// selfTestRows exercise what megastream files carry: multi-byte text, JSON,
+// and a raw post larger than a SQLite page
+var selfTestRows = []SQLiteRow{
+	{AtURI: "at://did:plc:selftest/app.bsky.feed.post/1", DID: "did:plc:selftest", RawPost: `{"text":"hello 🌍 — ünïcödé"}`, Inferences: `{"toxicity":0.01}`},
+	{AtURI: "at://did:plc:selftest/app.bsky.feed.post/2", DID: "did:plc:selftest", RawPost: `{"text":"` + strings.Repeat("x", 64*1024) + `"}`, Inferences: ""},
+}
+
+// SelfTest runs the spooler's file path on this platform: it writes a SQLite
+// database in the megastream schema with the SQLite driver, zips it, and
+// reads it back through the same unzip and query code the spoolers use. It
+// also checks that the temp directory can be removed afterwards, which fails
+// on platforms that lock files still held open.
+func SelfTest(ctx context.Context, logger *common.IngestLogger) (err error) {
+	tmpDir, err := os.MkdirTemp("", "ingest-selftest-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer func() {
+		if removeErr := os.RemoveAll(tmpDir); removeErr != nil && err == nil {
+			err = fmt.Errorf("failed to remove temp directory (is a file still open?): %w", removeErr)
+		}
+	}()
+
+	dbPath := filepath.Join(tmpDir, "selftest.db")
+	if err := writeSelfTestDatabase(ctx, dbPath); err != nil {
+		return err
+	}
+	if isZipFile(dbPath) {
+		return fmt.Errorf("raw SQLite database detected as a zip file")
+	}
+	if err := checkSelfTestRows(ctx, dbPath, logger); err != nil {
+		return fmt.Errorf("raw database: %w", err)
+	}
+
+	zipPath := filepath.Join(tmpDir, "selftest.db.zip")
+	if err := zipSelfTestDatabase(dbPath, zipPath); err != nil {
+		return err
+	}
+	if !isZipFile(zipPath) {
+		return fmt.Errorf("zipped database not detected as a zip file")
+	}
+	extractDir := filepath.Join(tmpDir, "extracted")
+	if err := os.Mkdir(extractDir, 0750); err != nil {
+		return fmt.Errorf("failed to create extract directory: %w", err)
+	}
+	extractedPath, err := unzipFile(zipPath, extractDir)
+	if err != nil {
+		return fmt.Errorf("failed to unzip database: %w", err)
+	}
+	if err := checkSelfTestRows(ctx, extractedPath, logger); err != nil {
+		return fmt.Errorf("zipped database: %w", err)
+	}
+	return nil
+}
+
+func writeSelfTestDatabase(ctx context.Context, dbPath string) error {
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		return fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+	defer func() { _ = db.Close() }()
+
+	if _, err := db.ExecContext(ctx, `CREATE TABLE enriched_posts (at_uri TEXT, did TEXT, raw_post TEXT, inferences TEXT)`); err != nil {
+		return fmt.Errorf("failed to create enriched_posts: %w", err)
+	}
+	for _, row := range selfTestRows {
+		if _, err := db.ExecContext(ctx, `INSERT INTO enriched_posts VALUES (?, ?, ?, ?)`, row.AtURI, row.DID, row.RawPost, row.Inferences); err != nil {
+			return fmt.Errorf("failed to insert row: %w", err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		return fmt.Errorf("failed to close SQLite database: %w", err)
+	}
+	return nil
+}
+
+func zipSelfTestDatabase(dbPath, zipPath string) error {
+	data, err := os.ReadFile(dbPath) // nolint:gosec // G304: path is in our own temp directory
+	if err != nil {
+		return fmt.Errorf("failed to read database: %w", err)
+	}
+	out, err := os.Create(zipPath) // nolint:gosec // G304: path is in our own temp directory
+	if err != nil {
+		return fmt.Errorf("failed to create zip file: %w", err)
+	}
+	zw := zip.NewWriter(out)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: filepath.Base(dbPath), Method: zip.Deflate})
+	if err == nil {
+		_, err = w.Write(data)
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write zip file: %w", err)
+	}
+	return nil
+}
+
+// checkSelfTestRows reads dbPath with processDatabase and compares the rows
+// with what was written
+func checkSelfTestRows(ctx context.Context, dbPath string, logger *common.IngestLogger) error {
+	rowChan := make(chan SQLiteRow, len(selfTestRows)+1)
+	if err := processDatabase(ctx, dbPath, filepath.Base(dbPath), rowChan, logger); err != nil {
+		return err
+	}
+	close(rowChan)
+
+	i := 0
+	for row := range rowChan {
+		if i >= len(selfTestRows) {
+			return fmt.Errorf("read more rows than the %d written", len(selfTestRows))
+		}
+		want := selfTestRows[i]
+		if row.AtURI != want.AtURI || row.DID != want.DID || row.RawPost != want.RawPost || row.Inferences != want.Inferences {
+			return fmt.Errorf("row %d read back differs from what was written", i)
+		}
+		i++
+	}
+	if i != len(selfTestRows) {
+		return fmt.Errorf("read %d rows, wrote %d", i, len(selfTestRows))
+	}
+	return nil
+}
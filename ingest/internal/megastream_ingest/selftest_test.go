@@ -0,0 +1,14 @@
+package megastream_ingest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func TestSelfTest(t *testing.T) {
+	if err := SelfTest(context.Background(), common.NewLogger(false)); err != nil {
+		t.Fatalf("spooler self-test failed: %v", err)
+	}
+}
@@ -16,6 +16,9 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"github.com/greenearth/ingest/internal/common"
 
 	_ "modernc.org/sqlite"
@@ -28,12 +31,16 @@ type SQLiteRow struct {
 	RawPost        string
 	Inferences     string
 	SourceFilename string
+	SpanContext    trace.SpanContext // Span of the file the row was read from
 }
 
 // Spooler defines the interface for data source processors that extract SQLiteRow data
 type Spooler interface {
 	Start(ctx context.Context) error
 	GetRowChannel() <-chan SQLiteRow
+	SetMemoryGuard(guard *common.MemoryGuard)
+	SetCatchUp(config CatchUpConfig) error
+	SetCursorWritePolicy(policy common.CursorWritePolicy)
 	Stop() error
 }
 
@@ -43,6 +50,66 @@ type baseSpooler struct {
 	logger       *common.IngestLogger
 	mode         string
 	interval     time.Duration
+	memoryGuard  *common.MemoryGuard
+	catchUp      CatchUpConfig
+
+	// Cursor of the last file processed, until it is written (see
+	// SetCursorWritePolicy)
+	cursorWrites *common.CursorThrottle
+	pendingUs    int64
+	pendingFile  string
+}
+
+// SetMemoryGuard pauses the spooler before each file while guard is throttled
+func (bs *baseSpooler) SetMemoryGuard(guard *common.MemoryGuard) {
+	bs.memoryGuard = guard
+}
+
+// SetCursorWritePolicy throttles cursor writes as files are processed. By
+// default the cursor is written after every file. A throttled cursor is
+// still written before the spooler looks for new files, and when it stops.
+func (bs *baseSpooler) SetCursorWritePolicy(policy common.CursorWritePolicy) {
+	bs.cursorWrites = common.NewCursorThrottle(policy, bs.logger)
+}
+
+// advanceCursor moves the cursor past the processed file with timestamp
+// fileTimeUs, writing it if due
+func (bs *baseSpooler) advanceCursor(fileTimeUs int64, filename string) {
+	bs.pendingUs, bs.pendingFile = fileTimeUs, filename
+	bs.cursorWrites.AddBatches(1)
+	if bs.cursorWrites.Due(time.Now()) {
+		bs.writeCursor()
+	}
+}
+
+// writeCursor writes the cursor of the last file processed, if it has not
+// been written. A failed write is retried with the next file's cursor.
+func (bs *baseSpooler) writeCursor() {
+	if bs.pendingUs == 0 {
+		return
+	}
+	now := time.Now()
+	if err := bs.stateManager.UpdateCursor(bs.pendingUs); err != nil {
+		bs.logger.Error("Failed to update cursor for file %s: %v", bs.pendingFile, err)
+		return
+	}
+	bs.logger.Debug("Updated cursor to %d after processing file: %s", bs.pendingUs, bs.pendingFile)
+	bs.cursorWrites.Written(bs.pendingUs, now)
+	bs.pendingUs, bs.pendingFile = 0, ""
+}
+
+// waitForMemory blocks while the memory guard is throttled, returning false
+// if ctx is done first
+func (bs *baseSpooler) waitForMemory(ctx context.Context) bool {
+	if !bs.memoryGuard.Throttled() {
+		return true
+	}
+	bs.logger.Info("Pausing file intake under memory pressure")
+	if err := bs.memoryGuard.Wait(ctx); err != nil {
+		return false
+	}
+	bs.logger.Info("Resuming file intake")
+	return true
 }
 
 // LocalSpooler processes SQLite database files from a local directory
@@ -59,6 +126,13 @@ type S3Spooler struct {
 	s3Client  *s3.Client
 	region    string
 	awsConfig aws.Config
+
+	// Range of file timestamps, in microseconds, for a spooler without a
+	// state manager (see NewS3RangeSpooler)
+	fromUs int64
+	toUs   int64
+
+	failedFiles []string
 }
 
 // NewLocalSpooler creates a new LocalSpooler for processing files from a local directory
@@ -70,6 +144,7 @@ func NewLocalSpooler(directory string, mode string, interval time.Duration, stat
 			logger:       logger,
 			mode:         mode,
 			interval:     interval,
+			cursorWrites: common.NewCursorThrottle(common.CursorWritePolicy{}, logger),
 		},
 		directory: directory,
 	}
@@ -77,6 +152,45 @@ func NewLocalSpooler(directory string, mode string, interval time.Duration, stat
 
 // NewS3Spooler creates a new S3Spooler for processing files from an Amazon S3 bucket
 func NewS3Spooler(bucket, prefix, region, accessKey, secretKey string, mode string, interval time.Duration, stateManager *common.StateManager, logger *common.IngestLogger) (*S3Spooler, error) {
+	cfg, err := loadAWSConfig(region, accessKey, secretKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Spooler{
+		baseSpooler: &baseSpooler{
+			rowChan:      make(chan SQLiteRow, 1000),
+			stateManager: stateManager,
+			logger:       logger,
+			mode:         mode,
+			interval:     interval,
+			cursorWrites: common.NewCursorThrottle(common.CursorWritePolicy{}, logger),
+		},
+		bucket:    bucket,
+		prefix:    prefix,
+		s3Client:  s3.NewFromConfig(cfg),
+		region:    region,
+		awsConfig: cfg,
+	}, nil
+}
+
+// NewS3RangeSpooler creates an S3Spooler that processes, once and in order,
+// the files whose filename timestamps fall within [from, to]. It neither
+// reads nor updates a cursor, so it can run alongside live ingestion.
+func NewS3RangeSpooler(bucket, prefix, region, accessKey, secretKey string, from, to time.Time, logger *common.IngestLogger) (*S3Spooler, error) {
+	if !to.After(from) {
+		return nil, fmt.Errorf("invalid range: %s is not after %s", to.Format(time.RFC3339), from.Format(time.RFC3339))
+	}
+	ss, err := NewS3Spooler(bucket, prefix, region, accessKey, secretKey, "once", 0, nil, logger)
+	if err != nil {
+		return nil, err
+	}
+	ss.fromUs = from.UnixMicro()
+	ss.toUs = to.UnixMicro()
+	return ss, nil
+}
+
+func loadAWSConfig(region, accessKey, secretKey string) (aws.Config, error) {
 	var cfg aws.Config
 	var err error
 
@@ -96,25 +210,9 @@ func NewS3Spooler(bucket, prefix, region, accessKey, secretKey string, mode stri
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		return aws.Config{}, fmt.Errorf("failed to load AWS config: %w", err)
 	}
-
-	client := s3.NewFromConfig(cfg)
-
-	return &S3Spooler{
-		baseSpooler: &baseSpooler{
-			rowChan:      make(chan SQLiteRow, 1000),
-			stateManager: stateManager,
-			logger:       logger,
-			mode:         mode,
-			interval:     interval,
-		},
-		bucket:    bucket,
-		prefix:    prefix,
-		s3Client:  client,
-		region:    region,
-		awsConfig: cfg,
-	}, nil
+	return cfg, nil
 }
 
 // Start begins processing files in the local directory
@@ -129,19 +227,25 @@ func (ls *LocalSpooler) Start(ctx context.Context) error {
 			if err != nil {
 				ls.logger.Error("Failed to discover files: %v", err)
 			} else {
-				ls.processFiles(ctx, files)
+				ls.processFiles(ctx, ls.startCatchUp(files))
 			}
+			backfillPaused := ls.backfill(ctx, ls.listFiles, ls.backfillFile)
 
 			if ls.mode == "once" {
 				ls.logger.Info("Single run complete, exiting spooler")
 				return
 			}
 
+			// A paused backfill resumes as soon as newer files are checked
+			wait := ls.interval
+			if backfillPaused {
+				wait = 0
+			}
 			select {
 			case <-ctx.Done():
 				ls.logger.Info("Context cancelled, stopping spooler")
 				return
-			case <-time.After(ls.interval):
+			case <-time.After(wait):
 			}
 		}
 	}()
@@ -161,61 +265,43 @@ func (ls *LocalSpooler) Stop() error {
 }
 
 func (ls *LocalSpooler) discoverFiles() ([]string, error) {
+	// Cursor is guaranteed to be set by StateManager; one a skewed clock
+	// put in the future would skip the files before it
+	cursorTimeUs := common.ClampFutureCursor(ls.stateManager.GetCursor().LastTimeUs, ls.logger)
+	ls.logger.Debug("Using cursor for file filtering: %d", cursorTimeUs)
+
+	files, err := ls.listFiles(cursorTimeUs, 0)
+	if err != nil {
+		return nil, err
+	}
+	ls.logger.Info("Discovered %d unprocessed files", len(files))
+	return files, nil
+}
+
+// listFiles returns, sorted, the files in the directory whose filename
+// timestamps are after afterUs and, unless toUs is 0, at or before toUs
+func (ls *LocalSpooler) listFiles(afterUs, toUs int64) ([]string, error) {
 	entries, err := os.ReadDir(ls.directory)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read directory: %w", err)
 	}
 
-	// Cursor is guaranteed to be set by StateManager
-	cursor := ls.stateManager.GetCursor()
-	cursorTimeUs := cursor.LastTimeUs
-	ls.logger.Debug("Using cursor for file filtering: %d", cursorTimeUs)
-
-	var files []string
-	var skippedCount int
-	var oldestSkipped, newestSkipped string
-	var oldestSkippedTime, newestSkippedTime int64
-
+	var names []string
 	for _, entry := range entries {
-		if entry.IsDir() {
-			continue
-		}
-
-		if !strings.HasSuffix(entry.Name(), ".db.zip") {
-			continue
-		}
-
-		fileTimeUs, err := common.ParseMegastreamFilenameTimestamp(entry.Name())
-		if err != nil {
-			ls.logger.Error("Skipping file with invalid filename format: %s (%v)", entry.Name(), err)
-			continue
-		}
-
-		if fileTimeUs <= cursorTimeUs {
-			skippedCount++
-			if oldestSkipped == "" || fileTimeUs < oldestSkippedTime {
-				oldestSkipped = entry.Name()
-				oldestSkippedTime = fileTimeUs
-			}
-			if newestSkipped == "" || fileTimeUs > newestSkippedTime {
-				newestSkipped = entry.Name()
-				newestSkippedTime = fileTimeUs
-			}
-			continue
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
 		}
-
-		files = append(files, entry.Name())
 	}
+	return selectFiles(names, afterUs, toUs, ls.logger), nil
+}
 
-	sort.Strings(files)
-	if skippedCount > 0 {
-		ls.logger.Info("Skipped %d files before cursor (oldest: %s, newest: %s)", skippedCount, oldestSkipped, newestSkipped)
-	}
-	ls.logger.Info("Discovered %d unprocessed files", len(files))
-	return files, nil
+// backfillFile processes a file in the backfill range
+func (ls *LocalSpooler) backfillFile(ctx context.Context, filename string) error {
+	return ls.processFile(ctx, filepath.Join(ls.directory, filename), filename)
 }
 
 func (ls *LocalSpooler) processFiles(ctx context.Context, files []string) {
+	defer ls.writeCursor()
 	for _, filename := range files {
 		select {
 		case <-ctx.Done():
@@ -223,6 +309,10 @@ func (ls *LocalSpooler) processFiles(ctx context.Context, files []string) {
 			return
 		default:
 		}
+		if !ls.waitForMemory(ctx) {
+			ls.logger.Info("Context cancelled during file processing")
+			return
+		}
 
 		filePath := filepath.Join(ls.directory, filename)
 		ls.logger.Info("Processing file: %s", filename)
@@ -236,16 +326,15 @@ func (ls *LocalSpooler) processFiles(ctx context.Context, files []string) {
 				continue
 			}
 
-			if err := ls.stateManager.UpdateCursor(fileTimeUs); err != nil {
-				ls.logger.Error("Failed to update cursor for file %s: %v", filename, err)
-			} else {
-				ls.logger.Debug("Updated cursor to %d after processing file: %s", fileTimeUs, filename)
-			}
+			ls.advanceCursor(fileTimeUs, filename)
 		}
 	}
 }
 
-func (ls *LocalSpooler) processFile(ctx context.Context, filePath, filename string) error {
+func (ls *LocalSpooler) processFile(ctx context.Context, filePath, filename string) (err error) {
+	ctx, span := common.StartSpan(ctx, "megastream.process_file", attribute.String("ingex.file", filename))
+	defer func() { common.EndSpan(span, err) }()
+
 	tmpDir, err := os.MkdirTemp("", "ingest-*")
 	if err != nil {
 		return fmt.Errorf("failed to create temp directory: %w", err)
@@ -260,7 +349,7 @@ func (ls *LocalSpooler) processFile(ctx context.Context, filePath, filename stri
 	var dbPath string
 	if isZipFile(filePath) {
 		ls.logger.Debug("File is zipped, extracting %s", filePath)
-		dbPath, err = unzipFile(filePath, tmpDir)
+		dbPath, err = unzipFileTraced(ctx, filePath, tmpDir)
 		if err != nil {
 			return fmt.Errorf("failed to unzip file: %w", err)
 		}
@@ -296,19 +385,27 @@ func (ss *S3Spooler) Start(ctx context.Context) error {
 			if err != nil {
 				ss.logger.Error("Failed to discover files: %v", err)
 			} else {
-				ss.processFiles(ctx, files)
+				ss.processFiles(ctx, ss.startCatchUp(files))
 			}
+			backfillPaused := ss.backfill(ctx, func(afterUs, toUs int64) ([]string, error) {
+				return ss.listFiles(ctx, afterUs, toUs)
+			}, ss.backfillFile)
 
 			if ss.mode == "once" {
 				ss.logger.Info("Single run complete, exiting spooler")
 				return
 			}
 
+			// A paused backfill resumes as soon as newer files are checked
+			wait := ss.interval
+			if backfillPaused {
+				wait = 0
+			}
 			select {
 			case <-ctx.Done():
 				ss.logger.Info("Context cancelled, stopping spooler")
 				return
-			case <-time.After(ss.interval):
+			case <-time.After(wait):
 			}
 		}
 	}()
@@ -321,6 +418,12 @@ func (ss *S3Spooler) GetRowChannel() <-chan SQLiteRow {
 	return ss.rowChan
 }
 
+// FailedFiles returns the keys of files that could not be processed. Call it
+// only after the row channel is closed.
+func (ss *S3Spooler) FailedFiles() []string {
+	return ss.failedFiles
+}
+
 // Stop gracefully stops the S3Spooler
 func (ss *S3Spooler) Stop() error {
 	ss.logger.Info("Stopping S3 spooler")
@@ -328,13 +431,28 @@ func (ss *S3Spooler) Stop() error {
 }
 
 func (ss *S3Spooler) discoverFiles(ctx context.Context) ([]string, error) {
-	// Cursor is guaranteed to be set by StateManager
-	cursor := ss.stateManager.GetCursor()
-	cursorTimeUs := cursor.LastTimeUs
-	ss.logger.Debug("Using cursor for file filtering: %d", cursorTimeUs)
+	// Files at or before afterUs are already processed; toUs of 0 is unbounded
+	afterUs, toUs := ss.fromUs-1, ss.toUs
+	if ss.stateManager != nil {
+		// Cursor is guaranteed to be set by StateManager; one a skewed clock
+		// put in the future would skip the files before it
+		afterUs, toUs = common.ClampFutureCursor(ss.stateManager.GetCursor().LastTimeUs, ss.logger), 0
+		ss.logger.Debug("Using cursor for file filtering: %d", afterUs)
+	}
+
+	files, err := ss.listFiles(ctx, afterUs, toUs)
+	if err != nil {
+		return nil, err
+	}
+	ss.logger.Info("Discovered %d unprocessed files in S3", len(files))
+	return files, nil
+}
 
+// listFiles returns, sorted, the keys of the files whose filename
+// timestamps are after afterUs and, unless toUs is 0, at or before toUs
+func (ss *S3Spooler) listFiles(ctx context.Context, afterUs, toUs int64) ([]string, error) {
 	// Convert cursor timestamp to filename for StartAfter optimization
-	startAfterFilename := common.TimestampToMegastreamFilename(cursorTimeUs)
+	startAfterFilename := common.TimestampToMegastreamFilename(afterUs)
 	startAfterKey := ss.prefix + startAfterFilename
 
 	input := &s3.ListObjectsV2Input{
@@ -365,6 +483,12 @@ func (ss *S3Spooler) discoverFiles(ctx context.Context) ([]string, error) {
 		if !*result.IsTruncated {
 			break
 		}
+		// Keys list in timestamp order, so a page ending past the range ends the listing
+		if toUs > 0 && len(result.Contents) > 0 {
+			if lastUs, err := common.ParseMegastreamFilenameTimestamp(filepath.Base(*result.Contents[len(result.Contents)-1].Key)); err == nil && lastUs > toUs {
+				break
+			}
+		}
 
 		input.ContinuationToken = result.NextContinuationToken
 		input.StartAfter = nil // Only use StartAfter on first request
@@ -372,13 +496,19 @@ func (ss *S3Spooler) discoverFiles(ctx context.Context) ([]string, error) {
 
 	ss.logger.Info("Retrieved %d objects from S3 across %d page(s)", totalObjects, pageCount)
 
-	// Filter files based on timestamp
+	return selectFiles(allObjects, afterUs, toUs, ss.logger), nil
+}
+
+// selectFiles returns, sorted, the megastream files among keys whose
+// filename timestamps are after afterUs and, unless toUs is 0, at or before
+// toUs
+func selectFiles(keys []string, afterUs, toUs int64, logger *common.IngestLogger) []string {
 	var files []string
-	var skippedCount int
+	var skippedCount, pastRangeCount int
 	var oldestSkipped, newestSkipped string
 	var oldestSkippedTime, newestSkippedTime int64
 
-	for _, key := range allObjects {
+	for _, key := range keys {
 		filename := filepath.Base(key)
 
 		if !strings.HasSuffix(filename, ".db.zip") {
@@ -387,11 +517,11 @@ func (ss *S3Spooler) discoverFiles(ctx context.Context) ([]string, error) {
 
 		fileTimeUs, err := common.ParseMegastreamFilenameTimestamp(filename)
 		if err != nil {
-			ss.logger.Error("Skipping file with invalid filename format: %s (%v)", filename, err)
+			logger.Error("Skipping file with invalid filename format: %s (%v)", filename, err)
 			continue
 		}
 
-		if fileTimeUs <= cursorTimeUs {
+		if fileTimeUs <= afterUs {
 			skippedCount++
 			if oldestSkipped == "" || fileTimeUs < oldestSkippedTime {
 				oldestSkipped = filename
@@ -403,19 +533,28 @@ func (ss *S3Spooler) discoverFiles(ctx context.Context) ([]string, error) {
 			}
 			continue
 		}
+		if toUs > 0 && fileTimeUs > toUs {
+			pastRangeCount++
+			continue
+		}
 
 		files = append(files, key)
 	}
 
 	sort.Strings(files)
 	if skippedCount > 0 {
-		ss.logger.Info("Skipped %d files before cursor (oldest: %s, newest: %s)", skippedCount, oldestSkipped, newestSkipped)
+		logger.Info("Skipped %d files before cursor (oldest: %s, newest: %s)", skippedCount, oldestSkipped, newestSkipped)
 	}
-	ss.logger.Info("Discovered %d unprocessed files in S3", len(files))
-	return files, nil
+	if pastRangeCount > 0 {
+		logger.Info("Skipped %d files after the end of the range", pastRangeCount)
+	}
+	return files
 }
 
 func (ss *S3Spooler) processFiles(ctx context.Context, keys []string) {
+	if ss.stateManager != nil {
+		defer ss.writeCursor()
+	}
 	for _, key := range keys {
 		select {
 		case <-ctx.Done():
@@ -423,13 +562,18 @@ func (ss *S3Spooler) processFiles(ctx context.Context, keys []string) {
 			return
 		default:
 		}
+		if !ss.waitForMemory(ctx) {
+			ss.logger.Info("Context cancelled during file processing")
+			return
+		}
 
 		filename := filepath.Base(key)
 		ss.logger.Info("Processing S3 file: %s", key)
 
 		if err := ss.processFile(ctx, key, filename); err != nil {
 			ss.logger.Error("Failed to process S3 file %s: %v", key, err)
-		} else {
+			ss.failedFiles = append(ss.failedFiles, key)
+		} else if ss.stateManager != nil {
 			fileTimeUs, err := common.ParseMegastreamFilenameTimestamp(filename)
 			if err != nil {
 				ss.logger.Error("Failed to parse filename timestamp for cursor update: %s (%v)", filename, err)
@@ -439,16 +583,24 @@ func (ss *S3Spooler) processFiles(ctx context.Context, keys []string) {
 			// TODO: Move state update to after Elasticsearch indexing is confirmed.
 			// mechanism from main thread back to spooler (e.g., via separate ack channel).
 			// https://github.com/greenearth-social/ingex/issues/44
-			if err := ss.stateManager.UpdateCursor(fileTimeUs); err != nil {
-				ss.logger.Error("Failed to update cursor for file %s: %v", filename, err)
-			} else {
-				ss.logger.Debug("Updated cursor to %d after processing file: %s", fileTimeUs, filename)
-			}
+			ss.advanceCursor(fileTimeUs, filename)
 		}
 	}
 }
 
-func (ss *S3Spooler) processFile(ctx context.Context, key, filename string) error {
+// backfillFile processes a file in the backfill range
+func (ss *S3Spooler) backfillFile(ctx context.Context, key string) error {
+	if err := ss.processFile(ctx, key, filepath.Base(key)); err != nil {
+		ss.failedFiles = append(ss.failedFiles, key)
+		return err
+	}
+	return nil
+}
+
+func (ss *S3Spooler) processFile(ctx context.Context, key, filename string) (err error) {
+	ctx, span := common.StartSpan(ctx, "megastream.process_file", attribute.String("ingex.file", key))
+	defer func() { common.EndSpan(span, err) }()
+
 	tmpDir, err := os.MkdirTemp("", "ingest-s3-*")
 	if err != nil {
 		return fmt.Errorf("failed to create temp directory: %w", err)
@@ -469,7 +621,7 @@ func (ss *S3Spooler) processFile(ctx context.Context, key, filename string) erro
 	var dbPath string
 	if isZipFile(zipPath) {
 		ss.logger.Debug("File is zipped, extracting %s", zipPath)
-		dbPath, err = unzipFile(zipPath, tmpDir)
+		dbPath, err = unzipFileTraced(ctx, zipPath, tmpDir)
 		if err != nil {
 			return fmt.Errorf("failed to unzip file: %w", err)
 		}
@@ -487,7 +639,10 @@ func (ss *S3Spooler) processFile(ctx context.Context, key, filename string) erro
 	return nil
 }
 
-func (ss *S3Spooler) downloadFile(ctx context.Context, key, destPath string) error {
+func (ss *S3Spooler) downloadFile(ctx context.Context, key, destPath string) (err error) {
+	ctx, span := common.StartSpan(ctx, "megastream.download", attribute.String("ingex.file", key))
+	defer func() { common.EndSpan(span, err) }()
+
 	input := &s3.GetObjectInput{
 		Bucket:       aws.String(ss.bucket),
 		Key:          aws.String(key),
@@ -560,6 +715,13 @@ func isZipFile(path string) bool {
 	return n >= 2 && header[0] == 0x50 && header[1] == 0x4b // nolint:gosec // G602: bounds already checked above
 }
 
+// unzipFileTraced is unzipFile in a span
+func unzipFileTraced(ctx context.Context, zipPath, destDir string) (dbPath string, err error) {
+	_, span := common.StartSpan(ctx, "megastream.unzip")
+	defer func() { common.EndSpan(span, err) }()
+	return unzipFile(zipPath, destDir)
+}
+
 func unzipFile(zipPath, destDir string) (string, error) {
 	r, err := zip.OpenReader(zipPath)
 	if err != nil {
@@ -616,7 +778,22 @@ func unzipFile(zipPath, destDir string) (string, error) {
 	return dbPath, nil
 }
 
-func processDatabase(ctx context.Context, dbPath, filename string, rowChan chan<- SQLiteRow, logger *common.IngestLogger) error {
+// processDatabase queues every row of the database at dbPath. Its span
+// records how long queueing blocked on a full channel, which is how a backlog
+// behind the spooler shows up.
+func processDatabase(ctx context.Context, dbPath, filename string, rowChan chan<- SQLiteRow, logger *common.IngestLogger) (err error) {
+	fileSpan := trace.SpanContextFromContext(ctx)
+	ctx, span := common.StartSpan(ctx, "megastream.read_database")
+	rowCount := 0
+	var queueWait time.Duration
+	defer func() {
+		span.SetAttributes(
+			attribute.Int("ingex.rows", rowCount),
+			attribute.Int64("ingex.queue_wait_ms", queueWait.Milliseconds()),
+		)
+		common.EndSpan(span, err)
+	}()
+
 	db, err := sql.Open("sqlite", dbPath)
 	if err != nil {
 		return fmt.Errorf("failed to open SQLite database: %w", err)
@@ -640,7 +817,6 @@ func processDatabase(ctx context.Context, dbPath, filename string, rowChan chan<
 		}
 	}()
 
-	rowCount := 0
 	for rows.Next() {
 		select {
 		case <-ctx.Done():
@@ -654,13 +830,16 @@ func processDatabase(ctx context.Context, dbPath, filename string, rowChan chan<
 			continue
 		}
 
+		queued := time.Now()
 		rowChan <- SQLiteRow{
 			AtURI:          atURI,
 			DID:            did,
 			RawPost:        rawPost,
 			Inferences:     inferences,
 			SourceFilename: filename,
+			SpanContext:    fileSpan,
 		}
+		queueWait += time.Since(queued)
 		rowCount++
 	}
 
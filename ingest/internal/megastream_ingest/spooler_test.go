@@ -0,0 +1,34 @@
+package megastream_ingest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func TestSelectFiles(t *testing.T) {
+	at := func(hour int) int64 {
+		return time.Date(2026, 3, 10, hour, 0, 0, 0, time.UTC).UnixMicro()
+	}
+	key := func(hour int) string {
+		return "megastream/" + common.TimestampToMegastreamFilename(at(hour))
+	}
+	keys := []string{key(12), key(9), "megastream/README.txt", key(10), key(11), "megastream/mega_jetstream_bad.db.zip"}
+	logger := common.NewLogger(false)
+
+	t.Run("after cursor", func(t *testing.T) {
+		got := selectFiles(keys, at(10), 0, logger)
+		if want := []string{key(11), key(12)}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("within range", func(t *testing.T) {
+		got := selectFiles(keys, at(10)-1, at(11), logger)
+		if want := []string{key(10), key(11)}; !reflect.DeepEqual(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+}
@@ -0,0 +1,147 @@
+// Package model defines the records ingest handles — posts, likes,
+// tombstones and account events — independent of how any source encodes
+// them or any sink stores them. Sources decode into these types and each
+// sink maps from them (see internal/common/model.go), so a new field is
+// added here once and then mapped where it is stored.
+//
+// Timestamps are RFC 3339 strings as received, so a record read back from a
+// sink maps to the same output it was written from.
+package model
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Post is an original post or a reply. Replies have thread URIs.
+type Post struct {
+	AtURI                   string
+	AuthorDID               string
+	Content                 string
+	Langs                   []string // Languages the author declared for the record, as BCP 47 tags
+	SelfLabels              []string // Values of the labels the author applied to the record, e.g. "porn"
+	CreatedAt               string   // Record createdAt, as written by the client
+	IndexedAt               string
+	ThreadRootURI           string
+	ThreadParentURI         string
+	QuoteURI                string
+	Embeddings              map[string][]float32 // Model name -> content embedding
+	Media                   []Media
+	External                *External
+	VideoTranscript         string
+	VideoTranscriptLanguage string
+	VideoDurationSec        float64 // Length of the embedded video in seconds; 0 if unknown
+	LikeCount               int
+	ReplyCount              int // Direct replies
+	ThreadReplyCount        int // Replies anywhere in the thread the post roots
+	QuoteCount              int
+}
+
+// IsReply reports whether the post is part of another post's thread
+func (p Post) IsReply() bool {
+	return p.ThreadParentURI != "" || p.ThreadRootURI != ""
+}
+
+// Media types
+const (
+	MediaImage = "image"
+	MediaVideo = "video"
+)
+
+// Media is an image or video embedded in a post
+type Media struct {
+	ID          string
+	Type        string // MediaImage or MediaVideo
+	MimeType    string
+	Size        int64
+	AspectRatio float64
+	Width       int
+	Height      int
+	AltText     string
+}
+
+// MediaCounts returns how many images and videos the post embeds
+func (p Post) MediaCounts() (images, videos int) {
+	for _, m := range p.Media {
+		switch m.Type {
+		case MediaImage:
+			images++
+		case MediaVideo:
+			videos++
+		}
+	}
+	return images, videos
+}
+
+// External is a link card embedded in a post
+type External struct {
+	URI         string
+	Title       string
+	Description string
+}
+
+// ExternalDomain returns the host of the post's link card, lower-cased and
+// without a "www." prefix or port, or "" if it has no card with an http(s)
+// link. Link cards to the same site share a domain, e.g. for ranking by
+// domain quality.
+func (p Post) ExternalDomain() string {
+	if p.External == nil {
+		return ""
+	}
+	u, err := url.Parse(strings.TrimSpace(p.External.URI))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	return strings.TrimPrefix(host, "www.")
+}
+
+// Like is a like of a post or reply
+type Like struct {
+	AtURI      string
+	AuthorDID  string
+	SubjectURI string
+	CreatedAt  string // Record createdAt, as written by the client
+	IndexedAt  string
+}
+
+// Tombstone kinds, named for the record that was deleted
+const (
+	TombstonePost   = "post"
+	TombstoneLike   = "like"
+	TombstoneFollow = "follow"
+)
+
+// Tombstone records the deletion of a post, like, or follow. SubjectURI is
+// set for likes and SubjectDID for follows.
+type Tombstone struct {
+	Kind       string
+	AtURI      string
+	AuthorDID  string
+	SubjectURI string
+	SubjectDID string
+	DeletedAt  string
+	IndexedAt  string
+}
+
+// Account statuses reported by account events. Inactive accounts carry the
+// reason; AccountActive is recorded for active ones, whose events carry none.
+const (
+	AccountActive      = "active"
+	AccountDeleted     = "deleted"
+	AccountDeactivated = "deactivated"
+	AccountTakendown   = "takendown"
+	AccountSuspended   = "suspended"
+)
+
+// AccountEvent is a change to an account's status, e.g. its deletion
+type AccountEvent struct {
+	DID    string
+	Status string // e.g. AccountDeleted; empty when active
+	TimeUs int64  // Source event time in microseconds since the epoch
+}
+
+// IsDeletion reports whether the account was deleted
+func (e AccountEvent) IsDeletion() bool {
+	return e.Status == AccountDeleted
+}
@@ -0,0 +1,54 @@
+package model
+
+import "testing"
+
+func TestPost_IsReply(t *testing.T) {
+	tests := []struct {
+		name string
+		post Post
+		want bool
+	}{
+		{"original", Post{AtURI: "at://a"}, false},
+		{"quote is not a reply", Post{QuoteURI: "at://q"}, false},
+		{"parent", Post{ThreadParentURI: "at://p"}, true},
+		{"root only", Post{ThreadRootURI: "at://r"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.post.IsReply(); got != tt.want {
+				t.Errorf("IsReply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPost_MediaCounts(t *testing.T) {
+	post := Post{Media: []Media{{Type: MediaImage}, {Type: MediaVideo}, {Type: MediaImage}, {Type: "gif"}}}
+	images, videos := post.MediaCounts()
+	if images != 2 || videos != 1 {
+		t.Errorf("MediaCounts() = %d, %d, want 2, 1", images, videos)
+	}
+}
+
+func TestPost_ExternalDomain(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{"https://www.Example.com/a?b=c", "example.com"},
+		{"http://news.example.co.uk:8080/story", "news.example.co.uk"},
+		{"https://example.com./", "example.com"},
+		{"at://did:plc:a/app.bsky.feed.post/1", ""},
+		{"not a url", ""},
+		{"https://", ""},
+	}
+	for _, tt := range tests {
+		post := Post{External: &External{URI: tt.uri}}
+		if got := post.ExternalDomain(); got != tt.want {
+			t.Errorf("ExternalDomain() of %q = %q, want %q", tt.uri, got, tt.want)
+		}
+	}
+	if got := (Post{}).ExternalDomain(); got != "" {
+		t.Errorf("ExternalDomain() without a link card = %q, want empty", got)
+	}
+}
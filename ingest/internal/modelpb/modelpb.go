@@ -0,0 +1,350 @@
+// Package modelpb encodes internal/model records in the protobuf wire format
+// defined by proto/model.proto, for consumers outside this module. The
+// encoding is written against protowire rather than generated, so building
+// needs no protoc; keep field numbers in sync with the schema.
+//
+// Decoding follows proto3 rules: unknown fields, and known fields with an
+// unexpected wire type, are skipped, so older readers accept newer records.
+package modelpb
+
+import (
+	"maps"
+	"math"
+	"slices"
+
+	"github.com/greenearth/ingest/internal/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// MarshalPost encodes a Post message
+func MarshalPost(p model.Post) []byte {
+	return appendPost(nil, p)
+}
+
+// UnmarshalPost decodes a Post message
+func UnmarshalPost(b []byte) (model.Post, error) {
+	var p model.Post
+	err := decodeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return stringField(typ, b, &p.AtURI)
+		case 2:
+			return stringField(typ, b, &p.AuthorDID)
+		case 3:
+			return stringField(typ, b, &p.Content)
+		case 4:
+			return stringField(typ, b, &p.CreatedAt)
+		case 5:
+			return stringField(typ, b, &p.IndexedAt)
+		case 6:
+			return stringField(typ, b, &p.ThreadRootURI)
+		case 7:
+			return stringField(typ, b, &p.ThreadParentURI)
+		case 8:
+			return stringField(typ, b, &p.QuoteURI)
+		case 9:
+			return messageField(typ, b, func(entry []byte) error {
+				var name string
+				var values []float32
+				err := decodeFields(entry, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+					switch num {
+					case 1:
+						return stringField(typ, b, &name)
+					case 2:
+						return messageField(typ, b, func(embedding []byte) error {
+							var err error
+							values, err = unmarshalEmbedding(embedding)
+							return err
+						})
+					}
+					return 0, nil
+				})
+				if err != nil {
+					return err
+				}
+				if p.Embeddings == nil {
+					p.Embeddings = make(map[string][]float32)
+				}
+				p.Embeddings[name] = values
+				return nil
+			})
+		case 10:
+			return messageField(typ, b, func(b []byte) error {
+				m, err := unmarshalMedia(b)
+				p.Media = append(p.Media, m)
+				return err
+			})
+		case 11:
+			return messageField(typ, b, func(b []byte) error {
+				external, err := unmarshalExternal(b)
+				p.External = &external
+				return err
+			})
+		case 12:
+			return stringField(typ, b, &p.VideoTranscript)
+		case 13:
+			return stringField(typ, b, &p.VideoTranscriptLanguage)
+		case 14:
+			var likeCount int64
+			n, err := varintField(typ, b, &likeCount)
+			p.LikeCount = int(likeCount)
+			return n, err
+		}
+		return 0, nil
+	})
+	return p, err
+}
+
+func appendPost(b []byte, p model.Post) []byte {
+	b = appendString(b, 1, p.AtURI)
+	b = appendString(b, 2, p.AuthorDID)
+	b = appendString(b, 3, p.Content)
+	b = appendString(b, 4, p.CreatedAt)
+	b = appendString(b, 5, p.IndexedAt)
+	b = appendString(b, 6, p.ThreadRootURI)
+	b = appendString(b, 7, p.ThreadParentURI)
+	b = appendString(b, 8, p.QuoteURI)
+	// Sorted so equal posts encode to equal bytes
+	for _, name := range slices.Sorted(maps.Keys(p.Embeddings)) {
+		values := p.Embeddings[name]
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, name)
+		entry = appendMessage(entry, 2, appendEmbedding(nil, values))
+		b = appendMessage(b, 9, entry)
+	}
+	for _, m := range p.Media {
+		b = appendMessage(b, 10, appendMedia(nil, m))
+	}
+	if p.External != nil {
+		b = appendMessage(b, 11, appendExternal(nil, *p.External))
+	}
+	b = appendString(b, 12, p.VideoTranscript)
+	b = appendString(b, 13, p.VideoTranscriptLanguage)
+	b = appendVarint(b, 14, int64(p.LikeCount))
+	return b
+}
+
+func appendEmbedding(b []byte, values []float32) []byte {
+	if len(values) == 0 {
+		return b
+	}
+	packed := make([]byte, 0, 4*len(values))
+	for _, v := range values {
+		packed = protowire.AppendFixed32(packed, math.Float32bits(v))
+	}
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	return protowire.AppendBytes(b, packed)
+}
+
+func unmarshalEmbedding(b []byte) ([]float32, error) {
+	values := []float32{}
+	err := decodeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num != 1 {
+			return 0, nil
+		}
+		switch typ {
+		case protowire.BytesType:
+			packed, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return n, nil
+			}
+			if len(packed)%4 != 0 {
+				return 0, errPackedLength
+			}
+			for len(packed) > 0 {
+				v, m := protowire.ConsumeFixed32(packed)
+				values = append(values, math.Float32frombits(v))
+				packed = packed[m:]
+			}
+			return n, nil
+		case protowire.Fixed32Type:
+			v, n := protowire.ConsumeFixed32(b)
+			if n >= 0 {
+				values = append(values, math.Float32frombits(v))
+			}
+			return n, nil
+		}
+		return 0, nil
+	})
+	return values, err
+}
+
+func appendMedia(b []byte, m model.Media) []byte {
+	b = appendString(b, 1, m.ID)
+	b = appendString(b, 2, m.Type)
+	b = appendString(b, 3, m.MimeType)
+	b = appendVarint(b, 4, m.Size)
+	if m.AspectRatio != 0 {
+		b = protowire.AppendTag(b, 5, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(m.AspectRatio))
+	}
+	b = appendVarint(b, 6, int64(m.Width))
+	b = appendVarint(b, 7, int64(m.Height))
+	b = appendString(b, 8, m.AltText)
+	return b
+}
+
+func unmarshalMedia(b []byte) (model.Media, error) {
+	var m model.Media
+	err := decodeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		var v int64
+		switch num {
+		case 1:
+			return stringField(typ, b, &m.ID)
+		case 2:
+			return stringField(typ, b, &m.Type)
+		case 3:
+			return stringField(typ, b, &m.MimeType)
+		case 4:
+			return varintField(typ, b, &m.Size)
+		case 5:
+			if typ != protowire.Fixed64Type {
+				return 0, nil
+			}
+			bits, n := protowire.ConsumeFixed64(b)
+			m.AspectRatio = math.Float64frombits(bits)
+			return n, nil
+		case 6:
+			n, err := varintField(typ, b, &v)
+			m.Width = int(int32(v))
+			return n, err
+		case 7:
+			n, err := varintField(typ, b, &v)
+			m.Height = int(int32(v))
+			return n, err
+		case 8:
+			return stringField(typ, b, &m.AltText)
+		}
+		return 0, nil
+	})
+	return m, err
+}
+
+func appendExternal(b []byte, e model.External) []byte {
+	b = appendString(b, 1, e.URI)
+	b = appendString(b, 2, e.Title)
+	b = appendString(b, 3, e.Description)
+	return b
+}
+
+func unmarshalExternal(b []byte) (model.External, error) {
+	var e model.External
+	err := decodeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return stringField(typ, b, &e.URI)
+		case 2:
+			return stringField(typ, b, &e.Title)
+		case 3:
+			return stringField(typ, b, &e.Description)
+		}
+		return 0, nil
+	})
+	return e, err
+}
+
+// MarshalLike encodes a Like message
+func MarshalLike(l model.Like) []byte {
+	return appendLike(nil, l)
+}
+
+// UnmarshalLike decodes a Like message
+func UnmarshalLike(b []byte) (model.Like, error) {
+	var l model.Like
+	err := decodeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return stringField(typ, b, &l.AtURI)
+		case 2:
+			return stringField(typ, b, &l.AuthorDID)
+		case 3:
+			return stringField(typ, b, &l.SubjectURI)
+		case 4:
+			return stringField(typ, b, &l.CreatedAt)
+		case 5:
+			return stringField(typ, b, &l.IndexedAt)
+		}
+		return 0, nil
+	})
+	return l, err
+}
+
+func appendLike(b []byte, l model.Like) []byte {
+	b = appendString(b, 1, l.AtURI)
+	b = appendString(b, 2, l.AuthorDID)
+	b = appendString(b, 3, l.SubjectURI)
+	b = appendString(b, 4, l.CreatedAt)
+	b = appendString(b, 5, l.IndexedAt)
+	return b
+}
+
+// MarshalTombstone encodes a Tombstone message
+func MarshalTombstone(t model.Tombstone) []byte {
+	return appendTombstone(nil, t)
+}
+
+// UnmarshalTombstone decodes a Tombstone message
+func UnmarshalTombstone(b []byte) (model.Tombstone, error) {
+	var t model.Tombstone
+	err := decodeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return stringField(typ, b, &t.Kind)
+		case 2:
+			return stringField(typ, b, &t.AtURI)
+		case 3:
+			return stringField(typ, b, &t.AuthorDID)
+		case 4:
+			return stringField(typ, b, &t.SubjectURI)
+		case 5:
+			return stringField(typ, b, &t.SubjectDID)
+		case 6:
+			return stringField(typ, b, &t.DeletedAt)
+		case 7:
+			return stringField(typ, b, &t.IndexedAt)
+		}
+		return 0, nil
+	})
+	return t, err
+}
+
+func appendTombstone(b []byte, t model.Tombstone) []byte {
+	b = appendString(b, 1, t.Kind)
+	b = appendString(b, 2, t.AtURI)
+	b = appendString(b, 3, t.AuthorDID)
+	b = appendString(b, 4, t.SubjectURI)
+	b = appendString(b, 5, t.SubjectDID)
+	b = appendString(b, 6, t.DeletedAt)
+	b = appendString(b, 7, t.IndexedAt)
+	return b
+}
+
+// MarshalAccountEvent encodes an AccountEvent message
+func MarshalAccountEvent(e model.AccountEvent) []byte {
+	return appendAccountEvent(nil, e)
+}
+
+// UnmarshalAccountEvent decodes an AccountEvent message
+func UnmarshalAccountEvent(b []byte) (model.AccountEvent, error) {
+	var e model.AccountEvent
+	err := decodeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return stringField(typ, b, &e.DID)
+		case 2:
+			return stringField(typ, b, &e.Status)
+		case 3:
+			return varintField(typ, b, &e.TimeUs)
+		}
+		return 0, nil
+	})
+	return e, err
+}
+
+func appendAccountEvent(b []byte, e model.AccountEvent) []byte {
+	b = appendString(b, 1, e.DID)
+	b = appendString(b, 2, e.Status)
+	b = appendVarint(b, 3, e.TimeUs)
+	return b
+}
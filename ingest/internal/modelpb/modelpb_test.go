@@ -0,0 +1,114 @@
+package modelpb
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func testPost() model.Post {
+	return model.Post{
+		AtURI:           "at://did:plc:a/app.bsky.feed.post/1",
+		AuthorDID:       "did:plc:a",
+		Content:         "hello",
+		CreatedAt:       "2025-01-27T12:00:00Z",
+		IndexedAt:       "2025-01-27T12:00:05Z",
+		ThreadRootURI:   "at://root",
+		ThreadParentURI: "at://parent",
+		Embeddings:      map[string][]float32{"minilm": {0.25, -1.5, 3}, "empty": {}},
+		Media: []model.Media{
+			{ID: "img", Type: model.MediaImage, MimeType: "image/jpeg", Size: 1 << 40, AspectRatio: 1.5, Width: 1600, Height: -1, AltText: "sunset"},
+			{ID: "vid", Type: model.MediaVideo},
+		},
+		External:  &model.External{URI: "https://example.com", Title: "Example"},
+		LikeCount: 7,
+	}
+}
+
+func TestPost_RoundTrip(t *testing.T) {
+	post := testPost()
+	got, err := UnmarshalPost(MarshalPost(post))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, post) {
+		t.Errorf("got %+v, want %+v", got, post)
+	}
+	if !bytes.Equal(MarshalPost(post), MarshalPost(got)) {
+		t.Error("expected equal posts to encode to equal bytes")
+	}
+}
+
+func TestUnmarshalPost_SkipsUnknownAndMistypedFields(t *testing.T) {
+	b := MarshalPost(model.Post{AtURI: "at://a"})
+	b = protowire.AppendTag(b, 99, protowire.BytesType)
+	b = protowire.AppendString(b, "from a newer writer")
+	b = protowire.AppendTag(b, 3, protowire.VarintType) // content is a string
+	b = protowire.AppendVarint(b, 1)
+
+	got, err := UnmarshalPost(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.AtURI != "at://a" || got.Content != "" {
+		t.Errorf("unexpected post %+v", got)
+	}
+}
+
+func TestUnmarshal_RejectsTruncatedInput(t *testing.T) {
+	b := MarshalPost(testPost())
+	if _, err := UnmarshalPost(b[:len(b)-3]); err == nil {
+		t.Error("expected a truncated post to fail")
+	}
+}
+
+func TestRecordStream(t *testing.T) {
+	post := testPost()
+	like := model.Like{AtURI: "at://like", AuthorDID: "did:plc:b", SubjectURI: post.AtURI}
+	tombstone := model.Tombstone{Kind: model.TombstoneFollow, AtURI: "at://follow", SubjectDID: "did:plc:c"}
+	event := model.AccountEvent{DID: "did:plc:d", Status: model.AccountDeleted, TimeUs: 1737979200000000}
+	records := []Record{{Post: &post}, {Like: &like}, {Tombstone: &tombstone}, {AccountEvent: &event}}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, r := range records {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Write(Record{}); err == nil {
+		t.Error("expected an empty record to be rejected")
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	stream := buf.Bytes()
+
+	r := NewReader(bytes.NewReader(stream))
+	for i, want := range records {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatalf("record %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("record %d: got %+v, want %+v", i, got, want)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("expected io.EOF at the end of the stream, got %v", err)
+	}
+
+	r = NewReader(bytes.NewReader(stream[:len(stream)-1]))
+	var err error
+	for err == nil {
+		_, err = r.Read()
+	}
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF for a truncated stream, got %v", err)
+	}
+}
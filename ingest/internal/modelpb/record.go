@@ -0,0 +1,139 @@
+package modelpb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/greenearth/ingest/internal/model"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// maxRecordSize bounds the length prefix a Reader accepts, so a corrupt
+// stream fails instead of allocating gigabytes
+const maxRecordSize = 64 << 20
+
+// Record holds exactly one of its fields
+type Record struct {
+	Post         *model.Post
+	Like         *model.Like
+	Tombstone    *model.Tombstone
+	AccountEvent *model.AccountEvent
+}
+
+// MarshalRecord encodes a Record message
+func MarshalRecord(r Record) ([]byte, error) {
+	switch {
+	case r.Post != nil:
+		return appendMessage(nil, 1, appendPost(nil, *r.Post)), nil
+	case r.Like != nil:
+		return appendMessage(nil, 2, appendLike(nil, *r.Like)), nil
+	case r.Tombstone != nil:
+		return appendMessage(nil, 3, appendTombstone(nil, *r.Tombstone)), nil
+	case r.AccountEvent != nil:
+		return appendMessage(nil, 4, appendAccountEvent(nil, *r.AccountEvent)), nil
+	}
+	return nil, errors.New("empty record")
+}
+
+// UnmarshalRecord decodes a Record message. As with a proto3 oneof, the last
+// of several set fields wins.
+func UnmarshalRecord(b []byte) (Record, error) {
+	var r Record
+	err := decodeFields(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return messageField(typ, b, func(b []byte) error {
+				p, err := UnmarshalPost(b)
+				r = Record{Post: &p}
+				return err
+			})
+		case 2:
+			return messageField(typ, b, func(b []byte) error {
+				l, err := UnmarshalLike(b)
+				r = Record{Like: &l}
+				return err
+			})
+		case 3:
+			return messageField(typ, b, func(b []byte) error {
+				t, err := UnmarshalTombstone(b)
+				r = Record{Tombstone: &t}
+				return err
+			})
+		case 4:
+			return messageField(typ, b, func(b []byte) error {
+				e, err := UnmarshalAccountEvent(b)
+				r = Record{AccountEvent: &e}
+				return err
+			})
+		}
+		return 0, nil
+	})
+	return r, err
+}
+
+// Writer writes a stream of length-delimited Records
+type Writer struct {
+	w   *bufio.Writer
+	buf []byte
+}
+
+// NewWriter creates a Writer on w. Call Flush when done.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// Write appends r to the stream
+func (w *Writer) Write(r Record) error {
+	msg, err := MarshalRecord(r)
+	if err != nil {
+		return err
+	}
+	w.buf = protowire.AppendVarint(w.buf[:0], uint64(len(msg)))
+	if _, err := w.w.Write(w.buf); err != nil {
+		return err
+	}
+	_, err = w.w.Write(msg)
+	return err
+}
+
+// Flush writes any buffered records to the underlying writer
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+// Reader reads a stream of length-delimited Records
+type Reader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewReader creates a Reader on r
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next record, or io.EOF at the end of the stream. A stream
+// that ends inside a record returns io.ErrUnexpectedEOF.
+func (r *Reader) Read() (Record, error) {
+	size, err := binary.ReadUvarint(r.r) // io.EOF only before the first byte
+	if err != nil {
+		return Record{}, err
+	}
+	if size > maxRecordSize {
+		return Record{}, fmt.Errorf("record of %d bytes exceeds the %d byte limit", size, maxRecordSize)
+	}
+	if uint64(cap(r.buf)) < size {
+		r.buf = make([]byte, size)
+	}
+	r.buf = r.buf[:size]
+	if _, err := io.ReadFull(r.r, r.buf); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return Record{}, err
+	}
+	return UnmarshalRecord(r.buf)
+}
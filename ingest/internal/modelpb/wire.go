@@ -0,0 +1,92 @@
+package modelpb
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var errPackedLength = errors.New("packed float field length is not a multiple of 4")
+
+// decodeFields calls field for each field in b. field returns the number of
+// bytes of the value it consumed, 0 to skip the field as unknown, or a
+// negative protowire error code.
+func decodeFields(b []byte, field func(num protowire.Number, typ protowire.Type, b []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		n, err := field(num, typ, b)
+		if err != nil {
+			return fmt.Errorf("field %d: %w", num, err)
+		}
+		if n == 0 {
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("field %d: %w", num, protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+func stringField(typ protowire.Type, b []byte, dst *string) (int, error) {
+	if typ != protowire.BytesType {
+		return 0, nil
+	}
+	v, n := protowire.ConsumeString(b)
+	if n >= 0 {
+		*dst = v
+	}
+	return n, nil
+}
+
+func varintField(typ protowire.Type, b []byte, dst *int64) (int, error) {
+	if typ != protowire.VarintType {
+		return 0, nil
+	}
+	v, n := protowire.ConsumeVarint(b)
+	if n >= 0 {
+		*dst = int64(v)
+	}
+	return n, nil
+}
+
+// messageField passes the encoded message in b to decode
+func messageField(typ protowire.Type, b []byte, decode func([]byte) error) (int, error) {
+	if typ != protowire.BytesType {
+		return 0, nil
+	}
+	v, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return n, nil
+	}
+	return n, decode(v)
+}
+
+// appendString appends a string field, omitting the proto3 default
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+// appendVarint appends an integer field, omitting the proto3 default
+func appendVarint(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
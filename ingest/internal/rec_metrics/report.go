@@ -0,0 +1,82 @@
+package rec_metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/parquet-go/parquet-go"
+)
+
+// DefaultMetricsIndex is the alias metrics are written to
+const DefaultMetricsIndex = "rec_metrics"
+
+// WriteIndex indexes rows into index, replacing the rows of an earlier
+// evaluation of the same period, arm, prompt version, and window
+func WriteIndex(ctx context.Context, client *elasticsearch.Client, index string, rows []ArmMetrics, dryRun bool, logger *common.IngestLogger) error {
+	return common.BulkIndexWithIDs(ctx, client, index, rows, ArmMetrics.ID, "slate metrics", "es.bulk_index_rec_metrics", dryRun, logger)
+}
+
+// EncodeParquet returns rows as a parquet file
+func EncodeParquet(rows []ArmMetrics) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := parquet.NewGenericWriter[ArmMetrics](&buf)
+	if _, err := writer.Write(rows); err != nil {
+		return nil, fmt.Errorf("failed to write parquet data: %w", err)
+	}
+	// Close writes the footer
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close parquet writer: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteParquet writes rows as a parquet report to a local path or GCS
+// (gs://bucket/object)
+func WriteParquet(ctx context.Context, path string, rows []ArmMetrics) error {
+	data, err := EncodeParquet(rows)
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(path, "gs://") {
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return fmt.Errorf("failed to write metrics report: %w", err)
+		}
+		return nil
+	}
+
+	bucket, object, err := parseGCSPath(path)
+	if err != nil {
+		return err
+	}
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	writer := client.Bucket(bucket).Object(object).NewWriter(ctx)
+	writer.ContentType = "application/vnd.apache.parquet"
+	if _, err := writer.Write(data); err != nil {
+		_ = writer.Close()
+		return fmt.Errorf("failed to write metrics report to GCS: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to finalize metrics report in GCS: %w", err)
+	}
+	return nil
+}
+
+func parseGCSPath(path string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "gs://"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid GCS path format: %s (expected gs://bucket/object)", path)
+	}
+	return parts[0], parts[1], nil
+}
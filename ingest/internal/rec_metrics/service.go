@@ -0,0 +1,425 @@
+// Package rec_metrics evaluates served recommendation slates offline. It
+// joins the impressions the recommender indexes (rec_impressions) with the
+// likes and replies the viewers made on those posts within a window after
+// seeing them, and computes engagement rates per experiment arm and prompt
+// version.
+package rec_metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/elastic/go-elasticsearch/v9/esapi"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// Config holds configuration for the evaluator
+type Config struct {
+	ImpressionsIndex string        // Impressions alias (default rec_impressions)
+	LikesIndex       string        // Likes alias (default likes)
+	RepliesIndex     string        // Replies alias (default replies)
+	Window           time.Duration // How long after an impression a like or reply counts (default 1h)
+	PageSize         int           // Impressions read per scroll page, and joined per lookup
+	KeepAlive        time.Duration // Scroll keep-alive between pages
+}
+
+// ArmMetrics are the engagement metrics of one experiment arm and prompt
+// version over an evaluation period. An impression is liked or replied to
+// when the viewer liked or replied to the post within the window after it
+// was served; engaged when either. CTR is the engaged share of impressions,
+// as likes and replies are the only interactions the indices record.
+type ArmMetrics struct {
+	Environment   string  `json:"environment" parquet:"environment"`
+	PeriodStart   string  `json:"period_start" parquet:"period_start"`
+	PeriodEnd     string  `json:"period_end" parquet:"period_end"`
+	ExperimentArm string  `json:"experiment_arm" parquet:"experiment_arm"`
+	PromptVersion string  `json:"prompt_version" parquet:"prompt_version"`
+	WindowSeconds int64   `json:"window_seconds" parquet:"window_seconds"`
+	Impressions   int64   `json:"impressions" parquet:"impressions"`
+	Users         int64   `json:"users" parquet:"users"`
+	Liked         int64   `json:"liked" parquet:"liked"`
+	Replied       int64   `json:"replied" parquet:"replied"`
+	Engaged       int64   `json:"engaged" parquet:"engaged"`
+	LikeRate      float64 `json:"like_rate" parquet:"like_rate"`
+	ReplyRate     float64 `json:"reply_rate" parquet:"reply_rate"`
+	CTR           float64 `json:"ctr" parquet:"ctr"`
+	ComputedAt    string  `json:"computed_at" parquet:"computed_at"`
+}
+
+// ID returns the metrics' _id in the metrics index, so evaluating a period
+// again overwrites its results
+func (m ArmMetrics) ID() string {
+	return fmt.Sprintf("%s|%s|%s|%s|%s|%d", m.Environment, m.PeriodStart, m.PeriodEnd, m.ExperimentArm, m.PromptVersion, m.WindowSeconds)
+}
+
+// Service computes slate metrics
+type Service struct {
+	client *elasticsearch.Client
+	config Config
+	logger *common.IngestLogger
+}
+
+// NewService creates a new evaluator
+func NewService(client *elasticsearch.Client, config Config, logger *common.IngestLogger) *Service {
+	if config.ImpressionsIndex == "" {
+		config.ImpressionsIndex = "rec_impressions"
+	}
+	if config.LikesIndex == "" {
+		config.LikesIndex = "likes"
+	}
+	if config.RepliesIndex == "" {
+		config.RepliesIndex = "replies"
+	}
+	if config.Window <= 0 {
+		config.Window = time.Hour
+	}
+	if config.PageSize <= 0 {
+		config.PageSize = 1000
+	}
+	if config.KeepAlive <= 0 {
+		config.KeepAlive = 5 * time.Minute
+	}
+	return &Service{client: client, config: config, logger: logger}
+}
+
+// Window returns how long after an impression engagement counts
+func (s *Service) Window() time.Duration {
+	return s.config.Window
+}
+
+// impression is the subset of an impression document the join reads
+type impression struct {
+	UserDID       string `json:"user_did"`
+	AtURI         string `json:"at_uri"`
+	ExperimentArm string `json:"experiment_arm"`
+	PromptVersion string `json:"prompt_version"`
+	ServedAt      string `json:"served_at"`
+
+	servedAt time.Time
+}
+
+// engagement is a like or reply: who made it, on which post, and when
+type engagement struct {
+	AuthorDID        string `json:"author_did"`
+	SubjectURI       string `json:"subject_uri"`        // Likes
+	ThreadParentPost string `json:"thread_parent_post"` // Replies
+	CreatedAt        string `json:"created_at"`
+}
+
+// armKey identifies the group an impression is counted in
+type armKey struct {
+	arm, prompt string
+}
+
+// armAccumulator counts one group's impressions
+type armAccumulator struct {
+	impressions, liked, replied, engaged int64
+	users                                map[string]struct{}
+}
+
+// Evaluate computes metrics for the impressions served in [from, to), one
+// row per experiment arm and prompt version. to should be at least the
+// window in the past, or engagement still to come is missed. Impressions
+// with an unparseable served_at are skipped.
+func (s *Service) Evaluate(ctx context.Context, environment string, from, to time.Time) ([]ArmMetrics, error) {
+	from, to = from.UTC(), to.UTC()
+	if !to.After(from) {
+		return nil, fmt.Errorf("evaluation range %s to %s is empty", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	start := time.Now()
+
+	groups := make(map[armKey]*armAccumulator)
+	query := map[string]interface{}{
+		"range": map[string]interface{}{
+			"served_at": map[string]interface{}{
+				"gte": from.Format(time.RFC3339Nano),
+				"lt":  to.Format(time.RFC3339Nano),
+			},
+		},
+	}
+	fields := []string{"user_did", "at_uri", "experiment_arm", "prompt_version", "served_at"}
+	var total int64
+	err := s.scroll(ctx, s.config.ImpressionsIndex, query, fields, func(hits []json.RawMessage) error {
+		page := make([]impression, 0, len(hits))
+		for _, raw := range hits {
+			var imp impression
+			if err := json.Unmarshal(raw, &imp); err != nil {
+				return fmt.Errorf("failed to parse impression: %w", err)
+			}
+			servedAt, err := time.Parse(time.RFC3339Nano, imp.ServedAt)
+			if err != nil || imp.UserDID == "" || imp.AtURI == "" {
+				s.logger.Error("Skipping impression of %q for %q served at %q", imp.AtURI, imp.UserDID, imp.ServedAt)
+				continue
+			}
+			imp.servedAt = servedAt
+			page = append(page, imp)
+		}
+		total += int64(len(page))
+		return s.join(ctx, page, groups)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Metric("rec_metrics.evaluate.duration_ms", float64(time.Since(start).Milliseconds()))
+	s.logger.Metric("rec_metrics.impressions_count", float64(total))
+	s.logger.Info("Evaluated %d impressions served between %s and %s", total, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	return s.rows(groups, environment, from, to), nil
+}
+
+// join looks up the likes and replies the viewers of page made on the posts
+// they were served, and counts each impression in its group
+func (s *Service) join(ctx context.Context, page []impression, groups map[armKey]*armAccumulator) error {
+	if len(page) == 0 {
+		return nil
+	}
+
+	users := make(map[string]struct{})
+	posts := make(map[string]struct{})
+	earliest, latest := page[0].servedAt, page[0].servedAt
+	for _, imp := range page {
+		users[imp.UserDID] = struct{}{}
+		posts[imp.AtURI] = struct{}{}
+		if imp.servedAt.Before(earliest) {
+			earliest = imp.servedAt
+		}
+		if imp.servedAt.After(latest) {
+			latest = imp.servedAt
+		}
+	}
+	latest = latest.Add(s.config.Window)
+
+	likes, err := s.engagements(ctx, s.config.LikesIndex, "subject_uri", users, posts, earliest, latest)
+	if err != nil {
+		return fmt.Errorf("failed to look up likes: %w", err)
+	}
+	replies, err := s.engagements(ctx, s.config.RepliesIndex, "thread_parent_post", users, posts, earliest, latest)
+	if err != nil {
+		return fmt.Errorf("failed to look up replies: %w", err)
+	}
+
+	for _, imp := range page {
+		key := armKey{imp.ExperimentArm, imp.PromptVersion}
+		acc, ok := groups[key]
+		if !ok {
+			acc = &armAccumulator{users: make(map[string]struct{})}
+			groups[key] = acc
+		}
+		acc.impressions++
+		acc.users[imp.UserDID] = struct{}{}
+
+		pair := imp.UserDID + "\x00" + imp.AtURI
+		liked := s.within(likes[pair], imp.servedAt)
+		replied := s.within(replies[pair], imp.servedAt)
+		if liked {
+			acc.liked++
+		}
+		if replied {
+			acc.replied++
+		}
+		if liked || replied {
+			acc.engaged++
+		}
+	}
+	return nil
+}
+
+// within reports whether any of times falls in the window after servedAt
+func (s *Service) within(times []time.Time, servedAt time.Time) bool {
+	for _, t := range times {
+		if !t.Before(servedAt) && t.Sub(servedAt) <= s.config.Window {
+			return true
+		}
+	}
+	return false
+}
+
+// engagements returns when each of users liked or replied to each of posts
+// between from and to, keyed by user and post. postField is the field of
+// index naming the post engaged with.
+func (s *Service) engagements(ctx context.Context, index, postField string, users, posts map[string]struct{}, from, to time.Time) (map[string][]time.Time, error) {
+	query := map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": []interface{}{
+				map[string]interface{}{"terms": map[string]interface{}{"author_did": keys(users)}},
+				map[string]interface{}{"terms": map[string]interface{}{postField: keys(posts)}},
+				map[string]interface{}{"range": map[string]interface{}{
+					"created_at": map[string]interface{}{
+						"gte": from.Format(time.RFC3339Nano),
+						"lte": to.Format(time.RFC3339Nano),
+					},
+				}},
+			},
+		},
+	}
+
+	result := make(map[string][]time.Time)
+	err := s.scroll(ctx, index, query, []string{"author_did", postField, "created_at"}, func(hits []json.RawMessage) error {
+		for _, raw := range hits {
+			var e engagement
+			if err := json.Unmarshal(raw, &e); err != nil {
+				return fmt.Errorf("failed to parse %s document: %w", index, err)
+			}
+			createdAt, err := time.Parse(time.RFC3339Nano, e.CreatedAt)
+			if err != nil {
+				continue
+			}
+			post := e.SubjectURI
+			if post == "" {
+				post = e.ThreadParentPost
+			}
+			pair := e.AuthorDID + "\x00" + post
+			result[pair] = append(result[pair], createdAt)
+		}
+		return nil
+	})
+	return result, err
+}
+
+// rows turns the groups into metrics, sorted by experiment arm and prompt
+// version
+func (s *Service) rows(groups map[armKey]*armAccumulator, environment string, from, to time.Time) []ArmMetrics {
+	computedAt := time.Now().UTC().Format(time.RFC3339)
+	rows := make([]ArmMetrics, 0, len(groups))
+	for key, acc := range groups {
+		row := ArmMetrics{
+			Environment:   environment,
+			PeriodStart:   from.Format(time.RFC3339),
+			PeriodEnd:     to.Format(time.RFC3339),
+			ExperimentArm: key.arm,
+			PromptVersion: key.prompt,
+			WindowSeconds: int64(s.config.Window.Seconds()),
+			Impressions:   acc.impressions,
+			Users:         int64(len(acc.users)),
+			Liked:         acc.liked,
+			Replied:       acc.replied,
+			Engaged:       acc.engaged,
+			ComputedAt:    computedAt,
+		}
+		if acc.impressions > 0 {
+			row.LikeRate = float64(acc.liked) / float64(acc.impressions)
+			row.ReplyRate = float64(acc.replied) / float64(acc.impressions)
+			row.CTR = float64(acc.engaged) / float64(acc.impressions)
+		}
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].ExperimentArm != rows[j].ExperimentArm {
+			return rows[i].ExperimentArm < rows[j].ExperimentArm
+		}
+		return rows[i].PromptVersion < rows[j].PromptVersion
+	})
+	return rows
+}
+
+func keys(set map[string]struct{}) []string {
+	result := make([]string, 0, len(set))
+	for k := range set {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+	return result
+}
+
+type scrollPage struct {
+	ScrollID string `json:"_scroll_id"`
+	Hits     struct {
+		Hits []struct {
+			Source json.RawMessage `json:"_source"`
+		} `json:"hits"`
+	} `json:"hits"`
+}
+
+// scroll calls fn with the _source of each page of documents of index that
+// match query, until every match has been read
+func (s *Service) scroll(ctx context.Context, index string, query map[string]interface{}, fields []string, fn func([]json.RawMessage) error) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"query":   query,
+		"_source": fields,
+		"size":    s.config.PageSize,
+		"sort":    []string{"_doc"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	res, err := s.client.Search(
+		s.client.Search.WithContext(ctx),
+		s.client.Search.WithIndex(index),
+		s.client.Search.WithBody(bytes.NewReader(body)),
+		s.client.Search.WithScroll(s.config.KeepAlive),
+		s.client.Search.WithIgnoreUnavailable(true),
+	)
+	if err != nil {
+		return fmt.Errorf("search of %s failed: %w", index, err)
+	}
+	page, err := s.decodePage(res)
+	if err != nil {
+		return fmt.Errorf("search of %s: %w", index, err)
+	}
+
+	scrollID := page.ScrollID
+	defer func() {
+		if scrollID == "" {
+			return
+		}
+		res, err := s.client.ClearScroll(s.client.ClearScroll.WithScrollID(scrollID))
+		if err != nil {
+			s.logger.Error("Failed to clear scroll on %s: %v", index, err)
+			return
+		}
+		_ = res.Body.Close()
+	}()
+
+	for len(page.Hits.Hits) > 0 {
+		sources := make([]json.RawMessage, len(page.Hits.Hits))
+		for i, hit := range page.Hits.Hits {
+			sources[i] = hit.Source
+		}
+		if err := fn(sources); err != nil {
+			return err
+		}
+		if len(page.Hits.Hits) < s.config.PageSize {
+			return nil
+		}
+
+		res, err := s.client.Scroll(
+			s.client.Scroll.WithContext(ctx),
+			s.client.Scroll.WithScrollID(scrollID),
+			s.client.Scroll.WithScroll(s.config.KeepAlive),
+		)
+		if err != nil {
+			return fmt.Errorf("scroll of %s failed: %w", index, err)
+		}
+		page, err = s.decodePage(res)
+		if err != nil {
+			return fmt.Errorf("scroll of %s: %w", index, err)
+		}
+		if page.ScrollID != "" {
+			scrollID = page.ScrollID
+		}
+	}
+	return nil
+}
+
+// decodePage reads and closes a search or scroll response
+func (s *Service) decodePage(res *esapi.Response) (*scrollPage, error) {
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			s.logger.Error("Failed to close search response body: %v", err)
+		}
+	}()
+	if res.IsError() {
+		return nil, fmt.Errorf("returned error: %s", res.String())
+	}
+	var page scrollPage
+	if err := json.NewDecoder(res.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return &page, nil
+}
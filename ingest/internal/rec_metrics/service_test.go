@@ -0,0 +1,113 @@
+package rec_metrics
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+	"github.com/parquet-go/parquet-go"
+)
+
+const (
+	postA = "at://did:plc:author/app.bsky.feed.post/a"
+	postB = "at://did:plc:author/app.bsky.feed.post/b"
+)
+
+func putImpression(es *estest.Server, user, post, arm, prompt, servedAt string) {
+	es.Put("rec_impressions", user+"|"+post+"|"+servedAt, map[string]interface{}{
+		"user_did": user, "at_uri": post, "experiment_arm": arm, "prompt_version": prompt, "served_at": servedAt,
+	})
+}
+
+func TestEvaluate_JoinsEngagementWithinWindow(t *testing.T) {
+	es := estest.New(t)
+	putImpression(es, "did:plc:u1", postA, "control", "v1", "2026-10-15T10:00:00Z")
+	putImpression(es, "did:plc:u1", postB, "control", "v1", "2026-10-15T10:00:00Z")
+	putImpression(es, "did:plc:u2", postA, "control", "v1", "2026-10-15T11:00:00Z")
+	putImpression(es, "did:plc:u3", postA, "treatment", "v2", "2026-10-15T12:00:00Z")
+	putImpression(es, "did:plc:u3", postB, "treatment", "v2", "2026-10-16T12:00:00Z") // After the period
+
+	// u1 liked A 10 minutes after seeing it and replied to B
+	es.Put("likes", "at://did:plc:u1/app.bsky.feed.like/1", map[string]interface{}{"author_did": "did:plc:u1", "subject_uri": postA, "created_at": "2026-10-15T10:10:00Z"})
+	es.Put("replies", "at://did:plc:u1/app.bsky.feed.post/r", map[string]interface{}{"author_did": "did:plc:u1", "thread_parent_post": postB, "created_at": "2026-10-15T10:30:00Z"})
+	// u2 liked A only after the window
+	es.Put("likes", "at://did:plc:u2/app.bsky.feed.like/1", map[string]interface{}{"author_did": "did:plc:u2", "subject_uri": postA, "created_at": "2026-10-15T13:00:00Z"})
+	// u3 liked A before it was served
+	es.Put("likes", "at://did:plc:u3/app.bsky.feed.like/1", map[string]interface{}{"author_did": "did:plc:u3", "subject_uri": postA, "created_at": "2026-10-15T11:59:00Z"})
+
+	service := NewService(es.Client, Config{PageSize: 2}, common.NewLogger(false))
+	from := time.Date(2026, 10, 15, 0, 0, 0, 0, time.UTC)
+	rows, err := service.Evaluate(context.Background(), "test", from, from.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected a row per arm, got %+v", rows)
+	}
+
+	control := rows[0]
+	if control.ExperimentArm != "control" || control.PromptVersion != "v1" {
+		t.Fatalf("expected control first, got %+v", control)
+	}
+	if control.Impressions != 3 || control.Users != 2 || control.Liked != 1 || control.Replied != 1 || control.Engaged != 2 {
+		t.Errorf("unexpected control counts %+v", control)
+	}
+	if control.CTR != 2.0/3 || control.LikeRate != 1.0/3 {
+		t.Errorf("unexpected control rates %+v", control)
+	}
+
+	treatment := rows[1]
+	if treatment.Impressions != 1 || treatment.Engaged != 0 || treatment.CTR != 0 {
+		t.Errorf("unexpected treatment row %+v", treatment)
+	}
+	if treatment.WindowSeconds != 3600 || treatment.PeriodStart != "2026-10-15T00:00:00Z" {
+		t.Errorf("unexpected treatment period %+v", treatment)
+	}
+
+	if len(es.Calls(estest.APIScroll)) == 0 {
+		t.Error("expected impressions read over more than one page")
+	}
+}
+
+func TestEvaluate_EmptyRange(t *testing.T) {
+	service := NewService(nil, Config{}, common.NewLogger(false))
+	now := time.Now()
+	if _, err := service.Evaluate(context.Background(), "test", now, now); err == nil {
+		t.Error("expected an error for an empty range")
+	}
+}
+
+func TestWriteIndexAndParquet(t *testing.T) {
+	es := estest.New(t)
+	rows := []ArmMetrics{
+		{Environment: "test", PeriodStart: "2026-10-15T00:00:00Z", PeriodEnd: "2026-10-16T00:00:00Z", ExperimentArm: "control", WindowSeconds: 3600, Impressions: 4, Engaged: 1, CTR: 0.25},
+		{Environment: "test", PeriodStart: "2026-10-15T00:00:00Z", PeriodEnd: "2026-10-16T00:00:00Z", ExperimentArm: "treatment", WindowSeconds: 3600, Impressions: 2},
+	}
+
+	for range 2 {
+		if err := WriteIndex(context.Background(), es.Client, DefaultMetricsIndex, rows, false, common.NewLogger(false)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if n := es.Len(DefaultMetricsIndex); n != 2 {
+		t.Errorf("expected re-evaluating a period to replace its rows, got %d documents", n)
+	}
+	if doc, ok := es.Get(DefaultMetricsIndex, rows[0].ID()); !ok || doc["ctr"] != 0.25 {
+		t.Errorf("unexpected metrics document %v", doc)
+	}
+
+	data, err := EncodeParquet(rows)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	read, err := parquet.Read[ArmMetrics](bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("failed to read parquet report: %v", err)
+	}
+	if len(read) != 2 || read[0] != rows[0] {
+		t.Errorf("expected the rows back from the report, got %+v", read)
+	}
+}
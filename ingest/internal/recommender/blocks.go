@@ -0,0 +1,380 @@
+package recommender
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/jetstream_ingest"
+)
+
+const (
+	// blockCacheMaxUsers bounds how many users' blocks are held; past it,
+	// blocks are read from Elasticsearch on every request
+	blockCacheMaxUsers = 100000
+	// maxBlocksPerUser bounds the blocks loaded for one user, newest first
+	maxBlocksPerUser = 10000
+	// blockCollection is the Jetstream collection block records are in
+	blockCollection = "app.bsky.graph.block"
+	// muteIdleTTL is how long a user's mutes are kept without the user
+	// being served or the mutes being set
+	muteIdleTTL = 24 * time.Hour
+)
+
+// blockEntry is a user's blocks as last read from Elasticsearch
+type blockEntry struct {
+	others    map[string]string // Block at_uri -> the other account's DID
+	expiresAt time.Time
+}
+
+// muteEntry is the accounts a user muted
+type muteEntry struct {
+	dids   map[string]bool
+	usedAt time.Time // Last set or read; idle entries are swept
+}
+
+// observedBlock is a block seen on the stream
+type observedBlock struct {
+	atURI      string
+	authorDID  string
+	subjectDID string
+	seenAt     time.Time
+}
+
+// BlockCache holds, per user, the accounts whose content the user must not
+// see: accounts the user blocked, accounts that blocked the user, and
+// accounts the user muted. Blocks are read from the blocks index on a miss
+// and kept for the TTL. Block events from Jetstream (see RunBlockStream)
+// invalidate the entries of both accounts and apply at once, before
+// jetstream_ingest has written them; they are remembered for the TTL, so an
+// entry read before or during an event is corrected until it expires.
+//
+// Mutes are private and never reach Jetstream, so the caller records them
+// from the user's session (see SetMutes). They are kept while the user is
+// served, and swept after muteIdleTTL without. A nil BlockCache hides
+// nothing.
+type BlockCache struct {
+	client *elasticsearch.Client
+	index  string
+	ttl    time.Duration
+	logger *common.IngestLogger
+
+	mu        sync.Mutex
+	entries   map[string]blockEntry
+	blocks    map[string][]observedBlock // Recent blocks by author and subject DID
+	unblocked map[string]time.Time       // Recently deleted block at_uris
+	mutes     map[string]muteEntry
+	now       func() time.Time
+}
+
+// NewBlockCache creates a cache reading blocks from index and keeping them
+// for ttl
+func NewBlockCache(client *elasticsearch.Client, index string, ttl time.Duration, logger *common.IngestLogger) *BlockCache {
+	if ttl <= 0 {
+		ttl = 5 * time.Minute
+	}
+	return &BlockCache{
+		client:    client,
+		index:     index,
+		ttl:       ttl,
+		logger:    logger,
+		entries:   make(map[string]blockEntry),
+		blocks:    make(map[string][]observedBlock),
+		unblocked: make(map[string]time.Time),
+		mutes:     make(map[string]muteEntry),
+		now:       time.Now,
+	}
+}
+
+// Observe applies a block create or delete from Jetstream; other messages
+// are ignored
+func (c *BlockCache) Observe(msg common.JetstreamMessage) {
+	if c == nil || msg.GetAtURI() == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case msg.IsBlock():
+		if msg.GetSubjectDID() == "" {
+			return
+		}
+		block := observedBlock{atURI: msg.GetAtURI(), authorDID: msg.GetAuthorDID(), subjectDID: msg.GetSubjectDID(), seenAt: c.now()}
+		c.blocks[block.authorDID] = append(c.blocks[block.authorDID], block)
+		c.blocks[block.subjectDID] = append(c.blocks[block.subjectDID], block)
+		delete(c.entries, block.authorDID)
+		delete(c.entries, block.subjectDID)
+		c.logger.Metric("recommender.blocks.block_observed_count", 1)
+	case msg.IsBlockDelete():
+		// Deletes carry no subject; it is known only if the author's block
+		// is held
+		author := msg.GetAuthorDID()
+		if subject := c.subjectLocked(author, msg.GetAtURI()); subject != "" {
+			delete(c.entries, subject)
+		}
+		c.unblocked[msg.GetAtURI()] = c.now()
+		delete(c.entries, author)
+		c.logger.Metric("recommender.blocks.unblock_observed_count", 1)
+	}
+}
+
+// subjectLocked returns the account blocked by the author's block atURI, if
+// the cache holds it
+func (c *BlockCache) subjectLocked(authorDID, atURI string) string {
+	if subject, ok := c.entries[authorDID].others[atURI]; ok {
+		return subject
+	}
+	for _, block := range c.blocks[authorDID] {
+		if block.atURI == atURI {
+			return block.subjectDID
+		}
+	}
+	return ""
+}
+
+// SetMutes replaces the accounts userDID has muted
+func (c *BlockCache) SetMutes(userDID string, mutedDIDs []string) {
+	if c == nil {
+		return
+	}
+	muted := make(map[string]bool, len(mutedDIDs))
+	for _, did := range mutedDIDs {
+		muted[did] = true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(muted) == 0 {
+		delete(c.mutes, userDID)
+		return
+	}
+	c.mutes[userDID] = muteEntry{dids: muted, usedAt: c.now()}
+}
+
+// Mute records that userDID muted mutedDID
+func (c *BlockCache) Mute(userDID, mutedDID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.mutes[userDID]
+	if entry.dids == nil {
+		entry.dids = make(map[string]bool)
+	}
+	entry.dids[mutedDID] = true
+	entry.usedAt = c.now()
+	c.mutes[userDID] = entry
+}
+
+// Unmute records that userDID unmuted mutedDID
+func (c *BlockCache) Unmute(userDID, mutedDID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.mutes[userDID]
+	if !ok {
+		return
+	}
+	delete(entry.dids, mutedDID)
+	if len(entry.dids) == 0 {
+		delete(c.mutes, userDID)
+		return
+	}
+	entry.usedAt = c.now()
+	c.mutes[userDID] = entry
+}
+
+// Hidden returns the DIDs whose content userDID must not see. When the
+// blocks index cannot be read, the blocks and mutes the cache has observed
+// are returned with the error.
+func (c *BlockCache) Hidden(ctx context.Context, userDID string) (map[string]bool, error) {
+	if c == nil {
+		return nil, nil
+	}
+	entry, err := c.entry(ctx, userDID)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	hidden := make(map[string]bool)
+	for atURI, other := range entry.others {
+		if _, gone := c.unblocked[atURI]; !gone {
+			hidden[other] = true
+		}
+	}
+	for _, block := range c.blocks[userDID] {
+		if _, gone := c.unblocked[block.atURI]; gone {
+			continue
+		}
+		if block.authorDID == userDID {
+			hidden[block.subjectDID] = true
+		} else {
+			hidden[block.authorDID] = true
+		}
+	}
+	if mutes, ok := c.mutes[userDID]; ok {
+		mutes.usedAt = c.now()
+		c.mutes[userDID] = mutes
+		for did := range mutes.dids {
+			hidden[did] = true
+		}
+	}
+	return hidden, err
+}
+
+// entry returns the user's cached blocks, reading them from the blocks
+// index when missing or expired
+func (c *BlockCache) entry(ctx context.Context, userDID string) (blockEntry, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[userDID]
+	if ok && c.now().After(entry.expiresAt) {
+		delete(c.entries, userDID)
+		ok = false
+	}
+	loadedAt := c.now()
+	c.mu.Unlock()
+	if ok {
+		c.logger.Metric("recommender.blocks.cache_hit_count", 1)
+		return entry, nil
+	}
+	c.logger.Metric("recommender.blocks.cache_miss_count", 1)
+
+	docs, err := common.FetchBlocks(ctx, c.client, c.logger, c.index, userDID, maxBlocksPerUser)
+	if err != nil {
+		c.logger.Metric("recommender.blocks.lookup_error_count", 1)
+		return blockEntry{}, fmt.Errorf("failed to read blocks of %s: %w", userDID, err)
+	}
+	if len(docs) == maxBlocksPerUser {
+		c.logger.Metric("recommender.blocks.truncated_count", 1)
+	}
+	entry = blockEntry{others: make(map[string]string, len(docs)), expiresAt: loadedAt.Add(c.ttl)}
+	for _, doc := range docs {
+		if doc.AuthorDID == userDID {
+			entry.others[doc.AtURI] = doc.SubjectDID
+		} else {
+			entry.others[doc.AtURI] = doc.AuthorDID
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) < blockCacheMaxUsers {
+		c.entries[userDID] = entry
+	}
+	return entry, nil
+}
+
+// Filter drops candidates by accounts hidden from userDID. If the blocks
+// index cannot be read, only the blocks and mutes observed by the cache are
+// enforced.
+func (c *BlockCache) Filter(ctx context.Context, userDID string, candidates []Candidate) []Candidate {
+	if c == nil || len(candidates) == 0 {
+		return candidates
+	}
+	hidden, err := c.Hidden(ctx, userDID)
+	if err != nil {
+		c.logger.Error("Enforcing observed blocks only: %v", err)
+	}
+	if len(hidden) == 0 {
+		return candidates
+	}
+
+	kept := make([]Candidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		if !hidden[candidateAuthor(candidate)] {
+			kept = append(kept, candidate)
+		}
+	}
+	if dropped := len(candidates) - len(kept); dropped > 0 {
+		c.logger.Metric("recommender.blocks.dropped_count", float64(dropped))
+	}
+	return kept
+}
+
+// Sweep removes expired entries, observed events older than the TTL, and
+// mutes idle for muteIdleTTL, and returns how many entries were removed
+func (c *BlockCache) Sweep() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	removed := 0
+	for userDID, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			delete(c.entries, userDID)
+			removed++
+		}
+	}
+	cutoff := now.Add(-c.ttl)
+	for did, blocks := range c.blocks {
+		recent := blocks[:0]
+		for _, block := range blocks {
+			if block.seenAt.After(cutoff) {
+				recent = append(recent, block)
+			}
+		}
+		if len(recent) == 0 {
+			delete(c.blocks, did)
+		} else {
+			c.blocks[did] = recent
+		}
+	}
+	for atURI, seenAt := range c.unblocked {
+		if !seenAt.After(cutoff) {
+			delete(c.unblocked, atURI)
+		}
+	}
+	idleCutoff := now.Add(-muteIdleTTL)
+	for userDID, mutes := range c.mutes {
+		if !mutes.usedAt.After(idleCutoff) {
+			delete(c.mutes, userDID)
+		}
+	}
+	return removed
+}
+
+// blockStreamURL restricts a Jetstream subscribe URL to block records
+func blockStreamURL(jetstreamURL string) (string, error) {
+	return jetstream_ingest.SubscribeURL(jetstreamURL, []string{blockCollection}, nil)
+}
+
+// RunBlockStream subscribes to block records on Jetstream and applies them
+// to cache, sweeping it every minute. Blocks made while the stream is
+// reconnecting reach the cache from the blocks index once the affected
+// entries expire. Blocks until ctx is done.
+func RunBlockStream(ctx context.Context, cache *BlockCache, jetstreamURL string, logger *common.IngestLogger) error {
+	streamURL, err := blockStreamURL(jetstreamURL)
+	if err != nil {
+		return err
+	}
+	client := jetstream_ingest.NewClient(streamURL, logger)
+	if err := client.Start(ctx); err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	messages := client.GetMessageChannel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			cache.Sweep()
+		case raw, ok := <-messages:
+			if !ok {
+				return nil
+			}
+			cache.Observe(common.NewJetstreamMessage(raw, logger))
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package recommender
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func blockEvent(author, rkey, subject string) common.JetstreamMessage {
+	return common.NewJetstreamMessage(`{"did":"`+author+`","time_us":1,"kind":"commit","commit":{"operation":"create","collection":"app.bsky.graph.block","rkey":"`+rkey+`","record":{"subject":"`+subject+`","createdAt":"2026-10-16T12:00:00Z"}}}`, common.NewLogger(false))
+}
+
+func unblockEvent(author, rkey string) common.JetstreamMessage {
+	return common.NewJetstreamMessage(`{"did":"`+author+`","time_us":2,"kind":"commit","commit":{"operation":"delete","collection":"app.bsky.graph.block","rkey":"`+rkey+`"}}`, common.NewLogger(false))
+}
+
+func authorCandidates(authors ...string) []Candidate {
+	candidates := make([]Candidate, len(authors))
+	for i, author := range authors {
+		candidates[i] = Candidate{AtURI: "at://" + author + "/app.bsky.feed.post/1"}
+	}
+	return candidates
+}
+
+func TestBlockCache_Filter(t *testing.T) {
+	es := estest.New(t)
+	es.Put(common.BlocksIndex, "at://did:plc:viewer/app.bsky.graph.block/1", map[string]interface{}{
+		"at_uri": "at://did:plc:viewer/app.bsky.graph.block/1", "author_did": "did:plc:viewer", "subject_did": "did:plc:blocked", "created_at": "2026-10-01T00:00:00Z",
+	})
+	es.Put(common.BlocksIndex, "at://did:plc:hater/app.bsky.graph.block/1", map[string]interface{}{
+		"at_uri": "at://did:plc:hater/app.bsky.graph.block/1", "author_did": "did:plc:hater", "subject_did": "did:plc:viewer", "created_at": "2026-10-02T00:00:00Z",
+	})
+	cache := NewBlockCache(es.Client, common.BlocksIndex, time.Minute, common.NewLogger(false))
+	cache.Mute("did:plc:viewer", "did:plc:muted")
+
+	candidates := authorCandidates("did:plc:blocked", "did:plc:hater", "did:plc:muted", "did:plc:fine")
+	kept := cache.Filter(context.Background(), "did:plc:viewer", candidates)
+	if len(kept) != 1 || candidateAuthor(kept[0]) != "did:plc:fine" {
+		t.Errorf("expected blocked, blocking and muted authors dropped, got %+v", kept)
+	}
+
+	// Cached: the index is read once
+	cache.Filter(context.Background(), "did:plc:viewer", candidates)
+	if calls := es.Calls(estest.APISearch); len(calls) != 1 {
+		t.Errorf("expected the blocks read once, got %d searches", len(calls))
+	}
+
+	cache.Unmute("did:plc:viewer", "did:plc:muted")
+	if kept := cache.Filter(context.Background(), "did:plc:viewer", candidates); len(kept) != 2 {
+		t.Errorf("expected the unmuted author served again, got %+v", kept)
+	}
+}
+
+func TestBlockCache_ObserveBeforeIndexed(t *testing.T) {
+	es := estest.New(t)
+	cache := NewBlockCache(es.Client, common.BlocksIndex, time.Minute, common.NewLogger(false))
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	candidates := authorCandidates("did:plc:other")
+
+	if kept := cache.Filter(context.Background(), "did:plc:viewer", candidates); len(kept) != 1 {
+		t.Fatalf("expected no blocks yet, got %+v", kept)
+	}
+
+	// The block applies at once, to both accounts, though the index lacks it
+	cache.Observe(blockEvent("did:plc:viewer", "b1", "did:plc:other"))
+	if kept := cache.Filter(context.Background(), "did:plc:viewer", candidates); len(kept) != 0 {
+		t.Errorf("expected the observed block enforced, got %+v", kept)
+	}
+	if kept := cache.Filter(context.Background(), "did:plc:other", authorCandidates("did:plc:viewer")); len(kept) != 0 {
+		t.Errorf("expected the block enforced for the blocked account too, got %+v", kept)
+	}
+
+	// Once indexed and then deleted, the unblock wins over the stale index
+	es.Put(common.BlocksIndex, "at://did:plc:viewer/app.bsky.graph.block/b1", map[string]interface{}{
+		"at_uri": "at://did:plc:viewer/app.bsky.graph.block/b1", "author_did": "did:plc:viewer", "subject_did": "did:plc:other",
+	})
+	cache.Observe(unblockEvent("did:plc:viewer", "b1"))
+	if kept := cache.Filter(context.Background(), "did:plc:other", authorCandidates("did:plc:viewer")); len(kept) != 1 {
+		t.Errorf("expected the unblock applied before the index caught up, got %+v", kept)
+	}
+
+	// Observed events are swept after the TTL
+	now = now.Add(2 * time.Minute)
+	cache.Sweep()
+	if len(cache.blocks) != 0 || len(cache.unblocked) != 0 {
+		t.Errorf("expected observed events swept, got %d blocks and %d unblocks", len(cache.blocks), len(cache.unblocked))
+	}
+}
+
+func TestBlockCache_LookupErrorEnforcesObserved(t *testing.T) {
+	es := estest.New(t)
+	es.Handle(estest.APISearch, func(estest.Call) *estest.Response {
+		return &estest.Response{Status: http.StatusServiceUnavailable, Body: `{"error":"unavailable"}`}
+	})
+	cache := NewBlockCache(es.Client, common.BlocksIndex, time.Minute, common.NewLogger(false))
+	cache.Observe(blockEvent("did:plc:viewer", "b1", "did:plc:blocked"))
+	cache.SetMutes("did:plc:viewer", []string{"did:plc:muted"})
+
+	kept := cache.Filter(context.Background(), "did:plc:viewer", authorCandidates("did:plc:blocked", "did:plc:muted", "did:plc:fine"))
+	if len(kept) != 1 {
+		t.Errorf("expected observed blocks and mutes enforced without the index, got %+v", kept)
+	}
+
+	var nilCache *BlockCache
+	if kept := nilCache.Filter(context.Background(), "did:plc:viewer", kept); len(kept) != 1 {
+		t.Error("expected a nil cache to hide nothing")
+	}
+}
+
+func TestBlockCache_SweepsIdleMutes(t *testing.T) {
+	cache := NewBlockCache(estest.New(t).Client, common.BlocksIndex, time.Minute, common.NewLogger(false))
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+	cache.SetMutes("did:plc:active", []string{"did:plc:muted"})
+	cache.SetMutes("did:plc:idle", []string{"did:plc:muted"})
+
+	// Serving a user keeps their mutes
+	now = now.Add(muteIdleTTL - time.Hour)
+	cache.Filter(context.Background(), "did:plc:active", authorCandidates("did:plc:muted"))
+	now = now.Add(2 * time.Hour)
+	cache.Sweep()
+	if _, ok := cache.mutes["did:plc:active"]; !ok || len(cache.mutes) != 1 {
+		t.Errorf("expected only the idle user's mutes swept, got %v", cache.mutes)
+	}
+	if kept := cache.Filter(context.Background(), "did:plc:active", authorCandidates("did:plc:muted")); len(kept) != 0 {
+		t.Errorf("expected the active user's mutes enforced, got %+v", kept)
+	}
+}
+
+func TestBlockStreamURL(t *testing.T) {
+	got, err := blockStreamURL("wss://jetstream2.us-east.bsky.network/subscribe")
+	if err != nil || got != "wss://jetstream2.us-east.bsky.network/subscribe?wantedCollections=app.bsky.graph.block" {
+		t.Errorf("unexpected stream URL %q (%v)", got, err)
+	}
+}
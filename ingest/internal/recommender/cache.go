@@ -0,0 +1,303 @@
+package recommender
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// CacheKey identifies a slate request. Requests with the same user, scoring
+// weights and prompt set are served the same slate until it expires.
+type CacheKey struct {
+	UserDID     string
+	WeightsHash string
+	PromptSet   string
+}
+
+// NewCacheKey builds a key, hashing weights independently of map order
+func NewCacheKey(userDID string, weights map[string]float64, promptSet string) CacheKey {
+	names := make([]string, 0, len(weights))
+	for name := range weights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		_, _ = h.Write([]byte(name))
+		_, _ = h.Write([]byte{'='})
+		_, _ = h.Write([]byte(strconv.FormatFloat(weights[name], 'g', -1, 64)))
+		_, _ = h.Write([]byte{0})
+	}
+
+	return CacheKey{
+		UserDID:     userDID,
+		WeightsHash: hex.EncodeToString(h.Sum(nil)[:8]),
+		PromptSet:   promptSet,
+	}
+}
+
+// lastSlateRetention bounds how long a user's last slate is kept for the
+// cached-slate degradation fallback
+const lastSlateRetention = time.Hour
+
+type cacheEntry struct {
+	slate     []Candidate
+	snapshot  time.Time
+	expiresAt time.Time
+}
+
+// SlateCache holds full slate responses for a short TTL so aggressively
+// refreshing clients don't recompute the pipeline. Entries for a user are
+// dropped as soon as ingest records a new like by that user.
+type SlateCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[CacheKey]cacheEntry
+	byUser  map[string]map[CacheKey]bool
+	last    map[string]cacheEntry
+	now     func() time.Time
+}
+
+// NewSlateCache creates a cache with the given entry TTL
+func NewSlateCache(ttl time.Duration) *SlateCache {
+	return &SlateCache{
+		ttl:     ttl,
+		entries: make(map[CacheKey]cacheEntry),
+		byUser:  make(map[string]map[CacheKey]bool),
+		last:    make(map[string]cacheEntry),
+		now:     time.Now,
+	}
+}
+
+// Get returns the cached slate for key, and the snapshot it was built at,
+// if it has not expired
+func (c *SlateCache) Get(key CacheKey) ([]Candidate, time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	if c.now().After(entry.expiresAt) {
+		c.deleteLocked(key)
+		return nil, time.Time{}, false
+	}
+	return entry.slate, entry.snapshot, true
+}
+
+// Put stores a slate built at snapshot (see WithSnapshot) under key and
+// records it as the user's last slate. Pages of a cached slate are served
+// at its snapshot, so they match the pages rebuilt once it expires.
+func (c *SlateCache) Put(key CacheKey, slate []Candidate, snapshot time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	c.entries[key] = cacheEntry{slate: slate, snapshot: snapshot, expiresAt: now.Add(c.ttl)}
+	if c.byUser[key.UserDID] == nil {
+		c.byUser[key.UserDID] = make(map[CacheKey]bool)
+	}
+	c.byUser[key.UserDID][key] = true
+	c.last[key.UserDID] = cacheEntry{slate: slate, expiresAt: now.Add(lastSlateRetention)}
+}
+
+// Last returns the most recent slate served to a user within the past hour,
+// ignoring TTL and invalidation. It backs the cached-slate degradation level.
+func (c *SlateCache) Last(userDID string) ([]Candidate, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.last[userDID]
+	if !ok || c.now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.slate, true
+}
+
+// InvalidateUser drops all fresh entries for a user
+func (c *SlateCache) InvalidateUser(userDID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.byUser[userDID] {
+		delete(c.entries, key)
+	}
+	delete(c.byUser, userDID)
+}
+
+// Sweep removes expired entries and returns how many were removed
+func (c *SlateCache) Sweep() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	removed := 0
+	now := c.now()
+	for key, entry := range c.entries {
+		if now.After(entry.expiresAt) {
+			c.deleteLocked(key)
+			removed++
+		}
+	}
+	for did, entry := range c.last {
+		if now.After(entry.expiresAt) {
+			delete(c.last, did)
+		}
+	}
+	return removed
+}
+
+func (c *SlateCache) deleteLocked(key CacheKey) {
+	delete(c.entries, key)
+	if keys := c.byUser[key.UserDID]; keys != nil {
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(c.byUser, key.UserDID)
+		}
+	}
+}
+
+// likeVisibilityLag covers the likes index refresh_interval (30s); each
+// poll re-reads this window so likes that became searchable late are not missed
+const likeVisibilityLag = 30 * time.Second
+
+// likersPageSize is how many likers each composite aggregation page returns
+const likersPageSize = 10000
+
+// likeAuthorsResponse is a page of the composite aggregation of recently
+// liking users
+type likeAuthorsResponse struct {
+	Aggregations struct {
+		Authors struct {
+			AfterKey map[string]interface{} `json:"after_key"`
+			Buckets  []struct {
+				Key struct {
+					AuthorDID string `json:"author_did"`
+				} `json:"key"`
+			} `json:"buckets"`
+		} `json:"authors"`
+	} `json:"aggregations"`
+}
+
+// FetchRecentLikers returns the DIDs of users with likes indexed after since.
+// It pages through them with a composite aggregation, so a burst of more
+// likers than one terms aggregation returns still invalidates every one.
+func FetchRecentLikers(ctx context.Context, client *elasticsearch.Client, index string, since time.Time, logger *common.IngestLogger) ([]string, error) {
+	var dids []string
+	var after map[string]interface{}
+	for {
+		composite := map[string]interface{}{
+			"size": likersPageSize,
+			"sources": []interface{}{
+				map[string]interface{}{
+					"author_did": map[string]interface{}{
+						"terms": map[string]interface{}{"field": "author_did"},
+					},
+				},
+			},
+		}
+		if after != nil {
+			composite["after"] = after
+		}
+		query := map[string]interface{}{
+			"size": 0,
+			"query": map[string]interface{}{
+				"range": map[string]interface{}{
+					"indexed_at": map[string]interface{}{
+						"gt": since.UTC().Format(time.RFC3339Nano),
+					},
+				},
+			},
+			"aggs": map[string]interface{}{
+				"authors": map[string]interface{}{"composite": composite},
+			},
+		}
+
+		response, err := searchRecentLikers(ctx, client, index, query, logger)
+		if err != nil {
+			return nil, err
+		}
+		authors := response.Aggregations.Authors
+		for _, bucket := range authors.Buckets {
+			dids = append(dids, bucket.Key.AuthorDID)
+		}
+		if len(authors.Buckets) == 0 || authors.AfterKey == nil {
+			return dids, nil
+		}
+		after = authors.AfterKey
+	}
+}
+
+// searchRecentLikers runs one page of the recent likers aggregation
+func searchRecentLikers(ctx context.Context, client *elasticsearch.Client, index string, query map[string]interface{}, logger *common.IngestLogger) (*likeAuthorsResponse, error) {
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	start := time.Now()
+	res, err := client.Search(
+		client.Search.WithContext(ctx),
+		client.Search.WithIndex(index),
+		client.Search.WithBody(bytes.NewReader(queryJSON)),
+	)
+	logger.Metric("es.recommender_recent_likers.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("search request failed: %w", err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			logger.Error("Failed to close search response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("search request returned error: %s", res.String())
+	}
+
+	var response likeAuthorsResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse search response: %w", err)
+	}
+	return &response, nil
+}
+
+// RunLikeInvalidation polls the likes index written by jetstream_ingest every
+// interval and invalidates cached slates for users who liked something since
+// the previous poll. It also sweeps expired entries. Blocks until ctx is done.
+func RunLikeInvalidation(ctx context.Context, cache *SlateCache, client *elasticsearch.Client, index string, interval time.Duration, logger *common.IngestLogger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	since := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pollStart := time.Now()
+			dids, err := FetchRecentLikers(ctx, client, index, since, logger)
+			if err != nil {
+				logger.Error("Failed to fetch recent likers for cache invalidation: %v", err)
+				continue
+			}
+			for _, did := range dids {
+				cache.InvalidateUser(did)
+			}
+			since = pollStart.Add(-likeVisibilityLag)
+			swept := cache.Sweep()
+			logger.Metric("recommender.cache.invalidated_count", float64(len(dids)))
+			logger.Metric("recommender.cache.expired_count", float64(swept))
+		}
+	}
+}
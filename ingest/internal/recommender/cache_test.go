@@ -0,0 +1,129 @@
+package recommender
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func TestNewCacheKey_IgnoresWeightOrder(t *testing.T) {
+	a := NewCacheKey("did:plc:u", map[string]float64{"recency": 0.3, "similarity": 0.7}, "default")
+	b := NewCacheKey("did:plc:u", map[string]float64{"similarity": 0.7, "recency": 0.3}, "default")
+	if a != b {
+		t.Errorf("expected equal keys, got %+v and %+v", a, b)
+	}
+
+	c := NewCacheKey("did:plc:u", map[string]float64{"recency": 0.4, "similarity": 0.6}, "default")
+	if a == c {
+		t.Error("expected different weights to produce different keys")
+	}
+}
+
+func TestSlateCache_TTL(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewSlateCache(30 * time.Second)
+	cache.now = func() time.Time { return now }
+
+	key := NewCacheKey("did:plc:u", nil, "")
+	snapshot := now.Add(-time.Second)
+	cache.Put(key, makeCandidates("s", 3), snapshot)
+
+	if slate, builtAt, ok := cache.Get(key); !ok || len(slate) != 3 || !builtAt.Equal(snapshot) {
+		t.Fatalf("expected cached slate built at %s, got %v at %s, %v", snapshot, slate, builtAt, ok)
+	}
+
+	now = now.Add(31 * time.Second)
+	if _, _, ok := cache.Get(key); ok {
+		t.Error("expected entry to expire after TTL")
+	}
+	if _, ok := cache.Last("did:plc:u"); !ok {
+		t.Error("expected last slate to outlive TTL")
+	}
+
+	now = now.Add(lastSlateRetention)
+	cache.Sweep()
+	if _, ok := cache.Last("did:plc:u"); ok {
+		t.Error("expected last slate to be dropped after retention")
+	}
+}
+
+func TestSlateCache_InvalidateUser(t *testing.T) {
+	cache := NewSlateCache(time.Minute)
+	k1 := NewCacheKey("did:plc:u", map[string]float64{"a": 1}, "")
+	k2 := NewCacheKey("did:plc:u", map[string]float64{"a": 2}, "")
+	other := NewCacheKey("did:plc:other", nil, "")
+	cache.Put(k1, makeCandidates("a", 1), time.Time{})
+	cache.Put(k2, makeCandidates("b", 1), time.Time{})
+	cache.Put(other, makeCandidates("c", 1), time.Time{})
+
+	cache.InvalidateUser("did:plc:u")
+
+	if _, _, ok := cache.Get(k1); ok {
+		t.Error("expected k1 to be invalidated")
+	}
+	if _, _, ok := cache.Get(k2); ok {
+		t.Error("expected k2 to be invalidated")
+	}
+	if _, _, ok := cache.Get(other); !ok {
+		t.Error("expected other user's entry to survive")
+	}
+	if _, ok := cache.Last("did:plc:u"); !ok {
+		t.Error("expected last slate to survive invalidation for degraded serving")
+	}
+}
+
+func TestSlateCache_Sweep(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := NewSlateCache(time.Second)
+	cache.now = func() time.Time { return now }
+	cache.Put(NewCacheKey("did:plc:a", nil, ""), nil, time.Time{})
+	cache.Put(NewCacheKey("did:plc:b", nil, ""), nil, time.Time{})
+
+	now = now.Add(2 * time.Second)
+	if removed := cache.Sweep(); removed != 2 {
+		t.Errorf("expected 2 expired entries, got %d", removed)
+	}
+	if len(cache.byUser) != 0 {
+		t.Errorf("expected user index to be cleaned up, got %v", cache.byUser)
+	}
+}
+
+func TestFetchRecentLikers(t *testing.T) {
+	var bodies []string
+	client := estest.NewClient(t, func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+		switch len(bodies) {
+		case 1:
+			_, _ = w.Write([]byte(`{"aggregations":{"authors":{"after_key":{"author_did":"did:plc:b"},"buckets":[{"key":{"author_did":"did:plc:a"},"doc_count":2},{"key":{"author_did":"did:plc:b"},"doc_count":1}]}}}`))
+		case 2:
+			_, _ = w.Write([]byte(`{"aggregations":{"authors":{"after_key":{"author_did":"did:plc:c"},"buckets":[{"key":{"author_did":"did:plc:c"},"doc_count":1}]}}}`))
+		default:
+			_, _ = w.Write([]byte(`{"aggregations":{"authors":{"buckets":[]}}}`))
+		}
+	})
+
+	since := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	dids, err := FetchRecentLikers(context.Background(), client, "likes", since, common.NewLogger(false))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(dids) != 3 || dids[0] != "did:plc:a" || dids[2] != "did:plc:c" {
+		t.Errorf("expected the likers of every page, got %v", dids)
+	}
+	if len(bodies) != 3 {
+		t.Fatalf("expected pages until one came back empty, got %d requests", len(bodies))
+	}
+	if !strings.Contains(bodies[0], `"gt":"2025-01-01T00:00:00Z"`) || strings.Contains(bodies[0], `"after"`) {
+		t.Errorf("expected indexed_at lower bound and no after key in the first query, got %s", bodies[0])
+	}
+	if !strings.Contains(bodies[1], `"after":{"author_did":"did:plc:b"}`) {
+		t.Errorf("expected the second page to start after the first, got %s", bodies[1])
+	}
+}
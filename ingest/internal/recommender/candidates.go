@@ -0,0 +1,46 @@
+// Package recommender provides candidate generation and slate assembly for
+// the Green Earth feed recommender. It reads the same Elasticsearch aliases
+// the ingest services write to.
+package recommender
+
+import (
+	"context"
+)
+
+// Candidate is a post proposed for a user's slate
+type Candidate struct {
+	AtURI     string
+	AuthorDID string
+	Score     float64
+	Strategy  string // strategy that produced the candidate, recorded in impression logs
+
+	// Explanation is set only for requests that ask for explanations (see
+	// WithExplain)
+	Explanation *Explanation
+}
+
+// CandidateSource produces scored candidates for a slate
+type CandidateSource interface {
+	Name() string
+	Candidates(ctx context.Context, limit int) ([]Candidate, error)
+}
+
+// candidateURI returns c's AT-URI
+func candidateURI(c Candidate) string {
+	return c.AtURI
+}
+
+// dedupeCandidates drops later candidates whose AtURI has already been seen,
+// preserving order
+func dedupeCandidates(candidates []Candidate) []Candidate {
+	seen := make(map[string]bool, len(candidates))
+	result := make([]Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		if c.AtURI == "" || seen[c.AtURI] {
+			continue
+		}
+		seen[c.AtURI] = true
+		result = append(result, c)
+	}
+	return result
+}
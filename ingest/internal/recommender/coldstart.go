@@ -0,0 +1,481 @@
+package recommender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/elastic/go-elasticsearch/v9"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// Cold-start strategy names. These are recorded on each served candidate and
+// in impression logs so cold-start slates can be evaluated offline.
+const (
+	StrategyTrending    = "cold_start_trending"
+	StrategySeedList    = "cold_start_seed_list"
+	StrategyExploration = "cold_start_exploration"
+)
+
+// explorationEmbeddingField is the indexed dense_vector used for kNN exploration
+const explorationEmbeddingField = common.EmbeddingFieldMiniLML12
+
+// UserHistory summarizes the engagement signals available for a user
+type UserHistory struct {
+	LikeCount   int
+	FollowCount int
+}
+
+// IsColdStart reports whether a user has no engagement history to personalize from
+func IsColdStart(history UserHistory) bool {
+	return history.LikeCount == 0 && history.FollowCount == 0
+}
+
+// WeightedSource pairs a candidate source with its share of a blended slate
+type WeightedSource struct {
+	Source CandidateSource
+	Weight float64
+}
+
+// ColdStartBlender serves slates for users without likes or follows by
+// interleaving trending, curated and exploration candidates by weight
+type ColdStartBlender struct {
+	sources []WeightedSource
+	logger  *common.IngestLogger
+}
+
+// NewColdStartBlender creates a blender over the given sources. Sources with
+// a non-positive weight are ignored.
+func NewColdStartBlender(sources []WeightedSource, logger *common.IngestLogger) *ColdStartBlender {
+	active := make([]WeightedSource, 0, len(sources))
+	for _, s := range sources {
+		if s.Source != nil && s.Weight > 0 {
+			active = append(active, s)
+		}
+	}
+	return &ColdStartBlender{sources: active, logger: logger}
+}
+
+// Blend returns up to limit deduplicated candidates. Each source is asked for
+// its weighted share of the slate and the results are interleaved with smooth
+// weighted round-robin so every strategy appears near the top. A failing
+// source is skipped; an error is returned only when every source fails.
+func (b *ColdStartBlender) Blend(ctx context.Context, limit int) ([]Candidate, error) {
+	if limit <= 0 || len(b.sources) == 0 {
+		return nil, nil
+	}
+
+	totalWeight := 0.0
+	for _, s := range b.sources {
+		totalWeight += s.Weight
+	}
+
+	queues := make([][]Candidate, len(b.sources))
+	failed := 0
+	var lastErr error
+	for i, s := range b.sources {
+		// Over-fetch so duplicates across sources don't leave the slate short
+		quota := int(math.Ceil(float64(limit)*s.Weight/totalWeight)) * 2
+		candidates, err := s.Source.Candidates(ctx, quota)
+		if err != nil {
+			failed++
+			lastErr = err
+			b.logger.Error("Cold-start source %s failed: %v", s.Source.Name(), err)
+			b.logger.Metric("recommender.cold_start.source_errors", 1)
+			continue
+		}
+		for j := range candidates {
+			candidates[j].Strategy = s.Source.Name()
+		}
+		queues[i] = candidates
+	}
+	if failed == len(b.sources) {
+		return nil, fmt.Errorf("all cold-start sources failed: %w", lastErr)
+	}
+
+	slate := make([]Candidate, 0, limit)
+	seen := make(map[string]bool, limit)
+	current := make([]float64, len(b.sources))
+	for len(slate) < limit {
+		best := -1
+		for i, s := range b.sources {
+			if len(queues[i]) == 0 {
+				continue
+			}
+			current[i] += s.Weight
+			if best == -1 || current[i] > current[best] {
+				best = i
+			}
+		}
+		if best == -1 {
+			break
+		}
+		current[best] -= totalWeight
+
+		next := queues[best][0]
+		queues[best] = queues[best][1:]
+		if next.AtURI == "" || seen[next.AtURI] {
+			continue
+		}
+		seen[next.AtURI] = true
+		slate = append(slate, next)
+	}
+
+	b.logger.Metric("recommender.cold_start.slate_size", float64(len(slate)))
+	return slate, nil
+}
+
+// candidateHit is the subset of a post document needed to build a candidate
+type candidateHit struct {
+	Score  float64 `json:"_score"`
+	Source struct {
+		AtURI     string `json:"at_uri"`
+		AuthorDID string `json:"author_did"`
+		LikeCount int    `json:"like_count"`
+	} `json:"_source"`
+}
+
+type candidateSearchResponse struct {
+	Took int `json:"took"`
+	Hits struct {
+		Hits []candidateHit `json:"hits"`
+	} `json:"hits"`
+}
+
+// searchCandidates runs a search against index and returns the raw hits
+func searchCandidates(ctx context.Context, client *elasticsearch.Client, index string, query map[string]interface{}, metricPrefix string, logger *common.IngestLogger) ([]candidateHit, error) {
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	start := time.Now()
+	res, err := client.Search(
+		client.Search.WithContext(ctx),
+		client.Search.WithIndex(index),
+		client.Search.WithBody(bytes.NewReader(queryJSON)),
+	)
+	logger.Metric(metricPrefix+".duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("search request failed: %w", err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			logger.Error("Failed to close search response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("search request returned error: %s", res.String())
+	}
+
+	var response candidateSearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse search response: %w", err)
+	}
+
+	logger.Metric(metricPrefix+".took_ms", float64(response.Took))
+	return response.Hits.Hits, nil
+}
+
+// CandidateWindow returns the lookback for trending and exploration
+// candidates: GE_RECOMMENDER_TRENDING_WINDOW when set, otherwise the hot
+// window the retention policy sets for index
+func CandidateWindow(config *common.Config, policy *common.RetentionPolicy, index string) (time.Duration, error) {
+	if config.RecommenderTrendingWindow > 0 {
+		return config.RecommenderTrendingWindow, nil
+	}
+	window := policy.Windows(index).Hot
+	if window <= 0 {
+		return 0, fmt.Errorf("no GE_RECOMMENDER_TRENDING_WINDOW and no hot window for %s in the retention policy", index)
+	}
+	return window, nil
+}
+
+// TrendingSource returns the most-liked recent posts
+type TrendingSource struct {
+	client *elasticsearch.Client
+	index  string
+	window time.Duration
+	logger *common.IngestLogger
+}
+
+// NewTrendingSource creates a source over posts created within window
+func NewTrendingSource(client *elasticsearch.Client, index string, window time.Duration, logger *common.IngestLogger) *TrendingSource {
+	return &TrendingSource{client: client, index: index, window: window, logger: logger}
+}
+
+// Name returns the strategy name
+func (s *TrendingSource) Name() string { return StrategyTrending }
+
+// Candidates returns up to limit recent posts ordered by like count, ties
+// broken by AT-URI. The snapshot bounds which posts are ranked but not their
+// counts: a page rebuilt after likes reorder posts already served fails
+// PageSlate with ErrStaleCursor and the client restarts from the first page.
+func (s *TrendingSource) Candidates(ctx context.Context, limit int) ([]Candidate, error) {
+	query := map[string]interface{}{
+		"query": snapshotFilter(ctx, s.window),
+		"sort": []interface{}{
+			map[string]interface{}{"like_count": "desc"},
+			map[string]interface{}{"at_uri": "asc"},
+		},
+		"_source": []string{"at_uri", "author_did", "like_count"},
+		"size":    limit,
+	}
+
+	hits, err := searchCandidates(ctx, s.client, s.index, query, "es.recommender_trending", s.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]Candidate, 0, len(hits))
+	for _, hit := range hits {
+		c := Candidate{
+			AtURI:     hit.Source.AtURI,
+			AuthorDID: hit.Source.AuthorDID,
+			Score:     float64(hit.Source.LikeCount),
+		}
+		ExplainFeature(ctx, &c, "like_count", float64(hit.Source.LikeCount))
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+// SeedList is the curated cold-start configuration. Posts are served as-is;
+// TopicAnchors are embeddings (all_MiniLM_L12_v2) of representative content
+// for each topic and drive kNN exploration.
+type SeedList struct {
+	Posts        []string             `json:"posts"`
+	TopicAnchors map[string][]float32 `json:"topic_anchors"`
+}
+
+// LoadSeedList reads a seed list from a local path or GCS (gs://bucket/object)
+func LoadSeedList(ctx context.Context, path string) (*SeedList, error) {
+	data, err := readConfigSource(ctx, path, "seed list")
+	if err != nil {
+		return nil, err
+	}
+
+	var seeds SeedList
+	if err := json.Unmarshal(data, &seeds); err != nil {
+		return nil, fmt.Errorf("failed to parse seed list: %w", err)
+	}
+	return &seeds, nil
+}
+
+// readConfigSource returns the document at a local path or GCS
+// (gs://bucket/object); what names it in errors
+func readConfigSource(ctx context.Context, path, what string) ([]byte, error) {
+	if !strings.HasPrefix(path, "gs://") {
+		data, err := os.ReadFile(path) //nolint:gosec // G304: path comes from service configuration
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", what, err)
+		}
+		return data, nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(path, "gs://"), "/", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid GCS path format: %s (expected gs://bucket/object)", path)
+	}
+
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	reader, err := client.Bucket(parts[0]).Object(parts[1]).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s in GCS: %w", what, err)
+	}
+	defer func() { _ = reader.Close() }() // Best-effort close for read operation
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from GCS: %w", what, err)
+	}
+	return data, nil
+}
+
+// SeedListSource serves curated posts in configured order
+type SeedListSource struct {
+	posts []string
+}
+
+// NewSeedListSource creates a source over curated post AT-URIs
+func NewSeedListSource(posts []string) *SeedListSource {
+	return &SeedListSource{posts: posts}
+}
+
+// Name returns the strategy name
+func (s *SeedListSource) Name() string { return StrategySeedList }
+
+// Candidates returns up to limit curated posts, scored by list position
+func (s *SeedListSource) Candidates(ctx context.Context, limit int) ([]Candidate, error) {
+	n := min(limit, len(s.posts))
+	candidates := make([]Candidate, 0, n)
+	for i, uri := range s.posts[:n] {
+		c := Candidate{
+			AtURI:     uri,
+			AuthorDID: common.ExtractDIDFromATURI(uri),
+			Score:     float64(len(s.posts) - i),
+		}
+		ExplainFeature(ctx, &c, "seed_list_position", float64(i+1))
+		candidates = append(candidates, c)
+	}
+	return candidates, nil
+}
+
+// ExplorationSource runs a kNN query per topic anchor and interleaves the
+// results so the slate spans topics rather than clustering around one
+type ExplorationSource struct {
+	client  *elasticsearch.Client
+	index   string
+	anchors map[string][]float32
+	window  time.Duration
+	logger  *common.IngestLogger
+}
+
+// NewExplorationSource creates a kNN exploration source over recent posts
+func NewExplorationSource(client *elasticsearch.Client, index string, anchors map[string][]float32, window time.Duration, logger *common.IngestLogger) *ExplorationSource {
+	return &ExplorationSource{client: client, index: index, anchors: anchors, window: window, logger: logger}
+}
+
+// Name returns the strategy name
+func (s *ExplorationSource) Name() string { return StrategyExploration }
+
+// Candidates returns up to limit posts drawn evenly across topic anchors.
+// Topics whose query fails are skipped.
+func (s *ExplorationSource) Candidates(ctx context.Context, limit int) ([]Candidate, error) {
+	if len(s.anchors) == 0 || limit <= 0 {
+		return nil, nil
+	}
+
+	perTopic := int(math.Ceil(float64(limit) / float64(len(s.anchors))))
+	filter := snapshotFilter(ctx, s.window)
+
+	var perTopicResults [][]Candidate
+	var lastErr error
+	for topic, vector := range s.anchors {
+		hits, err := common.KNNSearch(ctx, s.client, s.index, common.KNNQuery{
+			Field:  explorationEmbeddingField,
+			Vector: vector,
+			K:      perTopic,
+			Filter: filter,
+			Metric: "es.recommender_exploration",
+		}, s.logger)
+		if err != nil {
+			lastErr = err
+			s.logger.Error("Exploration query for topic %s failed: %v", topic, err)
+			continue
+		}
+
+		results := make([]Candidate, 0, len(hits))
+		for _, hit := range hits {
+			c := Candidate{
+				AtURI:     hit.Post.AtURI,
+				AuthorDID: hit.Post.AuthorDID,
+				Score:     hit.Score,
+			}
+			ExplainFeature(ctx, &c, "topic_similarity."+topic, hit.Score)
+			results = append(results, c)
+		}
+		perTopicResults = append(perTopicResults, results)
+	}
+	if len(perTopicResults) == 0 {
+		return nil, fmt.Errorf("all exploration queries failed: %w", lastErr)
+	}
+
+	return interleave(perTopicResults, limit), nil
+}
+
+// interleave takes one candidate from each list in turn until limit is reached
+func interleave(lists [][]Candidate, limit int) []Candidate {
+	result := make([]Candidate, 0, limit)
+	for i := 0; len(result) < limit; i++ {
+		added := false
+		for _, list := range lists {
+			if i < len(list) {
+				result = append(result, list[i])
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	return dedupeCandidates(result[:min(limit, len(result))])
+}
+
+// ImpressionsIndex is where impressions are indexed for offline evaluation
+// (see cmd/rec_metrics)
+const ImpressionsIndex = "rec_impressions"
+
+// Impression records a single served slate position for offline evaluation
+type Impression struct {
+	UserDID       string    `json:"user_did"`
+	AtURI         string    `json:"at_uri"`
+	Position      int       `json:"position"`
+	Strategy      string    `json:"strategy"`
+	ExperimentArm string    `json:"experiment_arm,omitempty"`
+	PromptVersion string    `json:"prompt_version,omitempty"`
+	ServedAt      time.Time `json:"served_at"`
+}
+
+// ImpressionTags identify what served a slate, so offline metrics can be
+// compared between experiment arms and prompt versions. Either may be empty.
+type ImpressionTags struct {
+	ExperimentArm string
+	PromptVersion string
+}
+
+// ID returns the impression's _id in the impressions index. A post served
+// to the same user at the same time is the same impression.
+func (imp Impression) ID() string {
+	return imp.UserDID + "|" + imp.AtURI + "|" + strconv.FormatInt(imp.ServedAt.UnixMicro(), 10)
+}
+
+// LogImpressions writes one JSON impression line per slate position and
+// counts impressions per strategy. offset is the position of slate[0], for
+// pages after the first.
+func LogImpressions(logger *common.IngestLogger, userDID string, slate []Candidate, offset int, servedAt time.Time, tags ImpressionTags) []Impression {
+	impressions := make([]Impression, 0, len(slate))
+	for i, c := range slate {
+		imp := Impression{
+			UserDID:       userDID,
+			AtURI:         c.AtURI,
+			Position:      offset + i,
+			Strategy:      c.Strategy,
+			ExperimentArm: tags.ExperimentArm,
+			PromptVersion: tags.PromptVersion,
+			ServedAt:      servedAt.UTC(),
+		}
+		impressions = append(impressions, imp)
+
+		line, err := json.Marshal(imp)
+		if err != nil {
+			logger.Error("Failed to marshal impression for %s: %v", c.AtURI, err)
+			continue
+		}
+		logger.Info("impression %s", line)
+		logger.Metric("recommender.impressions."+c.Strategy+"_count", 1)
+	}
+	return impressions
+}
+
+// IndexImpressions indexes impressions into index (normally
+// ImpressionsIndex) for the offline metrics job to join with later likes
+// and replies. Indexing an impression again overwrites it.
+func IndexImpressions(ctx context.Context, client *elasticsearch.Client, index string, impressions []Impression, dryRun bool, logger *common.IngestLogger) error {
+	return common.BulkIndexWithIDs(ctx, client, index, impressions, Impression.ID, "impression", "es.bulk_index_impressions", dryRun, logger)
+}
@@ -0,0 +1,281 @@
+package recommender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+type fakeSource struct {
+	name       string
+	candidates []Candidate
+	err        error
+	lastLimit  int
+}
+
+func (f *fakeSource) Name() string { return f.name }
+
+func (f *fakeSource) Candidates(_ context.Context, limit int) ([]Candidate, error) {
+	f.lastLimit = limit
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.candidates[:min(limit, len(f.candidates))], nil
+}
+
+func makeCandidates(prefix string, n int) []Candidate {
+	candidates := make([]Candidate, n)
+	for i := range candidates {
+		candidates[i] = Candidate{AtURI: fmt.Sprintf("at://did:plc:%s/app.bsky.feed.post/%d", prefix, i)}
+	}
+	return candidates
+}
+
+func TestIsColdStart(t *testing.T) {
+	if !IsColdStart(UserHistory{}) {
+		t.Error("expected user without likes or follows to be cold-start")
+	}
+	if IsColdStart(UserHistory{LikeCount: 1}) {
+		t.Error("expected user with a like not to be cold-start")
+	}
+	if IsColdStart(UserHistory{FollowCount: 1}) {
+		t.Error("expected user with a follow not to be cold-start")
+	}
+}
+
+func TestColdStartBlender_WeightedInterleave(t *testing.T) {
+	trending := &fakeSource{name: StrategyTrending, candidates: makeCandidates("trending", 20)}
+	seeds := &fakeSource{name: StrategySeedList, candidates: makeCandidates("seed", 20)}
+	blender := NewColdStartBlender([]WeightedSource{
+		{Source: trending, Weight: 3},
+		{Source: seeds, Weight: 1},
+	}, common.NewLogger(false))
+
+	slate, err := blender.Blend(context.Background(), 8)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(slate) != 8 {
+		t.Fatalf("expected 8 candidates, got %d", len(slate))
+	}
+
+	counts := map[string]int{}
+	for _, c := range slate {
+		counts[c.Strategy]++
+	}
+	if counts[StrategyTrending] != 6 || counts[StrategySeedList] != 2 {
+		t.Errorf("expected 6 trending and 2 seed candidates, got %v", counts)
+	}
+	if slate[0].Strategy != StrategyTrending {
+		t.Errorf("expected highest-weight strategy first, got %s", slate[0].Strategy)
+	}
+}
+
+func TestColdStartBlender_Dedupes(t *testing.T) {
+	shared := makeCandidates("shared", 5)
+	a := &fakeSource{name: StrategyTrending, candidates: shared}
+	b := &fakeSource{name: StrategySeedList, candidates: shared}
+	blender := NewColdStartBlender([]WeightedSource{
+		{Source: a, Weight: 1},
+		{Source: b, Weight: 1},
+	}, common.NewLogger(false))
+
+	slate, err := blender.Blend(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(slate) != 5 {
+		t.Errorf("expected 5 unique candidates, got %d", len(slate))
+	}
+}
+
+func TestColdStartBlender_FailOpen(t *testing.T) {
+	broken := &fakeSource{name: StrategyExploration, err: errors.New("es unavailable")}
+	seeds := &fakeSource{name: StrategySeedList, candidates: makeCandidates("seed", 5)}
+	blender := NewColdStartBlender([]WeightedSource{
+		{Source: broken, Weight: 1},
+		{Source: seeds, Weight: 1},
+	}, common.NewLogger(false))
+
+	slate, err := blender.Blend(context.Background(), 4)
+	if err != nil {
+		t.Fatalf("expected partial failure to be tolerated, got %v", err)
+	}
+	if len(slate) != 4 {
+		t.Errorf("expected slate filled from healthy source, got %d", len(slate))
+	}
+}
+
+func TestColdStartBlender_AllSourcesFail(t *testing.T) {
+	blender := NewColdStartBlender([]WeightedSource{
+		{Source: &fakeSource{name: StrategyTrending, err: errors.New("boom")}, Weight: 1},
+	}, common.NewLogger(false))
+
+	if _, err := blender.Blend(context.Background(), 4); err == nil {
+		t.Error("expected error when every source fails")
+	}
+}
+
+func TestColdStartBlender_IgnoresZeroWeight(t *testing.T) {
+	disabled := &fakeSource{name: StrategyExploration, candidates: makeCandidates("explore", 5)}
+	seeds := &fakeSource{name: StrategySeedList, candidates: makeCandidates("seed", 5)}
+	blender := NewColdStartBlender([]WeightedSource{
+		{Source: disabled, Weight: 0},
+		{Source: seeds, Weight: 1},
+	}, common.NewLogger(false))
+
+	if _, err := blender.Blend(context.Background(), 3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if disabled.lastLimit != 0 {
+		t.Error("expected zero-weight source not to be queried")
+	}
+}
+
+func TestSeedListSource_Candidates(t *testing.T) {
+	source := NewSeedListSource([]string{
+		"at://did:plc:a/app.bsky.feed.post/1",
+		"at://did:plc:b/app.bsky.feed.post/2",
+		"at://did:plc:c/app.bsky.feed.post/3",
+	})
+
+	candidates, err := source.Candidates(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(candidates) != 2 {
+		t.Fatalf("expected 2 candidates, got %d", len(candidates))
+	}
+	if candidates[0].AuthorDID != "did:plc:a" {
+		t.Errorf("expected author DID from AT-URI, got %q", candidates[0].AuthorDID)
+	}
+	if candidates[0].Score <= candidates[1].Score {
+		t.Error("expected earlier seeds to score higher")
+	}
+}
+
+func TestLoadSeedList_Local(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seeds.json")
+	body := `{"posts":["at://did:plc:a/app.bsky.feed.post/1"],"topic_anchors":{"science":[0.1,0.2]}}`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("failed to write seed list: %v", err)
+	}
+
+	seeds, err := LoadSeedList(context.Background(), path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(seeds.Posts) != 1 || len(seeds.TopicAnchors["science"]) != 2 {
+		t.Errorf("unexpected seed list contents: %+v", seeds)
+	}
+}
+
+func TestLoadSeedList_InvalidGCSPath(t *testing.T) {
+	if _, err := LoadSeedList(context.Background(), "gs://bucket-only"); err == nil {
+		t.Error("expected error for GCS path without object")
+	}
+}
+
+func TestTrendingSource_SortsByLikeCount(t *testing.T) {
+	var body string
+	client := estest.NewClient(t, func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		_, _ = w.Write([]byte(`{"took":1,"hits":{"hits":[
+			{"_score":null,"_source":{"at_uri":"at://did:plc:a/app.bsky.feed.post/1","author_did":"did:plc:a","like_count":42}}
+		]}}`))
+	})
+
+	source := NewTrendingSource(client, "posts", 6*time.Hour, common.NewLogger(false))
+	candidates, err := source.Candidates(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(candidates) != 1 || candidates[0].Score != 42 {
+		t.Fatalf("expected one candidate scored by like count, got %+v", candidates)
+	}
+	if !strings.Contains(body, `"sort":[{"like_count":"desc"},{"at_uri":"asc"}]`) {
+		t.Errorf("expected query sorted by like_count, ties by at_uri, got %s", body)
+	}
+}
+
+func TestExplorationSource_InterleavesTopics(t *testing.T) {
+	client := estest.NewClient(t, func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		topic := "b"
+		if strings.Contains(string(data), "[1,0]") {
+			topic = "a"
+		}
+		_, _ = fmt.Fprintf(w, `{"took":1,"hits":{"hits":[
+			{"_score":0.9,"_source":{"at_uri":"at://did:plc:%[1]s/app.bsky.feed.post/1","author_did":"did:plc:%[1]s"}},
+			{"_score":0.8,"_source":{"at_uri":"at://did:plc:%[1]s/app.bsky.feed.post/2","author_did":"did:plc:%[1]s"}}
+		]}}`, topic)
+	})
+
+	anchors := map[string][]float32{"a": {1, 0}, "b": {0, 1}}
+	source := NewExplorationSource(client, "posts", anchors, 24*time.Hour, common.NewLogger(false))
+	candidates, err := source.Candidates(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(candidates) != 2 {
+		t.Fatalf("expected 2 candidates, got %d", len(candidates))
+	}
+	if candidates[0].AuthorDID == candidates[1].AuthorDID {
+		t.Errorf("expected one candidate per topic, got %+v", candidates)
+	}
+}
+
+func TestLogImpressions_RecordsStrategy(t *testing.T) {
+	slate := []Candidate{
+		{AtURI: "at://did:plc:a/app.bsky.feed.post/1", Strategy: StrategyTrending},
+		{AtURI: "at://did:plc:b/app.bsky.feed.post/2", Strategy: StrategySeedList},
+	}
+	servedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tags := ImpressionTags{ExperimentArm: "control", PromptVersion: "v3"}
+	impressions := LogImpressions(common.NewLogger(false), "did:plc:viewer", slate, 0, servedAt, tags)
+	if len(impressions) != 2 {
+		t.Fatalf("expected 2 impressions, got %d", len(impressions))
+	}
+	if impressions[1].Position != 1 || impressions[1].Strategy != StrategySeedList {
+		t.Errorf("unexpected impression: %+v", impressions[1])
+	}
+	if impressions[0].UserDID != "did:plc:viewer" || !impressions[0].ServedAt.Equal(servedAt) {
+		t.Errorf("unexpected impression: %+v", impressions[0])
+	}
+	if impressions[0].ExperimentArm != "control" || impressions[0].PromptVersion != "v3" {
+		t.Errorf("expected the slate's tags on each impression, got %+v", impressions[0])
+	}
+
+	// A later page is positioned after the pages before it
+	page := LogImpressions(common.NewLogger(false), "did:plc:viewer", slate, 30, servedAt, tags)
+	if page[0].Position != 30 || page[1].Position != 31 {
+		t.Errorf("expected positions offset by the earlier pages, got %+v", page)
+	}
+}
+
+func TestIndexImpressions(t *testing.T) {
+	es := estest.New(t)
+	servedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	slate := []Candidate{{AtURI: "at://did:plc:a/app.bsky.feed.post/1"}, {AtURI: "at://did:plc:b/app.bsky.feed.post/2"}}
+	impressions := LogImpressions(common.NewLogger(false), "did:plc:viewer", slate, 0, servedAt, ImpressionTags{})
+
+	if err := IndexImpressions(context.Background(), es.Client, ImpressionsIndex, impressions, false, common.NewLogger(false)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	doc, ok := es.Get(ImpressionsIndex, "did:plc:viewer|at://did:plc:b/app.bsky.feed.post/2|1735689600000000")
+	if !ok || doc["position"] != 1.0 || doc["served_at"] != "2025-01-01T00:00:00Z" {
+		t.Errorf("unexpected impression document %v", doc)
+	}
+}
@@ -0,0 +1,191 @@
+package recommender
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidCursor is returned for cursors that are malformed or fail signature verification
+	ErrInvalidCursor = errors.New("invalid feed cursor")
+	// ErrStaleCursor is returned when the slate rebuilt from a cursor's snapshot
+	// no longer matches the pages the client has already seen
+	ErrStaleCursor = errors.New("stale feed cursor")
+)
+
+// FeedCursor is the scoring snapshot carried between pages of a slate.
+// Candidate retrieval for later pages is bounded by SnapshotUs so posts
+// arriving mid-session don't shift the slate; SeenHash detects when it
+// shifted anyway. Size is the size of the slate being paged, which each page
+// rebuilds, so every page draws from the same candidate pool.
+type FeedCursor struct {
+	SnapshotUs int64  `json:"t"`
+	Offset     int    `json:"o"`
+	SeenHash   string `json:"h"`
+	Size       int    `json:"n,omitempty"`
+}
+
+// CursorSigner encodes and verifies opaque HMAC-signed cursors
+type CursorSigner struct {
+	key []byte
+}
+
+// NewCursorSigner creates a signer with the given secret. An empty secret
+// is rejected: anyone could forge cursors signed with it.
+func NewCursorSigner(key []byte) (*CursorSigner, error) {
+	if len(key) == 0 {
+		return nil, errors.New("cursor signing secret is empty")
+	}
+	return &CursorSigner{key: key}, nil
+}
+
+// Encode serializes a cursor as base64url(payload) + "." + base64url(signature)
+func (s *CursorSigner) Encode(cursor FeedCursor) (string, error) {
+	payload, err := json.Marshal(cursor)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal cursor: %w", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.sign(encoded)), nil
+}
+
+// Decode verifies and parses a cursor produced by Encode
+func (s *CursorSigner) Decode(token string) (FeedCursor, error) {
+	var cursor FeedCursor
+
+	encoded, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return cursor, ErrInvalidCursor
+	}
+	gotSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(gotSig, s.sign(encoded)) {
+		return cursor, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(payload, &cursor); err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if cursor.Offset < 0 || cursor.Size < 0 {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+func (s *CursorSigner) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	_, _ = mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+// HashSeen returns an order-independent digest of the served AT-URIs
+func HashSeen(candidates []Candidate) string {
+	return hashSeen(candidates, candidateURI)
+}
+
+func hashSeen[T any](slate []T, atURI func(T) string) string {
+	uris := make([]string, 0, len(slate))
+	for _, c := range slate {
+		uris = append(uris, atURI(c))
+	}
+	sort.Strings(uris)
+
+	h := sha256.New()
+	for _, uri := range uris {
+		_, _ = h.Write([]byte(uri))
+		_, _ = h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// PageSlate returns the page of slate following cursor and the cursor for the
+// page after it. next is nil once the slate is exhausted. A zero cursor
+// starts at the first page; snapshotUs is only used then. ErrStaleCursor is
+// returned when slate[:cursor.Offset] no longer matches what was served.
+func PageSlate[T any](slate []T, cursor FeedCursor, snapshotUs int64, limit int, atURI func(T) string) (page []T, next *FeedCursor, err error) {
+	if limit <= 0 {
+		return nil, nil, fmt.Errorf("invalid page size %d", limit)
+	}
+	if cursor.SnapshotUs == 0 {
+		cursor = FeedCursor{SnapshotUs: snapshotUs, Size: cursor.Size}
+	}
+	if cursor.Offset > len(slate) {
+		return nil, nil, ErrStaleCursor
+	}
+	if cursor.Offset > 0 && hashSeen(slate[:cursor.Offset], atURI) != cursor.SeenHash {
+		return nil, nil, ErrStaleCursor
+	}
+
+	end := min(cursor.Offset+limit, len(slate))
+	page = slate[cursor.Offset:end]
+	if end < len(slate) {
+		next = &FeedCursor{
+			SnapshotUs: cursor.SnapshotUs,
+			Offset:     end,
+			SeenHash:   hashSeen(slate[:end], atURI),
+			Size:       cursor.Size,
+		}
+	}
+	return page, next, nil
+}
+
+type snapshotKey struct{}
+
+// WithSnapshot bounds candidate retrieval under ctx to posts indexed at or
+// before snapshot, so later pages are scored against the same corpus
+func WithSnapshot(ctx context.Context, snapshot time.Time) context.Context {
+	return context.WithValue(ctx, snapshotKey{}, snapshot)
+}
+
+// snapshotFrom returns the snapshot bound by WithSnapshot, or now
+func snapshotFrom(ctx context.Context) time.Time {
+	if snapshot, ok := ctx.Value(snapshotKey{}).(time.Time); ok {
+		return snapshot.UTC()
+	}
+	return time.Now().UTC()
+}
+
+// snapshotFilter bounds a retrieval query to posts indexed at or before the
+// snapshot bound by WithSnapshot, and created within window before it. Posts
+// backfilled or caught up mid-session carry an old created_at, so only
+// indexed_at keeps them out of later pages.
+func snapshotFilter(ctx context.Context, window time.Duration) map[string]interface{} {
+	snapshot := snapshotFrom(ctx)
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": []interface{}{
+				indexedBySnapshot(ctx),
+				map[string]interface{}{
+					"range": map[string]interface{}{
+						"created_at": map[string]interface{}{
+							"gte": snapshot.Add(-window).Format(time.RFC3339),
+							"lte": snapshot.Format(time.RFC3339),
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// indexedBySnapshot matches documents indexed at or before the snapshot
+// bound by WithSnapshot
+func indexedBySnapshot(ctx context.Context) map[string]interface{} {
+	return map[string]interface{}{
+		"range": map[string]interface{}{
+			"indexed_at": map[string]interface{}{"lte": snapshotFrom(ctx).Format(time.RFC3339)},
+		},
+	}
+}
@@ -0,0 +1,153 @@
+package recommender
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestSigner(t *testing.T, key string) *CursorSigner {
+	t.Helper()
+	signer, err := NewCursorSigner([]byte(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestCursorSigner_RoundTrip(t *testing.T) {
+	signer := newTestSigner(t, "secret")
+	cursor := FeedCursor{SnapshotUs: 1700000000000000, Offset: 30, SeenHash: "abc123"}
+
+	token, err := signer.Encode(cursor)
+	if err != nil {
+		t.Fatalf("unexpected encode error: %v", err)
+	}
+	decoded, err := signer.Decode(token)
+	if err != nil {
+		t.Fatalf("unexpected decode error: %v", err)
+	}
+	if decoded != cursor {
+		t.Errorf("expected %+v, got %+v", cursor, decoded)
+	}
+}
+
+func TestCursorSigner_RejectsTampering(t *testing.T) {
+	signer := newTestSigner(t, "secret")
+	token, err := signer.Encode(FeedCursor{SnapshotUs: 1, Offset: 10})
+	if err != nil {
+		t.Fatalf("unexpected encode error: %v", err)
+	}
+	forged, err := newTestSigner(t, "other").Encode(FeedCursor{SnapshotUs: 1, Offset: 1000})
+	if err != nil {
+		t.Fatalf("unexpected encode error: %v", err)
+	}
+
+	tests := map[string]string{
+		"empty":          "",
+		"no signature":   "eyJ0IjoxfQ",
+		"wrong key":      forged,
+		"truncated sig":  token[:len(token)-2],
+		"garbage base64": "!!!." + token[len(token)-10:],
+	}
+	for name, bad := range tests {
+		if _, err := signer.Decode(bad); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: expected ErrInvalidCursor, got %v", name, err)
+		}
+	}
+}
+
+func TestNewCursorSigner_RejectsEmptySecret(t *testing.T) {
+	if _, err := NewCursorSigner(nil); err == nil {
+		t.Error("expected an error for an empty secret")
+	}
+}
+
+func TestHashSeen_OrderIndependent(t *testing.T) {
+	a := makeCandidates("a", 3)
+	reversed := []Candidate{a[2], a[1], a[0]}
+	if HashSeen(a) != HashSeen(reversed) {
+		t.Error("expected hash to ignore ordering")
+	}
+	if HashSeen(a) == HashSeen(a[:2]) {
+		t.Error("expected different sets to hash differently")
+	}
+}
+
+func TestPageSlate_WalksSlate(t *testing.T) {
+	slate := makeCandidates("p", 5)
+
+	page, next, err := PageSlate(slate, FeedCursor{}, 42, 2, candidateURI)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(page) != 2 || next == nil || next.Offset != 2 || next.SnapshotUs != 42 || next.Size != 0 {
+		t.Fatalf("unexpected first page: %d items, next=%+v", len(page), next)
+	}
+
+	page, next, err = PageSlate(slate, *next, 99, 2, candidateURI)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if page[0].AtURI != slate[2].AtURI || next.SnapshotUs != 42 {
+		t.Fatalf("expected second page to keep the original snapshot, got %+v", next)
+	}
+
+	page, next, err = PageSlate(slate, *next, 99, 2, candidateURI)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(page) != 1 || next != nil {
+		t.Errorf("expected final page of 1 with no cursor, got %d items, next=%+v", len(page), next)
+	}
+}
+
+func TestPageSlate_DetectsShiftedSlate(t *testing.T) {
+	slate := makeCandidates("p", 5)
+	_, next, err := PageSlate(slate, FeedCursor{}, 1, 2, candidateURI)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	shifted := append([]Candidate{{AtURI: "at://did:plc:new/app.bsky.feed.post/0"}}, slate...)
+	if _, _, err := PageSlate(shifted, *next, 1, 2, candidateURI); !errors.Is(err, ErrStaleCursor) {
+		t.Errorf("expected ErrStaleCursor, got %v", err)
+	}
+
+	if _, _, err := PageSlate(slate[:1], *next, 1, 2, candidateURI); !errors.Is(err, ErrStaleCursor) {
+		t.Errorf("expected ErrStaleCursor for offset past slate, got %v", err)
+	}
+}
+
+func TestPageSlate_CarriesSlateSize(t *testing.T) {
+	slate := makeCandidates("p", 5)
+	_, next, err := PageSlate(slate, FeedCursor{Size: 5}, 1, 2, candidateURI)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if next == nil || next.Size != 5 || next.SnapshotUs != 1 {
+		t.Fatalf("expected the slate size carried to the next page, got %+v", next)
+	}
+	if _, next, err = PageSlate(slate, *next, 99, 2, candidateURI); err != nil || next.Size != 5 {
+		t.Errorf("expected the slate size kept, got %+v, %v", next, err)
+	}
+}
+
+func TestPageSlate_RejectsEmptyPages(t *testing.T) {
+	for _, limit := range []int{0, -1} {
+		if _, _, err := PageSlate(makeCandidates("p", 5), FeedCursor{}, 1, limit, candidateURI); err == nil {
+			t.Errorf("expected an error for page size %d", limit)
+		}
+	}
+}
+
+func TestWithSnapshot(t *testing.T) {
+	snapshot := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	if got := snapshotFrom(WithSnapshot(context.Background(), snapshot)); !got.Equal(snapshot) {
+		t.Errorf("expected %v, got %v", snapshot, got)
+	}
+	if got := snapshotFrom(context.Background()); time.Since(got) > time.Minute {
+		t.Errorf("expected unbound context to default to now, got %v", got)
+	}
+}
@@ -0,0 +1,244 @@
+package recommender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// DegradationLevel records how much of the pipeline served a request: the
+// set of degradations that skipped work to stay within the latency budget.
+// A request can be degraded several ways at once, e.g. served from a reduced
+// pool without LLM scoring, so each degradation is its own bit.
+type DegradationLevel int
+
+// Degradations, combined with | when more than one applied
+const (
+	LevelFull        DegradationLevel = 0               // all stages completed
+	LevelNoLLM       DegradationLevel = 1 << (iota - 1) // LLM scoring skipped, retrieval order served
+	LevelReducedPool                                    // retrieval retried with a smaller candidate pool
+	LevelCachedSlate                                    // live pipeline failed, last cached slate served
+)
+
+// degradations lists every degradation in pipeline order
+var degradations = []DegradationLevel{LevelReducedPool, LevelNoLLM, LevelCachedSlate}
+
+// Has reports whether degradation d applied
+func (l DegradationLevel) Has(d DegradationLevel) bool {
+	return l&d != 0
+}
+
+// String returns the level name used in metrics and response headers;
+// combined degradations are joined with "+", e.g. "reduced_pool+no_llm"
+func (l DegradationLevel) String() string {
+	if l == LevelFull {
+		return "full"
+	}
+	var names []string
+	rest := l
+	for _, d := range degradations {
+		if l.Has(d) {
+			names = append(names, d.name())
+			rest &^= d
+		}
+	}
+	if rest != 0 {
+		return fmt.Sprintf("level_%d", int(l))
+	}
+	return strings.Join(names, "+")
+}
+
+func (l DegradationLevel) name() string {
+	switch l {
+	case LevelNoLLM:
+		return "no_llm"
+	case LevelReducedPool:
+		return "reduced_pool"
+	default:
+		return "cached_slate"
+	}
+}
+
+// StageBudgets are per-stage timeouts. A zero budget means no timeout.
+type StageBudgets struct {
+	Retrieval time.Duration
+	Scoring   time.Duration
+}
+
+// Stages are the pluggable steps of slate construction
+type Stages struct {
+	// Retrieve fetches up to poolSize candidates for the user
+	Retrieve func(ctx context.Context, userDID string, poolSize int) ([]Candidate, error)
+	// Score reorders candidates; optional
+	Score ScoreFunc
+	// Cached returns the last slate served to the user, if any; optional
+	Cached func(userDID string) ([]Candidate, bool)
+	// Guard drops candidates deleted since they were indexed, from live and
+	// cached slates alike; optional
+	Guard *common.TombstoneGuard
+	// Accounts drops candidates by inactive (e.g. deactivated) accounts
+	// from live and cached slates in drop mode; optional
+	Accounts *common.AccountFilter
+	// Blocks drops candidates by accounts the user blocked or muted, or
+	// that blocked the user, from live and cached slates; optional
+	Blocks *BlockCache
+	// Guardrails drop live candidates by accounts too new or inactive for
+	// the request's experiment arm, before scoring; optional
+	Guardrails *Guardrails
+	// Filter drops live candidates whose posts break the configured
+	// post-filter rules, after scoring; optional
+	Filter *PostFilter
+}
+
+// postTombstonesAlias is where the tombstones of candidate posts are indexed
+const postTombstonesAlias = "post_tombstones"
+
+// DegradingPipeline runs slate construction under per-stage latency budgets,
+// falling back to cheaper paths instead of failing the request
+type DegradingPipeline struct {
+	stages          Stages
+	budgets         StageBudgets
+	poolSize        int
+	reducedPoolSize int
+	logger          *common.IngestLogger
+}
+
+// NewDegradingPipeline creates a pipeline. reducedPoolSize is used when
+// retrieval at poolSize misses its budget; it defaults to a quarter of poolSize.
+func NewDegradingPipeline(stages Stages, budgets StageBudgets, poolSize, reducedPoolSize int, logger *common.IngestLogger) *DegradingPipeline {
+	if reducedPoolSize <= 0 || reducedPoolSize >= poolSize {
+		reducedPoolSize = max(poolSize/4, 1)
+	}
+	return &DegradingPipeline{
+		stages:          stages,
+		budgets:         budgets,
+		poolSize:        poolSize,
+		reducedPoolSize: reducedPoolSize,
+		logger:          logger,
+	}
+}
+
+// Serve builds a slate of up to limit candidates and reports the degradation
+// level that served it. Candidates carry an Explanation when ctx asks for
+// explanations (see WithExplain). An error is returned only when retrieval fails at
+// every pool size and no cached slate exists, or when a strict tombstone
+// guard cannot check the slate.
+func (p *DegradingPipeline) Serve(ctx context.Context, userDID string, limit int) ([]Candidate, DegradationLevel, error) {
+	start := time.Now()
+	level := LevelFull
+
+	candidates, err := p.retrieve(ctx, userDID, p.poolSize)
+	if err != nil {
+		p.logger.Error("Retrieval failed for %s at pool size %d, shrinking pool: %v", userDID, p.poolSize, err)
+		level |= LevelReducedPool
+		if ctx.Err() != nil {
+			// The caller gave up; a smaller pool won't be served either
+			p.logger.Metric("recommender.serve.errors", 1)
+			return nil, level, fmt.Errorf("retrieval canceled: %w", ctx.Err())
+		}
+		candidates, err = p.retrieve(ctx, userDID, p.reducedPoolSize)
+	}
+	if err != nil {
+		p.logger.Error("Retrieval failed for %s at reduced pool size %d: %v", userDID, p.reducedPoolSize, err)
+		if p.stages.Cached != nil {
+			if cached, ok := p.stages.Cached(userDID); ok {
+				cached, guardErr := p.guard(ctx, userDID, cached)
+				if guardErr != nil {
+					p.logger.Metric("recommender.serve.errors", 1)
+					return nil, LevelCachedSlate, guardErr
+				}
+				p.record(LevelCachedSlate, start)
+				return explainSlate(ctx, cached[:min(limit, len(cached))], LevelCachedSlate), LevelCachedSlate, nil
+			}
+		}
+		p.logger.Metric("recommender.serve.errors", 1)
+		return nil, level, fmt.Errorf("retrieval failed and no cached slate available: %w", err)
+	}
+	candidates = explainRetrieved(ctx, candidates)
+
+	candidates, err = p.guard(ctx, userDID, candidates)
+	if err != nil {
+		p.logger.Metric("recommender.serve.errors", 1)
+		return nil, level, err
+	}
+	candidates = p.stages.Guardrails.Filter(ctx, candidates)
+
+	if p.stages.Score != nil {
+		scored, err := p.score(ctx, userDID, candidates)
+		if err != nil {
+			p.logger.Error("Scoring failed for %s, serving retrieval order: %v", userDID, err)
+			level |= LevelNoLLM
+		} else {
+			candidates = scored
+		}
+	}
+	candidates = p.stages.Filter.Filter(ctx, candidates)
+
+	p.record(level, start)
+	return explainSlate(ctx, candidates[:min(limit, len(candidates))], level), level, nil
+}
+
+func (p *DegradingPipeline) retrieve(ctx context.Context, userDID string, poolSize int) ([]Candidate, error) {
+	stageCtx, cancel := withBudget(ctx, p.budgets.Retrieval)
+	defer cancel()
+	candidates, err := p.stages.Retrieve(stageCtx, userDID, poolSize)
+	if err == nil && stageCtx.Err() != nil {
+		err = stageCtx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		p.logger.Metric("recommender.retrieval.timeout_count", 1)
+	}
+	return candidates, err
+}
+
+func (p *DegradingPipeline) score(ctx context.Context, userDID string, candidates []Candidate) ([]Candidate, error) {
+	stageCtx, cancel := withBudget(ctx, p.budgets.Scoring)
+	defer cancel()
+	scored, err := p.stages.Score(stageCtx, userDID, candidates)
+	if err == nil && stageCtx.Err() != nil {
+		err = stageCtx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		p.logger.Metric("recommender.scoring.timeout_count", 1)
+	}
+	return scored, err
+}
+
+// guard drops deleted candidates, those by inactive accounts, and those by
+// accounts hidden from the user, before they are scored or served
+func (p *DegradingPipeline) guard(ctx context.Context, userDID string, candidates []Candidate) ([]Candidate, error) {
+	candidates, err := common.FilterTombstoned(ctx, p.stages.Guard, postTombstonesAlias, candidates, func(c Candidate) string {
+		return c.AtURI
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Slates have nowhere to flag a candidate, so flag mode keeps them as is
+	candidates = common.FilterInactiveAccounts(ctx, p.stages.Accounts, candidates, candidateAuthor, nil)
+	return p.stages.Blocks.Filter(ctx, userDID, candidates), nil
+}
+
+func (p *DegradingPipeline) record(level DegradationLevel, start time.Time) {
+	p.logger.Metric("recommender.serve.duration_ms", float64(time.Since(start).Milliseconds()))
+	if level == LevelFull {
+		p.logger.Metric("recommender.degradation.full_count", 1)
+		return
+	}
+	// One count per degradation, so combined levels show up under each
+	for _, d := range degradations {
+		if level.Has(d) {
+			p.logger.Metric("recommender.degradation."+d.name()+"_count", 1)
+		}
+	}
+}
+
+func withBudget(ctx context.Context, budget time.Duration) (context.Context, context.CancelFunc) {
+	if budget <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, budget)
+}
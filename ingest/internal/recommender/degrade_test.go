@@ -0,0 +1,299 @@
+package recommender
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func retrieveN(n int) func(context.Context, string, int) ([]Candidate, error) {
+	return func(_ context.Context, _ string, poolSize int) ([]Candidate, error) {
+		return makeCandidates("r", min(n, poolSize)), nil
+	}
+}
+
+func blockUntilDone(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestDegradingPipeline_Full(t *testing.T) {
+	stages := Stages{
+		Retrieve: retrieveN(100),
+		Score: func(_ context.Context, _ string, candidates []Candidate) ([]Candidate, error) {
+			return []Candidate{candidates[1], candidates[0]}, nil
+		},
+	}
+	p := NewDegradingPipeline(stages, StageBudgets{}, 100, 0, common.NewLogger(false))
+
+	slate, level, err := p.Serve(context.Background(), "did:plc:viewer", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if level != LevelFull {
+		t.Errorf("expected LevelFull, got %s", level)
+	}
+	if len(slate) != 2 {
+		t.Errorf("expected scored slate, got %d candidates", len(slate))
+	}
+}
+
+func TestDegradingPipeline_ScoringTimeoutSkipsLLM(t *testing.T) {
+	stages := Stages{
+		Retrieve: retrieveN(20),
+		Score: func(ctx context.Context, _ string, _ []Candidate) ([]Candidate, error) {
+			return nil, blockUntilDone(ctx)
+		},
+	}
+	p := NewDegradingPipeline(stages, StageBudgets{Scoring: 10 * time.Millisecond}, 100, 0, common.NewLogger(false))
+
+	slate, level, err := p.Serve(context.Background(), "did:plc:viewer", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if level != LevelNoLLM {
+		t.Errorf("expected LevelNoLLM, got %s", level)
+	}
+	if len(slate) != 10 {
+		t.Errorf("expected retrieval-order slate of 10, got %d", len(slate))
+	}
+}
+
+func TestDegradingPipeline_ShrinksPoolOnRetrievalTimeout(t *testing.T) {
+	var pools []int
+	stages := Stages{
+		Retrieve: func(ctx context.Context, _ string, poolSize int) ([]Candidate, error) {
+			pools = append(pools, poolSize)
+			if poolSize > 25 {
+				return nil, blockUntilDone(ctx)
+			}
+			return makeCandidates("r", poolSize), nil
+		},
+	}
+	p := NewDegradingPipeline(stages, StageBudgets{Retrieval: 10 * time.Millisecond}, 100, 0, common.NewLogger(false))
+
+	slate, level, err := p.Serve(context.Background(), "did:plc:viewer", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if level != LevelReducedPool {
+		t.Errorf("expected LevelReducedPool, got %s", level)
+	}
+	if len(pools) != 2 || pools[1] != 25 {
+		t.Errorf("expected retry at a quarter of the pool, got %v", pools)
+	}
+	if len(slate) != 10 {
+		t.Errorf("expected slate of 10, got %d", len(slate))
+	}
+}
+
+func TestDegradingPipeline_ReportsReducedPoolAndSkippedLLM(t *testing.T) {
+	stages := Stages{
+		Retrieve: func(ctx context.Context, _ string, poolSize int) ([]Candidate, error) {
+			if poolSize > 25 {
+				return nil, blockUntilDone(ctx)
+			}
+			return makeCandidates("r", poolSize), nil
+		},
+		Score: func(ctx context.Context, _ string, _ []Candidate) ([]Candidate, error) {
+			return nil, blockUntilDone(ctx)
+		},
+	}
+	metrics := &guardrailMetrics{sums: map[string]float64{}}
+	logger := common.NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(metrics)
+	p := NewDegradingPipeline(stages, StageBudgets{Retrieval: 10 * time.Millisecond, Scoring: 10 * time.Millisecond}, 100, 0, logger)
+
+	_, level, err := p.Serve(context.Background(), "did:plc:viewer", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if level != LevelReducedPool|LevelNoLLM || !level.Has(LevelNoLLM) {
+		t.Errorf("expected reduced_pool+no_llm, got %s", level)
+	}
+	if metrics.Sum("recommender.degradation.reduced_pool_count") != 1 || metrics.Sum("recommender.degradation.no_llm_count") != 1 {
+		t.Errorf("expected both degradations counted, got %v", metrics.sums)
+	}
+}
+
+func TestDegradingPipeline_DoesNotRetryAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var pools []int
+	stages := Stages{
+		Retrieve: func(ctx context.Context, _ string, poolSize int) ([]Candidate, error) {
+			pools = append(pools, poolSize)
+			cancel()
+			return nil, ctx.Err()
+		},
+		Cached: func(string) ([]Candidate, bool) {
+			return makeCandidates("cached", 3), true
+		},
+	}
+	p := NewDegradingPipeline(stages, StageBudgets{}, 100, 10, common.NewLogger(false))
+
+	if _, _, err := p.Serve(ctx, "did:plc:viewer", 10); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancellation returned, got %v", err)
+	}
+	if len(pools) != 1 {
+		t.Errorf("expected no retry after the caller gave up, got pools %v", pools)
+	}
+}
+
+func TestDegradingPipeline_FallsBackToCache(t *testing.T) {
+	stages := Stages{
+		Retrieve: func(context.Context, string, int) ([]Candidate, error) {
+			return nil, errors.New("es unavailable")
+		},
+		Cached: func(string) ([]Candidate, bool) {
+			return makeCandidates("cached", 3), true
+		},
+	}
+	p := NewDegradingPipeline(stages, StageBudgets{}, 100, 10, common.NewLogger(false))
+
+	slate, level, err := p.Serve(context.Background(), "did:plc:viewer", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if level != LevelCachedSlate || len(slate) != 3 {
+		t.Errorf("expected cached slate of 3, got %s with %d", level, len(slate))
+	}
+}
+
+func TestDegradingPipeline_GuardDropsDeletedCandidates(t *testing.T) {
+	deleted := makeCandidates("r", 2)[1].AtURI
+	client := estest.NewClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"hits":{"hits":[{"_source":{"at_uri":"` + deleted + `"}}]}}`))
+	})
+	guard, err := common.NewTombstoneGuard(client, common.TombstoneGuardStrict, common.NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var retrieveErr error
+	stages := Stages{
+		Retrieve: func(_ context.Context, _ string, poolSize int) ([]Candidate, error) {
+			return makeCandidates("r", min(3, poolSize)), retrieveErr
+		},
+		Cached: func(string) ([]Candidate, bool) {
+			return makeCandidates("r", 3), true
+		},
+		Guard: guard,
+	}
+	p := NewDegradingPipeline(stages, StageBudgets{}, 100, 10, common.NewLogger(false))
+
+	for _, name := range []string{"live", "cached"} {
+		if name == "cached" {
+			retrieveErr = errors.New("es unavailable")
+		}
+		slate, _, err := p.Serve(context.Background(), "did:plc:viewer", 10)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if len(slate) != 2 {
+			t.Fatalf("%s: expected 2 candidates, got %d", name, len(slate))
+		}
+		for _, c := range slate {
+			if c.AtURI == deleted {
+				t.Errorf("%s: deleted candidate %s was served", name, deleted)
+			}
+		}
+	}
+}
+
+func TestDegradingPipeline_AccountsDropsInactiveAuthors(t *testing.T) {
+	client := estest.NewClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"docs":[{"found":true,"_source":{"did":"did:plc:gone","status":"deactivated","active":false}},{"found":false}]}`))
+	})
+	accounts, err := common.NewAccountFilter(client, common.InactiveAccountsDrop, common.NewLogger(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stages := Stages{
+		Retrieve: func(_ context.Context, _ string, poolSize int) ([]Candidate, error) {
+			candidates := makeCandidates("r", min(3, poolSize))
+			candidates[1].AuthorDID = "did:plc:gone"
+			return candidates, nil
+		},
+		Accounts: accounts,
+	}
+	p := NewDegradingPipeline(stages, StageBudgets{}, 100, 10, common.NewLogger(false))
+
+	slate, _, err := p.Serve(context.Background(), "did:plc:viewer", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(slate) != 2 {
+		t.Fatalf("expected 2 candidates, got %d", len(slate))
+	}
+	for _, c := range slate {
+		if c.AuthorDID == "did:plc:gone" {
+			t.Errorf("candidate %s by a deactivated account was served", c.AtURI)
+		}
+	}
+}
+
+func TestDegradingPipeline_BlocksDropHiddenAuthorsFromCachedSlate(t *testing.T) {
+	blocks := NewBlockCache(estest.New(t).Client, common.BlocksIndex, time.Minute, common.NewLogger(false))
+	cached := makeCandidates("c", 3)
+	cached[0].AuthorDID = "did:plc:blocked"
+	stages := Stages{
+		Retrieve: func(context.Context, string, int) ([]Candidate, error) {
+			return nil, errors.New("retrieval down")
+		},
+		Cached: func(string) ([]Candidate, bool) { return cached, true },
+		Blocks: blocks,
+	}
+	p := NewDegradingPipeline(stages, StageBudgets{}, 100, 10, common.NewLogger(false))
+
+	// Blocked after the slate was cached
+	blocks.Observe(blockEvent("did:plc:blocked", "b1", "did:plc:viewer"))
+	slate, level, err := p.Serve(context.Background(), "did:plc:viewer", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if level != LevelCachedSlate || len(slate) != 2 {
+		t.Fatalf("expected 2 cached candidates, got %d at %s", len(slate), level)
+	}
+	for _, c := range slate {
+		if c.AuthorDID == "did:plc:blocked" {
+			t.Errorf("candidate %s by an account that blocked the viewer was served", c.AtURI)
+		}
+	}
+}
+
+func TestDegradingPipeline_ErrorsWithoutCache(t *testing.T) {
+	stages := Stages{
+		Retrieve: func(context.Context, string, int) ([]Candidate, error) {
+			return nil, errors.New("es unavailable")
+		},
+	}
+	p := NewDegradingPipeline(stages, StageBudgets{}, 100, 10, common.NewLogger(false))
+
+	if _, _, err := p.Serve(context.Background(), "did:plc:viewer", 10); err == nil {
+		t.Error("expected error when retrieval fails with no cached slate")
+	}
+}
+
+func TestDegradationLevel_String(t *testing.T) {
+	tests := map[DegradationLevel]string{
+		LevelFull:                     "full",
+		LevelNoLLM:                    "no_llm",
+		LevelReducedPool:              "reduced_pool",
+		LevelCachedSlate:              "cached_slate",
+		LevelReducedPool | LevelNoLLM: "reduced_pool+no_llm",
+		DegradationLevel(9):           "level_9",
+	}
+	for level, want := range tests {
+		if got := level.String(); got != want {
+			t.Errorf("expected %q, got %q", want, got)
+		}
+	}
+}
@@ -0,0 +1,642 @@
+package recommender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/features"
+)
+
+// Candidate sources RecommendMostEngagingPosts ranks
+const (
+	EngagementSourceTrending = "trending" // most-liked recent posts
+	EngagementSourceSimilar  = "similar"  // recent posts nearest the user's interest vector
+)
+
+// Strategy names recorded on candidates ranked by engagement
+const (
+	StrategyEngagementTrending = "engagement_trending"
+	StrategyEngagementSimilar  = "engagement_similar"
+)
+
+const (
+	// engagementPoolFactor is how many candidates are retrieved per slate
+	// position, so ranking has posts to choose between
+	engagementPoolFactor = 5
+	// engagementMaxPool bounds the candidates retrieved for one slate
+	engagementMaxPool = 1000
+	// MaxEngagementPosts bounds the posts one prediction or slate covers
+	MaxEngagementPosts = 500
+)
+
+// interestEmbeddingField is the posts field a user's interest vector is
+// averaged from and compared with
+const interestEmbeddingField = "embeddings." + features.InterestEmbeddingModel
+
+// EngagementWeights are the coefficients of the engagement model, a
+// logistic regression over a post's features:
+//
+//	p = sigmoid(Bias + Popularity*ln(1+like_count) + Recency*recency + Similarity*similarity + Affinity*author_affinity)
+type EngagementWeights struct {
+	Bias       float64 `json:"bias"`
+	Popularity float64 `json:"popularity"`
+	Recency    float64 `json:"recency"`
+	Similarity float64 `json:"similarity"`
+	Affinity   float64 `json:"affinity"`
+}
+
+// DefaultEngagementWeights are hand-set priors that rank popular, fresh posts
+// close to the user's interests highly. They are not fitted to engagement.
+var DefaultEngagementWeights = EngagementWeights{
+	Bias:       -4,
+	Popularity: 0.5,
+	Recency:    1,
+	Similarity: 3,
+	Affinity:   2,
+}
+
+// Validate reports weights that are not finite numbers
+func (w EngagementWeights) Validate() error {
+	for name, v := range map[string]float64{"bias": w.Bias, "popularity": w.Popularity, "recency": w.Recency, "similarity": w.Similarity, "affinity": w.Affinity} {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("invalid %s weight %v", name, v)
+		}
+	}
+	return nil
+}
+
+// EngagementFeatures are the inputs the engagement model scores a post on
+type EngagementFeatures struct {
+	LikeCount      int     `json:"like_count"`
+	AgeHours       float64 `json:"age_hours"`
+	Recency        float64 `json:"recency"`         // 2^(-age / half-life): 1 for a new post, 0.5 at the half-life
+	Similarity     float64 `json:"similarity"`      // Cosine similarity of the post's embedding to the user's interest vector; 0 without either
+	AuthorAffinity float64 `json:"author_affinity"` // Share of the user's recent likes that went to the post's author
+}
+
+// EngagementPrediction is the predicted probability that a user engages with
+// a post
+type EngagementPrediction struct {
+	AtURI       string             `json:"at_uri"`
+	AuthorDID   string             `json:"author_did,omitempty"`
+	Probability float64            `json:"probability"`
+	Features    EngagementFeatures `json:"features"`
+	Strategy    string             `json:"strategy,omitempty"` // Source that proposed the post, for slates
+	Missing     bool               `json:"missing,omitempty"`  // The post is not in the posts index; its probability is 0
+}
+
+// EngagementConfig configures an EngagementModel. Zero values use defaults.
+type EngagementConfig struct {
+	PostsIndex   string            // Alias posts are read from (default: posts)
+	RepliesIndex string            // Alias a user's replies are read from (default: replies)
+	LikesIndex   string            // Alias a user's likes are read from (default: likes)
+	FollowsIndex string            // Alias a user's follows are read from (default: follows)
+	Window       time.Duration     // Lookback for candidate posts (default: 24h)
+	HalfLife     time.Duration     // Age at which a post's recency halves (default: 6h)
+	HistorySize  int               // A user's most recent likes, and posts and replies, their profile is built from (default: 200)
+	Weights      EngagementWeights // Weights used when a request sets none (default: DefaultEngagementWeights)
+	// ColdStart blends the feed candidates of users without likes or
+	// follows (see Retrieve); nil retrieves theirs from the request's source
+	ColdStart *ColdStartBlender
+}
+
+// EngagementModel predicts how likely users are to engage with posts from
+// the features already indexed: like_count, post age, post embeddings, and
+// the user's likes and posts
+type EngagementModel struct {
+	client *elasticsearch.Client
+	config EngagementConfig
+	logger *common.IngestLogger
+}
+
+// NewEngagementModel creates a model reading from client
+func NewEngagementModel(client *elasticsearch.Client, config EngagementConfig, logger *common.IngestLogger) *EngagementModel {
+	if config.PostsIndex == "" {
+		config.PostsIndex = "posts"
+	}
+	if config.RepliesIndex == "" {
+		config.RepliesIndex = "replies"
+	}
+	if config.LikesIndex == "" {
+		config.LikesIndex = "likes"
+	}
+	if config.FollowsIndex == "" {
+		config.FollowsIndex = "follows"
+	}
+	if config.Window <= 0 {
+		config.Window = 24 * time.Hour
+	}
+	if config.HalfLife <= 0 {
+		config.HalfLife = 6 * time.Hour
+	}
+	if config.HistorySize <= 0 {
+		config.HistorySize = 200
+	}
+	if config.Weights == (EngagementWeights{}) {
+		config.Weights = DefaultEngagementWeights
+	}
+	return &EngagementModel{client: client, config: config, logger: logger}
+}
+
+// userProfile is what a user's recent likes say about them
+type userProfile struct {
+	liked    map[string]bool    // Posts the user liked
+	authors  map[string]float64 // Share of the user's likes per author
+	interest []float32          // Mean embedding of the user's recent posts and replies; nil if none had one
+}
+
+// engagementPost is the subset of a post document the model scores
+type engagementPost struct {
+	AtURI      string               `json:"at_uri"`
+	AuthorDID  string               `json:"author_did"`
+	CreatedAt  string               `json:"created_at"`
+	LikeCount  int                  `json:"like_count"`
+	Embeddings map[string][]float32 `json:"embeddings,omitempty"`
+}
+
+// PredictEngagement returns the probability that userDID engages with each
+// of atURIs, in the order given. Posts not found are returned with Missing
+// set. An empty userDID predicts for a user with no history.
+func (m *EngagementModel) PredictEngagement(ctx context.Context, userDID string, atURIs []string) ([]EngagementPrediction, error) {
+	if len(atURIs) > MaxEngagementPosts {
+		return nil, fmt.Errorf("too many posts: %d (at most %d)", len(atURIs), MaxEngagementPosts)
+	}
+	start := time.Now()
+	profile, err := m.profile(ctx, userDID)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := m.lookupPosts(ctx, atURIs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := snapshotFrom(ctx)
+	predictions := make([]EngagementPrediction, 0, len(atURIs))
+	for _, uri := range atURIs {
+		post, found := posts[uri]
+		if !found {
+			predictions = append(predictions, EngagementPrediction{AtURI: uri, AuthorDID: common.ExtractDIDFromATURI(uri), Missing: true})
+			continue
+		}
+		predictions = append(predictions, m.predict(post, profile, m.config.Weights, now))
+	}
+	m.logger.Metric("recommender.engagement.predict.duration_ms", float64(time.Since(start).Milliseconds()))
+	m.logger.Metric("recommender.engagement.predict.posts_count", float64(len(atURIs)))
+	return predictions, nil
+}
+
+// RecommendMostEngagingPosts retrieves candidates from source, scores them
+// for userDID with weights (nil uses the configured weights), and returns
+// the slateSize most likely to be engaged with, most likely first. Posts the
+// user liked or wrote are left out. A user without an interest vector is
+// served trending candidates for the similar source.
+func (m *EngagementModel) RecommendMostEngagingPosts(ctx context.Context, userDID, source string, slateSize int, weights *EngagementWeights) ([]EngagementPrediction, error) {
+	if slateSize <= 0 || slateSize > MaxEngagementPosts {
+		return nil, fmt.Errorf("invalid slate size %d (must be from 1 to %d)", slateSize, MaxEngagementPosts)
+	}
+	w := m.config.Weights
+	if weights != nil {
+		if err := weights.Validate(); err != nil {
+			return nil, err
+		}
+		w = *weights
+	}
+	if err := validateEngagementSource(source); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	poolSize := min(slateSize*engagementPoolFactor, engagementMaxPool)
+	candidates, profile, err := m.retrieve(ctx, userDID, source, poolSize)
+	if err != nil {
+		return nil, err
+	}
+	uris := make([]string, 0, len(candidates))
+	strategies := make(map[string]string, len(candidates))
+	for _, c := range candidates {
+		uris = append(uris, c.AtURI)
+		strategies[c.AtURI] = c.Strategy
+	}
+	posts, err := m.lookupPosts(ctx, uris)
+	if err != nil {
+		return nil, err
+	}
+
+	now := snapshotFrom(ctx)
+	slate := make([]EngagementPrediction, 0, len(posts))
+	for _, uri := range uris {
+		post, found := posts[uri]
+		if !found {
+			continue // Deleted or expired since retrieval
+		}
+		prediction := m.predict(post, profile, w, now)
+		prediction.Strategy = strategies[uri]
+		slate = append(slate, prediction)
+	}
+	sort.SliceStable(slate, func(i, j int) bool {
+		return slate[i].Probability > slate[j].Probability
+	})
+	slate = slate[:min(slateSize, len(slate))]
+
+	m.logger.Metric("recommender.engagement.recommend.duration_ms", float64(time.Since(start).Milliseconds()))
+	m.logger.Metric("recommender.engagement.slate_size", float64(len(slate)))
+	return slate, nil
+}
+
+// Retrieve returns up to poolSize distinct candidates for userDID from
+// source, leaving out posts the user liked or wrote. Users without likes or
+// follows (see IsColdStart), and requests without a user, are served the
+// configured cold-start blend instead, when there is one. It is the
+// retrieval stage of a feed slate (see Stages.Retrieve).
+func (m *EngagementModel) Retrieve(ctx context.Context, userDID, source string, poolSize int) ([]Candidate, error) {
+	if err := validateEngagementSource(source); err != nil {
+		return nil, err
+	}
+	if m.config.ColdStart != nil {
+		history, err := m.history(ctx, userDID)
+		if err != nil {
+			return nil, err
+		}
+		if IsColdStart(history) {
+			m.logger.Metric("recommender.cold_start.served_count", 1)
+			blended, err := m.config.ColdStart.Blend(ctx, poolSize)
+			if err != nil {
+				return nil, err
+			}
+			kept := make([]Candidate, 0, len(blended))
+			for _, c := range blended {
+				if userDID == "" || c.AuthorDID != userDID {
+					kept = append(kept, c)
+				}
+			}
+			return kept, nil
+		}
+	}
+	candidates, _, err := m.retrieve(ctx, userDID, source, poolSize)
+	return candidates, err
+}
+
+// history reports whether userDID has likes and follows indexed by the
+// snapshot. Each count is at most 1, which is all IsColdStart needs, and
+// follows are only read for users without likes.
+func (m *EngagementModel) history(ctx context.Context, userDID string) (UserHistory, error) {
+	var history UserHistory
+	if userDID == "" {
+		return history, nil
+	}
+	for _, source := range []struct {
+		index string
+		count *int
+	}{{m.config.LikesIndex, &history.LikeCount}, {m.config.FollowsIndex, &history.FollowCount}} {
+		query := map[string]interface{}{
+			"query":   authoredBySnapshot(ctx, userDID),
+			"_source": false,
+			"size":    1,
+		}
+		var hits []struct {
+			ID string `json:"_id"`
+		}
+		if err := searchHits(ctx, m.client, source.index, query, "es.recommender_cold_start_history", &hits, m.logger); err != nil {
+			return history, fmt.Errorf("failed to read %s of %s: %w", source.index, userDID, err)
+		}
+		if *source.count = len(hits); *source.count > 0 {
+			break
+		}
+	}
+	return history, nil
+}
+
+// ScoreFunc returns a score function for the slate pipeline (see
+// Stages.Score) that orders candidates by the probability the user engages
+// with them under weights (nil uses the configured weights), most likely
+// first. Candidates whose posts are no longer indexed are dropped.
+func (m *EngagementModel) ScoreFunc(weights *EngagementWeights) ScoreFunc {
+	w := m.config.Weights
+	if weights != nil {
+		w = *weights
+	}
+	return func(ctx context.Context, userDID string, candidates []Candidate) ([]Candidate, error) {
+		profile, err := m.profile(ctx, userDID)
+		if err != nil {
+			return nil, err
+		}
+		posts, err := m.lookupPosts(ctx, atURIs(candidates))
+		if err != nil {
+			return nil, err
+		}
+
+		now := snapshotFrom(ctx)
+		scored := make([]Candidate, 0, len(candidates))
+		for _, c := range candidates {
+			post, found := posts[c.AtURI]
+			if !found {
+				continue // Deleted or expired since retrieval
+			}
+			prediction := m.predict(post, profile, w, now)
+			c.Score = prediction.Probability
+			ExplainComponent(ctx, &c, "engagement_probability", prediction.Probability)
+			ExplainFeature(ctx, &c, "like_count", float64(prediction.Features.LikeCount))
+			ExplainFeature(ctx, &c, "recency", prediction.Features.Recency)
+			ExplainFeature(ctx, &c, "similarity", prediction.Features.Similarity)
+			ExplainFeature(ctx, &c, "author_affinity", prediction.Features.AuthorAffinity)
+			scored = append(scored, c)
+		}
+		sort.SliceStable(scored, func(i, j int) bool {
+			return scored[i].Score > scored[j].Score
+		})
+		return scored, nil
+	}
+}
+
+// FeedPoolSize returns how many candidates are retrieved for a feed slate
+// of slateSize: as many as RecommendMostEngagingPosts ranks, or, for slates
+// scored by the LLM, as many as RecommendHighestScoringLLMPosts scores
+func FeedPoolSize(slateSize int, llm bool) int {
+	if llm {
+		return min(slateSize*llmPoolFactor, MaxLLMPosts)
+	}
+	return min(slateSize*engagementPoolFactor, engagementMaxPool)
+}
+
+// validateEngagementSource reports a source RecommendMostEngagingPosts does
+// not know
+func validateEngagementSource(source string) error {
+	if source != EngagementSourceTrending && source != EngagementSourceSimilar {
+		return fmt.Errorf("unknown source %q (expected %s or %s)", source, EngagementSourceTrending, EngagementSourceSimilar)
+	}
+	return nil
+}
+
+// retrieve returns up to poolSize distinct candidates for userDID from
+// source, leaving out posts the user liked or wrote, and the user's profile
+func (m *EngagementModel) retrieve(ctx context.Context, userDID, source string, poolSize int) ([]Candidate, userProfile, error) {
+	profile, err := m.profile(ctx, userDID)
+	if err != nil {
+		return nil, profile, err
+	}
+	candidates, err := m.candidates(ctx, source, profile, poolSize)
+	if err != nil {
+		return nil, profile, err
+	}
+
+	kept := make([]Candidate, 0, len(candidates))
+	for _, c := range dedupeCandidates(candidates) {
+		if profile.liked[c.AtURI] || (userDID != "" && c.AuthorDID == userDID) {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept, profile, nil
+}
+
+// candidates retrieves up to poolSize candidates from source
+func (m *EngagementModel) candidates(ctx context.Context, source string, profile userProfile, poolSize int) ([]Candidate, error) {
+	if source == EngagementSourceSimilar && profile.interest != nil {
+		hits, err := common.KNNSearch(ctx, m.client, m.config.PostsIndex, common.KNNQuery{
+			Field:  interestEmbeddingField,
+			Vector: profile.interest,
+			K:      poolSize,
+			Filter: snapshotFilter(ctx, m.config.Window),
+			Metric: "es.recommender_engagement_similar",
+		}, m.logger)
+		if err != nil {
+			return nil, fmt.Errorf("similar posts search failed: %w", err)
+		}
+		candidates := make([]Candidate, 0, len(hits))
+		for _, hit := range hits {
+			candidates = append(candidates, Candidate{AtURI: hit.Post.AtURI, AuthorDID: hit.Post.AuthorDID, Score: hit.Score, Strategy: StrategyEngagementSimilar})
+		}
+		return candidates, nil
+	}
+	if source == EngagementSourceSimilar {
+		m.logger.Metric("recommender.engagement.cold_start_count", 1)
+	}
+
+	candidates, err := NewTrendingSource(m.client, m.config.PostsIndex, m.config.Window, m.logger).Candidates(ctx, poolSize)
+	if err != nil {
+		return nil, fmt.Errorf("trending posts search failed: %w", err)
+	}
+	for i := range candidates {
+		candidates[i].Strategy = StrategyEngagementTrending
+	}
+	return candidates, nil
+}
+
+// predict scores post for the user described by profile
+func (m *EngagementModel) predict(post engagementPost, profile userProfile, w EngagementWeights, now time.Time) EngagementPrediction {
+	f := EngagementFeatures{LikeCount: post.LikeCount, Recency: 1}
+	if createdAt, err := time.Parse(time.RFC3339, post.CreatedAt); err == nil {
+		age := max(now.Sub(createdAt), 0)
+		f.AgeHours = age.Hours()
+		f.Recency = math.Exp2(-age.Hours() / m.config.HalfLife.Hours())
+	}
+	f.Similarity = cosineSimilarity(profile.interest, post.Embeddings[features.InterestEmbeddingModel])
+	f.AuthorAffinity = profile.authors[post.AuthorDID]
+
+	logit := w.Bias +
+		w.Popularity*math.Log1p(float64(max(post.LikeCount, 0))) +
+		w.Recency*f.Recency +
+		w.Similarity*f.Similarity +
+		w.Affinity*f.AuthorAffinity
+	return EngagementPrediction{
+		AtURI:       post.AtURI,
+		AuthorDID:   post.AuthorDID,
+		Probability: 1 / (1 + math.Exp(-logit)),
+		Features:    f,
+	}
+}
+
+// profile builds userDID's profile from their most recent likes, and their
+// interest vector from their most recent posts and replies
+func (m *EngagementModel) profile(ctx context.Context, userDID string) (userProfile, error) {
+	profile := userProfile{liked: make(map[string]bool), authors: make(map[string]float64)}
+	if userDID == "" {
+		return profile, nil
+	}
+
+	query := map[string]interface{}{
+		"query": authoredBySnapshot(ctx, userDID),
+		"sort": []interface{}{
+			map[string]interface{}{"created_at": "desc"},
+		},
+		"_source": []string{"subject_uri"},
+		"size":    m.config.HistorySize,
+	}
+	var likes []struct {
+		Source common.LikeData `json:"_source"`
+	}
+	if err := searchHits(ctx, m.client, m.config.LikesIndex, query, "es.recommender_engagement_likes", &likes, m.logger); err != nil {
+		return profile, fmt.Errorf("failed to read likes of %s: %w", userDID, err)
+	}
+
+	for _, like := range likes {
+		uri := like.Source.SubjectURI
+		if uri == "" || profile.liked[uri] {
+			continue
+		}
+		profile.liked[uri] = true
+		if author := common.ExtractDIDFromATURI(uri); author != "" {
+			profile.authors[author]++
+		}
+	}
+	for author, count := range profile.authors {
+		profile.authors[author] = count / float64(len(profile.liked))
+	}
+
+	interest, err := m.interestVector(ctx, userDID)
+	if err != nil {
+		return profile, err
+	}
+	profile.interest = interest
+	return profile, nil
+}
+
+// interestVector returns the interest vector of userDID, or nil if none of
+// their posts has an embedding. It is computed by features.UserAccumulator
+// from their most recent posts and replies, as the training export computes
+// interest_vector, so the model is served the feature it is trained on.
+func (m *EngagementModel) interestVector(ctx context.Context, userDID string) ([]float32, error) {
+	acc := features.NewUserAccumulator()
+	for _, source := range []struct {
+		index   string
+		isReply bool
+	}{{m.config.PostsIndex, false}, {m.config.RepliesIndex, true}} {
+		query := map[string]interface{}{
+			"query": authoredBySnapshot(ctx, userDID),
+			"sort": []interface{}{
+				map[string]interface{}{"created_at": "desc"},
+			},
+			"_source": []string{interestEmbeddingField},
+			"size":    m.config.HistorySize,
+		}
+		var hits []struct {
+			Source engagementPost `json:"_source"`
+		}
+		if err := searchHits(ctx, m.client, source.index, query, "es.recommender_engagement_authored", &hits, m.logger); err != nil {
+			return nil, fmt.Errorf("failed to read %s of %s: %w", source.index, userDID, err)
+		}
+		for _, hit := range hits {
+			acc.AddPost(userDID, source.isReply, hit.Source.Embeddings[features.InterestEmbeddingModel])
+		}
+	}
+	return acc.InterestVector(userDID), nil
+}
+
+// authoredBySnapshot matches userDID's records indexed by the snapshot bound
+// by WithSnapshot, so likes and posts made mid-session don't reorder later
+// pages
+func authoredBySnapshot(ctx context.Context, userDID string) map[string]interface{} {
+	return map[string]interface{}{
+		"bool": map[string]interface{}{
+			"filter": []interface{}{
+				map[string]interface{}{"term": map[string]interface{}{"author_did": userDID}},
+				indexedBySnapshot(ctx),
+			},
+		},
+	}
+}
+
+// lookupPosts fetches the scored fields of posts, keyed by at_uri. The read
+// alias spans several indices, so it searches by ID rather than using mget.
+func (m *EngagementModel) lookupPosts(ctx context.Context, atURIs []string) (map[string]engagementPost, error) {
+	if len(atURIs) == 0 {
+		return map[string]engagementPost{}, nil
+	}
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"ids": map[string]interface{}{"values": atURIs},
+		},
+		"_source": []string{"at_uri", "author_did", "created_at", "like_count", interestEmbeddingField},
+		"size":    len(atURIs),
+	}
+	var hits []struct {
+		ID     string         `json:"_id"`
+		Source engagementPost `json:"_source"`
+	}
+	if err := searchHits(ctx, m.client, m.config.PostsIndex, query, "es.recommender_engagement_posts", &hits, m.logger); err != nil {
+		return nil, fmt.Errorf("failed to look up posts: %w", err)
+	}
+
+	posts := make(map[string]engagementPost, len(hits))
+	for _, hit := range hits {
+		if hit.Source.AtURI == "" {
+			hit.Source.AtURI = hit.ID
+		}
+		posts[hit.ID] = hit.Source
+	}
+	return posts, nil
+}
+
+// searchHits runs query against index and decodes its hits into hits
+func searchHits(ctx context.Context, client *elasticsearch.Client, index string, query map[string]interface{}, metricPrefix string, hits interface{}, logger *common.IngestLogger) error {
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	start := time.Now()
+	res, err := client.Search(
+		client.Search.WithContext(ctx),
+		client.Search.WithIndex(index),
+		client.Search.WithBody(bytes.NewReader(queryJSON)),
+		client.Search.WithIgnoreUnavailable(true),
+	)
+	logger.Metric(metricPrefix+".duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return fmt.Errorf("search request failed: %w", err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			logger.Error("Failed to close search response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		return fmt.Errorf("search request returned error: %s", res.String())
+	}
+
+	var response struct {
+		Took int `json:"took"`
+		Hits struct {
+			Hits json.RawMessage `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return fmt.Errorf("failed to parse search response: %w", err)
+	}
+	logger.Metric(metricPrefix+".took_ms", float64(response.Took))
+	if len(response.Hits.Hits) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(response.Hits.Hits, hits); err != nil {
+		return fmt.Errorf("failed to parse search hits: %w", err)
+	}
+	return nil
+}
+
+// cosineSimilarity returns the cosine similarity of a and b, or 0 if either
+// is empty, their dimensions differ, or either has no magnitude
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
@@ -0,0 +1,273 @@
+package recommender
+
+import (
+	"context"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+const engagementUser = "did:plc:user"
+
+// newEngagementFixture indexes a user who liked two posts by did:plc:fav,
+// recent posts by did:plc:fav, another author, and the user, and a reply by
+// the user. The user's interest vector, the mean of their own post and
+// reply, points away from the posts they liked.
+func newEngagementFixture(t *testing.T) (*estest.Server, context.Context) {
+	t.Helper()
+	snapshot := time.Date(2026, 6, 3, 12, 0, 0, 0, time.UTC)
+	es := estest.New(t)
+	post := func(uri string, age time.Duration, likes int, vector []float64) {
+		es.Put("posts", uri, map[string]interface{}{
+			"at_uri":     uri,
+			"author_did": common.ExtractDIDFromATURI(uri),
+			"created_at": snapshot.Add(-age).Format(time.RFC3339),
+			"indexed_at": snapshot.Add(-age).Format(time.RFC3339),
+			"like_count": likes,
+			"embeddings": map[string]interface{}{"all_MiniLM_L12_v2": vector},
+		})
+	}
+	post("at://did:plc:fav/app.bsky.feed.post/liked1", time.Hour, 3, []float64{0, 1})
+	post("at://did:plc:fav/app.bsky.feed.post/liked2", 72*time.Hour, 3, []float64{0.1, 1})
+	post("at://did:plc:fav/app.bsky.feed.post/close", 2*time.Hour, 5, []float64{1, 0})
+	post("at://did:plc:other/app.bsky.feed.post/popular", 2*time.Hour, 50, []float64{0, 1})
+	post("at://"+engagementUser+"/app.bsky.feed.post/own", time.Hour, 100, []float64{1, 0})
+	es.Put("replies", "at://"+engagementUser+"/app.bsky.feed.post/reply", map[string]interface{}{
+		"at_uri":     "at://" + engagementUser + "/app.bsky.feed.post/reply",
+		"author_did": engagementUser,
+		"created_at": snapshot.Add(-time.Hour).Format(time.RFC3339),
+		"indexed_at": snapshot.Add(-time.Hour).Format(time.RFC3339),
+		"embeddings": map[string]interface{}{"all_MiniLM_L12_v2": []float64{1, 0.1}},
+	})
+	for i, uri := range []string{"at://did:plc:fav/app.bsky.feed.post/liked1", "at://did:plc:fav/app.bsky.feed.post/liked2"} {
+		es.Put("likes", "like"+string(rune('1'+i)), map[string]interface{}{
+			"author_did":  engagementUser,
+			"subject_uri": uri,
+			"created_at":  snapshot.Add(-time.Duration(i) * time.Minute).Format(time.RFC3339),
+			"indexed_at":  snapshot.Add(-time.Duration(i) * time.Minute).Format(time.RFC3339),
+		})
+	}
+	return es, WithSnapshot(context.Background(), snapshot)
+}
+
+func TestEngagementModel_PredictEngagement(t *testing.T) {
+	es, ctx := newEngagementFixture(t)
+	model := NewEngagementModel(es.Client, EngagementConfig{Window: 24 * time.Hour, HalfLife: 2 * time.Hour}, common.NewLogger(false))
+
+	predictions, err := model.PredictEngagement(ctx, engagementUser, []string{
+		"at://did:plc:other/app.bsky.feed.post/popular",
+		"at://did:plc:fav/app.bsky.feed.post/close",
+		"at://did:plc:gone/app.bsky.feed.post/deleted",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(predictions) != 3 {
+		t.Fatalf("expected a prediction per post, got %+v", predictions)
+	}
+	popular, near, deleted := predictions[0], predictions[1], predictions[2]
+	if near.AtURI != "at://did:plc:fav/app.bsky.feed.post/close" || near.Probability <= popular.Probability {
+		t.Errorf("expected the post close to the user's likes ranked above the popular one, got %+v and %+v", near, popular)
+	}
+	if near.Features.AuthorAffinity != 1 || near.Features.Similarity < 0.99 || near.Features.Recency != 0.5 || near.Features.LikeCount != 5 {
+		t.Errorf("unexpected features %+v", near.Features)
+	}
+	if popular.Features.AuthorAffinity != 0 || popular.Features.Similarity > 0.1 {
+		t.Errorf("unexpected features %+v", popular.Features)
+	}
+	if !deleted.Missing || deleted.Probability != 0 || deleted.AuthorDID != "did:plc:gone" {
+		t.Errorf("expected the deleted post flagged missing, got %+v", deleted)
+	}
+
+	// A user with no likes is scored on popularity and recency alone
+	anonymous, err := model.PredictEngagement(ctx, "", []string{"at://did:plc:other/app.bsky.feed.post/popular", "at://did:plc:fav/app.bsky.feed.post/close"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anonymous[0].Probability <= anonymous[1].Probability {
+		t.Errorf("expected the popular post ranked first without history, got %+v", anonymous)
+	}
+}
+
+func TestEngagementModel_RecommendMostEngagingPosts(t *testing.T) {
+	es, ctx := newEngagementFixture(t)
+	metrics := &guardrailMetrics{sums: map[string]float64{}}
+	logger := common.NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(metrics)
+	model := NewEngagementModel(es.Client, EngagementConfig{Window: 24 * time.Hour}, logger)
+
+	slate, err := model.RecommendMostEngagingPosts(ctx, engagementUser, EngagementSourceSimilar, 2, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slate) != 2 || slate[0].AtURI != "at://did:plc:fav/app.bsky.feed.post/close" || slate[1].AtURI != "at://did:plc:other/app.bsky.feed.post/popular" {
+		t.Fatalf("expected liked and own posts left out and the close post first, got %+v", slate)
+	}
+	if slate[0].Strategy != StrategyEngagementSimilar || slate[0].Probability < slate[1].Probability {
+		t.Errorf("unexpected slate %+v", slate)
+	}
+	if calls := es.Calls(estest.APISearch); len(calls) != 5 {
+		t.Errorf("expected likes, own posts, own replies, kNN, and candidate post searches, got %d", len(calls))
+	}
+
+	// Weights from the request override the model's
+	slate, err = model.RecommendMostEngagingPosts(ctx, engagementUser, EngagementSourceTrending, 1, &EngagementWeights{Popularity: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slate) != 1 || slate[0].AtURI != "at://did:plc:other/app.bsky.feed.post/popular" || slate[0].Strategy != StrategyEngagementTrending {
+		t.Errorf("expected the most-liked post first when only popularity counts, got %+v", slate)
+	}
+
+	// A user without an interest vector is served trending candidates
+	slate, err = model.RecommendMostEngagingPosts(ctx, "did:plc:new", EngagementSourceSimilar, 10, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slate) != 4 || slate[0].Strategy != StrategyEngagementTrending {
+		t.Errorf("expected every recent post from trending, got %+v", slate)
+	}
+	if got := metrics.Sum("recommender.engagement.cold_start_count"); got != 1 {
+		t.Errorf("expected one cold start counted, got %v", got)
+	}
+}
+
+func TestEngagementModel_RecommendBoundsBySnapshot(t *testing.T) {
+	es, ctx := newEngagementFixture(t)
+	snapshot := snapshotFrom(ctx)
+	// Created within the window but indexed after the snapshot, as a
+	// backfilled post would be
+	es.Put("posts", "at://did:plc:late/app.bsky.feed.post/backfilled", map[string]interface{}{
+		"at_uri":     "at://did:plc:late/app.bsky.feed.post/backfilled",
+		"author_did": "did:plc:late",
+		"created_at": snapshot.Add(-3 * time.Hour).Format(time.RFC3339),
+		"indexed_at": snapshot.Add(time.Minute).Format(time.RFC3339),
+		"like_count": 500,
+	})
+	// Liked after the snapshot: still a candidate on this snapshot's pages
+	es.Put("likes", "like-late", map[string]interface{}{
+		"author_did":  engagementUser,
+		"subject_uri": "at://did:plc:other/app.bsky.feed.post/popular",
+		"created_at":  snapshot.Add(time.Minute).Format(time.RFC3339),
+		"indexed_at":  snapshot.Add(time.Minute).Format(time.RFC3339),
+	})
+	model := NewEngagementModel(es.Client, EngagementConfig{Window: 24 * time.Hour}, common.NewLogger(false))
+
+	slate, err := model.RecommendMostEngagingPosts(ctx, engagementUser, EngagementSourceTrending, 10, &EngagementWeights{Popularity: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slate) != 2 || slate[0].AtURI != "at://did:plc:other/app.bsky.feed.post/popular" {
+		t.Errorf("expected only what was indexed by the snapshot, got %+v", slate)
+	}
+}
+
+func TestEngagementModel_FeedStages(t *testing.T) {
+	es, ctx := newEngagementFixture(t)
+	model := NewEngagementModel(es.Client, EngagementConfig{Window: 24 * time.Hour}, common.NewLogger(false))
+
+	candidates, err := model.Retrieve(ctx, engagementUser, EngagementSourceTrending, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 2 || candidates[0].AtURI != "at://did:plc:other/app.bsky.feed.post/popular" || candidates[0].Strategy != StrategyEngagementTrending {
+		t.Fatalf("expected liked and own posts left out, most-liked first, got %+v", candidates)
+	}
+	if _, err := model.Retrieve(ctx, engagementUser, "following", 10); err == nil {
+		t.Error("expected an unknown source rejected")
+	}
+
+	candidates = append(candidates, Candidate{AtURI: "at://did:plc:gone/app.bsky.feed.post/deleted"})
+	scored, err := model.ScoreFunc(nil)(WithExplain(ctx), engagementUser, candidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scored) != 2 || scored[0].AtURI != "at://did:plc:fav/app.bsky.feed.post/close" || scored[0].Score <= scored[1].Score {
+		t.Fatalf("expected the unindexed post dropped and the close post first, got %+v", scored)
+	}
+	if e := scored[0].Explanation; e == nil || e.Components["engagement_probability"] != scored[0].Score || e.Features["author_affinity"] != 1 {
+		t.Errorf("unexpected explanation %+v", e)
+	}
+	if candidates[0].Explanation != nil {
+		t.Error("expected the retrieved candidates left as they were")
+	}
+
+	// Weights passed in override the model's
+	scored, err = model.ScoreFunc(&EngagementWeights{Popularity: 1})(ctx, engagementUser, candidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scored[0].AtURI != "at://did:plc:other/app.bsky.feed.post/popular" || scored[0].Explanation != nil {
+		t.Errorf("expected the most-liked post first when only popularity counts, got %+v", scored)
+	}
+}
+
+func TestEngagementModel_RetrieveColdStart(t *testing.T) {
+	es, ctx := newEngagementFixture(t)
+	metrics := &guardrailMetrics{sums: map[string]float64{}}
+	logger := common.NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(metrics)
+	seeds := NewSeedListSource([]string{"at://did:plc:new/app.bsky.feed.post/own", "at://did:plc:curated/app.bsky.feed.post/1"})
+	model := NewEngagementModel(es.Client, EngagementConfig{
+		Window:    24 * time.Hour,
+		ColdStart: NewColdStartBlender([]WeightedSource{{Source: seeds, Weight: 1}}, logger),
+	}, logger)
+
+	// A user without likes or follows is served the blend, less their own posts
+	candidates, err := model.Retrieve(ctx, "did:plc:new", EngagementSourceSimilar, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 1 || candidates[0].AtURI != "at://did:plc:curated/app.bsky.feed.post/1" || candidates[0].Strategy != StrategySeedList {
+		t.Fatalf("expected the curated post, got %+v", candidates)
+	}
+	if got := metrics.Sum("recommender.cold_start.served_count"); got != 1 {
+		t.Errorf("expected one cold start counted, got %v", got)
+	}
+
+	// Follows alone are enough history to retrieve from the source
+	es.Put("follows", "follow1", map[string]interface{}{
+		"author_did":  "did:plc:new",
+		"subject_did": "did:plc:fav",
+		"indexed_at":  snapshotFrom(ctx).Add(-time.Hour).Format(time.RFC3339),
+	})
+	candidates, err = model.Retrieve(ctx, "did:plc:new", EngagementSourceTrending, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) == 0 || candidates[0].Strategy != StrategyEngagementTrending {
+		t.Errorf("expected trending candidates for a user with follows, got %+v", candidates)
+	}
+	candidates, err = model.Retrieve(ctx, engagementUser, EngagementSourceTrending, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 2 || metrics.Sum("recommender.cold_start.served_count") != 1 {
+		t.Errorf("expected a user with likes retrieved from the source, got %+v", candidates)
+	}
+}
+
+func TestEngagementModel_RecommendRejectsInvalidRequests(t *testing.T) {
+	es := estest.New(t)
+	model := NewEngagementModel(es.Client, EngagementConfig{}, common.NewLogger(false))
+	ctx := context.Background()
+
+	if _, err := model.RecommendMostEngagingPosts(ctx, engagementUser, "following", 10, nil); err == nil {
+		t.Error("expected an unknown source rejected")
+	}
+	if _, err := model.RecommendMostEngagingPosts(ctx, engagementUser, EngagementSourceTrending, 0, nil); err == nil {
+		t.Error("expected an empty slate size rejected")
+	}
+	if _, err := model.RecommendMostEngagingPosts(ctx, engagementUser, EngagementSourceTrending, 10, &EngagementWeights{Bias: math.NaN()}); err == nil {
+		t.Error("expected a NaN weight rejected")
+	}
+	if calls := es.Calls(estest.APISearch); len(calls) != 0 {
+		t.Errorf("expected invalid requests not to search, got %d searches", len(calls))
+	}
+}
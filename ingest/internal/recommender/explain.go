@@ -0,0 +1,140 @@
+package recommender
+
+import (
+	"context"
+	"maps"
+	"net/url"
+	"strconv"
+)
+
+// Explanation records why a candidate is in a slate: the source that
+// produced it, how retrieval and scoring ranked it, and the feature values
+// and component scores behind its score. Candidates carry one only when the
+// request asked for explanations (see WithExplain), so "why is this post
+// here?" can be answered without reproducing scoring offline.
+type Explanation struct {
+	Source         string             `json:"source,omitempty"` // Candidate strategy, e.g. cold_start_trending
+	RetrievalRank  int                `json:"retrieval_rank"`   // 1-based position in the retrieved pool; 0 if not known
+	RetrievalScore float64            `json:"retrieval_score"`
+	Score          float64            `json:"score"` // Score as served, after scoring if it ran
+	Components     map[string]float64 `json:"components,omitempty"`
+	Features       map[string]float64 `json:"features,omitempty"`
+	Level          string             `json:"degradation_level"` // DegradationLevel of the request that served it
+}
+
+// clone returns a copy of e that shares no maps with it, or an empty
+// explanation for nil
+func (e *Explanation) clone() *Explanation {
+	if e == nil {
+		return &Explanation{}
+	}
+	c := *e
+	c.Components = maps.Clone(e.Components)
+	c.Features = maps.Clone(e.Features)
+	return &c
+}
+
+type explainKey struct{}
+
+// WithExplain makes the pipeline under ctx attach an Explanation to each
+// served candidate
+func WithExplain(ctx context.Context) context.Context {
+	return context.WithValue(ctx, explainKey{}, true)
+}
+
+// Explaining reports whether ctx asks for explanations. Sources and score
+// functions can check it before computing values only an explanation uses.
+func Explaining(ctx context.Context) bool {
+	explain, _ := ctx.Value(explainKey{}).(bool)
+	return explain
+}
+
+// ParseExplain reports whether request parameters ask for explanations
+// (explain=true)
+func ParseExplain(params url.Values) bool {
+	explain, err := strconv.ParseBool(params.Get("explain"))
+	return err == nil && explain
+}
+
+// ExplainFeature records the value of a feature that went into c's score.
+// It does nothing unless ctx asks for explanations.
+func ExplainFeature(ctx context.Context, c *Candidate, name string, value float64) {
+	if !Explaining(ctx) {
+		return
+	}
+	if c.Explanation == nil {
+		c.Explanation = &Explanation{}
+	}
+	if c.Explanation.Features == nil {
+		c.Explanation.Features = make(map[string]float64)
+	}
+	c.Explanation.Features[name] = value
+}
+
+// ExplainComponent records one component of c's score, e.g. a model's
+// relevance score before blending. It does nothing unless ctx asks for
+// explanations.
+func ExplainComponent(ctx context.Context, c *Candidate, name string, value float64) {
+	if !Explaining(ctx) {
+		return
+	}
+	if c.Explanation == nil {
+		c.Explanation = &Explanation{}
+	}
+	if c.Explanation.Components == nil {
+		c.Explanation.Components = make(map[string]float64)
+	}
+	c.Explanation.Components[name] = value
+}
+
+// explainRetrieved records the source, rank, and score of each retrieved
+// candidate. It works on copies, so retrievers that return shared
+// candidates are never written to.
+func explainRetrieved(ctx context.Context, candidates []Candidate) []Candidate {
+	if !Explaining(ctx) {
+		return candidates
+	}
+	result := make([]Candidate, len(candidates))
+	for i, c := range candidates {
+		e := c.Explanation.clone()
+		e.Source = c.Strategy
+		e.RetrievalRank = i + 1
+		e.RetrievalScore = c.Score
+		c.Explanation = e
+		result[i] = c
+	}
+	return result
+}
+
+// explainSlate finishes the explanations of a slate served at level, or,
+// when ctx does not ask for them, drops any the candidates carry (e.g. a
+// cached slate built for an explained request)
+func explainSlate(ctx context.Context, slate []Candidate, level DegradationLevel) []Candidate {
+	explain := Explaining(ctx)
+	if !explain {
+		explained := false
+		for _, c := range slate {
+			explained = explained || c.Explanation != nil
+		}
+		if !explained {
+			return slate
+		}
+	}
+
+	result := make([]Candidate, len(slate))
+	for i, c := range slate {
+		if explain {
+			e := c.Explanation.clone()
+			if e.Source == "" {
+				e.Source = c.Strategy
+			}
+			e.Score = c.Score
+			e.Level = level.String()
+			c.Explanation = e
+		} else {
+			c.Explanation = nil
+		}
+		result[i] = c
+	}
+	return result
+}
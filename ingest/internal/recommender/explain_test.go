@@ -0,0 +1,118 @@
+package recommender
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+func TestParseExplain(t *testing.T) {
+	for query, want := range map[string]bool{
+		"explain=true": true,
+		"explain=1":    true,
+		"explain=no":   false,
+		"limit=10":     false,
+	} {
+		params, _ := url.ParseQuery(query)
+		if got := ParseExplain(params); got != want {
+			t.Errorf("ParseExplain(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
+
+func explainStages() Stages {
+	return Stages{
+		Retrieve: func(context.Context, string, int) ([]Candidate, error) {
+			candidates := makeCandidates("r", 3)
+			for i := range candidates {
+				candidates[i].Strategy = StrategyTrending
+				candidates[i].Score = float64(10 - i)
+			}
+			return candidates, nil
+		},
+		Score: func(ctx context.Context, _ string, candidates []Candidate) ([]Candidate, error) {
+			scored := []Candidate{candidates[2], candidates[0], candidates[1]}
+			for i := range scored {
+				scored[i].Score = float64(len(scored) - i)
+				ExplainComponent(ctx, &scored[i], "relevance", scored[i].Score/2)
+				ExplainFeature(ctx, &scored[i], "author_affinity", 0.25)
+			}
+			return scored, nil
+		},
+	}
+}
+
+func TestDegradingPipeline_Explain(t *testing.T) {
+	p := NewDegradingPipeline(explainStages(), StageBudgets{}, 100, 0, common.NewLogger(false))
+
+	slate, _, err := p.Serve(WithExplain(context.Background()), "did:plc:viewer", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(slate) != 3 {
+		t.Fatalf("expected 3 candidates, got %d", len(slate))
+	}
+	first := slate[0].Explanation
+	if first == nil {
+		t.Fatal("expected an explanation")
+	}
+	if first.Source != StrategyTrending || first.RetrievalRank != 3 || first.RetrievalScore != 8 {
+		t.Errorf("unexpected retrieval explanation %+v", first)
+	}
+	if first.Score != 3 || first.Components["relevance"] != 1.5 || first.Features["author_affinity"] != 0.25 {
+		t.Errorf("unexpected scoring explanation %+v", first)
+	}
+	if first.Level != LevelFull.String() {
+		t.Errorf("expected level %s, got %s", LevelFull, first.Level)
+	}
+}
+
+func TestDegradingPipeline_NoExplanationUnlessAsked(t *testing.T) {
+	p := NewDegradingPipeline(explainStages(), StageBudgets{}, 100, 0, common.NewLogger(false))
+
+	slate, _, err := p.Serve(context.Background(), "did:plc:viewer", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, c := range slate {
+		if c.Explanation != nil {
+			t.Errorf("expected no explanation on %s, got %+v", c.AtURI, c.Explanation)
+		}
+	}
+}
+
+func TestDegradingPipeline_ExplainCachedSlate(t *testing.T) {
+	cached := makeCandidates("c", 2)
+	cached[0].Explanation = &Explanation{Source: StrategySeedList, RetrievalRank: 4, Level: LevelFull.String()}
+	stages := Stages{
+		Retrieve: func(context.Context, string, int) ([]Candidate, error) {
+			return nil, errors.New("retrieval down")
+		},
+		Cached: func(string) ([]Candidate, bool) {
+			return cached, true
+		},
+	}
+	p := NewDegradingPipeline(stages, StageBudgets{}, 100, 0, common.NewLogger(false))
+
+	slate, _, err := p.Serve(WithExplain(context.Background()), "did:plc:viewer", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e := slate[0].Explanation; e == nil || e.RetrievalRank != 4 || e.Level != LevelCachedSlate.String() {
+		t.Errorf("expected the cached explanation served at %s, got %+v", LevelCachedSlate, e)
+	}
+	if cached[0].Explanation.Level != LevelFull.String() {
+		t.Error("explaining a cached slate must not modify the cache")
+	}
+
+	slate, _, err = p.Serve(context.Background(), "did:plc:viewer", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if slate[0].Explanation != nil {
+		t.Errorf("expected explanations dropped when not asked for, got %+v", slate[0].Explanation)
+	}
+}
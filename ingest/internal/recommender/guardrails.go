@@ -0,0 +1,467 @@
+package recommender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// Guardrail rule names, used in metrics and debug logs
+const (
+	GuardrailAccountAge = "account_age"
+	GuardrailPosts      = "posts"
+	GuardrailFollowers  = "followers"
+)
+
+// Indices and fields author activity is counted in
+const (
+	guardrailPostsIndex     = "posts,replies"
+	guardrailFollowsIndex   = "follows"
+	guardrailFollowersField = "subject_did"
+)
+
+// DefaultPLCDirectoryURL is the PLC directory did:plc creation times are
+// read from
+const DefaultPLCDirectoryURL = "https://plc.directory"
+
+// GuardrailRules keep candidates by new or inactive accounts, which are
+// mostly spam, out of slates. The zero value allows every author.
+type GuardrailRules struct {
+	MinAccountAge time.Duration // Youngest author account served, from its DID's creation time; 0 is unbounded
+	MinPosts      int           // Fewest posts and replies an author must have indexed
+	MinFollowers  int           // Fewest followers an author must have in follows
+}
+
+// IsZero reports whether the rules allow every author
+func (r GuardrailRules) IsZero() bool {
+	return r == GuardrailRules{}
+}
+
+// GuardrailConfig holds the rules for each experiment arm. An arm without
+// its own rules, and a request outside any arm, gets Default.
+type GuardrailConfig struct {
+	Default GuardrailRules
+	Arms    map[string]GuardrailRules
+}
+
+// IsZero reports whether no arm has rules
+func (c GuardrailConfig) IsZero() bool {
+	if !c.Default.IsZero() {
+		return false
+	}
+	for _, rules := range c.Arms {
+		if !rules.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// RulesFor returns the rules of arm
+func (c GuardrailConfig) RulesFor(arm string) GuardrailRules {
+	if rules, ok := c.Arms[arm]; ok {
+		return rules
+	}
+	return c.Default
+}
+
+// guardrailRulesDocument is the stored form of GuardrailRules, with a Go
+// duration string
+type guardrailRulesDocument struct {
+	MinAccountAge string `json:"min_account_age,omitempty"`
+	MinPosts      int    `json:"min_posts,omitempty"`
+	MinFollowers  int    `json:"min_followers,omitempty"`
+}
+
+// guardrailDocument is the stored form of GuardrailConfig
+type guardrailDocument struct {
+	Default guardrailRulesDocument            `json:"default"`
+	Arms    map[string]guardrailRulesDocument `json:"arms,omitempty"`
+}
+
+// LoadGuardrails reads guardrail rules from a local path or GCS
+// (gs://bucket/object). An empty path allows every author.
+func LoadGuardrails(ctx context.Context, path string) (GuardrailConfig, error) {
+	if path == "" {
+		return GuardrailConfig{}, nil
+	}
+	data, err := readConfigSource(ctx, path, "guardrails")
+	if err != nil {
+		return GuardrailConfig{}, err
+	}
+	return parseGuardrails(data, path)
+}
+
+func parseGuardrails(data []byte, name string) (GuardrailConfig, error) {
+	var doc guardrailDocument
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		return GuardrailConfig{}, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+
+	config := GuardrailConfig{Arms: make(map[string]GuardrailRules, len(doc.Arms))}
+	var err error
+	if config.Default, err = parseGuardrailRules(doc.Default, name+": default"); err != nil {
+		return GuardrailConfig{}, err
+	}
+	for arm, rules := range doc.Arms {
+		if arm == "" {
+			return GuardrailConfig{}, fmt.Errorf("%s: arm name is empty", name)
+		}
+		if config.Arms[arm], err = parseGuardrailRules(rules, name+": arm "+arm); err != nil {
+			return GuardrailConfig{}, err
+		}
+	}
+	return config, nil
+}
+
+func parseGuardrailRules(doc guardrailRulesDocument, name string) (GuardrailRules, error) {
+	rules := GuardrailRules{MinPosts: doc.MinPosts, MinFollowers: doc.MinFollowers}
+	if doc.MinAccountAge != "" {
+		d, err := time.ParseDuration(doc.MinAccountAge)
+		if err != nil || d < 0 {
+			return GuardrailRules{}, fmt.Errorf("%s: invalid min_account_age %q", name, doc.MinAccountAge)
+		}
+		rules.MinAccountAge = d
+	}
+	if rules.MinPosts < 0 {
+		return GuardrailRules{}, fmt.Errorf("%s: invalid min_posts %d", name, rules.MinPosts)
+	}
+	if rules.MinFollowers < 0 {
+		return GuardrailRules{}, fmt.Errorf("%s: invalid min_followers %d", name, rules.MinFollowers)
+	}
+	return rules, nil
+}
+
+type experimentArmKey struct{}
+
+// WithExperimentArm makes the pipeline under ctx apply arm's guardrails
+func WithExperimentArm(ctx context.Context, arm string) context.Context {
+	return context.WithValue(ctx, experimentArmKey{}, arm)
+}
+
+// experimentArmFrom returns the arm bound by WithExperimentArm, or ""
+func experimentArmFrom(ctx context.Context) string {
+	arm, _ := ctx.Value(experimentArmKey{}).(string)
+	return arm
+}
+
+// AccountCreationSource returns when accounts were created, keyed by DID.
+// Accounts whose creation time is unknown are left out; on error the
+// creation times found so far are returned along with it.
+type AccountCreationSource interface {
+	CreatedAt(ctx context.Context, dids []string) (map[string]time.Time, error)
+}
+
+// plcCacheSize caps the creation times a PLCDirectory keeps
+const plcCacheSize = 100000
+
+// PLCDirectory reads did:plc creation times from the first operation in
+// each DID's PLC audit log. Creation times never change, so they are
+// cached, along with DIDs that have none (other DID methods, or DIDs the
+// directory does not know).
+type PLCDirectory struct {
+	baseURL        string
+	httpClient     *http.Client
+	maxConcurrency int
+
+	mu    sync.Mutex
+	cache map[string]time.Time
+}
+
+// NewPLCDirectory creates a source reading from the directory at baseURL
+// (DefaultPLCDirectoryURL when empty)
+func NewPLCDirectory(baseURL string) *PLCDirectory {
+	if baseURL == "" {
+		baseURL = DefaultPLCDirectoryURL
+	}
+	return &PLCDirectory{
+		baseURL:        strings.TrimSuffix(baseURL, "/"),
+		httpClient:     &http.Client{Timeout: 2 * time.Second},
+		maxConcurrency: 8,
+		cache:          make(map[string]time.Time),
+	}
+}
+
+// CreatedAt implements AccountCreationSource
+func (d *PLCDirectory) CreatedAt(ctx context.Context, dids []string) (map[string]time.Time, error) {
+	created := make(map[string]time.Time, len(dids))
+	var missing []string
+	d.mu.Lock()
+	for _, did := range dids {
+		if createdAt, ok := d.cache[did]; ok {
+			if !createdAt.IsZero() {
+				created[did] = createdAt
+			}
+		} else if strings.HasPrefix(did, "did:plc:") {
+			missing = append(missing, did)
+		}
+	}
+	d.mu.Unlock()
+
+	var (
+		group errgroup.Group
+		mu    sync.Mutex
+	)
+	group.SetLimit(d.maxConcurrency)
+	for _, did := range missing {
+		group.Go(func() error {
+			createdAt, err := d.fetch(ctx, did)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			if !createdAt.IsZero() {
+				created[did] = createdAt
+			}
+			mu.Unlock()
+			d.remember(did, createdAt)
+			return nil
+		})
+	}
+	err := group.Wait()
+	return created, err
+}
+
+// fetch returns the creation time of did, or the zero time when the
+// directory does not know it
+func (d *PLCDirectory) fetch(ctx context.Context, did string) (time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.baseURL+"/"+did+"/log/audit", nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to create PLC request: %w", err)
+	}
+	res, err := d.httpClient.Do(req)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("PLC request for %s failed: %w", did, err)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	if res.StatusCode == http.StatusNotFound {
+		return time.Time{}, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("PLC request for %s returned status %d", did, res.StatusCode)
+	}
+
+	var operations []struct {
+		CreatedAt string `json:"createdAt"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&operations); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse PLC audit log of %s: %w", did, err)
+	}
+	if len(operations) == 0 {
+		return time.Time{}, nil
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, operations[0].CreatedAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid PLC creation time %q for %s", operations[0].CreatedAt, did)
+	}
+	return createdAt.UTC(), nil
+}
+
+func (d *PLCDirectory) remember(did string, createdAt time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.cache) >= plcCacheSize {
+		d.cache = make(map[string]time.Time)
+	}
+	d.cache[did] = createdAt
+}
+
+// Guardrails drop retrieved candidates by accounts that are too new or too
+// inactive to be trusted in feeds, before they are scored. Rules are chosen
+// per experiment arm (see WithExperimentArm). A nil Guardrails keeps every
+// candidate.
+type Guardrails struct {
+	client   *elasticsearch.Client
+	config   GuardrailConfig
+	accounts AccountCreationSource
+	logger   *common.IngestLogger
+}
+
+// NewGuardrails creates guardrails that count activity in the posts,
+// replies, and follows read aliases and read account ages from accounts.
+// Returns nil for rules that allow every author so callers can use the
+// result unconditionally.
+func NewGuardrails(client *elasticsearch.Client, config GuardrailConfig, accounts AccountCreationSource, logger *common.IngestLogger) *Guardrails {
+	if config.IsZero() {
+		return nil
+	}
+	return &Guardrails{client: client, config: config, accounts: accounts, logger: logger}
+}
+
+// GuardrailsFromConfig creates the guardrails GE_RECOMMENDER_GUARDRAILS
+// configures, reading account ages from GE_PLC_DIRECTORY_URL, or nil when
+// it is unset
+func GuardrailsFromConfig(ctx context.Context, client *elasticsearch.Client, config *common.Config, logger *common.IngestLogger) (*Guardrails, error) {
+	rules, err := LoadGuardrails(ctx, config.RecommenderGuardrailsPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewGuardrails(client, rules, NewPLCDirectory(config.PLCDirectoryURL), logger), nil
+}
+
+// Filter returns candidates without those whose authors break the rules of
+// ctx's experiment arm, preserving order. Account age is measured from the
+// snapshot bound by WithSnapshot. An author whose creation time is unknown
+// passes the age rule, and a failed lookup is logged and passes every
+// author on the rules it serves: guardrails shape the slate but are not
+// worth failing the request over.
+func (g *Guardrails) Filter(ctx context.Context, candidates []Candidate) []Candidate {
+	if g == nil || len(candidates) == 0 {
+		return candidates
+	}
+	arm := experimentArmFrom(ctx)
+	rules := g.config.RulesFor(arm)
+	if rules.IsZero() {
+		return candidates
+	}
+
+	authors := make([]string, 0, len(candidates))
+	seen := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		if did := candidateAuthor(c); did != "" && !seen[did] {
+			seen[did] = true
+			authors = append(authors, did)
+		}
+	}
+
+	var created map[string]time.Time
+	if rules.MinAccountAge > 0 && g.accounts != nil {
+		var err error
+		if created, err = g.accounts.CreatedAt(ctx, authors); err != nil {
+			g.lookupFailed(GuardrailAccountAge, err)
+		}
+	}
+	posts := g.counts(ctx, GuardrailPosts, rules.MinPosts, guardrailPostsIndex, "author_did", authors)
+	followers := g.counts(ctx, GuardrailFollowers, rules.MinFollowers, guardrailFollowsIndex, guardrailFollowersField, authors)
+
+	now := snapshotFrom(ctx)
+	kept := make([]Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		did := candidateAuthor(c)
+		if did == "" {
+			kept = append(kept, c)
+			continue
+		}
+		rule := ""
+		switch createdAt, ok := created[did]; {
+		case ok && now.Sub(createdAt) < rules.MinAccountAge:
+			rule = GuardrailAccountAge
+		case posts != nil && posts[did] < rules.MinPosts:
+			rule = GuardrailPosts
+		case followers != nil && followers[did] < rules.MinFollowers:
+			rule = GuardrailFollowers
+		}
+		if rule == "" {
+			kept = append(kept, c)
+			continue
+		}
+		g.logger.Debug("Guardrails: dropped %s by %s (%s, arm %q)", c.AtURI, did, rule, arm)
+		g.logger.Metric("recommender.guardrails."+rule+"_dropped_count", 1)
+	}
+	if dropped := len(candidates) - len(kept); dropped > 0 && arm != "" {
+		g.logger.Metric("recommender.guardrails.arm_"+arm+"_dropped_count", float64(dropped))
+	}
+	return kept
+}
+
+// counts returns how many documents each of dids has in index, by field,
+// or nil when threshold does not require it or the lookup fails
+func (g *Guardrails) counts(ctx context.Context, rule string, threshold int, index, field string, dids []string) map[string]int {
+	if threshold <= 0 || len(dids) == 0 {
+		return nil
+	}
+	counts, err := g.countByAuthor(ctx, index, field, dids)
+	if err != nil {
+		g.lookupFailed(rule, err)
+		return nil
+	}
+	return counts
+}
+
+func (g *Guardrails) lookupFailed(rule string, err error) {
+	g.logger.Metric("recommender.guardrails.lookup_error_count", 1)
+	g.logger.Error("Guardrail %s lookup failed, passing every author: %v", rule, err)
+}
+
+// countByAuthor counts the documents of dids in index with a terms
+// aggregation on field
+func (g *Guardrails) countByAuthor(ctx context.Context, index, field string, dids []string) (map[string]int, error) {
+	query := map[string]interface{}{
+		"size": 0,
+		"query": map[string]interface{}{
+			"terms": map[string]interface{}{field: dids},
+		},
+		"aggs": map[string]interface{}{
+			"authors": map[string]interface{}{
+				"terms": map[string]interface{}{"field": field, "size": len(dids)},
+			},
+		},
+	}
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	start := time.Now()
+	res, err := g.client.Search(
+		g.client.Search.WithContext(ctx),
+		g.client.Search.WithIndex(index),
+		g.client.Search.WithBody(bytes.NewReader(queryJSON)),
+		g.client.Search.WithIgnoreUnavailable(true),
+	)
+	g.logger.Metric("es.recommender_guardrails.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("search request failed: %w", err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			g.logger.Error("Failed to close search response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("search request returned error: %s", res.String())
+	}
+
+	var response struct {
+		Aggregations struct {
+			Authors struct {
+				Buckets []struct {
+					Key      string `json:"key"`
+					DocCount int    `json:"doc_count"`
+				} `json:"buckets"`
+			} `json:"authors"`
+		} `json:"aggregations"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse search response: %w", err)
+	}
+
+	counts := make(map[string]int, len(dids))
+	for _, bucket := range response.Aggregations.Authors.Buckets {
+		counts[bucket.Key] = bucket.DocCount
+	}
+	return counts, nil
+}
+
+// candidateAuthor returns the DID of c's author, from the candidate or its
+// AT-URI
+func candidateAuthor(c Candidate) string {
+	if c.AuthorDID != "" {
+		return c.AuthorDID
+	}
+	return common.ExtractDIDFromATURI(c.AtURI)
+}
@@ -0,0 +1,185 @@
+package recommender
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+type fakeAccountCreation struct {
+	created map[string]time.Time
+	err     error
+}
+
+func (f fakeAccountCreation) CreatedAt(context.Context, []string) (map[string]time.Time, error) {
+	return f.created, f.err
+}
+
+// guardrailMetrics sums the metrics recorded under each name
+type guardrailMetrics struct {
+	mu   sync.Mutex
+	sums map[string]float64
+}
+
+func (m *guardrailMetrics) Record(name string, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sums[name] += value
+}
+
+func (m *guardrailMetrics) Sum(name string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.sums[name]
+}
+
+func TestParseGuardrails(t *testing.T) {
+	config, err := parseGuardrails([]byte(`{"default":{"min_account_age":"72h","min_posts":3},"arms":{"treatment":{"min_followers":10},"control":{}}}`), "test")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := config.RulesFor(""); got != (GuardrailRules{MinAccountAge: 72 * time.Hour, MinPosts: 3}) {
+		t.Errorf("unexpected default rules %+v", got)
+	}
+	if got := config.RulesFor("treatment"); got != (GuardrailRules{MinFollowers: 10}) {
+		t.Errorf("expected an arm's rules to replace the default, got %+v", got)
+	}
+	if got := config.RulesFor("control"); !got.IsZero() {
+		t.Errorf("expected an arm without rules to allow every author, got %+v", got)
+	}
+	if got := config.RulesFor("unknown"); got != config.Default {
+		t.Errorf("expected an unknown arm to get the default, got %+v", got)
+	}
+
+	for _, body := range []string{
+		`{"default":{"min_account_age":"three days"}}`,
+		`{"default":{"min_posts":-1}}`,
+		`{"arms":{"treatment":{"min_followers":-1}}}`,
+		`{"arms":{"":{"min_posts":1}}}`,
+		`{"default":{"min_likes":1}}`,
+	} {
+		if _, err := parseGuardrails([]byte(body), "test"); err == nil {
+			t.Errorf("expected %s to be rejected", body)
+		}
+	}
+
+	if config, err := LoadGuardrails(context.Background(), ""); err != nil || !config.IsZero() {
+		t.Errorf("expected no guardrails without a path, got %+v (%v)", config, err)
+	}
+	if NewGuardrails(nil, GuardrailConfig{}, nil, common.NewLogger(false)) != nil {
+		t.Error("expected no guardrails for empty rules")
+	}
+}
+
+func TestGuardrails_Filter(t *testing.T) {
+	es := estest.New(t)
+	for i, did := range []string{"did:plc:old", "did:plc:old", "did:plc:new", "did:plc:quiet", "did:plc:old"} {
+		uri := "at://" + did + "/app.bsky.feed.post/" + string(rune('a'+i))
+		es.Put("posts", uri, map[string]interface{}{"at_uri": uri, "author_did": did})
+	}
+	es.Put("replies", "at://did:plc:new/app.bsky.feed.post/r", map[string]interface{}{"author_did": "did:plc:new"})
+	es.Put("follows", "at://did:plc:fan/app.bsky.graph.follow/1", map[string]interface{}{"author_did": "did:plc:fan", "subject_did": "did:plc:old"})
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	accounts := fakeAccountCreation{created: map[string]time.Time{
+		"did:plc:old":   now.Add(-365 * 24 * time.Hour),
+		"did:plc:new":   now.Add(-time.Hour),
+		"did:plc:quiet": now.Add(-365 * 24 * time.Hour),
+	}}
+	config := GuardrailConfig{
+		Default: GuardrailRules{MinAccountAge: 24 * time.Hour, MinPosts: 2},
+		Arms:    map[string]GuardrailRules{"treatment": {MinFollowers: 1}},
+	}
+	metrics := &guardrailMetrics{sums: map[string]float64{}}
+	logger := common.NewLogger(true)
+	logger.SetMetricCollector(metrics)
+	guardrails := NewGuardrails(es.Client, config, accounts, logger)
+
+	candidates := []Candidate{
+		{AtURI: "at://did:plc:old/app.bsky.feed.post/a"},
+		{AtURI: "at://did:plc:new/app.bsky.feed.post/c", AuthorDID: "did:plc:new"},
+		{AtURI: "at://did:plc:quiet/app.bsky.feed.post/d"},
+		{AtURI: "at://did:plc:unknown/app.bsky.feed.post/x"},
+	}
+	ctx := WithSnapshot(context.Background(), now)
+
+	kept := guardrails.Filter(ctx, candidates)
+	if len(kept) != 1 || kept[0].AtURI != candidates[0].AtURI {
+		t.Errorf("expected only the old, active author kept, got %+v", kept)
+	}
+	if got := metrics.Sum("recommender.guardrails.account_age_dropped_count"); got != 1 {
+		t.Errorf("expected the new account counted once, got %v", got)
+	}
+	if got := metrics.Sum("recommender.guardrails.posts_dropped_count"); got != 2 {
+		t.Errorf("expected the quiet and unknown authors counted, got %v", got)
+	}
+
+	// The treatment arm only requires a follower
+	kept = guardrails.Filter(WithExperimentArm(ctx, "treatment"), candidates)
+	if len(kept) != 1 || kept[0].AtURI != candidates[0].AtURI {
+		t.Errorf("expected only the followed author kept in treatment, got %+v", kept)
+	}
+	if got := metrics.Sum("recommender.guardrails.arm_treatment_dropped_count"); got != 3 {
+		t.Errorf("expected treatment drops counted per arm, got %v", got)
+	}
+}
+
+func TestGuardrails_FailOpen(t *testing.T) {
+	es := estest.New(t)
+	es.Handle(estest.APISearch, func(estest.Call) *estest.Response {
+		return &estest.Response{Status: http.StatusServiceUnavailable, Body: `{"error":"unavailable"}`}
+	})
+	config := GuardrailConfig{Default: GuardrailRules{MinAccountAge: time.Hour, MinPosts: 1, MinFollowers: 1}}
+	guardrails := NewGuardrails(es.Client, config, fakeAccountCreation{err: errors.New("plc unavailable")}, common.NewLogger(false))
+
+	candidates := makeCandidates("r", 3)
+	if kept := guardrails.Filter(context.Background(), candidates); len(kept) != 3 {
+		t.Errorf("expected failed lookups to keep every candidate, got %d", len(kept))
+	}
+}
+
+func TestPLCDirectory_CreatedAt(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/did:plc:old/log/audit":
+			_, _ = w.Write([]byte(`[{"createdAt":"2023-04-01T12:00:00.000Z"},{"createdAt":"2025-01-01T00:00:00.000Z"}]`))
+		case "/did:plc:fail/log/audit":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	directory := NewPLCDirectory(srv.URL + "/")
+	created, err := directory.CreatedAt(context.Background(), []string{"did:plc:old", "did:plc:gone", "did:web:example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(created) != 1 || !created["did:plc:old"].Equal(time.Date(2023, 4, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the creation time of the first operation, got %v", created)
+	}
+
+	// Known and unknown DIDs are cached; did:web is never looked up
+	if _, err := directory.CreatedAt(context.Background(), []string{"did:plc:old", "did:plc:gone"}); err != nil || requests.Load() != 2 {
+		t.Errorf("expected cached creation times, got %d requests (%v)", requests.Load(), err)
+	}
+
+	created, err = directory.CreatedAt(context.Background(), []string{"did:plc:old", "did:plc:fail"})
+	if err == nil {
+		t.Error("expected an error for a failed lookup")
+	}
+	if _, ok := created["did:plc:old"]; !ok {
+		t.Error("expected the creation times found returned along with the error")
+	}
+}
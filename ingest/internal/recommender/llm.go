@@ -0,0 +1,91 @@
+package recommender
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// LLMClientConfig configures the LLM scoring endpoint client
+type LLMClientConfig struct {
+	URL            string        // Scoring endpoint, e.g. http://llm-scorer:8000/score
+	APIKey         string        //nolint:gosec // G117: struct field name, not a secret value; sent as the X-API-Key header when set
+	Model          string        // Sent with each request; part of the cache key, so changing it rescores every post
+	Timeout        time.Duration // Per-request HTTP timeout
+	MaxRetries     int           // Retries beyond the first attempt
+	RetryBaseDelay time.Duration // Base delay for exponential backoff
+}
+
+// LLMPost is a post sent to the LLM for scoring
+type LLMPost struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// LLMClient is an HTTP client for an LLM scoring endpoint. The endpoint takes
+// {"model": ..., "prompt": ..., "posts": [{"id": ..., "text": ...}, ...]}
+// and returns {"scores": [...]}, the relevance of each post to the prompt
+// from 0 to 1, in order.
+type LLMClient struct {
+	endpoint *common.JSONClient
+	config   LLMClientConfig
+	logger   *common.IngestLogger
+}
+
+// NewLLMClient creates a new LLM scoring endpoint client
+func NewLLMClient(config LLMClientConfig, logger *common.IngestLogger) *LLMClient {
+	return &LLMClient{
+		endpoint: common.NewJSONClient("LLM endpoint", common.JSONClientConfig{
+			URL:            config.URL,
+			APIKey:         config.APIKey,
+			Timeout:        config.Timeout,
+			MaxRetries:     config.MaxRetries,
+			RetryBaseDelay: config.RetryBaseDelay,
+		}, logger),
+		config: config,
+		logger: logger,
+	}
+}
+
+// Model returns the model name sent with each request
+func (c *LLMClient) Model() string {
+	return c.config.Model
+}
+
+type llmRequest struct {
+	Model  string    `json:"model,omitempty"`
+	Prompt string    `json:"prompt"`
+	Posts  []LLMPost `json:"posts"`
+}
+
+type llmResponse struct {
+	Scores []float64 `json:"scores"`
+}
+
+// Score returns the relevance of each post to prompt, in input order,
+// clamped to [0, 1]. Retries transport errors, 429s and 5xx responses with
+// exponential backoff; other 4xx responses fail immediately.
+func (c *LLMClient) Score(ctx context.Context, prompt string, posts []LLMPost) ([]float64, error) {
+	if len(posts) == 0 {
+		return []float64{}, nil
+	}
+	start := time.Now()
+	var response llmResponse
+	err := c.endpoint.Post(ctx, llmRequest{Model: c.config.Model, Prompt: prompt, Posts: posts}, &response)
+	c.logger.Metric("recommender.llm.request.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		c.logger.Metric("recommender.llm.request_error_count", 1)
+		return nil, err
+	}
+	scores := response.Scores
+	if len(scores) != len(posts) {
+		c.logger.Metric("recommender.llm.request_error_count", 1)
+		return nil, fmt.Errorf("score count mismatch: got %d scores for %d posts", len(scores), len(posts))
+	}
+	for i, score := range scores {
+		scores[i] = min(max(score, 0), 1)
+	}
+	return scores, nil
+}
@@ -0,0 +1,374 @@
+package recommender
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"golang.org/x/time/rate"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// LLMScoresIndex is where LLM scores are cached, one document per post and
+// prompt
+const LLMScoresIndex = "llm_scores"
+
+const (
+	// MaxLLMPosts bounds the posts one LLMScore call or LLM slate covers
+	MaxLLMPosts = 200
+	// MaxLLMPromptBytes bounds a relevance prompt
+	MaxLLMPromptBytes = 4096
+	// llmPoolFactor is how many candidates are scored per slate position;
+	// lower than engagementPoolFactor because each costs an LLM call
+	llmPoolFactor = 2
+)
+
+// LLMScorerConfig configures an LLMScorer. Zero values use defaults.
+type LLMScorerConfig struct {
+	PostsIndex  string // Alias post content is read from (default: posts)
+	ScoresIndex string // Alias scores are cached in (default: LLMScoresIndex)
+	BatchSize   int    // Posts per LLM request (default: 20)
+	RateLimit   int    // LLM requests per minute; 0 is unlimited
+}
+
+// LLMScore is the relevance of a post to a prompt, as scored by the LLM
+type LLMScore struct {
+	AtURI     string  `json:"at_uri"`
+	AuthorDID string  `json:"author_did,omitempty"`
+	Score     float64 `json:"score"`
+	Cached    bool    `json:"cached,omitempty"`   // Read from the score cache rather than scored for this request
+	Strategy  string  `json:"strategy,omitempty"` // Source that proposed the post, for slates
+	Missing   bool    `json:"missing,omitempty"`  // The post is not in the posts index; it is not scored
+}
+
+// llmScoreDoc is a cached score in the scores index
+type llmScoreDoc struct {
+	AtURI      string    `json:"at_uri"`
+	AuthorDID  string    `json:"author_did,omitempty"`
+	PromptHash string    `json:"prompt_hash"`
+	Model      string    `json:"model,omitempty"`
+	Score      float64   `json:"score"`
+	ScoredAt   time.Time `json:"scored_at"`
+}
+
+// ID returns the score's _id in the scores index. A post scored again for
+// the same prompt and model overwrites its score.
+func (d llmScoreDoc) ID() string {
+	return d.PromptHash + "|" + d.AtURI
+}
+
+// llmPostContent is the subset of a post document sent to the LLM
+type llmPostContent struct {
+	AtURI     string `json:"at_uri"`
+	AuthorDID string `json:"author_did"`
+	Content   string `json:"content"`
+}
+
+// LLMScorer scores posts' relevance to a prompt with an LLM. Scores are
+// cached in the scores index by post, prompt, and model, so each post is
+// sent to the LLM once per prompt; posts are sent in batches, at most
+// RateLimit requests a minute.
+type LLMScorer struct {
+	llm     *LLMClient
+	client  *elasticsearch.Client
+	config  LLMScorerConfig
+	limiter *rate.Limiter
+	logger  *common.IngestLogger
+}
+
+// NewLLMScorer creates a scorer calling llm and reading and caching through
+// client
+func NewLLMScorer(llm *LLMClient, client *elasticsearch.Client, config LLMScorerConfig, logger *common.IngestLogger) *LLMScorer {
+	if config.PostsIndex == "" {
+		config.PostsIndex = "posts"
+	}
+	if config.ScoresIndex == "" {
+		config.ScoresIndex = LLMScoresIndex
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 20
+	}
+	limit := rate.Inf
+	if config.RateLimit > 0 {
+		limit = rate.Limit(float64(config.RateLimit) / 60)
+	}
+	return &LLMScorer{
+		llm:     llm,
+		client:  client,
+		config:  config,
+		limiter: rate.NewLimiter(limit, 1),
+		logger:  logger,
+	}
+}
+
+// PromptHash returns the cache key of prompt: a SHA-256 of the model and
+// the prompt, so scores from another model are not reused
+func (s *LLMScorer) PromptHash(prompt string) string {
+	sum := sha256.Sum256([]byte(s.llm.Model() + "\x00" + prompt))
+	return hex.EncodeToString(sum[:])
+}
+
+// LLMScore returns the relevance of each of atURIs to prompt, from 0 to 1,
+// in the order given. Cached scores are reused; the rest are scored by the
+// LLM and cached. Posts not found are returned with Missing set. If an LLM
+// request fails, the scores already made are cached and the error returned.
+func (s *LLMScorer) LLMScore(ctx context.Context, prompt string, atURIs []string) ([]LLMScore, error) {
+	if prompt == "" || len(prompt) > MaxLLMPromptBytes {
+		return nil, fmt.Errorf("invalid prompt of %d bytes (must be from 1 to %d)", len(prompt), MaxLLMPromptBytes)
+	}
+	if len(atURIs) > MaxLLMPosts {
+		return nil, fmt.Errorf("too many posts: %d (at most %d)", len(atURIs), MaxLLMPosts)
+	}
+	start := time.Now()
+	promptHash := s.PromptHash(prompt)
+
+	cached := s.lookupCached(ctx, promptHash, atURIs)
+	var uncached []string
+	seen := make(map[string]bool, len(atURIs))
+	for _, uri := range atURIs {
+		if _, found := cached[uri]; !found && !seen[uri] {
+			uncached = append(uncached, uri)
+		}
+		seen[uri] = true
+	}
+	s.logger.Metric("recommender.llm.cache_hit_count", float64(len(cached)))
+	s.logger.Metric("recommender.llm.cache_miss_count", float64(len(uncached)))
+
+	scored, err := s.scoreUncached(ctx, prompt, promptHash, uncached)
+	if err != nil {
+		return nil, err
+	}
+
+	scores := make([]LLMScore, 0, len(atURIs))
+	for _, uri := range atURIs {
+		if doc, found := cached[uri]; found {
+			scores = append(scores, LLMScore{AtURI: uri, AuthorDID: doc.AuthorDID, Score: doc.Score, Cached: true})
+		} else if doc, found := scored[uri]; found {
+			scores = append(scores, LLMScore{AtURI: uri, AuthorDID: doc.AuthorDID, Score: doc.Score})
+		} else {
+			scores = append(scores, LLMScore{AtURI: uri, AuthorDID: common.ExtractDIDFromATURI(uri), Missing: true})
+		}
+	}
+	s.logger.Metric("recommender.llm.score.duration_ms", float64(time.Since(start).Milliseconds()))
+	return scores, nil
+}
+
+// scoreUncached scores atURIs with the LLM in batches and caches the scores,
+// keyed by at_uri. Posts that are not indexed are left out.
+func (s *LLMScorer) scoreUncached(ctx context.Context, prompt, promptHash string, atURIs []string) (map[string]llmScoreDoc, error) {
+	scored := make(map[string]llmScoreDoc, len(atURIs))
+	if len(atURIs) == 0 {
+		return scored, nil
+	}
+	posts, err := s.lookupContent(ctx, atURIs)
+	if err != nil {
+		return nil, err
+	}
+	found := make([]llmPostContent, 0, len(posts))
+	for _, uri := range atURIs {
+		if post, ok := posts[uri]; ok {
+			found = append(found, post)
+		}
+	}
+
+	var docs []llmScoreDoc
+	defer func() {
+		// Cache what was scored even if a later batch failed or the request
+		// was canceled
+		if err := common.BulkIndexWithIDs(context.WithoutCancel(ctx), s.client, s.config.ScoresIndex, docs, llmScoreDoc.ID, "LLM score", "es.bulk_index_llm_scores", false, s.logger); err != nil {
+			s.logger.Error("Failed to cache %d LLM scores: %v", len(docs), err)
+			s.logger.Metric("recommender.llm.cache_write_error_count", 1)
+		}
+	}()
+	for batchStart := 0; batchStart < len(found); batchStart += s.config.BatchSize {
+		batch := found[batchStart:min(batchStart+s.config.BatchSize, len(found))]
+		if err := s.limiter.Wait(ctx); err != nil {
+			if ctx.Err() == nil {
+				// Wait fails at once when the wait would outlast ctx's deadline
+				err = fmt.Errorf("LLM rate limit: %w", context.DeadlineExceeded)
+			}
+			return nil, err
+		}
+		request := make([]LLMPost, len(batch))
+		for i, post := range batch {
+			request[i] = LLMPost{ID: post.AtURI, Text: post.Content}
+		}
+		scores, err := s.llm.Score(ctx, prompt, request)
+		if err != nil {
+			return nil, fmt.Errorf("LLM scoring failed: %w", err)
+		}
+		now := time.Now().UTC()
+		for i, post := range batch {
+			doc := llmScoreDoc{
+				AtURI:      post.AtURI,
+				AuthorDID:  post.AuthorDID,
+				PromptHash: promptHash,
+				Model:      s.llm.Model(),
+				Score:      scores[i],
+				ScoredAt:   now,
+			}
+			docs = append(docs, doc)
+			scored[post.AtURI] = doc
+		}
+		s.logger.Metric("recommender.llm.scored_count", float64(len(batch)))
+	}
+	return scored, nil
+}
+
+// lookupCached returns the cached scores of atURIs for promptHash, keyed by
+// at_uri. A failed lookup is logged and treated as a miss.
+func (s *LLMScorer) lookupCached(ctx context.Context, promptHash string, atURIs []string) map[string]llmScoreDoc {
+	cached := make(map[string]llmScoreDoc, len(atURIs))
+	if len(atURIs) == 0 {
+		return cached
+	}
+	ids := make([]string, len(atURIs))
+	for i, uri := range atURIs {
+		ids[i] = llmScoreDoc{AtURI: uri, PromptHash: promptHash}.ID()
+	}
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"ids": map[string]interface{}{"values": ids},
+		},
+		"size": len(ids),
+	}
+	var hits []struct {
+		Source llmScoreDoc `json:"_source"`
+	}
+	if err := searchHits(ctx, s.client, s.config.ScoresIndex, query, "es.recommender_llm_scores", &hits, s.logger); err != nil {
+		s.logger.Error("Failed to read cached LLM scores, scoring every post: %v", err)
+		s.logger.Metric("recommender.llm.cache_lookup_error_count", 1)
+		return cached
+	}
+	for _, hit := range hits {
+		cached[hit.Source.AtURI] = hit.Source
+	}
+	return cached
+}
+
+// lookupContent fetches the content of posts, keyed by at_uri
+func (s *LLMScorer) lookupContent(ctx context.Context, atURIs []string) (map[string]llmPostContent, error) {
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"ids": map[string]interface{}{"values": atURIs},
+		},
+		"_source": []string{"at_uri", "author_did", "content"},
+		"size":    len(atURIs),
+	}
+	var hits []struct {
+		ID     string         `json:"_id"`
+		Source llmPostContent `json:"_source"`
+	}
+	if err := searchHits(ctx, s.client, s.config.PostsIndex, query, "es.recommender_llm_posts", &hits, s.logger); err != nil {
+		return nil, fmt.Errorf("failed to look up posts: %w", err)
+	}
+
+	posts := make(map[string]llmPostContent, len(hits))
+	for _, hit := range hits {
+		if hit.Source.AtURI == "" {
+			hit.Source.AtURI = hit.ID
+		}
+		posts[hit.ID] = hit.Source
+	}
+	return posts, nil
+}
+
+// ScoreFunc returns a score function for the slate pipeline (see
+// Stages.Score) that orders candidates by their relevance to prompt, most
+// relevant first. Candidates that could not be scored follow in retrieval
+// order. Pools of more than MaxLLMPosts candidates fail to score.
+func (s *LLMScorer) ScoreFunc(prompt string) ScoreFunc {
+	return func(ctx context.Context, userDID string, candidates []Candidate) ([]Candidate, error) {
+		uris := make([]string, len(candidates))
+		for i, c := range candidates {
+			uris[i] = c.AtURI
+		}
+		scores, err := s.LLMScore(ctx, prompt, uris)
+		if err != nil {
+			return nil, err
+		}
+
+		scored := make([]Candidate, 0, len(candidates))
+		var unscored []Candidate
+		for i, c := range candidates {
+			if scores[i].Missing {
+				unscored = append(unscored, c)
+				continue
+			}
+			c.Score = scores[i].Score
+			ExplainComponent(ctx, &c, "llm_relevance", scores[i].Score)
+			scored = append(scored, c)
+		}
+		sort.SliceStable(scored, func(i, j int) bool {
+			return scored[i].Score > scored[j].Score
+		})
+		return append(scored, unscored...), nil
+	}
+}
+
+// RecommendHighestScoringLLMPosts retrieves candidates for userDID from
+// source as RecommendMostEngagingPosts does, scores their relevance to
+// prompt with scorer, and returns the slateSize most relevant, most
+// relevant first. Scoring that misses budget, e.g. queued behind the LLM
+// rate limit, is abandoned and the slate served in retrieval order, unscored,
+// at LevelNoLLM. A zero budget means no timeout.
+func RecommendHighestScoringLLMPosts(ctx context.Context, model *EngagementModel, scorer *LLMScorer, userDID, source, prompt string, slateSize int, budget time.Duration) ([]LLMScore, DegradationLevel, error) {
+	if slateSize <= 0 || slateSize > MaxLLMPosts {
+		return nil, LevelFull, fmt.Errorf("invalid slate size %d (must be from 1 to %d)", slateSize, MaxLLMPosts)
+	}
+	if err := validateEngagementSource(source); err != nil {
+		return nil, LevelFull, err
+	}
+	if prompt == "" || len(prompt) > MaxLLMPromptBytes {
+		return nil, LevelFull, fmt.Errorf("invalid prompt of %d bytes (must be from 1 to %d)", len(prompt), MaxLLMPromptBytes)
+	}
+
+	start := time.Now()
+	candidates, _, err := model.retrieve(ctx, userDID, source, min(slateSize*llmPoolFactor, MaxLLMPosts))
+	if err != nil {
+		return nil, LevelFull, err
+	}
+	uris := make([]string, len(candidates))
+	for i, c := range candidates {
+		uris[i] = c.AtURI
+	}
+	scoreCtx, cancel := withBudget(ctx, budget)
+	scores, err := scorer.LLMScore(scoreCtx, prompt, uris)
+	cancel()
+	level := LevelFull
+	if err != nil {
+		if ctx.Err() != nil || !errors.Is(err, context.DeadlineExceeded) {
+			return nil, LevelFull, err
+		}
+		scorer.logger.Error("LLM scoring for %s missed its %s budget, serving retrieval order: %v", userDID, budget, err)
+		scorer.logger.Metric("recommender.scoring.timeout_count", 1)
+		level = LevelNoLLM
+		scores = make([]LLMScore, len(candidates))
+		for i, c := range candidates {
+			scores[i] = LLMScore{AtURI: c.AtURI, AuthorDID: c.AuthorDID}
+		}
+	}
+
+	slate := make([]LLMScore, 0, len(scores))
+	for i, score := range scores {
+		if score.Missing {
+			continue // Deleted or expired since retrieval
+		}
+		score.Strategy = candidates[i].Strategy
+		slate = append(slate, score)
+	}
+	sort.SliceStable(slate, func(i, j int) bool {
+		return slate[i].Score > slate[j].Score
+	})
+	slate = slate[:min(slateSize, len(slate))]
+
+	scorer.logger.Metric("recommender.llm.recommend.duration_ms", float64(time.Since(start).Milliseconds()))
+	scorer.logger.Metric("recommender.llm.slate_size", float64(len(slate)))
+	return slate, level, nil
+}
@@ -0,0 +1,258 @@
+package recommender
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+// fakeLLM scores posts mentioning "solar" 0.9 and the rest 0.2, recording
+// the requests it serves
+type fakeLLM struct {
+	mu       sync.Mutex
+	requests []llmRequest
+}
+
+func (f *fakeLLM) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req llmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.mu.Unlock()
+
+	scores := make([]float64, len(req.Posts))
+	for i, post := range req.Posts {
+		scores[i] = 0.2
+		if strings.Contains(post.Text, "solar") {
+			scores[i] = 0.9
+		}
+	}
+	_ = json.NewEncoder(w).Encode(llmResponse{Scores: scores})
+}
+
+func (f *fakeLLM) Requests() []llmRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]llmRequest(nil), f.requests...)
+}
+
+// newLLMFixture indexes three posts, two about solar power, and returns a
+// scorer sending two posts per LLM request
+func newLLMFixture(t *testing.T) (*estest.Server, *fakeLLM, *LLMScorer, *guardrailMetrics) {
+	t.Helper()
+	es := estest.New(t)
+	for uri, content := range map[string]string{
+		"at://did:plc:a/app.bsky.feed.post/1": "Community solar reaches 1GW",
+		"at://did:plc:b/app.bsky.feed.post/2": "Cat pictures",
+		"at://did:plc:c/app.bsky.feed.post/3": "Rooftop solar subsidies extended",
+	} {
+		es.Put("posts", uri, map[string]interface{}{
+			"at_uri":     uri,
+			"author_did": common.ExtractDIDFromATURI(uri),
+			"content":    content,
+		})
+	}
+	llm := &fakeLLM{}
+	srv := httptest.NewServer(llm)
+	t.Cleanup(srv.Close)
+
+	metrics := &guardrailMetrics{sums: map[string]float64{}}
+	logger := common.NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(metrics)
+	client := NewLLMClient(LLMClientConfig{URL: srv.URL, Model: "test-model", Timeout: 5 * time.Second}, logger)
+	return es, llm, NewLLMScorer(client, es.Client, LLMScorerConfig{BatchSize: 2}, logger), metrics
+}
+
+func TestLLMScorer_BatchesAndCaches(t *testing.T) {
+	es, llm, scorer, metrics := newLLMFixture(t)
+	uris := []string{
+		"at://did:plc:a/app.bsky.feed.post/1",
+		"at://did:plc:b/app.bsky.feed.post/2",
+		"at://did:plc:gone/app.bsky.feed.post/4",
+		"at://did:plc:c/app.bsky.feed.post/3",
+	}
+
+	scores, err := scorer.LLMScore(context.Background(), "climate solutions", uris)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scores) != 4 || scores[0].Score != 0.9 || scores[1].Score != 0.2 || scores[3].Score != 0.9 || scores[0].Cached {
+		t.Fatalf("expected a score per post in request order, got %+v", scores)
+	}
+	if missing := scores[2]; !missing.Missing || missing.AuthorDID != "did:plc:gone" {
+		t.Errorf("expected the unindexed post flagged missing, got %+v", missing)
+	}
+	requests := llm.Requests()
+	if len(requests) != 2 || len(requests[0].Posts) != 2 || len(requests[1].Posts) != 1 {
+		t.Fatalf("expected the three indexed posts sent in batches of two, got %+v", requests)
+	}
+	if requests[0].Model != "test-model" || requests[0].Prompt != "climate solutions" || requests[0].Posts[0].ID != uris[0] {
+		t.Errorf("unexpected LLM request %+v", requests[0])
+	}
+	if es.Len(LLMScoresIndex) != 3 {
+		t.Errorf("expected three scores cached, got %d", es.Len(LLMScoresIndex))
+	}
+	if doc, ok := es.Get(LLMScoresIndex, scorer.PromptHash("climate solutions")+"|"+uris[0]); !ok || doc["score"] != 0.9 || doc["model"] != "test-model" {
+		t.Errorf("unexpected cached score %v", doc)
+	}
+
+	// The second call reads every score from the cache
+	again, err := scorer.LLMScore(context.Background(), "climate solutions", uris)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(llm.Requests()) != 2 {
+		t.Errorf("expected cached scores not to be sent to the LLM, got %d requests", len(llm.Requests()))
+	}
+	if !again[0].Cached || again[0].Score != 0.9 || again[0].AuthorDID != "did:plc:a" || !again[2].Missing {
+		t.Errorf("unexpected cached scores %+v", again)
+	}
+	if hits, misses := metrics.Sum("recommender.llm.cache_hit_count"), metrics.Sum("recommender.llm.cache_miss_count"); hits != 3 || misses != 5 {
+		t.Errorf("expected 3 cache hits and 5 misses, got %v and %v", hits, misses)
+	}
+
+	// Another prompt is scored anew
+	if _, err := scorer.LLMScore(context.Background(), "sports", uris[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if len(llm.Requests()) != 3 {
+		t.Errorf("expected another prompt scored by the LLM, got %d requests", len(llm.Requests()))
+	}
+}
+
+func TestLLMScorer_RejectsInvalidInput(t *testing.T) {
+	_, llm, scorer, _ := newLLMFixture(t)
+
+	if _, err := scorer.LLMScore(context.Background(), "", []string{"at://did:plc:a/app.bsky.feed.post/1"}); err == nil {
+		t.Error("expected an error without a prompt")
+	}
+	if _, err := scorer.LLMScore(context.Background(), strings.Repeat("x", MaxLLMPromptBytes+1), nil); err == nil {
+		t.Error("expected an error for an oversized prompt")
+	}
+	if _, err := scorer.LLMScore(context.Background(), "climate", make([]string, MaxLLMPosts+1)); err == nil {
+		t.Error("expected an error for too many posts")
+	}
+	if len(llm.Requests()) != 0 {
+		t.Errorf("expected invalid input not to reach the LLM, got %d requests", len(llm.Requests()))
+	}
+}
+
+func TestLLMScorer_ScoreFunc(t *testing.T) {
+	_, _, scorer, _ := newLLMFixture(t)
+	candidates := []Candidate{
+		{AtURI: "at://did:plc:gone/app.bsky.feed.post/4"},
+		{AtURI: "at://did:plc:b/app.bsky.feed.post/2"},
+		{AtURI: "at://did:plc:c/app.bsky.feed.post/3"},
+	}
+
+	ranked, err := scorer.ScoreFunc("climate solutions")(context.Background(), "did:plc:u", candidates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ranked) != 3 || ranked[0].AtURI != candidates[2].AtURI || ranked[0].Score != 0.9 || ranked[1].AtURI != candidates[1].AtURI {
+		t.Fatalf("expected candidates ordered by relevance, got %+v", ranked)
+	}
+	if ranked[2].AtURI != candidates[0].AtURI {
+		t.Errorf("expected the unscored candidate last, got %+v", ranked[2])
+	}
+}
+
+func TestRecommendHighestScoringLLMPosts(t *testing.T) {
+	es, ctx := newEngagementFixture(t)
+	for uri, content := range map[string]string{
+		"at://did:plc:fav/app.bsky.feed.post/close":     "Wind and solar",
+		"at://did:plc:other/app.bsky.feed.post/popular": "Transfer rumours",
+	} {
+		doc, _ := es.Get("posts", uri)
+		doc["content"] = content
+		es.Put("posts", uri, doc)
+	}
+	llm := &fakeLLM{}
+	srv := httptest.NewServer(llm)
+	defer srv.Close()
+	logger := common.NewLogger(false)
+	model := NewEngagementModel(es.Client, EngagementConfig{Window: 24 * time.Hour}, logger)
+	scorer := NewLLMScorer(NewLLMClient(LLMClientConfig{URL: srv.URL}, logger), es.Client, LLMScorerConfig{}, logger)
+
+	slate, level, err := RecommendHighestScoringLLMPosts(ctx, model, scorer, engagementUser, EngagementSourceTrending, "climate solutions", 2, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level != LevelFull {
+		t.Errorf("expected LevelFull, got %s", level)
+	}
+	if len(slate) != 2 || slate[0].AtURI != "at://did:plc:fav/app.bsky.feed.post/close" || slate[0].Score != 0.9 || slate[1].Score != 0.2 {
+		t.Fatalf("expected the relevant post ranked first, got %+v", slate)
+	}
+	for _, s := range slate {
+		if s.Strategy != "engagement_trending" || s.AuthorDID == engagementUser {
+			t.Errorf("unexpected slate entry %+v", s)
+		}
+	}
+
+	if _, _, err := RecommendHighestScoringLLMPosts(ctx, model, scorer, engagementUser, "following", "climate", 2, 0); err == nil {
+		t.Error("expected an error for an unknown source")
+	}
+	if _, _, err := RecommendHighestScoringLLMPosts(ctx, model, scorer, engagementUser, EngagementSourceTrending, "climate", MaxLLMPosts+1, 0); err == nil {
+		t.Error("expected an error for an oversized slate")
+	}
+}
+
+func TestRecommendHighestScoringLLMPosts_ServesRetrievalOrderPastBudget(t *testing.T) {
+	es, ctx := newEngagementFixture(t)
+	for uri, content := range map[string]string{
+		"at://did:plc:fav/app.bsky.feed.post/close":     "Wind and solar",
+		"at://did:plc:other/app.bsky.feed.post/popular": "Transfer rumours",
+	} {
+		doc, _ := es.Get("posts", uri)
+		doc["content"] = content
+		es.Put("posts", uri, doc)
+	}
+	llm := &fakeLLM{}
+	srv := httptest.NewServer(llm)
+	defer srv.Close()
+	metrics := &guardrailMetrics{sums: map[string]float64{}}
+	logger := common.NewLogger(true)
+	logger.SetOutput(io.Discard)
+	logger.SetMetricCollector(metrics)
+	model := NewEngagementModel(es.Client, EngagementConfig{Window: 24 * time.Hour}, logger)
+	// One request a minute: the first call spends the only token
+	scorer := NewLLMScorer(NewLLMClient(LLMClientConfig{URL: srv.URL}, logger), es.Client, LLMScorerConfig{RateLimit: 1}, logger)
+	if _, _, err := RecommendHighestScoringLLMPosts(ctx, model, scorer, engagementUser, EngagementSourceTrending, "sports", 2, time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	slate, level, err := RecommendHighestScoringLLMPosts(ctx, model, scorer, engagementUser, EngagementSourceTrending, "climate solutions", 2, 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the budget to bound the rate limit wait, took %s", elapsed)
+	}
+	if level != LevelNoLLM || len(slate) != 2 {
+		t.Fatalf("expected an unscored slate of 2 at no_llm, got %+v at %s", slate, level)
+	}
+	if slate[0].AtURI != "at://did:plc:other/app.bsky.feed.post/popular" || slate[0].Score != 0 || slate[0].Strategy != "engagement_trending" {
+		t.Errorf("expected the retrieval order served, got %+v", slate)
+	}
+	if len(llm.Requests()) != 1 {
+		t.Errorf("expected no LLM request past the budget, got %d", len(llm.Requests()))
+	}
+	if metrics.Sum("recommender.scoring.timeout_count") != 1 {
+		t.Errorf("expected the timeout counted, got %v", metrics.sums)
+	}
+}
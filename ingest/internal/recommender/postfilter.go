@@ -0,0 +1,263 @@
+package recommender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/elastic/go-elasticsearch/v9"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// Media requirements of PostFilterRules
+const (
+	MediaAny     = ""        // no requirement
+	MediaRequire = "require" // drop posts without images or video
+	MediaForbid  = "forbid"  // drop posts with images or video
+)
+
+// postFilterIndex is where the posts and replies of candidates are looked up
+const postFilterIndex = "posts,replies"
+
+// PostFilterRules decide which scored candidates may be served. The zero
+// value allows every post.
+type PostFilterRules struct {
+	MaxAge           time.Duration // Oldest post served, by created_at; 0 is unbounded
+	MinContentLength int           // Fewest characters of text a post must have
+	Media            string        // MediaAny, MediaRequire, or MediaForbid
+	ExcludeReplies   bool          // Drop replies
+}
+
+// postFilterDocument is the stored form of PostFilterRules, with a Go
+// duration string
+type postFilterDocument struct {
+	MaxPostAge       string `json:"max_post_age,omitempty"`
+	MinContentLength int    `json:"min_content_length,omitempty"`
+	Media            string `json:"media,omitempty"`
+	ExcludeReplies   bool   `json:"exclude_replies,omitempty"`
+}
+
+// LoadPostFilterRules reads post filter rules from a local path or GCS
+// (gs://bucket/object). An empty path allows every post.
+func LoadPostFilterRules(ctx context.Context, path string) (PostFilterRules, error) {
+	if path == "" {
+		return PostFilterRules{}, nil
+	}
+	data, err := readConfigSource(ctx, path, "post filters")
+	if err != nil {
+		return PostFilterRules{}, err
+	}
+	return parsePostFilterRules(data, path)
+}
+
+func parsePostFilterRules(data []byte, name string) (PostFilterRules, error) {
+	var doc postFilterDocument
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		return PostFilterRules{}, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+
+	rules := PostFilterRules{
+		MinContentLength: doc.MinContentLength,
+		Media:            doc.Media,
+		ExcludeReplies:   doc.ExcludeReplies,
+	}
+	if doc.MaxPostAge != "" {
+		d, err := time.ParseDuration(doc.MaxPostAge)
+		if err != nil || d < 0 {
+			return PostFilterRules{}, fmt.Errorf("%s: invalid max_post_age %q", name, doc.MaxPostAge)
+		}
+		rules.MaxAge = d
+	}
+	if rules.MinContentLength < 0 {
+		return PostFilterRules{}, fmt.Errorf("%s: invalid min_content_length %d", name, rules.MinContentLength)
+	}
+	switch rules.Media {
+	case MediaAny, MediaRequire, MediaForbid:
+	default:
+		return PostFilterRules{}, fmt.Errorf("%s: unknown media requirement %q (expected %s or %s)", name, rules.Media, MediaRequire, MediaForbid)
+	}
+	return rules, nil
+}
+
+// IsZero reports whether the rules allow every post
+func (r PostFilterRules) IsZero() bool {
+	return r == PostFilterRules{}
+}
+
+// filteredPost is the subset of a post or reply document the rules read
+type filteredPost struct {
+	CreatedAt        string `json:"created_at"`
+	Content          string `json:"content"`
+	ThreadParentPost string `json:"thread_parent_post"`
+	ThreadRootPost   string `json:"thread_root_post"`
+	ContainsImages   bool   `json:"contains_images"`
+	ContainsVideo    bool   `json:"contains_video"`
+	MediaCount       int    `json:"media_count"`
+}
+
+// violation returns the first rule post breaks as of now, or "" if it
+// breaks none. A created_at that cannot be parsed does not count against
+// MaxAge.
+func (r PostFilterRules) violation(post filteredPost, now time.Time) string {
+	if r.MaxAge > 0 {
+		if createdAt, err := time.Parse(time.RFC3339Nano, post.CreatedAt); err == nil && now.Sub(createdAt) > r.MaxAge {
+			return "age"
+		}
+	}
+	if r.MinContentLength > 0 && utf8.RuneCountInString(strings.TrimSpace(post.Content)) < r.MinContentLength {
+		return "content_length"
+	}
+	hasMedia := post.ContainsImages || post.ContainsVideo || post.MediaCount > 0
+	if (r.Media == MediaRequire && !hasMedia) || (r.Media == MediaForbid && hasMedia) {
+		return "media"
+	}
+	if r.ExcludeReplies && (post.ThreadParentPost != "" || post.ThreadRootPost != "") {
+		return "reply"
+	}
+	return ""
+}
+
+// PostFilter drops scored candidates whose posts break its rules, so feed
+// composition can be tuned by configuration (GE_RECOMMENDER_POST_FILTERS)
+// rather than code. A nil PostFilter keeps every candidate.
+type PostFilter struct {
+	client *elasticsearch.Client
+	rules  PostFilterRules
+	logger *common.IngestLogger
+}
+
+// NewPostFilter creates a filter that looks candidates up in the posts and
+// replies read aliases. Returns nil for rules that allow every post so
+// callers can use the result unconditionally.
+func NewPostFilter(client *elasticsearch.Client, rules PostFilterRules, logger *common.IngestLogger) *PostFilter {
+	if rules.IsZero() {
+		return nil
+	}
+	return &PostFilter{client: client, rules: rules, logger: logger}
+}
+
+// PostFilterFromConfig creates the filter GE_RECOMMENDER_POST_FILTERS
+// configures, or nil when it is unset
+func PostFilterFromConfig(ctx context.Context, client *elasticsearch.Client, config *common.Config, logger *common.IngestLogger) (*PostFilter, error) {
+	rules, err := LoadPostFilterRules(ctx, config.RecommenderPostFilterPath)
+	if err != nil {
+		return nil, err
+	}
+	return NewPostFilter(client, rules, logger), nil
+}
+
+// Filter returns candidates without those whose posts break the rules,
+// preserving order. Age is measured from the snapshot bound by WithSnapshot.
+// Candidates whose posts are not found are kept, and if the lookup fails
+// it is logged and every candidate is kept: filtering shapes the slate but
+// is not worth failing the request over.
+func (f *PostFilter) Filter(ctx context.Context, candidates []Candidate) []Candidate {
+	if f == nil || len(candidates) == 0 {
+		return candidates
+	}
+	posts, err := f.lookup(ctx, candidates)
+	if err != nil {
+		f.logger.Metric("recommender.post_filter.lookup_error_count", 1)
+		f.logger.Error("Post filter lookup failed, serving %d unfiltered candidates: %v", len(candidates), err)
+		return candidates
+	}
+
+	now := snapshotFrom(ctx)
+	kept := make([]Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		post, found := posts[c.AtURI]
+		if found {
+			if rule := f.rules.violation(post, now); rule != "" {
+				f.logger.Debug("Post filter: dropped %s (%s)", c.AtURI, rule)
+				continue
+			}
+		}
+		kept = append(kept, c)
+	}
+	f.logger.Metric("recommender.post_filter.dropped_count", float64(len(candidates)-len(kept)))
+	return kept
+}
+
+// lookup fetches the filtered fields of the candidates' posts, keyed by
+// at_uri. The read aliases span several indices, so it searches by ID
+// rather than using mget.
+func (f *PostFilter) lookup(ctx context.Context, candidates []Candidate) (map[string]filteredPost, error) {
+	ids := make([]string, 0, len(candidates))
+	authors := make(map[string]bool)
+	missingAuthor := false
+	for _, c := range candidates {
+		ids = append(ids, c.AtURI)
+		if c.AuthorDID == "" {
+			missingAuthor = true
+		} else {
+			authors[c.AuthorDID] = true
+		}
+	}
+
+	query := map[string]interface{}{
+		"query": map[string]interface{}{
+			"ids": map[string]interface{}{"values": ids},
+		},
+		"_source": []string{"created_at", "content", "thread_parent_post", "thread_root_post", "contains_images", "contains_video", "media_count"},
+		"size":    len(ids),
+	}
+	queryJSON, err := json.Marshal(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	// Only the authors' shards need searching, unless a candidate has no author
+	var routing []string
+	if !missingAuthor {
+		for did := range authors {
+			routing = append(routing, did)
+		}
+	}
+
+	start := time.Now()
+	res, err := f.client.Search(
+		f.client.Search.WithContext(ctx),
+		f.client.Search.WithIndex(postFilterIndex),
+		f.client.Search.WithBody(bytes.NewReader(queryJSON)),
+		f.client.Search.WithRouting(routing...),
+		f.client.Search.WithIgnoreUnavailable(true),
+	)
+	f.logger.Metric("es.recommender_post_filter.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("search request failed: %w", err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			f.logger.Error("Failed to close search response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("search request returned error: %s", res.String())
+	}
+
+	var response struct {
+		Hits struct {
+			Hits []struct {
+				ID     string       `json:"_id"`
+				Source filteredPost `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse search response: %w", err)
+	}
+
+	posts := make(map[string]filteredPost, len(response.Hits.Hits))
+	for _, hit := range response.Hits.Hits {
+		posts[hit.ID] = hit.Source
+	}
+	return posts, nil
+}
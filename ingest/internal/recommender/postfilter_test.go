@@ -0,0 +1,132 @@
+package recommender
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func TestLoadPostFilterRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "filters.json")
+	body := `{"max_post_age":"48h","min_content_length":20,"media":"forbid","exclude_replies":true}`
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("failed to write post filters: %v", err)
+	}
+
+	rules, err := LoadPostFilterRules(context.Background(), path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := PostFilterRules{MaxAge: 48 * time.Hour, MinContentLength: 20, Media: MediaForbid, ExcludeReplies: true}
+	if rules != want {
+		t.Errorf("got %+v, want %+v", rules, want)
+	}
+
+	if rules, err := LoadPostFilterRules(context.Background(), ""); err != nil || !rules.IsZero() {
+		t.Errorf("expected no rules without a path, got %+v (%v)", rules, err)
+	}
+}
+
+func TestParsePostFilterRules_Invalid(t *testing.T) {
+	for _, body := range []string{
+		`{"max_post_age":"two days"}`,
+		`{"max_post_age":"-1h"}`,
+		`{"min_content_length":-1}`,
+		`{"media":"video"}`,
+		`{"exclude_reply":true}`,
+	} {
+		if _, err := parsePostFilterRules([]byte(body), "test"); err == nil {
+			t.Errorf("expected %s to be rejected", body)
+		}
+	}
+}
+
+func TestPostFilterRules_Violation(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	post := filteredPost{CreatedAt: "2026-10-16T10:00:00Z", Content: "a post with enough text", MediaCount: 1, ContainsImages: true}
+
+	tests := []struct {
+		name   string
+		rules  PostFilterRules
+		post   filteredPost
+		expect string
+	}{
+		{"no rules", PostFilterRules{}, post, ""},
+		{"young enough", PostFilterRules{MaxAge: 3 * time.Hour}, post, ""},
+		{"too old", PostFilterRules{MaxAge: time.Hour}, post, "age"},
+		{"unparseable created_at", PostFilterRules{MaxAge: time.Hour}, filteredPost{CreatedAt: "yesterday"}, ""},
+		{"long enough", PostFilterRules{MinContentLength: 10}, post, ""},
+		{"too short", PostFilterRules{MinContentLength: 10}, filteredPost{Content: "  héllo  "}, "content_length"},
+		{"media required", PostFilterRules{Media: MediaRequire}, filteredPost{}, "media"},
+		{"media required and present", PostFilterRules{Media: MediaRequire}, filteredPost{ContainsVideo: true}, ""},
+		{"media forbidden", PostFilterRules{Media: MediaForbid}, post, "media"},
+		{"reply excluded", PostFilterRules{ExcludeReplies: true}, filteredPost{ThreadParentPost: "at://parent"}, "reply"},
+		{"top-level post kept", PostFilterRules{ExcludeReplies: true}, post, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rules.violation(tt.post, now); got != tt.expect {
+				t.Errorf("expected %q, got %q", tt.expect, got)
+			}
+		})
+	}
+}
+
+func TestNewPostFilter_NilWithoutRules(t *testing.T) {
+	filter := NewPostFilter(nil, PostFilterRules{}, common.NewLogger(false))
+	if filter != nil {
+		t.Fatal("expected no filter for empty rules")
+	}
+	candidates := makeCandidates("r", 2)
+	if got := filter.Filter(context.Background(), candidates); len(got) != 2 {
+		t.Errorf("a nil filter should keep every candidate, got %d", len(got))
+	}
+}
+
+func TestDegradingPipeline_FiltersScoredCandidates(t *testing.T) {
+	es := estest.New(t)
+	candidates := makeCandidates("r", 4)
+	es.Put("posts", candidates[0].AtURI, map[string]interface{}{"created_at": "2026-10-16T11:00:00Z", "content": "fresh post"})
+	es.Put("posts", candidates[1].AtURI, map[string]interface{}{"created_at": "2026-10-10T11:00:00Z", "content": "stale post"})
+	es.Put("replies", candidates[2].AtURI, map[string]interface{}{"created_at": "2026-10-16T11:00:00Z", "content": "fresh reply", "thread_parent_post": candidates[0].AtURI})
+	// candidates[3] is not indexed and is kept
+
+	filter := NewPostFilter(es.Client, PostFilterRules{MaxAge: 24 * time.Hour, ExcludeReplies: true}, common.NewLogger(false))
+	stages := Stages{
+		Retrieve: func(context.Context, string, int) ([]Candidate, error) {
+			return candidates, nil
+		},
+		Score: func(_ context.Context, _ string, c []Candidate) ([]Candidate, error) {
+			return []Candidate{c[3], c[2], c[1], c[0]}, nil
+		},
+		Filter: filter,
+	}
+	p := NewDegradingPipeline(stages, StageBudgets{}, 100, 10, common.NewLogger(false))
+
+	ctx := WithSnapshot(context.Background(), time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC))
+	slate, _, err := p.Serve(ctx, "did:plc:viewer", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(slate) != 2 || slate[0].AtURI != candidates[3].AtURI || slate[1].AtURI != candidates[0].AtURI {
+		t.Errorf("expected candidates 3 and 0 in scored order, got %v", slate)
+	}
+}
+
+func TestPostFilter_LookupFailureKeepsCandidates(t *testing.T) {
+	client := estest.NewClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"error":"unavailable"}`))
+	})
+	filter := NewPostFilter(client, PostFilterRules{ExcludeReplies: true}, common.NewLogger(false))
+
+	if got := filter.Filter(context.Background(), makeCandidates("r", 3)); len(got) != 3 {
+		t.Errorf("expected all 3 candidates kept when the lookup fails, got %d", len(got))
+	}
+}
@@ -0,0 +1,167 @@
+package recommender
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// ScoreFunc reorders candidates for a user
+type ScoreFunc func(ctx context.Context, userDID string, candidates []Candidate) ([]Candidate, error)
+
+// ShadowConfig registers a secondary scoring configuration
+type ShadowConfig struct {
+	Name           string        // identifies the configuration in shadow logs
+	Score          ScoreFunc     // secondary scorer; never served
+	SampleRate     float64       // fraction of users (0-1) whose requests are shadowed
+	Timeout        time.Duration // per-run budget, independent of the request deadline
+	MaxConcurrency int           // in-flight shadow runs; excess samples are dropped
+	// Filter drops shadow-ranked posts as the production Filter stage drops
+	// scored ones, so both slates come from the same posts; optional
+	Filter *PostFilter
+}
+
+// ShadowRecord is the log line comparing a shadow slate to the served one
+type ShadowRecord struct {
+	Shadow     string    `json:"shadow"`
+	UserDID    string    `json:"user_did"`
+	Production []string  `json:"production"`
+	Candidate  []string  `json:"candidate"`
+	Overlap    float64   `json:"overlap"`
+	DurationMs int64     `json:"duration_ms"`
+	LoggedAt   time.Time `json:"logged_at"`
+}
+
+// ShadowScorer runs a secondary scorer asynchronously on sampled requests and
+// logs its would-be slate next to the production slate
+type ShadowScorer struct {
+	config ShadowConfig
+	sem    chan struct{}
+	wg     sync.WaitGroup
+	logger *common.IngestLogger
+}
+
+// NewShadowScorer creates a shadow scorer
+func NewShadowScorer(config ShadowConfig, logger *common.IngestLogger) *ShadowScorer {
+	if config.MaxConcurrency <= 0 {
+		config.MaxConcurrency = 4
+	}
+	return &ShadowScorer{
+		config: config,
+		sem:    make(chan struct{}, config.MaxConcurrency),
+		logger: logger,
+	}
+}
+
+// sampled buckets users by FNV-32a so a shadowed user stays shadowed across
+// requests, which keeps per-user comparisons consistent
+func (s *ShadowScorer) sampled(userDID string) bool {
+	if s.config.SampleRate <= 0 {
+		return false
+	}
+	if s.config.SampleRate >= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(userDID))
+	return float64(h.Sum32()%10000) < s.config.SampleRate*10000
+}
+
+// Observe schedules a shadow run for a served request if the user is sampled
+// and capacity is available. It never blocks the caller. candidates are the
+// pool production scored, after the filters that run before scoring. The run
+// outlives ctx but reads at its snapshot (see WithSnapshot), as production did.
+func (s *ShadowScorer) Observe(ctx context.Context, userDID string, candidates, production []Candidate) {
+	if s == nil || !s.sampled(userDID) {
+		return
+	}
+
+	select {
+	case s.sem <- struct{}{}:
+	default:
+		s.logger.Metric("recommender.shadow.dropped_count", 1)
+		return
+	}
+
+	// Copy inputs; the serving path may reuse or reorder its slices
+	candidatesCopy := append([]Candidate(nil), candidates...)
+	productionCopy := append([]Candidate(nil), production...)
+	snapshot := snapshotFrom(ctx)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() { <-s.sem }()
+		s.run(snapshot, userDID, candidatesCopy, productionCopy)
+	}()
+}
+
+func (s *ShadowScorer) run(snapshot time.Time, userDID string, candidates, production []Candidate) {
+	ctx, cancel := withBudget(WithSnapshot(context.Background(), snapshot), s.config.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	scored, err := s.config.Score(ctx, userDID, candidates)
+	if err != nil {
+		s.logger.Error("Shadow scorer %s failed for %s: %v", s.config.Name, userDID, err)
+		s.logger.Metric("recommender.shadow.errors", 1)
+		return
+	}
+	scored = s.config.Filter.Filter(ctx, scored)
+	duration := time.Since(start)
+
+	shadowSlate := scored[:min(len(production), len(scored))]
+	record := ShadowRecord{
+		Shadow:     s.config.Name,
+		UserDID:    userDID,
+		Production: atURIs(production),
+		Candidate:  atURIs(shadowSlate),
+		Overlap:    slateOverlap(production, shadowSlate),
+		DurationMs: duration.Milliseconds(),
+		LoggedAt:   time.Now().UTC(),
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		s.logger.Error("Failed to marshal shadow record: %v", err)
+		return
+	}
+	s.logger.Info("shadow_slate %s", line)
+	s.logger.Metric("recommender.shadow.duration_ms", float64(duration.Milliseconds()))
+	s.logger.Metric("recommender.shadow.overlap", record.Overlap)
+}
+
+// Wait blocks until all in-flight shadow runs finish
+func (s *ShadowScorer) Wait() {
+	s.wg.Wait()
+}
+
+func atURIs(candidates []Candidate) []string {
+	uris := make([]string, len(candidates))
+	for i, c := range candidates {
+		uris[i] = c.AtURI
+	}
+	return uris
+}
+
+// slateOverlap returns the fraction of production posts also in the shadow slate
+func slateOverlap(production, shadow []Candidate) float64 {
+	if len(production) == 0 {
+		return 0
+	}
+	inShadow := make(map[string]bool, len(shadow))
+	for _, c := range shadow {
+		inShadow[c.AtURI] = true
+	}
+	shared := 0
+	for _, c := range production {
+		if inShadow[c.AtURI] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(production))
+}
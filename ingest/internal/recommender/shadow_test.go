@@ -0,0 +1,158 @@
+package recommender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+func reverseScore(_ context.Context, _ string, candidates []Candidate) ([]Candidate, error) {
+	out := make([]Candidate, len(candidates))
+	for i, c := range candidates {
+		out[len(candidates)-1-i] = c
+	}
+	return out, nil
+}
+
+func TestShadowScorer_LogsComparison(t *testing.T) {
+	var buf bytes.Buffer
+	logger := common.NewLogger(true)
+	logger.SetOutput(&buf)
+
+	shadow := NewShadowScorer(ShadowConfig{Name: "reverse", Score: reverseScore, SampleRate: 1}, logger)
+	candidates := makeCandidates("c", 4)
+	shadow.Observe(context.Background(), "did:plc:viewer", candidates, candidates[:2])
+	shadow.Wait()
+
+	output := buf.String()
+	idx := strings.Index(output, "shadow_slate ")
+	if idx == -1 {
+		t.Fatalf("expected shadow_slate log line, got %q", output)
+	}
+	var record ShadowRecord
+	line := strings.TrimSpace(output[idx+len("shadow_slate "):])
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		t.Fatalf("failed to parse shadow record: %v", err)
+	}
+	if record.Shadow != "reverse" || len(record.Candidate) != 2 {
+		t.Errorf("unexpected record: %+v", record)
+	}
+	if record.Overlap != 0 {
+		t.Errorf("expected no overlap between head and reversed tail, got %v", record.Overlap)
+	}
+}
+
+func TestShadowScorer_FiltersAtRequestSnapshot(t *testing.T) {
+	var buf bytes.Buffer
+	logger := common.NewLogger(true)
+	logger.SetOutput(&buf)
+	es := estest.New(t)
+	candidates := makeCandidates("c", 3)
+	es.Put("posts", candidates[0].AtURI, map[string]interface{}{"created_at": "2025-01-27T11:00:00Z", "content": "fresh post"})
+	es.Put("posts", candidates[1].AtURI, map[string]interface{}{"created_at": "2025-01-20T11:00:00Z", "content": "stale post"})
+
+	snapshot := time.Date(2025, 1, 27, 12, 0, 0, 0, time.UTC)
+	var scoredAt time.Time
+	score := func(ctx context.Context, userDID string, c []Candidate) ([]Candidate, error) {
+		scoredAt = snapshotFrom(ctx)
+		return reverseScore(ctx, userDID, c)
+	}
+	filter := NewPostFilter(es.Client, PostFilterRules{MaxAge: 24 * time.Hour}, logger)
+	shadow := NewShadowScorer(ShadowConfig{Name: "reverse", Score: score, SampleRate: 1, Filter: filter}, logger)
+
+	// The request was canceled once served; the shadow run still reads at
+	// its snapshot and drops what production's filter drops
+	ctx, cancel := context.WithCancel(WithSnapshot(context.Background(), snapshot))
+	cancel()
+	shadow.Observe(ctx, "did:plc:viewer", candidates, []Candidate{candidates[0], candidates[2]})
+	shadow.Wait()
+
+	if !scoredAt.Equal(snapshot) {
+		t.Errorf("expected the shadow run at the request snapshot, got %v", scoredAt)
+	}
+	output := buf.String()
+	idx := strings.Index(output, "shadow_slate ")
+	if idx == -1 {
+		t.Fatalf("expected shadow_slate log line, got %q", output)
+	}
+	var record ShadowRecord
+	line, _, _ := strings.Cut(output[idx+len("shadow_slate "):], "\n")
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		t.Fatalf("failed to parse shadow record: %v", err)
+	}
+	if len(record.Candidate) != 2 || record.Candidate[0] != candidates[2].AtURI || record.Candidate[1] != candidates[0].AtURI || record.Overlap != 1 {
+		t.Errorf("expected the stale post filtered from the shadow slate, got %+v", record)
+	}
+}
+
+func TestShadowScorer_SamplingIsPerUser(t *testing.T) {
+	shadow := NewShadowScorer(ShadowConfig{SampleRate: 0.1}, common.NewLogger(false))
+
+	sampled := 0
+	for i := 0; i < 10000; i++ {
+		did := fmt.Sprintf("did:plc:user%d", i)
+		first := shadow.sampled(did)
+		if shadow.sampled(did) != first {
+			t.Fatalf("expected deterministic sampling for %s", did)
+		}
+		if first {
+			sampled++
+		}
+	}
+	if sampled < 700 || sampled > 1300 {
+		t.Errorf("expected ~10%% of users sampled, got %d", sampled)
+	}
+
+	off := NewShadowScorer(ShadowConfig{SampleRate: 0}, common.NewLogger(false))
+	if off.sampled("did:plc:user1") {
+		t.Error("expected zero sample rate to disable shadowing")
+	}
+}
+
+func TestShadowScorer_DropsWhenSaturated(t *testing.T) {
+	release := make(chan struct{})
+	calls := 0
+	blocking := func(_ context.Context, _ string, candidates []Candidate) ([]Candidate, error) {
+		calls++
+		<-release
+		return candidates, nil
+	}
+
+	shadow := NewShadowScorer(ShadowConfig{Name: "slow", Score: blocking, SampleRate: 1, MaxConcurrency: 1}, common.NewLogger(false))
+	candidates := makeCandidates("c", 2)
+	shadow.Observe(context.Background(), "did:plc:a", candidates, candidates)
+	shadow.Observe(context.Background(), "did:plc:b", candidates, candidates)
+	close(release)
+	shadow.Wait()
+
+	if calls != 1 {
+		t.Errorf("expected second run to be dropped, got %d calls", calls)
+	}
+}
+
+func TestShadowScorer_ErrorDoesNotPanic(t *testing.T) {
+	failing := func(context.Context, string, []Candidate) ([]Candidate, error) {
+		return nil, errors.New("model unavailable")
+	}
+	shadow := NewShadowScorer(ShadowConfig{Name: "broken", Score: failing, SampleRate: 1}, common.NewLogger(false))
+	shadow.Observe(context.Background(), "did:plc:a", makeCandidates("c", 2), nil)
+	shadow.Wait()
+}
+
+func TestSlateOverlap(t *testing.T) {
+	a := makeCandidates("x", 4)
+	if got := slateOverlap(a, a[2:]); got != 0.5 {
+		t.Errorf("expected 0.5 overlap, got %v", got)
+	}
+	if got := slateOverlap(nil, a); got != 0 {
+		t.Errorf("expected 0 overlap for empty production slate, got %v", got)
+	}
+}
@@ -0,0 +1,128 @@
+package stage_mirror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+)
+
+// IndexProgress is how far one alias has been mirrored
+type IndexProgress struct {
+	IndexedAt string            `json:"indexed_at"`      // indexed_at of the last document read
+	After     []json.RawMessage `json:"after,omitempty"` // Sort values of the last document read, for search_after
+	Copied    int64             `json:"copied"`
+	Skipped   int64             `json:"skipped"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// Progress is the mirror's checkpoint, keyed by alias
+type Progress struct {
+	Indices map[string]*IndexProgress `json:"indices"`
+}
+
+func (p *Progress) index(name string) *IndexProgress {
+	if p.Indices == nil {
+		p.Indices = make(map[string]*IndexProgress)
+	}
+	if p.Indices[name] == nil {
+		p.Indices[name] = &IndexProgress{}
+	}
+	return p.Indices[name]
+}
+
+// ReadProgress reads progress from a local path or GCS (gs://bucket/object).
+// A missing file is empty progress.
+func ReadProgress(ctx context.Context, path string) (*Progress, error) {
+	var data []byte
+	if strings.HasPrefix(path, "gs://") {
+		bucket, object, err := parseGCSPath(path)
+		if err != nil {
+			return nil, err
+		}
+		client, err := storage.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GCS client: %w", err)
+		}
+		defer func() { _ = client.Close() }()
+
+		reader, err := client.Bucket(bucket).Object(object).NewReader(ctx)
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return &Progress{}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open mirror progress in GCS: %w", err)
+		}
+		defer func() { _ = reader.Close() }() // Best-effort close for read operation
+
+		data, err = io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mirror progress from GCS: %w", err)
+		}
+	} else {
+		var err error
+		data, err = os.ReadFile(path) //nolint:gosec // G304: path comes from service configuration
+		if errors.Is(err, os.ErrNotExist) {
+			return &Progress{}, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mirror progress: %w", err)
+		}
+	}
+
+	var progress Progress
+	if err := json.Unmarshal(data, &progress); err != nil {
+		return nil, fmt.Errorf("failed to parse mirror progress %s: %w", path, err)
+	}
+	return &progress, nil
+}
+
+// WriteProgress writes progress as JSON to a local path or GCS (gs://bucket/object)
+func WriteProgress(ctx context.Context, path string, progress *Progress) error {
+	data, err := json.MarshalIndent(progress, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal mirror progress: %w", err)
+	}
+
+	if !strings.HasPrefix(path, "gs://") {
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return fmt.Errorf("failed to write mirror progress: %w", err)
+		}
+		return nil
+	}
+
+	bucket, object, err := parseGCSPath(path)
+	if err != nil {
+		return err
+	}
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	writer := client.Bucket(bucket).Object(object).NewWriter(ctx)
+	writer.ContentType = "application/json"
+	if _, err := writer.Write(data); err != nil {
+		_ = writer.Close()
+		return fmt.Errorf("failed to write mirror progress to GCS: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("failed to finalize mirror progress in GCS: %w", err)
+	}
+	return nil
+}
+
+func parseGCSPath(path string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimPrefix(path, "gs://"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid GCS path format: %s (expected gs://bucket/object)", path)
+	}
+	return parts[0], parts[1], nil
+}
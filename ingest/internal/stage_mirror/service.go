@@ -0,0 +1,222 @@
+package stage_mirror
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v9"
+	"github.com/greenearth/ingest/internal/common"
+)
+
+// DefaultIndices are the aliases mirrored when none are configured
+var DefaultIndices = []string{"posts", "replies", "likes"}
+
+// Config holds the configuration for a mirror run
+type Config struct {
+	Indices       []string
+	SamplePercent float64       // Percentage of author DIDs mirrored (0-100)
+	AllowDIDs     []string      // Authors always mirrored, regardless of the sample
+	PageSize      int           // Documents per source search and target bulk request (default 1000)
+	Lookback      time.Duration // How far back an index with no progress starts (default 24h)
+	Settle        time.Duration // Documents indexed more recently than this are left for the next run (default 1m)
+	DryRun        bool
+}
+
+// Service copies a sample of documents from a source cluster into the write
+// aliases of a target cluster, in indexed_at order
+type Service struct {
+	source *elasticsearch.Client
+	target *elasticsearch.Client
+	config Config
+	allow  map[string]bool
+	logger *common.IngestLogger
+}
+
+// NewService creates a mirror from source to target
+func NewService(source, target *elasticsearch.Client, config Config, logger *common.IngestLogger) *Service {
+	if len(config.Indices) == 0 {
+		config.Indices = DefaultIndices
+	}
+	if config.PageSize <= 0 {
+		config.PageSize = 1000
+	}
+	if config.Lookback <= 0 {
+		config.Lookback = 24 * time.Hour
+	}
+	if config.Settle <= 0 {
+		config.Settle = time.Minute
+	}
+	allow := make(map[string]bool, len(config.AllowDIDs))
+	for _, did := range config.AllowDIDs {
+		if did != "" {
+			allow[did] = true
+		}
+	}
+	return &Service{source: source, target: target, config: config, allow: allow, logger: logger}
+}
+
+// Mirror copies every sampled document indexed since each index's progress
+// and up to now minus the settle time. save is called with the updated
+// progress after every page written, so an interrupted run resumes where it
+// stopped.
+func (s *Service) Mirror(ctx context.Context, progress *Progress, now time.Time, save func(*Progress) error) error {
+	until := now.Add(-s.config.Settle).UTC()
+	for _, index := range s.config.Indices {
+		if err := s.mirrorIndex(ctx, index, progress, now, until, save); err != nil {
+			return fmt.Errorf("mirror %s: %w", index, err)
+		}
+	}
+	return nil
+}
+
+// keep reports whether an author's documents are mirrored
+func (s *Service) keep(did string) bool {
+	return s.allow[did] || common.SampleDIDPercent(did, s.config.SamplePercent)
+}
+
+type mirrorHit struct {
+	Source json.RawMessage   `json:"_source"`
+	Sort   []json.RawMessage `json:"sort"`
+}
+
+type mirrorSearchResponse struct {
+	Hits struct {
+		Hits []mirrorHit `json:"hits"`
+	} `json:"hits"`
+}
+
+type mirrorDoc struct {
+	AtURI     string `json:"at_uri"`
+	AuthorDID string `json:"author_did"`
+	IndexedAt string `json:"indexed_at"`
+}
+
+func (s *Service) mirrorIndex(ctx context.Context, index string, progress *Progress, now, until time.Time, save func(*Progress) error) error {
+	cursor := progress.index(index)
+	if cursor.IndexedAt == "" {
+		cursor.IndexedAt = now.Add(-s.config.Lookback).UTC().Format(time.RFC3339Nano)
+		s.logger.Info("No progress for %s, starting from %s", index, cursor.IndexedAt)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		hits, err := s.search(ctx, index, cursor, until)
+		if err != nil {
+			return err
+		}
+		if len(hits) == 0 {
+			break
+		}
+
+		var docs []common.RawDoc
+		var skipped int64
+		for _, hit := range hits {
+			var doc mirrorDoc
+			if err := json.Unmarshal(hit.Source, &doc); err != nil || doc.AtURI == "" {
+				skipped++
+				continue
+			}
+			if !s.keep(doc.AuthorDID) {
+				skipped++
+				continue
+			}
+			docs = append(docs, common.RawDoc{AtURI: doc.AtURI, AuthorDID: doc.AuthorDID, Source: hit.Source})
+		}
+
+		if len(docs) > 0 {
+			if err := common.BulkIndex(ctx, s.target, common.WriteAlias(index), docs, s.config.DryRun, s.logger); err != nil {
+				return err
+			}
+		}
+
+		last := hits[len(hits)-1]
+		var lastDoc mirrorDoc
+		if err := json.Unmarshal(last.Source, &lastDoc); err == nil && lastDoc.IndexedAt != "" {
+			cursor.IndexedAt = lastDoc.IndexedAt
+		}
+		cursor.After = last.Sort
+		cursor.Copied += int64(len(docs))
+		cursor.Skipped += skipped
+		cursor.UpdatedAt = time.Now().UTC()
+
+		s.logger.Metric("stage_mirror.copied_count", float64(len(docs)))
+		s.logger.Metric("stage_mirror.skipped_count", float64(skipped))
+		s.logger.Debug("Mirrored %d of %d %s documents (through %s)", len(docs), len(hits), index, cursor.IndexedAt)
+
+		if !s.config.DryRun {
+			if err := save(progress); err != nil {
+				return err
+			}
+		}
+		if len(hits) < s.config.PageSize {
+			break
+		}
+	}
+
+	if indexedAt, err := time.Parse(time.RFC3339Nano, cursor.IndexedAt); err == nil {
+		lag := now.Sub(indexedAt)
+		s.logger.Metric("stage_mirror.lag_sec", lag.Seconds())
+		s.logger.Info("%s: %d copied, %d skipped in total; mirrored through %s (%s behind)",
+			index, cursor.Copied, cursor.Skipped, cursor.IndexedAt, lag.Round(time.Second))
+	}
+	return nil
+}
+
+// search returns the next page of documents after cursor, sorted by
+// indexed_at with at_uri breaking ties so paging never skips or repeats
+func (s *Service) search(ctx context.Context, index string, cursor *IndexProgress, until time.Time) ([]mirrorHit, error) {
+	indexedAt := map[string]interface{}{"lt": until.Format(time.RFC3339Nano)}
+	if len(cursor.After) == 0 {
+		indexedAt["gte"] = cursor.IndexedAt
+	}
+	body := map[string]interface{}{
+		"size": s.config.PageSize,
+		"query": map[string]interface{}{
+			"range": map[string]interface{}{"indexed_at": indexedAt},
+		},
+		"sort": []interface{}{
+			map[string]interface{}{"indexed_at": "asc"},
+			map[string]interface{}{"at_uri": "asc"},
+		},
+	}
+	if len(cursor.After) > 0 {
+		body["search_after"] = cursor.After
+	}
+
+	bodyJSON, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query: %w", err)
+	}
+
+	start := time.Now()
+	res, err := s.source.Search(
+		s.source.Search.WithContext(ctx),
+		s.source.Search.WithIndex(index),
+		s.source.Search.WithBody(bytes.NewReader(bodyJSON)),
+	)
+	s.logger.Metric("es.stage_mirror_search.duration_ms", float64(time.Since(start).Milliseconds()))
+	if err != nil {
+		return nil, fmt.Errorf("search request failed: %w", err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			s.logger.Error("Failed to close search response body: %v", err)
+		}
+	}()
+
+	if res.IsError() {
+		return nil, fmt.Errorf("search request returned error: %s", res.String())
+	}
+
+	var response mirrorSearchResponse
+	if err := json.NewDecoder(res.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to parse search response: %w", err)
+	}
+	return response.Hits.Hits, nil
+}
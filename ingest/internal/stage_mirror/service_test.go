@@ -0,0 +1,128 @@
+package stage_mirror
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greenearth/ingest/internal/common"
+	"github.com/greenearth/ingest/internal/estest"
+)
+
+// sourceHandler serves two pages of posts: a full first page and a final
+// page of one, recording each search body
+func sourceHandler(searches *[]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*searches = append(*searches, string(body))
+		if len(*searches) == 1 {
+			_, _ = w.Write([]byte(`{"hits":{"hits":[
+				{"_source":{"at_uri":"at://did:plc:allowed/app.bsky.feed.post/1","author_did":"did:plc:allowed","indexed_at":"2025-06-01T00:00:01Z"},"sort":[1748736001000,"at://did:plc:allowed/app.bsky.feed.post/1"]},
+				{"_source":{"at_uri":"at://did:plc:other/app.bsky.feed.post/2","author_did":"did:plc:other","indexed_at":"2025-06-01T00:00:02Z"},"sort":[1748736002000,"at://did:plc:other/app.bsky.feed.post/2"]}
+			]}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"hits":{"hits":[
+			{"_source":{"at_uri":"at://did:plc:allowed/app.bsky.feed.post/3","author_did":"did:plc:allowed","indexed_at":"2025-06-01T00:00:03Z","like_count":4},"sort":[1748736003000,"at://did:plc:allowed/app.bsky.feed.post/3"]}
+		]}}`))
+	}
+}
+
+func TestMirror_CopiesAllowedAuthorsAndSavesProgress(t *testing.T) {
+	var searches []string
+	source := estest.NewClient(t, sourceHandler(&searches))
+	var bulk []string
+	target := estest.NewClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bulk = append(bulk, r.URL.Path+" "+string(body))
+		_, _ = w.Write([]byte(`{"took":1,"errors":false,"items":[]}`))
+	})
+
+	service := NewService(source, target, Config{
+		Indices:   []string{"posts"},
+		AllowDIDs: []string{"did:plc:allowed"},
+		PageSize:  2,
+	}, common.NewLogger(false))
+
+	path := filepath.Join(t.TempDir(), "progress.json")
+	progress := &Progress{}
+	saves := 0
+	save := func(p *Progress) error {
+		saves++
+		return WriteProgress(context.Background(), path, p)
+	}
+	now := time.Date(2025, 6, 1, 1, 0, 0, 0, time.UTC)
+	if err := service.Mirror(context.Background(), progress, now, save); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(searches) != 2 {
+		t.Fatalf("expected two pages, got %d searches", len(searches))
+	}
+	if !strings.Contains(searches[0], `"gte":"2025-05-31T01:00:00Z"`) || strings.Contains(searches[0], "search_after") {
+		t.Errorf("first page must start at the lookback: %s", searches[0])
+	}
+	if !strings.Contains(searches[1], `"search_after":[1748736002000,"at://did:plc:other/app.bsky.feed.post/2"]`) {
+		t.Errorf("second page must continue after the last sort values: %s", searches[1])
+	}
+
+	if len(bulk) != 2 {
+		t.Fatalf("expected a bulk request per page, got %v", bulk)
+	}
+	for _, req := range bulk {
+		if strings.Contains(req, "did:plc:other") {
+			t.Errorf("unsampled author was mirrored: %s", req)
+		}
+		if !strings.Contains(req, `"_index":"posts-write"`) || !strings.Contains(req, `"routing":"did:plc:allowed"`) {
+			t.Errorf("expected writes routed through posts-write: %s", req)
+		}
+	}
+	if !strings.Contains(bulk[1], `"like_count":4`) {
+		t.Errorf("source must be copied verbatim: %s", bulk[1])
+	}
+
+	if saves != 2 {
+		t.Errorf("expected progress saved after each page, got %d", saves)
+	}
+	saved, err := ReadProgress(context.Background(), path)
+	if err != nil {
+		t.Fatalf("unexpected error reading progress: %v", err)
+	}
+	posts := saved.Indices["posts"]
+	if posts == nil || posts.Copied != 2 || posts.Skipped != 1 || posts.IndexedAt != "2025-06-01T00:00:03Z" {
+		t.Fatalf("unexpected progress %+v", posts)
+	}
+	after, _ := json.Marshal(posts.After)
+	if string(after) != `[1748736003000,"at://did:plc:allowed/app.bsky.feed.post/3"]` {
+		t.Errorf("unexpected search_after %s", after)
+	}
+}
+
+func TestMirror_DryRunWritesNothing(t *testing.T) {
+	var searches []string
+	source := estest.NewClient(t, sourceHandler(&searches))
+	target := estest.NewClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("dry run must not touch the target: %s %s", r.Method, r.URL.Path)
+	})
+
+	service := NewService(source, target, Config{Indices: []string{"posts"}, SamplePercent: 100, PageSize: 2, DryRun: true}, common.NewLogger(false))
+	err := service.Mirror(context.Background(), &Progress{}, time.Now(), func(*Progress) error {
+		t.Errorf("dry run must not save progress")
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestReadProgress_MissingFileIsEmpty(t *testing.T) {
+	progress, err := ReadProgress(context.Background(), filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || len(progress.Indices) != 0 {
+		t.Errorf("expected empty progress, got %+v, %v", progress, err)
+	}
+}
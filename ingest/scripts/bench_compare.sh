@@ -0,0 +1,104 @@
+#!/bin/bash
+
+# bench_compare - Benchmark a base revision and the working tree, and fail if
+# any benchmark regressed by more than a threshold
+#
+# Usage (from ingest/): scripts/bench_compare.sh [base-revision]
+#
+# Each benchmark runs BENCH_COUNT times on each side and the medians are
+# compared. A benchmark regresses if its time or allocations per op grow by
+# more than BENCH_THRESHOLD percent. Benchmarks missing on either side are
+# listed but not compared. If benchstat is installed, its report follows.
+
+set -e
+
+BASE="${1:-origin/main}"
+BENCH="${BENCH:-.}"
+BENCH_COUNT="${BENCH_COUNT:-6}"
+BENCH_PKGS="${BENCH_PKGS:-./internal/common ./cmd/jetstream_ingest}"
+BENCH_THRESHOLD="${BENCH_THRESHOLD:-10}"
+GO="${GO:-go}"
+
+RED='\033[0;31m'
+GREEN='\033[0;32m'
+NC='\033[0m' # No Color
+
+PREFIX=$(git rev-parse --show-prefix)
+WORK=$(mktemp -d)
+cleanup() {
+    git worktree remove --force "$WORK/base" >/dev/null 2>&1 || true
+    rm -rf "$WORK"
+}
+trap cleanup EXIT
+
+# run_benchmarks runs the benchmarks in directory $1 into file $2. A package
+# that does not exist or build on one side is skipped there.
+run_benchmarks() {
+    local dir=$1 out=$2 pkg
+    : > "$out"
+    for pkg in $BENCH_PKGS; do
+        (cd "$dir" && $GO test -run '^$' -bench "$BENCH" -benchmem -count "$BENCH_COUNT" "$pkg") >> "$out" 2>&1 \
+            || echo "bench_compare: skipping $pkg in $dir" >&2
+    done
+}
+
+git worktree add --detach --quiet "$WORK/base" "$BASE"
+echo "Benchmarking $BASE ($(git rev-parse --short "$BASE"))..."
+run_benchmarks "$WORK/base/$PREFIX" "$WORK/base.txt"
+echo "Benchmarking the working tree..."
+run_benchmarks . "$WORK/head.txt"
+
+if command -v benchstat >/dev/null 2>&1; then
+    benchstat "$WORK/base.txt" "$WORK/head.txt" || true
+    echo
+fi
+
+awk -v threshold="$BENCH_THRESHOLD" -v red="$RED" -v green="$GREEN" -v nc="$NC" '
+function median(key, metric,    n, i, j, v, tmp) {
+    n = count[key, metric]
+    for (i = 1; i <= n; i++) tmp[i] = values[key, metric, i]
+    for (i = 2; i <= n; i++) {
+        v = tmp[i]
+        for (j = i - 1; j >= 1 && tmp[j] > v; j--) tmp[j + 1] = tmp[j]
+        tmp[j + 1] = v
+    }
+    return n % 2 ? tmp[(n + 1) / 2] : (tmp[n / 2] + tmp[n / 2 + 1]) / 2
+}
+function delta(old, new) {
+    return old == 0 ? (new == 0 ? 0 : 100) : (new - old) * 100 / old
+}
+FNR == 1 { side = (FILENAME == ARGV[1]) ? "base" : "head" }
+/^pkg: / { pkg = $2 }
+/^Benchmark/ {
+    name = $1
+    sub(/-[0-9]+$/, "", name)
+    key = side SUBSEP pkg "." name
+    seen[pkg "." name] = 1
+    for (i = 3; i < NF; i += 2) {
+        if ($(i + 1) == "ns/op" || $(i + 1) == "allocs/op") {
+            values[key, $(i + 1), ++count[key, $(i + 1)]] = $i
+        }
+    }
+}
+END {
+    printf "%-60s %14s %14s %9s %9s\n", "benchmark", "base ns/op", "head ns/op", "time", "allocs"
+    failed = 0
+    for (b in seen) {
+        base = "base" SUBSEP b; head = "head" SUBSEP b
+        if (!count[base, "ns/op"] || !count[head, "ns/op"]) {
+            printf "%-60s %s\n", b, (count[base, "ns/op"] ? "removed" : "new") | "sort"
+            continue
+        }
+        t = delta(median(base, "ns/op"), median(head, "ns/op"))
+        a = delta(median(base, "allocs/op"), median(head, "allocs/op"))
+        mark = ""
+        if (t > threshold || a > threshold) { mark = red " REGRESSED" nc; failed++ }
+        printf "%-60s %14.0f %14.0f %+8.1f%% %+8.1f%%%s\n", b, median(base, "ns/op"), median(head, "ns/op"), t, a, mark | "sort"
+    }
+    close("sort")
+    if (failed) {
+        printf "%s%d benchmark(s) regressed by more than %s%%%s\n", red, failed, threshold, nc
+        exit 1
+    }
+    printf "%sNo benchmark regressed by more than %s%%%s\n", green, threshold, nc
+}' "$WORK/base.txt" "$WORK/head.txt"
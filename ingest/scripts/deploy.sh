@@ -21,6 +21,17 @@ GE_AWS_S3_PREFIX="${GE_AWS_S3_PREFIX:-mega/}"
 GE_JETSTREAM_INSTANCES="${GE_JETSTREAM_INSTANCES:-1}"
 GE_MEGASTREAM_INSTANCES="${GE_MEGASTREAM_INSTANCES:-1}"
 
+# Malformed row handling per service: skip, quarantine (to the DLQ), or halt
+GE_JETSTREAM_STRICTNESS="${GE_JETSTREAM_STRICTNESS:-quarantine}"
+GE_FIREHOSE_STRICTNESS="${GE_FIREHOSE_STRICTNESS:-quarantine}"
+GE_MEGASTREAM_STRICTNESS="${GE_MEGASTREAM_STRICTNESS:-quarantine}"
+
+# Stream lag beyond which each service reports unhealthy. Megastream reads
+# archive files as they are published, so it trails further behind by design.
+GE_JETSTREAM_MAX_LAG="${GE_JETSTREAM_MAX_LAG:-5m}"
+GE_FIREHOSE_MAX_LAG="${GE_FIREHOSE_MAX_LAG:-5m}"
+GE_MEGASTREAM_MAX_LAG="${GE_MEGASTREAM_MAX_LAG:-30m}"
+
 # Get current git SHA (short version) for deployment tracking
 GIT_SHA=$(git rev-parse --short HEAD 2>/dev/null || echo "unknown")
 
@@ -206,7 +217,12 @@ deploy_jetstream_service() {
         --set-env-vars="GE_JETSTREAM_URL=wss://jetstream2.us-east.bsky.network/subscribe" \
         --set-env-vars="GE_LOGGING_ENABLED=true" \
         --set-env-vars="GE_GIT_SHA=$GIT_SHA" \
+        --set-env-vars="GE_LOG_FORMAT=json" \
         --set-env-vars="GE_JETSTREAM_STATE_FILE=gs://$GE_GCP_PROJECT_ID-ingex-state-$GE_ENVIRONMENT/jetstream_state.json" \
+        --set-env-vars="GE_DLQ_DESTINATION=gs://$GE_GCP_PROJECT_ID-ingex-state-$GE_ENVIRONMENT/dlq" \
+        --set-env-vars="GE_INGEST_STRICTNESS=$GE_JETSTREAM_STRICTNESS" \
+        --set-env-vars="GE_MAX_INGEST_LAG=$GE_JETSTREAM_MAX_LAG" \
+        --set-env-vars="GE_SLO_STATE_FILE=gs://$GE_GCP_PROJECT_ID-ingex-state-$GE_ENVIRONMENT/slo/jetstream_ingest.json" \
         --set-env-vars="GE_ELASTICSEARCH_URL=$GE_ELASTICSEARCH_URL" \
         --set-env-vars="GE_ELASTICSEARCH_TLS_SKIP_VERIFY=true" \
         --set-env-vars="GE_METRIC_EXPORT_INTERVAL_SEC=60" \
@@ -216,6 +232,8 @@ deploy_jetstream_service() {
         --set-env-vars="GE_BLOCKLIST_DESTINATION=gs://$GE_GCP_PROJECT_ID-ingex-blocklist-$GE_ENVIRONMENT" \
         --set-env-vars="GE_LIKE_RATE_LIMIT_PER_HOUR=600" \
         --set-env-vars="GE_INDEX_PERIOD=$GE_INDEX_PERIOD" \
+        --set-env-vars="GE_INDEX_ROLLOVER=${GE_INDEX_ROLLOVER:-false}" \
+        --set-env-vars="GE_CANARY_INTERVAL=${GE_CANARY_INTERVAL:-1m}" \
         --set-secrets="GE_ELASTICSEARCH_API_KEY=$es_api_key_secret:latest" \
         --scaling="$GE_JETSTREAM_INSTANCES" \
         --cpu=1 \
@@ -229,6 +247,53 @@ deploy_jetstream_service() {
     cleanup_old_revisions "service" "jetstream-ingest-$GE_ENVIRONMENT"
 }
 
+# The firehose service is a fallback for when Jetstream is degraded. It is not
+# part of "all"; deploy it explicitly and stop it once Jetstream recovers.
+deploy_firehose_service() {
+    log_info "Deploying firehose-ingest service from source..."
+
+    local es_api_key_secret="elasticsearch-api-key"
+    if [ "$GE_ENVIRONMENT" = "prod" ]; then
+        es_api_key_secret="elasticsearch-api-key-prod"
+    fi
+
+    gcloud run deploy "firehose-ingest-$GE_ENVIRONMENT" \
+        --source=. \
+        --region="$GE_GCP_REGION" \
+        --service-account="ingex-runner-$GE_ENVIRONMENT@$GE_GCP_PROJECT_ID.iam.gserviceaccount.com" \
+        --vpc-connector="ingex-vpc-connector-$GE_ENVIRONMENT" \
+        --vpc-egress=private-ranges-only \
+        --set-build-env-vars="GOOGLE_BUILDABLE=./cmd/firehose_ingest,GOOGLE_RUNTIME_VERSION=1.25.7" \
+        --set-env-vars="GE_FIREHOSE_URL=wss://bsky.network/xrpc/com.atproto.sync.subscribeRepos" \
+        --set-env-vars="GE_LOGGING_ENABLED=true" \
+        --set-env-vars="GE_GIT_SHA=$GIT_SHA" \
+        --set-env-vars="GE_LOG_FORMAT=json" \
+        --set-env-vars="GE_FIREHOSE_STATE_FILE=gs://$GE_GCP_PROJECT_ID-ingex-state-$GE_ENVIRONMENT/firehose_state.json" \
+        --set-env-vars="GE_DLQ_DESTINATION=gs://$GE_GCP_PROJECT_ID-ingex-state-$GE_ENVIRONMENT/dlq" \
+        --set-env-vars="GE_INGEST_STRICTNESS=$GE_FIREHOSE_STRICTNESS" \
+        --set-env-vars="GE_MAX_INGEST_LAG=$GE_FIREHOSE_MAX_LAG" \
+        --set-env-vars="GE_SLO_STATE_FILE=gs://$GE_GCP_PROJECT_ID-ingex-state-$GE_ENVIRONMENT/slo/firehose_ingest.json" \
+        --set-env-vars="GE_ELASTICSEARCH_URL=$GE_ELASTICSEARCH_URL" \
+        --set-env-vars="GE_ELASTICSEARCH_TLS_SKIP_VERIFY=true" \
+        --set-env-vars="GE_METRIC_EXPORT_INTERVAL_SEC=60" \
+        --set-env-vars="GE_ENVIRONMENT=$GE_ENVIRONMENT" \
+        --set-env-vars="GE_GCP_PROJECT_ID=$GE_GCP_PROJECT_ID" \
+        --set-env-vars="GE_GCP_REGION=$GE_GCP_REGION" \
+        --set-env-vars="GE_LIKE_RATE_LIMIT_PER_HOUR=600" \
+        --set-env-vars="GE_INDEX_PERIOD=$GE_INDEX_PERIOD" \
+        --set-env-vars="GE_INDEX_ROLLOVER=${GE_INDEX_ROLLOVER:-false}" \
+        --set-secrets="GE_ELASTICSEARCH_API_KEY=$es_api_key_secret:latest" \
+        --scaling=1 \
+        --cpu=2 \
+        --memory=1Gi \
+        --timeout=3600 \
+        --concurrency=1000 \
+        --no-cpu-throttling \
+        --allow-unauthenticated
+
+    cleanup_old_revisions "service" "firehose-ingest-$GE_ENVIRONMENT"
+}
+
 deploy_megastream_service() {
     log_info "Deploying megastream-ingest service from source..."
 
@@ -274,9 +339,14 @@ deploy_megastream_service() {
         --set-build-env-vars="GOOGLE_BUILDABLE=./cmd/megastream_ingest,GOOGLE_RUNTIME_VERSION=1.25.7" \
         --set-env-vars="GE_LOGGING_ENABLED=true" \
         --set-env-vars="GE_GIT_SHA=$GIT_SHA" \
+        --set-env-vars="GE_LOG_FORMAT=json" \
         --set-env-vars="GE_SPOOL_INTERVAL_SEC=60" \
         --set-env-vars="GE_AWS_REGION=us-east-1" \
         --set-env-vars="GE_MEGASTREAM_STATE_FILE=gs://$GE_GCP_PROJECT_ID-ingex-state-$GE_ENVIRONMENT/megastream_state.json" \
+        --set-env-vars="GE_DLQ_DESTINATION=gs://$GE_GCP_PROJECT_ID-ingex-state-$GE_ENVIRONMENT/dlq" \
+        --set-env-vars="GE_INGEST_STRICTNESS=$GE_MEGASTREAM_STRICTNESS" \
+        --set-env-vars="GE_MAX_INGEST_LAG=$GE_MEGASTREAM_MAX_LAG" \
+        --set-env-vars="GE_SLO_STATE_FILE=gs://$GE_GCP_PROJECT_ID-ingex-state-$GE_ENVIRONMENT/slo/megastream_ingest.json" \
         --set-env-vars="GE_ELASTICSEARCH_URL=$GE_ELASTICSEARCH_URL" \
         --set-env-vars="GE_ELASTICSEARCH_TLS_SKIP_VERIFY=true" \
         --set-env-vars="GE_METRIC_EXPORT_INTERVAL_SEC=60" \
@@ -286,6 +356,7 @@ deploy_megastream_service() {
         --set-env-vars="GE_AWS_S3_BUCKET=$GE_AWS_S3_BUCKET" \
         --set-env-vars="GE_AWS_S3_PREFIX=$GE_AWS_S3_PREFIX" \
         --set-env-vars="GE_INDEX_PERIOD=$GE_INDEX_PERIOD" \
+        --set-env-vars="GE_INDEX_ROLLOVER=${GE_INDEX_ROLLOVER:-false}" \
         --set-env-vars="GE_INFERENCE_BASE_URL=$inference_base_url" \
         --set-secrets="GE_ELASTICSEARCH_API_KEY=$es_api_key_secret:latest,GE_AWS_S3_ACCESS_KEY=$aws_access_key_secret:latest,GE_AWS_S3_SECRET_KEY=$aws_secret_key_secret:latest,GE_INFERENCE_API_KEY=$inference_api_key_secret:latest" \
         --scaling="$GE_MEGASTREAM_INSTANCES" \
@@ -376,6 +447,7 @@ EOF
         --set-secrets="GE_ELASTICSEARCH_API_KEY=$es_api_key_secret:latest" \
         --set-env-vars="GE_LOGGING_ENABLED=true" \
         --set-env-vars="GE_GIT_SHA=$GIT_SHA" \
+        --set-env-vars="GE_LOG_FORMAT=json" \
         --set-env-vars="GE_GCP_PROJECT_ID=$GE_GCP_PROJECT_ID" \
         --set-env-vars="GE_ENVIRONMENT=$GE_ENVIRONMENT" \
         --set-env-vars="GE_GCP_REGION=$GE_GCP_REGION" \
@@ -431,6 +503,7 @@ deploy_extract_job() {
         --set-secrets="GE_ELASTICSEARCH_API_KEY=$es_api_key_secret:latest" \
         --set-env-vars="GE_LOGGING_ENABLED=true" \
         --set-env-vars="GE_GIT_SHA=$GIT_SHA" \
+        --set-env-vars="GE_LOG_FORMAT=json" \
         --set-env-vars="^|^GE_EXTRACT_INDICES=posts,likes,hashtags,replies" \
         --set-env-vars="GE_PARQUET_DESTINATION=gs://$destination_bucket" \
         --set-env-vars="GE_PARQUET_MAX_RECORDS=$max_records" \
@@ -446,6 +519,59 @@ deploy_extract_job() {
     cleanup_old_revisions "job" "extract-$GE_ENVIRONMENT"
 }
 
+deploy_mirror_job() {
+    log_info "Deploying stage-mirror job from source..."
+
+    # The mirror writes a sample of prod into this environment's cluster, so it
+    # only exists in stage
+    if [ "$GE_ENVIRONMENT" != "stage" ]; then
+        log_warn "stage-mirror is only deployed to stage; skipping for $GE_ENVIRONMENT"
+        return 0
+    fi
+    if [ -z "$GE_MIRROR_SOURCE_URL" ]; then
+        log_error "GE_MIRROR_SOURCE_URL (prod Elasticsearch URL reachable from stage) is required"
+        exit 1
+    fi
+
+    local temp_dir=$(mktemp -d)
+    trap "rm -rf $temp_dir" EXIT
+
+    cp go.mod go.sum "$temp_dir/"
+    cp -r internal "$temp_dir/"
+    mkdir -p "$temp_dir/cmd/stage_mirror"
+    cp cmd/stage_mirror/main.go "$temp_dir/cmd/stage_mirror/"
+    cp cmd/stage_mirror/main.go "$temp_dir/"
+
+    log_info "Deploying stage-mirror job with buildpacks..."
+
+    gcloud run jobs deploy "stage-mirror-$GE_ENVIRONMENT" \
+        --source="$temp_dir" \
+        --region="$GE_GCP_REGION" \
+        --service-account="ingex-runner-$GE_ENVIRONMENT@$GE_GCP_PROJECT_ID.iam.gserviceaccount.com" \
+        --vpc-connector="ingex-vpc-connector-$GE_ENVIRONMENT" \
+        --vpc-egress=private-ranges-only \
+        --set-env-vars="GE_ELASTICSEARCH_URL=$GE_ELASTICSEARCH_URL" \
+        --set-env-vars="GE_ELASTICSEARCH_TLS_SKIP_VERIFY=true" \
+        --set-secrets="GE_ELASTICSEARCH_API_KEY=elasticsearch-api-key:latest" \
+        --set-env-vars="GE_MIRROR_SOURCE_URL=$GE_MIRROR_SOURCE_URL" \
+        --set-secrets="GE_MIRROR_SOURCE_API_KEY=elasticsearch-mirror-source-api-key:latest" \
+        --set-env-vars="GE_MIRROR_STATE_FILE=gs://$GE_GCP_PROJECT_ID-ingex-state-$GE_ENVIRONMENT/stage_mirror_state.json" \
+        --set-env-vars="^|^GE_MIRROR_ALLOW_DIDS=${GE_MIRROR_ALLOW_DIDS:-}" \
+        --set-env-vars="GE_LOGGING_ENABLED=true" \
+        --set-env-vars="GE_GIT_SHA=$GIT_SHA" \
+        --set-env-vars="GE_LOG_FORMAT=json" \
+        --set-env-vars="GE_GCP_PROJECT_ID=$GE_GCP_PROJECT_ID" \
+        --set-env-vars="GE_ENVIRONMENT=$GE_ENVIRONMENT" \
+        --set-env-vars="GE_GCP_REGION=$GE_GCP_REGION" \
+        --set-env-vars="GE_METRIC_EXPORT_INTERVAL_SEC=60" \
+        --cpu=1 \
+        --memory=1Gi \
+        --task-timeout=3600 \
+        --args="--sample-percent,${GE_MIRROR_SAMPLE_PERCENT:-10}"
+
+    cleanup_old_revisions "job" "stage-mirror-$GE_ENVIRONMENT"
+}
+
 deploy_all_services() {
     log_info "Deploying all services to Cloud Run..."
 
@@ -522,6 +648,10 @@ main() {
             log_info "Deploying jetstream-ingest service..."
             deploy_jetstream_service
             ;;
+        firehose|firehose-ingest)
+            log_info "Deploying firehose-ingest service..."
+            deploy_firehose_service
+            ;;
         megastream|megastream-ingest)
             log_info "Deploying megastream-ingest service..."
             deploy_megastream_service
@@ -534,12 +664,16 @@ main() {
             log_info "Deploying extract job..."
             deploy_extract_job
             ;;
+        mirror|stage-mirror)
+            log_info "Deploying stage-mirror job..."
+            deploy_mirror_job
+            ;;
         all)
             deploy_all_services
             ;;
         *)
             log_error "Unknown service: $service"
-            echo "Valid services: jetstream, megastream, expiry, extract, all"
+            echo "Valid services: jetstream, firehose, megastream, expiry, extract, mirror, all"
             exit 1
             ;;
     esac
@@ -583,9 +717,11 @@ while [[ $# -gt 0 ]]; do
             echo
             echo "Services:"
             echo "  jetstream                   Deploy jetstream-ingest service only"
+            echo "  firehose                    Deploy firehose-ingest service only (Jetstream fallback; not in all)"
             echo "  megastream                  Deploy megastream-ingest service only"
             echo "  expiry                      Deploy elasticsearch-expiry job only"
             echo "  extract                     Deploy extract job only"
+            echo "  mirror                      Deploy stage-mirror job only (stage only; not in all)"
             echo "  all                         Deploy all services (default)"
             echo
             echo "Examples:"
@@ -614,10 +750,13 @@ while [[ $# -gt 0 ]]; do
             echo "  GE_ELASTICSEARCH_URL           Elasticsearch URL (auto-detect internal LB)"
             echo "  GE_AWS_S3_BUCKET               S3 bucket name (default: graze-mega-02)"
             echo "  GE_AWS_S3_PREFIX               S3 prefix (default: mega/)"
+            echo "  GE_MIRROR_SOURCE_URL           Prod Elasticsearch URL for the stage mirror"
+            echo "  GE_MIRROR_SAMPLE_PERCENT       Percentage of authors the stage mirror copies (default: 10)"
+            echo "  GE_MIRROR_ALLOW_DIDS           Comma-separated DIDs the stage mirror always copies"
             echo
             exit 0
             ;;
-        jetstream|megastream|expiry|extract|all)
+        jetstream|megastream|expiry|extract|mirror|all)
             # Handle service as first positional argument
             break
             ;;
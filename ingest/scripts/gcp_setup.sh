@@ -514,6 +514,52 @@ setup_extract_cloud_scheduler() {
     fi
 }
 
+setup_mirror_cloud_scheduler() {
+    # The stage mirror only runs in stage
+    if [ "$GE_ENVIRONMENT" != "stage" ]; then
+        return 0
+    fi
+    log_info "Setting up Cloud Scheduler for stage-mirror..."
+
+    COMPUTE_SERVICE_ACCOUNT="21637448064-compute@developer.gserviceaccount.com"
+    JOB_URI="https://run.googleapis.com/v2/projects/$GE_GCP_PROJECT_ID/locations/$GE_GCP_REGION/jobs/stage-mirror-$GE_ENVIRONMENT:run"
+
+    local schedule="15 * * * *"  # Hourly
+    local job_name="stage-mirror-hourly-stage"
+    local description="Hourly sampled copy of prod data into stage"
+
+    if ! gcloud run jobs describe "stage-mirror-$GE_ENVIRONMENT" --region="$GE_GCP_REGION" > /dev/null 2>&1; then
+        log_info "stage-mirror job not deployed yet; run './scripts/deploy.sh mirror' and re-run setup to schedule it"
+        return 0
+    fi
+
+    gcloud run jobs add-iam-policy-binding "stage-mirror-$GE_ENVIRONMENT" \
+        --region="$GE_GCP_REGION" \
+        --member="serviceAccount:$COMPUTE_SERVICE_ACCOUNT" \
+        --role="roles/run.invoker" \
+        2>/dev/null || log_info "Service account already has run.invoker permission"
+
+    if ! gcloud scheduler jobs describe "$job_name" --location="$GE_GCP_REGION" > /dev/null 2>&1; then
+        gcloud scheduler jobs create http "$job_name" \
+            --location="$GE_GCP_REGION" \
+            --schedule="$schedule" \
+            --uri="$JOB_URI" \
+            --http-method=POST \
+            --oauth-service-account-email="$COMPUTE_SERVICE_ACCOUNT" \
+            --description="$description"
+        log_info "Cloud Scheduler job created: $job_name"
+    else
+        gcloud scheduler jobs update http "$job_name" \
+            --location="$GE_GCP_REGION" \
+            --schedule="$schedule" \
+            --uri="$JOB_URI" \
+            --http-method=POST \
+            --oauth-service-account-email="$COMPUTE_SERVICE_ACCOUNT" \
+            --description="$description"
+        log_info "Cloud Scheduler job updated: $job_name"
+    fi
+}
+
 main() {
     echo "=================================================="
     echo "Green Earth Ingex - GCP Environment Setup"
@@ -536,6 +582,7 @@ main() {
     setup_firewall_rules
     setup_expiry_cloud_scheduler
     setup_extract_cloud_scheduler
+    setup_mirror_cloud_scheduler
 
     log_info "Environment setup complete!"
     echo
@@ -70,15 +70,15 @@ console = Console()
 INDEX_TYPES: dict[str, dict[str, str]] = {
     "posts": {
         "pattern": "posts-*",
-        "active_alias": "posts",    # write alias used by megastream/jetstream ingest
+        "active_alias": "posts",    # ingest writes through posts-write
     },
     "replies": {
         "pattern": "replies-*",
-        "active_alias": "replies",  # write alias used by megastream ingest
+        "active_alias": "replies",  # ingest writes through replies-write
     },
     "likes": {
         "pattern": "likes-*",
-        "active_alias": "likes",    # write alias used by jetstream ingest
+        "active_alias": "likes",    # ingest writes through likes-write
     },
 }
 
@@ -155,23 +155,31 @@ def _git_short_hash() -> str:
 
 
 async def _active_index_for(es: AsyncElasticsearch, alias: str) -> str | None:
-    """Return the index with is_write_index:true for alias, or None if alias doesn't exist."""
-    try:
-        resp = await es.indices.get_alias(name=alias)
+    """Return the index ingest currently writes to for alias, or None if alias doesn't exist.
+
+    Ingest writes through ``<alias>-write``. In rollover mode the read alias has
+    no write index, so the write alias is checked first; the read alias's own
+    is_write_index flag covers clusters that predate write aliases.
+    """
+    for name in (f"{alias}-write", alias):
+        try:
+            resp = await es.indices.get_alias(name=name)
+        except NotFoundError:
+            continue
+        except AuthorizationException:
+            _die(
+                f"User lacks 'view_index_metadata' privilege needed to read alias '{name}'. "
+                f"Use --include-active to skip the active-index check "
+                f"(only safe after the write period rolls over)."
+            )
         # Prefer the explicit write index; fall back to the sole member if unambiguous.
         for index_name, info in resp.items():
-            if info.get("aliases", {}).get(alias, {}).get("is_write_index"):
+            if info.get("aliases", {}).get(name, {}).get("is_write_index"):
                 return index_name
         indices = list(resp.keys())
-        return indices[0] if len(indices) == 1 else None
-    except NotFoundError:
-        return None
-    except AuthorizationException:
-        _die(
-            f"User lacks 'view_index_metadata' privilege needed to read alias '{alias}'. "
-            f"Use --include-active to skip the active-index check "
-            f"(only safe after the write period rolls over)."
-        )
+        if len(indices) == 1:
+            return indices[0]
+    return None
 
 
 async def _list_indices(es: AsyncElasticsearch, pattern: str) -> list[str]: